@@ -0,0 +1,272 @@
+// Package addscan streams the files added to the node to a scanner, such as
+// an antivirus, which can reject them and so fail the add.
+//
+// The data of a file is sent to the scanner while it is being added, and its
+// verdict is awaited once the file is read. A rejected file fails the add:
+// nothing is pinned, and the blocks written are removed by the next garbage
+// collection. The scanner is an HTTP service, sent the data of each file in
+// the body of a POST request, or an ICAP service (RFC 3507), sent RESPMOD
+// requests.
+package addscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var log = logging.Logger("addscan")
+
+var scans = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ipfs_addscan_files_total",
+	Help: "files added scanned, by result: accepted, rejected or failed",
+}, []string{"result"})
+
+// maxReasonSize is the largest reason of a rejection read from the scanner.
+const maxReasonSize = 1024
+
+// Settings configures the scanner.
+type Settings struct {
+	// URL is the URL of the scanner: an http or https URL the files are
+	// posted to, or an icap URL of the service the files are sent to.
+	URL string
+	// Header is sent with the requests.
+	Header http.Header
+	// Timeout is how long the scanner may take to read the data sent to it,
+	// and to give its verdict once it has all the data of a file.
+	Timeout time.Duration
+	// FailOpen accepts the files the scanner fails to scan, which are
+	// rejected otherwise.
+	FailOpen bool
+}
+
+// RejectedError is the error of a file rejected by the scanner.
+type RejectedError struct {
+	// Name is the path of the file in the data added.
+	Name string
+	// Reason is why the scanner rejected the file, as told by it.
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = "file"
+	}
+	if e.Reason == "" {
+		return name + " rejected by the scanner"
+	}
+	return name + " rejected by the scanner: " + e.Reason
+}
+
+// scanFunc sends the data of the file name read from r to the scanner, and
+// returns its verdict.
+type scanFunc func(ctx context.Context, name string, r io.Reader) error
+
+// Scanner scans the files added.
+type Scanner struct {
+	scan     scanFunc
+	timeout  time.Duration
+	failOpen bool
+}
+
+// New returns the scanner of s.
+func New(s Settings) (*Scanner, error) {
+	if s.Timeout <= 0 {
+		return nil, fmt.Errorf("scan timeout must be positive: %s", s.Timeout)
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanner URL %q: %w", s.URL, err)
+	}
+
+	sc := &Scanner{timeout: s.Timeout, failOpen: s.FailOpen}
+	switch u.Scheme {
+	case "http", "https":
+		client := &http.Client{}
+		sc.scan = func(ctx context.Context, name string, r io.Reader) error {
+			return scanHTTP(ctx, client, s.URL, s.Header, name, r)
+		}
+	case "icap":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid scanner URL %q: no host", s.URL)
+		}
+		sc.scan = func(ctx context.Context, name string, r io.Reader) error {
+			return scanICAP(ctx, u, s.Header, name, r)
+		}
+	default:
+		return nil, fmt.Errorf("invalid scanner URL %q: not an http, https or icap URL", s.URL)
+	}
+	return sc, nil
+}
+
+// verdict returns the verdict err of the scanner on the file name, or nil if
+// the scanner failed and fails open.
+func (s *Scanner) verdict(name string, err error) error {
+	var rejected *RejectedError
+	switch {
+	case err == nil:
+		scans.WithLabelValues("accepted").Inc()
+		return nil
+	case errors.As(err, &rejected):
+		scans.WithLabelValues("rejected").Inc()
+		rejected.Name = name
+		return rejected
+	default:
+		scans.WithLabelValues("failed").Inc()
+		if s.failOpen {
+			log.Warnf("accepting %s, the scanner failed: %s", name, err)
+			return nil
+		}
+		return fmt.Errorf("scanning %s: %w", name, err)
+	}
+}
+
+// scanReader sends the data it reads to the scanner.
+type scanReader struct {
+	s    *Scanner
+	ctx  context.Context
+	name string
+	r    io.Reader
+
+	started bool
+	pw      *io.PipeWriter
+	cancel  context.CancelFunc
+	result  chan error
+	// idle cancels the scan when the scanner stops reading the data,
+	// setting stalled
+	idle    *time.Timer
+	stalled int32
+	// done is set once the verdict is in, err being the error returned
+	// from then on
+	done bool
+	err  error
+}
+
+func (sr *scanReader) start() {
+	sr.started = true
+	pr, pw := io.Pipe()
+	ctx, cancel := context.WithCancel(sr.ctx)
+	sr.pw, sr.cancel = pw, cancel
+	sr.result = make(chan error, 1)
+	sr.idle = time.AfterFunc(sr.s.timeout, func() {
+		atomic.StoreInt32(&sr.stalled, 1)
+		cancel()
+	})
+	sr.idle.Stop()
+	go func() {
+		err := sr.s.scan(ctx, sr.name, pr)
+		// the rest of the data is not sent once the scanner is done
+		pr.CloseWithError(io.ErrClosedPipe)
+		sr.result <- err
+	}()
+}
+
+// wait waits for the verdict of the scanner, for up to the timeout of the
+// scanner.
+func (sr *scanReader) wait() error {
+	timer := time.NewTimer(sr.s.timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case err = <-sr.result:
+	case <-timer.C:
+		sr.cancel()
+		<-sr.result
+		err = errors.New("timed out waiting for the verdict of the scanner")
+	}
+	if atomic.LoadInt32(&sr.stalled) == 1 {
+		err = errors.New("the scanner stopped reading the data")
+	}
+	sr.cancel()
+	sr.done = true
+	sr.err = sr.s.verdict(sr.name, err)
+	return sr.err
+}
+
+func (sr *scanReader) Read(p []byte) (int, error) {
+	if sr.err != nil {
+		return 0, sr.err
+	}
+	if !sr.started {
+		sr.start()
+	}
+
+	n, err := sr.r.Read(p)
+	if n > 0 && !sr.done {
+		sr.idle.Reset(sr.s.timeout)
+		_, werr := sr.pw.Write(p[:n])
+		sr.idle.Stop()
+		if werr != nil {
+			// the scanner stopped reading the data, its verdict is
+			// final
+			if verr := sr.wait(); verr != nil {
+				return 0, verr
+			}
+		}
+	}
+	switch {
+	case err == io.EOF && !sr.done:
+		sr.pw.Close()
+		if verr := sr.wait(); verr != nil {
+			return n, verr
+		}
+	case err != nil && err != io.EOF && !sr.done:
+		sr.pw.CloseWithError(err)
+		sr.cancel()
+	}
+	return n, err
+}
+
+// Close stops the scan if it is not done.
+func (sr *scanReader) Close() error {
+	if sr.started && !sr.done {
+		sr.done = true
+		sr.pw.CloseWithError(errors.New("file not read entirely"))
+		sr.cancel()
+	}
+	return nil
+}
+
+// scanHTTP posts the data of r to the scanner at u, which accepts the file
+// with a 2xx response and rejects it with a 4xx one, whose body is the
+// reason.
+func scanHTTP(ctx context.Context, client *http.Client, u string, header http.Header, name string, r io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, r)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if name != "" {
+		req.Header.Set("X-Ipfs-Filename", url.PathEscape(name))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	reason, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxReasonSize))
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return nil
+	case res.StatusCode >= 400 && res.StatusCode < 500:
+		return &RejectedError{Reason: strings.TrimSpace(string(reason))}
+	default:
+		return fmt.Errorf("unexpected response from the scanner: %s", res.Status)
+	}
+}
@@ -0,0 +1,220 @@
+package addscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// readAll reads the files of nd as an add does, and returns the names of the
+// files read and the first error.
+func readAll(nd files.Node) ([]string, error) {
+	var names []string
+	err := files.Walk(nd, func(name string, nd files.Node) error {
+		f, ok := nd.(files.File)
+		if !ok {
+			return nil
+		}
+		defer f.Close()
+		if _, err := io.Copy(ioutil.Discard, f); err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func testDir() files.Directory {
+	return files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("clean")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"b.bin": files.NewBytesFile(bytes.Repeat([]byte("x"), 1<<20)),
+		}),
+	})
+}
+
+func newScanner(t *testing.T, u string, timeout time.Duration, failOpen bool) *Scanner {
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer key")
+	s, err := New(Settings{URL: u, Header: header, Timeout: timeout, FailOpen: failOpen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	for _, s := range []Settings{
+		{URL: "ftp://scanner.example.net", Timeout: time.Second},
+		{URL: "icap:///avscan", Timeout: time.Second},
+		{URL: "http://scanner.example.net"},
+	} {
+		if _, err := New(s); err == nil {
+			t.Errorf("expected %+v to fail", s)
+		}
+	}
+}
+
+func TestScanHTTP(t *testing.T) {
+	var mu sync.Mutex
+	scanned := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "who are you?", http.StatusInternalServerError)
+			return
+		}
+		data, _ := ioutil.ReadAll(r.Body)
+		name, _ := url.PathUnescape(r.Header.Get("X-Ipfs-Filename"))
+		mu.Lock()
+		scanned[name] = len(data)
+		mu.Unlock()
+		if bytes.Contains(data, []byte("EICAR")) {
+			http.Error(w, "Eicar-Test-Signature", http.StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+	s := newScanner(t, ts.URL, 10*time.Second, false)
+
+	names, err := readAll(s.Wrap(context.Background(), testDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(names) != "[a.txt sub/b.bin]" {
+		t.Fatalf("unexpected files read %v", names)
+	}
+	if scanned["a.txt"] != 5 || scanned["sub/b.bin"] != 1<<20 {
+		t.Fatalf("unexpected files scanned %v", scanned)
+	}
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.txt": files.NewBytesFile([]byte("clean")),
+		"eicar": files.NewBytesFile([]byte(eicar)),
+	})
+	_, err = readAll(s.Wrap(context.Background(), dir))
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || rejected.Name != "eicar" || rejected.Reason != "Eicar-Test-Signature" {
+		t.Fatalf("expected eicar rejected, got %v", err)
+	}
+}
+
+func TestScanFailure(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	var rejected *RejectedError
+	_, err := readAll(newScanner(t, failing.URL, 10*time.Second, false).Wrap(context.Background(), testDir()))
+	if err == nil || errors.As(err, &rejected) {
+		t.Fatalf("expected the scan to fail, got %v", err)
+	}
+	if _, err := readAll(newScanner(t, failing.URL, 10*time.Second, true).Wrap(context.Background(), testDir())); err != nil {
+		t.Fatalf("expected the files accepted, got %v", err)
+	}
+
+	// a scanner not reading the data, or not answering, times out
+	release := make(chan struct{})
+	stalled := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stalled.Close()
+	defer close(release)
+	start := time.Now()
+	_, err = readAll(newScanner(t, stalled.URL, 200*time.Millisecond, false).Wrap(context.Background(), testDir()))
+	if err == nil || errors.As(err, &rejected) {
+		t.Fatalf("expected the scan to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the scan to time out, took %s", elapsed)
+	}
+}
+
+// icapServer serves an ICAP service rejecting the files containing EICAR.
+func icapServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveICAP(conn)
+		}
+	}()
+	return "icap://" + l.Addr().String() + "/avscan"
+}
+
+func serveICAP(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	tp := textproto.NewReader(br)
+	if line, err := tp.ReadLine(); err != nil || !strings.HasPrefix(line, "RESPMOD icap://") {
+		return
+	}
+	h, err := tp.ReadMIMEHeader()
+	if err != nil || h.Get("Authorization") != "Bearer key" {
+		fmt.Fprint(conn, "ICAP/1.0 403 Forbidden\r\n\r\n")
+		return
+	}
+	var bodyOffset int
+	for _, part := range strings.Split(h.Get("Encapsulated"), ",") {
+		if v := strings.TrimPrefix(strings.TrimSpace(part), "res-body="); v != strings.TrimSpace(part) {
+			bodyOffset, _ = strconv.Atoi(v)
+		}
+	}
+	if _, err := io.CopyN(ioutil.Discard, br, int64(bodyOffset)); err != nil {
+		return
+	}
+	data, err := ioutil.ReadAll(httputil.NewChunkedReader(br))
+	if err != nil {
+		return
+	}
+	if bytes.Contains(data, []byte("EICAR")) {
+		fmt.Fprint(conn, "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: null-body=0\r\n\r\n")
+		return
+	}
+	fmt.Fprint(conn, "ICAP/1.0 204 No Content\r\n\r\n")
+}
+
+func TestScanICAP(t *testing.T) {
+	s := newScanner(t, icapServer(t), 10*time.Second, false)
+
+	if _, err := readAll(s.Wrap(context.Background(), testDir())); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"eicar": files.NewBytesFile([]byte(eicar)),
+	})
+	_, err := readAll(s.Wrap(context.Background(), dir))
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) || !strings.Contains(rejected.Reason, "Eicar-Test-Signature") {
+		t.Fatalf("expected eicar rejected, got %v", err)
+	}
+}
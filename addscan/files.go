@@ -0,0 +1,92 @@
+package addscan
+
+import (
+	"context"
+	"os"
+	gopath "path"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// Wrap returns nd, whose files are sent to the scanner while they are read.
+// Reading a file rejected by the scanner fails with a *RejectedError once
+// its data is read. The symlinks are not scanned.
+func (s *Scanner) Wrap(ctx context.Context, nd files.Node) files.Node {
+	return s.wrap(ctx, nd, "")
+}
+
+func (s *Scanner) wrap(ctx context.Context, nd files.Node, name string) files.Node {
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return nd
+	case files.File:
+		f := s.wrapFile(ctx, nd, name)
+		// the files added with --nocopy are referenced by their path
+		if fi, ok := nd.(files.FileInfo); ok {
+			return &scannedFileInfo{scannedFile: f, fi: fi}
+		}
+		return f
+	case files.Directory:
+		return &scannedDir{Directory: nd, s: s, ctx: ctx, name: name}
+	default:
+		return nd
+	}
+}
+
+func (s *Scanner) wrapFile(ctx context.Context, f files.File, name string) *scannedFile {
+	return &scannedFile{File: f, r: &scanReader{s: s, ctx: ctx, name: name, r: f}}
+}
+
+// scannedFile is a file sent to the scanner while it is read.
+type scannedFile struct {
+	files.File
+	r *scanReader
+}
+
+func (f *scannedFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
+
+func (f *scannedFile) Close() error {
+	f.r.Close()
+	return f.File.Close()
+}
+
+// scannedFileInfo is a scannedFile with a path on the filesystem.
+type scannedFileInfo struct {
+	*scannedFile
+	fi files.FileInfo
+}
+
+func (f *scannedFileInfo) AbsPath() string {
+	return f.fi.AbsPath()
+}
+
+func (f *scannedFileInfo) Stat() os.FileInfo {
+	return f.fi.Stat()
+}
+
+// scannedDir is a directory whose files are scanned.
+type scannedDir struct {
+	files.Directory
+	s    *Scanner
+	ctx  context.Context
+	name string
+}
+
+func (d *scannedDir) Entries() files.DirIterator {
+	return &scannedDirIterator{DirIterator: d.Directory.Entries(), d: d}
+}
+
+type scannedDirIterator struct {
+	files.DirIterator
+	d *scannedDir
+}
+
+func (it *scannedDirIterator) Node() files.Node {
+	nd := it.DirIterator.Node()
+	if nd == nil {
+		return nil
+	}
+	return it.d.s.wrap(it.d.ctx, nd, gopath.Join(it.d.name, it.Name()))
+}
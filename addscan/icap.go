@@ -0,0 +1,135 @@
+package addscan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultICAPPort is the port of the ICAP services whose URL has none.
+const defaultICAPPort = "1344"
+
+// icapChunkSize is the size of the chunks of the data sent to an ICAP
+// service.
+const icapChunkSize = 32 << 10
+
+// infectionHeaders are the headers of the ICAP responses the services tell
+// why they rejected a file in.
+var infectionHeaders = []string{"X-Infection-Found", "X-Violations-Found", "X-Virus-Id"}
+
+// scanICAP sends the data of r to the ICAP service u as the body of an HTTP
+// response, in a RESPMOD request. The service accepts the file with a 204
+// response, or a 200 one with the response unchanged, and rejects it with a
+// 200 response telling an infection, or replacing the response by an error.
+func scanICAP(ctx context.Context, u *url.URL, header http.Header, name string, r io.Reader) error {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultICAPPort)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	// the encapsulated response carries the name of the file
+	resHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n"
+	if name != "" {
+		resHeader += "Content-Disposition: attachment; filename=\"" + strings.NewReplacer(`"`, "", "\r", "", "\n", "").Replace(name) + "\"\r\n"
+	}
+	resHeader += "\r\n"
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", u.String())
+	fmt.Fprintf(w, "Host: %s\r\n", u.Host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	for k, vs := range header {
+		for _, v := range vs {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(resHeader))
+	w.WriteString(resHeader)
+
+	buf := make([]byte, icapChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			if _, err := w.WriteString("\r\n"); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	tp := textproto.NewReader(br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return err
+	}
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return fmt.Errorf("invalid ICAP response %q", line)
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid ICAP response %q", line)
+	}
+	h, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case 204:
+		return nil
+	case 200:
+	default:
+		return fmt.Errorf("unexpected response from the scanner: %s", line)
+	}
+	for _, k := range infectionHeaders {
+		if v := h.Get(k); v != "" {
+			return &RejectedError{Reason: v}
+		}
+	}
+	// the response was replaced, as by an error page
+	if strings.Contains(h.Get("Encapsulated"), "res-hdr=0") {
+		res, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			return &RejectedError{Reason: res.Status}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+// Package apierr sorts the errors of the CoreAPI into kinds, for the
+// embedders and scripts to handle them without matching their messages.
+//
+// The errors returned by the CoreAPI are matched with errors.Is against the
+// kinds, such as apierr.NotFound. KindOf sorts any error, including those
+// of the other APIs of the node and those of the commands decoded from the
+// HTTP API. The HTTP API answers the errors with the status of their kind,
+// and the CLI exits with the code of their kind.
+package apierr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	ds "github.com/ipfs/go-datastore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/membudget"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-namesys"
+	"github.com/ipfs/go-path/resolver"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+// Kind is the kind of an error.
+type Kind int
+
+// The kinds of the errors.
+const (
+	// Unknown is the kind of the errors of none of the other kinds
+	Unknown Kind = iota
+	// NotFound is the kind of the errors about content, links, names or
+	// peers which could not be found
+	NotFound
+	// Timeout is the kind of the errors of the operations which ran out of
+	// time
+	Timeout
+	// Offline is the kind of the errors of the operations which need the
+	// node to be online
+	Offline
+	// QuotaExceeded is the kind of the errors of the operations which would
+	// take the node over its storage or memory limits
+	QuotaExceeded
+	// InvalidPath is the kind of the errors about paths which could not be
+	// parsed
+	InvalidPath
+)
+
+var kindNames = map[Kind]string{
+	Unknown:       "unknown",
+	NotFound:      "not found",
+	Timeout:       "timeout",
+	Offline:       "offline",
+	QuotaExceeded: "quota exceeded",
+	InvalidPath:   "invalid path",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// Error makes the kinds errors, to be matched with errors.Is.
+func (k Kind) Error() string {
+	return k.String()
+}
+
+// Error is an error of a kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+// New returns err as an error of kind, or nil if err is nil.
+func New(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Error returns the message of the error, which its kind leaves untouched.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind of the error.
+func (e *Error) Is(target error) bool {
+	k, ok := target.(Kind)
+	return ok && k == e.Kind
+}
+
+// NetworkRequiredError is the error of the operations run offline which
+// would need the network to go on, such as fetching a block missing from the
+// blockstore, or resolving a name with no record stored locally. It is of the
+// Offline kind.
+type NetworkRequiredError struct {
+	// What is what is missing locally, such as "block bafy...".
+	What string
+	Err  error
+}
+
+func (e *NetworkRequiredError) Error() string {
+	return e.What + " is not available locally and would need the network"
+}
+
+func (e *NetworkRequiredError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the Offline kind.
+func (e *NetworkRequiredError) Is(target error) bool {
+	return target == Offline
+}
+
+// Wrap returns err as an error of its kind, or err itself if it is of no
+// known kind or already has one.
+func Wrap(err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	if kind := KindOf(err); kind != Unknown {
+		return &Error{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// KindOf returns the kind of err, Unknown if err is nil or of no known kind.
+func KindOf(err error) Kind {
+	var (
+		e         *Error
+		netErr    *NetworkRequiredError
+		cmdsErr   cmds.Error
+		cmdsErrP  *cmds.Error
+		noLink    resolver.ErrNoLink
+		pathError interface {
+			error
+			Path() string
+		}
+	)
+	switch {
+	case err == nil:
+		return Unknown
+	case errors.As(err, &netErr):
+		// before the kind of the error it wraps
+		return Offline
+	case errors.As(err, &e):
+		return e.Kind
+	case errors.As(err, &cmdsErr):
+		return kindOfCode(cmdsErr.Code)
+	case errors.As(err, &cmdsErrP):
+		return kindOfCode(cmdsErrP.Code)
+	case errors.Is(err, context.DeadlineExceeded):
+		return Timeout
+	case errors.Is(err, coreiface.ErrOffline):
+		return Offline
+	case errors.As(err, &noLink), ipld.IsNotFound(err), errors.Is(err, ds.ErrNotFound),
+		errors.Is(err, routing.ErrNotFound), errors.Is(err, coreiface.ErrResolveFailed),
+		errors.Is(err, namesys.ErrResolveFailed):
+		return NotFound
+	case errors.Is(err, membudget.ErrOverBudget):
+		return QuotaExceeded
+	case errors.As(err, &pathError):
+		// the errors of go-path, about the paths they are parsing
+		return InvalidPath
+	}
+	return Unknown
+}
+
+// The codes of the kinds in the errors of the commands, past those of
+// go-ipfs-cmds for the clients not to mistake them for theirs.
+const codeOffset = 32
+
+// Code returns the code of the errors of the commands of kind, or
+// cmds.ErrNormal for Unknown.
+func Code(kind Kind) cmds.ErrorType {
+	if kind == Unknown {
+		return cmds.ErrNormal
+	}
+	return cmds.ErrorType(codeOffset + int(kind))
+}
+
+func kindOfCode(code cmds.ErrorType) Kind {
+	kind := Kind(int(code) - codeOffset)
+	if _, ok := kindNames[kind]; !ok {
+		return Unknown
+	}
+	return kind
+}
+
+// HTTPStatus returns the status of the HTTP responses to the errors of kind,
+// or fallback for Unknown.
+func HTTPStatus(kind Kind, fallback int) int {
+	switch kind {
+	case NotFound:
+		return http.StatusNotFound
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case Offline:
+		return http.StatusServiceUnavailable
+	case QuotaExceeded:
+		return http.StatusInsufficientStorage
+	case InvalidPath:
+		return http.StatusBadRequest
+	}
+	return fallback
+}
+
+// ExitCode returns the code the CLI exits with on the errors of kind, 1 for
+// Unknown.
+func ExitCode(kind Kind) int {
+	switch kind {
+	case NotFound:
+		return 2
+	case Timeout:
+		return 3
+	case Offline:
+		return 4
+	case QuotaExceeded:
+		return 5
+	case InvalidPath:
+		return 6
+	}
+	return 1
+}
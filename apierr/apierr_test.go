@@ -0,0 +1,87 @@
+package apierr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	path "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+func TestKindOf(t *testing.T) {
+	_, pathErr := path.ParsePath("notapath")
+	for _, tc := range []struct {
+		err  error
+		kind Kind
+	}{
+		{nil, Unknown},
+		{errors.New("oops"), Unknown},
+		{New(QuotaExceeded, errors.New("full")), QuotaExceeded},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), Timeout},
+		{coreiface.ErrOffline, Offline},
+		{ipld.ErrNotFound{Cid: cid.Undef}, NotFound},
+		{&NetworkRequiredError{What: "name", Err: New(NotFound, errors.New("not found"))}, Offline},
+		{fmt.Errorf("get: %w", ds.ErrNotFound), NotFound},
+		{pathErr, InvalidPath},
+		{cmds.Error{Message: "offline", Code: Code(Offline)}, Offline},
+		{&cmds.Error{Message: "oops", Code: cmds.ErrNormal}, Unknown},
+	} {
+		if kind := KindOf(tc.err); kind != tc.kind {
+			t.Errorf("%v: expected %s, got %s", tc.err, tc.kind, kind)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil) != nil {
+		t.Fatal("expected nil")
+	}
+	oops := errors.New("oops")
+	if Wrap(oops) != oops {
+		t.Fatal("expected the errors of no kind left as they are")
+	}
+
+	err := Wrap(fmt.Errorf("get: %w", coreiface.ErrOffline))
+	if !errors.Is(err, Offline) || errors.Is(err, NotFound) {
+		t.Fatalf("expected an offline error, got %s", KindOf(err))
+	}
+	if !errors.Is(err, coreiface.ErrOffline) || err.Error() != "get: "+coreiface.ErrOffline.Error() {
+		t.Fatalf("expected the error wrapped untouched, got %q", err)
+	}
+	if Wrap(err) != err {
+		t.Fatal("expected the errors of a kind left as they are")
+	}
+}
+
+func TestCodes(t *testing.T) {
+	if Code(Unknown) != cmds.ErrNormal || kindOfCode(cmds.ErrClient) != Unknown {
+		t.Fatal("expected the codes of go-ipfs-cmds left to Unknown")
+	}
+	seen := map[int]Kind{}
+	for kind := range kindNames {
+		if kindOfCode(Code(kind)) != kind {
+			t.Errorf("%s: expected the code to round trip", kind)
+		}
+		if kind == Unknown {
+			continue
+		}
+		if HTTPStatus(kind, http.StatusInternalServerError) == http.StatusInternalServerError {
+			t.Errorf("%s: expected an HTTP status", kind)
+		}
+		code := ExitCode(kind)
+		if other, ok := seen[code]; ok || code == 1 {
+			t.Errorf("%s: exit code %d already taken by %s", kind, code, other)
+		}
+		seen[code] = kind
+	}
+	if HTTPStatus(Unknown, http.StatusTeapot) != http.StatusTeapot || ExitCode(Unknown) != 1 {
+		t.Fatal("expected the fallbacks for Unknown")
+	}
+}
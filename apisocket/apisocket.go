@@ -0,0 +1,114 @@
+// Package apisocket listens for and dials the API on local sockets: unix
+// domain sockets, and named pipes on Windows, so that local tools talk to the
+// daemon without a TCP port being opened.
+//
+// The access to a local socket is controlled by the file system: a unix
+// socket is created with the mode and group of its Settings, and a named pipe
+// is only accessible to the user running the daemon, the administrators, and
+// the group of its Settings.
+//
+// A named pipe is a /unix multiaddr whose path is in the pipe namespace, such
+// as /unix//./pipe/ipfs-api for the pipe \\.\pipe\ipfs-api.
+package apisocket
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// DefaultMode is the mode of the unix sockets when not set, only the user
+// running the daemon being allowed to connect.
+const DefaultMode os.FileMode = 0600
+
+// pipePrefix is the prefix of the paths of the named pipes, in a multiaddr.
+const pipePrefix = "//./pipe/"
+
+// Settings are the permissions of the local sockets.
+type Settings struct {
+	// Mode is the file mode of the unix sockets, 0 for DefaultMode
+	Mode os.FileMode
+	// Group is the group allowed to connect, if any
+	Group string
+}
+
+// ParseMode parses the octal file mode of the unix sockets, such as "0660".
+func ParseMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("invalid socket mode %q, expected an octal mode such as 0660", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// IsLocal reports whether addr is a local socket.
+func IsLocal(addr ma.Multiaddr) bool {
+	_, err := addr.ValueForProtocol(ma.P_UNIX)
+	return err == nil
+}
+
+// Listen listens on addr, with the permissions of s if it is a local socket.
+func Listen(addr ma.Multiaddr, s Settings) (manet.Listener, error) {
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return manet.Listen(addr)
+	}
+	if pipe, ok := pipeName(path); ok {
+		return listenPipe(addr, pipe, s)
+	}
+	return listenUnix(addr, s)
+}
+
+// Dial dials the local socket addr.
+func Dial(ctx context.Context, addr ma.Multiaddr) (net.Conn, error) {
+	path, err := addr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return nil, fmt.Errorf("not a local socket: %s", addr)
+	}
+	if pipe, ok := pipeName(path); ok {
+		return dialPipe(ctx, pipe)
+	}
+	_, path, err = manet.DialArgs(addr)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", path)
+}
+
+// listener is a listener of a local socket, as a multiaddr listener.
+type listener struct {
+	net.Listener
+	addr ma.Multiaddr
+}
+
+func (l *listener) Accept() (manet.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, addr: l.addr}, nil
+}
+
+func (l *listener) Multiaddr() ma.Multiaddr {
+	return l.addr
+}
+
+// conn is a connection to a local socket, both ends having its address.
+type conn struct {
+	net.Conn
+	addr ma.Multiaddr
+}
+
+func (c *conn) LocalMultiaddr() ma.Multiaddr {
+	return c.addr
+}
+
+func (c *conn) RemoteMultiaddr() ma.Multiaddr {
+	return c.addr
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+// +build !windows
+
+package apisocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// named pipes are Windows only
+func pipeName(path string) (string, bool) {
+	return "", false
+}
+
+func listenPipe(addr ma.Multiaddr, pipe string, s Settings) (manet.Listener, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
+
+func dialPipe(ctx context.Context, pipe string) (net.Conn, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
+
+func listenUnix(addr ma.Multiaddr, s Settings) (manet.Listener, error) {
+	_, path, err := manet.DialArgs(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+
+	gid := -1
+	if s.Group != "" {
+		g, err := user.LookupGroup(s.Group)
+		if err != nil {
+			return nil, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	mode := s.Mode
+	if mode == 0 {
+		mode = DefaultMode
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return &listener{Listener: l, addr: addr}, nil
+}
+
+// removeStale removes the socket at path if nothing listens on it, left by
+// a daemon that did not exit cleanly.
+func removeStale(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		c.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,93 @@
+//go:build !windows
+// +build !windows
+
+package apisocket
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	addr := ma.StringCast("/unix" + path)
+	if !IsLocal(addr) || IsLocal(ma.StringCast("/ip4/127.0.0.1/tcp/5001")) {
+		t.Fatal("expected only the unix socket to be local")
+	}
+
+	// left by a daemon that did not exit cleanly
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l, err := Listen(addr, Settings{Mode: 0660})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0660 {
+		t.Fatalf("expected the mode 0660, got %s", fi.Mode().Perm())
+	}
+	if !l.Multiaddr().Equal(addr) {
+		t.Fatalf("expected the listener on %s, got %s", addr, l.Multiaddr())
+	}
+
+	// in use
+	if _, err := Listen(addr, Settings{}); err == nil {
+		t.Fatal("expected listening on a socket in use to fail")
+	}
+
+	// the first connection is the check of the socket in use
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			c.Write([]byte("ok"))
+			c.Close()
+		}
+	}()
+	c, err := Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	buf := make([]byte, 2)
+	if _, err := c.Read(buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("expected to read ok, got %q (%v)", buf, err)
+	}
+}
+
+func TestListenNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(ma.StringCast("/unix"+path), Settings{}); err == nil {
+		t.Fatal("expected listening over a file to fail")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	if mode, err := ParseMode("0660"); err != nil || mode != 0660 {
+		t.Fatalf("expected 0660, got %s (%v)", mode, err)
+	}
+	for _, s := range []string{"", "rw", "0999", "01777"} {
+		if _, err := ParseMode(s); err == nil {
+			t.Fatalf("expected %q to be invalid", s)
+		}
+	}
+}
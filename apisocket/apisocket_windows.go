@@ -0,0 +1,58 @@
+//go:build windows
+// +build windows
+
+package apisocket
+
+import (
+	"context"
+	"net"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	winio "github.com/Microsoft/go-winio"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// pipeName returns the name of the named pipe at path, if in the pipe
+// namespace.
+func pipeName(path string) (string, bool) {
+	if !strings.HasPrefix(strings.ToLower(path), pipePrefix) {
+		return "", false
+	}
+	return filepath.FromSlash(path), true
+}
+
+func listenPipe(addr ma.Multiaddr, pipe string, s Settings) (manet.Listener, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+	// full access to the system, the administrators, and the user running
+	// the daemon, whose Uid is a SID on Windows
+	sddl := "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GA;;;" + u.Uid + ")"
+	if s.Group != "" {
+		sid, err := winio.LookupSidByName(s.Group)
+		if err != nil {
+			return nil, err
+		}
+		sddl += "(A;;GRGW;;;" + sid + ")"
+	}
+
+	l, err := winio.ListenPipe(pipe, &winio.PipeConfig{SecurityDescriptor: sddl})
+	if err != nil {
+		return nil, err
+	}
+	return &listener{Listener: l, addr: addr}, nil
+}
+
+func dialPipe(ctx context.Context, pipe string) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, pipe)
+}
+
+// the access to the unix sockets is not restricted on Windows, beyond the
+// permissions of their directory
+func listenUnix(addr ma.Multiaddr, s Settings) (manet.Listener, error) {
+	return manet.Listen(addr)
+}
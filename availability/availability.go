@@ -0,0 +1,282 @@
+// Package availability probes whether the providers of a DAG serve it to the
+// other peers. Each provider is dialed from a new libp2p host, unknown to it,
+// which fetches the root of the DAG and a sample of its leaves over bitswap
+// from this provider only, asking it to answer DONT_HAVE for the blocks it
+// does not have rather than to stay silent.
+//
+// The leaves are sampled by random walks down the DAG from the root, so only
+// the blocks on the way are fetched, however large the DAG.
+package availability
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	pb "github.com/ipfs/go-bitswap/message/pb"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	mh "github.com/multiformats/go-multihash"
+)
+
+var log = logging.Logger("availability")
+
+var (
+	// ErrDontHave is returned when the provider answers that it does not
+	// have a block.
+	ErrDontHave = errors.New("the provider does not have the block")
+	// ErrTimeout is returned when the provider neither sends a block nor
+	// answers that it does not have it within the timeout of the probe.
+	ErrTimeout = errors.New("no answer from the provider")
+)
+
+// Options are the options of a probe.
+type Options struct {
+	// Leaves is the number of leaves sampled.
+	Leaves int
+	// Timeout bounds the probe of a provider.
+	Timeout time.Duration
+}
+
+// Fetch is the fetch of a block from a provider.
+type Fetch struct {
+	Cid      string
+	Duration time.Duration
+	Error    string `json:",omitempty"`
+}
+
+// Result is the probe of a provider.
+type Result struct {
+	Peer peer.ID
+	// Addr is the address of the provider connected to, and Latency the
+	// round trip of a ping, 0 if the provider did not answer it.
+	Addr    string        `json:",omitempty"`
+	Latency time.Duration `json:",omitempty"`
+	// Error is the failure to connect to the provider.
+	Error string `json:",omitempty"`
+	// Root is the fetch of the root of the DAG, nil if not connected, and
+	// Leaves the fetches of the leaves sampled once the root is fetched.
+	Root   *Fetch  `json:",omitempty"`
+	Leaves []Fetch `json:",omitempty"`
+}
+
+// Available tells whether the provider served the root and all the leaves
+// sampled.
+func (r *Result) Available() bool {
+	if r.Root == nil || r.Root.Error != "" {
+		return false
+	}
+	for _, l := range r.Leaves {
+		if l.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Probe connects to the provider p from the host made by newHost, closed once
+// done, and fetches from it the root c of a DAG and a sample of its leaves.
+func Probe(ctx context.Context, newHost func() (host.Host, error), p peer.AddrInfo, c cid.Cid, opts Options) *Result {
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	r := &Result{Peer: p.ID}
+	h, err := newHost()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer h.Close()
+
+	net := bsnet.NewFromIpfsHost(h, routinghelpers.Null{})
+	f := &fetcher{
+		net:     net,
+		peer:    p.ID,
+		wants:   make(map[cid.Cid]chan response),
+		fetched: make(map[cid.Cid]ipld.Node),
+	}
+	net.SetDelegate(f)
+
+	if err := h.Connect(ctx, p); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if conns := h.Network().ConnsToPeer(p.ID); len(conns) > 0 {
+		r.Addr = conns[0].RemoteMultiaddr().String()
+	}
+	if ping := net.Ping(ctx, p.ID); ping.Error == nil {
+		r.Latency = ping.RTT
+	}
+
+	root, d, err := f.fetch(ctx, c)
+	r.Root = newFetch(c, d, err)
+	if err != nil {
+		return r
+	}
+
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// the nodes whose leaves are all sampled, for the DAGs with fewer leaves
+	// than asked
+	done := make(map[cid.Cid]bool)
+	for len(r.Leaves) < opts.Leaves && !done[c] && ctx.Err() == nil {
+		if leaf, d, err := f.walk(ctx, root, done, rng); leaf.Defined() {
+			r.Leaves = append(r.Leaves, *newFetch(leaf, d, err))
+		}
+	}
+	return r
+}
+
+func newFetch(c cid.Cid, d time.Duration, err error) *Fetch {
+	f := &Fetch{Cid: c.String(), Duration: d}
+	if err != nil {
+		f.Error = err.Error()
+	}
+	return f
+}
+
+type response struct {
+	blk blocks.Block
+	err error
+}
+
+// fetcher fetches blocks from a single peer, one at a time, and keeps them.
+type fetcher struct {
+	net  bsnet.BitSwapNetwork
+	peer peer.ID
+
+	mu    sync.Mutex
+	wants map[cid.Cid]chan response
+
+	fetched map[cid.Cid]ipld.Node
+}
+
+// walk follows a link picked at random from nd, among the ones not done, down
+// to a leaf, and returns the leaf and the time it took to fetch it, or the
+// block that failed to fetch, marking it done. It returns undefined when it
+// finds a node whose links are all done instead, marking it done in turn, or
+// a leaf inlined in its CID, never fetched.
+func (f *fetcher) walk(ctx context.Context, nd ipld.Node, done map[cid.Cid]bool, rng *rand.Rand) (cid.Cid, time.Duration, error) {
+	for {
+		var links []cid.Cid
+		for _, l := range nd.Links() {
+			if !done[l.Cid] {
+				links = append(links, l.Cid)
+			}
+		}
+		if len(links) == 0 {
+			done[nd.Cid()] = true
+			return cid.Undef, 0, nil
+		}
+		c := links[rng.Intn(len(links))]
+		if c.Prefix().MhType == mh.IDENTITY {
+			done[c] = true
+			return cid.Undef, 0, nil
+		}
+		next, d, err := f.fetch(ctx, c)
+		if err != nil || len(next.Links()) == 0 {
+			done[c] = true
+			return c, d, err
+		}
+		nd = next
+	}
+}
+
+// fetch returns the node c, fetched from the peer unless fetched already, and
+// the time it took.
+func (f *fetcher) fetch(ctx context.Context, c cid.Cid) (ipld.Node, time.Duration, error) {
+	if nd, ok := f.fetched[c]; ok {
+		return nd, 0, nil
+	}
+	start := time.Now()
+	blk, err := f.get(ctx, c)
+	d := time.Since(start)
+	if err != nil {
+		return nil, d, err
+	}
+	nd, err := ipld.Decode(blk)
+	if err != nil {
+		return nil, d, err
+	}
+	f.fetched[c] = nd
+	return nd, d, nil
+}
+
+func (f *fetcher) get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if c.Prefix().MhType == mh.IDENTITY {
+		dmh, err := mh.Decode(c.Hash())
+		if err != nil {
+			return nil, err
+		}
+		return blocks.NewBlockWithCid(dmh.Digest, c)
+	}
+
+	ch := make(chan response, 1)
+	f.mu.Lock()
+	f.wants[c] = ch
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		delete(f.wants, c)
+		f.mu.Unlock()
+	}()
+
+	msg := bsmsg.New(false)
+	msg.AddEntry(c, 1, pb.Message_Wantlist_Block, true)
+	if err := f.net.SendMessage(ctx, f.peer, msg); err != nil {
+		return nil, err
+	}
+	select {
+	case r := <-ch:
+		return r.blk, r.err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (f *fetcher) respond(c cid.Cid, r response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ch, ok := f.wants[c]; ok {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+}
+
+// ReceiveMessage implements bsnet.Receiver, and answers the wants with the
+// blocks received from the peer, or with ErrDontHave.
+func (f *fetcher) ReceiveMessage(ctx context.Context, sender peer.ID, incoming bsmsg.BitSwapMessage) {
+	if sender != f.peer {
+		return
+	}
+	for _, b := range incoming.Blocks() {
+		f.respond(b.Cid(), response{blk: b})
+	}
+	for _, c := range incoming.DontHaves() {
+		f.respond(c, response{err: ErrDontHave})
+	}
+}
+
+// ReceiveError implements bsnet.Receiver.
+func (f *fetcher) ReceiveError(err error) {
+	log.Debugf("probing %s: %s", f.peer, err)
+}
+
+// PeerConnected implements bsnet.Receiver.
+func (f *fetcher) PeerConnected(peer.ID) {}
+
+// PeerDisconnected implements bsnet.Receiver.
+func (f *fetcher) PeerDisconnected(peer.ID) {}
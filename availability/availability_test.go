@@ -0,0 +1,131 @@
+package availability
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// provider starts bitswap on a new host of mn, serving nodes.
+func provider(t *testing.T, ctx context.Context, mn mocknet.Mocknet, nodes ...ipld.Node) host.Host {
+	h, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	for _, nd := range nodes {
+		if err := bs.Put(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exch := bitswap.New(ctx, bsnet.NewFromIpfsHost(h, routinghelpers.Null{}), bs, bitswap.ProvideEnabled(false))
+	t.Cleanup(func() { exch.Close() })
+	return h
+}
+
+func TestProbe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New()
+	defer mn.Close()
+
+	var leaves []ipld.Node
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		leaves = append(leaves, dag.NewRawNode([]byte(data)))
+	}
+	inner := &dag.ProtoNode{}
+	root := &dag.ProtoNode{}
+	for i, l := range leaves {
+		parent := root
+		if i >= 3 {
+			parent = inner
+		}
+		if err := parent.AddNodeLink(l.Cid().String(), l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := root.AddNodeLink("inner", inner); err != nil {
+		t.Fatal(err)
+	}
+
+	full := provider(t, ctx, mn, append(leaves, root, inner)...)
+	rootOnly := provider(t, ctx, mn, root)
+	empty := provider(t, ctx, mn)
+	unreachable, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// each probe runs from a new host, linked to the providers but the
+	// unreachable one
+	newHost := func() (host.Host, error) {
+		h, err := mn.GenPeer()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range []host.Host{full, rootOnly, empty} {
+			if _, err := mn.LinkPeers(h.ID(), p.ID()); err != nil {
+				return nil, err
+			}
+		}
+		return h, nil
+	}
+	run := func(p host.Host, n int, timeout time.Duration) *Result {
+		return Probe(ctx, newHost, peer.AddrInfo{ID: p.ID(), Addrs: p.Addrs()}, root.Cid(), Options{Leaves: n, Timeout: timeout})
+	}
+
+	// all the leaves are sampled, the DAG having fewer than asked
+	r := run(full, 10, 5*time.Second)
+	if !r.Available() || r.Error != "" || r.Addr == "" {
+		t.Fatalf("expected the DAG available, got %+v", r)
+	}
+	if r.Root.Cid != root.Cid().String() || r.Root.Duration <= 0 {
+		t.Errorf("expected the root fetched, got %+v", r.Root)
+	}
+	if len(r.Leaves) != len(leaves) {
+		t.Errorf("expected %d leaves sampled, got %+v", len(leaves), r.Leaves)
+	}
+	seen := make(map[string]bool)
+	for _, l := range r.Leaves {
+		if seen[l.Cid] {
+			t.Errorf("expected the leaves sampled once, got %s twice", l.Cid)
+		}
+		seen[l.Cid] = true
+	}
+
+	// the missing blocks are answered with DONT_HAVE, before the timeout
+	r = run(rootOnly, 2, time.Minute)
+	if r.Available() || r.Root == nil || r.Root.Error != "" || len(r.Leaves) == 0 {
+		t.Fatalf("expected the root only available, got %+v", r)
+	}
+	for _, l := range r.Leaves {
+		if l.Error != ErrDontHave.Error() {
+			t.Errorf("expected the leaves missing, got %+v", l)
+		}
+	}
+	r = run(empty, 2, time.Minute)
+	if r.Available() || r.Root == nil || r.Root.Error != ErrDontHave.Error() || len(r.Leaves) != 0 {
+		t.Errorf("expected the root missing, got %+v", r)
+	}
+
+	// the unreachable providers are reported as such
+	r = Probe(ctx, newHost, peer.AddrInfo{ID: unreachable.ID(), Addrs: unreachable.Addrs()}, root.Cid(), Options{Leaves: 2, Timeout: time.Second})
+	if r.Available() || r.Error == "" || r.Root != nil {
+		t.Errorf("expected the provider unreachable, got %+v", r)
+	}
+}
@@ -0,0 +1,217 @@
+// Package bitswapstats records what bitswap exchanged with each peer: the
+// blocks sent and received, and the duplicates among the blocks received. The
+// wants sent that the peer did not answer yet, and the time it took to answer
+// the others, are taken from the stats of the peers recorded by peerstats.
+//
+// The Recorder is given to bitswap as its tracer. A block received from a peer
+// is a duplicate when a copy of it was received from any peer in the last
+// DuplicateWindow.
+package bitswapstats
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ipfs/go-ipfs/peerstats"
+)
+
+const (
+	// MaxPeers is the number of peers whose stats are kept, the peers that
+	// exchanged with the node last.
+	MaxPeers = 4096
+	// DuplicateWindow is how long a block received is remembered, to tell
+	// the duplicates apart.
+	DuplicateWindow = time.Minute
+
+	// pruneInterval is the interval at which the blocks received that
+	// expired are forgotten.
+	pruneInterval = 10 * time.Second
+)
+
+// Stat is what bitswap exchanged with a peer.
+type Stat struct {
+	Peer           peer.ID
+	BlocksSent     uint64
+	BlocksReceived uint64
+	DataSent       uint64
+	DataReceived   uint64
+	// DupBlocksReceived is the number of blocks received from the peer that
+	// were already received from some peer
+	DupBlocksReceived uint64
+	// OutstandingWants is the number of wants sent to the peer not answered
+	// yet, from peerstats
+	OutstandingWants int
+	// Latency is the moving average of the time the peer took to answer the
+	// wants with a block or a HAVE, from peerstats
+	Latency time.Duration
+	// Updated is the time of the last message exchanged with the peer
+	Updated time.Time
+}
+
+// receipt is when a block was last received, and from whom first.
+type receipt struct {
+	at   time.Time
+	from peer.ID
+}
+
+// Recorder records the stats of the peers.
+type Recorder struct {
+	// wants has the wants sent to the peers and their answers
+	wants *peerstats.Recorder
+
+	mu    sync.Mutex
+	peers map[peer.ID]*Stat
+	// received is when the blocks were last received, by multihash
+	received  map[string]receipt
+	lastPrune time.Time
+}
+
+// New returns a recorder without stats, completed with the wants recorded by
+// wants, which bitswap must be given as a tracer too.
+func New(wants *peerstats.Recorder) *Recorder {
+	return &Recorder{
+		wants:    wants,
+		peers:    make(map[peer.ID]*Stat),
+		received: make(map[string]receipt),
+	}
+}
+
+// Stat returns the stats of p, if any.
+func (r *Recorder) Stat(p peer.ID) (Stat, bool) {
+	r.mu.Lock()
+	r.prune(time.Now())
+	st, ok := r.peers[p]
+	var out Stat
+	if ok {
+		out = *st
+	}
+	r.mu.Unlock()
+	if !ok {
+		return Stat{}, false
+	}
+	return r.withWants(out), true
+}
+
+// Peers returns the stats of all the peers, by peer ID.
+func (r *Recorder) Peers() []Stat {
+	r.mu.Lock()
+	r.prune(time.Now())
+	stats := make([]Stat, 0, len(r.peers))
+	for _, st := range r.peers {
+		stats = append(stats, *st)
+	}
+	r.mu.Unlock()
+	for i := range stats {
+		stats[i] = r.withWants(stats[i])
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Peer < stats[j].Peer })
+	return stats
+}
+
+// withWants returns st with the outstanding wants and the latency of its
+// peer.
+func (r *Recorder) withWants(st Stat) Stat {
+	st.OutstandingWants = r.wants.Outstanding(st.Peer)
+	if ws, ok := r.wants.Stat(st.Peer); ok {
+		st.Latency = ws.Latency
+	}
+	return st
+}
+
+// Sender returns the peer the block of c was first received from, if it was
+// received in the last DuplicateWindow.
+func (r *Recorder) Sender(c cid.Cid) (peer.ID, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rc, ok := r.received[string(c.Hash())]
+	if !ok || time.Since(rc.at) >= DuplicateWindow {
+		return "", false
+	}
+	return rc.from, true
+}
+
+// MessageSent records the blocks sent to p, and that it was sent wants. It
+// implements bitswap.Tracer.
+func (r *Recorder) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	entries := msg.Wantlist()
+	if len(blks)+len(entries) == 0 {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.peer(p, now)
+	for _, b := range blks {
+		st.BlocksSent++
+		st.DataSent += uint64(len(b.RawData()))
+	}
+	r.prune(now)
+}
+
+// MessageReceived records the blocks received from p, and that it answered
+// wants. It implements bitswap.Tracer.
+func (r *Recorder) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	haves := msg.Haves()
+	dontHaves := msg.DontHaves()
+	if len(blks)+len(haves)+len(dontHaves) == 0 {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.peer(p, now)
+	for _, b := range blks {
+		st.BlocksReceived++
+		st.DataReceived += uint64(len(b.RawData()))
+		k := string(b.Cid().Hash())
+		if rc, ok := r.received[k]; ok && now.Sub(rc.at) < DuplicateWindow {
+			st.DupBlocksReceived++
+			r.received[k] = receipt{at: now, from: rc.from}
+		} else {
+			r.received[k] = receipt{at: now, from: p}
+		}
+	}
+	r.prune(now)
+}
+
+// peer returns the stats of p, created if needed, dropping the stats of the
+// peer updated the longest ago beyond MaxPeers.
+func (r *Recorder) peer(p peer.ID, now time.Time) *Stat {
+	st, ok := r.peers[p]
+	if !ok {
+		if len(r.peers) >= MaxPeers {
+			var oldest *Stat
+			for _, s := range r.peers {
+				if oldest == nil || s.Updated.Before(oldest.Updated) {
+					oldest = s
+				}
+			}
+			delete(r.peers, oldest.Peer)
+		}
+		st = &Stat{Peer: p}
+		r.peers[p] = st
+	}
+	st.Updated = now
+	return st
+}
+
+// prune forgets the blocks received that expired, at most every
+// pruneInterval.
+func (r *Recorder) prune(now time.Time) {
+	if now.Sub(r.lastPrune) < pruneInterval {
+		return
+	}
+	r.lastPrune = now
+	for k, rc := range r.received {
+		if now.Sub(rc.at) >= DuplicateWindow {
+			delete(r.received, k)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package bitswapstats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	pb "github.com/ipfs/go-bitswap/message/pb"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mh "github.com/multiformats/go-multihash"
+
+	"github.com/ipfs/go-ipfs/peerstats"
+)
+
+func testPeer(t *testing.T, i int) peer.ID {
+	t.Helper()
+	h, err := mh.Sum([]byte(fmt.Sprint("peer ", i)), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer.ID(h)
+}
+
+func wantlist(cancel bool, cs ...cid.Cid) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	for _, c := range cs {
+		if cancel {
+			msg.Cancel(c)
+		} else {
+			msg.AddEntry(c, 1, pb.Message_Wantlist_Block, true)
+		}
+	}
+	return msg
+}
+
+func received(blks ...blocks.Block) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	for _, b := range blks {
+		msg.AddBlock(b)
+	}
+	return msg
+}
+
+// tracer gives the messages to the recorder and to the peer stats it is
+// completed with, as bitswap does.
+type tracer struct {
+	r     *Recorder
+	wants *peerstats.Recorder
+}
+
+func (tr tracer) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	tr.wants.MessageSent(p, msg)
+	tr.r.MessageSent(p, msg)
+}
+
+func (tr tracer) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	tr.wants.MessageReceived(p, msg)
+	tr.r.MessageReceived(p, msg)
+}
+
+func TestRecord(t *testing.T) {
+	wants, err := peerstats.New(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wants.Close()
+	r := New(wants)
+	tr := tracer{r, wants}
+	p1, p2 := testPeer(t, 1), testPeer(t, 2)
+	b1, b2, b3 := blocks.NewBlock([]byte("b1")), blocks.NewBlock([]byte("b2")), blocks.NewBlock([]byte("b3"))
+
+	tr.MessageSent(p1, wantlist(false, b1.Cid(), b2.Cid(), b3.Cid()))
+	tr.MessageSent(p2, wantlist(false, b1.Cid(), b2.Cid()))
+	time.Sleep(10 * time.Millisecond)
+
+	// b1 from both peers, the second copy being a duplicate
+	tr.MessageReceived(p1, received(b1))
+	tr.MessageReceived(p2, received(b1))
+	tr.MessageSent(p2, wantlist(true, b2.Cid()))
+	dontHave := bsmsg.New(false)
+	dontHave.AddDontHave(b3.Cid())
+	tr.MessageReceived(p1, dontHave)
+	tr.MessageSent(p2, received(b3))
+
+	st1, ok := r.Stat(p1)
+	if !ok {
+		t.Fatal("no stats for p1")
+	}
+	if st1.BlocksReceived != 1 || st1.DataReceived != 2 || st1.DupBlocksReceived != 0 || st1.OutstandingWants != 1 || st1.Latency < 10*time.Millisecond {
+		t.Fatalf("unexpected stats for p1: %+v", st1)
+	}
+	st2, _ := r.Stat(p2)
+	if st2.BlocksReceived != 1 || st2.DupBlocksReceived != 1 || st2.OutstandingWants != 0 || st2.BlocksSent != 1 || st2.DataSent != 2 {
+		t.Fatalf("unexpected stats for p2: %+v", st2)
+	}
+	if _, ok := r.Stat(testPeer(t, 3)); ok {
+		t.Fatal("expected no stats for a peer without messages")
+	}
+	if ps := r.Peers(); len(ps) != 2 || ps[0].Peer > ps[1].Peer {
+		t.Fatalf("unexpected peers %v", ps)
+	}
+	if from, ok := r.Sender(b1.Cid()); !ok || from != p1 {
+		t.Fatalf("expected b1 received from p1 first, got %s", from)
+	}
+	if _, ok := r.Sender(b2.Cid()); ok {
+		t.Fatal("expected no sender for a block not received")
+	}
+
+	// the blocks received expire
+	r.mu.Lock()
+	r.received[string(b1.Cid().Hash())] = receipt{at: time.Now().Add(-DuplicateWindow), from: p1}
+	r.lastPrune = time.Time{}
+	r.mu.Unlock()
+	tr.MessageReceived(p2, received(b1))
+	if st2, _ := r.Stat(p2); st2.DupBlocksReceived != 1 {
+		t.Fatalf("expected the block received again not a duplicate, got %+v", st2)
+	}
+}
@@ -0,0 +1,217 @@
+// Package coldtier implements a two-tier blockstore that can move blocks out
+// of local storage into a secondary, usually object-storage-backed,
+// blockstore while keeping them transparently readable.
+//
+// The blocks read back from the cold tier are not moved back to the hot tier:
+// the DAGs offloaded are those selected to live in the cold tier, and every
+// read of them is served from it.
+package coldtier
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("coldtier")
+
+var (
+	// blocksPrefix is where the location of offloaded blocks is recorded.
+	blocksPrefix = ds.NewKey("/coldtier/blocks")
+	// rootsPrefix is where fully offloaded DAG roots are recorded.
+	rootsPrefix = ds.NewKey("/coldtier/roots")
+)
+
+// Blockstore serves blocks from a hot (local) blockstore and falls back to a
+// cold blockstore for blocks that have been offloaded. The set of offloaded
+// blocks is recorded in a local index so that lookups for blocks that are
+// neither hot nor cold never hit the cold tier.
+//
+// New blocks are always written to the hot tier.
+type Blockstore struct {
+	hot   blockstore.Blockstore
+	cold  blockstore.Blockstore
+	index ds.Datastore
+	roots ds.Datastore
+}
+
+var _ blockstore.Blockstore = (*Blockstore)(nil)
+
+// New returns a two-tier blockstore. The index datastore must be local and
+// persistent; it is used to record which blocks live in the cold tier.
+func New(hot, cold blockstore.Blockstore, index ds.Datastore) *Blockstore {
+	return &Blockstore{
+		hot:   hot,
+		cold:  cold,
+		index: namespace.Wrap(index, blocksPrefix),
+		roots: namespace.Wrap(index, rootsPrefix),
+	}
+}
+
+// IsCold returns true if the block has been offloaded to the cold tier.
+func (bs *Blockstore) IsCold(ctx context.Context, c cid.Cid) (bool, error) {
+	return bs.index.Has(ctx, dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// Offload moves a block from the hot to the cold tier. It is a no-op if the
+// block has already been offloaded.
+//
+// The block is written to the cold tier and recorded in the index before it
+// is removed from the hot tier, so it stays readable throughout.
+func (bs *Blockstore) Offload(ctx context.Context, c cid.Cid) error {
+	cold, err := bs.IsCold(ctx, c)
+	if err != nil || cold {
+		return err
+	}
+
+	blk, err := bs.hot.Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := bs.cold.Put(ctx, blk); err != nil {
+		return err
+	}
+	if err := bs.index.Put(ctx, dshelp.MultihashToDsKey(c.Hash()), nil); err != nil {
+		return err
+	}
+	return bs.hot.DeleteBlock(ctx, c)
+}
+
+func (bs *Blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	has, err := bs.hot.Has(ctx, c)
+	if err != nil || has {
+		return has, err
+	}
+	return bs.IsCold(ctx, c)
+}
+
+func (bs *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.hot.Get(ctx, c)
+	if !ipld.IsNotFound(err) {
+		return blk, err
+	}
+	if cold, cerr := bs.IsCold(ctx, c); cerr != nil || !cold {
+		return nil, err
+	}
+	return bs.cold.Get(ctx, c)
+}
+
+func (bs *Blockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	size, err := bs.hot.GetSize(ctx, c)
+	if !ipld.IsNotFound(err) {
+		return size, err
+	}
+	if cold, cerr := bs.IsCold(ctx, c); cerr != nil || !cold {
+		return -1, err
+	}
+	return bs.cold.GetSize(ctx, c)
+}
+
+func (bs *Blockstore) Put(ctx context.Context, blk blocks.Block) error {
+	cold, err := bs.IsCold(ctx, blk.Cid())
+	if err != nil || cold {
+		return err
+	}
+	return bs.hot.Put(ctx, blk)
+}
+
+func (bs *Blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	hot := make([]blocks.Block, 0, len(blks))
+	for _, blk := range blks {
+		cold, err := bs.IsCold(ctx, blk.Cid())
+		if err != nil {
+			return err
+		}
+		if !cold {
+			hot = append(hot, blk)
+		}
+	}
+	return bs.hot.PutMany(ctx, hot)
+}
+
+// DeleteBlock removes a block from whichever tier holds it. A DAG whose root
+// is deleted is no longer recorded as offloaded, so that it is offloaded
+// again once added back.
+func (bs *Blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	cold, err := bs.IsCold(ctx, c)
+	if err != nil {
+		return err
+	}
+	if !cold {
+		return bs.hot.DeleteBlock(ctx, c)
+	}
+
+	if err := bs.roots.Delete(ctx, dshelp.MultihashToDsKey(c.Hash())); err != nil {
+		return err
+	}
+	if err := bs.cold.DeleteBlock(ctx, c); err != nil && !ipld.IsNotFound(err) {
+		return err
+	}
+	return bs.index.Delete(ctx, dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// AllKeysChan returns the keys of both tiers. Cold keys are read from the
+// local index rather than by listing the cold tier.
+func (bs *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	hotCh, err := bs.hot.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bs.index.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan cid.Cid, dsq.KeysOnlyBufSize)
+	go func() {
+		defer func() {
+			res.Close() // ensure exit (signals early exit, too)
+			close(output)
+		}()
+
+		for c := range hotCh {
+			select {
+			case output <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			e, ok := res.NextSync()
+			if !ok {
+				return
+			}
+			if e.Error != nil {
+				log.Errorf("coldtier.AllKeysChan got err: %s", e.Error)
+				return
+			}
+
+			mh, err := dshelp.DsKeyToMultihash(ds.RawKey(e.Key))
+			if err != nil {
+				log.Warnf("error parsing key from binary: %s", err)
+				continue
+			}
+			select {
+			case output <- cid.NewCidV1(cid.Raw, mh):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+func (bs *Blockstore) HashOnRead(enabled bool) {
+	bs.hot.HashOnRead(enabled)
+	bs.cold.HashOnRead(enabled)
+}
@@ -0,0 +1,165 @@
+package coldtier
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+func newTiers() (hot, cold blockstore.Blockstore, bs *Blockstore) {
+	index := dssync.MutexWrap(ds.NewMapDatastore())
+	hot = blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	cold = blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	return hot, cold, New(hot, cold, index)
+}
+
+func TestOffload(t *testing.T) {
+	ctx := context.Background()
+	hot, cold, bs := newTiers()
+
+	blk := blocks.NewBlock([]byte("cold storage"))
+	if err := bs.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Offload(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if has, _ := hot.Has(ctx, blk.Cid()); has {
+		t.Error("block still in hot tier after offload")
+	}
+	if has, _ := cold.Has(ctx, blk.Cid()); !has {
+		t.Error("block missing from cold tier after offload")
+	}
+	if has, _ := bs.Has(ctx, blk.Cid()); !has {
+		t.Error("offloaded block not reported by Has")
+	}
+
+	got, err := bs.Get(ctx, blk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.RawData()) != "cold storage" {
+		t.Errorf("got %q from cold tier", got.RawData())
+	}
+
+	// Writing the block again must not bring it back to the hot tier.
+	if err := bs.Put(ctx, blk); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := hot.Has(ctx, blk.Cid()); has {
+		t.Error("re-put block written to hot tier")
+	}
+
+	var keys int
+	ch, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range ch {
+		keys++
+	}
+	if keys != 1 {
+		t.Errorf("expected 1 key, got %d", keys)
+	}
+
+	if err := bs.DeleteBlock(ctx, blk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := bs.Has(ctx, blk.Cid()); has {
+		t.Error("deleted block still reported by Has")
+	}
+	if has, _ := cold.Has(ctx, blk.Cid()); has {
+		t.Error("deleted block still in cold tier")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	hot, _, bs := newTiers()
+
+	dserv := NewPolicy(bs, nil, nil).dag
+	leaf := merkledag.NodeWithData([]byte("leaf"))
+	root := merkledag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	unpinned := merkledag.NodeWithData([]byte("unpinned"))
+	if err := dserv.AddMany(ctx, []ipld.Node{leaf, root, unpinned}); err != nil {
+		t.Fatal(err)
+	}
+
+	pinner, err := dspinner.New(ctx, dssync.MutexWrap(ds.NewMapDatastore()), dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPolicy(bs, pinner, []cid.Cid{root.Cid(), unpinned.Cid()})
+	if err := p.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []cid.Cid{root.Cid(), leaf.Cid()} {
+		if cold, _ := bs.IsCold(ctx, c); !cold {
+			t.Errorf("%s was not offloaded", c)
+		}
+		if has, _ := hot.Has(ctx, c); has {
+			t.Errorf("%s still in hot tier", c)
+		}
+	}
+	if cold, _ := bs.IsCold(ctx, unpinned.Cid()); cold {
+		t.Error("unpinned root was offloaded")
+	}
+
+	if _, pinned, _ := pinner.IsPinnedWithType(ctx, leaf.Cid(), pin.Indirect); !pinned {
+		t.Error("leaf should still be indirectly pinned")
+	}
+
+	// once unpinned and collected, the DAG added back is offloaded again
+	if err := pinner.Unpin(ctx, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{root.Cid(), leaf.Cid()} {
+		if err := bs.DeleteBlock(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dserv.AddMany(ctx, []ipld.Node{leaf, root}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, root, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{root.Cid(), leaf.Cid()} {
+		if cold, _ := bs.IsCold(ctx, c); !cold {
+			t.Errorf("%s was not offloaded again", c)
+		}
+	}
+
+	// unpinning alone clears the record of the offloaded DAG too
+	if err := pinner.Unpin(ctx, root.Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if done, _ := bs.roots.Has(ctx, dshelp.MultihashToDsKey(root.Cid().Hash())); done {
+		t.Error("unpinned root still recorded as offloaded")
+	}
+}
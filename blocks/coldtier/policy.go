@@ -0,0 +1,119 @@
+package coldtier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+// Policy offloads the blocks of a fixed set of recursively pinned DAGs to the
+// cold tier.
+type Policy struct {
+	bs     *Blockstore
+	dag    ipld.DAGService
+	pinner pin.Pinner
+	roots  []cid.Cid
+}
+
+// NewPolicy returns a policy offloading the DAGs under roots. Roots that are
+// not recursively pinned are skipped.
+func NewPolicy(bs *Blockstore, pinner pin.Pinner, roots []cid.Cid) *Policy {
+	return &Policy{
+		bs:     bs,
+		dag:    merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs))),
+		pinner: pinner,
+		roots:  roots,
+	}
+}
+
+// Apply offloads every block of every selected DAG that is still in the hot
+// tier. DAGs that have been fully offloaded before are not walked again,
+// until they are unpinned: their blocks may then be collected, and written
+// back to the hot tier when they are added again.
+func (p *Policy) Apply(ctx context.Context) error {
+	for _, root := range p.roots {
+		k := dshelp.MultihashToDsKey(root.Hash())
+
+		_, pinned, err := p.pinner.IsPinnedWithType(ctx, root, pin.Recursive)
+		if err != nil {
+			return err
+		}
+		if !pinned {
+			log.Warnf("not offloading %s: not pinned recursively", root)
+			if err := p.bs.roots.Delete(ctx, k); err != nil {
+				return err
+			}
+			continue
+		}
+
+		done, err := p.bs.roots.Has(ctx, k)
+		if err != nil {
+			return err
+		}
+		if done {
+			continue
+		}
+
+		n, err := p.offloadDAG(ctx, root)
+		if err != nil {
+			return fmt.Errorf("offloading %s: %w", root, err)
+		}
+		if err := p.bs.roots.Put(ctx, k, nil); err != nil {
+			return err
+		}
+		log.Infof("offloaded %d blocks of %s to the cold tier", n, root)
+	}
+	return nil
+}
+
+// offloadDAG walks the DAG under root, moving each block to the cold tier
+// once its links have been read.
+func (p *Policy) offloadDAG(ctx context.Context, root cid.Cid) (int, error) {
+	var n int
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		nd, err := p.dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		cold, err := p.bs.IsCold(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if !cold {
+			if err := p.bs.Offload(ctx, c); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		return nd.Links(), nil
+	}
+
+	err := merkledag.Walk(ctx, getLinks, root, cid.NewSet().Visit)
+	return n, err
+}
+
+// Run applies the policy every interval until ctx is canceled.
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Apply(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("applying cold tier policy: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,306 @@
+// Package groupcommit implements a blockstore committing the blocks written
+// concurrently together, in one batch of the datastore.
+//
+// Adding a file writes its blocks in many small batches, several in parallel.
+// On datastores where each commit syncs to disk, such as flatfs and badger,
+// the syncs bound the throughput of the add. The group commit blockstore
+// queues the blocks written while a commit is in progress, and commits them
+// all in the next one, so that the number of syncs follows the speed of the
+// disk instead of the number of writes.
+package groupcommit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Options are the limits of the commits.
+type Options struct {
+	// MaxBlocks is the maximum number of blocks of a commit.
+	MaxBlocks int
+	// MaxSize is the maximum size of the blocks of a commit, in bytes.
+	MaxSize int
+	// FlushInterval is how long a commit waits for more blocks to be written,
+	// unless the limits are reached. Zero commits right away.
+	FlushInterval time.Duration
+}
+
+// Blockstore commits the blocks written to its underlying blockstore in
+// groups. The writes return once their blocks are committed, and the blocks
+// waiting to be committed can already be read.
+type Blockstore struct {
+	blockstore.Blockstore
+	opts Options
+
+	mu sync.Mutex
+	// pending are the blocks waiting to be committed, by multihash
+	pending map[string]blocks.Block
+	queue   []*write
+	size    int
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+var _ blockstore.Blockstore = (*Blockstore)(nil)
+
+// write is a Put or PutMany waiting for its blocks to be committed.
+type write struct {
+	blocks []blocks.Block
+	size   int
+	err    chan error
+}
+
+// Default limits of the commits.
+const (
+	DefaultMaxBlocks = 1024
+	DefaultMaxSize   = 64 << 20
+)
+
+// New returns a group commit blockstore over bs, committing until Close is
+// called. The limits left to zero in opts take their default values.
+func New(bs blockstore.Blockstore, opts Options) *Blockstore {
+	if opts.MaxBlocks <= 0 {
+		opts.MaxBlocks = DefaultMaxBlocks
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	gc := &Blockstore{
+		Blockstore: bs,
+		opts:       opts,
+		pending:    make(map[string]blocks.Block),
+		wake:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+	go gc.run()
+	return gc
+}
+
+// Put commits b with the blocks written concurrently.
+func (gc *Blockstore) Put(ctx context.Context, b blocks.Block) error {
+	return gc.PutMany(ctx, []blocks.Block{b})
+}
+
+// PutMany commits bs with the blocks written concurrently.
+func (gc *Blockstore) PutMany(ctx context.Context, bs []blocks.Block) error {
+	if len(bs) == 0 {
+		return nil
+	}
+	w := &write{blocks: bs, err: make(chan error, 1)}
+	for _, b := range bs {
+		w.size += len(b.RawData())
+	}
+
+	gc.mu.Lock()
+	if gc.closed {
+		gc.mu.Unlock()
+		return gc.Blockstore.PutMany(ctx, bs)
+	}
+	for _, b := range bs {
+		gc.pending[string(b.Cid().Hash())] = b
+	}
+	gc.queue = append(gc.queue, w)
+	gc.size += w.size
+	gc.wakeLocked()
+	gc.mu.Unlock()
+
+	select {
+	case err := <-w.err:
+		return err
+	case <-ctx.Done():
+		// the blocks may still be committed
+		return ctx.Err()
+	}
+}
+
+// Has reports whether c is stored or waiting to be committed.
+func (gc *Blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if _, ok := gc.get(c); ok {
+		return true, nil
+	}
+	return gc.Blockstore.Has(ctx, c)
+}
+
+// Get returns the block of c, stored or waiting to be committed.
+func (gc *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if b, ok := gc.get(c); ok {
+		return blocks.NewBlockWithCid(b.RawData(), c)
+	}
+	return gc.Blockstore.Get(ctx, c)
+}
+
+// GetSize returns the size of the block of c, stored or waiting to be
+// committed.
+func (gc *Blockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	if b, ok := gc.get(c); ok {
+		return len(b.RawData()), nil
+	}
+	return gc.Blockstore.GetSize(ctx, c)
+}
+
+// DeleteBlock deletes c once the blocks waiting are committed, so that it is
+// not written again after.
+func (gc *Blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	if _, ok := gc.get(c); ok {
+		if err := gc.flush(ctx); err != nil {
+			return err
+		}
+	}
+	return gc.Blockstore.DeleteBlock(ctx, c)
+}
+
+// AllKeysChan lists the keys of the blockstore once the blocks waiting are
+// committed.
+func (gc *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	if err := gc.flush(ctx); err != nil {
+		return nil, err
+	}
+	return gc.Blockstore.AllKeysChan(ctx)
+}
+
+// Close commits the blocks waiting, and stops grouping the writes.
+func (gc *Blockstore) Close() error {
+	gc.mu.Lock()
+	if gc.closed {
+		gc.mu.Unlock()
+		return nil
+	}
+	gc.closed = true
+	close(gc.wake)
+	gc.mu.Unlock()
+
+	<-gc.done
+	return nil
+}
+
+// wakeLocked wakes the committer up, unless it already is. It must be called
+// with gc.mu held and gc not closed, as Close closes gc.wake under gc.mu.
+func (gc *Blockstore) wakeLocked() {
+	select {
+	case gc.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (gc *Blockstore) get(c cid.Cid) (blocks.Block, bool) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	b, ok := gc.pending[string(c.Hash())]
+	return b, ok
+}
+
+// flush waits for the blocks waiting to be committed.
+func (gc *Blockstore) flush(ctx context.Context) error {
+	// the writes are committed in order: once an empty write queued last is,
+	// all the others are too, and their errors are passed on to their writers
+	w := &write{err: make(chan error, 1)}
+	gc.mu.Lock()
+	if gc.closed || len(gc.queue) == 0 {
+		gc.mu.Unlock()
+		return nil
+	}
+	gc.queue = append(gc.queue, w)
+	gc.wakeLocked()
+	gc.mu.Unlock()
+
+	select {
+	case <-w.err:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run commits the writes queued, until Close.
+func (gc *Blockstore) run() {
+	defer close(gc.done)
+	for {
+		_, open := <-gc.wake
+		if open && gc.opts.FlushInterval > 0 {
+			gc.gather()
+		}
+		for gc.commit() {
+		}
+		if !open {
+			return
+		}
+	}
+}
+
+// gather waits for more blocks to be written, until the limits of a commit
+// are reached or the flush interval elapses.
+func (gc *Blockstore) gather() {
+	t := time.NewTimer(gc.opts.FlushInterval)
+	defer t.Stop()
+	for !gc.full() {
+		select {
+		case _, open := <-gc.wake:
+			if !open {
+				return
+			}
+		case <-t.C:
+			return
+		}
+	}
+}
+
+func (gc *Blockstore) full() bool {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	n := 0
+	for _, w := range gc.queue {
+		n += len(w.blocks)
+	}
+	return n >= gc.opts.MaxBlocks || gc.size >= gc.opts.MaxSize
+}
+
+// commit commits the writes at the head of the queue, up to the limits of a
+// commit, and reports whether any was.
+func (gc *Blockstore) commit() bool {
+	gc.mu.Lock()
+	var (
+		ws   []*write
+		bs   []blocks.Block
+		size int
+	)
+	for _, w := range gc.queue {
+		if len(ws) > 0 && (len(bs)+len(w.blocks) > gc.opts.MaxBlocks || size+w.size > gc.opts.MaxSize) {
+			break
+		}
+		ws = append(ws, w)
+		bs = append(bs, w.blocks...)
+		size += w.size
+	}
+	gc.queue = gc.queue[len(ws):]
+	gc.mu.Unlock()
+	if len(ws) == 0 {
+		return false
+	}
+
+	var err error
+	if len(bs) > 0 {
+		err = gc.Blockstore.PutMany(context.Background(), bs)
+	}
+
+	gc.mu.Lock()
+	gc.size -= size
+	for _, b := range bs {
+		k := string(b.Cid().Hash())
+		if gc.pending[k] == b {
+			delete(gc.pending, k)
+		}
+	}
+	gc.mu.Unlock()
+
+	for _, w := range ws {
+		w.err <- err
+	}
+	return true
+}
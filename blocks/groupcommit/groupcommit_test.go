@@ -0,0 +1,198 @@
+package groupcommit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// gatedBlockstore records the batches committed, and holds each commit until
+// released.
+type gatedBlockstore struct {
+	blockstore.Blockstore
+
+	mu      sync.Mutex
+	batches []int
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGated() *gatedBlockstore {
+	return &gatedBlockstore{
+		Blockstore: blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())),
+		started:    make(chan struct{}, 100),
+		release:    make(chan struct{}),
+	}
+}
+
+func (g *gatedBlockstore) PutMany(ctx context.Context, bs []blocks.Block) error {
+	g.started <- struct{}{}
+	<-g.release
+	g.mu.Lock()
+	g.batches = append(g.batches, len(bs))
+	g.mu.Unlock()
+	return g.Blockstore.PutMany(ctx, bs)
+}
+
+func newBlocks(n int) []blocks.Block {
+	bs := make([]blocks.Block, n)
+	for i := range bs {
+		bs[i] = blocks.NewBlock([]byte(fmt.Sprintf("block %d", i)))
+	}
+	return bs
+}
+
+func TestGroupCommit(t *testing.T) {
+	ctx := context.Background()
+	g := newGated()
+	bs := New(g, Options{})
+	defer bs.Close()
+
+	blks := newBlocks(11)
+	var wg sync.WaitGroup
+	put := func(b blocks.Block) {
+		defer wg.Done()
+		if err := bs.Put(ctx, b); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// the first write is committed alone, the ones made meanwhile together
+	wg.Add(1)
+	go put(blks[0])
+	<-g.started
+	wg.Add(10)
+	for _, b := range blks[1:] {
+		go put(b)
+	}
+	for _, b := range blks[1:] {
+		for {
+			if has, _ := bs.Has(ctx, b.Cid()); has {
+				break
+			}
+		}
+		got, err := bs.Get(ctx, b.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got.RawData()) != string(b.RawData()) {
+			t.Fatal("wrong data of a waiting block")
+		}
+	}
+	close(g.release)
+	wg.Wait()
+
+	if fmt.Sprint(g.batches) != "[1 10]" {
+		t.Fatalf("committed batches %v, expected [1 10]", g.batches)
+	}
+	for _, b := range blks {
+		if has, _ := g.Has(ctx, b.Cid()); !has {
+			t.Fatal("block not committed")
+		}
+	}
+}
+
+func TestGroupCommitLimits(t *testing.T) {
+	ctx := context.Background()
+	g := newGated()
+	bs := New(g, Options{MaxBlocks: 4})
+	defer bs.Close()
+
+	blks := newBlocks(11)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		bs.Put(ctx, blks[0])
+	}()
+	<-g.started
+	// the writes are not split, a batch holds as many as fit
+	for _, n := range []int{3, 3, 2, 2} {
+		wg.Add(1)
+		go func(bl []blocks.Block) {
+			defer wg.Done()
+			bs.PutMany(ctx, bl)
+		}(blks[1 : 1+n])
+	}
+	for {
+		bs.mu.Lock()
+		n := len(bs.queue)
+		bs.mu.Unlock()
+		if n == 4 {
+			break
+		}
+	}
+	close(g.release)
+	wg.Wait()
+
+	total := 0
+	for _, n := range g.batches[1:] {
+		if n > 4 {
+			t.Fatalf("batch of %d blocks, over the limit", n)
+		}
+		total += n
+	}
+	if total != 10 {
+		t.Fatalf("committed %d blocks, expected 10", total)
+	}
+}
+
+func TestGroupCommitClose(t *testing.T) {
+	ctx := context.Background()
+	g := newGated()
+	close(g.release)
+	bs := New(g, Options{})
+
+	blks := newBlocks(2)
+	if err := bs.Put(ctx, blks[0]); err != nil {
+		t.Fatal(err)
+	}
+	bs.Close()
+	// after close, the writes are committed directly
+	if err := bs.Put(ctx, blks[1]); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range blks {
+		if has, _ := g.Has(ctx, b.Cid()); !has {
+			t.Fatal("block not committed")
+		}
+	}
+}
+
+func TestGroupCommitCloseConcurrent(t *testing.T) {
+	ctx := context.Background()
+	g := newGated()
+	close(g.release)
+	bs := New(g, Options{})
+
+	// the writes racing Close are committed, before or after it
+	blks := newBlocks(100)
+	var wg sync.WaitGroup
+	for _, b := range blks {
+		wg.Add(1)
+		go func(b blocks.Block) {
+			defer wg.Done()
+			if err := bs.Put(ctx, b); err != nil {
+				t.Error(err)
+			}
+			if _, err := bs.AllKeysChan(ctx); err != nil {
+				t.Error(err)
+			}
+		}(b)
+	}
+	bs.Close()
+	wg.Wait()
+
+	for _, b := range blks {
+		if has, _ := g.Has(ctx, b.Cid()); !has {
+			t.Fatal("block not committed")
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Package placement implements a blockstore storing the blocks in several
+// blockstores, the main one and mounts, by rules on the size and the codec of
+// the blocks, or on the labels of their pins.
+//
+// The blocks are placed when put, by the rules on their size and codec. The
+// labels of the pins of a block are only known once it is pinned, so the
+// blocks of the labeled pins are moved to their mount later, by a Policy.
+package placement
+
+import (
+	"context"
+	"fmt"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("placement")
+
+// Main is the name the rules give to the main blockstore.
+const Main = "main"
+
+var (
+	// blocksPrefix is where the mount of the blocks not in the main
+	// blockstore is recorded.
+	blocksPrefix = ds.NewKey("/placement/blocks")
+	// rootsPrefix is where the pins whose blocks were placed by their labels
+	// are recorded.
+	rootsPrefix = ds.NewKey("/placement/roots")
+)
+
+// Rule places the blocks matching all its conditions in Mount.
+type Rule struct {
+	Mount string
+	// MinSize and MaxSize bound the size of the blocks, inclusive, 0 meaning
+	// no bound.
+	MinSize int
+	MaxSize int
+	// Codecs are the codecs of the blocks, all if empty.
+	Codecs []uint64
+	// PinLabels are the labels the recursive pins of the blocks all have,
+	// with these values.
+	PinLabels map[string]string
+}
+
+// matches tells whether the rule places blk, a block of a pin with labels,
+// nil when not known.
+func (r Rule) matches(blk blocks.Block, labels map[string]string) bool {
+	size := len(blk.RawData())
+	if size < r.MinSize || (r.MaxSize > 0 && size > r.MaxSize) {
+		return false
+	}
+	if len(r.Codecs) > 0 {
+		found := false
+		for _, c := range r.Codecs {
+			found = found || c == blk.Cid().Type()
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.PinLabels) > 0 {
+		return labels != nil && pinmeta.Filter{Labels: r.PinLabels}.Matches(pinmeta.Meta{Labels: labels})
+	}
+	return true
+}
+
+// Mount is a datastore the blocks are placed in besides the main blockstore.
+type Mount struct {
+	bs blockstore.Blockstore
+	ds ds.Datastore
+}
+
+// NewMount returns the mount storing the blocks in d, which holds nothing
+// else.
+func NewMount(d ds.Batching) Mount {
+	// not namespaced, which keeps it usable with flatfs
+	return Mount{bs: blockstore.NewBlockstoreNoPrefix(d), ds: d}
+}
+
+// Usage is the usage of a mount.
+type Usage struct {
+	// Blocks is the number of blocks of the mount, and Size the disk usage
+	// of its datastore, 0 if unknown.
+	Blocks uint64
+	Size   uint64
+}
+
+// Blockstore places the blocks in the main blockstore or in the mounts. The
+// mount of the blocks not in the main blockstore is recorded in a local
+// index, so that the blocks are looked up in the main blockstore and the
+// index only.
+type Blockstore struct {
+	main   blockstore.Blockstore
+	mounts map[string]Mount
+	rules  []Rule
+	index  ds.Datastore
+	roots  ds.Datastore
+}
+
+var _ blockstore.Blockstore = (*Blockstore)(nil)
+
+// New returns a blockstore placing the blocks by rules, in main or in mounts.
+// The index datastore must be local and persistent.
+func New(main blockstore.Blockstore, mounts map[string]Mount, rules []Rule, index ds.Datastore) (*Blockstore, error) {
+	for _, r := range rules {
+		if _, ok := mounts[r.Mount]; !ok && r.Mount != Main {
+			return nil, fmt.Errorf("no mount %q", r.Mount)
+		}
+	}
+	return &Blockstore{
+		main:   main,
+		mounts: mounts,
+		rules:  rules,
+		index:  namespace.Wrap(index, blocksPrefix),
+		roots:  namespace.Wrap(index, rootsPrefix),
+	}, nil
+}
+
+// place returns the mount of the first rule placing blk, a block of a pin
+// with labels, nil when not known, or Main.
+func (bs *Blockstore) place(blk blocks.Block, labels map[string]string) string {
+	for _, r := range bs.rules {
+		if r.matches(blk, labels) {
+			return r.Mount
+		}
+	}
+	return Main
+}
+
+func (bs *Blockstore) store(name string) blockstore.Blockstore {
+	if name == Main {
+		return bs.main
+	}
+	return bs.mounts[name].bs
+}
+
+// Locate returns the mount of the block c, Main, or "" if c is not stored.
+func (bs *Blockstore) Locate(ctx context.Context, c cid.Cid) (string, error) {
+	has, err := bs.main.Has(ctx, c)
+	if err != nil || has {
+		return Main, err
+	}
+	name, err := bs.index.Get(ctx, dshelp.MultihashToDsKey(c.Hash()))
+	switch {
+	case err == ds.ErrNotFound:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	if _, ok := bs.mounts[string(name)]; !ok {
+		return "", fmt.Errorf("block %s in mount %q, which is not mounted", c, name)
+	}
+	return string(name), nil
+}
+
+// Move moves the block c to the mount name, or to Main. It is a no-op if the
+// block is there already.
+//
+// The block is written to its mount and recorded in the index before it is
+// removed from the previous one, so it stays readable throughout.
+func (bs *Blockstore) Move(ctx context.Context, c cid.Cid, name string) error {
+	from, err := bs.Locate(ctx, c)
+	if err != nil || from == name {
+		return err
+	}
+	if from == "" {
+		return ipld.ErrNotFound{Cid: c}
+	}
+	blk, err := bs.store(from).Get(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := bs.store(name).Put(ctx, blk); err != nil {
+		return err
+	}
+	k := dshelp.MultihashToDsKey(c.Hash())
+	if name == Main {
+		if err := bs.index.Delete(ctx, k); err != nil {
+			return err
+		}
+	} else if err := bs.index.Put(ctx, k, []byte(name)); err != nil {
+		return err
+	}
+	return bs.store(from).DeleteBlock(ctx, c)
+}
+
+func (bs *Blockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	name, err := bs.Locate(ctx, c)
+	return name != "", err
+}
+
+func (bs *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	name, err := bs.Locate(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+	return bs.store(name).Get(ctx, c)
+}
+
+func (bs *Blockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	name, err := bs.Locate(ctx, c)
+	if err != nil {
+		return -1, err
+	}
+	if name == "" {
+		return -1, ipld.ErrNotFound{Cid: c}
+	}
+	return bs.store(name).GetSize(ctx, c)
+}
+
+// Put stores blk where the rules place it, unless it is stored already.
+func (bs *Blockstore) Put(ctx context.Context, blk blocks.Block) error {
+	return bs.PutMany(ctx, []blocks.Block{blk})
+}
+
+// PutMany stores the blocks where the rules place them, but the ones stored
+// already.
+func (bs *Blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	placed := make(map[string][]blocks.Block)
+	for _, blk := range blks {
+		name, err := bs.Locate(ctx, blk.Cid())
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			name = bs.place(blk, nil)
+			placed[name] = append(placed[name], blk)
+		}
+	}
+	for name, blks := range placed {
+		if err := bs.store(name).PutMany(ctx, blks); err != nil {
+			return err
+		}
+		if name == Main {
+			continue
+		}
+		for _, blk := range blks {
+			if err := bs.index.Put(ctx, dshelp.MultihashToDsKey(blk.Cid().Hash()), []byte(name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DeleteBlock removes a block from whichever blockstore holds it.
+func (bs *Blockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	name, err := bs.Locate(ctx, c)
+	if err != nil {
+		return err
+	}
+	if name == Main || name == "" {
+		return bs.main.DeleteBlock(ctx, c)
+	}
+	if err := bs.store(name).DeleteBlock(ctx, c); err != nil && !ipld.IsNotFound(err) {
+		return err
+	}
+	return bs.index.Delete(ctx, dshelp.MultihashToDsKey(c.Hash()))
+}
+
+// AllKeysChan returns the keys of the main blockstore and of the mounts,
+// read from the index rather than by listing the mounts.
+func (bs *Blockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	mainCh, err := bs.main.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bs.index.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	output := make(chan cid.Cid, dsq.KeysOnlyBufSize)
+	go func() {
+		defer func() {
+			res.Close() // ensure exit (signals early exit, too)
+			close(output)
+		}()
+
+		for c := range mainCh {
+			select {
+			case output <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		for {
+			e, ok := res.NextSync()
+			if !ok {
+				return
+			}
+			if e.Error != nil {
+				log.Errorf("placement.AllKeysChan got err: %s", e.Error)
+				return
+			}
+
+			mh, err := dshelp.DsKeyToMultihash(ds.RawKey(e.Key))
+			if err != nil {
+				log.Warnf("error parsing key from binary: %s", err)
+				continue
+			}
+			select {
+			case output <- cid.NewCidV1(cid.Raw, mh):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return output, nil
+}
+
+func (bs *Blockstore) HashOnRead(enabled bool) {
+	bs.main.HashOnRead(enabled)
+	for _, m := range bs.mounts {
+		m.bs.HashOnRead(enabled)
+	}
+}
+
+// Usage returns the usage of the mounts, by name. It reads the whole index.
+func (bs *Blockstore) Usage(ctx context.Context) (map[string]Usage, error) {
+	usage := make(map[string]Usage, len(bs.mounts))
+	for name, m := range bs.mounts {
+		size, err := ds.DiskUsage(ctx, m.ds)
+		if err != nil {
+			return nil, err
+		}
+		usage[name] = Usage{Size: size}
+	}
+
+	res, err := bs.index.Query(ctx, dsq.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		if u, ok := usage[string(e.Value)]; ok {
+			u.Blocks++
+			usage[string(e.Value)] = u
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,194 @@
+package placement
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+func newBlockstore(t *testing.T, rules []Rule) (main blockstore.Blockstore, mounts map[string]Mount, bs *Blockstore) {
+	main = blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	mounts = map[string]Mount{
+		"fast": NewMount(dssync.MutexWrap(ds.NewMapDatastore())),
+		"slow": NewMount(dssync.MutexWrap(ds.NewMapDatastore())),
+	}
+	bs, err := New(main, mounts, rules, dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return main, mounts, bs
+}
+
+func TestPlacement(t *testing.T) {
+	ctx := context.Background()
+	main, mounts, bs := newBlockstore(t, []Rule{
+		{Mount: Main, Codecs: []uint64{cid.DagCBOR}},
+		{Mount: "fast", MaxSize: 8},
+		{Mount: "slow", MinSize: 16, Codecs: []uint64{cid.Raw}},
+	})
+
+	small := blocks.NewBlock([]byte("small"))
+	large := merkledag.NewRawNode([]byte("a large leaf of raw data"))
+	medium := blocks.NewBlock([]byte("medium block"))
+	if err := bs.PutMany(ctx, []blocks.Block{small, large, medium}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		blk   blocks.Block
+		mount string
+	}{
+		{small, "fast"},
+		{large, "slow"},
+		{medium, Main},
+	} {
+		if name, err := bs.Locate(ctx, c.blk.Cid()); err != nil || name != c.mount {
+			t.Errorf("expected %q in %s, got %q, %v", c.blk.RawData(), c.mount, name, err)
+		}
+		store := main
+		if c.mount != Main {
+			store = mounts[c.mount].bs
+		}
+		if has, _ := store.Has(ctx, c.blk.Cid()); !has {
+			t.Errorf("expected %q stored in %s", c.blk.RawData(), c.mount)
+		}
+		got, err := bs.Get(ctx, c.blk.Cid())
+		if err != nil || string(got.RawData()) != string(c.blk.RawData()) {
+			t.Errorf("expected %q read back, got %v", c.blk.RawData(), err)
+		}
+	}
+	if has, _ := main.Has(ctx, small.Cid()); has {
+		t.Error("expected the small block not in the main blockstore")
+	}
+	if size, err := bs.GetSize(ctx, large.Cid()); err != nil || size != len(large.RawData()) {
+		t.Errorf("expected the size of the large block, got %d, %v", size, err)
+	}
+
+	// moved, the block stays where it is when put again
+	if err := bs.Move(ctx, small.Cid(), "slow"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(ctx, small); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := bs.Locate(ctx, small.Cid()); name != "slow" {
+		t.Errorf("expected the small block moved, in %q", name)
+	}
+	if has, _ := mounts["fast"].bs.Has(ctx, small.Cid()); has {
+		t.Error("expected the small block moved out of fast")
+	}
+
+	usage, err := bs.Usage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage["fast"].Blocks != 0 || usage["slow"].Blocks != 2 {
+		t.Errorf("unexpected usage %+v", usage)
+	}
+
+	var keys int
+	ch, err := bs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range ch {
+		keys++
+	}
+	if keys != 3 {
+		t.Errorf("expected 3 keys, got %d", keys)
+	}
+
+	for _, blk := range []blocks.Block{small, large, medium} {
+		if err := bs.DeleteBlock(ctx, blk.Cid()); err != nil {
+			t.Fatal(err)
+		}
+		if has, _ := bs.Has(ctx, blk.Cid()); has {
+			t.Errorf("expected %q deleted", blk.RawData())
+		}
+	}
+	if has, _ := mounts["slow"].bs.Has(ctx, large.Cid()); has {
+		t.Error("expected the large block deleted from slow")
+	}
+
+	if _, err := New(main, mounts, []Rule{{Mount: "none"}}, dssync.MutexWrap(ds.NewMapDatastore())); err == nil {
+		t.Error("expected the rules of unknown mounts refused")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	main, mounts, bs := newBlockstore(t, []Rule{
+		{Mount: "slow", PinLabels: map[string]string{"tier": "archive"}},
+	})
+	meta := pinmeta.New(dssync.MutexWrap(ds.NewMapDatastore()))
+	dserv := NewPolicy(bs, nil, meta).dag
+
+	leaf := merkledag.NodeWithData([]byte("leaf"))
+	root := merkledag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	other := merkledag.NodeWithData([]byte("other"))
+	if err := dserv.AddMany(ctx, []ipld.Node{leaf, root, other}); err != nil {
+		t.Fatal(err)
+	}
+	pinner, err := dspinner.New(ctx, dssync.MutexWrap(ds.NewMapDatastore()), dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, nd := range []ipld.Node{root, other} {
+		if err := pinner.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := meta.Set(ctx, pinmeta.Meta{Root: root.Cid(), Labels: map[string]string{"tier": "archive", "owner": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := meta.Set(ctx, pinmeta.Meta{Root: other.Cid(), Labels: map[string]string{"tier": "hot"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPolicy(bs, pinner, meta)
+	if err := p.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []cid.Cid{root.Cid(), leaf.Cid()} {
+		if has, _ := mounts["slow"].bs.Has(ctx, c); !has {
+			t.Errorf("expected %s moved to slow", c)
+		}
+		if has, _ := main.Has(ctx, c); has {
+			t.Errorf("expected %s moved out of main", c)
+		}
+	}
+	if name, _ := bs.Locate(ctx, other.Cid()); name != Main {
+		t.Errorf("expected the other pin left in main, in %q", name)
+	}
+
+	// relabeled, the pin is placed again
+	if err := meta.Set(ctx, pinmeta.Meta{Root: root.Cid(), Labels: map[string]string{"tier": "hot"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := meta.Set(ctx, pinmeta.Meta{Root: other.Cid(), Labels: map[string]string{"tier": "archive"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Apply(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := bs.Locate(ctx, other.Cid()); name != "slow" {
+		t.Errorf("expected the relabeled pin moved to slow, in %q", name)
+	}
+	for _, c := range []cid.Cid{root.Cid(), leaf.Cid()} {
+		if name, _ := bs.Locate(ctx, c); name != Main {
+			t.Errorf("expected %s moved back to main, in %q", c, name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package placement
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+// Policy moves the blocks of the recursive pins selected by the rules on the
+// labels of the pins to their mount.
+type Policy struct {
+	bs     *Blockstore
+	dag    ipld.DAGService
+	pinner pin.Pinner
+	meta   *pinmeta.Store
+}
+
+// NewPolicy returns a policy moving the blocks of the pins of pinner, whose
+// labels are in meta.
+func NewPolicy(bs *Blockstore, pinner pin.Pinner, meta *pinmeta.Store) *Policy {
+	return &Policy{
+		bs:     bs,
+		dag:    merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs))),
+		pinner: pinner,
+		meta:   meta,
+	}
+}
+
+// Apply places every block of the pins selected by the rules on their labels.
+// The pins placed before are not walked again, unless their labels or the
+// rules changed since, their blocks then being placed again, by the other
+// rules if the pins are no longer selected.
+func (p *Policy) Apply(ctx context.Context) error {
+	metas, err := p.meta.List(ctx, pinmeta.Filter{})
+	if err != nil {
+		return err
+	}
+	for _, m := range metas {
+		k := dshelp.MultihashToDsKey(m.Root.Hash())
+		placed, err := p.bs.roots.Get(ctx, k)
+		switch {
+		case err == ds.ErrNotFound:
+			if !p.selects(m.Labels) {
+				continue
+			}
+		case err != nil:
+			return err
+		case string(placed) == p.fingerprint(m.Labels):
+			continue
+		}
+
+		_, pinned, err := p.pinner.IsPinnedWithType(ctx, m.Root, pin.Recursive)
+		if err != nil {
+			return err
+		}
+		if !pinned {
+			continue
+		}
+
+		n, err := p.placeDAG(ctx, m.Root, m.Labels)
+		if err != nil {
+			return fmt.Errorf("placing %s: %w", m.Root, err)
+		}
+		// the pins no longer selected are placed by the other rules, once
+		if !p.selects(m.Labels) {
+			err = p.bs.roots.Delete(ctx, k)
+		} else {
+			err = p.bs.roots.Put(ctx, k, []byte(p.fingerprint(m.Labels)))
+		}
+		if err != nil {
+			return err
+		}
+		log.Infof("moved %d blocks of %s to their mount", n, m.Root)
+	}
+	return nil
+}
+
+// selects tells whether a rule selects the pins with labels.
+func (p *Policy) selects(labels map[string]string) bool {
+	m := pinmeta.Meta{Labels: labels}
+	for _, r := range p.bs.rules {
+		if len(r.PinLabels) > 0 && (pinmeta.Filter{Labels: r.PinLabels}).Matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprint identifies the labels of a pin and the rules its blocks were
+// placed by.
+func (p *Policy) fingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%q=%q,", k, labels[k])
+	}
+	fmt.Fprintf(&b, "%v", p.bs.rules)
+	return b.String()
+}
+
+// placeDAG walks the DAG under root, a pin with labels, moving each block to
+// its mount once its links have been read.
+func (p *Policy) placeDAG(ctx context.Context, root cid.Cid, labels map[string]string) (int, error) {
+	var n int
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		nd, err := p.dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		name := p.bs.place(nd, labels)
+		from, err := p.bs.Locate(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if from != name {
+			if err := p.bs.Move(ctx, c, name); err != nil {
+				return nil, err
+			}
+			n++
+		}
+		return nd.Links(), nil
+	}
+
+	err := merkledag.Walk(ctx, getLinks, root, cid.NewSet().Visit)
+	return n, err
+}
+
+// Run applies the policy every interval until ctx is canceled.
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.Apply(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("applying the placement policy: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
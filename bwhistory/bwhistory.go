@@ -0,0 +1,181 @@
+// Package bwhistory records the history of the bandwidth used by the node, in
+// total and by protocol and peer, so that the bandwidth used in the past
+// minutes can be told apart from the totals since the start.
+//
+// The Recorder samples the totals of a bandwidth reporter at an interval, and
+// keeps the traffic of each interval for a bounded retention. Only the peers
+// with the most traffic are kept in each sample, as a node may talk to
+// thousands of peers.
+package bwhistory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// Traffic is the number of bytes received and sent.
+type Traffic struct {
+	In  int64
+	Out int64
+}
+
+// Sample is the traffic of an interval.
+type Sample struct {
+	// Time is the end of the interval
+	Time time.Time
+	// Interval is the duration of the interval
+	Interval  time.Duration
+	Total     Traffic
+	Protocols map[protocol.ID]Traffic
+	// Peers is the traffic of the peers with the most traffic
+	Peers map[peer.ID]Traffic
+}
+
+// Settings are the settings of a Recorder.
+type Settings struct {
+	// Interval is the interval between the samples
+	Interval time.Duration
+	// Retention is how long the samples are kept
+	Retention time.Duration
+	// MaxPeers is the number of peers kept in each sample
+	MaxPeers int
+}
+
+// Recorder records the history of the bandwidth of a reporter.
+type Recorder struct {
+	reporter metrics.Reporter
+	settings Settings
+
+	mu      sync.Mutex
+	samples []Sample
+
+	// the totals at the last sample, the traffic of the next interval being
+	// the difference with them
+	last      time.Time
+	total     metrics.Stats
+	protocols map[protocol.ID]metrics.Stats
+	peers     map[peer.ID]metrics.Stats
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// New returns a recorder sampling reporter, until Close is called.
+func New(reporter metrics.Reporter, settings Settings) *Recorder {
+	r := &Recorder{
+		reporter: reporter,
+		settings: settings,
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	r.sample(time.Now())
+	go r.run()
+	return r
+}
+
+// Settings returns the settings of the recorder.
+func (r *Recorder) Settings() Settings {
+	return r.settings
+}
+
+// Samples returns the samples of the intervals ended after since, oldest
+// first.
+func (r *Recorder) Samples(since time.Time) []Sample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := sort.Search(len(r.samples), func(i int) bool {
+		return r.samples[i].Time.After(since)
+	})
+	return append([]Sample(nil), r.samples[i:]...)
+}
+
+// Close stops sampling.
+func (r *Recorder) Close() error {
+	close(r.closing)
+	<-r.closed
+	return nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.closed)
+	t := time.NewTicker(r.settings.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			r.sample(now)
+		case <-r.closing:
+			return
+		}
+	}
+}
+
+// sample records the traffic since the last sample, and drops the samples
+// past the retention.
+func (r *Recorder) sample(now time.Time) {
+	total := r.reporter.GetBandwidthTotals()
+	protocols := r.reporter.GetBandwidthByProtocol()
+	peers := r.reporter.GetBandwidthByPeer()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.last.IsZero() {
+		s := Sample{
+			Time:      now,
+			Interval:  now.Sub(r.last),
+			Total:     traffic(total, r.total),
+			Protocols: make(map[protocol.ID]Traffic),
+			Peers:     make(map[peer.ID]Traffic),
+		}
+		for p, st := range protocols {
+			if t := traffic(st, r.protocols[p]); t != (Traffic{}) {
+				s.Protocols[p] = t
+			}
+		}
+		active := make([]peer.ID, 0, len(peers))
+		for p, st := range peers {
+			if t := traffic(st, r.peers[p]); t != (Traffic{}) {
+				s.Peers[p] = t
+				active = append(active, p)
+			}
+		}
+		if len(active) > r.settings.MaxPeers {
+			sort.Slice(active, func(i, j int) bool {
+				ti, tj := s.Peers[active[i]], s.Peers[active[j]]
+				return ti.In+ti.Out > tj.In+tj.Out
+			})
+			for _, p := range active[r.settings.MaxPeers:] {
+				delete(s.Peers, p)
+			}
+		}
+		r.samples = append(r.samples, s)
+	}
+
+	old := 0
+	for old < len(r.samples) && now.Sub(r.samples[old].Time) > r.settings.Retention {
+		old++
+	}
+	r.samples = r.samples[old:]
+
+	r.last = now
+	r.total = total
+	r.protocols = protocols
+	r.peers = peers
+}
+
+// traffic returns the traffic between the totals prev and cur. The reporter
+// forgets the idle peers and protocols, so totals lower than the previous ones
+// started over.
+func traffic(cur, prev metrics.Stats) Traffic {
+	t := Traffic{In: cur.TotalIn - prev.TotalIn, Out: cur.TotalOut - prev.TotalOut}
+	if t.In < 0 || t.Out < 0 {
+		return Traffic{In: cur.TotalIn, Out: cur.TotalOut}
+	}
+	return t
+}
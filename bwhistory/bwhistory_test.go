@@ -0,0 +1,113 @@
+package bwhistory
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+// fakeReporter reports the totals it is set to.
+type fakeReporter struct {
+	metrics.Reporter
+	protocols map[protocol.ID]metrics.Stats
+	peers     map[peer.ID]metrics.Stats
+}
+
+func (f *fakeReporter) add(p peer.ID, proto protocol.ID, in, out int64) {
+	st := f.peers[p]
+	st.TotalIn += in
+	st.TotalOut += out
+	f.peers[p] = st
+	st = f.protocols[proto]
+	st.TotalIn += in
+	st.TotalOut += out
+	f.protocols[proto] = st
+}
+
+func (f *fakeReporter) GetBandwidthTotals() metrics.Stats {
+	var total metrics.Stats
+	for _, st := range f.peers {
+		total.TotalIn += st.TotalIn
+		total.TotalOut += st.TotalOut
+	}
+	return total
+}
+
+func (f *fakeReporter) GetBandwidthByProtocol() map[protocol.ID]metrics.Stats {
+	m := make(map[protocol.ID]metrics.Stats)
+	for k, v := range f.protocols {
+		m[k] = v
+	}
+	return m
+}
+
+func (f *fakeReporter) GetBandwidthByPeer() map[peer.ID]metrics.Stats {
+	m := make(map[peer.ID]metrics.Stats)
+	for k, v := range f.peers {
+		m[k] = v
+	}
+	return m
+}
+
+func newRecorder(f *fakeReporter, settings Settings, start time.Time) *Recorder {
+	r := &Recorder{reporter: f, settings: settings}
+	r.sample(start)
+	return r
+}
+
+func TestSamples(t *testing.T) {
+	f := &fakeReporter{protocols: map[protocol.ID]metrics.Stats{}, peers: map[peer.ID]metrics.Stats{}}
+	start := time.Unix(1000, 0)
+	f.add("a", "/ipfs/bitswap", 500, 0)
+	r := newRecorder(f, Settings{Interval: time.Second, Retention: time.Minute, MaxPeers: 2}, start)
+
+	f.add("a", "/ipfs/bitswap", 100, 10)
+	f.add("b", "/ipfs/kad/1.0.0", 20, 200)
+	f.add("c", "/ipfs/kad/1.0.0", 1, 1)
+	r.sample(start.Add(time.Second))
+
+	s := r.Samples(time.Time{})
+	if len(s) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(s))
+	}
+	if s[0].Total != (Traffic{In: 121, Out: 211}) {
+		t.Errorf("wrong total %+v", s[0].Total)
+	}
+	if s[0].Protocols["/ipfs/bitswap"] != (Traffic{In: 100, Out: 10}) {
+		t.Errorf("wrong bitswap traffic %+v", s[0].Protocols["/ipfs/bitswap"])
+	}
+	if s[0].Protocols["/ipfs/kad/1.0.0"] != (Traffic{In: 21, Out: 201}) {
+		t.Errorf("wrong dht traffic %+v", s[0].Protocols["/ipfs/kad/1.0.0"])
+	}
+	// only the 2 peers with the most traffic are kept
+	if len(s[0].Peers) != 2 || s[0].Peers["a"] != (Traffic{In: 100, Out: 10}) || s[0].Peers["b"] != (Traffic{In: 20, Out: 200}) {
+		t.Errorf("wrong peers %+v", s[0].Peers)
+	}
+
+	// idle intervals are recorded, with no protocols nor peers
+	r.sample(start.Add(2 * time.Second))
+	s = r.Samples(start.Add(time.Second))
+	if len(s) != 1 || s[0].Total != (Traffic{}) || len(s[0].Peers) != 0 || len(s[0].Protocols) != 0 {
+		t.Errorf("wrong idle sample %+v", s)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	f := &fakeReporter{protocols: map[protocol.ID]metrics.Stats{}, peers: map[peer.ID]metrics.Stats{}}
+	start := time.Unix(1000, 0)
+	r := newRecorder(f, Settings{Interval: time.Second, Retention: 10 * time.Second, MaxPeers: 2}, start)
+
+	for i := 1; i <= 30; i++ {
+		r.sample(start.Add(time.Duration(i) * time.Second))
+	}
+	s := r.Samples(time.Time{})
+	if len(s) != 11 {
+		t.Fatalf("expected the samples of the last 10s, got %d", len(s))
+	}
+	if !s[0].Time.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("wrong oldest sample %s", s[0].Time)
+	}
+}
@@ -0,0 +1,65 @@
+// Package cancelwatch measures how long the network work of a request goes on
+// once the request is canceled: the fetches of the exchange and the queries
+// of the routing should stop with the context they are given, so that the
+// requests aborted by their clients do not keep wanting blocks from peers or
+// walking the DHT.
+//
+// The exchange and routing returned by NewExchange and NewRouting count the
+// operations still running after their context is done, and record how long
+// they overran it once they return.
+package cancelwatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// The layers watched.
+const (
+	LayerBitswap = "bitswap"
+	LayerRouting = "routing"
+)
+
+var (
+	canceledRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_canceled_operations_running",
+		Help: "network operations whose context is done, still running",
+	}, []string{"layer", "op"})
+	canceledOverrun = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ipfs_canceled_operations_overrun_seconds",
+		Help:    "time the network operations ran after their context was done",
+		Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 30},
+	}, []string{"layer", "op"})
+)
+
+// watch watches the operation op of layer running with ctx, until the
+// returned function is called once it returns.
+func watch(ctx context.Context, layer, op string) func() {
+	if ctx.Done() == nil {
+		// never canceled
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		select {
+		case <-done:
+			return
+		default:
+		}
+		canceled := time.Now()
+		running := canceledRunning.WithLabelValues(layer, op)
+		running.Inc()
+		<-done
+		canceledOverrun.WithLabelValues(layer, op).Observe(time.Since(canceled).Seconds())
+		running.Dec()
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,79 @@
+package cancelwatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// stubbornExchange fetches its block once released, whatever the context.
+type stubbornExchange struct {
+	exchange.Interface
+	blk     blocks.Block
+	release chan struct{}
+}
+
+func (e *stubbornExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	<-e.release
+	return e.blk, nil
+}
+
+func (e *stubbornExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block, 1)
+	go func() {
+		defer close(out)
+		<-e.release
+		out <- e.blk
+	}()
+	return out, nil
+}
+
+func waitRunning(t *testing.T, op string, want float64) {
+	t.Helper()
+	running := canceledRunning.WithLabelValues(LayerBitswap, op)
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(running) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %v %s running once canceled, got %v", want, op, testutil.ToFloat64(running))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCanceledRunning(t *testing.T) {
+	blk := blocks.NewBlock([]byte("block"))
+	ex := &stubbornExchange{blk: blk, release: make(chan struct{})}
+	wex := NewExchange(ex)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan error)
+	go func() {
+		_, err := wex.GetBlock(ctx, blk.Cid())
+		got <- err
+	}()
+	ch, err := wex.GetBlocks(ctx, []cid.Cid{blk.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	waitRunning(t, "get_block", 1)
+	waitRunning(t, "get_blocks", 1)
+
+	close(ex.release)
+	if err := <-got; err != nil {
+		t.Fatal(err)
+	}
+	for range ch {
+	}
+	waitRunning(t, "get_block", 0)
+	waitRunning(t, "get_blocks", 0)
+	overrun := testutil.CollectAndCount(canceledOverrun, "ipfs_canceled_operations_overrun_seconds")
+	if overrun != 2 {
+		t.Fatalf("expected the overrun of 2 operations recorded, got %d", overrun)
+	}
+}
@@ -0,0 +1,78 @@
+package cancelwatch
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+// fetcher watches its fetches.
+type fetcher struct {
+	exchange.Fetcher
+}
+
+func (f fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	defer watch(ctx, LayerBitswap, "get_block")()
+	return f.Fetcher.GetBlock(ctx, c)
+}
+
+func (f fetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	stop := watch(ctx, LayerBitswap, "get_blocks")
+	in, err := f.Fetcher.GetBlocks(ctx, ks)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	// the fetch runs until its channel is closed
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		defer stop()
+		for blk := range in {
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Exchange is an exchange watching its fetches.
+type Exchange struct {
+	exchange.Interface
+	fetcher
+}
+
+// NewExchange returns ex, watching its fetches, including those made through
+// its sessions.
+func NewExchange(ex exchange.Interface) exchange.Interface {
+	e := &Exchange{Interface: ex, fetcher: fetcher{ex}}
+	if sex, ok := ex.(exchange.SessionExchange); ok {
+		return &SessionExchange{Exchange: e, sex: sex}
+	}
+	return e
+}
+
+// GetBlock implements exchange.Fetcher.
+func (e *Exchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.fetcher.GetBlock(ctx, c)
+}
+
+// GetBlocks implements exchange.Fetcher.
+func (e *Exchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return e.fetcher.GetBlocks(ctx, ks)
+}
+
+// SessionExchange is an Exchange with sessions.
+type SessionExchange struct {
+	*Exchange
+	sex exchange.SessionExchange
+}
+
+// NewSession implements exchange.SessionExchange.
+func (e *SessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return fetcher{e.sex.NewSession(ctx)}
+}
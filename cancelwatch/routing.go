@@ -0,0 +1,91 @@
+package cancelwatch
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+// Routing is a routing watching its queries.
+type Routing struct {
+	routing.Routing
+}
+
+// NewRouting returns r, watching its queries.
+func NewRouting(r routing.Routing) *Routing {
+	return &Routing{r}
+}
+
+// Provide implements routing.ContentRouting.
+func (r *Routing) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	defer watch(ctx, LayerRouting, "provide")()
+	return r.Routing.Provide(ctx, c, announce)
+}
+
+// FindProvidersAsync implements routing.ContentRouting.
+func (r *Routing) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	stop := watch(ctx, LayerRouting, "find_providers")
+	in := r.Routing.FindProvidersAsync(ctx, c, count)
+	// the query runs until its channel is closed
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		defer stop()
+		for pi := range in {
+			select {
+			case out <- pi:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// FindPeer implements routing.PeerRouting.
+func (r *Routing) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, error) {
+	defer watch(ctx, LayerRouting, "find_peer")()
+	return r.Routing.FindPeer(ctx, p)
+}
+
+// PutValue implements routing.ValueStore.
+func (r *Routing) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	defer watch(ctx, LayerRouting, "put_value")()
+	return r.Routing.PutValue(ctx, key, val, opts...)
+}
+
+// GetValue implements routing.ValueStore.
+func (r *Routing) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	defer watch(ctx, LayerRouting, "get_value")()
+	return r.Routing.GetValue(ctx, key, opts...)
+}
+
+// SearchValue implements routing.ValueStore.
+func (r *Routing) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	stop := watch(ctx, LayerRouting, "search_value")
+	in, err := r.Routing.SearchValue(ctx, key, opts...)
+	if err != nil {
+		stop()
+		return nil, err
+	}
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer stop()
+		for val := range in {
+			select {
+			case out <- val:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out, nil
+}
+
+// GetPublicKey implements routing.PubKeyFetcher.
+func (r *Routing) GetPublicKey(ctx context.Context, p peer.ID) (ci.PubKey, error) {
+	defer watch(ctx, LayerRouting, "get_public_key")()
+	return routing.GetPublicKey(r.Routing, ctx, p)
+}
@@ -0,0 +1,172 @@
+// Package carprogress tracks the progress of the imports and exports of CAR
+// files: the blocks and bytes read or written so far, and the roots of the
+// DAGs at hand.
+//
+// The progress of an import or export tracked by name in a Registry can be
+// followed from another request while the CAR data is streamed in or out,
+// which a single HTTP response cannot carry along with it.
+package carprogress
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// MaxDone is the number of operations done whose trackers are kept, for
+// their final progress to be reported.
+const MaxDone = 64
+
+// Op is the kind of an operation tracked.
+type Op string
+
+const (
+	Import Op = "import"
+	Export Op = "export"
+)
+
+// Event is the progress of an import or export.
+type Event struct {
+	Op Op
+	// Blocks is the number of blocks imported or exported, and Bytes their
+	// size.
+	Blocks uint64
+	Bytes  uint64
+	// Roots are the roots of the CAR file being imported, or of the DAG
+	// being exported, and Cid the last block.
+	Roots []cid.Cid `json:",omitempty"`
+	Cid   *cid.Cid  `json:",omitempty"`
+	// Rate is the bytes per second.
+	Rate float64
+	// Elapsed is the time since the operation started, in seconds.
+	Elapsed float64
+	Done    bool   `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// Tracker tracks the progress of an import or export.
+type Tracker struct {
+	mu      sync.Mutex
+	started time.Time
+	ended   time.Time
+	ev      Event
+}
+
+// New returns a tracker of op starting now.
+func New(op Op) *Tracker {
+	return &Tracker{started: time.Now(), ev: Event{Op: op}}
+}
+
+// SetRoots sets the roots at hand.
+func (t *Tracker) SetRoots(roots []cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ev.Roots = append([]cid.Cid(nil), roots...)
+}
+
+// Block records a block of size bytes imported or exported.
+func (t *Tracker) Block(c cid.Cid, size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ev.Blocks++
+	t.ev.Bytes += uint64(size)
+	t.ev.Cid = &c
+}
+
+// Done marks the operation done, failed with err if not nil.
+func (t *Tracker) Done(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.ev.Done {
+		return
+	}
+	t.ev.Done = true
+	t.ended = time.Now()
+	if err != nil {
+		t.ev.Error = err.Error()
+	}
+}
+
+// Progress returns the progress of the operation so far.
+func (t *Tracker) Progress() Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ev := t.ev
+	end := time.Now()
+	if ev.Done {
+		end = t.ended
+	}
+	ev.Elapsed = end.Sub(t.started).Seconds()
+	if ev.Elapsed > 0 {
+		ev.Rate = float64(ev.Bytes) / ev.Elapsed
+	}
+	return ev
+}
+
+// Registry holds the trackers of the operations tracked by name.
+type Registry struct {
+	mu       sync.Mutex
+	trackers map[string]*Tracker
+	// done is the names of the operations done, oldest first
+	done []string
+}
+
+// NewRegistry returns a registry without trackers.
+func NewRegistry() *Registry {
+	return &Registry{trackers: make(map[string]*Tracker)}
+}
+
+// Track registers t under name, which an operation not done yet may not be
+// tracked under. The tracker of an operation done under name is replaced.
+func (r *Registry) Track(name string, t *Tracker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.trackers[name]; ok {
+		if !old.Progress().Done {
+			return fmt.Errorf("a CAR %s is tracked as %q already", old.ev.Op, name)
+		}
+		r.forget(name)
+	}
+	r.trackers[name] = t
+	return nil
+}
+
+// Get returns the tracker of the operation tracked under name.
+func (r *Registry) Get(name string) (*Tracker, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.trackers[name]
+	return t, ok
+}
+
+// Done marks the operation tracked under name done, failed with err if not
+// nil. Its tracker is kept until MaxDone operations are done after it.
+func (r *Registry) Done(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.trackers[name]
+	if !ok {
+		return
+	}
+	t.Done(err)
+	r.forget(name)
+	r.trackers[name] = t
+	r.done = append(r.done, name)
+	if len(r.done) > MaxDone {
+		delete(r.trackers, r.done[0])
+		r.done = r.done[1:]
+	}
+}
+
+// forget drops the tracker of name. r.mu must be held.
+func (r *Registry) forget(name string) {
+	delete(r.trackers, name)
+	for i, n := range r.done {
+		if n == name {
+			r.done = append(r.done[:i], r.done[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package carprogress
+
+import (
+	"errors"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+)
+
+func TestTracker(t *testing.T) {
+	root := blocks.NewBlock([]byte("root"))
+	leaf := blocks.NewBlock([]byte("leaf data"))
+
+	tr := New(Export)
+	tr.SetRoots([]cid.Cid{root.Cid()})
+	tr.Block(root.Cid(), len(root.RawData()))
+	tr.Block(leaf.Cid(), len(leaf.RawData()))
+
+	ev := tr.Progress()
+	if ev.Op != Export || ev.Blocks != 2 || ev.Bytes != 13 || ev.Done {
+		t.Fatalf("expected 2 blocks of 13 bytes exported, got %+v", ev)
+	}
+	if len(ev.Roots) != 1 || !ev.Roots[0].Equals(root.Cid()) || ev.Cid == nil || !ev.Cid.Equals(leaf.Cid()) {
+		t.Fatalf("expected the root and the last block, got %+v", ev)
+	}
+
+	tr.Done(errors.New("boom"))
+	tr.Done(nil)
+	ev = tr.Progress()
+	if !ev.Done || ev.Error != "boom" {
+		t.Fatalf("expected the export failed, got %+v", ev)
+	}
+	if elapsed := tr.Progress().Elapsed; elapsed != ev.Elapsed {
+		t.Fatalf("expected the elapsed time stopped once done, got %f then %f", ev.Elapsed, elapsed)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	tr := New(Import)
+	if err := r.Track("c", tr); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Track("c", New(Export)); err == nil {
+		t.Fatal("expected tracking a second operation under the same name to fail")
+	}
+	r.Done("c", nil)
+	if got, ok := r.Get("c"); !ok || got != tr || !got.Progress().Done {
+		t.Fatal("expected the import done kept")
+	}
+	if err := r.Track("c", New(Export)); err != nil {
+		t.Fatalf("expected the import done replaced, got %s", err)
+	}
+
+	for i := 0; i < MaxDone+1; i++ {
+		name := string(rune('A' + i))
+		r.Track(name, New(Import))
+		r.Done(name, nil)
+	}
+	if _, ok := r.Get("A"); ok {
+		t.Fatal("expected the oldest operation done forgotten")
+	}
+	if _, ok := r.Get("c"); !ok {
+		t.Fatal("expected the operation not done kept")
+	}
+}
@@ -0,0 +1,273 @@
+// Package cdnpurge asks the HTTP caches in front of the gateway, such as
+// CDNs, to purge the content paths whose content changed, so that they serve
+// the new content rather than the one they cached.
+//
+// The content paths purged are the IPNS names published by the node with a
+// new value, and the paths of the sites published from the MFS whose entries
+// changed, along with the directories listing them. The purge requests are
+// made in the background: a failure is logged, the cache serving the stale
+// content until it expires.
+package cdnpurge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/go-ipfs/mfswatch"
+)
+
+var log = logging.Logger("cdnpurge")
+
+// MaxPending is the largest number of content paths waiting to be purged.
+// The paths beyond are dropped.
+const MaxPending = 10000
+
+// Settings configures the purge requests.
+type Settings struct {
+	// URLs are the templates of the URLs requested to purge a content path,
+	// where {path} is replaced by the content path, {name} by its CID or IPNS
+	// name, and {subpath} by the rest of it. The values are escaped as path
+	// segments before the "?" of the template, and as query values after.
+	URLs []string
+	// Method is the HTTP method of the purge requests.
+	Method string
+	// Header is sent with the purge requests.
+	Header http.Header
+	// Timeout is the timeout of a purge request.
+	Timeout time.Duration
+	// Sites are the content paths the MFS directories are published at, by
+	// MFS directory.
+	Sites map[string]string
+}
+
+// site is an MFS directory published at a content path.
+type site struct {
+	dir  string
+	path string
+}
+
+// Purger sends the purge requests of the content paths, one path after the
+// other, until Close is called.
+type Purger struct {
+	urls   []string
+	method string
+	header http.Header
+	client *http.Client
+	sites  []site
+
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]struct{}
+
+	wake   chan struct{}
+	cancel context.CancelFunc
+	closed chan struct{}
+}
+
+// New returns the purger of s.
+func New(s Settings) (*Purger, error) {
+	if s.Method == "" || strings.ContainsAny(s.Method, " \t\r\n") {
+		return nil, fmt.Errorf("invalid purge method %q", s.Method)
+	}
+	if s.Timeout <= 0 {
+		return nil, fmt.Errorf("purge timeout must be positive: %s", s.Timeout)
+	}
+	for _, t := range s.URLs {
+		u, err := url.Parse(expand(t, "/ipfs/bafkqaaa"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid purge URL %q: %w", t, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid purge URL %q: not an HTTP URL", t)
+		}
+	}
+
+	p := &Purger{
+		urls:   s.URLs,
+		method: s.Method,
+		header: s.Header,
+		client: &http.Client{Timeout: s.Timeout},
+		queued: make(map[string]struct{}),
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	for dir, cp := range s.Sites {
+		if !strings.HasPrefix(dir, "/") {
+			return nil, fmt.Errorf("site %s is not an absolute MFS path", dir)
+		}
+		cp = gopath.Clean(cp)
+		if !strings.HasPrefix(cp, "/ipfs/") && !strings.HasPrefix(cp, "/ipns/") {
+			return nil, fmt.Errorf("site %s is published at %s, which is not a content path", dir, cp)
+		}
+		p.sites = append(p.sites, site{dir: gopath.Clean(dir), path: cp})
+	}
+
+	var ctx context.Context
+	ctx, p.cancel = context.WithCancel(context.Background())
+	go p.run(ctx)
+	return p, nil
+}
+
+// Close stops the purge requests, dropping the paths not purged yet.
+func (p *Purger) Close() error {
+	p.cancel()
+	<-p.closed
+	return nil
+}
+
+// Purge queues the purge of the content path cp, unless it is already queued.
+func (p *Purger) Purge(cp string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.queued[cp]; ok {
+		return
+	}
+	if len(p.pending) >= MaxPending {
+		log.Warnf("too many paths to purge, dropped %s", cp)
+		return
+	}
+	p.queued[cp] = struct{}{}
+	p.pending = append(p.pending, cp)
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// WatchSites purges the content paths of the entries of the sites changed in
+// the MFS watched by w, until ctx is done.
+func (p *Purger) WatchSites(ctx context.Context, w *mfswatch.Watcher) error {
+	for _, s := range p.sites {
+		events, err := w.Watch(ctx, s.dir)
+		if err != nil {
+			return err
+		}
+		go func(s site) {
+			for e := range events {
+				for _, cp := range s.changed(e.Path) {
+					p.Purge(cp)
+				}
+			}
+		}(s)
+	}
+	return nil
+}
+
+// changed returns the content paths to purge for the change of the MFS path
+// mp: its own, and the one of the directory listing it.
+func (s site) changed(mp string) []string {
+	rel := strings.TrimPrefix(mp, strings.TrimSuffix(s.dir, "/"))
+	if rel == "" || rel == "/" {
+		return []string{s.path}
+	}
+	paths := []string{s.path + rel}
+	if dir := gopath.Dir(rel); dir == "/" {
+		paths = append(paths, s.path+"/")
+	} else {
+		paths = append(paths, s.path+dir+"/")
+	}
+	return paths
+}
+
+func (p *Purger) run(ctx context.Context) {
+	defer close(p.closed)
+	for {
+		cp, ok := p.next()
+		if !ok {
+			select {
+			case <-p.wake:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		for _, t := range p.urls {
+			if err := p.send(ctx, expand(t, cp)); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				log.Errorf("cannot purge %s: %s", cp, err)
+			}
+		}
+	}
+}
+
+// next returns the next content path to purge, if any.
+func (p *Purger) next() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.pending) == 0 {
+		return "", false
+	}
+	cp := p.pending[0]
+	p.pending = p.pending[1:]
+	delete(p.queued, cp)
+	return cp, true
+}
+
+// send requests the purge URL u.
+func (p *Purger) send(ctx context.Context, u string) error {
+	req, err := http.NewRequestWithContext(ctx, p.method, u, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range p.header {
+		req.Header[k] = v
+	}
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", p.method, req.URL.Redacted(), res.Status)
+	}
+	log.Debugf("purged %s", req.URL.Redacted())
+	return nil
+}
+
+// expand returns the URL of the template t purging the content path cp.
+func expand(t, cp string) string {
+	segments := strings.SplitN(strings.TrimPrefix(cp, "/"), "/", 3)
+	var name, subpath string
+	if len(segments) > 1 {
+		name = segments[1]
+	}
+	if len(segments) > 2 {
+		subpath = "/" + segments[2]
+	}
+
+	replacer := func(escape func(string) string) *strings.Replacer {
+		return strings.NewReplacer("{path}", escape(cp), "{name}", escape(name), "{subpath}", escape(subpath))
+	}
+	base := t
+	i := strings.Index(t, "?")
+	if i >= 0 {
+		base = t[:i]
+	}
+	u := replacer(escapePath).Replace(base)
+	if i >= 0 {
+		u += "?" + replacer(url.QueryEscape).Replace(t[i+1:])
+	}
+	return u
+}
+
+// escapePath escapes the segments of the path p.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,219 @@
+package cdnpurge
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	gopath "path"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	offroute "github.com/ipfs/go-ipfs-routing/offline"
+	"github.com/ipfs/go-ipns"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-mfs"
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	ft "github.com/ipfs/go-unixfs"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	record "github.com/libp2p/go-libp2p-record"
+
+	"github.com/ipfs/go-ipfs/mfswatch"
+)
+
+// purgeServer returns a purger of the paths sent to the purged channel.
+func purgeServer(t *testing.T, sites map[string]string) (*Purger, <-chan string) {
+	purged := make(chan string, 100)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PURGE" || r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "refused", http.StatusForbidden)
+			return
+		}
+		purged <- r.URL.Query().Get("url")
+	}))
+	t.Cleanup(ts.Close)
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer key")
+	p, err := New(Settings{
+		URLs:    []string{ts.URL + "/purge?url=https://gw.example.org{path}"},
+		Method:  "PURGE",
+		Header:  header,
+		Timeout: 10 * time.Second,
+		Sites:   sites,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p, purged
+}
+
+func next(t *testing.T, purged <-chan string) string {
+	select {
+	case u := <-purged:
+		return u
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for a purge")
+		return ""
+	}
+}
+
+func expectPurged(t *testing.T, purged <-chan string, urls ...string) {
+	got := make(map[string]bool)
+	for range urls {
+		got[next(t, purged)] = true
+	}
+	for _, u := range urls {
+		if !got[u] {
+			t.Fatalf("expected %s purged, got %v", u, got)
+		}
+	}
+	select {
+	case u := <-purged:
+		t.Fatalf("unexpected purge of %s", u)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestExpand(t *testing.T) {
+	for _, c := range []struct{ template, path, url string }{
+		{"https://cdn.example.net{path}", "/ipns/example.org/a b/c", "https://cdn.example.net/ipns/example.org/a%20b/c"},
+		{"https://{name}.ipns.example.net{subpath}", "/ipns/k51/a", "https://k51.ipns.example.net/a"},
+		{"https://{name}.ipfs.example.net{subpath}", "/ipfs/bafkqaaa", "https://bafkqaaa.ipfs.example.net"},
+		{"https://cdn.example.net/purge?url=https://gw{path}&n={name}", "/ipns/a/b&c", "https://cdn.example.net/purge?url=https://gw%2Fipns%2Fa%2Fb%26c&n=a"},
+	} {
+		if u := expand(c.template, c.path); u != c.url {
+			t.Errorf("%s with %s: expected %s, got %s", c.template, c.path, c.url, u)
+		}
+	}
+
+	for _, s := range []Settings{
+		{URLs: []string{"ftp://example.net{path}"}, Method: "PURGE", Timeout: time.Second},
+		{Method: "", Timeout: time.Second},
+		{Method: "PURGE"},
+		{Method: "PURGE", Timeout: time.Second, Sites: map[string]string{"/blog": "example.org"}},
+	} {
+		if _, err := New(s); err == nil {
+			t.Errorf("expected %+v to fail", s)
+		}
+	}
+}
+
+func TestPurgeSites(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, purged := purgeServer(t, map[string]string{"/sites/blog": "/ipns/blog.example.org"})
+
+	dserv := mdtest.Mock()
+	w := mfswatch.New(dserv)
+	nd := ft.EmptyDirNode()
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	w.Publish(nd.Cid())
+	root, err := mfs.NewRoot(ctx, dserv, nd, func(_ context.Context, c cid.Cid) error {
+		w.Publish(c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WatchSites(ctx, w); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func(mp, data string) {
+		f := dag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+		if err := dserv.Add(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+		if err := mfs.Mkdir(root, "/sites/blog/posts", mfs.MkdirOpts{Mkparents: true}); err != nil && err != mfs.ErrDirExists {
+			t.Fatal(err)
+		}
+		if dir, err := mfs.Lookup(root, gopath.Dir(mp)); err == nil {
+			dir.(*mfs.Directory).Unlink(gopath.Base(mp))
+		}
+		if err := mfs.PutNode(root, mp, f); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := mfs.FlushPath(ctx, root, "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	put("/sites/blog/posts/a.html", "a")
+	expectPurged(t, purged, "https://gw.example.org/ipns/blog.example.org")
+
+	put("/sites/blog/posts/a.html", "a2")
+	expectPurged(t, purged,
+		"https://gw.example.org/ipns/blog.example.org/posts/a.html",
+		"https://gw.example.org/ipns/blog.example.org/posts/")
+
+	put("/sites/blog/index.html", "i")
+	expectPurged(t, purged,
+		"https://gw.example.org/ipns/blog.example.org/index.html",
+		"https://gw.example.org/ipns/blog.example.org/")
+
+	// the changes out of the sites are not purged
+	put("/other.html", "o")
+	expectPurged(t, purged)
+}
+
+func TestPurgeNames(t *testing.T) {
+	ctx := context.Background()
+	p, purged := purgeServer(t, nil)
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, _, err := ic.GenerateKeyPair(ic.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.AddPrivKey(id, priv); err != nil {
+		t.Fatal(err)
+	}
+	rt := offroute.NewOfflineRouter(d, record.NamespacedValidator{
+		"ipns": ipns.Validator{KeyBook: ps},
+		"pk":   record.PublicKeyValidator{},
+	})
+	inner, err := namesys.NewNameSystem(rt, namesys.WithDatastore(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := p.NameSystem(inner, d)
+
+	name := "https://gw.example.org/ipns/" + coreiface.FormatKeyID(id)
+	a := path.FromString("/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+	b := path.FromString("/ipfs/bafkqaaa")
+
+	if err := ns.Publish(ctx, priv, a); err != nil {
+		t.Fatal(err)
+	}
+	expectPurged(t, purged, name)
+
+	// republished with the same value
+	if err := ns.PublishWithEOL(ctx, priv, a, time.Now().Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectPurged(t, purged)
+
+	if err := ns.PublishWithEOL(ctx, priv, b, time.Now().Add(48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	expectPurged(t, purged, name)
+}
@@ -0,0 +1,63 @@
+package cdnpurge
+
+import (
+	"context"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// nameSystem purges the IPNS names published with a new value, the names
+// republished with the same value being left cached.
+type nameSystem struct {
+	namesys.NameSystem
+	p *Purger
+	// published reads the records last published by the node
+	published *namesys.IpnsPublisher
+}
+
+// NameSystem returns ns, purging the IPNS names it publishes with a new
+// value. d is the datastore ns keeps the records it publishes in.
+func (p *Purger) NameSystem(ns namesys.NameSystem, d ds.Datastore) namesys.NameSystem {
+	return &nameSystem{
+		NameSystem: ns,
+		p:          p,
+		published:  namesys.NewIpnsPublisher(nil, d),
+	}
+}
+
+func (ns *nameSystem) Publish(ctx context.Context, name ic.PrivKey, value path.Path) error {
+	return ns.publish(ctx, name, value, func() error {
+		return ns.NameSystem.Publish(ctx, name, value)
+	})
+}
+
+func (ns *nameSystem) PublishWithEOL(ctx context.Context, name ic.PrivKey, value path.Path, eol time.Time) error {
+	return ns.publish(ctx, name, value, func() error {
+		return ns.NameSystem.PublishWithEOL(ctx, name, value, eol)
+	})
+}
+
+func (ns *nameSystem) publish(ctx context.Context, name ic.PrivKey, value path.Path, publish func() error) error {
+	id, err := peer.IDFromPrivateKey(name)
+	if err != nil {
+		return err
+	}
+	changed := true
+	if rec, err := ns.published.GetPublished(ctx, id, false); err == nil && rec != nil {
+		changed = string(rec.GetValue()) != value.String()
+	}
+
+	if err := publish(); err != nil {
+		return err
+	}
+	if changed {
+		ns.p.Purge("/ipns/" + coreiface.FormatKeyID(id))
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ import (
 	multierror "github.com/hashicorp/go-multierror"
 
 	version "github.com/ipfs/go-ipfs"
+	"github.com/ipfs/go-ipfs/apisocket"
 	utilmain "github.com/ipfs/go-ipfs/cmd/ipfs/util"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	config "github.com/ipfs/go-ipfs/config"
@@ -28,6 +29,8 @@ import (
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
 	libp2p "github.com/ipfs/go-ipfs/core/node/libp2p"
 	nodeMount "github.com/ipfs/go-ipfs/fuse/node"
+	keylock "github.com/ipfs/go-ipfs/keylock"
+	repo "github.com/ipfs/go-ipfs/repo"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations/ipfsfetcher"
@@ -37,10 +40,12 @@ import (
 	mprome "github.com/ipfs/go-metrics-prometheus"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	goprocess "github.com/jbenet/goprocess"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 	prometheus "github.com/prometheus/client_golang/prometheus"
 	promauto "github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/term"
 )
 
 const (
@@ -49,11 +54,14 @@ const (
 	initOptionKwd             = "init"
 	initConfigOptionKwd       = "init-config"
 	initProfileOptionKwd      = "init-profile"
+	initSeedOptionKwd         = "init-seed"
 	ipfsMountKwd              = "mount-ipfs"
 	ipnsMountKwd              = "mount-ipns"
 	migrateKwd                = "migrate"
 	mountKwd                  = "mount"
 	offlineKwd                = "offline" // global option
+	readOnlyKwd               = "read-only"
+	repoReadOnlyKwd           = "repo-readonly"
 	routingOptionKwd          = "routing"
 	routingOptionSupernodeKwd = "supernode"
 	routingOptionDHTClientKwd = "dhtclient"
@@ -68,10 +76,19 @@ const (
 	enableIPNSPubSubKwd       = "enable-namesys-pubsub"
 	enableMultiplexKwd        = "enable-mplex-experiment"
 	agentVersionSuffix        = "agent-version-suffix"
+	bootstrapGroupKwd         = "bootstrap-group"
 	// apiAddrKwd    = "address-api"
 	// swarmAddrKwd  = "address-swarm"
 )
 
+// dhtRoutingModes are the modes of the DHT routing options, overridden per
+// DHT by Routing.WANMode and Routing.LANMode.
+var dhtRoutingModes = map[string]dht.ModeOpt{
+	routingOptionDHTClientKwd: dht.ModeClient,
+	routingOptionDHTKwd:       dht.ModeAuto,
+	routingOptionDHTServerKwd: dht.ModeServer,
+}
+
 var daemonCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Run a network-connected IPFS node.",
@@ -141,6 +158,32 @@ environment variable:
 
   export IPFS_PATH=/path/to/ipfsrepo
 
+Read-only mirrors
+
+Nodes of a fleet of caches or gateway mirrors can be started with
+
+  ipfs daemon --read-only
+
+to guarantee that their content cannot be changed remotely. The API then
+declines the commands adding, removing or pinning content, writing to or
+repairing MFS, mounting, publishing records, or compressing or migrating the
+blocks, and the gateway cannot be writable. The pin
+follower, MFS replication, pin expiry and IPNS republisher are disabled, as
+well as the DNSLink publisher. Content is still fetched, cached and
+provided, and garbage collected with --enable-gc.
+
+With --repo-readonly, the repo itself is opened read-only, for instance from
+a snapshot of the storage of another node, shared by several replicas:
+
+  ipfs daemon --repo-readonly
+
+Its datastores refuse every write, as do its config and keystore, and it is
+not locked, so that other daemons and tools can open it read-only at the same
+time. It implies --read-only, and cannot be garbage collected or migrated.
+The content fetched from the network cannot be stored, and the address of the
+API is not written to the repo: the clients are given it, as in
+'ipfs --api=/ip4/127.0.0.1/tcp/5001 cat <path>'.
+
 Routing
 
 IPFS by default will use a DHT for content routing. There is a highly
@@ -168,9 +211,12 @@ Headers.
 		cmds.BoolOption(initOptionKwd, "Initialize ipfs with default settings if not already initialized"),
 		cmds.StringOption(initConfigOptionKwd, "Path to existing configuration file to be loaded during --init"),
 		cmds.StringOption(initProfileOptionKwd, "Configuration profiles to apply for --init. See ipfs init --help for more"),
+		cmds.StringOption(initSeedOptionKwd, "Seed manifest of the settings and content of the repo for --init. See ipfs init --help for more"),
 		cmds.StringOption(routingOptionKwd, "Overrides the routing option").WithDefault(routingOptionDefaultKwd),
 		cmds.BoolOption(mountKwd, "Mounts IPFS to the filesystem"),
 		cmds.BoolOption(writableKwd, "Enable writing objects (with POST, PUT and DELETE)"),
+		cmds.BoolOption(readOnlyKwd, "Disable the subsystems and commands changing the content of the node, for mirrors"),
+		cmds.BoolOption(repoReadOnlyKwd, "Open the repo read-only, without writing to it or locking it. Implies --read-only"),
 		cmds.StringOption(ipfsMountKwd, "Path to the mountpoint for IPFS (if using --mount). Defaults to config setting."),
 		cmds.StringOption(ipnsMountKwd, "Path to the mountpoint for IPNS (if using --mount). Defaults to config setting."),
 		cmds.BoolOption(unrestrictedApiAccessKwd, "Allow API access to unlisted hashes"),
@@ -182,6 +228,7 @@ Headers.
 		cmds.BoolOption(enableIPNSPubSubKwd, "Enable IPNS over pubsub. Implicitly enables pubsub, overrides Ipns.UsePubsub config."),
 		cmds.BoolOption(enableMultiplexKwd, "DEPRECATED"),
 		cmds.StringOption(agentVersionSuffix, "Optional suffix to the AgentVersion presented by `ipfs id` and also advertised through BitSwap."),
+		cmds.StringOption(bootstrapGroupKwd, "Bootstrap from the peers of this group of BootstrapGroups instead of Bootstrap."),
 
 		// TODO: add way to override addresses. tricky part: updating the config if also --init.
 		// cmds.StringOption(apiAddrKwd, "Address for the daemon rpc API (overrides config)"),
@@ -211,6 +258,9 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		log.Errorf("Injecting prometheus handler for metrics failed with message: %s\n", err.Error())
 	}
 
+	// record the logs from the start for 'ipfs log tail --since'
+	commands.StartLogHistory()
+
 	// let the user know we're going.
 	fmt.Printf("Initializing daemon...\n")
 
@@ -245,9 +295,23 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	// first, whether user has provided the initialization flag. we may be
 	// running in an uninitialized state.
 	initialize, _ := req.Options[initOptionKwd].(bool)
+	repoReadOnly, _ := req.Options[repoReadOnlyKwd].(bool)
+	if repoReadOnly {
+		for _, opt := range []string{initOptionKwd, enableGCKwd} {
+			if set, _ := req.Options[opt].(bool); set {
+				return cmds.Errorf(cmds.ErrClient, "--%s and --%s are mutually exclusive", opt, repoReadOnlyKwd)
+			}
+		}
+	}
 	if initialize && !fsrepo.IsInitialized(cctx.ConfigRoot) {
 		cfgLocation, _ := req.Options[initConfigOptionKwd].(string)
 		profiles, _ := req.Options[initProfileOptionKwd].(string)
+		var seed *seedManifest
+		if file, ok := req.Options[initSeedOptionKwd].(string); ok {
+			if seed, err = loadSeedManifest(file); err != nil {
+				return err
+			}
+		}
 		var conf *config.Config
 
 		if cfgLocation != "" {
@@ -269,7 +333,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 			}
 		}
 
-		if err = doInit(os.Stdout, cctx.ConfigRoot, false, profiles, conf); err != nil {
+		if err = doInit(os.Stdout, cctx.ConfigRoot, false, profiles, conf, seed); err != nil {
 			return err
 		}
 	}
@@ -279,11 +343,18 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 
 	// acquire the repo lock _before_ constructing a node. we need to make
 	// sure we are permitted to access the resources (datastore, etc.)
-	repo, err := fsrepo.Open(cctx.ConfigRoot)
+	openRepo := fsrepo.Open
+	if repoReadOnly {
+		openRepo = fsrepo.OpenReadOnly
+	}
+	repo, err := openRepo(cctx.ConfigRoot)
 	switch err {
 	default:
 		return err
 	case fsrepo.ErrNeedMigration:
+		if repoReadOnly {
+			return fmt.Errorf("fs-repo requires migration, which cannot run with --%s", repoReadOnlyKwd)
+		}
 		domigrate, found := req.Options[migrateKwd].(bool)
 		fmt.Println("Found outdated fs-repo, migrations need to be run.")
 
@@ -365,6 +436,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	defer repo.Close()
 
 	offline, _ := req.Options[offlineKwd].(bool)
+	readOnly := isReadOnly(req)
 	ipnsps, ipnsPsSet := req.Options[enableIPNSPubSubKwd].(bool)
 	pubsub, psSet := req.Options[enablePubSubKwd].(bool)
 
@@ -378,6 +450,16 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		return err
 	}
 
+	stopTracing, err := startTracing(req.Context, daemonConfigPollInterval, repo)
+	if err != nil {
+		return err
+	}
+	defer stopTracing()
+
+	if err := unlockKeystore(repo); err != nil {
+		return err
+	}
+
 	if !psSet {
 		pubsub = cfg.Pubsub.Enabled.WithDefault(false)
 	}
@@ -391,6 +473,7 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		Permanent:                   true, // It is temporary way to signify that node is permanent
 		Online:                      !offline,
 		DisableEncryptedConnections: unencrypted,
+		ReadOnly:                    readOnly,
 		ExtraOpts: map[string]bool{
 			"pubsub": pubsub,
 			"ipnsps": ipnsps,
@@ -398,12 +481,21 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 		//TODO(Kubuxu): refactor Online vs Offline by adding Permanent vs Ephemeral
 	}
 
+	ncfg.BootstrapGroup, _ = req.Options[bootstrapGroupKwd].(string)
+	if _, err := cfg.BootstrapGroupPeers(ncfg.BootstrapGroup); err != nil {
+		return err
+	}
+
 	routingOption, _ := req.Options[routingOptionKwd].(string)
 	if routingOption == routingOptionDefaultKwd {
 		routingOption = cfg.Routing.Type
 		if routingOption == "" {
 			routingOption = routingOptionDHTKwd
 		}
+		// the low-power mode does not serve the DHT
+		if routingOption == routingOptionDHTKwd && cfg.LowPower.Enabled.WithDefault(false) {
+			routingOption = routingOptionDHTClientKwd
+		}
 	}
 	switch routingOption {
 	case routingOptionSupernodeKwd:
@@ -419,6 +511,13 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	default:
 		return fmt.Errorf("unrecognized routing option: %s", routingOption)
 	}
+	if mode, ok := dhtRoutingModes[routingOption]; ok && (cfg.Routing.WANMode != nil || cfg.Routing.LANMode != nil) {
+		wanMode, lanMode, err := libp2p.DHTModes(cfg.Routing, mode)
+		if err != nil {
+			return err
+		}
+		ncfg.Routing = libp2p.DualDHTOption(wanMode, lanMode)
+	}
 
 	agentVersionSuffixString, _ := req.Options[agentVersionSuffix].(string)
 	if agentVersionSuffixString != "" {
@@ -473,6 +572,9 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 	if mount && offline {
 		return cmds.Errorf(cmds.ErrClient, "mount is not currently supported in offline mode")
 	}
+	if mount && readOnly {
+		return cmds.Errorf(cmds.ErrClient, "mount is not supported in read-only mode")
+	}
 	if mount {
 		if err := mountFuse(req, cctx); err != nil {
 			return err
@@ -548,7 +650,8 @@ func daemonFunc(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment
 			if err != nil {
 				log.Errorf("failed to access config: %s", err)
 			}
-			if len(cfg.Bootstrap) == 0 && len(cfg.Peering.Peers) == 0 {
+			bootstrapPeers, _ := cfg.BootstrapGroupPeers(node.BootstrapGroup.Name())
+			if len(bootstrapPeers) == 0 && len(cfg.Peering.Peers) == 0 {
 				// Skip peer check if Bootstrap and Peering lists are empty
 				// (means user disabled them on purpose)
 				log.Warn("skipping bootstrap: empty Bootstrap and Peering lists")
@@ -611,6 +714,17 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		listenerAddrs[string(listener.Multiaddr().Bytes())] = true
 	}
 
+	socketSettings := apisocket.Settings{
+		Mode:  apisocket.DefaultMode,
+		Group: cfg.API.SocketGroup.WithDefault(""),
+	}
+	if mode := cfg.API.SocketMode.WithDefault(""); mode != "" {
+		socketSettings.Mode, err = apisocket.ParseMode(mode)
+		if err != nil {
+			return nil, fmt.Errorf("serveHTTPApi: API.SocketMode: %s", err)
+		}
+	}
+
 	for _, addr := range apiAddrs {
 		apiMaddr, err := ma.NewMultiaddr(addr)
 		if err != nil {
@@ -620,7 +734,7 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 			continue
 		}
 
-		apiLis, err := manet.Listen(apiMaddr)
+		apiLis, err := apisocket.Listen(apiMaddr, socketSettings)
 		if err != nil {
 			return nil, fmt.Errorf("serveHTTPApi: manet.Listen(%s) failed: %s", apiMaddr, err)
 		}
@@ -662,6 +776,7 @@ func serveHTTPApi(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, error
 		defaultMux("/debug/stack"),
 		corehttp.MutexFractionOption("/debug/pprof-mutex/"),
 		corehttp.BlockProfileRateOption("/debug/pprof-block/"),
+		corehttp.ProfileHistoryOption("/debug/profiles/"),
 		corehttp.MetricsScrapingOption("/debug/metrics/prometheus"),
 		corehttp.LogOption(),
 	}
@@ -739,6 +854,13 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 	if !writableOptionFound {
 		writable = cfg.Gateway.Writable
 	}
+	if isReadOnly(req) {
+		if writable && writableOptionFound {
+			return nil, cmds.Errorf(cmds.ErrClient, "--%s and --%s are mutually exclusive", writableKwd, readOnlyKwd)
+		}
+		// Gateway.Writable is ignored by read-only mirrors
+		writable = false
+	}
 
 	listeners, err := sockets.TakeListeners("io.ipfs.gateway")
 	if err != nil {
@@ -786,6 +908,7 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		corehttp.MetricsCollectionOption("gateway"),
 		corehttp.HostnameOption(),
 		corehttp.GatewayOption(writable, "/ipfs", "/ipns"),
+		corehttp.HealthProbeOption(),
 		corehttp.VersionOption(),
 		corehttp.CheckVersionOption(),
 		corehttp.CommandsROOption(cmdctx),
@@ -795,6 +918,10 @@ func serveHTTPGateway(req *cmds.Request, cctx *oldcmds.Context) (<-chan error, e
 		opts = append(opts, corehttp.P2PProxyOption())
 	}
 
+	if cfg.Experimental.GraphQL {
+		opts = append(opts, corehttp.GraphQLOption("/graphql"))
+	}
+
 	if len(cfg.Gateway.RootRedirect) > 0 {
 		opts = append(opts, corehttp.RedirectOption("", cfg.Gateway.RootRedirect))
 	}
@@ -857,6 +984,14 @@ func mountFuse(req *cmds.Request, cctx *oldcmds.Context) error {
 	return nil
 }
 
+// isReadOnly reports whether the daemon is read-only, as with a read-only
+// repo.
+func isReadOnly(req *cmds.Request) bool {
+	readOnly, _ := req.Options[readOnlyKwd].(bool)
+	repoReadOnly, _ := req.Options[repoReadOnlyKwd].(bool)
+	return readOnly || repoReadOnly
+}
+
 func maybeRunGC(req *cmds.Request, node *core.IpfsNode) (<-chan error, error) {
 	enableGC, _ := req.Options[enableGCKwd].(bool)
 	if !enableGC {
@@ -930,3 +1065,35 @@ func printVersion() {
 	fmt.Printf("System version: %s\n", runtime.GOARCH+"/"+runtime.GOOS)
 	fmt.Printf("Golang version: %s\n", runtime.Version())
 }
+
+// unlockKeystore prompts for the passphrase of the encrypted keystore of r on
+// the terminal, when it was not given by the environment. Without a terminal,
+// the daemon starts with the keystore locked, to be unlocked with 'ipfs key
+// unlock'.
+func unlockKeystore(r repo.Repo) error {
+	ks, ok := keylock.Of(r.Keystore())
+	if !ok || !ks.Locked() {
+		return nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		fmt.Printf("The keystore is locked: its keys are not used until it is unlocked with 'ipfs key unlock'.\n")
+		return nil
+	}
+	for {
+		fmt.Fprint(os.Stderr, "Enter the passphrase of the keystore: ")
+		pass, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return err
+		}
+		switch err := ks.Unlock(pass); err {
+		case nil:
+			return nil
+		case keylock.ErrWrongPassphrase:
+			fmt.Fprintln(os.Stderr, "Wrong passphrase.")
+		default:
+			return err
+		}
+	}
+}
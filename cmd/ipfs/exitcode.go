@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli"
+	"github.com/ipfs/go-ipfs/apierr"
+)
+
+// errExitCode returns the code to exit with on err, returned by cli.Run: the
+// status set by the command, or the code of the kind of err.
+func errExitCode(err error) int {
+	var exitErr cli.ExitError
+	if errors.As(err, &exitErr) {
+		return int(exitErr)
+	}
+	return apierr.ExitCode(apierr.KindOf(err))
+}
+
+// makeExitCodeExecutor returns the executor of makeExecutor, the commands
+// failing with an error of a known kind exiting with its code.
+func makeExitCodeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
+	exe, err := makeExecutor(req, env)
+	if err != nil {
+		return nil, err
+	}
+	return exitCodeExecutor{exe}, nil
+}
+
+type exitCodeExecutor struct {
+	cmds.Executor
+}
+
+func (x exitCodeExecutor) Execute(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+	if cre, ok := re.(cli.ResponseEmitter); ok {
+		re = &exitCodeEmitter{ResponseEmitter: cre}
+	}
+	return x.Executor.Execute(req, re, env)
+}
+
+// exitCodeEmitter sets the exit status of the errors of a known kind, the
+// other errors exiting with 1.
+type exitCodeEmitter struct {
+	cli.ResponseEmitter
+}
+
+func (re *exitCodeEmitter) CloseWithError(err error) error {
+	if kind := apierr.KindOf(err); kind != apierr.Unknown {
+		re.SetStatus(apierr.ExitCode(kind))
+	}
+	return re.ResponseEmitter.CloseWithError(err)
+}
+
+// Type is that of the CLI emitter, for the commands to format their output
+// for it.
+func (re *exitCodeEmitter) Type() cmds.PostRunType {
+	return cmds.CLI
+}
@@ -30,6 +30,7 @@ const (
 	bitsOptionName      = "bits"
 	emptyRepoOptionName = "empty-repo"
 	profileOptionName   = "profile"
+	seedOptionName      = "seed"
 )
 
 var errRepoExists = errors.New(`ipfs configuration file already exists!
@@ -52,6 +53,25 @@ located at ~/.ipfs. To change the repo location, set the $IPFS_PATH
 environment variable:
 
     export IPFS_PATH=/path/to/ipfsrepo
+
+The nodes of a fleet or a classroom can be initialized the same way, with the
+settings and content of a seed manifest:
+
+    ipfs init --seed=seed.json
+
+The manifest is a JSON file listing the config profiles to apply, after the
+ones of --profile, the config values to set by key, as with
+'ipfs config --json', the CAR files to import, relative to the manifest, and
+the paths to pin recursively, with their names and labels:
+
+    {
+      "Profiles": ["server"],
+      "Config": {"Datastore.StorageMax": "50GB"},
+      "Cars": ["course.car"],
+      "Pins": [{"Path": "/ipfs/bafy...", "Name": "course"}]
+    }
+
+The roots of the CAR files are pinned when no pins are listed.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -62,6 +82,7 @@ environment variable:
 		cmds.IntOption(bitsOptionName, "b", "Number of bits to use in the generated RSA private key."),
 		cmds.BoolOption(emptyRepoOptionName, "e", "Don't add and pin help files to the local storage."),
 		cmds.StringOption(profileOptionName, "p", "Apply profile settings to config. Multiple profiles can be separated by ','"),
+		cmds.StringOption(seedOptionName, "Seed the repo with the settings and content of this manifest."),
 
 		// TODO need to decide whether to expose the override as a file or a
 		// directory. That is: should we allow the user to also specify the
@@ -77,6 +98,14 @@ environment variable:
 		algorithm, _ := req.Options[algorithmOptionName].(string)
 		nBitsForKeypair, nBitsGiven := req.Options[bitsOptionName].(int)
 
+		var seed *seedManifest
+		if file, ok := req.Options[seedOptionName].(string); ok {
+			var err error
+			if seed, err = loadSeedManifest(file); err != nil {
+				return err
+			}
+		}
+
 		var conf *config.Config
 
 		f := req.Files
@@ -122,7 +151,7 @@ environment variable:
 		}
 
 		profiles, _ := req.Options[profileOptionName].(string)
-		return doInit(os.Stdout, cctx.ConfigRoot, empty, profiles, conf)
+		return doInit(os.Stdout, cctx.ConfigRoot, empty, profiles, conf, seed)
 	},
 }
 
@@ -144,7 +173,7 @@ func applyProfiles(conf *config.Config, profiles string) error {
 	return nil
 }
 
-func doInit(out io.Writer, repoRoot string, empty bool, confProfiles string, conf *config.Config) error {
+func doInit(out io.Writer, repoRoot string, empty bool, confProfiles string, conf *config.Config, seed *seedManifest) error {
 	if _, err := fmt.Fprintf(out, "initializing IPFS node at %s\n", repoRoot); err != nil {
 		return err
 	}
@@ -157,7 +186,7 @@ func doInit(out io.Writer, repoRoot string, empty bool, confProfiles string, con
 		return errRepoExists
 	}
 
-	if err := applyProfiles(conf, confProfiles); err != nil {
+	if err := applyProfiles(conf, seed.profiles(confProfiles)); err != nil {
 		return err
 	}
 
@@ -165,6 +194,12 @@ func doInit(out io.Writer, repoRoot string, empty bool, confProfiles string, con
 		return err
 	}
 
+	if seed != nil {
+		if err := seedRepo(out, repoRoot, seed); err != nil {
+			return err
+		}
+	}
+
 	if !empty {
 		if err := addDefaultAssets(out, repoRoot); err != nil {
 			return err
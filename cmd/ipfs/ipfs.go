@@ -23,6 +23,7 @@ var localCommands = map[string]*cmds.Command{
 	"daemon":   daemonCmd,
 	"init":     initCmd,
 	"commands": commandsClientCmd,
+	"session":  sessionCmd,
 }
 
 func init() {
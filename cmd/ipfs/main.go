@@ -12,6 +12,7 @@ import (
 	"runtime/pprof"
 	"time"
 
+	"github.com/ipfs/go-ipfs/apisocket"
 	util "github.com/ipfs/go-ipfs/cmd/ipfs/util"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	core "github.com/ipfs/go-ipfs/core"
@@ -174,9 +175,9 @@ func mainRet() (exitCode int) {
 		}, nil
 	}
 
-	err = cli.Run(ctx, Root, os.Args, os.Stdin, os.Stdout, os.Stderr, buildEnv, makeExecutor)
+	err = cli.Run(ctx, Root, os.Args, os.Stdin, os.Stdout, os.Stderr, buildEnv, makeExitCodeExecutor)
 	if err != nil {
-		return 1
+		return errExitCode(err)
 	}
 
 	// everything went better than expected :)
@@ -262,12 +263,7 @@ func makeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
 		return exe, nil
 	}
 
-	// Resolve the API addr.
-	apiAddr, err = resolveAddr(req.Context, apiAddr)
-	if err != nil {
-		return nil, err
-	}
-	network, host, err := manet.DialArgs(apiAddr)
+	host, transport, err := apiTransport(req, apiAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -283,23 +279,62 @@ func makeExecutor(req *cmds.Request, env interface{}) (cmds.Executor, error) {
 		opts = append(opts, cmdhttp.ClientWithFallback(exe))
 	}
 
+	if transport != nil {
+		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{Transport: transport}))
+	}
+
+	return cmdhttp.NewClient(host, opts...), nil
+}
+
+// apiTransport returns the host to send the requests of req to, for the API
+// at apiAddr, and their transport, nil for the default one.
+func apiTransport(req *cmds.Request, apiAddr ma.Multiaddr) (string, http.RoundTripper, error) {
+	// Resolve the API addr.
+	apiAddr, err := resolveAddr(req.Context, apiAddr)
+	if err != nil {
+		return "", nil, err
+	}
+	network, host, err := manet.DialArgs(apiAddr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var transport http.RoundTripper
 	switch network {
 	case "tcp", "tcp4", "tcp6":
 	case "unix":
-		path := host
 		host = "unix"
-		opts = append(opts, cmdhttp.ClientWithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-					return net.Dial("unix", path)
-				},
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				// a unix socket, or a named pipe on Windows
+				return apisocket.Dial(ctx, apiAddr)
 			},
-		}))
+		}
 	default:
-		return nil, fmt.Errorf("unsupported API address: %s", apiAddr)
+		return "", nil, fmt.Errorf("unsupported API address: %s", apiAddr)
 	}
 
-	return cmdhttp.NewClient(host, opts...), nil
+	// Send the API secret in a header rather than as a query parameter.
+	if secret, ok := req.Options[corecmds.ApiAuthOption].(string); ok {
+		delete(req.Options, corecmds.ApiAuthOption)
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		transport = &authTransport{secret: secret, next: transport}
+	}
+	return host, transport, nil
+}
+
+// authTransport authorizes the requests made to the API with a secret.
+type authTransport struct {
+	secret string
+	next   http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.secret)
+	return t.next.RoundTrip(r)
 }
 
 func getRepoPath(req *cmds.Request) (string, error) {
@@ -163,7 +163,10 @@ func pinAllMFS(ctx context.Context, node pinMFSNode, cfg *config.Config, rootCid
 
 		// do nothing, if MFS has not changed since last pin on the exact same service or waiting for MFS.RepinInterval
 		if last, ok := lastPins[svcName]; ok {
-			if last.ServiceConfig == svcConfig && (last.CID == rootCid || time.Since(last.Time) < repinInterval) {
+			// the other policies, whose optional values are pointers, are not
+			// compared
+			sameConfig := last.ServiceConfig.API == svcConfig.API && last.ServiceConfig.Policies.MFS == svcConfig.Policies.MFS
+			if sameConfig && (last.CID == rootCid || time.Since(last.Time) < repinInterval) {
 				if last.CID == rootCid {
 					mfslog.Debugf("pinning MFS root to %q: pin for %q exists since %s, skipping", svcName, rootCid, last.Time.String())
 				} else {
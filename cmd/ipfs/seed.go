@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	gocarv2 "github.com/ipld/go-car/v2"
+)
+
+// seedManifest describes the seed of a new repo, so that the nodes of a fleet
+// or a classroom are initialized with the same settings and content:
+//
+//	{
+//	  "Profiles": ["server"],
+//	  "Config": {"Datastore.StorageMax": "50GB"},
+//	  "Cars": ["course.car"],
+//	  "Pins": [{"Path": "/ipfs/bafy...", "Name": "course"}]
+//	}
+type seedManifest struct {
+	// Profiles are the config profiles applied, after the ones of the
+	// command line.
+	Profiles []string
+	// Config are the config values set by key, as with 'ipfs config --json',
+	// after the profiles.
+	Config map[string]json.RawMessage
+	// Cars are the CAR files imported, relative to the manifest.
+	Cars []string
+	// Pins are the recursive pins added, the roots of the CARs when not
+	// set.
+	Pins []seedPin
+
+	// dir is the directory of the manifest
+	dir string
+}
+
+type seedPin struct {
+	Path   string
+	Name   string
+	Labels map[string]string
+}
+
+// loadSeedManifest reads the seed manifest at file.
+func loadSeedManifest(file string) (*seedManifest, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var seed seedManifest
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&seed); err != nil {
+		return nil, fmt.Errorf("invalid seed manifest %s: %w", file, err)
+	}
+	for _, p := range seed.Pins {
+		if err := ipath.New(p.Path).IsValid(); err != nil {
+			return nil, fmt.Errorf("invalid seed manifest %s: pin %q: %w", file, p.Path, err)
+		}
+	}
+	seed.dir = filepath.Dir(file)
+	return &seed, nil
+}
+
+// profiles returns the profiles of the command line followed by the ones of
+// the seed.
+func (seed *seedManifest) profiles(profiles string) string {
+	if seed == nil || len(seed.Profiles) == 0 {
+		return profiles
+	}
+	all := seed.Profiles
+	if profiles != "" {
+		all = append(strings.Split(profiles, ","), all...)
+	}
+	return strings.Join(all, ",")
+}
+
+// seedRepo sets the config values of seed in the new repo at repoRoot, and
+// imports and pins its content.
+func seedRepo(out io.Writer, repoRoot string, seed *seedManifest) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil { // NB: repo is owned by the node
+		return err
+	}
+
+	keys := make([]string, 0, len(seed.Config))
+	for key := range seed.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var value interface{}
+		if err := json.Unmarshal(seed.Config[key], &value); err != nil {
+			r.Close()
+			return fmt.Errorf("seed: config %s: %w", key, err)
+		}
+		if err := r.SetConfigKey(key, value); err != nil {
+			r.Close()
+			return fmt.Errorf("seed: config %s: %w", key, err)
+		}
+	}
+
+	nd, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+	if err != nil {
+		return err
+	}
+	defer nd.Close()
+	api, err := coreapi.NewCoreAPI(nd)
+	if err != nil {
+		return err
+	}
+
+	var roots []cid.Cid
+	for _, car := range seed.Cars {
+		if !filepath.IsAbs(car) {
+			car = filepath.Join(seed.dir, car)
+		}
+		carRoots, blocks, err := importSeedCar(ctx, api.Dag(), car)
+		if err != nil {
+			return fmt.Errorf("seed: %s: %w", car, err)
+		}
+		roots = append(roots, carRoots...)
+		if _, err := fmt.Fprintf(out, "imported %d blocks from %s\n", blocks, car); err != nil {
+			return err
+		}
+	}
+
+	pins := seed.Pins
+	if len(pins) == 0 {
+		for _, c := range roots {
+			pins = append(pins, seedPin{Path: ipath.IpfsPath(c).String()})
+		}
+	}
+	pinAPI := api.Pin().(*coreapi.PinAPI)
+	for _, pin := range pins {
+		p := ipath.New(pin.Path)
+		if err := pinAPI.Add(ctx, p); err != nil {
+			return fmt.Errorf("seed: pin %s: %w", pin.Path, err)
+		}
+		if pin.Name != "" || len(pin.Labels) > 0 {
+			if err := pinAPI.SetMeta(ctx, p, pin.Name, pin.Labels); err != nil {
+				return fmt.Errorf("seed: pin %s: %w", pin.Path, err)
+			}
+		}
+		if _, err := fmt.Fprintf(out, "pinned %s\n", pin.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importSeedCar imports the blocks of the CAR file, returning its roots and
+// the number of blocks.
+func importSeedCar(ctx context.Context, dag ipld.DAGService, file string) ([]cid.Cid, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	car, err := gocarv2.NewBlockReader(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	batch := ipld.NewBatch(ctx, dag)
+	blocks := 0
+	for {
+		block, err := car.Next()
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("block %d: %w", blocks+1, err)
+		} else if block == nil {
+			break
+		}
+		nd, err := ipld.Decode(block)
+		if err != nil {
+			return nil, 0, fmt.Errorf("block %d: %w", blocks+1, err)
+		}
+		if err := batch.Add(ctx, nd); err != nil {
+			return nil, 0, err
+		}
+		blocks++
+	}
+	if err := batch.Commit(); err != nil {
+		return nil, 0, err
+	}
+	return car.Roots, blocks, nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	oldcmds "github.com/ipfs/go-ipfs/commands"
+	corehttp "github.com/ipfs/go-ipfs/core/corehttp"
+	repo "github.com/ipfs/go-ipfs/repo"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs-cmds/cli"
+	cmdhttp "github.com/ipfs/go-ipfs-cmds/http"
+	"golang.org/x/term"
+)
+
+const (
+	sessionStopOnErrorOptionName = "stop-on-error"
+	sessionSeparatorOptionName   = "separator"
+
+	// sessionPrompt is printed before reading each command from a terminal.
+	sessionPrompt = "ipfs> "
+)
+
+var sessionCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Run many commands on the daemon over a single connection.",
+		ShortDescription: `
+'ipfs session' runs the commands of a script, or read from stdin, on the
+running daemon, one per line, over a single connection to its API.
+`,
+		LongDescription: `
+'ipfs session' runs the commands of a script, or read from stdin, on the
+running daemon, one per line, over a single connection to its API. It saves
+starting a process, connecting to the API and authorizing with it for each
+command, which is most of the time taken by small commands: tools running
+thousands of them run them in a session instead.
+
+Each line is a command line, without the leading 'ipfs', which is ignored if
+present. The arguments are split on spaces, quoted with single or double
+quotes, or escaped with a backslash, as in a shell. The empty lines and the
+lines starting with '#' are ignored, and 'exit' ends the session. The API
+is given to the session, with --api and --api-auth, while --timeout and
+--encoding are given to each command.
+
+The output and the errors of the commands are written to stdout and stderr
+in turn. With --separator, a line is written to stdout after the output of
+each command, telling the outputs apart. The commands do not read stdin, and
+the commands run by the client, like 'ipfs daemon' or 'ipfs init', are
+refused.
+
+The session goes on after a command fails, unless --stop-on-error is given,
+and fails when any of its commands did. Read from a terminal, the commands
+are prompted for.
+
+Example:
+
+    > ipfs session <<EOF
+    files mkdir -p /docs
+    files cp /ipfs/bafybeig... "/docs/my notes"
+    files stat --hash /docs
+    EOF
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("script", false, false, "File of the commands to run, one per line. Read from stdin if not given."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(sessionStopOnErrorOptionName, "s", "End the session after the first command that fails."),
+		cmds.StringOption(sessionSeparatorOptionName, "Line written to stdout after the output of each command."),
+	},
+	NoRemote: true,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cctx := env.(*oldcmds.Context)
+		stopOnError, _ := req.Options[sessionStopOnErrorOptionName].(bool)
+		separator, hasSeparator := req.Options[sessionSeparatorOptionName].(string)
+
+		in := os.Stdin
+		if len(req.Arguments) > 0 {
+			f, err := os.Open(req.Arguments[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		interactive := in == os.Stdin && term.IsTerminal(int(os.Stdin.Fd()))
+
+		exe, err := sessionClient(req, cctx)
+		if err != nil {
+			return err
+		}
+
+		var ran, failed int
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(nil, 1<<20)
+		for {
+			if interactive {
+				fmt.Fprint(os.Stderr, sessionPrompt)
+			}
+			if !scanner.Scan() {
+				break
+			}
+			args, err := splitCommandLine(scanner.Text())
+			if err != nil {
+				ran++
+				failed++
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				if stopOnError {
+					break
+				}
+				continue
+			}
+			if len(args) > 0 && args[0] == "ipfs" {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				continue
+			}
+			if len(args) == 1 && args[0] == "exit" {
+				break
+			}
+
+			ran++
+			err = runSessionCommand(req.Context, exe, env, args, os.Stdout, os.Stderr)
+			if err != nil {
+				failed++
+				// the errors of the commands that ran were written already
+				if _, ok := err.(cli.ExitError); !ok {
+					fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				}
+			}
+			if hasSeparator {
+				fmt.Fprintln(os.Stdout, separator)
+			}
+			if err != nil && stopOnError {
+				break
+			}
+			if err := req.Context.Err(); err != nil {
+				return err
+			}
+		}
+		if interactive {
+			fmt.Fprintln(os.Stderr)
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d commands failed", failed, ran)
+		}
+		return nil
+	},
+}
+
+// sessionClient returns the client running the commands of the session
+// started by req on the daemon, authorized once and keeping its connection
+// to the API open between the commands.
+func sessionClient(req *cmds.Request, cctx *oldcmds.Context) (cmds.Executor, error) {
+	apiAddr, err := apiAddrOption(req)
+	if err != nil {
+		return nil, err
+	}
+	if apiAddr == nil {
+		apiAddr, err = fsrepo.APIAddr(cctx.ConfigRoot)
+		switch err {
+		case nil:
+		case repo.ErrApiNotRunning:
+			return nil, errors.New("the commands of a session run on the daemon, which is not running")
+		default:
+			return nil, err
+		}
+	}
+
+	host, transport, err := apiTransport(req, apiAddr)
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return cmdhttp.NewClient(host,
+		cmdhttp.ClientWithAPIPrefix(corehttp.APIPath),
+		cmdhttp.ClientWithHTTPClient(&http.Client{Transport: &keepAliveTransport{next: transport}}),
+	), nil
+}
+
+// keepAliveTransport keeps the connections open after the requests, which
+// the client of the commands closes otherwise.
+type keepAliveTransport struct {
+	next http.RoundTripper
+}
+
+func (t *keepAliveTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Close = false
+	return t.next.RoundTrip(r)
+}
+
+// runSessionCommand runs the command line args of a session with exe,
+// writing its output to stdout and its errors to stderr. It returns a
+// cli.ExitError when the command ran and failed, its error written already.
+func runSessionCommand(ctx context.Context, exe cmds.Executor, env cmds.Environment, args []string, stdout, stderr io.Writer) error {
+	req, errParse := cli.Parse(ctx, args, nil, Root)
+	if req != nil {
+		if err := cli.HandleHelp("ipfs", req, stdout); err != cli.ErrNoHelpRequested {
+			return err
+		}
+	}
+	if errParse != nil {
+		return errParse
+	}
+	if req.Command.Run == nil {
+		return cli.ShortHelp("ipfs", Root, req.Path, stdout)
+	}
+	if req.Command.NoRemote {
+		return fmt.Errorf("'ipfs %s' runs on the client, not in a session", strings.Join(req.Path, " "))
+	}
+
+	var cancel context.CancelFunc
+	if timeoutStr, ok := req.Options[cmds.TimeoutOpt].(string); ok {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return err
+		}
+		req.Context, cancel = context.WithTimeout(req.Context, timeout)
+	} else {
+		req.Context, cancel = context.WithCancel(req.Context)
+	}
+	defer cancel()
+
+	// use JSON if text was requested but the command doesn't have a text-encoder
+	encType, _ := req.Options[cmds.EncLong].(string)
+	if _, ok := req.Command.Encoders[cmds.EncodingType(encType)]; cmds.EncodingType(encType) == cmds.Text && !ok {
+		req.Options[cmds.EncLong] = cmds.JSON
+	}
+
+	re, err := cli.NewResponseEmitter(stdout, stderr, req)
+	if err != nil {
+		return err
+	}
+	if err := exe.Execute(req, re, env); err != nil {
+		return err
+	}
+	if code := re.Status(); code != 0 {
+		return cli.ExitError(code)
+	}
+	return nil
+}
+
+// splitCommandLine splits line into arguments as a shell does: on spaces,
+// but within single or double quotes, and for the characters escaped with a
+// backslash. A line starting with '#' is a comment, with no arguments.
+func splitCommandLine(line string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+	)
+	runes := []rune(strings.TrimSpace(line))
+	if len(runes) > 0 && runes[0] == '#' {
+		return nil, nil
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\' && (quote == 0 || (i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]))):
+			if i+1 == len(runes) {
+				return nil, errors.New("unfinished escape at the end of the line")
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	for _, c := range []struct {
+		line string
+		args []string
+	}{
+		{"", nil},
+		{"  # files ls", nil},
+		{"files ls /", []string{"files", "ls", "/"}},
+		{"  files\tls   / ", []string{"files", "ls", "/"}},
+		{`files mkdir "/my docs"`, []string{"files", "mkdir", "/my docs"}},
+		{`files mkdir '/my "docs"'`, []string{"files", "mkdir", `/my "docs"`}},
+		{`files mkdir /my\ docs`, []string{"files", "mkdir", "/my docs"}},
+		{`echo "a \"b\" \c" 'd\e'`, []string{"echo", `a "b" \c`, `d\e`}},
+		{`key gen ""`, []string{"key", "gen", ""}},
+		{`pin add a#b`, []string{"pin", "add", "a#b"}},
+	} {
+		args, err := splitCommandLine(c.line)
+		if err != nil {
+			t.Errorf("%q: %s", c.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%q: expected %q, got %q", c.line, c.args, args)
+		}
+	}
+
+	for _, line := range []string{`files ls "/a`, `files ls '/a`, `files ls /a\`} {
+		if _, err := splitCommandLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/tracing"
+)
+
+// startTracing traces with the Tracing section of the config of r, and
+// applies its changes every configPollInterval, unless tracing is configured
+// by the environment variables. It returns the function stopping the tracing.
+func startTracing(ctx context.Context, configPollInterval time.Duration, r repo.Repo) (func(), error) {
+	if tracing.EnvEnabled() {
+		return func() {}, nil
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, err
+	}
+	tp, err := tracing.NewConfigTracerProvider(ctx, cfg.Tracing)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tick := time.NewTicker(configPollInterval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return
+			}
+			cfg, err := r.Config()
+			if err == nil {
+				err = tp.Configure(ctx, cfg.Tracing)
+			}
+			if err != nil {
+				log.Errorf("applying the tracing config: %s", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Errorf("shutting down the tracing: %s", err)
+		}
+	}, nil
+}
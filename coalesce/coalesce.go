@@ -0,0 +1,267 @@
+// Package coalesce coalesces the identical wants of the consumers of an
+// exchange: the gateway, pins and API calls fetching the same block at the
+// same time share a single fetch, whose block is delivered to all of them.
+//
+// A shared fetch runs until its block arrives, or until all the consumers
+// waiting for it give up. Its context is its own, and the consumers waiting
+// for a fetch canceled by the context of another consumer or session fetch
+// the block again.
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var coalescedWants = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ipfs_bitswap_coalesced_wants_total",
+	Help: "wants of blocks already being fetched, which did not trigger another fetch",
+})
+
+// errNotFetched is returned to the consumers waiting for a block a batch
+// fetch ended without.
+var errNotFetched = errors.New("block was not fetched")
+
+// want is a block being fetched.
+type want struct {
+	c     cid.Cid
+	fetch *fetch
+	// waiters is the number of consumers waiting for the block
+	waiters int
+	// done is closed when blk or err is set
+	done chan struct{}
+	blk  blocks.Block
+	err  error
+}
+
+// fetch is a fetch of the blocks of one or more wants.
+type fetch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// live is the number of wants the fetch is still for
+	live int
+}
+
+type coalescer struct {
+	mu    sync.Mutex
+	wants map[cid.Cid]*want
+}
+
+// join returns the wants of ks, with those that need to be fetched.
+func (co *coalescer) join(ks []cid.Cid) (wants []*want, fresh []*want) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	for _, c := range ks {
+		w, ok := co.wants[c]
+		if ok {
+			coalescedWants.Inc()
+		} else {
+			w = &want{c: c, done: make(chan struct{})}
+			co.wants[c] = w
+			fresh = append(fresh, w)
+		}
+		w.waiters++
+		wants = append(wants, w)
+	}
+	if len(fresh) > 0 {
+		f := &fetch{live: len(fresh)}
+		// the fetch outlives the consumer starting it
+		f.ctx, f.cancel = context.WithCancel(context.Background())
+		for _, w := range fresh {
+			w.fetch = f
+		}
+	}
+	return wants, fresh
+}
+
+// leave stops waiting for w, and abandons its fetch when no one waits for it
+// anymore.
+func (co *coalescer) leave(w *want) {
+	co.mu.Lock()
+	defer co.mu.Unlock()
+	w.waiters--
+	if w.waiters == 0 && co.wants[w.c] == w {
+		co.finish(w, nil, context.Canceled)
+	}
+}
+
+// finish sets the result of w, if it has none yet. The caller holds mu.
+func (co *coalescer) finish(w *want, blk blocks.Block, err error) {
+	if co.wants[w.c] != w {
+		return
+	}
+	delete(co.wants, w.c)
+	w.blk, w.err = blk, err
+	close(w.done)
+	w.fetch.live--
+	if w.fetch.live == 0 {
+		w.fetch.cancel()
+	}
+}
+
+// getBlock fetches c with f, unless it is already being fetched.
+func (co *coalescer) getBlock(ctx context.Context, f exchange.Fetcher, c cid.Cid) (blocks.Block, error) {
+	for {
+		wants, fresh := co.join([]cid.Cid{c})
+		w := wants[0]
+		if len(fresh) > 0 {
+			go func() {
+				blk, err := f.GetBlock(w.fetch.ctx, c)
+				co.mu.Lock()
+				co.finish(w, blk, err)
+				co.mu.Unlock()
+			}()
+		}
+
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			co.leave(w)
+			return nil, ctx.Err()
+		}
+		// fetch it ourselves if the fetch of another consumer was canceled
+		if len(fresh) == 0 && w.err != nil && ctx.Err() == nil && (errors.Is(w.err, context.Canceled) || errors.Is(w.err, context.DeadlineExceeded)) {
+			continue
+		}
+		return w.blk, w.err
+	}
+}
+
+// getBlocks fetches those of ks that are not being fetched already with f.
+func (co *coalescer) getBlocks(ctx context.Context, f exchange.Fetcher, ks []cid.Cid) (<-chan blocks.Block, error) {
+	set := cid.NewSet()
+	var unique []cid.Cid
+	for _, c := range ks {
+		if set.Visit(c) {
+			unique = append(unique, c)
+		}
+	}
+	wants, fresh := co.join(unique)
+
+	if len(fresh) > 0 {
+		fetchCtx := fresh[0].fetch.ctx
+		keys := make([]cid.Cid, len(fresh))
+		byKey := make(map[cid.Cid]*want, len(fresh))
+		for i, w := range fresh {
+			keys[i] = w.c
+			byKey[w.c] = w
+		}
+		ch, err := f.GetBlocks(fetchCtx, keys)
+		if err != nil {
+			co.mu.Lock()
+			for _, w := range fresh {
+				co.finish(w, nil, err)
+			}
+			co.mu.Unlock()
+			for _, w := range wants {
+				co.leave(w)
+			}
+			return nil, err
+		}
+		go func() {
+			for blk := range ch {
+				if w, ok := byKey[blk.Cid()]; ok {
+					co.mu.Lock()
+					co.finish(w, blk, nil)
+					co.mu.Unlock()
+				}
+			}
+			err := fetchCtx.Err()
+			if err == nil {
+				err = errNotFetched
+			}
+			co.mu.Lock()
+			for _, w := range fresh {
+				co.finish(w, nil, err)
+			}
+			co.mu.Unlock()
+		}()
+	}
+
+	out := make(chan blocks.Block)
+	var wg sync.WaitGroup
+	for _, w := range wants {
+		wg.Add(1)
+		go func(w *want) {
+			defer wg.Done()
+			select {
+			case <-w.done:
+			case <-ctx.Done():
+				co.leave(w)
+				return
+			}
+			if w.err != nil {
+				return
+			}
+			select {
+			case out <- w.blk:
+			case <-ctx.Done():
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+// fetcher coalesces the wants of its fetches with the other fetches of the
+// exchange.
+type fetcher struct {
+	exchange.Fetcher
+	co *coalescer
+}
+
+func (f fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return f.co.getBlock(ctx, f.Fetcher, c)
+}
+
+func (f fetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return f.co.getBlocks(ctx, f.Fetcher, ks)
+}
+
+// Exchange is an exchange coalescing the identical wants of its fetches.
+type Exchange struct {
+	exchange.Interface
+	fetcher
+}
+
+// NewExchange returns ex, coalescing the identical wants of its fetches,
+// including those made through its sessions.
+func NewExchange(ex exchange.Interface) exchange.Interface {
+	co := &coalescer{wants: make(map[cid.Cid]*want)}
+	e := &Exchange{Interface: ex, fetcher: fetcher{ex, co}}
+	if sex, ok := ex.(exchange.SessionExchange); ok {
+		return &SessionExchange{Exchange: e, sex: sex}
+	}
+	return e
+}
+
+// GetBlock implements exchange.Fetcher.
+func (e *Exchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.fetcher.GetBlock(ctx, c)
+}
+
+// GetBlocks implements exchange.Fetcher.
+func (e *Exchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return e.fetcher.GetBlocks(ctx, ks)
+}
+
+// SessionExchange is an Exchange with sessions.
+type SessionExchange struct {
+	*Exchange
+	sex exchange.SessionExchange
+}
+
+// NewSession implements exchange.SessionExchange.
+func (e *SessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return fetcher{e.sex.NewSession(ctx), e.co}
+}
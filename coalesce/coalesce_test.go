@@ -0,0 +1,243 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+// fakeExchange serves its blocks once released, and counts the wants.
+type fakeExchange struct {
+	blocks  map[cid.Cid]blocks.Block
+	release chan struct{}
+
+	mu    sync.Mutex
+	wants map[cid.Cid]int
+}
+
+func newFakeExchange(bs ...blocks.Block) *fakeExchange {
+	e := &fakeExchange{
+		blocks:  make(map[cid.Cid]blocks.Block),
+		release: make(chan struct{}),
+		wants:   make(map[cid.Cid]int),
+	}
+	for _, b := range bs {
+		e.blocks[b.Cid()] = b
+	}
+	return e
+}
+
+func (e *fakeExchange) wanted(c cid.Cid) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.wants[c]
+}
+
+func (e *fakeExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	e.mu.Lock()
+	e.wants[c]++
+	e.mu.Unlock()
+	select {
+	case <-e.release:
+		return e.blocks[c], nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (e *fakeExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	e.mu.Lock()
+	for _, c := range ks {
+		e.wants[c]++
+	}
+	e.mu.Unlock()
+	out := make(chan blocks.Block)
+	go func() {
+		defer close(out)
+		select {
+		case <-e.release:
+		case <-ctx.Done():
+			return
+		}
+		for _, c := range ks {
+			select {
+			case out <- e.blocks[c]:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (e *fakeExchange) HasBlock(context.Context, blocks.Block) error { return nil }
+
+func (e *fakeExchange) IsOnline() bool { return true }
+
+func (e *fakeExchange) Close() error { return nil }
+
+func (e *fakeExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return sessionFetcher{e, ctx}
+}
+
+// sessionFetcher fails once its session is over, like those of bitswap.
+type sessionFetcher struct {
+	e   *fakeExchange
+	ctx context.Context
+}
+
+func (s sessionFetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return s.e.GetBlock(ctx, c)
+}
+
+func (s sessionFetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return s.e.GetBlocks(ctx, ks)
+}
+
+func waitWanted(t *testing.T, e *fakeExchange, c cid.Cid, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for e.wanted(c) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s wanted %d times, expected %d", c, e.wanted(c), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitWaiters(t *testing.T, ex exchange.Interface, c cid.Cid, n int) {
+	t.Helper()
+	co := ex.(*SessionExchange).co
+	deadline := time.Now().Add(time.Second)
+	for {
+		co.mu.Lock()
+		w := co.wants[c]
+		ok := w != nil && w.waiters >= n
+		co.mu.Unlock()
+		if ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not waited for by %d consumers", c, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	a := blocks.NewBlock([]byte("a"))
+	b := blocks.NewBlock([]byte("b"))
+	fe := newFakeExchange(a, b)
+	ex := NewExchange(fe).(exchange.SessionExchange)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	get := func(f exchange.Fetcher) {
+		defer wg.Done()
+		blk, err := f.GetBlock(ctx, a.Cid())
+		if err != nil || !blk.Cid().Equals(a.Cid()) {
+			t.Errorf("unexpected result %v, %v", blk, err)
+		}
+	}
+	wg.Add(3)
+	go get(ex)
+	waitWanted(t, fe, a.Cid(), 1)
+	go get(ex)
+	go get(ex.NewSession(ctx))
+
+	var got []blocks.Block
+	ch, err := ex.GetBlocks(ctx, []cid.Cid{a.Cid(), b.Cid(), b.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitWanted(t, fe, b.Cid(), 1)
+	waitWaiters(t, ex, a.Cid(), 4)
+	close(fe.release)
+	for blk := range ch {
+		got = append(got, blk)
+	}
+	wg.Wait()
+
+	if len(got) != 2 {
+		t.Fatalf("expected a and b, got %v", got)
+	}
+	if fe.wanted(a.Cid()) != 1 || fe.wanted(b.Cid()) != 1 {
+		t.Fatalf("wanted a %d and b %d times", fe.wanted(a.Cid()), fe.wanted(b.Cid()))
+	}
+
+	// once fetched, a block is fetched anew
+	if _, err := ex.GetBlock(ctx, a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if fe.wanted(a.Cid()) != 2 {
+		t.Fatalf("wanted a %d times", fe.wanted(a.Cid()))
+	}
+}
+
+func TestCoalesceCancel(t *testing.T) {
+	a := blocks.NewBlock([]byte("a"))
+	fe := newFakeExchange(a)
+	ex := NewExchange(fe).(exchange.SessionExchange)
+	ctx := context.Background()
+
+	// the session fetching the block ends, the other consumer fetches it
+	sessCtx, endSession := context.WithCancel(ctx)
+	consumerCtx, cancelConsumer := context.WithCancel(ctx)
+	defer cancelConsumer()
+	errs := make(chan error, 1)
+	go func() {
+		_, err := ex.NewSession(sessCtx).GetBlock(consumerCtx, a.Cid())
+		errs <- err
+	}()
+	waitWanted(t, fe, a.Cid(), 1)
+
+	res := make(chan blocks.Block, 1)
+	go func() {
+		blk, err := ex.GetBlock(ctx, a.Cid())
+		if err != nil {
+			t.Error(err)
+		}
+		res <- blk
+	}()
+	waitWaiters(t, ex, a.Cid(), 2)
+	endSession()
+	if err := <-errs; err == nil {
+		t.Fatal("the fetch of the ended session succeeded")
+	}
+	waitWanted(t, fe, a.Cid(), 2)
+	close(fe.release)
+	if blk := <-res; blk == nil || !blk.Cid().Equals(a.Cid()) {
+		t.Fatalf("unexpected block %v", blk)
+	}
+
+	// a fetch no one waits for anymore is abandoned
+	fe = newFakeExchange(a)
+	ex = NewExchange(fe).(exchange.SessionExchange)
+	cctx, cancel := context.WithCancel(ctx)
+	go func() {
+		_, err := ex.GetBlock(cctx, a.Cid())
+		errs <- err
+	}()
+	waitWanted(t, fe, a.Cid(), 1)
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n := len(ex.(*SessionExchange).co.wants); n != 0 {
+		t.Fatalf("%d wants left", n)
+	}
+}
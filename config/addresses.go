@@ -8,4 +8,8 @@ type Addresses struct {
 	NoAnnounce     []string // swarm addresses not to announce to the network
 	API            Strings  // address for the local API (RPC)
 	Gateway        Strings  // address to listen on for IPFS HTTP object gateway
+
+	// NoAnnounceTransports are the transports, such as "quic" or "ws", whose
+	// addresses are not announced to the network
+	NoAnnounceTransports []string `json:",omitempty"`
 }
@@ -1,5 +1,73 @@
 package config
 
+import "fmt"
+
+// APIAuthConcealSelector selects the secrets of the API authorizations, which
+// are never shown or changed through the API.
+var APIAuthConcealSelector = []string{"API", "Authorizations", "*", "AuthSecret"}
+
 type API struct {
 	HTTPHeaders map[string][]string // HTTP headers to return with the API.
+
+	// Authorizations, when set, restricts the RPC API to the requests
+	// carrying one of these secrets. The keys are names for the
+	// authorizations.
+	Authorizations map[string]*RPCAuthScope `json:",omitempty"`
+
+	// SocketMode is the file mode of the unix sockets of Addresses.API, such
+	// as "0660" for the group of SocketGroup to connect too. Defaults to
+	// "0600".
+	SocketMode *OptionalString `json:",omitempty"`
+
+	// SocketGroup is the group allowed to connect to the unix sockets and
+	// named pipes of Addresses.API, if any.
+	SocketGroup *OptionalString `json:",omitempty"`
+}
+
+// RPCAuthScope describes a secret allowed to use the RPC API and what it can
+// be used for.
+type RPCAuthScope struct {
+	// AuthSecret is the bearer token sent in the Authorization header.
+	AuthSecret string
+
+	// AllowedCommands are the commands that can be called, e.g. "cat" or
+	// "files/*". All commands are allowed when empty.
+	AllowedCommands []string `json:",omitempty"`
+
+	// Scopes are names of RPCAuthScopes, whose commands can be called along
+	// with AllowedCommands.
+	Scopes []string `json:",omitempty"`
+
+	// DeniedCommands are the commands that can't be called, even if they
+	// match AllowedCommands or Scopes.
+	DeniedCommands []string `json:",omitempty"`
+}
+
+// RPCAuthScopes are the sets of commands that can be allowed to an
+// authorization by name, in its Scopes.
+var RPCAuthScopes = map[string][]string{
+	"read-only": {
+		"cat", "get", "ls", "dns", "resolve", "id", "version",
+		"block/get", "block/stat",
+		"dag/get", "dag/resolve", "dag/stat", "dag/export",
+		"object/get", "object/data", "object/links", "object/stat",
+		"files/ls", "files/read", "files/stat",
+		"name/resolve",
+	},
+	"pin-admin": {"pin/*"},
+}
+
+// Unrestricted reports whether the authorization can call every command.
+func (s *RPCAuthScope) Unrestricted() bool {
+	return len(s.AllowedCommands) == 0 && len(s.Scopes) == 0 && len(s.DeniedCommands) == 0
+}
+
+// CheckScopes returns an error if one of the Scopes is not in RPCAuthScopes.
+func (s *RPCAuthScope) CheckScopes() error {
+	for _, name := range s.Scopes {
+		if _, ok := RPCAuthScopes[name]; !ok {
+			return fmt.Errorf("unknown API authorization scope %q", name)
+		}
+	}
+	return nil
 }
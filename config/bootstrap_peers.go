@@ -30,6 +30,19 @@ func (c *Config) BootstrapPeers() ([]peer.AddrInfo, error) {
 	return ParseBootstrapPeers(c.Bootstrap)
 }
 
+// BootstrapGroupPeers returns the peers of a group of BootstrapGroups, or the
+// Bootstrap peers for the group "".
+func (c *Config) BootstrapGroupPeers(group string) ([]peer.AddrInfo, error) {
+	if group == "" {
+		return c.BootstrapPeers()
+	}
+	addrs, ok := c.BootstrapGroups[group]
+	if !ok {
+		return nil, fmt.Errorf("unknown bootstrap group %q", group)
+	}
+	return ParseBootstrapPeers(addrs)
+}
+
 // DefaultBootstrapPeers returns the (parsed) set of default bootstrap peers.
 // if it fails, it returns a meaningful error for the user.
 // This is here (and not inside cmd/ipfs/init) because of module dependency problems.
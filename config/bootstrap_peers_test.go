@@ -22,3 +22,30 @@ func TestBoostrapPeerStrings(t *testing.T) {
 		}
 	}
 }
+
+func TestBootstrapGroupPeers(t *testing.T) {
+	cfg := &Config{
+		Bootstrap: DefaultBootstrapAddresses[:1],
+		BootstrapGroups: map[string][]string{
+			"cluster": DefaultBootstrapAddresses[1:3],
+		},
+	}
+
+	peers, err := cfg.BootstrapGroupPeers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("expected the Bootstrap peer, got %v", peers)
+	}
+	peers, err = cfg.BootstrapGroupPeers("cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("expected the 2 peers of the group, got %v", peers)
+	}
+	if _, err := cfg.BootstrapGroupPeers("lan"); err == nil {
+		t.Fatal("expected an error for an unknown group")
+	}
+}
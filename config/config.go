@@ -22,20 +22,34 @@ type Config struct {
 	Routing   Routing   // local node's routing settings
 	Ipns      Ipns      // Ipns settings
 	Bootstrap []string  // local nodes's bootstrap peer addresses
-	Gateway   Gateway   // local node's gateway server options
-	API       API       // local node's API settings
-	Swarm     SwarmConfig
-	AutoNAT   AutoNATConfig
-	Pubsub    PubsubConfig
-	Peering   Peering
-	DNS       DNS
-	Migration Migration
-
-	Provider     Provider
-	Reprovider   Reprovider
-	Experimental Experiments
-	Plugins      Plugins
-	Pinning      Pinning
+	// BootstrapGroups are named sets of bootstrap peer addresses, such as the
+	// peers of a private network, used instead of Bootstrap when selected
+	BootstrapGroups map[string][]string `json:",omitempty"`
+	Gateway         Gateway             // local node's gateway server options
+	API             API                 // local node's API settings
+	Swarm           SwarmConfig
+	AutoNAT         AutoNATConfig
+	Pubsub          PubsubConfig
+	Peering         Peering
+	DNS             DNS
+	DNSLink         DNSLink
+	Migration       Migration
+
+	Provider       Provider
+	Reprovider     Reprovider
+	LowPower       LowPower
+	MemoryBudget   MemoryBudget
+	ResourceBudget ResourceBudget
+	Experimental   Experiments
+	Plugins        Plugins
+	Pinning        Pinning
+	Files          Files
+	Import         Import
+	Update         Update
+	Tracing        Tracing
+	Hooks          Hooks
+	Profiling      Profiling
+	Maintenance    Maintenance
 
 	Internal Internal // experimental/unstable options
 }
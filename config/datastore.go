@@ -23,6 +23,106 @@ type Datastore struct {
 
 	HashOnRead      bool
 	BloomFilterSize int
+
+	// ColdTier configures offloading of pinned content to a secondary
+	// datastore.
+	ColdTier ColdTier
+
+	// BackgroundIO limits the disk I/O of the background jobs.
+	BackgroundIO BackgroundIO
+
+	// GroupCommit groups the blocks written concurrently into fewer commits.
+	GroupCommit GroupCommit
+
+	// Placement stores the blocks in several datastores, by rules.
+	Placement Placement
+}
+
+// PlacementMain is the name the rules of Placement give to the main
+// datastore.
+const PlacementMain = "main"
+
+// Placement mounts datastores the blocks are stored in besides the main
+// datastore, by rules on their size, their codec or the labels of their pins,
+// such as to keep the small blocks on a fast disk and the large leaves on a
+// cheap one.
+type Placement struct {
+	// Mounts are the datastore specs of the mounts, in the same format as
+	// Datastore.Spec, by name.
+	Mounts map[string]map[string]interface{} `json:",omitempty"`
+
+	// Rules are tried in order, the first one matching a block placing it.
+	// The blocks no rule matches are stored in the main datastore.
+	Rules []PlacementRule `json:",omitempty"`
+
+	// Interval is how often the blocks of the pins selected by their labels
+	// are moved to their mount.
+	Interval *OptionalDuration `json:",omitempty"`
+}
+
+// PlacementRule places the blocks matching all its conditions in a mount.
+type PlacementRule struct {
+	// Mount is the name of the mount, or PlacementMain.
+	Mount string
+
+	// MinSize and MaxSize bound the size of the blocks, inclusive, such as
+	// "1MB".
+	MinSize *OptionalString `json:",omitempty"`
+	MaxSize *OptionalString `json:",omitempty"`
+
+	// Codecs are the names of the codecs of the blocks, such as "dag-pb".
+	Codecs []string `json:",omitempty"`
+
+	// PinLabels are the labels the recursive pins of the blocks all have,
+	// with these values. The blocks are moved once pinned.
+	PinLabels map[string]string `json:",omitempty"`
+}
+
+// GroupCommit configures the grouping of the blocks written concurrently,
+// such as by the adder and dag import, into batches committed together, so
+// that a datastore syncing each commit syncs once per batch.
+type GroupCommit struct {
+	// Enabled turns group commit on. Defaults to false.
+	Enabled Flag `json:",omitempty"`
+
+	// MaxBlocks is the maximum number of blocks of a batch.
+	MaxBlocks *OptionalInteger `json:",omitempty"`
+
+	// MaxSize is the maximum size of the blocks of a batch, such as "64MB".
+	MaxSize *OptionalString `json:",omitempty"`
+
+	// FlushInterval is how long a batch waits for more blocks before being
+	// committed. Unset commits as soon as the previous commit is done.
+	FlushInterval *OptionalDuration `json:",omitempty"`
+}
+
+// BackgroundIO limits the disk I/O of garbage collection, reprovider walks,
+// and repo verification and fsck, so that they leave the disk to the
+// foreground requests. The limits are shared by all these jobs.
+type BackgroundIO struct {
+	// OperationsPerSecond is the number of blocks listed, checked, read or
+	// deleted per second. Unset means no limit.
+	OperationsPerSecond *OptionalInteger `json:",omitempty"`
+
+	// BytesPerSecond is the size of the blocks read per second, such as
+	// "20MB". Unset means no limit.
+	BytesPerSecond *OptionalString `json:",omitempty"`
+}
+
+// ColdTier configures a secondary datastore that the blocks of selected pins
+// are moved to. Offloaded blocks remain readable, they are fetched back from
+// the cold tier on access.
+type ColdTier struct {
+	// Spec is the datastore spec of the cold tier, in the same format as
+	// Datastore.Spec. The cold tier is disabled when this is empty.
+	Spec map[string]interface{} `json:",omitempty"`
+
+	// Pins lists the CIDs of the recursive pins whose blocks should be
+	// offloaded to the cold tier.
+	Pins []string
+
+	// Interval is how often the offload policy is applied.
+	Interval *OptionalDuration `json:",omitempty"`
 }
 
 // DataStorePath returns the default data store path given a configuration root
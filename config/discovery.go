@@ -1,5 +1,11 @@
 package config
 
+import "time"
+
+// DefaultMDNSAnnounceTTL is how long the CIDs announced by a peer of the local
+// network are looked up there.
+const DefaultMDNSAnnounceTTL = 10 * time.Minute
+
 type Discovery struct {
 	MDNS MDNS
 }
@@ -9,4 +15,20 @@ type MDNS struct {
 
 	// Time in seconds between discovery rounds
 	Interval int
+
+	// Interfaces are the names of the network interfaces discovery runs on,
+	// all the multicast interfaces if empty
+	Interfaces []string `json:",omitempty"`
+
+	// ServiceName is the mDNS service announced and browsed, the one of
+	// libp2p (_p2p._udp) if empty
+	ServiceName string `json:",omitempty"`
+
+	// AnnounceContent announces the root CIDs of the data added to the peers
+	// found, which look them up there before asking the DHT
+	AnnounceContent Flag `json:",omitempty"`
+
+	// AnnounceTTL is how long the CIDs announced by a peer are looked up
+	// there
+	AnnounceTTL *OptionalDuration `json:",omitempty"`
 }
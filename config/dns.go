@@ -3,8 +3,8 @@ package config
 // DNS specifies DNS resolution rules using custom resolvers
 type DNS struct {
 	// Resolvers is a map of FQDNs to URLs for custom DNS resolution.
-	// URLs starting with `https://` indicate DoH endpoints.
-	// Support for other resolver types can be added in the future.
+	// URLs starting with `https://` indicate DoH endpoints, plugins can add
+	// resolvers for other URL schemes.
 	// https://en.wikipedia.org/wiki/Fully_qualified_domain_name
 	// https://en.wikipedia.org/wiki/DNS_over_HTTPS
 	//
@@ -14,4 +14,7 @@ type DNS struct {
 	Resolvers map[string]string
 	// MaxCacheTTL is the maximum duration DNS entries are valid in the cache.
 	MaxCacheTTL *OptionalDuration `json:",omitempty"`
+	// ImplicitResolvers enables the built-in resolvers of decentralized TLDs
+	// such as `eth.` that are not in Resolvers.
+	ImplicitResolvers Flag `json:",omitempty"`
 }
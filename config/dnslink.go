@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+// DefaultDNSLinkInterval is how often the sources of the DNSLink records are
+// checked when DNSLink.Interval is not set.
+const DefaultDNSLinkInterval = 30 * time.Second
+
+var DNSLinkConcealSelector = []string{"DNSLink", "Providers", "*", "Params"}
+
+// DNSLink configures the daemon to keep DNSLink TXT records pointing at the
+// current value of IPNS names or MFS paths.
+type DNSLink struct {
+	// Providers maps provider names to the DNS provider APIs used to update
+	// records.
+	Providers map[string]DNSLinkProvider
+
+	// Records lists the DNSLink records kept up to date.
+	Records []DNSLinkRecord
+
+	// Interval is how often record sources are checked for changes.
+	Interval *OptionalDuration `json:",omitempty"`
+}
+
+// DNSLinkProvider configures a DNS provider API.
+type DNSLinkProvider struct {
+	// Type is the provider type: "cloudflare", "route53", "rfc2136", or a
+	// type added by a plugin.
+	Type string
+
+	// Params are the provider specific parameters, such as credentials.
+	Params map[string]string
+}
+
+// DNSLinkRecord configures a DNSLink record and the source of its value.
+// Exactly one of Key and MFSPath must be set.
+type DNSLinkRecord struct {
+	// Domain is the domain whose _dnslink TXT record is updated.
+	Domain string
+
+	// Provider is the name of the entry in DNSLink.Providers managing the
+	// domain.
+	Provider string
+
+	// Key is the name of the IPNS key whose published value the record
+	// points at.
+	Key string `json:",omitempty"`
+
+	// MFSPath is the MFS path whose current CID the record points at.
+	MFSPath string `json:",omitempty"`
+
+	// TTL of the TXT record.
+	TTL *OptionalDuration `json:",omitempty"`
+}
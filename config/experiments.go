@@ -7,6 +7,8 @@ type Experiments struct {
 	GraphsyncEnabled     bool
 	Libp2pStreamMounting bool
 	P2pHttpProxy         bool
+	P2pHttpProxyTimeout  *OptionalDuration `json:",omitempty"`
 	StrategicProviding   bool
 	AcceleratedDHTClient bool
+	GraphQL              bool
 }
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// DefaultFilesReplicationInterval is how often a writer republishes its MFS
+// root while it does not change.
+const DefaultFilesReplicationInterval = 10 * time.Second
+
+// Files configures the MFS of the node, as used by 'ipfs files'.
+type Files struct {
+	// Replication configures the hot-standby replication of the MFS root.
+	Replication FilesReplication
+}
+
+// FilesReplication configures the hot-standby replication of the MFS root
+// over pubsub.
+type FilesReplication struct {
+	// Publish makes the node publish its MFS root to its standbys.
+	Publish Flag `json:",omitempty"`
+
+	// Follow is the peer ID of the writer node whose MFS root this node
+	// follows and keeps pinned, as its standby.
+	Follow string `json:",omitempty"`
+
+	// Interval is how often the MFS root is republished while it does not
+	// change, for standbys joining late.
+	Interval *OptionalDuration `json:",omitempty"`
+}
+
+// Enabled reports whether the node publishes or follows an MFS root.
+func (r FilesReplication) Enabled() bool {
+	return r.Publish.WithDefault(false) || r.Follow != ""
+}
@@ -1,5 +1,17 @@
 package config
 
+import "time"
+
+const (
+	// DefaultGatewayPurgeMethod is the HTTP method of the purge requests.
+	DefaultGatewayPurgeMethod = "PURGE"
+	// DefaultGatewayPurgeTimeout is the timeout of a purge request.
+	DefaultGatewayPurgeTimeout = 10 * time.Second
+	// DefaultGatewayMaxInlineSize is the largest data of the identity CIDs
+	// served, as large as the blocks 'ipfs add' may inline.
+	DefaultGatewayMaxInlineSize = MaxInlineLimit
+)
+
 type GatewaySpec struct {
 	// Paths is explicit list of path prefixes that should be handled by
 	// this gateway. Example: `["/ipfs", "/ipns", "/api"]`
@@ -18,6 +30,38 @@ type GatewaySpec struct {
 	// NoDNSLink configures this gateway to _not_ resolve DNSLink for the FQDN
 	// provided in `Host` HTTP header.
 	NoDNSLink bool
+
+	// HeaderHTML is a fragment of HTML inserted at the top of the directory
+	// listings and error pages served on this hostname.
+	HeaderHTML string `json:",omitempty"`
+
+	// FooterHTML is a fragment of HTML inserted at the bottom of the
+	// directory listings and error pages served on this hostname.
+	FooterHTML string `json:",omitempty"`
+
+	// Locale is the language of the directory listings and error pages
+	// served on this hostname, as a BCP 47 tag. Example: `de-CH`
+	Locale string `json:",omitempty"`
+
+	// Rewrites map paths of this hostname to content paths, the first rule
+	// matching a path applying. They take priority over Paths and DNSLink.
+	Rewrites []GatewayRewrite `json:",omitempty"`
+
+	// Root is the /ipfs/ or /ipns/ path, or the CID, served at the root of
+	// this hostname, for the paths not in Paths, in the place of DNSLink.
+	// Example: `/ipns/docs.example.com`
+	Root string `json:",omitempty"`
+}
+
+// GatewayRewrite maps a path of a hostname to a content path.
+type GatewayRewrite struct {
+	// From is the path mapped, or the path and the paths below it if it
+	// ends with "/*". Example: `/docs/*`
+	From string
+
+	// To is the /ipfs/ or /ipns/ path From is mapped to, the rest of the
+	// path below From being appended to it. Example: `/ipfs/{cid}/docs`
+	To string
 }
 
 // Gateway contains options for the HTTP gateway server.
@@ -68,4 +112,309 @@ type Gateway struct {
 	// PublicGateways configures behavior of known public gateways.
 	// Each key is a fully qualified domain name (FQDN).
 	PublicGateways map[string]*GatewaySpec
+
+	// AccessControl restricts the clients and the content paths the gateway
+	// serves.
+	AccessControl GatewayAccessControl
+
+	// ContentPolicy configures an external service asked whether a root CID
+	// may be served.
+	ContentPolicy GatewayContentPolicy
+
+	// Purge configures the purge requests sent to the HTTP caches in front of
+	// the gateway when the content they cache changes.
+	Purge GatewayPurge
+
+	// ResponseSignatures configures the signing of responses with the node
+	// key.
+	ResponseSignatures GatewayResponseSignatures
+
+	// SLO configures the service level metrics of the gateway.
+	SLO GatewaySLO
+
+	// HealthProbe configures the probe fetching content from the network
+	// through the gateway.
+	HealthProbe GatewayHealthProbe
+
+	// NameResolution bounds the resolution of the IPNS names and DNSLinks of
+	// the requests.
+	NameResolution GatewayNameResolution
+
+	// RateLimit limits the requests and bandwidth of each client.
+	RateLimit GatewayRateLimit
+
+	// ImageResizing configures the resizing of the images requested with the
+	// img-width and img-format parameters.
+	ImageResizing GatewayImageResizing
+
+	// Cache configures the cache of the resolved paths, directory listings
+	// and detected content types of the immutable content.
+	Cache GatewayCache
+
+	// RenderMarkdown serves the Markdown and source files requested by the
+	// browsers as HTML pages, the Markdown rendered and the sources
+	// highlighted.
+	RenderMarkdown Flag `json:",omitempty"`
+
+	// ProviderHints makes the gateway connect to the providers listed by the
+	// requests in the X-Ipfs-Providers header or the providers parameter
+	// before fetching their content.
+	ProviderHints Flag `json:",omitempty"`
+
+	// Upstream configures the gateways the blocks slow to retrieve are
+	// fetched from.
+	Upstream GatewayUpstream
+
+	// Shadow configures the gateway a sample of the requests is mirrored
+	// to, its responses compared with those served.
+	Shadow GatewayShadow
+
+	// MaxInlineSize is the largest data, in bytes, of the identity CIDs
+	// served, the data being inlined in the CID rather than stored in a
+	// block.
+	MaxInlineSize *OptionalInteger `json:",omitempty"`
+
+	// Canonicalize redirects the URLs of the content equivalent to a
+	// canonical URL to it.
+	Canonicalize GatewayCanonicalize
+}
+
+// GatewayCanonicalize selects the URLs redirected to their canonical form with
+// 301 Moved Permanently, so that the HTTP caches in front of the gateway keep
+// a single entry for equivalent URLs.
+type GatewayCanonicalize struct {
+	// TrailingSlash redirects the directories requested without a trailing
+	// slash, and the files requested with one.
+	TrailingSlash Flag `json:",omitempty"`
+
+	// PercentEncoding redirects the paths not percent-encoded as the gateway
+	// encodes them, such as the paths encoding unreserved characters or
+	// using lowercase hexadecimal digits.
+	PercentEncoding Flag `json:",omitempty"`
+
+	// CIDs redirects the /ipfs/ paths whose root CID is not written as a
+	// CIDv1 in lowercase base32, such as CIDv0 or base58 and uppercase CIDs.
+	// The subdomain gateways always redirect to the canonical CID.
+	CIDs Flag `json:",omitempty"`
+}
+
+// GatewayShadow configures the mirroring of a sample of the gateway requests
+// to another gateway, such as a node running a new version or config, whose
+// responses are compared with those served to the clients, then discarded.
+type GatewayShadow struct {
+	// URL of the gateway the requests are mirrored to, such as
+	// http://127.0.0.1:8081. The mirroring is disabled when empty.
+	URL string `json:",omitempty"`
+
+	// SampleRate is the fraction of the GET and HEAD requests mirrored,
+	// between 0 and 1.
+	SampleRate *OptionalFloat `json:",omitempty"`
+
+	// Timeout bounds a mirrored request.
+	Timeout *OptionalDuration `json:",omitempty"`
+
+	// MaxConcurrentRequests is the number of mirrored requests in flight at
+	// once, the requests sampled past it not being mirrored.
+	MaxConcurrentRequests *OptionalInteger `json:",omitempty"`
+}
+
+// GatewayUpstream configures the upstream gateways the blocks are fetched
+// from, as raw blocks verified against their CID, when they take too long to
+// retrieve from the network.
+type GatewayUpstream struct {
+	// URLs are the upstream gateways, such as https://ipfs.io. The blocks
+	// are only retrieved from the network when empty.
+	URLs []string `json:",omitempty"`
+
+	// LatencyBudget is how long a block is retrieved from the network before
+	// it is fetched from the upstream gateways too.
+	LatencyBudget *OptionalDuration `json:",omitempty"`
+
+	// Timeout bounds the fetch of a block from the upstream gateways.
+	Timeout *OptionalDuration `json:",omitempty"`
+}
+
+// GatewayCache configures the cache of the work done by the gateway for the
+// /ipfs/ paths, which never needs to be done again for the same path.
+type GatewayCache struct {
+	// Enabled makes the gateway keep the paths it resolved, the directory
+	// listings it rendered and the content types it detected.
+	Enabled Flag `json:",omitempty"`
+
+	// MaxSize is the size of the entries kept in memory, such as "32MB".
+	MaxSize *OptionalString `json:",omitempty"`
+
+	// TTL is how long an entry is kept.
+	TTL *OptionalDuration `json:",omitempty"`
+
+	// Path is the directory the entries are also kept in, so that they
+	// outlive the daemon, relative to the repo if not absolute. Unset means
+	// the entries are kept in memory only.
+	Path *OptionalString `json:",omitempty"`
+
+	// MaxDiskSize is the size of the entries kept in Path, such as "1GB".
+	MaxDiskSize *OptionalString `json:",omitempty"`
+}
+
+// GatewayImageResizing configures the images resized and transcoded by the
+// gateway for the requests asking for them.
+type GatewayImageResizing struct {
+	// Enabled makes the gateway resize the images requested with the
+	// img-width and img-format parameters. The parameters are ignored
+	// otherwise.
+	Enabled Flag `json:",omitempty"`
+
+	// Workers is the number of images resized at once.
+	Workers *OptionalInteger `json:",omitempty"`
+
+	// CacheSize is the size of the resized images kept, such as "64MB".
+	CacheSize *OptionalString `json:",omitempty"`
+}
+
+// GatewayRateLimit limits the requests of each client of the gateway, by
+// remote IP address or subnet.
+type GatewayRateLimit struct {
+	// RequestsPerSecond is the number of requests a client can start per
+	// second. Unset means no limit.
+	RequestsPerSecond *OptionalInteger `json:",omitempty"`
+
+	// MaxConcurrentRequests is the number of requests of a client served at
+	// once. Unset means no limit.
+	MaxConcurrentRequests *OptionalInteger `json:",omitempty"`
+
+	// MaxQueuedRequests is the number of requests of a client waiting to be
+	// served once MaxConcurrentRequests are. Unset means none: the requests
+	// over MaxConcurrentRequests are rejected.
+	MaxQueuedRequests *OptionalInteger `json:",omitempty"`
+
+	// TokenMaxConcurrentRequests is the MaxConcurrentRequests of each of the
+	// Gateway.AccessControl.Tokens, a token being a client whatever the
+	// addresses of its requests. Unset means MaxConcurrentRequests.
+	TokenMaxConcurrentRequests *OptionalInteger `json:",omitempty"`
+
+	// BytesPerSecond is the size of the responses sent to a client per
+	// second, such as "1MB". Unset means no limit.
+	BytesPerSecond *OptionalString `json:",omitempty"`
+
+	// IPv4PrefixLength and IPv6PrefixLength are the lengths of the subnets
+	// whose addresses are limited as one client.
+	IPv4PrefixLength *OptionalInteger `json:",omitempty"`
+	IPv6PrefixLength *OptionalInteger `json:",omitempty"`
+}
+
+// GatewayNameResolution bounds the resolution of chains of IPNS names and
+// DNSLinks by the gateway.
+type GatewayNameResolution struct {
+	// MaxDepth is the number of names resolved for a request before giving
+	// up.
+	MaxDepth *OptionalInteger `json:",omitempty"`
+	// StepTimeout bounds the time spent resolving each name.
+	StepTimeout *OptionalDuration `json:",omitempty"`
+}
+
+// GatewaySLO configures the service level metrics of the gateway.
+type GatewaySLO struct {
+	// ApdexThreshold is the time to first byte within which a response
+	// satisfies the client. Responses within four times the threshold are
+	// tolerated, slower ones frustrate.
+	ApdexThreshold *OptionalDuration `json:",omitempty"`
+}
+
+// GatewayHealthProbe configures the probe periodically fetching a content
+// path from the network through the gateway, whose result is served for the
+// load balancers.
+type GatewayHealthProbe struct {
+	// Path is the content path fetched, such as /ipfs/<cid> of a small
+	// file. The probe is disabled when empty.
+	Path string `json:",omitempty"`
+
+	// Interval is the time between the start of two probes.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// Timeout bounds the time of a probe.
+	Timeout *OptionalDuration `json:",omitempty"`
+}
+
+// GatewayResponseSignatures configures HTTP Message Signatures on gateway
+// responses.
+type GatewayResponseSignatures struct {
+	// Enabled makes the gateway sign its responses.
+	Enabled Flag `json:",omitempty"`
+
+	// MaxBodySize is the size in bytes of the largest response body that
+	// gets signed. Larger responses are sent unsigned.
+	MaxBodySize *OptionalInteger `json:",omitempty"`
+}
+
+// GatewayAccessControlConcealSelector selects the tokens of the gateway,
+// which are never shown or changed through the API.
+var GatewayAccessControlConcealSelector = []string{"Gateway", "AccessControl", "Tokens"}
+
+// GatewayAccessControl restricts the requests served by the gateway, before
+// resolving their path.
+type GatewayAccessControl struct {
+	// Tokens, when set, restricts the gateway to the requests carrying one
+	// of these bearer tokens in their Authorization header.
+	Tokens []string `json:",omitempty"`
+
+	// Allow, when set, restricts the gateway to these content paths and the
+	// paths below them, given as CIDs or as path prefixes. Example:
+	// `["bafy...", "/ipfs/bafy.../docs", "/ipns/example.org"]`
+	Allow []string `json:",omitempty"`
+
+	// Deny are content paths, given as Allow, the gateway refuses to serve,
+	// taking priority over Allow. The CIDs are denied whatever the path
+	// they are reached through.
+	Deny []string `json:",omitempty"`
+
+	// DenyFiles are files listing content paths denied, one per line, read
+	// again when they change.
+	DenyFiles []string `json:",omitempty"`
+}
+
+// GatewayPurgeConcealSelector selects the headers of the purge requests,
+// which carry the credentials of the caches.
+var GatewayPurgeConcealSelector = []string{"Gateway", "Purge", "Headers"}
+
+// GatewayPurge configures the purge requests sent to the HTTP caches in front
+// of the gateway, such as CDNs, when the IPNS names published by the node or
+// the sites published from its MFS change.
+type GatewayPurge struct {
+	// URLs are the templates of the URLs requested to purge a content path,
+	// where {path} is the content path, {name} its CID or IPNS name, and
+	// {subpath} the rest of it. Example:
+	// `["https://cdn.example.net/purge?url=https://gw.example.org{path}"]`
+	// The purge requests are disabled when empty.
+	URLs []string `json:",omitempty"`
+
+	// Method is the HTTP method of the purge requests.
+	Method *OptionalString `json:",omitempty"`
+
+	// Headers are the HTTP headers of the purge requests, as the credentials
+	// of the cache API.
+	Headers map[string]string `json:",omitempty"`
+
+	// Timeout of a purge request.
+	Timeout *OptionalDuration `json:",omitempty"`
+
+	// Sites are the content paths the MFS directories are published at, by
+	// MFS directory. Example: `{"/sites/blog": "/ipns/blog.example.org"}`
+	Sites map[string]string `json:",omitempty"`
+}
+
+// GatewayContentPolicy configures the HTTP endpoint the gateway consults
+// before serving a root CID.
+type GatewayContentPolicy struct {
+	// URL of the policy endpoint. The callout is disabled when empty.
+	URL string `json:",omitempty"`
+
+	// Timeout of a request to the policy endpoint.
+	Timeout *OptionalDuration `json:",omitempty"`
+
+	// CacheTTL is how long a decision is remembered.
+	CacheTTL *OptionalDuration `json:",omitempty"`
+
+	// FailOpen serves content when the policy endpoint can't be reached,
+	// instead of refusing to serve it.
+	FailOpen Flag `json:",omitempty"`
 }
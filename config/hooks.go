@@ -0,0 +1,46 @@
+package config
+
+import "time"
+
+// DefaultHookTimeout is the timeout of a hook when Hooks.Timeout is not set.
+const DefaultHookTimeout = 30 * time.Second
+
+// HooksConcealSelector selects the hooks, which run commands and carry the
+// credentials of the webhooks: they are never shown or changed through the
+// API, only in the config file.
+var HooksConcealSelector = []string{"Hooks"}
+
+// Hooks configures the commands run and the webhooks requested when the node
+// publishes an IPNS name or its MFS changes.
+type Hooks struct {
+	// OnPublish are run when an IPNS name is published with a new value.
+	OnPublish []Hook `json:",omitempty"`
+
+	// OnFilesChange are run when the MFS changes.
+	OnFilesChange []Hook `json:",omitempty"`
+
+	// Timeout is the timeout of a command or webhook request.
+	Timeout *OptionalDuration `json:",omitempty"`
+}
+
+// Hook is a command or a webhook. Exactly one of Exec and URL must be set.
+type Hook struct {
+	// Exec is the command run, and its arguments. The event is given as
+	// JSON on its standard input, and in IPFS_HOOK_* environment variables.
+	Exec []string `json:",omitempty"`
+
+	// URL is the URL the event is POSTed to, as JSON.
+	URL string `json:",omitempty"`
+
+	// Headers are the HTTP headers of the webhook requests, such as their
+	// credentials.
+	Headers map[string]string `json:",omitempty"`
+
+	// Key restricts the OnPublish hook to the name of this key, given by
+	// name or ID.
+	Key string `json:",omitempty"`
+
+	// Path restricts the OnFilesChange hook to the changes under this MFS
+	// path, the event carrying its CID instead of that of the MFS root.
+	Path string `json:",omitempty"`
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultImportChunker is the chunker used by 'ipfs add' when neither it nor
+// the config is given one.
+const DefaultImportChunker = "size-262144"
+
+const (
+	// DefaultInlineLimit is the size up to which blocks are inlined into
+	// their CID when no limit is given.
+	DefaultInlineLimit = 32
+	// MaxInlineLimit is the largest inline limit allowed, as identity CIDs
+	// are as long as the blocks they inline.
+	MaxInlineLimit = 128
+)
+
+// DefaultImportScanTimeout is how long the scanner of the files added may take
+// to read their data, and to give its verdict.
+const DefaultImportScanTimeout = 30 * time.Second
+
+// DefaultImportWorkers is how many files 'ipfs add' chunks and hashes at once
+// when neither it nor the config is given a number of workers.
+const DefaultImportWorkers = 1
+
+// Import configures how 'ipfs add' imports data.
+type Import struct {
+	// Chunker is the chunker used when 'ipfs add' is not given one, such as
+	// "size-262144", "buzhash" or "auto" to pick one for each file.
+	Chunker *OptionalString `json:",omitempty"`
+
+	// Inline inlines the blocks of up to InlineLimit bytes into identity
+	// CIDs when 'ipfs add' and 'ipfs files write' are not told otherwise.
+	Inline Flag `json:",omitempty"`
+	// InlineLimit is the size up to which blocks are inlined.
+	InlineLimit *OptionalInteger `json:",omitempty"`
+
+	// Workers is how many files 'ipfs add' chunks and hashes at once when
+	// not given --workers, 1 by default. 0 uses a worker per CPU.
+	Workers *OptionalInteger `json:",omitempty"`
+
+	// HashFunctions are the multihash functions accepted in the CIDs of the
+	// blocks beyond the ones deemed secure, such as "blake3", by name or
+	// hexadecimal code.
+	HashFunctions []string `json:",omitempty"`
+
+	// Scanner configures the scanner the files added are sent to, which can
+	// reject them.
+	Scanner ImportScanner
+}
+
+// ImportScannerConcealSelector selects the headers of the requests to the
+// scanner, which carry its credentials.
+var ImportScannerConcealSelector = []string{"Import", "Scanner", "Headers"}
+
+// ImportScanner configures the scanner, such as an antivirus, the files added
+// with 'ipfs add' and to the writable gateway are streamed to.
+type ImportScanner struct {
+	// URL is the URL of the scanner: an http or https URL the files are
+	// posted to, or the icap URL of an ICAP service. Example:
+	// `icap://127.0.0.1:1344/avscan`. The files are not scanned when empty.
+	URL string `json:",omitempty"`
+
+	// Headers are sent with the requests to the scanner.
+	Headers map[string]string `json:",omitempty"`
+
+	// Timeout is how long the scanner may take to read the data sent to it,
+	// and to give its verdict once it has all the data of a file.
+	Timeout *OptionalDuration `json:",omitempty"`
+
+	// FailOpen accepts the files the scanner fails to scan, which fail the
+	// add otherwise.
+	FailOpen Flag `json:",omitempty"`
+}
+
+// CheckInlineLimit returns an error if limit is not between 1 and
+// MaxInlineLimit bytes.
+func CheckInlineLimit(limit int64) error {
+	if limit < 1 || limit > MaxInlineLimit {
+		return fmt.Errorf("inline limit must be between 1 and %d bytes, got %d", MaxInlineLimit, limit)
+	}
+	return nil
+}
@@ -12,4 +12,8 @@ type InternalBitswap struct {
 	EngineBlockstoreWorkerCount OptionalInteger
 	EngineTaskWorkerCount       OptionalInteger
 	MaxOutstandingBytesPerPeer  OptionalInteger
+	ProviderSearchDelay         OptionalDuration
+	RebroadcastDelay            OptionalDuration
+	SessionMaxProviders         OptionalInteger
+	ProviderStats               Flag `json:",omitempty"`
 }
@@ -1,5 +1,15 @@
 package config
 
+import "time"
+
+// DefaultIpnsRemoteSignTimeout is how long a remote signer may take to sign a
+// record when its key is not given a timeout.
+const DefaultIpnsRemoteSignTimeout = 10 * time.Second
+
+// IpnsRemoteKeysConcealSelector selects the headers of the requests to the
+// remote signers, which carry their credentials.
+var IpnsRemoteKeysConcealSelector = []string{"Ipns", "RemoteKeys", "*", "Headers"}
+
 type Ipns struct {
 	RepublishPeriod string
 	RecordLifetime  string
@@ -8,4 +18,31 @@ type Ipns struct {
 
 	// Enable namesys pubsub (--enable-namesys-pubsub)
 	UsePubsub Flag `json:",omitempty"`
+
+	// Tuning of namesys pubsub, only used when it is enabled
+	PubsubRebroadcastInterval     *OptionalDuration `json:",omitempty"`
+	PubsubRebroadcastInitialDelay *OptionalDuration `json:",omitempty"`
+	PubsubMaxNames                *OptionalInteger  `json:",omitempty"`
+
+	// RemoteKeys are the keys whose records are signed by a remote signer,
+	// such as a KMS or an HSM, by name. They are listed and used as the keys
+	// of the keystore, which does not hold their private keys.
+	RemoteKeys map[string]IpnsRemoteKey `json:",omitempty"`
+}
+
+// IpnsRemoteKey configures a key signed by a remote signer.
+type IpnsRemoteKey struct {
+	// PublicKey is the public key of the key: its peer ID when it embeds the
+	// public key, as the ones of ed25519 keys do, or the base64 encoded
+	// public key protobuf.
+	PublicKey string
+
+	// URL is the http or https URL the data to sign is posted to.
+	URL string
+
+	// Headers are sent with the requests to the signer.
+	Headers map[string]string `json:",omitempty"`
+
+	// Timeout is how long the signer may take to sign a record.
+	Timeout *OptionalDuration `json:",omitempty"`
 }
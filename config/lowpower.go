@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+const (
+	// DefaultLowPowerAwake is how long the node is awake in each duty cycle
+	// of the low-power mode.
+	DefaultLowPowerAwake = time.Minute
+	// DefaultLowPowerSleep is how long the node sleeps in each duty cycle of
+	// the low-power mode.
+	DefaultLowPowerSleep = 9 * time.Minute
+	// DefaultLowPowerIntervalMultiplier is how much the low-power mode
+	// lengthens the reprovide and republish intervals.
+	DefaultLowPowerIntervalMultiplier = 2
+)
+
+// LowPower configures the low-power mode of the daemon, which can also be
+// switched on and off at runtime with 'ipfs lowpower'.
+type LowPower struct {
+	// Enabled enables the low-power mode when the daemon starts. It also
+	// makes the default DHT routing run in client mode.
+	Enabled Flag `json:",omitempty"`
+
+	// Awake is how long the node is awake in each duty cycle.
+	Awake *OptionalDuration `json:",omitempty"`
+
+	// Sleep is how long the node sleeps in each duty cycle.
+	Sleep *OptionalDuration `json:",omitempty"`
+
+	// IntervalMultiplier lengthens the reprovide and IPNS republish
+	// intervals.
+	IntervalMultiplier *OptionalInteger `json:",omitempty"`
+}
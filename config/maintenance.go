@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// DefaultMaintenanceWindowDuration is how long a maintenance window lasts.
+const DefaultMaintenanceWindowDuration = time.Hour
+
+// Maintenance configures the maintenance windows, when the heavy background
+// work of the daemon is allowed to run, so that it lands in off-peak hours.
+type Maintenance struct {
+	// Windows are the maintenance windows. Without windows, the background
+	// work runs any time.
+	Windows []MaintenanceWindow `json:",omitempty"`
+
+	// Tasks are the background work held to the windows: "gc", "reprovide",
+	// "scrub" and "migrate", all of them by default.
+	Tasks []string `json:",omitempty"`
+
+	// TimeZone is the IANA name of the time zone of the schedules, such as
+	// "UTC" or "Europe/Paris", the local time zone by default.
+	TimeZone *OptionalString `json:",omitempty"`
+}
+
+// MaintenanceWindow is a maintenance window, opening on a schedule.
+type MaintenanceWindow struct {
+	// Schedule is when the window opens, as a cron expression: minute, hour,
+	// day of the month, month and day of the week, such as "0 2 * * *" for
+	// every day at 2:00.
+	Schedule string
+
+	// Duration is how long the window stays open.
+	Duration *OptionalDuration `json:",omitempty"`
+}
@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+const (
+	// DefaultMemoryBudgetInterval is how often the memory usage is sampled.
+	DefaultMemoryBudgetInterval = time.Second
+	// DefaultMemoryBudgetMaxWait is how long requests are held back while
+	// the node is under memory pressure, before being declined.
+	DefaultMemoryBudgetMaxWait = 10 * time.Second
+)
+
+// MemoryBudget configures the memory budget of the node, which sheds load
+// when the memory usage gets close to the limit.
+type MemoryBudget struct {
+	// Limit is the budget, such as "2GB". Unset means no budget.
+	Limit *OptionalString `json:",omitempty"`
+
+	// Interval is how often the memory usage is sampled.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// MaxWait is how long API and gateway requests are held back while the
+	// node is under pressure, before being declined.
+	MaxWait *OptionalDuration `json:",omitempty"`
+}
@@ -0,0 +1,21 @@
+package config
+
+// PinExpiry configures the classes that pins can be added with, and after
+// which they are removed automatically.
+type PinExpiry struct {
+	// Classes maps the name of an expiry class to its limits.
+	Classes map[string]PinExpiryClass `json:",omitempty"`
+
+	// Interval is how often the expired pins are removed.
+	Interval *OptionalDuration `json:",omitempty"`
+}
+
+// PinExpiryClass sets when the pins of an expiry class expire. A pin expires
+// once either limit is exceeded; unset limits never expire.
+type PinExpiryClass struct {
+	// MaxAge is how long the pins are kept after being added.
+	MaxAge *OptionalDuration `json:",omitempty"`
+
+	// MaxIdle is how long the pins are kept after their root was last read.
+	MaxIdle *OptionalDuration `json:",omitempty"`
+}
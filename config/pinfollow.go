@@ -0,0 +1,26 @@
+package config
+
+import "time"
+
+// DefaultPinFollowInterval is how often the pinset followed is synced when
+// Pinning.Follow.Interval is not set.
+const DefaultPinFollowInterval = 5 * time.Minute
+
+// PinFollowConcealSelector selects the secret sent to the RPC API of the
+// node followed, which is never shown or changed through the API.
+var PinFollowConcealSelector = []string{"Pinning", "Follow", "AuthSecret"}
+
+// PinFollow configures the mirroring of the pinset of another node, making
+// this node a read replica of it.
+type PinFollow struct {
+	// Source is where the pinset is exported: either an /ipns/ name
+	// resolving to the list of the CIDs pinned, one per line, or the URL of
+	// the RPC API of the node.
+	Source string `json:",omitempty"`
+
+	// AuthSecret is sent as bearer token to the RPC API of Source, if set.
+	AuthSecret string `json:",omitempty"`
+
+	// Interval is how often the pinset is synced.
+	Interval *OptionalDuration `json:",omitempty"`
+}
@@ -184,6 +184,24 @@ fetching may be degraded.
 			return nil
 		},
 	},
+	"lowpower-v2": {
+		Description: `Runs the daemon in low-power mode, for battery or solar
+powered devices: network activity is limited to awake periods of a
+duty cycle, provides are batched, reprovides and IPNS republishes are
+spaced out, and the DHT runs in client mode. The low-power mode can
+be switched off at runtime with 'ipfs lowpower disable', the DHT
+staying in client mode until the daemon restarts.
+`,
+		Transform: func(c *Config) error {
+			c.LowPower.Enabled = True
+			c.AutoNAT.ServiceMode = AutoNATServiceDisabled
+
+			c.Swarm.ConnMgr.LowWater = 20
+			c.Swarm.ConnMgr.HighWater = 40
+			c.Swarm.ConnMgr.GracePeriod = time.Minute.String()
+			return nil
+		},
+	},
 	"randomports": {
 		Description: `Use a random port number for swarm.`,
 
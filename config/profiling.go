@@ -0,0 +1,41 @@
+package config
+
+import "time"
+
+const (
+	// DefaultProfilingInterval is the interval between the snapshots of the
+	// profiles.
+	DefaultProfilingInterval = time.Hour
+	// DefaultProfilingCPUDuration is how long the CPU is profiled in each
+	// snapshot.
+	DefaultProfilingCPUDuration = 10 * time.Second
+	// DefaultProfilingMaxSnapshots is the number of snapshots kept, two days
+	// at the default interval.
+	DefaultProfilingMaxSnapshots = 48
+	// DefaultProfilingPath is the directory of the snapshots, relative to
+	// the repo.
+	DefaultProfilingPath = "profiles"
+)
+
+// Profiling configures the snapshots of the CPU, heap and goroutine profiles
+// the daemon takes on a schedule, to diagnose the memory growth and the leaks
+// which only show after days of uptime.
+type Profiling struct {
+	// Enabled makes the daemon take the snapshots.
+	Enabled Flag `json:",omitempty"`
+
+	// Interval is the interval between the snapshots.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// CPUDuration is how long the CPU is profiled in each snapshot, zero
+	// disabling the CPU profiles.
+	CPUDuration *OptionalDuration `json:",omitempty"`
+
+	// MaxSnapshots is the number of snapshots kept, the oldest being
+	// removed.
+	MaxSnapshots *OptionalInteger `json:",omitempty"`
+
+	// Path is the directory of the snapshots, relative to the repo unless
+	// absolute.
+	Path *OptionalString `json:",omitempty"`
+}
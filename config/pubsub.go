@@ -11,4 +11,20 @@ type PubsubConfig struct {
 
 	// Enable pubsub (--enable-pubsub-experiment)
 	Enabled Flag `json:",omitempty"`
+
+	// History keeps the recent messages of topics, for the subscribers to
+	// get them replayed.
+	History PubsubHistory
+}
+
+// PubsubHistory configures the topics whose recent messages are kept.
+type PubsubHistory struct {
+	// Topics are the topics whose messages are kept, from the node start.
+	Topics []string `json:",omitempty"`
+
+	// Size is the number of messages kept per topic.
+	Size *OptionalInteger `json:",omitempty"`
+
+	// TTL is how long a message is kept.
+	TTL *OptionalDuration `json:",omitempty"`
 }
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 var (
 	RemoteServicesPath     = "Pinning.RemoteServices"
 	PinningConcealSelector = []string{"Pinning", "RemoteServices", "*", "API", "Key"}
@@ -7,6 +9,16 @@ var (
 
 type Pinning struct {
 	RemoteServices map[string]RemotePinningService
+
+	// Expiry configures the removal of the pins added with an expiry class.
+	Expiry PinExpiry
+
+	// Follow configures the mirroring of the pinset of another node.
+	Follow PinFollow
+
+	// LazyLoad loads the pinset in the background, the node serving
+	// meanwhile. Defaults to true.
+	LazyLoad Flag `json:",omitempty"`
 }
 
 type RemotePinningService struct {
@@ -20,7 +32,8 @@ type RemotePinningServiceAPI struct {
 }
 
 type RemotePinningServicePolicies struct {
-	MFS RemotePinningServiceMFSPolicy
+	MFS  RemotePinningServiceMFSPolicy
+	Sync RemotePinningServiceSyncPolicy
 }
 
 type RemotePinningServiceMFSPolicy struct {
@@ -31,3 +44,30 @@ type RemotePinningServiceMFSPolicy struct {
 	// RepinInterval determines the repin interval when the policy is enabled. In ns, us, ms, s, m, h.
 	RepinInterval string
 }
+
+// DefaultRemotePinSyncInterval is how often the pins are mirrored to a remote
+// service when Policies.Sync.Interval is not set.
+const DefaultRemotePinSyncInterval = 5 * time.Minute
+
+// DefaultRemotePinSyncMaxBackoff is the longest wait before retrying a pin
+// which failed when Policies.Sync.MaxBackoff is not set.
+const DefaultRemotePinSyncMaxBackoff = time.Hour
+
+// RemotePinningServiceSyncPolicy configures the mirroring of the recursive
+// pins of the node to the remote service.
+type RemotePinningServiceSyncPolicy struct {
+	// Enable mirrors the recursive pins to the service: the pins added are
+	// pinned remotely, and the pins removed are removed remotely.
+	Enable bool
+	// Label, given as key=value, restricts the pins mirrored to those with
+	// this label. All the recursive pins are mirrored if it is empty.
+	Label string `json:",omitempty"`
+	// PinName is the name of the remote pins, by which the mirrored pins are
+	// told from the others.
+	PinName string `json:",omitempty"`
+	// Interval is how often the pins are mirrored.
+	Interval *OptionalDuration `json:",omitempty"`
+	// MaxBackoff is the longest wait before retrying a pin which failed, the
+	// wait doubling with every failure.
+	MaxBackoff *OptionalDuration `json:",omitempty"`
+}
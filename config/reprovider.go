@@ -1,6 +1,35 @@
 package config
 
+import "time"
+
+// DefaultProviderRecordValidity is how long the peers of the public DHT keep
+// a provider record, which must be reprovided sooner.
+const DefaultProviderRecordValidity = 24 * time.Hour
+
 type Reprovider struct {
 	Interval string // Time period to reprovide locally stored objects to the network
 	Strategy string // Which keys to announce
+	Spread   Flag   `json:",omitempty"` // Spread the reprovides over the interval
+
+	// RecordValidity is how long the node keeps the provider records it
+	// stores for the other peers of the DHT, and how long its own records
+	// are assumed to be kept by the peers. Interval must be shorter.
+	RecordValidity *OptionalDuration `json:",omitempty"`
+
+	// Demand tunes the tracking of the keys requested by the peers, for the
+	// "demand" strategy.
+	Demand ReproviderDemand
+}
+
+// ReproviderDemand configures when the keys requested by the peers are in
+// demand, and hot.
+type ReproviderDemand struct {
+	// Window is how long a key is in demand after it was requested.
+	Window *OptionalDuration `json:",omitempty"`
+
+	// HotRequests is the number of requests in a window making a key hot.
+	HotRequests *OptionalInteger `json:",omitempty"`
+
+	// HotInterval is the interval at which the hot keys are reprovided.
+	HotInterval *OptionalDuration `json:",omitempty"`
 }
@@ -0,0 +1,36 @@
+package config
+
+import "time"
+
+const (
+	// DefaultResourceBudgetInterval is how often the file descriptors,
+	// goroutines and sockets of the node are counted.
+	DefaultResourceBudgetInterval = 10 * time.Second
+	// DefaultResourceBudgetFileDescriptors is the soft limit of the file
+	// descriptors, as a fraction of the limit of the OS.
+	DefaultResourceBudgetFileDescriptors = 0.9
+)
+
+// ResourceBudget configures the soft limits of the file descriptors,
+// goroutines and sockets of the node, which are exported as metrics. Going
+// over a soft limit logs a warning, and can shed connections, before the hard
+// limits of the OS are hit.
+type ResourceBudget struct {
+	// Interval is how often the resources are counted.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// FileDescriptors is the soft limit of the open file descriptors, as a
+	// fraction of the limit of the OS, between 0 and 1.
+	FileDescriptors *OptionalFloat `json:",omitempty"`
+
+	// Goroutines is the soft limit of the goroutines. Unset means no limit.
+	Goroutines *OptionalInteger `json:",omitempty"`
+
+	// Sockets is the soft limit of the open TCP and UDP sockets. Unset means
+	// no limit.
+	Sockets *OptionalInteger `json:",omitempty"`
+
+	// ShedConnections trims the connections to the peers, down to the low
+	// water of the connection manager, while over a soft limit.
+	ShedConnections Flag `json:",omitempty"`
+}
@@ -1,9 +1,55 @@
 package config
 
+import "time"
+
 // Routing defines configuration options for libp2p routing
 type Routing struct {
 	// Type sets default daemon routing mode.
 	//
 	// Can be one of "dht", "dhtclient", "dhtserver", "none", or unset.
 	Type string
+
+	// WANMode overrides the mode the DHT Type sets for the public DHT.
+	//
+	// Can be one of "auto", "client", "server", or unset.
+	WANMode *OptionalString `json:",omitempty"`
+
+	// LANMode overrides the mode the DHT Type sets for the LAN DHT.
+	//
+	// Can be one of "auto", "client", "server", or unset.
+	LANMode *OptionalString `json:",omitempty"`
+
+	// Indexers announces the provider records to HTTP indexers too.
+	Indexers RoutingIndexers
+
+	// PublishQueue queues the IPNS records and the provides that cannot be
+	// published while the node is unreachable, and publishes them once it is
+	// reachable again.
+	PublishQueue Flag `json:",omitempty"`
+}
+
+// DefaultIndexerBatchSize, DefaultIndexerBatchInterval and
+// DefaultIndexerAdvisoryTTL apply when the fields of Routing.Indexers are not
+// set.
+const (
+	DefaultIndexerBatchSize     = 1000
+	DefaultIndexerBatchInterval = 10 * time.Second
+	DefaultIndexerAdvisoryTTL   = 24 * time.Hour
+)
+
+// RoutingIndexers configures the announcements of the provider records to
+// HTTP indexers, in addition to the routing system.
+type RoutingIndexers struct {
+	// Endpoints are the base URLs of the delegated routing HTTP APIs of the
+	// indexers.
+	Endpoints []string `json:",omitempty"`
+
+	// BatchSize is the largest number of keys announced in one request.
+	BatchSize *OptionalInteger `json:",omitempty"`
+
+	// BatchInterval is how long provides are batched before being announced.
+	BatchInterval *OptionalDuration `json:",omitempty"`
+
+	// AdvisoryTTL is how long the indexers should keep the records.
+	AdvisoryTTL *OptionalDuration `json:",omitempty"`
 }
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type SwarmConfig struct {
 	// AddrFilters specifies a set libp2p addresses that we should never
 	// dial or receive connections from.
@@ -52,6 +54,72 @@ type SwarmConfig struct {
 
 	// ResourceMgr configures the libp2p Network Resource Manager
 	ResourceMgr ResourceMgr
+
+	// BandwidthHistory configures the history of the bandwidth metrics.
+	BandwidthHistory BandwidthHistory
+
+	// Identify configures what the node tells its peers about itself.
+	Identify Identify
+
+	// SpeedTest configures the speed test the node serves to its peers.
+	SpeedTest SpeedTest
+}
+
+const (
+	// DefaultSpeedTestMaxDuration caps the duration of the transfers of the
+	// speed tests served.
+	DefaultSpeedTestMaxDuration = 30 * time.Second
+	// DefaultSpeedTestMaxStreams is the number of streams tested at once.
+	DefaultSpeedTestMaxStreams = 8
+)
+
+// SpeedTest configures the speed test served to the peers running
+// 'ipfs diag speedtest' with the node.
+type SpeedTest struct {
+	// Enabled makes the node serve the speed test.
+	Enabled Flag `json:",omitempty"`
+
+	// MaxDuration caps the duration of the download and upload tests.
+	MaxDuration *OptionalDuration `json:",omitempty"`
+
+	// MaxStreams is the number of streams tested at once, all peers
+	// included.
+	MaxStreams *OptionalInteger `json:",omitempty"`
+}
+
+// Identify configures what the node tells its peers about itself with the
+// identify protocol.
+type Identify struct {
+	// AgentVersion replaces the agent version sent, go-ipfs/<version>/<commit>
+	// by default, such as with "go-ipfs" to leave the version out. It is also
+	// the one shown by 'ipfs id' and the /version endpoint.
+	AgentVersion *OptionalString `json:",omitempty"`
+}
+
+const (
+	// DefaultBandwidthHistoryInterval is the interval between the samples of
+	// the bandwidth history
+	DefaultBandwidthHistoryInterval = 10 * time.Second
+	// DefaultBandwidthHistoryRetention is how long the samples are kept
+	DefaultBandwidthHistoryRetention = time.Hour
+	// DefaultBandwidthHistoryMaxPeers is the number of peers kept in each
+	// sample
+	DefaultBandwidthHistoryMaxPeers = 20
+)
+
+// BandwidthHistory configures the history of the bandwidth used by the node,
+// in total and by protocol and peer, shown by 'ipfs stats bw history'. It is
+// only recorded when the bandwidth metrics are enabled.
+type BandwidthHistory struct {
+	// Interval is the interval between the samples.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// Retention is how long the samples are kept.
+	Retention *OptionalDuration `json:",omitempty"`
+
+	// MaxPeers is the number of peers with the most traffic kept in each
+	// sample.
+	MaxPeers *OptionalInteger `json:",omitempty"`
 }
 
 type RelayClient struct {
@@ -131,6 +199,33 @@ type ConnMgr struct {
 	LowWater    int
 	HighWater   int
 	GracePeriod string
+
+	// Tags are the policies of the peers with a tag, by tag.
+	Tags map[string]ConnMgrTag `json:",omitempty"`
+
+	// Peers are the tags of peers and their weight, by peer ID. The peers
+	// with the lowest weights are pruned first.
+	Peers map[string]map[string]int `json:",omitempty"`
+}
+
+// ConnMgrTagScopePrefix is the prefix of the scopes of 'ipfs swarm limit'
+// that are tag policies.
+const ConnMgrTagScopePrefix = "tag:"
+
+// ConnMgrTag is the policy of the peers with a tag.
+type ConnMgrTag struct {
+	// Protected keeps the connections to the peers with the tag from being
+	// pruned by the connection manager.
+	Protected bool `json:",omitempty"`
+
+	// MaxConns is the number of connections to the peers with the tag,
+	// beyond which their new connections are closed. Unset means no limit.
+	MaxConns *OptionalInteger `json:",omitempty"`
+
+	// MaxBandwidth is the bandwidth of the peers with the tag, such as
+	// "1MB" per second, beyond which the peers with the lowest weights are
+	// disconnected. Unset means no limit.
+	MaxBandwidth *OptionalString `json:",omitempty"`
 }
 
 // ResourceMgr defines configuration options for the libp2p Network Resource Manager
@@ -0,0 +1,22 @@
+package config
+
+// Tracing configures the OpenTelemetry tracing of the daemon. It is applied
+// when the daemon starts, and again when it is changed with 'ipfs config'
+// while the daemon runs. The IPFS_TRACING environment variables take
+// precedence over it.
+type Tracing struct {
+	// Exporter is where the spans are exported: "otlp-grpc", "otlp-http",
+	// "jaeger" or "stdout". Tracing is disabled when it is empty.
+	Exporter *OptionalString `json:",omitempty"`
+
+	// Endpoint is the URL of the collector of the OTLP and Jaeger
+	// exporters, which otherwise use their environment variables.
+	Endpoint *OptionalString `json:",omitempty"`
+
+	// SampleRatio is the ratio of the traces sampled, between 0 and 1.
+	SampleRatio *OptionalFloat `json:",omitempty"`
+
+	// Subsystems enables or disables the spans of each subsystem: "gateway",
+	// "bitswap", "dht" and "pinner". They are all enabled by default.
+	Subsystems map[string]Flag `json:",omitempty"`
+}
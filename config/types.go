@@ -314,6 +314,58 @@ func (p OptionalInteger) String() string {
 var _ json.Unmarshaler = (*OptionalInteger)(nil)
 var _ json.Marshaler = (*OptionalInteger)(nil)
 
+// OptionalFloat represents a floating point number that has a default value
+//
+// When encoded in json, Default is encoded as "null"
+type OptionalFloat struct {
+	value *float64
+}
+
+// WithDefault resolves the number with the given default.
+func (p *OptionalFloat) WithDefault(defaultValue float64) (value float64) {
+	if p == nil || p.value == nil {
+		return defaultValue
+	}
+	return *p.value
+}
+
+// IsDefault returns if this is a default optional number
+func (p *OptionalFloat) IsDefault() bool {
+	return p == nil || p.value == nil
+}
+
+func (p OptionalFloat) MarshalJSON() ([]byte, error) {
+	if p.value != nil {
+		return json.Marshal(p.value)
+	}
+	return json.Marshal(nil)
+}
+
+func (p *OptionalFloat) UnmarshalJSON(input []byte) error {
+	switch string(input) {
+	case "null", "undefined":
+		*p = OptionalFloat{}
+	default:
+		var value float64
+		err := json.Unmarshal(input, &value)
+		if err != nil {
+			return err
+		}
+		*p = OptionalFloat{value: &value}
+	}
+	return nil
+}
+
+func (p OptionalFloat) String() string {
+	if p.value == nil {
+		return "default"
+	}
+	return fmt.Sprintf("%g", *p.value)
+}
+
+var _ json.Unmarshaler = (*OptionalFloat)(nil)
+var _ json.Marshaler = (*OptionalFloat)(nil)
+
 // OptionalString represents a string that has a default value
 //
 // When encoded in json, Default is encoded as "null"
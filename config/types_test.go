@@ -412,6 +412,68 @@ func TestOptionalInteger(t *testing.T) {
 	}
 }
 
+func TestOptionalFloat(t *testing.T) {
+	makeFloat64Pointer := func(v float64) *float64 {
+		return &v
+	}
+
+	var defaultOptionalFloat OptionalFloat
+	if !defaultOptionalFloat.IsDefault() {
+		t.Fatal("should be the default")
+	}
+	if val := defaultOptionalFloat.WithDefault(0.5); val != 0.5 {
+		t.Errorf("optional float should have been 0.5, got %g", val)
+	}
+
+	filledFloat := OptionalFloat{value: makeFloat64Pointer(0)}
+	if filledFloat.IsDefault() {
+		t.Fatal("should not be the default")
+	}
+	if val := filledFloat.WithDefault(1); val != 0 {
+		t.Errorf("optional float should have been 0, got %g", val)
+	}
+
+	for jsonStr, goValue := range map[string]OptionalFloat{
+		"null": {},
+		"0":    {value: makeFloat64Pointer(0)},
+		"0.25": {value: makeFloat64Pointer(0.25)},
+		"-1":   {value: makeFloat64Pointer(-1)},
+	} {
+		var d OptionalFloat
+		err := json.Unmarshal([]byte(jsonStr), &d)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if goValue.value == nil && d.value == nil {
+		} else if goValue.value == nil && d.value != nil {
+			t.Errorf("expected default, got %s", d)
+		} else if *d.value != *goValue.value {
+			t.Fatalf("expected %s, got %s", goValue, d)
+		}
+
+		// Reverse
+		out, err := json.Marshal(goValue)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != jsonStr {
+			t.Fatalf("expected %s, got %s", jsonStr, string(out))
+		}
+	}
+
+	// test invalid values
+	for _, invalid := range []string{
+		"foo", "\"0.5\"", "[]",
+	} {
+		var p OptionalFloat
+		err := json.Unmarshal([]byte(invalid), &p)
+		if err == nil {
+			t.Errorf("expected to fail to decode %s as a float", invalid)
+		}
+	}
+}
+
 func TestOptionalString(t *testing.T) {
 	makeStringPointer := func(v string) *string {
 		return &v
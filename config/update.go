@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// DefaultUpdateCheckInterval is how often the daemon checks for a newer
+// version of go-ipfs.
+const DefaultUpdateCheckInterval = 24 * time.Hour
+
+// Update configures the checks for newer versions of go-ipfs. Nothing is
+// ever installed, the checks only report that a version is available.
+type Update struct {
+	// Check makes the daemon periodically check the distribution site for a
+	// newer version of go-ipfs.
+	Check Flag `json:",omitempty"`
+
+	// Interval is how often the daemon checks.
+	Interval *OptionalDuration `json:",omitempty"`
+
+	// DistPath is the IPFS path of the distribution site.
+	DistPath *OptionalString `json:",omitempty"`
+}
@@ -0,0 +1,324 @@
+// Package connpolicy applies the policies of peer tags to the connections of
+// the node, so that operators keep their connectivity to their own peers
+// while the connection manager prunes the others.
+//
+// The tags of a peer, and their weights, are set on the connection manager,
+// which prunes the peers with the lowest weights first, and never the peers
+// with a protected tag. The connections and bandwidth of the peers with a tag
+// are bounded by its quotas: the connections beyond the quota are closed as
+// they open, and the peers with the lowest weights are disconnected while the
+// bandwidth is over the quota.
+package connpolicy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	config "github.com/ipfs/go-ipfs/config"
+	logging "github.com/ipfs/go-log"
+	host "github.com/libp2p/go-libp2p-core/host"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+var log = logging.Logger("connpolicy")
+
+// checkInterval is the interval between the checks of the bandwidth quotas.
+const checkInterval = 10 * time.Second
+
+// connmgrTagPrefix prefixes the tags set on the connection manager, not to
+// mix them with the tags of the subsystems.
+const connmgrTagPrefix = "tag:"
+
+// Policy is the policy of the peers with a tag.
+type Policy struct {
+	// Protected keeps the peers from being pruned
+	Protected bool
+	// MaxConns is the number of connections to the peers, 0 for no limit
+	MaxConns int
+	// MaxBandwidth is the bytes per second sent to and received from the
+	// peers, 0 for no limit
+	MaxBandwidth uint64
+}
+
+// PolicyFromConfig returns the policy of a tag in the config.
+func PolicyFromConfig(cfg config.ConnMgrTag) (Policy, error) {
+	p := Policy{
+		Protected: cfg.Protected,
+		MaxConns:  int(cfg.MaxConns.WithDefault(0)),
+	}
+	bw, err := humanize.ParseBytes(cfg.MaxBandwidth.WithDefault("0"))
+	if err != nil {
+		return Policy{}, fmt.Errorf("invalid MaxBandwidth: %s", err)
+	}
+	p.MaxBandwidth = bw
+	return p, nil
+}
+
+// PeerTag is the tag of a peer.
+type PeerTag struct {
+	Peer   peer.ID
+	Tag    string
+	Weight int
+}
+
+// Manager applies the policies of the tags of the peers.
+type Manager struct {
+	host     host.Host
+	reporter metrics.Reporter
+
+	mu       sync.Mutex
+	policies map[string]Policy
+	peers    map[peer.ID]map[string]int
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// New returns a manager applying the policies to the connections of h, the
+// bandwidth of the peers being measured by reporter. The reporter may be
+// nil, without bandwidth quotas.
+func New(h host.Host, reporter metrics.Reporter, policies map[string]Policy) (*Manager, error) {
+	m := &Manager{
+		host:     h,
+		reporter: reporter,
+		policies: make(map[string]Policy),
+		peers:    make(map[peer.ID]map[string]int),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	for tag, p := range policies {
+		if err := m.SetPolicy(tag, p); err != nil {
+			return nil, err
+		}
+	}
+	h.Network().Notify((*notifiee)(m))
+	go m.run()
+	return m, nil
+}
+
+// Close stops applying the bandwidth and connection quotas.
+func (m *Manager) Close() error {
+	m.host.Network().StopNotify((*notifiee)(m))
+	close(m.closing)
+	<-m.closed
+	return nil
+}
+
+func connmgrTag(tag string) string {
+	return connmgrTagPrefix + tag
+}
+
+// Tag tags p with tag and weight.
+func (m *Manager) Tag(p peer.ID, tag string, weight int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tags, ok := m.peers[p]
+	if !ok {
+		tags = make(map[string]int)
+		m.peers[p] = tags
+	}
+	tags[tag] = weight
+
+	cm := m.host.ConnManager()
+	cm.TagPeer(p, connmgrTag(tag), weight)
+	if m.policies[tag].Protected {
+		cm.Protect(p, connmgrTag(tag))
+	}
+}
+
+// Untag removes the tag of p.
+func (m *Manager) Untag(p peer.ID, tag string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tags := m.peers[p]
+	if _, ok := tags[tag]; !ok {
+		return
+	}
+	delete(tags, tag)
+	if len(tags) == 0 {
+		delete(m.peers, p)
+	}
+
+	cm := m.host.ConnManager()
+	cm.UntagPeer(p, connmgrTag(tag))
+	cm.Unprotect(p, connmgrTag(tag))
+}
+
+// Tags returns the tags of the peers, by peer and tag.
+func (m *Manager) Tags() []PeerTag {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []PeerTag
+	for p, tags := range m.peers {
+		for tag, weight := range tags {
+			out = append(out, PeerTag{Peer: p, Tag: tag, Weight: weight})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Peer != out[j].Peer {
+			return out[i].Peer < out[j].Peer
+		}
+		return out[i].Tag < out[j].Tag
+	})
+	return out
+}
+
+// SetPolicy sets the policy of the peers with tag, a zero policy removing
+// it.
+func (m *Manager) SetPolicy(tag string, p Policy) error {
+	if p.MaxConns < 0 {
+		return fmt.Errorf("the connection quota of %q cannot be negative", tag)
+	}
+	if p.MaxBandwidth > 0 && m.reporter == nil {
+		return fmt.Errorf("the bandwidth quota of %q needs the bandwidth metrics, disabled by Swarm.DisableBandwidthMetrics", tag)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	protected := m.policies[tag].Protected
+	if p == (Policy{}) {
+		delete(m.policies, tag)
+	} else {
+		m.policies[tag] = p
+	}
+	if p.Protected == protected {
+		return nil
+	}
+	cm := m.host.ConnManager()
+	for pid, tags := range m.peers {
+		if _, ok := tags[tag]; !ok {
+			continue
+		}
+		if p.Protected {
+			cm.Protect(pid, connmgrTag(tag))
+		} else {
+			cm.Unprotect(pid, connmgrTag(tag))
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy of the peers with tag.
+func (m *Manager) Policy(tag string) Policy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.policies[tag]
+}
+
+// tagged returns the connected peers with tag. The caller holds mu.
+func (m *Manager) tagged(tag string) []peer.ID {
+	var peers []peer.ID
+	for p, tags := range m.peers {
+		if _, ok := tags[tag]; ok && m.host.Network().Connectedness(p) == network.Connected {
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// overConns returns the tag whose connection quota the connections of p go
+// over, if any. The caller holds mu.
+func (m *Manager) overConns(p peer.ID) (string, bool) {
+	for tag := range m.peers[p] {
+		max := m.policies[tag].MaxConns
+		if max == 0 {
+			continue
+		}
+		conns := 0
+		for _, q := range m.tagged(tag) {
+			conns += len(m.host.Network().ConnsToPeer(q))
+		}
+		if conns > max {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// checkBandwidth disconnects the peers with the lowest weights of the tags
+// over their bandwidth quota.
+func (m *Manager) checkBandwidth() {
+	m.mu.Lock()
+	var drop []peer.ID
+	for tag, p := range m.policies {
+		if p.MaxBandwidth == 0 {
+			continue
+		}
+		peers := m.tagged(tag)
+		rates := make(map[peer.ID]float64, len(peers))
+		var total float64
+		for _, q := range peers {
+			st := m.reporter.GetBandwidthForPeer(q)
+			rates[q] = st.RateIn + st.RateOut
+			total += rates[q]
+		}
+		sort.Slice(peers, func(i, j int) bool {
+			wi, wj := m.peers[peers[i]][tag], m.peers[peers[j]][tag]
+			if wi != wj {
+				return wi < wj
+			}
+			return rates[peers[i]] > rates[peers[j]]
+		})
+		for _, q := range peers {
+			if total <= float64(p.MaxBandwidth) {
+				break
+			}
+			log.Infof("disconnecting %s, the bandwidth of %q is over its quota", q, tag)
+			drop = append(drop, q)
+			total -= rates[q]
+		}
+	}
+	m.mu.Unlock()
+
+	for _, q := range drop {
+		if err := m.host.Network().ClosePeer(q); err != nil {
+			log.Debugf("disconnecting %s: %s", q, err)
+		}
+	}
+}
+
+func (m *Manager) run() {
+	defer close(m.closed)
+	if m.reporter == nil {
+		<-m.closing
+		return
+	}
+	t := time.NewTicker(checkInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			m.checkBandwidth()
+		case <-m.closing:
+			return
+		}
+	}
+}
+
+// notifiee closes the connections over the connection quotas.
+type notifiee Manager
+
+func (nn *notifiee) Connected(n network.Network, c network.Conn) {
+	m := (*Manager)(nn)
+	m.mu.Lock()
+	tag, over := m.overConns(c.RemotePeer())
+	m.mu.Unlock()
+	if !over {
+		return
+	}
+	log.Infof("closing a connection to %s, the connections of %q are over their quota", c.RemotePeer(), tag)
+	// not closed from the notification
+	go c.Close()
+}
+
+func (nn *notifiee) Disconnected(network.Network, network.Conn)   {}
+func (nn *notifiee) Listen(network.Network, ma.Multiaddr)         {}
+func (nn *notifiee) ListenClose(network.Network, ma.Multiaddr)    {}
+func (nn *notifiee) OpenedStream(network.Network, network.Stream) {}
+func (nn *notifiee) ClosedStream(network.Network, network.Stream) {}
@@ -0,0 +1,122 @@
+package connpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/config"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+// fakeReporter reports the rates of rates.
+type fakeReporter struct {
+	metrics.Reporter
+	rates map[peer.ID]float64
+}
+
+func (r *fakeReporter) GetBandwidthForPeer(p peer.ID) metrics.Stats {
+	return metrics.Stats{RateIn: r.rates[p]}
+}
+
+func waitConnected(t *testing.T, m *Manager, p peer.ID, want network.Connectedness) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.host.Network().Connectedness(p) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to be %s", p, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func policyFromJSON(t *testing.T, s string) (Policy, error) {
+	t.Helper()
+	var cfg config.ConnMgrTag
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return PolicyFromConfig(cfg)
+}
+
+func TestPolicyFromConfig(t *testing.T) {
+	p, err := policyFromJSON(t, `{"Protected": true, "MaxConns": 3, "MaxBandwidth": "1KiB"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (Policy{Protected: true, MaxConns: 3, MaxBandwidth: 1024}) {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+	if _, err := policyFromJSON(t, `{"MaxBandwidth": "lots"}`); err == nil {
+		t.Fatal("expected an invalid bandwidth to fail")
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	ctx := context.Background()
+	mn, err := mocknet.FullMeshLinked(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	local, a, b, c := hosts[0], hosts[1].ID(), hosts[2].ID(), hosts[3].ID()
+
+	reporter := &fakeReporter{rates: make(map[peer.ID]float64)}
+	m, err := New(local, reporter, map[string]Policy{
+		"cluster": {MaxConns: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	m.Tag(a, "cluster", 10)
+	m.Tag(b, "cluster", 20)
+	m.Tag(c, "cluster", 30)
+	m.Tag(c, "other", 1)
+
+	tags := m.Tags()
+	if len(tags) != 4 || tags[0].Weight == 0 {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+
+	// the third connection to the peers of cluster is over the quota
+	for _, p := range []peer.ID{a, b, c} {
+		if _, err := local.Network().DialPeer(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitConnected(t, m, a, network.Connected)
+	waitConnected(t, m, b, network.Connected)
+	waitConnected(t, m, c, network.NotConnected)
+
+	// over the bandwidth quota, the peers with the lowest weights go first
+	m.Untag(c, "cluster")
+	if _, err := local.Network().DialPeer(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPolicy("cluster", Policy{MaxBandwidth: 150}); err != nil {
+		t.Fatal(err)
+	}
+	reporter.rates[a], reporter.rates[b] = 100, 100
+	m.checkBandwidth()
+	waitConnected(t, m, a, network.NotConnected)
+	waitConnected(t, m, b, network.Connected)
+	waitConnected(t, m, c, network.Connected)
+
+	m.checkBandwidth()
+	waitConnected(t, m, b, network.Connected)
+}
+
+func TestBandwidthWithoutReporter(t *testing.T) {
+	mn, err := mocknet.FullMeshLinked(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(mn.Hosts()[0], nil, map[string]Policy{"cluster": {MaxBandwidth: 1}}); err == nil {
+		t.Fatal("expected a bandwidth quota without bandwidth metrics to fail")
+	}
+}
@@ -0,0 +1,33 @@
+package bootstrap
+
+import "sync"
+
+// Group is the name of the group of Config.BootstrapGroups the node
+// bootstraps from, "" for the Bootstrap peers. It can be switched while the
+// node runs.
+type Group struct {
+	mu   sync.RWMutex
+	name string
+}
+
+// NewGroup returns the group of the given name.
+func NewGroup(name string) *Group {
+	return &Group{name: name}
+}
+
+// Name returns the name of the group, "" for a nil group.
+func (g *Group) Name() string {
+	if g == nil {
+		return ""
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.name
+}
+
+// Set switches to the group of the given name.
+func (g *Group) Set(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.name = name
+}
@@ -62,6 +62,7 @@ func NewNode(ctx context.Context, cfg *BuildCfg) (*IpfsNode, error) {
 		return stopErr
 	}
 	n.IsOnline = cfg.Online
+	n.IsReadOnly = cfg.ReadOnly
 
 	go func() {
 		// Shut down the application if the lifetime context is canceled.
@@ -1,20 +1,28 @@
 package commands
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"runtime"
 	"strings"
 
+	config "github.com/ipfs/go-ipfs/config"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/core/coreunix"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
 
 	"github.com/cheggaaa/pb"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	mh "github.com/multiformats/go-multihash"
 )
 
@@ -29,22 +37,27 @@ type AddEvent struct {
 }
 
 const (
-	quietOptionName       = "quiet"
-	quieterOptionName     = "quieter"
-	silentOptionName      = "silent"
-	progressOptionName    = "progress"
-	trickleOptionName     = "trickle"
-	wrapOptionName        = "wrap-with-directory"
-	onlyHashOptionName    = "only-hash"
-	chunkerOptionName     = "chunker"
-	pinOptionName         = "pin"
-	rawLeavesOptionName   = "raw-leaves"
-	noCopyOptionName      = "nocopy"
-	fstoreCacheOptionName = "fscache"
-	cidVersionOptionName  = "cid-version"
-	hashOptionName        = "hash"
-	inlineOptionName      = "inline"
-	inlineLimitOptionName = "inline-limit"
+	quietOptionName         = "quiet"
+	quieterOptionName       = "quieter"
+	silentOptionName        = "silent"
+	progressOptionName      = "progress"
+	trickleOptionName       = "trickle"
+	wrapOptionName          = "wrap-with-directory"
+	onlyHashOptionName      = "only-hash"
+	chunkerOptionName       = "chunker"
+	pinOptionName           = "pin"
+	rawLeavesOptionName     = "raw-leaves"
+	noCopyOptionName        = "nocopy"
+	fstoreCacheOptionName   = "fscache"
+	cidVersionOptionName    = "cid-version"
+	hashOptionName          = "hash"
+	inlineOptionName        = "inline"
+	inlineLimitOptionName   = "inline-limit"
+	expireClassOptionName   = "expire-class"
+	workersOptionName       = "workers"
+	resumeOptionName        = "resume"
+	preserveModeOptionName  = "preserve-mode"
+	preserveMtimeOptionName = "preserve-mtime"
 )
 
 const adderOutChanSize = 8
@@ -87,6 +100,47 @@ hashes for the same file. The default is a fixed block size of
 Buzhash or Rabin fingerprint chunker for content defined chunking by
 specifying buzhash or rabin-[min]-[avg]-[max] (where min/avg/max refer
 to the desired chunk sizes in bytes), e.g. 'rabin-262144-524288-1048576'.
+The default can be changed with Import.Chunker in the config.
+
+The 'auto' chunker picks the chunking of each file from its size and how
+compressible its beginning is: files of up to 32 bytes are inlined into their
+CID, compressible files such as text use buzhash, and incompressible files of
+16MiB or more such as media use blocks of 1MiB. Other files use the default
+fixed block size.
+
+The '--inline' option inlines the blocks of up to '--inline-limit' bytes into
+identity CIDs, which carry the data of the block themselves: these blocks are
+neither stored nor fetched. Their defaults can be set with Import.Inline and
+Import.InlineLimit in the config. The limit is at most 128 bytes.
+
+The workers option, '--workers', chunks and hashes several files of the
+directories added at once, e.g. '--workers=8' to import a large tree on 8
+cores. 0 uses a worker per CPU. The subdirectories are read and built by the
+workers too, which speeds up adding trees of many small files. The hashes are
+the same whatever the number of workers, and so is the order of the output,
+the output of the files of a subdirectory being sent once the subdirectory is
+added. A single file is chunked by a
+single worker, and the files sent to a running daemon are streamed to it, so
+they are added one after another: add large trees with the daemon stopped to
+use the workers. The default can be changed with Import.Workers in the config.
+
+The resume option, '--resume', names an import session recording the files
+added, so that an interrupted import run again with the same session skips the
+files it completed, e.g. 'ipfs add -r --resume=dataset dataset/'. The files are
+added again if their size or modification time changed, or if their blocks
+were garbage collected, and a file interrupted is added again from its start.
+The session must be resumed with the same options, and is removed once the
+import completes. As the files sent to a running daemon are not read from the
+disk, '--resume' requires the daemon to be stopped.
+
+The preserve options, '--preserve-mode' and '--preserve-mtime', keep the
+permissions and the modification time of the files and the directories added
+in their UnixFS metadata, for 'ipfs get' to restore them, e.g. to back up a
+tree with its attributes. The gateway sends the modification time of a file
+as Last-Modified, and the /ipfs FUSE mount shows both. The metadata being part
+of the nodes, they change the hashes. As the files sent to a running daemon
+are not read from the disk, the preserve options require the daemon to be
+stopped. Symbolic links are added without metadata.
 
 The following examples use very small byte sizes to demonstrate the
 properties of the different chunkers on a small file. You'll likely
@@ -111,6 +165,12 @@ Finally, a note on hash determinism. While not guaranteed, adding the same
 file/directory with the same flags will almost always result in the same output
 hash. However, almost all of the flags provided by this command (other than pin,
 only-hash, and progress/status related flags) will change the final hash.
+
+The expire-class option, '--expire-class', makes the pin of the added content
+expire according to a class of Pinning.Expiry.Classes in the config, e.g. to
+keep temporary uploads for a day. Expired pins are removed by the daemon, or
+with 'ipfs pin expire'. Adding the content again without it makes the pin
+permanent.
 `,
 	},
 
@@ -131,15 +191,20 @@ only-hash, and progress/status related flags) will change the final hash.
 		cmds.BoolOption(trickleOptionName, "t", "Use trickle-dag format for dag generation."),
 		cmds.BoolOption(onlyHashOptionName, "n", "Only chunk and hash - do not write to disk."),
 		cmds.BoolOption(wrapOptionName, "w", "Wrap files with a directory object."),
-		cmds.StringOption(chunkerOptionName, "s", "Chunking algorithm, size-[bytes], rabin-[min]-[avg]-[max] or buzhash").WithDefault("size-262144"),
+		cmds.StringOption(chunkerOptionName, "s", "Chunking algorithm, size-[bytes], rabin-[min]-[avg]-[max], buzhash or auto. Default: Import.Chunker, or size-262144."),
 		cmds.BoolOption(pinOptionName, "Pin this object when adding.").WithDefault(true),
 		cmds.BoolOption(rawLeavesOptionName, "Use raw blocks for leaf nodes."),
 		cmds.BoolOption(noCopyOptionName, "Add the file using filestore. Implies raw-leaves. (experimental)"),
 		cmds.BoolOption(fstoreCacheOptionName, "Check the filestore for pre-existing blocks. (experimental)"),
 		cmds.IntOption(cidVersionOptionName, "CID version. Defaults to 0 unless an option that depends on CIDv1 is passed. Passing version 1 will cause the raw-leaves option to default to true."),
 		cmds.StringOption(hashOptionName, "Hash function to use. Implies CIDv1 if not sha2-256. (experimental)").WithDefault("sha2-256"),
-		cmds.BoolOption(inlineOptionName, "Inline small blocks into CIDs. (experimental)"),
-		cmds.IntOption(inlineLimitOptionName, "Maximum block size to inline. (experimental)").WithDefault(32),
+		cmds.BoolOption(inlineOptionName, "Inline small blocks into CIDs. Default: Import.Inline. (experimental)"),
+		cmds.IntOption(inlineLimitOptionName, "Maximum block size to inline. Default: Import.InlineLimit, or 32. (experimental)"),
+		cmds.StringOption(expireClassOptionName, "Expire the pin according to this class of Pinning.Expiry.Classes."),
+		cmds.IntOption(workersOptionName, "Number of files chunked and hashed at once, 0 for one per CPU. Default: Import.Workers, or 1."),
+		cmds.StringOption(resumeOptionName, "Record the files added in this import session, skipping those recorded by an interrupted import."),
+		cmds.BoolOption(preserveModeOptionName, "Keep the permissions of the files and directories in their UnixFS metadata."),
+		cmds.BoolOption(preserveMtimeOptionName, "Keep the modification time of the files and directories in their UnixFS metadata."),
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		quiet, _ := req.Options[quietOptionName].(bool)
@@ -160,6 +225,7 @@ only-hash, and progress/status related flags) will change the final hash.
 
 		return nil
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
@@ -171,15 +237,109 @@ only-hash, and progress/status related flags) will change the final hash.
 		wrap, _ := req.Options[wrapOptionName].(bool)
 		hash, _ := req.Options[onlyHashOptionName].(bool)
 		silent, _ := req.Options[silentOptionName].(bool)
-		chunker, _ := req.Options[chunkerOptionName].(string)
+		chunker, chunkerSet := req.Options[chunkerOptionName].(string)
 		dopin, _ := req.Options[pinOptionName].(bool)
 		rawblks, rbset := req.Options[rawLeavesOptionName].(bool)
 		nocopy, _ := req.Options[noCopyOptionName].(bool)
 		fscache, _ := req.Options[fstoreCacheOptionName].(bool)
 		cidVer, cidVerSet := req.Options[cidVersionOptionName].(int)
 		hashFunStr, _ := req.Options[hashOptionName].(string)
-		inline, _ := req.Options[inlineOptionName].(bool)
-		inlineLimit, _ := req.Options[inlineLimitOptionName].(int)
+		inline, inlineSet := req.Options[inlineOptionName].(bool)
+		inlineLimit, inlineLimitSet := req.Options[inlineLimitOptionName].(int)
+		expireClass, _ := req.Options[expireClassOptionName].(string)
+		workers, workersSet := req.Options[workersOptionName].(int)
+		resume, _ := req.Options[resumeOptionName].(string)
+		preserveMode, _ := req.Options[preserveModeOptionName].(bool)
+		preserveMtime, _ := req.Options[preserveMtimeOptionName].(bool)
+
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		if !chunkerSet {
+			chunker = cfg.Import.Chunker.WithDefault(config.DefaultImportChunker)
+		}
+		if !inlineSet {
+			inline = cfg.Import.Inline.WithDefault(false)
+		}
+		if !inlineLimitSet {
+			inlineLimit = int(cfg.Import.InlineLimit.WithDefault(config.DefaultInlineLimit))
+		}
+		if inline {
+			if err := config.CheckInlineLimit(int64(inlineLimit)); err != nil {
+				return err
+			}
+		}
+		if !workersSet {
+			workers = int(cfg.Import.Workers.WithDefault(config.DefaultImportWorkers))
+		}
+		if workers < 0 {
+			return fmt.Errorf("--%s must not be negative", workersOptionName)
+		}
+		if workers == 0 {
+			workers = runtime.NumCPU()
+		}
+		if (preserveMode || preserveMtime) && nd.IsDaemon {
+			opt := preserveModeOptionName
+			if !preserveMode {
+				opt = preserveMtimeOptionName
+			}
+			return fmt.Errorf("--%s cannot run on a daemon, stop the daemon first", opt)
+		}
+		var session *coreunix.Session
+		if resume != "" {
+			if nd.IsDaemon {
+				return fmt.Errorf("--%s cannot run on a daemon, stop the daemon first", resumeOptionName)
+			}
+			if hash {
+				return fmt.Errorf("--%s cannot be used with --%s", resumeOptionName, onlyHashOptionName)
+			}
+			session, err = coreunix.NewSession(nd.Repo.Datastore(), resume)
+			if err != nil {
+				return err
+			}
+			settings := fmt.Sprintf("chunker=%s hash=%s cid-version=%s raw-leaves=%s trickle=%t inline=%t inline-limit=%d nocopy=%t wrap=%t preserve-mode=%t preserve-mtime=%t",
+				chunker, hashFunStr, optionalValue(cidVer, cidVerSet), optionalValue(rawblks, rbset), trickle, inline, inlineLimit, nocopy, wrap, preserveMode, preserveMtime)
+			if err := session.Begin(req.Context, settings); err != nil {
+				return err
+			}
+		}
+
+		add := func(ctx context.Context, f files.Node, name string, opts ...options.UnixfsAddOption) (ipath.Resolved, error) {
+			return api.Unixfs().Add(ctx, f, opts...)
+		}
+		if workers > 1 || session != nil || preserveMode || preserveMtime || expireClass != "" {
+			unixfs, ok := api.Unixfs().(*coreapi.UnixfsAPI)
+			if !ok {
+				return errors.New("parallel and resumable imports, and imports preserving metadata, are not supported by this node")
+			}
+			add = func(ctx context.Context, f files.Node, name string, opts ...options.UnixfsAddOption) (ipath.Resolved, error) {
+				s := coreapi.AddSettings{
+					Workers:       workers,
+					PreserveMode:  preserveMode,
+					PreserveMtime: preserveMtime,
+					ExpireClass:   expireClass,
+				}
+				if session != nil {
+					s.Session = session.For(name)
+				}
+				return unixfs.AddWith(ctx, f, s, opts...)
+			}
+		}
+
+		if expireClass != "" {
+			if !dopin || hash {
+				return fmt.Errorf("--%s requires the added content to be pinned", expireClassOptionName)
+			}
+			if err := expiry.CheckClass(cfg.Pinning.Expiry, expireClass); err != nil {
+				return err
+			}
+		}
 
 		hashFunCode, ok := mh.Names[strings.ToLower(hashFunStr)]
 		if !ok {
@@ -238,9 +398,8 @@ only-hash, and progress/status related flags) will change the final hash.
 			opts[len(opts)-1] = options.Unixfs.Events(events)
 
 			go func() {
-				var err error
 				defer close(events)
-				_, err = api.Unixfs().Add(req.Context, addit.Node(), opts...)
+				_, err := add(req.Context, addit.Node(), addit.Name(), opts...)
 				errCh <- err
 			}()
 
@@ -285,6 +444,9 @@ only-hash, and progress/status related flags) will change the final hash.
 			return fmt.Errorf("expected a file argument")
 		}
 
+		if session != nil {
+			return session.End(req.Context)
+		}
 		return nil
 	},
 	PostRun: cmds.PostRunMap{
@@ -429,3 +591,11 @@ only-hash, and progress/status related flags) will change the final hash.
 	},
 	Type: AddEvent{},
 }
+
+// optionalValue formats the value of an option, or "default" if not set.
+func optionalValue(v interface{}, set bool) string {
+	if !set {
+		return "default"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	gopath "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const archiveNameOptionName = "name"
+
+// archiveEpoch is the modification time of every entry of the exported
+// archives: UnixFS does not record one.
+var archiveEpoch = time.Unix(0, 0).UTC()
+
+var ArchiveCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export UnixFS data as archives.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"export": archiveExportCmd,
+	},
+}
+
+var archiveExportCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export a UnixFS file or directory as a reproducible TAR archive.",
+		ShortDescription: `
+'ipfs archive export' writes the file or directory at the given path to stdout
+as a TAR archive. The archive only depends on the exported data: the same CID
+always produces a byte-identical archive.
+`,
+		LongDescription: `
+'ipfs archive export' writes the file or directory at the given path to stdout
+as a TAR archive. The archive only depends on the exported data: the same CID
+always produces a byte-identical archive, which makes it suitable for
+checksums and attestations.
+
+To achieve this, the archive is normalized:
+
+  - the entries of each directory are written in byte order of their names,
+    after the directory itself, whatever the order of the links in the DAG,
+    and whether the directory is sharded or not.
+  - directories have mode 0755, files 0644 and symlinks 0777.
+  - all entries are owned by uid and gid 0, without user or group names, and
+    have a modification time of 1970-01-01T00:00:00Z.
+
+The entries are prefixed with the CID of the exported object, or with the
+name given with '--name'.
+
+To compress the output with GZIP compression, use '--compress' or '-C'. You
+may also specify the level of compression by specifying '-l=<1-9>'. The GZIP
+header does not contain a name or a modification time either.
+
+Example:
+
+  > ipfs archive export QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 > data.tar
+`,
+	},
+
+	Arguments: []cmds.Argument{
+		cmds.StringArg("ipfs-path", true, false, "The path to the UnixFS object to export.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(archiveNameOptionName, "Name of the root entry of the archive. Default: the CID of the exported object."),
+		cmds.BoolOption(compressOptionName, "C", "Compress the output with GZIP compression."),
+		cmds.IntOption(compressionLevelOptionName, "l", "The level of compression (1-9)."),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		_, err := getCompressOptions(req)
+		return err
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cmplvl, err := getCompressOptions(req)
+		if err != nil {
+			return err
+		}
+
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+
+		name, _ := req.Options[archiveNameOptionName].(string)
+		if name == "" {
+			name = rp.Cid().String()
+		}
+		if gopath.Clean("/"+name) != "/"+name {
+			return fmt.Errorf("invalid archive name %q", name)
+		}
+
+		nd, err := api.Unixfs().Get(req.Context, rp)
+		if err != nil {
+			return err
+		}
+
+		piper, pipew := io.Pipe()
+		go func() {
+			defer nd.Close()
+			_ = pipew.CloseWithError(writeReproducibleArchive(pipew, nd, name, cmplvl))
+		}()
+
+		return res.Emit(piper)
+	},
+}
+
+// writeReproducibleArchive writes nd to w as a normalized TAR archive,
+// compressed according to compression.
+func writeReproducibleArchive(w io.Writer, nd files.Node, name string, compression int) error {
+	bufw := bufio.NewWriterSize(w, DefaultBufSize)
+	gzw, err := newMaybeGzWriter(bufw, compression)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(gzw)
+	if err := writeArchiveNode(tw, nd, name); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gzw.Close(); err != nil {
+		return err
+	}
+	return bufw.Flush()
+}
+
+func writeArchiveNode(tw *tar.Writer, nd files.Node, fpath string) error {
+	hdr := &tar.Header{
+		Name:    fpath,
+		ModTime: archiveEpoch,
+	}
+
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = nd.Target
+		hdr.Mode = 0777
+		return tw.WriteHeader(hdr)
+
+	case files.File:
+		size, err := nd.Size()
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Mode = 0644
+		hdr.Size = size
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, nd)
+		return err
+
+	case files.Directory:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+		hdr.Mode = 0755
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		type entry struct {
+			name string
+			nd   files.Node
+		}
+		var entries []entry
+		it := nd.Entries()
+		for it.Next() {
+			name := it.Name()
+			if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+				return fmt.Errorf("invalid entry name %q in %s", name, fpath)
+			}
+			entries = append(entries, entry{name, it.Node()})
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].name < entries[j].name
+		})
+
+		for _, e := range entries {
+			if err := writeArchiveNode(tw, e.nd, gopath.Join(fpath, e.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("file type %T is not supported", nd)
+	}
+}
@@ -0,0 +1,259 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	config "github.com/ipfs/go-ipfs/config"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+const (
+	authScopeOptionName = "scope"
+	authAllowOptionName = "allow"
+	authDenyOptionName  = "deny"
+)
+
+// authSecretSize is the number of random bytes of the secrets minted
+const authSecretSize = 32
+
+// AuthOutput is an authorization of the RPC API, output by "auth mint" with
+// its secret, and by "auth ls" without
+type AuthOutput struct {
+	Name            string
+	Secret          string   `json:",omitempty"`
+	Scopes          []string `json:",omitempty"`
+	AllowedCommands []string `json:",omitempty"`
+	DeniedCommands  []string `json:",omitempty"`
+}
+
+// AuthListOutput is the output of "auth ls"
+type AuthListOutput struct {
+	Authorizations []AuthOutput
+}
+
+var AuthCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Manage the authorizations of the RPC API.",
+		ShortDescription: `
+The authorizations of API.Authorizations restrict the RPC API to the requests
+carrying their secret, sent by the CLI with --api-auth, to the commands they
+allow. 'ipfs auth mint' creates an authorization with a random secret, and
+'ipfs auth revoke' removes one. They apply at once to a running daemon.
+
+Through the RPC API, only the authorizations allowed every command, without
+scopes, allowed nor denied commands, can manage the authorizations.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"mint":   authMintCmd,
+		"revoke": authRevokeCmd,
+		"ls":     authLsCmd,
+	},
+}
+
+func authScopeNames() string {
+	names := make([]string, 0, len(config.RPCAuthScopes))
+	for name := range config.RPCAuthScopes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+var authMintCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create an authorization of the RPC API, with a random secret.",
+		ShortDescription: `
+Creates the authorization <name> in API.Authorizations, and outputs its
+secret, which can't be shown again. Without --scope nor --allow, the
+authorization is allowed every command but those of --deny.
+
+The scopes are named sets of commands:
+
+  read-only   cat, get, ls, and the commands reading blocks, DAGs, objects,
+              files and names
+  pin-admin   pin and all its subcommands
+
+The commands of --allow and --deny are command paths, such as 'files/ls', a
+path ending with '/*' matching a command and all its subcommands.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name of the authorization."),
+	},
+	Options: []cmds.Option{
+		cmds.StringsOption(authScopeOptionName, "The scopes of commands allowed: "+authScopeNames()+"."),
+		cmds.StringsOption(authAllowOptionName, "The commands allowed, along with those of the scopes."),
+		cmds.StringsOption(authDenyOptionName, "The commands denied, even if allowed."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+		if name == "" || strings.ContainsAny(name, ". ") {
+			return fmt.Errorf("invalid authorization name %q", name)
+		}
+		scopes, _ := req.Options[authScopeOptionName].([]string)
+		allowed, _ := req.Options[authAllowOptionName].([]string)
+		denied, _ := req.Options[authDenyOptionName].([]string)
+		auth := &config.RPCAuthScope{
+			Scopes:          scopes,
+			AllowedCommands: allowed,
+			DeniedCommands:  denied,
+		}
+		if err := auth.CheckScopes(); err != nil {
+			return err
+		}
+
+		secret := make([]byte, authSecretSize)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		auth.AuthSecret = base64.RawURLEncoding.EncodeToString(secret)
+
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(cfgRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		cfg, err := r.Config()
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.API.Authorizations[name]; ok {
+			return fmt.Errorf("authorization %q already exists, revoke it first", name)
+		}
+		if err := r.SetConfigKey("API.Authorizations."+name, auth); err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &AuthOutput{
+			Name:            name,
+			Secret:          auth.AuthSecret,
+			Scopes:          scopes,
+			AllowedCommands: allowed,
+			DeniedCommands:  denied,
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AuthOutput) error {
+			_, err := fmt.Fprintln(w, out.Secret)
+			return err
+		}),
+	},
+	Type: AuthOutput{},
+}
+
+var authRevokeCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove an authorization of the RPC API.",
+		ShortDescription: `
+Removes the authorization <name> from API.Authorizations: its secret is
+refused from then on. The RPC API is open to every request once the last
+authorization is revoked.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The name of the authorization."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		name := req.Arguments[0]
+
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(cfgRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		cfg, err := r.Config()
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.API.Authorizations[name]; !ok {
+			return fmt.Errorf("no authorization %q", name)
+		}
+		auths := make(map[string]*config.RPCAuthScope, len(cfg.API.Authorizations)-1)
+		for n, auth := range cfg.API.Authorizations {
+			if n != name {
+				auths[n] = auth
+			}
+		}
+		return r.SetConfigKey("API.Authorizations", auths)
+	},
+}
+
+var authLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the authorizations of the RPC API, without their secret.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		r, err := fsrepo.Open(cfgRoot)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		cfg, err := r.Config()
+		if err != nil {
+			return err
+		}
+
+		out := &AuthListOutput{Authorizations: make([]AuthOutput, 0, len(cfg.API.Authorizations))}
+		for name, auth := range cfg.API.Authorizations {
+			if auth == nil {
+				continue
+			}
+			out.Authorizations = append(out.Authorizations, AuthOutput{
+				Name:            name,
+				Scopes:          auth.Scopes,
+				AllowedCommands: auth.AllowedCommands,
+				DeniedCommands:  auth.DeniedCommands,
+			})
+		}
+		sort.Slice(out.Authorizations, func(i, j int) bool {
+			return out.Authorizations[i].Name < out.Authorizations[j].Name
+		})
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AuthListOutput) error {
+			if len(out.Authorizations) == 0 {
+				_, err := fmt.Fprintln(w, "no authorization, the RPC API is open to every request")
+				return err
+			}
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintln(wtr, "Name\tScopes\tAllowed\tDenied")
+			for _, a := range out.Authorizations {
+				fmt.Fprintf(wtr, "%s\t%s\t%s\t%s\n", a.Name, authList(a.Scopes), authList(a.AllowedCommands), authList(a.DeniedCommands))
+			}
+			return nil
+		}),
+	},
+	Type: AuthListOutput{},
+}
+
+// authList formats the scopes or commands l, "-" when empty
+func authList(l []string) string {
+	if len(l) == 0 {
+		return "-"
+	}
+	return strings.Join(l, ",")
+}
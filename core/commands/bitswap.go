@@ -1,11 +1,14 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/core/coreapi"
 
 	humanize "github.com/dustin/go-humanize"
 	bitswap "github.com/ipfs/go-bitswap"
@@ -26,6 +29,7 @@ var BitswapCmd = &cmds.Command{
 		"wantlist":  showWantlistCmd,
 		"ledger":    ledgerCmd,
 		"reprovide": reprovideCmd,
+		"sessions":  bitswapSessionsCmd,
 	},
 }
 
@@ -167,6 +171,79 @@ var bitswapStatCmd = &cmds.Command{
 	},
 }
 
+// BitswapSessionOutput is the state of a running bitswap session
+type BitswapSessionOutput struct {
+	ID         uint64
+	Started    time.Time
+	Wanted     int
+	Blocks     int
+	Duplicates int
+	// DuplicatePercent is the percentage of the blocks received that were
+	// duplicates
+	DuplicatePercent float64
+	// Outstanding is the number of blocks wanted not received yet
+	Outstanding int
+	// Peers is the number of peers the blocks were received from
+	Peers int
+}
+
+var bitswapSessionsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the transfers of the running bitswap sessions.",
+		ShortDescription: `
+Lists the running bitswap sessions, oldest first, with the number of distinct
+blocks each asked for, the number of copies of these blocks received, and how
+many of them were duplicates, received from more than one peer. The blocks
+wanted not received yet, and the number of peers the blocks were received
+from, tell apart the sessions waiting for providers from the ones fetching.
+
+The percentage of duplicates of the sessions is also exported, once they end,
+as the metric ipfs_bitswap_session_duplicate_blocks_percent, and the number of
+running sessions as ipfs_bitswap_sessions. The duplicates can be lowered with
+the Internal.Bitswap knobs of the config.
+
+What bitswap exchanged with each peer is printed by 'ipfs stats bw bitswap'.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		capi, ok := api.(*coreapi.CoreAPI)
+		if !ok {
+			return errors.New("bitswap sessions are not supported by this node")
+		}
+
+		sessions, err := capi.BitswapSessions(req.Context)
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if err := res.Emit(&BitswapSessionOutput{
+				ID:               s.ID,
+				Started:          s.Started,
+				Wanted:           s.Wanted,
+				Blocks:           s.Blocks,
+				Duplicates:       s.Duplicates,
+				DuplicatePercent: s.DuplicatePercent(),
+				Outstanding:      s.Outstanding,
+				Peers:            s.Peers,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: BitswapSessionOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BitswapSessionOutput) error {
+			fmt.Fprintf(w, "%d\tstarted %s\t%d wanted\t%d outstanding\t%d received from %d peers\t%d duplicates (%.1f%%)\n", out.ID, out.Started.Format(time.RFC3339), out.Wanted, out.Outstanding, out.Blocks, out.Peers, out.Duplicates, out.DuplicatePercent)
+			return nil
+		}),
+	},
+}
+
 var ledgerCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the current ledger for a peer.",
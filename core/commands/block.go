@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 
+	humanize "github.com/dustin/go-humanize"
 	files "github.com/ipfs/go-ipfs-files"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
@@ -26,6 +27,13 @@ func (bs BlockStat) String() string {
 	return fmt.Sprintf("Key: %s\nSize: %d\n", bs.Key, bs.Size)
 }
 
+// BlockPutOutput is the output of 'ipfs block put': the stat of each block
+// put, or the summary of the blocks put with --batch.
+type BlockPutOutput struct {
+	*BlockStat
+	Batch *BlockBatchSummary `json:",omitempty"`
+}
+
 var BlockCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Interact with raw IPFS blocks.",
@@ -116,6 +124,7 @@ const (
 	blockFormatOptionName = "format"
 	mhtypeOptionName      = "mhtype"
 	mhlenOptionName       = "mhlen"
+	blockBatchOptionName  = "batch"
 )
 
 var blockPutCmd = &cmds.Command{
@@ -127,6 +136,20 @@ It reads from stdin, and outputs the block's CID to stdout.
 
 Unless specified, this command returns dag-pb CIDv0 CIDs. Setting 'mhtype' to anything
 other than 'sha2-256' or format to anything other than 'v0' will result in CIDv1.
+
+With --batch, each input is a stream of blocks with their CID, the sections of
+a .car file: the varint length of the CID and the block, followed by them. The
+header of a CARv1 or CARv2 file may come first, so .car files are put as is.
+Each block is checked against the hash of its CID before being stored, and a
+single summary is output:
+
+  Blocks    number of blocks stored, and Bytes their size
+  Invalid   number of blocks refused, for not matching their CID, using an
+            insecure hash function or going over the block size limit
+  Errors    the first of the blocks refused, and why
+
+The command fails if any block is refused, the others being stored all the
+same, as are the blocks read before a malformed stream.
 `,
 	},
 
@@ -138,9 +161,15 @@ other than 'sha2-256' or format to anything other than 'v0' will result in CIDv1
 		cmds.StringOption(mhtypeOptionName, "multihash hash function").WithDefault("sha2-256"),
 		cmds.IntOption(mhlenOptionName, "multihash hash length").WithDefault(-1),
 		cmds.BoolOption(pinOptionName, "pin added blocks recursively").WithDefault(false),
+		cmds.BoolOption(blockBatchOptionName, "Read streams of blocks with their CID, such as .car files, and verify them against it.").WithDefault(false),
 		cmdutils.AllowBigBlockOption,
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		if batch, _ := req.Options[blockBatchOptionName].(bool); batch {
+			return blockPutBatch(req, res, env)
+		}
+
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
@@ -187,10 +216,10 @@ other than 'sha2-256' or format to anything other than 'v0' will result in CIDv1
 				return err
 			}
 
-			err = res.Emit(&BlockStat{
+			err = res.Emit(&BlockPutOutput{BlockStat: &BlockStat{
 				Key:  p.Path().Cid().String(),
 				Size: p.Size(),
-			})
+			}})
 			if err != nil {
 				return err
 			}
@@ -199,12 +228,19 @@ other than 'sha2-256' or format to anything other than 'v0' will result in CIDv1
 		return it.Err()
 	},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, bs *BlockStat) error {
-			_, err := fmt.Fprintf(w, "%s\n", bs.Key)
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BlockPutOutput) error {
+			if s := out.Batch; s != nil {
+				fmt.Fprintf(w, "%d blocks stored (%s), %d refused\n", s.Blocks, humanize.Bytes(s.Bytes), s.Invalid)
+				for _, e := range s.Errors {
+					fmt.Fprintf(w, "block %d of %s: %s: %s\n", e.Block, e.File, e.Cid, e.Error)
+				}
+				return nil
+			}
+			_, err := fmt.Fprintf(w, "%s\n", out.Key)
 			return err
 		}),
 	},
-	Type: BlockStat{},
+	Type: BlockPutOutput{},
 }
 
 const (
@@ -232,6 +268,7 @@ It takes a list of base58 encoded multihashes to remove.
 		cmds.BoolOption(forceOptionName, "f", "Ignore nonexistent blocks."),
 		cmds.BoolOption(blockQuietOptionName, "q", "Write minimal output."),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
@@ -0,0 +1,255 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-verifcid"
+	gocar "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	gocarv2 "github.com/ipld/go-car/v2"
+)
+
+const (
+	// blockBatchSize is the number of blocks added to the blockstore at once.
+	blockBatchSize = 256
+	// maxBlockBatchErrors is the number of refused blocks detailed in the
+	// summary of a batch, the others being only counted.
+	maxBlockBatchErrors = 64
+)
+
+// BlockBatchSummary sums up the blocks put by 'ipfs block put --batch'.
+type BlockBatchSummary struct {
+	// Blocks is the number of blocks verified and stored, and Bytes their
+	// size.
+	Blocks int
+	Bytes  uint64
+	// Invalid is the number of blocks refused, the first of which are
+	// detailed in Errors.
+	Invalid int
+	Errors  []BlockBatchError `json:",omitempty"`
+}
+
+// BlockBatchError is a block refused by 'ipfs block put --batch'.
+type BlockBatchError struct {
+	File  string `json:",omitempty"`
+	Block int    // position of the block in File, from 1
+	Cid   string
+	Error string
+}
+
+// blockBatchReader reads the blocks of a batch: a stream of CARv1 sections,
+// each the varint length of a CID and its block followed by them, with or
+// without the header of a CARv1 or CARv2 file in front.
+type blockBatchReader struct {
+	r *bufio.Reader
+}
+
+func newBlockBatchReader(r io.Reader) (*blockBatchReader, error) {
+	br := bufio.NewReader(r)
+	if !startsWithCarHeader(br) {
+		return &blockBatchReader{r: br}, nil
+	}
+
+	h, err := gocar.ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	switch h.Version {
+	case 1:
+		return &blockBatchReader{r: br}, nil
+	case 2:
+		// the pragma of a CARv2 is read as a CARv1 header, followed by the
+		// CARv2 header locating the inner CARv1
+		var v2h gocarv2.Header
+		if _, err := v2h.ReadFrom(br); err != nil {
+			return nil, err
+		}
+		skip := int64(v2h.DataOffset) - gocarv2.PragmaSize - gocarv2.HeaderSize
+		if skip < 0 || v2h.DataSize == 0 {
+			return nil, fmt.Errorf("invalid CARv2 header: data of %d bytes at offset %d", v2h.DataSize, v2h.DataOffset)
+		}
+		if _, err := io.CopyN(ioutil.Discard, br, skip); err != nil {
+			return nil, err
+		}
+		inner := bufio.NewReader(io.LimitReader(br, int64(v2h.DataSize)))
+		if _, err := gocar.ReadHeader(inner); err != nil {
+			return nil, err
+		}
+		return &blockBatchReader{r: inner}, nil
+	default:
+		return nil, fmt.Errorf("unsupported CAR version %d", h.Version)
+	}
+}
+
+// startsWithCarHeader tells whether the first section of br holds a CAR
+// header, a CBOR map, rather than a CID, whose first byte is its version: 1,
+// or 0x12, the sha2-256 code of a CIDv0.
+func startsWithCarHeader(br *bufio.Reader) bool {
+	b, _ := br.Peek(binary.MaxVarintLen64 + 1)
+	_, n := binary.Uvarint(b)
+	if n <= 0 || n >= len(b) {
+		return false
+	}
+	return b[n]>>5 == 5
+}
+
+// next returns the CID and the data of the next block, or io.EOF once there
+// are no more.
+func (r *blockBatchReader) next() (cid.Cid, []byte, error) {
+	if _, err := r.r.Peek(1); err != nil {
+		return cid.Undef, nil, err
+	}
+	l, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return cid.Undef, nil, err
+	}
+	// the section is read as it comes, rather than allocated at the length
+	// it claims
+	section, err := ioutil.ReadAll(io.LimitReader(r.r, int64(l)))
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	if uint64(len(section)) != l {
+		return cid.Undef, nil, io.ErrUnexpectedEOF
+	}
+	c, n, err := carutil.ReadCid(section)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("invalid CID: %w", err)
+	}
+	return c, section[n:], nil
+}
+
+// verifyBlock checks the data of a block of a batch against its CID.
+func verifyBlock(req *cmds.Request, c cid.Cid, data []byte) error {
+	if err := verifcid.ValidateCid(c); err != nil {
+		return err
+	}
+	hashed, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !hashed.Equals(c) {
+		return fmt.Errorf("data hashes to %s", hashed)
+	}
+	return cmdutils.CheckBlockSize(req, uint64(len(data)))
+}
+
+func blockPutBatch(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+	if _, ok := req.Options[blockFormatOptionName].(string); ok {
+		return fmt.Errorf("--%s does not apply to --%s, the blocks come with their CID", blockFormatOptionName, blockBatchOptionName)
+	}
+	node, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	pinBlocks, _ := req.Options[pinOptionName].(bool)
+	if pinBlocks {
+		defer node.Blockstore.PinLock(req.Context).Unlock(req.Context)
+	}
+
+	var summary BlockBatchSummary
+	pending := make([]blocks.Block, 0, blockBatchSize)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := node.Blocks.AddBlocks(req.Context, pending); err != nil {
+			return err
+		}
+		for _, b := range pending {
+			if pinBlocks {
+				node.Pinning.PinWithMode(b.Cid(), pin.Recursive)
+			}
+			summary.Blocks++
+			summary.Bytes += uint64(len(b.RawData()))
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	// the blocks read before a malformed stream are stored all the same
+	readErr := func() error {
+		it := req.Files.Entries()
+		for it.Next() {
+			file := files.FileFromEntry(it)
+			if file == nil {
+				return errors.New("expected a file")
+			}
+			err := func() error {
+				defer file.Close()
+				br, err := newBlockBatchReader(file)
+				if err != nil {
+					return fmt.Errorf("%s: %w", it.Name(), err)
+				}
+				for n := 1; ; n++ {
+					c, data, err := br.next()
+					if err == io.EOF {
+						return nil
+					}
+					if err != nil {
+						return fmt.Errorf("block %d of %s: %w", n, it.Name(), err)
+					}
+					if err := verifyBlock(req, c, data); err != nil {
+						summary.Invalid++
+						if len(summary.Errors) < maxBlockBatchErrors {
+							summary.Errors = append(summary.Errors, BlockBatchError{
+								File:  it.Name(),
+								Block: n,
+								Cid:   c.String(),
+								Error: err.Error(),
+							})
+						}
+						continue
+					}
+					b, err := blocks.NewBlockWithCid(data, c)
+					if err != nil {
+						return err
+					}
+					if pending = append(pending, b); len(pending) == blockBatchSize {
+						if err := flush(); err != nil {
+							return err
+						}
+					}
+				}
+			}()
+			if err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	}()
+	if err := flush(); err != nil {
+		return err
+	}
+	if pinBlocks {
+		if err := node.Pinning.Flush(req.Context); err != nil {
+			return err
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	if err := res.Emit(&BlockPutOutput{Batch: &summary}); err != nil {
+		return err
+	}
+	if summary.Invalid > 0 {
+		return fmt.Errorf("%d out of %d blocks refused", summary.Invalid, summary.Invalid+summary.Blocks)
+	}
+	return nil
+}
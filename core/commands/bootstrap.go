@@ -35,9 +35,10 @@ Running 'ipfs bootstrap' with no arguments will run 'ipfs bootstrap list'.
 	Type:     bootstrapListCmd.Type,
 
 	Subcommands: map[string]*cmds.Command{
-		"list": bootstrapListCmd,
-		"add":  bootstrapAddCmd,
-		"rm":   bootstrapRemoveCmd,
+		"list":  bootstrapListCmd,
+		"add":   bootstrapAddCmd,
+		"rm":    bootstrapRemoveCmd,
+		"group": bootstrapGroupCmd,
 	},
 }
 
@@ -0,0 +1,154 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ipfs/go-ipfs/core/bootstrap"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// BootstrapGroup is a group of bootstrap peers, the Bootstrap peers when its
+// name is "".
+type BootstrapGroup struct {
+	Name   string
+	Peers  int
+	Active bool
+}
+
+// BootstrapGroupsOutput lists the groups of bootstrap peers.
+type BootstrapGroupsOutput struct {
+	Groups []BootstrapGroup
+}
+
+var bootstrapGroupCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show or switch the group of bootstrap peers.",
+		ShortDescription: `
+The node bootstraps from the Bootstrap peers of the config, or from one of
+the named groups of peers of BootstrapGroups, such as the peers of a private
+network. The group is chosen on start with 'ipfs daemon --bootstrap-group',
+and switched while the daemon runs with 'ipfs bootstrap group use'.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls":  bootstrapGroupLsCmd,
+		"use": bootstrapGroupUseCmd,
+	},
+}
+
+var bootstrapGroupLsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "List the groups of bootstrap peers.",
+		ShortDescription: `
+Lists the Bootstrap peers, shown as <Bootstrap>, and the groups of
+BootstrapGroups, with their number of peers. The group the node bootstraps
+from is marked with a '*'.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		active := nd.BootstrapGroup.Name()
+		out := &BootstrapGroupsOutput{Groups: []BootstrapGroup{{
+			Name:   "",
+			Peers:  len(cfg.Bootstrap),
+			Active: active == "",
+		}}}
+		for name, peers := range cfg.BootstrapGroups {
+			out.Groups = append(out.Groups, BootstrapGroup{Name: name, Peers: len(peers), Active: active == name})
+		}
+		sort.Slice(out.Groups, func(i, j int) bool {
+			return out.Groups[i].Name < out.Groups[j].Name
+		})
+		return cmds.EmitOnce(res, out)
+	},
+	Type: BootstrapGroupsOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BootstrapGroupsOutput) error {
+			for _, g := range out.Groups {
+				mark, name := " ", g.Name
+				if g.Active {
+					mark = "*"
+				}
+				if name == "" {
+					name = "<Bootstrap>"
+				}
+				fmt.Fprintf(w, "%s %s\t%d peers\n", mark, name, g.Peers)
+			}
+			return nil
+		}),
+	},
+}
+
+var bootstrapGroupUseCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Switch the group of bootstrap peers of the daemon.",
+		ShortDescription: `
+Restarts the bootstrapping of the daemon from the peers of the group, or from
+the Bootstrap peers when no group is given. The config is left unchanged, the
+daemon starts again with the group of --bootstrap-group.
+
+The connections open are kept: the peers of the group are dialed while the
+node has fewer connections than the bootstrap threshold.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("group", false, false, "The group of BootstrapGroups to bootstrap from."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+
+		var group string
+		if len(req.Arguments) > 0 {
+			group = req.Arguments[0]
+		}
+		peers, err := cfg.BootstrapGroupPeers(group)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, err.Error())
+		}
+
+		nd.BootstrapGroup.Set(group)
+		if err := nd.Bootstrap(bootstrap.DefaultBootstrapConfig); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &BootstrapGroupsOutput{Groups: []BootstrapGroup{{
+			Name:   group,
+			Peers:  len(peers),
+			Active: true,
+		}}})
+	},
+	Type: BootstrapGroupsOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *BootstrapGroupsOutput) error {
+			for _, g := range out.Groups {
+				name := g.Name
+				if name == "" {
+					name = "<Bootstrap>"
+				}
+				fmt.Fprintf(w, "bootstrapping from %s (%d peers)\n", name, g.Peers)
+			}
+			return nil
+		}),
+	},
+}
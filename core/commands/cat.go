@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreunix"
 
 	"github.com/cheggaaa/pb"
 	"github.com/ipfs/go-ipfs-cmds"
@@ -25,6 +26,17 @@ var CatCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Show IPFS object data.",
 		ShortDescription: "Displays the data contained by an IPFS or IPNS object(s) at the given path.",
+		LongDescription: `
+Displays the data contained by an IPFS or IPNS object(s) at the given path.
+The data of several paths is concatenated in order.
+
+The '--offset' and '--length' options select a range of the concatenated
+data. Only the blocks holding the range are fetched, e.g. to read the header
+of a large file without fetching it whole:
+
+  > ipfs cat --length 512 /ipfs/QmWATWQ7fVPP2EFGu71UkfnqhYXDYH566qy47CnJDgvs8u
+
+  `,
 	},
 
 	Arguments: []cmds.Argument{
@@ -34,12 +46,16 @@ var CatCmd = &cmds.Command{
 		cmds.Int64Option(offsetOptionName, "o", "Byte offset to begin reading from."),
 		cmds.Int64Option(lengthOptionName, "l", "Maximum number of bytes to read."),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data.").WithDefault(true),
+		cmdenv.OptionProviders,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
+		if err := cmdenv.ConnectProviders(req, api); err != nil {
+			return err
+		}
 
 		offset, _ := req.Options[offsetOptionName].(int64)
 		if offset < 0 {
@@ -169,7 +185,16 @@ func cat(ctx context.Context, api iface.CoreAPI, paths []string, offset int64, m
 		if max > 0 && length >= uint64(max) {
 			var r io.Reader = file
 			if overshoot := int64(length - uint64(max)); overshoot != 0 {
-				r = io.LimitReader(file, int64(size)-overshoot)
+				// the file is read up to the end of the range only,
+				// rather than ahead of it
+				nd, err := api.ResolveNode(ctx, path.New(p))
+				if err != nil {
+					return nil, 0, err
+				}
+				r, err = coreunix.NewRangeReader(ctx, api.Dag(), nd, count, int64(size)-overshoot)
+				if err != nil {
+					return nil, 0, err
+				}
 				length = uint64(max)
 			}
 			readers = append(readers, r)
@@ -10,6 +10,8 @@ import (
 	cid "github.com/ipfs/go-cid"
 	cidutil "github.com/ipfs/go-cidutil"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	config "github.com/ipfs/go-ipfs/config"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	verifcid "github.com/ipfs/go-verifcid"
 	mbase "github.com/multiformats/go-multibase"
 	mhash "github.com/multiformats/go-multihash"
@@ -25,6 +27,8 @@ var CidCmd = &cmds.Command{
 		"bases":  basesCmd,
 		"codecs": codecsCmd,
 		"hashes": hashesCmd,
+		"inline": cidInlineCmd,
+		"audit":  cidAuditCmd,
 	},
 	Extra: CreateCmdExtras(SetDoesNotUseRepo(true)),
 }
@@ -114,6 +118,98 @@ The optional format string is a printf style format string:
 	Type: CidFormatRes{},
 }
 
+const cidInlineLimitOptionName = "limit"
+
+// CidInlineOutput is the identity CID inlining some data
+type CidInlineOutput struct {
+	Cid string
+}
+
+var cidInlineCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inline data into an identity CID.",
+		ShortDescription: `
+Prints the identity CID carrying the given data, whose block does not need to
+be stored or fetched, as 'ipfs add --inline' and 'ipfs files write --inline'
+make for small blocks. The data is a raw block unless another codec is given.
+
+The data must fit in the inline limit, --limit, which defaults to
+Import.InlineLimit in the config, or 32 bytes. The limit is at most 128 bytes.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.FileArg("data", true, false, "The data to inline.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(cidCodecOptionName, "IPLD codec of the data.").WithDefault("raw"),
+		cmds.IntOption(cidInlineLimitOptionName, "Maximum size of the data. Default: Import.InlineLimit, or 32."),
+		cmds.StringOption(cidMultibaseOptionName, "Multibase to display CID in."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		codecStr, _ := req.Options[cidCodecOptionName].(string)
+		baseStr, _ := req.Options[cidMultibaseOptionName].(string)
+		limit, limitSet := req.Options[cidInlineLimitOptionName].(int)
+
+		codec, ok := cid.Codecs[codecStr]
+		if !ok {
+			return fmt.Errorf("unknown IPLD codec: %s", codecStr)
+		}
+		base := mbase.Encoding(mbase.Base32)
+		if baseStr != "" {
+			encoder, err := mbase.EncoderByName(baseStr)
+			if err != nil {
+				return err
+			}
+			base = encoder.Encoding()
+		}
+
+		if !limitSet {
+			nd, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			cfg, err := nd.Repo.Config()
+			if err != nil {
+				return err
+			}
+			limit = int(cfg.Import.InlineLimit.WithDefault(config.DefaultInlineLimit))
+		}
+		if err := config.CheckInlineLimit(int64(limit)); err != nil {
+			return err
+		}
+
+		file, err := cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+		if err != nil {
+			return err
+		}
+		if len(data) > limit {
+			return fmt.Errorf("data exceeds the inline limit of %d bytes", limit)
+		}
+
+		c, err := cid.V1Builder{Codec: codec, MhType: mhash.IDENTITY}.Sum(data)
+		if err != nil {
+			return err
+		}
+		str, err := c.StringOfBase(base)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &CidInlineOutput{Cid: str})
+	},
+	Type: CidInlineOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *CidInlineOutput) error {
+			_, err := fmt.Fprintln(w, out.Cid)
+			return err
+		}),
+	},
+}
+
 type CidFormatRes struct {
 	CidStr    string // Original Cid String passed in
 	Formatted string // Formatted Result
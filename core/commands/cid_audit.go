@@ -0,0 +1,388 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-mfs"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const cidAuditUpgradeOptionName = "upgrade"
+
+// cidAuditSizeBuckets are the upper bounds of the block sizes counted by
+// "cid audit", the larger blocks being counted in a last bucket
+var cidAuditSizeBuckets = []uint64{1 << 10, 16 << 10, 256 << 10, 1 << 20}
+
+// cidV1Builder builds the CIDv1 of the dag-pb blocks, which the CIDv0 are
+var cidV1Builder = cid.V1Builder{Codec: cid.DagProtobuf, MhType: mh.SHA2_256}
+
+// CidAuditSizeBucket is the number of blocks up to a size, output by
+// "cid audit". The last bucket, with no MaxSize, has the larger blocks.
+type CidAuditSizeBucket struct {
+	MaxSize uint64 `json:",omitempty"`
+	Blocks  uint64
+}
+
+// CidAuditOutput is the output of "cid audit"
+type CidAuditOutput struct {
+	// Blocks and Bytes are the number and size of the blocks stored,
+	// counted by multihash function in Hashes and by size in Sizes
+	Blocks uint64
+	Bytes  uint64
+	Hashes map[string]uint64
+	Sizes  []CidAuditSizeBucket
+	// References is the number of distinct CIDs referenced by the pins and
+	// the MFS, counted by version in Versions and by codec in Codecs, of
+	// which Missing are not stored
+	References uint64
+	Versions   map[string]uint64
+	Codecs     map[string]uint64
+	Missing    uint64 `json:",omitempty"`
+	// V0Pins is the number of recursive and direct pins of CIDv0 roots
+	V0Pins int
+	// PinsUpgraded and MFSUpgraded are the number of pins and MFS
+	// references re-encoded to CIDv1 with --upgrade
+	PinsUpgraded int `json:",omitempty"`
+	MFSUpgraded  int `json:",omitempty"`
+}
+
+var cidAuditCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Report the CID versions, codecs, hashes and sizes of the repo.",
+		ShortDescription: `
+Scans the blockstore, and reports how many blocks are hashed with each
+multihash function and how their sizes are distributed. As the blocks are
+stored by multihash, the CID versions and codecs are those of the references
+to the blocks: the distinct CIDs of the DAGs of the pins and of the MFS, of
+which those not stored locally are reported missing. It also reports how many
+recursive and direct pins have a CIDv0 root.
+
+CIDv0 can't be used in the subdomains of subdomain gateways, which are case
+insensitive, and newer defaults use CIDv1. With --upgrade, the CIDv0 pins are
+replaced with pins of the same content by CIDv1, keeping their name, labels
+and expiry, and the MFS directories and their references to CIDv0 are
+re-encoded as CIDv1, after the report is made. The blocks are the same, only
+the CIDs pointing to them change, so no data is copied: the references to
+CIDv0 within the pinned DAGs and within the files are left as they are.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(cidAuditUpgradeOptionName, "Re-encode the CIDv0 of the pins and MFS as CIDv1."),
+	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo(cidAuditUpgradeOptionName)),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		upgrade, _ := req.Options[cidAuditUpgradeOptionName].(bool)
+
+		out := &CidAuditOutput{
+			Hashes:   make(map[string]uint64),
+			Sizes:    make([]CidAuditSizeBucket, len(cidAuditSizeBuckets)+1),
+			Versions: make(map[string]uint64),
+			Codecs:   make(map[string]uint64),
+		}
+		if err := out.auditBlocks(req.Context, nd); err != nil {
+			return err
+		}
+
+		recursive, err := listPins(req.Context, api, options.Pin.Ls.Recursive())
+		if err != nil {
+			return err
+		}
+		direct, err := listPins(req.Context, api, options.Pin.Ls.Direct())
+		if err != nil {
+			return err
+		}
+		rootNode, err := nd.FilesRoot.GetDirectory().GetNode()
+		if err != nil {
+			return err
+		}
+		// only the local blocks are read
+		dserv := dag.NewDAGService(bserv.New(nd.Blockstore, offline.Exchange(nd.Blockstore)))
+		refs := cid.NewSet()
+		if err := out.auditReferences(req.Context, dserv, refs, rootNode.Cid(), true); err != nil {
+			return err
+		}
+		var v0 []coreiface.Pin
+		for _, pins := range []struct {
+			pins    []coreiface.Pin
+			recurse bool
+		}{{recursive, true}, {direct, false}} {
+			for _, p := range pins.pins {
+				root := p.Path().Cid()
+				if root.Version() == 0 {
+					v0 = append(v0, p)
+				}
+				if err := out.auditReferences(req.Context, dserv, refs, root, pins.recurse); err != nil {
+					return err
+				}
+			}
+		}
+		out.V0Pins = len(v0)
+
+		if upgrade {
+			end, err := journalFilesOp(req, nd)
+			if err != nil {
+				return err
+			}
+			out.MFSUpgraded, err = upgradeMFSDirectory(req.Context, nd.FilesRoot.GetDirectory())
+			if err == nil {
+				_, err = mfs.FlushPath(req.Context, nd.FilesRoot, "/")
+			}
+			end()
+			if err != nil {
+				return fmt.Errorf("upgrading MFS: %w", err)
+			}
+
+			for _, p := range v0 {
+				if err := upgradePin(req.Context, nd, api, p); err != nil {
+					return fmt.Errorf("upgrading the pin of %s: %w", p.Path().Cid(), err)
+				}
+				out.PinsUpgraded++
+			}
+		}
+
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *CidAuditOutput) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintf(wtr, "Blocks:\t%d\t(%d bytes)\n", out.Blocks, out.Bytes)
+			printAuditCounts(wtr, "Hashes", out.Hashes)
+			fmt.Fprintln(wtr, "Sizes:")
+			for _, b := range out.Sizes {
+				if b.MaxSize == 0 {
+					fmt.Fprintf(wtr, "  larger\t%d\n", b.Blocks)
+					continue
+				}
+				fmt.Fprintf(wtr, "  <= %d\t%d\n", b.MaxSize, b.Blocks)
+			}
+			fmt.Fprintf(wtr, "References:\t%d\t(%d missing)\n", out.References, out.Missing)
+			printAuditCounts(wtr, "Versions", out.Versions)
+			printAuditCounts(wtr, "Codecs", out.Codecs)
+			fmt.Fprintf(wtr, "CIDv0 pins:\t%d\n", out.V0Pins)
+			if out.PinsUpgraded+out.MFSUpgraded > 0 {
+				fmt.Fprintf(wtr, "Upgraded:\t%d pins, %d MFS references\n", out.PinsUpgraded, out.MFSUpgraded)
+			}
+			return nil
+		}),
+	},
+	Type: CidAuditOutput{},
+}
+
+// printAuditCounts prints the counts of the section name, the largest first.
+func printAuditCounts(w io.Writer, name string, counts map[string]uint64) {
+	fmt.Fprintf(w, "%s:\n", name)
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%d\n", name, counts[name])
+	}
+}
+
+// auditBlocks counts the blocks of the blockstore of nd by multihash function
+// and size.
+func (out *CidAuditOutput) auditBlocks(ctx context.Context, nd *core.IpfsNode) error {
+	for i, max := range cidAuditSizeBuckets {
+		out.Sizes[i].MaxSize = max
+	}
+
+	keys, err := nd.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	for c := range keys {
+		size, err := nd.Blockstore.GetSize(ctx, c)
+		if err != nil {
+			// removed since listed
+			continue
+		}
+		out.Blocks++
+		out.Bytes += uint64(size)
+		hash := "unknown"
+		if dec, err := mh.Decode(c.Hash()); err == nil {
+			var ok bool
+			if hash, ok = mh.Codes[dec.Code]; !ok {
+				hash = fmt.Sprintf("0x%x", dec.Code)
+			}
+		}
+		out.Hashes[hash]++
+		i := sort.Search(len(cidAuditSizeBuckets), func(i int) bool {
+			return uint64(size) <= cidAuditSizeBuckets[i]
+		})
+		out.Sizes[i].Blocks++
+	}
+	return ctx.Err()
+}
+
+// auditReferences counts root, and the CIDs of its DAG if recurse, by version
+// and codec, skipping those in seen.
+func (out *CidAuditOutput) auditReferences(ctx context.Context, dserv ipld.DAGService, seen *cid.Set, root cid.Cid, recurse bool) error {
+	queue := []cid.Cid{root}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if !seen.Visit(c) {
+			continue
+		}
+		out.References++
+		out.Versions[fmt.Sprintf("v%d", c.Version())]++
+		codec, ok := cid.CodecToStr[c.Type()]
+		if !ok {
+			codec = fmt.Sprintf("0x%x", c.Type())
+		}
+		out.Codecs[codec]++
+		if !recurse {
+			continue
+		}
+
+		nd, err := dserv.Get(ctx, c)
+		if err != nil {
+			if ipld.IsNotFound(err) {
+				out.Missing++
+				continue
+			}
+			return err
+		}
+		for _, l := range nd.Links() {
+			queue = append(queue, l.Cid)
+		}
+	}
+	return nil
+}
+
+// listPins returns the pins of type typ.
+func listPins(ctx context.Context, api coreiface.CoreAPI, typ options.PinLsOption) ([]coreiface.Pin, error) {
+	ch, err := api.Pin().Ls(ctx, typ)
+	if err != nil {
+		return nil, err
+	}
+	var pins []coreiface.Pin
+	for p := range ch {
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+	return pins, nil
+}
+
+// upgradePin replaces the CIDv0 pin p with a pin of the same type by CIDv1,
+// with the name, labels and expiry of p.
+func upgradePin(ctx context.Context, nd *core.IpfsNode, api coreiface.CoreAPI, p coreiface.Pin) error {
+	v0 := p.Path().Cid()
+	v1 := cid.NewCidV1(cid.DagProtobuf, v0.Hash())
+	recursive := p.Type() == "recursive"
+
+	if err := api.Pin().Add(ctx, path.IpfsPath(v1), options.Pin.Recursive(recursive)); err != nil {
+		return err
+	}
+	if nd.PinMeta != nil {
+		meta, ok, err := nd.PinMeta.Get(ctx, v0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := nd.PinMeta.Set(ctx, pinmeta.Meta{Root: v1, Name: meta.Name, Labels: meta.Labels}); err != nil {
+				return err
+			}
+		}
+	}
+	if nd.ExpiringPins != nil {
+		exp, ok, err := nd.ExpiringPins.Get(ctx, v0)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if err := nd.ExpiringPins.Add(ctx, v1, exp.Class, exp.Expires); err != nil {
+				return err
+			}
+		}
+	}
+	return api.Pin().Rm(ctx, path.IpfsPath(v0), options.Pin.RmRecursive(recursive))
+}
+
+// upgradeMFSDirectory re-encodes the MFS directory d, its subdirectories and
+// their references to CIDv0 files as CIDv1, returning how many were.
+func upgradeMFSDirectory(ctx context.Context, d *mfs.Directory) (int, error) {
+	names, err := d.ListNames(ctx)
+	if err != nil {
+		return 0, err
+	}
+	upgraded := 0
+	for _, name := range names {
+		child, err := d.Child(name)
+		if err != nil {
+			return upgraded, err
+		}
+		switch child := child.(type) {
+		case *mfs.Directory:
+			n, err := upgradeMFSDirectory(ctx, child)
+			upgraded += n
+			if err != nil {
+				return upgraded, err
+			}
+		case *mfs.File:
+			node, err := child.GetNode()
+			if err != nil {
+				return upgraded, err
+			}
+			pn, ok := node.(*dag.ProtoNode)
+			if !ok || pn.Cid().Version() != 0 {
+				continue
+			}
+			pn = pn.Copy().(*dag.ProtoNode)
+			pn.SetCidBuilder(cidV1Builder)
+			if err := d.Unlink(name); err != nil {
+				return upgraded, err
+			}
+			if err := d.AddChild(name, pn); err != nil {
+				return upgraded, err
+			}
+			upgraded++
+		}
+	}
+
+	node, err := d.GetNode()
+	if err != nil {
+		return upgraded, err
+	}
+	if node.Cid().Version() == 0 {
+		d.SetCidBuilder(cidV1Builder)
+		upgraded++
+	}
+	return upgraded, nil
+}
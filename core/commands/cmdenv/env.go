@@ -33,12 +33,9 @@ func GetApi(env cmds.Environment, req *cmds.Request) (coreiface.CoreAPI, error)
 		return nil, fmt.Errorf("expected env to be of type %T, got %T", ctx, env)
 	}
 
-	offline, _ := req.Options["offline"].(bool)
-	if !offline {
-		offline, _ = req.Options["local"].(bool)
-		if offline {
-			log.Errorf("Command '%s', --local is deprecated, use --offline instead", strings.Join(req.Path, " "))
-		}
+	offline := IsOffline(req)
+	if local, _ := req.Options["local"].(bool); local {
+		log.Errorf("Command '%s', --local is deprecated, use --offline instead", strings.Join(req.Path, " "))
 	}
 	api, err := ctx.GetAPI()
 	if err != nil {
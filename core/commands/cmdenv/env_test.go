@@ -1,8 +1,16 @@
 package cmdenv
 
 import (
+	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/apierr"
+	ipld "github.com/ipfs/go-ipld-format"
 )
 
 func TestEscNonPrint(t *testing.T) {
@@ -46,3 +54,28 @@ func hasNonPrintable(s string) bool {
 	}
 	return false
 }
+
+func TestOfflineError(t *testing.T) {
+	c, err := cid.Decode("QmYggEjcv95HCUExUzydomGZ3CeYq59jqMP8xVzyUt46iR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := fmt.Errorf("pin: %w", ipld.ErrNotFound{Cid: c})
+
+	online := &cmds.Request{Options: cmds.OptMap{}}
+	if OfflineError(online, missing) != missing {
+		t.Fatal("expected the errors left as they are online")
+	}
+
+	offline := &cmds.Request{Options: cmds.OptMap{"offline": true}}
+	err = OfflineError(offline, missing)
+	if apierr.KindOf(err) != apierr.Offline || !ipld.IsNotFound(err) {
+		t.Fatalf("expected an offline error wrapping the missing block, got %v", err)
+	}
+	if !strings.Contains(err.Error(), c.String()) {
+		t.Fatalf("expected the missing block named, got %q", err)
+	}
+	if other := errors.New("oops"); OfflineError(offline, other) != other {
+		t.Fatal("expected the other errors left as they are")
+	}
+}
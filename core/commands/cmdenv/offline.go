@@ -0,0 +1,39 @@
+package cmdenv
+
+import (
+	"errors"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/apierr"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// IsOffline tells whether req runs with --offline, or the deprecated --local.
+func IsOffline(req *cmds.Request) bool {
+	offline, _ := req.Options["offline"].(bool)
+	local, _ := req.Options["local"].(bool)
+	return offline || local
+}
+
+// OfflineError returns err, when req runs with --offline and err is about a
+// block missing from the blockstore, as an apierr.NetworkRequiredError
+// telling that the network would be needed to fetch the block. Other errors
+// are returned as they are.
+func OfflineError(req *cmds.Request, err error) error {
+	if err == nil || !IsOffline(req) {
+		return err
+	}
+	var netErr *apierr.NetworkRequiredError
+	if errors.As(err, &netErr) {
+		return err
+	}
+	var notFound ipld.ErrNotFound
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	what := "block"
+	if notFound.Cid.Defined() {
+		what += " " + notFound.Cid.String()
+	}
+	return &apierr.NetworkRequiredError{What: what, Err: err}
+}
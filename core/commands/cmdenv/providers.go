@@ -0,0 +1,34 @@
+package cmdenv
+
+import (
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// OptionProviders lists the known providers of the content of a command,
+// connected to before fetching it.
+var OptionProviders = cmds.StringsOption("providers", "Multiaddrs of known providers of the content, ending with /p2p/<peer-id>, connected to before fetching it.")
+
+// ConnectProviders connects to the providers given with OptionProviders, if
+// any, so that they are asked for the content first.
+func ConnectProviders(req *cmds.Request, api coreiface.CoreAPI) error {
+	hints, _ := req.Options[OptionProviders.Name()].([]string)
+	if len(hints) == 0 {
+		return nil
+	}
+	infos, err := coreapi.ParseProviderHints(hints)
+	if err != nil {
+		return err
+	}
+	capi, ok := api.(*coreapi.CoreAPI)
+	if !ok {
+		return nil
+	}
+	n, err := capi.ConnectProviders(req.Context, infos)
+	if err != nil {
+		return err
+	}
+	log.Debugf("connected to %d of the %d providers given", n, len(infos))
+	return nil
+}
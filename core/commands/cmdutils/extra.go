@@ -0,0 +1,37 @@
+package cmdutils
+
+import (
+	cmds "github.com/ipfs/go-ipfs-cmds"
+)
+
+// CreateCmdExtras returns the Extra of a command, set by opts.
+func CreateCmdExtras(opts ...func(e *cmds.Extra)) *cmds.Extra {
+	e := new(cmds.Extra)
+	for _, o := range opts {
+		o(e)
+	}
+	return e
+}
+
+// changesRepo describes commands changing the blocks, pins, MFS or mounts of
+// the node, or publishing records, which read-only nodes decline.
+type changesRepo struct{}
+
+// SetChangesRepo marks a command, and its subcommands, as changing the repo.
+// When options are given, only the calls setting one of these boolean
+// options change it, such as 'ipfs cid audit --upgrade'.
+func SetChangesRepo(options ...string) func(e *cmds.Extra) {
+	return func(e *cmds.Extra) {
+		e.SetValue(changesRepo{}, options)
+	}
+}
+
+// GetChangesRepo returns the options given to SetChangesRepo, and whether the
+// command was marked with it.
+func GetChangesRepo(e *cmds.Extra) (options []string, found bool) {
+	v, found := e.GetValue(changesRepo{})
+	if !found {
+		return nil, false
+	}
+	return v.([]string), true
+}
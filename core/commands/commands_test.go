@@ -29,6 +29,8 @@ func TestROCommands(t *testing.T) {
 		"/dag/resolve",
 		"/dag/stat",
 		"/dag/export",
+		"/dag/diff",
+		"/dag/progress",
 		"/dns",
 		"/get",
 		"/ls",
@@ -73,9 +75,16 @@ func TestROCommands(t *testing.T) {
 func TestCommands(t *testing.T) {
 	list := []string{
 		"/add",
+		"/archive",
+		"/archive/export",
+		"/auth",
+		"/auth/ls",
+		"/auth/mint",
+		"/auth/revoke",
 		"/bitswap",
 		"/bitswap/ledger",
 		"/bitswap/reprovide",
+		"/bitswap/sessions",
 		"/bitswap/stat",
 		"/bitswap/wantlist",
 		"/block",
@@ -86,16 +95,21 @@ func TestCommands(t *testing.T) {
 		"/bootstrap",
 		"/bootstrap/add",
 		"/bootstrap/add/default",
+		"/bootstrap/group",
+		"/bootstrap/group/ls",
+		"/bootstrap/group/use",
 		"/bootstrap/list",
 		"/bootstrap/rm",
 		"/bootstrap/rm/all",
 		"/cat",
 		"/cid",
+		"/cid/audit",
 		"/cid/base32",
 		"/cid/bases",
 		"/cid/codecs",
 		"/cid/format",
 		"/cid/hashes",
+		"/cid/inline",
 		"/commands",
 		"/commands/completion",
 		"/commands/completion/bash",
@@ -107,6 +121,8 @@ func TestCommands(t *testing.T) {
 		"/config/show",
 		"/dag",
 		"/dag/export",
+		"/dag/diff",
+		"/dag/progress",
 		"/dag/get",
 		"/dag/import",
 		"/dag/put",
@@ -120,11 +136,15 @@ func TestCommands(t *testing.T) {
 		"/dht/put",
 		"/dht/query",
 		"/diag",
+		"/diag/availability",
 		"/diag/cmds",
 		"/diag/cmds/clear",
 		"/diag/cmds/set-time",
+		"/diag/history",
 		"/diag/profile",
+		"/diag/speedtest",
 		"/diag/sys",
+		"/diff",
 		"/dns",
 		"/file",
 		"/file/ls",
@@ -132,12 +152,17 @@ func TestCommands(t *testing.T) {
 		"/files/chcid",
 		"/files/cp",
 		"/files/flush",
+		"/files/fsck",
 		"/files/ls",
 		"/files/mkdir",
 		"/files/mv",
 		"/files/read",
 		"/files/rm",
+		"/files/standby",
+		"/files/standby/promote",
+		"/files/standby/status",
 		"/files/stat",
+		"/files/watch",
 		"/files/write",
 		"/filestore",
 		"/filestore/dups",
@@ -146,17 +171,25 @@ func TestCommands(t *testing.T) {
 		"/get",
 		"/id",
 		"/key",
+		"/key/decrypt",
+		"/key/encrypt",
 		"/key/export",
 		"/key/gen",
 		"/key/import",
 		"/key/list",
+		"/key/lock",
 		"/key/rename",
 		"/key/rm",
 		"/key/rotate",
+		"/key/unlock",
 		"/log",
 		"/log/level",
 		"/log/ls",
 		"/log/tail",
+		"/lowpower",
+		"/lowpower/disable",
+		"/lowpower/enable",
+		"/lowpower/status",
 		"/ls",
 		"/mount",
 		"/multibase",
@@ -171,6 +204,7 @@ func TestCommands(t *testing.T) {
 		"/name/pubsub/state",
 		"/name/pubsub/subs",
 		"/name/resolve",
+		"/name/subscribe",
 		"/object",
 		"/object/data",
 		"/object/diff",
@@ -187,6 +221,7 @@ func TestCommands(t *testing.T) {
 		"/p2p",
 		"/p2p/close",
 		"/p2p/forward",
+		"/p2p/http-proxy",
 		"/p2p/listen",
 		"/p2p/ls",
 		"/p2p/stream",
@@ -194,7 +229,14 @@ func TestCommands(t *testing.T) {
 		"/p2p/stream/ls",
 		"/pin",
 		"/pin/add",
+		"/pin/diff",
+		"/pin/expire",
+		"/pin/export",
+		"/pin/follow",
+		"/pin/follow/status",
+		"/pin/follow/sync",
 		"/pin/ls",
+		"/pin/ready",
 		"/pin/remote",
 		"/pin/remote/add",
 		"/pin/remote/ls",
@@ -203,10 +245,16 @@ func TestCommands(t *testing.T) {
 		"/pin/remote/service/add",
 		"/pin/remote/service/ls",
 		"/pin/remote/service/rm",
+		"/pin/remote/sync",
+		"/pin/remote/sync/events",
+		"/pin/remote/sync/now",
+		"/pin/remote/sync/status",
 		"/pin/rm",
 		"/pin/update",
 		"/pin/verify",
 		"/ping",
+		"/provide",
+		"/provide/progress",
 		"/pubsub",
 		"/pubsub/ls",
 		"/pubsub/peers",
@@ -215,8 +263,10 @@ func TestCommands(t *testing.T) {
 		"/refs",
 		"/refs/local",
 		"/repo",
+		"/repo/compress",
 		"/repo/fsck",
 		"/repo/gc",
+		"/repo/migrate-to",
 		"/repo/stat",
 		"/repo/verify",
 		"/repo/version",
@@ -225,15 +275,23 @@ func TestCommands(t *testing.T) {
 		"/stats",
 		"/stats/bitswap",
 		"/stats/bw",
+		"/stats/bw/bitswap",
+		"/stats/bw/history",
+		"/stats/demand",
 		"/stats/dht",
+		"/stats/fetch",
+		"/stats/memory",
 		"/stats/provide",
+		"/stats/publish-queue",
 		"/stats/repo",
+		"/stats/tenants",
 		"/swarm",
 		"/swarm/addrs",
 		"/swarm/addrs/listen",
 		"/swarm/addrs/local",
 		"/swarm/connect",
 		"/swarm/disconnect",
+		"/swarm/events",
 		"/swarm/filters",
 		"/swarm/filters/add",
 		"/swarm/filters/rm",
@@ -244,13 +302,21 @@ func TestCommands(t *testing.T) {
 		"/swarm/peering/ls",
 		"/swarm/peering/rm",
 		"/swarm/stats",
+		"/swarm/tag",
+		"/swarm/tag/ls",
+		"/swarm/tag/rm",
 		"/tar",
 		"/tar/add",
 		"/tar/cat",
 		"/update",
+		"/unixfs",
+		"/unixfs/add-link",
+		"/unixfs/mkdir",
+		"/unixfs/rm-link",
 		"/urlstore",
 		"/urlstore/add",
 		"/version",
+		"/version/check",
 		"/version/deps",
 	}
 
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
@@ -90,6 +91,30 @@ Set the value of the 'Datastore.Path' key:
 		if blocked := matchesGlobPrefix(key, config.PinningConcealSelector); blocked {
 			return errors.New("cannot show or change pinning services credentials")
 		}
+		if blocked := matchesGlobPrefix(key, config.DNSLinkConcealSelector); blocked {
+			return errors.New("cannot show or change dnslink provider credentials")
+		}
+		if blocked := matchesGlobPrefix(key, config.APIAuthConcealSelector); blocked {
+			return errors.New("cannot show or change API authorization secrets")
+		}
+		if blocked := matchesGlobPrefix(key, config.PinFollowConcealSelector); blocked {
+			return errors.New("cannot show or change the secret of the pinset followed")
+		}
+		if blocked := matchesGlobPrefix(key, config.GatewayAccessControlConcealSelector); blocked {
+			return errors.New("cannot show or change the gateway tokens")
+		}
+		if blocked := matchesGlobPrefix(key, config.GatewayPurgeConcealSelector); blocked {
+			return errors.New("cannot show or change the headers of the purge requests")
+		}
+		if blocked := matchesGlobPrefix(key, config.ImportScannerConcealSelector); blocked {
+			return errors.New("cannot show or change the headers of the requests to the scanner")
+		}
+		if blocked := matchesGlobPrefix(key, config.IpnsRemoteKeysConcealSelector); blocked {
+			return errors.New("cannot show or change the headers of the requests to the remote signers")
+		}
+		if blocked := matchesGlobPrefix(key, config.HooksConcealSelector); blocked {
+			return errors.New("cannot show or change the hooks through the API, edit the config file")
+		}
 
 		cfgRoot, err := cmdenv.GetConfigRoot(env)
 		if err != nil {
@@ -212,6 +237,46 @@ NOTE: For security reasons, this command will omit your private key and remote s
 			return err
 		}
 
+		cfg, err = scrubOptionalValue(cfg, config.DNSLinkConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.APIAuthConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.PinFollowConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.GatewayAccessControlConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.GatewayPurgeConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.ImportScannerConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.IpnsRemoteKeysConcealSelector)
+		if err != nil {
+			return err
+		}
+
+		cfg, err = scrubOptionalValue(cfg, config.HooksConcealSelector)
+		if err != nil {
+			return err
+		}
+
 		return cmds.EmitOnce(res, &cfg)
 	},
 	Encoders: cmds.EncoderMap{
@@ -559,6 +624,96 @@ func replaceConfig(r repo.Repo, file io.Reader) error {
 		}
 	}
 
+	// Handle DNSLink.Providers (Params of each provider are secret)
+
+	oldCfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	for name, newProv := range newCfg.DNSLink.Providers {
+		oldProv := oldCfg.DNSLink.Providers[name]
+		if len(newProv.Params) == 0 {
+			// 'config show' omits the params, keep the stored ones
+			newProv.Params = oldProv.Params
+			newCfg.DNSLink.Providers[name] = newProv
+		} else if !reflect.DeepEqual(newProv.Params, oldProv.Params) {
+			return errors.New("cannot change the params of the DNSLink providers with 'config replace', edit the config file")
+		}
+	}
+
+	// Handle API.Authorizations (AuthSecret of each authorization is secret)
+
+	for name, newAuth := range newCfg.API.Authorizations {
+		if newAuth == nil {
+			delete(newCfg.API.Authorizations, name)
+			continue
+		}
+		oldAuth := oldCfg.API.Authorizations[name]
+		if oldAuth == nil {
+			return errors.New("cannot add API authorizations with 'config replace', use 'ipfs auth mint'")
+		}
+		// 'config show' omits the secrets, keep the stored ones
+		if newAuth.AuthSecret != "" && newAuth.AuthSecret != oldAuth.AuthSecret {
+			return errors.New("cannot change API authorization secrets with 'config replace'")
+		}
+		newAuth.AuthSecret = oldAuth.AuthSecret
+	}
+
+	// Handle Pinning.Follow (AuthSecret is secret)
+
+	if newCfg.Pinning.Follow.AuthSecret == "" {
+		newCfg.Pinning.Follow.AuthSecret = oldCfg.Pinning.Follow.AuthSecret
+	}
+
+	// Handle Gateway.AccessControl.Tokens (secret)
+
+	if len(newCfg.Gateway.AccessControl.Tokens) == 0 {
+		// 'config show' omits the tokens, keep the stored ones
+		newCfg.Gateway.AccessControl.Tokens = oldCfg.Gateway.AccessControl.Tokens
+	} else if !reflect.DeepEqual(newCfg.Gateway.AccessControl.Tokens, oldCfg.Gateway.AccessControl.Tokens) {
+		return errors.New("cannot change the gateway tokens with 'config replace', edit the config file")
+	}
+
+	// Handle Gateway.Purge.Headers (they carry the credentials of the caches)
+
+	if len(newCfg.Gateway.Purge.Headers) == 0 {
+		// 'config show' omits the headers, keep the stored ones
+		newCfg.Gateway.Purge.Headers = oldCfg.Gateway.Purge.Headers
+	} else if !reflect.DeepEqual(newCfg.Gateway.Purge.Headers, oldCfg.Gateway.Purge.Headers) {
+		return errors.New("cannot change the headers of the purge requests with 'config replace', edit the config file")
+	}
+
+	// Handle Import.Scanner.Headers (they carry the credentials of the scanner)
+
+	if len(newCfg.Import.Scanner.Headers) == 0 {
+		// 'config show' omits the headers, keep the stored ones
+		newCfg.Import.Scanner.Headers = oldCfg.Import.Scanner.Headers
+	} else if !reflect.DeepEqual(newCfg.Import.Scanner.Headers, oldCfg.Import.Scanner.Headers) {
+		return errors.New("cannot change the headers of the requests to the scanner with 'config replace', edit the config file")
+	}
+
+	// Handle Ipns.RemoteKeys (Headers of each key carry the signer credentials)
+
+	for name, newKey := range newCfg.Ipns.RemoteKeys {
+		oldKey := oldCfg.Ipns.RemoteKeys[name]
+		if len(newKey.Headers) == 0 {
+			// 'config show' omits the headers, keep the stored ones
+			newKey.Headers = oldKey.Headers
+			newCfg.Ipns.RemoteKeys[name] = newKey
+		} else if !reflect.DeepEqual(newKey.Headers, oldKey.Headers) {
+			return errors.New("cannot change the headers of the requests to the remote signers with 'config replace', edit the config file")
+		}
+	}
+
+	// Handle Hooks (they run commands, and carry the webhook credentials)
+
+	if len(newCfg.Hooks.OnPublish) == 0 && len(newCfg.Hooks.OnFilesChange) == 0 && newCfg.Hooks.Timeout == nil {
+		// 'config show' omits the hooks, keep the stored ones
+		newCfg.Hooks = oldCfg.Hooks
+	} else if !reflect.DeepEqual(newCfg.Hooks, oldCfg.Hooks) {
+		return errors.New("cannot change the hooks with 'config replace', edit the config file")
+	}
+
 	return r.SetConfig(&newCfg)
 }
 
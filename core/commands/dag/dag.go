@@ -10,6 +10,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-merkledag/dagutils"
 	ipfspath "github.com/ipfs/go-path"
 	//gipfree "github.com/ipld/go-ipld-prime/impl/free"
 	//gipselector "github.com/ipld/go-ipld-prime/traversal/selector"
@@ -21,6 +22,14 @@ const (
 	progressOptionName = "progress"
 	silentOptionName   = "silent"
 	statsOptionName    = "stats"
+	batchOptionName    = "batch"
+	offsetOptionName   = "offset"
+	lengthOptionName   = "length"
+	blocksOptionName   = "blocks"
+	carOptionName      = "car"
+	statsIntervalName  = "stats-interval"
+	trackOptionName    = "track"
+	intervalOptionName = "interval"
 )
 
 // DagCmd provides a subset of commands for interacting with ipld dag objects
@@ -35,12 +44,14 @@ the existing 'ipfs object' command moving forward.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"put":     DagPutCmd,
-		"get":     DagGetCmd,
-		"resolve": DagResolveCmd,
-		"import":  DagImportCmd,
-		"export":  DagExportCmd,
-		"stat":    DagStatCmd,
+		"put":      DagPutCmd,
+		"get":      DagGetCmd,
+		"resolve":  DagResolveCmd,
+		"import":   DagImportCmd,
+		"export":   DagExportCmd,
+		"stat":     DagStatCmd,
+		"diff":     DagDiffCmd,
+		"progress": DagProgressCmd,
 	},
 }
 
@@ -49,10 +60,13 @@ type OutputObject struct {
 	Cid cid.Cid
 }
 
-// ResolveOutput is the output type of 'dag resolve' command
+// ResolveOutput is the output type of 'dag resolve' command. Ref and Error
+// are only set in batch mode.
 type ResolveOutput struct {
+	Ref     string `json:",omitempty"`
 	Cid     cid.Cid
 	RemPath string
+	Error   string `json:",omitempty"`
 }
 
 type CarImportStats struct {
@@ -60,10 +74,20 @@ type CarImportStats struct {
 	BlockBytesCount uint64
 }
 
+// CarImportProgress is the progress of 'dag import': the blocks imported so
+// far, the CID of the last one, and the roots of the CAR file it is in.
+type CarImportProgress struct {
+	BlockCount      uint64
+	BlockBytesCount uint64
+	Cid             cid.Cid
+	Roots           []cid.Cid `json:",omitempty"`
+}
+
 // CarImportOutput is the output type of the 'dag import' commands
 type CarImportOutput struct {
-	Root  *RootMeta       `json:",omitempty"`
-	Stats *CarImportStats `json:",omitempty"`
+	Root     *RootMeta          `json:",omitempty"`
+	Stats    *CarImportStats    `json:",omitempty"`
+	Progress *CarImportProgress `json:",omitempty"`
 }
 
 // RootMeta is the metadata for a root pinning response
@@ -91,8 +115,9 @@ into an object of the specified format.
 		cmds.StringOption("hash", "Hash function to use").WithDefault("sha2-256"),
 		cmdutils.AllowBigBlockOption,
 	},
-	Run:  dagPut,
-	Type: OutputObject{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run:   dagPut,
+	Type:  OutputObject{},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *OutputObject) error {
 			enc, err := cmdenv.GetLowLevelCidEncoder(req)
@@ -112,6 +137,20 @@ var DagGetCmd = &cmds.Command{
 		ShortDescription: `
 'ipfs dag get' fetches a DAG node from IPFS and prints it out in the specified
 format.
+`,
+		LongDescription: `
+'ipfs dag get' fetches a DAG node from IPFS and prints it out in the specified
+format.
+
+The path is followed across the links of the nodes whatever their codec, so it
+can go from a dag-cbor or dag-json node into a UnixFS directory and on to its
+entries. /ipfs/ paths address the entries of UnixFS directories by name, while
+/ipld/ paths address the fields of dag-pb nodes, such as Links/0/Hash.
+
+With --offset or --length, the path must lead to a UnixFS file or a raw block,
+and the given range of its bytes is printed out instead of the node:
+
+  > ipfs dag get --offset 1024 --length 64 <cid>/dir/file.bin
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -119,6 +158,8 @@ format.
 	},
 	Options: []cmds.Option{
 		cmds.StringOption("output-codec", "Format that the object will be encoded as.").WithDefault("dag-json"),
+		cmds.Int64Option(offsetOptionName, "o", "Byte offset to begin reading the UnixFS file or raw block from."),
+		cmds.Int64Option(lengthOptionName, "l", "Maximum number of bytes of the UnixFS file or raw block to read."),
 	},
 	Run: dagGet,
 }
@@ -129,14 +170,35 @@ var DagResolveCmd = &cmds.Command{
 		Tagline: "Resolve IPLD block.",
 		ShortDescription: `
 'ipfs dag resolve' fetches a DAG node from IPFS, prints its address and remaining path.
+`,
+		LongDescription: `
+'ipfs dag resolve' fetches a DAG node from IPFS, prints its address and remaining path.
+
+With --batch, newline-separated paths are read from stdin and one result is
+streamed per path, in input order. A path that fails to resolve does not
+abort the command; its error is reported in the Error field of its result.
+Use --enc=json to get newline-delimited JSON output.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("ref", true, false, "The path to resolve").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(batchOptionName, "Read newline-separated paths from stdin and stream one result per path."),
+	},
 	Run: dagResolve,
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ResolveOutput) error {
+			batch, _ := req.Options[batchOptionName].(bool)
+			ref := req.Arguments[0]
+			if batch {
+				ref = out.Ref
+				if out.Error != "" {
+					fmt.Fprintf(w, "%s\tError: %s\n", ref, out.Error)
+					return nil
+				}
+			}
+
 			var (
 				enc cidenc.Encoder
 				err error
@@ -144,7 +206,7 @@ var DagResolveCmd = &cmds.Command{
 			switch {
 			case !cmdenv.CidBaseDefined(req):
 				// Not specified, check the path.
-				enc, err = cmdenv.CidEncoderFromPath(req.Arguments[0])
+				enc, err = cmdenv.CidEncoderFromPath(ref)
 				if err == nil {
 					break
 				}
@@ -161,6 +223,10 @@ var DagResolveCmd = &cmds.Command{
 				p = ipfspath.Join([]string{p, out.RemPath})
 			}
 
+			if batch {
+				fmt.Fprintf(w, "%s\t%s\n", ref, p)
+				return nil
+			}
 			fmt.Fprint(w, p)
 			return nil
 		}),
@@ -197,6 +263,19 @@ Note:
   currently present in the blockstore does not represent a complete DAG,
   pinning of that individual root will fail.
 
+  The blocks are verified against their CIDs as they are read, the import
+  failing at the first block whose data does not match. The blocks are
+  written to the blockstore in batches while the next ones are read, the
+  reading waiting for the writes when the blockstore falls behind, so the
+  memory used does not grow with the size of the CAR files.
+
+  With --stats-interval, the number of blocks imported so far, the CID of
+  the last one and the roots of the CAR file it is in are reported at that
+  interval, to follow the import of large CAR files.
+
+  With --track=<name>, the progress of the import is tracked under the
+  given name, for 'ipfs dag progress' to stream it from another request.
+
 Maximum supported CAR version: 1
 `,
 	},
@@ -207,10 +286,13 @@ Maximum supported CAR version: 1
 		cmds.BoolOption(pinRootsOptionName, "Pin optional roots listed in the .car headers after importing.").WithDefault(true),
 		cmds.BoolOption(silentOptionName, "No output."),
 		cmds.BoolOption(statsOptionName, "Output stats."),
+		cmds.StringOption(statsIntervalName, "Output the progress of the import at this interval, e.g. '10s'."),
+		cmds.StringOption(trackOptionName, "Track the progress of the import under this name, see 'ipfs dag progress'."),
 		cmdutils.AllowBigBlockOption,
 	},
-	Type: CarImportOutput{},
-	Run:  dagImport,
+	Type:  CarImportOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run:   dagImport,
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, event *CarImportOutput) error {
 
@@ -219,6 +301,15 @@ Maximum supported CAR version: 1
 				return nil
 			}
 
+			if p := event.Progress; p != nil {
+				enc, err := cmdenv.GetLowLevelCidEncoder(req)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(w, "Importing: %d blocks (%d bytes), last %s\n", p.BlockCount, p.BlockBytesCount, enc.Encode(p.Cid))
+				return err
+			}
+
 			// event should have only one of `Root` or `Stats` set, not both
 			if event.Root == nil {
 				if event.Stats == nil {
@@ -265,6 +356,13 @@ var DagExportCmd = &cmds.Command{
 'ipfs dag export' fetches a DAG and streams it out as a well-formed .car file.
 Note that at present only single root selections / .car files are supported.
 The output of blocks happens in strict DAG-traversal, first-seen, order.
+
+With --track=<name>, the progress of the export is tracked under the given
+name, for 'ipfs dag progress' to stream it from another request while the
+.car data is streamed out:
+
+  $ ipfs dag export --track=backup <cid> > backup.car &
+  $ ipfs dag progress backup
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -272,6 +370,8 @@ The output of blocks happens in strict DAG-traversal, first-seen, order.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(progressOptionName, "p", "Display progress on CLI. Defaults to true when STDERR is a TTY."),
+		cmds.StringOption(trackOptionName, "Track the progress of the export under this name, see 'ipfs dag progress'."),
+		cmdenv.OptionProviders,
 	},
 	Run: dagExport,
 	PostRun: cmds.PostRunMap{
@@ -298,6 +398,9 @@ var DagStatCmd = &cmds.Command{
 Statistics include size and number of blocks.
 
 Note: This command skips duplicate blocks in reporting both size and the number of blocks
+
+With --offline, only the blocks in the local blockstore are read: a missing
+block fails the command with an error of the offline kind, naming the block.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -322,3 +425,113 @@ Note: This command skips duplicate blocks in reporting both size and the number
 		}),
 	},
 }
+
+// DagDiffOutput is the output type of 'dag diff': the changes one by one,
+// then the blocks of the delta.
+type DagDiffOutput struct {
+	Change *DagDiffChange `json:",omitempty"`
+	Blocks *DagDiffBlocks `json:",omitempty"`
+}
+
+// DagDiffChange is a node added, removed or changed at the same path between
+// two DAGs.
+type DagDiffChange struct {
+	Type   dagutils.ChangeType
+	Path   string
+	Before string `json:",omitempty"`
+	After  string `json:",omitempty"`
+}
+
+// DagDiffBlocks are the blocks of the second DAG that are not part of the
+// first one, and the other way around.
+type DagDiffBlocks struct {
+	NumAdded    int
+	NumRemoved  int
+	AddedSize   uint64
+	RemovedSize uint64
+	// Added and Removed are only listed with --blocks
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+// DagDiffCmd is a command for getting the structural delta between two dags
+var DagDiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the structural delta between two DAGs.",
+		ShortDescription: `
+'ipfs dag diff' walks two DAGs together, pairing the links of the nodes at the
+same path, and lists the nodes added, removed or changed between them, then
+the blocks of the second DAG that are not part of the first one, and the other
+way around. With --car, it streams out these added blocks as a .car file
+instead, rooted at the second DAG: importing it next to the first DAG is
+enough to get the second one.
+`,
+		LongDescription: `
+'ipfs dag diff' walks two DAGs together, pairing the links of the nodes at the
+same path, and lists the nodes added, removed or changed between them, then
+the blocks of the second DAG that are not part of the first one, and the other
+way around. Each line of the output describes one change:
+
+  + <cid> <path>
+  - <cid> <path>
+  ~ <old cid> <new cid> <path>
+
+The paths are made of the link names, or of the link indexes for the unnamed
+links, such as the links to the chunks of a UnixFS file. A subtree that only
+exists in one of the DAGs is reported as a single change. A node is reported
+as changed when none of the nodes below it are, or when its data changed.
+
+The subtrees with the same CID at the same path are not walked: a block only
+found below one of them in the other DAG is reported as added, or removed.
+
+With --car, the blocks of the second DAG that are not part of the first one
+are streamed out as a .car file instead, rooted at the second DAG, in the
+order of a depth first walk.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path-a", true, false, "Path of the DAG to diff against."),
+		cmds.StringArg("path-b", true, false, "Path of the DAG to diff."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(blocksOptionName, "b", "List the blocks added and removed, not only their number."),
+		cmds.BoolOption(carOptionName, "Stream out the blocks added as a .car file instead."),
+		cmds.BoolOption(progressOptionName, "p", "Display progress on CLI with --car. Defaults to true when STDERR is a TTY."),
+	},
+	Run:  dagDiff,
+	Type: DagDiffOutput{},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: finishCLIDiff,
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *DagDiffOutput) error {
+			if c := out.Change; c != nil {
+				var err error
+				switch c.Type {
+				case dagutils.Add:
+					_, err = fmt.Fprintf(w, "+ %s %q\n", c.After, c.Path)
+				case dagutils.Remove:
+					_, err = fmt.Fprintf(w, "- %s %q\n", c.Before, c.Path)
+				case dagutils.Mod:
+					_, err = fmt.Fprintf(w, "~ %s %s %q\n", c.Before, c.After, c.Path)
+				}
+				return err
+			}
+
+			b := out.Blocks
+			for _, c := range b.Added {
+				if _, err := fmt.Fprintf(w, "added block %s\n", c); err != nil {
+					return err
+				}
+			}
+			for _, c := range b.Removed {
+				if _, err := fmt.Fprintf(w, "removed block %s\n", c); err != nil {
+					return err
+				}
+			}
+			_, err := fmt.Fprintf(w, "%d blocks added (%d bytes), %d blocks removed (%d bytes)\n",
+				b.NumAdded, b.AddedSize, b.NumRemoved, b.RemovedSize)
+			return err
+		}),
+	},
+}
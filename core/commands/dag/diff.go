@@ -0,0 +1,108 @@
+package dagcmd
+
+import (
+	"errors"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	gocar "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+)
+
+func dagDiff(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return err
+	}
+	capi, ok := api.(*coreapi.CoreAPI)
+	if !ok {
+		return errors.New("diffing DAGs is not supported by this node")
+	}
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return err
+	}
+
+	b, err := api.ResolvePath(req.Context, path.New(req.Arguments[1]))
+	if err != nil {
+		return err
+	}
+	delta, err := capi.DagDiff(req.Context, path.New(req.Arguments[0]), b)
+	if err != nil {
+		return err
+	}
+
+	if car, _ := req.Options[carOptionName].(bool); car {
+		pipeR, pipeW := io.Pipe()
+		go func() {
+			pipeW.CloseWithError(writeDiffCar(req, api.Dag(), b.Cid(), delta.Added, pipeW))
+		}()
+		if err := res.Emit(pipeR); err != nil {
+			pipeR.Close() // ignore the error if any
+			return err
+		}
+		return nil
+	}
+
+	for _, c := range delta.Changes {
+		out := &DagDiffChange{Type: c.Type, Path: c.Path}
+		if c.Before.Defined() {
+			out.Before = enc.Encode(c.Before)
+		}
+		if c.After.Defined() {
+			out.After = enc.Encode(c.After)
+		}
+		if err := res.Emit(&DagDiffOutput{Change: out}); err != nil {
+			return err
+		}
+	}
+
+	blocks := &DagDiffBlocks{
+		NumAdded:    len(delta.Added),
+		NumRemoved:  len(delta.Removed),
+		AddedSize:   delta.AddedSize,
+		RemovedSize: delta.RemovedSize,
+	}
+	if listBlocks, _ := req.Options[blocksOptionName].(bool); listBlocks {
+		blocks.Added = make([]string, len(delta.Added))
+		for i, c := range delta.Added {
+			blocks.Added[i] = enc.Encode(c)
+		}
+		blocks.Removed = make([]string, len(delta.Removed))
+		for i, c := range delta.Removed {
+			blocks.Removed[i] = enc.Encode(c)
+		}
+	}
+	return res.Emit(&DagDiffOutput{Blocks: blocks})
+}
+
+// writeDiffCar writes a .car file of the blocks, rooted at root, to w.
+func writeDiffCar(req *cmds.Request, dag ipld.NodeGetter, root cid.Cid, blocks []cid.Cid, w io.Writer) error {
+	err := gocar.WriteHeader(&gocar.CarHeader{Roots: []cid.Cid{root}, Version: 1}, w)
+	if err != nil {
+		return err
+	}
+	for _, c := range blocks {
+		nd, err := dag.Get(req.Context, c)
+		if err != nil {
+			return err
+		}
+		if err := carutil.LdWrite(w, c.Bytes(), nd.RawData()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func finishCLIDiff(res cmds.Response, re cmds.ResponseEmitter) error {
+	if car, _ := res.Request().Options[carOptionName].(bool); car {
+		return finishCLIExport(res, re)
+	}
+	return cmds.Copy(re, res)
+}
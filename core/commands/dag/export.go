@@ -11,6 +11,7 @@ import (
 	"github.com/cheggaaa/pb"
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/carprogress"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	ipld "github.com/ipfs/go-ipld-format"
 	iface "github.com/ipfs/interface-go-ipfs-core"
@@ -20,7 +21,7 @@ import (
 	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
 )
 
-func dagExport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+func dagExport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) (err error) {
 	c, err := cid.Decode(req.Arguments[0])
 	if err != nil {
 		return fmt.Errorf(
@@ -33,6 +34,23 @@ func dagExport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 	if err != nil {
 		return err
 	}
+	if err := cmdenv.ConnectProviders(req, api); err != nil {
+		return err
+	}
+
+	var t *carprogress.Tracker
+	if name, ok := req.Options[trackOptionName].(string); ok {
+		node, envErr := cmdenv.GetNode(env)
+		if envErr != nil {
+			return envErr
+		}
+		t = carprogress.New(carprogress.Export)
+		t.SetRoots([]cid.Cid{c})
+		if err := node.CarProgress.Track(name, t); err != nil {
+			return err
+		}
+		defer func() { node.CarProgress.Done(name, err) }()
+	}
 
 	pipeR, pipeW := io.Pipe()
 
@@ -50,7 +68,14 @@ func dagExport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 		// TraverseLinksOnlyOnce is safe for an exhaustive selector but won't be when we allow
 		// arbitrary selectors here
 		car := gocar.NewSelectiveCar(req.Context, store, []gocar.Dag{dag}, gocar.TraverseLinksOnlyOnce())
-		if err := car.Write(pipeW); err != nil {
+		var onBlocks []gocar.OnNewCarBlockFunc
+		if t != nil {
+			onBlocks = append(onBlocks, func(b gocar.Block) error {
+				t.Block(b.BlockCID, len(b.Data))
+				return nil
+			})
+		}
+		if err := car.Write(pipeW, onBlocks...); err != nil {
 			errCh <- err
 		}
 	}()
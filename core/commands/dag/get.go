@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"io"
 
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	ipldlegacy "github.com/ipfs/go-ipld-legacy"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/path"
 
 	"github.com/ipld/go-ipld-prime"
@@ -28,11 +31,27 @@ func dagGet(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) e
 		return err
 	}
 
+	offset, hasOffset := req.Options[offsetOptionName].(int64)
+	if offset < 0 {
+		return fmt.Errorf("cannot specify negative offset")
+	}
+	length, hasLength := req.Options[lengthOptionName].(int64)
+	if length < 0 {
+		return fmt.Errorf("cannot specify negative length")
+	}
+	if !hasLength {
+		length = -1
+	}
+
 	rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
 	if err != nil {
 		return err
 	}
 
+	if hasOffset || hasLength {
+		return dagGetBytes(req, res, api, rp, offset, length)
+	}
+
 	obj, err := api.Dag().Get(req.Context, rp.Cid())
 	if err != nil {
 		return err
@@ -69,3 +88,52 @@ func dagGet(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) e
 
 	return res.Emit(r)
 }
+
+// dagGetBytes emits up to length bytes (all if negative) of the UnixFS file or
+// raw block at rp, from offset.
+func dagGetBytes(req *cmds.Request, res cmds.ResponseEmitter, api coreiface.CoreAPI, rp path.Resolved, offset, length int64) error {
+	switch rp.Cid().Type() {
+	case cid.DagProtobuf, cid.Raw:
+	default:
+		return fmt.Errorf("cannot read bytes from %s: not a UnixFS file or raw block", rp)
+	}
+	if len(rp.Remainder()) > 0 {
+		return fmt.Errorf("cannot read bytes from %s: path goes into the fields of %s", rp, rp.Cid())
+	}
+
+	nd, err := api.Unixfs().Get(req.Context, rp)
+	if err != nil {
+		return err
+	}
+	file, ok := nd.(files.File)
+	if !ok {
+		nd.Close()
+		return fmt.Errorf("cannot read bytes from %s: not a UnixFS file", rp)
+	}
+
+	size, err := file.Size()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if offset > size {
+		offset = size
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return err
+	}
+	size -= offset
+	if length >= 0 && length < size {
+		size = length
+	}
+
+	res.SetLength(uint64(size))
+	r, w := io.Pipe()
+	go func() {
+		defer file.Close()
+		_, err := io.CopyN(w, file, size)
+		_ = w.CloseWithError(err)
+	}()
+	return res.Emit(r)
+}
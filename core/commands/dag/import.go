@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	cid "github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/carprogress"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 	ipld "github.com/ipfs/go-ipld-format"
@@ -17,7 +19,7 @@ import (
 	gocarv2 "github.com/ipld/go-car/v2"
 )
 
-func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) (err error) {
 
 	node, err := cmdenv.GetNode(env)
 	if err != nil {
@@ -48,8 +50,28 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 
 	doPinRoots, _ := req.Options[pinRootsOptionName].(bool)
 
+	var statsInterval time.Duration
+	if s, ok := req.Options[statsIntervalName].(string); ok {
+		statsInterval, err = time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", statsIntervalName, err)
+		}
+		if statsInterval <= 0 {
+			return fmt.Errorf("%s must be positive", statsIntervalName)
+		}
+	}
+
+	var t *carprogress.Tracker
+	if name, ok := req.Options[trackOptionName].(string); ok {
+		t = carprogress.New(carprogress.Import)
+		if err := node.CarProgress.Track(name, t); err != nil {
+			return err
+		}
+		defer func() { node.CarProgress.Done(name, err) }()
+	}
+
 	retCh := make(chan importResult, 1)
-	go importWorker(req, res, api, retCh)
+	go importWorker(req, res, api, statsInterval, t, retCh)
 
 	done := <-retCh
 	if done.err != nil {
@@ -132,15 +154,18 @@ func dagImport(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment
 	return nil
 }
 
-func importWorker(req *cmds.Request, re cmds.ResponseEmitter, api iface.CoreAPI, ret chan importResult) {
+func importWorker(req *cmds.Request, re cmds.ResponseEmitter, api iface.CoreAPI, statsInterval time.Duration, t *carprogress.Tracker, ret chan importResult) {
 
 	// this is *not* a transaction
 	// it is simply a way to relieve pressure on the blockstore
 	// similar to pinner.Pin/pinner.Flush
+	// it commits in the background, Add blocking once the commits in flight
+	// fill its buffer, so that the reading waits for the blockstore
 	batch := ipld.NewBatch(req.Context, api.Dag())
 
 	roots := make(map[cid.Cid]struct{})
 	var blockCount, blockBytesCount uint64
+	lastStats := time.Now()
 
 	it := req.Files.Entries()
 	for it.Next() {
@@ -168,11 +193,14 @@ func importWorker(req *cmds.Request, re cmds.ResponseEmitter, api iface.CoreAPI,
 			for _, c := range car.Roots {
 				roots[c] = struct{}{}
 			}
+			if t != nil {
+				t.SetRoots(car.Roots)
+			}
 
-			for {
+			for fileBlocks := 1; ; fileBlocks++ {
 				block, err := car.Next()
 				if err != nil && err != io.EOF {
-					return err
+					return fmt.Errorf("block %d of %s: %w", fileBlocks, it.Name(), err)
 				} else if block == nil {
 					break
 				}
@@ -183,7 +211,7 @@ func importWorker(req *cmds.Request, re cmds.ResponseEmitter, api iface.CoreAPI,
 				// the double-decode is suboptimal, but we need it for batching
 				nd, err := ipld.Decode(block)
 				if err != nil {
-					return err
+					return fmt.Errorf("block %d of %s: %w", fileBlocks, it.Name(), err)
 				}
 
 				if err := batch.Add(req.Context, nd); err != nil {
@@ -191,6 +219,24 @@ func importWorker(req *cmds.Request, re cmds.ResponseEmitter, api iface.CoreAPI,
 				}
 				blockCount++
 				blockBytesCount += uint64(len(block.RawData()))
+				if t != nil {
+					t.Block(block.Cid(), len(block.RawData()))
+				}
+
+				if statsInterval > 0 && time.Since(lastStats) >= statsInterval {
+					lastStats = time.Now()
+					err := re.Emit(&CarImportOutput{
+						Progress: &CarImportProgress{
+							BlockCount:      blockCount,
+							BlockBytesCount: blockBytesCount,
+							Cid:             block.Cid(),
+							Roots:           car.Roots,
+						},
+					})
+					if err != nil {
+						return err
+					}
+				}
 			}
 
 			return nil
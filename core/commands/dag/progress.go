@@ -0,0 +1,101 @@
+package dagcmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/carprogress"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+)
+
+// DagProgressCmd streams the progress of a CAR import or export tracked by
+// name.
+var DagProgressCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the progress of a .car import or export tracked by name.",
+		ShortDescription: `
+'ipfs dag progress' streams the progress of the import or export tracked under
+the given name by 'ipfs dag import --track' or 'ipfs dag export --track',
+every --interval until it is done.
+`,
+		LongDescription: `
+'ipfs dag progress' streams the progress of the import or export tracked under
+the given name by 'ipfs dag import --track' or 'ipfs dag export --track',
+every --interval until it is done:
+
+  Op        import or export
+  Blocks    number of blocks imported or exported, and Bytes their size
+  Roots     roots of the .car file being imported, or of the DAG exported
+  Cid       last block imported or exported
+  Rate      bytes per second
+  Elapsed   seconds since the operation started
+  Done      whether the operation is done
+  Error     why the operation failed, once done
+
+As the .car data of an export is streamed out in the response of 'ipfs dag
+export', its progress is followed from another request, as newline-delimited
+JSON with --enc=json, or over HTTP:
+
+  $ curl -X POST "http://127.0.0.1:5001/api/v0/dag/export?arg=<cid>&track=backup" > backup.car &
+  $ curl -X POST "http://127.0.0.1:5001/api/v0/dag/progress?arg=backup"
+
+The progress of the last operations done is kept, so the command can be
+started after the operation.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name the import or export is tracked under."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(intervalOptionName, "Time between the progress reports.").WithDefault("1s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		interval, err := time.ParseDuration(req.Options[intervalOptionName].(string))
+		if err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return fmt.Errorf("--%s must be positive", intervalOptionName)
+		}
+		t, ok := nd.CarProgress.Get(req.Arguments[0])
+		if !ok {
+			return fmt.Errorf("no .car import or export tracked as %q", req.Arguments[0])
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ev := t.Progress()
+			if err := res.Emit(&ev); err != nil || ev.Done {
+				return err
+			}
+			select {
+			case <-ticker.C:
+			case <-req.Context.Done():
+				return req.Context.Err()
+			}
+		}
+	},
+	Type: carprogress.Event{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *carprogress.Event) error {
+			s := fmt.Sprintf("%s: %d blocks (%s, %s/s)", ev.Op, ev.Blocks, humanize.Bytes(ev.Bytes), humanize.Bytes(uint64(ev.Rate)))
+			elapsed := time.Duration(ev.Elapsed * float64(time.Second)).Round(time.Second)
+			switch {
+			case ev.Error != "":
+				s += fmt.Sprintf(", failed after %s: %s", elapsed, ev.Error)
+			case ev.Done:
+				s += fmt.Sprintf(", done in %s", elapsed)
+			}
+			_, err := fmt.Fprintln(w, s)
+			return err
+		}),
+	},
+}
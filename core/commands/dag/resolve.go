@@ -1,7 +1,10 @@
 package dagcmd
 
 import (
+	"strings"
+
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/path"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
@@ -13,6 +16,10 @@ func dagResolve(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environmen
 		return err
 	}
 
+	if batch, _ := req.Options[batchOptionName].(bool); batch {
+		return dagResolveBatch(req, res, api)
+	}
+
 	rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
 	if err != nil {
 		return err
@@ -23,3 +30,43 @@ func dagResolve(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environmen
 		RemPath: rp.Remainder(),
 	})
 }
+
+// dagResolveBatch resolves every path found in the arguments and on stdin,
+// emitting one result per path. Resolution failures are reported per path
+// and do not abort the command.
+func dagResolveBatch(req *cmds.Request, res cmds.ResponseEmitter, api coreiface.CoreAPI) error {
+	refs := req.Arguments
+	body := req.BodyArgs()
+	for {
+		var ref string
+		if len(refs) > 0 {
+			ref, refs = refs[0], refs[1:]
+		} else if body != nil && body.Scan() {
+			ref = strings.TrimSpace(body.Argument())
+		} else {
+			break
+		}
+		if ref == "" {
+			continue
+		}
+		if err := req.Context.Err(); err != nil {
+			return err
+		}
+
+		out := &ResolveOutput{Ref: ref}
+		rp, err := api.ResolvePath(req.Context, path.New(ref))
+		if err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Cid = rp.Cid()
+			out.RemPath = rp.Remainder()
+		}
+		if err := res.Emit(out); err != nil {
+			return err
+		}
+	}
+	if body != nil {
+		return body.Err()
+	}
+	return nil
+}
@@ -24,7 +24,7 @@ func dagStat(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment)
 
 	rp, err := api.ResolvePath(req.Context, path.New(req.Arguments[0]))
 	if err != nil {
-		return err
+		return cmdenv.OfflineError(req, err)
 	}
 
 	if len(rp.Remainder()) > 0 {
@@ -34,7 +34,7 @@ func dagStat(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment)
 	nodeGetter := mdag.NewSession(req.Context, api.Dag())
 	obj, err := nodeGetter.Get(req.Context, rp.Cid())
 	if err != nil {
-		return err
+		return cmdenv.OfflineError(req, err)
 	}
 
 	dagstats := &DagStat{}
@@ -56,7 +56,7 @@ func dagStat(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment)
 		SkipDuplicates: true,
 	})
 	if err != nil {
-		return fmt.Errorf("error traversing DAG: %w", err)
+		return cmdenv.OfflineError(req, fmt.Errorf("error traversing DAG: %w", err))
 	}
 
 	if !progressive {
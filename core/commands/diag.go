@@ -10,8 +10,11 @@ var DiagCmd = &cmds.Command{
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"sys":     sysDiagCmd,
-		"cmds":    ActiveReqsCmd,
-		"profile": sysProfileCmd,
+		"sys":          sysDiagCmd,
+		"cmds":         ActiveReqsCmd,
+		"profile":      sysProfileCmd,
+		"history":      diagHistoryCmd,
+		"speedtest":    diagSpeedTestCmd,
+		"availability": diagAvailabilityCmd,
 	},
 }
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/availability"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	availabilityLeavesOptionName  = "leaves"
+	availabilityTimeoutOptionName = "probe-timeout"
+
+	// availabilityProbes bounds the providers probed at once.
+	availabilityProbes = 8
+)
+
+// AvailabilityOutput is the output of "diag availability": the probe of each
+// provider, then a summary.
+type AvailabilityOutput struct {
+	Text     string               `json:",omitempty"`
+	Provider *availability.Result `json:",omitempty"`
+}
+
+var diagAvailabilityCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check that the providers of a DAG serve it to other peers.",
+		ShortDescription: `
+'ipfs diag availability' finds the providers of a CID, and fetches the root
+and a sample of the leaves of its DAG from each of them, reporting which
+serve it and how fast.
+`,
+		LongDescription: `
+'ipfs diag availability' finds the providers of a CID, and fetches the root
+and a sample of the leaves of its DAG from each of them, reporting which
+serve it and how fast. It tells whether content is actually retrievable by
+others: a provider record alone does not mean the provider is reachable, nor
+that it still has all the blocks.
+
+Each provider is probed from a new libp2p host with a random identity, apart
+from the node and its connections, which asks for the blocks over bitswap from
+this provider only. The leaves are sampled by random walks down the DAG, so
+only the blocks on the way are fetched, however large the DAG is. The
+providers answering that they do not have a block are reported as such,
+rather than waiting for the timeout. The node itself is probed too when it
+provides the CID, over its own addresses.
+
+The probe of each provider, from connecting to it to the last leaf, is bounded
+by --probe-timeout. The command fails when none of the providers serve the
+root and all the leaves sampled.
+
+Example:
+
+    > ipfs diag availability bafybeig...
+    12D3KooWA...: available
+      Address:  /ip4/192.0.2.1/tcp/4001 (latency 35.20ms)
+      Root:     ok in 80.12ms
+      Leaves:   5 of 5 ok, in 95.40ms on average
+    12D3KooWB...: unreachable: failed to dial: ...
+    1 of 2 providers serve the root and the leaves sampled
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("cid", true, false, "CID of the DAG to check."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(numProvidersOptionName, "n", "The number of providers to probe.").WithDefault(20),
+		cmds.IntOption(availabilityLeavesOptionName, "l", "The number of leaves sampled from each provider.").WithDefault(5),
+		cmds.StringOption(availabilityTimeoutOptionName, "t", "Timeout of the probe of each provider.").WithDefault("1m"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		c, err := cid.Parse(req.Arguments[0])
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid CID: %s", err)
+		}
+		numProviders, _ := req.Options[numProvidersOptionName].(int)
+		if numProviders < 1 {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be positive, was %d", numProvidersOptionName, numProviders)
+		}
+		leaves, _ := req.Options[availabilityLeavesOptionName].(int)
+		if leaves < 0 {
+			return cmds.Errorf(cmds.ErrClient, "--%s must not be negative, was %d", availabilityLeavesOptionName, leaves)
+		}
+		timeoutStr, _ := req.Options[availabilityTimeoutOptionName].(string)
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", availabilityTimeoutOptionName, err)
+		}
+		if timeout <= 0 {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be positive, was %s", availabilityTimeoutOptionName, timeout)
+		}
+
+		ctx, cancel := context.WithCancel(req.Context)
+		defer cancel()
+		opts := availability.Options{Leaves: leaves, Timeout: timeout}
+		results := make(chan *availability.Result)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, availabilityProbes)
+		for p := range n.Routing.FindProvidersAsync(ctx, c, numProviders) {
+			switch {
+			case p.ID == n.Identity:
+				p.Addrs = n.PeerHost.Addrs()
+			case len(p.Addrs) == 0:
+				p.Addrs = n.Peerstore.Addrs(p.ID)
+			}
+			if len(p.Addrs) == 0 {
+				fctx, cancel := context.WithTimeout(ctx, kPingTimeout)
+				if found, err := n.Routing.FindPeer(fctx, p.ID); err == nil {
+					p.Addrs = found.Addrs
+				}
+				cancel()
+			}
+			wg.Add(1)
+			go func(p peer.AddrInfo) {
+				defer wg.Done()
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-sem }()
+				select {
+				case results <- availability.Probe(ctx, newProbeHost, p, c, opts):
+				case <-ctx.Done():
+				}
+			}(p)
+		}
+		go func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		probed, available := 0, 0
+		for r := range results {
+			probed++
+			if r.Available() {
+				available++
+			}
+			if err := res.Emit(&AvailabilityOutput{Provider: r}); err != nil {
+				return err
+			}
+		}
+		if err := req.Context.Err(); err != nil {
+			return err
+		}
+		if probed == 0 {
+			return fmt.Errorf("no providers found for %s", c)
+		}
+		if err := res.Emit(&AvailabilityOutput{
+			Text: fmt.Sprintf("%d of %d providers serve the root and the leaves sampled", available, probed),
+		}); err != nil {
+			return err
+		}
+		if available == 0 {
+			return fmt.Errorf("none of the %d providers serve %s", probed, c)
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AvailabilityOutput) error {
+			r := out.Provider
+			if r == nil {
+				fmt.Fprintln(w, out.Text)
+				return nil
+			}
+			switch {
+			case r.Root == nil:
+				fmt.Fprintf(w, "%s: unreachable: %s\n", r.Peer, r.Error)
+				return nil
+			case r.Available():
+				fmt.Fprintf(w, "%s: available\n", r.Peer)
+			default:
+				fmt.Fprintf(w, "%s: unavailable\n", r.Peer)
+			}
+			if r.Latency > 0 {
+				fmt.Fprintf(w, "  Address:  %s (latency %.2fms)\n", r.Addr, ms(r.Latency))
+			} else {
+				fmt.Fprintf(w, "  Address:  %s\n", r.Addr)
+			}
+			if r.Root.Error != "" {
+				fmt.Fprintf(w, "  Root:     %s after %.2fms\n", r.Root.Error, ms(r.Root.Duration))
+				return nil
+			}
+			fmt.Fprintf(w, "  Root:     ok in %.2fms\n", ms(r.Root.Duration))
+			if len(r.Leaves) == 0 {
+				return nil
+			}
+			ok := 0
+			var total time.Duration
+			for _, l := range r.Leaves {
+				if l.Error == "" {
+					ok++
+					total += l.Duration
+				}
+			}
+			if ok > 0 {
+				fmt.Fprintf(w, "  Leaves:   %d of %d ok, in %.2fms on average\n", ok, len(r.Leaves), ms(total/time.Duration(ok)))
+			} else {
+				fmt.Fprintf(w, "  Leaves:   0 of %d ok\n", len(r.Leaves))
+			}
+			for _, l := range r.Leaves {
+				if l.Error != "" {
+					fmt.Fprintf(w, "    %s: %s\n", l.Cid, l.Error)
+				}
+			}
+			return nil
+		}),
+	},
+	Type: AvailabilityOutput{},
+}
+
+// newProbeHost returns a libp2p host with a random identity, not listening,
+// to probe a provider apart from the node.
+func newProbeHost() (host.Host, error) {
+	sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return libp2p.New(libp2p.Identity(sk), libp2p.NoListenAddrs)
+}
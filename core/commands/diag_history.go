@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/profhistory"
+)
+
+const diagHistoryTopOptionName = "top"
+
+// DiagHistoryOutput is the output of "diag history".
+type DiagHistoryOutput struct {
+	// Dir is the directory of the snapshots
+	Dir       string
+	Snapshots []profhistory.Snapshot
+}
+
+var diagHistoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the history of the profiles taken on a schedule.",
+		ShortDescription: `
+'ipfs diag history' prints the timeline of the snapshots of the CPU, heap and
+goroutine profiles the daemon takes when Profiling.Enabled is set.
+`,
+		LongDescription: `
+'ipfs diag history' prints the timeline of the snapshots of the CPU, heap and
+goroutine profiles the daemon takes when Profiling.Enabled is set, every
+Profiling.Interval. It helps to diagnose the memory growth and the goroutine
+leaks which only show after days of uptime, while 'ipfs diag profile' takes
+the profiles once, on demand.
+
+Each snapshot shows the memory in use and the number of goroutines, followed,
+for the latest snapshot, by the functions which started the most goroutines
+and which allocated the most memory in use, with their change since the
+oldest snapshot. Use --top to print more or fewer functions, and --enc=json
+for the full summaries.
+
+The snapshots are kept in Profiling.Path, 'profiles' in the repo by default,
+the oldest ones being removed past Profiling.MaxSnapshots. The history is
+also read when the daemon is not running. The profiles of a snapshot can be
+examined with 'go tool pprof', from the directory or from the API of the
+daemon:
+
+  > go tool pprof http://127.0.0.1:5001/debug/profiles/<snapshot>/heap.pprof
+
+The timeline is also served as JSON at /debug/profiles/ on the API.
+
+Example:
+
+    > ipfs diag history
+    Time                 Uptime  Goroutines  Heap    Sys
+    2021-06-01 12:00:00  1m0s    312         52 MB   140 MB
+    2021-06-01 13:00:00  1h1m0s  4210        310 MB  480 MB
+
+    Goroutines by function (2021-06-01 13:00:00):
+      3811  +3500  github.com/libp2p/go-libp2p-swarm.(*Conn).start.func1
+    ...
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(statSinceOptionName, "s", "Only print the snapshots of the last period, such as '24h'."),
+		cmds.IntOption(diagHistoryTopOptionName, "Number of functions printed for the latest snapshot.").WithDefault(5),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var since time.Time
+		if s, ok := req.Options[statSinceOptionName].(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", statSinceOptionName, err)
+			}
+			since = time.Now().Add(-d)
+		}
+		top, _ := req.Options[diagHistoryTopOptionName].(int)
+		if top < 0 {
+			return cmds.Errorf(cmds.ErrClient, "--%s cannot be negative", diagHistoryTopOptionName)
+		}
+
+		var dir string
+		if nd.ProfileHistory != nil {
+			dir = nd.ProfileHistory.Settings().Dir
+		} else {
+			// without a daemon, the history is read from the disk
+			cfg, err := nd.Repo.Config()
+			if err != nil {
+				return err
+			}
+			if !cfg.Profiling.Enabled.WithDefault(false) {
+				return errors.New("profiling disabled in config (Profiling.Enabled)")
+			}
+			if dir, err = node.ProfilingDir(cfg.Profiling); err != nil {
+				return err
+			}
+		}
+		snapshots, err := profhistory.Load(dir)
+		if err != nil {
+			return err
+		}
+
+		out := &DiagHistoryOutput{Dir: dir, Snapshots: []profhistory.Snapshot{}}
+		for _, s := range snapshots {
+			if s.Time.After(since) {
+				out.Snapshots = append(out.Snapshots, s)
+			}
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *DiagHistoryOutput) error {
+			if len(out.Snapshots) == 0 {
+				fmt.Fprintf(w, "no snapshot in %s yet\n", out.Dir)
+				return nil
+			}
+
+			wtr := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+			fmt.Fprintln(wtr, "Time\tUptime\tGoroutines\tHeap\tSys")
+			for _, s := range out.Snapshots {
+				fmt.Fprintf(wtr, "%s\t%s\t%d\t%s\t%s\n",
+					s.Time.Local().Format("2006-01-02 15:04:05"),
+					s.Uptime.Round(time.Second),
+					s.Goroutines,
+					humanize.Bytes(s.HeapInuse),
+					humanize.Bytes(s.Sys),
+				)
+			}
+			if err := wtr.Flush(); err != nil {
+				return err
+			}
+
+			// the latest tops, compared with the oldest snapshot
+			top, _ := req.Options[diagHistoryTopOptionName].(int)
+			first, last := out.Snapshots[0], out.Snapshots[len(out.Snapshots)-1]
+			when := last.Time.Local().Format("2006-01-02 15:04:05")
+			if err := writeTop(w, "Goroutines by function ("+when+")", last.TopGoroutines, first.TopGoroutines, top, func(v int64) string {
+				return fmt.Sprint(v)
+			}); err != nil {
+				return err
+			}
+			return writeTop(w, "Heap in use by function ("+when+")", last.TopHeap, first.TopHeap, top, func(v int64) string {
+				if v < 0 {
+					return "-" + humanize.Bytes(uint64(-v))
+				}
+				return humanize.Bytes(uint64(v))
+			})
+		}),
+	},
+	Type: DiagHistoryOutput{},
+}
+
+// writeTop writes the first n entries of a top, with their change since the
+// top before.
+func writeTop(w io.Writer, title string, entries, before []profhistory.Entry, n int, format func(int64) string) error {
+	if n == 0 || len(entries) == 0 {
+		return nil
+	}
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	prev := make(map[string]int64, len(before))
+	for _, e := range before {
+		prev[e.Function] = e.Value
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	wtr := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+	for _, e := range entries {
+		change := "+" + format(e.Value-prev[e.Function])
+		if e.Value < prev[e.Function] {
+			change = format(e.Value - prev[e.Function])
+		}
+		fmt.Fprintf(wtr, "  %s\t%s\t%s\n", format(e.Value), change, e.Function)
+	}
+	return wtr.Flush()
+}
@@ -0,0 +1,146 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/speedtest"
+	pstore "github.com/libp2p/go-libp2p-core/peerstore"
+)
+
+const (
+	speedTestDurationOptionName = "duration"
+	speedTestStreamsOptionName  = "streams"
+
+	// speedTestMaxStreams bounds the streams of a test.
+	speedTestMaxStreams = 64
+)
+
+// SpeedTestOutput is the output of "diag speedtest": the steps of the test,
+// then its result.
+type SpeedTestOutput struct {
+	Text   string            `json:",omitempty"`
+	Result *speedtest.Result `json:",omitempty"`
+}
+
+var diagSpeedTestCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Measure the latency and the throughput to a peer.",
+		ShortDescription: `
+'ipfs diag speedtest' measures the latency and the download and upload
+throughput of the connection to a peer serving the speed test, as enabled by
+Swarm.SpeedTest.Enabled.
+`,
+		LongDescription: `
+'ipfs diag speedtest' measures the latency and the download and upload
+throughput of the connection to a peer serving the speed test, as enabled by
+Swarm.SpeedTest.Enabled in its config, the test failing with "protocol not
+supported" otherwise. The peer is given by its ID, found with the routing
+system, or by its multiaddr.
+
+The latency is measured with 10 pings. The download and the upload are then
+measured in turn, over --streams streams at once for --duration, which the
+peer caps with Swarm.SpeedTest.MaxDuration. The data goes over libp2p only,
+apart from bitswap: when fetching from a peer is slower than its speed test,
+the transfer is slowed by bitswap or by the peer providing the data, not by
+the network. 'ipfs stats bw --proto /ipfs/bitswap/1.2.0' shows the rate of
+bitswap for comparison.
+
+Example:
+
+    > ipfs diag speedtest --duration=10s 12D3KooW...
+    Testing 12D3KooW... for 10s over 4 streams
+    Address:   /ip4/192.0.2.1/tcp/4001
+    Latency:   min=1.20ms avg=1.45ms max=2.10ms
+    Download:  11 MB/s (112 MB in 10s)
+    Upload:    9.8 MB/s (98 MB in 10s)
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "ID or multiaddr of the peer to test."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(speedTestDurationOptionName, "d", "Duration of the download and upload tests.").WithDefault("10s"),
+		cmds.IntOption(speedTestStreamsOptionName, "s", "Number of streams of the download and upload tests.").WithDefault(4),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+
+		addr, pid, err := ParsePeerParam(req.Arguments[0])
+		if err != nil {
+			return fmt.Errorf("failed to parse peer address '%s': %s", req.Arguments[0], err)
+		}
+		if pid == n.Identity {
+			return fmt.Errorf("cannot test the speed to self")
+		}
+		durationStr, _ := req.Options[speedTestDurationOptionName].(string)
+		duration, err := time.ParseDuration(durationStr)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", speedTestDurationOptionName, err)
+		}
+		if duration <= 0 {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be positive, was %s", speedTestDurationOptionName, duration)
+		}
+		streams, _ := req.Options[speedTestStreamsOptionName].(int)
+		if streams <= 0 || streams > speedTestMaxStreams {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be between 1 and %d, was %d", speedTestStreamsOptionName, speedTestMaxStreams, streams)
+		}
+
+		if addr != nil {
+			n.Peerstore.AddAddr(pid, addr, pstore.TempAddrTTL)
+		}
+		if len(n.Peerstore.Addrs(pid)) == 0 {
+			ctx, cancel := context.WithTimeout(req.Context, kPingTimeout)
+			p, err := n.Routing.FindPeer(ctx, pid)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("peer lookup failed: %s", err)
+			}
+			n.Peerstore.AddAddrs(p.ID, p.Addrs, pstore.TempAddrTTL)
+		}
+
+		if err := res.Emit(&SpeedTestOutput{
+			Text: fmt.Sprintf("Testing %s for %s over %d streams", pid, duration, streams),
+		}); err != nil {
+			return err
+		}
+		result, err := speedtest.Run(req.Context, n.PeerHost, pid, speedtest.Options{
+			Duration: duration,
+			Streams:  streams,
+		})
+		if err != nil {
+			return err
+		}
+		return res.Emit(&SpeedTestOutput{Result: result})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SpeedTestOutput) error {
+			r := out.Result
+			if r == nil {
+				fmt.Fprintln(w, out.Text)
+				return nil
+			}
+			fmt.Fprintf(w, "Address:   %s\n", r.Addr)
+			fmt.Fprintf(w, "Latency:   min=%.2fms avg=%.2fms max=%.2fms\n", ms(r.MinLatency), ms(r.AvgLatency), ms(r.MaxLatency))
+			fmt.Fprintf(w, "Download:  %s\n", formatTransfer(r.Download))
+			fmt.Fprintf(w, "Upload:    %s\n", formatTransfer(r.Upload))
+			return nil
+		}),
+	},
+	Type: SpeedTestOutput{},
+}
+
+func formatTransfer(t speedtest.Transfer) string {
+	return fmt.Sprintf("%s/s (%s in %s)", humanize.Bytes(uint64(t.Rate)), humanize.Bytes(t.Bytes), t.Duration.Round(100*time.Millisecond))
+}
@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	gopath "path"
+	"sort"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	merkledag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-merkledag/dagutils"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// DiffChange is a file or directory added, removed or modified between two
+// UnixFS trees.
+type DiffChange struct {
+	Type dagutils.ChangeType
+	Path string
+	Dir  bool `json:",omitempty"`
+
+	Before     string `json:",omitempty"`
+	After      string `json:",omitempty"`
+	BeforeSize uint64 `json:",omitempty"`
+	AfterSize  uint64 `json:",omitempty"`
+
+	// SizeDelta is the difference between the sizes of the modified file.
+	SizeDelta int64 `json:",omitempty"`
+	// ChangedBlocks is the number of blocks of the modified file that are
+	// not part of its previous version.
+	ChangedBlocks int `json:",omitempty"`
+}
+
+var DiffCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the files changed between two UnixFS trees.",
+		ShortDescription: `
+'ipfs diff' lists the files and directories added, removed or modified
+between two UnixFS directories, including sharded ones.
+`,
+		LongDescription: `
+'ipfs diff' lists the files and directories added, removed or modified
+between two UnixFS directories, including sharded ones. Each line of the
+output describes one change:
+
+  + <cid> <path> (<size> bytes)
+  - <cid> <path> (<size> bytes)
+  ~ <old cid> <new cid> <path> (<size delta> bytes, <n> changed blocks)
+
+Directories that only exist in one of the trees are reported as a single
+change. The changed blocks of a modified file are the blocks of its new
+version that are not part of the old one. The parts of the file shared by
+both versions are not read, and so not fetched either.
+
+Example:
+
+  > ipfs diff QmegHcnrPgMwC7tBiMxChD54fgQMBUecNw9nE9UUU4x1bz QmcmRptkSPWhptCttgHg27QNDmnV33wAJyUkCnAvqD3eCD
+  ~ QmNgd5cz2jNftnAHBhcRUGdtiaMzb5Rhjqd4etondHHST8 QmRfFVsjSXkhFxrfWnLpMae2M4GBVsry6VAuYYcji5MiZb "bar" (+12 bytes, 1 changed blocks)
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path-a", true, false, "Path of the tree to diff against."),
+		cmds.StringArg("path-b", true, false, "Path of the tree to diff."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		d := &unixfsDiff{
+			ctx: req.Context,
+			api: api,
+			enc: enc.Encode,
+			emit: func(c *DiffChange) error {
+				return res.Emit(c)
+			},
+		}
+
+		a, err := d.resolve(path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		b, err := d.resolve(path.New(req.Arguments[1]))
+		if err != nil {
+			return err
+		}
+		return d.diff("", a, b)
+	},
+	Type: DiffChange{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, c *DiffChange) error {
+			name := c.Path
+			if c.Dir {
+				name += "/"
+			}
+
+			var err error
+			switch c.Type {
+			case dagutils.Add:
+				if c.Dir {
+					_, err = fmt.Fprintf(w, "+ %s %q\n", c.After, name)
+				} else {
+					_, err = fmt.Fprintf(w, "+ %s %q (%d bytes)\n", c.After, name, c.AfterSize)
+				}
+			case dagutils.Remove:
+				if c.Dir {
+					_, err = fmt.Fprintf(w, "- %s %q\n", c.Before, name)
+				} else {
+					_, err = fmt.Fprintf(w, "- %s %q (%d bytes)\n", c.Before, name, c.BeforeSize)
+				}
+			case dagutils.Mod:
+				_, err = fmt.Fprintf(w, "~ %s %s %q (%+d bytes, %d changed blocks)\n", c.Before, c.After, name, c.SizeDelta, c.ChangedBlocks)
+			}
+			return err
+		}),
+	},
+}
+
+// diffEntry is a file or directory of one of the diffed trees.
+type diffEntry struct {
+	cid  cid.Cid
+	dir  bool
+	size uint64
+}
+
+type unixfsDiff struct {
+	ctx  context.Context
+	api  iface.CoreAPI
+	enc  func(cid.Cid) string
+	emit func(*DiffChange) error
+}
+
+func (d *unixfsDiff) resolve(p path.Path) (diffEntry, error) {
+	rp, err := d.api.ResolvePath(d.ctx, p)
+	if err != nil {
+		return diffEntry{}, err
+	}
+
+	nd, err := d.api.Unixfs().Get(d.ctx, rp)
+	if err != nil {
+		return diffEntry{}, err
+	}
+	defer nd.Close()
+
+	e := diffEntry{cid: rp.Cid()}
+	switch nd := nd.(type) {
+	case files.Directory:
+		e.dir = true
+	case files.File:
+		size, err := nd.Size()
+		if err != nil {
+			return diffEntry{}, err
+		}
+		e.size = uint64(size)
+	}
+	return e, nil
+}
+
+// diff emits the changes between the entries a and b found at p.
+func (d *unixfsDiff) diff(p string, a, b diffEntry) error {
+	if a.cid == b.cid {
+		return nil
+	}
+	if !a.dir || !b.dir {
+		return d.modified(p, a, b)
+	}
+
+	entriesA, err := d.list(a.cid)
+	if err != nil {
+		return err
+	}
+	entriesB, err := d.list(b.cid)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedDiffNames(entriesA, entriesB) {
+		ea, inA := entriesA[name]
+		eb, inB := entriesB[name]
+		np := gopath.Join(p, name)
+
+		switch {
+		case !inB:
+			err = d.emit(&DiffChange{Type: dagutils.Remove, Path: np, Dir: ea.dir, Before: d.enc(ea.cid), BeforeSize: ea.size})
+		case !inA:
+			err = d.emit(&DiffChange{Type: dagutils.Add, Path: np, Dir: eb.dir, After: d.enc(eb.cid), AfterSize: eb.size})
+		default:
+			err = d.diff(np, ea, eb)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *unixfsDiff) modified(p string, a, b diffEntry) error {
+	changed, err := d.changedBlocks(a.cid, b.cid)
+	if err != nil {
+		return err
+	}
+	return d.emit(&DiffChange{
+		Type:          dagutils.Mod,
+		Path:          p,
+		Dir:           a.dir && b.dir,
+		Before:        d.enc(a.cid),
+		After:         d.enc(b.cid),
+		BeforeSize:    a.size,
+		AfterSize:     b.size,
+		SizeDelta:     int64(b.size) - int64(a.size),
+		ChangedBlocks: changed,
+	})
+}
+
+// list returns the entries of the directory c by name.
+func (d *unixfsDiff) list(c cid.Cid) (map[string]diffEntry, error) {
+	results, err := d.api.Unixfs().Ls(d.ctx, path.IpfsPath(c), options.Unixfs.ResolveChildren(true))
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]diffEntry)
+	for l := range results {
+		if l.Err != nil {
+			return nil, l.Err
+		}
+		entries[l.Name] = diffEntry{
+			cid:  l.Cid,
+			dir:  l.Type == iface.TDirectory,
+			size: l.Size,
+		}
+	}
+	return entries, nil
+}
+
+// changedBlocks counts the blocks of the DAG b that are not part of the DAG a.
+//
+// Both DAGs are walked together, level by level, without descending into the
+// blocks found on both sides: the subtrees shared by the two versions are
+// never read, so that diffing versions of a large file only fetches what
+// changed. A block of b which a only holds under a shared subtree is counted
+// as changed.
+func (d *unixfsDiff) changedBlocks(a, b cid.Cid) (int, error) {
+	getLinks := merkledag.GetLinksWithDAG(d.api.Dag())
+	seenA, seenB := cid.NewSet(), cid.NewSet()
+	seenA.Add(a)
+	seenB.Add(b)
+
+	levelA, levelB := []cid.Cid{a}, []cid.Cid{b}
+	for len(levelA) > 0 || len(levelB) > 0 {
+		// the blocks seen on both sides are shared, along with their subtrees
+		levelA, levelB = unshared(levelA, seenB), unshared(levelB, seenA)
+
+		var err error
+		if levelA, err = d.children(getLinks, levelA, seenA); err != nil {
+			return 0, err
+		}
+		if levelB, err = d.children(getLinks, levelB, seenB); err != nil {
+			return 0, err
+		}
+	}
+
+	changed := 0
+	err := seenB.ForEach(func(c cid.Cid) error {
+		if !seenA.Has(c) {
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+// children returns the children of the blocks of level not in seen yet, and
+// adds them to it.
+func (d *unixfsDiff) children(getLinks merkledag.GetLinks, level []cid.Cid, seen *cid.Set) ([]cid.Cid, error) {
+	var next []cid.Cid
+	for _, c := range level {
+		links, err := getLinks(d.ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			if seen.Visit(l.Cid) {
+				next = append(next, l.Cid)
+			}
+		}
+	}
+	return next, nil
+}
+
+// unshared returns the CIDs of level which are not in shared.
+func unshared(level []cid.Cid, shared *cid.Set) []cid.Cid {
+	var out []cid.Cid
+	for _, c := range level {
+		if !shared.Has(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func sortedDiffNames(a, b map[string]diffEntry) []string {
+	names := make([]string, 0, len(a)+len(b))
+	for n := range a {
+		names = append(names, n)
+	}
+	for n := range b {
+		if _, ok := a[n]; !ok {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,46 @@
+package commands
+
+import (
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/apierr"
+)
+
+// withErrorKinds makes the commands under the roots fail with the errors of a
+// known kind as cmds.Error of the code of their kind, for the HTTP API to
+// answer them with the status of their kind, and the CLI to exit with their
+// code.
+func withErrorKinds(roots ...*cmds.Command) {
+	seen := make(map[*cmds.Command]bool)
+	var walk func(cmd *cmds.Command)
+	walk = func(cmd *cmds.Command) {
+		if seen[cmd] {
+			return
+		}
+		seen[cmd] = true
+		if run := cmd.Run; run != nil {
+			cmd.Run = func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
+				return kindError(run(req, re, env))
+			}
+		}
+		for _, sub := range cmd.Subcommands {
+			walk(sub)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+}
+
+// kindError returns err as a cmds.Error of the code of its kind, or err
+// itself if it is of no known kind or a cmds.Error already.
+func kindError(err error) error {
+	switch err.(type) {
+	case nil, cmds.Error, *cmds.Error:
+		return err
+	}
+	kind := apierr.KindOf(err)
+	if kind == apierr.Unknown {
+		return err
+	}
+	return cmds.Error{Message: err.Error(), Code: apierr.Code(kind)}
+}
@@ -1,13 +1,12 @@
 package commands
 
-import cmds "github.com/ipfs/go-ipfs-cmds"
+import (
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+)
 
 func CreateCmdExtras(opts ...func(e *cmds.Extra)) *cmds.Extra {
-	e := new(cmds.Extra)
-	for _, o := range opts {
-		o(e)
-	}
-	return e
+	return cmdutils.CreateCmdExtras(opts...)
 }
 
 type doesNotUseRepo struct{}
@@ -11,11 +11,14 @@ import (
 	"strings"
 
 	humanize "github.com/dustin/go-humanize"
+	config "github.com/ipfs/go-ipfs/config"
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 
 	bservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
+	cidutil "github.com/ipfs/go-cidutil"
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -70,16 +73,19 @@ operations.
 		cmds.BoolOption(filesFlushOptionName, "f", "Flush target and ancestors after write.").WithDefault(true),
 	},
 	Subcommands: map[string]*cmds.Command{
-		"read":  filesReadCmd,
-		"write": filesWriteCmd,
-		"mv":    filesMvCmd,
-		"cp":    filesCpCmd,
-		"ls":    filesLsCmd,
-		"mkdir": filesMkdirCmd,
-		"stat":  filesStatCmd,
-		"rm":    filesRmCmd,
-		"flush": filesFlushCmd,
-		"chcid": filesChcidCmd,
+		"read":    filesReadCmd,
+		"write":   filesWriteCmd,
+		"mv":      filesMvCmd,
+		"cp":      filesCpCmd,
+		"ls":      filesLsCmd,
+		"mkdir":   filesMkdirCmd,
+		"stat":    filesStatCmd,
+		"rm":      filesRmCmd,
+		"flush":   filesFlushCmd,
+		"chcid":   filesChcidCmd,
+		"standby": filesStandbyCmd,
+		"fsck":    filesFsckCmd,
+		"watch":   filesWatchCmd,
 	},
 }
 
@@ -350,6 +356,16 @@ The lazy-copy feature can also be used to protect partial DAG contents from
 garbage collection. i.e. adding the Wikipedia root to MFS would not download
 all the Wikipedia, but will prevent any downloaded Wikipedia-DAG content from
 being GC'ed.
+
+With --recursive, the full DAG of the source is fetched before it is copied,
+the path and the count of the files and bytes fetched being output as each
+file is fetched:
+
+$ ipfs files cp -r /ipfs/<CID> /your/desired/mfs/path
+fetched /ipfs/<CID>/a.txt (1 files, 12 B)
+fetched /ipfs/<CID>/b.txt (2 files, 24 B)
+
+The MFS is only changed once the DAG is fetched.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -358,9 +374,12 @@ being GC'ed.
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(filesParentsOptionName, "p", "Make parent directories as needed."),
+		cmds.BoolOption(filesRecursiveOptionName, "r", "Fetch the full DAG of the source, outputting the progress."),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		mkParents, _ := req.Options[filesParentsOptionName].(bool)
+		recursive, _ := req.Options[filesRecursiveOptionName].(bool)
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
 			return err
@@ -398,6 +417,18 @@ being GC'ed.
 			return fmt.Errorf("cp: cannot get node from path %s: %s", src, err)
 		}
 
+		if recursive {
+			if err := fetchFiles(req.Context, api.Dag(), node, src, res); err != nil {
+				return fmt.Errorf("cp: %s", err)
+			}
+		}
+
+		end, err := journalFilesOp(req, nd)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		if mkParents {
 			err := ensureContainingDirectoryExists(nd.FilesRoot, dst, prefix)
 			if err != nil {
@@ -419,6 +450,15 @@ being GC'ed.
 
 		return nil
 	},
+	Type:     FilesProgress{},
+	Encoders: filesProgressEncoders,
+}
+
+// journalFilesOp records in the MFS journal that the command of req starts
+// changing the MFS of nd. The returned function records that it ended.
+func journalFilesOp(req *cmds.Request, nd *core.IpfsNode) (func(), error) {
+	op := strings.Join(append(req.Path[len(req.Path)-1:len(req.Path):len(req.Path)], req.Arguments...), " ")
+	return nd.FilesJournal.Begin(req.Context, op)
 }
 
 func getNodeFromPath(ctx context.Context, node *core.IpfsNode, api iface.CoreAPI, p string) (ipld.Node, error) {
@@ -682,6 +722,9 @@ Example:
 
     $ ipfs files mv /myfs/a/b/c /myfs/foo/newc
 
+With --recursive, the content of the source that was copied lazily to the MFS
+and is missing locally is fetched before it is moved, outputting the progress
+as 'ipfs files cp --recursive' does.
 `,
 	},
 
@@ -689,6 +732,10 @@ Example:
 		cmds.StringArg("source", true, false, "Source file to move."),
 		cmds.StringArg("dest", true, false, "Destination path for file to be moved to."),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(filesRecursiveOptionName, "r", "Fetch the full DAG of the source, outputting the progress."),
+	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -696,6 +743,7 @@ Example:
 		}
 
 		flush, _ := req.Options[filesFlushOptionName].(bool)
+		recursive, _ := req.Options[filesRecursiveOptionName].(bool)
 
 		src, err := checkPath(req.Arguments[0])
 		if err != nil {
@@ -706,12 +754,34 @@ Example:
 			return err
 		}
 
+		if recursive {
+			fsn, err := mfs.Lookup(nd.FilesRoot, src)
+			if err != nil {
+				return err
+			}
+			node, err := fsn.GetNode()
+			if err != nil {
+				return err
+			}
+			if err := fetchFiles(req.Context, nd.DAG, node, src, res); err != nil {
+				return fmt.Errorf("mv: %s", err)
+			}
+		}
+
+		end, err := journalFilesOp(req, nd)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		err = mfs.Mv(nd.FilesRoot, src, dst)
 		if err == nil && flush {
 			_, err = mfs.FlushPath(req.Context, nd.FilesRoot, "/")
 		}
 		return err
 	},
+	Type:     FilesProgress{},
+	Encoders: filesProgressEncoders,
 }
 
 const (
@@ -720,6 +790,9 @@ const (
 	filesTruncateOptionName  = "truncate"
 	filesRawLeavesOptionName = "raw-leaves"
 	filesFlushOptionName     = "flush"
+
+	filesInlineOptionName      = "inline"
+	filesInlineLimitOptionName = "inline-limit"
 )
 
 var filesWriteCmd = &cmds.Command{
@@ -755,6 +828,26 @@ WARNING:
 Usage of the '--flush=false' option does not guarantee data durability until
 the tree has been flushed. This can be accomplished by running 'ipfs files
 stat' on the file or any of its ancestors.
+
+INLINING:
+
+With the '--inline' option, or Import.Inline set in the config, files whose
+data fits in a single block of up to '--inline-limit' bytes, or
+Import.InlineLimit, are inlined into an identity CID once written. Writing to
+an inlined file makes it a regular file again.
+
+CONTENT-DEFINED CHUNKING:
+
+The blocks of a file are modified in place by default, and the data appended
+is cut in blocks of a fixed size: once data is inserted or removed, as when a
+new version of the file is written with '--truncate', none of the blocks after
+the change are the same as before. With '--chunker', the whole file is chunked
+again once written, as 'ipfs add' does, and a content-defined chunker such as
+'buzhash' or 'rabin' cuts the same blocks out of the data left unchanged: the
+file then shares most of its blocks with its previous version. The whole file
+is read to be chunked again.
+
+    ipfs files write --truncate --chunker=buzhash /myfs/doc.txt doc.txt
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -770,7 +863,11 @@ stat' on the file or any of its ancestors.
 		cmds.BoolOption(filesRawLeavesOptionName, "Use raw blocks for newly created leaf nodes. (experimental)"),
 		cidVersionOption,
 		hashOption,
+		cmds.BoolOption(filesInlineOptionName, "Inline the file into its CID if it fits in a small block. Default: Import.Inline."),
+		cmds.IntOption(filesInlineLimitOptionName, "Maximum block size to inline. Default: Import.InlineLimit, or 32."),
+		cmds.StringOption(filesChunkerOptionName, "Chunk the whole file again once written with this chunker, such as buzhash, instead of modifying its blocks in place."),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) (retErr error) {
 		path, err := checkPath(req.Arguments[0])
 		if err != nil {
@@ -798,6 +895,42 @@ stat' on the file or any of its ancestors.
 			return fmt.Errorf("cannot have negative write offset")
 		}
 
+		count, countfound := req.Options[filesCountOptionName].(int64)
+		if countfound && count < 0 {
+			return fmt.Errorf("cannot have negative byte count")
+		}
+
+		chunkerStr, _ := req.Options[filesChunkerOptionName].(string)
+		if chunkerStr != "" {
+			if err := checkChunker(chunkerStr); err != nil {
+				return err
+			}
+		}
+
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+		inline, inlineSet := req.Options[filesInlineOptionName].(bool)
+		if !inlineSet {
+			inline = cfg.Import.Inline.WithDefault(false)
+		}
+		inlineLimit, inlineLimitSet := req.Options[filesInlineLimitOptionName].(int)
+		if !inlineLimitSet {
+			inlineLimit = int(cfg.Import.InlineLimit.WithDefault(config.DefaultInlineLimit))
+		}
+		if inline {
+			if err := config.CheckInlineLimit(int64(inlineLimit)); err != nil {
+				return err
+			}
+		}
+
+		end, err := journalFilesOp(req, nd)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		if mkParents {
 			err := ensureContainingDirectoryExists(nd.FilesRoot, path, prefix)
 			if err != nil {
@@ -809,10 +942,37 @@ stat' on the file or any of its ancestors.
 		if err != nil {
 			return err
 		}
+		// the blocks written to an inlined file would be inlined whatever
+		// their size
+		if fi, err = uninlineFile(nd.FilesRoot, path, fi, prefix); err != nil {
+			return err
+		}
 		if rawLeavesDef {
 			fi.RawLeaves = rawLeaves
 		}
 
+		// runs once the file is closed
+		if inline {
+			defer func() {
+				if retErr == nil {
+					retErr = inlineFile(req.Context, nd.FilesRoot, path, inlineLimit, flush)
+				}
+			}()
+		}
+
+		var r io.Reader
+		r, err = cmdenv.GetFileArg(req.Files.Entries())
+		if err != nil {
+			return err
+		}
+		if countfound {
+			r = io.LimitReader(r, int64(count))
+		}
+
+		if chunkerStr != "" {
+			return rechunkFile(req.Context, nd.FilesRoot, nd.DAG, path, fi, r, offset, trunc, chunkerStr, prefix, flush)
+		}
+
 		wfd, err := fi.Open(mfs.Flags{Write: true, Sync: flush})
 		if err != nil {
 			return err
@@ -835,26 +995,12 @@ stat' on the file or any of its ancestors.
 			}
 		}
 
-		count, countfound := req.Options[filesCountOptionName].(int64)
-		if countfound && count < 0 {
-			return fmt.Errorf("cannot have negative byte count")
-		}
-
 		_, err = wfd.Seek(int64(offset), io.SeekStart)
 		if err != nil {
 			flog.Error("seekfail: ", err)
 			return err
 		}
 
-		var r io.Reader
-		r, err = cmdenv.GetFileArg(req.Files.Entries())
-		if err != nil {
-			return err
-		}
-		if countfound {
-			r = io.LimitReader(r, int64(count))
-		}
-
 		_, err = io.Copy(wfd, r)
 		return err
 	},
@@ -886,6 +1032,7 @@ Examples:
 		cidVersionOption,
 		hashOption,
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -906,6 +1053,12 @@ Examples:
 		}
 		root := n.FilesRoot
 
+		end, err := journalFilesOp(req, n)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		err = mfs.Mkdir(root, dirtomake, mfs.MkdirOpts{
 			Mkparents:  dashp,
 			Flush:      flush,
@@ -971,6 +1124,7 @@ Change the CID version or hash function of the root node of a given path.
 		cidVersionOption,
 		hashOption,
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -989,6 +1143,12 @@ Change the CID version or hash function of the root node of a given path.
 			return err
 		}
 
+		end, err := journalFilesOp(req, nd)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		err = updatePath(nd.FilesRoot, path, prefix)
 		if err == nil && flush {
 			_, err = mfs.FlushPath(req.Context, nd.FilesRoot, path)
@@ -1039,6 +1199,7 @@ Remove files or directories.
 		cmds.BoolOption(recursiveOptionName, "r", "Recursively remove directories."),
 		cmds.BoolOption(forceOptionName, "Forcibly remove target at path; implies -r for directories"),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -1048,6 +1209,13 @@ Remove files or directories.
 		// including file, directory, corrupted node, etc
 		force, _ := req.Options[forceOptionName].(bool)
 		dashr, _ := req.Options[recursiveOptionName].(bool)
+
+		end, err := journalFilesOp(req, nd)
+		if err != nil {
+			return err
+		}
+		defer end()
+
 		var errs []error
 		for _, arg := range req.Arguments {
 			path, err := checkPath(arg)
@@ -1184,6 +1352,131 @@ func getPrefix(req *cmds.Request) (cid.Builder, error) {
 	return &prefix, nil
 }
 
+// inlineFile replaces the file at path by a single block inlined into its
+// identity CID, when its data fits in up to limit bytes.
+func inlineFile(ctx context.Context, r *mfs.Root, path string, limit int, flush bool) error {
+	fi, err := getFileHandle(r, path, false, nil)
+	if err != nil {
+		return err
+	}
+	size, err := fi.Size()
+	if err != nil || size > int64(limit) {
+		return err
+	}
+	node, err := fi.GetNode()
+	if err != nil {
+		return err
+	}
+	prefix := node.Cid().Prefix()
+	if prefix.MhType == mh.IDENTITY {
+		return nil
+	}
+
+	fd, err := fi.Open(mfs.Flags{Read: true})
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(fd)
+	fd.Close()
+	if err != nil {
+		return err
+	}
+
+	// the block is inlined if it still fits once encoded
+	builder := cidutil.InlineBuilder{Builder: prefix, Limit: limit}
+	var inlined ipld.Node
+	if fi.RawLeaves {
+		inlined, err = dag.NewRawNodeWPrefix(data, builder.WithCodec(cid.Raw))
+		if err != nil {
+			return err
+		}
+	} else {
+		pn := dag.NodeWithData(ft.FilePBData(data, uint64(len(data))))
+		pn.SetCidBuilder(builder.WithCodec(cid.DagProtobuf))
+		inlined = pn
+	}
+	if inlined.Cid().Prefix().MhType != mh.IDENTITY {
+		return nil
+	}
+
+	if err := replaceFile(r, path, inlined); err != nil {
+		return err
+	}
+	if flush {
+		_, err = mfs.FlushPath(ctx, r, path)
+	}
+	return err
+}
+
+// uninlineFile replaces the inlined file at path by a regular one, whose CID
+// is built with builder, or the builder of its parent directory if nil. The
+// data is written again as a new file would be, as the inlined single block
+// cannot always be modified in place. It returns the file at path.
+func uninlineFile(r *mfs.Root, path string, fi *mfs.File, builder cid.Builder) (*mfs.File, error) {
+	node, err := fi.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	if node.Cid().Prefix().MhType != mh.IDENTITY {
+		return fi, nil
+	}
+
+	var data []byte
+	switch n := node.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(n.Data())
+		if err != nil {
+			return nil, err
+		}
+		data = fsn.Data()
+	case *dag.RawNode:
+		data = n.RawData()
+	default:
+		return nil, fmt.Errorf("unexpected node type %T for file %s", node, path)
+	}
+
+	if builder == nil {
+		pdir, err := getParentDir(r, gopath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		builder = pdir.GetCidBuilder()
+	}
+	empty := dag.NodeWithData(ft.FilePBData(nil, 0))
+	empty.SetCidBuilder(builder)
+	if err := replaceFile(r, path, empty); err != nil {
+		return nil, err
+	}
+
+	fi, err = getFileHandle(r, path, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	_, fi.RawLeaves = node.(*dag.RawNode)
+	fd, err := fi.Open(mfs.Flags{Write: true})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fi, fd.Close()
+}
+
+// replaceFile replaces the file at path by node.
+func replaceFile(r *mfs.Root, path string, node ipld.Node) error {
+	dirname, fname := gopath.Split(path)
+	pdir, err := getParentDir(r, dirname)
+	if err != nil {
+		return err
+	}
+	if err := pdir.Unlink(fname); err != nil {
+		return err
+	}
+	return pdir.AddChild(fname, node)
+}
+
 func ensureContainingDirectoryExists(r *mfs.Root, path string, builder cid.Builder) error {
 	dirtomake := gopath.Dir(path)
 
@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	gopath "path"
+
+	humanize "github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+const filesRecursiveOptionName = "recursive"
+
+// filesFetchAhead is how many entries of a directory are fetched ahead of the
+// one whose DAG is fetched.
+const filesFetchAhead = 64
+
+// FilesProgress is the progress of 'ipfs files cp' and 'ipfs files mv'
+// fetching the DAG of their source, sent once each file is fetched.
+type FilesProgress struct {
+	// Path is the path of the file fetched, the source or below it.
+	Path string
+	// Files and Bytes are the files and their bytes fetched so far.
+	Files int
+	Bytes uint64
+}
+
+// filesProgressEncoders write the progress of a fetch, one file a line.
+var filesProgressEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesProgress) error {
+		_, err := fmt.Fprintf(w, "fetched %s (%d files, %s)\n", out.Path, out.Files, humanize.Bytes(out.Bytes))
+		return err
+	}),
+}
+
+// fetchFiles fetches the whole DAG of nd, the source of a copy or move at p,
+// emitting the progress to res.
+func fetchFiles(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, p string, res cmds.ResponseEmitter) error {
+	f := &filesFetcher{dserv: dserv, res: res}
+	return f.fetch(ctx, nd, p)
+}
+
+type filesFetcher struct {
+	dserv    ipld.DAGService
+	res      cmds.ResponseEmitter
+	progress FilesProgress
+}
+
+func (f *filesFetcher) fetch(ctx context.Context, nd ipld.Node, p string) error {
+	var size uint64
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		size = uint64(len(nd.RawData()))
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			// not UnixFS, fetched as a whole
+			break
+		}
+		if fsn.IsDir() {
+			return f.fetchDir(ctx, nd, p)
+		}
+		size = fsn.FileSize()
+	}
+	if err := dag.FetchGraph(ctx, nd.Cid(), f.dserv); err != nil {
+		return fmt.Errorf("cannot fetch %s: %w", p, err)
+	}
+
+	f.progress.Path = p
+	f.progress.Files++
+	f.progress.Bytes += size
+	out := f.progress
+	return f.res.Emit(&out)
+}
+
+func (f *filesFetcher) fetchDir(ctx context.Context, nd ipld.Node, p string) error {
+	dir, err := uio.NewDirectoryFromNode(f.dserv, nd)
+	if err != nil {
+		return err
+	}
+	var links []*ipld.Link
+	if err := dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		links = append(links, l)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("cannot fetch %s: %w", p, err)
+	}
+
+	// the entries are fetched ahead, and their DAGs one after another
+	for start := 0; start < len(links); start += filesFetchAhead {
+		batch := links[start:]
+		if len(batch) > filesFetchAhead {
+			batch = batch[:filesFetchAhead]
+		}
+		keys := make([]cid.Cid, len(batch))
+		for i, l := range batch {
+			keys[i] = l.Cid
+		}
+		promises := ipld.GetNodes(ctx, f.dserv, keys)
+		for i, l := range batch {
+			child, err := promises[i].Get(ctx)
+			if err != nil {
+				return fmt.Errorf("cannot fetch %s: %w", gopath.Join(p, l.Name), err)
+			}
+			if err := f.fetch(ctx, child, gopath.Join(p, l.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/mfsjournal"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+const filesRepairOptionName = "repair"
+
+// FilesFsckOutput is the state of the MFS root checked by files fsck
+type FilesFsckOutput struct {
+	Root string
+	// Missing is a block of the DAG of the root missing locally, if any
+	Missing string `json:",omitempty"`
+	// Repaired is the root the MFS was reset to, if repaired
+	Repaired string `json:",omitempty"`
+}
+
+var filesFsckCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check that the DAG of the MFS root is complete.",
+		ShortDescription: `
+Checks that all the blocks of the DAG of the MFS root are present locally.
+
+The operations changing the MFS are journaled, and those interrupted by a
+crash are rolled back when the node next starts, so that the MFS root does
+not point at a partially written tree. Blocks can still go missing after an
+unclean shutdown, if the datastore lost the writes it did not sync. Note that
+the content copied to the MFS with 'ipfs files cp /ipfs/<cid>' is not fetched
+until read, and is reported missing until then.
+
+With --repair, an incomplete MFS root is reset to the most recent root
+resulting from a complete operation whose DAG is complete. The daemon must
+not be running.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(filesRepairOptionName, "Reset an incomplete MFS root to the last complete one."),
+	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo(filesRepairOptionName)),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		repair, _ := req.Options[filesRepairOptionName].(bool)
+		if repair && nd.IsDaemon {
+			return errors.New("--repair cannot run on a daemon, stop the daemon first")
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		rootNode, err := nd.FilesRoot.GetDirectory().GetNode()
+		if err != nil {
+			return err
+		}
+		root := rootNode.Cid()
+		// the local blocks are checked
+		dserv := dag.NewDAGService(bserv.New(nd.Blockstore, offline.Exchange(nd.Blockstore)))
+		missing, err := mfsjournal.Missing(req.Context, dserv, root)
+		if err != nil {
+			return err
+		}
+
+		out := &FilesFsckOutput{Root: enc.Encode(root)}
+		if !missing.Defined() {
+			return cmds.EmitOnce(res, out)
+		}
+		out.Missing = enc.Encode(missing)
+		if !repair {
+			return cmds.EmitOnce(res, out)
+		}
+
+		roots, err := nd.FilesJournal.Roots(req.Context)
+		if err != nil {
+			return err
+		}
+		for _, r := range roots {
+			if r.Equals(root) {
+				continue
+			}
+			m, err := mfsjournal.Missing(req.Context, dserv, r)
+			if err != nil {
+				return err
+			}
+			if m.Defined() {
+				continue
+			}
+			if err := nd.FilesJournal.SetRoot(req.Context, r); err != nil {
+				return err
+			}
+			out.Repaired = enc.Encode(r)
+			return cmds.EmitOnce(res, out)
+		}
+		return fmt.Errorf("MFS root %s is missing block %s, and no complete root was found in the journal: remove the incomplete paths with 'ipfs files rm --force'", out.Root, out.Missing)
+	},
+	Type: FilesFsckOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesFsckOutput) error {
+			if out.Missing == "" {
+				fmt.Fprintf(w, "MFS root %s is complete\n", out.Root)
+				return nil
+			}
+			fmt.Fprintf(w, "MFS root %s is missing block %s\n", out.Root, out.Missing)
+			if out.Repaired != "" {
+				fmt.Fprintf(w, "MFS root is now %s\n", out.Repaired)
+			}
+			return nil
+		}),
+	},
+}
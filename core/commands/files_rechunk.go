@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	mfs "github.com/ipfs/go-mfs"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+)
+
+const filesChunkerOptionName = "chunker"
+
+// checkChunker returns an error if chunkerStr is not a valid chunker.
+func checkChunker(chunkerStr string) error {
+	if _, err := chunker.FromString(bytes.NewReader(nil), chunkerStr); err != nil {
+		return fmt.Errorf("invalid chunker %q: %w", chunkerStr, err)
+	}
+	return nil
+}
+
+// rechunkFile writes data at offset in the file at path, truncated first if
+// trunc is set, by chunking the whole file again with the chunker chunkerStr,
+// as 'ipfs add' does. Unlike the blocks modified in place, the blocks cut by
+// a content-defined chunker, such as buzhash, out of the data left unchanged
+// are the same as before the write, so the file shares them with its previous
+// version. The CID of the file is built with builder, or the builder of the
+// file if nil.
+func rechunkFile(ctx context.Context, r *mfs.Root, dserv ipld.DAGService, path string, fi *mfs.File, data io.Reader, offset int64, trunc bool, chunkerStr string, builder cid.Builder, flush bool) error {
+	node, err := fi.GetNode()
+	if err != nil {
+		return err
+	}
+	if builder == nil {
+		builder = node.Cid().Prefix()
+	}
+
+	var (
+		size int64
+		old  mfs.FileDescriptor
+	)
+	if !trunc {
+		if size, err = fi.Size(); err != nil {
+			return err
+		}
+		if old, err = fi.Open(mfs.Flags{Read: true}); err != nil {
+			return err
+		}
+		defer func() {
+			if old != nil {
+				old.Close()
+			}
+		}()
+	}
+
+	// the file once written: its data up to offset, zeros from its end up
+	// to offset, the data written and the rest of the file
+	var parts []io.Reader
+	if old != nil {
+		parts = append(parts, io.LimitReader(old, offset))
+	}
+	if offset > size {
+		parts = append(parts, io.LimitReader(zeroReader{}, offset-size))
+	}
+	written := &countingReader{r: data}
+	parts = append(parts, written, &lazyReader{open: func() (io.Reader, error) {
+		end := offset + written.n
+		if old == nil || end >= size {
+			return bytes.NewReader(nil), nil
+		}
+		if _, err := old.Seek(end, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return old, nil
+	}})
+
+	chnk, err := chunker.FromString(io.MultiReader(parts...), chunkerStr)
+	if err != nil {
+		return err
+	}
+	bdag := ipld.NewBufferedDAG(ctx, dserv)
+	params := ihelper.DagBuilderParams{
+		Dagserv:    bdag,
+		RawLeaves:  fi.RawLeaves,
+		Maxlinks:   ihelper.DefaultLinksPerBlock,
+		CidBuilder: builder,
+	}
+	db, err := params.New(chnk)
+	if err != nil {
+		return err
+	}
+	nnode, err := balanced.Layout(db)
+	if err != nil {
+		return err
+	}
+	if err := bdag.Commit(); err != nil {
+		return err
+	}
+
+	if old != nil {
+		old.Close()
+		old = nil
+	}
+	if err := replaceFile(r, path, nnode); err != nil {
+		return err
+	}
+	if flush {
+		_, err = mfs.FlushPath(ctx, r, path)
+	}
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// lazyReader reads from the reader returned by open, called on the first
+// read.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil {
+		r, err := l.open()
+		if err != nil {
+			return 0, err
+		}
+		l.r = r
+	}
+	return l.r.Read(p)
+}
@@ -0,0 +1,173 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/mfsrepl"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// FilesStandbyOutput is the state of the MFS replication of a node
+type FilesStandbyOutput struct {
+	// Published is the MFS root last published, when publishing it
+	Published string `json:",omitempty"`
+	// Writer is the peer ID of the writer followed, when a standby
+	Writer     string     `json:",omitempty"`
+	Received   string     `json:",omitempty"`
+	ReceivedAt *time.Time `json:",omitempty"`
+	Pinned     string     `json:",omitempty"`
+	PinnedAt   *time.Time `json:",omitempty"`
+	Error      string     `json:",omitempty"`
+}
+
+// FilesPromoteOutput is the MFS root a standby took over
+type FilesPromoteOutput struct {
+	Root   string
+	Writer string
+}
+
+var filesStandbyCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Replicate the MFS root to hot standbys.",
+		ShortDescription: `
+A writer node with Files.Replication.Publish enabled publishes its MFS root
+over pubsub every time it changes. A standby node with Files.Replication.Follow
+set to the peer ID of the writer follows it, and keeps its latest MFS root
+pinned. Should the writer fail, at most a few seconds of MFS changes are lost:
+the standby takes over with 'ipfs files standby promote'.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status":  filesStandbyStatusCmd,
+		"promote": filesStandbyPromoteCmd,
+	},
+}
+
+var filesStandbyStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the state of the MFS replication.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.MFSPublisher == nil && nd.MFSStandby == nil {
+			return errors.New("MFS replication is not enabled, see Files.Replication")
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		out := &FilesStandbyOutput{}
+		if nd.MFSPublisher != nil {
+			if u := nd.MFSPublisher.Last(); u.Root.Defined() {
+				out.Published = enc.Encode(u.Root)
+			}
+		}
+		if nd.MFSStandby != nil {
+			st := nd.MFSStandby.Status()
+			out.Writer = st.Writer.String()
+			if st.Received.Root.Defined() && !st.ReceivedAt.IsZero() {
+				out.Received = enc.Encode(st.Received.Root)
+				out.ReceivedAt = &st.ReceivedAt
+			}
+			if st.Pinned.Root.Defined() {
+				out.Pinned = enc.Encode(st.Pinned.Root)
+				out.PinnedAt = &st.PinnedAt
+			}
+			out.Error = st.Error
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: FilesStandbyOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesStandbyOutput) error {
+			if out.Published != "" {
+				fmt.Fprintf(w, "publishing %s\n", out.Published)
+			}
+			if out.Writer == "" {
+				return nil
+			}
+			fmt.Fprintf(w, "following %s\n", out.Writer)
+			if out.ReceivedAt != nil {
+				fmt.Fprintf(w, "received %s at %s\n", out.Received, out.ReceivedAt.Format(time.RFC3339))
+			}
+			if out.PinnedAt != nil {
+				fmt.Fprintf(w, "pinned %s at %s\n", out.Pinned, out.PinnedAt.Format(time.RFC3339))
+			}
+			if out.Error != "" {
+				fmt.Fprintf(w, "error: %s\n", out.Error)
+			}
+			return nil
+		}),
+	},
+}
+
+var filesStandbyPromoteCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Take over the MFS root of the writer followed.",
+		ShortDescription: `
+Replaces the MFS root of the node with the last one pinned from the writer it
+followed as a standby. The daemon must not be running.
+
+To take over from the writer, stop the daemon of the standby, run this
+command, then unset Files.Replication.Follow, enable
+Files.Replication.Publish to become the new writer, and start the daemon.
+The root remains pinned until unpinned with 'ipfs pin rm'.
+`,
+	},
+	NoRemote: true,
+	Extra:    CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.IsOnline {
+			return errors.New("this command must be run in offline mode, stop the daemon first")
+		}
+
+		dstore := nd.Repo.Datastore()
+		root, writer, err := mfsrepl.LastRoot(req.Context, dstore)
+		if err == ds.ErrNotFound {
+			return errors.New("no MFS root was replicated to this node")
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := dstore.Put(req.Context, node.FilesRootDatastoreKey, root.Bytes()); err != nil {
+			return err
+		}
+		if err := dstore.Sync(req.Context, node.FilesRootDatastoreKey); err != nil {
+			return err
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &FilesPromoteOutput{Root: enc.Encode(root), Writer: writer.String()})
+	},
+	Type: FilesPromoteOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesPromoteOutput) error {
+			fmt.Fprintf(w, "MFS root is now %s, replicated from %s\n", out.Root, out.Writer)
+			return nil
+		}),
+	},
+}
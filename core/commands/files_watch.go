@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+)
+
+// FilesWatchEvent is a change of the MFS seen by files watch
+type FilesWatchEvent struct {
+	// Op is create, modify or delete
+	Op   string
+	Path string
+	// Old and New are the CIDs before and after the change
+	Old string `json:",omitempty"`
+	New string `json:",omitempty"`
+}
+
+var filesWatchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the changes of the MFS under a path.",
+		ShortDescription: `
+Emits an event every time an entry under the path is created, modified or
+deleted, with the CIDs of the entry before and after the change, until the
+command is interrupted. The path itself need not exist: its creation is an
+event too.
+
+A directory created or deleted is a single event, its entries are not reported
+one by one. The entries of a directory modified are. The changes are seen once
+the MFS root is published, a fraction of a second after they are flushed: the
+changes made with --flush=false are only seen once flushed, and several
+changes close together may be seen as one.
+
+The MFS only changes through the daemon, which must be running.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("path", false, false, "Path to watch, / if not given."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsDaemon {
+			return cmds.Errorf(cmds.ErrClient, "daemon not running")
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		capi, ok := api.(*coreapi.CoreAPI)
+		if !ok {
+			return errors.New("watching the MFS is not supported by this node")
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		p := "/"
+		if len(req.Arguments) > 0 {
+			p = req.Arguments[0]
+		}
+		p, err = checkPath(p)
+		if err != nil {
+			return err
+		}
+		events, err := capi.WatchFiles(req.Context, p)
+		if err != nil {
+			return err
+		}
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+
+		for e := range events {
+			out := &FilesWatchEvent{Op: string(e.Op), Path: e.Path}
+			if e.Old.Defined() {
+				out.Old = enc.Encode(e.Old)
+			}
+			if e.New.Defined() {
+				out.New = enc.Encode(e.New)
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: FilesWatchEvent{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FilesWatchEvent) error {
+			switch {
+			case out.Old == "":
+				_, err := fmt.Fprintf(w, "%s %s %s\n", out.Op, out.Path, out.New)
+				return err
+			case out.New == "":
+				_, err := fmt.Fprintf(w, "%s %s %s\n", out.Op, out.Path, out.Old)
+				return err
+			default:
+				_, err := fmt.Fprintf(w, "%s %s %s -> %s\n", out.Op, out.Path, out.Old, out.New)
+				return err
+			}
+		}),
+	},
+}
@@ -1,11 +1,14 @@
 package commands
 
 import (
+	gotar "archive/tar"
 	"bufio"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	gopath "path"
 	"path/filepath"
@@ -13,10 +16,15 @@ import (
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	"github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/fetchprogress"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 
 	"github.com/cheggaaa/pb"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/ipfs/interface-go-ipfs-core/path"
 	"github.com/ipfs/tar-utils"
 )
@@ -28,6 +36,7 @@ const (
 	archiveOptionName          = "archive"
 	compressOptionName         = "compress"
 	compressionLevelOptionName = "compression-level"
+	getTrackOptionName         = "track"
 )
 
 var GetCmd = &cmds.Command{
@@ -43,6 +52,29 @@ To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
 
 To compress the output with GZIP compression, use '--compress' or '-C'. You
 may also specify the level of compression by specifying '-l=<1-9>'.
+`,
+		LongDescription: `
+Stores to disk the data contained an IPFS or IPNS object(s) at the given path.
+
+By default, the output will be stored at './<ipfs-path>', but an alternate
+path can be specified with '--output=<path>' or '-o=<path>'.
+
+To output a TAR archive instead of unpacked files, use '--archive' or '-a'.
+
+To compress the output with GZIP compression, use '--compress' or '-C'. You
+may also specify the level of compression by specifying '-l=<1-9>'.
+
+With '--track=<name>', the progress of the fetch, in blocks and with the
+bytes fetched from each provider, is tracked under the given name, and
+streamed by 'ipfs stats fetch <name>' while the output is sent:
+
+  $ ipfs get --track=video QmHash &
+  $ ipfs stats fetch video
+
+The permissions and the modification times kept in the UnixFS metadata of
+the files, see 'ipfs add --preserve-mode --preserve-mtime', are restored on
+the files written, and set in the TAR archives output. The other files get
+the default permissions, and the current time.
 `,
 	},
 
@@ -55,6 +87,8 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		cmds.BoolOption(compressOptionName, "C", "Compress the output with GZIP compression."),
 		cmds.IntOption(compressionLevelOptionName, "l", "The level of compression (1-9)."),
 		cmds.BoolOption(progressOptionName, "p", "Stream progress data.").WithDefault(true),
+		cmds.StringOption(getTrackOptionName, "Track the progress of the fetch under this name, see 'ipfs stats fetch'."),
+		cmdenv.OptionProviders,
 	},
 	PreRun: func(req *cmds.Request, env cmds.Environment) error {
 		_, err := getCompressOptions(req)
@@ -70,10 +104,25 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 		if err != nil {
 			return err
 		}
+		if err := cmdenv.ConnectProviders(req, api); err != nil {
+			return err
+		}
 
 		p := path.New(req.Arguments[0])
 
-		file, err := api.Unixfs().Get(req.Context, p)
+		var t *fetchprogress.Tracker
+		if name, ok := req.Options[getTrackOptionName].(string); ok {
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			t = newFetchTracker(n)
+			if err := n.FetchProgress.Track(name, t); err != nil {
+				return err
+			}
+			defer n.FetchProgress.Done(name)
+		}
+		file, err := getFile(req.Context, api, t, p)
 		if err != nil {
 			return err
 		}
@@ -131,6 +180,26 @@ may also specify the level of compression by specifying '-l=<1-9>'.
 	},
 }
 
+// getFile returns the file of p, with the UnixFS metadata of its nodes,
+// fetched through t if set.
+func getFile(ctx context.Context, api coreiface.CoreAPI, t *fetchprogress.Tracker, p path.Path) (files.Node, error) {
+	rp, err := api.ResolvePath(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	var ng ipld.NodeGetter = dag.NewSession(ctx, api.Dag())
+	if t != nil {
+		t.AddRoots(rp.Cid())
+		ng = t.NodeGetter(ng)
+	}
+	dserv := dag.NewReadOnlyDagService(ng)
+	nd, err := dserv.Get(ctx, rp.Cid())
+	if err != nil {
+		return nil, err
+	}
+	return unixfsmeta.NewFile(ctx, dserv, nd)
+}
+
 type clearlineReader struct {
 	io.Reader
 	out io.Writer
@@ -239,8 +308,83 @@ func (gw *getWriter) writeExtracted(r io.Reader, fpath string) error {
 		progressCb = bar.Add64
 	}
 
+	// the metadata of the entries are collected as they are extracted, and
+	// restored once all are, the directories after their entries
+	pr, pw := io.Pipe()
+	collected := make(chan []extractedMeta, 1)
+	go func() {
+		metas, err := collectMeta(pr)
+		// the rest of the archive is drained for the extraction to go on
+		_, _ = io.Copy(ioutil.Discard, pr)
+		if err != nil {
+			log.Errorf("cannot read the metadata of the files: %s", err)
+		}
+		collected <- metas
+	}()
+
 	extractor := &tar.Extractor{Path: fpath, Progress: progressCb}
-	return extractor.Extract(r)
+	err := extractor.Extract(io.TeeReader(r, pw))
+	pw.Close()
+	metas := <-collected
+	if err != nil {
+		return err
+	}
+	return restoreMeta(fpath, metas)
+}
+
+// extractedMeta are the metadata of an entry of the archive extracted, named
+// after its path relative to the root of the archive, or the name of the root.
+type extractedMeta struct {
+	name string
+	// root is set for the root of the archive, and dir if it is a directory
+	root, dir bool
+	meta      unixfsmeta.Meta
+}
+
+// collectMeta returns the metadata of the entries of the archive r.
+func collectMeta(r io.Reader) ([]extractedMeta, error) {
+	var metas []extractedMeta
+	var rootName string
+	tr := gotar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return metas, nil
+		}
+		if err != nil {
+			return metas, err
+		}
+		e := extractedMeta{name: h.Name, meta: unixfsmeta.FromHeader(h)}
+		if rootName == "" {
+			rootName = h.Name
+			e.root, e.dir = true, h.Typeflag == gotar.TypeDir
+		} else {
+			e.name = strings.TrimPrefix(h.Name, rootName+"/")
+		}
+		if !e.meta.IsZero() {
+			metas = append(metas, e)
+		}
+	}
+}
+
+// restoreMeta restores the metadata of the entries extracted to fpath, laid
+// out as the extractor does, the entries of the directories first.
+func restoreMeta(fpath string, metas []extractedMeta) error {
+	for i := len(metas) - 1; i >= 0; i-- {
+		e := metas[i]
+		out := filepath.Join(fpath, filepath.FromSlash(e.name))
+		if e.root {
+			out = fpath
+			// a file extracted into an existing directory keeps its name
+			if fi, err := os.Stat(fpath); !e.dir && err == nil && fi.IsDir() {
+				out = filepath.Join(fpath, e.name)
+			}
+		}
+		if err := unixfsmeta.Restore(out, e.meta); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func getCompressOptions(req *cmds.Request) (int, error) {
@@ -323,10 +467,10 @@ func fileArchive(f files.Node, name string, archive bool, compression int) (io.R
 		// the case for 1. archive, and 2. not archived and not compressed, in which tar is used anyway as a transport format
 
 		// construct the tar writer
-		w, err := files.NewTarWriter(maybeGzw)
-		if checkErrAndClosePipe(err) {
-			return nil, err
-		}
+		// with the metadata of the nodes, marked for the CLI to restore them
+		// when extracting
+		w := unixfsmeta.NewTarWriter(maybeGzw)
+		w.Mark = !archive
 
 		go func() {
 			// write all the nodes recursively
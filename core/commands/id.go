@@ -9,9 +9,9 @@ import (
 	"sort"
 	"strings"
 
-	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	ke "github.com/ipfs/go-ipfs/core/commands/keyencode"
@@ -218,6 +218,10 @@ func printSelf(keyEnc ke.KeyEncoder, node *core.IpfsNode) (interface{}, error) {
 		sort.Strings(info.Protocols)
 	}
 	info.ProtocolVersion = identify.LibP2PVersion
-	info.AgentVersion = version.GetUserAgentVersion()
+	cfg, err := node.Repo.Config()
+	if err != nil {
+		return nil, err
+	}
+	info.AgentVersion = libp2p.AgentVersion(cfg.Swarm.Identify)
 	return info, nil
 }
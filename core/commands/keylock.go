@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	oldcmds "github.com/ipfs/go-ipfs/commands"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	keylock "github.com/ipfs/go-ipfs/keylock"
+	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	"golang.org/x/term"
+)
+
+const keyPassphraseArgName = "passphrase"
+
+// KeyLockOutput is the state of the keystore.
+type KeyLockOutput struct {
+	Encrypted bool
+	Locked    bool
+}
+
+var keyEncryptCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Encrypt the keys of the keystore with a passphrase.",
+		ShortDescription: `
+'ipfs key encrypt' encrypts the private keys of the keystore at rest with a
+passphrase, read from $IPFS_KEYSTORE_PASSPHRASE, from the systemd credential
+ipfs-keystore-passphrase, or else prompted for. The keys of an encrypted
+keystore are listed, but used only once it is unlocked: by the daemon at
+startup with the passphrase given by the environment or prompted for, or with
+'ipfs key unlock'. The identity of the node, in the config, is not encrypted.
+
+The daemon must not be running when calling this command.
+`,
+	},
+	NoRemote: true,
+	PreRun:   DaemonNotRunning,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cctx := env.(*oldcmds.Context)
+		ks, closer, err := openKeylock(cctx.ConfigRoot)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		pass, ok, err := keylock.EnvPassphrase()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if pass, err = promptPassphrase("Enter the passphrase of the keystore: "); err != nil {
+				return err
+			}
+			again, err := promptPassphrase("Enter it again: ")
+			if err != nil {
+				return err
+			}
+			if string(again) != string(pass) {
+				return errors.New("the passphrases do not match")
+			}
+		}
+		return ks.Encrypt(pass)
+	},
+}
+
+var keyDecryptCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Store the keys of an encrypted keystore in clear.",
+		ShortDescription: `
+'ipfs key decrypt' stores the private keys of an encrypted keystore in clear
+again, given its passphrase, read from $IPFS_KEYSTORE_PASSPHRASE, from the
+systemd credential ipfs-keystore-passphrase, or else prompted for. To change
+the passphrase, decrypt the keystore and encrypt it again.
+
+The daemon must not be running when calling this command.
+`,
+	},
+	NoRemote: true,
+	PreRun:   DaemonNotRunning,
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		cctx := env.(*oldcmds.Context)
+		ks, closer, err := openKeylock(cctx.ConfigRoot)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+
+		if !ks.Encrypted() {
+			return keylock.ErrNotEncrypted
+		}
+		// the repository is unlocked with the passphrase of the
+		// environment when it is opened
+		if ks.Locked() {
+			pass, err := promptPassphrase("Enter the passphrase of the keystore: ")
+			if err != nil {
+				return err
+			}
+			if err := ks.Unlock(pass); err != nil {
+				return err
+			}
+		}
+		return ks.Decrypt()
+	},
+}
+
+var keyUnlockCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Unlock the encrypted keystore of the daemon.",
+		ShortDescription: `
+'ipfs key unlock' unlocks the encrypted keystore of the running daemon, so that
+its keys are used to publish IPNS records, until it is locked again with
+'ipfs key lock' or the daemon stops. The passphrase is read from the standard
+input, or prompted for on a terminal.
+
+The commands run without a daemon unlock the keystore with the passphrase of
+$IPFS_KEYSTORE_PASSPHRASE.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg(keyPassphraseArgName, false, false, "The passphrase of the keystore.").EnableStdin(),
+	},
+	PreRun: func(req *cmds.Request, env cmds.Environment) error {
+		if len(req.Arguments) > 0 || !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil
+		}
+		pass, err := promptPassphrase("Enter the passphrase of the keystore: ")
+		if err != nil {
+			return err
+		}
+		// sent in the body of the request, as when read from stdin
+		req.Files = files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry("", files.NewBytesFile(append(pass, '\n'))),
+		})
+		return nil
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		ks, err := daemonKeylock(env)
+		if err != nil {
+			return err
+		}
+		if err := req.ParseBodyArgs(); err != nil {
+			return err
+		}
+		if len(req.Arguments) == 0 {
+			return errors.New("argument \"passphrase\" is required")
+		}
+		if err := ks.Unlock([]byte(req.Arguments[0])); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &KeyLockOutput{Encrypted: true, Locked: ks.Locked()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: keyLockEncoder(),
+	},
+	Type: KeyLockOutput{},
+}
+
+var keyLockCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Lock the encrypted keystore of the daemon.",
+		ShortDescription: `
+'ipfs key lock' locks the encrypted keystore of the running daemon, which then
+fails to use its private keys until it is unlocked with 'ipfs key unlock'.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		ks, err := daemonKeylock(env)
+		if err != nil {
+			return err
+		}
+		ks.Lock()
+		return cmds.EmitOnce(res, &KeyLockOutput{Encrypted: true, Locked: ks.Locked()})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: keyLockEncoder(),
+	},
+	Type: KeyLockOutput{},
+}
+
+func keyLockEncoder() cmds.EncoderFunc {
+	return cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *KeyLockOutput) error {
+		if out.Locked {
+			_, err := fmt.Fprintln(w, "keystore locked")
+			return err
+		}
+		_, err := fmt.Fprintln(w, "keystore unlocked")
+		return err
+	})
+}
+
+// openKeylock opens the repository at repoRoot, returning its keystore.
+func openKeylock(repoRoot string) (*keylock.Keystore, io.Closer, error) {
+	r, err := fsrepo.Open(repoRoot)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening repo (%v)", err)
+	}
+	ks, ok := keylock.Of(r.Keystore())
+	if !ok {
+		r.Close()
+		return nil, nil, keylock.ErrNotEncrypted
+	}
+	return ks, r, nil
+}
+
+// daemonKeylock returns the encrypted keystore of the running daemon.
+func daemonKeylock(env cmds.Environment) (*keylock.Keystore, error) {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if !nd.IsDaemon {
+		return nil, fmt.Errorf("the daemon is not running: the commands run without it unlock the keystore with $%s", keylock.PassphraseEnv)
+	}
+	ks, ok := keylock.Of(nd.Repo.Keystore())
+	if !ok || !ks.Encrypted() {
+		return nil, keylock.ErrNotEncrypted
+	}
+	return ks, nil
+}
+
+// promptPassphrase reads a passphrase on the terminal, without echoing it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("no passphrase given: set $%s", keylock.PassphraseEnv)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(pass) == 0 {
+		return nil, errors.New("the passphrase is empty")
+	}
+	return pass, nil
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+)
+
+const (
+	// opensshPemType is the type of the PEM block of the private keys of
+	// OpenSSH.
+	opensshPemType = "OPENSSH PRIVATE KEY"
+	opensshMagic   = "openssh-key-v1\x00"
+	opensshEd25519 = "ssh-ed25519"
+)
+
+// appendSSHString appends s to b as a string of the SSH wire format: its
+// length, as a big endian uint32, followed by its bytes.
+func appendSSHString(b []byte, s []byte) []byte {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(s)))
+	return append(append(b, l[:]...), s...)
+}
+
+// marshalOpenSSHEd25519 encodes k in the openssh-key-v1 format of the private
+// keys written by ssh-keygen, unencrypted, as described in the PROTOCOL.key
+// file of OpenSSH. The bytes returned are to be wrapped in a PEM block of type
+// opensshPemType.
+func marshalOpenSSHEd25519(k ed25519.PrivateKey) ([]byte, error) {
+	pub := k.Public().(ed25519.PublicKey)
+
+	pubBlob := appendSSHString(nil, []byte(opensshEd25519))
+	pubBlob = appendSSHString(pubBlob, pub)
+
+	// the check ints tell a wrong passphrase of an encrypted key, they are
+	// the same random value
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+	priv := append(check[:], check[:]...)
+	priv = appendSSHString(priv, []byte(opensshEd25519))
+	priv = appendSSHString(priv, pub)
+	priv = appendSSHString(priv, k)
+	priv = appendSSHString(priv, nil) // comment
+	// padded to the block size of the cipher, 8 when none
+	for i := byte(1); len(priv)%8 != 0; i++ {
+		priv = append(priv, i)
+	}
+
+	out := []byte(opensshMagic)
+	out = appendSSHString(out, []byte("none")) // cipher
+	out = appendSSHString(out, []byte("none")) // kdf
+	out = appendSSHString(out, nil)            // kdf options
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], 1)
+	out = append(out, n[:]...)
+	out = appendSSHString(out, pubBlob)
+	out = appendSSHString(out, priv)
+	return out, nil
+}
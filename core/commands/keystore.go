@@ -5,6 +5,7 @@ import (
 	"crypto/ed25519"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,17 +15,18 @@ import (
 	"text/tabwriter"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
-	keystore "github.com/ipfs/go-ipfs-keystore"
 	oldcmds "github.com/ipfs/go-ipfs/commands"
 	config "github.com/ipfs/go-ipfs/config"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	"github.com/ipfs/go-ipfs/core/commands/e"
 	ke "github.com/ipfs/go-ipfs/core/commands/keyencode"
+	keylock "github.com/ipfs/go-ipfs/keylock"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	migrations "github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/crypto/ssh"
 )
 
 var KeyCmd = &cmds.Command{
@@ -45,13 +47,17 @@ publish'.
 		`,
 	},
 	Subcommands: map[string]*cmds.Command{
-		"gen":    keyGenCmd,
-		"export": keyExportCmd,
-		"import": keyImportCmd,
-		"list":   keyListCmd,
-		"rename": keyRenameCmd,
-		"rm":     keyRmCmd,
-		"rotate": keyRotateCmd,
+		"gen":     keyGenCmd,
+		"export":  keyExportCmd,
+		"import":  keyImportCmd,
+		"list":    keyListCmd,
+		"rename":  keyRenameCmd,
+		"rm":      keyRmCmd,
+		"rotate":  keyRotateCmd,
+		"encrypt": keyEncryptCmd,
+		"decrypt": keyDecryptCmd,
+		"unlock":  keyUnlockCmd,
+		"lock":    keyLockCmd,
 	},
 }
 
@@ -140,10 +146,11 @@ var keyGenCmd = &cmds.Command{
 
 const (
 	// Key format options used both for importing and exporting.
-	keyFormatOptionName            = "format"
-	keyFormatPemCleartextOption    = "pem-pkcs8-cleartext"
-	keyFormatLibp2pCleartextOption = "libp2p-protobuf-cleartext"
-	keyAllowAnyTypeOptionName      = "allow-any-key-type"
+	keyFormatOptionName             = "format"
+	keyFormatPemCleartextOption     = "pem-pkcs8-cleartext"
+	keyFormatOpensshCleartextOption = "pem-openssh-cleartext"
+	keyFormatLibp2pCleartextOption  = "libp2p-protobuf-cleartext"
+	keyAllowAnyTypeOptionName       = "allow-any-key-type"
 )
 
 var keyExportCmd = &cmds.Command{
@@ -161,6 +168,15 @@ elsewhere. For example, using openssl to get a PEM with public key:
 
   $ ipfs key export testkey --format=pem-pkcs8-cleartext -o privkey.pem
   $ openssl pkey -in privkey.pem -pubout > pubkey.pem
+
+An ed25519 key can also be exported as an OpenSSH private key, as written by
+ssh-keygen, with '--format=pem-openssh-cleartext':
+
+  $ ipfs key export testkey --format=pem-openssh-cleartext -o id_ed25519
+  $ ssh-keygen -y -f id_ed25519 > id_ed25519.pub
+
+When the keystore is encrypted, its passphrase is read from
+$IPFS_KEYSTORE_PASSPHRASE, or asked for on the terminal.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -168,7 +184,7 @@ elsewhere. For example, using openssl to get a PEM with public key:
 	},
 	Options: []cmds.Option{
 		cmds.StringOption(outputOptionName, "o", "The path where the output should be stored."),
-		cmds.StringOption(keyFormatOptionName, "f", "The format of the exported private key, libp2p-protobuf-cleartext or pem-pkcs8-cleartext.").WithDefault(keyFormatLibp2pCleartextOption),
+		cmds.StringOption(keyFormatOptionName, "f", "The format of the exported private key, libp2p-protobuf-cleartext, pem-pkcs8-cleartext or pem-openssh-cleartext.").WithDefault(keyFormatLibp2pCleartextOption),
 	},
 	NoRemote: true,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
@@ -195,10 +211,22 @@ elsewhere. For example, using openssl to get a PEM with public key:
 		// Export is read-only: safe to read it without acquiring repo lock
 		// (this makes export work when ipfs daemon is already running)
 		ksp := filepath.Join(cfgRoot, "keystore")
-		ks, err := keystore.NewFSKeystore(ksp)
+		ks, err := keylock.Open(ksp)
 		if err != nil {
 			return err
 		}
+		if err := ks.UnlockFromEnv(); err != nil {
+			return fmt.Errorf("unlocking the keystore: %w", err)
+		}
+		if ks.Locked() {
+			pass, err := promptPassphrase("Enter the passphrase of the keystore: ")
+			if err != nil {
+				return err
+			}
+			if err := ks.Unlock(pass); err != nil {
+				return err
+			}
+		}
 
 		sk, err := ks.Get(name)
 		if err != nil {
@@ -227,6 +255,22 @@ elsewhere. For example, using openssl to get a PEM with public key:
 				return fmt.Errorf("marshalling key to PKCS8 format: %w", err)
 			}
 
+		case keyFormatOpensshCleartextOption:
+			// OpenSSH has its own format for ed25519 keys only, the
+			// others are exported in PKCS8
+			edKey, ok := sk.(*crypto.Ed25519PrivateKey)
+			if !ok {
+				return fmt.Errorf("only ed25519 keys are exported with format=%s: try again with format=%s", keyFormatOpensshCleartextOption, keyFormatPemCleartextOption)
+			}
+			raw, err := edKey.Raw()
+			if err != nil {
+				return err
+			}
+			formattedKey, err = marshalOpenSSHEd25519(ed25519.PrivateKey(raw))
+			if err != nil {
+				return fmt.Errorf("marshalling key to OpenSSH format: %w", err)
+			}
+
 		case keyFormatLibp2pCleartextOption:
 			formattedKey, err = crypto.MarshalPrivateKey(sk)
 			if err != nil {
@@ -259,6 +303,8 @@ elsewhere. For example, using openssl to get a PEM with public key:
 				switch exportFormat {
 				case keyFormatPemCleartextOption:
 					fileExtension = "pem"
+				case keyFormatOpensshCleartextOption:
+					fileExtension = "openssh"
 				case keyFormatLibp2pCleartextOption:
 					fileExtension = "key"
 				}
@@ -267,22 +313,27 @@ elsewhere. For example, using openssl to get a PEM with public key:
 				outPath = filepath.Clean(outPath)
 			}
 
-			// create file
-			file, err := os.Create(outPath)
+			// create file, readable by the user only as ssh requires for
+			// its keys
+			file, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 			if err != nil {
 				return err
 			}
 			defer file.Close()
 
 			switch exportFormat {
-			case keyFormatPemCleartextOption:
+			case keyFormatPemCleartextOption, keyFormatOpensshCleartextOption:
 				privKeyBytes, err := ioutil.ReadAll(outReader)
 				if err != nil {
 					return err
 				}
 
+				pemType := "PRIVATE KEY"
+				if exportFormat == keyFormatOpensshCleartextOption {
+					pemType = opensshPemType
+				}
 				err = pem.Encode(file, &pem.Block{
-					Type:  "PRIVATE KEY",
+					Type:  pemType,
 					Bytes: privKeyBytes,
 				})
 				if err != nil {
@@ -309,17 +360,24 @@ Imports a key and stores it under the provided name.
 
 By default, the key is assumed to be in 'libp2p-protobuf-cleartext' format,
 however it is possible to import private keys wrapped in interoperable PEM PKCS8
-by passing '--format=pem-pkcs8-cleartext'.
+by passing '--format=pem-pkcs8-cleartext'. The traditional PEM formats of RSA
+(PKCS1) and EC (SEC1) private keys are read as well.
 
 The PEM format allows for key generation outside of the IPFS node:
 
   $ openssl genpkey -algorithm ED25519 > ed25519.pem
   $ ipfs key import test-openssl -f pem-pkcs8-cleartext ed25519.pem
+
+The private keys of OpenSSH, not encrypted, are imported with
+'--format=pem-openssh-cleartext':
+
+  $ ssh-keygen -t ed25519 -N '' -f id_ed25519
+  $ ipfs key import test-ssh -f pem-openssh-cleartext id_ed25519
 `,
 	},
 	Options: []cmds.Option{
 		ke.OptionIPNSBase,
-		cmds.StringOption(keyFormatOptionName, "f", "The format of the private key to import, libp2p-protobuf-cleartext or pem-pkcs8-cleartext.").WithDefault(keyFormatLibp2pCleartextOption),
+		cmds.StringOption(keyFormatOptionName, "f", "The format of the private key to import, libp2p-protobuf-cleartext, pem-pkcs8-cleartext or pem-openssh-cleartext.").WithDefault(keyFormatLibp2pCleartextOption),
 		cmds.BoolOption(keyAllowAnyTypeOptionName, "Allow importing any key type.").WithDefault(false),
 	},
 	Arguments: []cmds.Argument{
@@ -358,15 +416,29 @@ The PEM format allows for key generation outside of the IPFS node:
 				return fmt.Errorf("PEM block not found in input data:\n%s", rest)
 			}
 
-			if pemBlock.Type != "PRIVATE KEY" {
+			var stdKey interface{}
+			switch pemBlock.Type {
+			case "PRIVATE KEY":
+				stdKey, err = x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
+				if err != nil {
+					return fmt.Errorf("parsing PKCS8 format: %w", err)
+				}
+			case "RSA PRIVATE KEY":
+				stdKey, err = x509.ParsePKCS1PrivateKey(pemBlock.Bytes)
+				if err != nil {
+					return fmt.Errorf("parsing PKCS1 format: %w", err)
+				}
+			case "EC PRIVATE KEY":
+				stdKey, err = x509.ParseECPrivateKey(pemBlock.Bytes)
+				if err != nil {
+					return fmt.Errorf("parsing SEC1 format: %w", err)
+				}
+			case opensshPemType:
+				return fmt.Errorf("unexpected %s type in PEM block for format=%s: try again with format=%s", pemBlock.Type, keyFormatPemCleartextOption, keyFormatOpensshCleartextOption)
+			default:
 				return fmt.Errorf("expected PRIVATE KEY type in PEM block but got: %s", pemBlock.Type)
 			}
 
-			stdKey, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes)
-			if err != nil {
-				return fmt.Errorf("parsing PKCS8 format: %w", err)
-			}
-
 			// In case ed25519.PrivateKey is returned we need the pointer for
 			// conversion to libp2p (see export command for more details).
 			if ed25519KeyPointer, ok := stdKey.(ed25519.PrivateKey); ok {
@@ -378,6 +450,23 @@ The PEM format allows for key generation outside of the IPFS node:
 				return fmt.Errorf("converting std Go key to libp2p key: %w", err)
 
 			}
+		case keyFormatOpensshCleartextOption:
+			stdKey, err := ssh.ParseRawPrivateKey(data)
+			if err != nil {
+				var missing *ssh.PassphraseMissingError
+				if errors.As(err, &missing) {
+					return fmt.Errorf("the OpenSSH key is encrypted: decrypt it first with 'ssh-keygen -p'")
+				}
+				return fmt.Errorf("parsing OpenSSH format: %w", err)
+			}
+			if ed25519KeyPointer, ok := stdKey.(ed25519.PrivateKey); ok {
+				stdKey = &ed25519KeyPointer
+			}
+
+			sk, _, err = crypto.KeyPairFromStdKey(stdKey)
+			if err != nil {
+				return fmt.Errorf("converting std Go key to libp2p key: %w", err)
+			}
 		case keyFormatLibp2pCleartextOption:
 			sk, err = crypto.UnmarshalPrivateKey(data)
 			if err != nil {
@@ -418,8 +507,11 @@ The PEM format allows for key generation outside of the IPFS node:
 		}
 		defer r.Close()
 
-		_, err = r.Keystore().Get(name)
-		if err == nil {
+		exists, err := r.Keystore().Has(name)
+		if err != nil {
+			return err
+		}
+		if exists {
 			return fmt.Errorf("key with name '%s' already exists", name)
 		}
 
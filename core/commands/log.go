@@ -1,12 +1,16 @@
 package commands
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
+	gopath "path"
+	"strings"
+	"time"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	logging "github.com/ipfs/go-log"
-	lwriter "github.com/ipfs/go-log/writer"
+	"go.uber.org/zap/zapcore"
 )
 
 // Golang os.Args overrides * and replaces the character argument with
@@ -104,22 +108,140 @@ subsystems of a running daemon.
 	Type: stringList{},
 }
 
+const (
+	logSubsystemOptionName = "subsystem"
+	logLevelOptionName     = "level"
+	logSinceOptionName     = "since"
+)
+
 var logTailCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
-		Tagline: "Read the event log.",
+		Tagline: "Read the daemon log.",
 		ShortDescription: `
-Outputs event log messages (not other log messages) as they are generated.
+Outputs the log messages of the daemon as they are generated.
 `,
-	},
+		LongDescription: `
+Outputs the log messages of the daemon as they are generated, with the
+following format:
+
+  <time> <level> <subsystem> <caller> <message> <fields>
+
+Use --enc=json to get one JSON object per message instead.
+
+Only the messages enabled by 'ipfs log level' are logged. Among them, use
+--subsystem to only output the messages of some subsystems, and --level to
+only output the messages at or above a level. Subsystems can be glob
+patterns, e.g. 'core/*'.
 
+Use --since to first output the recent messages logged at or after a time,
+given either as an RFC 3339 timestamp or as a duration before now (e.g.
+'10m'). The daemon keeps the last 1024 messages.
+
+Messages are dropped when the client cannot keep up with them.
+
+Example:
+
+  > ipfs log tail --subsystem=bitswap --subsystem=core/server --level=info --since=5m
+`,
+	},
+	NoLocal: true,
+	Options: []cmds.Option{
+		cmds.StringsOption(logSubsystemOptionName, "s", "Only output the messages of these subsystems."),
+		cmds.StringOption(logLevelOptionName, "l", "Only output the messages at or above this level."),
+		cmds.StringOption(logSinceOptionName, "Output the messages logged since this time or duration first."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		ctx := req.Context
-		r, w := io.Pipe()
-		go func() {
-			defer w.Close()
-			<-ctx.Done()
-		}()
-		lwriter.WriterGroup.AddWriter(w)
-		return res.Emit(r)
+		subsystems, _ := req.Options[logSubsystemOptionName].([]string)
+		for _, s := range subsystems {
+			if _, err := gopath.Match(s, ""); err != nil {
+				return fmt.Errorf("invalid subsystem pattern %q: %w", s, err)
+			}
+		}
+
+		minLevel := zapcore.DebugLevel
+		if l, ok := req.Options[logLevelOptionName].(string); ok {
+			if err := minLevel.UnmarshalText([]byte(l)); err != nil {
+				return fmt.Errorf("invalid log level %q", l)
+			}
+		}
+
+		var since time.Time
+		if s, ok := req.Options[logSinceOptionName].(string); ok {
+			var err error
+			since, err = parseLogSince(s)
+			if err != nil {
+				return err
+			}
+		}
+
+		match := func(e *LogEntry) bool {
+			if logEntryLevel(e) < minLevel {
+				return false
+			}
+			if len(subsystems) == 0 {
+				return true
+			}
+			for _, s := range subsystems {
+				if ok, _ := gopath.Match(s, e.Subsystem); ok {
+					return true
+				}
+			}
+			return false
+		}
+
+		StartLogHistory()
+		past, entries, cancel := logs.subscribe(since)
+		defer cancel()
+
+		for _, e := range past {
+			if !match(e) {
+				continue
+			}
+			if err := res.Emit(e); err != nil {
+				return err
+			}
+		}
+
+		for {
+			select {
+			case e := <-entries:
+				if !match(e) {
+					continue
+				}
+				if err := res.Emit(e); err != nil {
+					return err
+				}
+			case <-req.Context.Done():
+				return nil
+			}
+		}
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, e *LogEntry) error {
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s",
+				e.Time.Format("2006-01-02T15:04:05.000Z0700"), strings.ToUpper(e.Level), e.Subsystem, e.Caller, e.Message)
+			if len(e.Fields) > 0 {
+				fields, err := json.Marshal(e.Fields)
+				if err != nil {
+					return err
+				}
+				line += "\t" + string(fields)
+			}
+			_, err := fmt.Fprintln(w, line)
+			return err
+		}),
 	},
+	Type: LogEntry{},
+}
+
+// parseLogSince parses an RFC 3339 timestamp, or a duration before now.
+func parseLogSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: must be an RFC 3339 timestamp or a duration", s)
+	}
+	return time.Now().Add(-d), nil
 }
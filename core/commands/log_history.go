@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.uber.org/zap/zapcore"
+)
+
+// logHistorySize is the number of log entries kept to be replayed by
+// 'ipfs log tail --since'.
+const logHistorySize = 1024
+
+// logTailBuffer is the number of log entries queued for each 'ipfs log tail'
+// before entries get dropped.
+const logTailBuffer = 256
+
+// LogEntry is a log message of the daemon.
+type LogEntry struct {
+	Time      time.Time
+	Level     string
+	Subsystem string
+	Caller    string                 `json:",omitempty"`
+	Message   string                 `json:",omitempty"`
+	Fields    map[string]interface{} `json:",omitempty"`
+}
+
+// logHistory records the log messages of the process: it keeps the most recent
+// ones and sends new ones to subscribers.
+type logHistory struct {
+	mu      sync.Mutex
+	entries []*LogEntry // ring buffer
+	next    int
+	subs    map[chan *LogEntry]struct{}
+}
+
+var (
+	logHistoryOnce sync.Once
+	logs           *logHistory
+)
+
+// StartLogHistory starts recording the log messages of the process, so that
+// 'ipfs log tail' can replay the recent ones. It is called by the daemon at
+// startup, and on the first 'ipfs log tail' otherwise.
+func StartLogHistory() {
+	logHistoryOnce.Do(func() {
+		logs = &logHistory{
+			entries: make([]*LogEntry, 0, logHistorySize),
+			subs:    make(map[chan *LogEntry]struct{}),
+		}
+		go logs.record(logging.NewPipeReader())
+	})
+}
+
+func (h *logHistory) record(r *logging.PipeReader) {
+	defer r.Close()
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for s.Scan() {
+		e, err := parseLogEntry(s.Bytes())
+		if err != nil {
+			continue
+		}
+		h.add(e)
+	}
+}
+
+func (h *logHistory) add(e *LogEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.entries) < logHistorySize {
+		h.entries = append(h.entries, e)
+	} else {
+		h.entries[h.next] = e
+	}
+	h.next = (h.next + 1) % logHistorySize
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			// the subscriber isn't keeping up, logging must not block
+		}
+	}
+}
+
+// subscribe returns the recorded entries logged at or after since, and a
+// channel receiving the new ones until cancel is called.
+func (h *logHistory) subscribe(since time.Time) ([]*LogEntry, <-chan *LogEntry, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var past []*LogEntry
+	if !since.IsZero() {
+		n := len(h.entries)
+		for i := 0; i < n; i++ {
+			e := h.entries[(h.next+i)%n]
+			if !e.Time.Before(since) {
+				past = append(past, e)
+			}
+		}
+	}
+
+	ch := make(chan *LogEntry, logTailBuffer)
+	h.subs[ch] = struct{}{}
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, ch)
+	}
+	return past, ch, cancel
+}
+
+// parseLogEntry parses a log message encoded by the JSON format of go-log.
+func parseLogEntry(b []byte) (*LogEntry, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+
+	e := &LogEntry{}
+	if ts, ok := fields["ts"].(string); ok {
+		e.Time, _ = time.Parse("2006-01-02T15:04:05.000Z0700", ts)
+	}
+	e.Level, _ = fields["level"].(string)
+	e.Subsystem, _ = fields["logger"].(string)
+	e.Caller, _ = fields["caller"].(string)
+	e.Message, _ = fields["msg"].(string)
+	for _, k := range []string{"ts", "level", "logger", "caller", "msg"} {
+		delete(fields, k)
+	}
+	if len(fields) > 0 {
+		e.Fields = fields
+	}
+	return e, nil
+}
+
+// logEntryLevel returns the level of e, or the lowest level if it is unknown.
+func logEntryLevel(e *LogEntry) zapcore.Level {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(e.Level)); err != nil {
+		return zapcore.DebugLevel
+	}
+	return l
+}
@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/lowpower"
+)
+
+const (
+	lowPowerAwakeOptionName              = "awake"
+	lowPowerSleepOptionName              = "sleep"
+	lowPowerIntervalMultiplierOptionName = "interval-multiplier"
+)
+
+// LowPowerOutput is the state of the low-power mode
+type LowPowerOutput struct {
+	Enabled bool
+	Asleep  bool
+	// Until is when the current awake or sleep period ends, if enabled
+	Until              *time.Time `json:",omitempty"`
+	Awake              string
+	Sleep              string
+	IntervalMultiplier int
+}
+
+func newLowPowerOutput(s lowpower.Status) *LowPowerOutput {
+	out := &LowPowerOutput{
+		Enabled:            s.Enabled,
+		Asleep:             s.Asleep,
+		Awake:              s.Awake.String(),
+		Sleep:              s.Sleep.String(),
+		IntervalMultiplier: s.IntervalMultiplier,
+	}
+	if s.Enabled {
+		out.Until = &s.Until
+	}
+	return out
+}
+
+var LowPowerCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Control the low-power mode of the daemon.",
+		ShortDescription: `
+The low-power mode reduces the network activity of the daemon, for battery or
+solar powered devices. The daemon is awake for a while, then sleeps for a
+while: provides made while asleep are batched until it wakes up, reprovides
+and IPNS republishes only happen while awake and are spaced out by the
+interval multiplier, and connections are trimmed when falling asleep.
+
+The mode is enabled on start with LowPower.Enabled, or the 'lowpower-v2'
+config profile, which also makes the node a DHT client rather than a DHT
+server. It can be switched at any time with 'ipfs lowpower enable' and
+'ipfs lowpower disable', which do not change the config.
+
+The DHT mode is only chosen when the daemon starts: enabling the low-power
+mode at runtime leaves a DHT server answering the DHT queries, and disabling
+it leaves a DHT client in client mode, until the daemon restarts.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status":  lowPowerStatusCmd,
+		"enable":  lowPowerEnableCmd,
+		"disable": lowPowerDisableCmd,
+	},
+}
+
+var lowPowerEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *LowPowerOutput) error {
+		if !out.Enabled {
+			fmt.Fprintln(w, "low-power mode disabled")
+			return nil
+		}
+		state := "awake"
+		if out.Asleep {
+			state = "asleep"
+		}
+		fmt.Fprintf(w, "low-power mode enabled: awake %s, asleep %s, intervals x%d\n", out.Awake, out.Sleep, out.IntervalMultiplier)
+		if out.Until != nil {
+			fmt.Fprintf(w, "%s until %s\n", state, out.Until.Format(time.RFC3339))
+		}
+		return nil
+	}),
+}
+
+var lowPowerStatusCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the state of the low-power mode.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.LowPower == nil {
+			return ErrNotOnline
+		}
+		return cmds.EmitOnce(res, newLowPowerOutput(nd.LowPower.Status()))
+	},
+	Type:     LowPowerOutput{},
+	Encoders: lowPowerEncoders,
+}
+
+var lowPowerEnableCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Enable the low-power mode, or change its settings.",
+		ShortDescription: `
+Enables the low-power mode, starting with an awake period. The settings left
+out keep their current value, which defaults to those in the LowPower config
+section.
+
+The DHT mode is not changed: a DHT server keeps answering the DHT queries
+while awake. Set LowPower.Enabled and restart the daemon to run the DHT in
+client mode.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(lowPowerAwakeOptionName, "How long the daemon is awake in each duty cycle."),
+		cmds.StringOption(lowPowerSleepOptionName, "How long the daemon sleeps in each duty cycle, 0 to stay awake."),
+		cmds.IntOption(lowPowerIntervalMultiplierOptionName, "How much longer the reprovide and republish intervals get."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.LowPower == nil {
+			return ErrNotOnline
+		}
+
+		settings := nd.LowPower.Status().Settings
+		if s, ok := req.Options[lowPowerAwakeOptionName].(string); ok {
+			if settings.Awake, err = time.ParseDuration(s); err != nil {
+				return fmt.Errorf("invalid awake duration: %w", err)
+			}
+		}
+		if s, ok := req.Options[lowPowerSleepOptionName].(string); ok {
+			if settings.Sleep, err = time.ParseDuration(s); err != nil {
+				return fmt.Errorf("invalid sleep duration: %w", err)
+			}
+		}
+		if m, ok := req.Options[lowPowerIntervalMultiplierOptionName].(int); ok {
+			settings.IntervalMultiplier = m
+		}
+
+		if err := nd.LowPower.Enable(settings); err != nil {
+			return cmds.Errorf(cmds.ErrClient, err.Error())
+		}
+		return cmds.EmitOnce(res, newLowPowerOutput(nd.LowPower.Status()))
+	},
+	Type:     LowPowerOutput{},
+	Encoders: lowPowerEncoders,
+}
+
+var lowPowerDisableCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Disable the low-power mode.",
+		ShortDescription: `
+Disables the low-power mode, waking the daemon up. The DHT mode is not
+changed: a daemon started in low-power mode stays a DHT client until it
+restarts.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if nd.LowPower == nil {
+			return ErrNotOnline
+		}
+		nd.LowPower.Disable()
+		return cmds.EmitOnce(res, newLowPowerOutput(nd.LowPower.Status()))
+	},
+	Type:     LowPowerOutput{},
+	Encoders: lowPowerEncoders,
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	gopath "path"
 	"sort"
+	"strings"
 	"text/tabwriter"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
@@ -43,6 +45,16 @@ const (
 	lsResolveTypeOptionName = "resolve-type"
 	lsSizeOptionName        = "size"
 	lsStreamOptionName      = "stream"
+	lsRecursiveOptionName   = "recursive"
+	lsTreeOptionName        = "tree"
+	lsSortOptionName        = "sort"
+	lsFilterOptionName      = "filter"
+)
+
+const (
+	lsSortName = "name"
+	lsSortSize = "size"
+	lsSortNone = "none"
 )
 
 var LsCmd = &cmds.Command{
@@ -55,6 +67,28 @@ the following format:
   <link base58 hash> <link size in bytes> <link name>
 
 The JSON output contains type information.
+`,
+		LongDescription: `
+Displays the contents of an IPFS or IPNS object(s) at the given path, with
+the following format:
+
+  <link base58 hash> <link size in bytes> <link name>
+
+The JSON output contains type information.
+
+With --recursive, the contents of the subdirectories are listed too, and the
+name of each entry is its path relative to the listed object. Use --tree to
+display them as an indented tree instead.
+
+Entries are sorted by name, unless --stream is given. Use --sort to sort the
+entries of each directory by name or by size, or not to sort them at all.
+
+Use --filter to only list the entries whose name matches a glob pattern, as
+supported by Go's path.Match. With --recursive, the subdirectories are listed
+even when their name does not match.
+
+Use --stream with --enc=json to get newline-delimited JSON output, with one
+entry per line.
 `,
 	},
 
@@ -66,16 +100,43 @@ The JSON output contains type information.
 		cmds.BoolOption(lsResolveTypeOptionName, "Resolve linked objects to find out their types.").WithDefault(true),
 		cmds.BoolOption(lsSizeOptionName, "Resolve linked objects to find out their file size.").WithDefault(true),
 		cmds.BoolOption(lsStreamOptionName, "s", "Enable experimental streaming of directory entries as they are traversed."),
+		cmds.BoolOption(lsRecursiveOptionName, "r", "List the contents of subdirectories too."),
+		cmds.BoolOption(lsTreeOptionName, "Display recursive listings as a tree."),
+		cmds.StringOption(lsSortOptionName, "Sort the entries of each directory: name, size or none. Default: name, or none with --stream."),
+		cmds.StringOption(lsFilterOptionName, "Only list the entries whose name matches this glob pattern."),
+		cmdenv.OptionProviders,
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
+		if err := cmdenv.ConnectProviders(req, api); err != nil {
+			return err
+		}
 
 		resolveType, _ := req.Options[lsResolveTypeOptionName].(bool)
 		resolveSize, _ := req.Options[lsSizeOptionName].(bool)
 		stream, _ := req.Options[lsStreamOptionName].(bool)
+		recursive, _ := req.Options[lsRecursiveOptionName].(bool)
+		filter, _ := req.Options[lsFilterOptionName].(string)
+		sortBy, _ := req.Options[lsSortOptionName].(string)
+
+		switch sortBy {
+		case "":
+			sortBy = lsSortName
+			if stream {
+				sortBy = lsSortNone
+			}
+		case lsSortName, lsSortSize, lsSortNone:
+		default:
+			return fmt.Errorf("unknown sort order %q, must be one of %q, %q or %q", sortBy, lsSortName, lsSortSize, lsSortNone)
+		}
+		if filter != "" {
+			if _, err := gopath.Match(filter, ""); err != nil {
+				return fmt.Errorf("invalid filter %q: %w", filter, err)
+			}
+		}
 
 		err = req.ParseBodyArgs()
 		if err != nil {
@@ -114,10 +175,6 @@ The JSON output contains type information.
 						return nil
 					}, func(i int) {
 						// after each dir
-						sort.Slice(outputLinks, func(i, j int) bool {
-							return outputLinks[i].Name < outputLinks[j].Name
-						})
-
 						output[i] = LsObject{
 							Hash:  paths[i],
 							Links: outputLinks,
@@ -130,39 +187,66 @@ The JSON output contains type information.
 			}
 		}
 
-		for i, fpath := range paths {
-			results, err := api.Unixfs().Ls(req.Context, path.New(fpath),
-				options.Unixfs.ResolveChildren(resolveSize || resolveType))
+		// types are needed to find the subdirectories
+		lsOpts := options.Unixfs.ResolveChildren(resolveSize || resolveType || recursive)
+
+		// lsDir processes the entries of the directory at p, named by their
+		// path prefixed with prefix, and of its subdirectories if recursive.
+		var lsDir func(root string, p path.Path, prefix string) error
+		lsDir = func(root string, p path.Path, prefix string) error {
+			results, err := api.Unixfs().Ls(req.Context, p, lsOpts)
 			if err != nil {
 				return err
 			}
 
-			processLink, dirDone = processDir()
-			for link := range results {
-				if link.Err != nil {
-					return link.Err
-				}
-				var ftype unixfs_pb.Data_DataType
-				switch link.Type {
-				case iface.TFile:
-					ftype = unixfs.TFile
-				case iface.TDirectory:
-					ftype = unixfs.TDirectory
-				case iface.TSymlink:
-					ftype = unixfs.TSymlink
-				}
+			visit := func(link iface.DirEntry) error {
 				lsLink := LsLink{
-					Name: link.Name,
+					Name: prefix + link.Name,
 					Hash: enc.Encode(link.Cid),
 
 					Size:   link.Size,
-					Type:   ftype,
+					Type:   lsLinkType(link.Type),
 					Target: link.Target,
 				}
-				if err := processLink(paths[i], lsLink); err != nil {
+				if filter == "" || matchLsFilter(filter, link.Name) || (recursive && link.Type == iface.TDirectory) {
+					if err := processLink(root, lsLink); err != nil {
+						return err
+					}
+				}
+				if recursive && link.Type == iface.TDirectory {
+					return lsDir(root, path.IpfsPath(link.Cid), lsLink.Name+"/")
+				}
+				return nil
+			}
+
+			var links []iface.DirEntry
+			for link := range results {
+				if link.Err != nil {
+					return link.Err
+				}
+				if sortBy == lsSortNone {
+					if err := visit(link); err != nil {
+						return err
+					}
+					continue
+				}
+				links = append(links, link)
+			}
+
+			sortLsEntries(links, sortBy)
+			for _, link := range links {
+				if err := visit(link); err != nil {
 					return err
 				}
 			}
+			return nil
+		}
+
+		for i, fpath := range paths {
+			processLink, dirDone = processDir()
+			if err := lsDir(paths[i], path.New(fpath), ""); err != nil {
+				return err
+			}
 			dirDone(i)
 		}
 		return done()
@@ -170,6 +254,9 @@ The JSON output contains type information.
 	PostRun: cmds.PostRunMap{
 		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
 			req := res.Request()
+			if cmds.GetEncoding(req, cmds.Text) != cmds.Text {
+				return cmds.Copy(re, res)
+			}
 			lastObjectHash := ""
 
 			for {
@@ -198,10 +285,39 @@ The JSON output contains type information.
 	Type: LsOutput{},
 }
 
+func lsLinkType(t iface.FileType) unixfs_pb.Data_DataType {
+	switch t {
+	case iface.TFile:
+		return unixfs.TFile
+	case iface.TDirectory:
+		return unixfs.TDirectory
+	case iface.TSymlink:
+		return unixfs.TSymlink
+	}
+	return 0
+}
+
+// matchLsFilter reports whether name matches the glob pattern, which has
+// already been checked to be valid.
+func matchLsFilter(pattern, name string) bool {
+	ok, _ := gopath.Match(pattern, name)
+	return ok
+}
+
+func sortLsEntries(links []iface.DirEntry, sortBy string) {
+	sort.SliceStable(links, func(i, j int) bool {
+		if sortBy == lsSortSize && links[i].Size != links[j].Size {
+			return links[i].Size < links[j].Size
+		}
+		return links[i].Name < links[j].Name
+	})
+}
+
 func tabularOutput(req *cmds.Request, w io.Writer, out *LsOutput, lastObjectHash string, ignoreBreaks bool) string {
 	headers, _ := req.Options[lsHeadersOptionNameTime].(bool)
 	stream, _ := req.Options[lsStreamOptionName].(bool)
 	size, _ := req.Options[lsSizeOptionName].(bool)
+	tree, _ := req.Options[lsTreeOptionName].(bool)
 	// in streaming mode we can't automatically align the tabs
 	// so we take a best guess
 	var minTabWidth int
@@ -251,7 +367,14 @@ func tabularOutput(req *cmds.Request, w io.Writer, out *LsOutput, lastObjectHash
 				}
 			}
 
-			fmt.Fprintf(tw, s, link.Hash, link.Size, cmdenv.EscNonPrint(link.Name))
+			name := link.Name
+			if tree {
+				// indent the entries of subdirectories under their parent
+				depth := strings.Count(name, "/")
+				name = strings.Repeat("  ", depth) + gopath.Base(name)
+			}
+
+			fmt.Fprintf(tw, s, link.Hash, link.Size, cmdenv.EscNonPrint(name))
 		}
 	}
 	tw.Flush()
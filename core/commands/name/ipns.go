@@ -1,26 +1,38 @@
 package name
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/ipfs/go-ipfs/apierr"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/ipnscache"
+	"github.com/ipfs/go-ipfs/namechain"
 	namesys "github.com/ipfs/go-namesys"
 
+	ds "github.com/ipfs/go-datastore"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	logging "github.com/ipfs/go-log"
 	path "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 )
 
 var log = logging.Logger("core/commands/ipns")
 
 type ResolvedPath struct {
 	Path path.Path
+	// Stale is set when the path was resolved from a cached record because
+	// the routing system couldn't resolve the name.
+	Stale bool `json:",omitempty"`
 }
 
 const (
@@ -29,6 +41,9 @@ const (
 	dhtRecordCountOptionName = "dht-record-count"
 	dhtTimeoutOptionName     = "dht-timeout"
 	streamOptionName         = "stream"
+	allowStaleOptionName     = "allow-stale"
+	maxDepthOptionName       = "max-depth"
+	stepTimeoutOptionName    = "step-timeout"
 )
 
 var IpnsCmd = &cmds.Command{
@@ -66,6 +81,27 @@ Resolve the value of a dnslink:
   > ipfs name resolve ipfs.io
   /ipfs/QmaBvfZooxWkrv7D3r8LS9moNjzD2o525XMZze69hhoxf5
 
+The node keeps the last IPNS record it has seen for each name. With
+--allow-stale, a name that can't be resolved, e.g. because the node is offline
+or the DHT lookup failed, resolves to the value of that cached record instead.
+Such results are marked as stale as the name may have been updated since:
+
+  > ipfs name resolve --allow-stale QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+  warning: name could not be resolved, using a cached record that may be stale
+  /ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz
+
+With --offline, names are only resolved from the records stored locally: the
+records published by the node, and the last cached records, marked as stale. A
+name with no such record, or a DNSLink name, fails with an error of the offline
+kind, as resolving it would need the network.
+
+A name can point at another name, e.g. a DNSLink at an IPNS name. With
+--max-depth or --step-timeout, the names of such a chain are resolved one at a
+time, and the error of a name failing to resolve tells which one it is:
+
+  > ipfs name resolve --max-depth=3 --step-timeout=10s example.com
+  Error: step 2 of the name resolution, /ipns/k51...: name resolution timed out after 10s
+
 `,
 	},
 
@@ -78,6 +114,9 @@ Resolve the value of a dnslink:
 		cmds.UintOption(dhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution."),
 		cmds.StringOption(dhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution eg \"30s\". Pass 0 for no timeout."),
 		cmds.BoolOption(streamOptionName, "s", "Stream entries as they are found."),
+		cmds.BoolOption(allowStaleOptionName, "Fall back to the last cached record if the name can't be resolved."),
+		cmds.IntOption(maxDepthOptionName, "Max number of names resolved with --recursive."),
+		cmds.StringOption(stepTimeoutOptionName, "Max time to resolve each name with --recursive eg \"10s\"."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -102,6 +141,8 @@ Resolve the value of a dnslink:
 		rc, rcok := req.Options[dhtRecordCountOptionName].(uint)
 		dhtt, dhttok := req.Options[dhtTimeoutOptionName].(string)
 		stream, _ := req.Options[streamOptionName].(bool)
+		allowStale, _ := req.Options[allowStaleOptionName].(bool)
+		offline := cmdenv.IsOffline(req)
 
 		opts := []options.NameResolveOption{
 			options.Name.Cache(!nocache),
@@ -128,32 +169,98 @@ Resolve the value of a dnslink:
 			name = "/ipns/" + name
 		}
 
+		// fallback resolves name from the cached records, if allowed, which
+		// is always the case offline.
+		fallback := func(err error) error {
+			if (allowStale || offline) && req.Context.Err() == nil {
+				n, nerr := cmdenv.GetNode(env)
+				if nerr != nil {
+					return nerr
+				}
+				p, serr := resolveStale(req.Context, api, n.Repo.Datastore(), name, recursive, opts, 0)
+				if serr == nil {
+					return res.Emit(&ResolvedPath{Path: p, Stale: true})
+				}
+				log.Debugf("resolving %s from cached records: %s", name, serr)
+			}
+			if offline && apierr.KindOf(err) == apierr.NotFound {
+				return &apierr.NetworkRequiredError{What: "name " + name, Err: err}
+			}
+			return err
+		}
+
+		// the names of a chain are resolved one at a time when it is bounded
+		maxDepth, depthok := req.Options[maxDepthOptionName].(int)
+		stept, steptok := req.Options[stepTimeoutOptionName].(string)
+		if depthok || steptok {
+			if !recursive || stream {
+				return fmt.Errorf("--%s and --%s need --%s, and can't be used with --%s", maxDepthOptionName, stepTimeoutOptionName, recursiveOptionName, streamOptionName)
+			}
+			settings := namechain.Settings{MaxDepth: maxDepth}
+			if steptok {
+				settings.StepTimeout, err = time.ParseDuration(stept)
+				if err != nil {
+					return err
+				}
+			}
+			output, err := namechain.Resolve(req.Context, api.Name(), ipath.New(name), settings, opts...)
+			if err != nil {
+				return fallback(err)
+			}
+			return cmds.EmitOnce(res, &ResolvedPath{Path: path.FromString(output.String())})
+		}
+
 		if !stream {
 			output, err := api.Name().Resolve(req.Context, name, opts...)
 			if err != nil && (recursive || err != namesys.ErrResolveRecursion) {
-				return err
+				return fallback(err)
 			}
 
-			return cmds.EmitOnce(res, &ResolvedPath{path.FromString(output.String())})
+			return cmds.EmitOnce(res, &ResolvedPath{Path: path.FromString(output.String())})
 		}
 
 		output, err := api.Name().Search(req.Context, name, opts...)
 		if err != nil {
-			return err
+			return fallback(err)
 		}
 
+		emitted := false
 		for v := range output {
 			if v.Err != nil && (recursive || v.Err != namesys.ErrResolveRecursion) {
+				if !emitted {
+					return fallback(v.Err)
+				}
 				return v.Err
 			}
-			if err := res.Emit(&ResolvedPath{path.FromString(v.Path.String())}); err != nil {
+			if err := res.Emit(&ResolvedPath{Path: path.FromString(v.Path.String())}); err != nil {
 				return err
 			}
-
+			emitted = true
 		}
 
+		if !emitted && (allowStale || offline) {
+			return fallback(coreiface.ErrResolveFailed)
+		}
 		return nil
 	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			for {
+				v, err := res.Next()
+				if err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if rp, ok := v.(*ResolvedPath); ok && rp.Stale {
+					fmt.Fprintln(os.Stderr, "warning: name could not be resolved, using a cached record that may be stale")
+				}
+				if err := re.Emit(v); err != nil {
+					return err
+				}
+			}
+		},
+	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, rp *ResolvedPath) error {
 			_, err := fmt.Fprintln(w, rp.Path)
@@ -162,3 +269,43 @@ Resolve the value of a dnslink:
 	},
 	Type: ResolvedPath{},
 }
+
+// resolveStale resolves an IPNS name from the last record cached by the node,
+// resolving the names it points to recursively if asked to.
+func resolveStale(ctx context.Context, api coreiface.CoreAPI, d ds.Datastore, name string, recursive bool, opts []options.NameResolveOption, depth int) (path.Path, error) {
+	if depth >= nsopts.DefaultDepthLimit {
+		return "", namesys.ErrResolveRecursion
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(name, "/ipns/"), "/", 2)
+	id, err := peer.Decode(segments[0])
+	if err != nil {
+		// not an IPNS key, e.g. a DNSLink domain
+		return "", err
+	}
+
+	entry, err := ipnscache.Get(ctx, d, id)
+	if err != nil {
+		return "", err
+	}
+	p, err := path.ParsePath(string(entry.GetValue()))
+	if err != nil {
+		return "", err
+	}
+	if len(segments) > 1 {
+		p, err = path.FromSegments("", p.String(), segments[1])
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !recursive || p.Segments()[0] != "ipns" {
+		return p, nil
+	}
+
+	next, err := api.Name().Resolve(ctx, p.String(), opts...)
+	if err == nil {
+		return path.FromString(next.String()), nil
+	}
+	return resolveStale(ctx, api, d, p.String(), recursive, opts, depth+1)
+}
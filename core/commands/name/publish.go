@@ -7,6 +7,7 @@ import (
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	ke "github.com/ipfs/go-ipfs/core/commands/keyencode"
@@ -85,6 +86,7 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 		cmds.BoolOption(quieterOptionName, "Q", "Write only final hash."),
 		ke.OptionIPNSBase,
 	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
@@ -130,7 +132,7 @@ Alternatively, publish an <ipfs-path> using a valid PeerID (as listed by
 
 		out, err := api.Name().Publish(req.Context, p, opts...)
 		if err != nil {
-			if err == iface.ErrOffline {
+			if errors.Is(err, iface.ErrOffline) {
 				err = errAllowOffline
 			}
 			return err
@@ -0,0 +1,87 @@
+package name
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/namewatch"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// IpnsUpdate is a new value of a name followed by 'ipfs name subscribe'.
+type IpnsUpdate struct {
+	Name     string
+	Value    string
+	Sequence uint64
+}
+
+var IpnsSubscribeCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Follow the value of an IPNS name.",
+		ShortDescription: `
+Outputs the current value of an IPNS name, then its new value each time it is
+published, until canceled. The new records of the name are received over
+pubsub, so the daemon must run with --enable-namesys-pubsub, and the publisher
+must publish over pubsub too.
+`,
+		LongDescription: `
+Outputs the current value of an IPNS name, then its new value each time it is
+published, until canceled. The new records of the name are received over
+pubsub, so the daemon must run with --enable-namesys-pubsub, and the publisher
+must publish over pubsub too.
+
+Records republished with the same value are not output. The value is not
+resolved further, e.g. a name pointing at another name outputs that name.
+
+Examples:
+
+  > ipfs name subscribe k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8
+  /ipfs/QmatmE9msSfkKxoffpHwNLNKgwZG8eT9Bud6YoPab52vpy
+  /ipfs/QmSiTko9JZyabH56y2fussEt1A5oDqsFXB3CkvAqraFryz
+
+The gateway follows names the same way for the requests of /ipns/<name>?watch,
+answered with server-sent events.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "The IPNS name to follow."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if n.PSRouter == nil || n.PubSub == nil {
+			return cmds.Errorf(cmds.ErrClient, "IPNS pubsub subsystem is not enabled")
+		}
+
+		name := strings.TrimPrefix(req.Arguments[0], "/ipns/")
+		pid, err := peer.Decode(name)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, err.Error())
+		}
+
+		w := namewatch.NewWatcher(n.PubSub, n.PSRouter, n.Routing, n.RecordValidator)
+		updates, err := w.Watch(req.Context, pid)
+		if err != nil {
+			return err
+		}
+		for u := range updates {
+			if err := res.Emit(&IpnsUpdate{Name: name, Value: u.Value.String(), Sequence: u.Sequence}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Type: IpnsUpdate{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, u *IpnsUpdate) error {
+			_, err := fmt.Fprintln(w, u.Value)
+			return err
+		}),
+	},
+}
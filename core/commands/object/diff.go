@@ -22,7 +22,7 @@ type Changes struct {
 var ObjectDiffCmd = &cmds.Command{
 	Status: cmds.Deprecated, // https://github.com/ipfs/go-ipfs/issues/7936
 	Helptext: cmds.HelpText{
-		Tagline: "Display the diff between two IPFS objects.",
+		Tagline: "Deprecated way to display the diff between two dag-pb objects: use 'diff' instead.",
 		ShortDescription: `
 'ipfs object diff' is a command used to show the differences between
 two IPFS objects.`,
@@ -10,6 +10,7 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/ipfs/go-cid"
@@ -396,6 +397,7 @@ DEPRECATED and provided for legacy reasons. Use 'ipfs dag put' instead.
 		cmds.BoolOption(pinOptionName, "Pin this object when adding."),
 		cmds.BoolOption(quietOptionName, "q", "Write minimal output."),
 	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
@@ -478,6 +480,7 @@ DEPRECATED and provided for legacy reasons. Use 'dag put' and 'files' instead.
 	Arguments: []cmds.Argument{
 		cmds.StringArg("template", false, false, "Template to use. Optional."),
 	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
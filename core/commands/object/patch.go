@@ -22,7 +22,8 @@ build custom dag-pb objects. It mutates objects, creating new objects as a
 result. This is the Merkle-DAG version of modifying an object.
 
 DEPRECATED and provided for legacy reasons.
-For modern use cases, use MFS with 'files' commands: 'ipfs files --help'.
+For modern use cases, use MFS with 'files' commands: 'ipfs files --help', or
+'ipfs unixfs' to edit UnixFS directories, including sharded ones.
 
   $ ipfs files cp /ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn /some-dir
   $ ipfs files cp /ipfs/Qmayz4F4UzqcAMitTzU4zCSckDofvxstDuj3y7ajsLLEVs /some-dir/added-file.jpg
@@ -37,6 +38,7 @@ For modern use cases, use MFS with 'files' commands: 'ipfs files --help'.
 `,
 	},
 	Arguments: []cmds.Argument{},
+	Extra:     cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Subcommands: map[string]*cmds.Command{
 		"append-data": patchAppendDataCmd,
 		"add-link":    patchAddLinkCmd,
@@ -161,7 +163,8 @@ var patchRmLinkCmd = &cmds.Command{
 		ShortDescription: `
 Remove a Merkle-link from the given object and return the hash of the result.
 
-DEPRECATED and provided for legacy reasons. Use 'files rm' instead.
+DEPRECATED and provided for legacy reasons. Use 'files rm' or
+'ipfs unixfs rm-link' instead.
 `,
 	},
 	Arguments: []cmds.Argument{
@@ -208,9 +211,9 @@ var patchAddLinkCmd = &cmds.Command{
 		ShortDescription: `
 Add a Merkle-link to the given object and return the hash of the result.
 
-DEPRECATED and provided for legacy reasons.
+DEPRECATED and provided for legacy reasons. It corrupts sharded directories.
 
-Use MFS and 'files' commands instead:
+Use 'ipfs unixfs add-link', or MFS and 'files' commands instead:
 
   $ ipfs files cp /ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn /some-dir
   $ ipfs files cp /ipfs/Qmayz4F4UzqcAMitTzU4zCSckDofvxstDuj3y7ajsLLEVs /some-dir/added-file.jpg
@@ -53,6 +53,7 @@ type P2PStreamsOutput struct {
 const (
 	allowCustomProtocolOptionName = "allow-custom-protocol"
 	reportPeerIDOptionName        = "report-peer-id"
+	requestTimeoutOptionName      = "request-timeout"
 )
 
 var resolveTimeout = 10 * time.Second
@@ -70,11 +71,12 @@ are refined`,
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"stream":  p2pStreamCmd,
-		"forward": p2pForwardCmd,
-		"listen":  p2pListenCmd,
-		"close":   p2pCloseCmd,
-		"ls":      p2pLsCmd,
+		"stream":     p2pStreamCmd,
+		"forward":    p2pForwardCmd,
+		"listen":     p2pListenCmd,
+		"http-proxy": p2pHTTPProxyCmd,
+		"close":      p2pCloseCmd,
+		"ls":         p2pLsCmd,
 	},
 }
 
@@ -236,6 +238,68 @@ Example:
 	},
 }
 
+var p2pHTTPProxyCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Create libp2p service proxying HTTP requests.",
+		ShortDescription: `
+Create libp2p service and proxy the HTTP requests sent to it to the HTTP
+server at <target-address>.
+
+<protocol> specifies the libp2p handler name. It must be prefixed with '` + P2PProtoPrefix + `'
+and, for the gateway of other nodes to proxy requests to it, end with '/http'.
+
+Unlike 'ipfs p2p listen', which forwards the raw connections, the requests are
+proxied one by one: the server gets the ID of the peer a request comes from in
+the ` + p2p.PeerIDHeader + ` header, and has --request-timeout to answer it.
+
+Example:
+  ipfs p2p http-proxy ` + P2PProtoPrefix + `myapp/http /ip4/127.0.0.1/tcp/8000
+    - Proxy the requests to 'myapp' to the HTTP server at 127.0.0.1:8000,
+      which other nodes reach at /p2p/<peer-id>/x/myapp/http/<path> on their
+      gateway, with Experimental.P2pHttpProxy enabled.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("protocol", true, false, "Protocol name."),
+		cmds.StringArg("target-address", true, false, "Address of the HTTP server."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(allowCustomProtocolOptionName, "Don't require /x/ prefix"),
+		cmds.StringOption(requestTimeoutOptionName, "Time the server has to answer a request.").WithDefault("30s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := p2pGetNode(env)
+		if err != nil {
+			return err
+		}
+
+		proto := protocol.ID(req.Arguments[0])
+		target, err := ma.NewMultiaddr(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		if err := checkPort(target); err != nil {
+			return err
+		}
+		timeout, err := time.ParseDuration(req.Options[requestTimeoutOptionName].(string))
+		if err != nil {
+			return err
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("--%s must be positive", requestTimeoutOptionName)
+		}
+
+		allowCustom, _ := req.Options[allowCustomProtocolOptionName].(bool)
+		if !allowCustom && !strings.HasPrefix(string(proto), P2PProtoPrefix) {
+			return errors.New("protocol name must be within '" + P2PProtoPrefix + "' namespace")
+		}
+
+		_, err = n.P2P.ForwardRemoteHTTP(n.Context(), proto, target, timeout)
+		return err
+	},
+}
+
 // checkPort checks whether target multiaddr contains tcp or udp protocol
 // and whether the port is equal to 0
 func checkPort(target ma.Multiaddr) error {
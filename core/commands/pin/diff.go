@@ -0,0 +1,167 @@
+package pin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/pinning/follow"
+)
+
+const (
+	pinDiffAdded   = "added"
+	pinDiffRemoved = "removed"
+
+	pinExportOptionName = "export"
+)
+
+// PinDiffOutput is a change of the pinset since a snapshot, or the new
+// snapshot, output by "pin diff"
+type PinDiffOutput struct {
+	Cid      string `json:",omitempty"`
+	Change   string `json:",omitempty"`
+	Snapshot string `json:",omitempty"`
+}
+
+var diffPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the recursive pins added and removed since an export.",
+		ShortDescription: `
+Compares the objects pinned recursively with a pinset exported by
+'ipfs pin export', by default the last one, and streams those pinned since as
+added, and those unpinned since as removed.
+`,
+		LongDescription: `
+Compares the objects pinned recursively with a pinset exported by
+'ipfs pin export', by default the last one, and streams those pinned since as
+added, and those unpinned since as removed. Any list of CIDs, one per line,
+such as the output of 'ipfs pin ls --type=recursive --quiet' added to IPFS,
+can be compared too.
+
+With --export, the pins compared are exported once done, replacing the last
+export, and the CID of the new export is output last. Running it again
+streams the changes since, with none missed in between, so a loop keeping
+an external system in sync with the pinset does not need the full list each
+time:
+
+  > ipfs pin export -q
+  > ipfs pin diff --export
+  + QmNewPin
+  - QmOldPin
+  snapshot QmNewExport
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("snapshot", false, false, "Path to the pinset compared with, the last export by default."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinExportOptionName, "Export the pins compared once done."),
+	},
+	Type: PinDiffOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		export, _ := req.Options[pinExportOptionName].(bool)
+
+		prev, err := lastPinExport(req, n)
+		if err != nil {
+			return err
+		}
+		var snapshot path.Path
+		switch {
+		case len(req.Arguments) > 0:
+			snapshot = path.New(req.Arguments[0])
+		case prev.Defined():
+			snapshot = path.IpfsPath(prev)
+		default:
+			return errors.New("no pinset exported yet, see 'ipfs pin export'")
+		}
+
+		nd, err := api.Unixfs().Get(req.Context, snapshot)
+		if err != nil {
+			return err
+		}
+		f, ok := nd.(files.File)
+		if !ok {
+			return fmt.Errorf("%s is not a file", snapshot)
+		}
+		old, err := follow.ReadPinset(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", snapshot, err)
+		}
+		removed := cid.NewSet()
+		for _, c := range old {
+			removed.Add(c)
+		}
+
+		ls, err := api.Pin().Ls(req.Context, options.Pin.Ls.Recursive())
+		if err != nil {
+			return err
+		}
+		var pins []cid.Cid
+		for p := range ls {
+			if err := p.Err(); err != nil {
+				return err
+			}
+			c := p.Path().Cid()
+			// the previous export is replaced
+			if c == prev {
+				continue
+			}
+			if export {
+				pins = append(pins, c)
+			}
+			if removed.Has(c) {
+				removed.Remove(c)
+				continue
+			}
+			if err := res.Emit(&PinDiffOutput{Cid: enc.Encode(c), Change: pinDiffAdded}); err != nil {
+				return err
+			}
+		}
+		err = removed.ForEach(func(c cid.Cid) error {
+			return res.Emit(&PinDiffOutput{Cid: enc.Encode(c), Change: pinDiffRemoved})
+		})
+		if err != nil || !export {
+			return err
+		}
+
+		sortPins(pins)
+		exported, err := exportPins(req, n, api, prev, pins)
+		if err != nil {
+			return err
+		}
+		return res.Emit(&PinDiffOutput{Snapshot: enc.Encode(exported)})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinDiffOutput) error {
+			switch {
+			case out.Snapshot != "":
+				fmt.Fprintf(w, "snapshot %s\n", out.Snapshot)
+			case out.Change == pinDiffAdded:
+				fmt.Fprintf(w, "+ %s\n", out.Cid)
+			default:
+				fmt.Fprintf(w, "- %s\n", out.Cid)
+			}
+			return nil
+		}),
+	},
+}
@@ -0,0 +1,109 @@
+package pin
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+)
+
+const pinDryRunOptionName = "dry-run"
+
+// PinExpireOutput is an expired pin, output by "pin expire"
+type PinExpireOutput struct {
+	Cid    string
+	Class  string
+	Reason string
+}
+
+var expirePinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove the expired pins.",
+		ShortDescription: `
+Removes the pins added with an expiry class which are older, or have not been
+read for longer, than the limits of their class in Pinning.Expiry.Classes, and
+the pins added with a TTL which has passed.
+`,
+		LongDescription: `
+Removes the pins added with an expiry class which are older, or have not been
+read for longer, than the limits of their class in Pinning.Expiry.Classes, and
+the pins added with a TTL which has passed. The daemon does this periodically,
+every Pinning.Expiry.Interval, and 'ipfs repo gc' before collecting garbage.
+
+Pins are added with an expiry class with 'ipfs add --expire-class' or
+'ipfs pin add --expire-class', and with a TTL with 'ipfs pin add --ttl'. Reads of the pinned object itself, by local
+commands, the gateway or other peers, count as activity; those of its
+descendants do not. The unpinned content is removed by the next garbage
+collection.
+
+Use --dry-run to list the pins which would be removed, without removing them.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinDryRunOptionName, "Only list the expired pins, without removing them."),
+	},
+	Type:  PinExpireOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		dryRun, _ := req.Options[pinDryRunOptionName].(bool)
+
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return err
+		}
+		classes, err := expiry.Classes(cfg.Pinning.Expiry)
+		if err != nil {
+			return err
+		}
+
+		policy := expiry.NewPolicy(n.ExpiringPins, n.Pinning, n.Blockstore, classes)
+		var expired []expiry.Expired
+		if dryRun {
+			expired, err = policy.Expired(req.Context, time.Now())
+		} else {
+			expired, err = policy.Apply(req.Context, time.Now())
+		}
+
+		// report the pins removed before any failure
+		for _, e := range expired {
+			if err := res.Emit(&PinExpireOutput{
+				Cid:    enc.Encode(e.Root),
+				Class:  e.Class,
+				Reason: e.Reason,
+			}); err != nil {
+				return err
+			}
+		}
+		return err
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinExpireOutput) error {
+			dryRun, _ := req.Options[pinDryRunOptionName].(bool)
+			action := "unpinned"
+			if dryRun {
+				action = "would unpin"
+			}
+			if out.Class == "" {
+				fmt.Fprintf(w, "%s %s: %s\n", action, out.Cid, out.Reason)
+			} else {
+				fmt.Fprintf(w, "%s %s of class %q: %s\n", action, out.Cid, out.Class, out.Reason)
+			}
+			return nil
+		}),
+	},
+}
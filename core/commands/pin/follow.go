@@ -0,0 +1,304 @@
+package pin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	files "github.com/ipfs/go-ipfs-files"
+	pinner "github.com/ipfs/go-ipfs-pinner"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+
+	core "github.com/ipfs/go-ipfs/core"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/pinning/follow"
+)
+
+// pinExportKey is the datastore key of the last pinset exported, which is
+// kept pinned until the next export.
+var pinExportKey = ds.NewKey("/local/pins/export")
+
+var errNoFollower = errors.New("pinset following is not enabled, see Pinning.Follow")
+
+// PinExportOutput is the pinset exported by "pin export"
+type PinExportOutput struct {
+	Cid  string
+	Pins int
+}
+
+var exportPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Export the recursive pins, for other nodes to follow.",
+		ShortDescription: `
+Adds the list of the objects pinned recursively as a file, one CID per line,
+and outputs the CID of that file.
+`,
+		LongDescription: `
+Adds the list of the objects pinned recursively as a file, one CID per line,
+and outputs the CID of that file. The file stays pinned until the next export.
+
+Other nodes follow the pinset, keeping the same objects pinned, when their
+Pinning.Follow.Source is an IPNS name the export is published at:
+
+  > ipfs key gen pinset
+  > ipfs name publish --key=pinset /ipfs/$(ipfs pin export -q)
+
+Run it again when the pins change. Nodes may also follow the pinset with the
+RPC API of this node, without any export.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinQuietOptionName, "q", "Write just the CID of the export."),
+	},
+	Type:  PinExportOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		prev, err := lastPinExport(req, n)
+		if err != nil {
+			return err
+		}
+		pins, err := recursivePins(req, api, prev)
+		if err != nil {
+			return err
+		}
+		exported, err := exportPins(req, n, api, prev, pins)
+		if err != nil {
+			return err
+		}
+
+		return cmds.EmitOnce(res, &PinExportOutput{
+			Cid:  enc.Encode(exported),
+			Pins: len(pins),
+		})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinExportOutput) error {
+			if quiet, _ := req.Options[pinQuietOptionName].(bool); quiet {
+				fmt.Fprintln(w, out.Cid)
+				return nil
+			}
+			fmt.Fprintf(w, "exported %d pins as %s\n", out.Pins, out.Cid)
+			return nil
+		}),
+	},
+}
+
+// recursivePins returns the objects pinned recursively, sorted, but the
+// previous export prev.
+func recursivePins(req *cmds.Request, api coreiface.CoreAPI, prev cid.Cid) ([]cid.Cid, error) {
+	ls, err := api.Pin().Ls(req.Context, options.Pin.Ls.Recursive())
+	if err != nil {
+		return nil, err
+	}
+	var pins []cid.Cid
+	for p := range ls {
+		if err := p.Err(); err != nil {
+			return nil, err
+		}
+		// the previous export is replaced
+		if c := p.Path().Cid(); c != prev {
+			pins = append(pins, c)
+		}
+	}
+	sortPins(pins)
+	return pins, nil
+}
+
+// sortPins sorts pins as exported.
+func sortPins(pins []cid.Cid) {
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].String() < pins[j].String()
+	})
+}
+
+// exportPins adds pins as the export replacing prev, and returns its CID.
+func exportPins(req *cmds.Request, n *core.IpfsNode, api coreiface.CoreAPI, prev cid.Cid, pins []cid.Cid) (cid.Cid, error) {
+	var buf bytes.Buffer
+	if err := follow.WritePinset(&buf, pins); err != nil {
+		return cid.Undef, err
+	}
+	added, err := api.Unixfs().Add(req.Context, files.NewBytesFile(buf.Bytes()), options.Unixfs.Pin(true))
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	c := added.Cid()
+	if c == prev {
+		return c, nil
+	}
+	dstore := n.Repo.Datastore()
+	if err := dstore.Put(req.Context, pinExportKey, c.Bytes()); err != nil {
+		return cid.Undef, err
+	}
+	if err := dstore.Sync(req.Context, pinExportKey); err != nil {
+		return cid.Undef, err
+	}
+	if prev.Defined() {
+		// unless unpinned by hand
+		err := api.Pin().Rm(req.Context, path.IpfsPath(prev))
+		if err != nil && err != pinner.ErrNotPinned {
+			return cid.Undef, err
+		}
+	}
+	return c, nil
+}
+
+// lastPinExport returns the last pinset exported, if any.
+func lastPinExport(req *cmds.Request, n *core.IpfsNode) (cid.Cid, error) {
+	val, err := n.Repo.Datastore().Get(req.Context, pinExportKey)
+	switch err {
+	case nil:
+		return cid.Cast(val)
+	case ds.ErrNotFound:
+		return cid.Undef, nil
+	default:
+		return cid.Undef, err
+	}
+}
+
+var followPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Mirror the pinset of another node.",
+		ShortDescription: `
+A node with Pinning.Follow.Source set is a read replica of the pinset of
+another node: it periodically pins what was pinned there and unpins what was
+unpinned, every Pinning.Follow.Interval.
+`,
+		LongDescription: `
+A node with Pinning.Follow.Source set is a read replica of the pinset of
+another node: it periodically pins what was pinned there and unpins what was
+unpinned, every Pinning.Follow.Interval.
+
+The source is either an IPNS name the pinset is published at, see
+'ipfs pin export', or the URL of the RPC API of the node followed, such as
+http://10.0.0.1:5001. The pins added by hand are left alone: only the pins
+added by the follower are ever removed. Pinning recursively by hand an object
+the follower pinned, with 'ipfs pin add' or 'ipfs add', takes the pin over,
+and the follower no longer removes it.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": followStatusPinCmd,
+		"sync":   followSyncPinCmd,
+	},
+}
+
+// PinFollowOutput is the state of the follower, output by "pin follow status"
+// and "pin follow sync"
+type PinFollowOutput struct {
+	Source   string
+	Mirrored int
+	Synced   *time.Time `json:",omitempty"`
+	Added    int
+	Removed  int
+	Failed   int
+	Error    string `json:",omitempty"`
+}
+
+func followOutput(st follow.Status) *PinFollowOutput {
+	out := &PinFollowOutput{
+		Source:   st.Source,
+		Mirrored: st.Mirrored,
+		Added:    st.Last.Added,
+		Removed:  st.Last.Removed,
+		Failed:   st.Last.Failed,
+		Error:    st.Error,
+	}
+	if !st.Synced.IsZero() {
+		out.Synced = &st.Synced
+	}
+	return out
+}
+
+var followEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinFollowOutput) error {
+		fmt.Fprintf(w, "following %s: %d pins mirrored\n", out.Source, out.Mirrored)
+		if out.Synced == nil {
+			fmt.Fprintln(w, "not synced yet")
+			return nil
+		}
+		fmt.Fprintf(w, "synced at %s: %d added, %d removed, %d failed\n",
+			out.Synced.Format(time.RFC3339), out.Added, out.Removed, out.Failed)
+		if out.Error != "" {
+			fmt.Fprintf(w, "error: %s\n", out.Error)
+		}
+		return nil
+	}),
+}
+
+var followStatusPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the state of the pinset follower.",
+	},
+	NoLocal: true,
+	Type:    PinFollowOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if n.PinFollower == nil {
+			return errNoFollower
+		}
+
+		st, err := n.PinFollower.Status(req.Context)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, followOutput(st))
+	},
+	Encoders: followEncoders,
+}
+
+var followSyncPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Sync the pinset followed now.",
+		ShortDescription: `
+Syncs the pinset followed without waiting for Pinning.Follow.Interval, and
+waits for the sync to end. Pins which fail are retried by the next sync.
+`,
+	},
+	NoLocal: true,
+	Type:    PinFollowOutput{},
+	Extra:   cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if n.PinFollower == nil {
+			return errNoFollower
+		}
+
+		// the outcome, failed or not, is in the status
+		_, _ = n.PinFollower.Sync(req.Context)
+		st, err := n.PinFollower.Status(req.Context)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, followOutput(st))
+	},
+	Encoders: followEncoders,
+}
@@ -3,6 +3,7 @@ package pin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -21,7 +22,14 @@ import (
 
 	core "github.com/ipfs/go-ipfs/core"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 	e "github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/lazypin"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pinning/pinsize"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
 )
 
 var PinCmd = &cmds.Command{
@@ -36,6 +44,11 @@ var PinCmd = &cmds.Command{
 		"verify": verifyPinCmd,
 		"update": updatePinCmd,
 		"remote": remotePinCmd,
+		"expire": expirePinCmd,
+		"export": exportPinCmd,
+		"diff":   diffPinCmd,
+		"follow": followPinCmd,
+		"ready":  readyPinCmd,
 	},
 }
 
@@ -49,14 +62,71 @@ type AddPinOutput struct {
 }
 
 const (
-	pinRecursiveOptionName = "recursive"
-	pinProgressOptionName  = "progress"
+	pinRecursiveOptionName   = "recursive"
+	pinProgressOptionName    = "progress"
+	pinSelectorOptionName    = "selector"
+	pinLazyOptionName        = "lazy"
+	pinFillOptionName        = "fill"
+	pinExpireClassOptionName = "expire-class"
+	pinTTLOptionName         = "ttl"
+	pinLabelOptionName       = "label"
 )
 
 var addPinCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:          "Pin objects to local storage.",
 		ShortDescription: "Stores an IPFS object(s) from a given path locally to disk.",
+		LongDescription: `
+Stores an IPFS object(s) from a given path locally to disk.
+
+With --selector, only the blocks of the DAG matched by the given IPLD
+selector are fetched and pinned, which allows replicating part of a large
+dataset. The selector is given in DAG-JSON. The depth of recursive selectors
+counts the levels of the IPLD data model, and the blocks linked by a DAG-PB
+node are 4 levels below it (Links/<index>/Hash/<target>), so the following
+selector pins a UnixFS directory and the root blocks of its entries, but
+nothing deeper:
+
+  > ipfs pin add --selector='{"R":{"l":{"depth":4},":>":{"a":{">":{"@":{}}}}}}' <cid>
+
+Selector pins are listed with 'ipfs pin ls --type=selector', and removed with
+'ipfs pin rm', along with the other pins of the object.
+
+With --lazy, only the object itself is fetched and pinned. The rest of its
+DAG is fetched on first access, and the blocks fetched so far are kept by the
+garbage collector, which suits mirroring large catalogs of which only some
+content is ever read. With --fill, the node also fetches the rest of the DAG
+in the background while online, resuming after restarts, and turns the lazy pin into a
+recursive pin once it is complete. Lazy pins are listed with
+'ipfs pin ls --type=lazy'.
+
+With --expire-class, the pins expire according to a class of
+Pinning.Expiry.Classes in the config, and are removed by the daemon, or with
+'ipfs pin expire', once they are older or have not been read for longer than
+the class allows. Pinning an object again with a class restarts its age.
+
+With --ttl, the pins are removed once the given duration has passed, by the
+daemon, 'ipfs pin expire', or the next 'ipfs repo gc', which treats them as
+unpinned, e.g. for the artifacts of a CI mirror kept for three days:
+
+  > ipfs pin add --ttl=72h <cid>
+
+It can be combined with --expire-class, the pins being removed by whichever
+expires them first. Pinning an object again replaces its TTL, and pinning it
+again without --expire-class nor --ttl makes the pin permanent.
+
+With --name and --label, the pins are given a name and key/value labels, by
+which they can then be listed with 'ipfs pin ls --name' and
+'ipfs pin ls --label':
+
+  > ipfs pin add --name=backup-2024 --label team=infra --label env=prod <cid>
+
+Pinning an object again with a name or labels replaces both.
+
+With --offline, only the blocks in the local blockstore are pinned: a missing
+block fails the command with an error of the offline kind, naming the block,
+rather than fetching it from the network.
+`,
 	},
 
 	Arguments: []cmds.Argument{
@@ -65,17 +135,32 @@ var addPinCmd = &cmds.Command{
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively pin the object linked to by the specified object(s).").WithDefault(true),
 		cmds.BoolOption(pinProgressOptionName, "Show progress"),
+		cmds.StringOption(pinSelectorOptionName, "Only pin the blocks matched by this IPLD selector, in DAG-JSON."),
+		cmds.BoolOption(pinLazyOptionName, "Only fetch the object now, and the rest of its DAG on first access."),
+		cmds.BoolOption(pinFillOptionName, "Fetch the DAG of lazy pins in the background, and pin it recursively once complete."),
+		cmds.StringOption(pinExpireClassOptionName, "Expire the pins according to this class of Pinning.Expiry.Classes."),
+		cmds.StringOption(pinTTLOptionName, "Remove the pins once this duration has passed, e.g. \"72h\"."),
+		cmds.StringOption(pinNameOptionName, "Name the pins."),
+		cmds.StringsOption(pinLabelOptionName, "Label the pins, given as key=value. Can be given several times."),
+		cmdenv.OptionProviders,
 	},
-	Type: AddPinOutput{},
+	Type:  AddPinOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
+		if err := cmdenv.ConnectProviders(req, api); err != nil {
+			return err
+		}
 
 		// set recursive flag
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 		showProgress, _ := req.Options[pinProgressOptionName].(bool)
+		lazy, _ := req.Options[pinLazyOptionName].(bool)
+		fill, _ := req.Options[pinFillOptionName].(bool)
+		expireClass, _ := req.Options[pinExpireClassOptionName].(string)
 
 		if err := req.ParseBodyArgs(); err != nil {
 			return err
@@ -86,11 +171,103 @@ var addPinCmd = &cmds.Command{
 			return err
 		}
 
-		if !showProgress {
-			added, err := pinAddMany(req.Context, api, enc, req.Arguments, recursive)
+		if fill && !lazy {
+			return cmds.Errorf(cmds.ErrClient, "--%s requires --%s", pinFillOptionName, pinLazyOptionName)
+		}
+		if fill && cmdenv.IsOffline(req) {
+			return cmds.Errorf(cmds.ErrClient, "--%s is not supported with --offline", pinFillOptionName)
+		}
+
+		name, _ := req.Options[pinNameOptionName].(string)
+		labelArgs, _ := req.Options[pinLabelOptionName].([]string)
+		labels, err := pinmeta.ParseLabels(labelArgs)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", pinLabelOptionName, err)
+		}
+		named := func(added []string, err error) ([]string, error) {
+			if err != nil {
+				return nil, err
+			}
+			return added, setPinMeta(req.Context, api, added, name, labels)
+		}
+
+		var expires time.Time
+		if ttl, ok := req.Options[pinTTLOptionName].(string); ok {
+			d, err := time.ParseDuration(ttl)
+			if err != nil {
+				return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", pinTTLOptionName, err)
+			}
+			if d <= 0 {
+				return cmds.Errorf(cmds.ErrClient, "--%s must be positive", pinTTLOptionName)
+			}
+			expires = time.Now().Add(d)
+		}
+
+		if expireClass != "" || !expires.IsZero() {
+			if _, ok := req.Options[pinSelectorOptionName]; ok || lazy {
+				return cmds.Errorf(cmds.ErrClient, "--%s and --%s are only supported with recursive and direct pins", pinExpireClassOptionName, pinTTLOptionName)
+			}
+		}
+		if expireClass != "" {
+			n, err := cmdenv.GetNode(env)
 			if err != nil {
 				return err
 			}
+			cfg, err := n.Repo.Config()
+			if err != nil {
+				return err
+			}
+			if err := expiry.CheckClass(cfg.Pinning.Expiry, expireClass); err != nil {
+				return err
+			}
+		}
+
+		if lazy {
+			if showProgress {
+				return cmds.Errorf(cmds.ErrClient, "--%s is not supported with --%s", pinProgressOptionName, pinLazyOptionName)
+			}
+			if _, ok := req.Options[pinSelectorOptionName]; ok {
+				return cmds.Errorf(cmds.ErrClient, "--%s is not supported with --%s", pinSelectorOptionName, pinLazyOptionName)
+			}
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+
+			added, err := named(pinAddLazy(req.Context, n, api, enc, req.Arguments, fill))
+			if err != nil {
+				return cmdenv.OfflineError(req, err)
+			}
+
+			return cmds.EmitOnce(res, &AddPinOutput{Pins: added})
+		}
+
+		if sel, ok := req.Options[pinSelectorOptionName].(string); ok {
+			if showProgress {
+				return cmds.Errorf(cmds.ErrClient, "--%s is not supported with --%s", pinProgressOptionName, pinSelectorOptionName)
+			}
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+
+			blocks := n.Blocks
+			if cmdenv.IsOffline(req) {
+				blocks = bserv.New(n.Blockstore, offline.Exchange(n.Blockstore))
+			}
+			added, err := named(pinAddSelector(req.Context, n, blocks, api, enc, req.Arguments, sel))
+			if err != nil {
+				return cmdenv.OfflineError(req, err)
+			}
+
+			return cmds.EmitOnce(res, &AddPinOutput{Pins: added})
+		}
+
+		if !showProgress {
+			added, err := named(pinAddMany(req.Context, api, enc, req.Arguments, recursive, expireClass, expires))
+			if err != nil {
+				return cmdenv.OfflineError(req, err)
+			}
 
 			return cmds.EmitOnce(res, &AddPinOutput{Pins: added})
 		}
@@ -105,7 +282,7 @@ var addPinCmd = &cmds.Command{
 
 		ch := make(chan pinResult, 1)
 		go func() {
-			added, err := pinAddMany(ctx, api, enc, req.Arguments, recursive)
+			added, err := named(pinAddMany(ctx, api, enc, req.Arguments, recursive, expireClass, expires))
 			ch <- pinResult{pins: added, err: err}
 		}()
 
@@ -116,7 +293,7 @@ var addPinCmd = &cmds.Command{
 			select {
 			case val := <-ch:
 				if val.err != nil {
-					return val.err
+					return cmdenv.OfflineError(req, val.err)
 				}
 
 				if pv := v.Value(); pv != 0 {
@@ -138,8 +315,14 @@ var addPinCmd = &cmds.Command{
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *AddPinOutput) error {
 			rec, found := req.Options["recursive"].(bool)
+			_, sel := req.Options[pinSelectorOptionName].(string)
+			lazy, _ := req.Options[pinLazyOptionName].(bool)
 			var pintype string
-			if rec || !found {
+			if lazy {
+				pintype = "lazily"
+			} else if sel {
+				pintype = "with selector"
+			} else if rec || !found {
 				pintype = "recursively"
 			} else {
 				pintype = "directly"
@@ -181,7 +364,90 @@ var addPinCmd = &cmds.Command{
 	},
 }
 
-func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool) ([]string, error) {
+// pinAddMany pins paths, expiring the pins according to expireClass if set,
+// and at expires if not zero.
+func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, recursive bool, expireClass string, expires time.Time) ([]string, error) {
+	add := func(rp path.Resolved) error {
+		return api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive))
+	}
+	if expireClass != "" || !expires.IsZero() {
+		pins, ok := api.Pin().(*coreapi.PinAPI)
+		if !ok {
+			return nil, errors.New("expiring pins are not supported by this node")
+		}
+		add = func(rp path.Resolved) error {
+			return pins.AddExpiring(ctx, rp, expireClass, expires, options.Pin.Recursive(recursive))
+		}
+	}
+
+	added := make([]string, len(paths))
+	for i, b := range paths {
+		rp, err := api.ResolvePath(ctx, path.New(b))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := add(rp); err != nil {
+			return nil, err
+		}
+		added[i] = enc.Encode(rp.Cid())
+	}
+
+	return added, nil
+}
+
+// setPinMeta names and labels the pins of added, if name or labels are set.
+func setPinMeta(ctx context.Context, api coreiface.CoreAPI, added []string, name string, labels map[string]string) error {
+	if name == "" && len(labels) == 0 {
+		return nil
+	}
+	pins, ok := api.Pin().(*coreapi.PinAPI)
+	if !ok {
+		return errors.New("pin names and labels are not supported by this node")
+	}
+	for _, k := range added {
+		c, err := cid.Decode(k)
+		if err != nil {
+			return err
+		}
+		if err := pins.SetMeta(ctx, path.IpfsPath(c), name, labels); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pinAddSelector(ctx context.Context, n *core.IpfsNode, blocks bserv.BlockService, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, sel string) ([]string, error) {
+	sel, err := selectorpin.ParseSelector(sel)
+	if err != nil {
+		return nil, err
+	}
+
+	defer n.Blockstore.PinLock(ctx).Unlock(ctx)
+
+	bs := bserv.NewSession(ctx, blocks)
+	added := make([]string, len(paths))
+	for i, b := range paths {
+		rp, err := api.ResolvePath(ctx, path.New(b))
+		if err != nil {
+			return nil, err
+		}
+
+		// fetch the matched blocks before recording the pin
+		p := selectorpin.Pin{Root: rp.Cid(), Selector: sel}
+		if err := selectorpin.Walk(ctx, bs, p, func(cid.Cid) {}); err != nil {
+			return nil, err
+		}
+		if err := n.SelectorPins.Add(ctx, p); err != nil {
+			return nil, err
+		}
+		added[i] = enc.Encode(rp.Cid())
+	}
+
+	return added, nil
+}
+
+func pinAddLazy(ctx context.Context, n *core.IpfsNode, api coreiface.CoreAPI, enc cidenc.Encoder, paths []string, fill bool) ([]string, error) {
 	added := make([]string, len(paths))
 	for i, b := range paths {
 		rp, err := api.ResolvePath(ctx, path.New(b))
@@ -189,9 +455,18 @@ func pinAddMany(ctx context.Context, api coreiface.CoreAPI, enc cidenc.Encoder,
 			return nil, err
 		}
 
-		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(recursive)); err != nil {
+		// the root is pinned directly, the rest of the DAG is kept by GC
+		// through the lazy pin
+		if err := api.Pin().Add(ctx, rp, options.Pin.Recursive(false)); err != nil {
 			return nil, err
 		}
+		if err := n.LazyPins.Add(ctx, lazypin.Pin{Root: rp.Cid(), Fill: fill}); err != nil {
+			return nil, err
+		}
+		// when offline, filling starts when the node next runs online
+		if fill && n.LazyPinFiller != nil {
+			n.LazyPinFiller.Fill(rp.Cid())
+		}
 		added[i] = enc.Encode(rp.Cid())
 	}
 
@@ -208,6 +483,8 @@ collected if needed. (By default, recursively. Use -r=false for direct pins.)
 		LongDescription: `
 Removes the pin from the given object allowing it to be garbage
 collected if needed. (By default, recursively. Use -r=false for direct pins.)
+The selector and lazy pins of the object are removed as well, and so are its
+expiry, name and labels.
 
 A pin may not be removed because the specified object is not pinned or pinned
 indirectly. To determine if the object is pinned indirectly, use the command:
@@ -221,13 +498,19 @@ ipfs pin ls -t indirect <cid>
 	Options: []cmds.Option{
 		cmds.BoolOption(pinRecursiveOptionName, "r", "Recursively unpin the object linked to by the specified object(s).").WithDefault(true),
 	},
-	Type: PinOutput{},
+	Type:  PinOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
 			return err
 		}
 
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		// set recursive flag
 		recursive, _ := req.Options[pinRecursiveOptionName].(bool)
 
@@ -249,6 +532,45 @@ ipfs pin ls -t indirect <cid>
 
 			id := enc.Encode(rp.Cid())
 			pins = append(pins, id)
+
+			if _, err := n.ExpiringPins.Remove(req.Context, rp.Cid()); err != nil {
+				return err
+			}
+			if _, err := n.PinMeta.Remove(req.Context, rp.Cid()); err != nil {
+				return err
+			}
+
+			lazy, err := n.LazyPins.Remove(req.Context, rp.Cid())
+			if err != nil {
+				return err
+			}
+			if lazy && n.LazyPinFiller != nil {
+				n.LazyPinFiller.Stop(rp.Cid())
+			}
+
+			removed, err := n.SelectorPins.Remove(req.Context, rp.Cid())
+			if err != nil {
+				return err
+			}
+			if removed > 0 {
+				// the object may only have been pinned with selectors
+				pinType := "direct"
+				if recursive {
+					pinType = "recursive"
+				}
+				opt, err := options.Pin.IsPinned.Type(pinType)
+				if err != nil {
+					return err
+				}
+				_, pinned, err := api.Pin().IsPinned(req.Context, rp, opt)
+				if err != nil {
+					return err
+				}
+				if !pinned {
+					continue
+				}
+			}
+
 			if err := api.Pin().Rm(req.Context, rp, options.Pin.RmRecursive(recursive)); err != nil {
 				return err
 			}
@@ -271,6 +593,7 @@ const (
 	pinTypeOptionName   = "type"
 	pinQuietOptionName  = "quiet"
 	pinStreamOptionName = "stream"
+	pinSizeOptionName   = "size"
 )
 
 var listPinCmd = &cmds.Command{
@@ -294,6 +617,8 @@ Valid values are:
     * "recursive": pin that specific object, and indirectly pin all its
     	descendants
     * "indirect": pinned indirectly by an ancestor (like a refcount)
+    * "selector": pin the blocks of that object matched by an IPLD selector
+    * "lazy": pin that specific object, and keep its descendants once fetched
     * "all"
 
 With arguments, the command fails if any of the arguments is not a pinned
@@ -314,6 +639,24 @@ Example:
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
 	$ ipfs pin ls QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN
 	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN direct
+
+With --size, the recursive pins are listed with the bytes taken by the
+distinct blocks of their DAG, then the bytes of those blocks no other
+recursive pin has, which is what removing the pin would free:
+
+	$ ipfs pin ls --type=recursive --size
+	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN recursive 14 14
+
+The blocks of each recursive pin are indexed the first time it is listed
+with --size, which walks its DAG, and are then kept in the repo, so that
+only the pins added since are walked by the next listing.
+
+The pins added with a name are listed with it last, and their labels are
+listed with --enc=json. With --name or --label, only the pins of that name,
+or with all those labels, are listed:
+
+	$ ipfs pin ls --label team=infra
+	QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN recursive backup-2024
 `,
 	},
 
@@ -321,9 +664,12 @@ Example:
 		cmds.StringArg("ipfs-path", false, true, "Path to object(s) to be listed."),
 	},
 	Options: []cmds.Option{
-		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", or \"all\".").WithDefault("all"),
+		cmds.StringOption(pinTypeOptionName, "t", "The type of pinned keys to list. Can be \"direct\", \"indirect\", \"recursive\", \"selector\", \"lazy\", or \"all\".").WithDefault("all"),
 		cmds.BoolOption(pinQuietOptionName, "q", "Write just hashes of objects."),
 		cmds.BoolOption(pinStreamOptionName, "s", "Enable streaming of pins as they are discovered."),
+		cmds.BoolOption(pinSizeOptionName, "Show the storage taken by the recursive pins."),
+		cmds.StringOption(pinNameOptionName, "Only list the pins of this name."),
+		cmds.StringsOption(pinLabelOptionName, "Only list the pins with this label, given as key=value."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -331,13 +677,18 @@ Example:
 			return err
 		}
 
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
 		typeStr, _ := req.Options[pinTypeOptionName].(string)
 		stream, _ := req.Options[pinStreamOptionName].(bool)
 
 		switch typeStr {
-		case "all", "direct", "indirect", "recursive":
+		case "all", "direct", "indirect", "recursive", "selector", "lazy":
 		default:
-			err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+			err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, selector, lazy, all}", typeStr)
 			return err
 		}
 
@@ -347,15 +698,68 @@ Example:
 		if !stream {
 			emit = func(v interface{}) error {
 				obj := v.(*PinLsOutputWrapper)
-				lgcList[obj.PinLsObject.Cid] = PinLsType{Type: obj.PinLsObject.Type}
+				lgcList[obj.PinLsObject.Cid] = PinLsType{
+					Type:   obj.PinLsObject.Type,
+					Name:   obj.PinLsObject.Name,
+					Labels: obj.PinLsObject.Labels,
+					Size:   obj.PinLsObject.Size,
+				}
 				return nil
 			}
 		}
 
+		if size, _ := req.Options[pinSizeOptionName].(bool); size {
+			if n.PinSizes == nil {
+				return errors.New("pin sizes are not available on this node")
+			}
+			if err := syncPinSizes(req.Context, api, n.PinSizes); err != nil {
+				return err
+			}
+			emitPin := emit
+			emit = func(v interface{}) error {
+				obj := v.(*PinLsOutputWrapper)
+				if obj.PinLsObject.Type == "recursive" {
+					if s, ok := n.PinSizes.Size(obj.PinLsObject.root); ok {
+						obj.PinLsObject.Size = &PinSize{Total: s.Total, Unique: s.Unique, Blocks: s.Blocks}
+					}
+				}
+				return emitPin(obj)
+			}
+		}
+
+		name, _ := req.Options[pinNameOptionName].(string)
+		labelArgs, _ := req.Options[pinLabelOptionName].([]string)
+		labels, err := pinmeta.ParseLabels(labelArgs)
+		if err != nil {
+			return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", pinLabelOptionName, err)
+		}
+		filter := pinmeta.Filter{Name: name, Labels: labels}
+		metas, err := n.PinMeta.List(req.Context, filter)
+		if err != nil {
+			return err
+		}
+		if len(metas) > 0 || !filter.IsEmpty() {
+			named := make(map[cid.Cid]pinmeta.Meta, len(metas))
+			for _, m := range metas {
+				named[m.Root] = m
+			}
+			emitPin := emit
+			emit = func(v interface{}) error {
+				obj := v.(*PinLsOutputWrapper)
+				m, ok := named[obj.PinLsObject.root]
+				if !ok && !filter.IsEmpty() {
+					return nil
+				}
+				obj.PinLsObject.Name = m.Name
+				obj.PinLsObject.Labels = m.Labels
+				return emitPin(obj)
+			}
+		}
+
 		if len(req.Arguments) > 0 {
-			err = pinLsKeys(req, typeStr, api, emit)
+			err = pinLsKeys(req, typeStr, api, n.SelectorPins, n.LazyPins, emit)
 		} else {
-			err = pinLsAll(req, typeStr, api, emit)
+			err = pinLsAll(req, typeStr, api, n.SelectorPins, n.LazyPins, emit)
 		}
 		if err != nil {
 			return err
@@ -390,7 +794,11 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", out.PinLsObject.Cid)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", out.PinLsObject.Cid, out.PinLsObject.Type)
+					writePinLine(w, out.PinLsObject.Cid, PinLsType{
+						Type: out.PinLsObject.Type,
+						Name: out.PinLsObject.Name,
+						Size: out.PinLsObject.Size,
+					})
 				}
 				return nil
 			}
@@ -399,7 +807,7 @@ Example:
 				if quiet {
 					fmt.Fprintf(w, "%s\n", k)
 				} else {
-					fmt.Fprintf(w, "%s %s\n", k, v.Type)
+					writePinLine(w, k, v)
 				}
 			}
 
@@ -408,6 +816,19 @@ Example:
 	},
 }
 
+// writePinLine writes a pin as listed by pin ls: its CID and type, then its
+// sizes if listed and its name if any.
+func writePinLine(w io.Writer, c string, p PinLsType) {
+	fmt.Fprintf(w, "%s %s", c, p.Type)
+	if p.Size != nil {
+		fmt.Fprintf(w, " %d %d", p.Size.Total, p.Size.Unique)
+	}
+	if p.Name != "" {
+		fmt.Fprintf(w, " %s", p.Name)
+	}
+	fmt.Fprintln(w)
+}
+
 // PinLsOutputWrapper is the output type of the pin ls command.
 // Pin ls needs to output two different type depending on if it's streamed or not.
 // We use this to bypass the cmds lib refusing to have interface{}
@@ -423,30 +844,73 @@ type PinLsList struct {
 
 // PinLsType contains the type of a pin
 type PinLsType struct {
-	Type string
+	Type   string
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+	Size   *PinSize          `json:",omitempty"`
 }
 
 // PinLsObject contains the description of a pin
 type PinLsObject struct {
-	Cid  string `json:",omitempty"`
-	Type string `json:",omitempty"`
+	Cid    string            `json:",omitempty"`
+	Type   string            `json:",omitempty"`
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+	Size   *PinSize          `json:",omitempty"`
+
+	root cid.Cid
+}
+
+// PinSize is the storage taken by a recursive pin, listed with --size
+type PinSize struct {
+	// Total is the size of the distinct blocks of its DAG
+	Total uint64
+	// Unique is the size of those of its blocks no other recursive pin has
+	Unique uint64
+	Blocks int
 }
 
-func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+// syncPinSizes indexes the blocks of the recursive pins not indexed yet.
+func syncPinSizes(ctx context.Context, api coreiface.CoreAPI, sizes *pinsize.Index) error {
+	pins, err := api.Pin().Ls(ctx, options.Pin.Ls.Recursive())
+	if err != nil {
+		return err
+	}
+	var roots []cid.Cid
+	for p := range pins {
+		if err := p.Err(); err != nil {
+			return err
+		}
+		roots = append(roots, p.Path().Cid())
+	}
+	// walking the pinned DAGs is not an access
+	return sizes.Sync(expiry.Untracked(ctx), roots)
+}
+
+func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, sp *selectorpin.Store, lp *lazypin.Store, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
 	}
 
 	switch typeStr {
-	case "all", "direct", "indirect", "recursive":
+	case "all", "direct", "indirect", "recursive", "selector", "lazy":
 	default:
-		return fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+		return fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, selector, lazy, all}", typeStr)
 	}
 
-	opt, err := options.Pin.IsPinned.Type(typeStr)
-	if err != nil {
-		panic("unhandled pin type")
+	// lazy pins are direct pins of the pinner
+	isPinnedType := typeStr
+	if typeStr == "lazy" {
+		isPinnedType = "direct"
+	}
+
+	var opt options.PinIsPinnedOption
+	if typeStr != "selector" {
+		opt, err = options.Pin.IsPinned.Type(isPinnedType)
+		if err != nil {
+			panic("unhandled pin type")
+		}
 	}
 
 	for _, p := range req.Arguments {
@@ -455,9 +919,34 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 			return err
 		}
 
-		pinType, pinned, err := api.Pin().IsPinned(req.Context, rp, opt)
-		if err != nil {
-			return err
+		var pinType string
+		var pinned bool
+		if typeStr != "selector" {
+			pinType, pinned, err = api.Pin().IsPinned(req.Context, rp, opt)
+			if err != nil {
+				return err
+			}
+		}
+
+		if pinned && pinType == "direct" {
+			lazy, err := lp.Has(req.Context, rp.Cid())
+			if err != nil {
+				return err
+			}
+			if lazy {
+				pinType = "lazy"
+			}
+		}
+		if typeStr == "lazy" && pinType != "lazy" {
+			pinned = false
+		}
+
+		if !pinned && (typeStr == "all" || typeStr == "selector") {
+			spins, err := sp.Get(req.Context, rp.Cid())
+			if err != nil {
+				return err
+			}
+			pinType, pinned = "selector", len(spins) > 0
 		}
 
 		if !pinned {
@@ -465,7 +954,7 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 		}
 
 		switch pinType {
-		case "direct", "indirect", "recursive", "internal":
+		case "direct", "indirect", "recursive", "internal", "selector", "lazy":
 		default:
 			pinType = "indirect through " + pinType
 		}
@@ -474,6 +963,7 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 			PinLsObject: PinLsObject{
 				Type: pinType,
 				Cid:  enc.Encode(rp.Cid()),
+				root: rp.Cid(),
 			},
 		})
 		if err != nil {
@@ -484,42 +974,93 @@ func pinLsKeys(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit fu
 	return nil
 }
 
-func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, emit func(value interface{}) error) error {
+func pinLsAll(req *cmds.Request, typeStr string, api coreiface.CoreAPI, sp *selectorpin.Store, lp *lazypin.Store, emit func(value interface{}) error) error {
 	enc, err := cmdenv.GetCidEncoder(req)
 	if err != nil {
 		return err
 	}
 
 	switch typeStr {
-	case "all", "direct", "indirect", "recursive":
+	case "all", "direct", "indirect", "recursive", "selector", "lazy":
 	default:
-		err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", typeStr)
+		err = fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, selector, lazy, all}", typeStr)
 		return err
 	}
 
-	opt, err := options.Pin.Ls.Type(typeStr)
+	lazyRoots, err := lp.Roots(req.Context)
 	if err != nil {
-		panic("unhandled pin type")
+		return err
+	}
+	lazy := cid.NewSet()
+	for _, c := range lazyRoots {
+		lazy.Add(c)
 	}
 
-	pins, err := api.Pin().Ls(req.Context, opt)
-	if err != nil {
-		return err
+	// lazy pins are direct pins of the pinner
+	lsType := typeStr
+	if typeStr == "lazy" {
+		lsType = "direct"
 	}
 
-	for p := range pins {
-		if err := p.Err(); err != nil {
+	listed := cid.NewSet()
+	if typeStr != "selector" {
+		opt, err := options.Pin.Ls.Type(lsType)
+		if err != nil {
+			panic("unhandled pin type")
+		}
+
+		pins, err := api.Pin().Ls(req.Context, opt)
+		if err != nil {
 			return err
 		}
-		err = emit(&PinLsOutputWrapper{
-			PinLsObject: PinLsObject{
-				Type: p.Type(),
-				Cid:  enc.Encode(p.Path().Cid()),
-			},
-		})
+
+		for p := range pins {
+			if err := p.Err(); err != nil {
+				return err
+			}
+			pinType := p.Type()
+			if pinType == "direct" && lazy.Has(p.Path().Cid()) {
+				pinType = "lazy"
+			}
+			if typeStr == "lazy" && pinType != "lazy" {
+				continue
+			}
+			listed.Add(p.Path().Cid())
+			err = emit(&PinLsOutputWrapper{
+				PinLsObject: PinLsObject{
+					Type: pinType,
+					Cid:  enc.Encode(p.Path().Cid()),
+					root: p.Path().Cid(),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if typeStr == "all" || typeStr == "selector" {
+		spins, err := sp.List(req.Context)
 		if err != nil {
 			return err
 		}
+		for _, p := range spins {
+			// objects already listed, or with several selector pins, are
+			// listed once
+			if !listed.Visit(p.Root) {
+				continue
+			}
+			err = emit(&PinLsOutputWrapper{
+				PinLsObject: PinLsObject{
+					Type: "selector",
+					Cid:  enc.Encode(p.Root),
+					root: p.Root,
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -551,7 +1092,8 @@ pin.
 	Options: []cmds.Option{
 		cmds.BoolOption(pinUnpinOptionName, "Remove the old pin.").WithDefault(true),
 	},
-	Type: PinOutput{},
+	Type:  PinOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
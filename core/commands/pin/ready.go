@@ -0,0 +1,85 @@
+package pin
+
+import (
+	"fmt"
+	"io"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+)
+
+const pinReadyWaitOptionName = "wait"
+
+// PinReadyOutput is the state of the pinset reported by "pin ready"
+type PinReadyOutput struct {
+	Ready bool
+	Error string `json:",omitempty"`
+}
+
+var readyPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Tell whether the pinset is loaded.",
+		ShortDescription: `
+Outputs "ready" once the pinset is loaded, and "loading" until then.
+`,
+		LongDescription: `
+Outputs "ready" once the pinset is loaded, and "loading" until then.
+
+Unless Pinning.LazyLoad is disabled, the node loads its pinset in the
+background and serves meanwhile. The load is quick when the pinset was saved
+cleanly, but after a crash its indexes are rebuilt from all the pins, which
+takes minutes with millions of pins. The commands using the pins, such as
+'ipfs pin ls' and 'ipfs repo gc', wait for the load to complete.
+
+With --wait, waits for the load to complete, and fails if it did.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(pinReadyWaitOptionName, "Wait for the pinset to be loaded."),
+	},
+	Type: PinReadyOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		wait, _ := req.Options[pinReadyWaitOptionName].(bool)
+
+		if n.PinWarmup == nil {
+			return cmds.EmitOnce(res, &PinReadyOutput{Ready: true})
+		}
+		if wait {
+			if _, err := n.PinWarmup.Wait(req.Context); err != nil {
+				return err
+			}
+			return cmds.EmitOnce(res, &PinReadyOutput{Ready: true})
+		}
+
+		out := &PinReadyOutput{}
+		select {
+		case <-n.PinWarmup.Ready():
+			out.Ready = true
+			if err := n.PinWarmup.Err(); err != nil {
+				out.Ready = false
+				out.Error = err.Error()
+			}
+		default:
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PinReadyOutput) error {
+			var err error
+			switch {
+			case out.Ready:
+				_, err = fmt.Fprintln(w, "ready")
+			case out.Error != "":
+				_, err = fmt.Fprintf(w, "failed: %s\n", out.Error)
+			default:
+				_, err = fmt.Fprintln(w, "loading")
+			}
+			return err
+		}),
+	},
+}
@@ -19,6 +19,7 @@ import (
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	config "github.com/ipfs/go-ipfs/config"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 	logging "github.com/ipfs/go-log"
 	pinclient "github.com/ipfs/go-pinning-service-http-client"
@@ -39,6 +40,7 @@ var remotePinCmd = &cmds.Command{
 		"ls":      listRemotePinCmd,
 		"rm":      rmRemotePinCmd,
 		"service": remotePinServiceCmd,
+		"sync":    remoteSyncPinCmd,
 	},
 }
 
@@ -136,7 +138,8 @@ NOTE: a comma-separated notation is supported in CLI for convenience:
 		cmds.StringOption(pinNameOptionName, "An optional name for the pin."),
 		cmds.BoolOption(pinBackgroundOptionName, "Add to the queue on the remote service and return immediately (does not wait for pinned status).").WithDefault(false),
 	},
-	Type: RemotePinOutput{},
+	Type:  RemotePinOutput{},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		ctx, cancel := context.WithCancel(req.Context)
 		defer cancel()
@@ -378,6 +381,7 @@ To list and then remove all pending pin requests, pass an explicit status list:
 		cmds.DelimitedStringsOption(",", pinStatusOptionName, "Remove pins with the specified statuses (queued,pinning,pinned,failed).").WithDefault([]string{"pinned"}),
 		cmds.BoolOption(pinForceOptionName, "Allow removal of multiple pins matching the query without additional confirmation.").WithDefault(false),
 	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		ctx, cancel := context.WithCancel(req.Context)
 		defer cancel()
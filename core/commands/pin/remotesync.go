@@ -0,0 +1,317 @@
+package pin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	cidenc "github.com/ipfs/go-cidutil/cidenc"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+	"github.com/ipfs/go-ipfs/pinning/remotesync"
+)
+
+var errNoRemoteSync = errors.New("the pins are not mirrored to remote pinning services: set Pinning.RemoteServices.*.Policies.Sync.Enable and run the daemon online")
+
+const pinSyncAllOptionName = "all"
+
+var remoteSyncPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Mirror the pins to remote pinning services.",
+		ShortDescription: `
+The daemon mirrors the recursive pins to the remote pinning services with
+Policies.Sync.Enable set: every Policies.Sync.Interval, the pins added are
+pinned remotely and the pins removed are removed remotely.
+`,
+		LongDescription: `
+The daemon mirrors the recursive pins to the remote pinning services with
+Policies.Sync.Enable set: every Policies.Sync.Interval, the pins added are
+pinned remotely and the pins removed are removed remotely.
+
+  > ipfs config --json Pinning.RemoteServices.mysrv.Policies.Sync.Enable true
+
+With Policies.Sync.Label, given as key=value, only the pins with this label
+are mirrored, see 'ipfs pin add --label'. The remote pins are named after
+Policies.Sync.PinName, by which they are told from the pins added by hand,
+which are left alone.
+
+The pins which fail, when requested or on the service, are retried after a
+backoff doubling with every failure, up to Policies.Sync.MaxBackoff.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"status": remoteSyncStatusPinCmd,
+		"events": remoteSyncEventsPinCmd,
+		"now":    remoteSyncNowPinCmd,
+	},
+}
+
+// RemotePinSyncItem is a pin mirrored to a remote service
+type RemotePinSyncItem struct {
+	Service   string
+	Cid       string
+	Status    string
+	RequestID string     `json:",omitempty"`
+	Attempts  int        `json:",omitempty"`
+	Retry     *time.Time `json:",omitempty"`
+	Error     string     `json:",omitempty"`
+	Updated   time.Time
+}
+
+func remoteSyncItem(it remotesync.Item, enc cidenc.Encoder) RemotePinSyncItem {
+	out := RemotePinSyncItem{
+		Service:   it.Service,
+		Cid:       enc.Encode(it.Cid),
+		Status:    string(it.State),
+		RequestID: it.RequestID,
+		Attempts:  it.Attempts,
+		Error:     it.Error,
+		Updated:   it.Updated,
+	}
+	if it.State == remotesync.Failed {
+		out.Retry = &it.Retry
+	}
+	return out
+}
+
+// RemotePinSyncService is the state of the mirroring to a remote service
+type RemotePinSyncService struct {
+	Service string
+	Synced  time.Time
+	Error   string `json:",omitempty"`
+	Queued  int
+	Pinning int
+	Pinned  int
+	Failed  int
+}
+
+// RemotePinSyncOutput is the state of the mirroring, output by
+// "pin remote sync status" and "pin remote sync now"
+type RemotePinSyncOutput struct {
+	Services []RemotePinSyncService
+	Items    []RemotePinSyncItem
+}
+
+func getRemotePinSyncer(env cmds.Environment) (*remotesync.Syncer, error) {
+	n, err := cmdenv.GetNode(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.RemotePinSyncer == nil {
+		return nil, errNoRemoteSync
+	}
+	return n.RemotePinSyncer, nil
+}
+
+func remoteSyncOutput(req *cmds.Request, s *remotesync.Syncer) (*RemotePinSyncOutput, error) {
+	enc, err := cmdenv.GetCidEncoder(req)
+	if err != nil {
+		return nil, err
+	}
+	service, _ := req.Options[pinServiceNameOptionName].(string)
+	all, _ := req.Options[pinSyncAllOptionName].(bool)
+
+	out := &RemotePinSyncOutput{
+		Services: []RemotePinSyncService{},
+		Items:    []RemotePinSyncItem{},
+	}
+	for _, st := range s.Status() {
+		if service != "" && st.Name != service {
+			continue
+		}
+		out.Services = append(out.Services, RemotePinSyncService{
+			Service: st.Name,
+			Synced:  st.Synced,
+			Error:   st.Error,
+			Queued:  st.Count[remotesync.Queued],
+			Pinning: st.Count[remotesync.Pinning],
+			Pinned:  st.Count[remotesync.Pinned],
+			Failed:  st.Count[remotesync.Failed],
+		})
+	}
+	for _, it := range s.Items(service) {
+		// the pins mirrored already are many, and only listed with --all
+		if it.State == remotesync.Pinned && !all {
+			continue
+		}
+		out.Items = append(out.Items, remoteSyncItem(it, enc))
+	}
+	return out, nil
+}
+
+var remoteSyncOptions = []cmds.Option{
+	cmds.StringOption(pinServiceNameOptionName, "Only show the pins mirrored to this service."),
+	cmds.BoolOption(pinSyncAllOptionName, "a", "Also list the pins mirrored already, not just those queued, pinning or failed."),
+}
+
+var remoteSyncEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RemotePinSyncOutput) error {
+		for _, st := range out.Services {
+			fmt.Fprintf(w, "%s: synced at %s: %d queued, %d pinning, %d pinned, %d failed\n",
+				st.Service, st.Synced.Format(time.RFC3339), st.Queued, st.Pinning, st.Pinned, st.Failed)
+			if st.Error != "" {
+				fmt.Fprintf(w, "%s: error: %s\n", st.Service, st.Error)
+			}
+		}
+		if len(out.Items) == 0 {
+			return nil
+		}
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+		defer tw.Flush()
+		for _, it := range out.Items {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", it.Service, it.Cid, it.Status, remoteSyncDetails(it))
+		}
+		return nil
+	}),
+}
+
+// remoteSyncDetails describes the failures of it.
+func remoteSyncDetails(it RemotePinSyncItem) string {
+	if it.Status != string(remotesync.Failed) {
+		return ""
+	}
+	details := fmt.Sprintf("%d attempts", it.Attempts)
+	if it.Retry != nil {
+		details += ", retry at " + it.Retry.Format(time.RFC3339)
+	}
+	if it.Error != "" {
+		details += ": " + it.Error
+	}
+	return details
+}
+
+var remoteSyncStatusPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the pins being mirrored to remote pinning services.",
+		ShortDescription: `
+Shows, for every service the pins are mirrored to, when it was last synced
+and how many pins are queued, pinning, pinned and failed, then lists the pins
+queued, pinning and failed, with the number of failures of the latter and
+when they are retried. The pins mirrored already are listed with --all.
+`,
+	},
+	NoLocal: true,
+	Options: remoteSyncOptions,
+	Type:    RemotePinSyncOutput{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		s, err := getRemotePinSyncer(env)
+		if err != nil {
+			return err
+		}
+		out, err := remoteSyncOutput(req, s)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: remoteSyncEncoders,
+}
+
+var remoteSyncNowPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Mirror the pins to remote pinning services now.",
+		ShortDescription: `
+Mirrors the pins without waiting for Policies.Sync.Interval, retrying the
+pins which failed whether their backoff has passed or not, and shows the
+state of the mirroring once done, as 'ipfs pin remote sync status'.
+`,
+	},
+	NoLocal: true,
+	Options: remoteSyncOptions,
+	Type:    RemotePinSyncOutput{},
+	Extra:   cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		s, err := getRemotePinSyncer(env)
+		if err != nil {
+			return err
+		}
+		if err := s.Sync(req.Context); err != nil {
+			return err
+		}
+		out, err := remoteSyncOutput(req, s)
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: remoteSyncEncoders,
+}
+
+// RemotePinSyncEvent is a change of the state of a pin mirrored, emitted by
+// "pin remote sync events"
+type RemotePinSyncEvent struct {
+	RemotePinSyncItem
+	// Dropped is the number of events dropped before this one, the client
+	// being too slow
+	Dropped int `json:",omitempty"`
+}
+
+var remoteSyncEventsPinCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the changes of the pins mirrored to remote pinning services.",
+		ShortDescription: `
+Emits an event every time a pin mirrored changes state, until the command is
+interrupted:
+
+  queued   the pin was requested, and is queued by the service
+  pinning  the service is pinning the content
+  pinned   the service pinned the content
+  failed   the request or the pinning failed, the pin is retried later
+  removed  the pin was removed from the node, and from the service
+
+With --enc=json, the events are emitted one JSON object per line, and
+Dropped counts the events dropped before one, the client being too slow.
+`,
+	},
+	NoLocal: true,
+	Options: []cmds.Option{
+		cmds.StringOption(pinServiceNameOptionName, "Only emit the changes of the pins mirrored to this service."),
+	},
+	Type: RemotePinSyncEvent{},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		s, err := getRemotePinSyncer(env)
+		if err != nil {
+			return err
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+		service, _ := req.Options[pinServiceNameOptionName].(string)
+
+		events := s.Subscribe(req.Context)
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		for e := range events {
+			if service != "" && e.Service != service {
+				continue
+			}
+			out := &RemotePinSyncEvent{
+				RemotePinSyncItem: remoteSyncItem(e.Item, enc),
+				Dropped:           e.Dropped,
+			}
+			if err := res.Emit(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *RemotePinSyncEvent) error {
+			if out.Dropped > 0 {
+				fmt.Fprintf(w, "dropped %d events\n", out.Dropped)
+			}
+			line := strings.TrimSpace(fmt.Sprintf("%s %s %s %s", out.Status, out.Service, out.Cid, remoteSyncDetails(out.RemotePinSyncItem)))
+			_, err := fmt.Fprintln(w, line)
+			return err
+		}),
+	},
+}
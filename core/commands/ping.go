@@ -1,16 +1,21 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	host "github.com/libp2p/go-libp2p-core/host"
+	network "github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pstore "github.com/libp2p/go-libp2p-core/peerstore"
 	ping "github.com/libp2p/go-libp2p/p2p/protocol/ping"
@@ -23,10 +28,33 @@ type PingResult struct {
 	Success bool
 	Time    time.Duration
 	Text    string
+	// Seq is the sequence number of the ping, from 1, unset on the other
+	// results.
+	Seq int `json:",omitempty"`
+	// Summary is set on the last result, with the statistics of the pings.
+	Summary *PingSummary `json:",omitempty"`
+}
+
+// PingSummary is the statistics of the pings sent to a peer.
+type PingSummary struct {
+	Sent     int
+	Received int
+	// Loss is the percentage of pings without a pong.
+	Loss float64
+	// The latencies of the pongs received.
+	Min, Avg, Max, P50, P90, P99 time.Duration
+	// Jitter is the mean difference between consecutive latencies.
+	Jitter time.Duration
 }
 
 const (
-	pingCountOptionName = "count"
+	pingCountOptionName      = "count"
+	pingContinuousOptionName = "continuous"
+	pingIntervalOptionName   = "interval"
+	pingSizeOptionName       = "size"
+
+	// pingMaxSize bounds the payload of the pings.
+	pingMaxSize = 64 << 10
 )
 
 // ErrPingSelf is returned when the user attempts to ping themself.
@@ -40,12 +68,34 @@ var PingCmd = &cmds.Command{
 via the routing system, sends pings, waits for pongs, and prints out round-
 trip latency information.
 		`,
+		LongDescription: `
+'ipfs ping' is a tool to test sending data to other nodes. It finds nodes
+via the routing system, sends pings, waits for pongs, and prints out round-
+trip latency information.
+
+It sends --count pings, or with --continuous pings until it is interrupted,
+one every --interval. Each ping carries --size bytes, rounded up to a
+multiple of 32, and is lost if no pong comes back within 10 seconds.
+
+Once done or interrupted, it prints the statistics of the pings: the number
+sent and received, the percentage lost, and the minimum, average, maximum and
+percentiles of the latency, with its jitter, the mean difference between
+consecutive latencies.
+
+With --enc=json, each ping and the statistics are printed as a JSON object on
+their own line (NDJSON), to be processed by monitoring tools:
+
+  $ ipfs ping --continuous --enc=json <peer ID> | jq -c 'select(.Summary)'
+`,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("peer ID", true, true, "ID of peer to be pinged.").EnableStdin(),
 	},
 	Options: []cmds.Option{
 		cmds.IntOption(pingCountOptionName, "n", "Number of ping messages to send.").WithDefault(10),
+		cmds.BoolOption(pingContinuousOptionName, "Send ping messages until interrupted, instead of --count."),
+		cmds.StringOption(pingIntervalOptionName, "i", "Time between ping messages.").WithDefault("1s"),
+		cmds.IntOption(pingSizeOptionName, "s", "Size of the ping messages in bytes, rounded up to a multiple of 32.").WithDefault(ping.PingSize),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -71,10 +121,23 @@ trip latency information.
 			n.Peerstore.AddAddr(pid, addr, pstore.TempAddrTTL) // temporary
 		}
 
+		continuous, _ := req.Options[pingContinuousOptionName].(bool)
 		numPings, _ := req.Options[pingCountOptionName].(int)
-		if numPings <= 0 {
+		if numPings <= 0 && !continuous {
 			return fmt.Errorf("ping count must be greater than 0, was %d", numPings)
 		}
+		intervalStr, _ := req.Options[pingIntervalOptionName].(string)
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return fmt.Errorf("invalid ping interval %q: %s", intervalStr, err)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("ping interval must be greater than 0, was %s", interval)
+		}
+		size, _ := req.Options[pingSizeOptionName].(int)
+		if size <= 0 || size > pingMaxSize {
+			return fmt.Errorf("ping size must be between 1 and %d, was %d", pingMaxSize, size)
+		}
 
 		if len(n.Peerstore.Addrs(pid)) == 0 {
 			// Make sure we can find the node in question
@@ -101,62 +164,60 @@ trip latency information.
 			return err
 		}
 
-		ctx, cancel := context.WithTimeout(req.Context, kPingTimeout*time.Duration(numPings))
-		defer cancel()
-		pings := ping.Ping(ctx, n.PeerHost, pid)
+		p := &pinger{h: n.PeerHost, pid: pid, size: (size + ping.PingSize - 1) / ping.PingSize * ping.PingSize}
+		defer p.close()
 
-		var (
-			count int
-			total time.Duration
-		)
-		ticker := time.NewTicker(time.Second)
+		var stats pingStats
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		for i := 0; i < numPings; i++ {
-			r, ok := <-pings
-			if !ok {
-				break
+		for seq := 1; continuous || seq <= numPings; seq++ {
+			rtt, err := p.ping(req.Context)
+			if req.Context.Err() != nil {
+				return req.Context.Err()
 			}
 
-			if r.Error != nil {
+			stats.add(rtt, err == nil)
+			if err != nil {
 				err = res.Emit(&PingResult{
 					Success: false,
-					Text:    fmt.Sprintf("Ping error: %s", r.Error),
+					Text:    fmt.Sprintf("Ping error: %s", err),
+					Seq:     seq,
 				})
 			} else {
-				count++
-				total += r.RTT
 				err = res.Emit(&PingResult{
 					Success: true,
-					Time:    r.RTT,
+					Time:    rtt,
+					Seq:     seq,
 				})
 			}
 			if err != nil {
 				return err
 			}
+			if seq == numPings && !continuous {
+				break
+			}
 
 			select {
 			case <-ticker.C:
-			case <-ctx.Done():
-				return ctx.Err()
+			case <-req.Context.Done():
+				return req.Context.Err()
 			}
 		}
-		if count == 0 {
+		if len(stats.rtts) == 0 {
 			return fmt.Errorf("ping failed")
 		}
-		averagems := total.Seconds() * 1000 / float64(count)
 		return res.Emit(&PingResult{
 			Success: true,
-			Text:    fmt.Sprintf("Average latency: %.2fms", averagems),
+			Summary: stats.summary(),
 		})
 	},
 	Type: PingResult{},
 	PostRun: cmds.PostRunMap{
 		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
-			var (
-				total time.Duration
-				count int
-			)
+			// the statistics of the pings received so far, printed if the
+			// command is interrupted
+			var stats pingStats
 
 			for {
 				event, err := res.Next()
@@ -165,22 +226,20 @@ trip latency information.
 				case io.EOF:
 					return nil
 				case context.Canceled, context.DeadlineExceeded:
-					if count == 0 {
+					if len(stats.rtts) == 0 {
 						return err
 					}
-					averagems := total.Seconds() * 1000 / float64(count)
 					return re.Emit(&PingResult{
 						Success: true,
-						Text:    fmt.Sprintf("Average latency: %.2fms", averagems),
+						Summary: stats.summary(),
 					})
 				default:
 					return err
 				}
 
 				pr := event.(*PingResult)
-				if pr.Success && pr.Text == "" {
-					total += pr.Time
-					count++
+				if pr.Seq > 0 {
+					stats.add(pr.Time, pr.Success)
 				}
 				err = re.Emit(event)
 				if err != nil {
@@ -191,10 +250,15 @@ trip latency information.
 	},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PingResult) error {
-			if len(out.Text) > 0 {
+			if s := out.Summary; s != nil {
+				fmt.Fprintf(w, "%d pings sent, %d received, %.1f%% loss\n", s.Sent, s.Received, s.Loss)
+				fmt.Fprintf(w, "Average latency: %.2fms\n", ms(s.Avg))
+				fmt.Fprintf(w, "Latency: min=%.2fms p50=%.2fms p90=%.2fms p99=%.2fms max=%.2fms jitter=%.2fms\n",
+					ms(s.Min), ms(s.P50), ms(s.P90), ms(s.P99), ms(s.Max), ms(s.Jitter))
+			} else if len(out.Text) > 0 {
 				fmt.Fprintln(w, out.Text)
 			} else if out.Success {
-				fmt.Fprintf(w, "Pong received: time=%.2f ms\n", out.Time.Seconds()*1000)
+				fmt.Fprintf(w, "Pong received: time=%.2f ms\n", ms(out.Time))
 			} else {
 				fmt.Fprintf(w, "Pong failed\n")
 			}
@@ -203,6 +267,138 @@ trip latency information.
 	},
 }
 
+func ms(d time.Duration) float64 {
+	return d.Seconds() * 1000
+}
+
+// pinger pings a peer over the libp2p ping protocol, with payloads of any
+// multiple of ping.PingSize: the peer echoes them 32 bytes at a time.
+type pinger struct {
+	h    host.Host
+	pid  peer.ID
+	size int
+	// s is the stream of the pings, reopened after a failed ping
+	s network.Stream
+}
+
+// ping sends a ping and returns the time until its pong, or an error if it
+// did not come back within kPingTimeout.
+func (p *pinger) ping(ctx context.Context) (time.Duration, error) {
+	if p.s == nil {
+		s, err := p.h.NewStream(network.WithUseTransient(ctx, "ping"), p.pid, ping.ID)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.Scope().SetService(ping.ServiceName); err != nil {
+			s.Reset()
+			return 0, err
+		}
+		p.s = s
+	}
+
+	// abort on cancellation, the deadline bounds everything else
+	done := make(chan struct{})
+	defer close(done)
+	s := p.s
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-done:
+		}
+	}()
+
+	rtt, err := p.roundTrip()
+	if err != nil {
+		p.close()
+		return 0, err
+	}
+	p.h.Peerstore().RecordLatency(p.pid, rtt)
+	return rtt, nil
+}
+
+func (p *pinger) roundTrip() (time.Duration, error) {
+	buf := make([]byte, p.size)
+	if _, err := rand.Read(buf); err != nil {
+		return 0, err
+	}
+	if err := p.s.SetDeadline(time.Now().Add(kPingTimeout)); err != nil {
+		return 0, err
+	}
+
+	before := time.Now()
+	if _, err := p.s.Write(buf); err != nil {
+		return 0, err
+	}
+	rbuf := make([]byte, p.size)
+	if _, err := io.ReadFull(p.s, rbuf); err != nil {
+		return 0, err
+	}
+	rtt := time.Since(before)
+
+	if !bytes.Equal(buf, rbuf) {
+		return 0, errors.New("ping packet was incorrect")
+	}
+	return rtt, nil
+}
+
+func (p *pinger) close() {
+	if p.s != nil {
+		p.s.Reset()
+		p.s = nil
+	}
+}
+
+// pingStats accumulates the outcomes of the pings.
+type pingStats struct {
+	sent int
+	// rtts are the latencies of the pongs, in order
+	rtts []time.Duration
+}
+
+func (s *pingStats) add(rtt time.Duration, ok bool) {
+	s.sent++
+	if ok {
+		s.rtts = append(s.rtts, rtt)
+	}
+}
+
+// summary returns the statistics of the pings, which must have received a
+// pong.
+func (s *pingStats) summary() *PingSummary {
+	sum := &PingSummary{
+		Sent:     s.sent,
+		Received: len(s.rtts),
+		Loss:     float64(s.sent-len(s.rtts)) * 100 / float64(s.sent),
+	}
+
+	var total, jitter time.Duration
+	for i, rtt := range s.rtts {
+		total += rtt
+		if i > 0 {
+			d := rtt - s.rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+			jitter += d
+		}
+	}
+	sum.Avg = total / time.Duration(len(s.rtts))
+	if len(s.rtts) > 1 {
+		sum.Jitter = jitter / time.Duration(len(s.rtts)-1)
+	}
+
+	sorted := append([]time.Duration(nil), s.rtts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	// nearest rank
+	percentile := func(p int) time.Duration {
+		return sorted[(len(sorted)*p+99)/100-1]
+	}
+	sum.Min, sum.Max = sorted[0], sorted[len(sorted)-1]
+	sum.P50, sum.P90, sum.P99 = percentile(50), percentile(90), percentile(99)
+	return sum
+}
+
 func ParsePeerParam(text string) (ma.Multiaddr, peer.ID, error) {
 	// Multiaddr
 	if strings.HasPrefix(text, "/") {
@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPingStats(t *testing.T) {
+	var stats pingStats
+	for _, ms := range []int{10, 30, 0, 20, 40} {
+		stats.add(time.Duration(ms)*time.Millisecond, ms != 0)
+	}
+
+	sum := stats.summary()
+	expected := PingSummary{
+		Sent:     5,
+		Received: 4,
+		Loss:     20,
+		Min:      10 * time.Millisecond,
+		Avg:      25 * time.Millisecond,
+		Max:      40 * time.Millisecond,
+		P50:      20 * time.Millisecond,
+		P90:      40 * time.Millisecond,
+		P99:      40 * time.Millisecond,
+		// |30-10|, |20-30|, |40-20|
+		Jitter: 50 * time.Millisecond / 3,
+	}
+	if *sum != expected {
+		t.Fatalf("expected %+v, got %+v", expected, *sum)
+	}
+}
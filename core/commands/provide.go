@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+)
+
+// ProvideProgressOutput is the progress of the reprovides of the current
+// interval
+type ProvideProgressOutput struct {
+	Started  bool
+	Interval string
+	Start    time.Time
+	End      time.Time
+	Shard    int
+	Shards   int
+	Keys     int
+	Provided int
+	Failed   int
+	// Next is when the next key is due, if any
+	Next *time.Time `json:",omitempty"`
+	// Lag is how late the last key was reprovided
+	Lag string
+}
+
+var ProvideCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Inspect the announcements of the content of the node.",
+	},
+	Subcommands: map[string]*cmds.Command{
+		"progress": provideProgressCmd,
+	},
+}
+
+var provideProgressCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Show the progress of the reprovides of the current interval.",
+		ShortDescription: `
+With Reprovider.Spread enabled, the daemon reprovides each key at its own
+offset in the Reprovider.Interval rather than all keys at once. The keys of
+an interval are listed when it starts, and reprovided in shards, slices of
+the interval, one after the other.
+
+Shows the bounds of the current interval, the shard being reprovided, how
+many keys are scheduled in the interval and how many were reprovided so far,
+and how late the last one was.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.Reprovider == nil {
+			return errors.New("the reprovides are not spread, see Reprovider.Spread")
+		}
+
+		p := nd.Reprovider.Progress()
+		out := &ProvideProgressOutput{
+			Started:  p.Interval > 0,
+			Interval: p.Interval.String(),
+			Start:    p.Start,
+			End:      p.End,
+			Shard:    p.Shard,
+			Shards:   p.Shards,
+			Keys:     p.Keys,
+			Provided: p.Provided,
+			Failed:   p.Failed,
+			Lag:      p.Lag.String(),
+		}
+		if !p.Next.IsZero() {
+			out.Next = &p.Next
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Type: ProvideProgressOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ProvideProgressOutput) error {
+			if !out.Started {
+				fmt.Fprintln(w, "reprovides not started yet")
+				return nil
+			}
+			fmt.Fprintf(w, "interval of %s from %s to %s\n", out.Interval, out.Start.Format(time.RFC3339), out.End.Format(time.RFC3339))
+			percent := 100.0
+			if out.Keys > 0 {
+				percent = float64(out.Provided+out.Failed) * 100 / float64(out.Keys)
+			}
+			fmt.Fprintf(w, "shard %d of %d: %d of %d keys reprovided (%.1f%%), %d failed\n", out.Shard+1, out.Shards, out.Provided, out.Keys, percent, out.Failed)
+			if out.Next != nil {
+				fmt.Fprintf(w, "next key due at %s, last one %s late\n", out.Next.Format(time.RFC3339), out.Lag)
+			} else {
+				fmt.Fprintln(w, "all keys reprovided")
+			}
+			return nil
+		}),
+	},
+}
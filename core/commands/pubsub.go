@@ -9,10 +9,12 @@ import (
 	"sort"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
 	mbase "github.com/multiformats/go-multibase"
 	"github.com/pkg/errors"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 )
 
@@ -39,6 +41,8 @@ EXPERIMENTAL FEATURE
 	},
 }
 
+const pubsubReplayOptionName = "replay"
+
 type pubsubMessage struct {
 	From     string   `json:"from,omitempty"`
 	Data     string   `json:"data,omitempty"`
@@ -72,11 +76,21 @@ TOPIC AND DATA ENCODING
 
   You can inspect the format by passing --enc=json. The ipfs multibase commands
   can be used for encoding/decoding multibase strings in the userland.
+
+REPLAY
+
+  With --replay=<n>, the last n messages received by the node on the topic
+  are delivered first, for the subscribers that were away to catch up. The
+  node keeps the messages of the topics listed in Pubsub.History of the
+  config only.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("topic", true, false, "Name of topic to subscribe to."),
 	},
+	Options: []cmds.Option{
+		cmds.IntOption(pubsubReplayOptionName, "Deliver first the last <n> messages of the topic kept by the node."),
+	},
 	PreRun: urlArgsEncoder,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -88,8 +102,21 @@ TOPIC AND DATA ENCODING
 		}
 
 		topic := req.Arguments[0]
+		replay, _ := req.Options[pubsubReplayOptionName].(int)
+		if replay < 0 {
+			return fmt.Errorf("invalid --%s: %d", pubsubReplayOptionName, replay)
+		}
 
-		sub, err := api.PubSub().Subscribe(req.Context, topic)
+		var sub coreiface.PubSubSubscription
+		if replay > 0 {
+			psapi, ok := api.PubSub().(*coreapi.PubSubAPI)
+			if !ok {
+				return errors.New("replaying the messages is not supported by this node")
+			}
+			sub, err = psapi.SubscribeReplay(req.Context, topic, replay)
+		} else {
+			sub, err = api.PubSub().Subscribe(req.Context, topic)
+		}
 		if err != nil {
 			return err
 		}
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/e"
+	"github.com/ipfs/go-ipfs/fetchprogress"
 
 	cid "github.com/ipfs/go-cid"
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
@@ -23,6 +26,9 @@ var refsEncoderMap = cmds.EncoderMap{
 		if out.Err != "" {
 			return fmt.Errorf(out.Err)
 		}
+		if out.Progress != nil {
+			return nil
+		}
 		fmt.Fprintln(w, out.Ref)
 
 		return nil
@@ -53,6 +59,24 @@ with the following format:
   <link base58 hash>
 
 NOTE: List all references recursively by using the flag '-r'.
+`,
+		LongDescription: `
+Lists the hashes of all the links an IPFS or IPNS object(s) contains,
+with the following format:
+
+  <link base58 hash>
+
+NOTE: List all references recursively by using the flag '-r'.
+
+With --progress, the progress of the fetch of the objects is sent every
+second along with the refs, and once they are all listed: the blocks got out
+of those known so far, the bytes fetched from each provider, and the time
+left at the pace so far, see 'ipfs stats fetch --help'. The CLI writes it to
+stderr.
+
+With --offline, only the blocks in the local blockstore are listed: a missing
+block fails the command with an error of the offline kind, naming the block,
+rather than being fetched from the network.
 `,
 	},
 	Subcommands: map[string]*cmds.Command{
@@ -67,6 +91,7 @@ NOTE: List all references recursively by using the flag '-r'.
 		cmds.BoolOption(refsUniqueOptionName, "u", "Omit duplicate refs from output."),
 		cmds.BoolOption(refsRecursiveOptionName, "r", "Recursively list links of child nodes."),
 		cmds.IntOption(refsMaxDepthOptionName, "Only for recursive refs, limits fetch and listing to the given depth").WithDefault(-1),
+		cmds.BoolOption(progressOptionName, "Stream the progress of the fetch."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		err := req.ParseBodyArgs()
@@ -106,7 +131,7 @@ NOTE: List all references recursively by using the flag '-r'.
 		// TODO: use session for resolving as well.
 		objs, err := objectsForPaths(ctx, api, req.Arguments)
 		if err != nil {
-			return err
+			return cmdenv.OfflineError(req, err)
 		}
 
 		rw := RefWriter{
@@ -118,15 +143,70 @@ NOTE: List all references recursively by using the flag '-r'.
 			MaxDepth: maxDepth,
 		}
 
+		if cmdenv.IsOffline(req) {
+			rw.DAG = localNodeGetter{rw.DAG}
+		}
+
+		done := func() error { return nil }
+		if progress, _ := req.Options[progressOptionName].(bool); progress {
+			n, err := cmdenv.GetNode(env)
+			if err != nil {
+				return err
+			}
+			t := newFetchTracker(n)
+			t.AddRoots(objs...)
+			rw.DAG = t.NodeGetter(rw.DAG)
+			le := &lockedEmitter{ResponseEmitter: res}
+			rw.res = le
+			done = emitFetchProgress(ctx, le, t, func(ev *fetchprogress.Event) interface{} {
+				return &RefWrapper{Progress: ev}
+			})
+		}
+
 		for _, o := range objs {
 			if _, err := rw.WriteRefs(o, enc); err != nil {
-				if err := res.Emit(&RefWrapper{Err: err.Error()}); err != nil {
+				if cmdenv.IsOffline(req) {
+					// failed rather than emitted, for the error to keep its kind
+					return cmdenv.OfflineError(req, err)
+				}
+				if err := rw.res.Emit(&RefWrapper{Err: err.Error()}); err != nil {
 					return err
 				}
 			}
 		}
 
-		return nil
+		return done()
+	},
+	PostRun: cmds.PostRunMap{
+		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
+			// the progress goes to stderr when written as text
+			text := cmds.GetEncoding(res.Request(), cmds.Text) == cmds.Text
+			for {
+				v, err := res.Next()
+				if err != nil {
+					if err == io.EOF {
+						return nil
+					}
+					return err
+				}
+
+				out, ok := v.(*RefWrapper)
+				if !ok {
+					return e.TypeErr(out, v)
+				}
+				if out.Progress == nil || !text {
+					if err := re.Emit(out); err != nil {
+						return err
+					}
+					continue
+				}
+				end := "\r"
+				if out.Progress.Done {
+					end = "\n"
+				}
+				fmt.Fprintf(os.Stderr, "\033[2K%s%s", formatFetchProgress(out.Progress), end)
+			}
+		},
 	},
 	Encoders: refsEncoderMap,
 	Type:     RefWrapper{},
@@ -178,9 +258,31 @@ func objectsForPaths(ctx context.Context, n iface.CoreAPI, paths []string) ([]ci
 	return roots, nil
 }
 
+// localNodeGetter gets the nodes of a GetMany one at a time, for the error
+// of a node missing locally to name it, as the error of GetMany does not.
+type localNodeGetter struct {
+	ipld.NodeGetter
+}
+
+func (g localNodeGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	defer close(out)
+	for _, c := range cids {
+		nd, err := g.Get(ctx, c)
+		out <- &ipld.NodeOption{Node: nd, Err: err}
+		if err != nil {
+			break
+		}
+	}
+	return out
+}
+
 type RefWrapper struct {
 	Ref string
 	Err string
+	// Progress is the progress of the fetch, sent instead of a ref with
+	// --progress.
+	Progress *fetchprogress.Event `json:",omitempty"`
 }
 
 type RefWriter struct {
@@ -2,18 +2,28 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"text/tabwriter"
+	"time"
 
 	humanize "github.com/dustin/go-humanize"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 	corerepo "github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/gc"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/maintenance"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/compressds"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cid "github.com/ipfs/go-cid"
@@ -39,6 +49,9 @@ var RepoCmd = &cmds.Command{
 		"fsck":    repoFsckCmd,
 		"version": repoVersionCmd,
 		"verify":  repoVerifyCmd,
+
+		"migrate-to": repoMigrateToCmd,
+		"compress":   repoCompressCmd,
 	},
 }
 
@@ -46,12 +59,19 @@ var RepoCmd = &cmds.Command{
 type GcResult struct {
 	Key   cid.Cid
 	Error string `json:",omitempty"`
+	// Status is the progress of the incremental garbage collection, sent
+	// last by an incremental run, and alone with --status.
+	Status *gc.Status `json:",omitempty"`
 }
 
 const (
 	repoStreamErrorsOptionName = "stream-errors"
 	repoQuietOptionName        = "quiet"
 	repoSilentOptionName       = "silent"
+	repoRateOptionName         = "rate"
+	repoMaxDurationOptionName  = "max-duration"
+	repoMaxBytesOptionName     = "max-bytes"
+	repoStatusOptionName       = "status"
 )
 
 var repoGcCmd = &cmds.Command{
@@ -61,13 +81,36 @@ var repoGcCmd = &cmds.Command{
 'ipfs repo gc' is a plumbing command that will sweep the local
 set of stored objects and remove ones that are not pinned in
 order to reclaim hard disk space.
+`,
+		LongDescription: `
+'ipfs repo gc' is a plumbing command that will sweep the local
+set of stored objects and remove ones that are not pinned in
+order to reclaim hard disk space.
+
+By default, the blocks to keep are found all at once, holding off the
+pinning and the adds until the blocks not kept are removed, which can take
+hours on a large repo. With --max-duration or --max-bytes, the garbage
+collection is incremental instead: the blocks to keep are marked in the
+repo, and the others are removed in small batches, holding off the pinning
+and the adds only for a batch at a time. The run stops once it has lasted
+--max-duration or freed --max-bytes, and the next 'ipfs repo gc' goes on
+from there, until the garbage collection is done:
+
+  $ ipfs repo gc --max-duration=10m --max-bytes=50GB
+
+--status reports the progress of the incremental garbage collection in
+progress, if any.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoStreamErrorsOptionName, "Stream errors."),
 		cmds.BoolOption(repoQuietOptionName, "q", "Write minimal output."),
 		cmds.BoolOption(repoSilentOptionName, "Write no output."),
+		cmds.StringOption(repoMaxDurationOptionName, "Stop the garbage collection after this long, e.g. 10m, to go on with it at the next run."),
+		cmds.StringOption(repoMaxBytesOptionName, "Stop the garbage collection once it freed this much, e.g. 50GB, to go on with it at the next run."),
+		cmds.BoolOption(repoStatusOptionName, "Report the progress of the incremental garbage collection in progress."),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -77,7 +120,29 @@ order to reclaim hard disk space.
 		silent, _ := req.Options[repoSilentOptionName].(bool)
 		streamErrors, _ := req.Options[repoStreamErrorsOptionName].(bool)
 
-		gcOutChan := corerepo.GarbageCollectAsync(n, req.Context)
+		st, err := gc.IncrementalStatus(req.Context, n.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+		if status, _ := req.Options[repoStatusOptionName].(bool); status {
+			if st == nil {
+				st = &gc.Status{}
+			}
+			return re.Emit(&GcResult{Status: st})
+		}
+
+		budget, err := gcBudget(req)
+		if err != nil {
+			return err
+		}
+		// a garbage collection in progress is finished incrementally too
+		incremental := st != nil || budget != gc.Budget{}
+		var gcOutChan <-chan gc.Result
+		if incremental {
+			gcOutChan = corerepo.GarbageCollectIncremental(n, req.Context, budget)
+		} else {
+			gcOutChan = corerepo.GarbageCollectAsync(n, req.Context)
+		}
 
 		if streamErrors {
 			errs := false
@@ -111,18 +176,33 @@ order to reclaim hard disk space.
 			}
 		}
 
-		return nil
+		if !incremental {
+			return nil
+		}
+		st, err = gc.IncrementalStatus(req.Context, n.Repo.Datastore())
+		if err != nil || st == nil {
+			return err
+		}
+		return re.Emit(&GcResult{Status: st})
 	},
 	Type: GcResult{},
 	Encoders: cmds.EncoderMap{
 		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, gcr *GcResult) error {
 			quiet, _ := req.Options[repoQuietOptionName].(bool)
 			silent, _ := req.Options[repoSilentOptionName].(bool)
+			status, _ := req.Options[repoStatusOptionName].(bool)
 
 			if silent {
 				return nil
 			}
 
+			if gcr.Status != nil {
+				if quiet && !status {
+					return nil
+				}
+				return printGcStatus(w, gcr.Status, status)
+			}
+
 			if gcr.Error != "" {
 				_, err := fmt.Fprintf(w, "Error: %s\n", gcr.Error)
 				return err
@@ -139,9 +219,53 @@ order to reclaim hard disk space.
 	},
 }
 
+// gcBudget returns the budget of the garbage collection given by the
+// options, zero if none.
+func gcBudget(req *cmds.Request) (gc.Budget, error) {
+	var budget gc.Budget
+	if s, ok := req.Options[repoMaxDurationOptionName].(string); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return budget, fmt.Errorf("invalid --%s: %s", repoMaxDurationOptionName, err)
+		}
+		if d <= 0 {
+			return budget, fmt.Errorf("--%s must be positive", repoMaxDurationOptionName)
+		}
+		budget.MaxDuration = d
+	}
+	if s, ok := req.Options[repoMaxBytesOptionName].(string); ok {
+		n, err := humanize.ParseBytes(s)
+		if err != nil {
+			return budget, fmt.Errorf("invalid --%s: %s", repoMaxBytesOptionName, err)
+		}
+		if n == 0 {
+			return budget, fmt.Errorf("--%s must be positive", repoMaxBytesOptionName)
+		}
+		budget.MaxBytes = n
+	}
+	return budget, nil
+}
+
+// printGcStatus writes the progress of an incremental garbage collection,
+// reported by --status if asked, or else at the end of a run.
+func printGcStatus(w io.Writer, st *gc.Status, asked bool) error {
+	if st.Phase == "" {
+		_, err := fmt.Fprintln(w, "no garbage collection in progress")
+		return err
+	}
+	progress := fmt.Sprintf("%d blocks marked, %d blocks removed (%s freed)", st.Marked, st.Removed, humanize.Bytes(st.Freed))
+	if asked {
+		_, err := fmt.Fprintf(w, "garbage collection started %s, in the %s phase: %s\n", st.Started.Format(time.RFC3339), st.Phase, progress)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "garbage collection paused in the %s phase: %s so far, run 'ipfs repo gc' to go on with it\n", st.Phase, progress)
+	return err
+}
+
 const (
-	repoSizeOnlyOptionName = "size-only"
-	repoHumanOptionName    = "human"
+	repoSizeOnlyOptionName    = "size-only"
+	repoHumanOptionName       = "human"
+	repoCompressionOptionName = "compression"
 )
 
 var repoStatCmd = &cmds.Command{
@@ -156,11 +280,18 @@ StorageMax      string Maximum datastore size (from configuration)
 NumObjects      int Number of objects in the local repo.
 RepoPath        string The path to the repo being currently used.
 Version         string The repo version.
+
+With --compression, it also reports the size of the compressed datastores,
+as stored and once decompressed, which reads all their entries.
+
+With Datastore.Placement set, it also reports the number of blocks of each
+placement mount, and the disk usage of its datastore.
 `,
 	},
 	Options: []cmds.Option{
 		cmds.BoolOption(repoSizeOnlyOptionName, "s", "Only report RepoSize and StorageMax."),
 		cmds.BoolOption(repoHumanOptionName, "H", "Print sizes in human readable format (e.g., 1K 234M 2G)"),
+		cmds.BoolOption(repoCompressionOptionName, "Report the size of the compressed datastores, as stored and once decompressed."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		n, err := cmdenv.GetNode(env)
@@ -168,22 +299,24 @@ Version         string The repo version.
 			return err
 		}
 
+		var stat corerepo.Stat
 		sizeOnly, _ := req.Options[repoSizeOnlyOptionName].(bool)
 		if sizeOnly {
-			sizeStat, err := corerepo.RepoSize(req.Context, n)
-			if err != nil {
-				return err
-			}
-			return cmds.EmitOnce(res, &corerepo.Stat{
-				SizeStat: sizeStat,
-			})
+			stat.SizeStat, err = corerepo.RepoSize(req.Context, n)
+		} else {
+			stat, err = corerepo.RepoStat(req.Context, n)
 		}
-
-		stat, err := corerepo.RepoStat(req.Context, n)
 		if err != nil {
 			return err
 		}
 
+		if compression, _ := req.Options[repoCompressionOptionName].(bool); compression {
+			stat.Compression, err = corerepo.CompressionStat(req.Context, n)
+			if err != nil {
+				return err
+			}
+		}
+
 		return cmds.EmitOnce(res, &stat)
 	},
 	Type: &corerepo.Stat{},
@@ -216,27 +349,118 @@ Version         string The repo version.
 				fmt.Fprintf(wtr, "Version:\t%s\n", stat.Version)
 			}
 
+			mountpoints := make([]string, 0, len(stat.Compression))
+			for mountpoint := range stat.Compression {
+				mountpoints = append(mountpoints, mountpoint)
+			}
+			sort.Strings(mountpoints)
+			for _, mountpoint := range mountpoints {
+				c := stat.Compression[mountpoint]
+				fmt.Fprintf(wtr, "Compression %s:\t%s, %d of %d entries compressed\n", mountpoint, c.Algorithm, c.Compressed, c.Entries)
+				printSize("  LogicalSize", c.LogicalSize)
+				printSize("  PhysicalSize", c.PhysicalSize)
+			}
+
+			mounts := make([]string, 0, len(stat.Placement))
+			for name := range stat.Placement {
+				mounts = append(mounts, name)
+			}
+			sort.Strings(mounts)
+			for _, name := range mounts {
+				u := stat.Placement[name]
+				fmt.Fprintf(wtr, "Placement %s:\t%d blocks\n", name, u.Blocks)
+				printSize("  Size", u.Size)
+			}
+
 			return nil
 		}),
 	},
 }
 
+const repoFsckOnlineOptionName = "online"
+
+// FsckOutput is a problem found by "repo fsck --online", or its summary if
+// Check is empty.
+type FsckOutput struct {
+	Check    string `json:",omitempty"`
+	Message  string
+	Repaired bool `json:",omitempty"`
+}
+
 var repoFsckCmd = &cmds.Command{
-	Status: cmds.Deprecated, // https://github.com/ipfs/go-ipfs/issues/6435
 	Helptext: cmds.HelpText{
-		Tagline: "Remove repo lockfiles.",
+		Tagline: "Check the consistency of the repo.",
 		ShortDescription: `
-'ipfs repo fsck' is now a no-op.
+'ipfs repo fsck --online' checks the repo, which may be in use by the daemon,
+and repairs what it safely can.
 `,
+		LongDescription: `
+'ipfs repo fsck --online' checks the repo, which may be in use by the daemon,
+and repairs what it safely can. It checks:
+
+  - pins: the DAGs of the recursive pins and the roots of the direct, lazy and
+    selector pins are present. Direct pins of recursively pinned CIDs and lazy
+    pins already filled are removed.
+  - provider-queue: the entries of the provider queue are CIDs of blocks still
+    present. The other entries are removed.
+  - mfs: the DAG of the MFS root is present.
+  - datastore: the datastore checks itself, if it can, and the keys of the
+    blockstore are multihashes.
+
+Each problem is reported, tagged with '(repaired)' once repaired. The command
+fails if some problems could not be repaired: missing blocks can be fetched
+again with 'ipfs pin add' or 'ipfs refs -r'. Garbage collection waits for the
+checks to complete.
+
+Without --online, 'ipfs repo fsck' is a no-op, as it used to remove the repo
+lockfiles.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(repoFsckOnlineOptionName, "Check the repo, which may be in use by the daemon."),
 	},
-	NoRemote: true,
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
-		return cmds.EmitOnce(res, &MessageOutput{"`ipfs repo fsck` is deprecated and does nothing.\n"})
+		online, _ := req.Options[repoFsckOnlineOptionName].(bool)
+		if !online {
+			return cmds.EmitOnce(res, &FsckOutput{Message: "`ipfs repo fsck` without --online is deprecated and does nothing."})
+		}
+
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		var problems, repaired int
+		err = corerepo.Fsck(req.Context, n, func(p corerepo.FsckProblem) error {
+			problems++
+			if p.Repaired {
+				repaired++
+			}
+			return res.Emit(&FsckOutput{Check: p.Check, Message: p.Message, Repaired: p.Repaired})
+		})
+		if err != nil {
+			return err
+		}
+		if repaired < problems {
+			return fmt.Errorf("fsck found %d problems, could not repair %d", problems, problems-repaired)
+		}
+		if problems == 0 {
+			return res.Emit(&FsckOutput{Message: "fsck complete, the repo is consistent."})
+		}
+		return res.Emit(&FsckOutput{Message: fmt.Sprintf("fsck complete, repaired %d problems.", repaired)})
 	},
-	Type: MessageOutput{},
+	Type: FsckOutput{},
 	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *MessageOutput) error {
-			fmt.Fprintf(w, out.Message)
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *FsckOutput) error {
+			if out.Check == "" {
+				fmt.Fprintln(w, out.Message)
+				return nil
+			}
+			repaired := ""
+			if out.Repaired {
+				repaired = " (repaired)"
+			}
+			fmt.Fprintf(w, "%s: %s%s\n", out.Check, out.Message, repaired)
 			return nil
 		}),
 	},
@@ -301,6 +525,7 @@ var repoVerifyCmd = &cmds.Command{
 
 		bs := bstore.NewBlockstore(nd.Repo.Datastore())
 		bs.HashOnRead(true)
+		bs = iothrottle.NewBlockstore(bs, nd.Maintenance.Limiter(maintenance.Scrub, nd.BackgroundIO))
 
 		keys, err := bs.AllKeysChan(req.Context)
 		if err != nil {
@@ -357,6 +582,192 @@ var repoVerifyCmd = &cmds.Command{
 	},
 }
 
+// RepoMigrateProgress is the progress of 'ipfs repo migrate-to'.
+type RepoMigrateProgress struct {
+	Copied uint64
+	Done   bool `json:",omitempty"`
+}
+
+// repoMigrateProgressInterval is how often the progress of a migration is
+// emitted.
+const repoMigrateProgressInterval = time.Second
+
+var repoMigrateToCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Migrate the blocks to another datastore while the node runs.",
+		ShortDescription: `
+'ipfs repo migrate-to' moves the blocks to the datastore of the given spec,
+which replaces the one mounted at /blocks in Datastore.Spec, without
+stopping the node.
+`,
+		LongDescription: `
+'ipfs repo migrate-to' moves the blocks to the datastore of the given spec,
+which replaces the one mounted at /blocks in Datastore.Spec, without
+stopping the node. The spec is in the format of Datastore.Spec, see
+docs/datastores.md. For example, to move the blocks from flatfs to badger:
+
+  $ ipfs repo migrate-to '{"type": "measure", "prefix": "badger.datastore",
+    "child": {"type": "badgerds", "path": "badgerds", "syncWrites": false,
+    "truncate": true}}'
+
+The blocks are written to the new datastore as soon as the migration
+starts, and read from either datastore while the blocks of the old one are
+copied in the background. Once they are all copied, the new datastore is
+used alone, and Datastore.Spec is updated. The old datastore is closed when
+the node stops; its files are left in the repo, for you to remove.
+
+The copy is throttled by --rate, or by Datastore.BackgroundIO if it is not
+given. If the command is interrupted, or the node stops, the migration goes
+on when the node starts again: run the command again with the same spec to
+finish it.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("spec", true, false, "The JSON spec of the datastore to migrate the blocks to."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(repoRateOptionName, "Copy at most this many blocks per second."),
+	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		var spec map[string]interface{}
+		if err := json.Unmarshal([]byte(req.Arguments[0]), &spec); err != nil {
+			return fmt.Errorf("invalid datastore spec: %s", err)
+		}
+		return migrateBlocks(req, res, env, spec)
+	},
+	Type:     RepoMigrateProgress{},
+	Encoders: repoMigrateEncoders,
+}
+
+// migrateBlocks migrates the blocks to the datastore of spec, emitting the
+// progress.
+func migrateBlocks(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, spec map[string]interface{}) error {
+	nd, err := cmdenv.GetNode(env)
+	if err != nil {
+		return err
+	}
+	r, ok := nd.Repo.(repo.BlocksMigrator)
+	if !ok {
+		return repo.ErrBlocksMigrationUnsupported
+	}
+
+	limiter := nd.BackgroundIO
+	if rate, ok := req.Options[repoRateOptionName].(int); ok {
+		if rate <= 0 {
+			return fmt.Errorf("--%s must be positive", repoRateOptionName)
+		}
+		limiter = iothrottle.New(uint64(rate), 0)
+	}
+	limiter = nd.Maintenance.Limiter(maintenance.Migrate, limiter)
+
+	var (
+		copied   uint64
+		lastEmit time.Time
+	)
+	err = r.MigrateBlocks(req.Context, spec, limiter, func(n uint64) {
+		copied = n
+		if time.Since(lastEmit) < repoMigrateProgressInterval {
+			return
+		}
+		lastEmit = time.Now()
+		// an emit failing means the client is gone, the migration
+		// goes on until the context is canceled
+		_ = res.Emit(&RepoMigrateProgress{Copied: n})
+	})
+	if err != nil {
+		return err
+	}
+	return res.Emit(&RepoMigrateProgress{Copied: copied, Done: true})
+}
+
+var repoMigrateEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, obj *RepoMigrateProgress) error {
+		if obj.Done {
+			fmt.Fprintf(w, "migration complete, %d blocks copied.\n", obj.Copied)
+			return nil
+		}
+		fmt.Fprintf(w, "%d blocks copied.\r", obj.Copied)
+		return nil
+	}),
+}
+
+const repoCompressLevelOptionName = "level"
+
+var repoCompressCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Compress the blocks, or decompress them, while the node runs.",
+		ShortDescription: `
+'ipfs repo compress' migrates the blocks to a copy of the datastore mounted
+at /blocks which compresses them with the given algorithm, zstd or lz4, or
+decompresses them with 'none', without stopping the node.
+`,
+		LongDescription: `
+'ipfs repo compress' migrates the blocks to a copy of the datastore mounted
+at /blocks which compresses them with the given algorithm, zstd or lz4, or
+decompresses them with 'none', without stopping the node. zstd compresses
+more, lz4 is faster, and --level sets the zstd level, from 1 to 22. The
+blocks which don't shrink, such as those of media files, are stored as they
+are.
+
+The compressed blocks are copied to a new directory of the repo, named after
+the algorithm, such as 'blocks-zstd', and the decompressed blocks back to the
+directory without the suffix, which must have been removed. The migration is
+done as by 'ipfs repo migrate-to', throttled by --rate, and finished by
+running the command again if interrupted. 'ipfs repo stat --compression'
+reports the size of the blocks as stored and once decompressed.
+
+A compress datastore can also be configured on any mount of Datastore.Spec
+when the repo is created, see docs/datastores.md.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("algorithm", true, false, "The algorithm to compress the blocks with: "+strings.Join(compressds.Algorithms, ", ")+", or none to decompress them."),
+	},
+	Options: []cmds.Option{
+		cmds.IntOption(repoCompressLevelOptionName, "The zstd level, from 1 to 22."),
+		cmds.IntOption(repoRateOptionName, "Copy at most this many blocks per second."),
+	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		algorithm := req.Arguments[0]
+		if algorithm == "none" {
+			algorithm = ""
+		}
+		level, _ := req.Options[repoCompressLevelOptionName].(int)
+
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		cfg, err := nd.Repo.Config()
+		if err != nil {
+			return err
+		}
+		spec, path, err := fsrepo.CompressedBlocksSpec(cfg.Datastore.Spec, algorithm, level)
+		if err != nil {
+			return err
+		}
+		cfgRoot, err := cmdenv.GetConfigRoot(env)
+		if err != nil {
+			return err
+		}
+		// an interrupted migration goes on in the directory it started
+		migrating, err := fsrepo.BlocksMigration(cfgRoot)
+		if err != nil {
+			return err
+		}
+		if migrating == nil {
+			if _, err := os.Stat(filepath.Join(cfgRoot, path)); err == nil {
+				return fmt.Errorf("%s exists in the repo, remove it first", path)
+			}
+		}
+		return migrateBlocks(req, res, env, spec)
+	},
+	Type:     RepoMigrateProgress{},
+	Encoders: repoMigrateEncoders,
+}
+
 var repoVersionCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Show the repo version.",
@@ -8,12 +8,14 @@ import (
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
-	ncmd "github.com/ipfs/go-ipfs/core/commands/name"
+	"github.com/ipfs/go-ipfs/namechain"
+	"github.com/ipfs/go-ipfs/namespaces"
 	ns "github.com/ipfs/go-namesys"
 
 	cidenc "github.com/ipfs/go-cidutil/cidenc"
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	ipfspath "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
@@ -23,6 +25,9 @@ const (
 	resolveRecursiveOptionName      = "recursive"
 	resolveDhtRecordCountOptionName = "dht-record-count"
 	resolveDhtTimeoutOptionName     = "dht-timeout"
+	resolveBatchOptionName          = "batch"
+	resolveMaxDepthOptionName       = "max-depth"
+	resolveStepTimeoutOptionName    = "step-timeout"
 )
 
 var ResolveCmd = &cmds.Command{
@@ -38,7 +43,9 @@ There are a number of mutable name protocols that can link among
 themselves and into IPNS. For example IPNS references can (currently)
 point at an IPFS object, and DNS links can point at other DNS links, IPNS
 entries, or IPFS objects. This command accepts any of these
-identifiers and resolves them to the referenced item.
+identifiers and resolves them to the referenced item. The names of the
+namespaces added by plugins, such as /xyz/<name>, are resolved like the IPNS
+names, one at a time unless -r is given.
 
 EXAMPLES
 
@@ -62,6 +69,24 @@ Resolve the value of an IPFS DAG path:
   $ ipfs resolve /ipfs/QmeZy1fGbwgVSrqbfh9fKQrAWgeyRnj7h8fsHS1oy3k99x/beep/boop
   /ipfs/QmYRMjyvAiHKN9UTi8Bzt1HUspmSRD8T8DwxfSMzLgBon1
 
+Resolve many names in one request, reading them from stdin:
+
+  $ ipfs resolve --batch --enc=json < names.txt
+  {"Name":"/ipfs/QmeZy1fGbwgVSrqbfh9fKQrAWgeyRnj7h8fsHS1oy3k99x/beep","Path":"/ipfs/Qm..."}
+  {"Name":"/ipns/example.com","Path":"","Error":"could not resolve name"}
+
+In batch mode, a failure to resolve one name does not abort the command;
+the error is reported in the Error field of that name's result instead.
+Results are emitted in input order.
+
+Bound the resolution of chains of IPNS names and DNSLinks:
+
+  $ ipfs resolve -r --max-depth=2 --step-timeout=10s /ipns/example.com
+  Error: step 2 of the name resolution, /ipns/k51...: name resolution timed out after 10s
+
+With --max-depth or --step-timeout, the names are resolved one at a time, and
+the error of a name failing to resolve tells which name of the chain it is.
+
 `,
 	},
 
@@ -72,6 +97,9 @@ Resolve the value of an IPFS DAG path:
 		cmds.BoolOption(resolveRecursiveOptionName, "r", "Resolve until the result is an IPFS name.").WithDefault(true),
 		cmds.IntOption(resolveDhtRecordCountOptionName, "dhtrc", "Number of records to request for DHT resolution."),
 		cmds.StringOption(resolveDhtTimeoutOptionName, "dhtt", "Max time to collect values during DHT resolution eg \"30s\". Pass 0 for no timeout."),
+		cmds.BoolOption(resolveBatchOptionName, "Read newline-separated names from stdin and stream one result per name."),
+		cmds.IntOption(resolveMaxDepthOptionName, "Max number of IPNS names and DNSLinks resolved with --recursive."),
+		cmds.StringOption(resolveStepTimeoutOptionName, "Max time to resolve each IPNS name or DNSLink with --recursive eg \"10s\"."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
@@ -79,73 +107,156 @@ Resolve the value of an IPFS DAG path:
 			return err
 		}
 
-		name := req.Arguments[0]
-		recursive, _ := req.Options[resolveRecursiveOptionName].(bool)
-
-		// the case when ipns is resolved step by step
-		if strings.HasPrefix(name, "/ipns/") && !recursive {
-			rc, rcok := req.Options[resolveDhtRecordCountOptionName].(uint)
-			dhtt, dhttok := req.Options[resolveDhtTimeoutOptionName].(string)
-			ropts := []options.NameResolveOption{
-				options.Name.ResolveOption(nsopts.Depth(1)),
+		batch, _ := req.Options[resolveBatchOptionName].(bool)
+		if !batch {
+			p, err := resolveName(req, api, req.Arguments[0])
+			if err != nil {
+				return err
 			}
+			return cmds.EmitOnce(res, &ResolveOutput{Path: p})
+		}
 
-			if rcok {
-				ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtRecordCount(rc)))
+		itr := argumentIterator{req.Arguments, req.BodyArgs()}
+		for {
+			name, ok := itr.next()
+			if !ok {
+				break
 			}
-			if dhttok {
-				d, err := time.ParseDuration(dhtt)
-				if err != nil {
-					return err
-				}
-				if d < 0 {
-					return errors.New("DHT timeout value must be >= 0")
-				}
-				ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtTimeout(d)))
+			if name == "" {
+				continue
 			}
-			p, err := api.Name().Resolve(req.Context, name, ropts...)
-			// ErrResolveRecursion is fine
-			if err != nil && err != ns.ErrResolveRecursion {
+			if err := req.Context.Err(); err != nil {
 				return err
 			}
-			return cmds.EmitOnce(res, &ncmd.ResolvedPath{Path: ipfspath.Path(p.String())})
-		}
 
-		var enc cidenc.Encoder
-		switch {
-		case !cmdenv.CidBaseDefined(req) && !strings.HasPrefix(name, "/ipns/"):
-			// Not specified, check the path.
-			enc, err = cmdenv.CidEncoderFromPath(name)
-			if err == nil {
-				break
-			}
-			// Nope, fallback on the default.
-			fallthrough
-		default:
-			enc, err = cmdenv.GetCidEncoder(req)
+			out := &ResolveOutput{Name: name}
+			p, err := resolveName(req, api, name)
 			if err != nil {
+				out.Error = err.Error()
+			} else {
+				out.Path = p
+			}
+			if err := res.Emit(out); err != nil {
 				return err
 			}
 		}
+		return itr.err()
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ResolveOutput) error {
+			if batch, _ := req.Options[resolveBatchOptionName].(bool); !batch {
+				fmt.Fprintln(w, out.Path.String())
+				return nil
+			}
+			if out.Error != "" {
+				fmt.Fprintf(w, "%s\tError: %s\n", out.Name, out.Error)
+				return nil
+			}
+			fmt.Fprintf(w, "%s\t%s\n", out.Name, out.Path.String())
+			return nil
+		}),
+	},
+	Type: ResolveOutput{},
+}
+
+// ResolveOutput is the output type of the 'resolve' command. Name and Error
+// are only set in batch mode.
+type ResolveOutput struct {
+	Name  string `json:",omitempty"`
+	Path  ipfspath.Path
+	Error string `json:",omitempty"`
+}
+
+// resolveName resolves a single name according to the options set on req.
+func resolveName(req *cmds.Request, api coreiface.CoreAPI, name string) (ipfspath.Path, error) {
+	recursive, _ := req.Options[resolveRecursiveOptionName].(bool)
+
+	// the case when ipns is resolved step by step
+	if strings.HasPrefix(name, "/ipns/") && !recursive {
+		rc, rcok := req.Options[resolveDhtRecordCountOptionName].(uint)
+		dhtt, dhttok := req.Options[resolveDhtTimeoutOptionName].(string)
+		ropts := []options.NameResolveOption{
+			options.Name.ResolveOption(nsopts.Depth(1)),
+		}
+
+		if rcok {
+			ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtRecordCount(rc)))
+		}
+		if dhttok {
+			d, err := time.ParseDuration(dhtt)
+			if err != nil {
+				return "", err
+			}
+			if d < 0 {
+				return "", errors.New("DHT timeout value must be >= 0")
+			}
+			ropts = append(ropts, options.Name.ResolveOption(nsopts.DhtTimeout(d)))
+		}
+		p, err := api.Name().Resolve(req.Context, name, ropts...)
+		// ErrResolveRecursion is fine
+		if err != nil && err != ns.ErrResolveRecursion {
+			return "", err
+		}
+		return ipfspath.Path(p.String()), nil
+	}
 
-		// else, ipfs path or ipns with recursive flag
-		rp, err := api.ResolvePath(req.Context, path.New(name))
+	// as are the names of the namespaces added by plugins
+	if namespaces.IsNamespaced(name) && !recursive {
+		p, err := namespaces.ResolveOnce(req.Context, path.New(name))
 		if err != nil {
-			return err
+			return "", err
+		}
+		return ipfspath.Path(p.String()), nil
+	}
+
+	var (
+		enc cidenc.Encoder
+		err error
+	)
+	switch {
+	case !cmdenv.CidBaseDefined(req) && !strings.HasPrefix(name, "/ipns/"):
+		// Not specified, check the path.
+		enc, err = cmdenv.CidEncoderFromPath(name)
+		if err == nil {
+			break
 		}
+		// Nope, fallback on the default.
+		fallthrough
+	default:
+		enc, err = cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return "", err
+		}
+	}
 
-		encoded := "/" + rp.Namespace() + "/" + enc.Encode(rp.Cid())
-		if remainder := rp.Remainder(); remainder != "" {
-			encoded += "/" + remainder
+	// the names of a chain are resolved one at a time when it is bounded
+	maxDepth, depthok := req.Options[resolveMaxDepthOptionName].(int)
+	stept, steptok := req.Options[resolveStepTimeoutOptionName].(string)
+	if (depthok || steptok) && strings.HasPrefix(name, "/ipns/") {
+		settings := namechain.Settings{MaxDepth: maxDepth}
+		if steptok {
+			settings.StepTimeout, err = time.ParseDuration(stept)
+			if err != nil {
+				return "", err
+			}
 		}
+		p, err := namechain.Resolve(req.Context, api.Name(), path.New(name), settings)
+		if err != nil {
+			return "", err
+		}
+		name = p.String()
+	}
 
-		return cmds.EmitOnce(res, &ncmd.ResolvedPath{Path: ipfspath.Path(encoded)})
-	},
-	Encoders: cmds.EncoderMap{
-		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, rp *ncmd.ResolvedPath) error {
-			fmt.Fprintln(w, rp.Path.String())
-			return nil
-		}),
-	},
-	Type: ncmd.ResolvedPath{},
+	// else, ipfs path or ipns with recursive flag
+	rp, err := api.ResolvePath(req.Context, path.New(name))
+	if err != nil {
+		return "", err
+	}
+
+	encoded := "/" + rp.Namespace() + "/" + enc.Encode(rp.Cid())
+	if remainder := rp.Remainder(); remainder != "" {
+		encoded += "/" + remainder
+	}
+
+	return ipfspath.Path(encoded), nil
 }
@@ -3,6 +3,7 @@ package commands
 import (
 	"errors"
 
+	"github.com/ipfs/go-ipfs/apierr"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	dag "github.com/ipfs/go-ipfs/core/commands/dag"
 	name "github.com/ipfs/go-ipfs/core/commands/name"
@@ -16,7 +17,7 @@ import (
 
 var log = logging.Logger("core/commands")
 
-var ErrNotOnline = errors.New("this command must be run in online mode. Try running 'ipfs daemon' first")
+var ErrNotOnline = apierr.New(apierr.Offline, errors.New("this command must be run in online mode. Try running 'ipfs daemon' first"))
 
 const (
 	ConfigOption  = "config"
@@ -24,12 +25,13 @@ const (
 	LocalOption   = "local" // DEPRECATED: use OfflineOption
 	OfflineOption = "offline"
 	ApiOption     = "api"
+	ApiAuthOption = "api-auth"
 )
 
 var Root = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline:  "Global p2p merkle-dag filesystem.",
-		Synopsis: "ipfs [--config=<config> | -c] [--debug | -D] [--help] [-h] [--api=<api>] [--offline] [--cid-base=<base>] [--upgrade-cidv0-in-output] [--encoding=<encoding> | --enc] [--timeout=<timeout>] <command> ...",
+		Synopsis: "ipfs [--config=<config> | -c] [--debug | -D] [--help] [-h] [--api=<api>] [--api-auth=<secret>] [--offline] [--cid-base=<base>] [--upgrade-cidv0-in-output] [--encoding=<encoding> | --enc] [--timeout=<timeout>] <command> ...",
 		Subcommands: `
 BASIC COMMANDS
   init          Initialize local IPFS configuration
@@ -38,10 +40,12 @@ BASIC COMMANDS
   get <ref>     Download IPFS objects
   ls <ref>      List links from an object
   refs <ref>    List hashes of links from an object
+  diff <a> <b>  Show the files changed between two directories
 
 DATA STRUCTURE COMMANDS
   dag           Interact with IPLD DAG nodes
   files         Interact with files as if they were a unix filesystem
+  archive       Export files as reproducible archives
   block         Interact with raw blocks in the datastore
 
 TEXT ENCODING COMMANDS
@@ -60,6 +64,7 @@ ADVANCED COMMANDS
   stats         Various operational stats
   p2p           Libp2p stream mounting
   filestore     Manage the filestore (experimental)
+  lowpower      Control the low-power mode of the daemon
 
 NETWORK COMMANDS
   id            Show info about IPFS peers
@@ -73,6 +78,7 @@ NETWORK COMMANDS
 
 TOOL COMMANDS
   config        Manage configuration
+  auth          Manage the authorizations of the RPC API
   version       Show IPFS version information
   update        Download and apply go-ipfs updates
   commands      List all available commands
@@ -102,6 +108,7 @@ The CLI will exit with one of the following values:
 		cmds.BoolOption(LocalOption, "L", "Run the command locally, instead of using the daemon. DEPRECATED: use --offline."),
 		cmds.BoolOption(OfflineOption, "Run the command offline."),
 		cmds.StringOption(ApiOption, "Use a specific API instance (defaults to /ip4/127.0.0.1/tcp/5001)"),
+		cmds.StringOption(ApiAuthOption, "Secret of the API authorization to use with the daemon."),
 
 		// global options, added to every command
 		cmdenv.OptionCidBase,
@@ -118,6 +125,8 @@ var CommandsDaemonCmd = CommandsCmd(Root)
 
 var rootSubcommands = map[string]*cmds.Command{
 	"add":       AddCmd,
+	"archive":   ArchiveCmd,
+	"auth":      AuthCmd,
 	"bitswap":   BitswapCmd,
 	"block":     BlockCmd,
 	"cat":       CatCmd,
@@ -133,22 +142,26 @@ var rootSubcommands = map[string]*cmds.Command{
 	"dag":       dag.DagCmd,
 	"dht":       DhtCmd,
 	"diag":      DiagCmd,
+	"diff":      DiffCmd,
 	"dns":       DNSCmd,
 	"id":        IDCmd,
 	"key":       KeyCmd,
 	"log":       LogCmd,
+	"lowpower":  LowPowerCmd,
 	"ls":        LsCmd,
 	"mount":     MountCmd,
 	"name":      name.NameCmd,
 	"object":    ocmd.ObjectCmd,
 	"pin":       pin.PinCmd,
 	"ping":      PingCmd,
+	"provide":   ProvideCmd,
 	"p2p":       P2PCmd,
 	"refs":      RefsCmd,
 	"resolve":   ResolveCmd,
 	"swarm":     SwarmCmd,
 	"tar":       TarCmd,
 	"file":      unixfs.UnixFSCmd,
+	"unixfs":    unixfs.PatchCmd,
 	"update":    ExternalBinary("Please see https://git.io/fjylH for installation instructions."),
 	"urlstore":  urlStoreCmd,
 	"version":   VersionCmd,
@@ -195,10 +208,12 @@ var rootROSubcommands = map[string]*cmds.Command{
 	},
 	"dag": {
 		Subcommands: map[string]*cmds.Command{
-			"get":     dag.DagGetCmd,
-			"resolve": dag.DagResolveCmd,
-			"stat":    dag.DagStatCmd,
-			"export":  dag.DagExportCmd,
+			"get":      dag.DagGetCmd,
+			"resolve":  dag.DagResolveCmd,
+			"stat":     dag.DagStatCmd,
+			"export":   dag.DagExportCmd,
+			"diff":     dag.DagDiffCmd,
+			"progress": dag.DagProgressCmd,
 		},
 	},
 	"resolve": ResolveCmd,
@@ -224,6 +239,8 @@ func init() {
 
 	Root.Subcommands = rootSubcommands
 	RootRO.Subcommands = rootROSubcommands
+
+	withErrorKinds(Root, RootRO)
 }
 
 type MessageOutput struct {
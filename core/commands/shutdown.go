@@ -1,13 +1,50 @@
 package commands
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
 )
 
+const (
+	shutdownDrainOptionName        = "drain"
+	shutdownDrainTimeoutOptionName = "drain-timeout"
+
+	defaultShutdownDrainTimeout = time.Minute
+)
+
+// ShutdownOutput reports what happened to the work in flight when the daemon
+// was drained before shutting down.
+type ShutdownOutput struct {
+	// InFlight is the number of pieces of work in flight when draining
+	// started.
+	InFlight int
+	// Aborted describes the work that was still in flight after the drain
+	// timeout.
+	Aborted []string
+}
+
 var daemonShutdownCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Shut down the IPFS daemon.",
+		ShortDescription: `
+Shuts down the IPFS daemon.
+
+With --drain, the daemon first waits for the commands changing the repo,
+such as adds, pins and MFS changes, and the gateway transfers in flight to
+complete, for up to --drain-timeout, while declining new ones with
+'503 Service Unavailable'. It then flushes MFS and
+reports the work that was still in flight, which gets aborted by the
+shutdown.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(shutdownDrainOptionName, "Wait for the work in flight to complete before shutting down."),
+		cmds.StringOption(shutdownDrainTimeoutOptionName, "Maximum time to wait for the work in flight.").WithDefault(defaultShutdownDrainTimeout.String()),
 	},
 	Run: func(req *cmds.Request, re cmds.ResponseEmitter, env cmds.Environment) error {
 		nd, err := cmdenv.GetNode(env)
@@ -19,10 +56,40 @@ var daemonShutdownCmd = &cmds.Command{
 			return cmds.Errorf(cmds.ErrClient, "daemon not running")
 		}
 
+		if drain, _ := req.Options[shutdownDrainOptionName].(bool); drain {
+			timeout, err := time.ParseDuration(req.Options[shutdownDrainTimeoutOptionName].(string))
+			if err != nil {
+				return fmt.Errorf("invalid drain timeout: %w", err)
+			}
+
+			ctx, cancel := context.WithTimeout(req.Context, timeout)
+			inFlight, aborted := nd.Drainer().Drain(ctx)
+			cancel()
+
+			if err := nd.FilesRoot.Flush(); err != nil {
+				log.Error("error while flushing MFS:", err)
+			}
+
+			// the response must be sent before the API server stops
+			if err := cmds.EmitOnce(re, &ShutdownOutput{InFlight: inFlight, Aborted: aborted}); err != nil {
+				log.Error("error while reporting the drained work:", err)
+			}
+		}
+
 		if err := nd.Close(); err != nil {
 			log.Error("error while shutting down ipfs daemon:", err)
 		}
 
 		return nil
 	},
+	Type: ShutdownOutput{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *ShutdownOutput) error {
+			fmt.Fprintf(w, "drained %d of %d requests in flight\n", out.InFlight-len(out.Aborted), out.InFlight)
+			for _, a := range out.Aborted {
+				fmt.Fprintf(w, "aborted: %s\n", a)
+			}
+			return nil
+		}),
+	},
 }
@@ -26,11 +26,16 @@ for your IPFS node.`,
 	},
 
 	Subcommands: map[string]*cmds.Command{
-		"bw":      statBwCmd,
-		"repo":    repoStatCmd,
-		"bitswap": bitswapStatCmd,
-		"dht":     statDhtCmd,
-		"provide": statProvideCmd,
+		"bw":            statBwCmd,
+		"repo":          repoStatCmd,
+		"bitswap":       bitswapStatCmd,
+		"dht":           statDhtCmd,
+		"provide":       statProvideCmd,
+		"memory":        statMemoryCmd,
+		"tenants":       statTenantsCmd,
+		"publish-queue": statPublishQueueCmd,
+		"fetch":         statFetchCmd,
+		"demand":        statDemandCmd,
 	},
 }
 
@@ -76,6 +81,10 @@ Example:
     TotalOut: 12MB
     RateIn: 0B/s
     RateOut: 0B/s
+
+The bandwidth used in each interval of the last hour, by protocol or by peer,
+is printed by 'ipfs stats bw history', and the blocks bitswap exchanged with
+each peer by 'ipfs stats bw bitswap'.
 `,
 	},
 	Options: []cmds.Option{
@@ -153,6 +162,10 @@ Example:
 			}
 		}
 	},
+	Subcommands: map[string]*cmds.Command{
+		"history": statBwHistoryCmd,
+		"bitswap": statBwBitswapCmd,
+	},
 	Type: metrics.Stats{},
 	PostRun: cmds.PostRunMap{
 		cmds.CLI: func(res cmds.Response, re cmds.ResponseEmitter) error {
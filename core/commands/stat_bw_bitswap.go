@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// BwBitswapPeer is what bitswap exchanged with a peer, output by
+// "stats bw bitswap".
+type BwBitswapPeer struct {
+	Peer              string
+	BlocksReceived    uint64
+	BlocksSent        uint64
+	DataReceived      uint64
+	DataSent          uint64
+	DupBlocksReceived uint64
+	OutstandingWants  int
+	// Latency is the average time the peer took to answer the wants, in
+	// seconds
+	Latency float64
+	Updated time.Time
+}
+
+// StatBwBitswapOutput is the output of "stats bw bitswap"
+type StatBwBitswapOutput struct {
+	Peers []BwBitswapPeer
+}
+
+var statBwBitswapCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the blocks bitswap exchanged with each peer.",
+		ShortDescription: `
+'ipfs stats bw bitswap' prints, for each peer bitswap exchanged with, the
+blocks received from and sent to it, how many of the blocks received were
+duplicates, the wants sent to it not answered yet, and the average time it
+took to answer the others.
+`,
+		LongDescription: `
+'ipfs stats bw bitswap' prints, for each peer bitswap exchanged with, the
+blocks received from and sent to it, how many of the blocks received were
+duplicates, the wants sent to it not answered yet, and the average time it
+took to answer the others, the peers sending the most data first.
+
+A block received is a duplicate when a copy of it was received from any peer
+in the last minute. A want is outstanding until the peer answers it, it is
+cancelled, or it times out after a minute or two. The latency is a moving
+average of the time between the wants sent and their blocks, or HAVEs, the
+one of the provider stats (see Internal.Bitswap.ProviderStats), which are
+kept across restarts when enabled. The other stats of the last 4096 peers
+bitswap exchanged with are kept since the daemon started.
+
+The latency of all the answers and the number of outstanding wants are also
+exported as the metrics ipfs_bitswap_want_latency_seconds and
+ipfs_bitswap_outstanding_wants. The running bitswap sessions are listed by
+'ipfs bitswap sessions'.
+
+Example:
+
+    > ipfs stats bw bitswap --top=2
+    Peer                                                  Received      Sent         Dup  Wants  Latency
+    12D3KooWPhzfnGmTbByydRoddVX4ofNCWWZHcZUcgTXqdCxuUE1A  213 (51 MB)   0 (0 B)      4    0      120ms
+    QmepgFW7BHEtU4pZJdxaNiv75mKLLRQnPi1KaaXmQN4V1a        17 (4.1 MB)   3 (12 kB)    0    2      450ms
+`,
+	},
+	Options: []cmds.Option{
+		// --peer is the option of 'ipfs stats bw'
+		cmds.IntOption(statTopOptionName, "Only print the peers sending the most data."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		capi, ok := api.(*coreapi.CoreAPI)
+		if !ok {
+			return errors.New("bitswap stats are not supported by this node")
+		}
+
+		var ps []peer.ID
+		if pstr, ok := req.Options[statPeerOptionName].(string); ok {
+			pid, err := peer.Decode(pstr)
+			if err != nil {
+				return err
+			}
+			ps = append(ps, pid)
+		}
+		top, topFound := req.Options[statTopOptionName].(int)
+		if topFound && top <= 0 {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be positive", statTopOptionName)
+		}
+
+		stats, err := capi.BitswapPeers(req.Context, ps...)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].DataReceived > stats[j].DataReceived
+		})
+		if topFound && len(stats) > top {
+			stats = stats[:top]
+		}
+		out := &StatBwBitswapOutput{Peers: make([]BwBitswapPeer, 0, len(stats))}
+		for _, st := range stats {
+			out.Peers = append(out.Peers, BwBitswapPeer{
+				Peer:              st.Peer.String(),
+				BlocksReceived:    st.BlocksReceived,
+				BlocksSent:        st.BlocksSent,
+				DataReceived:      st.DataReceived,
+				DataSent:          st.DataSent,
+				DupBlocksReceived: st.DupBlocksReceived,
+				OutstandingWants:  st.OutstandingWants,
+				Latency:           st.Latency.Seconds(),
+				Updated:           st.Updated,
+			})
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatBwBitswapOutput) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintln(wtr, "Peer\tReceived\tSent\tDup\tWants\tLatency")
+			for _, p := range out.Peers {
+				fmt.Fprintf(wtr, "%s\t%d (%s)\t%d (%s)\t%d\t%d\t%s\n", p.Peer,
+					p.BlocksReceived, humanize.Bytes(p.DataReceived),
+					p.BlocksSent, humanize.Bytes(p.DataSent),
+					p.DupBlocksReceived, p.OutstandingWants,
+					time.Duration(p.Latency*float64(time.Second)).Round(time.Millisecond))
+			}
+			return nil
+		}),
+	},
+	Type: StatBwBitswapOutput{},
+}
@@ -0,0 +1,256 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/bwhistory"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+)
+
+const (
+	statSinceOptionName     = "since"
+	statByOptionName        = "by"
+	statDirectionOptionName = "direction"
+	statTopOptionName       = "top"
+)
+
+// BwHistorySample is the traffic of an interval, output by "stats bw history".
+// Key is the protocol or peer of the traffic when broken down by either.
+type BwHistorySample struct {
+	Time    time.Time
+	Key     string `json:",omitempty"`
+	In      int64
+	Out     int64
+	RateIn  float64
+	RateOut float64
+}
+
+// StatBwHistoryOutput is the output of "stats bw history"
+type StatBwHistoryOutput struct {
+	// Direction is "in" or "out" when only that direction is shown
+	Direction string `json:",omitempty"`
+	By        string `json:",omitempty"`
+	Samples   []BwHistorySample
+}
+
+var statBwHistoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Print the recent history of the bandwidth.",
+		ShortDescription: `
+'ipfs stats bw history' prints the bytes received and sent by the daemon in
+each interval of Swarm.BandwidthHistory, in total, by protocol or by peer.
+`,
+		LongDescription: `
+'ipfs stats bw history' prints the bytes received and sent by the daemon in
+each interval of Swarm.BandwidthHistory, in total, by protocol or by peer.
+It tells what used the bandwidth in the last minutes, while 'ipfs stats bw'
+gives the totals since the start and the current rates.
+
+The samples are kept for Swarm.BandwidthHistory.Retention, an hour by default.
+Each sample only keeps the Swarm.BandwidthHistory.MaxPeers peers with the most
+traffic in its interval.
+
+Use --by to break the traffic down by protocol or by peer, and --top to only
+show the protocols or peers with the most traffic over the samples shown.
+Use --proto or --peer to only show the traffic of a protocol or peer, and
+--direction to only show the traffic received or sent.
+
+Example:
+
+    > ipfs stats bw history --since=1m --by=protocol --top=2 --direction=out
+    Time      Protocol         Out
+    12:01:10  /ipfs/bitswap    1.2 MB/s
+    12:01:10  /ipfs/kad/1.0.0  3.1 kB/s
+    12:01:20  /ipfs/bitswap    950 kB/s
+    ...
+`,
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(statSinceOptionName, "s", "Only print the samples of the last period, such as '5m'."),
+		cmds.StringOption(statByOptionName, "Break the traffic down by 'protocol' or 'peer'."),
+		// --proto and --peer are the options of 'ipfs stats bw'
+		cmds.StringOption(statDirectionOptionName, "Only print the traffic received ('in') or sent ('out')."),
+		cmds.IntOption(statTopOptionName, "Only print the protocols or peers with the most traffic."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !nd.IsOnline {
+			return cmds.Errorf(cmds.ErrClient, ErrNotOnline.Error())
+		}
+		if nd.BandwidthHistory == nil {
+			return errors.New("bandwidth reporter disabled in config")
+		}
+
+		var since time.Time
+		if s, ok := req.Options[statSinceOptionName].(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return cmds.Errorf(cmds.ErrClient, "invalid --%s: %s", statSinceOptionName, err)
+			}
+			since = time.Now().Add(-d)
+		}
+
+		by, _ := req.Options[statByOptionName].(string)
+		proto, protoFound := req.Options[statProtoOptionName].(string)
+		pstr, peerFound := req.Options[statPeerOptionName].(string)
+		var pid peer.ID
+		switch {
+		case protoFound && peerFound:
+			return cmds.Errorf(cmds.ErrClient, "please only specify peer OR protocol")
+		case protoFound:
+			by = "protocol"
+		case peerFound:
+			pid, err = peer.Decode(pstr)
+			if err != nil {
+				return err
+			}
+			by = "peer"
+		}
+		switch by {
+		case "", "protocol", "peer":
+		default:
+			return cmds.Errorf(cmds.ErrClient, "--%s must be 'protocol' or 'peer'", statByOptionName)
+		}
+
+		direction, _ := req.Options[statDirectionOptionName].(string)
+		switch direction {
+		case "", "in", "out":
+		default:
+			return cmds.Errorf(cmds.ErrClient, "--%s must be 'in' or 'out'", statDirectionOptionName)
+		}
+		top, topFound := req.Options[statTopOptionName].(int)
+		if topFound && (by == "" || top <= 0) {
+			return cmds.Errorf(cmds.ErrClient, "--%s must be positive, and used with --%s", statTopOptionName, statByOptionName)
+		}
+
+		// the traffic of each sample by key, in the breakdown asked for
+		samples := nd.BandwidthHistory.Samples(since)
+		traffic := make([]map[string]bwhistory.Traffic, len(samples))
+		for i, s := range samples {
+			m := make(map[string]bwhistory.Traffic)
+			switch {
+			case protoFound:
+				if t, ok := s.Protocols[protocol.ID(proto)]; ok {
+					m[proto] = t
+				}
+			case peerFound:
+				if t, ok := s.Peers[pid]; ok {
+					m[pid.String()] = t
+				}
+			case by == "protocol":
+				for p, t := range s.Protocols {
+					m[string(p)] = t
+				}
+			case by == "peer":
+				for p, t := range s.Peers {
+					m[p.String()] = t
+				}
+			default:
+				m[""] = s.Total
+			}
+			traffic[i] = m
+		}
+
+		// the traffic of the keys over all the samples, in the direction
+		// shown, ranks them
+		sum := make(map[string]int64)
+		for _, m := range traffic {
+			for k, t := range m {
+				sum[k] += directionBytes(t, direction)
+			}
+		}
+		keys := make([]string, 0, len(sum))
+		for k := range sum {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if sum[keys[i]] != sum[keys[j]] {
+				return sum[keys[i]] > sum[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		if topFound && len(keys) > top {
+			keys = keys[:top]
+		}
+
+		out := &StatBwHistoryOutput{Direction: direction, By: by, Samples: []BwHistorySample{}}
+		for i, s := range samples {
+			secs := s.Interval.Seconds()
+			for _, k := range keys {
+				t, ok := traffic[i][k]
+				if !ok {
+					continue
+				}
+				out.Samples = append(out.Samples, BwHistorySample{
+					Time:    s.Time,
+					Key:     k,
+					In:      t.In,
+					Out:     t.Out,
+					RateIn:  float64(t.In) / secs,
+					RateOut: float64(t.Out) / secs,
+				})
+			}
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatBwHistoryOutput) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 2, ' ', 0)
+			defer wtr.Flush()
+
+			header := "Time"
+			switch out.By {
+			case "protocol":
+				header += "\tProtocol"
+			case "peer":
+				header += "\tPeer"
+			}
+			if out.Direction != "out" {
+				header += "\tIn"
+			}
+			if out.Direction != "in" {
+				header += "\tOut"
+			}
+			fmt.Fprintln(wtr, header)
+
+			for _, s := range out.Samples {
+				line := s.Time.Local().Format("15:04:05")
+				if out.By != "" {
+					line += "\t" + s.Key
+				}
+				if out.Direction != "out" {
+					line += "\t" + humanize.Bytes(uint64(s.RateIn)) + "/s"
+				}
+				if out.Direction != "in" {
+					line += "\t" + humanize.Bytes(uint64(s.RateOut)) + "/s"
+				}
+				fmt.Fprintln(wtr, line)
+			}
+			return nil
+		}),
+	},
+	Type: StatBwHistoryOutput{},
+}
+
+// directionBytes returns the bytes of t in direction, both when empty.
+func directionBytes(t bwhistory.Traffic, direction string) int64 {
+	switch direction {
+	case "in":
+		return t.In
+	case "out":
+		return t.Out
+	}
+	return t.In + t.Out
+}
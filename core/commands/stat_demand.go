@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+)
+
+const (
+	statDemandMinRequestsOptionName = "min-requests"
+	statDemandCountOptionName       = "count"
+)
+
+// KeyDemand is the demand of a key, output by "stats demand"
+type KeyDemand struct {
+	Key      string
+	Requests uint64
+	Since    time.Time
+	Last     time.Time
+}
+
+// StatDemandOutput is the output of "stats demand"
+type StatDemandOutput struct {
+	Keys []KeyDemand
+}
+
+var statDemandCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Returns the keys the peers requested over bitswap.",
+		ShortDescription: `
+Returns the keys the peers requested in the last Reprovider.Demand.Window,
+the most requested first, with the number of requests in their current window,
+when it started, and the last request.
+
+The requests are tracked when Reprovider.Strategy includes "demand", which
+reprovides the keys in demand along with the roots of the pins, and reprovides
+the keys requested at least Reprovider.Demand.HotRequests times in their window
+every Reprovider.Demand.HotInterval.
+
+This interface is not stable and may change from release to release.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.Uint64Option(statDemandMinRequestsOptionName, "Only list the keys requested at least this many times in their window."),
+		cmds.IntOption(statDemandCountOptionName, "n", "Only list this many keys, the most requested.").WithDefault(100),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.Demand == nil {
+			return errors.New("the requests are not tracked, see the \"demand\" strategy of Reprovider.Strategy")
+		}
+		enc, err := cmdenv.GetCidEncoder(req)
+		if err != nil {
+			return err
+		}
+
+		min, _ := req.Options[statDemandMinRequestsOptionName].(uint64)
+		count, _ := req.Options[statDemandCountOptionName].(int)
+		if count < 0 {
+			return fmt.Errorf("--%s must not be negative", statDemandCountOptionName)
+		}
+		stats := nd.Demand.InDemand(min)
+		if count > 0 && len(stats) > count {
+			stats = stats[:count]
+		}
+		out := &StatDemandOutput{Keys: make([]KeyDemand, 0, len(stats))}
+		for _, st := range stats {
+			out.Keys = append(out.Keys, KeyDemand{
+				Key:      enc.Encode(st.Key),
+				Requests: st.Requests,
+				Since:    st.Since,
+				Last:     st.Last,
+			})
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatDemandOutput) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintln(wtr, "Key\tRequests\tSince\tLast")
+			for _, k := range out.Keys {
+				fmt.Fprintf(wtr, "%s\t%d\t%s\t%s\n", k.Key, k.Requests, k.Since.Format(time.RFC3339), k.Last.Format(time.RFC3339))
+			}
+			return nil
+		}),
+	},
+	Type: StatDemandOutput{},
+}
@@ -3,10 +3,13 @@ package commands
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	"github.com/libp2p/go-libp2p-core/network"
@@ -25,10 +28,32 @@ type dhtPeerInfo struct {
 }
 
 type dhtStat struct {
-	Name    string
-	Buckets []dhtBucket
+	Name string
+	// Mode is "server" if the DHT answers the queries of other peers, else
+	// "client".
+	Mode string
+	// Served counts the requests served since the node started, by message
+	// type.
+	Served map[string]int64 `json:",omitempty"`
+	Health dhtHealth
+	// ProviderRecords are the provider records held in the datastore the
+	// DHTs share, set on the first DHT only.
+	ProviderRecords *int `json:",omitempty"`
+	Buckets         []dhtBucket
 }
 
+type dhtHealth struct {
+	// ConnectedPeers are the peers of the routing table the node is
+	// connected to.
+	ConnectedPeers int
+	// StaleBuckets are the buckets not refreshed within dhtStaleBucketAge.
+	StaleBuckets int
+}
+
+// dhtStaleBucketAge is when a bucket is stale: it missed three refreshes of
+// the DHT, which refreshes its buckets every 10 minutes.
+const dhtStaleBucketAge = 30 * time.Minute
+
 type dhtBucket struct {
 	LastRefresh string
 	Peers       []dhtPeerInfo
@@ -38,7 +63,16 @@ var statDhtCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Returns statistics about the node's DHT(s).",
 		ShortDescription: `
-Returns statistics about the DHT(s) the node is participating in.
+Returns statistics about the DHT(s) the node is participating in: their
+mode, the requests they served by type, the provider records they hold, and
+their routing tables with the health of the buckets.
+
+A DHT in server mode answers the queries of other peers. In the default
+"auto" mode of Routing.Type "dht", the node switches to server mode once it
+is publicly reachable; Routing.WANMode and Routing.LANMode force the mode of
+each DHT.
+
+A bucket is stale if it was not refreshed in the last 30 minutes.
 
 This interface is not stable and may change from release to release.
 `,
@@ -69,9 +103,21 @@ This interface is not stable and may change from release to release.
 			dhts = []string{"wan", "lan"}
 		}
 
+		providers, err := libp2p.CountDHTProviders(req.Context, nd.Repo.Datastore())
+		if err != nil {
+			return err
+		}
+		// set on the first DHT only
+		first := &providers
+		emit := func(st dhtStat) error {
+			st.ProviderRecords, first = first, nil
+			return res.Emit(st)
+		}
+
 	dhttypeloop:
 		for _, name := range dhts {
 			var dht *dht.IpfsDHT
+			lan := false
 
 			var separateClient bool
 			if nd.DHTClient != nd.DHT {
@@ -107,9 +153,14 @@ This interface is not stable and may change from release to release.
 						b.Peers = append(b.Peers, info)
 					}
 					buckets[0] = *b
+					// the table is refreshed as a whole, not by bucket
+					health := bucketsHealth(buckets)
+					health.StaleBuckets = 0
 
-					if err := res.Emit(dhtStat{
+					if err := emit(dhtStat{
 						Name:    name,
+						Mode:    "client",
+						Health:  health,
 						Buckets: buckets,
 					}); err != nil {
 						return err
@@ -126,6 +177,7 @@ This interface is not stable and may change from release to release.
 				fallthrough
 			case "lanserver":
 				dht = nd.DHT.LAN
+				lan = true
 			default:
 				return cmds.Errorf(cmds.ErrClient, "unknown dht type: %s", name)
 			}
@@ -171,8 +223,19 @@ This interface is not stable and may change from release to release.
 					buckets[i].LastRefresh = refreshTime.Format(time.RFC3339)
 				}
 			}
-			if err := res.Emit(dhtStat{
+			served, err := libp2p.DHTServed(dht)
+			if err != nil {
+				return err
+			}
+			mode := "client"
+			if libp2p.DHTServing(nd.PeerHost, lan) {
+				mode = "server"
+			}
+			if err := emit(dhtStat{
 				Name:    name,
+				Mode:    mode,
+				Served:  served,
+				Health:  bucketsHealth(buckets),
 				Buckets: buckets,
 			}); err != nil {
 				return err
@@ -198,7 +261,25 @@ This interface is not stable and may change from release to release.
 				count += len(bucket.Peers)
 			}
 
-			fmt.Fprintf(tw, "DHT %s (%d peers):\t\t\t\n", out.Name, count)
+			if out.ProviderRecords != nil {
+				fmt.Fprintf(tw, "Provider records: %d\t\t\t\n", *out.ProviderRecords)
+				fmt.Fprintln(tw, "\t\t\t")
+			}
+
+			fmt.Fprintf(tw, "DHT %s (%d peers, %s mode):\t\t\t\n", out.Name, count, out.Mode)
+			fmt.Fprintf(tw, "  %d connected peers, %d stale buckets\t\t\t\n", out.Health.ConnectedPeers, out.Health.StaleBuckets)
+			if len(out.Served) > 0 {
+				types := make([]string, 0, len(out.Served))
+				for t := range out.Served {
+					types = append(types, t)
+				}
+				sort.Strings(types)
+				served := make([]string, 0, len(types))
+				for _, t := range types {
+					served = append(served, fmt.Sprintf("%s=%d", t, out.Served[t]))
+				}
+				fmt.Fprintf(tw, "  Served: %s\t\t\t\n", strings.Join(served, " "))
+			}
 
 			for i, bucket := range out.Buckets {
 				lastRefresh := "never"
@@ -244,3 +325,18 @@ This interface is not stable and may change from release to release.
 	},
 	Type: dhtStat{},
 }
+
+func bucketsHealth(buckets []dhtBucket) dhtHealth {
+	var h dhtHealth
+	for _, b := range buckets {
+		for _, p := range b.Peers {
+			if p.Connected {
+				h.ConnectedPeers++
+			}
+		}
+		if t, err := time.Parse(time.RFC3339, b.LastRefresh); err != nil || time.Since(t) > dhtStaleBucketAge {
+			h.StaleBuckets++
+		}
+	}
+	return h
+}
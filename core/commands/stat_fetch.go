@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/fetchprogress"
+)
+
+// fetchProgressInterval is the interval at which the progress of a fetch is
+// sent.
+const fetchProgressInterval = time.Second
+
+var statFetchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the progress of a fetch tracked by name.",
+		ShortDescription: `
+'ipfs stats fetch' streams the progress of the fetch tracked under the given
+name by 'ipfs get --track', every --interval until it is done.
+`,
+		LongDescription: `
+'ipfs stats fetch' streams the progress of the fetch tracked under the given
+name by 'ipfs get --track', every --interval until it is done:
+
+  Blocks        number of blocks got, and Bytes their size
+  Known         number of blocks known so far: the roots, and the links of
+                the blocks got
+  Fetched       among the blocks got, the blocks fetched from the network,
+                and FetchedBytes their size
+  Rate          bytes fetched per second
+  Providers     the blocks, bytes, and bytes per second received from each
+                peer, when the bitswap stats are recorded
+  Elapsed       seconds since the fetch started
+  ETA           seconds left to get the blocks known, at the pace so far
+  Done          whether the fetch is done
+
+The blocks are counted once verified against their CID. As the blocks known
+grow while the DAG is walked, the ETA is a lower bound until all of them are
+known. The progress of the last fetches done is kept, so the command can be
+started after the fetch.
+
+'ipfs refs -r --progress' streams the same progress along with the refs.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("name", true, false, "Name the fetch is tracked under."),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(statIntervalOptionName, "Time between the progress reports.").WithDefault("1s"),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		interval, err := time.ParseDuration(req.Options[statIntervalOptionName].(string))
+		if err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return fmt.Errorf("--%s must be positive", statIntervalOptionName)
+		}
+		t, ok := nd.FetchProgress.Get(req.Arguments[0])
+		if !ok {
+			return fmt.Errorf("no fetch tracked as %q", req.Arguments[0])
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ev := t.Progress()
+			if err := res.Emit(&ev); err != nil || ev.Done {
+				return err
+			}
+			select {
+			case <-ticker.C:
+			case <-req.Context.Done():
+				return req.Context.Err()
+			}
+		}
+	},
+	Type: fetchprogress.Event{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, ev *fetchprogress.Event) error {
+			_, err := fmt.Fprintln(w, formatFetchProgress(ev))
+			return err
+		}),
+	},
+}
+
+// formatFetchProgress returns the progress of a fetch on a line.
+func formatFetchProgress(ev *fetchprogress.Event) string {
+	s := fmt.Sprintf("%d/%d blocks (%s), %d fetched (%s, %s/s)", ev.Blocks, ev.Known,
+		humanize.Bytes(ev.Bytes), ev.Fetched, humanize.Bytes(ev.FetchedBytes), humanize.Bytes(uint64(ev.Rate)))
+	if len(ev.Providers) > 0 {
+		s += fmt.Sprintf(" from %d peers", len(ev.Providers))
+	}
+	if ev.Done {
+		return s + fmt.Sprintf(", done in %s", secondsDuration(ev.Elapsed))
+	}
+	if ev.ETA > 0 {
+		s += fmt.Sprintf(", at least %s left", secondsDuration(ev.ETA))
+	}
+	return s
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
+
+// newFetchTracker returns a tracker of a fetch by n, telling the providers of
+// the blocks if the bitswap stats are recorded.
+func newFetchTracker(n *core.IpfsNode) *fetchprogress.Tracker {
+	var senders fetchprogress.Senders
+	if n.BitswapStats != nil {
+		senders = n.BitswapStats
+	}
+	return fetchprogress.New(n.Blockstore, senders)
+}
+
+// emitFetchProgress emits the progress of t, made by wrap, to res every
+// fetchProgressInterval, until the returned function is called, which emits
+// the final progress once t is marked done.
+func emitFetchProgress(ctx context.Context, res *lockedEmitter, t *fetchprogress.Tracker, wrap func(*fetchprogress.Event) interface{}) func() error {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(fetchProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				ev := t.Progress()
+				// an emit failing means the client is gone, the fetch
+				// stops with the context
+				_ = res.Emit(wrap(&ev))
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(stop)
+		wg.Wait()
+		t.Done()
+		ev := t.Progress()
+		return res.Emit(wrap(&ev))
+	}
+}
+
+// lockedEmitter lets more than one goroutine emit to a response.
+type lockedEmitter struct {
+	cmds.ResponseEmitter
+	mu sync.Mutex
+}
+
+func (e *lockedEmitter) Emit(v interface{}) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.ResponseEmitter.Emit(v)
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/membudget"
+)
+
+var statMemoryCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Returns statistics about the node's memory budget.",
+		ShortDescription: `
+Returns the memory used by the node against the budget set in
+MemoryBudget.Limit, and how much load was shed to stay within it.
+
+When the usage gets close to the budget, the node is under pressure: bitswap
+sessions are shed, caches are emptied, and API and gateway requests are held
+back for up to MemoryBudget.MaxWait, then declined.
+
+This interface is not stable and may change from release to release.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if nd.MemoryBudget == nil {
+			return errors.New("no memory budget, see MemoryBudget.Limit")
+		}
+		return cmds.EmitOnce(res, nd.MemoryBudget.Usage())
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, u *membudget.Usage) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintf(wtr, "Limit:\t%s\n", humanize.Bytes(u.Limit))
+			fmt.Fprintf(wtr, "Used:\t%s\t(%.1f%%)\n", humanize.Bytes(u.Used), 100*float64(u.Used)/float64(u.Limit))
+			fmt.Fprintf(wtr, "UnderPressure:\t%t\n", u.UnderPressure)
+			fmt.Fprintf(wtr, "Pressures:\t%d\n", u.Pressures)
+			fmt.Fprintf(wtr, "SessionsShed:\t%d\n", u.SessionsShed)
+			fmt.Fprintf(wtr, "RequestsDelayed:\t%d\n", u.RequestsDelayed)
+			fmt.Fprintf(wtr, "RequestsRejected:\t%d\n", u.RequestsRejected)
+			return nil
+		}),
+	},
+	Type: membudget.Usage{},
+}
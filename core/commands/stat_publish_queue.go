@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/pubqueue"
+)
+
+var statPublishQueueCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Returns the state of the queue of the publishes made while unreachable.",
+		ShortDescription: `
+Returns the number of IPNS records and provides queued because the node was
+unreachable when they were published, when the oldest of them was queued, and
+the result of the last attempt at publishing them.
+
+The node is unreachable when it is not connected to any peer, or when the
+routing system finds no peer to publish to. The queue persists across
+restarts, and is published a few seconds after the node gets connected, then
+every minute while some entries remain. See Routing.PublishQueue.
+
+This interface is not stable and may change from release to release.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if !nd.IsOnline {
+			return ErrNotOnline
+		}
+		if nd.PublishQueue == nil {
+			return errors.New("the publish queue is not enabled, see Routing.PublishQueue")
+		}
+
+		st := nd.PublishQueue.Stat()
+		return res.Emit(&st)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, s *pubqueue.Stat) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintf(wtr, "Records:\t%s\n", humanNumber(s.Records))
+			fmt.Fprintf(wtr, "Provides:\t%s\n", humanNumber(s.Provides))
+			fmt.Fprintf(wtr, "Dropped:\t%d\n", s.Dropped)
+			if !s.Oldest.IsZero() {
+				fmt.Fprintf(wtr, "Oldest:\t%s\n", s.Oldest.Format(time.RFC3339))
+			}
+			if !s.LastFlush.IsZero() {
+				fmt.Fprintf(wtr, "LastFlush:\t%s\n", s.LastFlush.Format(time.RFC3339))
+			}
+			if s.LastError != "" {
+				fmt.Fprintf(wtr, "LastError:\t%s\n", s.LastError)
+			}
+			return nil
+		}),
+	},
+	Type: pubqueue.Stat{},
+}
@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	humanize "github.com/dustin/go-humanize"
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+)
+
+// TenantUsage is the usage of a tenant, output by "stats tenants"
+type TenantUsage struct {
+	Name        string
+	BytesStored uint64
+	BytesServed uint64
+	Pins        int64
+}
+
+// StatTenantsOutput is the output of "stats tenants"
+type StatTenantsOutput struct {
+	Tenants []TenantUsage
+}
+
+var statTenantsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Returns the resource usage of each API authorization.",
+		ShortDescription: `
+Returns, for each authorization of API.Authorizations, the bytes of the new
+blocks stored by its requests, the bytes served to it by the API and the
+gateway, and the number of pins it owns.
+
+Gateway requests are accounted to an authorization when they carry its secret
+in their Authorization header, as API requests do. A pin is owned by the
+authorization which added it, until it is removed. The stored bytes are not
+decreased by garbage collection.
+
+The same figures are exported to Prometheus, as ipfs_tenant_* metrics.
+
+This interface is not stable and may change from release to release.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		if nd.Tenants == nil {
+			return errors.New("no tenants, see API.Authorizations")
+		}
+		usage := nd.Tenants.Usage()
+		out := &StatTenantsOutput{Tenants: []TenantUsage{}}
+		for _, name := range nd.Tenants.Tenants() {
+			u := usage[name]
+			out.Tenants = append(out.Tenants, TenantUsage{
+				Name:        name,
+				BytesStored: u.BytesStored,
+				BytesServed: u.BytesServed,
+				Pins:        u.Pins,
+			})
+		}
+		return cmds.EmitOnce(res, out)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *StatTenantsOutput) error {
+			wtr := tabwriter.NewWriter(w, 1, 2, 1, ' ', 0)
+			defer wtr.Flush()
+
+			fmt.Fprintln(wtr, "Tenant\tStored\tServed\tPins")
+			for _, t := range out.Tenants {
+				fmt.Fprintf(wtr, "%s\t%s\t%s\t%d\n", t.Name, humanize.Bytes(t.BytesStored), humanize.Bytes(t.BytesServed), t.Pins)
+			}
+			return nil
+		}),
+	},
+	Type: StatTenantsOutput{},
+}
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"path"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,10 +23,13 @@ import (
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/libp2p/go-libp2p-core/host"
 	inet "github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	manet "github.com/multiformats/go-multiaddr/net"
 	mamask "github.com/whyrusleeping/multiaddr-filter"
 )
 
@@ -53,11 +58,13 @@ ipfs peers in the internet.
 		"addrs":      swarmAddrsCmd,
 		"connect":    swarmConnectCmd,
 		"disconnect": swarmDisconnectCmd,
+		"events":     swarmEventsCmd,
 		"filters":    swarmFiltersCmd,
 		"peers":      swarmPeersCmd,
 		"peering":    swarmPeeringCmd,
 		"stats":      swarmStatsCmd, // libp2p Network Resource Manager
 		"limit":      swarmLimitCmd, // libp2p Network Resource Manager
+		"tag":        swarmTagCmd,
 	},
 }
 
@@ -371,6 +378,7 @@ The scope can be one of the following:
 - svc:<service> -- limits for the resource usage of a specific service.
 - proto:<proto> -- limits for the resource usage of a specific protocol.
 - peer:<peer>   -- limits for the resource usage of a specific peer.
+- tag:<tag>     -- policy of the peers tagged with 'ipfs swarm tag'.
 
 The output of this command is JSON.
 
@@ -382,12 +390,22 @@ It is possible to use this command to inspect and tweak limits at runtime:
 
 Changes made via command line are discarded on node shutdown.
 For permanent limits set Swarm.ResourceMgr.Limits in the $IPFS_PATH/config file.
+
+The policy of a tag is persisted in Swarm.ConnMgr.Tags of the config:
+
+	$ echo '{"Protected": true, "MaxConns": 20, "MaxBandwidth": "10MB"}' > policy.json
+	$ ipfs swarm limit tag:cluster policy.json
 `},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("scope", true, false, "scope of the limit"),
 		cmds.FileArg("limit.json", false, false, "limits to be set").EnableStdin(),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		scope := req.Arguments[0]
+		if strings.HasPrefix(scope, config.ConnMgrTagScopePrefix) {
+			return swarmTagLimit(req, res, env, strings.TrimPrefix(scope, config.ConnMgrTagScopePrefix))
+		}
+
 		node, err := cmdenv.GetNode(env)
 		if err != nil {
 			return err
@@ -397,8 +415,6 @@ For permanent limits set Swarm.ResourceMgr.Limits in the $IPFS_PATH/config file.
 			return libp2p.NoResourceMgrError
 		}
 
-		scope := req.Arguments[0]
-
 		//  set scope limit to new values (when limit.json is passed as a second arg)
 		if req.Files != nil {
 			var newLimit config.ResourceMgrScopeConfig
@@ -631,11 +647,33 @@ var swarmConnectCmd = &cmds.Command{
 The address format is an IPFS multiaddr:
 
 ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+`,
+		LongDescription: `
+'ipfs swarm connect' opens a new direct connection to a peer address.
+
+The address format is an IPFS multiaddr:
+
+ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ
+
+The peer is first dialed directly, on the addresses which are not relayed.
+If this fails and the peer has relayed (/p2p-circuit) addresses, it is dialed
+through relays, and when Swarm.EnableHolePunching is set, the relayed
+connection is given a few seconds to be upgraded to a direct one by hole
+punching. With --verbose, the output tells which of the three succeeded, with
+the time each attempt took:
+
+  connect QmaCpDMGvV2BGHeYERUEnRQAwe3N8SzbUtfsmvsqQLuvuJ success via relay (direct dial: failed in 5.002s: ...; relay: 312ms; hole punching: failed in 10s: no direct connection)
+
+With --direct-only, relays are not used.
 `,
 	},
 	Arguments: []cmds.Argument{
 		cmds.StringArg("address", true, true, "Address of peer to connect to.").EnableStdin(),
 	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmDirectOnlyOptionName, "Only dial the peer directly, not through relays."),
+		cmds.BoolOption(swarmVerboseOptionName, "v", "Show how the peer was connected, and the time each attempt took."),
+	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		node, err := cmdenv.GetNode(env)
 		if err != nil {
@@ -647,6 +685,18 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N
 			return err
 		}
 
+		if !node.IsOnline {
+			return ErrNotOnline
+		}
+
+		cfg, err := node.Repo.Config()
+		if err != nil {
+			return err
+		}
+		directOnly, _ := req.Options[swarmDirectOnlyOptionName].(bool)
+		verbose, _ := req.Options[swarmVerboseOptionName].(bool)
+		holePunching := cfg.Swarm.EnableHolePunching.WithDefault(false)
+
 		addrs := req.Arguments
 
 		pis, err := parseAddresses(req.Context, addrs, node.DNSResolver)
@@ -658,11 +708,20 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N
 		for i, pi := range pis {
 			output[i] = "connect " + pi.ID.Pretty()
 
-			err := api.Swarm().Connect(req.Context, pi)
+			attempts, err := connectPeer(req.Context, api, node.PeerHost, pi, directOnly, holePunching)
 			if err != nil {
 				return fmt.Errorf("%s failure: %s", output[i], err)
 			}
 			output[i] += " success"
+			if !verbose {
+				continue
+			}
+			output[i] += " via " + connectedVia(attempts)
+			if len(attempts) == 1 {
+				output[i] += fmt.Sprintf(" (%s)", attempts[0].took)
+			} else {
+				output[i] += " (" + formatAttempts(attempts) + ")"
+			}
 		}
 
 		return cmds.EmitOnce(res, &stringList{output})
@@ -673,6 +732,131 @@ ipfs swarm connect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAwe3N
 	Type: stringList{},
 }
 
+const (
+	swarmDirectOnlyOptionName = "direct-only"
+
+	connectDirect       = "direct dial"
+	connectRelay        = "relay"
+	connectHolePunching = "hole punching"
+
+	// how long a relayed connection is given to be upgraded by hole punching
+	holePunchingTimeout = 10 * time.Second
+)
+
+// connectAttempt is one of the ways tried to connect to a peer.
+type connectAttempt struct {
+	method string
+	took   time.Duration
+	err    error
+}
+
+// connectPeer connects to pi directly, or else through a relay if it has
+// relayed addresses, waiting for the relayed connection to be upgraded by hole
+// punching if enabled. It returns the attempts made, or an error explaining
+// all of them.
+func connectPeer(ctx context.Context, api coreiface.CoreAPI, h host.Host, pi peer.AddrInfo, directOnly, holePunching bool) ([]connectAttempt, error) {
+	var attempts []connectAttempt
+	try := func(method string, connect func() error) bool {
+		start := time.Now()
+		err := connect()
+		attempts = append(attempts, connectAttempt{method: method, took: time.Since(start).Round(time.Millisecond), err: err})
+		return err == nil
+	}
+
+	if try(connectDirect, func() error {
+		return api.Swarm().Connect(inet.WithForceDirectDial(ctx, "swarm connect"), pi)
+	}) {
+		return attempts, nil
+	}
+	if directOnly || !hasRelayAddrs(h, pi) {
+		return nil, errors.New(formatAttempts(attempts))
+	}
+
+	if !try(connectRelay, func() error {
+		return api.Swarm().Connect(ctx, pi)
+	}) {
+		return nil, errors.New(formatAttempts(attempts))
+	}
+	// the peer may have been reachable directly after all
+	if hasDirectConn(h, pi.ID) {
+		attempts[len(attempts)-1].method = connectDirect
+		return attempts, nil
+	}
+	if !holePunching {
+		return attempts, nil
+	}
+
+	// hole punching upgrades the relayed connection by itself, if it can,
+	// else the peer stays connected through the relay
+	try(connectHolePunching, func() error {
+		return waitDirectConn(ctx, h, pi.ID, holePunchingTimeout)
+	})
+	return attempts, nil
+}
+
+// connectedVia returns the method of the last successful attempt.
+func connectedVia(attempts []connectAttempt) string {
+	for i := len(attempts) - 1; i >= 0; i-- {
+		if attempts[i].err == nil {
+			return attempts[i].method
+		}
+	}
+	return ""
+}
+
+// hasRelayAddrs reports whether pi, or the addresses of the peer known to h,
+// include relayed ones.
+func hasRelayAddrs(h host.Host, pi peer.AddrInfo) bool {
+	for _, addrs := range [][]ma.Multiaddr{pi.Addrs, h.Peerstore().Addrs(pi.ID)} {
+		for _, a := range addrs {
+			if _, err := a.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDirectConn reports whether h has a connection to p which is not relayed.
+func hasDirectConn(h host.Host, p peer.ID) bool {
+	for _, c := range h.Network().ConnsToPeer(p) {
+		if _, err := c.RemoteMultiaddr().ValueForProtocol(ma.P_CIRCUIT); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// waitDirectConn waits up to timeout for h to have a direct connection to p.
+func waitDirectConn(ctx context.Context, h host.Host, p peer.ID, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !hasDirectConn(h, p) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.New("no direct connection")
+		}
+	}
+	return nil
+}
+
+// formatAttempts describes the connection attempts, e.g.
+// "direct dial: failed in 5s: ...; relay: 310ms".
+func formatAttempts(attempts []connectAttempt) string {
+	parts := make([]string, len(attempts))
+	for i, a := range attempts {
+		if a.err != nil {
+			parts[i] = fmt.Sprintf("%s: failed in %s: %s", a.method, a.took, a.err)
+		} else {
+			parts[i] = fmt.Sprintf("%s: %s", a.method, a.took)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
 var swarmDisconnectCmd = &cmds.Command{
 	Helptext: cmds.HelpText{
 		Tagline: "Close connection to a given address.",
@@ -684,10 +868,25 @@ ipfs swarm disconnect /ip4/104.131.131.82/tcp/4001/p2p/QmaCpDMGvV2BGHeYERUEnRQAw
 
 The disconnect is not permanent; if ipfs needs to talk to that address later,
 it will reconnect.
+
+Instead of addresses, the connections to close can be selected by criteria,
+which all have to match:
+
+  --protocol=<id>   the connections to the peers supporting the protocol
+  --relayed         the connections through a relay
+  --cidr=<subnet>   the connections from or to an IP address of the subnet,
+                    the address of the relay for relayed connections
+
+ipfs swarm disconnect --relayed --cidr=203.0.113.0/24
 `,
 	},
 	Arguments: []cmds.Argument{
-		cmds.StringArg("address", true, true, "Address of peer to disconnect from.").EnableStdin(),
+		cmds.StringArg("address", false, true, "Address of peer to disconnect from.").EnableStdin(),
+	},
+	Options: []cmds.Option{
+		cmds.StringOption(swarmProtocolOptionName, "Close the connections to the peers supporting this protocol."),
+		cmds.BoolOption(swarmRelayedOptionName, "Close the relayed connections."),
+		cmds.StringOption(swarmCIDROptionName, "Close the connections from or to this subnet."),
 	},
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		node, err := cmdenv.GetNode(env)
@@ -700,6 +899,32 @@ it will reconnect.
 			return err
 		}
 
+		protocol, hasProtocol := req.Options[swarmProtocolOptionName].(string)
+		relayed, _ := req.Options[swarmRelayedOptionName].(bool)
+		cidr, hasCIDR := req.Options[swarmCIDROptionName].(string)
+		if hasProtocol || relayed || hasCIDR {
+			if len(req.Arguments) > 0 {
+				return errors.New("addresses and criteria can not be combined")
+			}
+			if !node.IsOnline {
+				return ErrNotOnline
+			}
+			crit := connCriteria{protocol: protocol, relayed: relayed}
+			if hasCIDR {
+				if _, crit.subnet, err = net.ParseCIDR(cidr); err != nil {
+					return fmt.Errorf("invalid subnet: %w", err)
+				}
+			}
+			return cmds.EmitOnce(res, &stringList{disconnectMatching(node.PeerHost, crit)})
+		}
+
+		if err := req.ParseBodyArgs(); err != nil {
+			return err
+		}
+		if len(req.Arguments) == 0 {
+			return errors.New("no address or criteria given")
+		}
+
 		addrs, err := parseAddresses(req.Context, req.Arguments, node.DNSResolver)
 		if err != nil {
 			return err
@@ -738,6 +963,65 @@ it will reconnect.
 	Type: stringList{},
 }
 
+const (
+	swarmProtocolOptionName = "protocol"
+	swarmRelayedOptionName  = "relayed"
+	swarmCIDROptionName     = "cidr"
+)
+
+// connCriteria select connections, matching all the criteria set.
+type connCriteria struct {
+	protocol string
+	relayed  bool
+	subnet   *net.IPNet
+}
+
+func (crit connCriteria) match(h host.Host, c inet.Conn) bool {
+	addr := c.RemoteMultiaddr()
+	if crit.relayed {
+		if _, err := addr.ValueForProtocol(ma.P_CIRCUIT); err != nil {
+			return false
+		}
+	}
+	if crit.subnet != nil {
+		// the address of a relayed connection starts with the one of the
+		// relay
+		first, _ := ma.SplitFirst(addr)
+		if first == nil {
+			return false
+		}
+		ip, err := manet.ToIP(first)
+		if err != nil || !crit.subnet.Contains(ip) {
+			return false
+		}
+	}
+	if crit.protocol != "" {
+		protos, err := h.Peerstore().SupportsProtocols(c.RemotePeer(), crit.protocol)
+		if err != nil || len(protos) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// disconnectMatching closes the connections of h matching crit.
+func disconnectMatching(h host.Host, crit connCriteria) []string {
+	var output []string
+	for _, c := range h.Network().Conns() {
+		if !crit.match(h, c) {
+			continue
+		}
+		msg := "disconnect " + c.RemotePeer().Pretty() + " " + c.RemoteMultiaddr().String()
+		if err := c.Close(); err != nil {
+			msg += " failure: " + err.Error()
+		} else {
+			msg += " success"
+		}
+		output = append(output, msg)
+	}
+	return output
+}
+
 // parseAddresses is a function that takes in a slice of string peer addresses
 // (multiaddr + peerid) and returns a slice of properly constructed peers
 func parseAddresses(ctx context.Context, addrs []string, rslv *madns.Resolver) ([]peer.AddrInfo, error) {
@@ -0,0 +1,227 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/libp2p/go-libp2p-core/event"
+	inet "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// swarmEventsBuffer is the number of events buffered for a slow client, the
+// events beyond are dropped.
+const swarmEventsBuffer = 1024
+
+const swarmEventsInitialOptionName = "initial"
+
+// SwarmEvent is a change of the peers of the node, seen by swarm events
+type SwarmEvent struct {
+	// Type is connected, disconnected, identified, identify-failed, or
+	// dropped when events were dropped because the client was too slow
+	Type string
+	Time time.Time
+	Peer string `json:",omitempty"`
+
+	// Conns are the connections to the peer, when connected
+	Conns []SwarmEventConn `json:",omitempty"`
+
+	// AgentVersion, ProtocolVersion, Protocols and ListenAddrs are what the
+	// peer told about itself, when identified
+	AgentVersion    string   `json:",omitempty"`
+	ProtocolVersion string   `json:",omitempty"`
+	Protocols       []string `json:",omitempty"`
+	ListenAddrs     []string `json:",omitempty"`
+
+	// Error is why the identification failed, when identify-failed
+	Error string `json:",omitempty"`
+	// Dropped is the number of events dropped, when dropped
+	Dropped uint64 `json:",omitempty"`
+}
+
+// SwarmEventConn is a connection to a peer
+type SwarmEventConn struct {
+	Addr      string
+	Direction string
+}
+
+var swarmEventsCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Stream the connections and disconnections of peers.",
+		ShortDescription: `
+'ipfs swarm events' emits an event every time a peer gets connected, gets
+disconnected, or is identified, until the command is interrupted:
+
+  connected        the node has its first connection to the peer, the event
+                   has the addresses and the directions of the connections
+  disconnected     the node has no more connection to the peer
+  identified       the peer told its agent version, protocols and listen
+                   addresses
+  identify-failed  the identification of the peer failed
+  dropped          events were dropped, the client being too slow
+
+With --enc=json, the events are emitted one JSON object per line.
+
+With --initial, a connected event is emitted first for each peer already
+connected.
+`,
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(swarmEventsInitialOptionName, "Emit a connected event for each peer already connected first."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		n, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+		if !n.IsOnline {
+			return ErrNotOnline
+		}
+		initial, _ := req.Options[swarmEventsInitialOptionName].(bool)
+
+		sub, err := n.PeerHost.EventBus().Subscribe([]interface{}{
+			new(event.EvtPeerConnectednessChanged),
+			new(event.EvtPeerIdentificationCompleted),
+			new(event.EvtPeerIdentificationFailed),
+		})
+		if err != nil {
+			return err
+		}
+		defer sub.Close()
+
+		// the event bus is not held up by a slow client
+		events := make(chan *SwarmEvent, swarmEventsBuffer)
+		var dropped uint64
+		go func() {
+			for {
+				select {
+				case e, ok := <-sub.Out():
+					if !ok {
+						return
+					}
+					out := swarmEvent(n, e)
+					if out == nil {
+						continue
+					}
+					select {
+					case events <- out:
+					default:
+						atomic.AddUint64(&dropped, 1)
+					}
+				case <-req.Context.Done():
+					return
+				}
+			}
+		}()
+
+		if f, ok := res.(http.Flusher); ok {
+			f.Flush()
+		}
+		if initial {
+			for _, p := range n.PeerHost.Network().Peers() {
+				if err := res.Emit(connectedEvent(n, p, time.Now())); err != nil {
+					return err
+				}
+			}
+		}
+
+		for {
+			select {
+			case e := <-events:
+				if d := atomic.SwapUint64(&dropped, 0); d > 0 {
+					if err := res.Emit(&SwarmEvent{Type: "dropped", Time: time.Now(), Dropped: d}); err != nil {
+						return err
+					}
+				}
+				if err := res.Emit(e); err != nil {
+					return err
+				}
+			case <-req.Context.Done():
+				return nil
+			}
+		}
+	},
+	Type: SwarmEvent{},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *SwarmEvent) error {
+			var details []string
+			switch out.Type {
+			case "connected":
+				for _, c := range out.Conns {
+					details = append(details, c.Addr+" "+c.Direction)
+				}
+			case "identified":
+				details = append(details, out.AgentVersion)
+			case "identify-failed":
+				details = append(details, out.Error)
+			case "dropped":
+				details = append(details, fmt.Sprintf("%d events", out.Dropped))
+			}
+			line := strings.TrimSpace(out.Type + " " + out.Peer)
+			if len(details) > 0 {
+				line += " " + strings.Join(details, ", ")
+			}
+			_, err := fmt.Fprintln(w, line)
+			return err
+		}),
+	},
+}
+
+// swarmEvent returns the swarm event of the event bus event e, or nil if it
+// is not one.
+func swarmEvent(n *core.IpfsNode, e interface{}) *SwarmEvent {
+	now := time.Now()
+	switch e := e.(type) {
+	case event.EvtPeerConnectednessChanged:
+		switch e.Connectedness {
+		case inet.Connected:
+			return connectedEvent(n, e.Peer, now)
+		case inet.NotConnected:
+			return &SwarmEvent{Type: "disconnected", Time: now, Peer: e.Peer.Pretty()}
+		}
+	case event.EvtPeerIdentificationCompleted:
+		out := &SwarmEvent{Type: "identified", Time: now, Peer: e.Peer.Pretty()}
+		ps := n.Peerstore
+		if v, err := ps.Get(e.Peer, "AgentVersion"); err == nil {
+			out.AgentVersion, _ = v.(string)
+		}
+		if v, err := ps.Get(e.Peer, "ProtocolVersion"); err == nil {
+			out.ProtocolVersion, _ = v.(string)
+		}
+		if protocols, err := ps.GetProtocols(e.Peer); err == nil {
+			sort.Strings(protocols)
+			out.Protocols = protocols
+		}
+		for _, a := range ps.Addrs(e.Peer) {
+			out.ListenAddrs = append(out.ListenAddrs, a.String())
+		}
+		return out
+	case event.EvtPeerIdentificationFailed:
+		out := &SwarmEvent{Type: "identify-failed", Time: now, Peer: e.Peer.Pretty()}
+		if e.Reason != nil {
+			out.Error = e.Reason.Error()
+		}
+		return out
+	}
+	return nil
+}
+
+// connectedEvent returns the connected event of p, with its connections.
+func connectedEvent(n *core.IpfsNode, p peer.ID, now time.Time) *SwarmEvent {
+	out := &SwarmEvent{Type: "connected", Time: now, Peer: p.Pretty()}
+	for _, c := range n.PeerHost.Network().ConnsToPeer(p) {
+		out.Conns = append(out.Conns, SwarmEventConn{
+			Addr:      c.RemoteMultiaddr().String(),
+			Direction: directionString(c.Stat().Direction),
+		})
+	}
+	return out
+}
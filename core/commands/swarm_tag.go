@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+type peerTagOutput struct {
+	Peer   string
+	Tag    string
+	Weight int
+}
+
+var swarmTagCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Tag a peer for the connection manager.",
+		ShortDescription: `
+'ipfs swarm tag' tags a peer with a weight. When over Swarm.ConnMgr.HighWater,
+the connection manager prunes the peers with the lowest weights first, and
+never the peers with a protected tag.
+
+The tags are persisted in Swarm.ConnMgr.Peers of the config. The policy of a
+tag, protecting its peers and limiting their connections and bandwidth, is
+set with 'ipfs swarm limit tag:<tag>'.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "ID of the peer to tag."),
+		cmds.StringArg("tag", true, false, "Tag of the peer."),
+		cmds.StringArg("weight", true, false, "Weight of the tag."),
+	},
+	Subcommands: map[string]*cmds.Command{
+		"ls": swarmTagLsCmd,
+		"rm": swarmTagRmCmd,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		sapi, err := swarmTagAPI(env, req)
+		if err != nil {
+			return err
+		}
+		p, err := peer.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		tag := req.Arguments[1]
+		weight, err := strconv.Atoi(req.Arguments[2])
+		if err != nil {
+			return fmt.Errorf("invalid weight: %s", err)
+		}
+		if err := sapi.TagPeer(req.Context, p, tag, weight); err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &peerTagOutput{Peer: p.String(), Tag: tag, Weight: weight})
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *peerTagOutput) error {
+			fmt.Fprintf(w, "tagged %s %s %d\n", out.Peer, out.Tag, out.Weight)
+			return nil
+		}),
+	},
+	Type: peerTagOutput{},
+}
+
+var swarmTagLsCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "List the tags of the peers.",
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		sapi, err := swarmTagAPI(env, req)
+		if err != nil {
+			return err
+		}
+		tags, err := sapi.PeerTags(req.Context)
+		if err != nil {
+			return err
+		}
+		for _, t := range tags {
+			if err := res.Emit(&peerTagOutput{Peer: t.Peer.String(), Tag: t.Tag, Weight: t.Weight}); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *peerTagOutput) error {
+			fmt.Fprintf(w, "%s %s %d\n", out.Peer, out.Tag, out.Weight)
+			return nil
+		}),
+	},
+	Type: peerTagOutput{},
+}
+
+var swarmTagRmCmd = &cmds.Command{
+	Status: cmds.Experimental,
+	Helptext: cmds.HelpText{
+		Tagline: "Remove the tag of a peer.",
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("peer", true, false, "ID of the peer to untag."),
+		cmds.StringArg("tag", true, false, "Tag to remove."),
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		sapi, err := swarmTagAPI(env, req)
+		if err != nil {
+			return err
+		}
+		p, err := peer.Decode(req.Arguments[0])
+		if err != nil {
+			return err
+		}
+		return sapi.UntagPeer(req.Context, p, req.Arguments[1])
+	},
+}
+
+func swarmTagAPI(env cmds.Environment, req *cmds.Request) (*coreapi.SwarmAPI, error) {
+	api, err := cmdenv.GetApi(env, req)
+	if err != nil {
+		return nil, err
+	}
+	sapi, ok := api.Swarm().(*coreapi.SwarmAPI)
+	if !ok {
+		return nil, errors.New("peer tags are not supported by this node")
+	}
+	return sapi, nil
+}
+
+// swarmTagLimit gets or sets the policy of tag, for 'ipfs swarm limit'.
+func swarmTagLimit(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment, tag string) error {
+	sapi, err := swarmTagAPI(env, req)
+	if err != nil {
+		return err
+	}
+
+	if req.Files != nil {
+		it := req.Files.Entries()
+		if it.Next() {
+			file := files.FileFromEntry(it)
+			if file == nil {
+				return errors.New("expected a JSON file")
+			}
+			var policy config.ConnMgrTag
+			if err := json.NewDecoder(file).Decode(&policy); err != nil {
+				return errors.New("failed to decode JSON as ConnMgrTag")
+			}
+			return sapi.SetTagPolicy(req.Context, tag, policy)
+		}
+		if err := it.Err(); err != nil {
+			return fmt.Errorf("error opening limit JSON file: %w", err)
+		}
+	}
+
+	policy, err := sapi.TagPolicy(req.Context, tag)
+	if err != nil {
+		return err
+	}
+	b := new(bytes.Buffer)
+	if err := json.NewEncoder(b).Encode(policy); err != nil {
+		return err
+	}
+	return cmds.EmitOnce(res, b)
+}
@@ -6,6 +6,7 @@ import (
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
 	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
 	tar "github.com/ipfs/go-ipfs/tar"
 
 	dag "github.com/ipfs/go-merkledag"
@@ -37,6 +38,7 @@ represent it.
 	Arguments: []cmds.Argument{
 		cmds.FileArg("file", true, false, "Tar file to add.").EnableStdin(),
 	},
+	Extra: CreateCmdExtras(cmdutils.SetChangesRepo()),
 	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
 		api, err := cmdenv.GetApi(env, req)
 		if err != nil {
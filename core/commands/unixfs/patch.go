@@ -0,0 +1,306 @@
+package unixfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	cmdenv "github.com/ipfs/go-ipfs/core/commands/cmdenv"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	ipld "github.com/ipfs/go-ipld-format"
+	merkledag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const parentsOptionName = "parents"
+
+// PatchOutput is the output type of the 'unixfs' subcommands.
+type PatchOutput struct {
+	Hash string
+}
+
+var patchEncoders = cmds.EncoderMap{
+	cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, out *PatchOutput) error {
+		_, err := fmt.Fprintln(w, out.Hash)
+		return err
+	}),
+}
+
+var PatchCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Create new UnixFS directories from existing ones.",
+		ShortDescription: `
+'ipfs unixfs' creates a new UnixFS directory by adding or removing entries of
+an existing one, and prints out the CID of the new directory. It replaces
+'ipfs object patch', which only edits the links of single dag-pb nodes and
+corrupts HAMT-sharded directories.
+
+Sharded directories are edited through their shards and stay sharded, and
+directories growing past Internal.UnixFSShardingSizeThreshold are sharded.
+The CID version, hash function and data of the edited directories are kept.
+
+Only the blocks on the edited paths are fetched.
+`,
+	},
+	Subcommands: map[string]*cmds.Command{
+		"add-link": patchAddLinkCmd,
+		"rm-link":  patchRmLinkCmd,
+		"mkdir":    patchMkdirCmd,
+	},
+}
+
+var patchAddLinkCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add an entry to a UnixFS directory.",
+		ShortDescription: `
+Add an entry named <name> linking to <ref> to the UnixFS directory <root>,
+replacing the entry of that name if any. <name> can be a path into the
+subdirectories of <root>, which are created with --parents if missing.
+
+Example:
+
+    $ DIR=$(ipfs unixfs mkdir QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn docs)
+    $ ipfs unixfs add-link $DIR docs/cat.jpg QmW2WQi7j6c7UgJTarActp7tDNikE4B2qXtFCfLPdsgaTQ
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The UnixFS directory to add the entry to."),
+		cmds.StringArg("name", true, false, "The name or path of the entry."),
+		cmds.StringArg("ref", true, false, "The IPFS object to link to."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(parentsOptionName, "p", "Create the missing parent directories."),
+	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		parents, _ := req.Options[parentsOptionName].(bool)
+
+		root, err := api.ResolveNode(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		segments, err := entryPath(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+		child, err := api.ResolveNode(req.Context, path.New(req.Arguments[2]))
+		if err != nil {
+			return err
+		}
+
+		nd, err := editDirectory(req.Context, api.Dag(), root, segments, parents, func(d uio.Directory, name string) error {
+			return d.AddChild(req.Context, name, child)
+		})
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &PatchOutput{Hash: nd.Cid().String()})
+	},
+	Type:     PatchOutput{},
+	Encoders: patchEncoders,
+}
+
+var patchRmLinkCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Remove an entry from a UnixFS directory.",
+		ShortDescription: `
+Remove the entry named <name> from the UnixFS directory <root>. <name> can be
+a path into the subdirectories of <root>.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The UnixFS directory to remove the entry from."),
+		cmds.StringArg("name", true, false, "The name or path of the entry."),
+	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+
+		root, err := api.ResolveNode(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		segments, err := entryPath(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		nd, err := editDirectory(req.Context, api.Dag(), root, segments, false, func(d uio.Directory, name string) error {
+			err := d.RemoveChild(req.Context, name)
+			if err == os.ErrNotExist {
+				return fmt.Errorf("no entry named %q", strings.Join(segments, "/"))
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &PatchOutput{Hash: nd.Cid().String()})
+	},
+	Type:     PatchOutput{},
+	Encoders: patchEncoders,
+}
+
+var patchMkdirCmd = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Add an empty directory to a UnixFS directory.",
+		ShortDescription: `
+Add an empty directory named <name> to the UnixFS directory <root>. <name> can
+be a path into the subdirectories of <root>, which are created with --parents
+if missing. The new directories use the CID version and hash function of their
+parent.
+`,
+	},
+	Arguments: []cmds.Argument{
+		cmds.StringArg("root", true, false, "The UnixFS directory to add the directory to."),
+		cmds.StringArg("name", true, false, "The name or path of the directory."),
+	},
+	Options: []cmds.Option{
+		cmds.BoolOption(parentsOptionName, "p", "Create the missing parent directories, and do not fail if the directory exists."),
+	},
+	Extra: cmdutils.CreateCmdExtras(cmdutils.SetChangesRepo()),
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		api, err := cmdenv.GetApi(env, req)
+		if err != nil {
+			return err
+		}
+		parents, _ := req.Options[parentsOptionName].(bool)
+
+		root, err := api.ResolveNode(req.Context, path.New(req.Arguments[0]))
+		if err != nil {
+			return err
+		}
+		segments, err := entryPath(req.Arguments[1])
+		if err != nil {
+			return err
+		}
+
+		nd, err := editDirectory(req.Context, api.Dag(), root, segments, parents, func(d uio.Directory, name string) error {
+			existing, err := d.Find(req.Context, name)
+			switch {
+			case err == nil && parents && isDirectory(existing):
+				return nil
+			case err == nil:
+				return fmt.Errorf("%q already exists", strings.Join(segments, "/"))
+			case err != os.ErrNotExist:
+				return err
+			}
+			empty := emptyDirectory(d)
+			if err := api.Dag().Add(req.Context, empty); err != nil {
+				return err
+			}
+			return d.AddChild(req.Context, name, empty)
+		})
+		if err != nil {
+			return err
+		}
+		return cmds.EmitOnce(res, &PatchOutput{Hash: nd.Cid().String()})
+	},
+	Type:     PatchOutput{},
+	Encoders: patchEncoders,
+}
+
+// entryPath splits the path of a directory entry into its names.
+func entryPath(p string) ([]string, error) {
+	var segments []string
+	for _, s := range strings.Split(p, "/") {
+		switch s {
+		case "":
+		case ".", "..":
+			return nil, fmt.Errorf("invalid entry path %q", p)
+		default:
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid entry path %q", p)
+	}
+	return segments, nil
+}
+
+// editDirectory calls edit with the directory holding the last of segments in
+// the UnixFS directory nd, creating the missing directories on the way if
+// parents is set. It stores the edited directories and returns the new nd.
+func editDirectory(ctx context.Context, dserv ipld.DAGService, nd ipld.Node, segments []string, parents bool, edit func(d uio.Directory, name string) error) (ipld.Node, error) {
+	if !isDirectory(nd) {
+		return nil, errors.New("not a UnixFS directory")
+	}
+	d, err := uio.NewDirectoryFromNode(dserv, nd)
+	if err != nil {
+		return nil, err
+	}
+	// the check for unsharding walks the shards while they are edited, so
+	// sharded directories are edited as such and stay sharded
+	if dd, ok := d.(*uio.DynamicDirectory); ok {
+		if hd, ok := dd.Directory.(*uio.HAMTDirectory); ok {
+			d = hd
+		}
+	}
+
+	if len(segments) == 1 {
+		err = edit(d, segments[0])
+	} else {
+		var child ipld.Node
+		child, err = d.Find(ctx, segments[0])
+		if err == os.ErrNotExist && parents {
+			child, err = emptyDirectory(d), nil
+		}
+		if err == os.ErrNotExist {
+			return nil, fmt.Errorf("no directory named %q", segments[0])
+		}
+		if err != nil {
+			return nil, err
+		}
+		child, err = editDirectory(ctx, dserv, child, segments[1:], parents, edit)
+		if err != nil {
+			return nil, err
+		}
+		err = d.AddChild(ctx, segments[0], child)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := d.GetNode()
+	if err != nil {
+		return nil, err
+	}
+	return edited, dserv.Add(ctx, edited)
+}
+
+// emptyDirectory returns an empty directory built like its parent d.
+func emptyDirectory(d uio.Directory) ipld.Node {
+	nd := ft.EmptyDirNode()
+	nd.SetCidBuilder(d.GetCidBuilder())
+	return nd
+}
+
+func isDirectory(nd ipld.Node) bool {
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return false
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return false
+	}
+	switch fsn.Type() {
+	case ft.TDirectory, ft.THAMTShard:
+		return true
+	}
+	return false
+}
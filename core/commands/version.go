@@ -8,9 +8,12 @@ import (
 	"runtime/debug"
 
 	version "github.com/ipfs/go-ipfs"
+	"github.com/ipfs/go-ipfs/core/commands/cmdenv"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
+	"github.com/ipfs/go-ipfs/update"
 
 	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-path/resolver"
 )
 
 type VersionOutput struct {
@@ -44,7 +47,8 @@ var VersionCmd = &cmds.Command{
 		ShortDescription: "Returns the current version of IPFS and exits.",
 	},
 	Subcommands: map[string]*cmds.Command{
-		"deps": depsVersionCommand,
+		"deps":  depsVersionCommand,
+		"check": checkVersionCommand,
 	},
 
 	Options: []cmds.Option{
@@ -150,3 +154,61 @@ Print out all dependencies and their versions.`,
 		}),
 	},
 }
+
+var checkVersionCommand = &cmds.Command{
+	Helptext: cmds.HelpText{
+		Tagline: "Check for a newer version of go-ipfs.",
+		ShortDescription: `
+Compares the running version with the latest one on the distribution site,
+fetched over IPFS, or else over HTTP. Nothing is downloaded or installed.
+`,
+		LongDescription: `
+Compares the running version with the latest one on the distribution site,
+fetched over IPFS, or else over HTTP. Nothing is downloaded or installed.
+
+The distribution site is Update.DistPath, or else the IPFS_DIST_PATH
+environment variable, or else /ipns/dist.ipfs.io. Release candidates are only
+offered to release candidates.
+
+With Update.Check, the daemon checks every Update.Interval by itself, logs the
+versions available and reports them with the ipfs_update_available metric.
+`,
+	},
+	Run: func(req *cmds.Request, res cmds.ResponseEmitter, env cmds.Environment) error {
+		nd, err := cmdenv.GetNode(env)
+		if err != nil {
+			return err
+		}
+
+		checker := nd.UpdateChecker
+		if checker == nil {
+			cfg, err := nd.Repo.Config()
+			if err != nil {
+				return err
+			}
+			fetcher := update.NewFetcher(update.DistPath(cfg.Update), nd.Namesys, resolver.NewBasicResolver(nd.UnixFSFetcherFactory), nd.DAG)
+			checker, err = update.New(version.CurrentVersionNumber, fetcher)
+			if err != nil {
+				return err
+			}
+			defer checker.Close()
+		}
+
+		st, err := checker.Check(req.Context)
+		if err != nil {
+			return fmt.Errorf("checking for a newer version: %w", err)
+		}
+		return cmds.EmitOnce(res, &st)
+	},
+	Encoders: cmds.EncoderMap{
+		cmds.Text: cmds.MakeTypedEncoder(func(req *cmds.Request, w io.Writer, st *update.Status) error {
+			if st.Available {
+				fmt.Fprintf(w, "go-ipfs %s is available, this node runs %s\n", st.Latest, st.Current)
+			} else {
+				fmt.Fprintf(w, "go-ipfs %s is up to date\n", st.Current)
+			}
+			return nil
+		}),
+	},
+	Type: update.Status{},
+}
@@ -5,7 +5,7 @@ Packages underneath core/ provide a (relatively) stable, low-level API
 to carry out most IPFS-related tasks.  For more details on the other
 interfaces and how core/... fits into the bigger IPFS picture, see:
 
-  $ godoc github.com/ipfs/go-ipfs
+	$ godoc github.com/ipfs/go-ipfs
 */
 package core
 
@@ -43,13 +43,45 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
 
+	"github.com/ipfs/go-ipfs/addscan"
+	"github.com/ipfs/go-ipfs/bitswapstats"
+	"github.com/ipfs/go-ipfs/blocks/placement"
+	"github.com/ipfs/go-ipfs/bwhistory"
+	"github.com/ipfs/go-ipfs/carprogress"
+	"github.com/ipfs/go-ipfs/connpolicy"
 	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/demand"
+	"github.com/ipfs/go-ipfs/dupblocks"
+	"github.com/ipfs/go-ipfs/fetchprogress"
 	"github.com/ipfs/go-ipfs/fuse/mount"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/lanannounce"
+	"github.com/ipfs/go-ipfs/lowpower"
+	"github.com/ipfs/go-ipfs/maintenance"
+	"github.com/ipfs/go-ipfs/membudget"
+	"github.com/ipfs/go-ipfs/mfsjournal"
+	"github.com/ipfs/go-ipfs/mfsrepl"
+	"github.com/ipfs/go-ipfs/mfswatch"
 	"github.com/ipfs/go-ipfs/p2p"
 	"github.com/ipfs/go-ipfs/peering"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/follow"
+	"github.com/ipfs/go-ipfs/pinning/lazypin"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pinning/pinsize"
+	"github.com/ipfs/go-ipfs/pinning/remotesync"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
+	"github.com/ipfs/go-ipfs/pinning/warmup"
+	"github.com/ipfs/go-ipfs/profhistory"
+	"github.com/ipfs/go-ipfs/pubqueue"
+	"github.com/ipfs/go-ipfs/pubsubhistory"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/reprovide"
+	"github.com/ipfs/go-ipfs/resbudget"
+	"github.com/ipfs/go-ipfs/tenants"
+	"github.com/ipfs/go-ipfs/update"
 	"github.com/ipfs/go-namesys"
 	ipnsrp "github.com/ipfs/go-namesys/republisher"
 )
@@ -66,6 +98,12 @@ type IpfsNode struct {
 
 	// Local node
 	Pinning         pin.Pinner             // the pinning manager
+	SelectorPins    *selectorpin.Store     // the pins of sub-DAGs matched by selectors
+	LazyPins        *lazypin.Store         // the pins whose DAGs are fetched on demand
+	ExpiringPins    *expiry.Store          // the pins removed once their class expires them
+	PinMeta         *pinmeta.Store         // the names and labels of the pins
+	PinSizes        *pinsize.Index         `optional:"true"` // the storage taken by the recursive pins
+	PinWarmup       *warmup.Pinner         `optional:"true"` // tells when the pinset is loaded
 	Mounts          Mounts                 `optional:"true"` // current mount state, if any.
 	PrivateKey      ic.PrivKey             `optional:"true"` // the local node's private Key
 	PNetFingerprint libp2p.PNetFingerprint `optional:"true"` // fingerprint of private network
@@ -75,26 +113,55 @@ type IpfsNode struct {
 	Blockstore           bstore.GCBlockstore       // the block store (lower level)
 	Filestore            *filestore.Filestore      `optional:"true"` // the filestore blockstore
 	BaseBlocks           node.BaseBlocks           // the raw blockstore, no filestore wrapping
+	Placement            *placement.Blockstore     `optional:"true"` // places the blocks in the mounts of Datastore.Placement
 	GCLocker             bstore.GCLocker           // the locker used to protect the blockstore during gc
 	Blocks               bserv.BlockService        // the block service, get/add blocks.
 	DAG                  ipld.DAGService           // the merkle dag service, get/add objects.
 	IPLDFetcherFactory   fetcher.Factory           `name:"ipldFetcher"`   // fetcher that paths over the IPLD data model
 	UnixFSFetcherFactory fetcher.Factory           `name:"unixfsFetcher"` // fetcher that interprets UnixFS data
 	Reporter             *metrics.BandwidthCounter `optional:"true"`
+	BandwidthHistory     *bwhistory.Recorder       `optional:"true"` // the history of the bandwidth metrics
+	ProfileHistory       *profhistory.Recorder     `optional:"true"` // the snapshots of the profiles taken on a schedule
 	Discovery            mdns.Service              `optional:"true"`
 	FilesRoot            *mfs.Root
+	FilesJournal         *mfsjournal.Journal // the operations changing the MFS
+	FilesWatcher         *mfswatch.Watcher   // notifies the changes of the MFS
 	RecordValidator      record.Validator
+	MemoryBudget         *membudget.Budget       `optional:"true"` // sheds load when close to the memory limit
+	ResourceBudget       *resbudget.Budget       // counts the file descriptors, goroutines and sockets
+	BackgroundIO         *iothrottle.Limiter     `optional:"true"` // limits the disk I/O of the background jobs
+	Maintenance          *maintenance.Scheduler  `optional:"true"` // holds the background jobs to the maintenance windows
+	Tenants              *tenants.Accountant     `optional:"true"` // accounts for the usage of the API authorizations
+	AddScanner           *addscan.Scanner        `optional:"true"` // scans the files added
+	FetchProgress        *fetchprogress.Registry // the fetches tracked by name
+	CarProgress          *carprogress.Registry   // the CAR imports and exports tracked by name
 
 	// Online
 	PeerHost        p2phost.Host            `optional:"true"` // the network host (server+client)
 	Peering         *peering.PeeringService `optional:"true"`
+	ConnPolicy      *connpolicy.Manager     `optional:"true"` // the policies of the peer tags
+	LazyPinFiller   *lazypin.Filler         `optional:"true"` // fills the lazy pins in the background
+	LowPower        *lowpower.Controller    `optional:"true"` // switches the low-power mode
+	PublishQueue    *pubqueue.Queue         `optional:"true"` // the publishes made while unreachable
+	PubsubHistory   *pubsubhistory.History  `optional:"true"` // the recent messages of pubsub topics
+	MFSPublisher    *mfsrepl.Publisher      `optional:"true"` // publishes the MFS root to the standbys
+	MFSStandby      *mfsrepl.Follower       `optional:"true"` // follows the MFS root of the writer
+	PinFollower     *follow.Follower        `optional:"true"` // mirrors the pinset of another node
+	RemotePinSyncer *remotesync.Syncer      `optional:"true"` // mirrors the pins to remote pinning services
+	LANAnnouncer    *lanannounce.Announcer  `optional:"true"` // announces the CIDs added to the local network
+	UpdateChecker   *update.Checker         `optional:"true"` // checks for newer versions of go-ipfs
 	Filters         *ma.Filters             `optional:"true"`
 	Bootstrapper    io.Closer               `optional:"true"` // the periodic bootstrapper
+	BootstrapGroup  *bootstrap.Group        `optional:"true"` // the group of bootstrap peers used
 	Routing         routing.Routing         `optional:"true"` // the routing system. recommend ipfs-dht
 	DNSResolver     *madns.Resolver         // the DNS resolver
 	Exchange        exchange.Interface      // the block exchange + strategy (bitswap)
+	DupBlocks       *dupblocks.Tracker      `optional:"true"` // the duplicate blocks of the bitswap sessions
+	BitswapStats    *bitswapstats.Recorder  `optional:"true"` // what bitswap exchanged with each peer
+	Demand          *demand.Tracker         `optional:"true"` // the keys requested by the peers over bitswap
 	Namesys         namesys.NameSystem      // the name system, resolves paths to hashes
 	Provider        provider.System         // the value provider system
+	Reprovider      *reprovide.Reprovider   `optional:"true"` // spreads the reprovides over the interval
 	IpnsRepub       *ipnsrp.Republisher     `optional:"true"`
 	GraphExchange   graphsync.GraphExchange `optional:"true"`
 	ResourceManager network.ResourceManager `optional:"true"`
@@ -112,9 +179,12 @@ type IpfsNode struct {
 
 	stop func() error
 
+	drainer Drainer
+
 	// Flags
-	IsOnline bool `optional:"true"` // Online is set when networking is enabled.
-	IsDaemon bool `optional:"true"` // Daemon is set when running on a long-running daemon.
+	IsOnline   bool `optional:"true"` // Online is set when networking is enabled.
+	IsDaemon   bool `optional:"true"` // Daemon is set when running on a long-running daemon.
+	IsReadOnly bool `optional:"true"` // ReadOnly is set when the content of the node cannot be changed remotely.
 }
 
 // Mounts defines what the node's mount state is. This should
@@ -138,6 +208,11 @@ func (n *IpfsNode) Context() context.Context {
 	return n.ctx
 }
 
+// Drainer returns the tracker of the work in flight on the node.
+func (n *IpfsNode) Drainer() *Drainer {
+	return &n.drainer
+}
+
 // Bootstrap will set and call the IpfsNodes bootstrap function.
 func (n *IpfsNode) Bootstrap(cfg bootstrap.BootstrapConfig) error {
 	// TODO what should return value be when in offlineMode?
@@ -173,7 +248,7 @@ func (n *IpfsNode) loadBootstrapPeers() ([]peer.AddrInfo, error) {
 		return nil, err
 	}
 
-	return cfg.BootstrapPeers()
+	return cfg.BootstrapGroupPeers(n.BootstrapGroup.Name())
 }
 
 type ConstructPeerHostOpts struct {
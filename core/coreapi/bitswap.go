@@ -0,0 +1,46 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-ipfs/bitswapstats"
+	"github.com/ipfs/go-ipfs/dupblocks"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var errNoBitswapStats = errors.New("the bitswap stats are not recorded by this node")
+
+// BitswapSessions returns the state of the running bitswap sessions, oldest
+// first.
+func (api *CoreAPI) BitswapSessions(ctx context.Context) ([]dupblocks.Stat, error) {
+	if err := api.checkOnline(false); err != nil {
+		return nil, err
+	}
+	if api.dupBlocks == nil {
+		return nil, errNoBitswapStats
+	}
+	return api.dupBlocks.Sessions(), nil
+}
+
+// BitswapPeers returns what bitswap exchanged with the peers ps, or with all
+// the peers when none is given, by peer ID. The peers bitswap did not exchange
+// with are left out.
+func (api *CoreAPI) BitswapPeers(ctx context.Context, ps ...peer.ID) ([]bitswapstats.Stat, error) {
+	if err := api.checkOnline(false); err != nil {
+		return nil, err
+	}
+	if api.bitswapStats == nil {
+		return nil, errNoBitswapStats
+	}
+	if len(ps) == 0 {
+		return api.bitswapStats.Peers(), nil
+	}
+	stats := make([]bitswapstats.Stat, 0, len(ps))
+	for _, p := range ps {
+		if st, ok := api.bitswapStats.Stat(p); ok {
+			stats = append(stats, st)
+		}
+	}
+	return stats, nil
+}
@@ -16,6 +16,7 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 
+	"github.com/ipfs/go-ipfs/apierr"
 	util "github.com/ipfs/go-ipfs/blocks/blockstoreutil"
 	"github.com/ipfs/go-ipfs/tracing"
 )
@@ -80,7 +81,7 @@ func (api *BlockAPI) Get(ctx context.Context, p path.Path) (io.Reader, error) {
 
 	b, err := api.blocks.GetBlock(ctx, rp.Cid())
 	if err != nil {
-		return nil, err
+		return nil, apierr.Wrap(err)
 	}
 
 	return bytes.NewReader(b.RawData()), nil
@@ -138,7 +139,7 @@ func (api *BlockAPI) Stat(ctx context.Context, p path.Path) (coreiface.BlockStat
 
 	b, err := api.blocks.GetBlock(ctx, rp.Cid())
 	if err != nil {
-		return nil, err
+		return nil, apierr.Wrap(err)
 	}
 
 	return &BlockStat{
@@ -39,12 +39,25 @@ import (
 	record "github.com/libp2p/go-libp2p-record"
 	madns "github.com/multiformats/go-multiaddr-dns"
 
+	"github.com/ipfs/go-ipfs/addscan"
+	"github.com/ipfs/go-ipfs/apierr"
+	"github.com/ipfs/go-ipfs/bitswapstats"
+	"github.com/ipfs/go-ipfs/connpolicy"
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/dupblocks"
+	"github.com/ipfs/go-ipfs/lanannounce"
+	"github.com/ipfs/go-ipfs/mfswatch"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pubsubhistory"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-namesys"
 )
 
+// errOffline is returned by the operations needing the node to be online.
+var errOffline = apierr.New(apierr.Offline, coreiface.ErrOffline)
+
 type CoreAPI struct {
 	nctx context.Context
 
@@ -56,14 +69,25 @@ type CoreAPI struct {
 	baseBlocks blockstore.Blockstore
 	pinning    pin.Pinner
 
+	expiringPins *expiry.Store  // when the pins expire
+	pinMeta      *pinmeta.Store // the names and labels of the pins
+
+	filesWatcher *mfswatch.Watcher // notifies the changes of the MFS
+	addScanner   *addscan.Scanner  // scans the files added, if set
+
+	lanAnnouncer *lanannounce.Announcer // announces the CIDs added to the local network, if set
+
 	blocks               bserv.BlockService
 	dag                  ipld.DAGService
 	ipldFetcherFactory   fetcher.Factory
 	unixFSFetcherFactory fetcher.Factory
 	peerstore            pstore.Peerstore
 	peerHost             p2phost.Host
+	connPolicy           *connpolicy.Manager // the policies of the peer tags, when online
 	recordValidator      record.Validator
 	exchange             exchange.Interface
+	dupBlocks            *dupblocks.Tracker     // the duplicate blocks of the bitswap sessions
+	bitswapStats         *bitswapstats.Recorder // what bitswap exchanged with each peer
 
 	namesys     namesys.NameSystem
 	routing     routing.Routing
@@ -71,7 +95,8 @@ type CoreAPI struct {
 
 	provider provider.System
 
-	pubSub *pubsub.PubSub
+	pubSub        *pubsub.PubSub
+	pubsubHistory *pubsubhistory.History // the recent messages of topics, if kept
 
 	checkPublishAllowed func() error
 	checkOnline         func(allowOffline bool) error
@@ -169,6 +194,14 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		baseBlocks: n.BaseBlocks,
 		pinning:    n.Pinning,
 
+		expiringPins: n.ExpiringPins,
+		pinMeta:      n.PinMeta,
+
+		filesWatcher: n.FilesWatcher,
+		addScanner:   n.AddScanner,
+
+		lanAnnouncer: n.LANAnnouncer,
+
 		blocks:               n.Blocks,
 		dag:                  n.DAG,
 		ipldFetcherFactory:   n.IPLDFetcherFactory,
@@ -176,15 +209,19 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 		peerstore:       n.Peerstore,
 		peerHost:        n.PeerHost,
+		connPolicy:      n.ConnPolicy,
 		namesys:         n.Namesys,
 		recordValidator: n.RecordValidator,
 		exchange:        n.Exchange,
+		dupBlocks:       n.DupBlocks,
+		bitswapStats:    n.BitswapStats,
 		routing:         n.Routing,
 		dnsResolver:     n.DNSResolver,
 
 		provider: n.Provider,
 
-		pubSub: n.PubSub,
+		pubSub:        n.PubSub,
+		pubsubHistory: n.PubsubHistory,
 
 		nd:         n,
 		parentOpts: settings,
@@ -192,7 +229,7 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 
 	subApi.checkOnline = func(allowOffline bool) error {
 		if !n.IsOnline && !allowOffline {
-			return coreiface.ErrOffline
+			return errOffline
 		}
 		return nil
 	}
@@ -219,6 +256,10 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		}
 
 		subApi.routing = offlineroute.NewOfflineRouter(subApi.repo.Datastore(), subApi.recordValidator)
+		subApi.dnsResolver, err = madns.NewResolver(madns.WithDefaultResolver(offlineDNSResolver{}))
+		if err != nil {
+			return nil, err
+		}
 
 		subApi.namesys, err = namesys.NewNameSystem(subApi.routing,
 			namesys.WithDatastore(subApi.repo.Datastore()),
@@ -229,9 +270,11 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 		}
 
 		subApi.provider = provider.NewOfflineProvider()
+		subApi.lanAnnouncer = nil
 
 		subApi.peerstore = nil
 		subApi.peerHost = nil
+		subApi.connPolicy = nil
 		subApi.recordValidator = nil
 	}
 
@@ -244,6 +287,38 @@ func (api *CoreAPI) WithOptions(opts ...options.ApiOption) (coreiface.CoreAPI, e
 	return subApi, nil
 }
 
+// WithExchange returns an api backed by the same node, fetching the blocks it
+// is missing with exch instead of the exchange of the node.
+func (api *CoreAPI) WithExchange(exch exchange.Interface) *CoreAPI {
+	subApi := *api
+	subApi.exchange = exch
+	subApi.blocks = bserv.New(api.blockstore, exch)
+	subApi.dag = dag.NewDAGService(subApi.blocks)
+
+	fetchers := node.FetcherConfig(subApi.blocks)
+	subApi.ipldFetcherFactory = fetchers.IPLDFetcher
+	subApi.unixFSFetcherFactory = fetchers.UnixfsFetcher
+
+	return &subApi
+}
+
+// WithBlockstore returns an api backed by the same node, reading and writing
+// the blocks in bs instead of the blockstore of the node. The blocks missing
+// from bs are fetched with the exchange of the api.
+func (api *CoreAPI) WithBlockstore(bs blockstore.GCBlockstore) *CoreAPI {
+	subApi := *api
+	subApi.blockstore = bs
+	subApi.baseBlocks = bs
+	subApi.blocks = bserv.New(bs, api.exchange)
+	subApi.dag = dag.NewDAGService(subApi.blocks)
+
+	fetchers := node.FetcherConfig(subApi.blocks)
+	subApi.ipldFetcherFactory = fetchers.IPLDFetcher
+	subApi.unixFSFetcherFactory = fetchers.UnixfsFetcher
+
+	return &subApi
+}
+
 // getSession returns new api backed by the same node with a read-only session DAG
 func (api *CoreAPI) getSession(ctx context.Context) *CoreAPI {
 	sesApi := *api
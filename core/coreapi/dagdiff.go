@@ -0,0 +1,200 @@
+package coreapi
+
+import (
+	"bytes"
+	"context"
+	gopath "path"
+	"sort"
+	"strconv"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-merkledag/dagutils"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// DagChange is a node added, removed or changed at the same path between two
+// DAGs.
+type DagChange struct {
+	Type dagutils.ChangeType
+	// Path is the path of the node from the roots, /, by link names, or by
+	// link indexes for the unnamed links
+	Path   string
+	Before cid.Cid
+	After  cid.Cid
+}
+
+// DagDelta is the structural delta between two DAGs a and b.
+type DagDelta struct {
+	// Changes are in the order of the paths
+	Changes []DagChange
+
+	// Added are the blocks of b that are not part of a, in the order of a
+	// depth first walk of b, and Removed the blocks of a that are not part of
+	// b
+	Added       []cid.Cid
+	Removed     []cid.Cid
+	AddedSize   uint64
+	RemovedSize uint64
+}
+
+// DagDiff walks the DAGs a and b together, pairing the links of the nodes at
+// the same path, and returns the delta between them. The subtrees with the
+// same CID at the same path are not walked: a block of a that is only found
+// below one of them in b, and the other way around, is reported as removed, or
+// added.
+func (api *CoreAPI) DagDiff(ctx context.Context, a, b path.Path) (*DagDelta, error) {
+	ses := dag.NewSession(ctx, api.dag)
+	ra, err := api.ResolvePath(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := api.ResolvePath(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &dagDiff{
+		ctx:    ctx,
+		dag:    ses,
+		shared: cid.NewSet(),
+		delta:  &DagDelta{},
+	}
+	if err := d.diff("/", ra.Cid(), rb.Cid()); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(d.delta.Changes, func(i, j int) bool {
+		return d.delta.Changes[i].Path < d.delta.Changes[j].Path
+	})
+
+	var walkedA, walkedB []walkedBlock
+	inA := cid.NewSet()
+	if err := d.walk(ra.Cid(), inA, &walkedA); err != nil {
+		return nil, err
+	}
+	inB := cid.NewSet()
+	if err := d.walk(rb.Cid(), inB, &walkedB); err != nil {
+		return nil, err
+	}
+	for _, b := range walkedB {
+		if !inA.Has(b.cid) {
+			d.delta.Added = append(d.delta.Added, b.cid)
+			d.delta.AddedSize += b.size
+		}
+	}
+	for _, b := range walkedA {
+		if !inB.Has(b.cid) {
+			d.delta.Removed = append(d.delta.Removed, b.cid)
+			d.delta.RemovedSize += b.size
+		}
+	}
+	return d.delta, nil
+}
+
+type walkedBlock struct {
+	cid  cid.Cid
+	size uint64
+}
+
+type dagDiff struct {
+	ctx context.Context
+	dag ipld.NodeGetter
+
+	// shared are the roots of the subtrees found at the same path in a and b
+	shared *cid.Set
+	delta  *DagDelta
+}
+
+// diff records the changes between the nodes a and b found at p.
+func (d *dagDiff) diff(p string, a, b cid.Cid) error {
+	if a.Equals(b) {
+		d.shared.Add(a)
+		return nil
+	}
+
+	na, err := d.dag.Get(d.ctx, a)
+	if err != nil {
+		return err
+	}
+	nb, err := d.dag.Get(d.ctx, b)
+	if err != nil {
+		return err
+	}
+	linksA := linksByName(na)
+	linksB := linksByName(nb)
+
+	names := make([]string, 0, len(linksA)+len(linksB))
+	for name := range linksA {
+		names = append(names, name)
+	}
+	for name := range linksB {
+		if _, ok := linksA[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var below bool
+	for _, name := range names {
+		la, inA := linksA[name]
+		lb, inB := linksB[name]
+		np := gopath.Join(p, name)
+
+		switch {
+		case !inB:
+			d.delta.Changes = append(d.delta.Changes, DagChange{Type: dagutils.Remove, Path: np, Before: la})
+		case !inA:
+			d.delta.Changes = append(d.delta.Changes, DagChange{Type: dagutils.Add, Path: np, After: lb})
+		case la.Equals(lb):
+			d.shared.Add(la)
+			continue
+		default:
+			if err := d.diff(np, la, lb); err != nil {
+				return err
+			}
+		}
+		below = true
+	}
+
+	// the node itself changed, rather than only the links below it
+	pa, okA := na.(*dag.ProtoNode)
+	pb, okB := nb.(*dag.ProtoNode)
+	if !below || (okA && okB && !bytes.Equal(pa.Data(), pb.Data())) {
+		d.delta.Changes = append(d.delta.Changes, DagChange{Type: dagutils.Mod, Path: p, Before: a, After: b})
+	}
+	return nil
+}
+
+// linksByName returns the links of nd by name, or by index for the unnamed
+// links and the links whose name is already taken.
+func linksByName(nd ipld.Node) map[string]cid.Cid {
+	links := make(map[string]cid.Cid)
+	for i, l := range nd.Links() {
+		name := l.Name
+		if _, taken := links[name]; name == "" || taken {
+			name = strconv.Itoa(i)
+		}
+		links[name] = l.Cid
+	}
+	return links
+}
+
+// walk appends the blocks of the DAG c not seen yet to blocks, but for the
+// shared subtrees.
+func (d *dagDiff) walk(c cid.Cid, seen *cid.Set, blocks *[]walkedBlock) error {
+	if d.shared.Has(c) || !seen.Visit(c) {
+		return nil
+	}
+	nd, err := d.dag.Get(d.ctx, c)
+	if err != nil {
+		return err
+	}
+	*blocks = append(*blocks, walkedBlock{cid: c, size: uint64(len(nd.RawData()))})
+	for _, l := range nd.Links() {
+		if err := d.walk(l.Cid, seen, blocks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	cidutil "github.com/ipfs/go-cidutil"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/apierr"
 	"github.com/ipfs/go-ipfs/tracing"
 	dag "github.com/ipfs/go-merkledag"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
@@ -32,7 +33,7 @@ func (api *DhtAPI) FindPeer(ctx context.Context, p peer.ID) (peer.AddrInfo, erro
 
 	pi, err := api.routing.FindPeer(ctx, peer.ID(p))
 	if err != nil {
-		return peer.AddrInfo{}, err
+		return peer.AddrInfo{}, apierr.Wrap(err)
 	}
 
 	return pi, nil
@@ -95,7 +96,7 @@ func (api *DhtAPI) Provide(ctx context.Context, path path.Path, opts ...caopts.D
 	}
 
 	if !has {
-		return fmt.Errorf("block %s not found locally, cannot provide", c)
+		return apierr.New(apierr.NotFound, fmt.Errorf("block %s not found locally, cannot provide", c))
 	}
 
 	if settings.Recursive {
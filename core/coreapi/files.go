@@ -0,0 +1,17 @@
+package coreapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ipfs/go-ipfs/mfswatch"
+)
+
+// WatchFiles returns the changes of the MFS under the path p, from the next
+// change on, until ctx is done.
+func (api *CoreAPI) WatchFiles(ctx context.Context, p string) (<-chan mfswatch.Event, error) {
+	if api.filesWatcher == nil {
+		return nil, errors.New("the MFS of this node is not watched")
+	}
+	return api.filesWatcher.Watch(ctx, p)
+}
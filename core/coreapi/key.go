@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"sort"
 
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	keylock "github.com/ipfs/go-ipfs/keylock"
+	"github.com/ipfs/go-ipfs/remotesign"
 	"github.com/ipfs/go-ipfs/tracing"
 	ipfspath "github.com/ipfs/go-path"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
@@ -40,6 +43,29 @@ func (k *key) ID() peer.ID {
 	return k.peerID
 }
 
+// publicKeyReader is a keystore reading the public keys of its keys while it
+// is locked, as keylock.Keystore does.
+type publicKeyReader interface {
+	PublicKey(name string) (crypto.PubKey, error)
+}
+
+// keyID returns the peer ID of the key name of ks, read from its public key
+// when ks can, so that the keys of a locked keystore are told apart.
+func keyID(ks keystore.Keystore, name string) (peer.ID, error) {
+	if r, ok := ks.(publicKeyReader); ok {
+		pk, err := r.PublicKey(name)
+		if err != nil {
+			return "", err
+		}
+		return peer.IDFromPublicKey(pk)
+	}
+	sk, err := ks.Get(name)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(sk)
+}
+
 // Generate generates new key, stores it in the keystore under the specified
 // name and returns a base58 encoded multihash of its public key.
 func (api *KeyAPI) Generate(ctx context.Context, name string, opts ...caopts.KeyGenerateOption) (coreiface.Key, error) {
@@ -55,8 +81,11 @@ func (api *KeyAPI) Generate(ctx context.Context, name string, opts ...caopts.Key
 		return nil, fmt.Errorf("cannot create key with name 'self'")
 	}
 
-	_, err = api.repo.Keystore().Get(name)
-	if err == nil {
+	exists, err := api.repo.Keystore().Has(name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
 		return nil, fmt.Errorf("key with name '%s' already exists", name)
 	}
 
@@ -117,14 +146,7 @@ func (api *KeyAPI) List(ctx context.Context) ([]coreiface.Key, error) {
 	out[0] = &key{"self", api.identity}
 
 	for n, k := range keys {
-		privKey, err := api.repo.Keystore().Get(k)
-		if err != nil {
-			return nil, err
-		}
-
-		pubKey := privKey.GetPublic()
-
-		pid, err := peer.IDFromPublicKey(pubKey)
+		pid, err := keyID(api.repo.Keystore(), k)
 		if err != nil {
 			return nil, err
 		}
@@ -157,9 +179,16 @@ func (api *KeyAPI) Rename(ctx context.Context, oldName string, newName string, o
 	}
 
 	oldKey, err := ks.Get(oldName)
+	if errors.Is(err, keylock.ErrLocked) {
+		return nil, false, err
+	}
 	if err != nil {
 		return nil, false, fmt.Errorf("no key named %s was found", oldName)
 	}
+	// a remote key is configured, it is not moved in the keystore
+	if _, ok := oldKey.(*remotesign.Signer); ok {
+		return nil, false, remotesign.ErrRemoteKey
+	}
 
 	pubKey := oldKey.GetPublic()
 
@@ -209,18 +238,11 @@ func (api *KeyAPI) Remove(ctx context.Context, name string) (coreiface.Key, erro
 		return nil, fmt.Errorf("cannot remove key with name 'self'")
 	}
 
-	removed, err := ks.Get(name)
+	pid, err := keyID(ks, name)
 	if err != nil {
 		return nil, fmt.Errorf("no key named %s was found", name)
 	}
 
-	pubKey := removed.GetPublic()
-
-	pid, err := peer.IDFromPublicKey(pubKey)
-	if err != nil {
-		return nil, err
-	}
-
 	err = ks.Delete(name)
 	if err != nil {
 		return nil, err
@@ -3,10 +3,13 @@ package coreapi
 import (
 	"context"
 	"fmt"
+	"net"
 	"strings"
 	"time"
 
 	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/ipfs/go-ipfs/apierr"
+	"github.com/ipfs/go-ipfs/ipnscache"
 	"github.com/ipfs/go-ipfs/tracing"
 	"github.com/ipfs/go-namesys"
 	"go.opentelemetry.io/otel/attribute"
@@ -113,7 +116,7 @@ func (api *NameAPI) Search(ctx context.Context, name string, opts ...caopts.Name
 
 	var resolver namesys.Resolver = api.namesys
 	if !options.Cache {
-		resolver, err = namesys.NewNameSystem(api.routing,
+		resolver, err = namesys.NewNameSystem(ipnscache.NewValueStore(api.routing, api.repo.Datastore()),
 			namesys.WithDatastore(api.repo.Datastore()),
 			namesys.WithDNSResolver(api.dnsResolver))
 		if err != nil {
@@ -164,7 +167,7 @@ func (api *NameAPI) Resolve(ctx context.Context, name string, opts ...caopts.Nam
 		}
 	}
 
-	return p, err
+	return p, apierr.Wrap(err)
 }
 
 func keylookup(self ci.PrivKey, kstore keystore.Keystore, k string) (ci.PrivKey, error) {
@@ -211,20 +214,27 @@ func keylookup(self ci.PrivKey, kstore keystore.Keystore, k string) (ci.PrivKey,
 
 	// Then, look in the keystore.
 	for _, key := range keys {
-		privKey, err := kstore.Get(key)
-		if err != nil {
-			return nil, err
-		}
-
-		pid, err := peer.IDFromPrivateKey(privKey)
+		pid, err := keyID(kstore, key)
 		if err != nil {
 			return nil, err
 		}
 
 		if targetPid == pid {
-			return privKey, nil
+			return kstore.Get(key)
 		}
 	}
 
 	return nil, fmt.Errorf("no key by the given name or PeerID was found")
 }
+
+// offlineDNSResolver fails the DNS lookups of the APIs running offline, the
+// DNSLink names needing the network to be resolved.
+type offlineDNSResolver struct{}
+
+func (offlineDNSResolver) LookupIPAddr(_ context.Context, domain string) ([]net.IPAddr, error) {
+	return nil, &apierr.NetworkRequiredError{What: "DNS record of " + domain, Err: coreiface.ErrOffline}
+}
+
+func (offlineDNSResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return nil, &apierr.NetworkRequiredError{What: "DNS record of " + name, Err: coreiface.ErrOffline}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	gopath "path"
 
+	"github.com/ipfs/go-ipfs/apierr"
+	"github.com/ipfs/go-ipfs/namespaces"
 	"github.com/ipfs/go-ipfs/tracing"
 	"github.com/ipfs/go-namesys/resolve"
 
@@ -16,7 +18,6 @@ import (
 	ipld "github.com/ipfs/go-ipld-format"
 	ipfspath "github.com/ipfs/go-path"
 	ipfspathresolver "github.com/ipfs/go-path/resolver"
-	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	path "github.com/ipfs/interface-go-ipfs-core/path"
 )
 
@@ -33,7 +34,7 @@ func (api *CoreAPI) ResolveNode(ctx context.Context, p path.Path) (ipld.Node, er
 
 	node, err := api.dag.Get(ctx, rp.Cid())
 	if err != nil {
-		return nil, err
+		return nil, apierr.Wrap(err)
 	}
 	return node, nil
 }
@@ -47,20 +48,25 @@ func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (path.Resolved
 	if _, ok := p.(path.Resolved); ok {
 		return p.(path.Resolved), nil
 	}
+	// the names of the namespaces added by plugins, next to /ipns
+	p, err := namespaces.Resolve(ctx, p)
+	if err != nil {
+		return nil, apierr.Wrap(err)
+	}
 	if err := p.IsValid(); err != nil {
-		return nil, err
+		return nil, apierr.New(apierr.InvalidPath, err)
 	}
 
 	ipath := ipfspath.Path(p.String())
-	ipath, err := resolve.ResolveIPNS(ctx, api.namesys, ipath)
+	ipath, err = resolve.ResolveIPNS(ctx, api.namesys, ipath)
 	if err == resolve.ErrNoNamesys {
-		return nil, coreiface.ErrOffline
+		return nil, errOffline
 	} else if err != nil {
-		return nil, err
+		return nil, apierr.Wrap(err)
 	}
 
 	if ipath.Segments()[0] != "ipfs" && ipath.Segments()[0] != "ipld" {
-		return nil, fmt.Errorf("unsupported path namespace: %s", p.Namespace())
+		return nil, apierr.New(apierr.InvalidPath, fmt.Errorf("unsupported path namespace: %s", p.Namespace()))
 	}
 
 	var dataFetcher fetcher.Factory
@@ -73,12 +79,12 @@ func (api *CoreAPI) ResolvePath(ctx context.Context, p path.Path) (path.Resolved
 
 	node, rest, err := resolver.ResolveToLastNode(ctx, ipath)
 	if err != nil {
-		return nil, err
+		return nil, apierr.Wrap(err)
 	}
 
 	root, err := cid.Parse(ipath.Segments()[1])
 	if err != nil {
-		return nil, err
+		return nil, apierr.New(apierr.InvalidPath, err)
 	}
 
 	return path.NewResolvedPath(ipath, node, root, gopath.Join(rest...)), nil
@@ -3,11 +3,15 @@ package coreapi
 import (
 	"context"
 	"fmt"
+	"time"
 
 	bserv "github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/follow"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
 	"github.com/ipfs/go-ipfs/tracing"
 	"github.com/ipfs/go-merkledag"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
@@ -19,13 +23,40 @@ import (
 
 type PinAPI CoreAPI
 
+// Add pins p. A pin which was expiring no longer expires, and a pin added by
+// a pinset follower is no longer removed by it.
 func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOption) error {
+	return api.add(ctx, p, func(c cid.Cid) error {
+		if api.expiringPins == nil {
+			return nil
+		}
+		_, err := api.expiringPins.Remove(ctx, c)
+		return err
+	}, opts...)
+}
+
+// AddExpiring pins p like Add, and makes the pin expire according to the
+// expiry class if set, and at expires if not zero. The pin is removed by the
+// daemon, or by the next garbage collection, once it has expired.
+func (api *PinAPI) AddExpiring(ctx context.Context, p path.Path, class string, expires time.Time, opts ...caopts.PinAddOption) error {
+	if api.expiringPins == nil {
+		return fmt.Errorf("pin: expiring pins are not supported by this node")
+	}
+	return api.add(ctx, p, func(c cid.Cid) error {
+		return api.expiringPins.Add(ctx, c, class, expires)
+	}, opts...)
+}
+
+// add pins p, and records the expiry of the pin of its CID with expire under
+// the same pin lock, so that the expiry policy sees the pin and its expiry
+// together. The pin is taken over from the pinset followers.
+func (api *PinAPI) add(ctx context.Context, p path.Path, expire func(c cid.Cid) error, opts ...caopts.PinAddOption) error {
 	ctx, span := tracing.Span(ctx, "CoreAPI.PinAPI", "Add", trace.WithAttributes(attribute.String("path", p.String())))
 	defer span.End()
 
 	dagNode, err := api.core().ResolveNode(ctx, p)
 	if err != nil {
-		return fmt.Errorf("pin: %s", err)
+		return fmt.Errorf("pin: %w", err)
 	}
 
 	settings, err := caopts.PinAddOptions(opts...)
@@ -39,7 +70,15 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 
 	err = api.pinning.Pin(ctx, dagNode, settings.Recursive)
 	if err != nil {
-		return fmt.Errorf("pin: %s", err)
+		return fmt.Errorf("pin: %w", err)
+	}
+	if err := expire(dagNode.Cid()); err != nil {
+		return fmt.Errorf("pin: %w", err)
+	}
+	if settings.Recursive {
+		if err := follow.Release(ctx, api.repo.Datastore(), dagNode.Cid()); err != nil {
+			return fmt.Errorf("pin: %w", err)
+		}
 	}
 
 	if err := api.provider.Provide(dagNode.Cid()); err != nil {
@@ -49,6 +88,31 @@ func (api *PinAPI) Add(ctx context.Context, p path.Path, opts ...caopts.PinAddOp
 	return api.pinning.Flush(ctx)
 }
 
+// SetMeta names and labels the pin of p, replacing its previous name and
+// labels. No name and labels remove them.
+func (api *PinAPI) SetMeta(ctx context.Context, p path.Path, name string, labels map[string]string) error {
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return err
+	}
+	return api.pinMeta.Set(ctx, pinmeta.Meta{Root: rp.Cid(), Name: name, Labels: labels})
+}
+
+// Meta returns the name and labels of the pin of p, if any.
+func (api *PinAPI) Meta(ctx context.Context, p path.Path) (pinmeta.Meta, bool, error) {
+	rp, err := api.core().ResolvePath(ctx, p)
+	if err != nil {
+		return pinmeta.Meta{}, false, err
+	}
+	return api.pinMeta.Get(ctx, rp.Cid())
+}
+
+// LsMeta returns the name and labels of the pins selected by f, sorted by
+// root.
+func (api *PinAPI) LsMeta(ctx context.Context, f pinmeta.Filter) ([]pinmeta.Meta, error) {
+	return api.pinMeta.List(ctx, f)
+}
+
 func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) (<-chan coreiface.Pin, error) {
 	ctx, span := tracing.Span(ctx, "CoreAPI.PinAPI", "Ls")
 	defer span.End()
@@ -66,7 +130,8 @@ func (api *PinAPI) Ls(ctx context.Context, opts ...caopts.PinLsOption) (<-chan c
 		return nil, fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", settings.Type)
 	}
 
-	return api.pinLsAll(ctx, settings.Type), nil
+	// listing indirect pins walks the pinned DAGs, which is not an access
+	return api.pinLsAll(expiry.Untracked(ctx), settings.Type), nil
 }
 
 func (api *PinAPI) IsPinned(ctx context.Context, p path.Path, opts ...caopts.PinIsPinnedOption) (string, bool, error) {
@@ -90,7 +155,7 @@ func (api *PinAPI) IsPinned(ctx context.Context, p path.Path, opts ...caopts.Pin
 		return "", false, fmt.Errorf("invalid type '%s', must be one of {direct, indirect, recursive, all}", settings.WithType)
 	}
 
-	return api.pinning.IsPinnedWithType(ctx, resolved.Cid(), mode)
+	return api.pinning.IsPinnedWithType(expiry.Untracked(ctx), resolved.Cid(), mode)
 }
 
 // Rm pin rm api
@@ -187,6 +252,8 @@ func (api *PinAPI) Verify(ctx context.Context) (<-chan coreiface.PinStatus, erro
 	ctx, span := tracing.Span(ctx, "CoreAPI.PinAPI", "Verify")
 	defer span.End()
 
+	ctx = expiry.Untracked(ctx)
+
 	visited := make(map[cid.Cid]*pinStatus)
 	bs := api.blockstore
 	DAG := merkledag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
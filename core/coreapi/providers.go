@@ -0,0 +1,99 @@
+package coreapi
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-ipfs/tracing"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MaxProviderHints is the most providers given with a request that are
+	// dialed.
+	MaxProviderHints = 8
+	// providerHintsTimeout bounds the wait for the providers given with a
+	// request to be connected.
+	providerHintsTimeout = 5 * time.Second
+
+	providerHintTag    = "provider-hint"
+	providerHintWeight = 10
+)
+
+// ParseProviderHints parses the multiaddrs of the providers given with a
+// request, each ending with /p2p/ and the peer ID of the provider, and
+// separated by commas. The addresses of the same peer are merged.
+func ParseProviderHints(hints []string) ([]peer.AddrInfo, error) {
+	var addrs []ma.Multiaddr
+	for _, h := range hints {
+		for _, s := range strings.Split(h, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid provider address %q: %w", s, err)
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid provider address: %w", err)
+	}
+	if len(infos) > MaxProviderHints {
+		return nil, fmt.Errorf("too many providers: %d, at most %d are accepted", len(infos), MaxProviderHints)
+	}
+	return infos, nil
+}
+
+// ConnectProviders connects to the providers given by the caller of a
+// request, so that they are asked for its blocks before any provider is
+// looked for: the exchange sessions first ask the peers connected. It waits
+// for the connections for a few seconds at most, and returns how many
+// providers are connected: the blocks are found as usual when the providers
+// fail to connect.
+func (api *CoreAPI) ConnectProviders(ctx context.Context, infos []peer.AddrInfo) (int, error) {
+	ctx, span := tracing.Span(ctx, "CoreAPI", "ConnectProviders", trace.WithAttributes(attribute.Int("providers", len(infos))))
+	defer span.End()
+
+	if len(infos) == 0 {
+		return 0, nil
+	}
+	if api.peerHost == nil {
+		return 0, errOffline
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, providerHintsTimeout)
+	defer cancel()
+	var (
+		wg        sync.WaitGroup
+		connected int32
+	)
+	for _, pi := range infos {
+		if pi.ID == api.identity {
+			continue
+		}
+		wg.Add(1)
+		go func(pi peer.AddrInfo) {
+			defer wg.Done()
+			if err := api.peerHost.Connect(ctx, pi); err != nil {
+				return
+			}
+			// kept while the blocks are fetched from it
+			api.peerHost.ConnManager().TagPeer(pi.ID, providerHintTag, providerHintWeight)
+			atomic.AddInt32(&connected, 1)
+		}(pi)
+	}
+	wg.Wait()
+	span.SetAttributes(attribute.Int("connected", int(connected)))
+	return int(connected), nil
+}
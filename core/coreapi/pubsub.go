@@ -3,7 +3,9 @@ package coreapi
 import (
 	"context"
 	"errors"
+	"fmt"
 
+	"github.com/ipfs/go-ipfs/pubsubhistory"
 	"github.com/ipfs/go-ipfs/tracing"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	caopts "github.com/ipfs/interface-go-ipfs-core/options"
@@ -144,3 +146,94 @@ func (msg *pubSubMessage) Topics() []string {
 	}
 	return []string{*msg.msg.Topic}
 }
+
+// SubscribeReplay subscribes to topic, delivering first the last replay
+// messages of its history. The history of topic must be kept, see
+// Pubsub.History in the config.
+func (api *PubSubAPI) SubscribeReplay(ctx context.Context, topic string, replay int, opts ...caopts.PubSubSubscribeOption) (coreiface.PubSubSubscription, error) {
+	ctx, span := tracing.Span(ctx, "CoreAPI.PubSubAPI", "SubscribeReplay", trace.WithAttributes(attribute.String("topic", topic), attribute.Int("replay", replay)))
+	defer span.End()
+
+	if _, err := api.checkNode(); err != nil {
+		return nil, err
+	}
+	if api.pubsubHistory == nil || !api.pubsubHistory.Keeps(topic) {
+		return nil, fmt.Errorf("the history of %q is not kept, see Pubsub.History", topic)
+	}
+
+	// subscribed before reading the history, so that no message falls
+	// between the two
+	sub, err := api.Subscribe(ctx, topic, opts...)
+	if err != nil {
+		return nil, err
+	}
+	history, err := api.pubsubHistory.Last(ctx, topic, replay)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	replayed := make(map[string]struct{}, len(history))
+	for _, m := range history {
+		replayed[m.ID()] = struct{}{}
+	}
+	return &replaySubscription{
+		PubSubSubscription: sub,
+		topic:              topic,
+		history:            history,
+		replayed:           replayed,
+	}, nil
+}
+
+// replaySubscription delivers the messages of its history, then those of
+// its subscription not replayed already.
+type replaySubscription struct {
+	coreiface.PubSubSubscription
+	topic    string
+	history  []*pubsubhistory.Message
+	replayed map[string]struct{}
+}
+
+func (sub *replaySubscription) Next(ctx context.Context) (coreiface.PubSubMessage, error) {
+	if len(sub.history) > 0 {
+		m := sub.history[0]
+		sub.history = sub.history[1:]
+		return &historyMessage{m, sub.topic}, nil
+	}
+	for {
+		msg, err := sub.PubSubSubscription.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(sub.replayed) > 0 {
+			id := string(msg.From()) + string(msg.Seq())
+			if _, ok := sub.replayed[id]; ok {
+				delete(sub.replayed, id)
+				continue
+			}
+		}
+		return msg, nil
+	}
+}
+
+// historyMessage is a message of the history of topic.
+type historyMessage struct {
+	msg   *pubsubhistory.Message
+	topic string
+}
+
+func (msg *historyMessage) From() peer.ID {
+	return msg.msg.From
+}
+
+func (msg *historyMessage) Data() []byte {
+	return msg.msg.Data
+}
+
+func (msg *historyMessage) Seq() []byte {
+	return msg.msg.Seqno
+}
+
+func (msg *historyMessage) Topics() []string {
+	return []string{msg.topic}
+}
@@ -0,0 +1,104 @@
+package coreapi
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	ipld "github.com/ipfs/go-ipld-format"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// FetchSession is an api backed by the same node, fetching the blocks it is
+// missing with a single exchange session, as the gateway does for the requests
+// under the same root. The calls for the content under its root, such as Cat
+// and Ls, share the providers found instead of each looking for them.
+type FetchSession struct {
+	*CoreAPI
+
+	root   path.Resolved
+	cancel context.CancelFunc
+}
+
+// NewFetchSession opens a fetch session for root, lasting until ctx is done or
+// Close is called. The hints are the paths under root likely to be accessed:
+// their nodes and the children of these are fetched in the background.
+func (api *CoreAPI) NewFetchSession(ctx context.Context, root path.Path, hints ...string) (*FetchSession, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	sesApi := api
+	if sx, ok := api.blocks.Exchange().(exchange.SessionExchange); ok {
+		sesApi = api.WithExchange(&sessionExchange{Interface: sx, session: sx.NewSession(ctx)})
+	}
+
+	rp, err := sesApi.ResolvePath(ctx, root)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	s := &FetchSession{CoreAPI: sesApi, root: rp, cancel: cancel}
+	if len(hints) > 0 {
+		go s.prefetch(ctx, hints)
+	}
+	return s, nil
+}
+
+// Root returns the resolved root of the session.
+func (s *FetchSession) Root() path.Resolved {
+	return s.root
+}
+
+// Close ends the session.
+func (s *FetchSession) Close() error {
+	s.cancel()
+	return nil
+}
+
+// prefetch fetches the nodes at hints, and their children.
+func (s *FetchSession) prefetch(ctx context.Context, hints []string) {
+	for _, h := range hints {
+		nd, err := s.ResolveNode(ctx, path.Join(s.root, h))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// a hint is only a hint, the path may well not exist
+			continue
+		}
+		for _, p := range ipld.GetDAG(ctx, s.dag, nd) {
+			if _, err := p.Get(ctx); err != nil && ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// sessionExchange fetches the blocks with session. The sessions of the block
+// service fetch with it too, as the block service only fetches the blocks of
+// its sessions with a session exchange.
+type sessionExchange struct {
+	exchange.Interface
+	session exchange.Fetcher
+}
+
+// GetBlock fetches c with the session.
+func (e *sessionExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.session.GetBlock(ctx, c)
+}
+
+// GetBlocks fetches cs with the session.
+func (e *sessionExchange) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	return e.session.GetBlocks(ctx, cs)
+}
+
+// NewSession returns the exchange itself.
+func (e *sessionExchange) NewSession(context.Context) exchange.Fetcher {
+	return e
+}
+
+// Close does nothing, the exchange is the node's.
+func (e *sessionExchange) Close() error {
+	return nil
+}
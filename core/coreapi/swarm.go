@@ -2,9 +2,12 @@ package coreapi
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"time"
 
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/connpolicy"
 	"github.com/ipfs/go-ipfs/tracing"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	inet "github.com/libp2p/go-libp2p-core/network"
@@ -37,7 +40,7 @@ func (api *SwarmAPI) Connect(ctx context.Context, pi peer.AddrInfo) error {
 	defer span.End()
 
 	if api.peerHost == nil {
-		return coreiface.ErrOffline
+		return errOffline
 	}
 
 	if swrm, ok := api.peerHost.Network().(*swarm.Swarm); ok {
@@ -57,7 +60,7 @@ func (api *SwarmAPI) Disconnect(ctx context.Context, addr ma.Multiaddr) error {
 	defer span.End()
 
 	if api.peerHost == nil {
-		return coreiface.ErrOffline
+		return errOffline
 	}
 
 	taddr, id := peer.SplitAddr(addr)
@@ -92,7 +95,7 @@ func (api *SwarmAPI) KnownAddrs(ctx context.Context) (map[peer.ID][]ma.Multiaddr
 	defer span.End()
 
 	if api.peerHost == nil {
-		return nil, coreiface.ErrOffline
+		return nil, errOffline
 	}
 
 	addrs := make(map[peer.ID][]ma.Multiaddr)
@@ -112,7 +115,7 @@ func (api *SwarmAPI) LocalAddrs(ctx context.Context) ([]ma.Multiaddr, error) {
 	defer span.End()
 
 	if api.peerHost == nil {
-		return nil, coreiface.ErrOffline
+		return nil, errOffline
 	}
 
 	return api.peerHost.Addrs(), nil
@@ -123,7 +126,7 @@ func (api *SwarmAPI) ListenAddrs(ctx context.Context) ([]ma.Multiaddr, error) {
 	defer span.End()
 
 	if api.peerHost == nil {
-		return nil, coreiface.ErrOffline
+		return nil, errOffline
 	}
 
 	return api.peerHost.Network().InterfaceListenAddresses()
@@ -134,7 +137,7 @@ func (api *SwarmAPI) Peers(ctx context.Context) ([]coreiface.ConnectionInfo, err
 	defer span.End()
 
 	if api.peerHost == nil {
-		return nil, coreiface.ErrOffline
+		return nil, errOffline
 	}
 
 	conns := api.peerHost.Network().Conns()
@@ -191,3 +194,134 @@ func (ci *connInfo) Streams() ([]protocol.ID, error) {
 
 	return out, nil
 }
+
+// TagPeer tags p with tag and weight, for the connection manager to prune
+// the peers with the lowest weights first and apply the policy of tag. The
+// tag is persisted in Swarm.ConnMgr.Peers of the config.
+func (api *SwarmAPI) TagPeer(ctx context.Context, p peer.ID, tag string, weight int) error {
+	_, span := tracing.Span(ctx, "CoreAPI.SwarmAPI", "TagPeer", trace.WithAttributes(attribute.String("peerid", p.String()), attribute.String("tag", tag)))
+	defer span.End()
+
+	if api.connPolicy == nil {
+		return errOffline
+	}
+	if tag == "" {
+		return errors.New("the tag cannot be empty")
+	}
+
+	if err := api.setPeerTag(p, tag, weight, true); err != nil {
+		return err
+	}
+	api.connPolicy.Tag(p, tag, weight)
+	return nil
+}
+
+// UntagPeer removes the tag of p, from the config too.
+func (api *SwarmAPI) UntagPeer(ctx context.Context, p peer.ID, tag string) error {
+	_, span := tracing.Span(ctx, "CoreAPI.SwarmAPI", "UntagPeer", trace.WithAttributes(attribute.String("peerid", p.String()), attribute.String("tag", tag)))
+	defer span.End()
+
+	if api.connPolicy == nil {
+		return errOffline
+	}
+
+	if err := api.setPeerTag(p, tag, 0, false); err != nil {
+		return err
+	}
+	api.connPolicy.Untag(p, tag)
+	return nil
+}
+
+// setPeerTag sets or removes the tag of p in the config. The peers are set
+// as a whole, for the tags removed not to be merged back from the config
+// file.
+func (api *SwarmAPI) setPeerTag(p peer.ID, tag string, weight int, set bool) error {
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return err
+	}
+	// copied, the config being shared
+	peers := make(map[string]map[string]int, len(cfg.Swarm.ConnMgr.Peers)+1)
+	for pid, tags := range cfg.Swarm.ConnMgr.Peers {
+		peers[pid] = make(map[string]int, len(tags)+1)
+		for t, w := range tags {
+			peers[pid][t] = w
+		}
+	}
+	if set {
+		if peers[p.String()] == nil {
+			peers[p.String()] = make(map[string]int)
+		}
+		peers[p.String()][tag] = weight
+	} else {
+		if _, ok := peers[p.String()][tag]; !ok {
+			return nil
+		}
+		delete(peers[p.String()], tag)
+		if len(peers[p.String()]) == 0 {
+			delete(peers, p.String())
+		}
+	}
+	return api.repo.SetConfigKey("Swarm.ConnMgr.Peers", peers)
+}
+
+// PeerTags returns the tags of the peers, by peer and tag.
+func (api *SwarmAPI) PeerTags(ctx context.Context) ([]connpolicy.PeerTag, error) {
+	_, span := tracing.Span(ctx, "CoreAPI.SwarmAPI", "PeerTags")
+	defer span.End()
+
+	if api.connPolicy == nil {
+		return nil, errOffline
+	}
+	return api.connPolicy.Tags(), nil
+}
+
+// TagPolicy returns the policy of the peers with tag, as in the config.
+func (api *SwarmAPI) TagPolicy(ctx context.Context, tag string) (config.ConnMgrTag, error) {
+	_, span := tracing.Span(ctx, "CoreAPI.SwarmAPI", "TagPolicy", trace.WithAttributes(attribute.String("tag", tag)))
+	defer span.End()
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return config.ConnMgrTag{}, err
+	}
+	return cfg.Swarm.ConnMgr.Tags[tag], nil
+}
+
+// SetTagPolicy sets the policy of the peers with tag, persisted in
+// Swarm.ConnMgr.Tags of the config. An empty policy removes it.
+func (api *SwarmAPI) SetTagPolicy(ctx context.Context, tag string, policy config.ConnMgrTag) error {
+	_, span := tracing.Span(ctx, "CoreAPI.SwarmAPI", "SetTagPolicy", trace.WithAttributes(attribute.String("tag", tag)))
+	defer span.End()
+
+	if api.connPolicy == nil {
+		return errOffline
+	}
+	if tag == "" {
+		return errors.New("the tag cannot be empty")
+	}
+	p, err := connpolicy.PolicyFromConfig(policy)
+	if err != nil {
+		return err
+	}
+	// checked before being persisted
+	if err := api.connPolicy.SetPolicy(tag, p); err != nil {
+		return err
+	}
+
+	cfg, err := api.repo.Config()
+	if err != nil {
+		return err
+	}
+	// copied, the config being shared
+	tags := make(map[string]config.ConnMgrTag, len(cfg.Swarm.ConnMgr.Tags)+1)
+	for t, tp := range cfg.Swarm.ConnMgr.Tags {
+		tags[t] = tp
+	}
+	if p == (connpolicy.Policy{}) {
+		delete(tags, tag)
+	} else {
+		tags[tag] = policy
+	}
+	return api.repo.SetConfigKey("Swarm.ConnMgr.Tags", tags)
+}
@@ -0,0 +1,104 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-merkledag/dagutils"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+func TestDagDiff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apis, err := NodeProvider{}.MakeAPISwarm(ctx, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := apis[0].(*coreapi.CoreAPI)
+
+	node := func(data string, links ...ipld.Node) ipld.Node {
+		nd := dag.NodeWithData([]byte(data))
+		for _, l := range links {
+			if err := nd.AddRawLink("", &ipld.Link{Cid: l.Cid()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := api.Dag().Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+	named := func(data string, links map[string]ipld.Node) ipld.Node {
+		nd := dag.NodeWithData([]byte(data))
+		for name, l := range links {
+			if err := nd.AddNodeLink(name, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := api.Dag().Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		return nd
+	}
+
+	shared := node("shared", node("shared chunk"))
+	chunk1 := node("chunk 1")
+	chunk2 := node("chunk 2")
+	fileA := node("file", chunk1, chunk2)
+	chunk2B := node("chunk 2 changed")
+	chunk3 := node("chunk 3")
+	fileB := node("file", chunk1, chunk2B, chunk3)
+	goneChunk := node("gone chunk")
+	gone := node("gone", goneChunk)
+	a := named("dir", map[string]ipld.Node{"shared": shared, "file": fileA, "gone": gone})
+	b := named("dir changed", map[string]ipld.Node{"shared": shared, "file": fileB})
+
+	delta, err := api.DagDiff(ctx, path.IpfsPath(a.Cid()), path.IpfsPath(b.Cid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []coreapi.DagChange{
+		// the data of the root changed, as well as its links
+		{Type: dagutils.Mod, Path: "/", Before: a.Cid(), After: b.Cid()},
+		{Type: dagutils.Mod, Path: "/file/1", Before: chunk2.Cid(), After: chunk2B.Cid()},
+		{Type: dagutils.Add, Path: "/file/2", After: chunk3.Cid()},
+		{Type: dagutils.Remove, Path: "/gone", Before: gone.Cid()},
+	}
+	if len(delta.Changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %+v", len(expected), delta.Changes)
+	}
+	for i, c := range delta.Changes {
+		if c != expected[i] {
+			t.Errorf("expected the change %+v, got %+v", expected[i], c)
+		}
+	}
+
+	checkBlocks := func(kind string, got []cid.Cid, size uint64, expected ...ipld.Node) {
+		t.Helper()
+		set := cid.NewSet()
+		for _, c := range got {
+			set.Add(c)
+		}
+		var expectedSize uint64
+		for _, nd := range expected {
+			expectedSize += uint64(len(nd.RawData()))
+			if !set.Has(nd.Cid()) {
+				t.Fatalf("expected the %s block %s, got %v", kind, nd.Cid(), got)
+			}
+		}
+		if len(got) != len(expected) || size != expectedSize {
+			t.Fatalf("expected %d %s blocks of %d bytes, got %d of %d bytes", len(expected), kind, expectedSize, len(got), size)
+		}
+	}
+	// the chunk shared by the files is neither added nor removed
+	checkBlocks("added", delta.Added, delta.AddedSize, b, fileB, chunk2B, chunk3)
+	checkBlocks("removed", delta.Removed, delta.RemovedSize, a, fileA, chunk2, gone, goneChunk)
+}
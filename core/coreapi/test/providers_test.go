@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestParseProviderHints(t *testing.T) {
+	const id = "12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"
+	infos, err := coreapi.ParseProviderHints([]string{
+		"/ip4/1.2.3.4/tcp/4001/p2p/" + id + ", /ip4/1.2.3.4/udp/4001/quic/p2p/" + id,
+		"",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].ID.String() != id || len(infos[0].Addrs) != 2 {
+		t.Fatalf("expected the addresses merged, got %v", infos)
+	}
+
+	var many []string
+	for i := 0; i <= coreapi.MaxProviderHints; i++ {
+		_, pk, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pid, err := peer.IDFromPublicKey(pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		many = append(many, fmt.Sprintf("/ip4/1.2.3.4/tcp/4001/p2p/%s", pid))
+	}
+	for _, hints := range [][]string{
+		{"/ip4/1.2.3.4/tcp/4001"},
+		{"not an address"},
+		{strings.Join(many, ",")},
+	} {
+		if _, err := coreapi.ParseProviderHints(hints); err == nil {
+			t.Errorf("expected %v to fail", hints)
+		}
+	}
+}
+
+func TestConnectProviders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the nodes 1 and 2 are only connected to the node 0
+	apis, err := NodeProvider{}.MakeAPISwarm(ctx, true, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := apis[2].Unixfs().Add(ctx, files.NewBytesFile([]byte("hinted")), options.Unixfs.Pin(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	self, err := apis[2].Key().Self(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs, err := apis[2].Swarm().LocalAddrs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hints []string
+	for _, a := range addrs {
+		hints = append(hints, fmt.Sprintf("%s/p2p/%s", a, self.ID()))
+	}
+	infos, err := coreapi.ParseProviderHints(hints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := apis[1].(*coreapi.CoreAPI)
+	n, err := api.ConnectProviders(ctx, infos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || !connected(ctx, t, api, self.ID()) {
+		t.Fatalf("expected the provider connected, got %d", n)
+	}
+	if _, err := api.Unixfs().Get(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	offline, err := apis[1].WithOptions(options.Api.Offline(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offline.(*coreapi.CoreAPI).ConnectProviders(ctx, infos); err == nil {
+		t.Fatal("expected an offline api to fail")
+	}
+}
+
+func connected(ctx context.Context, t *testing.T, api *coreapi.CoreAPI, p peer.ID) bool {
+	conns, err := api.Swarm().Peers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range conns {
+		if c.ID() == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/interface-go-ipfs-core/options"
+	"github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+func TestFetchSession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	apis, err := NodeProvider{}.MakeAPISwarm(ctx, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"index.html": files.NewBytesFile([]byte("<html></html>")),
+		"style.css":  files.NewBytesFile([]byte("body {}")),
+	})
+	root, err := apis[0].Unixfs().Add(ctx, dir, options.Unixfs.Pin(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ses, err := apis[1].(*coreapi.CoreAPI).NewFetchSession(ctx, root, "style.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ses.Close()
+	if !ses.Root().Cid().Equals(root.Cid()) {
+		t.Fatalf("expected the session root %s, got %s", root, ses.Root())
+	}
+
+	// the hint is fetched in the background
+	offline, err := apis[1].WithOptions(options.Api.FetchBlocks(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		_, err := offline.Unixfs().Get(ctx, path.Join(root, "style.css"))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hint not prefetched: %s", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entries, err := ses.Unixfs().Ls(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for e := range entries {
+		if e.Err != nil {
+			t.Fatal(e.Err)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+
+	nd, err := ses.Unixfs().Get(ctx, path.Join(root, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(nd.(files.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<html></html>" {
+		t.Fatalf("unexpected content %q", data)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/tracing"
@@ -11,6 +12,7 @@ import (
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ipfs/go-ipfs/core/coreunix"
+	"github.com/ipfs/go-ipfs/pinning/follow"
 
 	blockservice "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
@@ -58,6 +60,42 @@ func getOrCreateNilNode() (*core.IpfsNode, error) {
 // Add builds a merkledag node from a reader, adds it to the blockstore,
 // and returns the key representing that node.
 func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options.UnixfsAddOption) (path.Resolved, error) {
+	return api.AddParallel(ctx, files, 1, opts...)
+}
+
+// AddParallel adds files like Add, chunking and hashing up to workers files of
+// the directories at once. The CIDs are the same whatever the workers.
+func (api *UnixfsAPI) AddParallel(ctx context.Context, files files.Node, workers int, opts ...options.UnixfsAddOption) (path.Resolved, error) {
+	return api.AddResumable(ctx, files, nil, workers, opts...)
+}
+
+// AddResumable adds files like AddParallel, recording the files added in
+// session if set, and skipping those it recorded already.
+func (api *UnixfsAPI) AddResumable(ctx context.Context, files files.Node, session *coreunix.Session, workers int, opts ...options.UnixfsAddOption) (path.Resolved, error) {
+	return api.AddWith(ctx, files, AddSettings{Workers: workers, Session: session}, opts...)
+}
+
+// AddSettings are the settings of an import beyond the options of the
+// CoreAPI.
+type AddSettings struct {
+	// Workers is how many files of the directories are chunked and hashed at
+	// once.
+	Workers int
+	// Session, if set, records the files added, and skips those it recorded
+	// already.
+	Session *coreunix.Session
+	// PreserveMode and PreserveMtime keep the mode and the modification time
+	// of the files read from the disk in their UnixFS metadata.
+	PreserveMode  bool
+	PreserveMtime bool
+	// ExpireClass, if set, makes the pin of the root expire according to
+	// this expiry class. Otherwise, the expiry the pin had is removed.
+	ExpireClass string
+}
+
+// AddWith adds files like Add, with the settings s.
+func (api *UnixfsAPI) AddWith(ctx context.Context, files files.Node, s AddSettings, opts ...options.UnixfsAddOption) (path.Resolved, error) {
+	workers, session := s.Workers, s.Session
 	ctx, span := tracing.Span(ctx, "CoreAPI.UnixfsAPI", "Add")
 	defer span.End()
 
@@ -80,6 +118,10 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		attribute.Bool("nocopy", settings.NoCopy),
 		attribute.Bool("silent", settings.Silent),
 		attribute.Bool("progress", settings.Progress),
+		attribute.Int("workers", workers),
+		attribute.Bool("resume", session != nil),
+		attribute.Bool("preservemode", s.PreserveMode),
+		attribute.Bool("preservemtime", s.PreserveMtime),
 	)
 
 	cfg, err := api.repo.Config()
@@ -156,6 +198,28 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 	fileAdder.RawLeaves = settings.RawLeaves
 	fileAdder.NoCopy = settings.NoCopy
 	fileAdder.CidBuilder = prefix
+	fileAdder.Workers = workers
+	fileAdder.Resume = session
+	fileAdder.PreserveMode = s.PreserveMode
+	fileAdder.PreserveMtime = s.PreserveMtime
+	if s.ExpireClass != "" && (!fileAdder.Pin || api.expiringPins == nil) {
+		return nil, fmt.Errorf("expiring pins are not supported by this import")
+	}
+	if fileAdder.Pin {
+		fileAdder.PinRecord = func(ctx context.Context, root cid.Cid) error {
+			if err := follow.Release(ctx, api.repo.Datastore(), root); err != nil {
+				return err
+			}
+			switch {
+			case api.expiringPins == nil:
+				return nil
+			case s.ExpireClass != "":
+				return api.expiringPins.Add(ctx, root, s.ExpireClass, time.Time{})
+			}
+			_, err := api.expiringPins.Remove(ctx, root)
+			return err
+		}
+	}
 
 	switch settings.Layout {
 	case options.BalancedLayout:
@@ -186,6 +250,11 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		fileAdder.SetMfsRoot(mr)
 	}
 
+	// the files stored are scanned as they are added
+	if api.addScanner != nil && !settings.OnlyHash {
+		files = api.addScanner.Wrap(ctx, files)
+	}
+
 	nd, err := fileAdder.AddAllAndPin(ctx, files)
 	if err != nil {
 		return nil, err
@@ -195,6 +264,9 @@ func (api *UnixfsAPI) Add(ctx context.Context, files files.Node, opts ...options
 		if err := api.provider.Provide(nd.Cid()); err != nil {
 			return nil, err
 		}
+		if api.lanAnnouncer != nil {
+			api.lanAnnouncer.Announce(nd.Cid())
+		}
 	}
 
 	return path.IpfsPath(nd.Cid()), nil
@@ -144,13 +144,85 @@ func commandsOption(cctx oldcmds.Context, command *cmds.Command, allowGet bool)
 		addCORSFromEnv(cfg)
 		addCORSDefaults(cfg)
 		patchCORSVars(cfg, l.Addr())
+		if len(rcfg.API.Authorizations) > 0 {
+			cfg.AddAllowedHeaders("Authorization")
+		}
+		for name, auth := range rcfg.API.Authorizations {
+			if auth == nil {
+				continue
+			}
+			if err := auth.CheckScopes(); err != nil {
+				return nil, fmt.Errorf("API.Authorizations.%s: %w", name, err)
+			}
+		}
 
-		cmdHandler := cmdsHttp.NewHandler(&cctx, command, cfg)
-		mux.Handle(APIPath+"/", cmdHandler)
+		cmdHandler := withErrorStatus(cmdsHttp.NewHandler(&cctx, command, cfg))
+		// the commands changing the repo are tracked, and declined once the
+		// node is draining
+		handler := withDrain(n, cmdHandler, func(r *http.Request) bool {
+			return changesRepo(command, r)
+		})
+		handler = withMemoryBudget(n, handler, isBudgetedCommand)
+		handler = withTenantUsage(n, handler, nil)
+		handler = withReadOnly(n, command, handler)
+		mux.Handle(APIPath+"/", withAuthorizations(command, handler, func() map[string]*config.RPCAuthScope {
+			cfg, err := n.Repo.Config()
+			if err != nil {
+				log.Errorf("reading the API authorizations: %s", err)
+				return rcfg.API.Authorizations
+			}
+			return cfg.API.Authorizations
+		}))
 		return mux, nil
 	}
 }
 
+// rpcCall is the command of root called by an RPC request.
+type rpcCall struct {
+	// path is the path of the command, e.g. "pin/add"
+	path string
+	// chain holds the commands from root to the called one
+	chain []*cmds.Command
+	// args holds the string arguments, the one given as the last segment of
+	// the URL path first
+	args []string
+}
+
+// parseCall returns the command of root called by r, parsing its path the
+// way the commands handler does: the last segment of the path is an argument
+// when it is not a subcommand, as in /api/v0/pin/add/<cid>. It returns false
+// when r calls no command the handler would run.
+func parseCall(root *cmds.Command, r *http.Request) (rpcCall, bool) {
+	pth := strings.Split(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, APIPath), "/"), "/")
+	chain, err := root.Resolve(pth[:len(pth)-1])
+	if err != nil {
+		return rpcCall{}, false
+	}
+
+	var args []string
+	last := pth[len(pth)-1]
+	if sub := chain[len(chain)-1].Subcommands[last]; sub != nil {
+		chain = append(chain, sub)
+	} else {
+		args = append(args, last)
+		pth = pth[:len(pth)-1]
+	}
+	for _, c := range chain {
+		if c.NoRemote {
+			return rpcCall{}, false
+		}
+	}
+	if chain[len(chain)-1].Run == nil {
+		return rpcCall{}, false
+	}
+
+	return rpcCall{
+		path:  strings.Join(pth, "/"),
+		chain: chain,
+		args:  append(args, r.URL.Query()["arg"]...),
+	}, true
+}
+
 // CommandsOption constructs a ServerOption for hooking the commands into the
 // HTTP server. It will NOT allow GET requests.
 func CommandsOption(cctx oldcmds.Context) ServeOption {
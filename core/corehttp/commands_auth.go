@@ -0,0 +1,157 @@
+package corehttp
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/tenants"
+)
+
+const authSchemeBearer = "Bearer "
+
+// authorizedHandler only lets through the RPC requests carrying the secret of
+// one of the authorizations, for a command of root this authorization
+// allows. The authorizations are looked up for each request, for the
+// authorizations minted and revoked while the daemon runs to apply at once.
+type authorizedHandler struct {
+	next  http.Handler
+	root  *cmds.Command
+	auths func() map[string]*config.RPCAuthScope
+}
+
+func withAuthorizations(root *cmds.Command, next http.Handler, auths func() map[string]*config.RPCAuthScope) http.Handler {
+	return &authorizedHandler{next: next, root: root, auths: auths}
+}
+
+// staticAuthorizations returns the authorizations auths.
+func staticAuthorizations(auths map[string]*config.RPCAuthScope) func() map[string]*config.RPCAuthScope {
+	return func() map[string]*config.RPCAuthScope {
+		return auths
+	}
+}
+
+func (h *authorizedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// CORS preflight requests never carry credentials
+	if r.Method == http.MethodOptions || len(h.auths()) == 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	name, scope := h.authorize(r.Header.Get("Authorization"))
+	if scope == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs"`)
+		http.Error(w, "401 - Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// the patterns are matched against the path of the command, without the
+	// argument the path may end with
+	call, ok := parseCall(h.root, r)
+	if !ok || !commandAllowed(scope, call.path) || (!scope.Unrestricted() && configuresAuthorizations(call.path, call.args)) {
+		log.Debugf("API authorization %q is not allowed to call %q", name, r.URL.Path)
+		http.Error(w, "403 - Forbidden: command not allowed for this authorization", http.StatusForbidden)
+		return
+	}
+
+	// the usage of the request is accounted to its authorization
+	h.next.ServeHTTP(w, r.WithContext(tenants.WithTenant(r.Context(), name)))
+}
+
+// authorize returns the authorization whose secret is in the Authorization
+// header value hdr, or nil if there is none.
+func (h *authorizedHandler) authorize(hdr string) (string, *config.RPCAuthScope) {
+	if len(hdr) < len(authSchemeBearer) || !strings.EqualFold(hdr[:len(authSchemeBearer)], authSchemeBearer) {
+		return "", nil
+	}
+	secret := []byte(strings.TrimSpace(hdr[len(authSchemeBearer):]))
+	if len(secret) == 0 {
+		return "", nil
+	}
+
+	for name, scope := range h.auths() {
+		if scope != nil && subtle.ConstantTimeCompare(secret, []byte(scope.AuthSecret)) == 1 {
+			return name, scope
+		}
+	}
+	return "", nil
+}
+
+// commandAllowed reports whether scope allows calling the command at path cmd,
+// e.g. "files/ls". Denied commands take precedence over allowed ones, and
+// only the unrestricted authorizations can manage the authorizations with
+// "ipfs auth".
+func commandAllowed(scope *config.RPCAuthScope, cmd string) bool {
+	if scope.Unrestricted() {
+		return true
+	}
+	if matchCommand("auth/*", cmd) {
+		return false
+	}
+	for _, p := range scope.DeniedCommands {
+		if matchCommand(p, cmd) {
+			return false
+		}
+	}
+	if len(scope.AllowedCommands) == 0 && len(scope.Scopes) == 0 {
+		return true
+	}
+	for _, p := range scope.AllowedCommands {
+		if matchCommand(p, cmd) {
+			return true
+		}
+	}
+	// the unknown scopes allow no command
+	for _, name := range scope.Scopes {
+		for _, p := range config.RPCAuthScopes[name] {
+			if matchCommand(p, cmd) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configuresAuthorizations reports whether calling the command at path cmd
+// with the arguments args, including the one at the end of the URL path,
+// reads or changes the authorizations through the config: "config replace",
+// or "config" with a key under API.Authorizations or above it. Only the
+// unrestricted authorizations may, since the others could lift their own
+// restrictions.
+func configuresAuthorizations(cmd string, args []string) bool {
+	switch cmd {
+	case "config/replace":
+		return true
+	case "config":
+		if len(args) == 0 {
+			return false
+		}
+		key := strings.Split(args[0], ".")
+		for i, part := range []string{"API", "Authorizations"} {
+			if i == len(key) {
+				break
+			}
+			if !strings.EqualFold(key[i], part) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matchCommand reports whether the command path cmd matches pattern: either a
+// command path, "*" for all commands, or a command path followed by "/*" for a
+// command and all its subcommands.
+func matchCommand(pattern, cmd string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "*" {
+		return true
+	}
+	if prefix := strings.TrimSuffix(pattern, "/*"); prefix != pattern {
+		return cmd == prefix || strings.HasPrefix(cmd, prefix+"/")
+	}
+	return cmd == pattern
+}
@@ -0,0 +1,131 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/config"
+	corecommands "github.com/ipfs/go-ipfs/core/commands"
+)
+
+func TestMatchCommand(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, cmd string
+		match        bool
+	}{
+		{"*", "id", true},
+		{"id", "id", true},
+		{"/id", "id", true},
+		{"id", "ping", false},
+		{"files/*", "files", true},
+		{"files/*", "files/ls", true},
+		{"files/*", "filestore/ls", false},
+		{"files/ls", "files/ls", true},
+		{"files/ls", "files/rm", false},
+		{"files", "files/ls", false},
+	} {
+		if m := matchCommand(tc.pattern, tc.cmd); m != tc.match {
+			t.Errorf("matchCommand(%q, %q) = %t, expected %t", tc.pattern, tc.cmd, m, tc.match)
+		}
+	}
+}
+
+func TestAuthorizedHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := withAuthorizations(corecommands.Root, ok, staticAuthorizations(map[string]*config.RPCAuthScope{
+		"all":    {AuthSecret: "all-secret"},
+		"files":  {AuthSecret: "files-secret", AllowedCommands: []string{"files/*", "key/*"}, DeniedCommands: []string{"key/rm"}},
+		"reader": {AuthSecret: "reader-secret", AllowedCommands: []string{"add"}, Scopes: []string{"read-only", "pin-admin"}},
+		"denied": {AuthSecret: "denied-secret", DeniedCommands: []string{"key/rm"}},
+		"bogus":  {AuthSecret: "bogus-secret", Scopes: []string{"unknown"}},
+		"config": {AuthSecret: "config-secret", AllowedCommands: []string{"config/*"}},
+	}))
+
+	for _, tc := range []struct {
+		method, path, auth string
+		status             int
+	}{
+		{http.MethodPost, "/api/v0/id", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v0/id", "Bearer wrong", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v0/id", "Basic all-secret", http.StatusUnauthorized},
+		{http.MethodOptions, "/api/v0/id", "", http.StatusOK},
+		{http.MethodPost, "/api/v0/id", "Bearer all-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/key/rm", "bearer all-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/id", "Bearer files-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/files/ls", "Bearer files-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/key/list", "Bearer files-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/key/rm", "Bearer files-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/key/rm/foo", "Bearer files-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/files/ls/foo", "Bearer files-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/key/rm/foo", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/key/list/foo", "Bearer denied-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/key//rm", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/unknown", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/auth/rm/foo", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/cat", "Bearer reader-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/add", "Bearer reader-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/pin/rm", "Bearer reader-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/files/rm", "Bearer reader-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/id", "Bearer bogus-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/auth/mint", "Bearer all-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/auth/mint", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/auth/ls", "Bearer files-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/id", "Bearer denied-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config?arg=Gateway.Writable&arg=true", "Bearer config-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config?arg=APIs.Other&arg=true", "Bearer config-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config/show", "Bearer config-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config?arg=API.Authorizations.config.AllowedCommands&arg=[]", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config?arg=api.authorizations.config.Scopes&arg=[]", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config?arg=API.Authorizations", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config?arg=API&arg={}", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config/replace", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config/API.Authorizations.x?arg={}&json=true", "Bearer config-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config/API.Authorizations.x?arg={}&json=true", "Bearer denied-secret", http.StatusForbidden},
+		{http.MethodPost, "/api/v0/config/Gateway.Writable?arg=true", "Bearer config-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config/API.Authorizations.x?arg={}&json=true", "Bearer all-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config?arg=API.Authorizations.all.DeniedCommands&arg=[]", "Bearer all-secret", http.StatusOK},
+		{http.MethodPost, "/api/v0/config/replace", "Bearer all-secret", http.StatusOK},
+	} {
+		r := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.auth != "" {
+			r.Header.Set("Authorization", tc.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tc.status {
+			t.Errorf("%s %s with %q: got status %d, expected %d", tc.method, tc.path, tc.auth, w.Code, tc.status)
+		}
+	}
+}
+
+func TestAuthorizationsChanged(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	var auths map[string]*config.RPCAuthScope
+	h := withAuthorizations(corecommands.Root, ok, func() map[string]*config.RPCAuthScope { return auths })
+
+	request := func(auth string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/v0/id", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request(""); code != http.StatusOK {
+		t.Fatalf("expected the requests to be allowed without authorizations, got %d", code)
+	}
+	auths = map[string]*config.RPCAuthScope{"admin": {AuthSecret: "secret"}}
+	if code := request(""); code != http.StatusUnauthorized {
+		t.Fatalf("expected the requests without secret to be refused once minted, got %d", code)
+	}
+	if code := request("Bearer secret"); code != http.StatusOK {
+		t.Fatalf("expected the minted secret to be allowed, got %d", code)
+	}
+	auths = map[string]*config.RPCAuthScope{"other": {AuthSecret: "other-secret"}}
+	if code := request("Bearer secret"); code != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked secret to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,78 @@
+package corehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/apierr"
+)
+
+// withErrorStatus answers the errors of the commands of next of a known kind
+// with the status of their kind, go-ipfs-cmds answering them all with 500
+// Internal Server Error. The errors of the NotFound kind are left at 500, the
+// clients of the commands taking 404 for an unknown command: they read the
+// kind from the code of the error instead.
+func withErrorStatus(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorStatusResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(ew, r)
+		if ew.code == 0 {
+			return
+		}
+
+		status := ew.code
+		var e cmds.Error
+		if err := json.Unmarshal(ew.buf.Bytes(), &e); err == nil {
+			if kind := apierr.KindOf(e); kind != apierr.NotFound {
+				status = apierr.HTTPStatus(kind, status)
+			}
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(ew.buf.Bytes())
+	})
+}
+
+// errorStatusResponseWriter buffers the errors answered by go-ipfs-cmds
+// before any output, the other responses are passed through.
+type errorStatusResponseWriter struct {
+	http.ResponseWriter
+	// code is the status of the buffered error, 0 if the response is passed
+	// through
+	code    int
+	started bool
+	buf     bytes.Buffer
+}
+
+func (w *errorStatusResponseWriter) WriteHeader(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	// the errors of go-ipfs-cmds are encoded in JSON by default
+	if code == http.StatusInternalServerError && w.Header().Get("Content-Type") == "application/json" {
+		w.code = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorStatusResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *errorStatusResponseWriter) Flush() {
+	if w.code != 0 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
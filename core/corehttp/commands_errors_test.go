@@ -0,0 +1,56 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	"github.com/ipfs/go-ipfs/apierr"
+)
+
+func TestErrorStatus(t *testing.T) {
+	handler := withErrorStatus(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var kind apierr.Kind
+		switch r.URL.Path {
+		case "/ok":
+			_, _ = w.Write([]byte("ok"))
+			return
+		case "/offline":
+			kind = apierr.Offline
+		case "/invalid":
+			kind = apierr.InvalidPath
+		case "/notfound":
+			kind = apierr.NotFound
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(cmds.Error{Message: "oops", Code: apierr.Code(kind)})
+	}))
+
+	for path, status := range map[string]int{
+		"/ok":      http.StatusOK,
+		"/offline": http.StatusServiceUnavailable,
+		"/invalid": http.StatusBadRequest,
+		// 404 stands for an unknown command
+		"/notfound": http.StatusInternalServerError,
+		"/other":    http.StatusInternalServerError,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		if w.Code != status {
+			t.Errorf("%s: expected %d, got %d", path, status, w.Code)
+		}
+		if path == "/ok" {
+			continue
+		}
+		var e cmds.Error
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Message != "oops" {
+			t.Errorf("%s: expected the error passed through, got %q", path, w.Body.String())
+		}
+		if path == "/notfound" && apierr.KindOf(e) != apierr.NotFound {
+			t.Errorf("expected the kind in the code of the error")
+		}
+	}
+}
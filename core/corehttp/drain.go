@@ -0,0 +1,30 @@
+package corehttp
+
+import (
+	"net/http"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// withDrain tracks the requests served by next in the drainer of the node,
+// and answers 503 Service Unavailable once it is draining. When isTracked is
+// not nil, only the requests it returns true for are tracked.
+func withDrain(n *core.IpfsNode, next http.Handler, isTracked func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || (isTracked != nil && !isTracked(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		done, ok := n.Drainer().Start(r.Method + " " + r.URL.RequestURI())
+		if !ok {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "503 - Service Unavailable: node is shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer done()
+
+		next.ServeHTTP(w, r)
+	})
+}
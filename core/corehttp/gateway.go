@@ -4,14 +4,24 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"runtime"
 	"sort"
 
+	"github.com/dustin/go-humanize"
 	version "github.com/ipfs/go-ipfs"
+	config "github.com/ipfs/go-ipfs/config"
 	core "github.com/ipfs/go-ipfs/core"
 	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/namechain"
+	"github.com/ipfs/go-ipfs/namespaces"
+	"github.com/ipfs/go-ipfs/namewatch"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	options "github.com/ipfs/interface-go-ipfs-core/options"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
 )
 
@@ -19,6 +29,45 @@ type GatewayConfig struct {
 	Headers      map[string][]string
 	Writable     bool
 	PathPrefixes []string
+
+	// AccessControl, if set, restricts the clients and the content paths
+	// served.
+	AccessControl *gatewayAccess
+
+	// ContentPolicy, if set, is consulted before serving a root CID.
+	ContentPolicy ContentPolicy
+	// ContentPolicyFailOpen serves content when ContentPolicy fails.
+	ContentPolicyFailOpen bool
+
+	// NameResolution bounds the resolution of the /ipns paths.
+	NameResolution namechain.Settings
+
+	// ImageResizer, if set, resizes the images requested with the img-width
+	// and img-format parameters.
+	ImageResizer *ImageResizer
+
+	// RenderMarkdown serves the Markdown and source files requested by the
+	// browsers as HTML pages.
+	RenderMarkdown bool
+
+	// Cache, if set, keeps the resolved paths, directory listings and
+	// detected content types of the /ipfs/ paths.
+	Cache *responseCache
+
+	// NameWatcher, if set, follows the names of the /ipns/<name>?watch
+	// requests.
+	NameWatcher NameWatcher
+
+	// MaxInlineSize, if positive, is the largest data of the identity CIDs
+	// served.
+	MaxInlineSize int
+
+	// Canonical selects the URLs redirected to their canonical form.
+	Canonical CanonicalURLs
+
+	// BlockFiles, if set, returns the file a raw block is stored in as is,
+	// for the raw leaves of the files served to be sent from the disk.
+	BlockFiles func(cid.Cid) (string, bool)
 }
 
 // A helper function to clean up a set of headers:
@@ -43,6 +92,10 @@ func cleanHeaderSet(headers []string) []string {
 
 func GatewayOption(writable bool, paths ...string) ServeOption {
 	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		if writable && n.IsReadOnly {
+			return nil, fmt.Errorf("a read-only node cannot serve a writable gateway")
+		}
+
 		cfg, err := n.Repo.Config()
 		if err != nil {
 			return nil, err
@@ -53,6 +106,28 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 			return nil, err
 		}
 
+		// requests for content under the same root share their exchange session
+		var sessions *gatewaySessions
+		if sx, ok := n.Blocks.Exchange().(exchange.SessionExchange); ok && !cfg.Gateway.NoFetch {
+			sessions = newGatewaySessions(n.Context(), sx)
+			api = api.(*coreapi.CoreAPI).WithExchange(sessions)
+		}
+
+		// the blocks slow to retrieve are fetched from the upstream gateways too
+		if ucfg := cfg.Gateway.Upstream; len(ucfg.URLs) > 0 && !cfg.Gateway.NoFetch {
+			var exch exchange.Interface = n.Blocks.Exchange()
+			if sessions != nil {
+				exch = sessions
+			}
+			upstream, err := newGatewayUpstream(exch, ucfg.URLs,
+				ucfg.LatencyBudget.WithDefault(defaultUpstreamLatencyBudget),
+				ucfg.Timeout.WithDefault(defaultUpstreamTimeout))
+			if err != nil {
+				return nil, err
+			}
+			api = api.(*coreapi.CoreAPI).WithExchange(upstream)
+		}
+
 		headers := make(map[string][]string, len(cfg.Gateway.HTTPHeaders))
 		for h, v := range cfg.Gateway.HTTPHeaders {
 			headers[http.CanonicalHeaderKey(h)] = v
@@ -79,6 +154,7 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 				"User-Agent",
 				"Range",
 				"X-Requested-With",
+				providersHeader,
 			}, headers[ACAHeadersName]...))
 
 		headers[ACEHeadersName] = cleanHeaderSet(
@@ -88,26 +164,157 @@ func GatewayOption(writable bool, paths ...string) ServeOption {
 				"X-Stream-Output",
 			}, headers[ACEHeadersName]...))
 
+		policy, access, limiter, err := newGatewayRestrictions(n, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var resizer *ImageResizer
+		if icfg := cfg.Gateway.ImageResizing; icfg.Enabled.WithDefault(false) {
+			cacheSize, err := humanize.ParseBytes(icfg.CacheSize.WithDefault(defaultImageCacheSize))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Gateway.ImageResizing.CacheSize: %s", err)
+			}
+			resizer = NewImageResizer(int(icfg.Workers.WithDefault(int64(runtime.NumCPU()))), int64(cacheSize))
+			if n.MemoryBudget != nil {
+				n.MemoryBudget.OnPressure(resizer.purge)
+			}
+		}
+
+		cache, err := newResponseCache(cfg.Gateway.Cache)
+		if err != nil {
+			return nil, err
+		}
+		if cache != nil && n.MemoryBudget != nil {
+			n.MemoryBudget.OnPressure(cache.purge)
+		}
+
+		maxInlineSize := cfg.Gateway.MaxInlineSize.WithDefault(config.DefaultGatewayMaxInlineSize)
+		if maxInlineSize < 1 {
+			return nil, fmt.Errorf("invalid Gateway.MaxInlineSize: %d is not positive", maxInlineSize)
+		}
+
+		var watcher NameWatcher
+		if n.PSRouter != nil && n.PubSub != nil {
+			watcher = namewatch.NewWatcher(n.PubSub, n.PSRouter, n.Routing, n.RecordValidator)
+		}
+
 		var gateway http.Handler = newGatewayHandler(GatewayConfig{
-			Headers:      headers,
-			Writable:     writable,
-			PathPrefixes: cfg.Gateway.PathPrefixes,
+			Headers:               headers,
+			Writable:              writable,
+			PathPrefixes:          cfg.Gateway.PathPrefixes,
+			AccessControl:         access,
+			ContentPolicy:         policy,
+			ContentPolicyFailOpen: cfg.Gateway.ContentPolicy.FailOpen.WithDefault(false),
+			NameResolution: namechain.Settings{
+				MaxDepth:    int(cfg.Gateway.NameResolution.MaxDepth.WithDefault(nsopts.DefaultDepthLimit)),
+				StepTimeout: cfg.Gateway.NameResolution.StepTimeout.WithDefault(0),
+			},
+			ImageResizer:   resizer,
+			RenderMarkdown: cfg.Gateway.RenderMarkdown.WithDefault(false),
+			Cache:          cache,
+			NameWatcher:    watcher,
+			MaxInlineSize:  int(maxInlineSize),
+			Canonical: CanonicalURLs{
+				TrailingSlash:   cfg.Gateway.Canonicalize.TrailingSlash.WithDefault(false),
+				PercentEncoding: cfg.Gateway.Canonicalize.PercentEncoding.WithDefault(false),
+				CIDs:            cfg.Gateway.Canonicalize.CIDs.WithDefault(false),
+			},
+			BlockFiles: blockFiles(n.Repo, cfg),
 		}, api)
 
+		gateway = withBranding(gateway)
+
+		if scfg := cfg.Gateway.ResponseSignatures; scfg.Enabled.WithDefault(false) {
+			var underPressure func() bool
+			if n.MemoryBudget != nil {
+				underPressure = n.MemoryBudget.UnderPressure
+			}
+			gateway, err = newSigningHandler(gateway, n.PrivateKey,
+				int(scfg.MaxBodySize.WithDefault(DefaultSignatureMaxBodySize)), underPressure)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if sessions != nil {
+			gateway = sessions.handler(gateway)
+		}
+		if !cfg.Gateway.NoFetch && cfg.Gateway.ProviderHints.WithDefault(true) {
+			gateway = withProviderHints(gateway, api.(*coreapi.CoreAPI))
+		}
+		gateway = withTenantUsage(n, gateway, cfg.API.Authorizations)
+		gateway = withDrain(n, gateway, nil)
+		gateway = withMemoryBudget(n, gateway, nil)
+		if scfg := cfg.Gateway.Shadow; scfg.URL != "" {
+			shadow, err := newGatewayShadow(scfg)
+			if err != nil {
+				return nil, err
+			}
+			gateway = shadow.handler(gateway)
+		}
+		gateway = withSLOMetrics(gateway, cfg.Gateway.SLO.ApdexThreshold.WithDefault(defaultApdexThreshold))
+		gateway = withRateLimit(gateway, limiter)
+		gateway = withStructuredErrors(gateway)
 		gateway = otelhttp.NewHandler(gateway, "Gateway.Request")
 
 		for _, p := range paths {
 			mux.Handle(p+"/", gateway)
+			// the namespaces added by plugins are served next to /ipns
+			if p == "/ipns" {
+				for _, ns := range namespaces.Names() {
+					mux.Handle("/"+ns+"/", gateway)
+				}
+			}
 		}
 		return mux, nil
 	}
 }
 
+// newGatewayRestrictions returns the content policy, access control and rate
+// limiter of the gateway set in cfg, each nil if not set.
+func newGatewayRestrictions(n *core.IpfsNode, cfg *config.Config) (ContentPolicy, *gatewayAccess, *rateLimiter, error) {
+	var policy ContentPolicy
+	if pcfg := cfg.Gateway.ContentPolicy; pcfg.URL != "" {
+		var err error
+		policy, err = NewHTTPContentPolicy(pcfg.URL,
+			pcfg.Timeout.WithDefault(defaultPolicyTimeout),
+			pcfg.CacheTTL.WithDefault(defaultPolicyCacheTTL))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if hp, ok := policy.(*httpContentPolicy); ok && n.MemoryBudget != nil {
+			n.MemoryBudget.OnPressure(hp.purge)
+		}
+	}
+
+	access, err := newGatewayAccess(cfg.Gateway.AccessControl)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	limiter, err := newRateLimiter(cfg.Gateway.RateLimit, access)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return policy, access, limiter, nil
+}
+
 func VersionOption() ServeOption {
-	return func(_ *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		agent := libp2p.AgentVersion(cfg.Swarm.Identify)
+		// the commit is left out with the version when the agent version is
+		// replaced
+		showCommit := cfg.Swarm.Identify.AgentVersion == nil
 		mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
-			fmt.Fprintf(w, "Commit: %s\n", version.CurrentCommit)
-			fmt.Fprintf(w, "Client Version: %s\n", version.GetUserAgentVersion())
+			if showCommit {
+				fmt.Fprintf(w, "Commit: %s\n", version.CurrentCommit)
+			}
+			fmt.Fprintf(w, "Client Version: %s\n", agent)
 			fmt.Fprintf(w, "Protocol Version: %s\n", id.LibP2PVersion)
 		})
 		return mux, nil
@@ -0,0 +1,294 @@
+package corehttp
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	gopath "path"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	config "github.com/ipfs/go-ipfs/config"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// denyFileCheckInterval is the time between two checks of the deny files for
+// changes.
+const denyFileCheckInterval = 10 * time.Second
+
+// gatewayAccess restricts the requests of the gateway to the clients carrying
+// a token, and to the content paths allowed and not denied.
+//
+// The content paths are compared by prefix, segment by segment, the CIDs by
+// multihash, so that the CIDv0 and CIDv1 of some content are the same path.
+type gatewayAccess struct {
+	tokens [][]byte
+	allow  []string
+	deny   []string
+
+	mu      sync.Mutex
+	files   []*denyFile
+	checked time.Time
+}
+
+// denyFile is a file listing content paths denied.
+type denyFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+	deny    []string
+}
+
+// newGatewayAccess returns the access control of cfg, or nil if it restricts
+// nothing.
+func newGatewayAccess(cfg config.GatewayAccessControl) (*gatewayAccess, error) {
+	if len(cfg.Tokens) == 0 && len(cfg.Allow) == 0 && len(cfg.Deny) == 0 && len(cfg.DenyFiles) == 0 {
+		return nil, nil
+	}
+
+	a := &gatewayAccess{}
+	for _, t := range cfg.Tokens {
+		if t == "" {
+			return nil, fmt.Errorf("Gateway.AccessControl.Tokens: empty token")
+		}
+		a.tokens = append(a.tokens, []byte(t))
+	}
+	var err error
+	if a.allow, err = accessPaths(cfg.Allow); err != nil {
+		return nil, fmt.Errorf("Gateway.AccessControl.Allow: %w", err)
+	}
+	if a.deny, err = accessPaths(cfg.Deny); err != nil {
+		return nil, fmt.Errorf("Gateway.AccessControl.Deny: %w", err)
+	}
+	for _, p := range cfg.DenyFiles {
+		f := &denyFile{path: p}
+		if err := f.load(); err != nil {
+			return nil, fmt.Errorf("Gateway.AccessControl.DenyFiles: %w", err)
+		}
+		a.files = append(a.files, f)
+	}
+	a.checked = time.Now()
+	return a, nil
+}
+
+// accessPaths returns the content paths of entries, normalized.
+func accessPaths(entries []string) ([]string, error) {
+	paths := make([]string, 0, len(entries))
+	for _, e := range entries {
+		p, err := normalizeAccessPath(e)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// normalizeAccessPath returns the content path p, or /ipfs/p for a CID, with
+// its CID replaced by its multihash, and its IPNS name by the peer ID it is,
+// or by the DNSLink name in lower case.
+func normalizeAccessPath(p string) (string, error) {
+	p = strings.TrimSpace(p)
+	if !strings.HasPrefix(p, "/") {
+		if _, err := cid.Decode(p); err != nil {
+			return "", fmt.Errorf("invalid CID or content path %q", p)
+		}
+		p = ipfsPathPrefix + p
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(gopath.Clean(p), "/"), "/", 3)
+	if len(segments) < 2 || (segments[0] != "ipfs" && segments[0] != "ipns") || segments[1] == "" {
+		return "", fmt.Errorf("invalid content path %q", p)
+	}
+	if segments[0] == "ipfs" {
+		c, err := cid.Decode(segments[1])
+		if err != nil {
+			return "", fmt.Errorf("invalid CID in content path %q: %w", p, err)
+		}
+		segments[1] = c.Hash().B58String()
+	} else if id, err := peer.Decode(segments[1]); err == nil {
+		segments[1] = id.String()
+	} else {
+		segments[1] = strings.ToLower(segments[1])
+	}
+	return "/" + strings.Join(segments, "/"), nil
+}
+
+// matchAccessPath reports whether the content path p is one of paths, or
+// below one of them.
+func matchAccessPath(paths []string, p string) bool {
+	for _, prefix := range paths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// authorized reports whether r carries one of the tokens, if any are set.
+func (a *gatewayAccess) authorized(r *http.Request) bool {
+	return len(a.tokens) == 0 || a.token(r) >= 0
+}
+
+// token returns the index of the token r carries, or -1 if it carries none.
+func (a *gatewayAccess) token(r *http.Request) int {
+	hdr := r.Header.Get("Authorization")
+	if len(hdr) < len(authSchemeBearer) || !strings.EqualFold(hdr[:len(authSchemeBearer)], authSchemeBearer) {
+		return -1
+	}
+	token := []byte(strings.TrimSpace(hdr[len(authSchemeBearer):]))
+	found := -1
+	for i, t := range a.tokens {
+		if subtle.ConstantTimeCompare(token, t) == 1 {
+			found = i
+		}
+	}
+	return found
+}
+
+// check returns the status of the refusal of the content path p, and why,
+// or 0 if p may be served.
+func (a *gatewayAccess) check(p string) (int, string) {
+	np, err := normalizeAccessPath(p)
+	if err != nil {
+		// the gateway rejects the invalid paths itself
+		if len(a.allow) > 0 {
+			return http.StatusForbidden, "path not allowed by the gateway"
+		}
+		return 0, ""
+	}
+	if a.denied(np) {
+		return http.StatusGone, "path denied by the gateway"
+	}
+	if len(a.allow) > 0 && !matchAccessPath(a.allow, np) {
+		return http.StatusForbidden, "path not allowed by the gateway"
+	}
+	return 0, ""
+}
+
+// deniedCid reports whether the CID c is denied.
+func (a *gatewayAccess) deniedCid(c cid.Cid) bool {
+	return a.denied(ipfsPathPrefix + c.Hash().B58String())
+}
+
+func (a *gatewayAccess) denied(np string) bool {
+	if matchAccessPath(a.deny, np) {
+		return true
+	}
+	for _, deny := range a.fileDenies() {
+		if matchAccessPath(deny, np) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileDenies returns the paths denied by the deny files, read again first if
+// they changed since they were last checked, more than denyFileCheckInterval
+// ago.
+func (a *gatewayAccess) fileDenies() [][]string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.files) == 0 {
+		return nil
+	}
+
+	if time.Since(a.checked) >= denyFileCheckInterval {
+		a.checked = time.Now()
+		for _, f := range a.files {
+			if err := f.reload(); err != nil {
+				// the paths denied before are kept
+				log.Errorf("cannot read the gateway deny file %s again: %s", f.path, err)
+			}
+		}
+	}
+
+	denies := make([][]string, len(a.files))
+	for i, f := range a.files {
+		denies[i] = f.deny
+	}
+	return denies
+}
+
+// reload reads the file again if it changed.
+func (f *denyFile) reload() error {
+	st, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if st.ModTime().Equal(f.modTime) && st.Size() == f.size {
+		return nil
+	}
+	return f.load()
+}
+
+// load reads the content paths of the file, one per line, ignoring the empty
+// lines and the comments starting with "#".
+func (f *denyFile) load() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	st, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var deny []string
+	s := bufio.NewScanner(file)
+	for line := 1; s.Scan(); line++ {
+		e := strings.TrimSpace(s.Text())
+		if e == "" || strings.HasPrefix(e, "#") {
+			continue
+		}
+		p, err := normalizeAccessPath(e)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", f.path, line, err)
+		}
+		deny = append(deny, p)
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	f.deny, f.modTime, f.size = deny, st.ModTime(), st.Size()
+	return nil
+}
+
+// checkAccess refuses the requests without a token, and the requests for a
+// content path not allowed, or denied, before resolving it. When it returns
+// false, a response has already been written.
+func (i *gatewayHandler) checkAccess(w http.ResponseWriter, r *http.Request) bool {
+	a := i.config.AccessControl
+	if a == nil || r.Method == http.MethodOptions {
+		// CORS preflight requests never carry credentials
+		return true
+	}
+
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-gateway"`)
+		http.Error(w, "401 - Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if status, reason := a.check(r.URL.Path); status != 0 {
+		log.Debugw("gateway access refused", "path", r.URL.Path, "status", status)
+		http.Error(w, reason, status)
+		return false
+	}
+	return true
+}
+
+// checkResolvedAccess refuses the requests resolved to a CID denied through
+// another path. When it returns false, a response has already been written.
+func (i *gatewayHandler) checkResolvedAccess(w http.ResponseWriter, resolved cid.Cid) bool {
+	a := i.config.AccessControl
+	if a == nil || !a.deniedCid(resolved) {
+		return true
+	}
+	http.Error(w, "path denied by the gateway", http.StatusGone)
+	return false
+}
@@ -0,0 +1,168 @@
+package corehttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	path "github.com/ipfs/go-path"
+)
+
+// emptyDirV1 is emptyDir as a CIDv1.
+const emptyDirV1 = "/ipfs/bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"
+
+func TestNormalizeAccessPath(t *testing.T) {
+	peerID := "12D3KooWQEDPVTD8FNXjaNbTwaiYnaxLeyxaHcxdWYzr2RGKhTbN"
+	for p, np := range map[string]string{
+		emptyDir:              emptyDir,
+		emptyDirV1 + "/a//b/": emptyDir + "/a/b",
+		"bafkqaaa":            "/ipfs/11",
+		"/ipns/Example.ORG/x": "/ipns/example.org/x",
+		"/ipns/" + peerID:     "/ipns/" + peerID,
+	} {
+		got, err := normalizeAccessPath(p)
+		if err != nil {
+			t.Errorf("%s: %s", p, err)
+			continue
+		}
+		if got != np {
+			t.Errorf("%s: expected %s, got %s", p, np, got)
+		}
+	}
+	for _, p := range []string{"", "/ipfs", "/ipfs/notacid", "/foo/bar", "notacid"} {
+		if _, err := normalizeAccessPath(p); err == nil {
+			t.Errorf("%q: expected an invalid path", p)
+		}
+	}
+}
+
+func writeDenyFile(t *testing.T, name, content string) {
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGatewayAccessCheck(t *testing.T) {
+	denyFile := filepath.Join(t.TempDir(), "deny")
+	writeDenyFile(t, denyFile, "# denied\n\n"+emptyDirV1+"/secret\n")
+
+	a, err := newGatewayAccess(config.GatewayAccessControl{
+		Allow:     []string{emptyDir, "/ipns/example.org"},
+		Deny:      []string{"/ipns/example.org/private"},
+		DenyFiles: []string{denyFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, status := range map[string]int{
+		emptyDirV1 + "/a":              0,
+		emptyDir + "/secret/a":         http.StatusGone,
+		emptyDir + "/secretive":        0,
+		"/ipns/EXAMPLE.org/index.html": 0,
+		"/ipns/example.org/private":    http.StatusGone,
+		"/ipns/example.com":            http.StatusForbidden,
+		"/ipfs/bafkqaaa":               http.StatusForbidden,
+		"/favicon.ico":                 http.StatusForbidden,
+	} {
+		if st, _ := a.check(p); st != status {
+			t.Errorf("%s: expected status %d, got %d", p, status, st)
+		}
+	}
+
+	// the deny file changed, but is only read again after a while
+	writeDenyFile(t, denyFile, "/ipns/example.org\n")
+	if st, _ := a.check("/ipns/example.org"); st != 0 {
+		t.Fatalf("expected the deny file not to be read again yet, got %d", st)
+	}
+	a.checked = time.Now().Add(-denyFileCheckInterval)
+	if st, _ := a.check("/ipns/example.org"); st != http.StatusGone {
+		t.Fatalf("expected the deny file to be read again, got %d", st)
+	}
+	if st, _ := a.check(emptyDir + "/secret"); st != 0 {
+		t.Fatalf("expected the path no longer denied, got %d", st)
+	}
+
+	// the paths denied are kept when the deny file cannot be read
+	if err := os.Remove(denyFile); err != nil {
+		t.Fatal(err)
+	}
+	a.checked = time.Now().Add(-denyFileCheckInterval)
+	if st, _ := a.check("/ipns/example.org"); st != http.StatusGone {
+		t.Fatalf("expected the path still denied, got %d", st)
+	}
+
+	if a, err := newGatewayAccess(config.GatewayAccessControl{}); a != nil || err != nil {
+		t.Errorf("expected no access control without restrictions, got %v, %v", a, err)
+	}
+	for _, cfg := range []config.GatewayAccessControl{
+		{Tokens: []string{""}},
+		{Allow: []string{"/ipfs/notacid"}},
+		{DenyFiles: []string{denyFile}},
+	} {
+		if _, err := newGatewayAccess(cfg); err == nil {
+			t.Errorf("expected %+v to fail", cfg)
+		}
+	}
+}
+
+func TestGatewayAccessControl(t *testing.T) {
+	ns := mockNamesys{}
+	ns["/ipns/example.net"] = path.FromString(emptyDir)
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.AccessControl = config.GatewayAccessControl{
+		Tokens: []string{"secret", "other"},
+		Deny:   []string{emptyDirV1},
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(p, auth string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	for _, auth := range []string{"", "Bearer wrong", "Basic secret"} {
+		res := get("/ipfs/bafkqaaa", auth)
+		if res.StatusCode != http.StatusUnauthorized || res.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("%q: expected a 401 response, got %d", auth, res.StatusCode)
+		}
+	}
+	for p, status := range map[string]int{
+		"/ipfs/bafkqaaa":    http.StatusOK,
+		emptyDir + "/":      http.StatusGone,
+		"/ipns/example.net": http.StatusGone, // resolved to emptyDir
+	} {
+		if res := get(p, "bearer other"); res.StatusCode != status {
+			t.Errorf("%s: expected status %d, got %d", p, status, res.StatusCode)
+		}
+	}
+}
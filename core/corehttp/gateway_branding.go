@@ -0,0 +1,131 @@
+package corehttp
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"strings"
+
+	config "github.com/ipfs/go-ipfs/config"
+)
+
+// brandingOf returns the spec of the known gateway serving r, if it brands
+// its pages with Gateway.PublicGateways HeaderHTML, FooterHTML or Locale.
+func brandingOf(r *http.Request) *config.GatewaySpec {
+	gw, _ := r.Context().Value(gatewaySpecKey{}).(*config.GatewaySpec)
+	if gw == nil || (gw.HeaderHTML == "" && gw.FooterHTML == "" && gw.Locale == "") {
+		return nil
+	}
+	return gw
+}
+
+// brandPage inserts the header and footer of gw in the body of an HTML page
+// of the gateway, and sets its language to the locale of gw.
+func brandPage(page []byte, gw *config.GatewaySpec) []byte {
+	s := string(page)
+	if gw.Locale != "" {
+		// the pages of the gateway are in English by default
+		s = strings.Replace(s, `<html lang="en">`, `<html lang="`+html.EscapeString(gw.Locale)+`">`, 1)
+	}
+	if gw.HeaderHTML != "" {
+		if i := strings.Index(s, "<body"); i >= 0 {
+			i += strings.Index(s[i:], ">") + 1
+			s = s[:i] + "\n" + gw.HeaderHTML + s[i:]
+		}
+	}
+	if gw.FooterHTML != "" {
+		if i := strings.LastIndex(s, "</body>"); i >= 0 {
+			s = s[:i] + gw.FooterHTML + "\n" + s[i:]
+		}
+	}
+	return []byte(s)
+}
+
+// withBranding serves the plain text errors of next as HTML pages with the
+// branding of the gateway serving the request, to the clients accepting HTML.
+func withBranding(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gw := brandingOf(r)
+		if gw == nil || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		bw := &brandingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, r)
+		if bw.code == 0 {
+			return
+		}
+
+		page := fmt.Sprintf("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n<title>%d %s</title>\n</head>\n<body>\n<pre>%s</pre>\n</body>\n</html>\n",
+			bw.code, http.StatusText(bw.code), html.EscapeString(strings.TrimSpace(bw.buf.String())))
+		h := w.Header()
+		h.Set("Content-Type", "text/html; charset=utf-8")
+		h.Del("Content-Length")
+		if gw.Locale != "" {
+			h.Set("Content-Language", gw.Locale)
+		}
+		w.WriteHeader(bw.code)
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(brandPage([]byte(page), gw))
+		}
+	})
+}
+
+// brandingResponseWriter buffers the errors written with http.Error, the
+// other responses are passed through.
+type brandingResponseWriter struct {
+	http.ResponseWriter
+	// code is the status of the buffered error, 0 if the response is passed
+	// through
+	code    int
+	started bool
+	buf     bytes.Buffer
+}
+
+func (w *brandingResponseWriter) WriteHeader(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	// http.Error sets these, and nothing else does with an error status
+	if code >= 400 && w.Header().Get("Content-Type") == "text/plain; charset=utf-8" &&
+		w.Header().Get("X-Content-Type-Options") == "nosniff" {
+		w.code = code
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *brandingResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom passes the copies of the responses passed through on to the
+// ResponseWriter, which sends the files with sendfile.
+func (w *brandingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.buf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func (w *brandingResponseWriter) Flush() {
+	if w.code != 0 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
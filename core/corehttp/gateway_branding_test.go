@@ -0,0 +1,84 @@
+package corehttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/config"
+)
+
+func TestBrandPage(t *testing.T) {
+	page := "<!DOCTYPE html>\n<html lang=\"en\">\n<body class=\"listing\">\n<main>Index</main>\n</body>\n</html>\n"
+	gw := &config.GatewaySpec{
+		HeaderHTML: "<header>Library</header>",
+		FooterHTML: "<footer>Legal notice</footer>",
+		Locale:     "de-CH",
+	}
+	expected := "<!DOCTYPE html>\n<html lang=\"de-CH\">\n<body class=\"listing\">\n<header>Library</header>\n<main>Index</main>\n<footer>Legal notice</footer>\n</body>\n</html>\n"
+	if got := string(brandPage([]byte(page), gw)); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestWithBranding(t *testing.T) {
+	h := withBranding(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipfs/missing":
+			webErrorWithCode(w, "ipfs resolve -r /ipfs/missing", errors.New("not found"), http.StatusNotFound)
+		case "/ipfs/pretty404":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<p>custom</p>"))
+		default:
+			_, _ = w.Write([]byte("data"))
+		}
+	}))
+	branded := &config.GatewaySpec{FooterHTML: "<footer>Legal notice</footer>", Locale: "fr"}
+
+	get := func(p, accept string, gw *config.GatewaySpec) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if gw != nil {
+			req = withGatewaySpec(req, gw)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	res := get("/ipfs/missing", "text/html,*/*", branded)
+	body := res.Body.String()
+	if res.Code != http.StatusNotFound || res.Header().Get("Content-Type") != "text/html; charset=utf-8" ||
+		res.Header().Get("Content-Language") != "fr" {
+		t.Fatalf("unexpected response %d %v", res.Code, res.Header())
+	}
+	if !strings.Contains(body, `<html lang="fr">`) || !strings.Contains(body, "<footer>Legal notice</footer>\n</body>") ||
+		!strings.Contains(body, "ipfs resolve -r /ipfs/missing: not found") {
+		t.Fatalf("unexpected error page %q", body)
+	}
+
+	// plain text for the clients not accepting HTML, and on other hostnames
+	for _, res := range []*httptest.ResponseRecorder{
+		get("/ipfs/missing", "", branded),
+		get("/ipfs/missing", "text/html", nil),
+		get("/ipfs/missing", "text/html", &config.GatewaySpec{Paths: []string{"/ipfs"}}),
+	} {
+		if res.Code != http.StatusNotFound || !strings.HasPrefix(res.Header().Get("Content-Type"), "text/plain") {
+			t.Fatalf("unexpected response %d %v", res.Code, res.Header())
+		}
+	}
+
+	// content is never branded
+	if res := get("/ipfs/pretty404", "text/html", branded); res.Code != http.StatusNotFound || res.Body.String() != "<p>custom</p>" {
+		t.Fatalf("unexpected response %d %q", res.Code, res.Body.String())
+	}
+	if res := get("/ipfs/file", "text/html", branded); res.Code != http.StatusOK || res.Body.String() != "data" {
+		t.Fatalf("unexpected response %d %q", res.Code, res.Body.String())
+	}
+}
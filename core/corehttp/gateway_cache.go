@@ -0,0 +1,377 @@
+package corehttp
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/assets"
+	config "github.com/ipfs/go-ipfs/config"
+	path "github.com/ipfs/go-path"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	defaultCacheMaxSize     = "32MB"
+	defaultCacheMaxDiskSize = "1GB"
+	defaultCacheTTL         = 24 * time.Hour
+)
+
+// responseCache keeps the work done for the immutable /ipfs/ paths: the
+// paths resolved, the directory listings rendered and the content types
+// detected. The entries recently used are kept in memory, and also in a
+// directory if the cache has one, so that they outlive the daemon. A nil
+// cache keeps nothing.
+type responseCache struct {
+	ttl time.Duration
+	dir string
+
+	mu   sync.Mutex
+	mem  *cacheLRU
+	disk *cacheLRU
+}
+
+// cacheEntry is an entry of a cacheLRU. The entries of the disk carry no
+// value, it is in their file.
+type cacheEntry struct {
+	key     string
+	value   []byte
+	size    int64
+	expires time.Time
+}
+
+// diskCacheEntry is the content of the file of an entry of the disk.
+type diskCacheEntry struct {
+	Key     string
+	Value   []byte
+	Expires time.Time
+}
+
+// cacheLRU is a set of entries bounded by their size, from which the entries
+// least recently used are evicted.
+type cacheLRU struct {
+	// order lists the entries from the most recently used
+	order   *list.List
+	entries map[string]*list.Element
+	size    int64
+	maxSize int64
+	// onEvict, if set, is called with the entries evicted
+	onEvict func(e *cacheEntry)
+}
+
+func newCacheLRU(maxSize int64, onEvict func(e *cacheEntry)) *cacheLRU {
+	return &cacheLRU{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		maxSize: maxSize,
+		onEvict: onEvict,
+	}
+}
+
+// get returns the entry of key, unless it expired.
+func (c *cacheLRU) get(key string, now time.Time) (*cacheEntry, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if now.After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+// add adds e as the entry most recently used, unless it is larger than the
+// whole set. e replaces the entry of the same key, which is not evicted.
+func (c *cacheLRU) add(e *cacheEntry) {
+	if el, ok := c.entries[e.key]; ok {
+		c.order.Remove(el)
+		delete(c.entries, e.key)
+		c.size -= el.Value.(*cacheEntry).size
+	}
+	if e.size > c.maxSize {
+		return
+	}
+	c.entries[e.key] = c.order.PushFront(e)
+	c.size += e.size
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+// addOldest adds e as the entry least recently used, if there is room for
+// it.
+func (c *cacheLRU) addOldest(e *cacheEntry) bool {
+	if _, ok := c.entries[e.key]; ok || c.size+e.size > c.maxSize {
+		return false
+	}
+	c.entries[e.key] = c.order.PushBack(e)
+	c.size += e.size
+	return true
+}
+
+func (c *cacheLRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	if c.onEvict != nil {
+		c.onEvict(e)
+	}
+}
+
+// purge drops all the entries, without evicting them.
+func (c *cacheLRU) purge() {
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+}
+
+// newResponseCache returns the cache configured by cfg, or nil if the
+// gateway keeps no cache.
+func newResponseCache(cfg config.GatewayCache) (*responseCache, error) {
+	if !cfg.Enabled.WithDefault(false) {
+		return nil, nil
+	}
+	maxSize, err := humanize.ParseBytes(cfg.MaxSize.WithDefault(defaultCacheMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gateway.Cache.MaxSize: %s", err)
+	}
+	c := &responseCache{
+		ttl: cfg.TTL.WithDefault(defaultCacheTTL),
+		mem: newCacheLRU(int64(maxSize), nil),
+	}
+	if c.ttl <= 0 {
+		return nil, fmt.Errorf("invalid Gateway.Cache.TTL: %s", c.ttl)
+	}
+
+	dir := cfg.Path.WithDefault("")
+	if dir == "" {
+		return c, nil
+	}
+	maxDiskSize, err := humanize.ParseBytes(cfg.MaxDiskSize.WithDefault(defaultCacheMaxDiskSize))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gateway.Cache.MaxDiskSize: %s", err)
+	}
+	if !filepath.IsAbs(dir) {
+		root, err := config.PathRoot()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(root, dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("invalid Gateway.Cache.Path: %s", err)
+	}
+	c.dir = dir
+	c.disk = newCacheLRU(int64(maxDiskSize), func(e *cacheEntry) {
+		os.Remove(filepath.Join(c.dir, e.key))
+	})
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("cannot read Gateway.Cache.Path: %s", err)
+	}
+	return c, nil
+}
+
+// load lists the entries kept in the directory of the cache by the previous
+// runs, the most recently written first. The entries beyond the size of the
+// disk are removed. The entries are only read when asked for, their key
+// being the name of their file until then.
+func (c *responseCache) load() error {
+	infos, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+	now := time.Now()
+	for _, info := range infos {
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		name := filepath.Join(c.dir, info.Name())
+		if strings.HasSuffix(name, ".tmp") {
+			// written when the daemon stopped
+			os.Remove(name)
+			continue
+		}
+		e := &cacheEntry{
+			key:     info.Name(),
+			size:    info.Size(),
+			expires: info.ModTime().Add(c.ttl),
+		}
+		if now.After(e.expires) || !c.disk.addOldest(e) {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
+
+// file returns the name of the file of the entry of key.
+func (c *responseCache) file(key string) string {
+	return filepath.Join(c.dir, c.fileKey(key))
+}
+
+// fileKey returns the key of the entry of key in the disk.
+func (c *responseCache) fileKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// get returns the value of key, read from the disk if not in memory.
+func (c *responseCache) get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if e, ok := c.mem.get(key, now); ok {
+		c.mu.Unlock()
+		return e.value, true
+	}
+	if c.disk == nil {
+		c.mu.Unlock()
+		return nil, false
+	}
+	_, ok := c.disk.get(c.fileKey(key), now)
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(c.file(key))
+	if err != nil {
+		return nil, false
+	}
+	var de diskCacheEntry
+	if err := json.Unmarshal(data, &de); err != nil || de.Key != key || now.After(de.Expires) {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mem.add(&cacheEntry{key: key, value: de.Value, size: cacheEntrySize(key, de.Value), expires: de.Expires})
+	return de.Value, true
+}
+
+// put keeps value as the value of key.
+func (c *responseCache) put(key string, value []byte) {
+	if c == nil {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+	c.mu.Lock()
+	c.mem.add(&cacheEntry{key: key, value: value, size: cacheEntrySize(key, value), expires: expires})
+	c.mu.Unlock()
+	if c.disk == nil {
+		return
+	}
+
+	data, err := json.Marshal(&diskCacheEntry{Key: key, Value: value, Expires: expires})
+	if err != nil {
+		return
+	}
+	// the entry is complete, or is not there
+	if err := c.write(c.file(key), data); err != nil {
+		log.Debugf("cannot write the cache entry of %s: %s", key, err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.disk.add(&cacheEntry{key: c.fileKey(key), size: int64(len(data)), expires: expires})
+}
+
+// write writes data to the file name, through a temporary file renamed once
+// written.
+func (c *responseCache) write(name string, data []byte) error {
+	f, err := ioutil.TempFile(c.dir, filepath.Base(name)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// resolved returns the resolution of the immutable path p, if kept.
+func (c *responseCache) resolved(p ipath.Path) (ipath.Resolved, bool) {
+	value, ok := c.get("resolved " + p.String())
+	if !ok {
+		return nil, false
+	}
+	var res cachedResolution
+	if err := json.Unmarshal(value, &res); err != nil {
+		return nil, false
+	}
+	return ipath.NewResolvedPath(path.FromString(p.String()), res.Cid, res.Root, res.Remainder), true
+}
+
+// putResolved keeps the resolution of the immutable path p.
+func (c *responseCache) putResolved(p ipath.Resolved) {
+	if c == nil {
+		return
+	}
+	value, err := json.Marshal(&cachedResolution{Cid: p.Cid(), Root: p.Root(), Remainder: p.Remainder()})
+	if err != nil {
+		return
+	}
+	c.put("resolved "+p.String(), value)
+}
+
+// cachedResolution is the value of the entries of the resolved paths.
+type cachedResolution struct {
+	Cid       cid.Cid
+	Root      cid.Cid
+	Remainder string
+}
+
+// listingCacheKey is the key of the listing of the directory dir requested
+// as contentPath with the URL path originalUrlPath on the gateway gwURL.
+func listingCacheKey(dir cid.Cid, contentPath ipath.Path, originalUrlPath, gwURL string) string {
+	return strings.Join([]string{"listing", assets.BindataVersionHash, "/ipfs/" + dir.String(), contentPath.String(), originalUrlPath, gwURL}, " ")
+}
+
+// renderedCacheKey is the key of the rendered page of the file c, whose
+// links depend on the URLs it is requested with.
+func renderedCacheKey(c cid.Cid, contentPath ipath.Path, gwURL string) string {
+	return strings.Join([]string{"rendered", assets.BindataVersionHash, "/ipfs/" + c.String(), contentPath.String(), gwURL}, " ")
+}
+
+// contentTypeCacheKey is the key of the content type detected in the data of
+// the file c.
+func contentTypeCacheKey(c cid.Cid) string {
+	return "content-type /ipfs/" + c.String()
+}
+
+// purge drops the entries kept in memory, those of the disk being kept.
+func (c *responseCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mem.purge()
+}
+
+// cacheEntrySize is about the memory taken by an entry.
+func cacheEntrySize(key string, value []byte) int64 {
+	return int64(len(key) + len(value))
+}
@@ -0,0 +1,174 @@
+package corehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	config "github.com/ipfs/go-ipfs/config"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+func cacheConfig(t *testing.T, s string) config.GatewayCache {
+	var cfg config.GatewayCache
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestResponseCache(t *testing.T) {
+	if c, err := newResponseCache(config.GatewayCache{}); c != nil || err != nil {
+		t.Fatalf("expected no cache, got %v, %v", c, err)
+	}
+	value := func(key string) []byte {
+		return bytes.Repeat([]byte(key), 100)
+	}
+	dir := t.TempDir()
+	for _, s := range []string{
+		`{"Enabled": true, "MaxSize": "lots"}`,
+		`{"Enabled": true, "TTL": "-1s"}`,
+		`{"Enabled": true, "Path": "` + dir + `", "MaxDiskSize": "lots"}`,
+	} {
+		if _, err := newResponseCache(cacheConfig(t, s)); err == nil {
+			t.Errorf("expected %s to fail", s)
+		}
+	}
+
+	// the memory holds two entries, the disk four, of about 200 bytes each
+	cfg := cacheConfig(t, `{"Enabled": true, "MaxSize": "250B", "Path": "`+dir+`", "MaxDiskSize": "900B"}`)
+	c, err := newResponseCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		c.put(key, value(key))
+	}
+	c.purge()
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected a evicted from the disk")
+	}
+	for _, key := range []string{"b", "c", "d", "e"} {
+		if v, ok := c.get(key); !ok || !bytes.Equal(v, value(key)) {
+			t.Fatalf("expected %s read from the disk, got %q", key, v)
+		}
+	}
+	if infos, err := ioutil.ReadDir(dir); err != nil || len(infos) != 4 {
+		t.Fatalf("expected 4 files, got %d (%v)", len(infos), err)
+	}
+
+	// the entries outlive the cache
+	c, err = newResponseCache(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := c.get("e"); !ok || !bytes.Equal(v, value("e")) {
+		t.Fatalf("expected e kept, got %q", v)
+	}
+
+	// the entries expire
+	c, err = newResponseCache(cacheConfig(t, `{"Enabled": true, "TTL": "10ms"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.put("a", []byte("a-value"))
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.get("a"); ok {
+		t.Fatal("expected a expired")
+	}
+
+	var none *responseCache
+	none.put("a", []byte("a-value"))
+	if _, ok := none.get("a"); ok {
+		t.Fatal("expected nothing kept without a cache")
+	}
+}
+
+func TestGatewayCache(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheCfg := cacheConfig(t, `{"Enabled": true, "Path": "`+t.TempDir()+`"}`)
+	cfg.Gateway.Cache = cacheCfg
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"notes": files.NewBytesFile([]byte("plain text")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirPath := ipath.Join(k, "sub")
+	dirCid, err := api.ResolvePath(n.Context(), dirPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := api.ResolvePath(n.Context(), ipath.Join(dirPath, "notes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(p string) string {
+		t.Helper()
+		res, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: unexpected status %d", p, res.StatusCode)
+		}
+		return string(body)
+	}
+
+	listing := get(dirPath.String() + "/")
+	if again := get(dirPath.String() + "/"); again != listing {
+		t.Fatal("expected the same listing")
+	}
+	get(dirPath.String() + "/notes")
+
+	// the work done is read back by the next runs
+	c, err := newResponseCache(cacheCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, ok := c.resolved(ipath.New(dirPath.String() + "/notes"))
+	if !ok || !resolved.Cid().Equals(notes.Cid()) || resolved.Root() != notes.Root() {
+		t.Fatalf("expected the resolution of notes kept, got %v", resolved)
+	}
+	key := listingCacheKey(dirCid.Cid(), ipath.New(dirPath.String()+"/"), dirPath.String()+"/", "")
+	if page, ok := c.get(key); !ok || string(page) != listing {
+		t.Fatal("expected the listing kept")
+	}
+	if ctype, ok := c.get(contentTypeCacheKey(notes.Cid())); !ok || string(ctype) != "text/plain; charset=utf-8" {
+		t.Fatalf("expected the content type of notes kept, got %q", ctype)
+	}
+}
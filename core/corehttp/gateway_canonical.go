@@ -0,0 +1,101 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// CanonicalURLs selects the URLs of the content redirected to their canonical
+// form, see config.GatewayCanonicalize.
+type CanonicalURLs struct {
+	TrailingSlash   bool
+	PercentEncoding bool
+	CIDs            bool
+}
+
+// canonicalCidPath returns p with its root CID written as a CIDv1 in
+// lowercase base32, if p is an /ipfs/ path.
+func canonicalCidPath(p string) string {
+	if !strings.HasPrefix(p, ipfsPathPrefix) {
+		return p
+	}
+	parts := strings.SplitN(p[len(ipfsPathPrefix):], "/", 2)
+	c, err := cid.Decode(parts[0])
+	if err != nil {
+		return p
+	}
+	if c.Version() == 0 {
+		c = cid.NewCidV1(cid.DagProtobuf, c.Hash())
+	}
+	parts[0] = c.String()
+	return ipfsPathPrefix + strings.Join(parts, "/")
+}
+
+// redirectCanonical redirects the request to the URL with the canonical
+// escaped path p, and tells whether it did, when p is not the path requested.
+func redirectCanonical(w http.ResponseWriter, r *http.Request, u *url.URL, p string) bool {
+	if p == "" || p == u.EscapedPath() {
+		return false
+	}
+	if w.Header().Get("Location") != "" {
+		// already redirected to a subdomain gateway, see statusResponseWriter
+		return false
+	}
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	http.Redirect(w, r, p, http.StatusMovedPermanently)
+	return true
+}
+
+// redirectToCanonicalPath redirects the requests whose path is not
+// percent-encoded canonically, or whose root CID is not canonical, before
+// their path is resolved.
+func (i *gatewayHandler) redirectToCanonicalPath(w http.ResponseWriter, r *http.Request) bool {
+	c := i.config.Canonical
+	if !c.PercentEncoding && !c.CIDs {
+		return false
+	}
+	// the path as requested, before the hostname rewrites
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return false
+	}
+
+	p := u.Path
+	if _, ok := r.Context().Value("gw-hostname").(string); c.CIDs && !ok {
+		// the root CIDs of the subdomain gateways are in the hostname, and
+		// already redirected to the canonical CID
+		p = canonicalCidPath(p)
+	}
+	if !c.PercentEncoding && p == u.Path {
+		return false
+	}
+	return redirectCanonical(w, r, u, (&url.URL{Path: p}).EscapedPath())
+}
+
+// redirectToCanonicalSlash redirects the requests for the directories without
+// a trailing slash, and for the files with one.
+func (i *gatewayHandler) redirectToCanonicalSlash(w http.ResponseWriter, r *http.Request, node files.Node) bool {
+	if !i.config.Canonical.TrailingSlash || r.URL.Query().Get("go-get") == "1" {
+		return false
+	}
+	u, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		return false
+	}
+
+	p := u.EscapedPath()
+	_, isDir := node.(files.Directory)
+	switch hasSlash := strings.HasSuffix(p, "/"); {
+	case isDir && !hasSlash:
+		p += "/"
+	case !isDir && hasSlash:
+		p = strings.TrimSuffix(p, "/")
+	}
+	return redirectCanonical(w, r, u, p)
+}
@@ -0,0 +1,99 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	mbase "github.com/multiformats/go-multibase"
+)
+
+func TestGatewayCanonicalURLs(t *testing.T) {
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.Canonicalize = config.GatewayCanonicalize{
+		TrailingSlash:   config.True,
+		PercentEncoding: config.True,
+		CIDs:            config.True,
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile([]byte("fnord")),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"a b.txt": files.NewBytesFile([]byte("spaced")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir.Cid().Version() != 0 {
+		t.Fatalf("expected a CIDv0, got %s", dir.Cid())
+	}
+	v1 := cid.NewCidV1(cid.DagProtobuf, dir.Cid().Hash())
+	upper, err := v1.StringOfBase(mbase.Base32Upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := "/ipfs/" + v1.String()
+
+	for _, c := range []struct {
+		p, location string
+	}{
+		{root + "/", ""},
+		{root + "/file.txt", ""},
+		{root + "/sub/a%20b.txt", ""},
+		{"/ipfs/" + dir.Cid().String() + "/file.txt", root + "/file.txt"},
+		{"/ipfs/" + upper + "/file.txt?filename=a.txt", root + "/file.txt?filename=a.txt"},
+		{root, root + "/"},
+		{root + "/sub?download=true", root + "/sub/?download=true"},
+		{root + "/file.txt/", root + "/file.txt"},
+		{root + "/%66ile.txt", root + "/file.txt"},
+		{root + "/sub/a%20b%2etxt", root + "/sub/a%20b.txt"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+c.p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if c.location == "" {
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("expected %s served, got %d", c.p, res.StatusCode)
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusMovedPermanently {
+			t.Errorf("expected %s redirected, got %d", c.p, res.StatusCode)
+			continue
+		}
+		if loc := res.Header.Get("Location"); !strings.HasSuffix(loc, c.location) {
+			t.Errorf("expected %s redirected to %s, got %s", c.p, c.location, loc)
+		}
+	}
+}
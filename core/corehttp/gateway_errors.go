@@ -0,0 +1,224 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/apierr"
+	"github.com/ipfs/go-ipfs/namechain"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-path/resolver"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+// errorCodeHeader tells the programmatic clients of the gateway what an error
+// is about, beyond its status.
+const errorCodeHeader = "X-Ipfs-Error-Code"
+
+// The codes of the gateway errors.
+const (
+	errorCodeBadRequest            = "bad-request"
+	errorCodeForbidden             = "forbidden"
+	errorCodeNotFound              = "not-found"
+	errorCodeBlocked               = "blocked"
+	errorCodeRateLimited           = "rate-limited"
+	errorCodeTimeout               = "timeout"
+	errorCodeNameResolutionTimeout = "name-resolution-timeout"
+	errorCodeNameResolutionFailed  = "name-resolution-failed"
+	errorCodeNameChainTooDeep      = "name-chain-too-deep"
+	errorCodeOffline               = "offline"
+	errorCodeQuotaExceeded         = "quota-exceeded"
+	errorCodeUnavailable           = "unavailable"
+	errorCodeInternal              = "internal"
+)
+
+// errorCode returns the code of an error answered with status, from err if
+// known, or else from status.
+func errorCode(err error, status int) string {
+	var noLink resolver.ErrNoLink
+	switch {
+	case err == nil:
+	case errors.Is(err, namechain.ErrStepTimeout):
+		return errorCodeNameResolutionTimeout
+	case errors.Is(err, namechain.ErrTooDeep):
+		return errorCodeNameChainTooDeep
+	case errors.Is(err, coreiface.ErrResolveFailed):
+		return errorCodeNameResolutionFailed
+	case errors.Is(err, coreiface.ErrOffline):
+		return errorCodeOffline
+	case errors.Is(err, context.DeadlineExceeded):
+		return errorCodeTimeout
+	case errors.As(err, &noLink), errors.Is(err, routing.ErrNotFound), ipld.IsNotFound(err):
+		return errorCodeNotFound
+	case apierr.KindOf(err) == apierr.QuotaExceeded:
+		return errorCodeQuotaExceeded
+	}
+
+	switch {
+	case status == http.StatusNotFound:
+		return errorCodeNotFound
+	case status == http.StatusForbidden:
+		return errorCodeForbidden
+	case status == http.StatusUnavailableForLegalReasons:
+		return errorCodeBlocked
+	case status == http.StatusTooManyRequests:
+		return errorCodeRateLimited
+	case status == http.StatusRequestTimeout, status == http.StatusGatewayTimeout:
+		return errorCodeTimeout
+	case status == http.StatusServiceUnavailable:
+		return errorCodeUnavailable
+	case status >= 500:
+		return errorCodeInternal
+	}
+	return errorCodeBadRequest
+}
+
+// retryableErrorCodes are the codes of the errors that may not happen again
+// if the request is retried.
+var retryableErrorCodes = map[string]bool{
+	errorCodeRateLimited:           true,
+	errorCodeTimeout:               true,
+	errorCodeNameResolutionTimeout: true,
+	errorCodeOffline:               true,
+	errorCodeUnavailable:           true,
+}
+
+// jsonError is the body of the errors of the gateway to the clients preferring
+// JSON.
+type jsonError struct {
+	Code    string
+	Message string
+	Path    string
+	// Retryable tells if the request may succeed if retried, after
+	// RetryAfter seconds if set.
+	Retryable  bool
+	RetryAfter int `json:",omitempty"`
+}
+
+// prefersJSON reports whether an Accept header prefers application/json to
+// the HTML and plain text of the error pages.
+func prefersJSON(accept string) bool {
+	jsonQ, textQ := 0.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			if q > jsonQ {
+				jsonQ = q
+			}
+		case "text/html", "text/plain", "text/*", "*/*":
+			if q > textQ {
+				textQ = q
+			}
+		}
+	}
+	return jsonQ > 0 && jsonQ >= textQ
+}
+
+// withStructuredErrors adds the code of the errors of next to their headers,
+// and serves them as JSON to the clients preferring it.
+func withStructuredErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &errorResponseWriter{ResponseWriter: w, buffer: prefersJSON(r.Header.Get("Accept"))}
+		next.ServeHTTP(ew, r)
+		if ew.code == 0 {
+			return
+		}
+
+		h := w.Header()
+		body := jsonError{
+			Code:    h.Get(errorCodeHeader),
+			Message: strings.TrimSpace(ew.buf.String()),
+			Path:    r.URL.Path,
+		}
+		body.Retryable = retryableErrorCodes[body.Code]
+		if retry, err := strconv.Atoi(h.Get("Retry-After")); err == nil {
+			body.RetryAfter = retry
+		}
+		h.Set("Content-Type", "application/json")
+		h.Del("Content-Length")
+		w.WriteHeader(ew.code)
+		if r.Method != http.MethodHead {
+			_ = json.NewEncoder(w).Encode(body)
+		}
+	})
+}
+
+// errorResponseWriter sets the code of the errors written with http.Error,
+// and buffers them if buffer is set. The other responses are passed through.
+type errorResponseWriter struct {
+	http.ResponseWriter
+	buffer bool
+	// code is the status of the buffered error, 0 if the response is passed
+	// through
+	code    int
+	started bool
+	buf     bytes.Buffer
+}
+
+func (w *errorResponseWriter) WriteHeader(code int) {
+	if w.started {
+		return
+	}
+	w.started = true
+	// http.Error sets these, and nothing else does with an error status
+	h := w.Header()
+	if code >= 400 && h.Get("Content-Type") == "text/plain; charset=utf-8" && h.Get("X-Content-Type-Options") == "nosniff" {
+		if h.Get(errorCodeHeader) == "" {
+			h.Set(errorCodeHeader, errorCode(nil, code))
+		}
+		if w.buffer {
+			w.code = code
+			return
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *errorResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom passes the copies of the responses passed through on to the
+// ResponseWriter, which sends the files with sendfile.
+func (w *errorResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.code != 0 {
+		return w.buf.ReadFrom(r)
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func (w *errorResponseWriter) Flush() {
+	if w.code != 0 {
+		return
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
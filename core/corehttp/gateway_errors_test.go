@@ -0,0 +1,95 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core/corerepo"
+	"github.com/ipfs/go-ipfs/namechain"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+func TestErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{&namechain.StepError{Step: 2, Name: "/ipns/a", Err: namechain.ErrStepTimeout}, http.StatusGatewayTimeout, errorCodeNameResolutionTimeout},
+		{fmt.Errorf("resolve: %w", coreiface.ErrOffline), http.StatusServiceUnavailable, errorCodeOffline},
+		{context.DeadlineExceeded, http.StatusRequestTimeout, errorCodeTimeout},
+		{fmt.Errorf("put: %w", corerepo.ErrMaxStorageExceeded), http.StatusInternalServerError, errorCodeQuotaExceeded},
+		{errors.New("oops"), http.StatusNotFound, errorCodeNotFound},
+		{errors.New("oops"), http.StatusInternalServerError, errorCodeInternal},
+		{nil, http.StatusTooManyRequests, errorCodeRateLimited},
+		{nil, http.StatusBadRequest, errorCodeBadRequest},
+	} {
+		if code := errorCode(tc.err, tc.status); code != tc.code {
+			t.Errorf("%v (%d): expected %s, got %s", tc.err, tc.status, tc.code, code)
+		}
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"application/json":                  true,
+		"application/json, */*;q=0.5":       true,
+		"text/html, application/json":       true,
+		"text/html, application/json;q=0.9": false,
+		"*/*":                               false,
+		"":                                  false,
+	} {
+		if prefersJSON(accept) != expected {
+			t.Errorf("%q: expected %t", accept, expected)
+		}
+	}
+}
+
+func TestStructuredErrors(t *testing.T) {
+	handler := withStructuredErrors(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipfs/ok":
+			_, _ = w.Write([]byte("ok"))
+		case "/ipfs/limited":
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			webError(w, "ipfs resolve -r "+r.URL.Path, context.DeadlineExceeded, http.StatusInternalServerError)
+		}
+	}))
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/ipfs/slow", "text/plain")
+	if w.Code != http.StatusRequestTimeout || w.Header().Get(errorCodeHeader) != errorCodeTimeout {
+		t.Fatalf("expected a timeout, got %d %q", w.Code, w.Header().Get(errorCodeHeader))
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Fatalf("expected a plain text error, got %s", ct)
+	}
+
+	w = get("/ipfs/limited", "application/json")
+	var body jsonError
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a JSON error, got %q: %s", w.Body, err)
+	}
+	expected := jsonError{Code: errorCodeRateLimited, Message: "slow down", Path: "/ipfs/limited", Retryable: true, RetryAfter: 3}
+	if w.Code != http.StatusTooManyRequests || body != expected {
+		t.Fatalf("unexpected error %d %+v", w.Code, body)
+	}
+
+	w = get("/ipfs/ok", "application/json")
+	if w.Code != http.StatusOK || w.Body.String() != "ok" || w.Header().Get(errorCodeHeader) != "" {
+		t.Fatalf("expected the response to be passed through, got %d %q", w.Code, w.Body)
+	}
+}
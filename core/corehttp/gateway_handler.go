@@ -2,6 +2,7 @@ package corehttp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -18,6 +19,8 @@ import (
 
 	cid "github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/namechain"
+	"github.com/ipfs/go-ipfs/namespaces"
 	dag "github.com/ipfs/go-merkledag"
 	mfs "github.com/ipfs/go-mfs"
 	path "github.com/ipfs/go-path"
@@ -76,6 +79,13 @@ type gatewayHandler struct {
 	unixfsGenDirGetMetric *prometheus.HistogramVec
 	carStreamGetMetric    *prometheus.HistogramVec
 	rawBlockGetMetric     *prometheus.HistogramVec
+	tarStreamGetMetric    *prometheus.HistogramVec
+	zipStreamGetMetric    *prometheus.HistogramVec
+	dagJSONGetMetric      *prometheus.HistogramVec
+	fileStatGetMetric     *prometheus.HistogramVec
+
+	// the indexes of the CARs whose ranges were requested
+	carIndexes *carIndexes
 }
 
 // StatusResponseWriter enables us to override HTTP Status Code passed to
@@ -98,6 +108,12 @@ func (sw *statusResponseWriter) WriteHeader(code int) {
 	sw.ResponseWriter.WriteHeader(code)
 }
 
+// ReadFrom passes the copies on to the ResponseWriter, which sends the files
+// with sendfile.
+func (sw *statusResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(sw.ResponseWriter, r)
+}
+
 // ServeContent replies to the request using the content in the provided ReadSeeker
 // and returns the status code written and any error encountered during a write.
 // It wraps http.ServeContent which takes care of If-None-Match+Etag,
@@ -139,7 +155,7 @@ func (w *errRecordingResponseWriter) Write(p []byte) (int, error) {
 // ReadFrom exposes errRecordingResponseWriter's underlying ResponseWriter to io.Copy
 // to allow optimized methods to be taken advantage of.
 func (w *errRecordingResponseWriter) ReadFrom(r io.Reader) (n int64, err error) {
-	n, err = io.Copy(w.ResponseWriter, r)
+	n, err = copyContent(w.ResponseWriter, r)
 	if err != nil && w.err == nil {
 		w.err = err
 	}
@@ -192,8 +208,9 @@ func newGatewayHistogramMetric(name string, help string) *prometheus.HistogramVe
 
 func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
 	i := &gatewayHandler{
-		config: c,
-		api:    api,
+		config:     c,
+		api:        api,
+		carIndexes: newCarIndexes(),
 		// Improved Metrics
 		// ----------------------------
 		// Time till the first content block (bar in /ipfs/cid/foo/bar)
@@ -225,6 +242,26 @@ func newGatewayHandler(c GatewayConfig, api coreiface.CoreAPI) *gatewayHandler {
 			"gw_raw_block_get_duration_seconds",
 			"The time to GET an entire raw Block from the gateway.",
 		),
+		// TAR: time it takes to return requested TAR stream
+		tarStreamGetMetric: newGatewayHistogramMetric(
+			"gw_tar_stream_get_duration_seconds",
+			"The time to GET an entire TAR stream from the gateway.",
+		),
+		// ZIP: time it takes to return requested ZIP stream
+		zipStreamGetMetric: newGatewayHistogramMetric(
+			"gw_zip_stream_get_duration_seconds",
+			"The time to GET an entire ZIP stream from the gateway.",
+		),
+		// DAG-JSON: time it takes to return requested node as DAG-JSON
+		dagJSONGetMetric: newGatewayHistogramMetric(
+			"gw_dag_json_get_duration_seconds",
+			"The time to GET an entire DAG-JSON node from the gateway.",
+		),
+		// File stat: time it takes to return the stat of the requested file
+		fileStatGetMetric: newGatewayHistogramMetric(
+			"gw_file_stat_get_duration_seconds",
+			"The time to GET the stat of a UnixFS node from the gateway.",
+		),
 
 		// Legacy Metrics
 		// ----------------------------
@@ -271,6 +308,10 @@ func (i *gatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if !i.checkAccess(w, r) {
+		return
+	}
+
 	if i.config.Writable {
 		switch r.Method {
 		case http.MethodPost:
@@ -369,7 +410,17 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	if _, ok := r.URL.Query()[watchParam]; ok && strings.HasPrefix(r.URL.Path, ipnsPathPrefix) {
+		i.serveNameUpdates(w, r)
+		return
+	}
+
 	contentPath := ipath.New(r.URL.Path)
+	if p, ok := namespaces.Path(r.URL.Path); ok {
+		// the paths of the namespaces added by plugins are mutable, as the
+		// /ipns/ paths
+		contentPath = p
+	}
 	if pathErr := contentPath.IsValid(); pathErr != nil {
 		if fixupSuperfluousNamespace(w, r.URL.Path, r.URL.RawQuery) {
 			// the error was due to redundant namespace, which we were able to fix
@@ -382,14 +433,36 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if i.redirectToCanonicalPath(w, r) {
+		logger.Debugw("redirect to the canonical path", "status", http.StatusMovedPermanently)
+		return
+	}
+
+	// the data of an identity CID is checked before any resolution
+	root, isRoot := rootCid(contentPath)
+	if isRoot && !i.checkInlineSize(w, root) {
+		return
+	}
+
 	// Resolve path to the final DAG node for the ETag
-	resolvedPath, err := i.api.ResolvePath(r.Context(), contentPath)
-	switch err {
-	case nil:
-	case coreiface.ErrOffline:
+	resolvedPath, err := i.resolvePath(r.Context(), contentPath)
+	switch {
+	case err == nil:
+	case errors.Is(err, coreiface.ErrOffline):
 		webError(w, "ipfs resolve -r "+debugStr(contentPath.String()), err, http.StatusServiceUnavailable)
 		return
+	case errors.Is(err, namechain.ErrStepTimeout):
+		webError(w, "ipfs resolve -r "+debugStr(contentPath.String()), err, http.StatusGatewayTimeout)
+		return
+	case isRoot && i.isMalformedInline(r.Context(), root):
+		webError(w, "ipfs resolve -r "+debugStr(contentPath.String()), err, http.StatusBadRequest)
+		return
 	default:
+		// the rules of the _redirects file of the site, if any
+		if i.serveRedirectsIfPresent(w, r, contentPath, begin, logger) {
+			return
+		}
+
 		// if Accept is text/html, see if ipfs-404.html is present
 		if i.servePretty404IfPresent(w, r, contentPath) {
 			logger.Debugw("serve pretty 404 if present")
@@ -400,6 +473,22 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// the identity CIDs linked from the content, or named by /ipns/ paths
+	if !i.checkInlineSize(w, resolvedPath.Cid()) {
+		return
+	}
+
+	if !i.checkResolvedAccess(w, resolvedPath.Cid()) {
+		logger.Debugw("denied by the access control", "path", contentPath)
+		return
+	}
+
+	// Ask the content policy, if any, before serving anything
+	if !i.checkContentPolicy(w, r, contentPath) {
+		logger.Debugw("denied by content policy", "path", contentPath)
+		return
+	}
+
 	// Detect when explicit Accept header or ?format parameter are present
 	responseFormat, formatParams, err := customResponseFormat(r)
 	if err != nil {
@@ -410,12 +499,25 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("ResolvedPath", resolvedPath.String()))
 
 	// Finish early if client already has matching Etag
-	ifNoneMatch := r.Header.Get("If-None-Match")
-	if ifNoneMatch == getEtag(r, resolvedPath.Cid()) || ifNoneMatch == getDirListingEtag(resolvedPath.Cid()) {
+	// (the generated dir listing only exists in the implicit format)
+	etags := []string{getEtag(r, resolvedPath.Cid())}
+	if responseFormat == "" {
+		etags = append(etags, getDirListingEtag(resolvedPath.Cid()))
+		if i.config.RenderMarkdown {
+			etags = append(etags, getRenderedEtag(resolvedPath.Cid()))
+		}
+	}
+	if etag, ok := matchingEtag(r.Header.Get("If-None-Match"), etags...); ok {
+		// the 304 names the representation still valid, for the clients to
+		// resume or revalidate the range of the right one
+		w.Header().Set("Etag", etag)
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
+	// the range requests validated with a date rather than an Etag
+	r = checkIfRange(r, contentPath, responseFormat)
+
 	// Update the global metric of the time it takes to read the final root block of the requested resource
 	// NOTE: for legacy reasons this happens before we go into content-type specific code paths
 	_, err = i.api.Block().Get(r.Context(), resolvedPath)
@@ -431,6 +533,9 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	// HTTP Headers
 	i.addUserHeaders(w) // ok, _now_ write user's headers.
 	w.Header().Set("X-Ipfs-Path", contentPath.String())
+	// The response format may come from the Accept header, HTTP caches must
+	// not serve one format for another
+	w.Header().Add("Vary", "Accept")
 
 	if rootCids, err := i.buildIpfsRootsHeader(contentPath.String(), r); err == nil {
 		w.Header().Set("X-Ipfs-Roots", rootCids)
@@ -454,6 +559,22 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 		carVersion := formatParams["version"]
 		i.serveCar(w, r, resolvedPath, contentPath, carVersion, begin)
 		return
+	case "application/x-tar":
+		logger.Debugw("serving tar file", "path", contentPath)
+		i.serveTar(w, r, resolvedPath, contentPath, begin)
+		return
+	case "application/zip":
+		logger.Debugw("serving zip file", "path", contentPath)
+		i.serveZip(w, r, resolvedPath, contentPath, begin)
+		return
+	case "application/vnd.ipld.dag-json":
+		logger.Debugw("serving dag-json", "path", contentPath)
+		i.serveDagJSON(w, r, resolvedPath, contentPath, begin)
+		return
+	case "application/vnd.ipfs.file-stat+json":
+		logger.Debugw("serving file stat", "path", contentPath)
+		i.serveFileStat(w, r, resolvedPath, contentPath, begin)
+		return
 	default: // catch-all for unsuported application/vnd.*
 		err := fmt.Errorf("unsupported format %q", responseFormat)
 		webError(w, "failed respond with requested content type", err, http.StatusBadRequest)
@@ -461,6 +582,36 @@ func (i *gatewayHandler) getOrHeadHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+// resolvePath resolves the IPNS names and DNSLinks of contentPath one at a
+// time, within the bounds of the config, then the rest of contentPath.
+func (i *gatewayHandler) resolvePath(ctx context.Context, contentPath ipath.Path) (ipath.Resolved, error) {
+	if contentPath.Namespace() == "ipns" {
+		p, err := namechain.Resolve(ctx, i.api.Name(), contentPath, i.config.NameResolution)
+		var stepErr *namechain.StepError
+		if errors.As(err, &stepErr) && stepErr.Step == 1 {
+			// the name of the request, already in the error page
+			return nil, stepErr.Err
+		}
+		if err != nil {
+			return nil, err
+		}
+		contentPath = p
+	}
+	// the resolutions of the /ipfs/ paths never change
+	if contentPath.Namespace() != "ipfs" {
+		return i.api.ResolvePath(ctx, contentPath)
+	}
+	if resolved, ok := i.config.Cache.resolved(contentPath); ok {
+		return resolved, nil
+	}
+	resolved, err := i.api.ResolvePath(ctx, contentPath)
+	if err != nil {
+		return nil, err
+	}
+	i.config.Cache.putResolved(resolved)
+	return resolved, nil
+}
+
 func (i *gatewayHandler) servePretty404IfPresent(w http.ResponseWriter, r *http.Request, contentPath ipath.Path) bool {
 	resolved404Path, ctype, err := i.searchUpTreeFor404(r, contentPath)
 	if err != nil {
@@ -703,7 +854,8 @@ func addCacheControlHeaders(w http.ResponseWriter, r *http.Request, contentPath
 		// Set modtime to 'zero time' to disable Last-Modified header (superseded by Cache-Control)
 		modtime = noModtime
 
-		// TODO: set Last-Modified? - TBD - /ipfs/ modification metadata is present in unixfs 1.5 https://github.com/ipfs/go-ipfs/issues/6920?
+		// The files with a modification time in their UnixFS 1.5 metadata
+		// get it as Last-Modified, see serveFile
 	}
 
 	return modtime
@@ -767,8 +919,10 @@ func (i *gatewayHandler) buildIpfsRootsHeader(contentPath string, r *http.Reques
 	*/
 	var sp strings.Builder
 	var pathRoots []string
-	pathSegments := strings.Split(contentPath[6:], "/")
-	sp.WriteString(contentPath[:5]) // /ipfs or /ipns
+	// the namespace, such as /ipfs or /ipns
+	nsLen := strings.IndexByte(contentPath[1:], '/') + 1
+	pathSegments := strings.Split(contentPath[nsLen+1:], "/")
+	sp.WriteString(contentPath[:nsLen])
 	for _, root := range pathSegments {
 		if root == "" {
 			continue
@@ -786,11 +940,13 @@ func (i *gatewayHandler) buildIpfsRootsHeader(contentPath string, r *http.Reques
 }
 
 func webError(w http.ResponseWriter, message string, err error, defaultCode int) {
-	if _, ok := err.(resolver.ErrNoLink); ok {
+	// the errors of the CoreAPI wrap those of the resolver and routing
+	var noLink resolver.ErrNoLink
+	if errors.As(err, &noLink) {
 		webErrorWithCode(w, message, err, http.StatusNotFound)
-	} else if err == routing.ErrNotFound {
+	} else if errors.Is(err, routing.ErrNotFound) {
 		webErrorWithCode(w, message, err, http.StatusNotFound)
-	} else if err == context.DeadlineExceeded {
+	} else if errors.Is(err, context.DeadlineExceeded) {
 		webErrorWithCode(w, message, err, http.StatusRequestTimeout)
 	} else {
 		webErrorWithCode(w, message, err, defaultCode)
@@ -798,6 +954,7 @@ func webError(w http.ResponseWriter, message string, err error, defaultCode int)
 }
 
 func webErrorWithCode(w http.ResponseWriter, message string, err error, code int) {
+	w.Header().Set(errorCodeHeader, errorCode(err, code))
 	http.Error(w, fmt.Sprintf("%s: %s", message, err), code)
 	if code >= 500 {
 		log.Warnf("server error: %s: %s", message, err)
@@ -824,15 +981,55 @@ func getEtag(r *http.Request, cid cid.Cid) string {
 	suffix := `"`
 	responseFormat, _, err := customResponseFormat(r)
 	if err == nil && responseFormat != "" {
-		// application/vnd.ipld.foo → foo
-		f := responseFormat[strings.LastIndex(responseFormat, ".")+1:]
+		// application/vnd.ipld.foo → foo, application/x-tar → x-tar,
+		// application/zip → zip
+		f := responseFormat[strings.LastIndexAny(responseFormat, "./")+1:]
 		// Etag: "cid.foo" (gives us nice compression together with Content-Disposition in block (raw) and car responses)
 		suffix = `.` + f + suffix
 	}
-	// TODO: include selector suffix when https://github.com/ipfs/go-ipfs/issues/8769 lands
+	// Etag: "cid.depth-1.car" or "cid.entity-bytes-0-1023.car" for the CARs
+	// of part of a DAG
+	if responseFormat == "application/vnd.ipld.car" {
+		if scope, err := parseCarScope(r); err == nil && scope.String() != "" {
+			suffix = "." + scope.String() + suffix
+		}
+	}
+	// Etag: "cid.w320.jpeg" for the resized images
+	if params, ok, err := parseImageParams(r); err == nil && ok {
+		suffix = "." + params.String() + suffix
+	}
 	return prefix + cid.String() + suffix
 }
 
+// etagMatch reports whether the If-None-Match header matches one of etags,
+// using the weak comparison of RFC 7232: weak and strong etags of the same
+// value match.
+func etagMatch(ifNoneMatch string, etags ...string) bool {
+	_, ok := matchingEtag(ifNoneMatch, etags...)
+	return ok
+}
+
+// matchingEtag returns the first of etags the If-None-Match header matches,
+// see etagMatch.
+func matchingEtag(ifNoneMatch string, etags ...string) (string, bool) {
+	if ifNoneMatch == "" || len(etags) == 0 {
+		return "", false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return etags[0], true
+		}
+		tag = strings.TrimPrefix(tag, "W/")
+		for _, etag := range etags {
+			if tag == strings.TrimPrefix(etag, "W/") {
+				return etag, true
+			}
+		}
+	}
+	return "", false
+}
+
 // return explicit response format if specified in request as query parameter or via Accept HTTP header
 func customResponseFormat(r *http.Request) (mediaType string, params map[string]string, err error) {
 	if formatParam := r.URL.Query().Get("format"); formatParam != "" {
@@ -842,14 +1039,24 @@ func customResponseFormat(r *http.Request) (mediaType string, params map[string]
 			return "application/vnd.ipld.raw", nil, nil
 		case "car":
 			return "application/vnd.ipld.car", nil, nil
+		case "tar":
+			return "application/x-tar", nil, nil
+		case "zip":
+			return "application/zip", nil, nil
+		case "dag-json":
+			return "application/vnd.ipld.dag-json", nil, nil
 		}
 	}
+	if statParam := r.URL.Query().Get("stat"); statParam == "true" {
+		return "application/vnd.ipfs.file-stat+json", nil, nil
+	}
 	// Browsers and other user agents will send Accept header with generic types like:
 	// Accept:text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8
 	// We only care about explciit, vendor-specific content-types.
 	for _, accept := range r.Header.Values("Accept") {
-		// respond to the very first ipld content type
-		if strings.HasPrefix(accept, "application/vnd.ipld") {
+		// respond to the very first ipld, tar, zip or file stat content type
+		if strings.HasPrefix(accept, "application/vnd.ipld") || strings.HasPrefix(accept, "application/x-tar") ||
+			strings.HasPrefix(accept, "application/zip") || strings.HasPrefix(accept, "application/vnd.ipfs.file-stat+json") {
 			mediatype, params, err := mime.ParseMediaType(accept)
 			if err != nil {
 				return "", nil, err
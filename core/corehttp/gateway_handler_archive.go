@@ -0,0 +1,266 @@
+package corehttp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/tracing"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// archiveModTime is the modification time of the entries of the archives,
+// which is fixed for the archive of a CID to always be the same, and the
+// earliest one ZIP supports.
+var archiveModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveFormat is a format of the archives of the UnixFS files and
+// directories.
+type archiveFormat struct {
+	name      string
+	ext       string
+	mediaType string
+	newWriter func(io.Writer) archiveWriter
+}
+
+var (
+	tarFormat = archiveFormat{
+		name:      "TAR",
+		ext:       ".tar",
+		mediaType: "application/x-tar",
+		newWriter: func(w io.Writer) archiveWriter { return &tarArchive{tw: tar.NewWriter(w)} },
+	}
+	zipFormat = archiveFormat{
+		name:      "ZIP",
+		ext:       ".zip",
+		mediaType: "application/zip",
+		newWriter: func(w io.Writer) archiveWriter { return &zipArchive{zw: zip.NewWriter(w)} },
+	}
+)
+
+// serveTar returns a TAR stream of the UnixFS file or directory
+func (i *gatewayHandler) serveTar(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, begin time.Time) {
+	i.serveArchive(w, r, resolvedPath, contentPath, tarFormat, i.tarStreamGetMetric, begin)
+}
+
+// serveZip returns a ZIP stream of the UnixFS file or directory
+func (i *gatewayHandler) serveZip(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, begin time.Time) {
+	i.serveArchive(w, r, resolvedPath, contentPath, zipFormat, i.zipStreamGetMetric, begin)
+}
+
+func (i *gatewayHandler) serveArchive(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, format archiveFormat, metric *prometheus.HistogramVec, begin time.Time) {
+	ctx, span := tracing.Span(r.Context(), "Gateway", "Serve"+format.name, trace.WithAttributes(attribute.String("path", resolvedPath.String())))
+	defer span.End()
+	rootCid := resolvedPath.Cid()
+
+	// The archive of a CID is always the same: its entries are sorted by
+	// name, and carry no time but archiveModTime, so the Etag is strong
+	etag := getEtag(r, rootCid)
+	w.Header().Set("Etag", etag)
+
+	// Finish early if Etag match
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	file, err := i.api.Unixfs().Get(ctx, resolvedPath)
+	if err != nil {
+		webError(w, "ipfs get "+debugStr(contentPath.String()), err, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Set Content-Disposition
+	name := rootCid.String() + format.ext
+	setContentDispositionHeader(w, name, "attachment")
+
+	// Like CAR streams, archive streams are not seekable and may be
+	// interrupted
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Cache-Control", "no-cache, no-transform")
+
+	w.Header().Set("Content-Type", format.mediaType)
+	w.Header().Set("X-Content-Type-Options", "nosniff") // no funny business in the browsers :^)
+
+	// The stream is not built for HEAD requests, it would fetch the whole DAG
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	aw := format.newWriter(w)
+	if err := writeArchive(aw, file, rootCid.String()); err != nil {
+		// The headers are sent already, the error can only be a trailer
+		w.Header().Set("X-Stream-Error", err.Error())
+		return
+	}
+	if err := aw.Close(); err != nil {
+		w.Header().Set("X-Stream-Error", err.Error())
+		return
+	}
+
+	// Update metrics
+	metric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+}
+
+// archiveWriter writes the entries of an archive, named by their path.
+type archiveWriter interface {
+	dir(name string) error
+	file(name string, size int64, r io.Reader) error
+	symlink(name, target string) error
+	Close() error
+}
+
+// archiveEntry is an entry of a directory written to an archive.
+type archiveEntry struct {
+	name string
+	nd   files.Node
+}
+
+// writeArchive writes nd to aw as name, and the entries of the directories
+// below it in the order of their names.
+func writeArchive(aw archiveWriter, nd files.Node, name string) error {
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return aw.symlink(name, nd.Target)
+	case files.File:
+		size, err := nd.Size()
+		if err != nil {
+			return err
+		}
+		return aw.file(name, size, nd)
+	case files.Directory:
+		if err := aw.dir(name); err != nil {
+			return err
+		}
+
+		var entries []archiveEntry
+		defer func() {
+			for _, e := range entries {
+				e.nd.Close()
+			}
+		}()
+		it := nd.Entries()
+		for it.Next() {
+			entries = append(entries, archiveEntry{name: it.Name(), nd: it.Node()})
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		// the sharded directories list their entries in the order of the
+		// hashes of their names
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].name < entries[j].name
+		})
+
+		for _, e := range entries {
+			if e.name == "" || e.name == "." || e.name == ".." || strings.ContainsAny(e.name, "/\x00") {
+				return fmt.Errorf("invalid name %q in %s", e.name, name)
+			}
+			if err := writeArchive(aw, e.nd, name+"/"+e.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported UnixFS node type at %s", name)
+	}
+}
+
+// tarArchive writes a TAR archive.
+type tarArchive struct {
+	tw *tar.Writer
+}
+
+func (a *tarArchive) dir(name string) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  archiveModTime,
+	})
+}
+
+func (a *tarArchive) file(name string, size int64, r io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  archiveModTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, r)
+	return err
+}
+
+func (a *tarArchive) symlink(name, target string) error {
+	return a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  archiveModTime,
+	})
+}
+
+func (a *tarArchive) Close() error {
+	return a.tw.Close()
+}
+
+// zipArchive writes a ZIP archive, its entries stored uncompressed.
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) create(name string, mode os.FileMode) (io.Writer, error) {
+	h := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: archiveModTime,
+	}
+	h.SetMode(mode)
+	return a.zw.CreateHeader(h)
+}
+
+func (a *zipArchive) dir(name string) error {
+	_, err := a.create(name+"/", os.ModeDir|0755)
+	return err
+}
+
+func (a *zipArchive) file(name string, size int64, r io.Reader) error {
+	w, err := a.create(name, 0644)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(w, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: expected %d bytes, read %d", name, size, n)
+	}
+	return err
+}
+
+func (a *zipArchive) symlink(name, target string) error {
+	w, err := a.create(name, os.ModeSymlink|0777)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
@@ -0,0 +1,144 @@
+package corehttp
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+func TestArchive(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+
+	// the entries of the sharded directories are not in the order of their
+	// names
+	prevShardingSize := uio.HAMTShardingSize
+	defer func() { uio.HAMTShardingSize = prevShardingSize }()
+	uio.HAMTShardingSize = 1
+
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"b.txt": files.NewBytesFile([]byte("bbb")),
+		"a": files.NewMapDirectory(map[string]files.Node{
+			"z":    files.NewBytesFile([]byte("zz")),
+			"y":    files.NewBytesFile(nil),
+			"link": files.NewLinkFile("../b.txt", nil),
+		}),
+		"c": files.NewMapDirectory(nil),
+	})
+	k, err := api.Unixfs().Add(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := k.Cid().String()
+
+	get := func(query, accept string) []byte {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+k.String()+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK || res.Header.Get("X-Stream-Error") != "" {
+			t.Fatalf("%s: unexpected response %d %q", query, res.StatusCode, res.Header.Get("X-Stream-Error"))
+		}
+		if etag := res.Header.Get("Etag"); strings.HasPrefix(etag, "W/") {
+			t.Fatalf("%s: expected a strong Etag, got %s", query, etag)
+		}
+		return body
+	}
+
+	// name, content, or the target of the symlinks
+	expected := [][2]string{
+		{root + "/", ""},
+		{root + "/a/", ""},
+		{root + "/a/link", "../b.txt"},
+		{root + "/a/y", ""},
+		{root + "/a/z", "zz"},
+		{root + "/b.txt", "bbb"},
+		{root + "/c/", ""},
+	}
+	check := func(format string, entries [][2]string) {
+		t.Helper()
+		if len(entries) != len(expected) {
+			t.Fatalf("%s: expected %v, got %v", format, expected, entries)
+		}
+		for i, e := range entries {
+			if e != expected[i] {
+				t.Fatalf("%s: expected entry %v, got %v", format, expected[i], e)
+			}
+		}
+	}
+
+	tarball := get("?format=tar", "")
+	if again := get("", "application/x-tar"); !bytes.Equal(tarball, again) {
+		t.Fatal("expected the same TAR stream")
+	}
+	var entries [][2]string
+	tr := tar.NewReader(bytes.NewReader(tarball))
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeSymlink {
+			data = []byte(h.Linkname)
+		}
+		if !h.ModTime.Equal(archiveModTime) {
+			t.Fatalf("unexpected time %s of %s", h.ModTime, h.Name)
+		}
+		entries = append(entries, [2]string{h.Name, string(data)})
+	}
+	check("tar", entries)
+
+	archive := get("?format=zip", "")
+	if again := get("", "application/zip"); !bytes.Equal(archive, again) {
+		t.Fatal("expected the same ZIP stream")
+	}
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = nil
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Mode()&os.ModeSymlink != 0 && f.Name != root+"/a/link" {
+			t.Fatalf("unexpected symlink %s", f.Name)
+		}
+		entries = append(entries, [2]string{f.Name, string(data)})
+	}
+	check("zip", entries)
+}
@@ -3,15 +3,22 @@ package corehttp
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	blocks "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/go-ipfs/tracing"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	gocar "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
 	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -32,27 +39,32 @@ func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, resolv
 		webError(w, "unsupported CAR version", err, http.StatusBadRequest)
 		return
 	}
+	scope, err := parseCarScope(r)
+	if err != nil {
+		webError(w, "invalid CAR scope", err, http.StatusBadRequest)
+		return
+	}
 	rootCid := resolvedPath.Cid()
 
 	// Set Content-Disposition
 	name := rootCid.String() + ".car"
 	setContentDispositionHeader(w, name, "attachment")
 
-	// Weak Etag W/ because we can't guarantee byte-for-byte identical  responses
-	// (CAR is streamed, and in theory, blocks may arrive from datastore in non-deterministic order)
-	etag := `W/` + getEtag(r, rootCid)
+	// The blocks are written in the order of the traversal of the DAG, so
+	// the responses are byte-for-byte identical and the Etag is strong, as the
+	// If-Range of resumed downloads requires. The Etag includes the scope of
+	// the CARs of part of a DAG.
+	etag := getEtag(r, rootCid)
 	w.Header().Set("Etag", etag)
 
 	// Finish early if Etag match
-	if r.Header.Get("If-None-Match") == etag {
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
 		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	// Make it clear we don't support range-requests over a car stream
-	// Partial downloads and resumes should be handled using
-	// IPLD selectors: https://github.com/ipfs/go-ipfs/issues/8769
-	w.Header().Set("Accept-Ranges", "none")
+	// Range requests are served from the index of the CAR, see serveCarRange
+	w.Header().Set("Accept-Ranges", "bytes")
 
 	// Explicit Cache-Control to ensure fresh stream on retry.
 	// CAR stream could be interrupted, and client should be able to resume and get full response, not the truncated one
@@ -61,14 +73,20 @@ func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, resolv
 	w.Header().Set("Content-Type", "application/vnd.ipld.car; version=1")
 	w.Header().Set("X-Content-Type-Options", "nosniff") // no funny business in the browsers :^)
 
-	// Same go-car settings as dag.export command
+	// The stream is not built for HEAD requests, it would fetch the whole DAG
+	if r.Method == http.MethodHead {
+		return
+	}
+
 	store := dagStore{dag: i.api.Dag(), ctx: ctx}
 
-	// TODO: support selectors passed as request param: https://github.com/ipfs/go-ipfs/issues/8769
-	dag := gocar.Dag{Root: rootCid, Selector: selectorparse.CommonSelector_ExploreAllRecursively}
-	car := gocar.NewSelectiveCar(ctx, store, []gocar.Dag{dag}, gocar.TraverseLinksOnlyOnce())
+	if r.Header.Get("Range") != "" {
+		i.serveCarRange(w, r, store, rootCid, scope, name)
+		i.carStreamGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+		return
+	}
 
-	if err := car.Write(w); err != nil {
+	if err := writeCar(ctx, w, store, rootCid, scope); err != nil {
 		// We return error as a trailer, however it is not something browsers can access
 		// (https://github.com/mdn/browser-compat-data/issues/14703)
 		// Due to this, we suggest client always verify that
@@ -81,6 +99,297 @@ func (i *gatewayHandler) serveCar(w http.ResponseWriter, r *http.Request, resolv
 	i.carStreamGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
 }
 
+// newSelectiveCar returns the CAR of the DAG of root, with the same go-car
+// settings as the dag.export command
+func newSelectiveCar(ctx context.Context, store dagStore, root cid.Cid) gocar.SelectiveCar {
+	// TODO: support selectors passed as request param: https://github.com/ipfs/go-ipfs/issues/8769
+	dag := gocar.Dag{Root: root, Selector: selectorparse.CommonSelector_ExploreAllRecursively}
+	return gocar.NewSelectiveCar(ctx, store, []gocar.Dag{dag}, gocar.TraverseLinksOnlyOnce())
+}
+
+// carDepthAll is the depth of the CARs of whole DAGs
+const carDepthAll = -1
+
+// carScope is the part of the DAG of its root a CAR has.
+type carScope struct {
+	// depth is the number of links followed from the root, or carDepthAll
+	depth int
+
+	// entity limits the CAR to the blocks of the UnixFS entity of the root:
+	// all the blocks of a file, the blocks of a directory without its
+	// entries, or the root block of anything else
+	entity bool
+	// bytes further limits the CAR of a file to the blocks of the bytes from
+	// from to to, inclusive, counted from the end of the file when negative,
+	// up to the end when toEnd is set
+	bytes    bool
+	from, to int64
+	toEnd    bool
+}
+
+// String returns the scope as the suffix of the Etag of its CARs, empty for
+// the whole DAG.
+func (s carScope) String() string {
+	switch {
+	case s.bytes && s.toEnd:
+		return fmt.Sprintf("entity-bytes-%d-*", s.from)
+	case s.bytes:
+		return fmt.Sprintf("entity-bytes-%d-%d", s.from, s.to)
+	case s.entity:
+		return "entity"
+	case s.depth != carDepthAll:
+		return fmt.Sprintf("depth-%d", s.depth)
+	}
+	return ""
+}
+
+// parseCarScope returns the scope of the CAR requested by the depth, scope and
+// entity-bytes query parameters. scope=block is depth=0, the root block only,
+// scope=entity the UnixFS entity of the root, and scope=all is the default,
+// the whole DAG. entity-bytes=from:to is the scope of the entity, limited to
+// a byte range of a file.
+func parseCarScope(r *http.Request) (carScope, error) {
+	q := r.URL.Query()
+	scope, depth, bytes := q.Get("scope"), q.Get("depth"), q.Get("entity-bytes")
+	if scope != "" && depth != "" || bytes != "" && depth != "" {
+		return carScope{}, fmt.Errorf("only one of scope or depth can be set")
+	}
+	switch scope {
+	case "", "all":
+		if bytes != "" && scope != "" {
+			return carScope{}, fmt.Errorf("entity-bytes requires scope=entity")
+		}
+	case "block":
+		if bytes != "" {
+			return carScope{}, fmt.Errorf("entity-bytes requires scope=entity")
+		}
+		return carScope{depth: 0}, nil
+	case "entity":
+	default:
+		return carScope{}, fmt.Errorf("scope must be 'all', 'entity' or 'block'")
+	}
+	if scope == "entity" || bytes != "" {
+		s := carScope{depth: carDepthAll, entity: true}
+		if bytes == "" {
+			return s, nil
+		}
+		return s, parseEntityBytes(&s, bytes)
+	}
+	if depth == "" || depth == "all" {
+		return carScope{depth: carDepthAll}, nil
+	}
+	d, err := strconv.Atoi(depth)
+	if err != nil || d < 0 {
+		return carScope{}, fmt.Errorf("depth must be 'all' or a number of links, got %q", depth)
+	}
+	return carScope{depth: d}, nil
+}
+
+// parseEntityBytes sets the byte range of s from the value of entity-bytes,
+// from:to, to being a number or *.
+func parseEntityBytes(s *carScope, value string) error {
+	invalid := fmt.Errorf("entity-bytes must be from:to, to being * for the end, got %q", value)
+	i := strings.Index(value, ":")
+	if i < 0 {
+		return invalid
+	}
+	from, to := value[:i], value[i+1:]
+	var err error
+	if s.from, err = strconv.ParseInt(from, 10, 64); err != nil {
+		return invalid
+	}
+	if to == "*" {
+		s.toEnd = true
+	} else if s.to, err = strconv.ParseInt(to, 10, 64); err != nil {
+		return invalid
+	} else if s.from >= 0 && s.to >= 0 && s.from > s.to {
+		return fmt.Errorf("entity-bytes must not end before it starts, got %q", value)
+	}
+	s.bytes = true
+	return nil
+}
+
+// writeCar writes the CAR of the scope of the DAG of root to w. The blocks of
+// whole DAGs are written by go-car, in the same order as the dag export
+// command. onBlock is called for each block written.
+func writeCar(ctx context.Context, w io.Writer, store dagStore, root cid.Cid, scope carScope, onBlock ...gocar.OnNewCarBlockFunc) error {
+	if scope == (carScope{depth: carDepthAll}) {
+		return newSelectiveCar(ctx, store, root).Write(w, onBlock...)
+	}
+
+	header := &gocar.CarHeader{Roots: []cid.Cid{root}, Version: 1}
+	if err := gocar.WriteHeader(header, w); err != nil {
+		return fmt.Errorf("failed to write car header: %s", err)
+	}
+	size, err := gocar.HeaderSize(header)
+	if err != nil {
+		return err
+	}
+	cw := &carWalker{store: store, w: w, onBlock: onBlock, offset: size, visited: make(map[cid.Cid]int)}
+	if !scope.entity {
+		return cw.walk(root, scope.depth)
+	}
+
+	nd, err := store.dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	from, to := int64(0), int64(-1)
+	if size, ok := entityFileSize(nd); ok && scope.bytes {
+		from, to = scope.from, scope.to
+		if from < 0 {
+			from += int64(size)
+			if from < 0 {
+				from = 0
+			}
+		}
+		if to < 0 {
+			to += int64(size)
+		}
+		if scope.toEnd || to >= int64(size) {
+			to = int64(size) - 1
+		}
+	}
+	return cw.walkEntity(nd, 0, from, to, scope.bytes)
+}
+
+// entityFileSize returns the size of the file of nd, if it is one.
+func entityFileSize(nd ipld.Node) (uint64, bool) {
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		return uint64(len(nd.RawData())), true
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(nd.Data())
+		if err != nil || (fsn.Type() != ft.TFile && fsn.Type() != ft.TRaw) {
+			return 0, false
+		}
+		return fsn.FileSize(), true
+	}
+	return 0, false
+}
+
+// carWalker writes the blocks of a DAG down to a depth, depth first and in the
+// order of the links, like the traversal of go-car.
+type carWalker struct {
+	store   dagStore
+	w       io.Writer
+	onBlock []gocar.OnNewCarBlockFunc
+	offset  uint64
+
+	// visited is the depth left when each block written was last walked: a
+	// block reached again closer to the root has more of its DAG written
+	visited map[cid.Cid]int
+}
+
+func (cw *carWalker) walk(c cid.Cid, depth int) error {
+	left, written := cw.visited[c]
+	if written && left >= depth {
+		return nil
+	}
+	nd, err := cw.store.dag.Get(cw.store.ctx, c)
+	if err != nil {
+		return err
+	}
+	if !written {
+		if err := cw.write(nd); err != nil {
+			return err
+		}
+	}
+	cw.visited[c] = depth
+
+	if depth == 0 {
+		return nil
+	}
+	for _, l := range nd.Links() {
+		if err := cw.walk(l.Cid, depth-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkEntity writes the blocks of the UnixFS entity of nd, found at offset in
+// its file. When ranged, only the blocks of the file with some of the bytes
+// from from to to are written.
+func (cw *carWalker) walkEntity(nd ipld.Node, offset, from, to int64, ranged bool) error {
+	if _, written := cw.visited[nd.Cid()]; !written {
+		if err := cw.write(nd); err != nil {
+			return err
+		}
+		cw.visited[nd.Cid()] = 0
+	}
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil
+	}
+
+	links := pn.Links()
+	switch fsn.Type() {
+	case ft.TFile, ft.TRaw:
+		sizes := fsn.BlockSizes()
+		if len(sizes) != len(links) {
+			// the links cannot be placed in the file
+			ranged = false
+		}
+		// the data of the node comes before the data of its links
+		start := offset + int64(len(fsn.Data()))
+		for i, l := range links {
+			var end int64
+			if ranged {
+				end = start + int64(sizes[i])
+				if end <= from || start > to {
+					start = end
+					continue
+				}
+			}
+			child, err := l.GetNode(cw.store.ctx, cw.store.dag)
+			if err != nil {
+				return err
+			}
+			if err := cw.walkEntity(child, start, from, to, ranged); err != nil {
+				return err
+			}
+			start = end
+		}
+	case ft.THAMTShard:
+		// the shards of the directory, not its entries
+		padLen := len(fmt.Sprintf("%X", fsn.Fanout()-1))
+		for _, l := range links {
+			if len(l.Name) != padLen {
+				continue
+			}
+			child, err := l.GetNode(cw.store.ctx, cw.store.dag)
+			if err != nil {
+				return err
+			}
+			if err := cw.walkEntity(child, 0, from, to, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write writes the section of the block of nd.
+func (cw *carWalker) write(nd ipld.Node) error {
+	c, data := nd.Cid(), nd.RawData()
+	if err := carutil.LdWrite(cw.w, c.Bytes(), data); err != nil {
+		return err
+	}
+	size := carutil.LdSize(c.Bytes(), data)
+	for _, onBlock := range cw.onBlock {
+		if err := onBlock(gocar.Block{BlockCID: c, Data: data, Offset: cw.offset, Size: size}); err != nil {
+			return err
+		}
+	}
+	cw.offset += size
+	return nil
+}
+
 type dagStore struct {
 	dag coreiface.APIDagService
 	ctx context.Context
@@ -0,0 +1,200 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	gocar "github.com/ipld/go-car"
+	"github.com/ipld/go-car/v2/index"
+	varint "github.com/multiformats/go-varint"
+)
+
+// past this many roots, the least recently used CAR index is dropped
+const maxCarIndexes = 16
+
+// carIndex is the layout of the CARv1 stream of a DAG: its header, and the
+// offsets of the sections of its blocks, in the order they are written. The
+// records are the ones of a CARv2 index, sorted by offset instead of
+// multihash.
+type carIndex struct {
+	header  []byte
+	records []index.Record
+	size    int64
+}
+
+// buildCarIndex traverses the scope of the DAG of root, fetching the blocks
+// missing, and returns the layout of its CAR.
+func buildCarIndex(ctx context.Context, store dagStore, root cid.Cid, scope carScope) (*carIndex, error) {
+	var header bytes.Buffer
+	if err := gocar.WriteHeader(&gocar.CarHeader{Roots: []cid.Cid{root}, Version: 1}, &header); err != nil {
+		return nil, err
+	}
+	idx := &carIndex{header: header.Bytes(), size: int64(header.Len())}
+	err := writeCar(ctx, io.Discard, store, root, scope, func(b gocar.Block) error {
+		idx.records = append(idx.records, index.Record{Cid: b.BlockCID, Offset: b.Offset})
+		idx.size = int64(b.Offset + b.Size)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// carKey identifies the CAR of the scope of a DAG
+type carKey struct {
+	root  cid.Cid
+	scope carScope
+}
+
+// carIndexes keeps the indexes of the CARs served recently, so that the
+// ranges of a download do not each traverse the DAG.
+type carIndexes struct {
+	mu sync.Mutex
+	// order lists the CARs from the least recently used
+	order   []carKey
+	indexes map[carKey]*carIndex
+}
+
+func newCarIndexes() *carIndexes {
+	return &carIndexes{indexes: make(map[carKey]*carIndex)}
+}
+
+func (c *carIndexes) get(root carKey) (*carIndex, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	idx, ok := c.indexes[root]
+	if ok {
+		c.touch(root)
+	}
+	return idx, ok
+}
+
+func (c *carIndexes) add(root carKey, idx *carIndex) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.indexes[root]; !ok && len(c.indexes) >= maxCarIndexes {
+		delete(c.indexes, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.indexes[root] = idx
+	c.touch(root)
+}
+
+// touch moves root to the end of order.
+func (c *carIndexes) touch(root carKey) {
+	for i, r := range c.order {
+		if r == root {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, root)
+}
+
+// serveCarRange serves the ranges requested of the CAR of the scope of root,
+// reading only the blocks of the sections in these ranges.
+func (i *gatewayHandler) serveCarRange(w http.ResponseWriter, r *http.Request, store dagStore, root cid.Cid, scope carScope, name string) {
+	key := carKey{root: root, scope: scope}
+	idx, ok := i.carIndexes.get(key)
+	if !ok {
+		var err error
+		idx, err = buildCarIndex(r.Context(), store, root, scope)
+		if err != nil {
+			webError(w, "failed to index the CAR", err, http.StatusInternalServerError)
+			return
+		}
+		i.carIndexes.add(key, idx)
+	}
+
+	// ServeContent answers the conditional requests, and the unsatisfiable
+	// ranges
+	http.ServeContent(w, r, name, time.Time{}, &carReader{store: store, idx: idx})
+}
+
+// carReader reads the CAR of an index, getting the block of each section
+// read.
+type carReader struct {
+	store  dagStore
+	idx    *carIndex
+	offset int64
+
+	// the section last read, starting at sectionStart
+	section      []byte
+	sectionStart int64
+}
+
+func (cr *carReader) Read(p []byte) (int, error) {
+	if cr.offset >= cr.idx.size {
+		return 0, io.EOF
+	}
+	if cr.offset < int64(len(cr.idx.header)) {
+		n := copy(p, cr.idx.header[cr.offset:])
+		cr.offset += int64(n)
+		return n, nil
+	}
+
+	if cr.section == nil || cr.offset < cr.sectionStart || cr.offset >= cr.sectionStart+int64(len(cr.section)) {
+		if err := cr.readSection(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, cr.section[cr.offset-cr.sectionStart:])
+	cr.offset += int64(n)
+	return n, nil
+}
+
+// readSection gets the block of the section at the offset of the reader.
+func (cr *carReader) readSection() error {
+	records := cr.idx.records
+	i := sort.Search(len(records), func(i int) bool {
+		return int64(records[i].Offset) > cr.offset
+	}) - 1
+	rec := records[i]
+
+	blk, err := cr.store.Get(rec.Cid)
+	if err != nil {
+		return err
+	}
+	c, data := rec.Cid.Bytes(), blk.RawData()
+	section := varint.ToUvarint(uint64(len(c) + len(data)))
+	section = append(section, c...)
+	section = append(section, data...)
+
+	end := cr.idx.size
+	if i < len(records)-1 {
+		end = int64(records[i+1].Offset)
+	}
+	if int64(rec.Offset)+int64(len(section)) != end {
+		return fmt.Errorf("section of %s does not match the CAR index", rec.Cid)
+	}
+
+	cr.section = section
+	cr.sectionStart = int64(rec.Offset)
+	return nil
+}
+
+func (cr *carReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += cr.offset
+	case io.SeekEnd:
+		offset += cr.idx.size
+	default:
+		return cr.offset, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return cr.offset, errors.New("invalid seek offset")
+	}
+	cr.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,43 @@
+package corehttp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseCarScope(t *testing.T) {
+	for _, tc := range []struct {
+		query string
+		etag  string
+		err   bool
+	}{
+		{query: "", etag: ""},
+		{query: "scope=all", etag: ""},
+		{query: "scope=block", etag: "depth-0"},
+		{query: "depth=2", etag: "depth-2"},
+		{query: "scope=entity", etag: "entity"},
+		{query: "entity-bytes=0:1023", etag: "entity-bytes-0-1023"},
+		{query: "scope=entity&entity-bytes=-10:*", etag: "entity-bytes--10-*"},
+		{query: "entity-bytes=10:-1", etag: "entity-bytes-10--1"},
+		{query: "entity-bytes=10:1", err: true},
+		{query: "entity-bytes=10", err: true},
+		{query: "entity-bytes=a:*", err: true},
+		{query: "scope=block&entity-bytes=0:*", err: true},
+		{query: "depth=1&entity-bytes=0:*", err: true},
+		{query: "scope=all&depth=1", err: true},
+		{query: "depth=-1", err: true},
+	} {
+		scope, err := parseCarScope(httptest.NewRequest("GET", "/ipfs/cid?format=car&"+tc.query, nil))
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tc.query, err)
+		} else if scope.String() != tc.etag {
+			t.Errorf("%s: expected the scope %q, got %q", tc.query, tc.etag, scope.String())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package corehttp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ipfs/go-ipfs/tracing"
+	ipldlegacy "github.com/ipfs/go-ipld-legacy"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serveDagJSON returns the node at the resolved path encoded as DAG-JSON
+func (i *gatewayHandler) serveDagJSON(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, begin time.Time) {
+	ctx, span := tracing.Span(r.Context(), "Gateway", "ServeDagJSON", trace.WithAttributes(attribute.String("path", resolvedPath.String())))
+	defer span.End()
+	nodeCid := resolvedPath.Cid()
+
+	obj, err := i.api.Dag().Get(ctx, nodeCid)
+	if err != nil {
+		webError(w, "ipfs dag get "+nodeCid.String(), err, http.StatusInternalServerError)
+		return
+	}
+	universal, ok := obj.(ipldlegacy.UniversalNode)
+	if !ok {
+		err := fmt.Errorf("%T is not a valid IPLD node", obj)
+		webError(w, "ipfs dag get "+nodeCid.String(), err, http.StatusInternalServerError)
+		return
+	}
+
+	// The encoding of a node is deterministic, the whole response is
+	// encoded before it is served so ServeContent can honor range requests
+	var buf bytes.Buffer
+	if err := dagjson.Encode(universal.(ipld.Node), &buf); err != nil {
+		webError(w, "failed to encode DAG-JSON", err, http.StatusInternalServerError)
+		return
+	}
+
+	// Set Content-Disposition
+	name := nodeCid.String() + ".json"
+	setContentDispositionHeader(w, name, "attachment")
+
+	// Set remaining headers
+	modtime := addCacheControlHeaders(w, r, contentPath, nodeCid)
+	w.Header().Set("Content-Type", "application/vnd.ipld.dag-json")
+	w.Header().Set("X-Content-Type-Options", "nosniff") // no funny business in the browsers :^)
+
+	// ServeContent will take care of
+	// If-None-Match+Etag, Content-Length and range requests
+	_, dataSent, _ := ServeContent(w, r, name, modtime, bytes.NewReader(buf.Bytes()))
+
+	if dataSent {
+		// Update metrics
+		i.dagJSONGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+	}
+}
@@ -0,0 +1,44 @@
+package corehttp
+
+import (
+	"net/http"
+	"strings"
+
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// checkIfRange answers the If-Range of the range requests dated rather than
+// tagged, returning the request to serve. http.ServeContent compares the
+// tagged ones strongly with the Etag of the representation served, which
+// names its CID and format, so that a resumed download never gets the bytes
+// of another representation. It would compare the dated ones with the
+// Last-Modified of the response, which does not name the bytes served: that
+// of /ipns/ paths is the time of the response, or the modification time of
+// the file in its UnixFS metadata, which other files may share.
+//
+// A date validates the range of the immutable paths, whose bytes never change,
+// unless their format is negotiated with the Accept header. Otherwise the
+// range is dropped, for the whole representation to be sent, as if the date
+// did not match.
+func checkIfRange(r *http.Request, contentPath ipath.Path, responseFormat string) *http.Request {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" || r.Header.Get("Range") == "" || isEntityTag(ifRange) {
+		return r
+	}
+
+	r = r.Clone(r.Context())
+	negotiated := responseFormat != "" && r.URL.Query().Get("format") == ""
+	if _, err := http.ParseTime(ifRange); err == nil && !contentPath.Mutable() && !negotiated {
+		r.Header.Del("If-Range")
+	} else {
+		r.Header.Del("Range")
+	}
+	return r
+}
+
+// isEntityTag reports whether the If-Range value v is an entity tag rather
+// than a date. Weak tags, which clients must not send in If-Range, never match
+// in http.ServeContent.
+func isEntityTag(v string) bool {
+	return strings.HasPrefix(v, `"`) || strings.HasPrefix(v, `W/"`)
+}
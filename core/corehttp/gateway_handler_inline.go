@@ -0,0 +1,62 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// inlineData returns the data of c if it is an identity CID, whose data is
+// inlined in the CID rather than stored in a block.
+func inlineData(c cid.Cid) ([]byte, bool) {
+	if !c.Defined() || c.Prefix().MhType != mh.IDENTITY {
+		return nil, false
+	}
+	dmh, err := mh.Decode(c.Hash())
+	if err != nil {
+		return nil, false
+	}
+	return dmh.Digest, true
+}
+
+// rootCid returns the CID at the root of the /ipfs/ path p.
+func rootCid(p ipath.Path) (cid.Cid, bool) {
+	if p.Namespace() != "ipfs" {
+		return cid.Undef, false
+	}
+	root := strings.SplitN(strings.TrimPrefix(p.String(), ipfsPathPrefix), "/", 2)[0]
+	c, err := cid.Decode(root)
+	if err != nil {
+		return cid.Undef, false
+	}
+	return c, true
+}
+
+// checkInlineSize replies with 400 Bad Request when c is an identity CID
+// whose data is over the MaxInlineSize of the gateway, and tells whether the
+// request may go on.
+func (i *gatewayHandler) checkInlineSize(w http.ResponseWriter, c cid.Cid) bool {
+	data, ok := inlineData(c)
+	if !ok || i.config.MaxInlineSize <= 0 || len(data) <= i.config.MaxInlineSize {
+		return true
+	}
+	err := fmt.Errorf("%d bytes inlined, over the limit of %d bytes", len(data), i.config.MaxInlineSize)
+	webError(w, "inline CID too large", err, http.StatusBadRequest)
+	return false
+}
+
+// isMalformedInline tells whether c is an identity CID whose data does not
+// decode with its codec. Such content is never missing, the data being in the
+// CID itself, so the errors reading it are the fault of the request.
+func (i *gatewayHandler) isMalformedInline(ctx context.Context, c cid.Cid) bool {
+	if _, ok := inlineData(c); !ok {
+		return false
+	}
+	_, err := i.api.Dag().Get(ctx, c)
+	return err != nil
+}
@@ -0,0 +1,279 @@
+package corehttp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	gopath "path"
+	"strconv"
+	"strings"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"go.uber.org/zap"
+)
+
+// redirectsFile is the file of the redirect rules at the root of a site, in
+// the syntax of the _redirects files of Netlify.
+const redirectsFile = "_redirects"
+
+// maxRedirectsFileSize is the largest _redirects file read.
+const maxRedirectsFileSize = 64 << 10
+
+// redirectRule is a rule of a _redirects file, such as
+//
+//	/articles/:year/* /posts/:year/:splat 301
+//
+// where the placeholders match a segment of the path, and the final * the
+// rest of it.
+type redirectRule struct {
+	from   string
+	to     string
+	status int
+}
+
+// parseRedirects parses the rules of a _redirects file: one rule per line,
+// the path matched, the path or URL it leads to, and an optional status
+// (301 when not set). The lines starting with # are comments.
+func parseRedirects(r io.Reader) ([]redirectRule, error) {
+	var rules []redirectRule
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected a path, a path or URL to go to, and an optional status", n)
+		}
+		rule := redirectRule{from: fields[0], to: fields[1], status: http.StatusMovedPermanently}
+		if !strings.HasPrefix(rule.from, "/") {
+			return nil, fmt.Errorf("line %d: %q is not an absolute path", n, rule.from)
+		}
+		if len(fields) == 3 {
+			status, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid status %q", n, fields[2])
+			}
+			rule.status = status
+		}
+		switch rule.status {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			if u, err := url.Parse(rule.to); err != nil || (!u.IsAbs() && !strings.HasPrefix(rule.to, "/")) {
+				return nil, fmt.Errorf("line %d: %q is neither an absolute path nor a URL", n, rule.to)
+			}
+		case http.StatusOK, http.StatusNotFound, http.StatusGone, http.StatusUnavailableForLegalReasons:
+			// the content served is in the site
+			if !strings.HasPrefix(rule.to, "/") {
+				return nil, fmt.Errorf("line %d: %q is not an absolute path", n, rule.to)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unsupported status %d", n, rule.status)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, s.Err()
+}
+
+// match returns the path or URL the rule leads urlPath to, with its
+// placeholders replaced, if the rule matches urlPath.
+func (rule redirectRule) match(urlPath string) (string, bool) {
+	from := strings.Split(strings.Trim(rule.from, "/"), "/")
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+
+	values := make(map[string]string)
+	for i, f := range from {
+		if f == "*" && i == len(from)-1 {
+			values["splat"] = strings.Join(segments[i:], "/")
+			return rule.expand(values), true
+		}
+		if i >= len(segments) {
+			return "", false
+		}
+		if strings.HasPrefix(f, ":") && len(f) > 1 {
+			values[f[1:]] = segments[i]
+		} else if f != segments[i] {
+			return "", false
+		}
+	}
+	if len(segments) != len(from) {
+		return "", false
+	}
+	return rule.expand(values), true
+}
+
+// expand replaces the placeholders of the target of the rule, such as :year
+// or :splat, with their values.
+func (rule redirectRule) expand(values map[string]string) string {
+	var b strings.Builder
+	to := rule.to
+	for {
+		i := strings.IndexByte(to, ':')
+		if i < 0 {
+			b.WriteString(to)
+			return b.String()
+		}
+		b.WriteString(to[:i])
+		to = to[i+1:]
+		j := 0
+		for j < len(to) && isPlaceholderChar(to[j]) {
+			j++
+		}
+		if v, ok := values[to[:j]]; ok && j > 0 {
+			b.WriteString(v)
+		} else {
+			b.WriteString(":" + to[:j])
+		}
+		to = to[j:]
+	}
+}
+
+func isPlaceholderChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// serveRedirectsIfPresent applies the rules of the _redirects file at the root
+// of the site when contentPath is not found, such as the fallback of a single
+// page app to its /index.html:
+//
+//	/* /index.html 200
+//
+// The rules only apply to the sites with their own origin, on a subdomain or
+// a DNSLink gateway, as the paths of the rules are from the root of the site.
+func (i *gatewayHandler) serveRedirectsIfPresent(w http.ResponseWriter, r *http.Request, contentPath ipath.Path, begin time.Time, logger *zap.SugaredLogger) bool {
+	if _, ok := r.Context().Value("gw-hostname").(string); !ok {
+		return false
+	}
+	// "", namespace, root, and the path in the site
+	segments := strings.SplitN(contentPath.String(), "/", 4)
+	if len(segments) < 3 {
+		return false
+	}
+	sitePath := ipath.New("/" + segments[1] + "/" + segments[2])
+	urlPath := "/"
+	if len(segments) == 4 {
+		urlPath += segments[3]
+	}
+
+	root, err := i.resolvePath(r.Context(), sitePath)
+	if err != nil {
+		return false
+	}
+	rules, ok, err := i.readRedirects(r.Context(), root)
+	if !ok {
+		return false
+	}
+	if err != nil {
+		webError(w, "invalid "+redirectsFile+" file", err, http.StatusInternalServerError)
+		return true
+	}
+
+	for _, rule := range rules {
+		to, ok := rule.match(urlPath)
+		if !ok {
+			continue
+		}
+		if rule.status >= 300 && rule.status < 400 {
+			if r.URL.RawQuery != "" && !strings.Contains(to, "?") {
+				to += "?" + r.URL.RawQuery
+			}
+			logger.Debugw("redirect rule", "from", urlPath, "to", to, "status", rule.status)
+			http.Redirect(w, r, to, rule.status)
+			return true
+		}
+		if i.serveRewrite(w, r, sitePath, root, to, rule.status, begin) {
+			logger.Debugw("rewrite rule", "from", urlPath, "to", to, "status", rule.status)
+			return true
+		}
+		// the rules leading to missing content are skipped
+	}
+	return false
+}
+
+// readRedirects reads the rules of the _redirects file of the site at root,
+// not ok if there is none.
+func (i *gatewayHandler) readRedirects(ctx context.Context, root ipath.Resolved) ([]redirectRule, bool, error) {
+	p, err := i.api.ResolvePath(ctx, ipath.Join(root, redirectsFile))
+	if err != nil {
+		return nil, false, nil
+	}
+	nd, err := i.api.Unixfs().Get(ctx, p)
+	if err != nil {
+		return nil, false, nil
+	}
+	defer nd.Close()
+	f, ok := nd.(files.File)
+	if !ok {
+		return nil, false, nil
+	}
+	if size, err := f.Size(); err != nil {
+		return nil, true, err
+	} else if size > maxRedirectsFileSize {
+		return nil, true, fmt.Errorf("larger than %d bytes", maxRedirectsFileSize)
+	}
+	rules, err := parseRedirects(io.LimitReader(f, maxRedirectsFileSize))
+	return rules, true, err
+}
+
+// serveRewrite serves the file at the path to of the site with the status of
+// a rewrite rule, or the index.html of the directory at to. It returns false
+// if there is no such file.
+func (i *gatewayHandler) serveRewrite(w http.ResponseWriter, r *http.Request, sitePath ipath.Path, root ipath.Resolved, to string, status int, begin time.Time) bool {
+	to = strings.SplitN(to, "?", 2)[0]
+	resolved, err := i.api.ResolvePath(r.Context(), ipath.Join(root, strings.TrimPrefix(to, "/")))
+	if err != nil {
+		return false
+	}
+	nd, err := i.api.Unixfs().Get(r.Context(), resolved)
+	if err != nil {
+		return false
+	}
+	if _, ok := nd.(files.Directory); ok {
+		nd.Close()
+		to = gopath.Join(to, "index.html")
+		if resolved, err = i.api.ResolvePath(r.Context(), ipath.Join(root, strings.TrimPrefix(to, "/"))); err != nil {
+			return false
+		}
+		if nd, err = i.api.Unixfs().Get(r.Context(), resolved); err != nil {
+			return false
+		}
+	}
+	defer nd.Close()
+	f, ok := nd.(files.File)
+	if !ok {
+		return false
+	}
+
+	if !i.checkResolvedAccess(w, resolved.Cid()) {
+		return true
+	}
+	targetPath := ipath.Join(sitePath, strings.TrimPrefix(to, "/"))
+	i.addUserHeaders(w)
+	w.Header().Set("X-Ipfs-Path", targetPath.String())
+	if status == http.StatusOK {
+		i.serveFile(w, r, resolved, targetPath, f, begin)
+		return true
+	}
+
+	// the error pages are served whole, with the status of the rule
+	size, err := f.Size()
+	if err != nil {
+		return false
+	}
+	if ctype := mime.TypeByExtension(gopath.Ext(to)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		io.CopyN(w, f, size)
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package corehttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	path "github.com/ipfs/go-path"
+)
+
+func TestParseRedirects(t *testing.T) {
+	rules, err := parseRedirects(strings.NewReader(`
+# comment
+/old /new
+/docs/* https://docs.example.net/:splat 302
+/*    /index.html   200
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []redirectRule{
+		{"/old", "/new", http.StatusMovedPermanently},
+		{"/docs/*", "https://docs.example.net/:splat", http.StatusFound},
+		{"/*", "/index.html", http.StatusOK},
+	}
+	if len(rules) != len(expected) {
+		t.Fatalf("expected %d rules, got %v", len(expected), rules)
+	}
+	for i := range rules {
+		if rules[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected[i], rules[i])
+		}
+	}
+
+	for _, s := range []string{
+		"/a",
+		"/a /b 301 extra",
+		"a /b",
+		"/a /b 418",
+		"/a /b abc",
+		"/a b 302",
+		"/a https://example.net 200",
+	} {
+		if _, err := parseRedirects(strings.NewReader(s)); err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestRedirectRuleMatch(t *testing.T) {
+	for _, test := range []struct {
+		from, to, path string
+		expected       string
+		ok             bool
+	}{
+		{"/old", "/new", "/old", "/new", true},
+		{"/old", "/new", "/old/", "/new", true},
+		{"/old", "/new", "/older", "", false},
+		{"/old", "/new", "/old/page", "", false},
+		{"/*", "/index.html", "/", "/index.html", true},
+		{"/*", "/index.html", "/a/b/c", "/index.html", true},
+		{"/blog/*", "/posts/:splat", "/blog/2022/hello", "/posts/2022/hello", true},
+		{"/blog/*", "/posts/:splat", "/blog", "/posts/", true},
+		{"/blog/*", "/posts/:splat", "/news/2022", "", false},
+		{"/articles/:year/:slug", "/posts/:year-:slug?from=:other", "/articles/2022/hello", "/posts/2022-hello?from=:other", true},
+		{"/articles/:year/:slug", "/posts/:year", "/articles/2022", "", false},
+	} {
+		rule := redirectRule{from: test.from, to: test.to, status: http.StatusMovedPermanently}
+		to, ok := rule.match(test.path)
+		if ok != test.ok || to != test.expected {
+			t.Errorf("%s -> %s on %s: expected %q (%t), got %q (%t)", test.from, test.to, test.path, test.expected, test.ok, to, ok)
+		}
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+
+	f1 := files.NewMapDirectory(map[string]files.Node{
+		"_redirects": files.NewBytesFile([]byte(`
+/old-page /new-page.html 301
+/temp /new-page.html 302
+/docs/* /manual/:splat 308
+/missing/* /nope.html 200
+/gone /gone.html 410
+/app/* /app/index.html 200
+/* /404.html 404
+`)),
+		"new-page.html": files.NewBytesFile([]byte("new page")),
+		"gone.html":     files.NewBytesFile([]byte("gone")),
+		"404.html":      files.NewBytesFile([]byte("not here")),
+		"app": files.NewMapDirectory(map[string]files.Node{
+			"index.html": files.NewBytesFile([]byte("single page app")),
+		}),
+	})
+	k, err := api.Unixfs().Add(ctx, f1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := "example.net"
+	ns["/ipns/"+host] = path.FromString(k.String())
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		status   int
+		location string
+		text     string
+	}{
+		{host, "/new-page.html", http.StatusOK, "", "new page"},
+		{host, "/old-page", http.StatusMovedPermanently, "/new-page.html", ""},
+		{host, "/temp?a=b", http.StatusFound, "/new-page.html?a=b", ""},
+		{host, "/docs/guide/intro", http.StatusPermanentRedirect, "/manual/guide/intro", ""},
+		{host, "/gone", http.StatusGone, "", "gone"},
+		{host, "/app/users/42", http.StatusOK, "", "single page app"},
+		// the rules leading to missing content are skipped
+		{host, "/missing/page", http.StatusNotFound, "", "not here"},
+		{host, "/other", http.StatusNotFound, "", "not here"},
+		// not on the origin of the site
+		{"", k.String() + "/old-page", http.StatusNotFound, "", ""},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.host != "" {
+			req.Host = test.host
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != test.status {
+			t.Errorf("%s: expected the status %d, got %d", test.path, test.status, res.StatusCode)
+			continue
+		}
+		if loc := res.Header.Get("Location"); loc != test.location {
+			t.Errorf("%s: expected the location %q, got %q", test.path, test.location, loc)
+		}
+		if test.text == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.text {
+			t.Errorf("%s: expected %q, got %q", test.path, test.text, body)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package corehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs/tracing"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fileStat is the response of the application/vnd.ipfs.file-stat+json format
+type fileStat struct {
+	Cid            string
+	Type           string // file, directory or symlink
+	Size           uint64 // the size of the data of a file
+	CumulativeSize uint64 // the size of the whole DAG
+	Blocks         int    // the number of child blocks
+
+	// How a file is chunked: the data sizes of its child blocks, and whether
+	// they are raw blocks
+	BlockSizes []uint64 `json:",omitempty"`
+	RawLeaves  bool     `json:",omitempty"`
+}
+
+// serveFileStat returns the stat of the UnixFS node at the resolved path,
+// read from its root block only
+func (i *gatewayHandler) serveFileStat(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, begin time.Time) {
+	ctx, span := tracing.Span(r.Context(), "Gateway", "ServeFileStat", trace.WithAttributes(attribute.String("path", resolvedPath.String())))
+	defer span.End()
+	nodeCid := resolvedPath.Cid()
+
+	nd, err := i.api.Dag().Get(ctx, nodeCid)
+	if err != nil {
+		webError(w, "ipfs dag get "+nodeCid.String(), err, http.StatusInternalServerError)
+		return
+	}
+	cumulsize, err := nd.Size()
+	if err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	stat := fileStat{
+		Cid:            nodeCid.String(),
+		CumulativeSize: cumulsize,
+		Blocks:         len(nd.Links()),
+	}
+	switch n := nd.(type) {
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(n.Data())
+		if err != nil {
+			webError(w, "not a UnixFS node", err, http.StatusBadRequest)
+			return
+		}
+		switch fsn.Type() {
+		case ft.TDirectory, ft.THAMTShard:
+			stat.Type = "directory"
+		case ft.TSymlink:
+			stat.Type = "symlink"
+		case ft.TFile, ft.TRaw:
+			stat.Type = "file"
+			stat.Size = fsn.FileSize()
+			stat.BlockSizes = fsn.BlockSizes()
+			stat.RawLeaves = len(n.Links()) > 0
+			for _, l := range n.Links() {
+				stat.RawLeaves = stat.RawLeaves && l.Cid.Prefix().Codec == cid.Raw
+			}
+		default:
+			err := fmt.Errorf("unsupported UnixFS type %s", fsn.Type())
+			webError(w, "not a UnixFS file or directory", err, http.StatusBadRequest)
+			return
+		}
+	case *dag.RawNode:
+		stat.Type = "file"
+		stat.Size = cumulsize
+	default:
+		err := fmt.Errorf("%s is not a UnixFS node", nodeCid)
+		webError(w, "not a UnixFS node", err, http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(&stat); err != nil {
+		internalWebError(w, err)
+		return
+	}
+
+	// Set remaining headers
+	modtime := addCacheControlHeaders(w, r, contentPath, nodeCid)
+	w.Header().Set("Content-Type", "application/vnd.ipfs.file-stat+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff") // no funny business in the browsers :^)
+
+	// ServeContent will take care of
+	// If-None-Match+Etag, Content-Length and range requests
+	_, dataSent, _ := ServeContent(w, r, nodeCid.String()+".json", modtime, bytes.NewReader(buf.Bytes()))
+
+	if dataSent {
+		// Update metrics
+		i.fileStatGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+	}
+}
@@ -20,11 +20,20 @@ func (i *gatewayHandler) serveUnixFs(w http.ResponseWriter, r *http.Request, res
 	// Handling UnixFS
 	dr, err := i.api.Unixfs().Get(ctx, resolvedPath)
 	if err != nil {
-		webError(w, "ipfs cat "+html.EscapeString(contentPath.String()), err, http.StatusNotFound)
+		status := http.StatusNotFound
+		if i.isMalformedInline(ctx, resolvedPath.Cid()) {
+			status = http.StatusBadRequest
+		}
+		webError(w, "ipfs cat "+html.EscapeString(contentPath.String()), err, status)
 		return
 	}
 	defer dr.Close()
 
+	if i.redirectToCanonicalSlash(w, r, dr) {
+		logger.Debugw("redirect to the canonical trailing slash", "path", contentPath, "status", http.StatusMovedPermanently)
+		return
+	}
+
 	// Handling Unixfs file
 	if f, ok := dr.(files.File); ok {
 		logger.Debugw("serving unixfs file", "path", contentPath)
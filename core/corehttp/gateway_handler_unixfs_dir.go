@@ -1,6 +1,9 @@
 package corehttp
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"net/http"
 	"net/url"
 	gopath "path"
@@ -42,8 +45,9 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 	// Check if directory has index.html, if so, serveFile
 	idxPath := ipath.Join(resolvedPath, "index.html")
 	idx, err := i.api.Unixfs().Get(ctx, idxPath)
-	switch err.(type) {
-	case nil:
+	var noLink resolver.ErrNoLink
+	switch {
+	case err == nil:
 		cpath := contentPath.String()
 		dirwithoutslash := cpath[len(cpath)-1] != '/'
 		goget := r.URL.Query().Get("go-get") == "1"
@@ -71,7 +75,7 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 		// write to request
 		i.serveFile(w, r, resolvedPath, idxPath, f, begin)
 		return
-	case resolver.ErrNoLink:
+	case errors.As(err, &noLink):
 		logger.Debugw("no index.html; noop", "path", idxPath)
 	default:
 		internalWebError(w, err)
@@ -96,7 +100,7 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 	if assets.BindataVersionHash != "" {
 		dirEtag := getDirListingEtag(resolvedPath.Cid())
 		w.Header().Set("Etag", dirEtag)
-		if r.Header.Get("If-None-Match") == dirEtag {
+		if etagMatch(r.Header.Get("If-None-Match"), dirEtag) {
 			w.WriteHeader(http.StatusNotModified)
 			return
 		}
@@ -107,6 +111,46 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	// Gateway root URL to be used when linking to other rootIDs.
+	// This will be blank unless subdomain or DNSLink resolution is being used
+	// for this request.
+	var gwURL string
+
+	// Get gateway hostname and build gateway URL.
+	if h, ok := r.Context().Value("gw-hostname").(string); ok {
+		gwURL = "//" + h
+	} else {
+		gwURL = ""
+	}
+
+	// The listing of a directory is rendered once for the URLs it is
+	// requested with, its links depending on them
+	key := listingCacheKey(resolvedPath.Cid(), contentPath, originalUrlPath, gwURL)
+	page, ok := i.config.Cache.get(key)
+	if !ok {
+		page, err = i.renderDirectory(ctx, resolvedPath, contentPath, dir, originalUrlPath, gwURL, logger)
+		if err != nil {
+			internalWebError(w, err)
+			return
+		}
+		i.config.Cache.put(key, page)
+	}
+
+	if gw := brandingOf(r); gw != nil {
+		if gw.Locale != "" {
+			w.Header().Set("Content-Language", gw.Locale)
+		}
+		page = brandPage(page, gw)
+	}
+	_, _ = w.Write(page)
+
+	// Update metrics
+	i.unixfsGenDirGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+}
+
+// renderDirectory returns the HTML listing of dir, with the links of the
+// originalUrlPath it is requested with.
+func (i *gatewayHandler) renderDirectory(ctx context.Context, resolvedPath ipath.Resolved, contentPath ipath.Path, dir files.Directory, originalUrlPath, gwURL string, logger *zap.SugaredLogger) ([]byte, error) {
 	// storage for directory listing
 	var dirListing []directoryItem
 	dirit := dir.Entries()
@@ -119,12 +163,11 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 
 		resolved, err := i.api.ResolvePath(ctx, ipath.Join(resolvedPath, dirit.Name()))
 		if err != nil {
-			internalWebError(w, err)
-			return
+			return nil, err
 		}
 		hash := resolved.Cid().String()
 
-		// See comment above where originalUrlPath is declared.
+		// See comment in serveDirectory where originalUrlPath is declared.
 		di := directoryItem{
 			Size:      size,
 			Name:      dirit.Name(),
@@ -135,8 +178,7 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 		dirListing = append(dirListing, di)
 	}
 	if dirit.Err() != nil {
-		internalWebError(w, dirit.Err())
-		return
+		return nil, dirit.Err()
 	}
 
 	// construct the correct back link
@@ -169,21 +211,9 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 
 	hash := resolvedPath.Cid().String()
 
-	// Gateway root URL to be used when linking to other rootIDs.
-	// This will be blank unless subdomain or DNSLink resolution is being used
-	// for this request.
-	var gwURL string
-
-	// Get gateway hostname and build gateway URL.
-	if h, ok := r.Context().Value("gw-hostname").(string); ok {
-		gwURL = "//" + h
-	} else {
-		gwURL = ""
-	}
-
 	dnslink := hasDNSLinkOrigin(gwURL, contentPath.String())
 
-	// See comment above where originalUrlPath is declared.
+	// See comment in serveDirectory where originalUrlPath is declared.
 	tplData := listingTemplateData{
 		GatewayURL:  gwURL,
 		DNSLink:     dnslink,
@@ -197,13 +227,11 @@ func (i *gatewayHandler) serveDirectory(w http.ResponseWriter, r *http.Request,
 
 	logger.Debugw("request processed", "tplDataDNSLink", dnslink, "tplDataSize", size, "tplDataBackLink", backLink, "tplDataHash", hash)
 
-	if err := listingTemplate.Execute(w, tplData); err != nil {
-		internalWebError(w, err)
-		return
+	var page bytes.Buffer
+	if err := listingTemplate.Execute(&page, tplData); err != nil {
+		return nil, err
 	}
-
-	// Update metrics
-	i.unixfsGenDirGetMetric.WithLabelValues(contentPath.Namespace()).Observe(time.Since(begin).Seconds())
+	return page.Bytes(), nil
 }
 
 func getDirListingEtag(dirCid cid.Cid) string {
@@ -12,6 +12,7 @@ import (
 	"github.com/gabriel-vasile/mimetype"
 	files "github.com/ipfs/go-ipfs-files"
 	"github.com/ipfs/go-ipfs/tracing"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
@@ -26,9 +27,38 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, r *http.Request, resol
 	// Set Cache-Control and read optional Last-Modified time
 	modtime := addCacheControlHeaders(w, r, contentPath, resolvedPath.Cid())
 
+	// The node of the file is in the blockstore already, the file being open
+	nd, ndErr := i.api.Dag().Get(r.Context(), resolvedPath.Cid())
+	// Last-Modified is the modification time kept in the UnixFS metadata
+	// of the file, if any
+	if ndErr == nil {
+		if m, err := unixfsmeta.Get(nd); err == nil && !m.ModTime.IsZero() {
+			modtime = m.ModTime
+		}
+	}
+
 	// Set Content-Disposition
 	name := addContentDispositionHeader(w, r, contentPath)
 
+	// Images are resized when asked to, if the gateway resizes images
+	if i.config.ImageResizer != nil {
+		params, ok, err := parseImageParams(r)
+		if err != nil {
+			webError(w, "invalid image parameters", err, http.StatusBadRequest)
+			return
+		}
+		if ok {
+			i.serveResizedImage(w, r, resolvedPath, name, modtime, file, params)
+			return
+		}
+	}
+
+	// Markdown and source files are rendered for the browsers, if the
+	// gateway renders them
+	if i.rendersFile(r, name) && i.serveRenderedFile(w, r, resolvedPath, contentPath, name, file) {
+		return
+	}
+
 	// Prepare size value for Content-Length HTTP header (set inside of http.ServeContent)
 	size, err := file.Size()
 	if err != nil {
@@ -37,10 +67,17 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, r *http.Request, resol
 	}
 
 	// Lazy seeker enables efficient range-requests and HTTP HEAD responses
-	content := &lazySeeker{
+	var content io.ReadSeeker = &lazySeeker{
 		size:   size,
 		reader: file,
 	}
+	// The ranges of UnixFS files only fetch the leaves they cover
+	if ndErr == nil {
+		if fr, ok := newUnixfsFileReader(r.Context(), i.api.Dag(), nd, size); ok {
+			fr.files = i.config.BlockFiles
+			content = fr
+		}
+	}
 
 	// Calculate deterministic value for Content-Type HTTP header
 	// (we prefer to do it here, rather than using implicit sniffing in http.ServeContent)
@@ -52,6 +89,16 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, r *http.Request, resol
 	} else {
 		ctype = mime.TypeByExtension(gopath.Ext(name))
 		if ctype == "" {
+			// the data of a CID is always of the type detected before
+			if cached, ok := i.config.Cache.get(contentTypeCacheKey(resolvedPath.Cid())); ok {
+				ctype = string(cached)
+			}
+		}
+		if ctype == "" && r.Method == http.MethodHead {
+			// HEAD requests do not fetch the data to sniff its type, link
+			// checkers would otherwise download the first blocks of files
+			w.Header()["Content-Type"] = nil // no sniffing by ServeContent either
+		} else if ctype == "" {
 			// uses https://github.com/gabriel-vasile/mimetype library to determine the content type.
 			// Fixes https://github.com/ipfs/go-ipfs/issues/7252
 			mimeType, err := mimetype.DetectReader(content)
@@ -66,6 +113,7 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, r *http.Request, resol
 				http.Error(w, "seeker can't seek", http.StatusInternalServerError)
 				return
 			}
+			i.config.Cache.put(contentTypeCacheKey(resolvedPath.Cid()), []byte(ctype))
 		}
 		// Strip the encoding from the HTML Content-Type header and let the
 		// browser figure it out.
@@ -77,7 +125,9 @@ func (i *gatewayHandler) serveFile(w http.ResponseWriter, r *http.Request, resol
 	}
 	// Setting explicit Content-Type to avoid mime-type sniffing on the client
 	// (unifies behavior across gateways and web browsers)
-	w.Header().Set("Content-Type", ctype)
+	if ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
 
 	// special fixup around redirects
 	w = &statusResponseWriter{w}
@@ -0,0 +1,216 @@
+package corehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+)
+
+// past this many leaves, the leaves read sequentially are not fetched further
+// ahead
+const maxFileReadAhead = 16
+
+// unixfsFileReader reads a UnixFS file, walking its DAG from the root to the
+// leaf of the offset read, by the sizes of the children of each node. Unlike
+// the DagReader of go-unixfs, which preloads the children of the nodes from
+// the start of the file, only the leaves read are fetched, so that range
+// requests in large files fetch the blocks of their ranges. The next leaves
+// are fetched ahead once the leaves are read in sequence.
+type unixfsFileReader struct {
+	ctx    context.Context
+	dag    ipld.NodeGetter
+	root   ipld.Node
+	size   int64
+	offset int64
+
+	// the data of the leaf read, starting at leafStart in the file
+	leaf      []byte
+	leafStart int64
+
+	// the node linking to the leaf, the index of the leaf in its links and
+	// the sizes of its children
+	parent     *dag.ProtoNode
+	index      int
+	blockSizes []uint64
+	// the promises of the children of parent fetched ahead, by index, and the
+	// number of leaves to fetch ahead
+	ahead  map[int]*ipld.NodePromise
+	window int
+
+	// files, if set, returns the file a raw leaf is stored in as is, for
+	// sendTo to send it from the disk
+	files func(cid.Cid) (string, bool)
+}
+
+// newUnixfsFileReader returns a reader of the UnixFS file of root, or false if
+// root is not a file with data, such as a symlink.
+func newUnixfsFileReader(ctx context.Context, ng ipld.NodeGetter, root ipld.Node, size int64) (*unixfsFileReader, bool) {
+	switch n := root.(type) {
+	case *dag.RawNode:
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(n.Data())
+		if err != nil {
+			return nil, false
+		}
+		switch fsn.Type() {
+		case ft.TFile, ft.TRaw:
+		default:
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	return &unixfsFileReader{ctx: ctx, dag: ng, root: root, size: size}, true
+}
+
+func (fr *unixfsFileReader) Read(p []byte) (int, error) {
+	if fr.offset >= fr.size {
+		return 0, io.EOF
+	}
+	if err := fr.loadLeaf(); err != nil {
+		return 0, err
+	}
+
+	n := copy(p, fr.leaf[fr.offset-fr.leafStart:])
+	fr.offset += int64(n)
+	return n, nil
+}
+
+// loadLeaf fetches the leaf of the offset, unless it is the leaf read.
+func (fr *unixfsFileReader) loadLeaf() error {
+	if fr.leaf != nil && fr.offset >= fr.leafStart && fr.offset < fr.leafStart+int64(len(fr.leaf)) {
+		return nil
+	}
+	// the next leaf of the same parent, read in sequence
+	next := fr.leaf != nil && fr.offset == fr.leafStart+int64(len(fr.leaf)) &&
+		fr.parent != nil && fr.index+1 < len(fr.parent.Links())
+	if next && fr.nextLeaf() {
+		return nil
+	}
+	return fr.seekLeaf(true)
+}
+
+// seekLeaf walks the DAG from the root to the leaf of the offset. Unless
+// fetchRaw is set, the walk stops at the parent of the leaf when it is a raw
+// block, leaving the leaf unread.
+func (fr *unixfsFileReader) seekLeaf(fetchRaw bool) error {
+	nd, start := fr.root, int64(0)
+	fr.parent, fr.ahead, fr.window = nil, nil, 0
+	for {
+		data, pn, fsn, err := fileNodeData(nd)
+		if err != nil {
+			return err
+		}
+		if pn == nil || len(pn.Links()) == 0 || fr.offset < start+int64(len(data)) {
+			if fr.offset >= start+int64(len(data)) {
+				return fmt.Errorf("offset %d past the data of %s", fr.offset, nd.Cid())
+			}
+			fr.leaf, fr.leafStart = data, start
+			return nil
+		}
+
+		// the child of the offset
+		sizes := fsn.BlockSizes()
+		if len(sizes) != len(pn.Links()) {
+			return fmt.Errorf("inconsistent block sizes in %s", nd.Cid())
+		}
+		pos := start + int64(len(data))
+		i := 0
+		for ; i < len(sizes) && fr.offset >= pos+int64(sizes[i]); i++ {
+			pos += int64(sizes[i])
+		}
+		if i == len(sizes) {
+			return fmt.Errorf("offset %d past the children of %s", fr.offset, nd.Cid())
+		}
+
+		if !fetchRaw && pn.Links()[i].Cid.Type() == cid.Raw {
+			fr.parent, fr.index, fr.blockSizes = pn, i, sizes
+			fr.leaf, fr.leafStart = nil, pos
+			return nil
+		}
+		child, err := fr.dag.Get(fr.ctx, pn.Links()[i].Cid)
+		if err != nil {
+			return err
+		}
+		fr.parent, fr.index, fr.blockSizes = pn, i, sizes
+		nd, start = child, pos
+	}
+}
+
+// nextLeaf reads the next child of the parent of the leaf, fetching the
+// following ones ahead. It returns false if that child is not a leaf.
+func (fr *unixfsFileReader) nextLeaf() bool {
+	links := fr.parent.Links()
+	fr.index++
+
+	// the read ahead grows while the leaves are read in sequence
+	if fr.window < maxFileReadAhead {
+		fr.window = fr.window*2 + 1
+	}
+	if fr.ahead == nil {
+		fr.ahead = make(map[int]*ipld.NodePromise)
+	}
+	var missing []cid.Cid
+	var indexes []int
+	for i := fr.index; i < len(links) && i <= fr.index+fr.window; i++ {
+		if _, ok := fr.ahead[i]; !ok {
+			missing = append(missing, links[i].Cid)
+			indexes = append(indexes, i)
+		}
+	}
+	for j, p := range ipld.GetNodes(fr.ctx, fr.dag, missing) {
+		fr.ahead[indexes[j]] = p
+	}
+
+	child, err := fr.ahead[fr.index].Get(fr.ctx)
+	delete(fr.ahead, fr.index)
+	if err != nil {
+		return false
+	}
+	data, pn, _, err := fileNodeData(child)
+	if err != nil || (pn != nil && len(pn.Links()) > 0) || int64(len(data)) != int64(fr.blockSizes[fr.index]) {
+		return false
+	}
+	fr.leafStart += int64(len(fr.leaf))
+	fr.leaf = data
+	return true
+}
+
+// fileNodeData returns the data of a node of a UnixFS file, with the node and
+// its UnixFS metadata if it is not a raw leaf.
+func fileNodeData(nd ipld.Node) ([]byte, *dag.ProtoNode, *ft.FSNode, error) {
+	switch n := nd.(type) {
+	case *dag.RawNode:
+		return n.RawData(), nil, nil, nil
+	case *dag.ProtoNode:
+		fsn, err := ft.FSNodeFromBytes(n.Data())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return fsn.Data(), n, fsn, nil
+	}
+	return nil, nil, nil, errors.New("unsupported node in a UnixFS file")
+}
+
+func (fr *unixfsFileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += fr.offset
+	case io.SeekEnd:
+		offset += fr.size
+	default:
+		return fr.offset, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return fr.offset, errors.New("invalid seek offset")
+	}
+	fr.offset = offset
+	return offset, nil
+}
@@ -0,0 +1,117 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	h "github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipfs/go-unixfs/importer/trickle"
+)
+
+// countingGetter counts the nodes fetched.
+type countingGetter struct {
+	ipld.NodeGetter
+	gets int64
+}
+
+func (g *countingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	atomic.AddInt64(&g.gets, 1)
+	return g.NodeGetter.Get(ctx, c)
+}
+
+func (g *countingGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	atomic.AddInt64(&g.gets, int64(len(cids)))
+	return g.NodeGetter.GetMany(ctx, cids)
+}
+
+func buildTestFile(t *testing.T, data []byte, layout func(*h.DagBuilderHelper) (ipld.Node, error), rawLeaves bool) (ipld.DAGService, ipld.Node) {
+	ds := mdtest.Mock()
+	dbp := h.DagBuilderParams{Dagserv: ds, Maxlinks: 4, RawLeaves: rawLeaves}
+	db, err := dbp.New(chunker.NewSizeSplitter(bytes.NewReader(data), 10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := layout(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ds, nd
+}
+
+func TestUnixfsFileReader(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	layouts := map[string]func(*h.DagBuilderHelper) (ipld.Node, error){
+		"balanced": balanced.Layout,
+		"trickle":  trickle.Layout,
+	}
+	for name, layout := range layouts {
+		for _, rawLeaves := range []bool{false, true} {
+			ds, nd := buildTestFile(t, data, layout, rawLeaves)
+			fr, ok := newUnixfsFileReader(ctx, ds, nd, int64(len(data)))
+			if !ok {
+				t.Fatalf("%s: not a file", name)
+			}
+
+			all, err := ioutil.ReadAll(fr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(all, data) {
+				t.Fatalf("%s (raw leaves %t): wrong file read", name, rawLeaves)
+			}
+
+			rnd := rand.New(rand.NewSource(2))
+			for i := 0; i < 50; i++ {
+				off := rnd.Intn(len(data))
+				n := rnd.Intn(len(data) - off)
+				if _, err := fr.Seek(int64(off), io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				buf := make([]byte, n)
+				if _, err := io.ReadFull(fr, buf); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf, data[off:off+n]) {
+					t.Fatalf("%s (raw leaves %t): wrong range %d-%d", name, rawLeaves, off, off+n)
+				}
+			}
+		}
+	}
+}
+
+func TestUnixfsFileReaderFetchesRange(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 640)
+	rand.New(rand.NewSource(1)).Read(data)
+	ds, nd := buildTestFile(t, data, balanced.Layout, true)
+
+	// 64 leaves under 3 levels of 4 links
+	g := &countingGetter{NodeGetter: ds}
+	fr, _ := newUnixfsFileReader(ctx, g, nd, int64(len(data)))
+	if _, err := fr.Seek(500, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(fr, buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[500:505]) {
+		t.Fatal("wrong range read")
+	}
+	if gets := atomic.LoadInt64(&g.gets); gets != 3 {
+		t.Fatalf("expected the 3 nodes from the root to the leaf to be fetched, got %d", gets)
+	}
+}
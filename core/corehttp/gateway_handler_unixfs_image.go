@@ -0,0 +1,312 @@
+package corehttp
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // decodes the first frame of GIFs
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/tracing"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	imageWidthParam  = "img-width"
+	imageFormatParam = "img-format"
+
+	imageFormatJPEG = "jpeg"
+	imageFormatPNG  = "png"
+
+	defaultImageCacheSize = "64MB"
+
+	// the widest image resized to
+	maxImageWidth = 4096
+	// images of more pixels or bytes are not resized, to bound the memory
+	// of a resize
+	maxImagePixels     = 50_000_000
+	maxImageSourceSize = 64 << 20
+
+	imageJPEGQuality = 85
+)
+
+var (
+	errNotAnImage    = errors.New("not a JPEG, PNG or GIF image")
+	errImageTooLarge = errors.New("image too large to be resized")
+)
+
+// imageParams is the resizing of an image asked by a request.
+type imageParams struct {
+	// width is the width of the resized image, the height keeping the
+	// aspect ratio. Images narrower than width, or all images if 0, keep
+	// their size.
+	width int
+	// format is the format of the resized image, or "" for PNG images to
+	// stay PNG and JPEG images JPEG
+	format string
+}
+
+// String returns the params as a suffix of the Etags of the resized images,
+// such as "w320.jpeg".
+func (p imageParams) String() string {
+	s := "w" + strconv.Itoa(p.width)
+	if p.format != "" {
+		s += "." + p.format
+	}
+	return s
+}
+
+// parseImageParams returns the resizing asked by the query of r, or false if
+// r asks for none.
+func parseImageParams(r *http.Request) (imageParams, bool, error) {
+	q := r.URL.Query()
+	width, format := q.Get(imageWidthParam), q.Get(imageFormatParam)
+	if width == "" && format == "" {
+		return imageParams{}, false, nil
+	}
+
+	var p imageParams
+	if width != "" {
+		w, err := strconv.Atoi(width)
+		if err != nil || w < 1 || w > maxImageWidth {
+			return p, false, fmt.Errorf("%s must be between 1 and %d", imageWidthParam, maxImageWidth)
+		}
+		p.width = w
+	}
+	switch format {
+	case "":
+	case "jpg", imageFormatJPEG:
+		p.format = imageFormatJPEG
+	case imageFormatPNG:
+		p.format = imageFormatPNG
+	default:
+		return p, false, fmt.Errorf("unsupported %s %q, use %s or %s", imageFormatParam, format, imageFormatJPEG, imageFormatPNG)
+	}
+	return p, true, nil
+}
+
+// serveResizedImage serves the image of file resized as asked by params.
+func (i *gatewayHandler) serveResizedImage(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, name string, modtime time.Time, file files.File, params imageParams) {
+	ctx, span := tracing.Span(r.Context(), "Gateway", "ServeResizedImage", trace.WithAttributes(attribute.String("path", resolvedPath.String()), attribute.String("params", params.String())))
+	defer span.End()
+
+	img, err := i.config.ImageResizer.resize(ctx, resolvedPath.Cid().String()+"."+params.String(), file, params)
+	switch {
+	case err == nil:
+	case errors.Is(err, errNotAnImage), errors.Is(err, errImageTooLarge):
+		webError(w, "cannot resize "+name, err, http.StatusBadRequest)
+		return
+	default:
+		webError(w, "cannot resize "+name, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/"+img.format)
+	ServeContent(w, r, name, modtime, bytes.NewReader(img.data))
+}
+
+// ImageResizer resizes the images of the gateway, a few at a time, and keeps
+// the images resized recently.
+type ImageResizer struct {
+	workers chan struct{}
+
+	mu sync.Mutex
+	// order lists the images from the most recently used
+	order     *list.List
+	images    map[string]*list.Element
+	size      int64
+	cacheSize int64
+}
+
+// resizedImage is an image resized, encoded in format.
+type resizedImage struct {
+	key    string
+	format string
+	data   []byte
+}
+
+// NewImageResizer returns an ImageResizer resizing workers images at once,
+// and keeping up to cacheSize bytes of resized images.
+func NewImageResizer(workers int, cacheSize int64) *ImageResizer {
+	if workers < 1 {
+		workers = 1
+	}
+	return &ImageResizer{
+		workers:   make(chan struct{}, workers),
+		order:     list.New(),
+		images:    make(map[string]*list.Element),
+		cacheSize: cacheSize,
+	}
+}
+
+// resize returns the image read from src resized as asked by params, from the
+// images resized before under key if there.
+func (ir *ImageResizer) resize(ctx context.Context, key string, src io.Reader, params imageParams) (*resizedImage, error) {
+	if img, ok := ir.get(key); ok {
+		return img, nil
+	}
+
+	// the image is checked before being decoded, as a few bytes can encode
+	// many pixels
+	data, err := ioutil.ReadAll(io.LimitReader(src, maxImageSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageSourceSize {
+		return nil, errImageTooLarge
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return nil, errImageTooLarge
+	}
+
+	select {
+	case ir.workers <- struct{}{}:
+		defer func() { <-ir.workers }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// resized by another request while waiting
+	if img, ok := ir.get(key); ok {
+		return img, nil
+	}
+
+	decoded, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotAnImage
+	}
+	if params.format != "" {
+		format = params.format
+	} else if format != imageFormatJPEG {
+		format = imageFormatPNG
+	}
+
+	var buf bytes.Buffer
+	resized := resizeImage(decoded, params.width)
+	if format == imageFormatJPEG {
+		err = jpeg.Encode(&buf, flattenImage(resized), &jpeg.Options{Quality: imageJPEGQuality})
+	} else {
+		err = png.Encode(&buf, resized)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img := &resizedImage{key: key, format: format, data: buf.Bytes()}
+	ir.add(img)
+	return img, nil
+}
+
+func (ir *ImageResizer) get(key string) (*resizedImage, bool) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	e, ok := ir.images[key]
+	if !ok {
+		return nil, false
+	}
+	ir.order.MoveToFront(e)
+	return e.Value.(*resizedImage), true
+}
+
+func (ir *ImageResizer) add(img *resizedImage) {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	if _, ok := ir.images[img.key]; ok || int64(len(img.data)) > ir.cacheSize {
+		return
+	}
+	ir.images[img.key] = ir.order.PushFront(img)
+	ir.size += int64(len(img.data))
+	for ir.size > ir.cacheSize {
+		last := ir.order.Remove(ir.order.Back()).(*resizedImage)
+		delete(ir.images, last.key)
+		ir.size -= int64(len(last.data))
+	}
+}
+
+// purge drops the resized images kept.
+func (ir *ImageResizer) purge() {
+	ir.mu.Lock()
+	defer ir.mu.Unlock()
+	ir.order.Init()
+	ir.images = make(map[string]*list.Element)
+	ir.size = 0
+}
+
+// resizeImage scales src down to width, each pixel of the result averaging
+// the pixels of src it covers. Images narrower than width, or all images if
+// width is 0, keep their size.
+func resizeImage(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if width <= 0 || width >= sw {
+		return src
+	}
+	height := (sh*width + sw/2) / sw
+	if height < 1 {
+		height = 1
+	}
+
+	// premultiplied, so that transparent pixels do not darken the average
+	rgba := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 == x0 {
+				x1++
+			}
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				off := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += uint64(rgba.Pix[off+c])
+					}
+					off += 4
+				}
+			}
+			n := uint64((x1 - x0) * (y1 - y0))
+			d := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[d+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// flattenImage returns img over a white background, as JPEG images have no
+// transparency.
+func flattenImage(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
@@ -0,0 +1,166 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+)
+
+func TestResizeImage(t *testing.T) {
+	// two halves, black and white
+	src := image.NewRGBA(image.Rect(0, 0, 100, 50))
+	for y := 0; y < 50; y++ {
+		for x := 50; x < 100; x++ {
+			src.Set(x, y, color.White)
+		}
+		for x := 0; x < 50; x++ {
+			src.Set(x, y, color.Black)
+		}
+	}
+
+	resized := resizeImage(src, 10)
+	if b := resized.Bounds(); b.Dx() != 10 || b.Dy() != 5 {
+		t.Fatalf("expected a 10x5 image, got %s", b)
+	}
+	if r, _, _, _ := resized.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("expected the left half to stay black, got %d", r)
+	}
+	if r, _, _, _ := resized.At(9, 4).RGBA(); r != 0xffff {
+		t.Errorf("expected the right half to stay white, got %d", r)
+	}
+
+	if resizeImage(src, 200) != src || resizeImage(src, 0) != src {
+		t.Error("expected the images narrower than the width to keep their size")
+	}
+}
+
+func TestParseImageParams(t *testing.T) {
+	for query, expected := range map[string]string{
+		"img-width=320":                 "w320",
+		"img-width=320&img-format=jpg":  "w320.jpeg",
+		"img-format=png":                "w0.png",
+		"img-width=0":                   "error",
+		"img-width=100000":              "error",
+		"img-width=320&img-format=webp": "error",
+		"format=car":                    "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ipfs/bafkqaaa?"+query, nil)
+		p, ok, err := parseImageParams(r)
+		var got string
+		switch {
+		case err != nil:
+			got = "error"
+		case ok:
+			got = p.String()
+		}
+		if got != expected {
+			t.Errorf("%s: expected %q, got %q", query, expected, got)
+		}
+	}
+}
+
+func TestImageResizerCache(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+	ir := NewImageResizer(1, 1<<20)
+	ctx := context.Background()
+
+	img, err := ir.resize(ctx, "a", bytes.NewReader(src.Bytes()), imageParams{width: 16, format: imageFormatJPEG})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.format != imageFormatJPEG {
+		t.Fatalf("expected a JPEG image, got %s", img.format)
+	}
+	// the source is not read again
+	if cached, err := ir.resize(ctx, "a", bytes.NewReader(nil), imageParams{width: 16}); err != nil || cached != img {
+		t.Fatalf("expected the resized image to be cached, got %v", err)
+	}
+
+	if _, err := ir.resize(ctx, "b", bytes.NewReader([]byte("not an image")), imageParams{width: 16}); err != errNotAnImage {
+		t.Fatalf("expected %v, got %v", errNotAnImage, err)
+	}
+
+	ir.purge()
+	if _, ok := ir.get("a"); ok {
+		t.Fatal("expected the cache to be purged")
+	}
+}
+
+func TestGatewayImageResizing(t *testing.T) {
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.ImageResizing.Enabled = config.True
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var src bytes.Buffer
+	if err := png.Encode(&src, image.NewGray(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := api.Unixfs().Add(n.Context(), files.NewBytesFile(src.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.Get(ts.URL + p.String() + "?img-width=320&img-format=jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected a 200 response, got %d: %s", res.StatusCode, body)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("expected a JPEG image, got %s", ct)
+	}
+	if etag := res.Header.Get("Etag"); etag != `"`+p.Cid().String()+`.w320.jpeg"` {
+		t.Fatalf("unexpected Etag %s", etag)
+	}
+	resized, err := jpeg.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resized.Width != 320 || resized.Height != 240 {
+		t.Fatalf("expected a 320x240 image, got %dx%d", resized.Width, resized.Height)
+	}
+
+	res, err = http.Get(ts.URL + p.String() + "?img-format=webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected a 400 response, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,247 @@
+package corehttp
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	gopath "path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers/b"
+	"github.com/alecthomas/chroma/lexers/c"
+	"github.com/alecthomas/chroma/lexers/circular"
+	"github.com/alecthomas/chroma/lexers/d"
+	"github.com/alecthomas/chroma/lexers/g"
+	"github.com/alecthomas/chroma/lexers/h"
+	"github.com/alecthomas/chroma/lexers/j"
+	"github.com/alecthomas/chroma/lexers/k"
+	"github.com/alecthomas/chroma/lexers/l"
+	"github.com/alecthomas/chroma/lexers/p"
+	"github.com/alecthomas/chroma/lexers/r"
+	"github.com/alecthomas/chroma/lexers/s"
+	"github.com/alecthomas/chroma/lexers/t"
+	"github.com/alecthomas/chroma/lexers/y"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/dustin/go-humanize"
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/assets"
+	"github.com/ipfs/go-ipfs/tracing"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the largest files rendered, the larger ones being served as they are
+const maxRenderedFileSize = 1 << 20
+
+// markdownExtensions are the extensions of the files rendered as Markdown.
+var markdownExtensions = map[string]bool{".md": true, ".markdown": true}
+
+// sourceLexers highlight the source files, by their extension.
+var sourceLexers = map[string]chroma.Lexer{
+	".c":     c.C,
+	".h":     c.C,
+	".cc":    c.CPP,
+	".cpp":   c.CPP,
+	".hpp":   c.CPP,
+	".cs":    c.CSharp,
+	".css":   c.CSS,
+	".diff":  d.Diff,
+	".patch": d.Diff,
+	".go":    g.Go,
+	".hs":    h.Haskell,
+	".java":  j.Java,
+	".js":    j.Javascript,
+	".mjs":   j.Javascript,
+	".jsx":   j.JSX,
+	".json":  j.JSON,
+	".kt":    k.Kotlin,
+	".lua":   l.Lua,
+	".php":   circular.PHP,
+	".pl":    p.Perl,
+	".py":    p.Python,
+	".rb":    r.Ruby,
+	".rs":    r.Rust,
+	".sh":    b.Bash,
+	".bash":  b.Bash,
+	".sol":   s.Solidity,
+	".sql":   s.SQL,
+	".swift": s.Swift,
+	".scala": s.Scala,
+	".toml":  t.TOML,
+	".ts":    t.TypeScript,
+	".tsx":   t.TypeScript,
+	".yaml":  y.YAML,
+	".yml":   y.YAML,
+}
+
+var (
+	markdownRenderer = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+	sourceFormatter = chromahtml.New(chromahtml.WithLineNumbers(true), chromahtml.TabWidth(4))
+	sourceStyle     = styles.GitHub
+)
+
+// renderedStyle styles the rendered files, in addition to the style of the
+// directory listings.
+const renderedStyle = `
+#rendered-file { padding: 1em 2em; overflow-wrap: break-word; }
+#rendered-file pre { overflow: auto; padding: 1em; background-color: #f6f8fa; }
+#rendered-file img { max-width: 100%; }
+#rendered-file table { border-collapse: collapse; }
+#rendered-file th, #rendered-file td { border: 1px solid #dfe2e5; padding: .4em .8em; }
+`
+
+// renderedTemplateData is the page of a rendered file, whose header is that
+// of the directory listings.
+type renderedTemplateData struct {
+	listingTemplateData
+	Content template.HTML
+}
+
+// renderedPage returns the template of the pages of the rendered files, given
+// the template of the directory listings, whose page they keep up to the
+// listing itself.
+func renderedPage(listing string) string {
+	end := strings.Index(listing, `<div class="table-responsive">`)
+	if end < 0 || !strings.Contains(listing, "</style>") {
+		panic("unexpected directory listing template")
+	}
+	page := strings.Replace(listing[:end], "</style>", renderedStyle+"</style>", 1)
+	page = strings.Replace(page, "Index of", "", 1)
+	return page + "<div id=\"rendered-file\">{{ .Content }}</div>\n  </div>\n</body>\n</html>\n"
+}
+
+// rendersFile returns true if the file name requested by r is served as an
+// HTML page, the gateway rendering the files and the request accepting HTML
+// without asking for another format.
+func (i *gatewayHandler) rendersFile(r *http.Request, name string) bool {
+	if !i.config.RenderMarkdown || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+	q := r.URL.Query()
+	if q.Get("format") != "" || q.Get("download") == "true" || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		return false
+	}
+	ext := strings.ToLower(gopath.Ext(name))
+	return markdownExtensions[ext] || sourceLexers[ext] != nil
+}
+
+// serveRenderedFile serves the Markdown or source file as an HTML page, and
+// returns false without writing anything for the files too large or not in
+// UTF-8 to be rendered, whose reading it rewinds.
+func (i *gatewayHandler) serveRenderedFile(w http.ResponseWriter, r *http.Request, resolvedPath ipath.Resolved, contentPath ipath.Path, name string, file files.File) bool {
+	_, span := tracing.Span(r.Context(), "Gateway", "ServeRenderedFile", trace.WithAttributes(attribute.String("path", resolvedPath.String())))
+	defer span.End()
+
+	size, err := file.Size()
+	if err != nil || size > maxRenderedFileSize {
+		return false
+	}
+
+	etag := getRenderedEtag(resolvedPath.Cid())
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("Etag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	// Gateway root URL to be used when linking to other rootIDs, as in the
+	// directory listings
+	var gwURL string
+	if h, ok := r.Context().Value("gw-hostname").(string); ok {
+		gwURL = "//" + h
+	}
+
+	key := renderedCacheKey(resolvedPath.Cid(), contentPath, gwURL)
+	page, ok := i.config.Cache.get(key)
+	if !ok {
+		src, err := ioutil.ReadAll(io.LimitReader(file, maxRenderedFileSize+1))
+		if err != nil {
+			internalWebError(w, err)
+			return true
+		}
+		if len(src) > maxRenderedFileSize || !utf8.Valid(src) {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				internalWebError(w, err)
+				return true
+			}
+			return false
+		}
+		page, err = renderFile(src, name, resolvedPath.Cid(), contentPath, size, gwURL)
+		if err != nil {
+			internalWebError(w, err)
+			return true
+		}
+		i.config.Cache.put(key, page)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Etag", etag)
+	if gw := brandingOf(r); gw != nil {
+		if gw.Locale != "" {
+			w.Header().Set("Content-Language", gw.Locale)
+		}
+		page = brandPage(page, gw)
+	}
+	if r.Method == http.MethodHead {
+		return true
+	}
+	_, _ = w.Write(page)
+	return true
+}
+
+// renderFile returns the HTML page of the Markdown or source file src, named
+// name, with the header of the directory listings.
+func renderFile(src []byte, name string, c cid.Cid, contentPath ipath.Path, size int64, gwURL string) ([]byte, error) {
+	var content bytes.Buffer
+	ext := strings.ToLower(gopath.Ext(name))
+	if markdownExtensions[ext] {
+		// the HTML of the Markdown, which could run scripts on the origin
+		// of the gateway, is left out
+		if err := markdownRenderer.Convert(src, &content); err != nil {
+			return nil, err
+		}
+	} else {
+		it, err := sourceLexers[ext].Tokenise(nil, string(src))
+		if err != nil {
+			return nil, err
+		}
+		if err := sourceFormatter.Format(&content, sourceStyle, it); err != nil {
+			return nil, err
+		}
+	}
+
+	dnslink := hasDNSLinkOrigin(gwURL, contentPath.String())
+	data := renderedTemplateData{
+		listingTemplateData: listingTemplateData{
+			GatewayURL:  gwURL,
+			DNSLink:     dnslink,
+			Size:        humanize.Bytes(uint64(size)),
+			Path:        contentPath.String(),
+			Breadcrumbs: breadcrumbs(contentPath.String(), dnslink),
+			Hash:        c.String(),
+		},
+		Content: template.HTML(content.String()),
+	}
+	var page bytes.Buffer
+	if err := renderedTemplate.Execute(&page, data); err != nil {
+		return nil, fmt.Errorf("rendering %s: %w", name, err)
+	}
+	return page.Bytes(), nil
+}
+
+// getRenderedEtag returns the Etag of the rendered page of the file c, which
+// changes with the pages of the gateway.
+func getRenderedEtag(c cid.Cid) string {
+	return `"Rendered-` + assets.BindataVersionHash + `_CID-` + c.String() + `"`
+}
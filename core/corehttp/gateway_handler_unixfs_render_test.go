@@ -0,0 +1,110 @@
+package corehttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	files "github.com/ipfs/go-ipfs-files"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+)
+
+func TestGatewayRenderMarkdown(t *testing.T) {
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.RenderMarkdown = config.True
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme := "# Title\n\nSome *text* <script>alert(1)</script>\n"
+	p, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"README.md": files.NewBytesFile([]byte(readme)),
+		"main.go":   files.NewBytesFile([]byte("package main\n\nfunc main() {}\n")),
+		"notes.txt": files.NewBytesFile([]byte("plain text\n")),
+		"blob.md":   files.NewBytesFile([]byte{0xff, 0xfe, 0x00}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path, accept string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+p.String()+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected a 200 response, got %d: %s", path, res.StatusCode, body)
+		}
+		return res, string(body)
+	}
+
+	const browser = "text/html,application/xhtml+xml,*/*;q=0.8"
+	res, body := get("/README.md", browser)
+	if ct := res.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("expected an HTML page, got %s", ct)
+	}
+	if !strings.Contains(body, "<h1>Title</h1>") || !strings.Contains(body, "<em>text</em>") {
+		t.Fatalf("expected the Markdown rendered, got %s", body)
+	}
+	if strings.Contains(body, "<script>") {
+		t.Fatal("expected the HTML of the Markdown left out")
+	}
+	if !strings.Contains(body, `<a href="/ipfs/`+p.Cid().String()+`/README.md">README.md</a>`) {
+		t.Fatalf("expected the breadcrumbs of the file, got %s", body)
+	}
+	if etag := res.Header.Get("Etag"); !strings.HasPrefix(etag, `"Rendered-`) {
+		t.Fatalf("unexpected Etag %s", etag)
+	}
+
+	_, body = get("/main.go", browser)
+	if !strings.Contains(body, "<pre") || !strings.Contains(body, ">package</span>") {
+		t.Fatalf("expected the source highlighted, got %s", body)
+	}
+
+	// the bytes are served to the other clients, the files not rendered and
+	// those asked in another format
+	for path, accept := range map[string]string{
+		"/README.md":               "",
+		"/README.md?download=true": browser,
+		"/notes.txt":               browser,
+		"/blob.md":                 browser,
+	} {
+		res, body := get(path, accept)
+		if strings.HasPrefix(res.Header.Get("Content-Type"), "text/html") || strings.Contains(body, "rendered-file") {
+			t.Fatalf("%s: expected the bytes of the file, got %s", path, body)
+		}
+	}
+	res, body = get("/README.md?format=raw", browser)
+	if ct := res.Header.Get("Content-Type"); ct != "application/vnd.ipld.raw" || strings.Contains(body, "rendered-file") {
+		t.Fatalf("expected the raw block, got %s", ct)
+	}
+}
@@ -0,0 +1,83 @@
+package corehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/namewatch"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	watchParam = "watch"
+
+	// watchKeepAlive is how often a comment is sent on the idle event
+	// streams, for the proxies not to close them
+	watchKeepAlive = 30 * time.Second
+)
+
+var errNameWatchDisabled = errors.New("IPNS over pubsub is not enabled")
+
+// NameWatcher follows the value of IPNS names, such as namewatch.Watcher.
+type NameWatcher interface {
+	Watch(ctx context.Context, id peer.ID) (<-chan namewatch.Update, error)
+}
+
+// serveNameUpdates answers the /ipns/<name>?watch requests with server-sent
+// events, one for the current value of the name and one for each new value.
+func (i *gatewayHandler) serveNameUpdates(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, ipnsPathPrefix), "/")
+	if i.config.NameWatcher == nil {
+		webError(w, "cannot watch "+debugStr(name), errNameWatchDisabled, http.StatusNotImplemented)
+		return
+	}
+	id, err := peer.Decode(name)
+	if err != nil {
+		webError(w, "only IPNS keys can be watched, not "+debugStr(name), err, http.StatusBadRequest)
+		return
+	}
+
+	updates, err := i.config.NameWatcher.Watch(r.Context(), id)
+	if err != nil {
+		webError(w, "cannot watch "+debugStr(name), err, http.StatusInternalServerError)
+		return
+	}
+
+	i.addUserHeaders(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: update\nid: %d\ndata: %s\n\n", u.Sequence, u.Value)
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+		}
+		if err != nil {
+			return
+		}
+		flush()
+	}
+}
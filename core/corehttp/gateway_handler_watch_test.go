@@ -0,0 +1,57 @@
+package corehttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/namewatch"
+	path "github.com/ipfs/go-path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type fakeNameWatcher []namewatch.Update
+
+func (f fakeNameWatcher) Watch(ctx context.Context, id peer.ID) (<-chan namewatch.Update, error) {
+	out := make(chan namewatch.Update, len(f))
+	for _, u := range f {
+		out <- u
+	}
+	close(out)
+	return out, nil
+}
+
+func TestServeNameUpdates(t *testing.T) {
+	const name = "k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8"
+	get := func(h *gatewayHandler, p string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.getOrHeadHandler(w, httptest.NewRequest(http.MethodGet, p, nil))
+		return w
+	}
+
+	h := newGatewayHandler(GatewayConfig{}, nil)
+	if w := get(h, "/ipns/"+name+"?watch"); w.Code != http.StatusNotImplemented {
+		t.Fatalf("expected watching to be disabled, got %d", w.Code)
+	}
+
+	h = newGatewayHandler(GatewayConfig{NameWatcher: fakeNameWatcher{
+		{Value: path.FromString("/ipfs/bafkqaaa"), Sequence: 1},
+		{Value: path.FromString("/ipns/example.com"), Sequence: 4},
+	}}, nil)
+	if w := get(h, "/ipns/example.com?watch"); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected DNSLink names to be rejected, got %d", w.Code)
+	}
+
+	w := get(h, "/ipns/"+name+"/?watch")
+	if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", w.Code, ct)
+	}
+	body, _ := ioutil.ReadAll(w.Body)
+	expected := "event: update\nid: 1\ndata: /ipfs/bafkqaaa\n\n" +
+		"event: update\nid: 4\ndata: /ipns/example.com\n\n"
+	if string(body) != expected {
+		t.Fatalf("unexpected events %q", body)
+	}
+}
@@ -0,0 +1,41 @@
+package corehttp
+
+import (
+	"net/http"
+
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+)
+
+const (
+	// providersHeader lists the multiaddrs of known providers of the content
+	// requested.
+	providersHeader = "X-Ipfs-Providers"
+	// providersParam is the query parameter listing them, for the clients
+	// that cannot set headers, such as the links.
+	providersParam = "providers"
+)
+
+// withProviderHints makes the GET and HEAD requests for content connect to
+// the providers they list in the X-Ipfs-Providers header or the providers
+// query parameter, comma separated, before they are served, so that the
+// blocks are fetched from them without looking for providers first.
+func withProviderHints(next http.Handler, api *coreapi.CoreAPI) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hints := append(r.Header.Values(providersHeader), r.URL.Query()[providersParam]...)
+		if len(hints) == 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		infos, err := coreapi.ParseProviderHints(hints)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if n, err := api.ConnectProviders(r.Context(), infos); err != nil {
+			log.Debugf("connecting to the providers of %s: %s", r.URL.Path, err)
+		} else {
+			log.Debugf("connected to %d of the %d providers of %s", n, len(infos), r.URL.Path)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
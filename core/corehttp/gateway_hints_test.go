@@ -0,0 +1,53 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+)
+
+func TestProviderHints(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := 0
+	h := withProviderHints(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+	}), api.(*coreapi.CoreAPI))
+
+	const hint = "/ip4/127.0.0.1/tcp/4001/p2p/12D3KooWGC6TvWhfapngX6wvJHMYvKpDMXPb3ZnCZ6dMoaMtimQ5"
+	for _, tc := range []struct {
+		target string
+		header string
+		status int
+	}{
+		{"/ipfs/bafkqaaa", "", http.StatusOK},
+		// the offline node serves the request without connecting
+		{"/ipfs/bafkqaaa?providers=" + hint, "", http.StatusOK},
+		{"/ipfs/bafkqaaa", hint, http.StatusOK},
+		{"/ipfs/bafkqaaa?providers=/ip4/127.0.0.1/tcp/4001", "", http.StatusBadRequest},
+		{"/ipfs/bafkqaaa", "nonsense", http.StatusBadRequest},
+	} {
+		served = 0
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		if tc.header != "" {
+			req.Header.Set(providersHeader, tc.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Errorf("%s %q: expected status %d, got %d", tc.target, tc.header, tc.status, rec.Code)
+		}
+		if want := tc.status == http.StatusOK; (served == 1) != want {
+			t.Errorf("%s %q: expected the request served: %t", tc.target, tc.header, want)
+		}
+	}
+}
@@ -91,7 +91,12 @@ func hasDNSLinkOrigin(gwURL string, path string) bool {
 	return false
 }
 
-var listingTemplate *template.Template
+var (
+	listingTemplate *template.Template
+	// renderedTemplate is the template of the rendered Markdown and source
+	// files, with the header of the listings
+	renderedTemplate *template.Template
+)
 
 func init() {
 	knownIconsBytes, err := assets.Asset("dir-index-html/knownIcons.txt")
@@ -130,4 +135,5 @@ func init() {
 		"iconFromExt": iconFromExt,
 		"urlEscape":   urlEscape,
 	}).Parse(string(dirIndexBytes)))
+	renderedTemplate = template.Must(template.Must(listingTemplate.Clone()).New("rendered").Parse(renderedPage(string(dirIndexBytes))))
 }
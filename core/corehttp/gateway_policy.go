@@ -0,0 +1,222 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const (
+	// PolicyAllow lets the gateway serve the content.
+	PolicyAllow = "allow"
+	// PolicyDeny makes the gateway refuse to serve the content.
+	PolicyDeny = "deny"
+
+	policyTagsHeader = "X-Ipfs-Policy-Tags"
+
+	defaultPolicyTimeout   = 5 * time.Second
+	defaultPolicyCacheTTL  = 5 * time.Minute
+	defaultPolicyCacheSize = 4096
+)
+
+// PolicyDecision is the answer of a ContentPolicy about a root CID.
+type PolicyDecision struct {
+	// Action is either PolicyAllow or PolicyDeny.
+	Action string
+	// Tags are returned to the client in the X-Ipfs-Policy-Tags header.
+	Tags []string `json:",omitempty"`
+	// Reason is returned to the client when the content is denied.
+	Reason string `json:",omitempty"`
+	// Status is the HTTP status code used when the content is denied.
+	// Defaults to 451 Unavailable For Legal Reasons.
+	Status int `json:",omitempty"`
+}
+
+// ContentPolicy decides whether the gateway may serve the DAG under a root
+// CID.
+type ContentPolicy interface {
+	Check(ctx context.Context, root cid.Cid) (PolicyDecision, error)
+}
+
+type policyCacheEntry struct {
+	decision PolicyDecision
+	expires  time.Time
+}
+
+// httpContentPolicy asks an HTTP endpoint about root CIDs and caches the
+// answers.
+type httpContentPolicy struct {
+	url    string
+	client *http.Client
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]policyCacheEntry
+}
+
+// NewHTTPContentPolicy returns a ContentPolicy consulting the endpoint at u.
+//
+// For each root CID, the endpoint receives a GET request with the CID (as
+// CIDv1) in the "cid" query parameter, and must answer with a JSON encoded
+// PolicyDecision. Decisions are cached for ttl.
+func NewHTTPContentPolicy(u string, timeout, ttl time.Duration) (ContentPolicy, error) {
+	if _, err := url.Parse(u); err != nil {
+		return nil, fmt.Errorf("invalid content policy URL: %w", err)
+	}
+	return &httpContentPolicy{
+		url:    u,
+		client: &http.Client{Timeout: timeout},
+		ttl:    ttl,
+		cache:  make(map[string]policyCacheEntry),
+	}, nil
+}
+
+func (p *httpContentPolicy) Check(ctx context.Context, root cid.Cid) (PolicyDecision, error) {
+	// cache and ask by CIDv1 so that both versions get the same answer
+	key := cid.NewCidV1(root.Type(), root.Hash()).String()
+
+	p.mu.Lock()
+	e, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.decision, nil
+	}
+
+	d, err := p.fetch(ctx, key)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.cache) >= defaultPolicyCacheSize {
+		p.evict()
+	}
+	p.cache[key] = policyCacheEntry{decision: d, expires: time.Now().Add(p.ttl)}
+	return d, nil
+}
+
+func (p *httpContentPolicy) fetch(ctx context.Context, key string) (PolicyDecision, error) {
+	var d PolicyDecision
+
+	sep := "?"
+	if strings.Contains(p.url, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+sep+"cid="+url.QueryEscape(key), nil)
+	if err != nil {
+		return d, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return d, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return d, fmt.Errorf("content policy endpoint returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return d, fmt.Errorf("decoding content policy decision: %w", err)
+	}
+	if d.Action != PolicyAllow && d.Action != PolicyDeny {
+		return d, fmt.Errorf("unknown content policy action %q", d.Action)
+	}
+	return d, nil
+}
+
+// evict makes room in the cache by dropping expired decisions, or an
+// arbitrary one if none expired. It must be called with p.mu held.
+func (p *httpContentPolicy) evict() {
+	now := time.Now()
+	for k, e := range p.cache {
+		if now.After(e.expires) {
+			delete(p.cache, k)
+		}
+	}
+	for k := range p.cache {
+		if len(p.cache) < defaultPolicyCacheSize {
+			break
+		}
+		delete(p.cache, k)
+	}
+}
+
+// purge empties the cache.
+func (p *httpContentPolicy) purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cache = make(map[string]policyCacheEntry)
+}
+
+// checkContentPolicy asks the content policy, if any, whether the root CID of
+// contentPath may be served. When it returns false, a response has already
+// been written.
+func (i *gatewayHandler) checkContentPolicy(w http.ResponseWriter, r *http.Request, contentPath ipath.Path) bool {
+	if i.config.ContentPolicy == nil {
+		return true
+	}
+
+	root, err := resolveRootCid(r.Context(), i.api, contentPath)
+	if err != nil {
+		webError(w, "ipfs resolve -r "+debugStr(contentPath.String()), err, http.StatusNotFound)
+		return false
+	}
+
+	d, err := i.config.ContentPolicy.Check(r.Context(), root)
+	if err != nil {
+		if i.config.ContentPolicyFailOpen {
+			log.Warnf("content policy check of %s failed, serving it anyway: %s", root, err)
+			return true
+		}
+		webError(w, "content policy check of "+root.String(), err, http.StatusServiceUnavailable)
+		return false
+	}
+
+	if len(d.Tags) > 0 {
+		w.Header().Set(policyTagsHeader, strings.Join(d.Tags, ","))
+	}
+	if d.Action != PolicyDeny {
+		return true
+	}
+
+	status := d.Status
+	if status < 400 || status > 599 {
+		status = http.StatusUnavailableForLegalReasons
+	}
+	reason := d.Reason
+	if reason == "" {
+		reason = "denied by content policy"
+	}
+	http.Error(w, reason, status)
+	return false
+}
+
+// resolveRootCid returns the CID of the first segment of contentPath,
+// resolved with api.
+func resolveRootCid(ctx context.Context, api iface.CoreAPI, contentPath ipath.Path) (cid.Cid, error) {
+	segments := strings.SplitN(strings.TrimPrefix(contentPath.String(), "/"), "/", 3)
+	if len(segments) < 2 {
+		return cid.Undef, fmt.Errorf("invalid path %q", contentPath)
+	}
+	if segments[0] == "ipfs" {
+		return cid.Decode(segments[1])
+	}
+
+	root, err := api.ResolvePath(ctx, ipath.New("/"+segments[0]+"/"+segments[1]))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return root.Cid(), nil
+}
@@ -0,0 +1,262 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/namechain"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultProbeInterval = time.Minute
+	defaultProbeTimeout  = 30 * time.Second
+)
+
+// HealthProbePath is the path of the gateway serving the result of the last
+// health probe.
+const HealthProbePath = "/health/fetch"
+
+// HealthProbeStatus is the result of the last health probe.
+type HealthProbeStatus struct {
+	// Path is the content path fetched by the probe
+	Path    string
+	Healthy bool
+	// Time is when the probe ended, zero until the first one did
+	Time time.Time `json:",omitempty"`
+	// Duration is the time the probe took, in seconds
+	Duration float64 `json:",omitempty"`
+	Bytes    int64   `json:",omitempty"`
+	Error    string  `json:",omitempty"`
+}
+
+// healthProbe periodically fetches a content path through a gateway handler
+// whose blockstore starts empty, so that every probe fetches the content from
+// the network, as a request for content the node does not have.
+type healthProbe struct {
+	path     string
+	interval time.Duration
+	timeout  time.Duration
+	// handler returns the gateway handler of a probe
+	handler func() http.Handler
+
+	mu     sync.Mutex
+	status HealthProbeStatus
+
+	duration prometheus.Histogram
+	probes   *prometheus.CounterVec
+	healthy  prometheus.Gauge
+}
+
+func newHealthProbe(path string, interval, timeout time.Duration, handler func() http.Handler) *healthProbe {
+	return &healthProbe{
+		path:     path,
+		interval: interval,
+		timeout:  timeout,
+		handler:  handler,
+		status:   HealthProbeStatus{Path: path},
+		duration: registerGatewayCollector("gw_probe_duration_seconds", prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_probe_duration_seconds",
+				Help:      "The time of the successful health probes fetching content from the network through the gateway.",
+				Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60},
+			},
+		)).(prometheus.Histogram),
+		probes: registerGatewayCollector("gw_probes_total", prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_probes_total",
+				Help:      "The number of health probes fetching content from the network through the gateway, by result.",
+			},
+			[]string{"result"},
+		)).(*prometheus.CounterVec),
+		healthy: registerGatewayCollector("gw_probe_healthy", prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_probe_healthy",
+				Help:      "Whether the last health probe fetched its content from the network through the gateway.",
+			},
+		)).(prometheus.Gauge),
+	}
+}
+
+// run probes every interval until ctx is done.
+func (p *healthProbe) run(ctx context.Context) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		p.probe(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// probe fetches the path once, and records the result.
+func (p *healthProbe) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.path, nil)
+	if err != nil {
+		p.record(HealthProbeStatus{Error: err.Error()})
+		return
+	}
+
+	begin := time.Now()
+	w := &probeResponseWriter{header: make(http.Header)}
+	p.handler().ServeHTTP(w, req)
+	end := time.Now()
+
+	st := HealthProbeStatus{
+		Time:     end,
+		Duration: end.Sub(begin).Seconds(),
+		Bytes:    w.bytes,
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		st.Error = fmt.Sprintf("timed out after %s", p.timeout)
+	case ctx.Err() != nil:
+		// the node is stopping
+		return
+	case w.code != http.StatusOK:
+		st.Error = fmt.Sprintf("status %d: %s", w.code, strings.TrimSpace(w.body.String()))
+	default:
+		st.Healthy = true
+	}
+	p.record(st)
+}
+
+func (p *healthProbe) record(st HealthProbeStatus) {
+	st.Path = p.path
+	if st.Healthy {
+		p.duration.Observe(st.Duration)
+		p.probes.WithLabelValues("success").Inc()
+		p.healthy.Set(1)
+	} else {
+		log.Warnf("health probe of %s failed: %s", p.path, st.Error)
+		p.probes.WithLabelValues("failure").Inc()
+		p.healthy.Set(0)
+	}
+	p.mu.Lock()
+	p.status = st
+	p.mu.Unlock()
+}
+
+// Status returns the result of the last probe.
+func (p *healthProbe) Status() HealthProbeStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// ServeHTTP serves the result of the last probe, with a 503 status unless it
+// succeeded.
+func (p *healthProbe) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st := p.Status()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !st.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(&st); err != nil {
+		log.Debugf("cannot send the health probe status: %s", err)
+	}
+}
+
+// probeResponseWriter discards the body of the response, but for the start
+// of an error message.
+type probeResponseWriter struct {
+	header http.Header
+	code   int
+	bytes  int64
+	body   strings.Builder
+}
+
+func (w *probeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *probeResponseWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *probeResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	n := len(b)
+	w.bytes += int64(n)
+	if rest := 512 - w.body.Len(); w.code != http.StatusOK && rest > 0 {
+		if len(b) > rest {
+			b = b[:rest]
+		}
+		w.body.Write(b)
+	}
+	return n, nil
+}
+
+// HealthProbeOption periodically fetches Gateway.HealthProbe.Path from the
+// network through the gateway, when set, and serves the result of the last
+// probe on HealthProbePath.
+func HealthProbeOption() ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		pcfg := cfg.Gateway.HealthProbe
+		if pcfg.Path == "" {
+			return mux, nil
+		}
+		if !strings.HasPrefix(pcfg.Path, "/ipfs/") && !strings.HasPrefix(pcfg.Path, "/ipns/") {
+			return nil, fmt.Errorf("Gateway.HealthProbe.Path must be an /ipfs or /ipns path: %q", pcfg.Path)
+		}
+		interval := pcfg.Interval.WithDefault(defaultProbeInterval)
+		timeout := pcfg.Timeout.WithDefault(defaultProbeTimeout)
+		if interval <= 0 || timeout <= 0 {
+			return nil, fmt.Errorf("Gateway.HealthProbe.Interval and Gateway.HealthProbe.Timeout must be positive")
+		}
+
+		api, err := coreapi.NewCoreAPI(n)
+		if err != nil {
+			return nil, err
+		}
+		gcfg := GatewayConfig{
+			Headers: map[string][]string{},
+			NameResolution: namechain.Settings{
+				MaxDepth:    int(cfg.Gateway.NameResolution.MaxDepth.WithDefault(nsopts.DefaultDepthLimit)),
+				StepTimeout: cfg.Gateway.NameResolution.StepTimeout.WithDefault(0),
+			},
+		}
+		handler := func() http.Handler {
+			bs := blockstore.NewGCBlockstore(
+				blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())),
+				blockstore.NewGCLocker(),
+			)
+			return newGatewayHandler(gcfg, api.(*coreapi.CoreAPI).WithBlockstore(bs))
+		}
+
+		p := newHealthProbe(pcfg.Path, interval, timeout, handler)
+		go p.run(n.Context())
+		mux.Handle(HealthProbePath, p)
+		return mux, nil
+	}
+}
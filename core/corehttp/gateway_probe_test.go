@@ -0,0 +1,81 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHealthProbe(t *testing.T) {
+	var serve http.HandlerFunc
+	p := newHealthProbe("/ipfs/probe", time.Minute, 50*time.Millisecond, func() http.Handler {
+		return serve
+	})
+
+	status := func() (int, HealthProbeStatus) {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, HealthProbePath, nil))
+		var st HealthProbeStatus
+		if err := json.NewDecoder(rec.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, st
+	}
+	if code, st := status(); code != http.StatusServiceUnavailable || st.Path != "/ipfs/probe" || !st.Time.IsZero() {
+		t.Fatalf("expected unhealthy before the first probe, got %d %+v", code, st)
+	}
+
+	successes := testutil.ToFloat64(p.probes.WithLabelValues("success"))
+	serve = func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ipfs/probe" {
+			t.Errorf("probed %s", r.URL.Path)
+		}
+		_, _ = w.Write([]byte("probe content"))
+	}
+	p.probe(context.Background())
+	if code, st := status(); code != http.StatusOK || !st.Healthy || st.Bytes != 13 || st.Time.IsZero() {
+		t.Fatalf("expected healthy, got %d %+v", code, st)
+	}
+	if testutil.ToFloat64(p.probes.WithLabelValues("success")) != successes+1 || testutil.ToFloat64(p.healthy) != 1 {
+		t.Fatal("success not recorded")
+	}
+
+	for _, tc := range []struct {
+		serve http.HandlerFunc
+		err   string
+	}{
+		{func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "failed to resolve /ipfs/probe: not found", http.StatusNotFound)
+		}, "status 404: failed to resolve /ipfs/probe: not found"},
+		{func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		}, "timed out after 50ms"},
+		{func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, strings.Repeat("x", 1000), http.StatusInternalServerError)
+		}, "status 500: " + strings.Repeat("x", 512)},
+	} {
+		serve = tc.serve
+		p.probe(context.Background())
+		if code, st := status(); code != http.StatusServiceUnavailable || st.Healthy || st.Error != tc.err {
+			t.Fatalf("expected unhealthy with %q, got %d %+v", tc.err, code, st)
+		}
+		if testutil.ToFloat64(p.healthy) != 0 {
+			t.Fatal("failure not recorded")
+		}
+	}
+
+	// a probe interrupted by the node stopping is not recorded
+	serve = func(w http.ResponseWriter, r *http.Request) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.probe(ctx)
+	if _, st := status(); !strings.HasPrefix(st.Error, "status 500") {
+		t.Fatalf("expected the last probe kept, got %+v", st)
+	}
+}
@@ -0,0 +1,374 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	config "github.com/ipfs/go-ipfs/config"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultRateLimitIPv4PrefixLength = 32
+	defaultRateLimitIPv6PrefixLength = 64
+
+	// past this long without requests, the state of a client is dropped
+	rateLimitIdleTimeout = time.Minute
+)
+
+const (
+	rateLimitReasonRate        = "rate"
+	rateLimitReasonConcurrency = "concurrency"
+)
+
+// rateLimiter limits the requests and the bandwidth of each client of the
+// gateway, the clients being the subnets of the remote addresses, or the
+// tokens of the access control.
+type rateLimiter struct {
+	requestsPerSecond  float64
+	maxConcurrent      int
+	maxQueued          int
+	tokenMaxConcurrent int
+	bytesPerSecond     float64
+	ipv4Mask           net.IPMask
+	ipv6Mask           net.IPMask
+	access             *gatewayAccess
+
+	mu        sync.Mutex
+	clients   map[string]*rateLimitClient
+	lastSweep time.Time
+
+	rejected *prometheus.CounterVec
+	queued   prometheus.Gauge
+}
+
+// rateLimitClient is the state of the requests of a client.
+type rateLimitClient struct {
+	requests      *tokenBucket
+	bytes         *tokenBucket
+	maxConcurrent int
+	inFlight      int
+	// queue is the requests waiting to be served, first come first served,
+	// each once its channel is closed
+	queue []chan struct{}
+	last  time.Time
+}
+
+// newRateLimiter returns the rate limiter of cfg, or nil if cfg sets no limit.
+// The clients carrying a token of access, if not nil, are told apart by
+// token.
+func newRateLimiter(cfg config.GatewayRateLimit, access *gatewayAccess) (*rateLimiter, error) {
+	bytesPerSecond, err := humanize.ParseBytes(cfg.BytesPerSecond.WithDefault("0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Gateway.RateLimit.BytesPerSecond: %s", err)
+	}
+	ipv4Prefix := cfg.IPv4PrefixLength.WithDefault(defaultRateLimitIPv4PrefixLength)
+	if ipv4Prefix < 0 || ipv4Prefix > 32 {
+		return nil, fmt.Errorf("invalid Gateway.RateLimit.IPv4PrefixLength: %d", ipv4Prefix)
+	}
+	ipv6Prefix := cfg.IPv6PrefixLength.WithDefault(defaultRateLimitIPv6PrefixLength)
+	if ipv6Prefix < 0 || ipv6Prefix > 128 {
+		return nil, fmt.Errorf("invalid Gateway.RateLimit.IPv6PrefixLength: %d", ipv6Prefix)
+	}
+
+	maxConcurrent := cfg.MaxConcurrentRequests.WithDefault(0)
+	tokenMaxConcurrent := cfg.TokenMaxConcurrentRequests.WithDefault(maxConcurrent)
+	if !cfg.TokenMaxConcurrentRequests.IsDefault() && (access == nil || len(access.tokens) == 0) {
+		return nil, fmt.Errorf("Gateway.RateLimit.TokenMaxConcurrentRequests needs Gateway.AccessControl.Tokens")
+	}
+
+	l := &rateLimiter{
+		requestsPerSecond:  float64(cfg.RequestsPerSecond.WithDefault(0)),
+		maxConcurrent:      int(maxConcurrent),
+		maxQueued:          int(cfg.MaxQueuedRequests.WithDefault(0)),
+		tokenMaxConcurrent: int(tokenMaxConcurrent),
+		bytesPerSecond:     float64(bytesPerSecond),
+		ipv4Mask:           net.CIDRMask(int(ipv4Prefix), 32),
+		ipv6Mask:           net.CIDRMask(int(ipv6Prefix), 128),
+		access:             access,
+		clients:            make(map[string]*rateLimitClient),
+	}
+	if l.requestsPerSecond <= 0 && l.maxConcurrent <= 0 && l.tokenMaxConcurrent <= 0 && l.bytesPerSecond <= 0 {
+		return nil, nil
+	}
+
+	l.rejected = registerGatewayCollector("gw_ratelimit_rejected_requests_total", prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_ratelimit_rejected_requests_total",
+			Help:      "The number of gateway requests rejected by the rate limits of their client, by limit exceeded.",
+		},
+		[]string{"reason"},
+	)).(*prometheus.CounterVec)
+	l.queued = registerGatewayCollector("gw_ratelimit_queued_requests", prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_ratelimit_queued_requests",
+			Help:      "The number of gateway requests waiting for the concurrency limit of their client.",
+		},
+	)).(prometheus.Gauge)
+	return l, nil
+}
+
+// client returns the key of the client of r, and its concurrency limit: a
+// token of the access control is a client of its own.
+func (l *rateLimiter) client(r *http.Request) (string, int) {
+	if l.access != nil && len(l.access.tokens) > 0 {
+		if i := l.access.token(r); i >= 0 {
+			return "token/" + strconv.Itoa(i), l.tokenMaxConcurrent
+		}
+	}
+	return l.clientKey(r.RemoteAddr), l.maxConcurrent
+}
+
+// clientKey returns the subnet of the remote address of a request.
+func (l *rateLimiter) clientKey(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	mask := l.ipv6Mask
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, l.ipv4Mask
+	}
+	ones, _ := mask.Size()
+	return ip.Mask(mask).String() + "/" + strconv.Itoa(ones)
+}
+
+// start counts a request of the client of key, limited to maxConcurrent
+// requests at once. It returns the client, with the channel closed once the
+// request may be served if it is queued, or the limit exceeded and the
+// seconds after which to retry.
+func (l *rateLimiter) start(key string, maxConcurrent int, now time.Time) (*rateLimitClient, chan struct{}, string, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitIdleTimeout {
+		for k, c := range l.clients {
+			if c.inFlight == 0 && now.Sub(c.last) > rateLimitIdleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	c, ok := l.clients[key]
+	if !ok {
+		c = &rateLimitClient{
+			requests:      newTokenBucket(l.requestsPerSecond, now),
+			bytes:         newTokenBucket(l.bytesPerSecond, now),
+			maxConcurrent: maxConcurrent,
+		}
+		l.clients[key] = c
+	}
+	c.last = now
+
+	full := c.maxConcurrent > 0 && c.inFlight >= c.maxConcurrent
+	if full && len(c.queue) >= l.maxQueued {
+		return nil, nil, rateLimitReasonConcurrency, 1
+	}
+	if wait := c.requests.tryTake(now, 1); wait > 0 {
+		return nil, nil, rateLimitReasonRate, int(math.Ceil(wait.Seconds()))
+	}
+	if full {
+		wait := make(chan struct{})
+		c.queue = append(c.queue, wait)
+		l.queued.Inc()
+		return c, wait, "", 0
+	}
+	c.inFlight++
+	return c, nil, "", 0
+}
+
+// done counts the end of a request of c, whose place goes to the first
+// request queued.
+func (l *rateLimiter) done(c *rateLimitClient) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(c.queue) > 0 {
+		close(c.queue[0])
+		c.queue = c.queue[1:]
+		l.queued.Dec()
+	} else {
+		c.inFlight--
+	}
+	c.last = time.Now()
+}
+
+// abandon removes the request of c waiting for wait from the queue, or ends
+// it if it was let in meanwhile.
+func (l *rateLimiter) abandon(c *rateLimitClient, wait chan struct{}) {
+	l.mu.Lock()
+	for i, w := range c.queue {
+		if w == wait {
+			c.queue = append(c.queue[:i], c.queue[i+1:]...)
+			l.queued.Dec()
+			l.mu.Unlock()
+			return
+		}
+	}
+	l.mu.Unlock()
+	l.done(c)
+}
+
+// waitBytes waits until n more bytes sent to c are within its bandwidth.
+func (l *rateLimiter) waitBytes(ctx context.Context, c *rateLimitClient, n int) error {
+	l.mu.Lock()
+	delay := c.bytes.take(time.Now(), float64(n))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withRateLimit answers 429 Too Many Requests to the requests over the limits
+// of their client, queues those over its concurrency if it has room, and slows
+// the responses down to its bandwidth.
+func withRateLimit(next http.Handler, l *rateLimiter) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, maxConcurrent := l.client(r)
+		c, wait, reason, retry := l.start(key, maxConcurrent, time.Now())
+		if c == nil {
+			l.rejected.WithLabelValues(reason).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			http.Error(w, "429 - Too Many Requests: over the "+reason+" limit of the client", http.StatusTooManyRequests)
+			return
+		}
+		if wait != nil {
+			select {
+			case <-wait:
+			case <-r.Context().Done():
+				l.abandon(c, wait)
+				return
+			}
+		}
+		defer l.done(c)
+
+		if l.bytesPerSecond > 0 {
+			w = &rateLimitedWriter{ResponseWriter: w, ctx: r.Context(), limiter: l, client: c}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitedWriter writes a response within the bandwidth of its client.
+type rateLimitedWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	limiter *rateLimiter
+	client  *rateLimitClient
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	// the writes are split in chunks of a fraction of a second, so that the
+	// concurrent responses of the client share its bandwidth
+	chunk := int(w.limiter.bytesPerSecond / 10)
+	if chunk < 1024 {
+		chunk = 1024
+	}
+	var written int
+	for len(p) > 0 {
+		n := len(p)
+		if n > chunk {
+			n = chunk
+		}
+		if err := w.limiter.waitBytes(w.ctx, w.client, n); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *rateLimitedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// tokenBucket is a token bucket holding up to a second of its rate. Its
+// tokens go negative when more is taken than it holds. The nil bucket is
+// unlimited.
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, tokens: rate, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+// take takes n tokens, and returns how long to wait for the bucket to be out
+// of debt.
+func (b *tokenBucket) take(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// tryTake takes n tokens if the bucket holds them, or returns how long to
+// wait for it to.
+func (b *tokenBucket) tryTake(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens < n {
+		return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return 0
+}
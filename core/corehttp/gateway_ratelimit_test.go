@@ -0,0 +1,220 @@
+package corehttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func rateLimitConfig(t *testing.T, s string) config.GatewayRateLimit {
+	var cfg config.GatewayRateLimit
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	l, err := newRateLimiter(rateLimitConfig(t, `{"RequestsPerSecond": 1, "IPv4PrefixLength": 24}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, key := range map[string]string{
+		"192.0.2.10:1234":             "192.0.2.0/24",
+		"[::ffff:192.0.2.99]:1234":    "192.0.2.0/24",
+		"198.51.100.1:80":             "198.51.100.0/24",
+		"[2001:db8:1:2:3:4:5:6]:1234": "2001:db8:1:2::/64",
+		"[2001:db8:1:3::1]:443":       "2001:db8:1:3::/64",
+		"not-an-ip":                   "not-an-ip",
+	} {
+		if k := l.clientKey(addr); k != key {
+			t.Errorf("%s: expected client %s, got %s", addr, key, k)
+		}
+	}
+
+	if l, err := newRateLimiter(config.GatewayRateLimit{}, nil); l != nil || err != nil {
+		t.Errorf("expected no limiter without limits, got %v, %v", l, err)
+	}
+	if _, err := newRateLimiter(rateLimitConfig(t, `{"BytesPerSecond": "lots"}`), nil); err == nil {
+		t.Error("expected an invalid BytesPerSecond to fail")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l, err := newRateLimiter(rateLimitConfig(t, `{"RequestsPerSecond": 2, "MaxConcurrentRequests": 1}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	handler := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ipfs/hold" {
+			<-release
+		}
+	}), l)
+	get := func(path, addr string) int {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	rejected := func(reason string) float64 {
+		return testutil.ToFloat64(l.rejected.WithLabelValues(reason))
+	}
+
+	concurrency := rejected(rateLimitReasonConcurrency)
+	done := make(chan int)
+	go func() { done <- get("/ipfs/hold", "192.0.2.1:1") }()
+	for {
+		l.mu.Lock()
+		c := l.clients["192.0.2.1/32"]
+		held := c != nil && c.inFlight == 1
+		l.mu.Unlock()
+		if held {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if code := get("/ipfs/a", "192.0.2.1:2"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the concurrent request to be rejected, got %d", code)
+	}
+	if rejected(rateLimitReasonConcurrency) != concurrency+1 {
+		t.Error("expected the concurrency rejection to be counted")
+	}
+	if code := get("/ipfs/a", "192.0.2.2:1"); code != http.StatusOK {
+		t.Errorf("expected another client to be served, got %d", code)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("expected the held request to be served, got %d", code)
+	}
+
+	// the held request took one of the 2 requests of the second
+	rate := rejected(rateLimitReasonRate)
+	if code := get("/ipfs/a", "192.0.2.1:3"); code != http.StatusOK {
+		t.Errorf("expected the second request to be served, got %d", code)
+	}
+	if code := get("/ipfs/a", "192.0.2.1:4"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the third request to be rejected, got %d", code)
+	}
+	if rejected(rateLimitReasonRate) != rate+1 {
+		t.Error("expected the rate rejection to be counted")
+	}
+}
+
+func TestRateLimitBandwidth(t *testing.T) {
+	l, err := newRateLimiter(rateLimitConfig(t, `{"BytesPerSecond": "10KB"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 12000))
+	}), l)
+
+	// the first second of bandwidth is sent at once, the rest after
+	begin := time.Now()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ipfs/a", nil))
+	if w.Body.Len() != 12000 {
+		t.Fatalf("expected the whole response, got %d bytes", w.Body.Len())
+	}
+	if d := time.Since(begin); d < 150*time.Millisecond {
+		t.Errorf("expected the response to be slowed down, took %s", d)
+	}
+}
+
+func TestRateLimitQueue(t *testing.T) {
+	access, err := newGatewayAccess(config.GatewayAccessControl{Tokens: []string{"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := newRateLimiter(rateLimitConfig(t, `{"MaxConcurrentRequests": 1, "MaxQueuedRequests": 1, "TokenMaxConcurrentRequests": 2}`), access)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := make(chan struct{})
+	handler := withRateLimit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ipfs/hold" {
+			<-release
+		}
+	}), l)
+	start := func(ctx context.Context, path, addr, token string) chan int {
+		done := make(chan int, 1)
+		go func() {
+			r := httptest.NewRequest(http.MethodGet, path, nil).WithContext(ctx)
+			r.RemoteAddr = addr
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			done <- w.Code
+		}()
+		return done
+	}
+	waitFor := func(key string, inFlight, queued int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			l.mu.Lock()
+			c := l.clients[key]
+			ok := c != nil && c.inFlight == inFlight && len(c.queue) == queued
+			l.mu.Unlock()
+			if ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s to have %d requests served and %d queued", key, inFlight, queued)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	ctx := context.Background()
+
+	held := start(ctx, "/ipfs/hold", "192.0.2.1:1", "")
+	waitFor("192.0.2.1/32", 1, 0)
+	queued := start(ctx, "/ipfs/a", "192.0.2.1:2", "")
+	waitFor("192.0.2.1/32", 1, 1)
+	if code := <-start(ctx, "/ipfs/a", "192.0.2.1:3", ""); code != http.StatusTooManyRequests {
+		t.Errorf("expected the request over the queue to be rejected, got %d", code)
+	}
+
+	// the token is a client of its own, with its own limit
+	heldToken := start(ctx, "/ipfs/hold", "192.0.2.1:4", "secret")
+	waitFor("token/0", 1, 0)
+	if code := <-start(ctx, "/ipfs/a", "198.51.100.1:1", "secret"); code != http.StatusOK {
+		t.Errorf("expected the second request of the token to be served, got %d", code)
+	}
+
+	// a request giving up leaves the queue
+	close(release)
+	for _, done := range []chan int{held, queued, heldToken} {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("expected the request to be served, got %d", code)
+		}
+	}
+	release = make(chan struct{})
+	held = start(ctx, "/ipfs/hold", "192.0.2.1:5", "")
+	waitFor("192.0.2.1/32", 1, 0)
+	cctx, cancel := context.WithCancel(ctx)
+	abandoned := start(cctx, "/ipfs/a", "192.0.2.1:6", "")
+	waitFor("192.0.2.1/32", 1, 1)
+	cancel()
+	<-abandoned
+	waitFor("192.0.2.1/32", 1, 0)
+	close(release)
+	<-held
+	waitFor("192.0.2.1/32", 0, 0)
+
+	if _, err := newRateLimiter(rateLimitConfig(t, `{"TokenMaxConcurrentRequests": 2}`), nil); err == nil {
+		t.Error("expected TokenMaxConcurrentRequests without tokens to fail")
+	}
+}
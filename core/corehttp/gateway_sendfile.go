@@ -0,0 +1,147 @@
+package corehttp
+
+import (
+	"io"
+	"os"
+
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// blockFiles returns the function returning the file a block of r is stored
+// in as is, or nil if the blocks of r are not stored in files, or are hashed
+// when read, which sending them from their files would skip.
+func blockFiles(r repo.Repo, cfg *config.Config) func(cid.Cid) (string, bool) {
+	bf, ok := r.(repo.BlockFiler)
+	if !ok || cfg.Datastore.HashOnRead {
+		return nil
+	}
+	return func(c cid.Cid) (string, bool) {
+		return bf.BlockFile(blockstore.BlockPrefix.Child(dshelp.MultihashToDsKey(c.Hash())))
+	}
+}
+
+// copyContent copies src to dst, as io.Copy does. The UnixFS files copied by
+// http.ServeContent are sent with sendTo, which sends their leaves stored in
+// files from the disk.
+func copyContent(dst io.Writer, src io.Reader) (int64, error) {
+	if lr, ok := src.(*io.LimitedReader); ok {
+		if fr, ok := lr.R.(*unixfsFileReader); ok && fr.files != nil {
+			n, err := fr.sendTo(dst, lr.N)
+			lr.N -= n
+			return n, err
+		}
+	}
+	return io.Copy(dst, src)
+}
+
+// sendTo writes up to n bytes of the file, from the offset, to w. The raw
+// leaves stored as is in files are copied from their file to w without being
+// read, which net/http does with sendfile when w passes io.ReaderFrom on to
+// the connection. Past the first leaf which is not, the leaves are read.
+func (fr *unixfsFileReader) sendTo(w io.Writer, n int64) (int64, error) {
+	var sent int64
+	for sent < n && fr.offset < fr.size {
+		var k int64
+		var err error
+		if fr.files != nil {
+			k, err = fr.sendLeafFile(w, n-sent)
+		}
+		if k == 0 && err == nil {
+			k, err = fr.sendLeaf(w, n-sent)
+		}
+		sent += k
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// sendLeaf writes up to max bytes of the leaf of the offset to w.
+func (fr *unixfsFileReader) sendLeaf(w io.Writer, max int64) (int64, error) {
+	if err := fr.loadLeaf(); err != nil {
+		return 0, err
+	}
+	data := fr.leaf[fr.offset-fr.leafStart:]
+	if int64(len(data)) > max {
+		data = data[:max]
+	}
+	n, err := w.Write(data)
+	fr.offset += int64(n)
+	return int64(n), err
+}
+
+// sendLeafFile copies up to max bytes of the raw leaf of the offset from its
+// file to w. It sends nothing if the leaf was read already, and stops sending
+// the leaves from files if it is not a raw leaf stored in a file.
+func (fr *unixfsFileReader) sendLeafFile(w io.Writer, max int64) (int64, error) {
+	if fr.leaf != nil && fr.offset >= fr.leafStart && fr.offset < fr.leafStart+int64(len(fr.leaf)) {
+		return 0, nil
+	}
+	switch {
+	case fr.parent != nil && fr.offset >= fr.leafStart && fr.offset < fr.leafStart+int64(fr.blockSizes[fr.index]):
+		// the child of the offset
+	case fr.parent != nil && fr.index+1 < len(fr.parent.Links()) && fr.offset == fr.leafStart+int64(fr.blockSizes[fr.index]):
+		// the next child of the same parent, sent in sequence
+		fr.index++
+		fr.leaf, fr.leafStart = nil, fr.offset
+	default:
+		if err := fr.seekLeaf(false); err != nil {
+			return 0, err
+		}
+	}
+	if fr.leaf != nil {
+		// the root, or a leaf which is not raw, read by seekLeaf
+		return 0, nil
+	}
+
+	size := int64(fr.blockSizes[fr.index])
+	f, ok := fr.openLeafFile(fr.parent.Links()[fr.index].Cid, size)
+	if !ok {
+		fr.files = nil
+		return 0, nil
+	}
+	defer f.Close()
+
+	skip := fr.offset - fr.leafStart
+	if _, err := f.Seek(skip, io.SeekStart); err != nil {
+		fr.files = nil
+		return 0, nil
+	}
+	n := size - skip
+	if n > max {
+		n = max
+	}
+	sent, err := io.Copy(w, &io.LimitedReader{R: f, N: n})
+	fr.offset += sent
+	if err == nil && sent < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return sent, err
+}
+
+// openLeafFile opens the file of the raw leaf c, of size bytes, false if it is
+// not stored in a file, such as the leaves fetched from the network or moved
+// to another datastore.
+func (fr *unixfsFileReader) openLeafFile(c cid.Cid, size int64) (*os.File, bool) {
+	if c.Type() != cid.Raw {
+		return nil, false
+	}
+	name, ok := fr.files(c)
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, false
+	}
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() || fi.Size() != size {
+		f.Close()
+		return nil, false
+	}
+	return f, true
+}
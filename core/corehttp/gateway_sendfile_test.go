@@ -0,0 +1,134 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	h "github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipfs/go-unixfs/importer/trickle"
+)
+
+// testBlockFiles returns the function writing the blocks of ds to files in
+// dir, counting them, with the blocks of missing not stored in files.
+func testBlockFiles(t *testing.T, ds ipld.DAGService, dir string, missing map[cid.Cid]bool, sent *int) func(cid.Cid) (string, bool) {
+	return func(c cid.Cid) (string, bool) {
+		if missing[c] {
+			return "", false
+		}
+		nd, err := ds.Get(context.Background(), c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := filepath.Join(dir, c.String())
+		if err := ioutil.WriteFile(name, nd.RawData(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		*sent++
+		return name, true
+	}
+}
+
+func TestUnixfsFileReaderSendsLeafFiles(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	layouts := map[string]func(*h.DagBuilderHelper) (ipld.Node, error){
+		"balanced": balanced.Layout,
+		"trickle":  trickle.Layout,
+	}
+	for name, layout := range layouts {
+		for _, rawLeaves := range []bool{false, true} {
+			ds, nd := buildTestFile(t, data, layout, rawLeaves)
+			fr, ok := newUnixfsFileReader(ctx, ds, nd, int64(len(data)))
+			if !ok {
+				t.Fatalf("%s: not a file", name)
+			}
+			var sent int
+			fr.files = testBlockFiles(t, ds, t.TempDir(), nil, &sent)
+
+			rnd := rand.New(rand.NewSource(2))
+			for i := 0; i < 50; i++ {
+				off := rnd.Intn(len(data))
+				n := rnd.Intn(len(data)-off) + 1
+				if i == 0 {
+					off, n = 0, len(data)
+				}
+				if _, err := fr.Seek(int64(off), io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				lr := &io.LimitedReader{R: fr, N: int64(n)}
+				if _, err := copyContent(&buf, lr); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(buf.Bytes(), data[off:off+n]) {
+					t.Fatalf("%s (raw leaves %t): wrong range [%d, %d) sent", name, rawLeaves, off, off+n)
+				}
+				if lr.N != 0 {
+					t.Fatalf("%s (raw leaves %t): %d bytes left to send", name, rawLeaves, lr.N)
+				}
+			}
+			if rawLeaves && sent == 0 {
+				t.Fatalf("%s: no leaf sent from its file", name)
+			}
+			if !rawLeaves && sent != 0 {
+				t.Fatalf("%s: %d leaves which are not raw sent from files", name, sent)
+			}
+		}
+	}
+}
+
+func TestUnixfsFileReaderSendsLeavesMissingFiles(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	ds, nd := buildTestFile(t, data, balanced.Layout, true)
+	fr, ok := newUnixfsFileReader(ctx, ds, nd, int64(len(data)))
+	if !ok {
+		t.Fatal("not a file")
+	}
+
+	// the leaf of the bytes [100, 110) is not stored in a file
+	missing := make(map[cid.Cid]bool)
+	fr.files = func(c cid.Cid) (string, bool) {
+		missing[c] = true
+		return "", false
+	}
+	if _, err := fr.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := copyContent(ioutil.Discard, &io.LimitedReader{R: fr, N: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 {
+		t.Fatalf("expected 1 leaf looked up, got %d", len(missing))
+	}
+
+	fr, _ = newUnixfsFileReader(ctx, ds, nd, int64(len(data)))
+	var sent int
+	fr.files = testBlockFiles(t, ds, t.TempDir(), missing, &sent)
+	var buf bytes.Buffer
+	if _, err := copyContent(&buf, &io.LimitedReader{R: fr, N: int64(len(data))}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("wrong file sent")
+	}
+	// the leaves after the missing one are read
+	if sent != 10 {
+		t.Fatalf("expected the 10 leaves before the missing one sent from their files, got %d", sent)
+	}
+	if fr.files != nil {
+		t.Fatal("expected the leaves not to be sent from files after a missing one")
+	}
+}
@@ -0,0 +1,149 @@
+package corehttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+const (
+	// how long the session of a root is kept after its last request ends
+	gatewaySessionTTL = time.Minute
+	// past this many roots, requests get a session of their own
+	maxGatewaySessions = 1024
+)
+
+type gatewaySessionKey struct{}
+
+// gatewaySessions shares an exchange session between the requests for content
+// under the same root, such as the assets of a website, so that they share
+// the providers found instead of each looking for them.
+//
+// It is the exchange of the gateway API: the blocks are fetched with the
+// session of the request, or with the exchange of the node outside requests.
+// The sessions of the block service fetch with it too, as the block service
+// only fetches the blocks of its sessions with a session exchange.
+type gatewaySessions struct {
+	exchange.Interface
+	sx  exchange.SessionExchange
+	ctx context.Context
+	ttl time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*gatewaySession
+}
+
+type gatewaySession struct {
+	fetcher exchange.Fetcher
+	cancel  context.CancelFunc
+	active  int
+	expiry  *time.Timer
+}
+
+func newGatewaySessions(ctx context.Context, exch exchange.SessionExchange) *gatewaySessions {
+	return &gatewaySessions{
+		Interface: exch,
+		sx:        exch,
+		ctx:       ctx,
+		ttl:       gatewaySessionTTL,
+		sessions:  make(map[string]*gatewaySession),
+	}
+}
+
+// sessionRoot returns the root of a gateway path, /ipfs/cid or /ipns/name, or
+// "" if there is none.
+func sessionRoot(p string) string {
+	segs := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 3)
+	if len(segs) < 2 || segs[1] == "" || (segs[0] != "ipfs" && segs[0] != "ipns") {
+		return ""
+	}
+	return "/" + segs[0] + "/" + segs[1]
+}
+
+// acquire returns the session of root, and the function to call once it is
+// not used anymore.
+func (s *gatewaySessions) acquire(root string) (exchange.Fetcher, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ses, ok := s.sessions[root]
+	if !ok {
+		ctx, cancel := context.WithCancel(s.ctx)
+		if len(s.sessions) >= maxGatewaySessions {
+			return s.sx.NewSession(ctx), cancel
+		}
+		ses = &gatewaySession{fetcher: s.sx.NewSession(ctx), cancel: cancel}
+		ses.expiry = time.AfterFunc(s.ttl, func() { s.expire(root, ses) })
+		s.sessions[root] = ses
+	}
+	ses.active++
+	ses.expiry.Stop()
+
+	return ses.fetcher, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ses.active--; ses.active == 0 {
+			ses.expiry.Reset(s.ttl)
+		}
+	}
+}
+
+// expire ends the session of root, unless it was used again meanwhile.
+func (s *gatewaySessions) expire(root string, ses *gatewaySession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ses.active > 0 || s.sessions[root] != ses {
+		return
+	}
+	delete(s.sessions, root)
+	ses.cancel()
+}
+
+// handler makes the GET and HEAD requests of next use the session of their
+// root.
+func (s *gatewaySessions) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		root := sessionRoot(r.URL.Path)
+		if root == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ses, release := s.acquire(root)
+		defer release()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), gatewaySessionKey{}, ses)))
+	})
+}
+
+func (s *gatewaySessions) fetcher(ctx context.Context) exchange.Fetcher {
+	if ses, ok := ctx.Value(gatewaySessionKey{}).(exchange.Fetcher); ok {
+		return ses
+	}
+	return s.Interface
+}
+
+// GetBlock fetches c with the session of the request of ctx, if any.
+func (s *gatewaySessions) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return s.fetcher(ctx).GetBlock(ctx, c)
+}
+
+// GetBlocks fetches cs with the session of the request of ctx, if any.
+func (s *gatewaySessions) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	return s.fetcher(ctx).GetBlocks(ctx, cs)
+}
+
+// NewSession returns the sessions themselves, so that the sessions of the
+// block service fetch with the session of their request too.
+func (s *gatewaySessions) NewSession(context.Context) exchange.Fetcher {
+	return s
+}
+
+// Close does nothing, the exchange is the node's.
+func (s *gatewaySessions) Close() error {
+	return nil
+}
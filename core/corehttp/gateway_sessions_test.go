@@ -0,0 +1,118 @@
+package corehttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+type mockSession struct {
+	ctx context.Context
+}
+
+func (s *mockSession) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return blocks.NewBlock([]byte("data")), nil
+}
+
+func (s *mockSession) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	return nil, nil
+}
+
+type mockSessionExchange struct {
+	exchange.Interface
+
+	mu       sync.Mutex
+	sessions []*mockSession
+}
+
+func (x *mockSessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	ses := &mockSession{ctx: ctx}
+	x.sessions = append(x.sessions, ses)
+	return ses
+}
+
+func TestGatewaySessions(t *testing.T) {
+	exch := &mockSessionExchange{}
+	sessions := newGatewaySessions(context.Background(), exch)
+	sessions.ttl = 50 * time.Millisecond
+
+	var used []exchange.Fetcher
+	h := sessions.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		used = append(used, sessions.fetcher(r.Context()))
+	}))
+	get := func(p string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, p, nil))
+	}
+
+	get("/ipfs/bafyroot/index.html")
+	get("/ipfs/bafyroot/style.css")
+	get("/ipfs/bafyother")
+	get("/version")
+	if len(exch.sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(exch.sessions))
+	}
+	if used[0] != used[1] || used[0] == used[2] {
+		t.Fatal("sessions not shared by root")
+	}
+	if used[3] != exchange.Fetcher(exch) {
+		t.Fatal("expected the exchange of the node outside of a root")
+	}
+
+	// unused sessions expire
+	ses := exch.sessions[0]
+	time.Sleep(200 * time.Millisecond)
+	if ses.ctx.Err() == nil {
+		t.Fatal("session did not expire")
+	}
+	get("/ipfs/bafyroot/index.html")
+	if len(exch.sessions) != 3 || used[4] == used[0] {
+		t.Fatal("expected a new session after expiry")
+	}
+}
+
+func TestSessionRoot(t *testing.T) {
+	for p, root := range map[string]string{
+		"/ipfs/cid":              "/ipfs/cid",
+		"/ipfs/cid/a/b":          "/ipfs/cid",
+		"/ipns/example.com/file": "/ipns/example.com",
+		"/ipfs/":                 "",
+		"/api/v0/cat":            "",
+	} {
+		if got := sessionRoot(p); got != root {
+			t.Errorf("root of %s: expected %q, got %q", p, root, got)
+		}
+	}
+}
+
+func TestGatewaySessionsBlockService(t *testing.T) {
+	exch := &mockSessionExchange{}
+	sessions := newGatewaySessions(context.Background(), exch)
+	bs := bserv.New(blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore())), sessions)
+	blk := blocks.NewBlock([]byte("data"))
+
+	// the sessions of the block service fetch with the session of the request
+	var err error
+	h := sessions.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err = bserv.NewSession(r.Context(), bs).GetBlock(r.Context(), blk.Cid())
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ipfs/bafyroot", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exch.sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(exch.sessions))
+	}
+}
@@ -0,0 +1,223 @@
+package corehttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultShadowSampleRate            = 0.01
+	defaultShadowTimeout               = 30 * time.Second
+	defaultShadowMaxConcurrentRequests = 16
+
+	shadowMatch          = "match"
+	shadowStatusMismatch = "status_mismatch"
+	shadowFailed         = "failed"
+	shadowDropped        = "dropped"
+
+	backendPrimary = "primary"
+	backendShadow  = "shadow"
+)
+
+// shadowStrippedHeaders are the headers not mirrored: the credentials of the
+// clients, and the hop-by-hop headers, which only concern the connection to
+// this gateway.
+var shadowStrippedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Proxy-Authorization",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// gatewayShadow mirrors a sample of the GET and HEAD requests to another
+// gateway once they are served, comparing the status and the latency of its
+// responses with those of the responses served, which it never changes. The
+// responses of the other gateway are read and discarded.
+type gatewayShadow struct {
+	base    string
+	rate    float64
+	timeout time.Duration
+	// slots bounds the mirrored requests in flight
+	slots  chan struct{}
+	client *http.Client
+
+	requests *prometheus.CounterVec
+	ttfb     *prometheus.HistogramVec
+	duration *prometheus.HistogramVec
+}
+
+func newGatewayShadow(cfg config.GatewayShadow) (*gatewayShadow, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Gateway.Shadow.URL: %q is not an HTTP URL", cfg.URL)
+	}
+	rate := cfg.SampleRate.WithDefault(defaultShadowSampleRate)
+	if rate < 0 || rate > 1 {
+		return nil, fmt.Errorf("invalid Gateway.Shadow.SampleRate: %v is not between 0 and 1", rate)
+	}
+	timeout := cfg.Timeout.WithDefault(defaultShadowTimeout)
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid Gateway.Shadow.Timeout: %s is not positive", timeout)
+	}
+	maxRequests := cfg.MaxConcurrentRequests.WithDefault(defaultShadowMaxConcurrentRequests)
+	if maxRequests <= 0 {
+		return nil, fmt.Errorf("invalid Gateway.Shadow.MaxConcurrentRequests: %d is not positive", maxRequests)
+	}
+
+	buckets := []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60}
+	histogram := func(name, help string) *prometheus.HistogramVec {
+		return registerGatewayCollector(name, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      name,
+				Help:      help,
+				Buckets:   buckets,
+			},
+			[]string{"backend"},
+		)).(*prometheus.HistogramVec)
+	}
+	return &gatewayShadow{
+		base:    strings.TrimSuffix(cfg.URL, "/"),
+		rate:    rate,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxRequests),
+		client: &http.Client{
+			// the redirects are compared, not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		requests: registerGatewayCollector("gw_shadow_requests_total", prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_shadow_requests_total",
+				Help:      "The number of gateway requests sampled for the shadow gateway, by result: match, status_mismatch, failed or dropped.",
+			},
+			[]string{"result"},
+		)).(*prometheus.CounterVec),
+		ttfb: histogram(
+			"gw_shadow_time_to_first_byte_seconds",
+			"The time to the first byte of the gateway requests mirrored to the shadow gateway, by backend: primary or shadow.",
+		),
+		duration: histogram(
+			"gw_shadow_response_duration_seconds",
+			"The time to the entire response of the gateway requests mirrored to the shadow gateway, by backend: primary or shadow.",
+		),
+	}, nil
+}
+
+// handler mirrors a sample of the requests served by next.
+func (s *gatewayShadow) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || rand.Float64() >= s.rate {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case s.slots <- struct{}{}:
+		default:
+			s.requests.WithLabelValues(shadowDropped).Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the request as received, before the hostname rewrites
+		method, uri, host, header := r.Method, r.RequestURI, r.Host, shadowHeader(r.Header)
+		if uri == "" {
+			uri = r.URL.RequestURI()
+		}
+
+		begin := time.Now()
+		sw := &sloResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		end := time.Now()
+		if sw.first.IsZero() {
+			// net/http sends the empty response once we return
+			sw.first = end
+			sw.code = http.StatusOK
+		}
+		s.ttfb.WithLabelValues(backendPrimary).Observe(sw.first.Sub(begin).Seconds())
+		s.duration.WithLabelValues(backendPrimary).Observe(end.Sub(begin).Seconds())
+
+		go func() {
+			defer func() { <-s.slots }()
+			s.mirror(method, uri, host, header, sw.code)
+		}()
+	})
+}
+
+// shadowHeader returns a copy of the header of a request to mirror, without
+// the credentials and the hop-by-hop headers.
+func shadowHeader(h http.Header) http.Header {
+	header := h.Clone()
+	// the headers named in Connection are hop-by-hop too
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range shadowStrippedHeaders {
+		header.Del(name)
+	}
+	return header
+}
+
+// mirror sends the request to the shadow gateway, and compares the status of
+// its response with the status served.
+func (s *gatewayShadow) mirror(method, uri, host string, header http.Header, served int) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, s.base+uri, nil)
+	if err != nil {
+		s.requests.WithLabelValues(shadowFailed).Inc()
+		log.Debugf("gateway shadow: %s %s: %s", method, uri, err)
+		return
+	}
+	req.Header = header
+	req.Host = host
+
+	begin := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		s.requests.WithLabelValues(shadowFailed).Inc()
+		log.Debugf("gateway shadow: %s %s: %s", method, uri, err)
+		return
+	}
+	s.ttfb.WithLabelValues(backendShadow).Observe(time.Since(begin).Seconds())
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		s.requests.WithLabelValues(shadowFailed).Inc()
+		log.Debugf("gateway shadow: %s %s: reading the response: %s", method, uri, err)
+		return
+	}
+	s.duration.WithLabelValues(backendShadow).Observe(time.Since(begin).Seconds())
+
+	if resp.StatusCode != served {
+		s.requests.WithLabelValues(shadowStatusMismatch).Inc()
+		log.Infof("gateway shadow: %s %s: %d served, %d from the shadow gateway", method, uri, served, resp.StatusCode)
+		return
+	}
+	s.requests.WithLabelValues(shadowMatch).Inc()
+}
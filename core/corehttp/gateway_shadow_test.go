@@ -0,0 +1,127 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func shadowConfig(t *testing.T, s string) config.GatewayShadow {
+	var cfg config.GatewayShadow
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestGatewayShadow(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		hosts   []string
+		headers []http.Header
+	)
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		headers = append(headers, r.Header)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/ipfs/missing":
+			http.NotFound(w, r)
+		case "/ipfs/slow":
+			<-release
+		}
+	}))
+	defer backend.Close()
+
+	shadow, err := newGatewayShadow(shadowConfig(t, `{"URL": "`+backend.URL+`", "SampleRate": 1, "MaxConcurrentRequests": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := 0
+	h := shadow.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.Write([]byte("served"))
+	}))
+
+	count := func(result string) float64 {
+		return testutil.ToFloat64(shadow.requests.WithLabelValues(result))
+	}
+	// waitFor waits for the mirrored request in flight to be done
+	waitFor := func(result string, n float64) {
+		t.Helper()
+		for start := time.Now(); count(result) < n; time.Sleep(10 * time.Millisecond) {
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("expected %v %s", n, result)
+			}
+		}
+	}
+	get := func(p string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, p, nil)
+		req.Host = "example.org"
+		req.Header.Set("Accept", "application/vnd.ipld.raw")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("Connection", "X-Hop")
+		req.Header.Set("X-Hop", "1")
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	match, mismatch, dropped := count(shadowMatch), count(shadowStatusMismatch), count(shadowDropped)
+	if rec := get("/ipfs/found"); rec.Code != http.StatusOK || rec.Body.String() != "served" {
+		t.Fatalf("expected the response served unchanged, got %d: %q", rec.Code, rec.Body)
+	}
+	waitFor(shadowMatch, match+1)
+
+	// the status of the shadow does not change the response served
+	if rec := get("/ipfs/missing"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the response served unchanged, got %d", rec.Code)
+	}
+	waitFor(shadowStatusMismatch, mismatch+1)
+
+	// the requests sampled while the shadow is busy are only served
+	get("/ipfs/slow")
+	get("/ipfs/found")
+	if served != 4 || count(shadowDropped) != dropped+1 {
+		t.Fatalf("expected 4 requests served and 1 dropped, got %d and %v", served, count(shadowDropped)-dropped)
+	}
+	close(release)
+	waitFor(shadowMatch, match+2)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, host := range hosts {
+		if host != "example.org" {
+			t.Errorf("expected the host of the requests mirrored, got %q", host)
+		}
+	}
+	for _, header := range headers {
+		if header.Get("Accept") != "application/vnd.ipld.raw" {
+			t.Errorf("expected the headers of the requests mirrored, got %v", header)
+		}
+		for _, name := range []string{"Authorization", "Cookie", "X-Hop"} {
+			if v := header.Get(name); v != "" {
+				t.Errorf("expected the %s header not mirrored, got %q", name, v)
+			}
+		}
+	}
+
+	for _, cfg := range []string{
+		`{"URL": "ftp://example.org"}`,
+		`{"URL": "` + backend.URL + `", "SampleRate": 2}`,
+		`{"URL": "` + backend.URL + `", "MaxConcurrentRequests": 0}`,
+	} {
+		if _, err := newGatewayShadow(shadowConfig(t, cfg)); err == nil {
+			t.Errorf("expected %s refused", cfg)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package corehttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+const (
+	// DefaultSignatureMaxBodySize is the size of the largest response body
+	// the gateway signs by default. Each response signed is buffered whole,
+	// which this keeps small.
+	DefaultSignatureMaxBodySize = 1 << 20
+
+	signatureLabel = "sig1"
+)
+
+// signedResponseHeaders are the response headers covered by the signature
+// when they are present, in addition to the status code.
+var signedResponseHeaders = []string{
+	"Content-Type",
+	"Content-Digest",
+	"Content-Range",
+	"Etag",
+	"Cache-Control",
+	"X-Ipfs-Path",
+	"X-Ipfs-Roots",
+	"X-Ipfs-Policy-Tags",
+}
+
+// signingHandler signs the responses of the wrapped handler with the node key
+// using HTTP Message Signatures (RFC 9421). The signature covers the status
+// code, the headers listed in signedResponseHeaders and, through the
+// Content-Digest header, the body.
+//
+// Bodies are buffered to compute their digest: responses with a body larger
+// than maxBodySize are sent unsigned, and so are the responses whose body
+// would grow the buffer while the node is under memory pressure.
+type signingHandler struct {
+	next        http.Handler
+	key         ic.PrivKey
+	keyID       string
+	alg         string
+	maxBodySize int
+	// underPressure reports whether the node is under memory pressure, if
+	// set
+	underPressure func() bool
+}
+
+func newSigningHandler(next http.Handler, key ic.PrivKey, maxBodySize int, underPressure func() bool) (*signingHandler, error) {
+	if key == nil {
+		return nil, fmt.Errorf("cannot sign gateway responses without a node key")
+	}
+
+	var alg string
+	switch key.Type() {
+	case pb.KeyType_Ed25519:
+		alg = "ed25519"
+	case pb.KeyType_RSA:
+		alg = "rsa-v1_5-sha256"
+	default:
+		return nil, fmt.Errorf("cannot sign gateway responses with a %s key", key.Type())
+	}
+
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &signingHandler{
+		next:          next,
+		key:           key,
+		keyID:         id.String(),
+		alg:           alg,
+		maxBodySize:   maxBodySize,
+		underPressure: underPressure,
+	}, nil
+}
+
+func (h *signingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sw := &signingResponseWriter{w: w, h: h, head: r.Method == http.MethodHead}
+	h.next.ServeHTTP(sw, r)
+	sw.finish()
+}
+
+// sign adds the Signature-Input and Signature headers to hdr.
+func (h *signingHandler) sign(hdr http.Header, status int) error {
+	components := []string{`"@status"`}
+	var base strings.Builder
+	fmt.Fprintf(&base, "\"@status\": %d\n", status)
+	for _, name := range signedResponseHeaders {
+		values, ok := hdr[name]
+		if !ok {
+			continue
+		}
+		lname := strings.ToLower(name)
+		components = append(components, strconv.Quote(lname))
+		fmt.Fprintf(&base, "%q: %s\n", lname, strings.Join(values, ", "))
+	}
+
+	params := fmt.Sprintf("(%s);created=%d;keyid=%q;alg=%q",
+		strings.Join(components, " "), time.Now().Unix(), h.keyID, h.alg)
+	fmt.Fprintf(&base, "\"@signature-params\": %s", params)
+
+	sig, err := h.key.Sign([]byte(base.String()))
+	if err != nil {
+		return err
+	}
+
+	hdr.Set("Signature-Input", signatureLabel+"="+params)
+	hdr.Set("Signature", signatureLabel+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// signingResponseWriter buffers a response until it is complete so it can be
+// signed, or until its body gets too large or the node comes under memory
+// pressure, after which it is passed through.
+// The responses flushed, such as the event streams, are passed through once
+// their headers are signed.
+type signingResponseWriter struct {
+	w    http.ResponseWriter
+	h    *signingHandler
+	head bool
+
+	status      int
+	buf         bytes.Buffer
+	passThrough bool
+}
+
+func (sw *signingResponseWriter) Header() http.Header {
+	return sw.w.Header()
+}
+
+func (sw *signingResponseWriter) WriteHeader(code int) {
+	if sw.status == 0 {
+		sw.status = code
+	}
+}
+
+func (sw *signingResponseWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	if sw.passThrough {
+		return sw.w.Write(p)
+	}
+	if sw.buf.Len()+len(p) > sw.h.maxBodySize || (sw.h.underPressure != nil && sw.h.underPressure()) {
+		sw.passThrough = true
+		// too large to sign, or no memory to spare for it: send what we
+		// have and stream the rest
+		sw.w.WriteHeader(sw.status)
+		if _, err := sw.w.Write(sw.buf.Bytes()); err != nil {
+			return 0, err
+		}
+		sw.buf = bytes.Buffer{}
+		return sw.w.Write(p)
+	}
+	return sw.buf.Write(p)
+}
+
+// Flush signs the headers of a response streamed to the client, without the
+// digest of its body which is not complete, sends it, and passes the rest of
+// it through.
+func (sw *signingResponseWriter) Flush() {
+	if !sw.passThrough {
+		sw.passThrough = true
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		if err := sw.h.sign(sw.w.Header(), sw.status); err != nil {
+			log.Errorf("signing gateway response: %s", err)
+		}
+		sw.w.WriteHeader(sw.status)
+		if _, err := sw.w.Write(sw.buf.Bytes()); err != nil {
+			log.Debugf("writing signed gateway response: %s", err)
+			return
+		}
+		sw.buf = bytes.Buffer{}
+	}
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish signs and sends a response that was fully buffered.
+func (sw *signingResponseWriter) finish() {
+	if sw.passThrough {
+		return
+	}
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	hdr := sw.w.Header()
+	// HEAD responses and 304s have no body to digest
+	if !sw.head && sw.status != http.StatusNotModified {
+		digest := sha256.Sum256(sw.buf.Bytes())
+		hdr.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+	}
+	if err := sw.h.sign(hdr, sw.status); err != nil {
+		log.Errorf("signing gateway response: %s", err)
+	}
+
+	sw.w.WriteHeader(sw.status)
+	if _, err := sw.w.Write(sw.buf.Bytes()); err != nil {
+		log.Debugf("writing signed gateway response: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package corehttp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestSigningHandler(t *testing.T) {
+	sk, pk, err := ic.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := strings.Repeat("x", 100)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Ipfs-Path", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, body[:len(body)/2])
+		fmt.Fprint(w, body[len(body)/2:])
+	})
+
+	h, err := newSigningHandler(next, sk, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipfs/bafkqaaa", nil))
+	res := rec.Result()
+
+	if rec.Body.String() != body {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+	digest := sha256.Sum256([]byte(body))
+	expectedDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(digest[:]) + ":"
+	if d := res.Header.Get("Content-Digest"); d != expectedDigest {
+		t.Fatalf("unexpected digest %q", d)
+	}
+
+	input := res.Header.Get("Signature-Input")
+	m := regexp.MustCompile(`^sig1=(\("@status" "content-type" "content-digest" "x-ipfs-path"\);created=\d+;keyid="([^"]+)";alg="ed25519")$`).FindStringSubmatch(input)
+	if m == nil {
+		t.Fatalf("unexpected Signature-Input %q", input)
+	}
+	if m[2] != id.String() {
+		t.Fatalf("unexpected keyid %q", m[2])
+	}
+
+	base := "\"@status\": 200\n" +
+		"\"content-type\": text/plain\n" +
+		"\"content-digest\": " + expectedDigest + "\n" +
+		"\"x-ipfs-path\": /ipfs/bafkqaaa\n" +
+		"\"@signature-params\": " + m[1]
+	sig := res.Header.Get("Signature")
+	if !strings.HasPrefix(sig, "sig1=:") || !strings.HasSuffix(sig, ":") {
+		t.Fatalf("unexpected Signature %q", sig)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig[len("sig1=:") : len(sig)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := pk.Verify([]byte(base), raw); err != nil || !ok {
+		t.Fatalf("signature doesn't verify: %v", err)
+	}
+
+	// larger bodies are sent unsigned
+	h.maxBodySize = 10
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipfs/bafkqaaa", nil))
+	if rec.Body.String() != body {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+	if s := rec.Result().Header.Get("Signature"); s != "" {
+		t.Fatalf("unexpected signature on a large response: %q", s)
+	}
+
+	// and so are the bodies written under memory pressure
+	h.maxBodySize = 200
+	h.underPressure = func() bool { return true }
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipfs/bafkqaaa", nil))
+	if rec.Body.String() != body {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+	if s := rec.Result().Header.Get("Signature"); s != "" {
+		t.Fatalf("unexpected signature on a response under memory pressure: %q", s)
+	}
+}
+
+func TestSigningHandlerFlush(t *testing.T) {
+	sk, _, err := ic.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec *httptest.ResponseRecorder
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if !rec.Flushed || rec.Result().Header.Get("Signature") == "" {
+			t.Error("expected the signed headers sent on flush")
+		}
+		fmt.Fprint(w, "event: update\n\n")
+		w.(http.Flusher).Flush()
+		if rec.Body.String() != "event: update\n\n" {
+			t.Errorf("expected the event sent on flush, got %q", rec.Body.String())
+		}
+	})
+
+	h, err := newSigningHandler(next, sk, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ipns/example.org?watch", nil))
+	if d := rec.Result().Header.Get("Content-Digest"); d != "" {
+		t.Fatalf("unexpected digest of a streamed response %q", d)
+	}
+	if rec.Body.String() != "event: update\n\n" {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,191 @@
+package corehttp
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-ipfs/core/netfetch"
+	prometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultApdexThreshold = 500 * time.Millisecond
+
+const (
+	sourceCache   = "cache"
+	sourceNetwork = "network"
+
+	apdexSatisfied  = "satisfied"
+	apdexTolerating = "tolerating"
+	apdexFrustrated = "frustrated"
+)
+
+// sloMetrics are the service level metrics of the gateway, split by whether
+// the response could be served from the blockstore alone.
+type sloMetrics struct {
+	threshold time.Duration
+
+	ttfb     *prometheus.HistogramVec
+	duration *prometheus.HistogramVec
+	apdex    *prometheus.CounterVec
+}
+
+// registerGatewayCollector registers c, or returns the collector registered
+// under the same name.
+func registerGatewayCollector(name string, c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		log.Errorf("failed to register ipfs_http_%s: %v", name, err)
+	}
+	return c
+}
+
+func newSLOMetrics(threshold time.Duration) *sloMetrics {
+	// finer than the buckets of the other gateway metrics, as most responses
+	// start within a second
+	buckets := []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30, 60}
+	histogram := func(name, help string) *prometheus.HistogramVec {
+		return registerGatewayCollector(name, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      name,
+				Help:      help,
+				Buckets:   buckets,
+			},
+			[]string{"gateway", "source"},
+		)).(*prometheus.HistogramVec)
+	}
+
+	apdexThreshold := registerGatewayCollector("gw_apdex_threshold_seconds", prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ipfs",
+			Subsystem: "http",
+			Name:      "gw_apdex_threshold_seconds",
+			Help:      "The time to first byte within which a gateway response satisfies the client.",
+		},
+	)).(prometheus.Gauge)
+	apdexThreshold.Set(threshold.Seconds())
+
+	return &sloMetrics{
+		threshold: threshold,
+		ttfb: histogram(
+			"gw_time_to_first_byte_seconds",
+			"The time to the first byte of a GET response from the gateway.",
+		),
+		duration: histogram(
+			"gw_response_duration_seconds",
+			"The time to send an entire GET response from the gateway.",
+		),
+		apdex: registerGatewayCollector("gw_apdex_requests_total", prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_apdex_requests_total",
+				Help:      "The number of GET responses from the gateway by Apdex zone of their time to first byte.",
+			},
+			[]string{"gateway", "source", "zone"},
+		)).(*prometheus.CounterVec),
+	}
+}
+
+// zone returns the Apdex zone of a response.
+func (m *sloMetrics) zone(status int, ttfb time.Duration) string {
+	switch {
+	case status >= 500:
+		return apdexFrustrated
+	case ttfb <= m.threshold:
+		return apdexSatisfied
+	case ttfb <= 4*m.threshold:
+		return apdexTolerating
+	default:
+		return apdexFrustrated
+	}
+}
+
+// withSLOMetrics records the service level metrics of the GET and HEAD
+// requests served by next.
+func withSLOMetrics(next http.Handler, threshold time.Duration) http.Handler {
+	m := newSLOMetrics(threshold)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		begin := time.Now()
+		ctx, tracker := netfetch.WithTracker(r.Context())
+		sw := &sloResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		end := time.Now()
+		if sw.first.IsZero() {
+			// net/http sends the empty response once we return
+			sw.first = end
+			sw.code = http.StatusOK
+		}
+
+		source := sourceCache
+		if tracker.Fetched() {
+			source = sourceNetwork
+		}
+		ns := gatewayNamespace(r.URL.Path)
+		ttfb := sw.first.Sub(begin)
+
+		m.ttfb.WithLabelValues(ns, source).Observe(ttfb.Seconds())
+		m.duration.WithLabelValues(ns, source).Observe(end.Sub(begin).Seconds())
+		m.apdex.WithLabelValues(ns, source, m.zone(sw.code, ttfb)).Inc()
+	})
+}
+
+// gatewayNamespace returns the namespace of a gateway path, "ipfs" or
+// "ipns", like the label of the other gateway metrics.
+func gatewayNamespace(p string) string {
+	ns := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2)[0]
+	if ns != "ipfs" && ns != "ipns" {
+		return "other"
+	}
+	return ns
+}
+
+// sloResponseWriter records when the response started, and its status code.
+type sloResponseWriter struct {
+	http.ResponseWriter
+	first time.Time
+	code  int
+}
+
+func (w *sloResponseWriter) WriteHeader(code int) {
+	if w.first.IsZero() {
+		w.first = time.Now()
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sloResponseWriter) Write(p []byte) (int, error) {
+	if w.first.IsZero() {
+		w.first = time.Now()
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom passes the copies on to the ResponseWriter, which sends the files
+// with sendfile.
+func (w *sloResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.first.IsZero() {
+		w.first = time.Now()
+		w.code = http.StatusOK
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func (w *sloResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
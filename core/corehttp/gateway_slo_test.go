@@ -0,0 +1,62 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs/core/netfetch"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSLOMetrics(t *testing.T) {
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	ex := netfetch.NewExchange(offline.Exchange(bs))
+
+	handler := withSLOMetrics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ipfs/fetched":
+			// missing blocks are asked to the exchange
+			c, _ := cid.Decode("bafkqaaa")
+			_, _ = ex.GetBlock(r.Context(), c)
+		case "/ipfs/slow":
+			time.Sleep(100 * time.Millisecond)
+		case "/ipfs/error":
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}), 50*time.Millisecond)
+
+	m := newSLOMetrics(50 * time.Millisecond)
+	count := func(source, zone string) float64 {
+		return testutil.ToFloat64(m.apdex.WithLabelValues("ipfs", source, zone))
+	}
+
+	for _, tc := range []struct {
+		path   string
+		source string
+		zone   string
+	}{
+		{"/ipfs/cached", sourceCache, apdexSatisfied},
+		{"/ipfs/fetched", sourceNetwork, apdexSatisfied},
+		{"/ipfs/slow", sourceCache, apdexTolerating},
+		{"/ipfs/error", sourceCache, apdexFrustrated},
+	} {
+		before := count(tc.source, tc.zone)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if after := count(tc.source, tc.zone); after != before+1 {
+			t.Errorf("%s: expected a %s response from %s", tc.path, tc.zone, tc.source)
+		}
+	}
+
+	if n := testutil.CollectAndCount(m.ttfb); n == 0 {
+		t.Error("no time to first byte recorded")
+	}
+}
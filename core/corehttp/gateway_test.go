@@ -2,31 +2,40 @@ package corehttp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	version "github.com/ipfs/go-ipfs"
 	core "github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/namespaces"
 	repo "github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 	namesys "github.com/ipfs/go-namesys"
 
+	cid "github.com/ipfs/go-cid"
 	datastore "github.com/ipfs/go-datastore"
 	syncds "github.com/ipfs/go-datastore/sync"
 	files "github.com/ipfs/go-ipfs-files"
 	config "github.com/ipfs/go-ipfs/config"
+	dag "github.com/ipfs/go-merkledag"
 	path "github.com/ipfs/go-path"
+	ft "github.com/ipfs/go-unixfs"
 	iface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/ipfs/interface-go-ipfs-core/options"
 	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
 	ipath "github.com/ipfs/interface-go-ipfs-core/path"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
 	id "github.com/libp2p/go-libp2p/p2p/protocol/identify"
+	mh "github.com/multiformats/go-multihash"
 )
 
 // `ipfs object new unixfs-dir`
@@ -244,8 +253,9 @@ func TestGatewayGet(t *testing.T) {
 		{"double.example.com", "/", http.StatusOK, "fnord"},
 		{"triple.example.com", "/", http.StatusOK, "fnord"},
 		{"working.example.com", k.String(), http.StatusNotFound, "ipfs resolve -r /ipns/working.example.com" + k.String() + ": no link named \"ipfs\" under " + k.Cid().String() + "\n"},
-		{"broken.example.com", "/", http.StatusNotFound, "ipfs resolve -r /ipns/broken.example.com/: " + namesys.ErrResolveFailed.Error() + "\n"},
-		{"broken.example.com", k.String(), http.StatusNotFound, "ipfs resolve -r /ipns/broken.example.com" + k.String() + ": " + namesys.ErrResolveFailed.Error() + "\n"},
+		// the error of a name of the chain tells which one failed
+		{"broken.example.com", "/", http.StatusNotFound, "ipfs resolve -r /ipns/broken.example.com/: step 2 of the name resolution, /ipns/" + k.Cid().String() + ": " + namesys.ErrResolveFailed.Error() + "\n"},
+		{"broken.example.com", k.String(), http.StatusNotFound, "ipfs resolve -r /ipns/broken.example.com" + k.String() + ": step 2 of the name resolution, /ipns/" + k.Cid().String() + ": " + namesys.ErrResolveFailed.Error() + "\n"},
 		// This test case ensures we don't treat the TLD as a file extension.
 		{"example.man", "/", http.StatusOK, "fnord"},
 	} {
@@ -283,6 +293,71 @@ func TestGatewayGet(t *testing.T) {
 	}
 }
 
+// testNamespace resolves the names of /test-ns, registered once for all the
+// runs of the tests.
+type testNamespace map[string]ipath.Path
+
+var (
+	testNames             = testNamespace{}
+	registerTestNamespace sync.Once
+)
+
+func (m testNamespace) Resolve(ctx context.Context, name string) (ipath.Path, error) {
+	p, ok := m[name]
+	if !ok {
+		return nil, errors.New("unknown test name")
+	}
+	return p, nil
+}
+
+func TestGatewayNamespace(t *testing.T) {
+	registerTestNamespace.Do(func() {
+		if err := namespaces.Register("test-ns", testNames); err != nil {
+			t.Fatal(err)
+		}
+	})
+	ts, api, ctx := newTestServerAndNode(t, mockNamesys{})
+
+	dir, err := api.Unixfs().Add(ctx, files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile([]byte("fnord")),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testNames["docs"] = dir
+
+	res, err := http.Get(ts.URL + "/test-ns/docs/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || string(body) != "fnord" {
+		t.Fatalf("expected the file served, got %d: %q", res.StatusCode, body)
+	}
+	if cc := res.Header.Get("Cache-Control"); strings.Contains(cc, "immutable") {
+		t.Errorf("expected the path of a name not cached as immutable, got %q", cc)
+	}
+	if p := res.Header.Get("X-Ipfs-Path"); p != "/test-ns/docs/file.txt" {
+		t.Errorf("expected the path of the name in X-Ipfs-Path, got %q", p)
+	}
+	if roots := strings.Split(res.Header.Get("X-Ipfs-Roots"), ","); len(roots) != 2 || roots[0] != dir.Cid().String() {
+		t.Errorf("expected the roots of the name and the file, got %v", roots)
+	}
+
+	res, err = http.Get(ts.URL + "/test-ns/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown name not found, got %d", res.StatusCode)
+	}
+}
+
 func TestPretty404(t *testing.T) {
 	ns := mockNamesys{}
 	ts, api, ctx := newTestServerAndNode(t, ns)
@@ -312,7 +387,7 @@ func TestPretty404(t *testing.T) {
 		{"/nope", "text/html", http.StatusNotFound, "Custom 404"},
 		{"/nope", "text/*", http.StatusNotFound, "Custom 404"},
 		{"/nope", "*/*", http.StatusNotFound, "Custom 404"},
-		{"/nope", "application/json", http.StatusNotFound, "ipfs resolve -r /ipns/example.net/nope: no link named \"nope\" under QmcmnF7XG5G34RdqYErYDwCKNFQ6jb8oKVR21WAJgubiaj\n"},
+		{"/nope", "application/json", http.StatusNotFound, `{"Code":"not-found","Message":"ipfs resolve -r /ipns/example.net/nope: no link named \"nope\" under QmcmnF7XG5G34RdqYErYDwCKNFQ6jb8oKVR21WAJgubiaj","Path":"/ipns/example.net/nope","Retryable":false}` + "\n"},
 		{"/deeper/nope", "text/html", http.StatusNotFound, "Deep custom 404"},
 		{"/deeper/", "text/html", http.StatusOK, ""},
 		{"/deeper", "text/html", http.StatusOK, ""},
@@ -602,6 +677,384 @@ func TestCacheControlImmutable(t *testing.T) {
 	}
 }
 
+func TestInlineCid(t *testing.T) {
+	ts, _, _ := newTestServerAndNode(t, nil)
+
+	inline := func(codec uint64, data []byte) string {
+		h, err := mh.Sum(data, mh.IDENTITY, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "/ipfs/" + cid.NewCidV1(codec, h).String()
+	}
+	malformed := inline(cid.DagProtobuf, []byte{0xff, 0xff, 0xff, 0x01})
+	for _, c := range []struct {
+		p           string
+		status      int
+		contentType string
+	}{
+		{inline(cid.Raw, []byte("<html><body>hi</body></html>")), http.StatusOK, "text/html"},
+		{inline(cid.Raw, []byte(strings.Repeat("a", config.DefaultGatewayMaxInlineSize))), http.StatusOK, "text/plain; charset=utf-8"},
+		{inline(cid.Raw, []byte(strings.Repeat("a", config.DefaultGatewayMaxInlineSize+1))), http.StatusBadRequest, ""},
+		// the data of an identity CID is never missing, only malformed
+		{malformed, http.StatusBadRequest, ""},
+		{malformed + "/file", http.StatusBadRequest, ""},
+	} {
+		res, err := http.Get(ts.URL + c.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.status {
+			t.Errorf("expected %d for %s, got %d", c.status, c.p, res.StatusCode)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if ct := res.Header.Get("Content-Type"); ct != c.contentType {
+			t.Errorf("expected Content-Type %q for %s, got %q", c.contentType, c.p, ct)
+		}
+		if cc := res.Header.Get("Cache-Control"); cc != immutableCacheControl {
+			t.Errorf("expected %s cached as immutable, got %q", c.p, cc)
+		}
+	}
+
+	// the malformed blocks are still served as is
+	res, err := http.Get(ts.URL + malformed + "?format=raw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected the raw block of a malformed identity CID served, got %d", res.StatusCode)
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	nd := dag.NodeWithData(ft.FilePBData([]byte("fnord"), 5))
+	if err := unixfsmeta.Set(nd, unixfsmeta.Meta{ModTime: mtime}); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.Dag().Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("fnord")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for p, expected := range map[string]string{
+		"/ipfs/" + nd.Cid().String(): mtime.Format(http.TimeFormat),
+		plain.String():               "",
+	} {
+		res, err := http.Get(ts.URL + p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if got := res.Header.Get("Last-Modified"); got != expected {
+			t.Errorf("%s: expected Last-Modified %q, got %q", p, expected, got)
+		}
+	}
+}
+
+func TestFormatEtags(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+
+	k, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("fnord")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(format, ifNoneMatch string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+k.String()+"?format="+format, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	seen := make(map[string]string)
+	for _, format := range []string{"", "raw", "car", "tar", "zip", "dag-json"} {
+		res := get(format, "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("format %q: expected 200, got %d", format, res.StatusCode)
+		}
+		etag := res.Header.Get("Etag")
+		if other, ok := seen[etag]; ok || etag == "" {
+			t.Fatalf("format %q: Etag %q not distinct from format %q", format, etag, other)
+		}
+		seen[etag] = format
+		if res.Header.Get("Vary") != "Accept" {
+			t.Fatalf("format %q: expected Vary: Accept, got %q", format, res.Header.Get("Vary"))
+		}
+
+		// deterministic, and honored with weak comparison among others
+		if again := get(format, "").Header.Get("Etag"); again != etag {
+			t.Fatalf("format %q: Etag changed from %q to %q", format, etag, again)
+		}
+		if res := get(format, `"other", W/`+strings.TrimPrefix(etag, "W/")); res.StatusCode != http.StatusNotModified {
+			t.Fatalf("format %q: expected 304 for %s, got %d", format, etag, res.StatusCode)
+		}
+	}
+	// an Etag of another format is not honored
+	if res := get("car", `"`+k.Cid().String()+`.tar"`); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 for the Etag of another format, got %d", res.StatusCode)
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	ns := mockNamesys{}
+	ts, api, ctx := newTestServerAndNode(t, ns)
+
+	k, err := api.Unixfs().Add(ctx, files.NewBytesFile([]byte("fnord fnord fnord")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/example.com"] = path.FromString(k.String())
+	etag := `"` + k.Cid().String() + `"`
+	date := time.Now().UTC().Format(http.TimeFormat)
+
+	for _, c := range []struct {
+		p, accept, ifRange string
+		status             int
+	}{
+		{k.String(), "", etag, http.StatusPartialContent},
+		{k.String(), "", `"` + k.Cid().String() + `.raw"`, http.StatusOK},
+		{k.String(), "", "W/" + etag, http.StatusOK},
+		{k.String(), "", date, http.StatusPartialContent},
+		{k.String() + "?format=raw", "", date, http.StatusPartialContent},
+		{k.String(), "application/vnd.ipld.raw", date, http.StatusOK},
+		{"/ipns/example.com", "", etag, http.StatusPartialContent},
+		{"/ipns/example.com", "", date, http.StatusOK},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+c.p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", "bytes=6-10")
+		req.Header.Set("If-Range", c.ifRange)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != c.status {
+			t.Errorf("%s with If-Range %s: expected %d, got %d", c.p, c.ifRange, c.status, res.StatusCode)
+			continue
+		}
+		if c.status == http.StatusPartialContent && string(body) != "fnord" {
+			t.Errorf("%s with If-Range %s: expected the range, got %q", c.p, c.ifRange, body)
+		}
+	}
+
+	// the 304 names the representation still valid
+	req, err := http.NewRequest(http.MethodGet, ts.URL+k.String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=6-10")
+	req.Header.Set("If-None-Match", etag)
+	res, err := doWithoutRedirect(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotModified || res.Header.Get("Etag") != etag {
+		t.Fatalf("expected 304 with Etag %s, got %d with %q", etag, res.StatusCode, res.Header.Get("Etag"))
+	}
+}
+
+func TestHeadWithoutData(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+
+	data := strings.Repeat("fnord", 100)
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile([]byte(data)),
+		"noext":    files.NewBytesFile([]byte(strings.ToUpper(data))),
+	})
+	k, err := api.Unixfs().Add(ctx, dir, options.Unixfs.Chunker("size-128"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the roots of the files are left
+	for _, name := range []string{"file.txt", "noext"} {
+		links, err := api.Object().Links(ctx, ipath.Join(k, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range links {
+			if err := api.Block().Rm(ctx, ipath.IpfsPath(l.Cid)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for name, ctype := range map[string]string{
+		"file.txt": "text/plain; charset=utf-8",
+		"noext":    "",
+	} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, ts.URL+k.String()+"/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", name, res.StatusCode)
+		}
+		if res.ContentLength != int64(len(data)) {
+			t.Fatalf("%s: expected a length of %d, got %d", name, len(data), res.ContentLength)
+		}
+		if got := res.Header.Get("Content-Type"); got != ctype {
+			t.Fatalf("%s: expected Content-Type %q, got %q", name, ctype, got)
+		}
+	}
+}
+
+func TestFileStat(t *testing.T) {
+	ts, api, ctx := newTestServerAndNode(t, nil)
+
+	data := strings.Repeat("fnord", 100)
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"file.txt": files.NewBytesFile([]byte(data)),
+	})
+	k, err := api.Unixfs().Add(ctx, dir, options.Unixfs.Chunker("size-128"), options.Unixfs.RawLeaves(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := api.ResolvePath(ctx, ipath.Join(k, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stat := func(p, accept string) fileStat {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", p, res.StatusCode)
+		}
+		if ctype := res.Header.Get("Content-Type"); ctype != "application/vnd.ipfs.file-stat+json" {
+			t.Fatalf("%s: unexpected Content-Type %q", p, ctype)
+		}
+		var st fileStat
+		if err := json.NewDecoder(res.Body).Decode(&st); err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	st := stat(k.String()+"/file.txt?stat=true", "")
+	if st.Cid != file.Cid().String() || st.Type != "file" || st.Size != uint64(len(data)) ||
+		st.Blocks != 4 || !st.RawLeaves || len(st.BlockSizes) != 4 || st.BlockSizes[0] != 128 {
+		t.Fatalf("unexpected file stat %+v", st)
+	}
+	if again := stat(k.String()+"/file.txt", "application/vnd.ipfs.file-stat+json"); again.Cid != st.Cid || again.Size != st.Size {
+		t.Fatalf("stat differs between ?stat=true and Accept: %+v, %+v", st, again)
+	}
+	if st := stat(k.String()+"?stat=true", ""); st.Type != "directory" || st.Blocks != 1 {
+		t.Fatalf("unexpected directory stat %+v", st)
+	}
+}
+
+func TestContentPolicy(t *testing.T) {
+	var calls int
+	policy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("cid") == "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354" {
+			w.Write([]byte(`{"Action":"deny","Reason":"nope","Tags":["a","b"]}`))
+			return
+		}
+		w.Write([]byte(`{"Action":"allow","Tags":["ok"]}`))
+	}))
+	defer policy.Close()
+
+	n, err := newNodeWithMockNamesys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.ContentPolicy.URL = policy.URL
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// emptyDir is denied, under both CID versions
+	for _, p := range []string{emptyDir, "/ipfs/bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"} {
+		res, err := http.Get(ts.URL + p + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnavailableForLegalReasons || !strings.Contains(string(body), "nope") {
+			t.Fatalf("expected a 451 response, got %d: %s", res.StatusCode, body)
+		}
+		if tags := res.Header.Get("X-Ipfs-Policy-Tags"); tags != "a,b" {
+			t.Fatalf("unexpected tags %q", tags)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the decision to be cached, got %d calls", calls)
+	}
+
+	// the empty file is allowed
+	res, err := http.Get(ts.URL + "/ipfs/bafkqaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected a 200 response, got %d", res.StatusCode)
+	}
+	if tags := res.Header.Get("X-Ipfs-Policy-Tags"); tags != "ok" {
+		t.Fatalf("unexpected tags %q", tags)
+	}
+}
+
 func TestGoGetSupport(t *testing.T) {
 	ts, _, _ := newTestServerAndNode(t, nil)
 	t.Logf("test server url: %s", ts.URL)
@@ -656,3 +1109,47 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("response doesn't contain protocol version:\n%s", s)
 	}
 }
+
+func TestVersionAgentVersion(t *testing.T) {
+	c := config.Config{
+		Identity: config.Identity{
+			PeerID: "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe", // required by offline node
+		},
+	}
+	var agent config.OptionalString
+	if err := json.Unmarshal([]byte(`"go-ipfs"`), &agent); err != nil {
+		t.Fatal(err)
+	}
+	c.Swarm.Identify.AgentVersion = &agent
+	r := &repo.Mock{
+		C: c,
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	n, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := makeHandler(n, nil, VersionOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("error reading response: %s", err)
+	}
+	s := string(body)
+
+	if !strings.Contains(s, "Client Version: go-ipfs\n") {
+		t.Fatalf("response doesn't contain the configured client version:\n%s", s)
+	}
+	if strings.Contains(s, "Commit:") {
+		t.Fatalf("response contains the commit:\n%s", s)
+	}
+}
@@ -0,0 +1,291 @@
+package corehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	defaultUpstreamLatencyBudget = time.Second
+	defaultUpstreamTimeout       = 30 * time.Second
+
+	// the largest block fetched from an upstream gateway, as the largest
+	// block bitswap sends
+	maxUpstreamBlockSize = 2 << 20
+	// the most blocks of a GetBlocks fetched from the upstream gateways at
+	// once
+	maxUpstreamFetches = 8
+)
+
+// gatewayUpstream is the exchange of the gateway API fetching the blocks
+// which take longer than the latency budget to retrieve with the exchange it
+// wraps from the upstream gateways too, as raw blocks. A block fetched from
+// an upstream gateway is verified against its CID, and given to the exchange
+// as if added, which stores it and ends its retrieval from the network.
+type gatewayUpstream struct {
+	exchange.Interface
+	// fetcher retrieves the blocks from the network, with the session of
+	// the exchange if any
+	fetcher exchange.Fetcher
+
+	urls    []string
+	budget  time.Duration
+	timeout time.Duration
+	client  *http.Client
+	fetches *prometheus.CounterVec
+}
+
+func newGatewayUpstream(exch exchange.Interface, urls []string, budget, timeout time.Duration) (*gatewayUpstream, error) {
+	if budget < 0 {
+		return nil, fmt.Errorf("invalid Gateway.Upstream.LatencyBudget: %s is negative", budget)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid Gateway.Upstream.Timeout: %s is not positive", timeout)
+	}
+	bases := make([]string, 0, len(urls))
+	for _, u := range urls {
+		pu, err := url.Parse(u)
+		if err != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+			return nil, fmt.Errorf("invalid Gateway.Upstream.URLs: %q is not an HTTP URL", u)
+		}
+		bases = append(bases, strings.TrimSuffix(u, "/"))
+	}
+	return &gatewayUpstream{
+		Interface: exch,
+		fetcher:   exch,
+		urls:      bases,
+		budget:    budget,
+		timeout:   timeout,
+		client:    &http.Client{},
+		fetches: registerGatewayCollector("gw_upstream_fetches_total", prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: "ipfs",
+				Subsystem: "http",
+				Name:      "gw_upstream_fetches_total",
+				Help:      "The number of blocks fetched from the upstream gateways past the latency budget, by result: ok or failed.",
+			},
+			[]string{"result"},
+		)).(*prometheus.CounterVec),
+	}, nil
+}
+
+// NewSession returns the exchange fetching with a session of the exchange
+// wrapped, if it has sessions.
+func (u *gatewayUpstream) NewSession(ctx context.Context) exchange.Fetcher {
+	sx, ok := u.Interface.(exchange.SessionExchange)
+	if !ok {
+		return u
+	}
+	ses := *u
+	ses.fetcher = sx.NewSession(ctx)
+	return &ses
+}
+
+type fetchResult struct {
+	blk blocks.Block
+	err error
+}
+
+// GetBlock retrieves c from the network, and from the upstream gateways too
+// past the latency budget, returning the first of them to succeed.
+func (u *gatewayUpstream) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	network := make(chan fetchResult, 1)
+	go func() {
+		blk, err := u.fetcher.GetBlock(ctx, c)
+		network <- fetchResult{blk, err}
+	}()
+
+	t := time.NewTimer(u.budget)
+	defer t.Stop()
+	select {
+	case r := <-network:
+		return r.blk, r.err
+	case <-t.C:
+	}
+
+	upstream := make(chan fetchResult, 1)
+	go func() {
+		blk, err := u.fetch(ctx, c)
+		upstream <- fetchResult{blk, err}
+	}()
+	select {
+	case r := <-network:
+		return r.blk, r.err
+	case r := <-upstream:
+		if r.err != nil {
+			u.fetches.WithLabelValues("failed").Inc()
+			log.Debugf("upstream gateways failed to fetch %s: %s", c, r.err)
+			r = <-network
+			return r.blk, r.err
+		}
+		u.fetches.WithLabelValues("ok").Inc()
+		u.store(ctx, r.blk)
+		return r.blk, nil
+	}
+}
+
+// GetBlocks retrieves cs from the network, and the blocks not retrieved
+// within the latency budget from the upstream gateways too.
+func (u *gatewayUpstream) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	network, err := u.fetcher.GetBlocks(ctx, cs)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	out := make(chan blocks.Block)
+	go func() {
+		defer cancel()
+		defer close(out)
+
+		remaining := cid.NewSet()
+		for _, c := range cs {
+			remaining.Add(c)
+		}
+		upstream := make(chan blocks.Block)
+		t := time.NewTimer(u.budget)
+		defer t.Stop()
+		for remaining.Len() > 0 {
+			var blk blocks.Block
+			select {
+			case b, ok := <-network:
+				if !ok {
+					// retrieved, or ctx is done
+					return
+				}
+				blk = b
+			case blk = <-upstream:
+			case <-t.C:
+				u.fetchAll(ctx, remaining.Keys(), upstream)
+				continue
+			case <-ctx.Done():
+				return
+			}
+			// a block fetched upstream is retrieved from the network too
+			if !remaining.Has(blk.Cid()) {
+				continue
+			}
+			remaining.Remove(blk.Cid())
+			select {
+			case out <- blk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// fetchAll fetches cs from the upstream gateways in the background, sending
+// the blocks fetched to out until ctx is done.
+func (u *gatewayUpstream) fetchAll(ctx context.Context, cs []cid.Cid, out chan<- blocks.Block) {
+	sem := make(chan struct{}, maxUpstreamFetches)
+	go func() {
+		for _, c := range cs {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			go func(c cid.Cid) {
+				defer func() { <-sem }()
+				blk, err := u.fetch(ctx, c)
+				if err != nil {
+					if ctx.Err() == nil {
+						u.fetches.WithLabelValues("failed").Inc()
+						log.Debugf("upstream gateways failed to fetch %s: %s", c, err)
+					}
+					return
+				}
+				u.fetches.WithLabelValues("ok").Inc()
+				u.store(ctx, blk)
+				select {
+				case out <- blk:
+				case <-ctx.Done():
+				}
+			}(c)
+		}
+	}()
+}
+
+// store gives blk to the exchange, which stores it and ends its retrieval.
+func (u *gatewayUpstream) store(ctx context.Context, blk blocks.Block) {
+	if err := u.Interface.HasBlock(ctx, blk); err != nil {
+		log.Errorf("failed to store the block %s fetched upstream: %s", blk.Cid(), err)
+	}
+}
+
+// fetch fetches c from all the upstream gateways at once, returning the
+// first block verified.
+func (u *gatewayUpstream) fetch(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	ctx, cancel := context.WithTimeout(ctx, u.timeout)
+	defer cancel()
+
+	results := make(chan fetchResult, len(u.urls))
+	for _, base := range u.urls {
+		go func(base string) {
+			blk, err := u.fetchFrom(ctx, base, c)
+			results <- fetchResult{blk, err}
+		}(base)
+	}
+	var errs []string
+	for range u.urls {
+		r := <-results
+		if r.err == nil {
+			return r.blk, nil
+		}
+		errs = append(errs, r.err.Error())
+	}
+	return nil, errors.New(strings.Join(errs, "; "))
+}
+
+// fetchFrom fetches c from the gateway at base as a raw block, and verifies
+// it.
+func (u *gatewayUpstream) fetchFrom(ctx context.Context, base string, c cid.Cid) (blocks.Block, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/ipfs/"+c.String()+"?format=raw", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+	res, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+		return nil, fmt.Errorf("GET %s: %s", req.URL.Redacted(), res.Status)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxUpstreamBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxUpstreamBlockSize {
+		return nil, fmt.Errorf("GET %s: block larger than %d bytes", req.URL.Redacted(), maxUpstreamBlockSize)
+	}
+	// trust nothing but the hash
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("GET %s: the block does not match its CID", req.URL.Redacted())
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
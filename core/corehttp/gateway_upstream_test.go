@@ -0,0 +1,136 @@
+package corehttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+// slowExchange has the blocks of have at once, and never retrieves the
+// others.
+type slowExchange struct {
+	exchange.Interface
+
+	have map[cid.Cid]blocks.Block
+
+	mu    sync.Mutex
+	added []cid.Cid
+}
+
+func (x *slowExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if b, ok := x.have[c]; ok {
+		return b, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (x *slowExchange) GetBlocks(ctx context.Context, cs []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block, len(cs))
+	for _, c := range cs {
+		if b, ok := x.have[c]; ok {
+			out <- b
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		close(out)
+	}()
+	return out, nil
+}
+
+func (x *slowExchange) HasBlock(ctx context.Context, b blocks.Block) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.added = append(x.added, b.Cid())
+	return nil
+}
+
+// upstreamGateway serves the raw blocks of blks, and counts its requests.
+func upstreamGateway(t *testing.T, blks map[string][]byte) (*httptest.Server, *int) {
+	var mu sync.Mutex
+	requests := new(int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*requests++
+		mu.Unlock()
+		data, ok := blks[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok || r.URL.Query().Get("format") != "raw" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.ipld.raw")
+		w.Write(data)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, requests
+}
+
+func TestGatewayUpstream(t *testing.T) {
+	local := blocks.NewBlock([]byte("local"))
+	remote := blocks.NewBlock([]byte("remote"))
+	missing := blocks.NewBlock([]byte("missing"))
+	good, goodRequests := upstreamGateway(t, map[string][]byte{remote.Cid().String(): remote.RawData()})
+	// serves another block in the place of the missing one
+	bad, _ := upstreamGateway(t, map[string][]byte{missing.Cid().String(): []byte("forged")})
+
+	exch := &slowExchange{have: map[cid.Cid]blocks.Block{local.Cid(): local}}
+	u, err := newGatewayUpstream(exch, []string{good.URL + "/", bad.URL}, 50*time.Millisecond, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// retrieved within the budget
+	if b, err := u.GetBlock(ctx, local.Cid()); err != nil || !b.Cid().Equals(local.Cid()) {
+		t.Fatalf("expected the local block, got %v, %v", b, err)
+	}
+	if *goodRequests != 0 {
+		t.Fatal("expected no upstream request within the budget")
+	}
+
+	b, err := u.GetBlock(ctx, remote.Cid())
+	if err != nil || string(b.RawData()) != "remote" {
+		t.Fatalf("expected the block fetched upstream, got %v, %v", b, err)
+	}
+	if len(exch.added) != 1 || !exch.added[0].Equals(remote.Cid()) {
+		t.Fatalf("expected the block fetched upstream stored, got %v", exch.added)
+	}
+
+	// the forged block is refused, and the network waited for
+	tctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	if _, err := u.GetBlock(tctx, missing.Cid()); err != context.DeadlineExceeded {
+		t.Fatalf("expected the forged block refused, got %v", err)
+	}
+
+	tctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := u.GetBlocks(tctx, []cid.Cid{local.Cid(), remote.Cid()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for b := range out {
+		got[string(b.RawData())] = true
+	}
+	if len(got) != 2 || !got["local"] || !got["remote"] {
+		t.Fatalf("expected the local and upstream blocks, got %v", got)
+	}
+}
+
+func TestGatewayUpstreamInvalid(t *testing.T) {
+	for _, urls := range [][]string{{"ftp://example.org"}, {"example.org"}} {
+		if _, err := newGatewayUpstream(&slowExchange{}, urls, time.Second, time.Second); err == nil {
+			t.Errorf("expected %v invalid", urls)
+		}
+	}
+}
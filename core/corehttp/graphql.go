@@ -0,0 +1,556 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+
+	core "github.com/ipfs/go-ipfs/core"
+	coreapi "github.com/ipfs/go-ipfs/core/coreapi"
+
+	cid "github.com/ipfs/go-cid"
+	ipldlegacy "github.com/ipfs/go-ipld-legacy"
+	iface "github.com/ipfs/interface-go-ipfs-core"
+	options "github.com/ipfs/interface-go-ipfs-core/options"
+	ipath "github.com/ipfs/interface-go-ipfs-core/path"
+	ipld "github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+const (
+	// graphqlMaxQuerySize is the maximum size of the body of a GraphQL request.
+	graphqlMaxQuerySize = 1 << 20
+	// graphqlMaxBlocks is the maximum number of blocks loaded by a GraphQL
+	// query, so that a single query cannot walk arbitrarily large DAGs.
+	graphqlMaxBlocks = 1024
+)
+
+// GraphQLOption serves, under the given path, an experimental GraphQL
+// endpoint for querying IPLD data.
+//
+// The 'node' field of the query takes a 'cid' argument, a CID or an IPFS
+// path. The fields selected on a node are the keys of the IPLD maps
+// traversed from there, following links to other blocks transparently, so
+// that only the requested data is returned.
+//
+// The queries are held to the same restrictions as the requests of the
+// gateway: Gateway.NoFetch, the access control, content policy and rate
+// limits, the drain and the memory budget.
+func GraphQLOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := n.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		api, err := coreapi.NewCoreAPI(n, options.Api.FetchBlocks(!cfg.Gateway.NoFetch))
+		if err != nil {
+			return nil, err
+		}
+		policy, access, limiter, err := newGatewayRestrictions(n, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var h http.Handler = &graphqlHandler{
+			api:            api,
+			access:         access,
+			policy:         policy,
+			policyFailOpen: cfg.Gateway.ContentPolicy.FailOpen.WithDefault(false),
+		}
+		h = withTenantUsage(n, h, cfg.API.Authorizations)
+		h = withDrain(n, h, nil)
+		h = withMemoryBudget(n, h, nil)
+		h = withRateLimit(h, limiter)
+		mux.Handle(path, h)
+		return mux, nil
+	}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   *graphqlObject `json:"data,omitempty"`
+	Errors []graphqlError `json:"errors,omitempty"`
+}
+
+// graphqlObject is a JSON object whose fields are in the order in which they
+// were selected, as required by GraphQL.
+type graphqlObject struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *graphqlObject) set(key string, value interface{}) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+func (o *graphqlObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(kb)
+		b.WriteByte(':')
+		b.Write(vb)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+type graphqlHandler struct {
+	api iface.CoreAPI
+	// access and policy are those of the gateway, if any
+	access         *gatewayAccess
+	policy         ContentPolicy
+	policyFailOpen bool
+}
+
+func (h *graphqlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.access != nil && r.Method != http.MethodOptions && !h.access.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-gateway"`)
+		writeGraphQLError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+		return
+	}
+
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, fmt.Errorf("invalid variables: %w", err))
+				return
+			}
+		}
+
+	case http.MethodPost:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, graphqlMaxQuerySize))
+		if err != nil {
+			writeGraphQLError(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mt {
+		case "application/graphql":
+			req.Query = string(body)
+		case "application/json", "":
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeGraphQLError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+				return
+			}
+		default:
+			writeGraphQLError(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", mt))
+			return
+		}
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeGraphQLError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	if req.Query == "" {
+		writeGraphQLError(w, http.StatusBadRequest, fmt.Errorf("missing query"))
+		return
+	}
+	q, err := parseGraphQLQuery(req.Query)
+	if err != nil {
+		writeGraphQLError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	vars := make(map[string]interface{}, len(q.defaults)+len(req.Variables))
+	for k, v := range q.defaults {
+		vars[k] = v
+	}
+	for k, v := range req.Variables {
+		vars[k] = v
+	}
+
+	e := &graphqlExecutor{ctx: r.Context(), h: h, api: h.api, vars: vars}
+	res := graphqlResponse{Data: e.execute(q)}
+	res.Errors = e.errors
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&res)
+}
+
+func writeGraphQLError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&graphqlResponse{
+		Errors: []graphqlError{{Message: err.Error()}},
+	})
+}
+
+// graphqlExecutor resolves the fields of a query. Errors are recorded along
+// with the path of the field that failed, whose value is then null, as
+// GraphQL returns partial results.
+type graphqlExecutor struct {
+	ctx    context.Context
+	h      *graphqlHandler
+	api    iface.CoreAPI
+	vars   map[string]interface{}
+	errors []graphqlError
+	loaded int
+}
+
+func (e *graphqlExecutor) execute(q *graphqlQuery) *graphqlObject {
+	data := &graphqlObject{}
+	for _, f := range q.selections {
+		path := []interface{}{f.key()}
+		v, err := e.root(f, path)
+		if err != nil {
+			e.fail(path, err)
+		}
+		data.set(f.key(), v)
+	}
+	return data
+}
+
+func (e *graphqlExecutor) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, graphqlError{
+		Message: err.Error(),
+		Path:    append([]interface{}(nil), path...),
+	})
+}
+
+// arg returns the value of the string argument name of f, or ok false if it
+// isn't given.
+func (e *graphqlExecutor) arg(f *graphqlField, name string) (s string, ok bool, err error) {
+	v, ok := f.args[name]
+	if !ok {
+		return "", false, nil
+	}
+	if vr, isVar := v.(graphqlVariable); isVar {
+		if v, ok = e.vars[string(vr)]; !ok {
+			return "", false, fmt.Errorf("variable $%s is not defined", vr)
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	default:
+		return "", false, fmt.Errorf("argument %q of field %q must be a string", name, f.name)
+	}
+}
+
+func (e *graphqlExecutor) root(f *graphqlField, path []interface{}) (interface{}, error) {
+	switch f.name {
+	case "__typename":
+		return "Query", nil
+	case "node":
+	default:
+		return nil, fmt.Errorf("unknown field %q, the only field of queries is \"node\"", f.name)
+	}
+	for name := range f.args {
+		if name != "cid" {
+			return nil, fmt.Errorf("unknown argument %q of field %q", name, f.name)
+		}
+	}
+
+	s, ok, err := e.arg(f, "cid")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("field %q requires a \"cid\" argument", f.name)
+	}
+
+	var p ipath.Path
+	if c, err := cid.Decode(s); err == nil {
+		p = ipath.IpfsPath(c)
+	} else {
+		p = ipath.New(s)
+		if err := p.IsValid(); err != nil {
+			return nil, err
+		}
+	}
+	if a := e.h.access; a != nil {
+		if status, reason := a.check(p.String()); status != 0 {
+			return nil, errors.New(reason)
+		}
+	}
+	rp, err := e.api.ResolvePath(e.ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkResolved(p, rp.Cid()); err != nil {
+		return nil, err
+	}
+
+	c := rp.Cid()
+	n, err := e.load(c)
+	if err != nil {
+		return nil, err
+	}
+	if rp.Remainder() != "" {
+		if c, n, err = e.traverse(c, n, ipld.ParsePath(rp.Remainder())); err != nil {
+			return nil, err
+		}
+	}
+	return e.project(c, n, f, path), nil
+}
+
+// checkResolved refuses the content path p, resolved to c, when the gateway
+// would: c is denied by its access control, or the root of p by its content
+// policy.
+func (e *graphqlExecutor) checkResolved(p ipath.Path, c cid.Cid) error {
+	if a := e.h.access; a != nil && a.deniedCid(c) {
+		return errors.New("path denied by the gateway")
+	}
+	if e.h.policy == nil {
+		return nil
+	}
+
+	root, err := resolveRootCid(e.ctx, e.api, p)
+	if err != nil {
+		return err
+	}
+	d, err := e.h.policy.Check(e.ctx, root)
+	if err != nil {
+		if e.h.policyFailOpen {
+			log.Warnf("content policy check of %s failed, serving it anyway: %s", root, err)
+			return nil
+		}
+		return fmt.Errorf("content policy check of %s: %w", root, err)
+	}
+	if d.Action != PolicyDeny {
+		return nil
+	}
+	if d.Reason == "" {
+		return errors.New("denied by content policy")
+	}
+	return errors.New(d.Reason)
+}
+
+// load fetches the block c.
+func (e *graphqlExecutor) load(c cid.Cid) (ipld.Node, error) {
+	if e.loaded >= graphqlMaxBlocks {
+		return nil, fmt.Errorf("query exceeds the limit of %d blocks", graphqlMaxBlocks)
+	}
+	e.loaded++
+
+	obj, err := e.api.Dag().Get(e.ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	n, ok := obj.(ipldlegacy.UniversalNode)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a valid IPLD node", c)
+	}
+	return n, nil
+}
+
+// follow loads the block linked by n if n is a link.
+func (e *graphqlExecutor) follow(c cid.Cid, n ipld.Node) (cid.Cid, ipld.Node, error) {
+	if n.Kind() != ipld.Kind_Link {
+		return c, n, nil
+	}
+	l, err := n.AsLink()
+	if err != nil {
+		return c, nil, err
+	}
+	cl, ok := l.(cidlink.Link)
+	if !ok {
+		return c, nil, fmt.Errorf("unsupported link type %T", l)
+	}
+	n, err = e.load(cl.Cid)
+	return cl.Cid, n, err
+}
+
+// traverse returns the node at p from n, which is part of the block c, and
+// the block the node is part of. It returns a nil node if there is no such
+// node.
+func (e *graphqlExecutor) traverse(c cid.Cid, n ipld.Node, p ipld.Path) (cid.Cid, ipld.Node, error) {
+	for _, seg := range p.Segments() {
+		var err error
+		if c, n, err = e.follow(c, n); err != nil {
+			return c, nil, err
+		}
+
+		switch n.Kind() {
+		case ipld.Kind_Map:
+			n, err = n.LookupByString(seg.String())
+		case ipld.Kind_List:
+			i, ierr := seg.Index()
+			if ierr != nil || i < 0 {
+				return c, nil, fmt.Errorf("invalid list index %q", seg.String())
+			}
+			n, err = n.LookupByIndex(i)
+		default:
+			return c, nil, fmt.Errorf("cannot traverse %q: node of kind %s has no fields", seg.String(), n.Kind())
+		}
+		if err != nil {
+			if _, notFound := err.(ipld.ErrNotExists); notFound {
+				return c, nil, nil
+			}
+			return c, nil, err
+		}
+	}
+	return c, n, nil
+}
+
+// project returns the value of the field f, whose node is n, recording the
+// errors.
+func (e *graphqlExecutor) project(c cid.Cid, n ipld.Node, f *graphqlField, path []interface{}) interface{} {
+	if n == nil || n.IsNull() {
+		return nil
+	}
+
+	if f.selections == nil {
+		v, err := graphqlLeaf(n, f)
+		if err != nil {
+			e.fail(path, err)
+		}
+		return v
+	}
+
+	c, n, err := e.follow(c, n)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+
+	switch n.Kind() {
+	case ipld.Kind_Map:
+		return e.selectFields(c, n, f.selections, path)
+	case ipld.Kind_List:
+		out := make([]interface{}, 0, n.Length())
+		for it := n.ListIterator(); !it.Done(); {
+			i, v, err := it.Next()
+			if err != nil {
+				e.fail(path, err)
+				return nil
+			}
+			out = append(out, e.project(c, v, f, append(path[:len(path):len(path)], i)))
+		}
+		return out
+	case ipld.Kind_Null:
+		return nil
+	default:
+		e.fail(path, fmt.Errorf("field %q of kind %s cannot have a selection of subfields", f.key(), n.Kind()))
+		return nil
+	}
+}
+
+// selectFields returns the fields of the map n selected by sels.
+func (e *graphqlExecutor) selectFields(c cid.Cid, n ipld.Node, sels []*graphqlField, path []interface{}) *graphqlObject {
+	obj := &graphqlObject{}
+	for _, f := range sels {
+		fpath := append(path[:len(path):len(path)], f.key())
+		v, err := e.field(c, n, f, fpath)
+		if err != nil {
+			e.fail(fpath, err)
+		}
+		obj.set(f.key(), v)
+	}
+	return obj
+}
+
+// field returns the value of the field f of the map n.
+func (e *graphqlExecutor) field(c cid.Cid, n ipld.Node, f *graphqlField, path []interface{}) (interface{}, error) {
+	switch f.name {
+	case "__cid":
+		return c.String(), nil
+	case "__kind":
+		return n.Kind().String(), nil
+	}
+
+	for name := range f.args {
+		if name != "path" {
+			return nil, fmt.Errorf("unknown argument %q of field %q", name, f.name)
+		}
+	}
+	p, ok, err := e.arg(f, "path")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		p = f.name
+	}
+
+	c, v, err := e.traverse(c, n, ipld.ParsePath(p))
+	if err != nil {
+		return nil, err
+	}
+	return e.project(c, v, f, path), nil
+}
+
+// graphqlLeaf returns the value of the leaf field f, whose node is n. Links
+// and bytes are encoded as in DAG-JSON.
+func graphqlLeaf(n ipld.Node, f *graphqlField) (interface{}, error) {
+	switch n.Kind() {
+	case ipld.Kind_Bool:
+		return n.AsBool()
+	case ipld.Kind_Int:
+		return n.AsInt()
+	case ipld.Kind_Float:
+		return n.AsFloat()
+	case ipld.Kind_String:
+		return n.AsString()
+	case ipld.Kind_Bytes:
+		b, err := n.AsBytes()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"/": map[string]string{"bytes": base64.RawStdEncoding.EncodeToString(b)}}, nil
+	case ipld.Kind_Link:
+		l, err := n.AsLink()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"/": l.String()}, nil
+	case ipld.Kind_List:
+		out := make([]interface{}, 0, n.Length())
+		for it := n.ListIterator(); !it.Done(); {
+			_, v, err := it.Next()
+			if err != nil {
+				return nil, err
+			}
+			if v.IsNull() {
+				out = append(out, nil)
+				continue
+			}
+			lv, err := graphqlLeaf(v, f)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, lv)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("field %q of kind %s must have a selection of subfields", f.key(), n.Kind())
+	}
+}
@@ -0,0 +1,411 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// graphqlField is a field selected by a GraphQL query.
+type graphqlField struct {
+	alias      string
+	name       string
+	args       map[string]interface{}
+	selections []*graphqlField // nil for leaf fields
+}
+
+// key returns the name of the field in the response.
+func (f *graphqlField) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+// graphqlVariable is an argument value referencing a variable of the query.
+type graphqlVariable string
+
+// graphqlQuery is a parsed GraphQL query.
+type graphqlQuery struct {
+	selections []*graphqlField
+	defaults   map[string]interface{} // default values of the variables
+}
+
+// parseGraphQLQuery parses the subset of GraphQL supported by the GraphQL
+// endpoint: a single query operation, with variables, aliases and
+// arguments. Fragments, directives and mutations are not supported.
+func parseGraphQLQuery(src string) (*graphqlQuery, error) {
+	p := &graphqlParser{lex: graphqlLexer{src: src}}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+
+	q := &graphqlQuery{defaults: make(map[string]interface{})}
+	if p.tok.kind == graphqlName {
+		switch p.tok.value {
+		case "query":
+		case "mutation", "subscription":
+			return nil, p.errorf("%s operations are not supported", p.tok.value)
+		case "fragment":
+			return nil, p.errorf("fragments are not supported")
+		default:
+			return nil, p.errorf("unexpected %s", p.tok)
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == graphqlName {
+			// operation name
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.is("(") {
+			if err := p.parseVariables(q.defaults); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sels, err := p.parseSelections()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != graphqlEOF {
+		return nil, p.errorf("only one operation is supported, found %s", p.tok)
+	}
+	q.selections = sels
+	return q, nil
+}
+
+type graphqlParser struct {
+	lex graphqlLexer
+	tok graphqlToken
+}
+
+func (p *graphqlParser) next() error {
+	t, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = t
+	return nil
+}
+
+func (p *graphqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.tok.offset, fmt.Sprintf(format, args...))
+}
+
+// expect consumes the punctuator s.
+func (p *graphqlParser) expect(s string) error {
+	if !p.tok.is(s) {
+		return p.errorf("expected %q, found %s", s, p.tok)
+	}
+	return p.next()
+}
+
+func (p *graphqlParser) name() (string, error) {
+	if p.tok.kind != graphqlName {
+		return "", p.errorf("expected a name, found %s", p.tok)
+	}
+	name := p.tok.value
+	return name, p.next()
+}
+
+// parseVariables parses variable definitions, recording their default values.
+func (p *graphqlParser) parseVariables(defaults map[string]interface{}) error {
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for !p.tok.is(")") {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		// types are only checked when the variables are used
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if p.tok.is("=") {
+			if err := p.next(); err != nil {
+				return err
+			}
+			v, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			if _, ok := v.(graphqlVariable); ok {
+				return p.errorf("default value of $%s must be constant", name)
+			}
+			defaults[name] = v
+		}
+	}
+	return p.next()
+}
+
+func (p *graphqlParser) skipType() error {
+	if p.tok.is("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.tok.is("!") {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *graphqlParser) parseSelections() ([]*graphqlField, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var fields []*graphqlField
+	for !p.tok.is("}") {
+		switch {
+		case p.tok.is("..."):
+			return nil, p.errorf("fragments are not supported")
+		case p.tok.is("@"):
+			return nil, p.errorf("directives are not supported")
+		}
+
+		f := &graphqlField{}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.is(":") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			f.alias = name
+			if name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		f.name = name
+
+		if p.tok.is("(") {
+			if f.args, err = p.parseArguments(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok.is("@") {
+			return nil, p.errorf("directives are not supported")
+		}
+		if p.tok.is("{") {
+			if f.selections, err = p.parseSelections(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, o := range fields {
+			if o.key() == f.key() {
+				return nil, p.errorf("field %q is selected more than once, use aliases", f.key())
+			}
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, p.errorf("empty selection")
+	}
+	return fields, p.next()
+}
+
+func (p *graphqlParser) parseArguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := make(map[string]interface{})
+	for !p.tok.is(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if _, ok := args[name]; ok {
+			return nil, p.errorf("argument %q is given more than once", name)
+		}
+		if args[name], err = p.parseValue(); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.next()
+}
+
+func (p *graphqlParser) parseValue() (interface{}, error) {
+	t := p.tok
+	var v interface{}
+	switch {
+	case t.is("$"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return graphqlVariable(name), err
+	case t.kind == graphqlString:
+		v = t.value
+	case t.kind == graphqlInt:
+		i, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", t.value)
+		}
+		v = i
+	case t.kind == graphqlFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %s", t.value)
+		}
+		v = f
+	case t.kind == graphqlName && (t.value == "true" || t.value == "false"):
+		v = t.value == "true"
+	case t.kind == graphqlName && t.value == "null":
+		v = nil
+	default:
+		return nil, p.errorf("unsupported value %s", t)
+	}
+	return v, p.next()
+}
+
+type graphqlTokenKind int
+
+const (
+	graphqlEOF graphqlTokenKind = iota
+	graphqlPunctuator
+	graphqlName
+	graphqlInt
+	graphqlFloat
+	graphqlString
+)
+
+type graphqlToken struct {
+	kind   graphqlTokenKind
+	value  string
+	offset int
+}
+
+func (t graphqlToken) is(punctuator string) bool {
+	return t.kind == graphqlPunctuator && t.value == punctuator
+}
+
+func (t graphqlToken) String() string {
+	switch t.kind {
+	case graphqlEOF:
+		return "end of query"
+	case graphqlString:
+		return strconv.Quote(t.value)
+	default:
+		return fmt.Sprintf("%q", t.value)
+	}
+}
+
+type graphqlLexer struct {
+	src string
+	pos int
+}
+
+func (l *graphqlLexer) next() (graphqlToken, error) {
+	// skip ignored tokens: whitespace, commas and comments
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != ',' {
+			break
+		}
+		l.pos++
+	}
+
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return graphqlToken{kind: graphqlEOF, offset: start}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return graphqlToken{kind: graphqlPunctuator, value: "...", offset: start}, nil
+
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		l.pos++
+		return graphqlToken{kind: graphqlPunctuator, value: string(c), offset: start}, nil
+
+	case c == '_' || isGraphQLLetter(c):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isGraphQLLetter(l.src[l.pos]) || isGraphQLDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return graphqlToken{kind: graphqlName, value: l.src[start:l.pos], offset: start}, nil
+
+	case c == '-' || isGraphQLDigit(c):
+		kind := graphqlInt
+		l.pos++
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c == '.' || c == 'e' || c == 'E' || ((c == '+' || c == '-') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E')) {
+				kind = graphqlFloat
+			} else if !isGraphQLDigit(c) {
+				break
+			}
+			l.pos++
+		}
+		return graphqlToken{kind: kind, value: l.src[start:l.pos], offset: start}, nil
+
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			return graphqlToken{}, fmt.Errorf("syntax error at offset %d: block strings are not supported", start)
+		}
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != '"' {
+			if l.src[l.pos] == '\n' || l.src[l.pos] == '\r' {
+				break
+			}
+			if l.src[l.pos] == '\\' {
+				l.pos++
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) || l.src[l.pos] != '"' {
+			return graphqlToken{}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+		}
+		l.pos++
+		// GraphQL strings use the escape sequences of JSON
+		var s string
+		if err := json.Unmarshal([]byte(l.src[start:l.pos]), &s); err != nil {
+			return graphqlToken{}, fmt.Errorf("syntax error at offset %d: invalid string", start)
+		}
+		return graphqlToken{kind: graphqlString, value: s, offset: start}, nil
+
+	default:
+		return graphqlToken{}, fmt.Errorf("syntax error at offset %d: unexpected character %q", start, c)
+	}
+}
+
+func isGraphQLLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isGraphQLDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,277 @@
+package corehttp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/config"
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/coreapi"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ipldlegacy "github.com/ipfs/go-ipld-legacy"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestParseGraphQLQuery(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		err   string
+	}{
+		{query: `{ node(cid: "bafy") { a } }`},
+		{query: `query Q($c: String! = "bafy", $n: [Int]) { n: node(cid: $c) { a b { c } d(path: "x/0") } }`},
+		{query: "# comment\n{ node(cid: \"b\\u0061fy\"), other: node(cid: \"bafy\") { __cid } }"},
+		{query: `{ node(cid: "bafy") { a a } }`, err: "selected more than once"},
+		{query: `{ node(cid: "bafy") { ...F } }`, err: "fragments are not supported"},
+		{query: `{ node(cid: "bafy") @skip(if: true) { a } }`, err: "directives are not supported"},
+		{query: `mutation { node }`, err: "mutation operations are not supported"},
+		{query: `{ node(cid: "bafy") { a } } { node }`, err: "only one operation"},
+		{query: `{ node(cid: "bafy", cid: "bafy") }`, err: "more than once"},
+		{query: `{ node(cid: "bafy) }`, err: "unterminated string"},
+		{query: `{ node(cid: [1]) }`, err: "unsupported value"},
+		{query: `{ }`, err: "empty selection"},
+		{query: `{ node `, err: "end of query"},
+	} {
+		_, err := parseGraphQLQuery(test.query)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", test.query, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: expected an error", test.query)
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: expected an error containing %q, got %q", test.query, test.err, err)
+		}
+	}
+}
+
+func putDagJSON(t *testing.T, n *core.IpfsNode, doc string) string {
+	t.Helper()
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjson.Decode(nb, strings.NewReader(doc)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := dagcbor.Encode(nb.Build(), &buf); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: mh.SHA2_256}.Sum(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, err := blocks.NewBlockWithCid(buf.Bytes(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := ipldlegacy.DecodeNode(context.Background(), blk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.Add(context.Background(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return c.String()
+}
+
+func TestGraphQL(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(&graphqlHandler{api: api})
+	t.Cleanup(ts.Close)
+
+	author := putDagJSON(t, n, `{"name": "alice", "key": {"/": {"bytes": "AQI"}}}`)
+	root := putDagJSON(t, n, `{
+		"title": "doc",
+		"tags": ["a", "b"],
+		"author": {"/": "`+author+`"},
+		"my-links": [{"/": "`+author+`"}],
+		"size": 12
+	}`)
+
+	for _, test := range []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{
+			query:  `{ node(cid: "` + root + `") { title size tags } }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":{"title":"doc","size":12,"tags":["a","b"]}}}`,
+		},
+		{
+			query:  `{ node(cid: "/ipfs/` + root + `/author") { name __cid } }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":{"name":"alice","__cid":"` + author + `"}}}`,
+		},
+		{
+			query:  `{ node(cid: "` + root + `") { author { name key } missing first: _(path: "tags/1") links: _(path: "my-links") { name } } }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":{"author":{"name":"alice","key":{"/":{"bytes":"AQI"}}},"missing":null,"first":"b","links":[{"name":"alice"}]}}}`,
+		},
+		{
+			query:  `{ node(cid: "` + root + `") { author title { x } } }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":{"author":{"/":"` + author + `"},"title":null}},"errors":[{"message":"field \"title\" of kind string cannot have a selection of subfields","path":["node","title"]}]}`,
+		},
+		{
+			query:  `{ node(cid: $c) { title } }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":null},"errors":[{"message":"variable $c is not defined","path":["node"]}]}`,
+		},
+		{
+			query:  `{ node(cid: "` + root + `") }`,
+			status: http.StatusOK,
+			body:   `{"data":{"node":null},"errors":[{"message":"field \"node\" of kind map must have a selection of subfields","path":["node"]}]}`,
+		},
+		{
+			query:  `{ node { title `,
+			status: http.StatusBadRequest,
+			body:   `{"errors":[{"message":"syntax error at offset 15: expected a name, found end of query"}]}`,
+		},
+	} {
+		resp, err := http.Get(ts.URL + "/graphql?query=" + url.QueryEscape(test.query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.query, test.status, resp.StatusCode)
+		}
+		if got := strings.TrimSpace(string(body)); got != test.body {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.query, test.body, got)
+		}
+	}
+
+	// POST with variables
+	resp, err := http.Post(ts.URL+"/graphql", "application/json", strings.NewReader(
+		`{"query": "query($c: String!) { node(cid: $c) { title } }", "variables": {"c": "`+root+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if got := strings.TrimSpace(string(body)); got != `{"data":{"node":{"title":"doc"}}}` {
+		t.Errorf("unexpected response to POST: %s", got)
+	}
+}
+
+// policyFunc is a ContentPolicy calling itself.
+type policyFunc func(root cid.Cid) PolicyDecision
+
+func (f policyFunc) Check(_ context.Context, root cid.Cid) (PolicyDecision, error) {
+	return f(root), nil
+}
+
+func TestGraphQLRestrictions(t *testing.T) {
+	n, err := newNodeWithMockNamesys(mockNamesys{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	author := putDagJSON(t, n, `{"name": "alice"}`)
+	root := putDagJSON(t, n, `{"title": "doc", "author": {"/": "`+author+`"}}`)
+	banned := putDagJSON(t, n, `{"title": "banned"}`)
+
+	access, err := newGatewayAccess(config.GatewayAccessControl{
+		Tokens: []string{"token"},
+		Deny:   []string{author},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(&graphqlHandler{
+		api:    api,
+		access: access,
+		policy: policyFunc(func(c cid.Cid) PolicyDecision {
+			if c.String() == banned {
+				return PolicyDecision{Action: PolicyDeny, Reason: "banned"}
+			}
+			return PolicyDecision{Action: PolicyAllow}
+		}),
+	})
+	t.Cleanup(ts.Close)
+
+	for _, test := range []struct {
+		query  string
+		token  string
+		status int
+		body   string
+	}{
+		{
+			query:  `{ node(cid: "` + root + `") { title } }`,
+			status: http.StatusUnauthorized,
+			body:   `{"errors":[{"message":"unauthorized"}]}`,
+		},
+		{
+			query:  `{ node(cid: "` + root + `") { title } }`,
+			token:  "token",
+			status: http.StatusOK,
+			body:   `{"data":{"node":{"title":"doc"}}}`,
+		},
+		{
+			query:  `{ node(cid: "` + author + `") { name } }`,
+			token:  "token",
+			status: http.StatusOK,
+			body:   `{"data":{"node":null},"errors":[{"message":"path denied by the gateway","path":["node"]}]}`,
+		},
+		{
+			query:  `{ node(cid: "/ipfs/` + root + `/author") { name } }`,
+			token:  "token",
+			status: http.StatusOK,
+			body:   `{"data":{"node":null},"errors":[{"message":"path denied by the gateway","path":["node"]}]}`,
+		},
+		{
+			query:  `{ node(cid: "` + banned + `") { title } }`,
+			token:  "token",
+			status: http.StatusOK,
+			body:   `{"data":{"node":null},"errors":[{"message":"banned","path":["node"]}]}`,
+		},
+	} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/graphql?query="+url.QueryEscape(test.query), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.query, test.status, resp.StatusCode)
+		}
+		if got := strings.TrimSpace(string(body)); got != test.body {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.query, test.body, got)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	cid "github.com/ipfs/go-cid"
@@ -70,11 +71,22 @@ func HostnameOption() ServeOption {
 			if xHost := r.Header.Get("X-Forwarded-Host"); xHost != "" {
 				host = xHost
 			}
+			host = normalizeHostname(host)
 
 			// HTTP Host & Path check: is this one of our  "known gateways"?
 			if gw, ok := isKnownHostname(host, knownGateways); ok {
 				// This is a known gateway but request is not using
 				// the subdomain feature.
+				r = withGatewaySpec(r, gw)
+
+				// Is this path mapped to content by a rewrite rule?
+				if contentPath, ok := rewritePath(gw.Rewrites, r.URL.Path); ok {
+					// the original path is kept for the links and
+					// redirects, as with DNSLink
+					r.URL.Path = contentPath
+					childMux.ServeHTTP(w, withHostnameContext(r, host))
+					return
+				}
 
 				// Does this gateway _handle_ this path?
 				if hasPrefix(r.URL.Path, gw.Paths...) {
@@ -109,6 +121,19 @@ func HostnameOption() ServeOption {
 				}
 				// Not a whitelisted path
 
+				// Is the hostname serving a fixed root?
+				if gw.Root != "" {
+					root, err := rootPath(gw.Root)
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusInternalServerError)
+						return
+					}
+					// rewrite path and handle as DNSLink
+					r.URL.Path = root + r.URL.Path
+					childMux.ServeHTTP(w, withHostnameContext(r, host))
+					return
+				}
+
 				// Try DNSLink, if it was not explicitly disabled for the hostname
 				if !gw.NoDNSLink && isDNSLinkName(r.Context(), coreAPI, host) {
 					// rewrite path and handle as DNSLink
@@ -128,6 +153,7 @@ func HostnameOption() ServeOption {
 			// /ipns/ example: {libp2p-key}.ipns.localhost:8080, {inlined-dnslink-fqdn}.ipns.dweb.link
 			if gw, gwHostname, ns, rootID, ok := knownSubdomainDetails(host, knownGateways); ok {
 				// Looks like we're using a known gateway in subdomain mode.
+				r = withGatewaySpec(r, gw)
 
 				// Assemble original path prefix.
 				pathPrefix := "/" + ns + "/" + rootID
@@ -240,6 +266,11 @@ type gatewayHosts struct {
 type wildcardHost struct {
 	re   *regexp.Regexp
 	spec *config.GatewaySpec
+
+	// the number of labels which are not wildcards, and of multi-level
+	// wildcards, ranking the hosts from the most specific
+	literals, multi int
+	pattern         string
 }
 
 // Extends request context to include hostname of a canonical gateway root
@@ -253,6 +284,17 @@ func withHostnameContext(r *http.Request, hostname string) *http.Request {
 	return r.WithContext(ctx)
 }
 
+// gatewaySpecKey is the context key of the spec of the known gateway serving
+// a request.
+type gatewaySpecKey struct{}
+
+// Extends request context to include the spec of the known gateway serving
+// the request, for the settings applied by the gateway handler (branding)
+func withGatewaySpec(r *http.Request, gw *config.GatewaySpec) *http.Request {
+	ctx := context.WithValue(r.Context(), gatewaySpecKey{}, gw)
+	return r.WithContext(ctx)
+}
+
 func prepareKnownGateways(publicGateways map[string]*config.GatewaySpec) gatewayHosts {
 	var hosts gatewayHosts
 
@@ -265,35 +307,103 @@ func prepareKnownGateways(publicGateways map[string]*config.GatewaySpec) gateway
 
 	// Then apply values from Gateway.PublicGateways, if present in the config
 	for hostname, gw := range publicGateways {
+		hostname = normalizeHostname(hostname)
 		if gw == nil {
 			// Remove any implicit defaults, if present. This is useful when one
 			// wants to disable subdomain gateway on localhost etc.
 			delete(hosts.exact, hostname)
 			continue
 		}
+		for _, rule := range gw.Rewrites {
+			if err := checkRewrite(rule); err != nil {
+				log.Warnf("ignoring invalid rewrite of gateway hostname %q: %s", hostname, err)
+			}
+		}
+		if gw.Root != "" {
+			if _, err := rootPath(gw.Root); err != nil {
+				log.Warnf("invalid root of gateway hostname %q: %s", hostname, err)
+			}
+		}
 		if strings.Contains(hostname, "*") {
-			// from *.domain.tld, construct a regexp that match any direct subdomain
-			// of .domain.tld.
-			//
-			// Regexp will be in the form of ^[^.]+\.domain.tld(?::\d+)?$
-
-			escaped := strings.ReplaceAll(hostname, ".", `\.`)
-			regexed := strings.ReplaceAll(escaped, "*", "[^.]+")
-
-			re, err := regexp.Compile(fmt.Sprintf(`^%s(?::\d+)?$`, regexed))
+			host, err := newWildcardHost(hostname, gw)
 			if err != nil {
-				log.Warn("invalid wildcard gateway hostname \"%s\"", hostname)
+				log.Warnf("invalid wildcard gateway hostname %q: %s", hostname, err)
+				continue
 			}
-
-			hosts.wildcard = append(hosts.wildcard, wildcardHost{re: re, spec: gw})
+			hosts.wildcard = append(hosts.wildcard, host)
 		} else {
 			hosts.exact[hostname] = gw
 		}
 	}
 
+	// a hostname matching several wildcards belongs to the most specific
+	sort.Slice(hosts.wildcard, func(i, j int) bool {
+		a, b := hosts.wildcard[i], hosts.wildcard[j]
+		if a.literals != b.literals {
+			return a.literals > b.literals
+		}
+		if a.multi != b.multi {
+			return a.multi < b.multi
+		}
+		return a.pattern < b.pattern
+	})
+
 	return hosts
 }
 
+// newWildcardHost parses a wildcard hostname, whose labels may be "*",
+// matching any single label, or "**", matching one or more labels. For
+// example, "*.corp.internal" matches "gw.corp.internal", and
+// "**.corp.internal" also matches "gw.eu.corp.internal". A "*" within a label
+// matches any part of a single label, as in "gw-*.corp.internal".
+func newWildcardHost(hostname string, gw *config.GatewaySpec) (wildcardHost, error) {
+	host := wildcardHost{spec: gw, pattern: hostname}
+	labels := strings.Split(hostname, ".")
+	for i, l := range labels {
+		switch {
+		case l == "**":
+			labels[i] = `[^.]+(?:\.[^.]+)*`
+			host.multi++
+		case l == "*":
+			labels[i] = `[^.]+`
+		case strings.Contains(l, "**"):
+			return wildcardHost{}, fmt.Errorf("multi-level wildcards must be whole labels")
+		case strings.Contains(l, "*"):
+			// foo-* matches any label starting with foo-
+			parts := strings.Split(l, "*")
+			for j, part := range parts {
+				parts[j] = regexp.QuoteMeta(part)
+			}
+			labels[i] = strings.Join(parts, `[^.]+`)
+			host.literals++
+		case l == "":
+			return wildcardHost{}, fmt.Errorf("empty label")
+		default:
+			labels[i] = regexp.QuoteMeta(l)
+			host.literals++
+		}
+	}
+
+	// Regexp will be in the form of ^[^.]+\.domain\.tld(?::\d+)?$
+	re, err := regexp.Compile(fmt.Sprintf(`^%s(?::\d+)?$`, strings.Join(labels, `\.`)))
+	if err != nil {
+		return wildcardHost{}, err
+	}
+	host.re = re
+	return host, nil
+}
+
+// normalizeHostname returns hostname in lower case and without the trailing
+// dot of fully qualified names, keeping its port if any: hostnames are case
+// insensitive, and "gw.corp.internal." is "gw.corp.internal".
+func normalizeHostname(hostname string) string {
+	hostname = strings.ToLower(hostname)
+	if host, port, err := net.SplitHostPort(hostname); err == nil && strings.HasSuffix(host, ".") {
+		return net.JoinHostPort(strings.TrimSuffix(host, "."), port)
+	}
+	return strings.TrimSuffix(hostname, ".")
+}
+
 // isKnownHostname checks Gateway.PublicGateways and returns matching
 // GatewaySpec with graceful fallback to version without port
 func isKnownHostname(hostname string, knownGateways gatewayHosts) (gw *config.GatewaySpec, ok bool) {
@@ -574,6 +684,53 @@ func toSubdomainURL(hostname, path string, r *http.Request, ipfs iface.CoreAPI)
 	))
 }
 
+// checkRewrite checks that a rewrite rule maps a path to an /ipfs/ or /ipns/
+// path.
+func checkRewrite(rule config.GatewayRewrite) error {
+	from := strings.TrimSuffix(rule.From, "/*")
+	if !strings.HasPrefix(rule.From, "/") || strings.Contains(from, "*") {
+		return fmt.Errorf("From %q must be a path, optionally ending with /*", rule.From)
+	}
+	if !hasPrefix(rule.To, "/ipfs/", "/ipns/") || len(strings.Split(strings.Trim(rule.To, "/"), "/")) < 2 {
+		return fmt.Errorf("To %q must be an /ipfs/ or /ipns/ path", rule.To)
+	}
+	return nil
+}
+
+// rewritePath returns the content path p is mapped to by the first of rules
+// matching it, if any. Invalid rules are skipped.
+func rewritePath(rules []config.GatewayRewrite, p string) (string, bool) {
+	for _, rule := range rules {
+		if checkRewrite(rule) != nil {
+			continue
+		}
+		from := strings.TrimSuffix(rule.From, "/*")
+		if from == rule.From {
+			if p == from {
+				return rule.To, true
+			}
+			continue
+		}
+		// "/docs/*" matches "/docs", "/docs/" and the paths below
+		if p == from || strings.HasPrefix(p, from+"/") {
+			return strings.TrimSuffix(rule.To, "/") + p[len(from):], true
+		}
+	}
+	return "", false
+}
+
+// rootPath returns the content path of the root of a hostname, an /ipfs/ or
+// /ipns/ path, or a CID, without a trailing slash.
+func rootPath(root string) (string, error) {
+	if c, err := cid.Decode(root); err == nil {
+		return "/ipfs/" + c.String(), nil
+	}
+	if !hasPrefix(root, "/ipfs/", "/ipns/") || len(strings.Split(strings.Trim(root, "/"), "/")) < 2 {
+		return "", fmt.Errorf("Root %q must be an /ipfs/ or /ipns/ path, or a CID", root)
+	}
+	return strings.TrimSuffix(root, "/"), nil
+}
+
 func hasPrefix(path string, prefixes ...string) bool {
 	for _, prefix := range prefixes {
 		// Assume people are creative with trailing slashes in Gateway config
@@ -2,8 +2,10 @@ package corehttp
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	cid "github.com/ipfs/go-cid"
@@ -213,6 +215,10 @@ func TestKnownSubdomainDetails(t *testing.T) {
 	gwLong := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
 	gwWildcard1 := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
 	gwWildcard2 := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
+	gwCorp := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
+	gwMulti := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
+	gwMultiEU := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
+	gwPartial := &config.GatewaySpec{Paths: []string{"/ipfs", "/ipns", "/api"}, UseSubdomains: true}
 
 	knownGateways := prepareKnownGateways(map[string]*config.GatewaySpec{
 		"localhost":               gwLocalhost,
@@ -221,6 +227,11 @@ func TestKnownSubdomainDetails(t *testing.T) {
 		"dweb.ipfs.pvt.k12.ma.us": gwLong, // note the sneaky ".ipfs." ;-)
 		"*.wildcard1.tld":         gwWildcard1,
 		"*.*.wildcard2.tld":       gwWildcard2,
+		"GW.Corp.Internal.":       gwCorp,
+		"**.multi.internal":       gwMulti,
+		"**.eu.multi.internal":    gwMultiEU,
+		"gw-*.multi.internal":     gwPartial,
+		"gw**.multi.internal":     gwPartial,
 	})
 
 	for _, test := range []struct {
@@ -277,8 +288,20 @@ func TestKnownSubdomainDetails(t *testing.T) {
 		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.sub.wildcard1.tld", gwWildcard1, "sub.wildcard1.tld", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
 		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.sub1.sub2.wildcard1.tld", nil, "", "", "", false},
 		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.sub1.sub2.wildcard2.tld", gwWildcard2, "sub1.sub2.wildcard2.tld", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		// internal hostnames, matched in lower case without the trailing dot
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw.corp.internal", gwCorp, "gw.corp.internal", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		{"en.wikipedia-on-ipfs.org.ipns.gw.corp.internal:8080", gwCorp, "gw.corp.internal:8080", "ipns", "en.wikipedia-on-ipfs.org", true},
+		// multi-level wildcards, the most specific matching
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.multi.internal", nil, "", "", "", false},
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw.multi.internal", gwMulti, "gw.multi.internal", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw.us.multi.internal", gwMulti, "gw.us.multi.internal", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw.paris.eu.multi.internal:8080", gwMultiEU, "gw.paris.eu.multi.internal:8080", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		// wildcards within a label are more specific, and multi-level ones
+		// must be whole labels
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw-eu.multi.internal", gwPartial, "gw-eu.multi.internal", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
+		{"bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am.ipfs.gw.eu.multi.internal", gwMultiEU, "gw.eu.multi.internal", "ipfs", "bafkreicysg23kiwv34eg2d7qweipxwosdo2py4ldv42nbauguluen5v6am", true},
 	} {
-		gw, hostname, ns, rootID, ok := knownSubdomainDetails(test.hostHeader, knownGateways)
+		gw, hostname, ns, rootID, ok := knownSubdomainDetails(normalizeHostname(test.hostHeader), knownGateways)
 		if ok != test.ok {
 			t.Errorf("knownSubdomainDetails(%s): ok is %t, expected %t", test.hostHeader, ok, test.ok)
 		}
@@ -301,3 +324,227 @@ func TestKnownSubdomainDetails(t *testing.T) {
 func equalError(a, b error) bool {
 	return (a == nil && b == nil) || (a != nil && b != nil && a.Error() == b.Error())
 }
+
+func TestRewritePath(t *testing.T) {
+	rules := []config.GatewayRewrite{
+		{From: "/docs/*", To: "/ipfs/bafkqaaa/site/docs/"},
+		{From: "/blog", To: "/ipns/blog.example.com"},
+		{From: "/bad/*", To: "/docs"},
+		{From: "/*", To: "/ipns/www.example.com"},
+	}
+	for p, expected := range map[string]string{
+		"/docs":          "/ipfs/bafkqaaa/site/docs",
+		"/docs/":         "/ipfs/bafkqaaa/site/docs/",
+		"/docs/a/b.html": "/ipfs/bafkqaaa/site/docs/a/b.html",
+		"/docsify":       "/ipns/www.example.com/docsify",
+		"/blog":          "/ipns/blog.example.com",
+		"/blog/post":     "/ipns/www.example.com/blog/post",
+		"/bad/x":         "/ipns/www.example.com/bad/x",
+		"/":              "/ipns/www.example.com/",
+	} {
+		if out, ok := rewritePath(rules, p); !ok || out != expected {
+			t.Errorf("%s: expected %s, got %q (%t)", p, expected, out, ok)
+		}
+	}
+	if _, ok := rewritePath(rules[:2], "/other"); ok {
+		t.Error("expected /other not to be rewritten")
+	}
+
+	for _, rule := range []config.GatewayRewrite{
+		{From: "docs", To: "/ipfs/bafkqaaa"},
+		{From: "/d*cs/*", To: "/ipfs/bafkqaaa"},
+		{From: "/docs", To: "/ipfs/"},
+		{From: "/docs", To: "https://example.com"},
+	} {
+		if checkRewrite(rule) == nil {
+			t.Errorf("expected %+v to be invalid", rule)
+		}
+	}
+}
+
+func TestGatewayRewrites(t *testing.T) {
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"docs": files.NewMapDirectory(map[string]files.Node{
+			"intro.txt": files.NewBytesFile([]byte("intro")),
+			"sub": files.NewMapDirectory(map[string]files.Node{
+				"a.txt": files.NewBytesFile([]byte("a")),
+			}),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	home, err := api.Unixfs().Add(n.Context(), files.NewBytesFile([]byte("home")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/www.example.com"] = path.FromString(home.String())
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.PublicGateways = map[string]*config.GatewaySpec{
+		"example.com": {
+			Paths: []string{"/ipfs"},
+			Rewrites: []config.GatewayRewrite{
+				{From: "/docs/*", To: docs.String() + "/docs"},
+				{From: "/", To: "/ipns/www.example.com"},
+			},
+		},
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, HostnameOption(), GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(p string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = "example.com"
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(body)
+	}
+
+	for p, expected := range map[string]string{
+		"/docs/intro.txt": "intro",
+		"/docs/sub/a.txt": "a",
+		"/":               "home",
+	} {
+		if res, body := get(p); res.StatusCode != http.StatusOK || body != expected {
+			t.Errorf("%s: expected %q, got %d %q", p, expected, res.StatusCode, body)
+		}
+	}
+
+	// the links of the listings keep the path of the hostname
+	if _, body := get("/docs/sub/"); !strings.Contains(body, `href="/docs/sub/a.txt"`) {
+		t.Errorf("expected the listing to link to /docs/sub/a.txt, got %s", body)
+	}
+
+	// the paths of the hostname are still served, the others are not
+	if res, body := get(docs.String() + "/docs/intro.txt"); res.StatusCode != http.StatusOK || body != "intro" {
+		t.Errorf("expected the /ipfs path to be served, got %d %q", res.StatusCode, body)
+	}
+	if res, _ := get("/other"); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 response, got %d", res.StatusCode)
+	}
+}
+
+func TestRootPath(t *testing.T) {
+	for root, expected := range map[string]string{
+		"/ipns/docs.example.com": "/ipns/docs.example.com",
+		"/ipfs/bafkqaaa/site/":   "/ipfs/bafkqaaa/site",
+		"bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi": "/ipfs/bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi",
+	} {
+		if out, err := rootPath(root); err != nil || out != expected {
+			t.Errorf("%s: expected %s, got %q (%v)", root, expected, out, err)
+		}
+	}
+	for _, root := range []string{"/ipfs/", "docs.example.com", "https://example.com"} {
+		if _, err := rootPath(root); err == nil {
+			t.Errorf("expected %q to be invalid", root)
+		}
+	}
+}
+
+func TestGatewayRoot(t *testing.T) {
+	ns := mockNamesys{}
+	n, err := newNodeWithMockNamesys(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := coreapi.NewCoreAPI(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, err := api.Unixfs().Add(n.Context(), files.NewMapDirectory(map[string]files.Node{
+		"index.html": files.NewBytesFile([]byte("home")),
+		"guide": files.NewMapDirectory(map[string]files.Node{
+			"intro.txt": files.NewBytesFile([]byte("intro")),
+		}),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns["/ipns/docs.example.com"] = path.FromString(site.String())
+
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Gateway.PublicGateways = map[string]*config.GatewaySpec{
+		"docs.example.com": {Root: site.Root().String()},
+		"ipns.example.com": {Paths: []string{"/ipfs"}, Root: "/ipns/docs.example.com"},
+	}
+
+	dh := &delegatedHandler{}
+	ts := httptest.NewServer(dh)
+	defer ts.Close()
+	dh.Handler, err = makeHandler(n, ts.Listener, HostnameOption(), GatewayOption(false, "/ipfs", "/ipns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(host, p string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+p, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+		res, err := doWithoutRedirect(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res, string(body)
+	}
+
+	for _, host := range []string{"docs.example.com", "ipns.example.com"} {
+		for p, expected := range map[string]string{
+			"/":                "home",
+			"/guide/intro.txt": "intro",
+		} {
+			if res, body := get(host, p); res.StatusCode != http.StatusOK || body != expected {
+				t.Errorf("%s%s: expected %q, got %d %q", host, p, expected, res.StatusCode, body)
+			}
+		}
+	}
+
+	// the links of the listings keep the path of the hostname
+	if _, body := get("docs.example.com", "/guide/"); !strings.Contains(body, `href="/guide/intro.txt"`) {
+		t.Errorf("expected the listing to link to /guide/intro.txt, got %s", body)
+	}
+	// the paths of the hostname are still served
+	if res, body := get("ipns.example.com", site.String()+"/guide/intro.txt"); res.StatusCode != http.StatusOK || body != "intro" {
+		t.Errorf("expected the /ipfs path to be served, got %d %q", res.StatusCode, body)
+	}
+}
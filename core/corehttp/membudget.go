@@ -0,0 +1,57 @@
+package corehttp
+
+import (
+	"net/http"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/membudget"
+)
+
+// unbudgetedCommands are the RPC commands served even when the node is over
+// its memory budget, so that it can still be inspected and shut down.
+var unbudgetedCommands = []string{
+	"diag/*",
+	"log/*",
+	"shutdown",
+	"stats/*",
+	"version",
+}
+
+// withMemoryBudget holds the requests served by next back while the node is
+// under memory pressure, and answers 503 Service Unavailable if the pressure
+// lasts. When isBudgeted is not nil, only the requests it returns true for
+// are held back.
+func withMemoryBudget(n *core.IpfsNode, next http.Handler, isBudgeted func(r *http.Request) bool) http.Handler {
+	if n.MemoryBudget == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || (isBudgeted != nil && !isBudgeted(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := n.MemoryBudget.Wait(r.Context()); err != nil {
+			if err == membudget.ErrOverBudget {
+				w.Header().Set("Retry-After", "10")
+				http.Error(w, "503 - Service Unavailable: node is over its memory budget", http.StatusServiceUnavailable)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isBudgetedCommand reports whether r calls a command held back by the memory
+// budget.
+func isBudgetedCommand(r *http.Request) bool {
+	cmd := strings.Trim(strings.TrimPrefix(r.URL.Path, APIPath), "/")
+	for _, p := range unbudgetedCommands {
+		if matchCommand(p, cmd) {
+			return false
+		}
+	}
+	return true
+}
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"go.opencensus.io/stats/view"
 	"go.opencensus.io/zpages"
 
@@ -134,6 +136,51 @@ var (
 		[]string{"transport"},
 		nil,
 	)
+
+	tenantBytesStoredMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tenant", "bytes_stored_total"),
+		"Bytes of the new blocks stored by each API authorization",
+		[]string{"tenant"},
+		nil,
+	)
+	tenantBytesServedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tenant", "bytes_served_total"),
+		"Bytes served by the API and the gateway to each API authorization",
+		[]string{"tenant"},
+		nil,
+	)
+	tenantPinsMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "tenant", "pins"),
+		"Number of pins owned by each API authorization",
+		[]string{"tenant"},
+		nil,
+	)
+
+	updateAvailableMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "update", "available"),
+		"Whether the latest version of go-ipfs is newer than the running one",
+		[]string{"latest"},
+		nil,
+	)
+
+	dhtServingMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "serving"),
+		"Whether each DHT answers the queries of other peers (server mode)",
+		[]string{"dht"},
+		nil,
+	)
+	dhtPeersMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "routing_table_peers"),
+		"Number of peers in the routing table of each DHT",
+		[]string{"dht"},
+		nil,
+	)
+	dhtServedMetric = prometheus.NewDesc(
+		prometheus.BuildFQName("ipfs", "dht", "served_requests_total"),
+		"Requests served by each DHT, by message type",
+		[]string{"dht", "type"},
+		nil,
+	)
 )
 
 type IpfsNodeCollector struct {
@@ -142,6 +189,13 @@ type IpfsNodeCollector struct {
 
 func (_ IpfsNodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- peersTotalMetric
+	ch <- tenantBytesStoredMetric
+	ch <- tenantBytesServedMetric
+	ch <- tenantPinsMetric
+	ch <- updateAvailableMetric
+	ch <- dhtServingMetric
+	ch <- dhtPeersMetric
+	ch <- dhtServedMetric
 }
 
 func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
@@ -153,6 +207,45 @@ func (c IpfsNodeCollector) Collect(ch chan<- prometheus.Metric) {
 			tr,
 		)
 	}
+
+	if c.Node.Tenants != nil {
+		for tenant, u := range c.Node.Tenants.Usage() {
+			ch <- prometheus.MustNewConstMetric(tenantBytesStoredMetric, prometheus.CounterValue, float64(u.BytesStored), tenant)
+			ch <- prometheus.MustNewConstMetric(tenantBytesServedMetric, prometheus.CounterValue, float64(u.BytesServed), tenant)
+			ch <- prometheus.MustNewConstMetric(tenantPinsMetric, prometheus.GaugeValue, float64(u.Pins), tenant)
+		}
+	}
+
+	if c.Node.UpdateChecker != nil {
+		// only once the latest version is known
+		if st := c.Node.UpdateChecker.Status(); st.Latest != "" {
+			available := 0.0
+			if st.Available {
+				available = 1
+			}
+			ch <- prometheus.MustNewConstMetric(updateAvailableMetric, prometheus.GaugeValue, available, st.Latest)
+		}
+	}
+
+	if c.Node.DHT != nil {
+		for name, d := range map[string]*dht.IpfsDHT{"wan": c.Node.DHT.WAN, "lan": c.Node.DHT.LAN} {
+			serving := 0.0
+			if libp2p.DHTServing(c.Node.PeerHost, name == "lan") {
+				serving = 1
+			}
+			ch <- prometheus.MustNewConstMetric(dhtServingMetric, prometheus.GaugeValue, serving, name)
+			ch <- prometheus.MustNewConstMetric(dhtPeersMetric, prometheus.GaugeValue, float64(d.RoutingTable().Size()), name)
+
+			served, err := libp2p.DHTServed(d)
+			if err != nil {
+				log.Errorf("collecting the requests served by the %s DHT: %s", name, err)
+				continue
+			}
+			for msgType, n := range served {
+				ch <- prometheus.MustNewConstMetric(dhtServedMetric, prometheus.CounterValue, float64(n), name, msgType)
+			}
+		}
+	}
 }
 
 func (c IpfsNodeCollector) PeersTotalValues() map[string]float64 {
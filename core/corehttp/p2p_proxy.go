@@ -1,12 +1,15 @@
 package corehttp
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	core "github.com/ipfs/go-ipfs/core"
 	peer "github.com/libp2p/go-libp2p-core/peer"
@@ -15,9 +18,19 @@ import (
 	p2phttp "github.com/libp2p/go-libp2p-http"
 )
 
+// defaultP2PProxyTimeout is the time the peers have to answer the requests
+// proxied to them, unless Experimental.P2pHttpProxyTimeout is set.
+const defaultP2PProxyTimeout = 30 * time.Second
+
 // P2PProxyOption is an endpoint for proxying a HTTP request to another ipfs peer
 func P2PProxyOption() ServeOption {
 	return func(ipfsNode *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		cfg, err := ipfsNode.Repo.Config()
+		if err != nil {
+			return nil, err
+		}
+		timeout := cfg.Experimental.P2pHttpProxyTimeout.WithDefault(defaultP2PProxyTimeout)
+
 		mux.HandleFunc("/p2p/", func(w http.ResponseWriter, request *http.Request) {
 			// parse request
 			parsedRequest, err := parseRequest(request)
@@ -26,6 +39,25 @@ func P2PProxyOption() ServeOption {
 				return
 			}
 
+			// the peer has timeout to answer, and then to send the body as
+			// long as the client reads it
+			ctx, cancel := context.WithCancel(request.Context())
+			defer cancel()
+			var timedOut int32
+			timer := time.AfterFunc(timeout, func() {
+				atomic.StoreInt32(&timedOut, 1)
+				cancel()
+			})
+			defer timer.Stop()
+
+			// tell the peer where the request was sent to
+			request.Header.Set("X-Forwarded-Host", request.Host)
+			if request.TLS == nil {
+				request.Header.Set("X-Forwarded-Proto", "http")
+			} else {
+				request.Header.Set("X-Forwarded-Proto", "https")
+			}
+			request = request.WithContext(ctx)
 			request.Host = "" // Let URL's Host take precedence.
 			request.URL.Path = parsedRequest.httpPath
 			target, err := url.Parse(fmt.Sprintf("libp2p://%s", parsedRequest.target))
@@ -34,15 +66,56 @@ func P2PProxyOption() ServeOption {
 				return
 			}
 
-			rt := p2phttp.NewTransport(ipfsNode.PeerHost, p2phttp.ProtocolOption(parsedRequest.name))
+			rt := ctxRoundTripper{p2phttp.NewTransport(ipfsNode.PeerHost, p2phttp.ProtocolOption(parsedRequest.name))}
 			proxy := httputil.NewSingleHostReverseProxy(target)
 			proxy.Transport = rt
+			proxy.ModifyResponse = func(*http.Response) error {
+				timer.Stop()
+				return nil
+			}
+			proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+				if atomic.LoadInt32(&timedOut) != 0 {
+					handleError(w, "peer did not answer in time", err, http.StatusGatewayTimeout)
+					return
+				}
+				handleError(w, "failed to proxy request", err, http.StatusBadGateway)
+			}
 			proxy.ServeHTTP(w, request)
 		})
 		return mux, nil
 	}
 }
 
+// ctxRoundTripper stops waiting for the response when the context of the
+// request is done, which the p2phttp transport only checks when dialing.
+type ctxRoundTripper struct {
+	http.RoundTripper
+}
+
+func (rt ctxRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := rt.RoundTripper.RoundTrip(r)
+		done <- result{resp, err}
+	}()
+	select {
+	case res := <-done:
+		return res.resp, res.err
+	case <-r.Context().Done():
+		go func() {
+			// closes the stream once the response comes
+			if res := <-done; res.err == nil {
+				res.resp.Body.Close()
+			}
+		}()
+		return nil, r.Context().Err()
+	}
+}
+
 type proxyRequest struct {
 	target   string
 	name     protocol.ID
@@ -1,9 +1,12 @@
 package corehttp
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-ipfs/thirdparty/assert"
 
@@ -54,3 +57,42 @@ func TestParseRequestInvalidPath(t *testing.T) {
 		}
 	}
 }
+
+// stuckRoundTripper answers once released, whatever the context.
+type stuckRoundTripper struct {
+	release chan struct{}
+	closed  chan struct{}
+}
+
+type closeNotifier struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c closeNotifier) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func (rt stuckRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	<-rt.release
+	return &http.Response{StatusCode: http.StatusOK, Body: closeNotifier{strings.NewReader(""), rt.closed}}, nil
+}
+
+func TestCtxRoundTripper(t *testing.T) {
+	stuck := stuckRoundTripper{release: make(chan struct{}), closed: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "libp2p://peer/index.txt", nil)
+	if _, err := (ctxRoundTripper{stuck}).RoundTrip(req); err != context.DeadlineExceeded {
+		t.Fatalf("expected the round trip to stop with its context, got %v", err)
+	}
+
+	// the response coming late is closed
+	close(stuck.release)
+	select {
+	case <-stuck.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the late response closed")
+	}
+}
@@ -0,0 +1,66 @@
+package corehttp
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	core "github.com/ipfs/go-ipfs/core"
+)
+
+// ProfileHistoryOption serves the snapshots of the profiles the node takes
+// on a schedule: the timeline of their summaries as JSON at path, and the
+// profiles of a snapshot at path/<snapshot>/<profile>, for 'go tool pprof'.
+func ProfileHistoryOption(path string) ServeOption {
+	return func(n *core.IpfsNode, _ net.Listener, mux *http.ServeMux) (*http.ServeMux, error) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if n.ProfileHistory == nil {
+				http.Error(w, "profiling disabled in config (Profiling.Enabled)", http.StatusNotFound)
+				return
+			}
+
+			rest := strings.Trim(strings.TrimPrefix(r.URL.Path, path), "/")
+			if rest == "" {
+				snapshots, err := n.ProfileHistory.History()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(snapshots)
+				return
+			}
+
+			parts := strings.Split(rest, "/")
+			if len(parts) != 2 {
+				http.NotFound(w, r)
+				return
+			}
+			f, err := n.ProfileHistory.Open(parts[0], parts[1])
+			if err != nil {
+				if os.IsNotExist(err) {
+					http.NotFound(w, r)
+				} else {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+				}
+				return
+			}
+			defer f.Close()
+			fi, err := f.Stat()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+parts[0]+"-"+parts[1]+`"`)
+			http.ServeContent(w, r, "", fi.ModTime(), f)
+		})
+		return mux, nil
+	}
+}
@@ -0,0 +1,72 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	cmds "github.com/ipfs/go-ipfs-cmds"
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/commands/cmdutils"
+)
+
+// withReadOnly answers 403 Forbidden to the requests calling a command of
+// root changing the repo when the node is read-only: the commands marked with
+// cmdutils.SetChangesRepo, which change the blocks, pins, MFS or mounts of
+// the node, or publish records.
+func withReadOnly(n *core.IpfsNode, root *cmds.Command, next http.Handler) http.Handler {
+	if !n.IsReadOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if changesRepo(root, r) {
+			http.Error(w, "403 - Forbidden: node is read-only", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// changesRepo reports whether r calls a command of root, or a subcommand of
+// one, marked as changing the repo, with the options it is marked with if
+// any. The requests calling no command are reported as changing it.
+func changesRepo(root *cmds.Command, r *http.Request) bool {
+	call, ok := parseCall(root, r)
+	if !ok {
+		return true
+	}
+	query := r.URL.Query()
+	for _, c := range call.chain {
+		options, ok := cmdutils.GetChangesRepo(c.Extra)
+		if !ok {
+			continue
+		}
+		if len(options) == 0 {
+			return true
+		}
+		for _, name := range options {
+			if optionSet(c, name, query) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// optionSet reports whether the boolean option name of c is set to true in
+// query, by any of its names.
+func optionSet(c *cmds.Command, name string, query url.Values) bool {
+	for _, opt := range c.Options {
+		if opt.Name() != name {
+			continue
+		}
+		for _, n := range opt.Names() {
+			for _, v := range query[n] {
+				if set, err := strconv.ParseBool(v); err == nil && set {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package corehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corecommands "github.com/ipfs/go-ipfs/core/commands"
+)
+
+func TestChangesRepo(t *testing.T) {
+	for _, tc := range []struct {
+		path    string
+		changes bool
+	}{
+		{"/api/v0/add", true},
+		{"/api/v0/cat", false},
+		{"/api/v0/pin/add", true},
+		{"/api/v0/pin/add/bafkqaaa", true},
+		{"/api/v0/pin/add/", true},
+		{"/api/v0/pin/ls", false},
+		{"/api/v0/files/mkdir", true},
+		{"/api/v0/files/ls", false},
+		{"/api/v0/files/rm/foo", true},
+		{"/api/v0/files/ls/foo", false},
+		{"/api/v0/object/patch/add-link", true},
+		{"/api/v0/repo/compress", true},
+		{"/api/v0/repo/migrate-to", true},
+		{"/api/v0/repo/stat", false},
+		{"/api/v0/cid/audit", false},
+		{"/api/v0/cid/audit?upgrade=false", false},
+		{"/api/v0/cid/audit?upgrade=true", true},
+		{"/api/v0/files/fsck", false},
+		{"/api/v0/files/fsck?repair=true", true},
+		{"/api/v0/pin", true},
+		{"/api/v0/unknown", true},
+		{"/api/v0/unknown/add", true},
+		{"/api/v0/pin//add", true},
+	} {
+		r := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		if c := changesRepo(corecommands.Root, r); c != tc.changes {
+			t.Errorf("%s: changes the repo %t, expected %t", tc.path, c, tc.changes)
+		}
+	}
+}
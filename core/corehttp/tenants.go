@@ -0,0 +1,60 @@
+package corehttp
+
+import (
+	"io"
+	"net/http"
+
+	config "github.com/ipfs/go-ipfs/config"
+	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/tenants"
+)
+
+// withTenantUsage accounts for the bytes served by next to the tenant of each
+// request. The requests without a tenant, such as those of the gateway, are
+// accounted to the authorization of auths whose secret they carry, if any.
+func withTenantUsage(n *core.IpfsNode, next http.Handler, auths map[string]*config.RPCAuthScope) http.Handler {
+	if n.Tenants == nil {
+		return next
+	}
+	ah := &authorizedHandler{auths: staticAuthorizations(auths)}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := tenants.FromContext(r.Context())
+		if tenant == "" {
+			if tenant, _ = ah.authorize(r.Header.Get("Authorization")); tenant == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r = r.WithContext(tenants.WithTenant(r.Context(), tenant))
+		}
+
+		cw := &countingResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		n.Tenants.Served(tenant, cw.n)
+	})
+}
+
+// countingResponseWriter counts the bytes of the response body.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// ReadFrom passes the copies on to the ResponseWriter, which sends the files
+// with sendfile.
+func (w *countingResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := io.Copy(w.ResponseWriter, r)
+	w.n += n
+	return n, err
+}
+
+func (w *countingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
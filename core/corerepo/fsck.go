@@ -0,0 +1,303 @@
+package corerepo
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/maintenance"
+
+	bserv "github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+// The checks of Fsck.
+const (
+	FsckPins          = "pins"
+	FsckProviderQueue = "provider-queue"
+	FsckMFS           = "mfs"
+	FsckDatastore     = "datastore"
+)
+
+// FsckProblem is an inconsistency of the repo found by Fsck.
+type FsckProblem struct {
+	// Check is the check which found the problem.
+	Check string
+	// Message describes the problem.
+	Message string
+	// Repaired is set if Fsck repaired the problem.
+	Repaired bool
+}
+
+// Fsck checks the consistency of the repo of n, which may be running, and
+// repairs what it safely can: the pins, the provider queue, the reachability
+// of the MFS root and the keys of the blockstore. Each problem found is
+// passed to report, Fsck stops if report fails.
+//
+// Garbage collection waits for Fsck, so that blocks do not go missing while
+// they are checked.
+func Fsck(ctx context.Context, n *core.IpfsNode, report func(FsckProblem) error) error {
+	unlocker := n.Blockstore.PinLock(ctx)
+	defer unlocker.Unlock(ctx)
+
+	bs := iothrottle.NewBlockstore(n.Blockstore, n.Maintenance.Limiter(maintenance.Scrub, n.BackgroundIO))
+	f := &fsck{
+		n:       n,
+		bs:      bs,
+		dag:     dag.NewDAGService(bserv.New(bs, offline.Exchange(bs))),
+		visited: cid.NewSet(),
+		report:  report,
+	}
+	for _, check := range []func(context.Context) error{
+		f.checkPins,
+		f.checkProviderQueue,
+		f.checkMFS,
+		f.checkDatastore,
+	} {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type fsck struct {
+	n *core.IpfsNode
+	// bs is the blockstore of n, throttled as a background job
+	bs bstore.Blockstore
+	// dag is offline, the local blocks are checked
+	dag ipld.DAGService
+	// visited are the blocks found complete, with all their descendants
+	visited *cid.Set
+	report  func(FsckProblem) error
+}
+
+func (f *fsck) problem(check string, repaired bool, format string, args ...interface{}) error {
+	return f.report(FsckProblem{Check: check, Message: fmt.Sprintf(format, args...), Repaired: repaired})
+}
+
+// missing returns the first block of the DAG of root missing locally, or
+// cid.Undef if the DAG is complete.
+func (f *fsck) missing(ctx context.Context, root cid.Cid) (cid.Cid, error) {
+	if f.visited.Has(root) {
+		return cid.Undef, nil
+	}
+	walked := cid.NewSet()
+	missing := cid.Undef
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := dag.GetLinksDirect(f.dag)(ctx, c)
+		if ipld.IsNotFound(err) {
+			missing = c
+		}
+		return links, err
+	}
+	err := dag.Walk(ctx, getLinks, root, func(c cid.Cid) bool {
+		return !f.visited.Has(c) && walked.Visit(c)
+	})
+	if missing.Defined() {
+		return missing, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	_ = walked.ForEach(func(c cid.Cid) error {
+		f.visited.Add(c)
+		return nil
+	})
+	return cid.Undef, nil
+}
+
+// checkPins checks that the DAGs of the recursive pins and the roots of the
+// other pins are present, and drops the pins made redundant.
+func (f *fsck) checkPins(ctx context.Context) error {
+	pinner := f.n.Pinning
+
+	recursive, err := pinner.RecursiveKeys(ctx)
+	if err != nil {
+		return err
+	}
+	recursiveSet := cid.NewSet()
+	for _, c := range recursive {
+		recursiveSet.Add(c)
+		m, err := f.missing(ctx, c)
+		if err != nil {
+			return err
+		}
+		if m.Defined() {
+			if err := f.problem(FsckPins, false, "recursive pin %s is missing block %s", c, m); err != nil {
+				return err
+			}
+		}
+	}
+
+	direct, err := pinner.DirectKeys(ctx)
+	if err != nil {
+		return err
+	}
+	directSet := cid.NewSet()
+	unpinned := false
+	for _, c := range direct {
+		directSet.Add(c)
+		if recursiveSet.Has(c) {
+			// the recursive pin keeps the block already
+			pinner.RemovePinWithMode(c, pin.Direct)
+			unpinned = true
+			if err := f.problem(FsckPins, true, "direct pin %s is also pinned recursively, removed the direct pin", c); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := f.checkRoot(ctx, c, "direct pin"); err != nil {
+			return err
+		}
+	}
+	if unpinned {
+		if err := pinner.Flush(ctx); err != nil {
+			return err
+		}
+	}
+
+	lazy, err := f.n.LazyPins.Roots(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range lazy {
+		switch {
+		case recursiveSet.Has(c):
+			// filled already
+			if _, err := f.n.LazyPins.Remove(ctx, c); err != nil {
+				return err
+			}
+			if err := f.problem(FsckPins, true, "lazy pin %s is pinned recursively, removed the lazy pin", c); err != nil {
+				return err
+			}
+		case !directSet.Has(c):
+			if err := f.problem(FsckPins, false, "lazy pin %s has no direct pin of its root", c); err != nil {
+				return err
+			}
+		}
+	}
+
+	selector, err := f.n.SelectorPins.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range selector {
+		if err := f.checkRoot(ctx, p.Root, "selector pin"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fsck) checkRoot(ctx context.Context, c cid.Cid, kind string) error {
+	has, err := f.bs.Has(ctx, c)
+	if err != nil {
+		return err
+	}
+	if !has {
+		return f.problem(FsckPins, false, "%s %s is missing its root", kind, c)
+	}
+	return nil
+}
+
+// checkProviderQueue drops the entries of the provider queue which are not
+// CIDs, or whose blocks are not present anymore.
+func (f *fsck) checkProviderQueue(ctx context.Context) error {
+	d := f.n.Repo.Datastore()
+	res, err := d.Query(ctx, dsq.Query{Prefix: node.ProviderQueuePrefix.String()})
+	if err != nil {
+		return err
+	}
+	// the entries are deleted once all queried
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		k := ds.NewKey(e.Key)
+		c, err := cid.Cast(e.Value)
+		msg := ""
+		if err != nil {
+			msg = fmt.Sprintf("entry %s is not a CID", k)
+		} else if has, err := f.bs.Has(ctx, c); err != nil {
+			return err
+		} else if !has {
+			msg = fmt.Sprintf("entry %s is for %s, which is not present", k, c)
+		}
+		if msg == "" {
+			continue
+		}
+		// the entry may be dequeued meanwhile, deleting it is harmless
+		if err := d.Delete(ctx, k); err != nil {
+			return err
+		}
+		if err := f.problem(FsckProviderQueue, true, "%s, removed it", msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMFS checks that the DAG of the MFS root is present.
+func (f *fsck) checkMFS(ctx context.Context) error {
+	if f.n.FilesRoot == nil {
+		return nil
+	}
+	nd, err := f.n.FilesRoot.GetDirectory().GetNode()
+	if err != nil {
+		return err
+	}
+	m, err := f.missing(ctx, nd.Cid())
+	if err != nil {
+		return err
+	}
+	if m.Defined() {
+		return f.problem(FsckMFS, false, "MFS root %s is missing block %s", nd.Cid(), m)
+	}
+	return nil
+}
+
+// checkDatastore checks the datastore, if it can, and that the keys of the
+// blockstore are multihashes.
+func (f *fsck) checkDatastore(ctx context.Context) error {
+	d := f.n.Repo.Datastore()
+	if cd, ok := d.(ds.CheckedDatastore); ok {
+		if err := cd.Check(ctx); err != nil {
+			if err := f.problem(FsckDatastore, false, "%s", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	res, err := d.Query(ctx, dsq.Query{Prefix: bstore.BlockPrefix.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		// not repaired: no CID reaches the key, and the datastore may not
+		// locate it either, e.g. a file in the wrong directory of flatfs
+		if _, err := dshelp.DsKeyToMultihash(ds.NewKey(path.Base(r.Key))); err != nil {
+			if err := f.problem(FsckDatastore, false, "blockstore key %s is not a multihash", r.Key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
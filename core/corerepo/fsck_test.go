@@ -0,0 +1,98 @@
+package corerepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/pinning/lazypin"
+	"github.com/ipfs/go-ipfs/repo"
+
+	"github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	config "github.com/ipfs/go-ipfs/config"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestFsck(t *testing.T) {
+	ctx := context.Background()
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: "QmTFauExutTsy4XP6JbMFcw2Wa9645HJt2bTqL6qYDCKfe", // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	n, err := core.NewNode(ctx, &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(expected map[string]bool) {
+		t.Helper()
+		found := make(map[string]bool)
+		err := Fsck(ctx, n, func(p FsckProblem) error {
+			found[p.Message] = p.Repaired
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != len(expected) {
+			t.Fatalf("expected %v, found %v", expected, found)
+		}
+		for msg, repaired := range expected {
+			if rep, ok := found[msg]; !ok || rep != repaired {
+				t.Fatalf("expected %v, found %v", expected, found)
+			}
+		}
+	}
+	check(nil)
+
+	// a recursive pin with a missing child
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.DAG.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+	// pinned directly too, and lazily
+	n.Pinning.PinWithMode(root.Cid(), pin.Recursive)
+	n.Pinning.PinWithMode(root.Cid(), pin.Direct)
+	if err := n.Pinning.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.LazyPins.Add(ctx, lazypin.Pin{Root: root.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// queued to be provided, but collected meanwhile
+	gone := dag.NodeWithData([]byte("gone")).Cid()
+	queued := node.ProviderQueuePrefix.ChildString("1/" + gone.String())
+	if err := r.D.Put(ctx, queued, gone.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	invalid := node.ProviderQueuePrefix.ChildString("2/invalid")
+	if err := r.D.Put(ctx, invalid, []byte("invalid")); err != nil {
+		t.Fatal(err)
+	}
+
+	check(map[string]bool{
+		"recursive pin " + root.Cid().String() + " is missing block " + child.Cid().String():           false,
+		"direct pin " + root.Cid().String() + " is also pinned recursively, removed the direct pin":    true,
+		"lazy pin " + root.Cid().String() + " is pinned recursively, removed the lazy pin":             true,
+		"entry " + queued.String() + " is for " + gone.String() + ", which is not present, removed it": true,
+		"entry " + invalid.String() + " is not a CID, removed it":                                      true,
+	})
+
+	// the repairs hold
+	if err := n.DAG.Add(ctx, child); err != nil {
+		t.Fatal(err)
+	}
+	check(nil)
+}
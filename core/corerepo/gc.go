@@ -6,8 +6,12 @@ import (
 	"errors"
 	"time"
 
+	"github.com/ipfs/go-ipfs/apierr"
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/gc"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/maintenance"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
 	"github.com/ipfs/go-ipfs/repo"
 
 	"github.com/dustin/go-humanize"
@@ -18,7 +22,7 @@ import (
 
 var log = logging.Logger("corerepo")
 
-var ErrMaxStorageExceeded = errors.New("maximum storage limit exceeded. Try to unpin some files")
+var ErrMaxStorageExceeded = apierr.New(apierr.QuotaExceeded, errors.New("maximum storage limit exceeded. Try to unpin some files"))
 
 type GC struct {
 	Node       *core.IpfsNode
@@ -83,12 +87,29 @@ func BestEffortRoots(filesRoot *mfs.Root) ([]cid.Cid, error) {
 	return []cid.Cid{rootDag.Cid()}, nil
 }
 
-func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
+// gcRoots returns the best-effort roots of GC: the MFS root, and the roots of
+// the lazy pins, whose blocks fetched so far are kept.
+func gcRoots(ctx context.Context, n *core.IpfsNode) ([]cid.Cid, error) {
 	roots, err := BestEffortRoots(n.FilesRoot)
+	if err != nil {
+		return nil, err
+	}
+	lazy, err := n.LazyPins.Roots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(roots, lazy...), nil
+}
+
+func GarbageCollect(n *core.IpfsNode, ctx context.Context) error {
+	if err := unpinExpired(ctx, n); err != nil {
+		return err
+	}
+	roots, err := gcRoots(ctx, n)
 	if err != nil {
 		return err
 	}
-	rmed := gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+	rmed := gc.GC(ctx, iothrottle.NewGCBlockstore(n.Blockstore, n.BackgroundIO), n.Repo.Datastore(), n.Pinning, n.SelectorPins, roots)
 
 	return CollectResult(ctx, rmed, nil)
 }
@@ -147,16 +168,58 @@ func (e *MultiError) Error() string {
 	return buf.String()
 }
 
+// unpinExpired removes the expired pins, so that GC collects their content
+// instead of waiting for the pin expiry policy to run.
+func unpinExpired(ctx context.Context, n *core.IpfsNode) error {
+	if n.ExpiringPins == nil {
+		return nil
+	}
+	cfg, err := n.Repo.Config()
+	if err != nil {
+		return err
+	}
+	classes, err := expiry.Classes(cfg.Pinning.Expiry)
+	if err != nil {
+		return err
+	}
+	expired, err := expiry.NewPolicy(n.ExpiringPins, n.Pinning, n.Blockstore, classes).Apply(ctx, time.Now())
+	for _, e := range expired {
+		log.Infof("unpinned %s before gc: %s", e.Root, e.Reason)
+	}
+	return err
+}
+
 func GarbageCollectAsync(n *core.IpfsNode, ctx context.Context) <-chan gc.Result {
-	roots, err := BestEffortRoots(n.FilesRoot)
+	err := unpinExpired(ctx, n)
+	var roots []cid.Cid
+	if err == nil {
+		roots, err = gcRoots(ctx, n)
+	}
 	if err != nil {
-		out := make(chan gc.Result)
-		out <- gc.Result{Error: err}
-		close(out)
-		return out
+		return errResult(err)
+	}
+
+	return gc.GC(ctx, iothrottle.NewGCBlockstore(n.Blockstore, n.BackgroundIO), n.Repo.Datastore(), n.Pinning, n.SelectorPins, roots)
+}
+
+// GarbageCollectIncremental runs an incremental garbage collection within
+// budget, going on with the one in progress, if any. See gc.IncrementalGC.
+func GarbageCollectIncremental(n *core.IpfsNode, ctx context.Context, budget gc.Budget) <-chan gc.Result {
+	if err := unpinExpired(ctx, n); err != nil {
+		return errResult(err)
+	}
+	roots := func(ctx context.Context) ([]cid.Cid, error) {
+		return gcRoots(ctx, n)
 	}
+	return gc.IncrementalGC(ctx, iothrottle.NewGCBlockstore(n.Blockstore, n.BackgroundIO), n.Repo.Datastore(), n.Pinning, n.SelectorPins, roots, budget)
+}
 
-	return gc.GC(ctx, n.Blockstore, n.Repo.Datastore(), n.Pinning, roots)
+// errResult returns the output of a garbage collection failing with err.
+func errResult(err error) <-chan gc.Result {
+	out := make(chan gc.Result, 1)
+	out <- gc.Result{Error: err}
+	close(out)
+	return out
 }
 
 func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
@@ -188,6 +251,13 @@ func PeriodicGC(ctx context.Context, node *core.IpfsNode) error {
 		case <-ctx.Done():
 			return nil
 		case <-time.After(period):
+			// the collection starts in a maintenance window
+			if err := node.Maintenance.Wait(ctx, maintenance.GC); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
 			// the private func maybeGC doesn't compute storageMax, storageGC, slackGC so that they are not re-computed for every cycle
 			if err := gc.maybeGC(ctx, 0); err != nil {
 				log.Error(err)
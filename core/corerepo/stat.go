@@ -6,7 +6,10 @@ import (
 
 	context "context"
 
+	"github.com/ipfs/go-ipfs/blocks/placement"
 	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/compressds"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
 	humanize "github.com/dustin/go-humanize"
@@ -24,6 +27,11 @@ type Stat struct {
 	NumObjects uint64
 	RepoPath   string
 	Version    string
+	// Compression is the size of the compressed datastores, as stored and
+	// once decompressed, by the mountpoint they are under
+	Compression map[string]compressds.Stat `json:",omitempty"`
+	// Placement is the usage of the mounts of Datastore.Placement, by name
+	Placement map[string]placement.Usage `json:",omitempty"`
 }
 
 // NoLimit represents the value for unlimited storage
@@ -51,6 +59,14 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 		return Stat{}, err
 	}
 
+	var usage map[string]placement.Usage
+	if n.Placement != nil {
+		usage, err = n.Placement.Usage(ctx)
+		if err != nil {
+			return Stat{}, err
+		}
+	}
+
 	return Stat{
 		SizeStat: SizeStat{
 			RepoSize:   sizeStat.RepoSize,
@@ -59,6 +75,7 @@ func RepoStat(ctx context.Context, n *core.IpfsNode) (Stat, error) {
 		NumObjects: count,
 		RepoPath:   path,
 		Version:    fmt.Sprintf("fs-repo@%d", fsrepo.RepoVersion),
+		Placement:  usage,
 	}, nil
 }
 
@@ -89,3 +106,14 @@ func RepoSize(ctx context.Context, n *core.IpfsNode) (SizeStat, error) {
 		StorageMax: storageMax,
 	}, nil
 }
+
+// CompressionStat returns the size of the compressed datastores of the repo,
+// as stored and once decompressed, reading all their entries. It returns
+// none if the repo can't compress its datastores.
+func CompressionStat(ctx context.Context, n *core.IpfsNode) (map[string]compressds.Stat, error) {
+	r, ok := n.Repo.(repo.CompressionStater)
+	if !ok {
+		return nil, nil
+	}
+	return r.CompressionStat(ctx)
+}
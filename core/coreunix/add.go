@@ -5,16 +5,19 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	gopath "path"
 	"strconv"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-cidutil"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	chunker "github.com/ipfs/go-ipfs-chunker"
 	files "github.com/ipfs/go-ipfs-files"
 	pin "github.com/ipfs/go-ipfs-pinner"
 	posinfo "github.com/ipfs/go-ipfs-posinfo"
 	"github.com/ipfs/go-ipfs/tracing"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
 	dag "github.com/ipfs/go-merkledag"
@@ -80,6 +83,24 @@ type Adder struct {
 	tempRoot   cid.Cid
 	CidBuilder cid.Builder
 	liveNodes  uint64
+	// Workers is how many files of the directories added are chunked and
+	// hashed concurrently. Up to 1, the files are added one after another.
+	Workers int
+	pending *pendingFiles
+	// Resume, if set, is the session recording the files added, for an
+	// interrupted import to skip them when resumed.
+	Resume *Session
+	// PreserveMode and PreserveMtime keep the mode and the modification time
+	// of the files and the directories added, when known, in their UnixFS
+	// metadata.
+	PreserveMode  bool
+	PreserveMtime bool
+	// PinRecord, if set, records what comes with the pin of the root added,
+	// such as its expiry, under the pin lock it is pinned under.
+	PinRecord func(ctx context.Context, root cid.Cid) error
+	// rootMeta are the metadata of the directory added, set on the root
+	// once the whole tree is added
+	rootMeta unixfsmeta.Meta
 }
 
 func (adder *Adder) mfsRoot() (*mfs.Root, error) {
@@ -101,19 +122,20 @@ func (adder *Adder) SetMfsRoot(r *mfs.Root) {
 	adder.mroot = r
 }
 
-// Constructs a node from reader's data, and adds it. Doesn't pin.
-func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
-	chnk, err := chunker.FromString(reader, adder.Chunker)
+// Constructs a node from reader's data with the chunker and CID builder, and
+// adds it to dserv. Doesn't pin.
+func (adder *Adder) add(dserv *ipld.BufferedDAG, reader io.Reader, chunkerStr string, builder cid.Builder) (ipld.Node, error) {
+	chnk, err := chunker.FromString(reader, chunkerStr)
 	if err != nil {
 		return nil, err
 	}
 
 	params := ihelper.DagBuilderParams{
-		Dagserv:    adder.bufferedDS,
+		Dagserv:    dserv,
 		RawLeaves:  adder.RawLeaves,
 		Maxlinks:   ihelper.DefaultLinksPerBlock,
 		NoCopy:     adder.NoCopy,
-		CidBuilder: adder.CidBuilder,
+		CidBuilder: builder,
 	}
 
 	db, err := params.New(chnk)
@@ -130,7 +152,7 @@ func (adder *Adder) add(reader io.Reader) (ipld.Node, error) {
 		return nil, err
 	}
 
-	return nd, adder.bufferedDS.Commit()
+	return nd, dserv.Commit()
 }
 
 // RootNode returns the mfs root node
@@ -214,6 +236,11 @@ func (adder *Adder) outputDirs(path string, fsn mfs.FSNode) error {
 		if err != nil {
 			return err
 		}
+		if path == "" {
+			if nd, err = unixfsmeta.Apply(nd, adder.rootMeta); err != nil {
+				return err
+			}
+		}
 
 		return outputDagnode(adder.Out, path, nd)
 	default:
@@ -231,6 +258,18 @@ func (adder *Adder) addNode(node ipld.Node, path string) error {
 		node = pi.Node
 	}
 
+	if err := adder.putNode(node, path); err != nil {
+		return err
+	}
+
+	if !adder.Silent {
+		return outputDagnode(adder.Out, path, node)
+	}
+	return nil
+}
+
+// putNode patches node into the root at path, creating its parents.
+func (adder *Adder) putNode(node ipld.Node, path string) error {
 	mr, err := adder.mfsRoot()
 	if err != nil {
 		return err
@@ -247,14 +286,7 @@ func (adder *Adder) addNode(node ipld.Node, path string) error {
 		}
 	}
 
-	if err := mfs.PutNode(mr, path, node); err != nil {
-		return err
-	}
-
-	if !adder.Silent {
-		return outputDagnode(adder.Out, path, node)
-	}
-	return nil
+	return mfs.PutNode(mr, path, node)
 }
 
 // AddAllAndPin adds the given request's files and pin them.
@@ -271,9 +303,17 @@ func (adder *Adder) AddAllAndPin(ctx context.Context, file files.Node) (ipld.Nod
 		}
 	}()
 
+	if adder.Workers > 1 {
+		adder.pending = newPendingFiles(ctx, adder.Workers)
+		defer adder.pending.cancel()
+	}
+
 	if err := adder.addFileNode(ctx, "", file, true); err != nil {
 		return nil, err
 	}
+	if err := adder.flushPending(); err != nil {
+		return nil, err
+	}
 
 	// get root
 	mr, err := adder.mfsRoot()
@@ -320,6 +360,14 @@ func (adder *Adder) AddAllAndPin(ctx context.Context, file files.Node) (ipld.Nod
 	if err != nil {
 		return nil, err
 	}
+	if dir && !adder.rootMeta.IsZero() {
+		if nd, err = unixfsmeta.Apply(nd, adder.rootMeta); err != nil {
+			return nil, err
+		}
+		if err := adder.dagService.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+	}
 
 	// output directory events
 	err = adder.outputDirs(name, root)
@@ -337,13 +385,23 @@ func (adder *Adder) AddAllAndPin(ctx context.Context, file files.Node) (ipld.Nod
 	if !adder.Pin {
 		return nd, nil
 	}
-	return nd, adder.PinRoot(ctx, nd)
+	if err := adder.PinRoot(ctx, nd); err != nil || adder.PinRecord == nil {
+		return nd, err
+	}
+	return nd, adder.PinRecord(ctx, nd.Cid())
 }
 
 func (adder *Adder) addFileNode(ctx context.Context, path string, file files.Node, toplevel bool) error {
 	ctx, span := tracing.Span(ctx, "CoreUnix.Adder", "AddFileNode")
 	defer span.End()
 
+	if f, ok := adder.asyncFile(file); ok {
+		return adder.addFileAsync(ctx, path, f)
+	}
+	if d, ok := adder.asyncDir(file, toplevel); ok {
+		return adder.addDirAsync(ctx, path, d)
+	}
+
 	defer file.Close()
 
 	err := adder.maybePauseForGC(ctx)
@@ -351,19 +409,16 @@ func (adder *Adder) addFileNode(ctx context.Context, path string, file files.Nod
 		return err
 	}
 
-	if adder.liveNodes >= liveCacheSize {
-		// TODO: A smarter cache that uses some sort of lru cache with an eviction handler
-		mr, err := adder.mfsRoot()
-		if err != nil {
-			return err
-		}
-		if err := mr.FlushMemFree(adder.ctx); err != nil {
+	if err := adder.maybeFlushMfs(); err != nil {
+		return err
+	}
+
+	// the files pending are added first, for the output to keep its order
+	if _, dir := file.(files.Directory); !dir {
+		if err := adder.flushPending(); err != nil {
 			return err
 		}
-
-		adder.liveNodes = 0
 	}
-	adder.liveNodes++
 
 	switch f := file.(type) {
 	case files.Directory:
@@ -377,6 +432,25 @@ func (adder *Adder) addFileNode(ctx context.Context, path string, file files.Nod
 	}
 }
 
+// maybeFlushMfs flushes the MFS root and frees its memory after every
+// liveCacheSize nodes added.
+func (adder *Adder) maybeFlushMfs() error {
+	if adder.liveNodes >= liveCacheSize {
+		// TODO: A smarter cache that uses some sort of lru cache with an eviction handler
+		mr, err := adder.mfsRoot()
+		if err != nil {
+			return err
+		}
+		if err := mr.FlushMemFree(adder.ctx); err != nil {
+			return err
+		}
+
+		adder.liveNodes = 0
+	}
+	adder.liveNodes++
+	return nil
+}
+
 func (adder *Adder) addSymlink(path string, l *files.Symlink) error {
 	sdata, err := unixfs.SymlinkData(l.Target)
 	if err != nil {
@@ -394,10 +468,46 @@ func (adder *Adder) addSymlink(path string, l *files.Symlink) error {
 }
 
 func (adder *Adder) addFile(path string, file files.File) error {
+	if resumed, err := adder.resumeFile(path, file); resumed || err != nil {
+		return err
+	}
+
+	dagnode, err := adder.buildFile(adder.bufferedDS, path, file, adder.Progress)
+	if err != nil {
+		return err
+	}
+
+	// patch it into the root
+	if err := adder.addNode(dagnode, path); err != nil {
+		return err
+	}
+	return adder.recordFile(path, fileStat(file), dagnode.Cid())
+}
+
+// buildFile builds the DAG of file into dserv, sending progress updates if
+// progress is set.
+func (adder *Adder) buildFile(dserv *ipld.BufferedDAG, path string, file files.File, progress bool) (ipld.Node, error) {
+	var reader io.Reader = file
+	chunkerStr, builder := adder.Chunker, adder.CidBuilder
+	if chunkerStr == AutoChunker {
+		size, err := file.Size()
+		if err != nil {
+			size = -1
+		}
+		// the filestore reads the file itself, so it is not probed
+		var inline bool
+		reader, chunkerStr, inline = autoChunking(reader, size, !adder.NoCopy)
+		if inline && !adder.NoCopy {
+			if builder == nil {
+				builder = dag.V0CidPrefix()
+			}
+			builder = cidutil.InlineBuilder{Builder: builder, Limit: autoInlineLimit}
+		}
+	}
+
 	// if the progress flag was specified, wrap the file so that we can send
 	// progress updates to the client (over the output channel)
-	var reader io.Reader = file
-	if adder.Progress {
+	if progress {
 		rdr := &progressReader{file: reader, path: path, out: adder.Out}
 		if fi, ok := file.(files.FileInfo); ok {
 			reader = &progressReader2{rdr, fi}
@@ -406,19 +516,62 @@ func (adder *Adder) addFile(path string, file files.File) error {
 		}
 	}
 
-	dagnode, err := adder.add(reader)
+	nd, err := adder.add(dserv, reader, chunkerStr, builder)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return adder.applyMeta(dserv, nd, fileStat(file))
+}
 
-	// patch it into the root
-	return adder.addNode(dagnode, path)
+// meta returns the metadata of the file, or the directory, of stat st kept
+// by the adder.
+func (adder *Adder) meta(st os.FileInfo) unixfsmeta.Meta {
+	return unixfsmeta.FromFileInfo(st, adder.PreserveMode, adder.PreserveMtime)
+}
+
+// applyMeta returns the root nd of the DAG of a file, built into dserv, with
+// the metadata of its stat st kept by the adder, added to dserv.
+func (adder *Adder) applyMeta(dserv *ipld.BufferedDAG, nd ipld.Node, st os.FileInfo) (ipld.Node, error) {
+	m := adder.meta(st)
+	if m.IsZero() {
+		return nd, nil
+	}
+	// the filestore keeps referencing the leaf, the node holding the
+	// metadata is stored
+	if pi, ok := nd.(*posinfo.FilestoreNode); ok {
+		nd = pi.Node
+	}
+	mnd, err := unixfsmeta.Apply(nd, m)
+	if err != nil {
+		return nil, err
+	}
+	if err := dserv.Add(adder.ctx, mnd); err != nil {
+		return nil, err
+	}
+	return mnd, dserv.Commit()
 }
 
 func (adder *Adder) addDir(ctx context.Context, path string, dir files.Directory, toplevel bool) error {
 	log.Infof("adding directory: %s", path)
 
-	if !(toplevel && path == "") {
+	m := adder.meta(dirStat(dir))
+	switch {
+	case toplevel && path == "":
+		adder.rootMeta = m
+	case !m.IsZero():
+		// the entries are added to the directory holding the metadata
+		dnode := unixfs.EmptyDirNode()
+		dnode.SetCidBuilder(adder.CidBuilder)
+		if err := unixfsmeta.Set(dnode, m); err != nil {
+			return err
+		}
+		if err := adder.dagService.Add(ctx, dnode); err != nil {
+			return err
+		}
+		if err := adder.putNode(dnode, path); err != nil {
+			return err
+		}
+	default:
 		mr, err := adder.mfsRoot()
 		if err != nil {
 			return err
@@ -441,8 +594,51 @@ func (adder *Adder) addDir(ctx context.Context, path string, dir files.Directory
 			return err
 		}
 	}
+	if err := it.Err(); err != nil {
+		return err
+	}
 
-	return it.Err()
+	if (toplevel && path == "") || m.IsZero() {
+		return nil
+	}
+	return adder.keepDirMeta(path, m)
+}
+
+// keepDirMeta sets the metadata m of the directory at path again, if it lost
+// them being sharded as it grew.
+func (adder *Adder) keepDirMeta(path string, m unixfsmeta.Meta) error {
+	mr, err := adder.mfsRoot()
+	if err != nil {
+		return err
+	}
+	fsn, err := mfs.Lookup(mr, path)
+	if err != nil {
+		return err
+	}
+	nd, err := fsn.GetNode()
+	if err != nil {
+		return err
+	}
+	if cur, err := unixfsmeta.Get(nd); err != nil || !cur.IsZero() {
+		return err
+	}
+
+	if nd, err = unixfsmeta.Apply(nd, m); err != nil {
+		return err
+	}
+	parent, name := gopath.Split(path)
+	pfsn, err := mfs.Lookup(mr, parent)
+	if err != nil {
+		return err
+	}
+	pdir, ok := pfsn.(*mfs.Directory)
+	if !ok {
+		return fmt.Errorf("%s is not a directory", parent)
+	}
+	if err := pdir.Unlink(name); err != nil {
+		return err
+	}
+	return pdir.AddChild(name, nd)
 }
 
 func (adder *Adder) maybePauseForGC(ctx context.Context) error {
@@ -450,6 +646,11 @@ func (adder *Adder) maybePauseForGC(ctx context.Context) error {
 	defer span.End()
 
 	if adder.unlocker != nil && adder.gcLocker.GCRequested(ctx) {
+		// the blocks of the files pending are not in the root yet
+		if err := adder.flushPending(); err != nil {
+			return err
+		}
+
 		rn, err := adder.curRootNode()
 		if err != nil {
 			return err
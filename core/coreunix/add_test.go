@@ -8,12 +8,14 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/gc"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-blockservice"
@@ -24,7 +26,9 @@ import (
 	files "github.com/ipfs/go-ipfs-files"
 	pi "github.com/ipfs/go-ipfs-posinfo"
 	config "github.com/ipfs/go-ipfs/config"
+	ipld "github.com/ipfs/go-ipld-format"
 	dag "github.com/ipfs/go-merkledag"
+	uio "github.com/ipfs/go-unixfs/io"
 	coreiface "github.com/ipfs/interface-go-ipfs-core"
 )
 
@@ -81,7 +85,7 @@ func TestAddMultipleGCLive(t *testing.T) {
 	gc1started := make(chan struct{})
 	go func() {
 		defer close(gc1started)
-		gc1out = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, nil)
+		gc1out = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, node.SelectorPins, nil)
 	}()
 
 	// GC shouldn't get the lock until after the file is completely added
@@ -113,7 +117,7 @@ func TestAddMultipleGCLive(t *testing.T) {
 	gc2started := make(chan struct{})
 	go func() {
 		defer close(gc2started)
-		gc2out = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, nil)
+		gc2out = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, node.SelectorPins, nil)
 	}()
 
 	select {
@@ -199,7 +203,7 @@ func TestAddGCLive(t *testing.T) {
 	gcstarted := make(chan struct{})
 	go func() {
 		defer close(gcstarted)
-		gcout = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, nil)
+		gcout = gc.GC(context.Background(), node.Blockstore, node.Repo.Datastore(), node.Pinning, node.SelectorPins, nil)
 	}()
 
 	// gc shouldn't start until we let the add finish its current file.
@@ -366,3 +370,319 @@ func (fi *dummyFileInfo) Mode() os.FileMode  { return 0 }
 func (fi *dummyFileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *dummyFileInfo) IsDir() bool        { return false }
 func (fi *dummyFileInfo) Sys() interface{}   { return nil }
+
+func TestAddParallel(t *testing.T) {
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(42))
+	for _, d := range []string{"a", "a/b", "a/b/e", "c", "d"} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, name := range []string{"a/1", "a/2", "a/b/3", "a/b/4", "c/5", "6", "7", "8"} {
+		data := make([]byte, rnd.Intn(1<<20)+i)
+		rnd.Read(data)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the small files of a directory are added by the workers it is handed
+	// to, or in place
+	for i := 0; i < 200; i++ {
+		if err := ioutil.WriteFile(filepath.Join(dir, "d", strconv.Itoa(i)), []byte(strconv.Itoa(i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"link": "a/1", "c/link": "5"} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	add := func(workers int, file files.Node) (cid.Cid, []string) {
+		r := &repo.Mock{
+			C: config.Config{
+				Identity: config.Identity{
+					PeerID: testPeerID, // required by offline node
+				},
+			},
+			D: syncds.MutexWrap(datastore.NewMapDatastore()),
+		}
+		node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make(chan interface{}, 64)
+		adder.Out = out
+		adder.Workers = workers
+
+		var names []string
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for o := range out {
+				names = append(names, o.(*coreiface.AddEvent).Name)
+			}
+		}()
+		root, err := adder.AddAllAndPin(context.Background(), file)
+		close(out)
+		<-done
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Cid(), names
+	}
+	serialFile := func() files.Node {
+		st, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := files.NewSerialFile(dir, false, st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	// the directories are sharded, or not, the same way
+	prevShardingSize := uio.HAMTShardingSize
+	defer func() { uio.HAMTShardingSize = prevShardingSize }()
+	for _, shardingSize := range []int{prevShardingSize, 1} {
+		uio.HAMTShardingSize = shardingSize
+		expected, expectedNames := add(1, serialFile())
+		for _, workers := range []int{2, 8} {
+			root, names := add(workers, serialFile())
+			if !root.Equals(expected) {
+				t.Errorf("%d workers: expected %s, got %s", workers, expected, root)
+			}
+			if len(names) != len(expectedNames) {
+				t.Fatalf("%d workers: expected the output %v, got %v", workers, expectedNames, names)
+			}
+			for i := range names {
+				if names[i] != expectedNames[i] {
+					t.Fatalf("%d workers: expected the output %v, got %v", workers, expectedNames, names)
+				}
+			}
+		}
+	}
+}
+
+func TestAddResume(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1", "2", "3"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("file "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	session, err := NewSession(node.Repo.Datastore(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Begin(ctx, "chunker=default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// records, for each file, whether it was resumed rather than read
+	add := func() (cid.Cid, map[string]bool) {
+		adder, err := NewAdder(ctx, node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Resume = session.For("dir")
+		st, err := os.Stat(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := files.NewSerialFile(dir, false, st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := make(map[string]bool)
+		it := f.(files.Directory).Entries()
+		var entries []files.DirEntry
+		for it.Next() {
+			entries = append(entries, files.FileEntry(it.Name(), &readRecorder{it.Node().(files.File), it.Name(), read}))
+		}
+		root, err := adder.AddAllAndPin(ctx, files.NewSliceDirectory(entries))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root.Cid(), read
+	}
+
+	expected, read := add()
+	if len(read) != 3 {
+		t.Fatalf("expected the 3 files to be read, got %v", read)
+	}
+
+	// changing a file adds it again
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "2"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	root, read := add()
+	if !root.Equals(expected) {
+		t.Errorf("expected %s, got %s", expected, root)
+	}
+	if len(read) != 1 || !read["2"] {
+		t.Fatalf("expected only 2 to be read, got %v", read)
+	}
+
+	if err := session.Begin(ctx, "chunker=buzhash"); err == nil {
+		t.Fatal("expected the session to be resumed with the same settings only")
+	}
+	if err := session.End(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, read := add(); len(read) != 3 {
+		t.Fatalf("expected the 3 files to be read once the session ended, got %v", read)
+	}
+}
+
+// readRecorder records the files read.
+type readRecorder struct {
+	files.File
+	name string
+	read map[string]bool
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	r.read[r.name] = true
+	return r.File.Read(p)
+}
+
+func (r *readRecorder) Stat() os.FileInfo {
+	return r.File.(files.FileInfo).Stat()
+}
+
+func (r *readRecorder) AbsPath() string {
+	return r.File.(files.FileInfo).AbsPath()
+}
+
+func TestAddPreserveMeta(t *testing.T) {
+	dir := t.TempDir()
+	modes := map[string]os.FileMode{
+		"a":     0750,
+		"a/1":   0640,
+		"a/big": 0755 | os.ModeSetuid,
+		"2":     0600,
+	}
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	big := make([]byte, 1<<20)
+	rand.New(rand.NewSource(42)).Read(big)
+	for name, data := range map[string][]byte{"a/1": []byte("1"), "a/big": big, "2": []byte("2")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 789, time.UTC)
+	for _, name := range []string{"a/1", "a/big", "2", "a", "."} {
+		p := filepath.Join(dir, name)
+		if mode, ok := modes[name]; ok {
+			if err := os.Chmod(p, mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modes["."] = st.Mode().Perm()
+
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	add := func(workers int, raw bool) ipld.Node {
+		adder, err := NewAdder(ctx, node.Pinning, node.Blockstore, node.DAG)
+		if err != nil {
+			t.Fatal(err)
+		}
+		adder.Workers = workers
+		adder.RawLeaves = raw
+		adder.PreserveMode = true
+		adder.PreserveMtime = true
+		f, err := files.NewSerialFile(dir, false, st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, err := adder.AddAllAndPin(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	// the directories keep their metadata sharded too
+	prevShardingSize := uio.HAMTShardingSize
+	defer func() { uio.HAMTShardingSize = prevShardingSize }()
+	for _, shardingSize := range []int{prevShardingSize, 1} {
+		uio.HAMTShardingSize = shardingSize
+		for _, raw := range []bool{false, true} {
+			expected := add(1, raw)
+			if root := add(4, raw); !root.Cid().Equals(expected.Cid()) {
+				t.Fatalf("expected the same CID with workers, got %s and %s", expected.Cid(), root.Cid())
+			}
+
+			f, err := unixfsmeta.NewFile(ctx, node.DAG, expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seen := 0
+			err = files.Walk(f, func(fpath string, n files.Node) error {
+				name := fpath
+				if name == "" {
+					name = "."
+				}
+				m := unixfsmeta.Of(n)
+				if !m.HasMode || m.Mode != modes[name] {
+					t.Errorf("%s: expected the mode %s, got %s", name, modes[name], m.Mode)
+				}
+				if !m.ModTime.Equal(mtime) {
+					t.Errorf("%s: expected the modification time %s, got %s", name, mtime, m.ModTime)
+				}
+				seen++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen != len(modes) {
+				t.Fatalf("expected %d entries, got %d", len(modes), seen)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package coreunix
+
+import (
+	"bufio"
+	"compress/flate"
+	"io"
+	"strconv"
+
+	chunker "github.com/ipfs/go-ipfs-chunker"
+)
+
+// AutoChunker is the chunker picking the chunking of each file from its size
+// and how compressible its data is.
+const AutoChunker = "auto"
+
+const (
+	// files up to this size are inlined into their CID
+	autoInlineLimit = 32
+	// how much of a file is compressed to probe its compressibility
+	autoProbeSize = 64 << 10
+	// data compressing below this ratio is compressible, e.g. text
+	autoCompressible = 0.75
+	// incompressible files from this size, e.g. media, get large chunks
+	autoLargeFile = 16 << 20
+)
+
+var (
+	autoDefaultChunker = "size-" + strconv.FormatInt(chunker.DefaultBlockSize, 10)
+	autoLargeChunker   = "size-" + strconv.Itoa(1<<20)
+)
+
+// autoChunking returns the chunker for a file of size bytes, -1 if unknown,
+// read from r, and whether the file is small enough to be inlined. The file
+// must then be read from the returned reader, which buffers what was probed.
+// If probe is false, the data is not read and only the size is used.
+func autoChunking(r io.Reader, size int64, probe bool) (io.Reader, string, bool) {
+	if size >= 0 && size <= autoInlineLimit {
+		return r, autoDefaultChunker, true
+	}
+	// a single chunk either way
+	if size >= 0 && size <= chunker.DefaultBlockSize {
+		return r, autoDefaultChunker, false
+	}
+	if !probe {
+		if size >= autoLargeFile {
+			return r, autoLargeChunker, false
+		}
+		return r, autoDefaultChunker, false
+	}
+
+	br := bufio.NewReaderSize(r, autoProbeSize)
+	// a short file is probed whole
+	sample, _ := br.Peek(autoProbeSize)
+	switch {
+	case len(sample) > 0 && compressedRatio(sample) < autoCompressible:
+		// content-defined chunks deduplicate the edits of text and the like
+		return br, "buzhash", false
+	case size >= autoLargeFile:
+		return br, autoLargeChunker, false
+	default:
+		return br, autoDefaultChunker, false
+	}
+}
+
+// compressedRatio returns how much data compresses, from 0 to about 1.
+func compressedRatio(data []byte) float64 {
+	var n byteCounter
+	fw, err := flate.NewWriter(&n, flate.BestSpeed)
+	if err != nil {
+		return 1
+	}
+	if _, err := fw.Write(data); err != nil {
+		return 1
+	}
+	if err := fw.Close(); err != nil {
+		return 1
+	}
+	return float64(n) / float64(len(data))
+}
+
+// byteCounter counts the bytes written to it.
+type byteCounter int
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
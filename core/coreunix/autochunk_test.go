@@ -0,0 +1,90 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/repo"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	syncds "github.com/ipfs/go-datastore/sync"
+	files "github.com/ipfs/go-ipfs-files"
+	config "github.com/ipfs/go-ipfs/config"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func TestAutoChunking(t *testing.T) {
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rand.New(rand.NewSource(1)).Read(b)
+		return b
+	}
+	text := bytes.Repeat([]byte("all work and no play makes jack a dull boy\n"), 20000)
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		size    int64
+		probe   bool
+		chunker string
+		inline  bool
+	}{
+		{"tiny", []byte("hello"), 5, true, "size-262144", true},
+		{"single chunk", random(100 << 10), 100 << 10, true, "size-262144", false},
+		{"text", text, int64(len(text)), true, "buzhash", false},
+		{"media", random(autoLargeFile), autoLargeFile, true, "size-1048576", false},
+		{"random", random(1 << 20), 1 << 20, true, "size-262144", false},
+		{"unknown size", text, -1, true, "buzhash", false},
+		{"not probed", text, int64(len(text)), false, "size-262144", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, chunker, inline := autoChunking(bytes.NewReader(tc.data), tc.size, tc.probe)
+			if chunker != tc.chunker || inline != tc.inline {
+				t.Fatalf("expected %s (inline: %t), got %s (inline: %t)", tc.chunker, tc.inline, chunker, inline)
+			}
+			// the probed data is not lost
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tc.data) {
+				t.Fatal("data changed by the probe")
+			}
+		})
+	}
+}
+
+func TestAddAutoChunker(t *testing.T) {
+	r := &repo.Mock{
+		C: config.Config{
+			Identity: config.Identity{
+				PeerID: testPeerID, // required by offline node
+			},
+		},
+		D: syncds.MutexWrap(datastore.NewMapDatastore()),
+	}
+	node, err := core.NewNode(context.Background(), &core.BuildCfg{Repo: r})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adder, err := NewAdder(context.Background(), node.Pinning, node.Blockstore, node.DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adder.Chunker = AutoChunker
+	adder.Out = make(chan interface{}, 10)
+
+	nd, err := adder.AddAllAndPin(context.Background(), files.NewBytesFile([]byte("tiny")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid().Prefix().MhType != mh.IDENTITY || nd.Cid().Prefix().Codec != cid.DagProtobuf {
+		t.Fatalf("expected an inlined file, got %s", nd.Cid())
+	}
+}
@@ -0,0 +1,406 @@
+package coreunix
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	gopath "path"
+
+	files "github.com/ipfs/go-ipfs-files"
+	posinfo "github.com/ipfs/go-ipfs-posinfo"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+
+	"github.com/ipfs/go-ipfs/unixfsmeta"
+)
+
+// pendingFiles are the files being chunked and hashed by the workers, in the
+// order they are patched into the MFS root. The DAG of each file is built by
+// a worker on its own, and the MFS root is only changed by the adder, so the
+// CIDs are the same as when adding the files one after another.
+//
+// The directories read from the disk are built by the workers too, each as a
+// whole: their entries are read and added by the worker, which hands the
+// subdirectories and the files to the other workers when some are free, and
+// their directory node is patched into the root at once. The links of a
+// directory being sorted, and its shards independent of the order its entries
+// are added in, their CIDs are the same as well.
+type pendingFiles struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// workers holds a token for each file being added by a worker
+	workers chan struct{}
+	files   []*pendingFile
+}
+
+// pendingFile is a file, or a directory, added by a worker.
+type pendingFile struct {
+	path string
+	stat os.FileInfo
+	size int64
+	done chan struct{}
+	node ipld.Node
+	err  error
+	// added are the entries of the directory added, in the order of the
+	// output, for a directory
+	dir   bool
+	added []addedEntry
+}
+
+// addedEntry is a file, or a symlink, added as part of a directory built by
+// a worker, whose output is sent once the directory is patched into the root.
+type addedEntry struct {
+	path  string
+	size  int64
+	event *coreiface.AddEvent
+}
+
+func newPendingFiles(ctx context.Context, workers int) *pendingFiles {
+	ctx, cancel := context.WithCancel(ctx)
+	return &pendingFiles{
+		ctx:     ctx,
+		cancel:  cancel,
+		workers: make(chan struct{}, workers),
+	}
+}
+
+// asyncFile returns the file of n if it can be added by a worker. The files
+// must be readable apart from the stream of the directory they are in, as
+// those read from the disk are, unlike those of a multipart request, which
+// are added in order.
+func (adder *Adder) asyncFile(n files.Node) (files.File, bool) {
+	if adder.pending == nil {
+		return nil, false
+	}
+	if _, ok := n.(*files.Symlink); ok {
+		return nil, false
+	}
+	f, ok := n.(files.File)
+	if !ok {
+		return nil, false
+	}
+	_, err := f.Seek(0, io.SeekCurrent)
+	return f, err == nil
+}
+
+// asyncDir returns the directory of n if it can be added by a worker, as the
+// directories read from the disk can. The sessions record the files one by
+// one, so that the directories of a resumable import are not.
+func (adder *Adder) asyncDir(n files.Node, toplevel bool) (files.Directory, bool) {
+	if adder.pending == nil || adder.Resume != nil || toplevel {
+		return nil, false
+	}
+	d, ok := n.(files.Directory)
+	if !ok {
+		return nil, false
+	}
+	_, disk := d.(interface{ Stat() os.FileInfo })
+	return d, disk
+}
+
+// dirStat returns the stat of dir, if read from the disk.
+func dirStat(dir files.Directory) os.FileInfo {
+	if d, ok := dir.(interface{ Stat() os.FileInfo }); ok {
+		return d.Stat()
+	}
+	return nil
+}
+
+// addFileAsync hands file to a worker, once one is free, and patches the files
+// the workers added by then into the root.
+func (adder *Adder) addFileAsync(ctx context.Context, path string, file files.File) error {
+	if err := adder.maybePauseForGC(ctx); err != nil {
+		file.Close()
+		return err
+	}
+
+	resumed, err := adder.resumeFile(path, file)
+	if err != nil || resumed {
+		file.Close()
+		if err != nil {
+			return err
+		}
+		return adder.maybeFlushMfs()
+	}
+
+	pf := &pendingFile{path: path, stat: fileStat(file), size: -1, done: make(chan struct{})}
+	if size, err := file.Size(); err == nil {
+		pf.size = size
+	}
+	return adder.startPending(pf, file, func(dserv *ipld.BufferedDAG) {
+		pf.node, pf.err = adder.buildFile(dserv, path, file, false)
+	})
+}
+
+// addDirAsync hands dir to a worker, once one is free, and patches the files
+// the workers added by then into the root.
+func (adder *Adder) addDirAsync(ctx context.Context, path string, dir files.Directory) error {
+	if err := adder.maybePauseForGC(ctx); err != nil {
+		dir.Close()
+		return err
+	}
+
+	pf := &pendingFile{path: path, size: -1, done: make(chan struct{}), dir: true}
+	return adder.startPending(pf, dir, func(dserv *ipld.BufferedDAG) {
+		pf.node, pf.added, pf.err = adder.buildDir(dserv, path, dir)
+	})
+}
+
+// startPending queues pf, and runs build on a worker, once one is free. n is
+// closed once built.
+func (adder *Adder) startPending(pf *pendingFile, n files.Node, build func(*ipld.BufferedDAG)) error {
+	p := adder.pending
+	// the files waiting to be patched are bounded, as they are held open
+	for len(p.files) >= 4*cap(p.workers) {
+		if err := adder.patchPending(true); err != nil {
+			n.Close()
+			return err
+		}
+	}
+	select {
+	case p.workers <- struct{}{}:
+	case <-p.ctx.Done():
+		n.Close()
+		return p.ctx.Err()
+	}
+	p.files = append(p.files, pf)
+
+	go func() {
+		defer func() { <-p.workers }()
+		defer close(pf.done)
+		defer n.Close()
+
+		build(ipld.NewBufferedDAG(p.ctx, adder.dagService))
+	}()
+
+	return adder.patchPending(false)
+}
+
+// dirEntry is an entry of a directory built by a worker, added by another
+// worker or in place.
+type dirEntry struct {
+	name  string
+	done  chan struct{}
+	node  ipld.Node
+	added []addedEntry
+	err   error
+}
+
+// buildDir builds the DAG of dir into dserv, with its entries, returning the
+// directory node and the entries added. The entries are handed to the free
+// workers, and added in place when none is.
+func (adder *Adder) buildDir(dserv *ipld.BufferedDAG, path string, dir files.Directory) (ipld.Node, []addedEntry, error) {
+	p := adder.pending
+	d := uio.NewDirectory(dserv)
+	d.SetCidBuilder(adder.CidBuilder)
+
+	var entries []*dirEntry
+	var added []addedEntry
+	// link links the entries added, in order, waiting for the first one if
+	// wait is set
+	link := func(wait bool) error {
+		for len(entries) > 0 {
+			e := entries[0]
+			if wait {
+				<-e.done
+			}
+			select {
+			case <-e.done:
+			default:
+				return nil
+			}
+			entries = entries[1:]
+			if e.err != nil {
+				return e.err
+			}
+			if err := d.AddChild(p.ctx, e.name, e.node); err != nil {
+				return err
+			}
+			added = append(added, e.added...)
+		}
+		return nil
+	}
+
+	err := func() error {
+		it := dir.Entries()
+		for it.Next() {
+			e := &dirEntry{name: it.Name(), done: make(chan struct{})}
+			fpath := gopath.Join(path, e.name)
+			n := it.Node()
+			entries = append(entries, e)
+
+			select {
+			case p.workers <- struct{}{}:
+				go func() {
+					defer func() { <-p.workers }()
+					e.node, e.added, e.err = adder.buildEntry(ipld.NewBufferedDAG(p.ctx, adder.dagService), fpath, n)
+					close(e.done)
+				}()
+			default:
+				e.node, e.added, e.err = adder.buildEntry(dserv, fpath, n)
+				close(e.done)
+			}
+
+			if err := link(false); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	}()
+	if err == nil {
+		err = link(true)
+	}
+	if err != nil {
+		// the entries being added hold their file open
+		for _, e := range entries {
+			<-e.done
+		}
+		return nil, nil, err
+	}
+
+	nd, err := d.GetNode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if nd, err = unixfsmeta.Apply(nd, adder.meta(dirStat(dir))); err != nil {
+		return nil, nil, err
+	}
+	if err := dserv.Add(p.ctx, nd); err != nil {
+		return nil, nil, err
+	}
+	return nd, added, dserv.Commit()
+}
+
+// buildEntry builds the DAG of the entry n of a directory built by a worker
+// into dserv, closing it.
+func (adder *Adder) buildEntry(dserv *ipld.BufferedDAG, path string, n files.Node) (ipld.Node, []addedEntry, error) {
+	defer n.Close()
+	if err := adder.pending.ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var nd ipld.Node
+	entry := addedEntry{path: path, size: -1}
+	switch f := n.(type) {
+	case files.Directory:
+		return adder.buildDir(dserv, path, f)
+	case *files.Symlink:
+		sdata, err := unixfs.SymlinkData(f.Target)
+		if err != nil {
+			return nil, nil, err
+		}
+		sn := dag.NodeWithData(sdata)
+		sn.SetCidBuilder(adder.CidBuilder)
+		if err := dserv.Add(adder.pending.ctx, sn); err != nil {
+			return nil, nil, err
+		}
+		nd = sn
+	case files.File:
+		if size, err := f.Size(); err == nil {
+			entry.size = size
+		}
+		fn, err := adder.buildFile(dserv, path, f, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if pi, ok := fn.(*posinfo.FilestoreNode); ok {
+			fn = pi.Node
+		}
+		nd = fn
+	default:
+		return nil, nil, errors.New("unknown file type")
+	}
+
+	var err error
+	if entry.event, err = getOutput(nd); err != nil {
+		return nil, nil, err
+	}
+	entry.event.Name = path
+	return nd, []addedEntry{entry}, dserv.Commit()
+}
+
+// patchPending patches the files the workers added into the root, in order,
+// waiting for the first file pending if wait is set.
+func (adder *Adder) patchPending(wait bool) error {
+	p := adder.pending
+	for len(p.files) > 0 {
+		pf := p.files[0]
+		if wait {
+			<-pf.done
+			wait = false
+		}
+		select {
+		case <-pf.done:
+		default:
+			return nil
+		}
+		p.files = p.files[1:]
+		if pf.err != nil {
+			return pf.err
+		}
+
+		if err := adder.maybeFlushMfs(); err != nil {
+			return err
+		}
+		if pf.dir {
+			if err := adder.patchDir(pf); err != nil {
+				return err
+			}
+			continue
+		}
+		// the progress of a file is reported once it is added, the CLI
+		// expecting the updates of one file at a time
+		if adder.Progress && pf.size >= 0 {
+			adder.Out <- &coreiface.AddEvent{
+				Name:  pf.path,
+				Bytes: pf.size,
+			}
+		}
+		if err := adder.addNode(pf.node, pf.path); err != nil {
+			return err
+		}
+		if err := adder.recordFile(pf.path, pf.stat, pf.node.Cid()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchDir patches the directory pf a worker added into the root, and sends
+// the output of its entries. The output of the directories is sent once the
+// whole tree is added, as for the directories added by the adder.
+func (adder *Adder) patchDir(pf *pendingFile) error {
+	if err := adder.putNode(pf.node, pf.path); err != nil {
+		return err
+	}
+	for _, e := range pf.added {
+		if adder.Progress && e.size >= 0 {
+			adder.Out <- &coreiface.AddEvent{
+				Name:  e.path,
+				Bytes: e.size,
+			}
+		}
+		if !adder.Silent && adder.Out != nil {
+			adder.Out <- e.event
+		}
+	}
+	return nil
+}
+
+// flushPending waits for the workers and patches all the files pending into
+// the root.
+func (adder *Adder) flushPending() error {
+	if adder.pending == nil {
+		return nil
+	}
+	for len(adder.pending.files) > 0 {
+		if err := adder.patchPending(true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package coreunix
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	unixfs_pb "github.com/ipfs/go-unixfs/pb"
+)
+
+// rangePrefetch is how many blocks of a range are fetched ahead of the one
+// read.
+const rangePrefetch = 16
+
+// rangeReader reads a byte range of a UnixFS file, walking its DAG from the
+// root to fetch only the blocks holding the range. Unlike the reader of the
+// whole file, it does not read ahead past the end of the range.
+type rangeReader struct {
+	ctx    context.Context
+	getter ipld.NodeGetter
+	// start and end are the offsets of the range in the file.
+	start, end int64
+	// buf is the data of the range read from the last block.
+	buf []byte
+	// stack are the nodes whose children are being read.
+	stack []*rangeFrame
+}
+
+// rangeFrame is a node whose children are being read.
+type rangeFrame struct {
+	links []*ipld.Link
+	sizes []uint64
+	// next is the index of the next child, and pos its offset in the file.
+	next int
+	pos  int64
+	// promises are the children fetched from the index first.
+	promises []*ipld.NodePromise
+	first    int
+}
+
+// NewRangeReader returns a reader of length bytes of the UnixFS file nd from
+// offset, or of its rest if length is negative. Only the blocks of the range
+// are fetched from getter.
+func NewRangeReader(ctx context.Context, getter ipld.NodeGetter, nd ipld.Node, offset, length int64) (io.Reader, error) {
+	if offset < 0 {
+		return nil, fmt.Errorf("invalid offset %d", offset)
+	}
+	r := &rangeReader{ctx: ctx, getter: getter, start: offset, end: -1}
+	if length >= 0 {
+		r.end = offset + length
+	}
+	if err := r.push(nd, 0); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// push reads the data of nd in the range, nd being at pos in the file, and
+// pushes its children to be read.
+func (r *rangeReader) push(nd ipld.Node, pos int64) error {
+	switch nd := nd.(type) {
+	case *dag.RawNode:
+		r.buf = r.clip(nd.RawData(), pos)
+		return nil
+	case *dag.ProtoNode:
+		fsn, err := unixfs.FSNodeFromBytes(nd.Data())
+		if err != nil {
+			return err
+		}
+		switch fsn.Type() {
+		case unixfs_pb.Data_File, unixfs_pb.Data_Raw:
+		case unixfs_pb.Data_Directory, unixfs_pb.Data_HAMTShard:
+			return fmt.Errorf("%s is a directory", nd.Cid())
+		default:
+			return fmt.Errorf("%s is not a file", nd.Cid())
+		}
+		if len(nd.Links()) != fsn.NumChildren() {
+			return fmt.Errorf("%s has %d links and %d block sizes", nd.Cid(), len(nd.Links()), fsn.NumChildren())
+		}
+		data := fsn.Data()
+		r.buf = r.clip(data, pos)
+		if len(nd.Links()) > 0 {
+			r.stack = append(r.stack, &rangeFrame{
+				links: nd.Links(),
+				sizes: fsn.BlockSizes(),
+				pos:   pos + int64(len(data)),
+			})
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s is not a UnixFS file", nd.Cid())
+	}
+}
+
+// clip returns the part of data in the range, data being at pos in the file.
+func (r *rangeReader) clip(data []byte, pos int64) []byte {
+	end := pos + int64(len(data))
+	if r.end >= 0 && end > r.end {
+		end = r.end
+	}
+	start := pos
+	if start < r.start {
+		start = r.start
+	}
+	if start >= end {
+		return nil
+	}
+	return data[start-pos : end-pos]
+}
+
+// inRange reports whether bytes from start to end are in the range.
+func (r *rangeReader) inRange(start, end int64) bool {
+	return end > r.start && (r.end < 0 || start < r.end)
+}
+
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if len(r.stack) == 0 {
+			return 0, io.EOF
+		}
+		f := r.stack[len(r.stack)-1]
+		if f.next == len(f.links) || (r.end >= 0 && f.pos >= r.end) {
+			r.stack = r.stack[:len(r.stack)-1]
+			continue
+		}
+
+		i := f.next
+		start := f.pos
+		f.next++
+		f.pos += int64(f.sizes[i])
+		if !r.inRange(start, f.pos) {
+			continue
+		}
+
+		nd, err := r.child(f, i)
+		if err != nil {
+			return 0, err
+		}
+		if err := r.push(nd, start); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// child fetches the child i of f, fetching the next children in the range
+// along with it.
+func (r *rangeReader) child(f *rangeFrame, i int) (ipld.Node, error) {
+	if i < f.first || i >= f.first+len(f.promises) {
+		var keys []cid.Cid
+		pos := f.pos - int64(f.sizes[i])
+		for j := i; j < len(f.links) && len(keys) < rangePrefetch; j++ {
+			end := pos + int64(f.sizes[j])
+			if !r.inRange(pos, end) {
+				break
+			}
+			keys = append(keys, f.links[j].Cid)
+			pos = end
+		}
+		f.promises = ipld.GetNodes(r.ctx, r.getter, keys)
+		f.first = i
+	}
+	return f.promises[i-f.first].Get(r.ctx)
+}
@@ -0,0 +1,110 @@
+package coreunix
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	ihelper "github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipfs/go-unixfs/importer/trickle"
+)
+
+// countingGetter counts the nodes fetched.
+type countingGetter struct {
+	ipld.DAGService
+	fetched int
+}
+
+func (g *countingGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	g.fetched++
+	return g.DAGService.Get(ctx, c)
+}
+
+func (g *countingGetter) GetMany(ctx context.Context, keys []cid.Cid) <-chan *ipld.NodeOption {
+	g.fetched += len(keys)
+	return g.DAGService.GetMany(ctx, keys)
+}
+
+func TestRangeReader(t *testing.T) {
+	ctx := context.Background()
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	for _, tc := range []struct {
+		name      string
+		rawLeaves bool
+		trickle   bool
+	}{
+		{"balanced", false, false},
+		{"raw leaves", true, false},
+		{"trickle", false, true},
+	} {
+		dserv := mdtest.Mock()
+		params := ihelper.DagBuilderParams{
+			Dagserv:   dserv,
+			RawLeaves: tc.rawLeaves,
+			Maxlinks:  4,
+		}
+		db, err := params.New(chunker.NewSizeSplitter(bytes.NewReader(data), 1000))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var nd ipld.Node
+		if tc.trickle {
+			nd, err = trickle.Layout(db)
+		} else {
+			nd, err = balanced.Layout(db)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, r := range [][2]int64{{0, -1}, {0, 0}, {0, 1}, {999, 2}, {12345, 30000}, {99990, -1}, {99990, 100}, {100000, 10}} {
+			g := &countingGetter{DAGService: dserv}
+			rr, err := NewRangeReader(ctx, g, nd, r[0], r[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := ioutil.ReadAll(rr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			end := int64(len(data))
+			if r[1] >= 0 && r[0]+r[1] < end {
+				end = r[0] + r[1]
+			}
+			start := r[0]
+			if start > end {
+				start = end
+			}
+			if !bytes.Equal(out, data[start:end]) {
+				t.Errorf("%s %v: got %d bytes, expected %d", tc.name, r, len(out), end-start)
+			}
+			// a range within a leaf fetches the leaf and the nodes above it
+			if !tc.trickle && r[1] > 0 && r[1] <= 2 && g.fetched > 5 {
+				t.Errorf("%s %v: fetched %d nodes", tc.name, r, g.fetched)
+			}
+		}
+	}
+
+	rr, err := NewRangeReader(ctx, mdtest.Mock(), dag.NewRawNode([]byte("raw")), 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := ioutil.ReadAll(rr); string(out) != "a" {
+		t.Errorf("expected a, got %q", out)
+	}
+
+	if _, err := NewRangeReader(ctx, mdtest.Mock(), unixfs.EmptyDirNode(), 0, 1); err == nil {
+		t.Error("expected a directory not to be read")
+	}
+}
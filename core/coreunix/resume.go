@@ -0,0 +1,183 @@
+package coreunix
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-ipfs/mfsjournal"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+)
+
+// sessionsKey is the datastore key under which the import sessions are
+// recorded.
+var sessionsKey = ds.NewKey("/local/add/sessions")
+
+// Session records the files an import completed, so that the import can be
+// resumed after an interruption without adding these files again.
+//
+// The settings of the session are stored under its key, and the files it
+// completed below it. The files are recorded with their size and
+// modification time, and are added again if either changed.
+type Session struct {
+	ds  ds.Datastore
+	key ds.Key
+	// name is the name of the argument whose files are added.
+	name string
+}
+
+// sessionFile is the record of a file completed by a session.
+type sessionFile struct {
+	Cid     cid.Cid
+	Size    int64
+	ModTime time.Time
+}
+
+// NewSession returns the import session id recorded in d.
+func NewSession(d ds.Datastore, id string) (*Session, error) {
+	if id == "" || strings.Contains(id, "/") || ds.NewKey(id).String() != "/"+id {
+		return nil, fmt.Errorf("invalid import session %q", id)
+	}
+	return &Session{ds: d, key: sessionsKey.ChildString(id)}, nil
+}
+
+// For returns the session recording the files of the argument name.
+func (s *Session) For(name string) *Session {
+	return &Session{ds: s.ds, key: s.key, name: name}
+}
+
+// Begin starts the session with settings, the options changing the CIDs of
+// the files, or checks that a session resumed was started with the same.
+func (s *Session) Begin(ctx context.Context, settings string) error {
+	b, err := s.ds.Get(ctx, s.key)
+	if err == ds.ErrNotFound {
+		if err := s.ds.Put(ctx, s.key, []byte(settings)); err != nil {
+			return err
+		}
+		return s.ds.Sync(ctx, s.key)
+	}
+	if err != nil {
+		return err
+	}
+	if string(b) != settings {
+		return fmt.Errorf("import session %s was started with other options: %s", s.key.BaseNamespace(), b)
+	}
+	return nil
+}
+
+// End removes the session, once the import completed.
+func (s *Session) End(ctx context.Context) error {
+	res, err := s.ds.Query(ctx, dsq.Query{Prefix: s.key.String(), KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := s.ds.Delete(ctx, ds.NewKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	if err := s.ds.Delete(ctx, s.key); err != nil {
+		return err
+	}
+	return s.ds.Sync(ctx, s.key)
+}
+
+func (s *Session) fileKey(path string) ds.Key {
+	return s.key.ChildString(base64.RawURLEncoding.EncodeToString([]byte(s.name + "/" + path)))
+}
+
+// done returns the CID of the file at path if the session completed it, and
+// it did not change since.
+func (s *Session) done(ctx context.Context, path string, st os.FileInfo) (cid.Cid, bool, error) {
+	b, err := s.ds.Get(ctx, s.fileKey(path))
+	if err == ds.ErrNotFound {
+		return cid.Undef, false, nil
+	}
+	if err != nil {
+		return cid.Undef, false, err
+	}
+	var f sessionFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return cid.Undef, false, fmt.Errorf("invalid import session record of %s: %w", path, err)
+	}
+	if f.Size != st.Size() || !f.ModTime.Equal(st.ModTime()) {
+		return cid.Undef, false, nil
+	}
+	return f.Cid, true, nil
+}
+
+// record records that the session completed the file at path. The records
+// are not synced one by one: those lost in a crash only have their file added
+// again.
+func (s *Session) record(ctx context.Context, path string, st os.FileInfo, c cid.Cid) error {
+	b, err := json.Marshal(&sessionFile{Cid: c, Size: st.Size(), ModTime: st.ModTime()})
+	if err != nil {
+		return err
+	}
+	return s.ds.Put(ctx, s.fileKey(path), b)
+}
+
+// fileStat returns the stat of file, if the file was read from the disk.
+func fileStat(file files.File) os.FileInfo {
+	if fi, ok := file.(files.FileInfo); ok {
+		return fi.Stat()
+	}
+	return nil
+}
+
+// resumeFile patches the file at path into the root if the session completed
+// it before, and its DAG is still complete, reporting whether it did.
+func (adder *Adder) resumeFile(path string, file files.File) (bool, error) {
+	st := fileStat(file)
+	if adder.Resume == nil || st == nil {
+		return false, nil
+	}
+	c, done, err := adder.Resume.done(adder.ctx, path, st)
+	if err != nil || !done {
+		return false, err
+	}
+	// the blocks may have been garbage collected since
+	missing, err := mfsjournal.Missing(adder.ctx, adder.dagService, c)
+	if err != nil {
+		return false, err
+	}
+	if missing.Defined() {
+		log.Infof("adding %s again, block %s is missing", path, missing)
+		return false, nil
+	}
+	nd, err := adder.dagService.Get(adder.ctx, c)
+	if err != nil {
+		return false, err
+	}
+
+	if err := adder.flushPending(); err != nil {
+		return false, err
+	}
+	if adder.Progress {
+		adder.Out <- &coreiface.AddEvent{
+			Name:  path,
+			Bytes: st.Size(),
+		}
+	}
+	return true, adder.addNode(nd, path)
+}
+
+// recordFile records in the session that the file at path was added as c.
+func (adder *Adder) recordFile(path string, st os.FileInfo, c cid.Cid) error {
+	if adder.Resume == nil || st == nil {
+		return nil
+	}
+	return adder.Resume.record(adder.ctx, path, st, c)
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Drainer tracks the work in flight on a node, such as adds, pins and
+// gateway transfers, so that the daemon can wait for it to complete before
+// shutting down. Once draining, it declines new work.
+//
+// The zero value is ready to use.
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	next     uint64
+	active   map[uint64]string
+	idle     chan struct{} // closed when draining and nothing is active
+}
+
+// Start registers a piece of work described by desc. It returns false if the
+// node is draining and the work must be declined. Otherwise, the returned
+// function must be called once the work is done.
+func (d *Drainer) Start(desc string) (func(), bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		return nil, false
+	}
+	if d.active == nil {
+		d.active = make(map[uint64]string)
+	}
+
+	id := d.next
+	d.next++
+	d.active[id] = desc
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+
+			delete(d.active, id)
+			if d.draining && len(d.active) == 0 {
+				close(d.idle)
+			}
+		})
+	}, true
+}
+
+// Draining reports whether the node declines new work.
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Drain declines new work from now on and waits for the work in flight to
+// complete, or for ctx to be done. It returns the number of pieces of work
+// that were in flight, and the description of those which are still active.
+func (d *Drainer) Drain(ctx context.Context) (int, []string) {
+	d.mu.Lock()
+	inFlight := len(d.active)
+	if !d.draining {
+		d.draining = true
+		d.idle = make(chan struct{})
+		if inFlight == 0 {
+			close(d.idle)
+		}
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	remaining := make([]string, 0, len(d.active))
+	for _, desc := range d.active {
+		remaining = append(remaining, desc)
+	}
+	sort.Strings(remaining)
+	return inFlight, remaining
+}
@@ -0,0 +1,94 @@
+// Package netfetch tells whether serving a request needed blocks from the
+// network, or could be done from the local blockstore alone.
+//
+// The exchange returned by NewExchange is only asked for the blocks missing
+// from the blockstore: it marks the tracker of the context of every fetch, as
+// set up with WithTracker.
+package netfetch
+
+import (
+	"context"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+type trackerKey struct{}
+
+// Tracker records whether blocks were fetched from the network.
+type Tracker struct {
+	fetched int32
+}
+
+// WithTracker returns a context whose fetches are recorded by the returned
+// tracker.
+func WithTracker(ctx context.Context) (context.Context, *Tracker) {
+	t := new(Tracker)
+	return context.WithValue(ctx, trackerKey{}, t), t
+}
+
+// Fetched reports whether blocks were fetched from the network.
+func (t *Tracker) Fetched() bool {
+	return atomic.LoadInt32(&t.fetched) != 0
+}
+
+func mark(ctx context.Context) {
+	if t, ok := ctx.Value(trackerKey{}).(*Tracker); ok {
+		atomic.StoreInt32(&t.fetched, 1)
+	}
+}
+
+// fetcher marks the trackers of the contexts of its fetches.
+type fetcher struct {
+	exchange.Fetcher
+}
+
+func (f fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	mark(ctx)
+	return f.Fetcher.GetBlock(ctx, c)
+}
+
+func (f fetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	mark(ctx)
+	return f.Fetcher.GetBlocks(ctx, ks)
+}
+
+// Exchange is an exchange marking the trackers of the contexts of its
+// fetches.
+type Exchange struct {
+	exchange.Interface
+	fetcher
+}
+
+// NewExchange returns ex, marking the trackers of the contexts of its fetches,
+// including those made through its sessions.
+func NewExchange(ex exchange.Interface) exchange.Interface {
+	e := &Exchange{Interface: ex, fetcher: fetcher{ex}}
+	if sex, ok := ex.(exchange.SessionExchange); ok {
+		return &SessionExchange{Exchange: e, sex: sex}
+	}
+	return e
+}
+
+// GetBlock implements exchange.Fetcher.
+func (e *Exchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return e.fetcher.GetBlock(ctx, c)
+}
+
+// GetBlocks implements exchange.Fetcher.
+func (e *Exchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	return e.fetcher.GetBlocks(ctx, ks)
+}
+
+// SessionExchange is an Exchange with sessions.
+type SessionExchange struct {
+	*Exchange
+	sex exchange.SessionExchange
+}
+
+// NewSession implements exchange.SessionExchange.
+func (e *SessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	return fetcher{e.sex.NewSession(ctx)}
+}
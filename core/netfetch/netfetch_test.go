@@ -0,0 +1,121 @@
+package netfetch
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+)
+
+// sessionExchange is an exchange whose sessions are the exchange itself.
+type sessionExchange struct {
+	exchange.Interface
+}
+
+func (e sessionExchange) NewSession(context.Context) exchange.Fetcher {
+	return e.Interface
+}
+
+func TestTrackerFetch(t *testing.T) {
+	ctx := context.Background()
+	local := blocks.NewBlock([]byte("local"))
+	remote := blocks.NewBlock([]byte("remote"))
+
+	// the remote block is only in the blockstore of the exchange, as if it
+	// came from the network
+	netbs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := netbs.Put(ctx, remote); err != nil {
+		t.Fatal(err)
+	}
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := bs.Put(ctx, local); err != nil {
+		t.Fatal(err)
+	}
+	ex := NewExchange(sessionExchange{offline.Exchange(netbs)})
+	if _, ok := ex.(exchange.SessionExchange); !ok {
+		t.Fatal("expected the sessions of the exchange kept")
+	}
+	bsvc := bserv.New(bs, ex)
+
+	for _, tc := range []struct {
+		name    string
+		get     func(ctx context.Context) error
+		fetched bool
+	}{
+		{"local block", func(ctx context.Context) error {
+			_, err := bsvc.GetBlock(ctx, local.Cid())
+			return err
+		}, false},
+		{"missing block", func(ctx context.Context) error {
+			_, err := bsvc.GetBlock(ctx, remote.Cid())
+			return err
+		}, true},
+		{"local blocks", func(ctx context.Context) error {
+			for range bsvc.GetBlocks(ctx, []cid.Cid{local.Cid()}) {
+			}
+			return nil
+		}, false},
+		{"missing blocks", func(ctx context.Context) error {
+			for range bsvc.GetBlocks(ctx, []cid.Cid{local.Cid(), remote.Cid()}) {
+			}
+			return nil
+		}, true},
+		{"session", func(ctx context.Context) error {
+			_, err := bserv.NewSession(ctx, bsvc).GetBlock(ctx, remote.Cid())
+			return err
+		}, true},
+	} {
+		tctx, tracker := WithTracker(ctx)
+		if err := tc.get(tctx); err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if tracker.Fetched() != tc.fetched {
+			t.Errorf("%s: expected fetched %t, got %t", tc.name, tc.fetched, tracker.Fetched())
+		}
+	}
+}
+
+func TestTrackerLimits(t *testing.T) {
+	ctx := context.Background()
+	b := blocks.NewBlock([]byte("remote"))
+	netbs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if err := netbs.Put(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	ex := NewExchange(offline.Exchange(netbs))
+
+	// fetches without a tracker are not recorded anywhere
+	if _, err := ex.GetBlock(ctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a tracker only records the fetches of its own context
+	tctx, tracker := WithTracker(ctx)
+	_, other := WithTracker(ctx)
+	if _, err := ex.GetBlock(tctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if !tracker.Fetched() {
+		t.Error("expected the fetch recorded")
+	}
+	if other.Fetched() {
+		t.Error("expected the fetch of another context not recorded")
+	}
+
+	// failed fetches still asked the network
+	tctx, tracker = WithTracker(ctx)
+	missing := blocks.NewBlock([]byte("missing"))
+	if _, err := ex.GetBlock(tctx, missing.Cid()); err == nil {
+		t.Fatal("expected the missing block not found")
+	}
+	if !tracker.Fetched() {
+		t.Error("expected the failed fetch recorded")
+	}
+}
@@ -0,0 +1,29 @@
+package node
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ipfs/go-ipfs/addscan"
+	config "github.com/ipfs/go-ipfs/config"
+)
+
+// AddScanner creates the scanner the files added are streamed to
+func AddScanner(cfg config.ImportScanner) func() (*addscan.Scanner, error) {
+	return func() (*addscan.Scanner, error) {
+		header := make(http.Header, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			header.Set(k, v)
+		}
+		s, err := addscan.New(addscan.Settings{
+			URL:      cfg.URL,
+			Header:   header,
+			Timeout:  cfg.Timeout.WithDefault(config.DefaultImportScanTimeout),
+			FailOpen: cfg.FailOpen.WithDefault(false),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Import.Scanner config: %s", err)
+		}
+		return s, nil
+	}
+}
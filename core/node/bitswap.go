@@ -2,17 +2,32 @@ package node
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/ipfs/go-bitswap"
+	bsmsg "github.com/ipfs/go-bitswap/message"
 	"github.com/ipfs/go-bitswap/network"
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	delay "github.com/ipfs/go-ipfs-delay"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	config "github.com/ipfs/go-ipfs/config"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/routing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/bitswapstats"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/dupblocks"
+	"github.com/ipfs/go-ipfs/peerstats"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/tracing"
 )
 
 const (
@@ -21,24 +36,142 @@ const (
 	DefaultTaskWorkerCount             = 8
 	DefaultEngineTaskWorkerCount       = 8
 	DefaultMaxOutstandingBytesPerPeer  = 1 << 20
+	DefaultProviderSearchDelay         = time.Second
+	DefaultRebroadcastDelay            = time.Minute
+	// bitswap looks up at most 10 providers for each want
+	DefaultSessionMaxProviders = 10
 )
 
-// OnlineExchange creates new LibP2P backed block exchange (BitSwap)
-func OnlineExchange(cfg *config.Config, provide bool) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
-		bitswapNetwork := network.NewFromIpfsHost(host, rt)
+// providerLimit caps the number of providers bitswap looks up for each want,
+// which join the peer set of the session of the want.
+type providerLimit struct {
+	routing.ContentRouting
+	limit int
+}
+
+func (r providerLimit) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	if count <= 0 || count > r.limit {
+		count = r.limit
+	}
+	return r.ContentRouting.FindProvidersAsync(ctx, c, count)
+}
+
+// tracers are the tracers of bitswap, each seeing all the messages.
+type tracers []bitswap.Tracer
+
+func (ts tracers) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, t := range ts {
+		t.MessageReceived(p, msg)
+	}
+}
+
+func (ts tracers) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	for _, t := range ts {
+		t.MessageSent(p, msg)
+	}
+}
+
+// wantTracingNetwork has the tracer see the wants bitswap sends to the peers,
+// which it does not trace itself, only tracing the messages of its engine.
+type wantTracingNetwork struct {
+	network.BitSwapNetwork
+	tracer bitswap.Tracer
+}
+
+func (n wantTracingNetwork) NewMessageSender(ctx context.Context, p peer.ID, opts *network.MessageSenderOpts) (network.MessageSender, error) {
+	ms, err := n.BitSwapNetwork.NewMessageSender(ctx, p, opts)
+	if err != nil {
+		return nil, err
+	}
+	return wantTracingSender{ms, p, n.tracer}, nil
+}
+
+type wantTracingSender struct {
+	network.MessageSender
+	p      peer.ID
+	tracer bitswap.Tracer
+}
 
+// SendMsg traces msg before sending it, for the answers not to be received
+// before the wants are traced.
+func (s wantTracingSender) SendMsg(ctx context.Context, msg bsmsg.BitSwapMessage) error {
+	ctx, span := tracing.Span(ctx, "Bitswap", "SendMsg", trace.WithAttributes(
+		attribute.String("peer", s.p.String()),
+		attribute.Int("wants", len(msg.Wantlist())),
+		attribute.Int("blocks", len(msg.Blocks())),
+	))
+	defer span.End()
+
+	s.tracer.MessageSent(s.p, msg)
+	return s.MessageSender.SendMsg(ctx, msg)
+}
+
+// OnlineExchange creates new LibP2P backed block exchange (BitSwap), with the
+// tracker of the duplicate blocks of its sessions and the recorder of what it
+// exchanged with each peer. The stats of the peers are recorded, and unless
+// disabled, persisted, the slow peers being the last providers looked up. The requests of the peers are tracked for the "demand"
+// reprovider strategy, if used.
+func OnlineExchange(cfg *config.Config, provide bool) interface{} {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, rt routing.Routing, bs blockstore.GCBlockstore, repo repo.Repo, dm optionalDemand) (exchange.Interface, *dupblocks.Tracker, *bitswapstats.Recorder, error) {
 		var internalBsCfg config.InternalBitswap
 		if cfg.Internal.Bitswap != nil {
 			internalBsCfg = *cfg.Internal.Bitswap
 		}
 
+		provSearchDelay := internalBsCfg.ProviderSearchDelay.WithDefault(DefaultProviderSearchDelay)
+		if provSearchDelay <= 0 {
+			return nil, nil, nil, fmt.Errorf("Internal.Bitswap.ProviderSearchDelay must be positive")
+		}
+		rebroadcastDelay := internalBsCfg.RebroadcastDelay.WithDefault(DefaultRebroadcastDelay)
+		if rebroadcastDelay <= 0 {
+			return nil, nil, nil, fmt.Errorf("Internal.Bitswap.RebroadcastDelay must be positive")
+		}
+		maxProviders := internalBsCfg.SessionMaxProviders.WithDefault(DefaultSessionMaxProviders)
+		if maxProviders < 1 || maxProviders > DefaultSessionMaxProviders {
+			return nil, nil, nil, fmt.Errorf("Internal.Bitswap.SessionMaxProviders must be between 1 and %d", DefaultSessionMaxProviders)
+		}
+
+		providerStats := internalBsCfg.ProviderStats.WithDefault(true)
+		// without the provider stats, the stats of the peers are only kept
+		// for the bitswap stats
+		var statsDs datastore.Datastore = dssync.MutexWrap(datastore.NewMapDatastore())
+		if providerStats {
+			statsDs = repo.Datastore()
+		}
+		stats, err := peerstats.New(mctx, statsDs)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return stats.Close()
+			},
+		})
+
+		tracker := dupblocks.NewTracker()
+		recorder := bitswapstats.New(stats)
+		tracer := tracers{tracker, recorder, stats}
+		if dm.Demand != nil {
+			tracer = append(tracer, dm.Demand)
+		}
+		var providers routing.ContentRouting = rt
+		if providerStats {
+			providers = peerstats.NewRouting(rt, stats)
+		}
+		bitswapNetwork := wantTracingNetwork{
+			BitSwapNetwork: network.NewFromIpfsHost(host, providerLimit{providers, int(maxProviders)}),
+			tracer:         tracer,
+		}
+
 		opts := []bitswap.Option{
 			bitswap.ProvideEnabled(provide),
 			bitswap.EngineBlockstoreWorkerCount(int(internalBsCfg.EngineBlockstoreWorkerCount.WithDefault(DefaultEngineBlockstoreWorkerCount))),
 			bitswap.TaskWorkerCount(int(internalBsCfg.TaskWorkerCount.WithDefault(DefaultTaskWorkerCount))),
 			bitswap.EngineTaskWorkerCount(int(internalBsCfg.EngineTaskWorkerCount.WithDefault(DefaultEngineTaskWorkerCount))),
 			bitswap.MaxOutstandingBytesPerPeer(int(internalBsCfg.MaxOutstandingBytesPerPeer.WithDefault(DefaultMaxOutstandingBytesPerPeer))),
+			bitswap.ProviderSearchDelay(provSearchDelay),
+			bitswap.RebroadcastDelay(delay.Fixed(rebroadcastDelay)),
+			bitswap.WithTracer(tracer),
 		}
 		exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs, opts...)
 		lc.Append(fx.Hook{
@@ -46,7 +179,7 @@ func OnlineExchange(cfg *config.Config, provide bool) interface{} {
 				return exch.Close()
 			},
 		})
-		return exch
+		return exch, tracker, recorder, nil
 
 	}
 }
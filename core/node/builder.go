@@ -8,6 +8,7 @@ import (
 
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
 	"github.com/ipfs/go-ipfs/repo"
@@ -37,6 +38,14 @@ type BuildCfg struct {
 	// If NilRepo is set, a Repo backed by a nil datastore will be constructed
 	NilRepo bool
 
+	// If ReadOnly is set, the subsystems changing the pins, MFS or published
+	// records of the node are disabled
+	ReadOnly bool
+
+	// BootstrapGroup is the group of Config.BootstrapGroups to bootstrap
+	// from, the Bootstrap peers when empty
+	BootstrapGroup string
+
 	Routing libp2p.RoutingOption
 	Host    libp2p.HostOption
 	Repo    repo.Repo
@@ -109,6 +118,10 @@ func (cfg *BuildCfg) options(ctx context.Context) (fx.Option, *cfg.Config) {
 		return cfg.Routing
 	})
 
+	bootstrapGroup := fx.Provide(func() *bootstrap.Group {
+		return bootstrap.NewGroup(cfg.BootstrapGroup)
+	})
+
 	conf, err := cfg.Repo.Config()
 	if err != nil {
 		return fx.Error(err), nil
@@ -118,6 +131,7 @@ func (cfg *BuildCfg) options(ctx context.Context) (fx.Option, *cfg.Config) {
 		repoOption,
 		hostOption,
 		routingOption,
+		bootstrapGroup,
 		metricsCtx,
 	), conf
 }
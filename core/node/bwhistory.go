@@ -0,0 +1,40 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-ipfs/bwhistory"
+	config "github.com/ipfs/go-ipfs/config"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	"go.uber.org/fx"
+)
+
+// BandwidthHistory creates the recorder of the history of the bandwidth
+// metrics
+func BandwidthHistory(cfg config.BandwidthHistory) func(fx.Lifecycle, *metrics.BandwidthCounter) (*bwhistory.Recorder, error) {
+	return func(lc fx.Lifecycle, reporter *metrics.BandwidthCounter) (*bwhistory.Recorder, error) {
+		settings := bwhistory.Settings{
+			Interval:  cfg.Interval.WithDefault(config.DefaultBandwidthHistoryInterval),
+			Retention: cfg.Retention.WithDefault(config.DefaultBandwidthHistoryRetention),
+			MaxPeers:  int(cfg.MaxPeers.WithDefault(config.DefaultBandwidthHistoryMaxPeers)),
+		}
+		if settings.Interval <= 0 {
+			return nil, fmt.Errorf("config setting Swarm.BandwidthHistory.Interval must be positive: %s", settings.Interval)
+		}
+		if settings.Retention < settings.Interval {
+			return nil, fmt.Errorf("config setting Swarm.BandwidthHistory.Retention must be at least the interval: %s", settings.Retention)
+		}
+		if settings.MaxPeers < 0 {
+			return nil, fmt.Errorf("config setting Swarm.BandwidthHistory.MaxPeers cannot be negative")
+		}
+
+		r := bwhistory.New(reporter, settings)
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return r.Close()
+			},
+		})
+		return r, nil
+	}
+}
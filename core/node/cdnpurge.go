@@ -0,0 +1,50 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ipfs/go-ipfs/cdnpurge"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/mfswatch"
+	"go.uber.org/fx"
+)
+
+// optionalPurger is the purger of the HTTP caches in front of the gateway,
+// which only exists when enabled
+type optionalPurger struct {
+	fx.In
+	Purger *cdnpurge.Purger `optional:"true"`
+}
+
+// GatewayPurger creates the purger of the HTTP caches in front of the
+// gateway, purging the sites published from the MFS as they change
+func GatewayPurger(cfg config.GatewayPurge) func(helpers.MetricsCtx, fx.Lifecycle, *mfswatch.Watcher) (*cdnpurge.Purger, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, w *mfswatch.Watcher) (*cdnpurge.Purger, error) {
+		header := make(http.Header, len(cfg.Headers))
+		for k, v := range cfg.Headers {
+			header.Set(k, v)
+		}
+		p, err := cdnpurge.New(cdnpurge.Settings{
+			URLs:    cfg.URLs,
+			Method:  cfg.Method.WithDefault(config.DefaultGatewayPurgeMethod),
+			Header:  header,
+			Timeout: cfg.Timeout.WithDefault(config.DefaultGatewayPurgeTimeout),
+			Sites:   cfg.Sites,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Gateway.Purge config: %s", err)
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return p.Close()
+			},
+		})
+		if err := p.WatchSites(helpers.LifecycleCtx(mctx, lc), w); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
@@ -0,0 +1,47 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/blocks/coldtier"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/jbenet/goprocess"
+	goprocessctx "github.com/jbenet/goprocess/context"
+)
+
+// DefaultColdTierInterval is how often the cold tier offload policy runs when
+// Datastore.ColdTier.Interval is not set.
+const DefaultColdTierInterval = time.Hour
+
+// ColdTierPolicy periodically offloads the blocks of the pins selected in
+// the cold tier config.
+func ColdTierPolicy(cfg config.ColdTier) func(lcProcess, *coldtier.Blockstore, pin.Pinner) error {
+	return func(lc lcProcess, bs *coldtier.Blockstore, pinner pin.Pinner) error {
+		if bs == nil {
+			return fmt.Errorf("cold tier policy configured without a cold tier datastore")
+		}
+
+		roots := make([]cid.Cid, 0, len(cfg.Pins))
+		for _, p := range cfg.Pins {
+			c, err := cid.Decode(p)
+			if err != nil {
+				return fmt.Errorf("failure to parse config setting Datastore.ColdTier.Pins: %s", err)
+			}
+			roots = append(roots, c)
+		}
+
+		interval := cfg.Interval.WithDefault(DefaultColdTierInterval)
+		if interval <= 0 {
+			return fmt.Errorf("config setting Datastore.ColdTier.Interval must be positive: %s", interval)
+		}
+
+		policy := coldtier.NewPolicy(bs, pinner, roots)
+		lc.Append(func(proc goprocess.Process) {
+			policy.Run(goprocessctx.OnClosingContext(proc), interval)
+		})
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/connpolicy"
+	host "github.com/libp2p/go-libp2p-core/host"
+	metrics "github.com/libp2p/go-libp2p-core/metrics"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+)
+
+type connPolicyIn struct {
+	fx.In
+
+	LC       fx.Lifecycle
+	Host     host.Host
+	Reporter *metrics.BandwidthCounter `optional:"true"`
+}
+
+// ConnPolicy creates the manager of the policies of the peer tags, tagging
+// the peers of the config.
+func ConnPolicy(cfg config.ConnMgr) func(connPolicyIn) (*connpolicy.Manager, error) {
+	return func(in connPolicyIn) (*connpolicy.Manager, error) {
+		policies := make(map[string]connpolicy.Policy, len(cfg.Tags))
+		for tag, tcfg := range cfg.Tags {
+			p, err := connpolicy.PolicyFromConfig(tcfg)
+			if err != nil {
+				return nil, fmt.Errorf("config setting Swarm.ConnMgr.Tags[%q]: %s", tag, err)
+			}
+			policies[tag] = p
+		}
+
+		var reporter metrics.Reporter
+		if in.Reporter != nil {
+			reporter = in.Reporter
+		}
+		m, err := connpolicy.New(in.Host, reporter, policies)
+		if err != nil {
+			return nil, err
+		}
+		for pid, tags := range cfg.Peers {
+			p, err := peer.Decode(pid)
+			if err != nil {
+				m.Close()
+				return nil, fmt.Errorf("config setting Swarm.ConnMgr.Peers: invalid peer ID %q: %s", pid, err)
+			}
+			for tag, weight := range tags {
+				m.Tag(p, tag, weight)
+			}
+		}
+
+		in.LC.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return m.Close()
+			},
+		})
+		return m, nil
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/ipfs/go-filestore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
 	pin "github.com/ipfs/go-ipfs-pinner"
 	"github.com/ipfs/go-ipfs-pinner/dspinner"
 	format "github.com/ipfs/go-ipld-format"
@@ -25,12 +26,47 @@ import (
 	"github.com/ipld/go-ipld-prime/schema"
 	"go.uber.org/fx"
 
+	"github.com/ipfs/go-ipfs/cancelwatch"
+	"github.com/ipfs/go-ipfs/coalesce"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/netfetch"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/dupblocks"
+	"github.com/ipfs/go-ipfs/membudget"
+	"github.com/ipfs/go-ipfs/mfsjournal"
+	"github.com/ipfs/go-ipfs/mfswatch"
+	"github.com/ipfs/go-ipfs/pinning/lazypin"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pinning/pinsize"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
+	"github.com/ipfs/go-ipfs/pinning/warmup"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/tenants"
 )
 
+// optionalDupBlocks is the tracker of the duplicate blocks of the bitswap
+// sessions, which only exists online
+type optionalDupBlocks struct {
+	fx.In
+	DupBlocks *dupblocks.Tracker `optional:"true"`
+}
+
 // BlockService creates new blockservice which provides an interface to fetch content-addressable blocks
-func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interface) blockservice.BlockService {
+func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interface, mb optionalMemoryBudget, dt optionalDupBlocks) blockservice.BlockService {
+	// watch the fetches going on once canceled, below the coalescing, which
+	// cancels a shared fetch when all its consumers gave up
+	rem = cancelwatch.NewExchange(rem)
+	// account the blocks received to the sessions that wanted them
+	if dt.DupBlocks != nil {
+		rem = dupblocks.NewExchange(rem, dt.DupBlocks)
+	}
+	// share the fetches of the blocks wanted by several consumers at once
+	rem = coalesce.NewExchange(rem)
+	// tell the gateway metrics apart the requests served from the blockstore
+	rem = netfetch.NewExchange(rem)
+	if mb.MemoryBudget != nil {
+		rem = membudget.NewExchange(rem, mb.MemoryBudget)
+	}
 	bsvc := blockservice.New(bs, rem)
 
 	lc.Append(fx.Hook{
@@ -42,8 +78,10 @@ func BlockService(lc fx.Lifecycle, bs blockstore.Blockstore, rem exchange.Interf
 	return bsvc
 }
 
-// Pinning creates new pinner which tells GC which blocks should be kept
-func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo) (pin.Pinner, error) {
+// Pinning creates new pinner which tells GC which blocks should be kept.
+// Unless Pinning.LazyLoad is disabled, the pinner loads in the background,
+// and the returned warmup pinner tells when it is loaded.
+func Pinning(mctx helpers.MetricsCtx, lc fx.Lifecycle, cfg *config.Config, bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo, ta optionalTenants) (pin.Pinner, *warmup.Pinner, error) {
 	rootDS := repo.Datastore()
 
 	syncFn := func(ctx context.Context) error {
@@ -54,14 +92,69 @@ func Pinning(bstore blockstore.Blockstore, ds format.DAGService, repo repo.Repo)
 	}
 	syncDs := &syncDagService{ds, syncFn}
 
-	ctx := context.TODO()
+	load := func(ctx context.Context) (pin.Pinner, error) {
+		return dspinner.New(ctx, rootDS, syncDs)
+	}
 
-	pinning, err := dspinner.New(ctx, rootDS, syncDs)
-	if err != nil {
-		return nil, err
+	var (
+		pinning pin.Pinner
+		wp      *warmup.Pinner
+	)
+	if cfg.Pinning.LazyLoad.WithDefault(true) {
+		// the pinner rebuilds its indexes after an unclean shutdown, which
+		// must not hold the start of the node
+		wp = warmup.New(helpers.LifecycleCtx(mctx, lc), load)
+		pinning = wp
+	} else {
+		var err error
+		pinning, err = load(context.TODO())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if ta.Tenants != nil {
+		pinning = tenants.NewPinner(pinning, ta.Tenants)
 	}
 
-	return pinning, nil
+	return pinning, wp, nil
+}
+
+// SelectorPins creates the store of the selector pins, which GC and the
+// reprovider handle along with the pins of the pinner
+func SelectorPins(repo repo.Repo) *selectorpin.Store {
+	return selectorpin.New(repo.Datastore())
+}
+
+// LazyPins creates the store of the lazy pins, whose roots GC handles as
+// best-effort roots
+func LazyPins(repo repo.Repo) *lazypin.Store {
+	return lazypin.New(repo.Datastore())
+}
+
+// PinMeta creates the store of the names and labels of the pins
+func PinMeta(repo repo.Repo) *pinmeta.Store {
+	return pinmeta.New(repo.Datastore())
+}
+
+// PinSizes creates the index of the storage taken by the recursive pins, whose
+// DAGs are walked in the local blockstore only
+func PinSizes(repo repo.Repo, bs blockstore.GCBlockstore) *pinsize.Index {
+	return pinsize.New(repo.Datastore(), merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs))))
+}
+
+// LazyPinFiller creates the filler of the lazy pins, which resumes filling
+// them when the node starts
+func LazyPinFiller(lc fx.Lifecycle, store *lazypin.Store, pinner pin.Pinner, dag format.DAGService, locker blockstore.GCLocker) *lazypin.Filler {
+	filler := lazypin.NewFiller(store, pinner, dag, locker)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return filler.Resume(ctx)
+		},
+		OnStop: func(context.Context) error {
+			return filler.Close()
+		},
+	})
+	return filler
 }
 
 var (
@@ -108,9 +201,23 @@ func Dag(bs blockservice.BlockService) format.DAGService {
 	return merkledag.NewDAGService(bs)
 }
 
-// Files loads persisted MFS root
-func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService) (*mfs.Root, error) {
-	dsk := datastore.NewKey("/local/filesroot")
+// FilesRootDatastoreKey is the datastore key of the MFS root
+var FilesRootDatastoreKey = datastore.NewKey("/local/filesroot")
+
+// FilesJournal creates the journal of the operations changing the MFS
+func FilesJournal(repo repo.Repo) *mfsjournal.Journal {
+	return mfsjournal.New(repo.Datastore(), FilesRootDatastoreKey)
+}
+
+// FilesWatcher creates the watcher of the changes of the MFS
+func FilesWatcher(dag format.DAGService) *mfswatch.Watcher {
+	return mfswatch.New(dag)
+}
+
+// Files loads persisted MFS root, rolling back the operations interrupted
+// when the node last stopped
+func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.DAGService, bs blockstore.GCBlockstore, journal *mfsjournal.Journal, watcher *mfswatch.Watcher, mp optionalMFSPublisher) (*mfs.Root, error) {
+	dsk := FilesRootDatastoreKey
 	pf := func(ctx context.Context, c cid.Cid) error {
 		rootDS := repo.Datastore()
 		if err := rootDS.Sync(ctx, blockstore.BlockPrefix); err != nil {
@@ -123,11 +230,22 @@ func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.
 		if err := rootDS.Put(ctx, dsk, c.Bytes()); err != nil {
 			return err
 		}
-		return rootDS.Sync(ctx, dsk)
+		if err := rootDS.Sync(ctx, dsk); err != nil {
+			return err
+		}
+
+		watcher.Publish(c)
+		if mp.Publisher != nil {
+			mp.Publisher.Publish(c)
+		}
+		return nil
 	}
 
 	var nd *merkledag.ProtoNode
 	ctx := helpers.LifecycleCtx(mctx, lc)
+	if err := recoverFiles(ctx, journal, bs); err != nil {
+		return nil, err
+	}
 	val, err := repo.Datastore().Get(ctx, dsk)
 
 	switch {
@@ -158,6 +276,7 @@ func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.
 		return nil, err
 	}
 
+	watcher.Publish(nd.Cid())
 	root, err := mfs.NewRoot(ctx, dag, nd, pf)
 
 	lc.Append(fx.Hook{
@@ -168,3 +287,26 @@ func Files(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, dag format.
 
 	return root, err
 }
+
+// recoverFiles rolls back the MFS root to before the operations interrupted
+// when the node last stopped, if any, provided the root they started from is
+// still present. Its DAG is not walked, as MFS may reference DAGs which are
+// not fetched.
+func recoverFiles(ctx context.Context, journal *mfsjournal.Journal, bs blockstore.GCBlockstore) error {
+	e, interrupted, err := journal.Interrupted(ctx)
+	if err != nil || !interrupted {
+		return err
+	}
+	if e.Root.Defined() {
+		has, err := bs.Has(ctx, e.Root)
+		if err != nil {
+			return err
+		}
+		if !has {
+			logger.Errorf("MFS operations %q were interrupted, and the root %s they started from is gone: kept the current root, check it with 'ipfs files fsck'", e.Ops, e.Root)
+			return journal.Discard(ctx)
+		}
+	}
+	logger.Warnf("MFS operations %q were interrupted, rolled back the MFS root to %s", e.Ops, e.Root)
+	return journal.Rollback(ctx, e)
+}
@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/demand"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+const (
+	// the defaults of Reprovider.Demand
+	DefaultDemandWindow      = 7 * 24 * time.Hour
+	DefaultDemandHotRequests = 10
+	DefaultDemandHotInterval = 2 * time.Hour
+)
+
+// optionalDemand is the tracker of the keys requested over bitswap, which
+// only exists online with the "demand" reprovider strategy
+type optionalDemand struct {
+	fx.In
+	Demand *demand.Tracker `optional:"true"`
+}
+
+// usesDemandStrategy reports whether the reprovider strategy s includes the
+// "demand" strategy.
+func usesDemandStrategy(s string) bool {
+	for _, part := range strings.Split(s, "+") {
+		if strings.SplitN(part, ":", 2)[0] == "demand" {
+			return true
+		}
+	}
+	return false
+}
+
+// DemandTracker creates the tracker of the keys requested over bitswap, for
+// the "demand" reprovider strategy
+func DemandTracker(cfg config.ReproviderDemand) func(helpers.MetricsCtx, fx.Lifecycle, repo.Repo) (*demand.Tracker, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*demand.Tracker, error) {
+		window := cfg.Window.WithDefault(DefaultDemandWindow)
+		if window <= 0 {
+			return nil, fmt.Errorf("config setting Reprovider.Demand.Window must be positive")
+		}
+		t, err := demand.New(mctx, repo.Datastore(), window)
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return t.Close()
+			},
+		})
+		return t, nil
+	}
+}
+
+// DemandReprovider reprovides the hot keys every Reprovider.Demand.HotInterval,
+// between the rounds of reprovides of the strategy every reproviderInterval.
+func DemandReprovider(cfg config.ReproviderDemand, reproviderInterval time.Duration) func(helpers.MetricsCtx, fx.Lifecycle, *demand.Tracker, routing.Routing, blockstore.Blockstore, optionalLowPower) error {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, t *demand.Tracker, rt routing.Routing, bs blockstore.Blockstore, lp optionalLowPower) error {
+		interval := cfg.HotInterval.WithDefault(DefaultDemandHotInterval)
+		if reproviderInterval <= 0 || interval <= 0 {
+			// reproviding is disabled
+			return nil
+		}
+		if interval >= reproviderInterval {
+			return fmt.Errorf("config setting Reprovider.Demand.HotInterval %s is not shorter than Reprovider.Interval %s", interval, reproviderInterval)
+		}
+		hot := cfg.HotRequests.WithDefault(DefaultDemandHotRequests)
+		if hot < 1 {
+			return fmt.Errorf("config setting Reprovider.Demand.HotRequests must be positive")
+		}
+
+		ctx, cancel := context.WithCancel(helpers.LifecycleCtx(mctx, lc))
+		done := make(chan struct{})
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					defer close(done)
+					tick := time.NewTicker(interval)
+					defer tick.Stop()
+					for {
+						select {
+						case <-tick.C:
+						case <-ctx.Done():
+							return
+						}
+						if lp.LowPower != nil {
+							if err := lp.LowPower.WaitAwake(ctx); err != nil {
+								return
+							}
+						}
+						n, err := demand.ReprovideHot(ctx, t, rt, bs.Has, uint64(hot))
+						if err != nil && ctx.Err() == nil {
+							logger.Errorf("reprovide the keys in demand: %s", err)
+						}
+						logger.Debugf("reprovided %d keys in demand", n)
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				cancel()
+				<-done
+				return nil
+			},
+		})
+		return nil
+	}
+}
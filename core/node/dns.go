@@ -1,14 +1,19 @@
 package node
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"strings"
+	"net"
+	"net/url"
+	"sync"
 	"time"
 
 	config "github.com/ipfs/go-ipfs/config"
 	doh "github.com/libp2p/go-doh-resolver"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 
 	"github.com/miekg/dns"
 )
@@ -18,21 +23,130 @@ var defaultResolvers = map[string]string{
 	"crypto.": "https://resolver.cloudflare-eth.com/dns-query",
 }
 
-func newResolver(url string, opts ...doh.Option) (madns.BasicResolver, error) {
-	if !strings.HasPrefix(url, "https://") {
-		return nil, fmt.Errorf("invalid resolver url: %s", url)
+// systemResolverLabel labels the metrics of the resolver of the operating
+// system, the catch-all one unless `.` is in DNS.Resolvers.
+const systemResolverLabel = "system"
+
+var (
+	dnsLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_dns_lookups_total",
+		Help: "DNS lookups, by resolver, record type and result: success, notfound or error",
+	}, []string{"resolver", "type", "result"})
+	dnsLookupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ipfs_dns_lookup_duration_seconds",
+		Help:    "duration of the DNS lookups, by resolver",
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"resolver"})
+)
+
+// meteredResolver records the lookups of a resolver in the metrics, labelled
+// with its URL.
+type meteredResolver struct {
+	madns.BasicResolver
+	label string
+}
+
+// resolverLabel returns the URL of a resolver without its credentials and
+// query, which may hold secrets.
+func resolverLabel(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+// observe records a lookup of typ started at start, which found n records.
+// The DoH resolvers find no records for the names that do not exist, where
+// the resolver of the system fails.
+func (r *meteredResolver) observe(typ string, start time.Time, n int, err error) {
+	dnsLookupDuration.WithLabelValues(r.label).Observe(time.Since(start).Seconds())
+	var result string
+	dnsErr, _ := err.(*net.DNSError)
+	switch {
+	case err == nil && n > 0:
+		result = "success"
+	case err == nil, dnsErr != nil && dnsErr.IsNotFound:
+		result = "notfound"
+	default:
+		result = "error"
+	}
+	dnsLookups.WithLabelValues(r.label, typ, result).Inc()
+}
+
+func (r *meteredResolver) LookupIPAddr(ctx context.Context, domain string) ([]net.IPAddr, error) {
+	start := time.Now()
+	addrs, err := r.BasicResolver.LookupIPAddr(ctx, domain)
+	r.observe("ip", start, len(addrs), err)
+	return addrs, err
+}
+
+func (r *meteredResolver) LookupTXT(ctx context.Context, domain string) ([]string, error) {
+	start := time.Now()
+	txt, err := r.BasicResolver.LookupTXT(ctx, domain)
+	r.observe("txt", start, len(txt), err)
+	return txt, err
+}
+
+// DNSResolverConstructor builds a resolver from the URL of an entry in
+// DNS.Resolvers.
+type DNSResolverConstructor func(url string, cfg config.DNS) (madns.BasicResolver, error)
+
+var (
+	resolverSchemesMu sync.Mutex
+	resolverSchemes   = map[string]DNSResolverConstructor{
+		"https": newDoHResolver,
 	}
+)
+
+// RegisterDNSResolver adds a type of resolver for the URLs of scheme in
+// DNS.Resolvers. It fails if the scheme is already registered.
+func RegisterDNSResolver(scheme string, c DNSResolverConstructor) error {
+	resolverSchemesMu.Lock()
+	defer resolverSchemesMu.Unlock()
+
+	if _, ok := resolverSchemes[scheme]; ok {
+		return fmt.Errorf("dns resolver scheme %q already registered", scheme)
+	}
+	resolverSchemes[scheme] = c
+	return nil
+}
 
+func newDoHResolver(url string, cfg config.DNS) (madns.BasicResolver, error) {
+	var opts []doh.Option
+	if !cfg.MaxCacheTTL.IsDefault() {
+		opts = append(opts, doh.WithMaxCacheTTL(cfg.MaxCacheTTL.WithDefault(time.Duration(math.MaxUint32)*time.Second)))
+	}
 	return doh.NewResolver(url, opts...)
 }
 
+func newResolver(rawurl string, cfg config.DNS) (madns.BasicResolver, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme == "" {
+		return nil, fmt.Errorf("invalid resolver url: %s", rawurl)
+	}
+
+	resolverSchemesMu.Lock()
+	c, ok := resolverSchemes[u.Scheme]
+	resolverSchemesMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unsupported resolver url scheme: %s", rawurl)
+	}
+	rslv, err := c(rawurl, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &meteredResolver{BasicResolver: rslv, label: resolverLabel(rawurl)}, nil
+}
+
 func DNSResolver(cfg *config.Config) (*madns.Resolver, error) {
 	var opts []madns.Option
 	var err error
 
-	var dohOpts []doh.Option
-	if !cfg.DNS.MaxCacheTTL.IsDefault() {
-		dohOpts = append(dohOpts, doh.WithMaxCacheTTL(cfg.DNS.MaxCacheTTL.WithDefault(time.Duration(math.MaxUint32)*time.Second)))
+	if cfg.DNS.Resolvers["."] == "" {
+		opts = append(opts, madns.WithDefaultResolver(&meteredResolver{BasicResolver: net.DefaultResolver, label: systemResolverLabel}))
 	}
 
 	domains := make(map[string]struct{})           // to track overridden default resolvers
@@ -51,7 +165,7 @@ func DNSResolver(cfg *config.Config) (*madns.Resolver, error) {
 
 		rslv, ok := rslvrs[url]
 		if !ok {
-			rslv, err = newResolver(url, dohOpts...)
+			rslv, err = newResolver(url, cfg.DNS)
 			if err != nil {
 				return nil, fmt.Errorf("bad resolver for %s: %w", domain, err)
 			}
@@ -65,6 +179,10 @@ func DNSResolver(cfg *config.Config) (*madns.Resolver, error) {
 		}
 	}
 
+	if !cfg.DNS.ImplicitResolvers.WithDefault(true) {
+		return madns.NewResolver(opts...)
+	}
+
 	// fill in defaults if not overridden by the user
 	for domain, url := range defaultResolvers {
 		_, ok := domains[domain]
@@ -74,7 +192,7 @@ func DNSResolver(cfg *config.Config) (*madns.Resolver, error) {
 
 		rslv, ok := rslvrs[url]
 		if !ok {
-			rslv, err = newResolver(url)
+			rslv, err = newResolver(url, config.DNS{})
 			if err != nil {
 				return nil, fmt.Errorf("bad resolver for %s: %w", domain, err)
 			}
@@ -0,0 +1,109 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	namesys "github.com/ipfs/go-namesys"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/dnslink"
+	"github.com/ipfs/go-ipfs/mfswatch"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// optionalDNSLink is the publisher of the DNSLink records, which only exists
+// when some are configured
+type optionalDNSLink struct {
+	fx.In
+	Publisher *dnslink.Publisher `optional:"true"`
+}
+
+// DNSLinkPublisher creates the publisher keeping the DNSLink records in sync
+// with the names published by the node and the MFS, updating them as these
+// change
+func DNSLinkPublisher(cfg config.DNSLink) func(helpers.MetricsCtx, fx.Lifecycle, repo.Repo, peer.ID, *mfswatch.Watcher) (*dnslink.Publisher, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, self peer.ID, w *mfswatch.Watcher) (*dnslink.Publisher, error) {
+		providers := make(map[string]dnslink.Provider, len(cfg.Providers))
+		for name, pcfg := range cfg.Providers {
+			p, err := dnslink.NewProvider(pcfg.Type, pcfg.Params)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DNSLink config: provider %s: %w", name, err)
+			}
+			providers[name] = p
+		}
+
+		records := make([]dnslink.Record, 0, len(cfg.Records))
+		var paths []string
+		for _, rcfg := range cfg.Records {
+			p, ok := providers[rcfg.Provider]
+			if !ok {
+				return nil, fmt.Errorf("invalid DNSLink config: record %s: unknown provider %q", rcfg.Domain, rcfg.Provider)
+			}
+			src, err := dnslinkSource(repo, self, w, rcfg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid DNSLink config: record %s: %w", rcfg.Domain, err)
+			}
+			records = append(records, dnslink.Record{
+				Domain:   rcfg.Domain,
+				TTL:      rcfg.TTL.WithDefault(0),
+				Provider: p,
+				Source:   src,
+			})
+			if rcfg.MFSPath != "" {
+				paths = append(paths, rcfg.MFSPath)
+			}
+		}
+
+		pub := dnslink.NewPublisher(records)
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		if err := pub.WatchFiles(ctx, w, paths...); err != nil {
+			return nil, err
+		}
+		interval := cfg.Interval.WithDefault(config.DefaultDNSLinkInterval)
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go pub.Run(ctx, interval)
+				return nil
+			},
+		})
+		return pub, nil
+	}
+}
+
+// dnslinkSource returns the source of the value of a DNSLink record: the
+// value last published by the node for its key, or the CID of its MFS path
+// in the MFS root last flushed.
+func dnslinkSource(repo repo.Repo, self peer.ID, w *mfswatch.Watcher, rcfg config.DNSLinkRecord) (dnslink.Source, error) {
+	switch {
+	case rcfg.Key != "" && rcfg.MFSPath != "":
+		return nil, fmt.Errorf("only one of Key and MFSPath can be set")
+	case rcfg.MFSPath != "":
+		return func(ctx context.Context) (string, error) {
+			c, err := w.Resolve(ctx, rcfg.MFSPath)
+			if err != nil || c == cid.Undef {
+				return "", err
+			}
+			return "/ipfs/" + c.String(), nil
+		}, nil
+	case rcfg.Key != "":
+		id, err := keyID(repo, self, rcfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		published := namesys.NewIpnsPublisher(nil, repo.Datastore())
+		return func(ctx context.Context) (string, error) {
+			entry, err := published.GetPublished(ctx, id, false)
+			if err != nil || entry == nil {
+				return "", err
+			}
+			return string(entry.GetValue()), nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("one of Key and MFSPath must be set")
+	}
+}
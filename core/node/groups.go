@@ -13,7 +13,10 @@ import (
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 
+	"github.com/ipfs/go-ipfs/carprogress"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/fetchprogress"
+	"github.com/ipfs/go-ipfs/hashfunc"
 	"github.com/ipfs/go-ipfs/p2p"
 
 	offline "github.com/ipfs/go-ipfs-exchange-offline"
@@ -27,7 +30,6 @@ import (
 var logger = log.Logger("core:constructor")
 
 var BaseLibP2P = fx.Options(
-	fx.Provide(libp2p.UserAgent),
 	fx.Provide(libp2p.PNet),
 	fx.Provide(libp2p.ConnectionManager),
 	fx.Provide(libp2p.Host),
@@ -71,7 +73,8 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	// parse PubSub config
 
 	ps, disc := fx.Options(), fx.Options()
-	if bcfg.getOpt("pubsub") || bcfg.getOpt("ipnsps") {
+	// the MFS replication runs over pubsub
+	if bcfg.getOpt("pubsub") || bcfg.getOpt("ipnsps") || cfg.Files.Replication.Enabled() {
 		disc = fx.Provide(libp2p.TopicDiscovery())
 
 		var pubsubOptions []pubsub.Option
@@ -147,13 +150,14 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		// Services (resource management)
 		fx.Provide(libp2p.ResourceManager(cfg.Swarm)),
 		fx.Provide(libp2p.AddrFilters(cfg.Swarm.AddrFilters)),
-		fx.Provide(libp2p.AddrsFactory(cfg.Addresses.Announce, cfg.Addresses.AppendAnnounce, cfg.Addresses.NoAnnounce)),
+		fx.Provide(libp2p.UserAgent(cfg.Swarm.Identify)),
+		fx.Provide(libp2p.AddrsFactory(cfg.Addresses.Announce, cfg.Addresses.AppendAnnounce, cfg.Addresses.NoAnnounce, cfg.Addresses.NoAnnounceTransports)),
 		fx.Provide(libp2p.SmuxTransport(cfg.Swarm.Transports)),
 		fx.Provide(libp2p.RelayTransport(enableRelayTransport)),
 		fx.Provide(libp2p.RelayService(cfg.Swarm.RelayService.Enabled.WithDefault(true), cfg.Swarm.RelayService)),
 		fx.Provide(libp2p.Transports(cfg.Swarm.Transports)),
 		fx.Invoke(libp2p.StartListening(cfg.Addresses.Swarm)),
-		fx.Invoke(libp2p.SetupDiscovery(cfg.Discovery.MDNS.Enabled, cfg.Discovery.MDNS.Interval)),
+		fx.Invoke(libp2p.SetupDiscovery(cfg.Discovery.MDNS)),
 		fx.Provide(libp2p.ForceReachability(cfg.Internal.Libp2pForceReachability)),
 		fx.Provide(libp2p.StaticRelays(cfg.Swarm.RelayClient.StaticRelays)),
 		fx.Provide(libp2p.HolePunching(cfg.Swarm.EnableHolePunching, cfg.Swarm.RelayClient.Enabled.WithDefault(false))),
@@ -162,9 +166,13 @@ func LibP2P(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 
 		fx.Provide(libp2p.Routing),
 		fx.Provide(libp2p.BaseRouting(cfg.Experimental.AcceleratedDHTClient)),
-		maybeProvide(libp2p.PubsubRouter, bcfg.getOpt("ipnsps")),
+		maybeProvide(libp2p.PubsubRouter(cfg.Ipns), bcfg.getOpt("ipnsps")),
+		maybeProvide(libp2p.IndexerRouter(cfg.Routing.Indexers), len(cfg.Routing.Indexers.Endpoints) > 0),
+		maybeProvide(libp2p.LANAnnouncer(cfg.Discovery.MDNS), cfg.Discovery.MDNS.Enabled && cfg.Discovery.MDNS.AnnounceContent.WithDefault(false)),
+		maybeInvoke(libp2p.SpeedTestServer(cfg.Swarm.SpeedTest), cfg.Swarm.SpeedTest.Enabled.WithDefault(false)),
 
 		maybeProvide(libp2p.BandwidthCounter, !cfg.Swarm.DisableBandwidthMetrics),
+		maybeProvide(BandwidthHistory(cfg.Swarm.BandwidthHistory), !cfg.Swarm.DisableBandwidthMetrics),
 		maybeProvide(libp2p.NatPortMap, !cfg.Swarm.DisableNatPortMap),
 		maybeProvide(libp2p.AutoRelay(len(cfg.Swarm.RelayClient.StaticRelays) == 0), cfg.Swarm.RelayClient.Enabled.WithDefault(false)),
 		autonat,
@@ -192,7 +200,8 @@ func Storage(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	return fx.Options(
 		fx.Provide(RepoConfig),
 		fx.Provide(Datastore),
-		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead)),
+		fx.Provide(ExpiringPins),
+		fx.Provide(BaseBlockstoreCtor(cacheOpts, bcfg.NilRepo, cfg.Datastore.HashOnRead, cfg.Datastore.GroupCommit, cfg.Datastore.Placement)),
 		finalBstore,
 	)
 }
@@ -284,6 +293,17 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 	/* don't provide from bitswap when the strategic provider service is active */
 	shouldBitswapProvide := !cfg.Experimental.StrategicProviding
 
+	// the keys requested over bitswap are tracked for the "demand" strategy
+	useDemand := !cfg.Experimental.StrategicProviding && usesDemandStrategy(cfg.Reprovider.Strategy)
+	reproviderInterval := kReprovideFrequency
+	if cfg.Reprovider.Interval != "" {
+		d, err := time.ParseDuration(cfg.Reprovider.Interval)
+		if err != nil {
+			return fx.Error(fmt.Errorf("failure to parse config setting Reprovider.Interval: %s", err))
+		}
+		reproviderInterval = d
+	}
+
 	return fx.Options(
 		fx.Provide(OnlineExchange(cfg, shouldBitswapProvide)),
 		maybeProvide(Graphsync, cfg.Experimental.GraphsyncEnabled),
@@ -291,13 +311,31 @@ func Online(bcfg *BuildCfg, cfg *config.Config) fx.Option {
 		fx.Provide(Namesys(ipnsCacheSize)),
 		fx.Provide(Peering),
 		PeerWith(cfg.Peering.Peers...),
-
-		fx.Invoke(IpnsRepublisher(repubPeriod, recordLifetime)),
+		fx.Provide(ConnPolicy(cfg.Swarm.ConnMgr)),
+		fx.Provide(LazyPinFiller),
+		fx.Provide(LowPower(cfg.LowPower)),
+		maybeProvide(PublishQueue, cfg.Routing.PublishQueue.WithDefault(false)),
+		maybeProvide(PubsubHistory(cfg.Pubsub.History), bcfg.getOpt("pubsub") && len(cfg.Pubsub.History.Topics) > 0),
+		maybeProvide(MFSPublisher(cfg.Files.Replication), cfg.Files.Replication.Publish.WithDefault(false) && !bcfg.ReadOnly),
+		maybeProvide(MFSFollower(cfg.Files.Replication, cfg.Pubsub), cfg.Files.Replication.Follow != "" && !bcfg.ReadOnly),
+		maybeProvide(PinFollower(cfg.Pinning.Follow), cfg.Pinning.Follow.Source != "" && !bcfg.ReadOnly),
+		maybeProvide(RemotePinSyncer, remotePinSyncEnabled(cfg.Pinning) && !bcfg.ReadOnly),
+		maybeProvide(UpdateChecker(cfg.Update), cfg.Update.Check.WithDefault(false)),
+		maybeProvide(DNSLinkPublisher(cfg.DNSLink), len(cfg.DNSLink.Records) > 0 && !bcfg.ReadOnly),
+		maybeProvide(ProfileHistory(cfg.Profiling), cfg.Profiling.Enabled.WithDefault(false)),
+
+		maybeInvoke(IpnsRepublisher(repubPeriod, recordLifetime), !bcfg.ReadOnly),
+		maybeInvoke(ColdTierPolicy(cfg.Datastore.ColdTier), len(cfg.Datastore.ColdTier.Spec) > 0),
+		maybeInvoke(PlacementPolicy(cfg.Datastore.Placement), hasPinLabelRules(cfg.Datastore.Placement) && !bcfg.ReadOnly),
+		maybeInvoke(PinExpiryPolicy(cfg.Pinning.Expiry), !bcfg.ReadOnly),
+		maybeInvoke(ShedConnections, cfg.ResourceBudget.ShedConnections.WithDefault(false)),
 
 		fx.Provide(p2p.New),
 
 		LibP2P(bcfg, cfg),
-		OnlineProviders(cfg.Experimental.StrategicProviding, cfg.Experimental.AcceleratedDHTClient, cfg.Reprovider.Strategy, cfg.Reprovider.Interval),
+		OnlineProviders(cfg.Experimental.StrategicProviding, cfg.Experimental.AcceleratedDHTClient, cfg.Reprovider.Strategy, cfg.Reprovider.Interval, cfg.Reprovider.RecordValidity.WithDefault(config.DefaultProviderRecordValidity), cfg.Reprovider.Spread.WithDefault(false)),
+		maybeProvide(DemandTracker(cfg.Reprovider.Demand), useDemand),
+		maybeInvoke(DemandReprovider(cfg.Reprovider.Demand, reproviderInterval), useDemand),
 	)
 }
 
@@ -308,7 +346,7 @@ func Offline(cfg *config.Config) fx.Option {
 		fx.Provide(DNSResolver),
 		fx.Provide(Namesys(0)),
 		fx.Provide(offroute.NewOfflineRouter),
-		OfflineProviders(cfg.Experimental.StrategicProviding, cfg.Experimental.AcceleratedDHTClient, cfg.Reprovider.Strategy, cfg.Reprovider.Interval),
+		OfflineProviders(cfg.Experimental.StrategicProviding, cfg.Experimental.AcceleratedDHTClient, cfg.Reprovider.Strategy, cfg.Reprovider.Interval, cfg.Reprovider.RecordValidity.WithDefault(config.DefaultProviderRecordValidity)),
 	)
 }
 
@@ -318,7 +356,15 @@ var Core = fx.Options(
 	fx.Provide(Dag),
 	fx.Provide(FetcherConfig),
 	fx.Provide(Pinning),
+	fx.Provide(SelectorPins),
+	fx.Provide(LazyPins),
+	fx.Provide(PinMeta),
+	fx.Provide(PinSizes),
+	fx.Provide(FilesJournal),
+	fx.Provide(FilesWatcher),
 	fx.Provide(Files),
+	fx.Provide(fetchprogress.NewRegistry),
+	fx.Provide(carprogress.NewRegistry),
 )
 
 func Networked(bcfg *BuildCfg, cfg *config.Config) fx.Option {
@@ -347,6 +393,10 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 	}
 	uio.HAMTShardingSize = int(shardSizeInt)
 
+	if err := hashfunc.Enable(cfg.Import.HashFunctions...); err != nil {
+		return fx.Error(fmt.Errorf("Import.HashFunctions: %w", err))
+	}
+
 	// Migrate users of deprecated Experimental.ShardingEnabled flag
 	if cfg.Experimental.ShardingEnabled {
 		logger.Fatal("The `Experimental.ShardingEnabled` field is no longer used, please remove it from the config.\n" +
@@ -361,6 +411,14 @@ func IPFS(ctx context.Context, bcfg *BuildCfg) fx.Option {
 
 		Storage(bcfg, cfg),
 		Identity(cfg),
+		maybeProvide(MemoryBudget(cfg.MemoryBudget), cfg.MemoryBudget.Limit != nil),
+		fx.Provide(ResourceBudget(cfg.ResourceBudget)),
+		maybeProvide(BackgroundIO(cfg.Datastore.BackgroundIO), cfg.Datastore.BackgroundIO != config.BackgroundIO{}),
+		maybeProvide(Maintenance(cfg.Maintenance), len(cfg.Maintenance.Windows) > 0),
+		maybeProvide(Tenants(cfg.API), len(cfg.API.Authorizations) > 0),
+		maybeProvide(GatewayPurger(cfg.Gateway.Purge), len(cfg.Gateway.Purge.URLs) > 0),
+		maybeProvide(Hooks(cfg.Hooks), len(cfg.Hooks.OnPublish) > 0 || len(cfg.Hooks.OnFilesChange) > 0),
+		maybeProvide(AddScanner(cfg.Import.Scanner), cfg.Import.Scanner.URL != ""),
 		IPNS,
 		Networked(bcfg, cfg),
 
@@ -0,0 +1,90 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/hooks"
+	"github.com/ipfs/go-ipfs/mfswatch"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// optionalHooks is the runner of the hooks, which only exists when some are
+// configured
+type optionalHooks struct {
+	fx.In
+	Runner *hooks.Runner `optional:"true"`
+}
+
+// Hooks creates the runner of the commands and webhooks run when a name is
+// published or the MFS changes
+func Hooks(cfg config.Hooks) func(helpers.MetricsCtx, fx.Lifecycle, repo.Repo, peer.ID, *mfswatch.Watcher) (*hooks.Runner, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, self peer.ID, w *mfswatch.Watcher) (*hooks.Runner, error) {
+		convert := func(hs []config.Hook) ([]hooks.Hook, error) {
+			out := make([]hooks.Hook, 0, len(hs))
+			for _, h := range hs {
+				header := make(http.Header, len(h.Headers))
+				for k, v := range h.Headers {
+					header.Set(k, v)
+				}
+				hook := hooks.Hook{Exec: h.Exec, URL: h.URL, Header: header, Path: h.Path}
+				if h.Key != "" {
+					id, err := keyID(repo, self, h.Key)
+					if err != nil {
+						return nil, err
+					}
+					hook.Key = id
+				}
+				out = append(out, hook)
+			}
+			return out, nil
+		}
+		onPublish, err := convert(cfg.OnPublish)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Hooks config: %s", err)
+		}
+		onFilesChange, err := convert(cfg.OnFilesChange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Hooks config: %s", err)
+		}
+
+		r, err := hooks.New(hooks.Settings{
+			OnPublish:     onPublish,
+			OnFilesChange: onFilesChange,
+			Timeout:       cfg.Timeout.WithDefault(config.DefaultHookTimeout),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Hooks config: %s", err)
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return r.Close()
+			},
+		})
+		if err := r.WatchFiles(helpers.LifecycleCtx(mctx, lc), w); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+// keyID returns the ID of a key of the node, given by name or ID.
+func keyID(repo repo.Repo, self peer.ID, key string) (peer.ID, error) {
+	if key == "self" {
+		return self, nil
+	}
+	if sk, err := repo.Keystore().Get(key); err == nil {
+		return peer.IDFromPrivateKey(sk)
+	}
+	id, err := peer.Decode(key)
+	if err != nil {
+		return "", fmt.Errorf("no key named %q", key)
+	}
+	return id, nil
+}
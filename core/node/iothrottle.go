@@ -0,0 +1,32 @@
+package node
+
+import (
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"go.uber.org/fx"
+)
+
+// optionalBackgroundIO is the limiter of the background jobs, which only
+// exists when Datastore.BackgroundIO sets a limit
+type optionalBackgroundIO struct {
+	fx.In
+	BackgroundIO *iothrottle.Limiter `optional:"true"`
+}
+
+// BackgroundIO creates the limiter of the disk I/O of the background jobs
+func BackgroundIO(cfg config.BackgroundIO) func() (*iothrottle.Limiter, error) {
+	return func() (*iothrottle.Limiter, error) {
+		ops := cfg.OperationsPerSecond.WithDefault(0)
+		if ops < 0 {
+			return nil, fmt.Errorf("Datastore.BackgroundIO.OperationsPerSecond cannot be negative")
+		}
+		bytes, err := humanize.ParseBytes(cfg.BytesPerSecond.WithDefault("0"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Datastore.BackgroundIO.BytesPerSecond: %s", err)
+		}
+		return iothrottle.New(uint64(ops), bytes), nil
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"github.com/libp2p/go-libp2p-record"
 	madns "github.com/multiformats/go-multiaddr-dns"
 
+	"github.com/ipfs/go-ipfs/ipnscache"
+	"github.com/ipfs/go-ipfs/lowpower"
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-namesys"
 	"github.com/ipfs/go-namesys/republisher"
@@ -28,8 +30,8 @@ func RecordValidator(ps peerstore.Peerstore) record.Validator {
 }
 
 // Namesys creates new name system
-func Namesys(cacheSize int) func(rt routing.Routing, rslv *madns.Resolver, repo repo.Repo) (namesys.NameSystem, error) {
-	return func(rt routing.Routing, rslv *madns.Resolver, repo repo.Repo) (namesys.NameSystem, error) {
+func Namesys(cacheSize int) func(rt routing.Routing, rslv *madns.Resolver, repo repo.Repo, pq optionalPublishQueue, gp optionalPurger, oh optionalHooks, dl optionalDNSLink) (namesys.NameSystem, error) {
+	return func(rt routing.Routing, rslv *madns.Resolver, repo repo.Repo, pq optionalPublishQueue, gp optionalPurger, oh optionalHooks, dl optionalDNSLink) (namesys.NameSystem, error) {
 		opts := []namesys.Option{
 			namesys.WithDatastore(repo.Datastore()),
 			namesys.WithDNSResolver(rslv),
@@ -39,22 +41,44 @@ func Namesys(cacheSize int) func(rt routing.Routing, rslv *madns.Resolver, repo
 			opts = append(opts, namesys.WithCache(cacheSize))
 		}
 
-		return namesys.NewNameSystem(rt, opts...)
+		// persist the records we see so names can be resolved from a stale
+		// record when the routing system can't find them
+		ns, err := namesys.NewNameSystem(ipnscache.NewValueStore(pq.routing(rt), repo.Datastore()), opts...)
+		if err != nil {
+			return nil, err
+		}
+		// the caches in front of the gateway drop the names published anew
+		if gp.Purger != nil {
+			ns = gp.Purger.NameSystem(ns, repo.Datastore())
+		}
+		if oh.Runner != nil {
+			ns = oh.Runner.NameSystem(ns, repo.Datastore())
+		}
+		if dl.Publisher != nil {
+			ns = dl.Publisher.NameSystem(ns)
+		}
+		return ns, nil
 	}
 }
 
 // IpnsRepublisher runs new IPNS republisher service
-func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey) error {
-	return func(lc lcProcess, namesys namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey) error {
-		repub := republisher.NewRepublisher(namesys, repo.Datastore(), privKey, repo.Keystore())
-
+func IpnsRepublisher(repubPeriod time.Duration, recordLifetime time.Duration) func(lcProcess, namesys.NameSystem, repo.Repo, crypto.PrivKey, optionalLowPower) error {
+	return func(lc lcProcess, ns namesys.NameSystem, repo repo.Repo, privKey crypto.PrivKey, lp optionalLowPower) error {
+		interval := republisher.DefaultRebroadcastInterval
 		if repubPeriod != 0 {
 			if !util.Debug && (repubPeriod < time.Minute || repubPeriod > (time.Hour*24)) {
 				return fmt.Errorf("config setting IPNS.RepublishPeriod is not between 1min and 1day: %s", repubPeriod)
 			}
 
-			repub.Interval = repubPeriod
+			interval = repubPeriod
+		}
+
+		var pub namesys.Publisher = ns
+		if lp.LowPower != nil {
+			pub = lowpower.NewRepublisher(ns, lp.LowPower, interval)
 		}
+		repub := republisher.NewRepublisher(pub, repo.Datastore(), privKey, repo.Keystore())
+		repub.Interval = interval
 
 		if recordLifetime != 0 {
 			repub.RecordLifetime = recordLifetime
@@ -25,7 +25,7 @@ func AddrFilters(filters []string) func() (*ma.Filters, Libp2pOpts, error) {
 	}
 }
 
-func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string) (p2pbhost.AddrsFactory, error) {
+func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string, noAnnounceTransports []string) (p2pbhost.AddrsFactory, error) {
 	var err error                     // To assign to the slice in the for loop
 	existing := make(map[string]bool) // To avoid duplicates
 
@@ -66,6 +66,15 @@ func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []st
 		noAnnAddrs[string(maddr.Bytes())] = true
 	}
 
+	noAnnProtos := map[int]bool{}
+	for _, name := range noAnnounceTransports {
+		p := ma.ProtocolWithName(name)
+		if p.Code == 0 {
+			return nil, fmt.Errorf("unknown transport in Addresses.NoAnnounceTransports: %s", name)
+		}
+		noAnnProtos[p.Code] = true
+	}
+
 	return func(allAddrs []ma.Multiaddr) []ma.Multiaddr {
 		var addrs []ma.Multiaddr
 		if len(annAddrs) > 0 {
@@ -80,7 +89,7 @@ func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []st
 			// check for exact matches
 			ok := noAnnAddrs[string(maddr.Bytes())]
 			// check for /ipcidr matches
-			if !ok && !filters.AddrBlocked(maddr) {
+			if !ok && !filters.AddrBlocked(maddr) && !hasProtocol(maddr, noAnnProtos) {
 				out = append(out, maddr)
 			}
 		}
@@ -88,9 +97,22 @@ func makeAddrsFactory(announce []string, appendAnnouce []string, noAnnounce []st
 	}, nil
 }
 
-func AddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string) func() (opts Libp2pOpts, err error) {
+// hasProtocol returns whether maddr has a protocol of codes.
+func hasProtocol(maddr ma.Multiaddr, codes map[int]bool) bool {
+	if len(codes) == 0 {
+		return false
+	}
+	for _, p := range maddr.Protocols() {
+		if codes[p.Code] {
+			return true
+		}
+	}
+	return false
+}
+
+func AddrsFactory(announce []string, appendAnnouce []string, noAnnounce []string, noAnnounceTransports []string) func() (opts Libp2pOpts, err error) {
 	return func() (opts Libp2pOpts, err error) {
-		addrsFactory, err := makeAddrsFactory(announce, appendAnnouce, noAnnounce)
+		addrsFactory, err := makeAddrsFactory(announce, appendAnnouce, noAnnounce, noAnnounceTransports)
 		if err != nil {
 			return opts, err
 		}
@@ -0,0 +1,95 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	host "github.com/libp2p/go-libp2p-core/host"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	dual "github.com/libp2p/go-libp2p-kad-dht/dual"
+	dhtmetrics "github.com/libp2p/go-libp2p-kad-dht/metrics"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// dhtServedView counts the requests received by the DHTs, which only serve
+// them in server mode, by DHT and message type.
+var dhtServedView = &view.View{
+	Name:        "ipfs/dht/served_requests",
+	Description: "Requests served by the DHTs of the node",
+	Measure:     dhtmetrics.ReceivedMessages,
+	TagKeys:     []tag.Key{dhtmetrics.KeyInstanceID, dhtmetrics.KeyMessageType},
+	Aggregation: view.Count(),
+}
+
+func init() {
+	if err := view.Register(dhtServedView); err != nil {
+		log.Errorf("registering the DHT metrics: %s", err)
+	}
+}
+
+// DHTServed returns the number of requests d served since the node started,
+// by message type.
+func DHTServed(d *dht.IpfsDHT) (map[string]int64, error) {
+	rows, err := view.RetrieveData(dhtServedView.Name)
+	if err != nil {
+		return nil, err
+	}
+	// the DHTs are told apart by their address
+	id := fmt.Sprintf("%p", d)
+	served := make(map[string]int64)
+	for _, row := range rows {
+		var instance, msgType string
+		for _, t := range row.Tags {
+			switch t.Key {
+			case dhtmetrics.KeyInstanceID:
+				instance = t.Value
+			case dhtmetrics.KeyMessageType:
+				msgType = t.Value
+			}
+		}
+		if c, ok := row.Data.(*view.CountData); ok && instance == id {
+			served[msgType] += c.Value
+		}
+	}
+	return served, nil
+}
+
+// DHTServing reports whether the WAN, or else the LAN, DHT of h answers the
+// queries of other peers: DHTs in auto mode only do when the node is
+// reachable.
+func DHTServing(h host.Host, lan bool) bool {
+	p := dht.ProtocolDHT
+	if lan {
+		p = protocol.ID(dht.DefaultPrefix) + dual.LanExtension + "/kad/1.0.0"
+	}
+	for _, served := range h.Mux().Protocols() {
+		if served == string(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// CountDHTProviders counts the provider records the DHTs hold in d, the
+// datastore they share: those of other peers, and those of the node.
+func CountDHTProviders(ctx context.Context, d ds.Datastore) (int, error) {
+	res, err := d.Query(ctx, dsq.Query{Prefix: providers.ProvidersKeyPrefix, KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer res.Close()
+
+	n := 0
+	for r := range res.Next() {
+		if r.Error != nil {
+			return 0, r.Error
+		}
+		n++
+	}
+	return n, nil
+}
@@ -2,6 +2,7 @@ package libp2p
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/host"
@@ -9,16 +10,21 @@ import (
 	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	legacymdns "github.com/libp2p/go-libp2p/p2p/discovery/mdns_legacy"
 
+	routinghelpers "github.com/libp2p/go-libp2p-routing-helpers"
+
 	"go.uber.org/fx"
 
+	config "github.com/ipfs/go-ipfs/config"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/lanannounce"
 )
 
 const discoveryConnTimeout = time.Second * 30
 
 type discoveryHandler struct {
-	ctx  context.Context
-	host host.Host
+	ctx       context.Context
+	host      host.Host
+	announcer *lanannounce.Announcer
 }
 
 func (dh *discoveryHandler) HandlePeerFound(p peer.AddrInfo) {
@@ -27,35 +33,93 @@ func (dh *discoveryHandler) HandlePeerFound(p peer.AddrInfo) {
 	defer cancel()
 	if err := dh.host.Connect(ctx, p); err != nil {
 		log.Warnf("failed to connect to peer %s found by discovery: %s", p.ID, err)
+		return
+	}
+	if dh.announcer != nil {
+		dh.announcer.AddPeer(p.ID)
 	}
 }
 
-func DiscoveryHandler(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host) *discoveryHandler {
+type discoveryHandlerIn struct {
+	fx.In
+
+	Host      host.Host
+	Announcer *lanannounce.Announcer `optional:"true"`
+}
+
+func DiscoveryHandler(mctx helpers.MetricsCtx, lc fx.Lifecycle, in discoveryHandlerIn) *discoveryHandler {
 	return &discoveryHandler{
-		ctx:  helpers.LifecycleCtx(mctx, lc),
-		host: host,
+		ctx:       helpers.LifecycleCtx(mctx, lc),
+		host:      in.Host,
+		announcer: in.Announcer,
+	}
+}
+
+// LANAnnouncer announces the root CIDs of the data added to the peers found
+// with mDNS, and routes the CIDs they announce to them
+func LANAnnouncer(cfg config.MDNS) interface{} {
+	return func(lc fx.Lifecycle, h host.Host) (*lanannounce.Announcer, p2pRouterOut) {
+		a := lanannounce.New(h, lanannounce.Settings{
+			TTL: cfg.AnnounceTTL.WithDefault(config.DefaultMDNSAnnounceTTL),
+		})
+		lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error {
+				return a.Close()
+			},
+		})
+
+		return a, p2pRouterOut{
+			Router: Router{
+				Routing: &routinghelpers.Compose{
+					ContentRouting: a,
+				},
+				Priority: 50,
+			},
+		}
 	}
 }
 
-func SetupDiscovery(useMdns bool, mdnsInterval int) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler) error {
+func SetupDiscovery(cfg config.MDNS) func(helpers.MetricsCtx, fx.Lifecycle, host.Host, *discoveryHandler) error {
 	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, host host.Host, handler *discoveryHandler) error {
-		if useMdns {
-			service := mdns.NewMdnsService(host, mdns.ServiceName, handler)
-			if err := service.Start(); err != nil {
-				log.Error("error starting mdns service: ", err)
-				return nil
-			}
+		if !cfg.Enabled {
+			return nil
+		}
 
-			if mdnsInterval == 0 {
-				mdnsInterval = 5
-			}
-			legacyService, err := legacymdns.NewMdnsService(mctx, host, time.Duration(mdnsInterval)*time.Second, legacymdns.ServiceTag)
+		var service mdns.Service
+		if len(cfg.Interfaces) > 0 {
+			ifaces, err := mdnsInterfaces(cfg.Interfaces)
 			if err != nil {
-				log.Error("mdns error: ", err)
-				return nil
+				return fmt.Errorf("Discovery.MDNS.Interfaces: %w", err)
 			}
-			legacyService.RegisterNotifee(handler)
+			service = newMdnsService(host, cfg.ServiceName, ifaces, handler)
+		} else {
+			service = mdns.NewMdnsService(host, cfg.ServiceName, handler)
+		}
+		if err := service.Start(); err != nil {
+			log.Error("error starting mdns service: ", err)
+			return nil
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error {
+				return service.Close()
+			},
+		})
+
+		// The legacy discovery can't be restricted to interfaces, and nodes
+		// configured with their own service name are newer than it.
+		if len(cfg.Interfaces) > 0 || cfg.ServiceName != "" {
+			return nil
+		}
+		mdnsInterval := cfg.Interval
+		if mdnsInterval == 0 {
+			mdnsInterval = 5
+		}
+		legacyService, err := legacymdns.NewMdnsService(mctx, host, time.Duration(mdnsInterval)*time.Second, legacymdns.ServiceTag)
+		if err != nil {
+			log.Error("mdns error: ", err)
+			return nil
 		}
+		legacyService.RegisterNotifee(handler)
 		return nil
 	}
 }
@@ -11,6 +11,7 @@ import (
 	record "github.com/libp2p/go-libp2p-record"
 	routedhost "github.com/libp2p/go-libp2p/p2p/host/routed"
 
+	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/repo"
 
@@ -24,6 +25,7 @@ type P2PHostIn struct {
 	Validator     record.Validator
 	HostOption    HostOption
 	RoutingOption RoutingOption
+	Group         *bootstrap.Group
 	ID            peer.ID
 	Peerstore     peerstore.Peerstore
 
@@ -48,7 +50,7 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 	if err != nil {
 		return out, err
 	}
-	bootstrappers, err := cfg.BootstrapPeers()
+	bootstrappers, err := cfg.BootstrapGroupPeers(params.Group.Name())
 	if err != nil {
 		return out, err
 	}
@@ -56,7 +58,7 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 	opts = append(opts, libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
 		r, err := params.RoutingOption(
 			ctx, h,
-			params.Repo.Datastore(),
+			repo.StateDatastore(params.Repo),
 			params.Validator,
 			bootstrappers...,
 		)
@@ -72,7 +74,7 @@ func Host(mctx helpers.MetricsCtx, lc fx.Lifecycle, params P2PHostIn) (out P2PHo
 	// this code is necessary just for tests: mock network constructions
 	// ignore the libp2p constructor options that actually construct the routing!
 	if out.Routing == nil {
-		r, err := params.RoutingOption(ctx, out.Host, params.Repo.Datastore(), params.Validator, bootstrappers...)
+		r, err := params.RoutingOption(ctx, out.Host, repo.StateDatastore(params.Repo), params.Validator, bootstrappers...)
 		if err != nil {
 			return P2PHostOut{}, err
 		}
@@ -0,0 +1,160 @@
+package libp2p
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	namesys "github.com/libp2p/go-libp2p-pubsub-router"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultIpnsPubsubMaxNames is the default number of names followed over
+// pubsub at the same time.
+const DefaultIpnsPubsubMaxNames = 1024
+
+var (
+	ipnsPubsubNames = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_ipns_pubsub_names",
+		Help: "number of names followed over pubsub",
+	})
+	ipnsPubsubEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_ipns_pubsub_evictions_total",
+		Help: "names no longer followed over pubsub because the limit was reached",
+	})
+	// the names are not labels: any name can be looked up, which would grow
+	// the series without bound
+	ipnsPubsubResolves = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_ipns_pubsub_resolves_total",
+		Help: "lookups of the names followed over pubsub",
+	})
+	ipnsPubsubMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_ipns_pubsub_messages_total",
+		Help: "records received on the topics of the names followed over pubsub",
+	}, []string{"result"})
+)
+
+var validationResults = map[pubsub.ValidationResult]string{
+	pubsub.ValidationAccept: "accept",
+	pubsub.ValidationIgnore: "ignore",
+	pubsub.ValidationReject: "reject",
+}
+
+// psNamePool bounds the number of names followed by a PubsubValueStore: every
+// lookup or publication of a name joins its topic, and the topics of the least
+// recently used names are left once there are more than max of them.
+type psNamePool struct {
+	vs  *namesys.PubsubValueStore
+	ps  *pubsub.PubSub
+	max int
+
+	mu    sync.Mutex
+	order *list.List // of keys, most recently used first
+	keys  map[string]*list.Element
+}
+
+func newPSNamePool(vs *namesys.PubsubValueStore, ps *pubsub.PubSub, max int) *psNamePool {
+	return &psNamePool{
+		vs:    vs,
+		ps:    ps,
+		max:   max,
+		order: list.New(),
+		keys:  make(map[string]*list.Element),
+	}
+}
+
+func (p *psNamePool) PutValue(ctx context.Context, key string, value []byte, opts ...routing.Option) error {
+	p.use(key)
+	return p.vs.PutValue(ctx, key, value, opts...)
+}
+
+func (p *psNamePool) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	p.use(key)
+	ipnsPubsubResolves.Inc()
+	return p.vs.GetValue(ctx, key, opts...)
+}
+
+func (p *psNamePool) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	p.use(key)
+	ipnsPubsubResolves.Inc()
+	return p.vs.SearchValue(ctx, key, opts...)
+}
+
+// use marks key as the most recently used and leaves the topics of the least
+// recently used names if there are too many.
+func (p *psNamePool) use(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.keys[key]; ok {
+		p.order.MoveToFront(e)
+	} else {
+		p.keys[key] = p.order.PushFront(key)
+	}
+
+	if p.max > 0 {
+		e := p.order.Back()
+		for p.order.Len() > p.max && e != p.order.Front() {
+			prev := e.Prev()
+			// names being resolved right now can't be canceled, skip them
+			if p.evict(e.Value.(string)) {
+				p.order.Remove(e)
+			}
+			e = prev
+		}
+	}
+	ipnsPubsubNames.Set(float64(p.order.Len()))
+}
+
+// evict leaves the topic of key. It must be called with p.mu held.
+func (p *psNamePool) evict(key string) bool {
+	if _, err := p.vs.Cancel(key); err != nil {
+		log.Debugf("not leaving pubsub topic of %s: %s", keyName(key), err)
+		return false
+	}
+	if p.ps != nil {
+		// the value store never unregisters its validators
+		_ = p.ps.UnregisterTopicValidator(namesys.KeyToTopic(key))
+	}
+	delete(p.keys, key)
+	ipnsPubsubEvictions.Inc()
+	return true
+}
+
+// psMetrics wraps the validators the value store registers to count the
+// records received on the topics.
+type psMetrics struct {
+	*pubsub.PubSub
+}
+
+func (p psMetrics) RegisterTopicValidator(topic string, val interface{}, opts ...pubsub.ValidatorOpt) error {
+	if v, ok := val.(func(context.Context, peer.ID, *pubsub.Message) pubsub.ValidationResult); ok {
+		val = func(ctx context.Context, src peer.ID, msg *pubsub.Message) pubsub.ValidationResult {
+			res := v(ctx, src, msg)
+			if r, ok := validationResults[res]; ok {
+				ipnsPubsubMessages.WithLabelValues(r).Inc()
+			}
+			return res
+		}
+	}
+	return p.PubSub.RegisterTopicValidator(topic, val, opts...)
+}
+
+// keyName returns the IPNS name of a record key, or the key itself if it
+// isn't an IPNS key.
+func keyName(key string) string {
+	if !strings.HasPrefix(key, "/ipns/") {
+		return key
+	}
+	id, err := peer.IDFromBytes([]byte(strings.TrimPrefix(key, "/ipns/")))
+	if err != nil {
+		return key
+	}
+	return id.String()
+}
@@ -0,0 +1,77 @@
+package libp2p
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/ipfs/go-ipns"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pstoremem "github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	namesys "github.com/libp2p/go-libp2p-pubsub-router"
+	record "github.com/libp2p/go-libp2p-record"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestPSNamePool(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New()
+	h, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps, err := pubsub.NewGossipSub(ctx, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pstore, err := pstoremem.NewPeerstore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator := record.NamespacedValidator{"ipns": ipns.Validator{KeyBook: pstore}}
+	vs, err := namesys.NewPubsubValueStore(ctx, h, psMetrics{ps}, validator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := newPSNamePool(vs, ps, 2)
+
+	var keys []string
+	for i := 0; i < 3; i++ {
+		_, pk, err := crypto.GenerateEd25519Key(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPublicKey(pk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, ipns.RecordKey(id))
+	}
+
+	for _, k := range keys[:2] {
+		pool.GetValue(ctx, k)
+	}
+	// use keys[0] again so that keys[1] is the least recently used
+	pool.GetValue(ctx, keys[0])
+	pool.GetValue(ctx, keys[2])
+
+	subs := vs.GetSubscriptions()
+	sort.Strings(subs)
+	expected := []string{keys[0], keys[2]}
+	sort.Strings(expected)
+	if len(subs) != 2 || subs[0] != expected[0] || subs[1] != expected[1] {
+		t.Fatalf("expected to follow %v, got %v", expected, subs)
+	}
+
+	// the validator of the left topic has been removed so it can be joined again
+	if _, err := pool.GetValue(ctx, keys[1]); err == nil {
+		t.Fatal("expected no record")
+	}
+	if len(vs.GetSubscriptions()) != 2 {
+		t.Fatalf("expected to follow 2 names, got %v", vs.GetSubscriptions())
+	}
+}
@@ -25,8 +25,26 @@ type Libp2pOpts struct {
 	Opts []libp2p.Option `group:"libp2p"`
 }
 
-// Misc options
-var UserAgent = simpleOpt(libp2p.UserAgent(version.GetUserAgentVersion()))
+// AgentVersion returns the agent version the node identifies itself with to
+// its peers: Swarm.Identify.AgentVersion, or the one of go-ipfs.
+func AgentVersion(cfg config.Identify) string {
+	return cfg.AgentVersion.WithDefault(version.GetUserAgentVersion())
+}
+
+// UserAgent sets the agent version sent to the peers with identify. It is
+// only read once the node is constructed, for the agent version suffix of the
+// daemon to be set by then.
+func UserAgent(cfg config.Identify) func() (opts Libp2pOpts, err error) {
+	return func() (opts Libp2pOpts, err error) {
+		agent := AgentVersion(cfg)
+		if agent == "" {
+			// libp2p would send the path of the binary instead
+			return opts, fmt.Errorf("Swarm.Identify.AgentVersion cannot be empty")
+		}
+		opts.Opts = append(opts.Opts, libp2p.UserAgent(agent))
+		return
+	}
+}
 
 func ConnectionManager(low, high int, grace time.Duration) func() (opts Libp2pOpts, err error) {
 	return func() (opts Libp2pOpts, err error) {
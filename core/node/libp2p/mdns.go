@@ -0,0 +1,192 @@
+package libp2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+	"github.com/libp2p/zeroconf/v2"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	mdnsDomain    = "local"
+	dnsaddrPrefix = "dnsaddr="
+)
+
+// mdnsInterfaces returns the network interfaces of names, which must support
+// multicast.
+func mdnsInterfaces(names []string) ([]net.Interface, error) {
+	ifaces := make([]net.Interface, 0, len(names))
+	for _, name := range names {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %w", name, err)
+		}
+		if iface.Flags&net.FlagMulticast == 0 {
+			return nil, fmt.Errorf("interface %q does not support multicast", name)
+		}
+		ifaces = append(ifaces, *iface)
+	}
+	return ifaces, nil
+}
+
+// mdnsService is the mDNS discovery of libp2p, announcing and browsing the
+// same records as mdns.NewMdnsService, on the given interfaces only.
+type mdnsService struct {
+	host        host.Host
+	serviceName string
+	peerName    string
+	ifaces      []net.Interface
+	notifee     mdns.Notifee
+
+	// ctx is canceled by Close
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resolverWG sync.WaitGroup
+	server     *zeroconf.Server
+}
+
+func newMdnsService(host host.Host, serviceName string, ifaces []net.Interface, notifee mdns.Notifee) *mdnsService {
+	if serviceName == "" {
+		serviceName = mdns.ServiceName
+	}
+	s := &mdnsService{
+		host:        host,
+		serviceName: serviceName,
+		peerName:    randomPeerName(),
+		ifaces:      ifaces,
+		notifee:     notifee,
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+func (s *mdnsService) Start() error {
+	if err := s.startServer(); err != nil {
+		return err
+	}
+	s.startResolver()
+	return nil
+}
+
+func (s *mdnsService) Close() error {
+	s.cancel()
+	if s.server != nil {
+		s.server.Shutdown()
+	}
+	s.resolverWG.Wait()
+	return nil
+}
+
+func (s *mdnsService) startServer() error {
+	interfaceAddrs, err := s.host.Network().InterfaceListenAddresses()
+	if err != nil {
+		return err
+	}
+	addrs, err := peer.AddrInfoToP2pAddrs(&peer.AddrInfo{
+		ID:    s.host.ID(),
+		Addrs: interfaceAddrs,
+	})
+	if err != nil {
+		return err
+	}
+
+	var txts []string
+	// the A and AAAA records are required, but ignored by libp2p
+	var ip4, ip6 string
+	for _, addr := range addrs {
+		if !manet.IsThinWaist(addr) { // don't announce circuit addresses
+			continue
+		}
+		txts = append(txts, dnsaddrPrefix+addr.String())
+		first, _ := ma.SplitFirst(addr)
+		if ip4 == "" && first.Protocol().Code == ma.P_IP4 {
+			ip4 = first.Value()
+		} else if ip6 == "" && first.Protocol().Code == ma.P_IP6 {
+			ip6 = first.Value()
+		}
+	}
+	var ips []string
+	for _, ip := range []string{ip4, ip6} {
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return errors.New("didn't find any IP addresses")
+	}
+
+	// the port is required, but ignored by libp2p too
+	s.server, err = zeroconf.RegisterProxy(s.peerName, s.serviceName, mdnsDomain, 4001, s.peerName, ips, txts, s.ifaces)
+	return err
+}
+
+func (s *mdnsService) startResolver() {
+	entries := make(chan *zeroconf.ServiceEntry, 1000)
+	s.resolverWG.Add(2)
+	go func() {
+		defer s.resolverWG.Done()
+		for {
+			// entries is not closed if browsing fails to start
+			var entry *zeroconf.ServiceEntry
+			select {
+			case entry = <-entries:
+			case <-s.ctx.Done():
+				return
+			}
+			if entry == nil {
+				return
+			}
+			addrs := make([]ma.Multiaddr, 0, len(entry.Text))
+			for _, txt := range entry.Text {
+				if !strings.HasPrefix(txt, dnsaddrPrefix) {
+					continue
+				}
+				addr, err := ma.NewMultiaddr(txt[len(dnsaddrPrefix):])
+				if err != nil {
+					log.Debugf("failed to parse multiaddr: %s", err)
+					continue
+				}
+				addrs = append(addrs, addr)
+			}
+			infos, err := peer.AddrInfosFromP2pAddrs(addrs...)
+			if err != nil {
+				log.Debugf("failed to get peer info: %s", err)
+				continue
+			}
+			for _, info := range infos {
+				if info.ID != s.host.ID() {
+					go s.notifee.HandlePeerFound(info)
+				}
+			}
+		}
+	}()
+	go func() {
+		defer s.resolverWG.Done()
+		if err := zeroconf.Browse(s.ctx, s.serviceName, mdnsDomain, entries, zeroconf.SelectIfaces(s.ifaces)); err != nil {
+			log.Debugf("zeroconf browsing failed: %s", err)
+		}
+	}()
+}
+
+// randomPeerName returns the random instance name of the node, between 32
+// and 63 characters long like the one of libp2p.
+func randomPeerName() string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, 32+rand.Intn(32))
+	for i := range b {
+		b[i] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+var _ mdns.Service = (*mdnsService)(nil)
@@ -2,12 +2,18 @@ package libp2p
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"time"
 
+	"github.com/ipfs/go-ipfs/cancelwatch"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/bootstrap"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/indexer"
 
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/libp2p/go-libp2p-core/crypto"
 	host "github.com/libp2p/go-libp2p-core/host"
 	routing "github.com/libp2p/go-libp2p-core/routing"
 	dht "github.com/libp2p/go-libp2p-kad-dht"
@@ -44,6 +50,7 @@ type processInitialRoutingIn struct {
 	Host      host.Host
 	Repo      repo.Repo
 	Validator record.Validator
+	Group     *bootstrap.Group
 }
 
 type processInitialRoutingOut struct {
@@ -73,7 +80,7 @@ func BaseRouting(experimentalDHTClient bool) interface{} {
 			if err != nil {
 				return out, err
 			}
-			bspeers, err := cfg.BootstrapPeers()
+			bspeers, err := cfg.BootstrapGroupPeers(in.Group.Name())
 			if err != nil {
 				return out, err
 			}
@@ -82,7 +89,7 @@ func BaseRouting(experimentalDHTClient bool) interface{} {
 				dht.DefaultPrefix,
 				fullrt.DHTOption(
 					dht.Validator(in.Validator),
-					dht.Datastore(in.Repo.Datastore()),
+					dht.Datastore(repo.StateDatastore(in.Repo)),
 					dht.BootstrapPeers(bspeers...),
 					dht.BucketSize(20),
 				),
@@ -139,10 +146,11 @@ func Routing(in p2pOnlineRoutingIn) routing.Routing {
 		irouters[i] = v.Routing
 	}
 
-	return routinghelpers.Tiered{
+	// watch the queries going on once canceled
+	return cancelwatch.NewRouting(routinghelpers.Tiered{
 		Routers:   irouters,
 		Validator: in.Validator,
-	}
+	})
 }
 
 type p2pPSRoutingIn struct {
@@ -154,28 +162,62 @@ type p2pPSRoutingIn struct {
 	PubSub          *pubsub.PubSub `optional:"true"`
 }
 
-func PubsubRouter(mctx helpers.MetricsCtx, lc fx.Lifecycle, in p2pPSRoutingIn) (p2pRouterOut, *namesys.PubsubValueStore, error) {
-	psRouter, err := namesys.NewPubsubValueStore(
-		helpers.LifecycleCtx(mctx, lc),
-		in.Host,
-		in.PubSub,
-		in.Validator,
-		namesys.WithRebroadcastInterval(time.Minute),
-	)
-
-	if err != nil {
-		return p2pRouterOut{}, nil, err
+func PubsubRouter(cfg config.Ipns) func(helpers.MetricsCtx, fx.Lifecycle, p2pPSRoutingIn) (p2pRouterOut, *namesys.PubsubValueStore, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, in p2pPSRoutingIn) (p2pRouterOut, *namesys.PubsubValueStore, error) {
+		psRouter, err := namesys.NewPubsubValueStore(
+			helpers.LifecycleCtx(mctx, lc),
+			in.Host,
+			psMetrics{in.PubSub},
+			in.Validator,
+			namesys.WithRebroadcastInterval(cfg.PubsubRebroadcastInterval.WithDefault(time.Minute)),
+			namesys.WithRebroadcastInitialDelay(cfg.PubsubRebroadcastInitialDelay.WithDefault(100*time.Millisecond)),
+		)
+
+		if err != nil {
+			return p2pRouterOut{}, nil, err
+		}
+
+		pool := newPSNamePool(psRouter, in.PubSub, int(cfg.PubsubMaxNames.WithDefault(DefaultIpnsPubsubMaxNames)))
+
+		return p2pRouterOut{
+			Router: Router{
+				Routing: &routinghelpers.Compose{
+					ValueStore: &routinghelpers.LimitedValueStore{
+						ValueStore: pool,
+						Namespaces: []string{"ipns"},
+					},
+				},
+				Priority: 100,
+			},
+		}, psRouter, nil
 	}
+}
+
+// IndexerRouter announces the provider records to the HTTP indexers of cfg,
+// in addition to the other routers
+func IndexerRouter(cfg config.RoutingIndexers) interface{} {
+	return func(lc fx.Lifecycle, h host.Host, sk crypto.PrivKey) (p2pRouterOut, error) {
+		pub, err := indexer.New(h, sk, cfg.Endpoints, indexer.Settings{
+			BatchSize:     int(cfg.BatchSize.WithDefault(config.DefaultIndexerBatchSize)),
+			BatchInterval: cfg.BatchInterval.WithDefault(config.DefaultIndexerBatchInterval),
+			AdvisoryTTL:   cfg.AdvisoryTTL.WithDefault(config.DefaultIndexerAdvisoryTTL),
+		})
+		if err != nil {
+			return p2pRouterOut{}, fmt.Errorf("invalid Routing.Indexers config: %w", err)
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(ctx context.Context) error {
+				return pub.Close()
+			},
+		})
 
-	return p2pRouterOut{
-		Router: Router{
-			Routing: &routinghelpers.Compose{
-				ValueStore: &routinghelpers.LimitedValueStore{
-					ValueStore: psRouter,
-					Namespaces: []string{"ipns"},
+		return p2pRouterOut{
+			Router: Router{
+				Routing: &routinghelpers.Compose{
+					ContentRouting: pub,
 				},
+				Priority: 2000,
 			},
-			Priority: 100,
-		},
-	}, psRouter, nil
+		}, nil
+	}
 }
@@ -2,6 +2,10 @@ package libp2p
 
 import (
 	"context"
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs/config"
+
 	"github.com/ipfs/go-datastore"
 	host "github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -46,6 +50,81 @@ func constructDHTRouting(mode dht.ModeOpt) func(
 	}
 }
 
+// DualDHTOption returns the routing of the public (WAN) DHT in wanMode, and
+// of the LAN DHT in lanMode. Unlike dual.New, which DHTOption and the like
+// use, it does not force the LAN DHT in server mode.
+func DualDHTOption(wanMode, lanMode dht.ModeOpt) RoutingOption {
+	return func(
+		ctx context.Context,
+		host host.Host,
+		dstore datastore.Batching,
+		validator record.Validator,
+		bootstrapPeers ...peer.AddrInfo,
+	) (routing.Routing, error) {
+		common := []dht.Option{
+			dht.Concurrency(10),
+			dht.Datastore(dstore),
+			dht.Validator(validator),
+		}
+		// the same filters as dual.New
+		wan, err := dht.New(ctx, host, append(common,
+			dht.Mode(wanMode),
+			dht.BootstrapPeers(bootstrapPeers...),
+			dht.QueryFilter(dht.PublicQueryFilter),
+			dht.RoutingTableFilter(dht.PublicRoutingTableFilter),
+			dht.RoutingTablePeerDiversityFilter(dht.NewRTPeerDiversityFilter(host, 2, 3)),
+		)...)
+		if err != nil {
+			return nil, err
+		}
+		lan, err := dht.New(ctx, host, append(common,
+			dht.Mode(lanMode),
+			dht.ProtocolExtension(dual.LanExtension),
+			dht.QueryFilter(dht.PrivateQueryFilter),
+			dht.RoutingTableFilter(dht.PrivateRoutingTableFilter),
+		)...)
+		if err != nil {
+			_ = wan.Close()
+			return nil, err
+		}
+		return &dual.DHT{WAN: wan, LAN: lan}, nil
+	}
+}
+
+// DHTModes returns the modes of the WAN and LAN DHTs of cfg, for a routing
+// of the DHTs in mode.
+func DHTModes(cfg config.Routing, mode dht.ModeOpt) (wanMode, lanMode dht.ModeOpt, err error) {
+	wanMode, err = parseDHTMode(cfg.WANMode.WithDefault(""), mode)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Routing.WANMode: %w", err)
+	}
+	// like dual.New, the LAN DHT serves unless the WAN one is a client
+	lanDefault := dht.ModeServer
+	if wanMode == dht.ModeClient {
+		lanDefault = dht.ModeClient
+	}
+	lanMode, err = parseDHTMode(cfg.LANMode.WithDefault(""), lanDefault)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Routing.LANMode: %w", err)
+	}
+	return wanMode, lanMode, nil
+}
+
+func parseDHTMode(s string, def dht.ModeOpt) (dht.ModeOpt, error) {
+	switch s {
+	case "":
+		return def, nil
+	case "auto":
+		return dht.ModeAuto, nil
+	case "client":
+		return dht.ModeClient, nil
+	case "server":
+		return dht.ModeServer, nil
+	default:
+		return 0, fmt.Errorf("unrecognized DHT mode: %q", s)
+	}
+}
+
 func constructNilRouting(
 	ctx context.Context,
 	host host.Host,
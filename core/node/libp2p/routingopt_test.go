@@ -0,0 +1,48 @@
+package libp2p
+
+import (
+	"encoding/json"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/config"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+)
+
+func optionalString(s string) *config.OptionalString {
+	var o config.OptionalString
+	if err := json.Unmarshal([]byte(`"`+s+`"`), &o); err != nil {
+		panic(err)
+	}
+	return &o
+}
+
+func TestDHTModes(t *testing.T) {
+	for _, tc := range []struct {
+		wan, lan       *config.OptionalString
+		mode           dht.ModeOpt
+		expWAN, expLAN dht.ModeOpt
+		err            bool
+	}{
+		{mode: dht.ModeAuto, expWAN: dht.ModeAuto, expLAN: dht.ModeServer},
+		{mode: dht.ModeClient, expWAN: dht.ModeClient, expLAN: dht.ModeClient},
+		{wan: optionalString("server"), mode: dht.ModeClient, expWAN: dht.ModeServer, expLAN: dht.ModeServer},
+		{lan: optionalString("client"), mode: dht.ModeAuto, expWAN: dht.ModeAuto, expLAN: dht.ModeClient},
+		{wan: optionalString("client"), lan: optionalString("auto"), mode: dht.ModeServer, expWAN: dht.ModeClient, expLAN: dht.ModeAuto},
+		{wan: optionalString("sever"), mode: dht.ModeAuto, err: true},
+		{lan: optionalString("off"), mode: dht.ModeAuto, err: true},
+	} {
+		wan, lan, err := DHTModes(config.Routing{WANMode: tc.wan, LANMode: tc.lan}, tc.mode)
+		if tc.err {
+			if err == nil {
+				t.Errorf("expected an error for %v, %v", tc.wan, tc.lan)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wan != tc.expWAN || lan != tc.expLAN {
+			t.Errorf("expected %v/%v, got %v/%v", tc.expWAN, tc.expLAN, wan, lan)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package libp2p
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/speedtest"
+	"github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+)
+
+// SpeedTestServer serves the speed test to the peers running
+// 'ipfs diag speedtest' with the node
+func SpeedTestServer(cfg config.SpeedTest) func(fx.Lifecycle, host.Host) error {
+	return func(lc fx.Lifecycle, h host.Host) error {
+		maxDuration := cfg.MaxDuration.WithDefault(config.DefaultSpeedTestMaxDuration)
+		if maxDuration <= 0 {
+			return fmt.Errorf("config setting Swarm.SpeedTest.MaxDuration must be positive: %s", maxDuration)
+		}
+		maxStreams := cfg.MaxStreams.WithDefault(config.DefaultSpeedTestMaxStreams)
+		if maxStreams <= 0 {
+			return fmt.Errorf("config setting Swarm.SpeedTest.MaxStreams must be positive: %d", maxStreams)
+		}
+
+		srv := speedtest.NewServer(h, speedtest.Settings{
+			MaxDuration: maxDuration,
+			MaxStreams:  int(maxStreams),
+		})
+		lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error {
+				return srv.Close()
+			},
+		})
+		return nil
+	}
+}
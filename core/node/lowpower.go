@@ -0,0 +1,55 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/lowpower"
+	"github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+)
+
+// optionalLowPower is the controller of the low-power mode, which only exists
+// when online
+type optionalLowPower struct {
+	fx.In
+	LowPower *lowpower.Controller `optional:"true"`
+}
+
+// LowPower creates the controller of the low-power mode, and enables it on
+// start if configured to
+func LowPower(cfg config.LowPower) func(helpers.MetricsCtx, fx.Lifecycle, host.Host) (*lowpower.Controller, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host) (*lowpower.Controller, error) {
+		settings := lowpower.Settings{
+			Awake:              cfg.Awake.WithDefault(config.DefaultLowPowerAwake),
+			Sleep:              cfg.Sleep.WithDefault(config.DefaultLowPowerSleep),
+			IntervalMultiplier: int(cfg.IntervalMultiplier.WithDefault(config.DefaultLowPowerIntervalMultiplier)),
+		}
+		if err := settings.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid LowPower config: %s", err)
+		}
+
+		ctrl := lowpower.New(settings)
+
+		// shed the connections that are not needed while asleep
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		ctrl.OnSleep(func() {
+			h.ConnManager().TrimOpenConns(ctx)
+		})
+
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				if cfg.Enabled.WithDefault(false) {
+					return ctrl.Enable(settings)
+				}
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return ctrl.Close()
+			},
+		})
+		return ctrl, nil
+	}
+}
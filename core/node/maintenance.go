@@ -0,0 +1,44 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/maintenance"
+)
+
+// Maintenance creates the scheduler holding the background work to the
+// maintenance windows
+func Maintenance(cfg config.Maintenance) func() (*maintenance.Scheduler, error) {
+	return func() (*maintenance.Scheduler, error) {
+		loc := time.Local
+		if tz := cfg.TimeZone.WithDefault(""); tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return nil, fmt.Errorf("invalid config setting Maintenance.TimeZone: %s", err)
+			}
+		}
+
+		windows := make([]maintenance.Window, 0, len(cfg.Windows))
+		for _, w := range cfg.Windows {
+			windows = append(windows, maintenance.Window{
+				Schedule: w.Schedule,
+				Duration: w.Duration.WithDefault(config.DefaultMaintenanceWindowDuration),
+			})
+		}
+		tasks := maintenance.Tasks
+		if len(cfg.Tasks) > 0 {
+			tasks = make([]maintenance.Task, 0, len(cfg.Tasks))
+			for _, t := range cfg.Tasks {
+				tasks = append(tasks, maintenance.Task(t))
+			}
+		}
+
+		s, err := maintenance.New(windows, tasks, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config setting Maintenance: %s", err)
+		}
+		return s, nil
+	}
+}
@@ -0,0 +1,36 @@
+package node
+
+import (
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/membudget"
+	"go.uber.org/fx"
+)
+
+// optionalMemoryBudget is the memory budget of the node, which only exists
+// when MemoryBudget.Limit is set
+type optionalMemoryBudget struct {
+	fx.In
+	MemoryBudget *membudget.Budget `optional:"true"`
+}
+
+// MemoryBudget creates the memory budget of the node, sampling the memory
+// usage for as long as the node runs
+func MemoryBudget(cfg config.MemoryBudget) func(helpers.MetricsCtx, fx.Lifecycle) (*membudget.Budget, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle) (*membudget.Budget, error) {
+		limit, err := humanize.ParseBytes(cfg.Limit.WithDefault(""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid MemoryBudget.Limit: %s", err)
+		}
+		if limit == 0 {
+			return nil, fmt.Errorf("MemoryBudget.Limit must be positive")
+		}
+
+		b := membudget.New(limit, cfg.MaxWait.WithDefault(config.DefaultMemoryBudgetMaxWait))
+		go b.Run(helpers.LifecycleCtx(mctx, lc), cfg.Interval.WithDefault(config.DefaultMemoryBudgetInterval))
+		return b, nil
+	}
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/mfsrepl"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// optionalMFSPublisher is the publisher of the MFS root, which only exists
+// when online with Files.Replication.Publish enabled
+type optionalMFSPublisher struct {
+	fx.In
+	Publisher *mfsrepl.Publisher `optional:"true"`
+}
+
+// MFSPublisher creates the publisher of the MFS root of the node to its
+// standbys
+func MFSPublisher(cfg config.FilesReplication) func(helpers.MetricsCtx, fx.Lifecycle, peer.ID, repo.Repo, *pubsub.PubSub) (*mfsrepl.Publisher, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, id peer.ID, repo repo.Repo, ps *pubsub.PubSub) (*mfsrepl.Publisher, error) {
+		// the MFS root as of the last run, an MFS without changes having none
+		root := cid.Undef
+		val, err := repo.Datastore().Get(mctx, FilesRootDatastoreKey)
+		switch err {
+		case nil:
+			if root, err = cid.Cast(val); err != nil {
+				return nil, err
+			}
+		case datastore.ErrNotFound:
+		default:
+			return nil, err
+		}
+
+		p, err := mfsrepl.NewPublisher(ps, id, root, cfg.Interval.WithDefault(config.DefaultFilesReplicationInterval))
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go p.Run()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return p.Close()
+			},
+		})
+		return p, nil
+	}
+}
+
+// MFSFollower creates the follower of the MFS root of the writer the node is
+// a standby of
+func MFSFollower(cfg config.FilesReplication, pscfg config.PubsubConfig) func(fx.Lifecycle, repo.Repo, *pubsub.PubSub, pin.Pinner, format.DAGService, blockstore.GCLocker) (*mfsrepl.Follower, error) {
+	return func(lc fx.Lifecycle, repo repo.Repo, ps *pubsub.PubSub, pinner pin.Pinner, dag format.DAGService, locker blockstore.GCLocker) (*mfsrepl.Follower, error) {
+		writer, err := peer.Decode(cfg.Follow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Files.Replication.Follow: %s", err)
+		}
+		if pscfg.DisableSigning {
+			return nil, errors.New("Files.Replication.Follow requires signed pubsub messages, unset Pubsub.DisableSigning")
+		}
+
+		f, err := mfsrepl.NewFollower(ps, writer, repo.Datastore(), pinner, dag, locker)
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go f.Run()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return f.Close()
+			},
+		})
+		return f, nil
+	}
+}
@@ -0,0 +1,39 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/jbenet/goprocess"
+	goprocessctx "github.com/jbenet/goprocess/context"
+)
+
+// DefaultPinExpiryInterval is how often the expired pins are removed when
+// Pinning.Expiry.Interval is not set.
+const DefaultPinExpiryInterval = time.Hour
+
+// PinExpiryPolicy periodically removes the pins which exceed the limits of
+// their expiry class.
+func PinExpiryPolicy(cfg config.PinExpiry) func(lcProcess, *expiry.Store, pin.Pinner, blockstore.GCLocker) error {
+	return func(lc lcProcess, store *expiry.Store, pinner pin.Pinner, locker blockstore.GCLocker) error {
+		classes, err := expiry.Classes(cfg)
+		if err != nil {
+			return fmt.Errorf("failure to parse config setting Pinning.Expiry.Classes: %s", err)
+		}
+
+		interval := cfg.Interval.WithDefault(DefaultPinExpiryInterval)
+		if interval <= 0 {
+			return fmt.Errorf("config setting Pinning.Expiry.Interval must be positive: %s", interval)
+		}
+
+		policy := expiry.NewPolicy(store, pinner, locker, classes)
+		lc.Append(func(proc goprocess.Process) {
+			policy.Run(goprocessctx.OnClosingContext(proc), interval)
+		})
+		return nil
+	}
+}
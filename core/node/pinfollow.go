@@ -0,0 +1,63 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-fetcher"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-namesys"
+	"github.com/ipfs/go-path/resolver"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/pinning/follow"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// PinFollower creates the follower mirroring the pinset of Pinning.Follow.Source
+func PinFollower(cfg config.PinFollow) interface{} {
+	type input struct {
+		fx.In
+		LC            fx.Lifecycle
+		Repo          repo.Repo
+		Namesys       namesys.NameSystem
+		Pinner        pin.Pinner
+		DAG           format.DAGService
+		Locker        blockstore.GCLocker
+		UnixfsFetcher fetcher.Factory `name:"unixfsFetcher"`
+	}
+	return func(in input) (*follow.Follower, error) {
+		interval := cfg.Interval.WithDefault(config.DefaultPinFollowInterval)
+		if interval <= 0 {
+			return nil, fmt.Errorf("config setting Pinning.Follow.Interval must be positive: %s", interval)
+		}
+
+		var src follow.Source
+		var err error
+		if strings.HasPrefix(cfg.Source, "/") {
+			src, err = follow.NewNameSource(cfg.Source, in.Namesys, resolver.NewBasicResolver(in.UnixfsFetcher), in.DAG)
+		} else {
+			src, err = follow.NewAPISource(cfg.Source, cfg.AuthSecret, http.DefaultClient)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid Pinning.Follow.Source: %s", err)
+		}
+
+		f := follow.New(src, in.Repo.Datastore(), in.Pinner, in.DAG, in.Locker)
+		in.LC.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go f.Run(interval)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return f.Close()
+			},
+		})
+		return f, nil
+	}
+}
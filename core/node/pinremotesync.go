@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pin "github.com/ipfs/go-ipfs-pinner"
+	pinclient "github.com/ipfs/go-pinning-service-http-client"
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pinning/remotesync"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// remotePinSyncPollInterval is how often the services are checked for a
+// sync, and the config reread
+const remotePinSyncPollInterval = time.Minute / 2
+
+// remotePinSyncEnabled reports whether a remote pinning service has
+// Policies.Sync enabled.
+func remotePinSyncEnabled(cfg config.Pinning) bool {
+	for _, svc := range cfg.RemoteServices {
+		if svc.Policies.Sync.Enable {
+			return true
+		}
+	}
+	return false
+}
+
+// RemotePinSyncer creates the syncer mirroring the pins to the remote pinning
+// services with Policies.Sync enabled
+func RemotePinSyncer(lc fx.Lifecycle, r repo.Repo, h host.Host, pinner pin.Pinner, meta *pinmeta.Store) *remotesync.Syncer {
+	services := func() ([]remotesync.Service, error) {
+		// reread, the services being changed while the daemon runs
+		cfg, err := r.Config()
+		if err != nil {
+			return nil, err
+		}
+		return remotePinSyncServices(cfg, h)
+	}
+	s := remotesync.New(services, pinner, meta)
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go s.Run(remotePinSyncPollInterval)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			return s.Close()
+		},
+	})
+	return s
+}
+
+// remotePinSyncServices returns the services of cfg with Policies.Sync
+// enabled.
+func remotePinSyncServices(cfg *config.Config, h host.Host) ([]remotesync.Service, error) {
+	// the service may fetch the pins from the node
+	origins, err := peer.AddrInfoToP2pAddrs(host.InfoFromHost(h))
+	if err != nil {
+		return nil, err
+	}
+
+	var services []remotesync.Service
+	for name, svc := range cfg.Pinning.RemoteServices {
+		policy := svc.Policies.Sync
+		if !policy.Enable {
+			continue
+		}
+		interval := policy.Interval.WithDefault(config.DefaultRemotePinSyncInterval)
+		if interval <= 0 {
+			return nil, fmt.Errorf("config setting Pinning.RemoteServices.%s.Policies.Sync.Interval must be positive: %s", name, interval)
+		}
+		maxBackoff := policy.MaxBackoff.WithDefault(config.DefaultRemotePinSyncMaxBackoff)
+		if maxBackoff <= 0 {
+			return nil, fmt.Errorf("config setting Pinning.RemoteServices.%s.Policies.Sync.MaxBackoff must be positive: %s", name, maxBackoff)
+		}
+		var filter pinmeta.Filter
+		if policy.Label != "" {
+			labels, err := pinmeta.ParseLabels([]string{policy.Label})
+			if err != nil {
+				return nil, fmt.Errorf("invalid Pinning.RemoteServices.%s.Policies.Sync.Label: %s", name, err)
+			}
+			filter.Labels = labels
+		}
+		pinName := policy.PinName
+		if pinName == "" {
+			pinName = fmt.Sprintf("policy/%s/sync", h.ID())
+		}
+
+		services = append(services, remotesync.Service{
+			Name:       name,
+			Client:     pinclient.NewClient(svc.API.Endpoint, svc.API.Key),
+			PinName:    pinName,
+			Filter:     filter,
+			Origins:    origins,
+			Interval:   interval,
+			MaxBackoff: maxBackoff,
+		})
+	}
+	return services, nil
+}
@@ -0,0 +1,106 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs/blocks/placement"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/jbenet/goprocess"
+	goprocessctx "github.com/jbenet/goprocess/context"
+	mc "github.com/multiformats/go-multicodec"
+)
+
+// DefaultPlacementInterval is how often the blocks of the labeled pins are
+// moved to their mount when Datastore.Placement.Interval is not set.
+const DefaultPlacementInterval = time.Hour
+
+// placementBlockstore returns the blockstore placing the blocks in main or in
+// the mounts of the repo, by the rules of cfg.
+func placementBlockstore(cfg config.Placement, r repo.Repo, main blockstore.Blockstore) (*placement.Blockstore, error) {
+	mounts := make(map[string]placement.Mount)
+	if pm, ok := r.(repo.PlacementMounter); ok {
+		for name, d := range pm.PlacementDatastores() {
+			mounts[name] = placement.NewMount(d)
+		}
+	}
+	rules, err := placementRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := placement.New(main, mounts, rules, r.Datastore())
+	if err != nil {
+		return nil, fmt.Errorf("config setting Datastore.Placement.Rules: %w", err)
+	}
+	return bs, nil
+}
+
+func placementRules(cfg config.Placement) ([]placement.Rule, error) {
+	rules := make([]placement.Rule, 0, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		rule := placement.Rule{Mount: r.Mount, PinLabels: r.PinLabels}
+		for _, s := range []struct {
+			opt  *config.OptionalString
+			name string
+			size *int
+		}{
+			{r.MinSize, "MinSize", &rule.MinSize},
+			{r.MaxSize, "MaxSize", &rule.MaxSize},
+		} {
+			if s.opt == nil {
+				continue
+			}
+			size, err := humanize.ParseBytes(s.opt.WithDefault(""))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Datastore.Placement.Rules[%d].%s: %s", i, s.name, err)
+			}
+			*s.size = int(size)
+		}
+		for _, name := range r.Codecs {
+			var codec mc.Code
+			if err := codec.Set(name); err != nil {
+				return nil, fmt.Errorf("invalid Datastore.Placement.Rules[%d].Codecs: %s", i, err)
+			}
+			rule.Codecs = append(rule.Codecs, uint64(codec))
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// hasPinLabelRules tells whether a rule of cfg places the blocks by the labels
+// of their pins.
+func hasPinLabelRules(cfg config.Placement) bool {
+	for _, r := range cfg.Rules {
+		if len(r.PinLabels) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PlacementPolicy periodically moves the blocks of the pins selected by their
+// labels in the placement config to their mount.
+func PlacementPolicy(cfg config.Placement) func(lcProcess, *placement.Blockstore, pin.Pinner, *pinmeta.Store) error {
+	return func(lc lcProcess, bs *placement.Blockstore, pinner pin.Pinner, meta *pinmeta.Store) error {
+		if bs == nil {
+			return fmt.Errorf("placement policy configured without placement mounts")
+		}
+
+		interval := cfg.Interval.WithDefault(DefaultPlacementInterval)
+		if interval <= 0 {
+			return fmt.Errorf("config setting Datastore.Placement.Interval must be positive: %s", interval)
+		}
+
+		policy := placement.NewPolicy(bs, pinner, meta)
+		lc.Append(func(proc goprocess.Process) {
+			policy.Run(goprocessctx.OnClosingContext(proc), interval)
+		})
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/profhistory"
+	"go.uber.org/fx"
+)
+
+// ProfilingDir returns the directory of the snapshots of the profiles.
+func ProfilingDir(cfg config.Profiling) (string, error) {
+	dir := cfg.Path.WithDefault(config.DefaultProfilingPath)
+	if dir == "" {
+		return "", fmt.Errorf("config setting Profiling.Path cannot be empty")
+	}
+	if filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	root, err := config.PathRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, dir), nil
+}
+
+// ProfileHistory creates the recorder of the snapshots of the profiles
+func ProfileHistory(cfg config.Profiling) func(fx.Lifecycle) (*profhistory.Recorder, error) {
+	return func(lc fx.Lifecycle) (*profhistory.Recorder, error) {
+		dir, err := ProfilingDir(cfg)
+		if err != nil {
+			return nil, err
+		}
+		settings := profhistory.Settings{
+			Dir:          dir,
+			Interval:     cfg.Interval.WithDefault(config.DefaultProfilingInterval),
+			CPUDuration:  cfg.CPUDuration.WithDefault(config.DefaultProfilingCPUDuration),
+			MaxSnapshots: int(cfg.MaxSnapshots.WithDefault(config.DefaultProfilingMaxSnapshots)),
+		}
+		if settings.Interval <= 0 {
+			return nil, fmt.Errorf("config setting Profiling.Interval must be positive: %s", settings.Interval)
+		}
+		if settings.CPUDuration < 0 || settings.CPUDuration >= settings.Interval {
+			return nil, fmt.Errorf("config setting Profiling.CPUDuration must be shorter than the interval: %s", settings.CPUDuration)
+		}
+		if settings.MaxSnapshots <= 0 {
+			return nil, fmt.Errorf("config setting Profiling.MaxSnapshots must be positive")
+		}
+
+		r, err := profhistory.New(settings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Profiling.Path: %s", err)
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return r.Close()
+			},
+		})
+		return r, nil
+	}
+}
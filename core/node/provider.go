@@ -3,41 +3,106 @@ package node
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/ipfs/go-fetcher"
-	"github.com/ipfs/go-ipfs-pinner"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/ipfs/go-ipfs-provider"
 	"github.com/ipfs/go-ipfs-provider/batched"
 	q "github.com/ipfs/go-ipfs-provider/queue"
 	"github.com/ipfs/go-ipfs-provider/simple"
+	util "github.com/ipfs/go-ipfs-util"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
 	"github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-ipfs/core/node/helpers"
 	"github.com/ipfs/go-ipfs/core/node/libp2p"
+	"github.com/ipfs/go-ipfs/lowpower"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/reprovide"
 )
 
 const kReprovideFrequency = time.Hour * 12
 
+const (
+	// the bounds of Reprovider.RecordValidity
+	minProviderRecordValidity = time.Hour
+	maxProviderRecordValidity = 7 * 24 * time.Hour
+)
+
+var (
+	reprovideRoundTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_reprovider_round_timestamp_seconds",
+		Help: "time the last round of reprovides started",
+	})
+	reprovideExpiryTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_reprovider_records_expiry_timestamp_seconds",
+		Help: "time the provider records of the last round of reprovides start expiring",
+	})
+	reprovideExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_reprovider_records_expired_total",
+		Help: "rounds of reprovides started after the provider records of the previous round had started expiring",
+	})
+)
+
+// providerQueueName is the name of the provider queue in the datastore
+const providerQueueName = "provider-v1"
+
+// ProviderQueuePrefix is the datastore prefix of the entries of the provider queue
+var ProviderQueuePrefix = ds.NewKey("/" + providerQueueName + "/queue")
+
 // SIMPLE
 
 // ProviderQueue creates new datastore backed provider queue
-func ProviderQueue(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*q.Queue, error) {
-	return q.NewQueue(helpers.LifecycleCtx(mctx, lc), "provider-v1", repo.Datastore())
+func ProviderQueue(mctx helpers.MetricsCtx, lc fx.Lifecycle, r repo.Repo) (*q.Queue, error) {
+	return q.NewQueue(helpers.LifecycleCtx(mctx, lc), providerQueueName, repo.StateDatastore(r))
 }
 
 // SimpleProvider creates new record provider
-func SimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing) provider.Provider {
-	return simple.NewProvider(helpers.LifecycleCtx(mctx, lc), queue, rt)
+func SimpleProvider(mctx helpers.MetricsCtx, lc fx.Lifecycle, queue *q.Queue, rt routing.Routing, lp optionalLowPower, pq optionalPublishQueue) provider.Provider {
+	p := simple.NewProvider(helpers.LifecycleCtx(mctx, lc), queue, pq.routing(rt))
+	if lp.LowPower != nil {
+		return lowpower.NewProvider(p, lp.LowPower)
+	}
+	return p
 }
 
 // SimpleReprovider creates new reprovider
 func SimpleReprovider(reproviderInterval time.Duration) interface{} {
-	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc) (provider.Reprovider, error) {
-		return simple.NewReprovider(helpers.LifecycleCtx(mctx, lc), reproviderInterval, rt, keyProvider), nil
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, rt routing.Routing, keyProvider simple.KeyChanFunc, lp optionalLowPower) (provider.Reprovider, error) {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		if lp.LowPower != nil && reproviderInterval > 0 {
+			// the low-power mode schedules the reprovides itself
+			r := simple.NewReprovider(ctx, 0, rt, keyProvider)
+			return lowpower.NewReprovider(ctx, r, lp.LowPower, reproviderInterval), nil
+		}
+		return simple.NewReprovider(ctx, reproviderInterval, rt, keyProvider), nil
+	}
+}
+
+// SpreadReprovider creates the reprovider spreading the reprovides over the
+// interval
+func SpreadReprovider(reproviderInterval time.Duration) interface{} {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, id peer.ID, rt routing.Routing, keyProvider simple.KeyChanFunc, lp optionalLowPower) *reprovide.Reprovider {
+		ctx := helpers.LifecycleCtx(mctx, lc)
+		// the triggered reprovides are run by the simple reprovider
+		r := simple.NewReprovider(ctx, 0, rt, keyProvider)
+		var pacer reprovide.Pacer
+		if lp.LowPower != nil {
+			pacer = lp.LowPower
+		}
+		// the offsets of the keys differ from node to node
+		return reprovide.New(ctx, r, rt, keyProvider, reproviderInterval, []byte(id), pacer)
 	}
 }
 
@@ -69,7 +134,7 @@ type provideMany interface {
 
 // BatchedProviderSys creates new provider system
 func BatchedProviderSys(isOnline bool, reprovideInterval string) interface{} {
-	return func(lc fx.Lifecycle, cr libp2p.BaseIpfsRouting, q *q.Queue, keyProvider simple.KeyChanFunc, repo repo.Repo) (provider.System, error) {
+	return func(lc fx.Lifecycle, cr libp2p.BaseIpfsRouting, q *q.Queue, keyProvider simple.KeyChanFunc, rp repo.Repo) (provider.System, error) {
 		r, ok := (cr).(provideMany)
 		if !ok {
 			return nil, fmt.Errorf("BatchedProviderSys requires a content router that supports provideMany")
@@ -87,7 +152,7 @@ func BatchedProviderSys(isOnline bool, reprovideInterval string) interface{} {
 
 		sys, err := batched.New(r, q,
 			batched.ReproviderInterval(reprovideIntervalDuration),
-			batched.Datastore(repo.Datastore()),
+			batched.Datastore(repo.StateDatastore(rp)),
 			batched.KeyProvider(keyProvider))
 		if err != nil {
 			return nil, err
@@ -112,33 +177,34 @@ func BatchedProviderSys(isOnline bool, reprovideInterval string) interface{} {
 // ONLINE/OFFLINE
 
 // OnlineProviders groups units managing provider routing records online
-func OnlineProviders(useStrategicProviding bool, useBatchedProviding bool, reprovideStrategy string, reprovideInterval string) fx.Option {
+func OnlineProviders(useStrategicProviding bool, useBatchedProviding bool, reprovideStrategy string, reprovideInterval string, recordValidity time.Duration, spreadReprovides bool) fx.Option {
 	if useStrategicProviding {
 		return fx.Provide(provider.NewOfflineProvider)
 	}
 
 	return fx.Options(
-		SimpleProviders(reprovideStrategy, reprovideInterval),
+		SimpleProviders(reprovideStrategy, reprovideInterval, recordValidity, spreadReprovides && !useBatchedProviding),
+		fx.Invoke(ProviderRecordValidity(recordValidity)),
 		maybeProvide(SimpleProviderSys(true), !useBatchedProviding),
 		maybeProvide(BatchedProviderSys(true, reprovideInterval), useBatchedProviding),
 	)
 }
 
 // OfflineProviders groups units managing provider routing records offline
-func OfflineProviders(useStrategicProviding bool, useBatchedProviding bool, reprovideStrategy string, reprovideInterval string) fx.Option {
+func OfflineProviders(useStrategicProviding bool, useBatchedProviding bool, reprovideStrategy string, reprovideInterval string, recordValidity time.Duration) fx.Option {
 	if useStrategicProviding {
 		return fx.Provide(provider.NewOfflineProvider)
 	}
 
 	return fx.Options(
-		SimpleProviders(reprovideStrategy, reprovideInterval),
+		SimpleProviders(reprovideStrategy, reprovideInterval, recordValidity, false),
 		maybeProvide(SimpleProviderSys(false), true),
 		//maybeProvide(BatchedProviderSys(false, reprovideInterval), useBatchedProviding),
 	)
 }
 
 // SimpleProviders creates the simple provider/reprovider dependencies
-func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Option {
+func SimpleProviders(reprovideStrategy string, reprovideInterval string, recordValidity time.Duration, spreadReprovides bool) fx.Option {
 	reproviderInterval := kReprovideFrequency
 	if reprovideInterval != "" {
 		dur, err := time.ParseDuration(reprovideInterval)
@@ -149,35 +215,133 @@ func SimpleProviders(reprovideStrategy string, reprovideInterval string) fx.Opti
 		reproviderInterval = dur
 	}
 
-	var keyProvider fx.Option
-	switch reprovideStrategy {
-	case "all":
-		fallthrough
-	case "":
-		keyProvider = fx.Provide(simple.NewBlockstoreProvider)
-	case "roots":
-		keyProvider = fx.Provide(pinnedProviderStrategy(true))
-	case "pinned":
-		keyProvider = fx.Provide(pinnedProviderStrategy(false))
-	default:
-		return fx.Error(fmt.Errorf("unknown reprovider strategy '%s'", reprovideStrategy))
+	if !util.Debug {
+		if recordValidity < minProviderRecordValidity || recordValidity > maxProviderRecordValidity {
+			return fx.Error(fmt.Errorf("config setting Reprovider.RecordValidity is not between 1h and 7 days: %s", recordValidity))
+		}
+		if reproviderInterval > recordValidity {
+			return fx.Error(fmt.Errorf("config setting Reprovider.Interval %s is longer than Reprovider.RecordValidity %s, the provider records would expire before being reprovided", reproviderInterval, recordValidity))
+		}
+	}
+
+	strategies, err := parseReprovideStrategy(reprovideStrategy)
+	if err != nil {
+		return fx.Error(err)
+	}
+	keyProvider := fx.Provide(reprovideKeyProvider(strategies, recordValidity))
+
+	reprovider := fx.Provide(SimpleReprovider(reproviderInterval))
+	if spreadReprovides && reproviderInterval > 0 {
+		reprovider = fx.Options(
+			fx.Provide(SpreadReprovider(reproviderInterval)),
+			fx.Provide(func(r *reprovide.Reprovider) provider.Reprovider { return r }),
+		)
 	}
 
 	return fx.Options(
 		fx.Provide(ProviderQueue),
 		fx.Provide(SimpleProvider),
 		keyProvider,
-		fx.Provide(SimpleReprovider(reproviderInterval)),
+		reprovider,
 	)
 }
 
-func pinnedProviderStrategy(onlyRoots bool) interface{} {
-	type input struct {
-		fx.In
-		Pinner      pin.Pinner
-		IPLDFetcher fetcher.Factory `name:"ipldFetcher"`
+// ProviderRecordValidity sets how long the DHT keeps the provider records of
+// the other peers.
+func ProviderRecordValidity(validity time.Duration) func() {
+	return func() {
+		providers.ProvideValidity = validity
 	}
-	return func(in input) simple.KeyChanFunc {
-		return simple.NewPinnedProvider(onlyRoots, in.Pinner, in.IPLDFetcher)
+}
+
+// trackReprovideRounds returns the keys of keys, and records the rounds of
+// reprovides listing them in the metrics, along with when the records they
+// provide start expiring, the peers keeping them for validity.
+func trackReprovideRounds(keys simple.KeyChanFunc, validity time.Duration) simple.KeyChanFunc {
+	var mu sync.Mutex
+	var last time.Time
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		ch, err := keys(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		mu.Lock()
+		if !last.IsZero() && now.Sub(last) > validity {
+			reprovideExpired.Inc()
+		}
+		last = now
+		mu.Unlock()
+		reprovideRoundTime.Set(float64(now.Unix()))
+		reprovideExpiryTime.Set(float64(now.Add(validity).Unix()))
+		return ch, nil
 	}
 }
+
+// selectorPinnedProvider returns the keys of pinned followed by the blocks
+// matched by the selector pins, or only their roots if onlyRoots is set.
+func selectorPinnedProvider(pinned simple.KeyChanFunc, onlyRoots bool, sp *selectorpin.Store, bs blockstore.Blockstore) simple.KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		// reproviding does not count as reading the pins
+		ctx = expiry.Untracked(ctx)
+
+		keys, err := pinned(ctx)
+		if err != nil {
+			return nil, err
+		}
+		spins, err := sp.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+
+			send := func(c cid.Cid) bool {
+				select {
+				case outCh <- c:
+					return true
+				case <-ctx.Done():
+					return false
+				}
+			}
+
+			for c := range keys {
+				if !send(c) {
+					return
+				}
+			}
+
+			set := cid.NewSet()
+			for _, p := range spins {
+				if onlyRoots {
+					if set.Visit(p.Root) && !send(p.Root) {
+						return
+					}
+					continue
+				}
+				err := selectorpin.Walk(ctx, blockGetter{bs}, p, func(c cid.Cid) {
+					if set.Visit(c) {
+						send(c)
+					}
+				})
+				if err != nil {
+					logger.Errorf("reprovide selector pin %s: %s", p.Root, err)
+				}
+			}
+		}()
+
+		return outCh, nil
+	}
+}
+
+// blockGetter gets blocks from a blockstore.
+type blockGetter struct {
+	bs blockstore.Blockstore
+}
+
+func (g blockGetter) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return g.bs.Get(ctx, c)
+}
@@ -0,0 +1,43 @@
+package node
+
+import (
+	"context"
+
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/pubqueue"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"go.uber.org/fx"
+)
+
+// optionalPublishQueue is the queue of the publishes made while unreachable,
+// which only exists when online and enabled
+type optionalPublishQueue struct {
+	fx.In
+	Queue *pubqueue.Queue `optional:"true"`
+}
+
+// routing returns rt, queuing the publishes made while unreachable if
+// enabled.
+func (pq optionalPublishQueue) routing(rt routing.Routing) routing.Routing {
+	if pq.Queue == nil {
+		return rt
+	}
+	return pq.Queue.Routing()
+}
+
+// PublishQueue creates the queue of the IPNS records and the provides that
+// could not be published while the node was unreachable
+func PublishQueue(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo, rt routing.Routing, h host.Host) (*pubqueue.Queue, error) {
+	q, err := pubqueue.New(helpers.LifecycleCtx(mctx, lc), repo.Datastore(), rt, h.Network())
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(context.Context) error {
+			return q.Close()
+		},
+	})
+	return q, nil
+}
@@ -0,0 +1,36 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/pubsubhistory"
+	"github.com/ipfs/go-ipfs/repo"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"go.uber.org/fx"
+)
+
+const (
+	defaultPubsubHistorySize = 100
+	defaultPubsubHistoryTTL  = 24 * time.Hour
+)
+
+// PubsubHistory keeps the recent messages of the topics of cfg, persisted in
+// the datastore of the repo.
+func PubsubHistory(cfg config.PubsubHistory) func(fx.Lifecycle, repo.Repo, *pubsub.PubSub) (*pubsubhistory.History, error) {
+	return func(lc fx.Lifecycle, repo repo.Repo, ps *pubsub.PubSub) (*pubsubhistory.History, error) {
+		size := cfg.Size.WithDefault(defaultPubsubHistorySize)
+		ttl := cfg.TTL.WithDefault(defaultPubsubHistoryTTL)
+		h, err := pubsubhistory.New(ps, repo.Datastore(), cfg.Topics, int(size), ttl)
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStop: func(context.Context) error {
+				return h.Close()
+			},
+		})
+		return h, nil
+	}
+}
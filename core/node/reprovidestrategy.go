@@ -0,0 +1,347 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-fetcher"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-mfs"
+	"go.uber.org/fx"
+
+	"github.com/ipfs/go-ipfs/demand"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/maintenance"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
+)
+
+// ReprovideStrategyParams are the parts of the node the reprovide strategies
+// list the keys to reprovide from. The blockstore and the fetcher read the
+// blocks at the rate of the background jobs.
+type ReprovideStrategyParams struct {
+	Pinner       pin.Pinner
+	SelectorPins *selectorpin.Store
+	PinMeta      *pinmeta.Store
+	Blockstore   blockstore.Blockstore
+	IPLDFetcher  fetcher.Factory
+	FilesRoot    *mfs.Root
+	// Demand is the tracker of the keys requested over bitswap, nil when
+	// offline or not used by the strategy
+	Demand *demand.Tracker
+}
+
+// ReprovideStrategy builds the function listing the keys reprovided by a
+// strategy of Reprovider.Strategy. arg is what follows the colon after the
+// name of the strategy, if any, as "public=true" in "pinned:public=true".
+type ReprovideStrategy func(arg string, p ReprovideStrategyParams) (simple.KeyChanFunc, error)
+
+var (
+	reprovideStrategiesMu sync.Mutex
+	reprovideStrategies   = map[string]ReprovideStrategy{
+		"all":    allReprovideStrategy,
+		"pinned": pinnedReprovideStrategy(false),
+		"roots":  pinnedReprovideStrategy(true),
+		"mfs":    mfsReprovideStrategy,
+		"demand": demandReprovideStrategy,
+	}
+)
+
+// RegisterReprovideStrategy adds a strategy to Reprovider.Strategy. It fails
+// if the name is already registered.
+func RegisterReprovideStrategy(name string, s ReprovideStrategy) error {
+	if name == "" || strings.ContainsAny(name, ":+") {
+		return fmt.Errorf("invalid reprovider strategy name %q", name)
+	}
+
+	reprovideStrategiesMu.Lock()
+	defer reprovideStrategiesMu.Unlock()
+
+	if _, ok := reprovideStrategies[name]; ok {
+		return fmt.Errorf("reprovider strategy %q already registered", name)
+	}
+	reprovideStrategies[name] = s
+	return nil
+}
+
+// reprovideStrategy is a strategy of Reprovider.Strategy, with its argument.
+type reprovideStrategy struct {
+	strategy ReprovideStrategy
+	arg      string
+}
+
+// parseReprovideStrategy parses the strategies of s, joined with "+", as
+// "pinned+mfs".
+func parseReprovideStrategy(s string) ([]reprovideStrategy, error) {
+	if s == "" {
+		s = "all"
+	}
+
+	reprovideStrategiesMu.Lock()
+	defer reprovideStrategiesMu.Unlock()
+
+	var strategies []reprovideStrategy
+	for _, part := range strings.Split(s, "+") {
+		name, arg := part, ""
+		if i := strings.Index(part, ":"); i >= 0 {
+			name, arg = part[:i], part[i+1:]
+		}
+		strategy, ok := reprovideStrategies[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown reprovider strategy '%s'", name)
+		}
+		strategies = append(strategies, reprovideStrategy{strategy: strategy, arg: arg})
+	}
+	return strategies, nil
+}
+
+// reprovideKeyProvider returns the keys of the strategies, one strategy after
+// the other, each key once. The rounds of reprovides are tracked in the
+// metrics, their records being valid for recordValidity.
+func reprovideKeyProvider(strategies []reprovideStrategy, recordValidity time.Duration) interface{} {
+	type input struct {
+		fx.In
+		Pinner       pin.Pinner
+		SelectorPins *selectorpin.Store
+		PinMeta      *pinmeta.Store
+		Blockstore   blockstore.Blockstore
+		BlockService blockservice.BlockService
+		IPLDFetcher  fetcher.Factory `name:"ipldFetcher"`
+		FilesRoot    *mfs.Root
+		BackgroundIO *iothrottle.Limiter    `optional:"true"`
+		Maintenance  *maintenance.Scheduler `optional:"true"`
+		Demand       *demand.Tracker        `optional:"true"`
+	}
+	return func(in input) (simple.KeyChanFunc, error) {
+		p := ReprovideStrategyParams{
+			Pinner:       in.Pinner,
+			SelectorPins: in.SelectorPins,
+			PinMeta:      in.PinMeta,
+			Blockstore:   in.Blockstore,
+			IPLDFetcher:  in.IPLDFetcher,
+			FilesRoot:    in.FilesRoot,
+			Demand:       in.Demand,
+		}
+		if l := in.Maintenance.Limiter(maintenance.Reprovide, in.BackgroundIO); l != nil {
+			// the keys are listed at the rate of the background jobs, in
+			// the maintenance windows
+			p.Blockstore = iothrottle.NewBlockstore(in.Blockstore, l)
+			p.IPLDFetcher = FetcherConfig(blockservice.New(p.Blockstore, in.BlockService.Exchange())).IPLDFetcher
+		}
+
+		keys := make([]simple.KeyChanFunc, 0, len(strategies))
+		for _, s := range strategies {
+			k, err := s.strategy(s.arg, p)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+		if len(keys) == 1 {
+			return trackReprovideRounds(keys[0], recordValidity), nil
+		}
+		return trackReprovideRounds(joinKeyProviders(keys), recordValidity), nil
+	}
+}
+
+// joinKeyProviders returns the keys of providers, one after the other, each
+// key once.
+func joinKeyProviders(providers []simple.KeyChanFunc) simple.KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+
+			set := cid.NewSet()
+			for _, provider := range providers {
+				keys, err := provider(ctx)
+				if err != nil {
+					logger.Errorf("reprovide: %s", err)
+					return
+				}
+				for c := range keys {
+					if !set.Visit(c) {
+						continue
+					}
+					select {
+					case outCh <- c:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}()
+		return outCh, nil
+	}
+}
+
+// allReprovideStrategy returns the keys of the blockstore.
+func allReprovideStrategy(arg string, p ReprovideStrategyParams) (simple.KeyChanFunc, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("reprovider strategy 'all' takes no argument")
+	}
+	return simple.NewBlockstoreProvider(p.Blockstore), nil
+}
+
+// pinnedReprovideStrategy returns the keys of the pins, or only their roots if
+// onlyRoots is set. Given labels as argument, as "public=true,team=web", it
+// returns the keys of the pins with these labels, the selector pins having
+// none.
+func pinnedReprovideStrategy(onlyRoots bool) ReprovideStrategy {
+	return func(arg string, p ReprovideStrategyParams) (simple.KeyChanFunc, error) {
+		if arg == "" {
+			pinned := simple.NewPinnedProvider(onlyRoots, p.Pinner, p.IPLDFetcher)
+			return selectorPinnedProvider(pinned, onlyRoots, p.SelectorPins, p.Blockstore), nil
+		}
+
+		labels, err := pinmeta.ParseLabels(strings.Split(arg, ","))
+		if err != nil {
+			return nil, err
+		}
+		pinner := &labeledPinner{pinner: p.Pinner, meta: p.PinMeta, filter: pinmeta.Filter{Labels: labels}}
+		pinned := simple.NewPinnedProvider(onlyRoots, pinner, p.IPLDFetcher)
+		return func(ctx context.Context) (<-chan cid.Cid, error) {
+			// reproviding does not count as reading the pins
+			return pinned(expiry.Untracked(ctx))
+		}, nil
+	}
+}
+
+// demandReprovideStrategy returns the roots of the pins, followed by the keys
+// the peers requested in the last Reprovider.Demand.Window that the node
+// stores, so that the content nobody requests is only announced by its roots.
+// Offline, the requests are not tracked, and only the roots are returned.
+func demandReprovideStrategy(arg string, p ReprovideStrategyParams) (simple.KeyChanFunc, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("reprovider strategy 'demand' takes no argument")
+	}
+	roots, err := pinnedReprovideStrategy(true)("", p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Demand == nil {
+		return roots, nil
+	}
+
+	requested := func(ctx context.Context) (<-chan cid.Cid, error) {
+		stats := p.Demand.InDemand(0)
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+			for _, st := range stats {
+				has, err := p.Blockstore.Has(ctx, st.Key)
+				if err != nil {
+					logger.Errorf("reprovide the keys in demand: %s", err)
+					return
+				}
+				if !has {
+					continue
+				}
+				select {
+				case outCh <- st.Key:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return outCh, nil
+	}
+	return joinKeyProviders([]simple.KeyChanFunc{roots, requested}), nil
+}
+
+// labeledPinner lists the pins of pinner selected by filter.
+type labeledPinner struct {
+	pinner pin.Pinner
+	meta   *pinmeta.Store
+	filter pinmeta.Filter
+}
+
+func (p *labeledPinner) DirectKeys(ctx context.Context) ([]cid.Cid, error) {
+	return p.selected(ctx, p.pinner.DirectKeys)
+}
+
+func (p *labeledPinner) RecursiveKeys(ctx context.Context) ([]cid.Cid, error) {
+	return p.selected(ctx, p.pinner.RecursiveKeys)
+}
+
+func (p *labeledPinner) selected(ctx context.Context, list func(context.Context) ([]cid.Cid, error)) ([]cid.Cid, error) {
+	metas, err := p.meta.List(ctx, p.filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) == 0 {
+		return nil, nil
+	}
+	roots := cid.NewSet()
+	for _, m := range metas {
+		roots.Add(m.Root)
+	}
+
+	keys, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var selected []cid.Cid
+	for _, c := range keys {
+		if roots.Has(c) {
+			selected = append(selected, c)
+		}
+	}
+	return selected, nil
+}
+
+// mfsReprovideStrategy returns the keys of the MFS, skipping the blocks the
+// node does not have, as those of the directories copied into the MFS
+// without being fetched.
+func mfsReprovideStrategy(arg string, p ReprovideStrategyParams) (simple.KeyChanFunc, error) {
+	if arg != "" {
+		return nil, fmt.Errorf("reprovider strategy 'mfs' takes no argument")
+	}
+	dserv := dag.NewDAGService(blockservice.New(p.Blockstore, offline.Exchange(p.Blockstore)))
+
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		nd, err := p.FilesRoot.GetDirectory().GetNode()
+		if err != nil {
+			return nil, err
+		}
+		root := nd.Cid()
+
+		outCh := make(chan cid.Cid)
+		go func() {
+			defer close(outCh)
+
+			getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+				links, err := dag.GetLinksDirect(dserv)(ctx, c)
+				if errors.Is(err, ipld.ErrNotFound{}) {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				select {
+				case outCh <- c:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				return links, nil
+			}
+			err := dag.Walk(ctx, getLinks, root, cid.NewSet().Visit)
+			if err != nil && ctx.Err() == nil {
+				logger.Errorf("reprovide mfs: %s", err)
+			}
+		}()
+		return outCh, nil
+	}, nil
+}
@@ -0,0 +1,46 @@
+package node
+
+import (
+	"fmt"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/resbudget"
+	"github.com/libp2p/go-libp2p-core/host"
+	"go.uber.org/fx"
+)
+
+// ResourceBudget creates the resource budget of the node, counting its file
+// descriptors, goroutines and sockets for as long as the node runs
+func ResourceBudget(cfg config.ResourceBudget) func(helpers.MetricsCtx, fx.Lifecycle) (*resbudget.Budget, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle) (*resbudget.Budget, error) {
+		limits := resbudget.Limits{
+			FileDescriptors: cfg.FileDescriptors.WithDefault(config.DefaultResourceBudgetFileDescriptors),
+			Goroutines:      int(cfg.Goroutines.WithDefault(0)),
+			Sockets:         int(cfg.Sockets.WithDefault(0)),
+		}
+		if limits.FileDescriptors < 0 || limits.FileDescriptors > 1 {
+			return nil, fmt.Errorf("ResourceBudget.FileDescriptors must be between 0 and 1")
+		}
+		if limits.Goroutines < 0 || limits.Sockets < 0 {
+			return nil, fmt.Errorf("ResourceBudget.Goroutines and ResourceBudget.Sockets must not be negative")
+		}
+		interval := cfg.Interval.WithDefault(config.DefaultResourceBudgetInterval)
+		if interval <= 0 {
+			return nil, fmt.Errorf("ResourceBudget.Interval must be positive")
+		}
+
+		b := resbudget.New(limits)
+		go b.Run(helpers.LifecycleCtx(mctx, lc), interval)
+		return b, nil
+	}
+}
+
+// ShedConnections trims the connections to the peers while the node is over a
+// soft limit of its resource budget
+func ShedConnections(mctx helpers.MetricsCtx, lc fx.Lifecycle, b *resbudget.Budget, h host.Host) {
+	ctx := helpers.LifecycleCtx(mctx, lc)
+	b.OnOverLimit(func() {
+		h.ConnManager().TrimOpenConns(ctx)
+	})
+}
@@ -1,14 +1,23 @@
 package node
 
 import (
+	"context"
+	"fmt"
+
+	humanize "github.com/dustin/go-humanize"
 	"github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipfs/go-ipfs/config"
 	"go.uber.org/fx"
 
 	"github.com/ipfs/go-filestore"
+	"github.com/ipfs/go-ipfs/blocks/coldtier"
+	"github.com/ipfs/go-ipfs/blocks/groupcommit"
+	"github.com/ipfs/go-ipfs/blocks/placement"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/pinning/expiry"
 	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/tenants"
 	"github.com/ipfs/go-ipfs/thirdparty/verifbs"
 )
 
@@ -22,23 +31,69 @@ func Datastore(repo repo.Repo) datastore.Datastore {
 	return repo.Datastore()
 }
 
+// ExpiringPins creates the store of the pins with an expiry class, which
+// records the reads of their roots
+func ExpiringPins(repo repo.Repo) *expiry.Store {
+	return expiry.New(repo.Datastore())
+}
+
 // BaseBlocks is the lower level blockstore without GC or Filestore layers
 type BaseBlocks blockstore.Blockstore
 
-// BaseBlockstoreCtor creates cached blockstore backed by the provided datastore
-func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead bool) func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle) (bs BaseBlocks, err error) {
-	return func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle) (bs BaseBlocks, err error) {
-		// hash security
+// BaseBlockstoreCtor creates cached blockstore backed by the provided datastore.
+// When the repo has a cold tier, the returned coldtier blockstore is the
+// two-tier layer beneath the cache, otherwise it is nil. Likewise, the
+// returned placement blockstore is the layer placing the blocks in the mounts
+// of Datastore.Placement when it has rules.
+func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead bool, gcCfg config.GroupCommit, placementCfg config.Placement) func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle, expiring *expiry.Store, ta optionalTenants) (bs BaseBlocks, cold *coldtier.Blockstore, placed *placement.Blockstore, err error) {
+	return func(mctx helpers.MetricsCtx, repo repo.Repo, lc fx.Lifecycle, expiring *expiry.Store, ta optionalTenants) (bs BaseBlocks, cold *coldtier.Blockstore, placed *placement.Blockstore, err error) {
 		bs = blockstore.NewBlockstore(repo.Datastore())
+		if gcCfg.Enabled.WithDefault(false) {
+			opts, err := groupCommitOptions(gcCfg)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			gcbs := groupcommit.New(bs, opts)
+			lc.Append(fx.Hook{
+				OnStop: func(context.Context) error {
+					return gcbs.Close()
+				},
+			})
+			bs = gcbs
+		}
+		if len(placementCfg.Rules) > 0 {
+			placed, err = placementBlockstore(placementCfg, repo, bs)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			bs = placed
+		}
+		if cds := repo.ColdDatastore(); cds != nil {
+			// The cold datastore holds nothing but blocks, so it is not
+			// namespaced (which also keeps it usable with flatfs).
+			cold = coldtier.New(bs, blockstore.NewBlockstoreNoPrefix(cds), repo.Datastore())
+			bs = cold
+		}
+
+		// record reads for the inactivity of expiring pins
+		bs = expiry.NewBlockstore(bs, expiring)
+
+		// hash security
 		bs = &verifbs.VerifBS{Blockstore: bs}
 
 		if !nilRepo {
 			bs, err = blockstore.CachedBlockstore(helpers.LifecycleCtx(mctx, lc), bs, cacheOpts)
 			if err != nil {
-				return nil, err
+				return nil, nil, nil, err
 			}
 		}
 
+		// account for the blocks stored by the tenants, above the cache
+		// telling whether they are new
+		if ta.Tenants != nil {
+			bs = tenants.NewBlockstore(bs, ta.Tenants)
+		}
+
 		bs = blockstore.NewIdStore(bs)
 
 		if hashOnRead { // TODO: review: this is how it was done originally, is there a reason we can't just pass this directly?
@@ -49,6 +104,30 @@ func BaseBlockstoreCtor(cacheOpts blockstore.CacheOpts, nilRepo bool, hashOnRead
 	}
 }
 
+// groupCommitOptions reads the limits of the group commits from cfg
+func groupCommitOptions(cfg config.GroupCommit) (groupcommit.Options, error) {
+	maxBlocks := cfg.MaxBlocks.WithDefault(groupcommit.DefaultMaxBlocks)
+	if maxBlocks <= 0 {
+		return groupcommit.Options{}, fmt.Errorf("Datastore.GroupCommit.MaxBlocks must be positive")
+	}
+	maxSize := uint64(groupcommit.DefaultMaxSize)
+	if cfg.MaxSize != nil {
+		var err error
+		maxSize, err = humanize.ParseBytes(cfg.MaxSize.WithDefault(""))
+		if err != nil {
+			return groupcommit.Options{}, fmt.Errorf("invalid Datastore.GroupCommit.MaxSize: %s", err)
+		}
+		if maxSize == 0 {
+			return groupcommit.Options{}, fmt.Errorf("Datastore.GroupCommit.MaxSize must be positive")
+		}
+	}
+	return groupcommit.Options{
+		MaxBlocks:     int(maxBlocks),
+		MaxSize:       int(maxSize),
+		FlushInterval: cfg.FlushInterval.WithDefault(0),
+	}, nil
+}
+
 // GcBlockstoreCtor wraps the base blockstore with GC and Filestore layers
 func GcBlockstoreCtor(bb BaseBlocks) (gclocker blockstore.GCLocker, gcbs blockstore.GCBlockstore, bs blockstore.Blockstore) {
 	gclocker = blockstore.NewGCLocker()
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/fx"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/core/node/helpers"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/tenants"
+)
+
+// tenantUsageSaveInterval is how often the usage of the tenants is saved
+const tenantUsageSaveInterval = time.Minute
+
+// optionalTenants is the accountant of the tenants, which only exists when
+// API.Authorizations are set
+type optionalTenants struct {
+	fx.In
+	Tenants *tenants.Accountant `optional:"true"`
+}
+
+// Tenants creates the accountant of the usage of every API authorization
+func Tenants(cfg config.API) func(helpers.MetricsCtx, fx.Lifecycle, repo.Repo) (*tenants.Accountant, error) {
+	return func(mctx helpers.MetricsCtx, lc fx.Lifecycle, repo repo.Repo) (*tenants.Accountant, error) {
+		names := make([]string, 0, len(cfg.Authorizations))
+		for name := range cfg.Authorizations {
+			names = append(names, name)
+		}
+
+		a, err := tenants.New(mctx, repo.Datastore(), names)
+		if err != nil {
+			return nil, err
+		}
+		lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go a.Run(tenantUsageSaveInterval)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return a.Close()
+			},
+		})
+		return a, nil
+	}
+}
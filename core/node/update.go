@@ -0,0 +1,49 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/go-fetcher"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-namesys"
+	"github.com/ipfs/go-path/resolver"
+	"go.uber.org/fx"
+
+	version "github.com/ipfs/go-ipfs"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/update"
+)
+
+// UpdateChecker creates the checker for newer versions of go-ipfs of Update.Check
+func UpdateChecker(cfg config.Update) interface{} {
+	type input struct {
+		fx.In
+		LC            fx.Lifecycle
+		Namesys       namesys.NameSystem
+		DAG           format.DAGService
+		UnixfsFetcher fetcher.Factory `name:"unixfsFetcher"`
+	}
+	return func(in input) (*update.Checker, error) {
+		interval := cfg.Interval.WithDefault(config.DefaultUpdateCheckInterval)
+		if interval <= 0 {
+			return nil, fmt.Errorf("config setting Update.Interval must be positive: %s", interval)
+		}
+
+		fetcher := update.NewFetcher(update.DistPath(cfg), in.Namesys, resolver.NewBasicResolver(in.UnixfsFetcher), in.DAG)
+		c, err := update.New(version.CurrentVersionNumber, fetcher)
+		if err != nil {
+			return nil, err
+		}
+		in.LC.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go c.Run(interval)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				return c.Close()
+			},
+		})
+		return c, nil
+	}
+}
@@ -0,0 +1,247 @@
+// Package demand records which keys the peers request over bitswap, and
+// persists it in the datastore, so that the reprovider announces the keys in
+// demand more often than the others, and announces only the roots of the
+// content nobody requests.
+//
+// The Tracker is given to bitswap as its tracer, to see the wants received. A
+// key is in demand when it was requested in the last window, and hot when it
+// was requested at least a number of times in its current window, which
+// starts with the first request after the previous one has passed.
+package demand
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("demand")
+
+// demandKey is the datastore key under which the requests are persisted.
+var demandKey = ds.NewKey("/local/demand")
+
+const (
+	// MaxKeys is the number of keys whose requests are kept, the keys
+	// requested last.
+	MaxKeys = 1 << 16
+	// FlushInterval is the interval at which the requests are persisted.
+	FlushInterval = time.Minute
+)
+
+// Stat is the record of the requests of a key.
+type Stat struct {
+	Key cid.Cid `json:"-"`
+	// Requests is the number of requests in the current window
+	Requests uint64
+	// Since is when the current window started
+	Since time.Time
+	// Last is the time of the last request
+	Last time.Time
+}
+
+// Tracker records the requests of the keys, until Close is called.
+type Tracker struct {
+	ds     ds.Datastore
+	window time.Duration
+
+	mu    sync.Mutex
+	keys  map[cid.Cid]*Stat
+	dirty map[cid.Cid]struct{}
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// New returns a tracker of the requests persisted in d, a key being in demand
+// for window after its last request.
+func New(ctx context.Context, d ds.Datastore, window time.Duration) (*Tracker, error) {
+	t := &Tracker{
+		ds:      d,
+		window:  window,
+		keys:    make(map[cid.Cid]*Stat),
+		dirty:   make(map[cid.Cid]struct{}),
+		closing: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	res, err := d.Query(ctx, dsq.Query{Prefix: demandKey.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		c, err := cid.Decode(k.BaseNamespace())
+		if err != nil {
+			log.Warnf("ignoring the requests of invalid key %s", k.BaseNamespace())
+			continue
+		}
+		var st Stat
+		if err := json.Unmarshal(e.Value, &st); err != nil {
+			log.Warnf("ignoring the invalid requests of key %s: %s", c, err)
+			continue
+		}
+		st.Key = c
+		t.keys[c] = &st
+	}
+	go t.run()
+	return t, nil
+}
+
+// Stat returns the requests of c, if requested in the last window.
+func (t *Tracker) Stat(c cid.Cid) (Stat, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	st, ok := t.keys[c]
+	if !ok || time.Since(st.Last) > t.window {
+		return Stat{}, false
+	}
+	return *st, true
+}
+
+// InDemand returns the requests of the keys requested in the last window
+// at least min times in their current window, the most requested first.
+func (t *Tracker) InDemand(min uint64) []Stat {
+	now := time.Now()
+	t.mu.Lock()
+	stats := make([]Stat, 0, len(t.keys))
+	for _, st := range t.keys {
+		if now.Sub(st.Last) <= t.window && st.Requests >= min {
+			stats = append(stats, *st)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Requests != stats[j].Requests {
+			return stats[i].Requests > stats[j].Requests
+		}
+		return stats[i].Last.After(stats[j].Last)
+	})
+	return stats
+}
+
+// MessageReceived records the wants of p in msg. It implements
+// bitswap.Tracer.
+func (t *Tracker) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	entries := msg.Wantlist()
+	if len(entries) == 0 {
+		return
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range entries {
+		if e.Cancel {
+			continue
+		}
+		t.request(e.Cid, now)
+	}
+}
+
+// MessageSent implements bitswap.Tracer, the messages sent are not recorded.
+func (t *Tracker) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {}
+
+// request records a request of c. t.mu must be held.
+func (t *Tracker) request(c cid.Cid, now time.Time) {
+	st, ok := t.keys[c]
+	if !ok {
+		st = &Stat{Key: c}
+		t.keys[c] = st
+	}
+	if now.Sub(st.Since) > t.window {
+		st.Since = now
+		st.Requests = 0
+	}
+	st.Requests++
+	st.Last = now
+	t.dirty[c] = struct{}{}
+}
+
+// Close persists the requests and stops recording.
+func (t *Tracker) Close() error {
+	close(t.closing)
+	<-t.closed
+	return t.flush(context.Background(), time.Now())
+}
+
+func (t *Tracker) run() {
+	defer close(t.closed)
+	tick := time.NewTicker(FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			if err := t.flush(context.Background(), now); err != nil {
+				log.Errorf("persisting the requests: %s", err)
+			}
+		case <-t.closing:
+			return
+		}
+	}
+}
+
+// flush persists the requests changed, and forgets the keys not requested in
+// the last window and the ones past MaxKeys.
+func (t *Tracker) flush(ctx context.Context, now time.Time) error {
+	t.mu.Lock()
+	var evicted []cid.Cid
+	for c, st := range t.keys {
+		if now.Sub(st.Last) > t.window {
+			evicted = append(evicted, c)
+		}
+	}
+	for _, c := range evicted {
+		delete(t.keys, c)
+		delete(t.dirty, c)
+	}
+	if len(t.keys) > MaxKeys {
+		cs := make([]cid.Cid, 0, len(t.keys))
+		for c := range t.keys {
+			cs = append(cs, c)
+		}
+		sort.Slice(cs, func(i, j int) bool {
+			return t.keys[cs[i]].Last.After(t.keys[cs[j]].Last)
+		})
+		for _, c := range cs[MaxKeys:] {
+			delete(t.keys, c)
+			delete(t.dirty, c)
+			evicted = append(evicted, c)
+		}
+	}
+	changed := make([]Stat, 0, len(t.dirty))
+	for c := range t.dirty {
+		changed = append(changed, *t.keys[c])
+	}
+	t.dirty = make(map[cid.Cid]struct{})
+	t.mu.Unlock()
+
+	if len(changed) == 0 && len(evicted) == 0 {
+		return nil
+	}
+	for _, c := range evicted {
+		if err := t.ds.Delete(ctx, demandKey.ChildString(c.String())); err != nil {
+			return err
+		}
+	}
+	for _, st := range changed {
+		b, err := json.Marshal(&st)
+		if err != nil {
+			return err
+		}
+		if err := t.ds.Put(ctx, demandKey.ChildString(st.Key.String()), b); err != nil {
+			return err
+		}
+	}
+	return t.ds.Sync(ctx, demandKey)
+}
@@ -0,0 +1,161 @@
+package demand
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	pb "github.com/ipfs/go-bitswap/message/pb"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+func testKey(i int) cid.Cid {
+	return blocks.NewBlock([]byte(fmt.Sprint("block ", i))).Cid()
+}
+
+func wants(cancel bool, cs ...cid.Cid) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	for _, c := range cs {
+		if cancel {
+			msg.Cancel(c)
+		} else {
+			msg.AddEntry(c, 1, pb.Message_Wantlist_Have, false)
+		}
+	}
+	return msg
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	tr, err := New(ctx, d, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, b, c := testKey(1), testKey(2), testKey(3)
+	for i := 0; i < 3; i++ {
+		tr.MessageReceived("peer", wants(false, a))
+	}
+	tr.MessageReceived("peer", wants(false, b))
+	tr.MessageReceived("peer", wants(true, c))
+
+	if st, ok := tr.Stat(a); !ok || st.Requests != 3 {
+		t.Fatalf("expected 3 requests of a, got %v", st)
+	}
+	if _, ok := tr.Stat(c); ok {
+		t.Fatal("expected the cancels not to be requests")
+	}
+	stats := tr.InDemand(0)
+	if len(stats) != 2 || stats[0].Key != a || stats[1].Key != b {
+		t.Fatalf("expected a then b in demand, got %v", stats)
+	}
+	if stats := tr.InDemand(2); len(stats) != 1 || stats[0].Key != a {
+		t.Fatalf("expected only a requested twice, got %v", stats)
+	}
+
+	// the window of b passed
+	tr.mu.Lock()
+	tr.keys[b].Since = time.Now().Add(-2 * time.Hour)
+	tr.keys[b].Last = time.Now().Add(-2 * time.Hour)
+	tr.mu.Unlock()
+	if _, ok := tr.Stat(b); ok {
+		t.Fatal("expected b not to be in demand after its window")
+	}
+	tr.MessageReceived("peer", wants(false, b))
+	if st, ok := tr.Stat(b); !ok || st.Requests != 1 {
+		t.Fatalf("expected the requests of b to restart, got %v", st)
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tr, err = New(ctx, d, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	if st, ok := tr.Stat(a); !ok || st.Requests != 3 || st.Key != a {
+		t.Fatalf("expected the requests of a to be persisted, got %v", st)
+	}
+}
+
+func TestFlushEvicts(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	tr, err := New(ctx, d, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	old, recent := testKey(1), testKey(2)
+	tr.MessageReceived("peer", wants(false, old, recent))
+	if err := tr.flush(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	tr.mu.Lock()
+	tr.keys[old].Last = time.Now().Add(-2 * time.Hour)
+	tr.mu.Unlock()
+	if err := tr.flush(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(ctx, demandKey.ChildString(old.String())); has {
+		t.Fatal("expected the key not requested in the window to be forgotten")
+	}
+	if has, _ := d.Has(ctx, demandKey.ChildString(recent.String())); !has {
+		t.Fatal("expected the key requested to be persisted")
+	}
+}
+
+type mockRouting struct {
+	mu       sync.Mutex
+	provided []cid.Cid
+}
+
+func (m *mockRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.provided = append(m.provided, c)
+	return nil
+}
+
+func (m *mockRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, n int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
+
+func TestReprovideHot(t *testing.T) {
+	ctx := context.Background()
+	tr, err := New(ctx, dssync.MutexWrap(ds.NewMapDatastore()), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	hot, missing, cold := testKey(1), testKey(2), testKey(3)
+	for i := 0; i < 5; i++ {
+		tr.MessageReceived("peer", wants(false, hot, missing))
+	}
+	tr.MessageReceived("peer", wants(false, cold))
+
+	var rt mockRouting
+	has := func(ctx context.Context, c cid.Cid) (bool, error) {
+		return c != missing, nil
+	}
+	n, err := ReprovideHot(ctx, tr, &rt, has, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(rt.provided) != 1 || rt.provided[0] != hot {
+		t.Fatalf("expected only the hot key stored to be provided, got %v", rt.provided)
+	}
+}
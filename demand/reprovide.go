@@ -0,0 +1,44 @@
+package demand
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var hotProvides = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "ipfs_reprovider_hot_provides_total",
+	Help: "keys in demand reprovided between the rounds of reprovides",
+})
+
+// MaxHotKeys is the number of hot keys reprovided at once, the most requested.
+const MaxHotKeys = 1024
+
+// ReprovideHot provides the keys requested at least hot times in their
+// current window that has says the node stores, returning how many were
+// provided. It stops at the first failure.
+func ReprovideHot(ctx context.Context, t *Tracker, rt routing.ContentRouting, has func(context.Context, cid.Cid) (bool, error), hot uint64) (int, error) {
+	stats := t.InDemand(hot)
+	if len(stats) > MaxHotKeys {
+		stats = stats[:MaxHotKeys]
+	}
+	provided := 0
+	for _, st := range stats {
+		ok, err := has(ctx, st.Key)
+		if err != nil {
+			return provided, err
+		}
+		if !ok {
+			continue
+		}
+		if err := rt.Provide(ctx, st.Key, true); err != nil {
+			return provided, err
+		}
+		hotProvides.Inc()
+		provided++
+	}
+	return provided, nil
+}
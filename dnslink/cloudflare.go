@@ -0,0 +1,141 @@
+package dnslink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultCloudflareEndpoint = "https://api.cloudflare.com/client/v4"
+
+type cloudflareProvider struct {
+	endpoint string
+	token    string
+	zoneID   string
+	client   *http.Client
+}
+
+// NewCloudflareProvider returns a provider using the Cloudflare DNS API.
+//
+// Parameters: "Token" (an API token with DNS edit permission), "ZoneID", and
+// optionally "Endpoint".
+func NewCloudflareProvider(params map[string]string) (Provider, error) {
+	if err := requireParams("cloudflare", params, "Token", "ZoneID"); err != nil {
+		return nil, err
+	}
+	endpoint := params["Endpoint"]
+	if endpoint == "" {
+		endpoint = defaultCloudflareEndpoint
+	}
+	return &cloudflareProvider{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    params["Token"],
+		zoneID:   params["ZoneID"],
+		client:   &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (p *cloudflareProvider) SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error {
+	name := strings.TrimSuffix(recordName(domain), ".")
+	records := p.zoneURL("dns_records")
+
+	var existing []cloudflareRecord
+	query := url.Values{"type": {"TXT"}, "name": {name}}
+	if err := p.do(ctx, http.MethodGet, records+"?"+query.Encode(), nil, &existing); err != nil {
+		return err
+	}
+
+	rec := cloudflareRecord{
+		Type:    "TXT",
+		Name:    name,
+		Content: "dnslink=" + value,
+		TTL:     1, // automatic
+	}
+	if ttl > 0 {
+		rec.TTL = int(ttl.Seconds())
+	}
+
+	// Update the first dnslink entry in place and remove any others.
+	updated := false
+	for _, e := range existing {
+		if !strings.HasPrefix(e.Content, "dnslink=") {
+			continue
+		}
+		if !updated {
+			if err := p.do(ctx, http.MethodPut, records+"/"+e.ID, rec, nil); err != nil {
+				return err
+			}
+			updated = true
+			continue
+		}
+		if err := p.do(ctx, http.MethodDelete, records+"/"+e.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	if updated {
+		return nil
+	}
+	return p.do(ctx, http.MethodPost, records, rec, nil)
+}
+
+func (p *cloudflareProvider) zoneURL(resource string) string {
+	return fmt.Sprintf("%s/zones/%s/%s", p.endpoint, url.PathEscape(p.zoneID), resource)
+}
+
+func (p *cloudflareProvider) do(ctx context.Context, method, u string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var res cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: decoding response: %w", method, u, err)
+	}
+	if !res.Success {
+		msgs := make([]string, 0, len(res.Errors))
+		for _, e := range res.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s (%s)", method, u, resp.Status, strings.Join(msgs, "; "))
+	}
+	if out != nil {
+		return json.Unmarshal(res.Result, out)
+	}
+	return nil
+}
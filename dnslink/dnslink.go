@@ -0,0 +1,177 @@
+// Package dnslink keeps DNSLink TXT records pointing at the current value of
+// IPNS names and MFS paths, using pluggable DNS provider APIs.
+package dnslink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/go-ipfs/mfswatch"
+)
+
+var log = logging.Logger("dnslink")
+
+// Provider updates DNSLink records through a DNS provider API.
+type Provider interface {
+	// SetDNSLink makes the TXT record at _dnslink.<domain> contain exactly
+	// one dnslink entry pointing at value, e.g. "/ipfs/bafy...". Other
+	// dnslink entries at that name are replaced.
+	SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error
+}
+
+// ProviderConstructor builds a provider from its configuration parameters.
+type ProviderConstructor func(params map[string]string) (Provider, error)
+
+var (
+	providersMu sync.Mutex
+	providers   = map[string]ProviderConstructor{
+		"cloudflare": NewCloudflareProvider,
+		"route53":    NewRoute53Provider,
+		"rfc2136":    NewRFC2136Provider,
+	}
+)
+
+// RegisterProvider adds a provider type. It fails if the type is already
+// registered.
+func RegisterProvider(typ string, c ProviderConstructor) error {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, ok := providers[typ]; ok {
+		return fmt.Errorf("dnslink provider %q already registered", typ)
+	}
+	providers[typ] = c
+	return nil
+}
+
+// NewProvider builds a provider of a registered type.
+func NewProvider(typ string, params map[string]string) (Provider, error) {
+	providersMu.Lock()
+	c, ok := providers[typ]
+	providersMu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown dnslink provider type %q", typ)
+	}
+	return c(params)
+}
+
+// Source returns the current value a DNSLink record should point at.
+type Source func(ctx context.Context) (string, error)
+
+// Record is a DNSLink record kept in sync with a source.
+type Record struct {
+	Domain   string
+	TTL      time.Duration
+	Provider Provider
+	Source   Source
+}
+
+// Publisher updates DNSLink records whenever the value of their source
+// changes.
+type Publisher struct {
+	records []Record
+	// last holds the value last published for each domain.
+	last map[string]string
+	// changed is signaled when a source may have changed
+	changed chan struct{}
+}
+
+// NewPublisher returns a publisher for the given records.
+func NewPublisher(records []Record) *Publisher {
+	return &Publisher{
+		records: records,
+		last:    make(map[string]string, len(records)),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Changed notifies Run that a source may have changed, for it to update the
+// records without waiting for the next interval.
+func (p *Publisher) Changed() {
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Update publishes the records whose source changed since the last
+// successful update. Errors are logged and retried on the next update.
+func (p *Publisher) Update(ctx context.Context) {
+	for _, r := range p.records {
+		value, err := r.Source(ctx)
+		if err != nil {
+			log.Errorf("dnslink %s: reading source: %s", r.Domain, err)
+			continue
+		}
+		if value == "" || p.last[r.Domain] == value {
+			continue
+		}
+
+		if err := r.Provider.SetDNSLink(ctx, r.Domain, value, r.TTL); err != nil {
+			log.Errorf("dnslink %s: updating record: %s", r.Domain, err)
+			continue
+		}
+		p.last[r.Domain] = value
+		log.Infof("dnslink %s: now points at %s", r.Domain, value)
+	}
+}
+
+// Run calls Update every interval, and when Changed is called, until ctx is
+// canceled.
+func (p *Publisher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.Update(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-p.changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// WatchFiles calls Changed on the changes of the MFS paths, until ctx is
+// done.
+func (p *Publisher) WatchFiles(ctx context.Context, w *mfswatch.Watcher, paths ...string) error {
+	for _, mp := range paths {
+		events, err := w.Watch(ctx, mp)
+		if err != nil {
+			return err
+		}
+		go func() {
+			for range events {
+				p.Changed()
+			}
+		}()
+	}
+	return nil
+}
+
+// recordName returns the fully qualified name of the DNSLink TXT record of
+// domain.
+func recordName(domain string) string {
+	name := "_dnslink." + domain
+	if name[len(name)-1] != '.' {
+		name += "."
+	}
+	return name
+}
+
+// requireParams returns an error naming the first missing parameter.
+func requireParams(typ string, params map[string]string, names ...string) error {
+	for _, n := range names {
+		if params[n] == "" {
+			return fmt.Errorf("dnslink provider %s: missing required parameter %q", typ, n)
+		}
+	}
+	return nil
+}
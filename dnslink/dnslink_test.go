@@ -0,0 +1,172 @@
+package dnslink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type mockProvider struct {
+	set map[string][]string
+}
+
+func (p *mockProvider) SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error {
+	p.set[domain] = append(p.set[domain], value)
+	return nil
+}
+
+func TestPublisherUpdate(t *testing.T) {
+	ctx := context.Background()
+	prov := &mockProvider{set: make(map[string][]string)}
+
+	value := ""
+	pub := NewPublisher([]Record{{
+		Domain:   "example.com",
+		Provider: prov,
+		Source:   func(context.Context) (string, error) { return value, nil },
+	}})
+
+	// nothing published yet
+	pub.Update(ctx)
+	if len(prov.set["example.com"]) != 0 {
+		t.Fatalf("expected no update, got %v", prov.set)
+	}
+
+	value = "/ipfs/a"
+	pub.Update(ctx)
+	pub.Update(ctx)
+	value = "/ipfs/b"
+	pub.Update(ctx)
+
+	got := prov.set["example.com"]
+	if len(got) != 2 || got[0] != "/ipfs/a" || got[1] != "/ipfs/b" {
+		t.Fatalf("unexpected updates: %v", got)
+	}
+}
+
+type chanProvider chan string
+
+func (p chanProvider) SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error {
+	p <- value
+	return nil
+}
+
+func TestPublisherRunChanged(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	prov := make(chanProvider, 1)
+
+	var value atomic.Value
+	value.Store("/ipfs/a")
+	pub := NewPublisher([]Record{{
+		Domain:   "example.com",
+		Provider: prov,
+		Source:   func(context.Context) (string, error) { return value.Load().(string), nil },
+	}})
+	go pub.Run(ctx, time.Hour)
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-prov:
+			if got != want {
+				t.Fatalf("expected %s published, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not published", want)
+		}
+	}
+	expect("/ipfs/a")
+
+	// the change is published without waiting for the interval
+	value.Store("/ipfs/b")
+	pub.Changed()
+	expect("/ipfs/b")
+}
+
+func TestNewProvider(t *testing.T) {
+	if _, err := NewProvider("nope", nil); err == nil {
+		t.Fatal("expected error for unknown provider type")
+	}
+	if _, err := NewProvider("cloudflare", map[string]string{"Token": "t"}); err == nil {
+		t.Fatal("expected error for missing ZoneID")
+	}
+	if err := RegisterProvider("cloudflare", NewCloudflareProvider); err == nil {
+		t.Fatal("expected error registering a provider type twice")
+	}
+}
+
+func TestCloudflareProvider(t *testing.T) {
+	records := map[string]cloudflareRecord{
+		"1": {ID: "1", Type: "TXT", Name: "_dnslink.example.com", Content: "dnslink=/ipfs/old"},
+		"2": {ID: "2", Type: "TXT", Name: "_dnslink.example.com", Content: "dnslink=/ipfs/older"},
+		"3": {ID: "3", Type: "TXT", Name: "_dnslink.example.com", Content: "unrelated"},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false})
+			return
+		}
+
+		var result interface{}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Path != "/zones/zone/dns_records" || r.URL.Query().Get("name") != "_dnslink.example.com" {
+				t.Errorf("unexpected GET %s", r.URL)
+			}
+			var list []cloudflareRecord
+			for _, rec := range records {
+				list = append(list, rec)
+			}
+			result = list
+		case http.MethodPut:
+			var rec cloudflareRecord
+			json.NewDecoder(r.Body).Decode(&rec)
+			rec.ID = r.URL.Path[len("/zones/zone/dns_records/"):]
+			records[rec.ID] = rec
+		case http.MethodDelete:
+			delete(records, r.URL.Path[len("/zones/zone/dns_records/"):])
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "result": result})
+	}))
+	defer srv.Close()
+
+	p, err := NewCloudflareProvider(map[string]string{
+		"Token":    "secret",
+		"ZoneID":   "zone",
+		"Endpoint": srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.SetDNSLink(context.Background(), "example.com", "/ipfs/new", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records left, got %v", records)
+	}
+	var dnslinks int
+	for _, rec := range records {
+		switch rec.Content {
+		case "dnslink=/ipfs/new":
+			dnslinks++
+			if rec.TTL != 60 {
+				t.Errorf("expected TTL 60, got %d", rec.TTL)
+			}
+		case "unrelated":
+		default:
+			t.Errorf("unexpected record %v", rec)
+		}
+	}
+	if dnslinks != 1 {
+		t.Fatalf("expected exactly one dnslink record, got %v", records)
+	}
+}
@@ -0,0 +1,39 @@
+package dnslink
+
+import (
+	"context"
+	"time"
+
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// nameSystem notifies the publisher of the DNSLink records of the IPNS names
+// it publishes.
+type nameSystem struct {
+	namesys.NameSystem
+	p *Publisher
+}
+
+// NameSystem returns ns, updating the DNSLink records as soon as it publishes
+// a name.
+func (p *Publisher) NameSystem(ns namesys.NameSystem) namesys.NameSystem {
+	return &nameSystem{NameSystem: ns, p: p}
+}
+
+func (ns *nameSystem) Publish(ctx context.Context, name ic.PrivKey, value path.Path) error {
+	if err := ns.NameSystem.Publish(ctx, name, value); err != nil {
+		return err
+	}
+	ns.p.Changed()
+	return nil
+}
+
+func (ns *nameSystem) PublishWithEOL(ctx context.Context, name ic.PrivKey, value path.Path, eol time.Time) error {
+	if err := ns.NameSystem.PublishWithEOL(ctx, name, value, eol); err != nil {
+		return err
+	}
+	ns.p.Changed()
+	return nil
+}
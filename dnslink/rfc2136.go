@@ -0,0 +1,91 @@
+package dnslink
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type rfc2136Provider struct {
+	server    string
+	zone      string
+	keyName   string
+	secret    string
+	algorithm string
+	transport string
+}
+
+// NewRFC2136Provider returns a provider sending RFC 2136 dynamic updates to
+// an authoritative name server.
+//
+// Parameters: "Server" (host or host:port), "Zone", and optionally
+// "TSIGKeyName", "TSIGSecret" (base64), "TSIGAlgorithm" (defaults to
+// hmac-sha256) and "Transport" ("udp" or "tcp", defaults to "tcp").
+func NewRFC2136Provider(params map[string]string) (Provider, error) {
+	if err := requireParams("rfc2136", params, "Server", "Zone"); err != nil {
+		return nil, err
+	}
+	if (params["TSIGKeyName"] == "") != (params["TSIGSecret"] == "") {
+		return nil, fmt.Errorf("dnslink provider rfc2136: TSIGKeyName and TSIGSecret must be set together")
+	}
+
+	server := params["Server"]
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	algorithm := params["TSIGAlgorithm"]
+	if algorithm == "" {
+		algorithm = dns.HmacSHA256
+	}
+	transport := params["Transport"]
+	if transport == "" {
+		transport = "tcp"
+	}
+	if transport != "tcp" && transport != "udp" {
+		return nil, fmt.Errorf("dnslink provider rfc2136: invalid transport %q", transport)
+	}
+
+	return &rfc2136Provider{
+		server:    server,
+		zone:      dns.Fqdn(params["Zone"]),
+		keyName:   dns.Fqdn(params["TSIGKeyName"]),
+		secret:    params["TSIGSecret"],
+		algorithm: dns.Fqdn(algorithm),
+		transport: transport,
+	}, nil
+}
+
+func (p *rfc2136Provider) SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	name := recordName(domain)
+
+	m := new(dns.Msg)
+	m.SetUpdate(p.zone)
+	m.RemoveRRset([]dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET},
+	}})
+	m.Insert([]dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: uint32(ttl.Seconds())},
+		Txt: []string{"dnslink=" + value},
+	}})
+
+	c := &dns.Client{Net: p.transport}
+	if p.secret != "" {
+		c.TsigSecret = map[string]string{p.keyName: p.secret}
+		m.SetTsig(p.keyName, p.algorithm, 300, time.Now().Unix())
+	}
+
+	resp, _, err := c.ExchangeContext(ctx, m, p.server)
+	if err != nil {
+		return fmt.Errorf("rfc2136: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("rfc2136: update of %s refused: %s", name, dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package dnslink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRoute53Endpoint = "https://route53.amazonaws.com"
+	route53Region          = "us-east-1"
+	route53Service         = "route53"
+	route53XMLNS           = "https://route53.amazonaws.com/doc/2013-04-01/"
+)
+
+type route53Provider struct {
+	endpoint     string
+	accessKeyID  string
+	secretKey    string
+	sessionToken string
+	zoneID       string
+	client       *http.Client
+}
+
+// NewRoute53Provider returns a provider using the AWS Route 53 API.
+//
+// Parameters: "AccessKeyID", "SecretAccessKey", "HostedZoneID", and
+// optionally "SessionToken" and "Endpoint".
+func NewRoute53Provider(params map[string]string) (Provider, error) {
+	if err := requireParams("route53", params, "AccessKeyID", "SecretAccessKey", "HostedZoneID"); err != nil {
+		return nil, err
+	}
+	endpoint := params["Endpoint"]
+	if endpoint == "" {
+		endpoint = defaultRoute53Endpoint
+	}
+	return &route53Provider{
+		endpoint:     strings.TrimSuffix(endpoint, "/"),
+		accessKeyID:  params["AccessKeyID"],
+		secretKey:    params["SecretAccessKey"],
+		sessionToken: params["SessionToken"],
+		zoneID:       strings.TrimPrefix(params["HostedZoneID"], "/hostedzone/"),
+		client:       &http.Client{Timeout: time.Minute},
+	}, nil
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	XMLNS   string          `xml:"xmlns,attr"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+type route53Change struct {
+	Action string       `xml:"Action"`
+	RRSet  route53RRSet `xml:"ResourceRecordSet"`
+}
+
+type route53RRSet struct {
+	Name    string   `xml:"Name"`
+	Type    string   `xml:"Type"`
+	TTL     int64    `xml:"TTL"`
+	Records []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+func (p *route53Provider) SetDNSLink(ctx context.Context, domain string, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+
+	creq := route53ChangeRequest{
+		XMLNS: route53XMLNS,
+		Changes: []route53Change{{
+			Action: "UPSERT",
+			RRSet: route53RRSet{
+				Name:    recordName(domain),
+				Type:    "TXT",
+				TTL:     int64(ttl.Seconds()),
+				Records: []string{fmt.Sprintf("%q", "dnslink="+value)},
+			},
+		}},
+	}
+
+	body, err := xml.Marshal(creq)
+	if err != nil {
+		return err
+	}
+	body = append([]byte(xml.Header), body...)
+
+	u := fmt.Sprintf("%s/2013-04-01/hostedzone/%s/rrset", p.endpoint, p.zoneID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	p.sign(req, body, time.Now().UTC())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("route53: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 authorization header to req.
+func (p *route53Provider) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if p.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{date, route53Region, route53Service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+p.secretKey), date)
+	key = hmacSHA256(key, route53Region)
+	key = hmacSHA256(key, route53Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.accessKeyID, scope, signedHeaders, signature,
+	))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
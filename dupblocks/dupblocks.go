@@ -0,0 +1,229 @@
+// Package dupblocks tracks the duplicate blocks received by the bitswap
+// sessions: a block wanted by a session and received from several peers
+// wasted the bandwidth of all its copies but the first.
+//
+// The Tracker is given to bitswap as its tracer, to see the blocks received,
+// and the exchange returned by NewExchange registers the wants of the sessions
+// with it. A block received is accounted to every session that wanted it, for
+// as long as the session runs.
+package dupblocks
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sessionDuplicates = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ipfs_bitswap_session_duplicate_blocks_percent",
+		Help:    "percentage of the blocks received by the ended bitswap sessions that were duplicates",
+		Buckets: []float64{1, 5, 10, 25, 50, 75},
+	})
+	runningSessions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_bitswap_sessions",
+		Help: "number of running bitswap sessions",
+	})
+)
+
+// Stat is the state of a running session.
+type Stat struct {
+	ID      uint64
+	Started time.Time
+	// Wanted is the number of distinct blocks the session asked for
+	Wanted int
+	// Blocks is the number of copies of these blocks received, including the
+	// duplicates
+	Blocks int
+	// Duplicates is the number of copies received of blocks already received
+	Duplicates int
+	// Outstanding is the number of blocks wanted not received yet
+	Outstanding int
+	// Peers is the number of peers the blocks were received from
+	Peers int
+}
+
+// DuplicatePercent is the percentage of the blocks received that were
+// duplicates.
+func (s Stat) DuplicatePercent() float64 {
+	if s.Blocks == 0 {
+		return 0
+	}
+	return float64(s.Duplicates) * 100 / float64(s.Blocks)
+}
+
+type session struct {
+	Stat
+	// received is the number of copies received of each block wanted
+	received map[cid.Cid]int
+	peers    map[peer.ID]struct{}
+}
+
+// Tracker accounts the blocks received by bitswap to the sessions that wanted
+// them.
+type Tracker struct {
+	mu       sync.Mutex
+	lastID   uint64
+	sessions map[uint64]*session
+	// wanted indexes the running sessions by the blocks they wanted
+	wanted map[cid.Cid][]*session
+}
+
+// NewTracker returns a tracker without sessions.
+func NewTracker() *Tracker {
+	return &Tracker{
+		sessions: make(map[uint64]*session),
+		wanted:   make(map[cid.Cid][]*session),
+	}
+}
+
+// MessageReceived accounts the blocks of msg to the sessions that wanted them.
+// It implements bitswap.Tracer.
+func (t *Tracker) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	if len(blks) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, blk := range blks {
+		c := blk.Cid()
+		for _, s := range t.wanted[c] {
+			if s.received[c] > 0 {
+				s.Duplicates++
+			} else {
+				s.Outstanding--
+			}
+			s.received[c]++
+			s.Blocks++
+			if _, ok := s.peers[p]; !ok {
+				s.peers[p] = struct{}{}
+				s.Peers++
+			}
+		}
+	}
+}
+
+// MessageSent implements bitswap.Tracer.
+func (t *Tracker) MessageSent(peer.ID, bsmsg.BitSwapMessage) {}
+
+// Sessions returns the state of the running sessions, oldest first.
+func (t *Tracker) Sessions() []Stat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := make([]Stat, 0, len(t.sessions))
+	for _, s := range t.sessions {
+		stats = append(stats, s.Stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+func (t *Tracker) open() *session {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lastID++
+	s := &session{
+		Stat:     Stat{ID: t.lastID, Started: time.Now()},
+		received: make(map[cid.Cid]int),
+		peers:    make(map[peer.ID]struct{}),
+	}
+	t.sessions[s.ID] = s
+	runningSessions.Set(float64(len(t.sessions)))
+	return s
+}
+
+func (t *Tracker) want(s *session, ks []cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessions[s.ID] != s {
+		return
+	}
+	for _, c := range ks {
+		if _, ok := s.received[c]; ok {
+			continue
+		}
+		s.received[c] = 0
+		s.Wanted++
+		s.Outstanding++
+		t.wanted[c] = append(t.wanted[c], s)
+	}
+}
+
+// close stops tracking s, and records its duplicates.
+func (t *Tracker) close(s *session) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.sessions, s.ID)
+	runningSessions.Set(float64(len(t.sessions)))
+	for c := range s.received {
+		ss := t.wanted[c]
+		for i := range ss {
+			if ss[i] == s {
+				ss = append(ss[:i], ss[i+1:]...)
+				break
+			}
+		}
+		if len(ss) == 0 {
+			delete(t.wanted, c)
+		} else {
+			t.wanted[c] = ss
+		}
+	}
+	if s.Blocks > 0 {
+		sessionDuplicates.Observe(s.DuplicatePercent())
+	}
+}
+
+// fetcher registers the wants of its session with the tracker.
+type fetcher struct {
+	exchange.Fetcher
+	t *Tracker
+	s *session
+}
+
+func (f fetcher) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	f.t.want(f.s, []cid.Cid{c})
+	return f.Fetcher.GetBlock(ctx, c)
+}
+
+func (f fetcher) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	f.t.want(f.s, ks)
+	return f.Fetcher.GetBlocks(ctx, ks)
+}
+
+// SessionExchange is an exchange whose sessions are tracked.
+type SessionExchange struct {
+	exchange.SessionExchange
+	t *Tracker
+}
+
+// NewExchange returns ex, tracking its sessions with t. Exchanges without
+// sessions are returned as is.
+func NewExchange(ex exchange.Interface, t *Tracker) exchange.Interface {
+	sex, ok := ex.(exchange.SessionExchange)
+	if !ok {
+		return ex
+	}
+	return &SessionExchange{SessionExchange: sex, t: t}
+}
+
+// NewSession implements exchange.SessionExchange. The session is tracked
+// until ctx is done, as the bitswap session.
+func (e *SessionExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	s := e.t.open()
+	go func() {
+		<-ctx.Done()
+		e.t.close(s)
+	}()
+	return fetcher{e.SessionExchange.NewSession(ctx), e.t, s}
+}
@@ -0,0 +1,99 @@
+package dupblocks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// fakeExchange returns no blocks, the tracker is fed the messages directly.
+type fakeExchange struct{}
+
+func (fakeExchange) GetBlock(context.Context, cid.Cid) (blocks.Block, error) { return nil, nil }
+
+func (fakeExchange) GetBlocks(context.Context, []cid.Cid) (<-chan blocks.Block, error) {
+	ch := make(chan blocks.Block)
+	close(ch)
+	return ch, nil
+}
+
+func (fakeExchange) HasBlock(context.Context, blocks.Block) error { return nil }
+
+func (fakeExchange) IsOnline() bool { return true }
+
+func (fakeExchange) Close() error { return nil }
+
+func (e fakeExchange) NewSession(context.Context) exchange.Fetcher { return e }
+
+func message(bs ...blocks.Block) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	for _, b := range bs {
+		msg.AddBlock(b)
+	}
+	return msg
+}
+
+func TestDuplicates(t *testing.T) {
+	a := blocks.NewBlock([]byte("a"))
+	b := blocks.NewBlock([]byte("b"))
+	c := blocks.NewBlock([]byte("c"))
+	tr := NewTracker()
+	ex := NewExchange(fakeExchange{}, tr).(exchange.SessionExchange)
+
+	ctx1, end1 := context.WithCancel(context.Background())
+	ctx2, end2 := context.WithCancel(context.Background())
+	defer end2()
+	s1 := ex.NewSession(ctx1)
+	s2 := ex.NewSession(ctx2)
+	if _, err := s1.GetBlocks(ctx1, []cid.Cid{a.Cid(), b.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s2.GetBlock(ctx2, a.Cid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := tr.Sessions()[0]; st.Outstanding != 2 || st.Peers != 0 {
+		t.Fatalf("unexpected stat of the first session %+v", st)
+	}
+
+	p, q := peer.ID("peer"), peer.ID("other peer")
+	tr.MessageReceived(p, message(a, c))
+	tr.MessageReceived(p, message(a, b))
+	tr.MessageReceived(q, message(b))
+
+	stats := tr.Sessions()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(stats))
+	}
+	if st := stats[0]; st.Wanted != 2 || st.Blocks != 4 || st.Duplicates != 2 || st.DuplicatePercent() != 50 || st.Outstanding != 0 || st.Peers != 2 {
+		t.Fatalf("unexpected stat of the first session %+v", st)
+	}
+	if st := stats[1]; st.Wanted != 1 || st.Blocks != 2 || st.Duplicates != 1 || st.Outstanding != 0 || st.Peers != 1 {
+		t.Fatalf("unexpected stat of the second session %+v", st)
+	}
+
+	// an ended session is not tracked anymore
+	end1()
+	deadline := time.Now().Add(time.Second)
+	for len(tr.Sessions()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("ended session still tracked")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	tr.MessageReceived(p, message(a, b))
+	if st := tr.Sessions()[0]; st.Blocks != 3 || st.Duplicates != 2 {
+		t.Fatalf("unexpected stat of the second session %+v", st)
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if _, ok := tr.wanted[b.Cid()]; ok {
+		t.Fatal("blocks of the ended session still indexed")
+	}
+}
@@ -0,0 +1,225 @@
+// Package fetchprogress tracks the progress of the fetch of DAGs: the blocks
+// got out of those known so far, the data received from each provider, and
+// the time left at the pace so far.
+//
+// A Tracker wraps the NodeGetter the DAGs are walked with. The blocks it gets
+// are verified against their CID, by the blockservice or when they are read
+// from the blockstore, before they are counted. The blocks known are the
+// roots and the links of the blocks got, so the total grows as the DAGs are
+// walked, and the estimated time left is a lower bound until all their
+// blocks are known.
+package fetchprogress
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Senders tells the peer a block was received from.
+// *bitswapstats.Recorder implements it.
+type Senders interface {
+	Sender(c cid.Cid) (peer.ID, bool)
+}
+
+// Event is the progress of a fetch.
+type Event struct {
+	// Blocks is the number of blocks got, and Bytes their size.
+	Blocks uint64
+	Bytes  uint64
+	// Known is the number of blocks known so far.
+	Known uint64
+	// Fetched is the number of blocks got from the network, and
+	// FetchedBytes their size, the others being there already.
+	Fetched      uint64
+	FetchedBytes uint64
+	// Rate is the bytes fetched per second.
+	Rate      float64
+	Providers []Provider `json:",omitempty"`
+	// Elapsed is the time since the fetch started, and ETA the time left to
+	// get the blocks known at the pace so far, in seconds.
+	Elapsed float64
+	ETA     float64 `json:",omitempty"`
+	Done    bool    `json:",omitempty"`
+}
+
+// Provider is the data received from a peer.
+type Provider struct {
+	Peer   string
+	Blocks uint64
+	Bytes  uint64
+	// Rate is the bytes received per second.
+	Rate float64
+}
+
+// Tracker tracks the progress of a fetch.
+type Tracker struct {
+	local   bstore.Blockstore
+	senders Senders
+
+	mu        sync.Mutex
+	started   time.Time
+	ended     time.Time
+	known     *cid.Set
+	got       *cid.Set
+	ev        Event
+	providers map[peer.ID]*Provider
+}
+
+// New returns a tracker of a fetch starting now, telling the blocks fetched
+// from those in local, and their providers with senders, if not nil.
+func New(local bstore.Blockstore, senders Senders) *Tracker {
+	return &Tracker{
+		local:     local,
+		senders:   senders,
+		started:   time.Now(),
+		known:     cid.NewSet(),
+		got:       cid.NewSet(),
+		providers: make(map[peer.ID]*Provider),
+	}
+}
+
+// AddRoots adds the roots of the DAGs fetched to the blocks known.
+func (t *Tracker) AddRoots(roots ...cid.Cid) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, c := range roots {
+		t.known.Add(c)
+	}
+}
+
+// NodeGetter returns ng, tracking the nodes got through it.
+func (t *Tracker) NodeGetter(ng ipld.NodeGetter) ipld.NodeGetter {
+	return &nodeGetter{ng: ng, t: t}
+}
+
+// Done marks the fetch done.
+func (t *Tracker) Done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.ev.Done {
+		t.ev.Done = true
+		t.ended = time.Now()
+	}
+}
+
+// Progress returns the progress of the fetch so far.
+func (t *Tracker) Progress() Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ev := t.ev
+	ev.Known = uint64(t.known.Len())
+	end := time.Now()
+	if ev.Done {
+		end = t.ended
+	}
+	elapsed := end.Sub(t.started).Seconds()
+	ev.Elapsed = elapsed
+	if elapsed > 0 {
+		ev.Rate = float64(ev.FetchedBytes) / elapsed
+	}
+	if !ev.Done && ev.Blocks > 0 && ev.Known > ev.Blocks {
+		ev.ETA = elapsed / float64(ev.Blocks) * float64(ev.Known-ev.Blocks)
+	}
+	ev.Providers = make([]Provider, 0, len(t.providers))
+	for _, p := range t.providers {
+		pr := *p
+		if elapsed > 0 {
+			pr.Rate = float64(pr.Bytes) / elapsed
+		}
+		ev.Providers = append(ev.Providers, pr)
+	}
+	sort.Slice(ev.Providers, func(i, j int) bool {
+		return ev.Providers[i].Bytes > ev.Providers[j].Bytes
+	})
+	return ev
+}
+
+// gotNode records nd, fetched from the network or not.
+func (t *Tracker) gotNode(nd ipld.Node, fetched bool) {
+	var from peer.ID
+	var sent bool
+	if fetched && t.senders != nil {
+		from, sent = t.senders.Sender(nd.Cid())
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := nd.Cid()
+	t.known.Add(c)
+	for _, l := range nd.Links() {
+		t.known.Add(l.Cid)
+	}
+	if !t.got.Visit(c) {
+		return
+	}
+	size := uint64(len(nd.RawData()))
+	t.ev.Blocks++
+	t.ev.Bytes += size
+	if !fetched {
+		return
+	}
+	t.ev.Fetched++
+	t.ev.FetchedBytes += size
+	if !sent {
+		return
+	}
+	p, ok := t.providers[from]
+	if !ok {
+		p = &Provider{Peer: from.String()}
+		t.providers[from] = p
+	}
+	p.Blocks++
+	p.Bytes += size
+}
+
+// isLocal returns whether the block of c is in the local blockstore, before
+// it is got.
+func (t *Tracker) isLocal(ctx context.Context, c cid.Cid) bool {
+	has, err := t.local.Has(ctx, c)
+	return err == nil && has
+}
+
+type nodeGetter struct {
+	ng ipld.NodeGetter
+	t  *Tracker
+}
+
+func (g *nodeGetter) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	local := g.t.isLocal(ctx, c)
+	nd, err := g.ng.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	g.t.gotNode(nd, !local)
+	return nd, nil
+}
+
+func (g *nodeGetter) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	local := make(map[cid.Cid]bool, len(cids))
+	for _, c := range cids {
+		local[c] = g.t.isLocal(ctx, c)
+	}
+	in := g.ng.GetMany(ctx, cids)
+	out := make(chan *ipld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for opt := range in {
+			if opt.Err == nil {
+				g.t.gotNode(opt.Node, !local[opt.Node.Cid()])
+			}
+			select {
+			case out <- opt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
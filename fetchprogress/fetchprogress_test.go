@@ -0,0 +1,115 @@
+package fetchprogress
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+type senders map[cid.Cid]peer.ID
+
+func (s senders) Sender(c cid.Cid) (peer.ID, bool) {
+	p, ok := s[c]
+	return p, ok
+}
+
+func TestTracker(t *testing.T) {
+	ctx := context.Background()
+	local := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	remote := mdtest.Mock()
+
+	a, b := dag.NodeWithData([]byte("a")), dag.NodeWithData([]byte("bb"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("a", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := root.AddNodeLink("b", b); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.AddMany(ctx, []ipld.Node{root, a, b}); err != nil {
+		t.Fatal(err)
+	}
+	// a is there already, the other blocks are fetched from p
+	if err := local.Put(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	p := peer.ID("provider")
+	tr := New(local, senders{root.Cid(): p, b.Cid(): p})
+	tr.AddRoots(root.Cid())
+	ng := tr.NodeGetter(remote)
+
+	if _, err := ng.Get(ctx, root.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	ev := tr.Progress()
+	if ev.Blocks != 1 || ev.Known != 3 || ev.Fetched != 1 || ev.ETA == 0 || ev.Done {
+		t.Fatalf("unexpected progress once the root is got: %+v", ev)
+	}
+
+	for opt := range ng.GetMany(ctx, []cid.Cid{a.Cid(), b.Cid()}) {
+		if opt.Err != nil {
+			t.Fatal(opt.Err)
+		}
+	}
+	// got again, counted once
+	if _, err := ng.Get(ctx, b.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	tr.Done()
+	ev = tr.Progress()
+	size := func(nds ...ipld.Node) (n uint64) {
+		for _, nd := range nds {
+			n += uint64(len(nd.RawData()))
+		}
+		return n
+	}
+	if ev.Blocks != 3 || ev.Known != 3 || ev.Bytes != size(root, a, b) || !ev.Done || ev.ETA != 0 {
+		t.Fatalf("unexpected progress once done: %+v", ev)
+	}
+	if ev.Fetched != 2 || ev.FetchedBytes != size(root, b) || ev.Rate == 0 {
+		t.Fatalf("expected the root and b fetched, got %+v", ev)
+	}
+	if len(ev.Providers) != 1 || ev.Providers[0].Peer != p.String() || ev.Providers[0].Bytes != ev.FetchedBytes {
+		t.Fatalf("expected all fetched from p, got %+v", ev.Providers)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	tr := New(nil, nil)
+	if err := r.Track("f", tr); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Track("f", New(nil, nil)); err == nil {
+		t.Fatal("expected tracking a second fetch under the same name to fail")
+	}
+	r.Done("f")
+	if got, ok := r.Get("f"); !ok || got != tr || !got.Progress().Done {
+		t.Fatal("expected the fetch done kept")
+	}
+	if err := r.Track("f", New(nil, nil)); err != nil {
+		t.Fatalf("expected the fetch done replaced, got %s", err)
+	}
+
+	for i := 0; i < MaxDone+1; i++ {
+		name := string(rune('A' + i))
+		r.Track(name, New(nil, nil))
+		r.Done(name)
+	}
+	if _, ok := r.Get("A"); ok {
+		t.Fatal("expected the oldest fetch done forgotten")
+	}
+	if _, ok := r.Get("f"); !ok {
+		t.Fatal("expected the fetch not done kept")
+	}
+}
@@ -0,0 +1,76 @@
+package fetchprogress
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MaxDone is the number of fetches done whose trackers are kept, for their
+// final progress to be reported.
+const MaxDone = 64
+
+// Registry holds the trackers of the fetches tracked by name.
+type Registry struct {
+	mu       sync.Mutex
+	trackers map[string]*Tracker
+	// done is the names of the fetches done, oldest first
+	done []string
+}
+
+// NewRegistry returns a registry without trackers.
+func NewRegistry() *Registry {
+	return &Registry{trackers: make(map[string]*Tracker)}
+}
+
+// Track registers t under name, which a fetch not done yet may not be
+// tracked under. The tracker of a fetch done under name is replaced.
+func (r *Registry) Track(name string, t *Tracker) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.trackers[name]; ok {
+		if !old.Progress().Done {
+			return fmt.Errorf("a fetch is tracked as %q already", name)
+		}
+		r.forget(name)
+	}
+	r.trackers[name] = t
+	return nil
+}
+
+// Get returns the tracker of the fetch tracked under name.
+func (r *Registry) Get(name string) (*Tracker, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.trackers[name]
+	return t, ok
+}
+
+// Done marks the fetch tracked under name done. Its tracker is kept until
+// MaxDone fetches are done after it.
+func (r *Registry) Done(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.trackers[name]
+	if !ok {
+		return
+	}
+	t.Done()
+	r.forget(name)
+	r.trackers[name] = t
+	r.done = append(r.done, name)
+	if len(r.done) > MaxDone {
+		delete(r.trackers, r.done[0])
+		r.done = r.done[1:]
+	}
+}
+
+// forget drops the tracker of name. r.mu must be held.
+func (r *Registry) forget(name string) {
+	delete(r.trackers, name)
+	for i, n := range r.done {
+		if n == name {
+			r.done = append(r.done[:i], r.done[i+1:]...)
+			break
+		}
+	}
+}
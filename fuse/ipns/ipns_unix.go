@@ -91,9 +91,9 @@ func ipnsPubFunc(ipfs iface.CoreAPI, key iface.Key) mfs.PubFunc {
 
 func loadRoot(ctx context.Context, ipfs iface.CoreAPI, key iface.Key) (*mfs.Root, fs.Node, error) {
 	node, err := ipfs.ResolveNode(ctx, key.Path())
-	switch err {
-	case nil:
-	case iface.ErrResolveFailed:
+	switch {
+	case err == nil:
+	case errors.Is(err, iface.ErrResolveFailed):
 		node = ft.EmptyDirNode()
 	default:
 		log.Errorf("looking up %s: %s", key.Path(), err)
@@ -15,6 +15,7 @@ import (
 	fs "bazil.org/fuse/fs"
 	"github.com/ipfs/go-cid"
 	core "github.com/ipfs/go-ipfs/core"
+	"github.com/ipfs/go-ipfs/unixfsmeta"
 	ipld "github.com/ipfs/go-ipld-format"
 	logging "github.com/ipfs/go-log"
 	mdag "github.com/ipfs/go-merkledag"
@@ -166,9 +167,23 @@ func (s *Node) Attr(ctx context.Context, a *fuse.Attr) error {
 	case ft.TSymlink:
 		a.Mode = 0777 | os.ModeSymlink
 		a.Size = uint64(len(s.cached.Data()))
+		return nil
 	default:
 		return fmt.Errorf("invalid data type - %s", s.cached.Type())
 	}
+
+	// the mode and the modification time kept in the UnixFS metadata
+	m, err := unixfsmeta.Get(s.Nd)
+	if err != nil {
+		log.Debugf("invalid metadata: %s", err)
+		return nil
+	}
+	if m.HasMode {
+		a.Mode = a.Mode&os.ModeType | m.Mode
+	}
+	if !m.ModTime.IsZero() {
+		a.Mtime = m.ModTime
+	}
 	return nil
 }
 
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strings"
 
+	blocks "github.com/ipfs/go-block-format"
 	bserv "github.com/ipfs/go-blockservice"
 	cid "github.com/ipfs/go-cid"
 	dstore "github.com/ipfs/go-datastore"
@@ -17,6 +18,9 @@ import (
 	logging "github.com/ipfs/go-log"
 	dag "github.com/ipfs/go-merkledag"
 	"github.com/ipfs/go-verifcid"
+
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
 )
 
 var log = logging.Logger("gc")
@@ -43,11 +47,12 @@ func toRawCids(set *cid.Set) (*cid.Set, error) {
 // - all recursively pinned blocks, plus all of their descendants (recursively)
 // - bestEffortRoots, plus all of its descendants (recursively)
 // - all directly pinned blocks
+// - all blocks matched by the selector pins of sp, if not nil
 // - all blocks utilized internally by the pinner
 //
 // The routine then iterates over every block in the blockstore and
 // deletes any block that is not found in the marked set.
-func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, bestEffortRoots []cid.Cid) <-chan Result {
+func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, sp *selectorpin.Store, bestEffortRoots []cid.Cid) <-chan Result {
 	ctx, cancel := context.WithCancel(ctx)
 
 	unlocker := bs.GCLock(ctx)
@@ -62,7 +67,7 @@ func GC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn
 		defer close(output)
 		defer unlocker.Unlock(ctx)
 
-		gcs, err := ColoredSet(ctx, pn, ds, bestEffortRoots, output)
+		gcs, err := ColoredSet(ctx, pn, sp, ds, bestEffortRoots, output)
 		if err != nil {
 			select {
 			case output <- Result{Error: err}:
@@ -199,8 +204,11 @@ func toCidV1(c cid.Cid) cid.Cid {
 }
 
 // ColoredSet computes the set of nodes in the graph that are pinned by the
-// pins in the given pinner.
-func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
+// pins in the given pinner, and by the selector pins in sp if not nil.
+func ColoredSet(ctx context.Context, pn pin.Pinner, sp *selectorpin.Store, ng ipld.NodeGetter, bestEffortRoots []cid.Cid, output chan<- Result) (*cid.Set, error) {
+	// walking the pinned DAGs does not count as reading them
+	ctx = expiry.Untracked(ctx)
+
 	// KeySet currently implemented in memory, in the future, may be bloom filter or
 	// disk backed to conserve memory.
 	errors := false
@@ -261,6 +269,27 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 		gcs.Add(toCidV1(k))
 	}
 
+	if sp != nil {
+		spins, err := sp.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bg := selectorBlockGetter{ng}
+		for _, p := range spins {
+			err := selectorpin.Walk(ctx, bg, p, func(k cid.Cid) {
+				gcs.Add(toCidV1(k))
+			})
+			if err != nil {
+				errors = true
+				select {
+				case output <- Result{Error: &CannotFetchLinksError{p.Root, err}}:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+
 	ikeys, err := pn.InternalPins(ctx)
 	if err != nil {
 		return nil, err
@@ -282,6 +311,16 @@ func ColoredSet(ctx context.Context, pn pin.Pinner, ng ipld.NodeGetter, bestEffo
 	return gcs, nil
 }
 
+// selectorBlockGetter gets the blocks walked by selector pins from a
+// NodeGetter.
+type selectorBlockGetter struct {
+	ng ipld.NodeGetter
+}
+
+func (g selectorBlockGetter) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	return g.ng.Get(ctx, c)
+}
+
 // ErrCannotFetchAllLinks is returned as the last Result in the GC output
 // channel when there was an error creating the marked set because of a
 // problem when finding descendants.
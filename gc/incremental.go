@@ -0,0 +1,535 @@
+package gc
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	dstore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-verifcid"
+
+	"github.com/ipfs/go-ipfs/pinning/expiry"
+	"github.com/ipfs/go-ipfs/pinning/selectorpin"
+)
+
+// The phases of an incremental garbage collection run.
+const (
+	// PhaseMark is the marking of the blocks to keep.
+	PhaseMark = "mark"
+	// PhaseSweep is the deletion of the blocks not marked.
+	PhaseSweep = "sweep"
+	// PhaseCleanup is the deletion of the marks, once the sweep is done.
+	PhaseCleanup = "cleanup"
+)
+
+// sweepBatchSize is the number of blocks deleted at most under each hold of
+// the GC lock.
+const sweepBatchSize = 1000
+
+var (
+	incrementalKey = dstore.NewKey("/gc/incremental")
+	// stateKey is where the Status of the run in progress is stored
+	stateKey = incrementalKey.ChildString("state")
+	// markedKey is the namespace of the marks, keyed by multihash, whose
+	// values are the codecs marked with it
+	markedKey = incrementalKey.ChildString("marked")
+)
+
+// errPaused stops a run whose budget is spent.
+var errPaused = errors.New("garbage collection budget spent")
+
+// incrementalRunning, set to 1 while an incremental run goes, keeps more
+// than one from going at once.
+var incrementalRunning int32
+
+// Budget limits an incremental garbage collection run. Once spent, the run
+// stops, and goes on from there at the next one.
+type Budget struct {
+	// MaxDuration is how long the run lasts at most, 0 for no limit.
+	MaxDuration time.Duration
+	// MaxBytes is how much the run frees at most, 0 for no limit.
+	MaxBytes uint64
+}
+
+// Status is the progress of an incremental garbage collection, stored in the
+// repo between the runs.
+type Status struct {
+	Phase   string
+	Started time.Time
+	// Marked is the number of blocks marked to keep.
+	Marked uint64
+	// Removed is the number of blocks removed, and Freed their size.
+	Removed uint64
+	Freed   uint64
+}
+
+// IncrementalStatus returns the status of the incremental garbage collection
+// in progress, or nil if there is none.
+func IncrementalStatus(ctx context.Context, dstor dstore.Datastore) (*Status, error) {
+	b, err := dstor.Get(ctx, stateKey)
+	if err == dstore.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var st Status
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// IncrementalGC performs a garbage collection of the blocks in the
+// blockstore which, unlike GC, does not hold the GC lock for the whole run,
+// and can be spread over several runs limited by budget.
+//
+// The blocks to keep, the same as with GC, are marked in dstor rather than
+// in memory. A block is marked once all its descendants are, so that the
+// DAGs marked already are skipped by the next walks. The blocks not marked
+// are then deleted in batches, each under the GC lock, after the pinned
+// DAGs and bestEffortRoots, called every time, are walked again to mark the
+// blocks added to them since. Once spent, the budget stops the run, which
+// the next one goes on with; IncrementalStatus reports its progress.
+func IncrementalGC(ctx context.Context, bs bstore.GCBlockstore, dstor dstore.Datastore, pn pin.Pinner, sp *selectorpin.Store, bestEffortRoots func(context.Context) ([]cid.Cid, error), budget Budget) <-chan Result {
+	ctx, cancel := context.WithCancel(ctx)
+	output := make(chan Result, 128)
+	bsrv := bserv.New(bs, offline.Exchange(bs))
+
+	g := &incremental{
+		bs:     bs,
+		dstor:  dstor,
+		marks:  namespace.Wrap(dstor, markedKey),
+		pn:     pn,
+		sp:     sp,
+		roots:  bestEffortRoots,
+		ng:     dag.NewDAGService(bsrv),
+		budget: budget,
+		output: output,
+		marked: cid.NewSet(),
+		kept:   cid.NewSet(),
+		walked: make(map[selectorpin.Pin]bool),
+	}
+	if budget.MaxDuration > 0 {
+		g.deadline = time.Now().Add(budget.MaxDuration)
+	}
+
+	go func() {
+		defer cancel()
+		defer close(output)
+		if !atomic.CompareAndSwapInt32(&incrementalRunning, 0, 1) {
+			g.emit(ctx, Result{Error: errors.New("a garbage collection is running already")})
+			return
+		}
+		defer atomic.StoreInt32(&incrementalRunning, 0)
+
+		// walking the pinned DAGs does not count as reading them
+		if err := g.run(expiry.Untracked(ctx)); err != nil && err != errPaused {
+			if ferr, ok := err.(*CannotFetchLinksError); ok {
+				g.emit(ctx, Result{Error: ferr})
+				err = ErrCannotFetchAllLinks
+			}
+			g.emit(ctx, Result{Error: err})
+		}
+	}()
+	return output
+}
+
+type incremental struct {
+	bs     bstore.GCBlockstore
+	dstor  dstore.Datastore
+	marks  dstore.Datastore
+	pn     pin.Pinner
+	sp     *selectorpin.Store
+	roots  func(context.Context) ([]cid.Cid, error)
+	ng     ipld.NodeGetter
+	output chan<- Result
+
+	budget   Budget
+	deadline time.Time
+	freed    uint64 // by this run
+
+	st Status
+
+	// marked caches the CIDs, made v1, known to be marked
+	marked *cid.Set
+	// kept holds the raw CIDs of the blocks kept though not marked: the
+	// ones pinned directly or by selector, and those whose DAG has blocks
+	// missing
+	kept *cid.Set
+	// partial holds the CIDs, made v1, of the best-effort DAGs with blocks
+	// missing, walked by the current markRoots
+	partial *cid.Set
+	// walked holds the selector pins walked by this run
+	walked map[selectorpin.Pin]bool
+
+	deleteErrors bool
+}
+
+func (g *incremental) run(ctx context.Context) error {
+	st, err := IncrementalStatus(ctx, g.dstor)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		st = &Status{Phase: PhaseMark, Started: time.Now()}
+	}
+	g.st = *st
+	// the status is saved whenever the run stops, so that it records the
+	// blocks marked or removed so far
+	defer func() {
+		if g.st.Phase != "" {
+			if err := g.saveState(context.Background()); err != nil {
+				log.Errorf("saving the garbage collection status: %s", err)
+			}
+		}
+	}()
+
+	if g.st.Phase == PhaseMark {
+		if err := g.markRoots(ctx); err != nil {
+			return err
+		}
+		if err := g.setPhase(ctx, PhaseSweep); err != nil {
+			return err
+		}
+	}
+	if g.st.Phase == PhaseSweep {
+		if err := g.sweep(ctx); err != nil {
+			return err
+		}
+		if g.deleteErrors {
+			return ErrCannotDeleteSomeBlocks
+		}
+		if err := g.setPhase(ctx, PhaseCleanup); err != nil {
+			return err
+		}
+	}
+	if err := g.cleanup(ctx); err != nil {
+		return err
+	}
+	g.st.Phase = ""
+	if err := g.dstor.Delete(ctx, stateKey); err != nil {
+		return err
+	}
+
+	gds, ok := g.dstor.(dstore.GCDatastore)
+	if !ok {
+		return nil
+	}
+	return gds.CollectGarbage(ctx)
+}
+
+// markRoots marks the DAGs of the recursive and internal pins, and of the
+// best-effort roots, and adds the blocks pinned directly or by selector to
+// kept.
+func (g *incremental) markRoots(ctx context.Context) error {
+	g.partial = cid.NewSet()
+	rkeys, err := g.pn.RecursiveKeys(ctx)
+	if err != nil {
+		return err
+	}
+	ikeys, err := g.pn.InternalPins(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range append(rkeys, ikeys...) {
+		if _, err := g.markDAG(ctx, c, false); err != nil {
+			return err
+		}
+	}
+
+	roots, err := g.roots(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range roots {
+		if _, err := g.markDAG(ctx, c, true); err != nil {
+			return err
+		}
+	}
+
+	dkeys, err := g.pn.DirectKeys(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range dkeys {
+		g.kept.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+	}
+
+	if g.sp == nil {
+		return nil
+	}
+	spins, err := g.sp.List(ctx)
+	if err != nil {
+		return err
+	}
+	bg := selectorBlockGetter{g.ng}
+	for _, p := range spins {
+		if g.walked[p] {
+			continue
+		}
+		err := selectorpin.Walk(ctx, bg, p, func(k cid.Cid) {
+			g.kept.Add(cid.NewCidV1(cid.Raw, k.Hash()))
+		})
+		if err != nil {
+			return &CannotFetchLinksError{p.Root, err}
+		}
+		g.walked[p] = true
+	}
+	return nil
+}
+
+// markDAG marks the DAG of c, and returns whether all of its blocks are
+// there. If not, with bestEffort, the blocks missing are skipped and those
+// leading to them are added to kept instead of being marked, for the DAG to
+// be walked again once they are fetched; otherwise, it fails.
+func (g *incremental) markDAG(ctx context.Context, c cid.Cid, bestEffort bool) (bool, error) {
+	c = toCidV1(c)
+	if done, err := g.isMarked(ctx, c); err != nil || done {
+		return done, err
+	}
+	if g.partial.Has(c) {
+		return false, nil
+	}
+	if g.overTime() {
+		return false, errPaused
+	}
+	if err := verifcid.ValidateCid(c); err != nil {
+		return false, &CannotFetchLinksError{c, err}
+	}
+
+	links, err := ipld.GetLinks(ctx, g.ng, c)
+	if err != nil {
+		if bestEffort && ipld.IsNotFound(err) {
+			return false, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		return false, &CannotFetchLinksError{c, err}
+	}
+	complete := true
+	for _, l := range links {
+		done, err := g.markDAG(ctx, l.Cid, bestEffort)
+		if err != nil {
+			return false, err
+		}
+		complete = complete && done
+	}
+	if !complete {
+		g.partial.Add(c)
+		g.kept.Add(cid.NewCidV1(cid.Raw, c.Hash()))
+		return false, nil
+	}
+	return true, g.mark(ctx, c)
+}
+
+// isMarked returns whether c, made v1, is marked. The marks are per codec,
+// for a block not to be taken as marked with the links of another codec.
+func (g *incremental) isMarked(ctx context.Context, c cid.Cid) (bool, error) {
+	if g.marked.Has(c) {
+		return true, nil
+	}
+	codecs, err := g.markedCodecs(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	for _, codec := range codecs {
+		if codec == c.Type() {
+			g.marked.Add(c)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (g *incremental) mark(ctx context.Context, c cid.Cid) error {
+	codecs, err := g.markedCodecs(ctx, c)
+	if err != nil {
+		return err
+	}
+	var v []byte
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, codec := range append(codecs, c.Type()) {
+		n := binary.PutUvarint(buf, codec)
+		v = append(v, buf[:n]...)
+	}
+	if err := g.marks.Put(ctx, dshelp.MultihashToDsKey(c.Hash()), v); err != nil {
+		return err
+	}
+	g.marked.Add(c)
+	g.st.Marked++
+	return nil
+}
+
+// markedCodecs returns the codecs the multihash of c is marked with.
+func (g *incremental) markedCodecs(ctx context.Context, c cid.Cid) ([]uint64, error) {
+	v, err := g.marks.Get(ctx, dshelp.MultihashToDsKey(c.Hash()))
+	if err == dstore.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var codecs []uint64
+	for len(v) > 0 {
+		codec, n := binary.Uvarint(v)
+		if n <= 0 {
+			return nil, errors.New("invalid garbage collection mark")
+		}
+		codecs = append(codecs, codec)
+		v = v[n:]
+	}
+	return codecs, nil
+}
+
+// keep returns whether the block of the raw CID k is kept: marked with any
+// codec, or in kept.
+func (g *incremental) keep(ctx context.Context, k cid.Cid) (bool, error) {
+	if g.kept.Has(k) {
+		return true, nil
+	}
+	return g.marks.Has(ctx, dshelp.MultihashToDsKey(k.Hash()))
+}
+
+// sweep deletes the blocks not kept, in batches.
+func (g *incremental) sweep(ctx context.Context) error {
+	keychan, err := g.bs.AllKeysChan(ctx)
+	if err != nil {
+		return err
+	}
+	batch := make([]cid.Cid, 0, sweepBatchSize)
+	for k := range keychan {
+		if g.overBudget() {
+			return errPaused
+		}
+		// NOTE: assumes that all CIDs returned by the keychan are _raw_ CIDv1 CIDs.
+		keep, err := g.keep(ctx, k)
+		if err != nil {
+			return err
+		}
+		if keep {
+			continue
+		}
+		batch = append(batch, k)
+		if len(batch) < sweepBatchSize {
+			continue
+		}
+		if err := g.sweepBatch(ctx, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return g.sweepBatch(ctx, batch)
+}
+
+// sweepBatch deletes the blocks of batch not kept, under the GC lock, once
+// the blocks pinned since the last batch are marked.
+func (g *incremental) sweepBatch(ctx context.Context, batch []cid.Cid) error {
+	unlocker := g.bs.GCLock(ctx)
+	defer unlocker.Unlock(ctx)
+	if err := g.markRoots(ctx); err != nil {
+		return err
+	}
+
+	for _, k := range batch {
+		if g.overBudget() {
+			return errPaused
+		}
+		keep, err := g.keep(ctx, k)
+		if err != nil {
+			return err
+		}
+		if keep {
+			continue
+		}
+		size, err := g.bs.GetSize(ctx, k)
+		if ipld.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := g.bs.DeleteBlock(ctx, k); err != nil {
+			g.deleteErrors = true
+			if !g.emit(ctx, Result{Error: &CannotDeleteBlockError{k, err}}) {
+				return ctx.Err()
+			}
+			continue
+		}
+		g.st.Removed++
+		g.st.Freed += uint64(size)
+		g.freed += uint64(size)
+		if !g.emit(ctx, Result{KeyRemoved: k}) {
+			return ctx.Err()
+		}
+	}
+	return g.saveState(ctx)
+}
+
+// cleanup deletes the marks. The next run, if this one stops before it is
+// done, goes on with it rather than marking again, as the marks left may
+// claim DAGs whose blocks' marks are deleted.
+func (g *incremental) cleanup(ctx context.Context) error {
+	res, err := g.marks.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		if g.overTime() {
+			return errPaused
+		}
+		if err := g.marks.Delete(ctx, dstore.NewKey(r.Key)); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (g *incremental) setPhase(ctx context.Context, phase string) error {
+	g.st.Phase = phase
+	return g.saveState(ctx)
+}
+
+func (g *incremental) saveState(ctx context.Context) error {
+	b, err := json.Marshal(g.st)
+	if err != nil {
+		return err
+	}
+	return g.dstor.Put(ctx, stateKey, b)
+}
+
+func (g *incremental) overTime() bool {
+	return !g.deadline.IsZero() && time.Now().After(g.deadline)
+}
+
+func (g *incremental) overBudget() bool {
+	return g.overTime() || (g.budget.MaxBytes > 0 && g.freed >= g.budget.MaxBytes)
+}
+
+// emit sends r to the output, and returns false if ctx is done first.
+func (g *incremental) emit(ctx context.Context, r Result) bool {
+	select {
+	case g.output <- r:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
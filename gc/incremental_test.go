@@ -0,0 +1,118 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func collect(t *testing.T, out <-chan Result) []cid.Cid {
+	t.Helper()
+	var removed []cid.Cid
+	for r := range out {
+		if r.Error != nil {
+			t.Fatal(r.Error)
+		}
+		removed = append(removed, r.KeyRemoved)
+	}
+	return removed
+}
+
+func linked(data string, children ...ipld.Node) *dag.ProtoNode {
+	nd := dag.NodeWithData([]byte(data))
+	for i, c := range children {
+		if err := nd.AddNodeLink(fmt.Sprint(i), c); err != nil {
+			panic(err)
+		}
+	}
+	return nd
+}
+
+func TestIncrementalGC(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	add := func(nds ...ipld.Node) {
+		t.Helper()
+		if err := dserv.AddMany(ctx, nds); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b := linked("a"), linked("b")
+	pinned := linked("pinned", a, b)
+	add(pinned, a, b)
+	if err := pinner.Pin(ctx, pinned, true); err != nil {
+		t.Fatal(err)
+	}
+	// the best-effort root has a block missing: it is kept, with the
+	// blocks there
+	present, missing := linked("present"), linked("missing")
+	root := linked("root", present, missing)
+	add(root, present)
+	roots := func(context.Context) ([]cid.Cid, error) {
+		return []cid.Cid{root.Cid()}, nil
+	}
+	for i := 0; i < 10; i++ {
+		add(linked(fmt.Sprint("garbage ", i)))
+	}
+
+	removed := collect(t, IncrementalGC(ctx, bs, dstore, pinner, nil, roots, Budget{MaxBytes: 1}))
+	if len(removed) != 1 {
+		t.Fatalf("expected the run to stop after a block, got %d removed", len(removed))
+	}
+	st, err := IncrementalStatus(ctx, dstore)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st == nil || st.Phase != PhaseSweep || st.Removed != 1 || st.Freed == 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	// pinned between the runs
+	c := linked("c")
+	later := linked("later", c)
+	add(later, c)
+	if err := pinner.Pin(ctx, later, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	removed = collect(t, IncrementalGC(ctx, bs, dstore, pinner, nil, roots, Budget{}))
+	if len(removed) != 9 {
+		t.Fatalf("expected the other 9 blocks removed, got %d", len(removed))
+	}
+	for _, k := range []cid.Cid{pinned.Cid(), a.Cid(), b.Cid(), later.Cid(), c.Cid(), root.Cid(), present.Cid()} {
+		if has, err := bs.Has(ctx, k); err != nil || !has {
+			t.Fatalf("expected %s kept", k)
+		}
+	}
+	if st, err := IncrementalStatus(ctx, dstore); err != nil || st != nil {
+		t.Fatalf("expected the garbage collection done, got %+v, %v", st, err)
+	}
+	res, err := dstore.Query(ctx, dsq.Query{Prefix: incrementalKey.String(), KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := res.Rest(); len(left) != 0 {
+		t.Fatalf("expected the marks deleted, got %d left", len(left))
+	}
+}
@@ -0,0 +1,97 @@
+// Package hashfunc enables multihash functions beyond the ones go-verifcid
+// deems secure, from Import.HashFunctions or registered by plugins, to
+// experiment with new hash functions without waiting for them to be allowed
+// by a release.
+//
+// The functions enabled are added to the set of go-verifcid itself, so that
+// they are accepted everywhere the CIDs are verified: by the blockstore, the
+// blockservice, pinning, the reprovider and the garbage collector.
+package hashfunc
+
+import (
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"sync"
+	_ "unsafe" // for go:linkname
+
+	"github.com/ipfs/go-verifcid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// goodset is the set of the hash functions go-verifcid accepts. It is read
+// without locking, so it is only written to by the first call enabling a
+// function, before the nodes use it.
+//
+//go:linkname goodset github.com/ipfs/go-verifcid.goodset
+var goodset map[uint64]bool
+
+var mu sync.Mutex
+
+// Register registers the hash function code, named name, with the hashes of
+// newHash, and enables it. The hash function can then be used by 'ipfs add'
+// and 'ipfs block put'. It must be called before the node is constructed.
+func Register(code uint64, name string, newHash func() hash.Hash) error {
+	if newHash == nil {
+		return fmt.Errorf("hash function %q has no implementation", name)
+	}
+	if name == "" || strings.ToLower(name) != name {
+		return fmt.Errorf("invalid hash function name %q", name)
+	}
+	if c, ok := mh.Names[name]; ok && c != code {
+		return fmt.Errorf("hash function name %q already taken by 0x%x", name, c)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	mh.Register(code, newHash)
+	mh.Names[name] = code
+	mh.Codes[code] = name
+	enable(code)
+	return nil
+}
+
+// Enable enables the hash functions named, or given as hexadecimal codes,
+// such as "blake3" or "0x1e". They must have an implementation, built in
+// go-multihash or registered by a plugin. It must be called before the node
+// is constructed.
+func Enable(names ...string) error {
+	codes := make([]uint64, 0, len(names))
+	for _, name := range names {
+		code, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if _, err := mh.GetHasher(code); err != nil {
+			return fmt.Errorf("hash function %q has no implementation", name)
+		}
+		codes = append(codes, code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, code := range codes {
+		enable(code)
+	}
+	return nil
+}
+
+func enable(code uint64) {
+	if !verifcid.IsGoodHash(code) {
+		goodset[code] = true
+	}
+}
+
+func lookup(name string) (uint64, error) {
+	name = strings.ToLower(name)
+	if code, ok := mh.Names[name]; ok {
+		return code, nil
+	}
+	if strings.HasPrefix(name, "0x") {
+		if code, err := strconv.ParseUint(name[2:], 16, 64); err == nil {
+			return code, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hash function %q", name)
+}
@@ -0,0 +1,64 @@
+package hashfunc
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-verifcid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, code uint64) cid.Cid {
+	h, err := mh.Sum([]byte("data"), code, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestEnable(t *testing.T) {
+	if err := verifcid.ValidateCid(testCid(t, mh.SHA2_256)); err != nil {
+		t.Fatal(err)
+	}
+	c := testCid(t, mh.BLAKE3)
+	if err := verifcid.ValidateCid(c); err != verifcid.ErrPossiblyInsecureHashFunction {
+		t.Fatalf("expected blake3 not accepted, got %v", err)
+	}
+
+	if err := Enable("sha2-256", "nope"); err == nil || err.Error() != `unknown hash function "nope"` {
+		t.Fatalf("expected the unknown hash function to fail, got %v", err)
+	}
+	if err := Enable("0x123456"); err == nil {
+		t.Fatal("expected the hash function without implementation to fail")
+	}
+	if err := Enable("BLAKE3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifcid.ValidateCid(c); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Enable("murmur3-x64-64"); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifcid.ValidateCid(testCid(t, mh.MURMUR3X64_64)); err != verifcid.ErrBelowMinimumHashLength {
+		t.Fatalf("expected the short hash not accepted, got %v", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const code = 0x300001
+	if err := Register(code, "sha2-256", sha256.New); err == nil {
+		t.Fatal("expected the name taken to fail")
+	}
+	if err := Register(code, "test-sha2-256", sha256.New); err != nil {
+		t.Fatal(err)
+	}
+	if mh.Names["test-sha2-256"] != code || mh.Codes[code] != "test-sha2-256" {
+		t.Fatal("hash function not named")
+	}
+	if err := verifcid.ValidateCid(testCid(t, code)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,373 @@
+// Package hooks runs the commands and requests the webhooks configured for the
+// events of the node: the IPNS names it publishes with a new value, and the
+// changes of its MFS, so that deployments react to them without polling.
+//
+// The hooks are run in the background, one after the other in the order of
+// the events: a failure is logged, and the next hooks are run regardless.
+// The hooks pending when the node stops are still run, within the timeout of
+// a hook.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	path "github.com/ipfs/go-path"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/ipfs/go-ipfs/mfswatch"
+)
+
+var log = logging.Logger("hooks")
+
+// MaxPending is the largest number of hooks waiting to be run. The hooks
+// beyond are dropped.
+const MaxPending = 1000
+
+// maxOutput is the most of the output of a command failing which is logged
+const maxOutput = 1 << 10
+
+// The types of the events.
+const (
+	// NamePublish is the publication of an IPNS name with a new value.
+	NamePublish = "name-publish"
+	// FilesChange is a change of the MFS.
+	FilesChange = "files-change"
+)
+
+// Event is an event the hooks are run for, given to them as JSON.
+type Event struct {
+	Type string
+	Time time.Time
+	// Name is the IPNS name published, as /ipns/<key ID>, and Value the path
+	// it was published with.
+	Name  string `json:",omitempty"`
+	Value string `json:",omitempty"`
+	// Path is the MFS path changed, / for the root.
+	Path string `json:",omitempty"`
+	// Cid is the CID of the new value: the CID published, when it was
+	// published with an /ipfs/ path, or the CID of the MFS path changed,
+	// empty when it was removed.
+	Cid string `json:",omitempty"`
+}
+
+// env returns the environment variables of the commands run for e.
+func (e Event) env() []string {
+	return []string{
+		"IPFS_HOOK_TYPE=" + e.Type,
+		"IPFS_HOOK_NAME=" + e.Name,
+		"IPFS_HOOK_VALUE=" + e.Value,
+		"IPFS_HOOK_PATH=" + e.Path,
+		"IPFS_HOOK_CID=" + e.Cid,
+	}
+}
+
+// Hook is a command or a webhook. Exactly one of Exec and URL is set.
+type Hook struct {
+	// Exec is the command run, and its arguments.
+	Exec []string
+	// URL is the URL the event is POSTed to, with Header.
+	URL    string
+	Header http.Header
+	// Key, if set, restricts an OnPublish hook to the name of this key.
+	Key peer.ID
+	// Path restricts an OnFilesChange hook to the changes under this MFS
+	// path, / if empty.
+	Path string
+}
+
+func (h Hook) String() string {
+	if h.URL != "" {
+		// the URL may carry credentials
+		if u, err := url.Parse(h.URL); err == nil {
+			return u.Redacted()
+		}
+		return h.URL
+	}
+	return strings.Join(h.Exec, " ")
+}
+
+// Settings configures the hooks.
+type Settings struct {
+	// OnPublish are run when an IPNS name is published with a new value.
+	OnPublish []Hook
+	// OnFilesChange are run when the MFS changes.
+	OnFilesChange []Hook
+	// Timeout is the timeout of a hook.
+	Timeout time.Duration
+}
+
+// job is a hook to run for an event.
+type job struct {
+	hook  Hook
+	event Event
+}
+
+// Runner runs the hooks of the events, one after the other, until Close is
+// called.
+type Runner struct {
+	onPublish     []Hook
+	onFilesChange []Hook
+	timeout       time.Duration
+	client        *http.Client
+
+	mu      sync.Mutex
+	pending []job
+
+	wake    chan struct{}
+	closing chan struct{}
+	cancel  context.CancelFunc
+	closed  chan struct{}
+}
+
+// New returns the runner of the hooks of s.
+func New(s Settings) (*Runner, error) {
+	if s.Timeout <= 0 {
+		return nil, fmt.Errorf("hook timeout must be positive: %s", s.Timeout)
+	}
+	for i := range s.OnFilesChange {
+		h := &s.OnFilesChange[i]
+		if h.Path == "" {
+			h.Path = "/"
+		}
+		if !strings.HasPrefix(h.Path, "/") {
+			return nil, fmt.Errorf("hook %s: %s is not an absolute MFS path", h, h.Path)
+		}
+	}
+	for _, h := range append(append([]Hook{}, s.OnPublish...), s.OnFilesChange...) {
+		if err := h.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &Runner{
+		onPublish:     s.OnPublish,
+		onFilesChange: s.OnFilesChange,
+		timeout:       s.Timeout,
+		client:        &http.Client{Timeout: s.Timeout},
+		wake:          make(chan struct{}, 1),
+		closing:       make(chan struct{}),
+		closed:        make(chan struct{}),
+	}
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run(ctx)
+	return r, nil
+}
+
+func (h Hook) validate() error {
+	switch {
+	case len(h.Exec) > 0 && h.URL != "":
+		return fmt.Errorf("hook %s has both a command and a URL", h)
+	case len(h.Exec) > 0:
+		if h.Exec[0] == "" {
+			return errors.New("hook with an empty command")
+		}
+	case h.URL != "":
+		u, err := url.Parse(h.URL)
+		if err != nil {
+			return fmt.Errorf("invalid hook URL %q: %w", h.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid hook URL %q: not an HTTP URL", h.URL)
+		}
+	default:
+		return errors.New("hook with neither a command nor a URL")
+	}
+	return nil
+}
+
+// Close runs the hooks pending, within the timeout of a hook, and stops the
+// runner.
+func (r *Runner) Close() error {
+	close(r.closing)
+	select {
+	case <-r.closed:
+	case <-time.After(r.timeout):
+		r.mu.Lock()
+		if n := len(r.pending); n > 0 {
+			log.Warnf("stopping with %d hooks not run", n)
+		}
+		r.mu.Unlock()
+		r.cancel()
+		<-r.closed
+	}
+	return nil
+}
+
+// Published runs the OnPublish hooks of the IPNS name id published with
+// value.
+func (r *Runner) Published(id peer.ID, value path.Path) {
+	e := Event{
+		Type:  NamePublish,
+		Time:  time.Now(),
+		Name:  "/ipns/" + coreiface.FormatKeyID(id),
+		Value: value.String(),
+	}
+	if segments := value.Segments(); len(segments) == 2 && segments[0] == "ipfs" {
+		e.Cid = segments[1]
+	}
+	for _, h := range r.onPublish {
+		if h.Key == "" || h.Key == id {
+			r.queue(h, e)
+		}
+	}
+}
+
+// WatchFiles runs the OnFilesChange hooks of the changes of the MFS watched
+// by w, until ctx is done.
+func (r *Runner) WatchFiles(ctx context.Context, w *mfswatch.Watcher) error {
+	byPath := make(map[string][]Hook)
+	for _, h := range r.onFilesChange {
+		byPath[h.Path] = append(byPath[h.Path], h)
+	}
+	for p, hooks := range byPath {
+		events, err := w.Watch(ctx, p)
+		if err != nil {
+			return err
+		}
+		last, err := w.Resolve(ctx, p)
+		if err != nil {
+			return err
+		}
+		go func(p string, hooks []Hook, last cid.Cid) {
+			// a change is several events, for the entries changed
+			for range events {
+				c, err := w.Resolve(ctx, p)
+				if err != nil {
+					log.Errorf("cannot resolve the MFS path %s: %s", p, err)
+					continue
+				}
+				if c.Equals(last) {
+					continue
+				}
+				last = c
+				e := Event{Type: FilesChange, Time: time.Now(), Path: p}
+				if c.Defined() {
+					e.Cid = c.String()
+				}
+				for _, h := range hooks {
+					r.queue(h, e)
+				}
+			}
+		}(p, hooks, last)
+	}
+	return nil
+}
+
+// queue queues the run of h for e.
+func (r *Runner) queue(h Hook, e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) >= MaxPending {
+		log.Warnf("too many hooks pending, dropped %s for the %s event", h, e.Type)
+		return
+	}
+	r.pending = append(r.pending, job{hook: h, event: e})
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Runner) run(ctx context.Context) {
+	defer close(r.closed)
+	for {
+		j, ok := r.next()
+		if !ok {
+			select {
+			case <-r.wake:
+				continue
+			case <-r.closing:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := r.runHook(ctx, j.hook, j.event); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorf("hook %s failed for the %s event: %s", j.hook, j.event.Type, err)
+		}
+	}
+}
+
+// next returns the next hook to run, if any.
+func (r *Runner) next() (job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pending) == 0 {
+		return job{}, false
+	}
+	j := r.pending[0]
+	r.pending = r.pending[1:]
+	return j, true
+}
+
+// runHook runs h for e.
+func (r *Runner) runHook(ctx context.Context, h Hook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	if h.URL != "" {
+		return r.post(ctx, h, body)
+	}
+
+	cmd := exec.CommandContext(ctx, h.Exec[0], h.Exec[1:]...)
+	cmd.Env = append(os.Environ(), e.env()...)
+	cmd.Stdin = bytes.NewReader(body)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(out) > maxOutput {
+			out = out[:maxOutput]
+		}
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	log.Debugf("ran %s for the %s event", h, e.Type)
+	return nil
+}
+
+// post POSTs the event body to the webhook h.
+func (r *Runner) post(ctx context.Context, h Hook, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("POST %s: %s", req.URL.Redacted(), res.Status)
+	}
+	log.Debugf("requested %s", req.URL.Redacted())
+	return nil
+}
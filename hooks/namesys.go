@@ -0,0 +1,66 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// nameSystem runs the OnPublish hooks of the IPNS names published with a new
+// value, the names republished with the same value running none.
+type nameSystem struct {
+	namesys.NameSystem
+	r *Runner
+	// published reads the records last published by the node
+	published *namesys.IpnsPublisher
+}
+
+// NameSystem returns ns, running the OnPublish hooks of the IPNS names it
+// publishes with a new value. d is the datastore ns keeps the records it
+// publishes in.
+func (r *Runner) NameSystem(ns namesys.NameSystem, d ds.Datastore) namesys.NameSystem {
+	if len(r.onPublish) == 0 {
+		return ns
+	}
+	return &nameSystem{
+		NameSystem: ns,
+		r:          r,
+		published:  namesys.NewIpnsPublisher(nil, d),
+	}
+}
+
+func (ns *nameSystem) Publish(ctx context.Context, name ic.PrivKey, value path.Path) error {
+	return ns.publish(ctx, name, value, func() error {
+		return ns.NameSystem.Publish(ctx, name, value)
+	})
+}
+
+func (ns *nameSystem) PublishWithEOL(ctx context.Context, name ic.PrivKey, value path.Path, eol time.Time) error {
+	return ns.publish(ctx, name, value, func() error {
+		return ns.NameSystem.PublishWithEOL(ctx, name, value, eol)
+	})
+}
+
+func (ns *nameSystem) publish(ctx context.Context, name ic.PrivKey, value path.Path, publish func() error) error {
+	id, err := peer.IDFromPrivateKey(name)
+	if err != nil {
+		return err
+	}
+	changed := true
+	if rec, err := ns.published.GetPublished(ctx, id, false); err == nil && rec != nil {
+		changed = string(rec.GetValue()) != value.String()
+	}
+
+	if err := publish(); err != nil {
+		return err
+	}
+	if changed {
+		ns.r.Published(id, value)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+// Package indexer announces the provider records of the node to HTTP
+// indexers, with the PUT /routing/v1/providers request of the delegated
+// routing HTTP API.
+//
+// Provides are batched, for each indexer separately, and announced as signed
+// bitswap records. The requests failing on network errors, rate limits or
+// server errors are retried with an exponential backoff.
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multibase"
+)
+
+var log = logging.Logger("indexer")
+
+const (
+	// maxAttempts is how many times a batch is announced before being
+	// dropped, until the next reprovide.
+	maxAttempts = 5
+	// maxPending is how many keys are batched for an indexer at most, when
+	// it does not keep up.
+	maxPending = 100000
+	// requestTimeout bounds each announcement.
+	requestTimeout = time.Minute
+)
+
+// Settings configures the batching of the announcements.
+type Settings struct {
+	// BatchSize is the largest number of keys announced in one request.
+	BatchSize int
+	// BatchInterval is how long provides are batched.
+	BatchInterval time.Duration
+	// AdvisoryTTL is how long the indexers should keep the records.
+	AdvisoryTTL time.Duration
+}
+
+// Publisher announces the provider records of a host to indexers. It is a
+// content router which only provides, and never finds providers.
+type Publisher struct {
+	host     host.Host
+	key      crypto.PrivKey
+	settings Settings
+	client   *http.Client
+	indexers []*indexer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// indexer batches the keys to announce to an endpoint.
+type indexer struct {
+	endpoint string
+
+	mu      sync.Mutex
+	pending []cid.Cid
+	queued  map[cid.Cid]struct{}
+	dropped int
+	// added is signaled when keys are batched
+	added chan struct{}
+}
+
+// New returns a publisher announcing the provider records of h, signed with
+// key, to the indexers at endpoints. It runs until closed.
+func New(h host.Host, key crypto.PrivKey, endpoints []string, s Settings) (*Publisher, error) {
+	if s.BatchSize < 1 {
+		return nil, fmt.Errorf("batch size must be positive: %d", s.BatchSize)
+	}
+	if s.BatchInterval <= 0 {
+		return nil, fmt.Errorf("batch interval must be positive: %s", s.BatchInterval)
+	}
+
+	p := &Publisher{
+		host:     h,
+		key:      key,
+		settings: s,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+	for _, e := range endpoints {
+		u, err := url.Parse(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid indexer endpoint %q: %w", e, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid indexer endpoint %q: not an HTTP URL", e)
+		}
+		p.indexers = append(p.indexers, &indexer{
+			endpoint: strings.TrimSuffix(e, "/") + "/routing/v1/providers",
+			queued:   make(map[cid.Cid]struct{}),
+			added:    make(chan struct{}, 1),
+		})
+	}
+
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	for _, idx := range p.indexers {
+		p.wg.Add(1)
+		go p.run(idx)
+	}
+	return p, nil
+}
+
+// Provide batches the announcement of c to the indexers, unless announce is
+// false.
+func (p *Publisher) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if !announce {
+		return nil
+	}
+	for _, idx := range p.indexers {
+		idx.add(c)
+	}
+	return nil
+}
+
+// FindProvidersAsync finds no providers: the indexers are only announced to.
+func (p *Publisher) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
+
+// Close stops the announcements, dropping the keys still batched, as they
+// are reprovided anyway.
+func (p *Publisher) Close() error {
+	p.cancel()
+	p.wg.Wait()
+	return nil
+}
+
+func (idx *indexer) add(c cid.Cid) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, ok := idx.queued[c]; ok {
+		return
+	}
+	if len(idx.pending) >= maxPending {
+		idx.dropped++
+		return
+	}
+	idx.queued[c] = struct{}{}
+	idx.pending = append(idx.pending, c)
+	select {
+	case idx.added <- struct{}{}:
+	default:
+	}
+}
+
+func (idx *indexer) len() int {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return len(idx.pending)
+}
+
+// take removes n keys at most from the batch.
+func (idx *indexer) take(n int) []cid.Cid {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if n > len(idx.pending) {
+		n = len(idx.pending)
+	}
+	keys := idx.pending[:n:n]
+	idx.pending = idx.pending[n:]
+	for _, c := range keys {
+		delete(idx.queued, c)
+	}
+	if idx.dropped > 0 {
+		log.Warnf("dropped %d provider records not announced to %s in time", idx.dropped, idx.endpoint)
+		idx.dropped = 0
+	}
+	return keys
+}
+
+func (p *Publisher) run(idx *indexer) {
+	defer p.wg.Done()
+	for {
+		// wait for the first key of a batch, then for the batch to fill up
+		select {
+		case <-idx.added:
+		case <-p.ctx.Done():
+			return
+		}
+		timer := time.NewTimer(p.settings.BatchInterval)
+	batching:
+		for idx.len() < p.settings.BatchSize {
+			select {
+			case <-idx.added:
+			case <-timer.C:
+				break batching
+			case <-p.ctx.Done():
+				timer.Stop()
+				return
+			}
+		}
+		timer.Stop()
+
+		for keys := idx.take(p.settings.BatchSize); len(keys) > 0; keys = idx.take(p.settings.BatchSize) {
+			if !p.announce(idx, keys) {
+				return
+			}
+		}
+	}
+}
+
+// announce announces keys to idx, retrying on temporary failures. It returns
+// false if the publisher was closed meanwhile.
+func (p *Publisher) announce(idx *indexer, keys []cid.Cid) bool {
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		err := p.put(idx.endpoint, keys)
+		if err == nil {
+			log.Debugf("announced %d provider records to %s", len(keys), idx.endpoint)
+			return true
+		}
+		if p.ctx.Err() != nil {
+			return false
+		}
+		if _, ok := err.(permanentError); ok || attempt == maxAttempts {
+			log.Errorf("failed to announce %d provider records to %s: %s", len(keys), idx.endpoint, err)
+			return true
+		}
+		log.Debugf("announcing %d provider records to %s, retrying in %s: %s", len(keys), idx.endpoint, backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-p.ctx.Done():
+			timer.Stop()
+			return false
+		}
+		backoff *= 2
+	}
+}
+
+// permanentError is an announcement failure not worth retrying.
+type permanentError struct {
+	error
+}
+
+// bitswapPayload is the signed part of a bitswap provider record.
+type bitswapPayload struct {
+	Keys        []string
+	Timestamp   int64 // in milliseconds since the Unix epoch
+	AdvisoryTTL int64 // in nanoseconds
+	ID          string
+	Addrs       []string
+}
+
+type providerRecord struct {
+	Schema    string
+	Protocol  string
+	Signature string
+	Payload   json.RawMessage
+}
+
+type putProvidersRequest struct {
+	Providers []providerRecord
+}
+
+func (p *Publisher) put(endpoint string, keys []cid.Cid) error {
+	payload := bitswapPayload{
+		Keys:        make([]string, len(keys)),
+		Timestamp:   time.Now().UnixNano() / int64(time.Millisecond),
+		AdvisoryTTL: int64(p.settings.AdvisoryTTL),
+		ID:          p.host.ID().String(),
+	}
+	for i, c := range keys {
+		payload.Keys[i] = c.String()
+	}
+	for _, a := range p.host.Addrs() {
+		payload.Addrs = append(payload.Addrs, a.String())
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return permanentError{err}
+	}
+	sig, err := p.key.Sign(payloadBytes)
+	if err != nil {
+		return permanentError{err}
+	}
+	signature, err := multibase.Encode(multibase.Base64, sig)
+	if err != nil {
+		return permanentError{err}
+	}
+	body, err := json.Marshal(putProvidersRequest{
+		Providers: []providerRecord{{
+			Schema:    "bitswap",
+			Protocol:  "transport-bitswap",
+			Signature: signature,
+			Payload:   payloadBytes,
+		}},
+	})
+	if err != nil {
+		return permanentError{err}
+	}
+
+	req, err := http.NewRequestWithContext(p.ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	default:
+		return permanentError{fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))}
+	}
+}
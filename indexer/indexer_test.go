@@ -0,0 +1,132 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multibase"
+)
+
+func TestPublisher(t *testing.T) {
+	h, err := mocknet.New().GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	announced := make(map[string]int)
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/routing/v1/providers" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		// the first request fails, and is retried
+		if requests == 1 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		var req putProvidersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Providers) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		rec := req.Providers[0]
+		_, sig, err := multibase.Decode(rec.Signature)
+		if err != nil {
+			http.Error(w, "bad signature", http.StatusBadRequest)
+			return
+		}
+		if ok, err := h.Peerstore().PubKey(h.ID()).Verify(rec.Payload, sig); err != nil || !ok {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		var payload bitswapPayload
+		if err := json.Unmarshal(rec.Payload, &payload); err != nil || payload.ID != h.ID().String() ||
+			rec.Schema != "bitswap" || payload.AdvisoryTTL != int64(time.Hour) || len(payload.Keys) > 2 {
+			http.Error(w, "bad record", http.StatusBadRequest)
+			return
+		}
+		for _, k := range payload.Keys {
+			announced[k]++
+		}
+		fmt.Fprint(w, `{"ProvideResults":[]}`)
+	}))
+	defer srv.Close()
+
+	p, err := New(h, h.Peerstore().PrivKey(h.ID()), []string{srv.URL + "/"}, Settings{
+		BatchSize:     2,
+		BatchInterval: 50 * time.Millisecond,
+		AdvisoryTTL:   time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var keys []cid.Cid
+	for i := 0; i < 5; i++ {
+		keys = append(keys, dag.NodeWithData([]byte(fmt.Sprint(i))).Cid())
+	}
+	for _, c := range keys {
+		if err := p.Provide(p.ctx, c, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// provided a second time while batched, and not announced
+	if err := p.Provide(p.ctx, keys[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Provide(p.ctx, dag.NodeWithData([]byte("local")).Cid(), false); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(announced)
+		mu.Unlock()
+		if n == len(keys) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("announced %d keys of %d", n, len(keys))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// let the late requests through
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, c := range keys {
+		if announced[c.String()] != 1 {
+			t.Fatalf("%s announced %d times", c, announced[c.String()])
+		}
+	}
+}
+
+func TestNewInvalidEndpoint(t *testing.T) {
+	h, err := mocknet.New().GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := Settings{BatchSize: 1, BatchInterval: time.Second, AdvisoryTTL: time.Hour}
+	for _, e := range []string{"indexer.example.com", "ftp://indexer.example.com", "http://"} {
+		if _, err := New(h, h.Peerstore().PrivKey(h.ID()), []string{e}, s); err == nil {
+			t.Fatalf("endpoint %q accepted", e)
+		}
+	}
+}
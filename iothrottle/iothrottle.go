@@ -0,0 +1,210 @@
+// Package iothrottle limits the disk I/O of the background jobs of the node.
+//
+// Garbage collection, reprovider walks, and repo verification and fsck read
+// the whole repo, or a large part of it. On spinning disks, this takes the
+// disk away from the foreground requests, such as the ones of the gateway,
+// whose latency suffers. Their blockstores are throttled by a Limiter, which
+// holds back their operations to a given rate of blocks and bytes.
+package iothrottle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Limiter limits the rate of operations and bytes of the blockstores it
+// throttles. It is shared by all the background jobs, so that running several
+// does not multiply the I/O. The nil Limiter does not limit anything.
+type Limiter struct {
+	limits *limits // nil if the limiter only has a gate
+	// gate, if set, holds the operations back until it returns
+	gate func(context.Context) error
+}
+
+type limits struct {
+	mu    sync.Mutex
+	ops   *bucket
+	bytes *bucket
+}
+
+// New returns a Limiter of opsPerSec operations and bytesPerSec bytes per
+// second. A zero rate is unlimited.
+func New(opsPerSec, bytesPerSec uint64) *Limiter {
+	now := time.Now()
+	return &Limiter{limits: &limits{
+		ops:   newBucket(float64(opsPerSec), now),
+		bytes: newBucket(float64(bytesPerSec), now),
+	}}
+}
+
+// Gated returns a Limiter which holds each operation back until gate
+// returns, such as until a maintenance window opens, then within the limits
+// of l, shared with it. l may be nil.
+func Gated(l *Limiter, gate func(context.Context) error) *Limiter {
+	g := &Limiter{gate: gate}
+	if l != nil {
+		g.limits = l.limits
+		if l.gate != nil {
+			g.gate = func(ctx context.Context) error {
+				if err := l.gate(ctx); err != nil {
+					return err
+				}
+				return gate(ctx)
+			}
+		}
+	}
+	return g
+}
+
+// Wait waits until one more operation, of n bytes, is within the limits. An
+// operation is let through once the ones before are paid for, so a block
+// larger than the byte rate still gets through, after a longer wait.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	if l.gate != nil {
+		if err := l.gate(ctx); err != nil {
+			return err
+		}
+	}
+	if l.limits == nil {
+		return ctx.Err()
+	}
+
+	l.limits.mu.Lock()
+	now := time.Now()
+	delay := l.limits.ops.take(now, 1)
+	if d := l.limits.bytes.take(now, float64(n)); d > delay {
+		delay = d
+	}
+	l.limits.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bucket is a token bucket holding up to a second of its rate. Its tokens go
+// negative when more is taken than it holds.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, now time.Time) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &bucket{rate: rate, tokens: rate, last: now}
+}
+
+// take takes n tokens, and returns how long to wait for the bucket to be out
+// of debt.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// NewBlockstore returns bs throttled by l. Each block listed, checked, read or
+// deleted counts as an operation, and the blocks read count their size. The
+// blocks written are not throttled, nor is bs if l is nil.
+func NewBlockstore(bs blockstore.Blockstore, l *Limiter) blockstore.Blockstore {
+	if l == nil {
+		return bs
+	}
+	return &throttled{Blockstore: bs, limiter: l}
+}
+
+// NewGCBlockstore returns bs throttled by l, as NewBlockstore does.
+func NewGCBlockstore(bs blockstore.GCBlockstore, l *Limiter) blockstore.GCBlockstore {
+	if l == nil {
+		return bs
+	}
+	return blockstore.NewGCBlockstore(NewBlockstore(bs, l), bs)
+}
+
+type throttled struct {
+	blockstore.Blockstore
+	limiter *Limiter
+}
+
+func (t *throttled) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	if err := t.limiter.Wait(ctx, 0); err != nil {
+		return false, err
+	}
+	return t.Blockstore.Has(ctx, c)
+}
+
+func (t *throttled) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	if err := t.limiter.Wait(ctx, 0); err != nil {
+		return -1, err
+	}
+	return t.Blockstore.GetSize(ctx, c)
+}
+
+// Get waits after the read, as the size of the block is only known then.
+func (t *throttled) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	b, err := t.Blockstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.limiter.Wait(ctx, len(b.RawData())); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (t *throttled) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	if err := t.limiter.Wait(ctx, 0); err != nil {
+		return err
+	}
+	return t.Blockstore.DeleteBlock(ctx, c)
+}
+
+func (t *throttled) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	keys, err := t.Blockstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		for c := range keys {
+			if t.limiter.Wait(ctx, 0) != nil {
+				return
+			}
+			select {
+			case out <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,163 @@
+package iothrottle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+func TestLimiterOps(t *testing.T) {
+	ctx := context.Background()
+	l := New(100, 0)
+
+	// the first second of operations is allowed at once
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.Wait(ctx, 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d > 50*time.Millisecond {
+		t.Fatalf("burst held back for %s", d)
+	}
+
+	// then 100 per second
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		if err := l.Wait(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Fatalf("10 operations over the limit took only %s", d)
+	}
+}
+
+func TestLimiterBytes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := New(0, 1000)
+
+	// a read larger than the rate gets through, once paid for
+	start := time.Now()
+	if err := l.Wait(ctx, 1500); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Fatalf("debt of 500 bytes paid back in %s", d)
+	}
+
+	cancel()
+	if err := l.Wait(ctx, 2000); err != context.Canceled {
+		t.Fatalf("expected the wait to be canceled, got %v", err)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	var l *Limiter
+	if err := l.Wait(context.Background(), 1<<30); err != nil {
+		t.Fatal(err)
+	}
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	if NewBlockstore(bs, nil) != bs {
+		t.Fatal("blockstore throttled by a nil limiter")
+	}
+}
+
+func TestGated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	open := make(chan struct{})
+	gate := func(ctx context.Context) error {
+		select {
+		case <-open:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// the gated limiter shares the limits of the other
+	l := New(10, 0)
+	g := Gated(l, gate)
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Wait(ctx, 0)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("operation let through before the gate, with %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(open)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 9; i++ {
+		if err := l.Wait(ctx, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := g.Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Fatalf("operation over the shared limit took only %s", d)
+	}
+
+	// a gated nil limiter only has the gate
+	if err := Gated(nil, gate).Wait(ctx, 1<<30); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlockstore(t *testing.T) {
+	ctx := context.Background()
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	var bks []blocks.Block
+	for _, s := range []string{"a", "b", "c", "d"} {
+		b := blocks.NewBlock([]byte(s))
+		if err := bs.Put(ctx, b); err != nil {
+			t.Fatal(err)
+		}
+		bks = append(bks, b)
+	}
+
+	l := New(10, 0)
+	tbs := NewBlockstore(bs, l)
+	// use up the burst
+	for i := 0; i < 10; i++ {
+		if _, err := tbs.Has(ctx, bks[0].Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	keys, err := tbs.AllKeysChan(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range keys {
+		n++
+	}
+	if n != len(bks) {
+		t.Fatalf("expected %d keys, got %d", len(bks), n)
+	}
+	if d := time.Since(start); d < 300*time.Millisecond {
+		t.Fatalf("listing 4 keys at 10 per second took only %s", d)
+	}
+
+	b, err := tbs.Get(ctx, bks[1].Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b.RawData()) != "b" {
+		t.Fatalf("unexpected block %q", b.RawData())
+	}
+}
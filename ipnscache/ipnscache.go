@@ -0,0 +1,121 @@
+// Package ipnscache persists the IPNS records seen by the node so that names
+// can still be resolved, from a possibly stale record, when the routing
+// system can't find them.
+package ipnscache
+
+import (
+	"context"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+)
+
+var log = logging.Logger("ipnscache")
+
+var keyPrefix = ds.NewKey("/ipns-cache")
+
+// ValueStore wraps a routing.ValueStore and persists every IPNS record it
+// puts or retrieves. Records returned by the routing system have already been
+// validated by it.
+type ValueStore struct {
+	routing.ValueStore
+	ds ds.Datastore
+}
+
+// NewValueStore returns a ValueStore persisting records to d.
+func NewValueStore(vs routing.ValueStore, d ds.Datastore) *ValueStore {
+	return &ValueStore{ValueStore: vs, ds: d}
+}
+
+// PutValue implements routing.ValueStore.
+func (s *ValueStore) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	s.store(ctx, key, val)
+	return s.ValueStore.PutValue(ctx, key, val, opts...)
+}
+
+// GetValue implements routing.ValueStore.
+func (s *ValueStore) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	val, err := s.ValueStore.GetValue(ctx, key, opts...)
+	if err == nil {
+		s.store(ctx, key, val)
+	}
+	return val, err
+}
+
+// SearchValue implements routing.ValueStore.
+func (s *ValueStore) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	vals, err := s.ValueStore.SearchValue(ctx, key, opts...)
+	if err != nil || !isIpnsKey(key) {
+		return vals, err
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for val := range vals {
+			s.store(ctx, key, val)
+			select {
+			case out <- val:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// store persists val if key is an IPNS key and val is newer than the record
+// already cached. Failures are only logged: the cache is best effort.
+func (s *ValueStore) store(ctx context.Context, key string, val []byte) {
+	if !isIpnsKey(key) {
+		return
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := entry.Unmarshal(val); err != nil {
+		return
+	}
+
+	dsk := dsKey(key)
+	if old, err := s.ds.Get(ctx, dsk); err == nil {
+		oldEntry := new(pb.IpnsEntry)
+		if err := oldEntry.Unmarshal(old); err == nil {
+			if c, err := ipns.Compare(entry, oldEntry); err == nil && c <= 0 {
+				return
+			}
+		}
+	}
+
+	if err := s.ds.Put(ctx, dsk, val); err != nil {
+		log.Warnf("caching ipns record: %s", err)
+	}
+}
+
+// Get returns the cached record of the IPNS name of id. It returns
+// ds.ErrNotFound if no record of that name was seen.
+func Get(ctx context.Context, d ds.Datastore, id peer.ID) (*pb.IpnsEntry, error) {
+	val, err := d.Get(ctx, dsKey(ipns.RecordKey(id)))
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(pb.IpnsEntry)
+	if err := entry.Unmarshal(val); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func isIpnsKey(key string) bool {
+	return strings.HasPrefix(key, "/ipns/")
+}
+
+func dsKey(key string) ds.Key {
+	return keyPrefix.Child(dshelp.NewKeyFromBinary([]byte(key)))
+}
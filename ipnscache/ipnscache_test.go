@@ -0,0 +1,104 @@
+package ipnscache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipns "github.com/ipfs/go-ipns"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+type mapValueStore map[string][]byte
+
+func (m mapValueStore) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	m[key] = val
+	return nil
+}
+
+func (m mapValueStore) GetValue(ctx context.Context, key string, opts ...routing.Option) ([]byte, error) {
+	val, ok := m[key]
+	if !ok {
+		return nil, routing.ErrNotFound
+	}
+	return val, nil
+}
+
+func (m mapValueStore) SearchValue(ctx context.Context, key string, opts ...routing.Option) (<-chan []byte, error) {
+	out := make(chan []byte, 1)
+	if val, ok := m[key]; ok {
+		out <- val
+	}
+	close(out)
+	return out, nil
+}
+
+func record(t *testing.T, sk crypto.PrivKey, value string, seq uint64) []byte {
+	entry, err := ipns.Create(sk, []byte(value), seq, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := entry.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestValueStore(t *testing.T) {
+	ctx := context.Background()
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := ipns.RecordKey(id)
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	inner := mapValueStore{}
+	vs := NewValueStore(inner, d)
+
+	if _, err := Get(ctx, d, id); err != ds.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := vs.PutValue(ctx, key, record(t, sk, "/ipfs/a", 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// an older record seen later doesn't replace the cached one
+	inner[key] = record(t, sk, "/ipfs/b", 1)
+	vals, err := vs.SearchValue(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range vals {
+	}
+	checkCached(t, d, id, "/ipfs/a")
+
+	// a newer one does, and stays cached once the routing system lost it
+	inner[key] = record(t, sk, "/ipfs/c", 3)
+	if _, err := vs.GetValue(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	delete(inner, key)
+	checkCached(t, d, id, "/ipfs/c")
+}
+
+func checkCached(t *testing.T, d ds.Datastore, id peer.ID, expected string) {
+	t.Helper()
+	entry, err := Get(context.Background(), d, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := string(entry.GetValue()); v != expected {
+		t.Fatalf("expected cached value %s, got %s", expected, v)
+	}
+}
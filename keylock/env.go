@@ -0,0 +1,50 @@
+package keylock
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// PassphraseEnv is the environment variable the passphrase of the keystore
+// is read from.
+const PassphraseEnv = "IPFS_KEYSTORE_PASSPHRASE"
+
+// CredentialName is the name of the systemd credential (see LoadCredential=
+// in systemd.exec(5)) the passphrase of the keystore is read from.
+const CredentialName = "ipfs-keystore-passphrase"
+
+// EnvPassphrase returns the passphrase of the keystore given by the
+// environment, in PassphraseEnv or else in the credential CredentialName,
+// and whether there is one.
+func EnvPassphrase() ([]byte, bool, error) {
+	if pass, ok := os.LookupEnv(PassphraseEnv); ok {
+		return []byte(pass), true, nil
+	}
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return nil, false, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, CredentialName))
+	switch {
+	case os.IsNotExist(err):
+		return nil, false, nil
+	case err != nil:
+		return nil, false, err
+	}
+	return bytes.TrimRight(data, "\r\n"), true, nil
+}
+
+// UnlockFromEnv unlocks the keystore with the passphrase given by the
+// environment, if it is locked and there is one.
+func (ks *Keystore) UnlockFromEnv() error {
+	if !ks.Locked() {
+		return nil
+	}
+	pass, ok, err := EnvPassphrase()
+	if err != nil || !ok {
+		return err
+	}
+	return ks.Unlock(pass)
+}
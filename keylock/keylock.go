@@ -0,0 +1,544 @@
+// Package keylock is a keystore whose keys can be encrypted at rest with a
+// passphrase.
+//
+// The keys are files of a directory, named as by the keystore of
+// go-ipfs-keystore, which reads the keys stored in clear. Once the keystore is
+// encrypted, each private key is sealed with AES-GCM under a key derived from
+// the passphrase with scrypt, next to its public key stored in clear, so that
+// the keys can be listed and told apart while the keystore is locked. The
+// private keys are read and written once the keystore is unlocked with the
+// passphrase, which is not stored.
+package keylock
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	logging "github.com/ipfs/go-log"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	"golang.org/x/crypto/scrypt"
+)
+
+var log = logging.Logger("keylock")
+
+// ErrLocked is the error of the operations on the private keys of an
+// encrypted keystore while it is locked.
+var ErrLocked = errors.New("the keystore is locked, unlock it with 'ipfs key unlock'")
+
+// ErrWrongPassphrase is the error of unlocking the keystore with a wrong
+// passphrase.
+var ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+
+// ErrNotEncrypted is the error of unlocking or decrypting a keystore which is
+// not encrypted.
+var ErrNotEncrypted = errors.New("the keystore is not encrypted")
+
+// ErrEncrypted is the error of encrypting a keystore which is encrypted.
+var ErrEncrypted = errors.New("the keystore is already encrypted")
+
+const (
+	keyFilenamePrefix = "key_"
+	// encryptionFilename is the name of the file of the parameters of the
+	// encryption, in the directory of the keystore
+	encryptionFilename = "encryption"
+
+	// the parameters of scrypt for the new passphrases
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltSize = 32
+)
+
+// sealedMagic starts the files of the sealed keys, which the marshalled
+// private keys never start with.
+var sealedMagic = []byte("\x00keylock\x01")
+
+// check is sealed with the key of the entries in the parameters of the
+// encryption, telling whether a passphrase is the right one.
+var check = []byte("ipfs keystore")
+
+var codec = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// encryption holds the parameters of the encryption of a keystore.
+type encryption struct {
+	N, R, P int
+	Salt    []byte
+	Check   []byte
+}
+
+func (e *encryption) derive(passphrase []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, e.Salt, e.N, e.R, e.P, 32)
+}
+
+// Keystore is a keystore backed by the files of a directory, whose keys can
+// be encrypted. It implements keystore.Keystore.
+type Keystore struct {
+	dir string
+
+	mu sync.RWMutex
+	// enc is nil while the keys are stored in clear
+	enc *encryption
+	// key seals the private keys, nil while the keystore is locked
+	key []byte
+}
+
+var _ keystore.Keystore = (*Keystore)(nil)
+
+// Open returns the keystore of dir, created if it does not exist. An
+// encrypted keystore is opened locked.
+func Open(dir string) (*Keystore, error) {
+	if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	ks := &Keystore{dir: dir}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, encryptionFilename))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		var enc encryption
+		if err := json.Unmarshal(data, &enc); err != nil {
+			return nil, fmt.Errorf("reading the encryption of the keystore: %w", err)
+		}
+		ks.enc = &enc
+	}
+	return ks, nil
+}
+
+// Of returns the Keystore ks is, or wraps: keystores adding keys to another
+// one return it from an Unwrap method.
+func Of(ks keystore.Keystore) (*Keystore, bool) {
+	for {
+		switch k := ks.(type) {
+		case *Keystore:
+			return k, true
+		case interface{ Unwrap() keystore.Keystore }:
+			ks = k.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// Encrypted returns whether the keys are encrypted.
+func (ks *Keystore) Encrypted() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.enc != nil
+}
+
+// Locked returns whether the keys are encrypted and the keystore is not
+// unlocked.
+func (ks *Keystore) Locked() bool {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.enc != nil && ks.key == nil
+}
+
+// Unlock unlocks the keystore with passphrase, or fails with
+// ErrWrongPassphrase.
+func (ks *Keystore) Unlock(passphrase []byte) error {
+	ks.mu.RLock()
+	enc := ks.enc
+	ks.mu.RUnlock()
+	if enc == nil {
+		return ErrNotEncrypted
+	}
+
+	key, err := enc.derive(passphrase)
+	if err != nil {
+		return err
+	}
+	if plain, err := open(key, enc.Check, nil); err != nil || !bytes.Equal(plain, check) {
+		return ErrWrongPassphrase
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.key = key
+	return nil
+}
+
+// Lock forgets the key of the private keys, until the keystore is unlocked
+// again.
+func (ks *Keystore) Lock() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.key = nil
+}
+
+// Encrypt encrypts the keys with passphrase, leaving the keystore unlocked.
+func (ks *Keystore) Encrypt(passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return errors.New("the passphrase is empty")
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.enc != nil {
+		return ErrEncrypted
+	}
+
+	enc := &encryption{N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, saltSize)}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return err
+	}
+	key, err := enc.derive(passphrase)
+	if err != nil {
+		return err
+	}
+	if enc.Check, err = seal(key, check, nil); err != nil {
+		return err
+	}
+	data, err := json.Marshal(enc)
+	if err != nil {
+		return err
+	}
+
+	// the keys stored in clear are still read once the encryption is saved,
+	// should the keystore be left half encrypted
+	if err := writeFile(filepath.Join(ks.dir, encryptionFilename), data, 0600); err != nil {
+		return err
+	}
+	ks.enc, ks.key = enc, key
+
+	names, err := ks.list()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		sk, err := ks.get(name)
+		if err != nil {
+			return err
+		}
+		if err := ks.write(name, sk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decrypt stores the keys of the unlocked keystore in clear.
+func (ks *Keystore) Decrypt() error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.enc == nil {
+		return ErrNotEncrypted
+	}
+	if ks.key == nil {
+		return ErrLocked
+	}
+
+	names, err := ks.list()
+	if err != nil {
+		return err
+	}
+	sks := make(map[string]ci.PrivKey, len(names))
+	for _, name := range names {
+		if sks[name], err = ks.get(name); err != nil {
+			return err
+		}
+	}
+
+	enc, key := ks.enc, ks.key
+	ks.enc, ks.key = nil, nil
+	for name, sk := range sks {
+		if err := ks.write(name, sk); err != nil {
+			ks.enc, ks.key = enc, key
+			return err
+		}
+	}
+	return os.Remove(filepath.Join(ks.dir, encryptionFilename))
+}
+
+// Has returns whether or not a key exists in the Keystore
+func (ks *Keystore) Has(name string) (bool, error) {
+	kp, err := ks.path(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(kp)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put stores a key in the Keystore, if a key with the same name already
+// exists, returns ErrKeyExists. The key is sealed if the keystore is
+// encrypted, which must then be unlocked.
+func (ks *Keystore) Put(name string, k ci.PrivKey) error {
+	kp, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	data, err := ks.marshal(k)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.OpenFile(kp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if err != nil {
+		if os.IsExist(err) {
+			err = keystore.ErrKeyExists
+		}
+		return err
+	}
+	defer fi.Close()
+
+	_, err = fi.Write(data)
+	return err
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns
+// ErrNoSuchKey otherwise. The keys sealed are only read while the keystore is
+// unlocked, failing with ErrLocked otherwise.
+func (ks *Keystore) Get(name string) (ci.PrivKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.get(name)
+}
+
+// PublicKey returns the public key of a key, which is read while the keystore
+// is locked.
+func (ks *Keystore) PublicKey(name string) (ci.PubKey, error) {
+	data, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sealedMagic) {
+		sk, err := ci.UnmarshalPrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		return sk.GetPublic(), nil
+	}
+	pub, _, err := splitSealed(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", name, err)
+	}
+	return ci.UnmarshalPublicKey(pub)
+}
+
+// Delete removes a key from the Keystore
+func (ks *Keystore) Delete(name string) error {
+	kp, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(kp)
+}
+
+// List return a list of key identifier
+func (ks *Keystore) List() ([]string, error) {
+	return ks.list()
+}
+
+func (ks *Keystore) list() ([]string, error) {
+	dir, err := os.Open(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(names))
+	for _, name := range names {
+		// the temporary files start with a dot
+		if name == encryptionFilename || strings.HasPrefix(name, ".") {
+			continue
+		}
+		decoded, err := decode(name)
+		if err != nil {
+			log.Errorf("Ignoring keyfile with invalid encoded filename: %s", name)
+			continue
+		}
+		list = append(list, decoded)
+	}
+	return list, nil
+}
+
+func (ks *Keystore) path(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("key name must be at least one character")
+	}
+	return filepath.Join(ks.dir, keyFilenamePrefix+strings.ToLower(codec.EncodeToString([]byte(name)))), nil
+}
+
+func (ks *Keystore) read(name string) ([]byte, error) {
+	kp, err := ks.path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(kp)
+	if os.IsNotExist(err) {
+		return nil, keystore.ErrNoSuchKey
+	}
+	return data, err
+}
+
+// get reads a key, with ks.mu held.
+func (ks *Keystore) get(name string) (ci.PrivKey, error) {
+	data, err := ks.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sealedMagic) {
+		return ci.UnmarshalPrivateKey(data)
+	}
+
+	if ks.key == nil {
+		return nil, fmt.Errorf("key %s: %w", name, ErrLocked)
+	}
+	pub, sealed, err := splitSealed(data)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", name, err)
+	}
+	plain, err := open(ks.key, sealed, pub)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %s: %w", name, err)
+	}
+	return ci.UnmarshalPrivateKey(plain)
+}
+
+// write replaces a key, with ks.mu held.
+func (ks *Keystore) write(name string, sk ci.PrivKey) error {
+	kp, err := ks.path(name)
+	if err != nil {
+		return err
+	}
+	data, err := ks.marshal(sk)
+	if err != nil {
+		return err
+	}
+	return writeFile(kp, data, 0400)
+}
+
+// marshal returns the data of the file of sk, sealed if the keystore is
+// encrypted, with ks.mu held.
+func (ks *Keystore) marshal(sk ci.PrivKey) ([]byte, error) {
+	data, err := ci.MarshalPrivateKey(sk)
+	if err != nil || ks.enc == nil {
+		return data, err
+	}
+	if ks.key == nil {
+		return nil, ErrLocked
+	}
+
+	pub, err := ci.MarshalPublicKey(sk.GetPublic())
+	if err != nil {
+		return nil, err
+	}
+	// the public key is authenticated along with the private one
+	sealed, err := seal(ks.key, data, pub)
+	if err != nil {
+		return nil, err
+	}
+	var l [binary.MaxVarintLen64]byte
+	out := append([]byte{}, sealedMagic...)
+	out = append(out, l[:binary.PutUvarint(l[:], uint64(len(pub)))]...)
+	out = append(out, pub...)
+	return append(out, sealed...), nil
+}
+
+// splitSealed returns the public key and the sealed private key of the data
+// of a sealed key.
+func splitSealed(data []byte) (pub, sealed []byte, err error) {
+	data = data[len(sealedMagic):]
+	n, l := binary.Uvarint(data)
+	if l <= 0 || uint64(len(data)-l) < n {
+		return nil, nil, errors.New("truncated sealed key")
+	}
+	data = data[l:]
+	return data[:n], data[n:], nil
+}
+
+// seal encrypts plain with key, returning the nonce followed by the
+// ciphertext.
+func seal(key, plain, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, additional), nil
+}
+
+func open(key, sealed, additional []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("truncated sealed data")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additional)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFile replaces the file p with data, through a temporary file renamed
+// over it.
+func writeFile(p string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func decode(name string) (string, error) {
+	if !strings.HasPrefix(name, keyFilenamePrefix) {
+		return "", fmt.Errorf("key's filename has unexpected format")
+	}
+	decoded, err := codec.DecodeString(strings.ToUpper(name[len(keyFilenamePrefix):]))
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
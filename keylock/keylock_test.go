@@ -0,0 +1,172 @@
+package keylock
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func genKey(t *testing.T) ci.PrivKey {
+	sk, _, err := ci.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sk
+}
+
+func TestKeystore(t *testing.T) {
+	dir := t.TempDir()
+
+	// the keys stored in clear by go-ipfs-keystore are read
+	fsks, err := keystore.NewFSKeystore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clear := genKey(t)
+	if err := fsks.Put("clear", clear); err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Encrypted() || ks.Locked() {
+		t.Fatal("expected a keystore in clear")
+	}
+	if sk, err := ks.Get("clear"); err != nil || !sk.Equals(clear) {
+		t.Fatalf("expected the key in clear read, got %v", err)
+	}
+	if err := ks.Unlock([]byte("secret")); err != ErrNotEncrypted {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+
+	if err := ks.Encrypt([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Encrypt([]byte("secret")); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+	sealed := genKey(t)
+	if err := ks.Put("sealed", sealed); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("sealed", sealed); err != keystore.ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+
+	// no private key is left in clear
+	raw, _ := ci.MarshalPrivateKey(clear)
+	for _, name := range []string{"clear", "sealed"} {
+		kp, _ := ks.path(name)
+		data, err := ioutil.ReadFile(kp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, sealedMagic) || bytes.Contains(data, raw) {
+			t.Fatalf("expected %s sealed", name)
+		}
+	}
+
+	// a keystore opened again is locked
+	ks, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ks.Locked() {
+		t.Fatal("expected the keystore locked")
+	}
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "clear" || names[1] != "sealed" {
+		t.Fatalf("unexpected keys %v", names)
+	}
+	if pk, err := ks.PublicKey("sealed"); err != nil || !pk.Equals(sealed.GetPublic()) {
+		t.Fatalf("expected the public key read while locked, got %v", err)
+	}
+	if _, err := ks.Get("sealed"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := ks.Put("other", genKey(t)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if _, err := ks.Get("missing"); err != keystore.ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+
+	if err := ks.Unlock([]byte("wrong")); err != ErrWrongPassphrase {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+	if err := ks.Unlock([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]ci.PrivKey{"clear": clear, "sealed": sealed} {
+		if sk, err := ks.Get(name); err != nil || !sk.Equals(want) {
+			t.Fatalf("expected %s read once unlocked, got %v", name, err)
+		}
+	}
+	ks.Lock()
+	if _, err := ks.Get("sealed"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked once locked again, got %v", err)
+	}
+
+	// the keys decrypted are read by go-ipfs-keystore
+	if err := ks.Decrypt(); err != ErrLocked {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := ks.Unlock([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Decrypt(); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Encrypted() {
+		t.Fatal("expected the keystore in clear")
+	}
+	if sk, err := fsks.Get("sealed"); err != nil || !sk.Equals(sealed) {
+		t.Fatalf("expected the key decrypted, got %v", err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(dir, encryptionFilename)); err == nil {
+		t.Fatal("expected the encryption removed")
+	}
+}
+
+// setenv sets the variable k to v until the end of the test.
+func setenv(t *testing.T, k, v string) {
+	old, ok := os.LookupEnv(k)
+	if err := os.Setenv(k, v); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(k, old)
+		} else {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestEnvPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, CredentialName), []byte("from-systemd\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setenv(t, "CREDENTIALS_DIRECTORY", dir)
+	if pass, ok, err := EnvPassphrase(); err != nil || !ok || string(pass) != "from-systemd" {
+		t.Fatalf("expected the credential read, got %q, %v", pass, err)
+	}
+	setenv(t, PassphraseEnv, "from-env")
+	if pass, ok, err := EnvPassphrase(); err != nil || !ok || string(pass) != "from-env" {
+		t.Fatalf("expected the variable read, got %q, %v", pass, err)
+	}
+}
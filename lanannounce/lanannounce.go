@@ -0,0 +1,297 @@
+// Package lanannounce announces the root CIDs of the data recently added to
+// the node to the peers of its local network, found with mDNS, which look the
+// CIDs up there before asking the DHT: the nodes of a cluster on the same
+// network fetch the data added by each other right away.
+//
+// The CIDs are sent over a libp2p protocol, one per line, to the peers of the
+// local network only, and are accepted from them only: the peers found with
+// mDNS, or connected from a private address. A peer joining the local network
+// is sent the CIDs added recently. The announcements received expire after a
+// while.
+package lanannounce
+
+import (
+	"bufio"
+	"context"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var log = logging.Logger("lanannounce")
+
+var (
+	sent = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_lanannounce_sent_total",
+		Help: "CIDs announced to the peers of the local network",
+	})
+	received = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ipfs_lanannounce_received_total",
+		Help: "CIDs announced by the peers of the local network",
+	})
+)
+
+// ID is the protocol the CIDs are announced with.
+const ID protocol.ID = "/ipfs/lan-announce/1.0.0"
+
+const (
+	// maxRecent is how many of the CIDs added recently are sent to a peer
+	// joining the local network.
+	maxRecent = 64
+	// maxAnnounce is the most CIDs read from a stream.
+	maxAnnounce = maxRecent
+	// maxKnown is the most CIDs announced by the peers kept at once.
+	maxKnown = 4096
+	// batchDelay is how long the CIDs added are gathered before they are
+	// sent, in a single stream to each peer.
+	batchDelay  = 100 * time.Millisecond
+	sendTimeout = 10 * time.Second
+	readTimeout = 10 * time.Second
+
+	connTag    = "lan-announce"
+	connWeight = 20
+)
+
+// Settings configures the announcer.
+type Settings struct {
+	// TTL is how long the CIDs announced by a peer are looked up there.
+	TTL time.Duration
+}
+
+// Announcer announces the CIDs added to the peers of the local network, and
+// finds the CIDs they announce.
+type Announcer struct {
+	h   host.Host
+	ttl time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	notify chan struct{}
+
+	mu      sync.Mutex
+	peers   map[peer.ID]struct{}
+	recent  []cid.Cid // the CIDs added recently, the latest last
+	pending []cid.Cid // the CIDs added not sent yet
+	// known are the peers announcing each CID, with when they expire
+	known map[cid.Cid]map[peer.ID]time.Time
+}
+
+// New returns the announcer of h, started.
+func New(h host.Host, s Settings) *Announcer {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Announcer{
+		h:      h,
+		ttl:    s.TTL,
+		ctx:    ctx,
+		cancel: cancel,
+		notify: make(chan struct{}, 1),
+		peers:  make(map[peer.ID]struct{}),
+		known:  make(map[cid.Cid]map[peer.ID]time.Time),
+	}
+	h.SetStreamHandler(ID, a.handleStream)
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// Close stops the announcer.
+func (a *Announcer) Close() error {
+	a.h.RemoveStreamHandler(ID)
+	a.cancel()
+	a.wg.Wait()
+	return nil
+}
+
+// AddPeer adds p, found on the local network, to the peers the CIDs are
+// announced to and accepted from, and sends it the CIDs added recently.
+func (a *Announcer) AddPeer(p peer.ID) {
+	if p == a.h.ID() {
+		return
+	}
+	a.mu.Lock()
+	_, ok := a.peers[p]
+	a.peers[p] = struct{}{}
+	recent := append([]cid.Cid(nil), a.recent...)
+	a.mu.Unlock()
+	if ok {
+		return
+	}
+	// the connection is kept, as the data is fetched from the peer
+	a.h.ConnManager().TagPeer(p, connTag, connWeight)
+	if len(recent) > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.send(p, recent)
+		}()
+	}
+}
+
+// Announce announces c, the root CID of data added, to the peers of the local
+// network.
+func (a *Announcer) Announce(c cid.Cid) {
+	a.mu.Lock()
+	a.recent = append(a.recent, c)
+	if len(a.recent) > maxRecent {
+		a.recent = a.recent[len(a.recent)-maxRecent:]
+	}
+	a.pending = append(a.pending, c)
+	a.mu.Unlock()
+	select {
+	case a.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (a *Announcer) run() {
+	defer a.wg.Done()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-a.notify:
+		}
+		// the CIDs added together are sent together
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(batchDelay):
+		}
+
+		a.mu.Lock()
+		cids := a.pending
+		a.pending = nil
+		peers := make([]peer.ID, 0, len(a.peers))
+		for p := range a.peers {
+			peers = append(peers, p)
+		}
+		a.mu.Unlock()
+
+		var wg sync.WaitGroup
+		for _, p := range peers {
+			wg.Add(1)
+			go func(p peer.ID) {
+				defer wg.Done()
+				a.send(p, cids)
+			}(p)
+		}
+		wg.Wait()
+	}
+}
+
+// send sends cids to p, if it is connected.
+func (a *Announcer) send(p peer.ID, cids []cid.Cid) {
+	if a.h.Network().Connectedness(p) != network.Connected {
+		return
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, sendTimeout)
+	defer cancel()
+	s, err := a.h.NewStream(ctx, p, ID)
+	if err != nil {
+		log.Debugf("announcing to %s: %s", p, err)
+		return
+	}
+	s.SetWriteDeadline(time.Now().Add(sendTimeout))
+	w := bufio.NewWriter(s)
+	for _, c := range cids {
+		w.WriteString(c.String())
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		log.Debugf("announcing to %s: %s", p, err)
+		s.Reset()
+		return
+	}
+	s.Close()
+	sent.Add(float64(len(cids)))
+}
+
+func (a *Announcer) handleStream(s network.Stream) {
+	defer s.Close()
+	p := s.Conn().RemotePeer()
+	if !a.local(p, s.Conn().RemoteMultiaddr()) {
+		s.Reset()
+		return
+	}
+
+	s.SetReadDeadline(time.Now().Add(readTimeout))
+	sc := bufio.NewScanner(s)
+	sc.Buffer(make([]byte, 0, 256), 256)
+	expires := time.Now().Add(a.ttl)
+	for n := 0; n < maxAnnounce && sc.Scan(); n++ {
+		c, err := cid.Decode(sc.Text())
+		if err != nil {
+			s.Reset()
+			return
+		}
+		a.mu.Lock()
+		a.addKnown(c, p, expires)
+		a.mu.Unlock()
+		received.Inc()
+	}
+}
+
+// local returns whether p, connected from addr, is a peer of the local
+// network: one found with mDNS, or connected from a private address, as the
+// peers which announce before they are found are.
+func (a *Announcer) local(p peer.ID, addr ma.Multiaddr) bool {
+	a.mu.Lock()
+	_, ok := a.peers[p]
+	a.mu.Unlock()
+	return ok || manet.IsPrivateAddr(addr) || manet.IsIPLoopback(addr)
+}
+
+// addKnown records that p announced c, until expires.
+func (a *Announcer) addKnown(c cid.Cid, p peer.ID, expires time.Time) {
+	if _, ok := a.known[c]; !ok && len(a.known) >= maxKnown {
+		a.expire(time.Now())
+		if len(a.known) >= maxKnown {
+			return
+		}
+	}
+	ps, ok := a.known[c]
+	if !ok {
+		ps = make(map[peer.ID]time.Time)
+		a.known[c] = ps
+	}
+	ps[p] = expires
+}
+
+// expire removes the announcements expired at now.
+func (a *Announcer) expire(now time.Time) {
+	for c, ps := range a.known {
+		for p, expires := range ps {
+			if !now.Before(expires) {
+				delete(ps, p)
+			}
+		}
+		if len(ps) == 0 {
+			delete(a.known, c)
+		}
+	}
+}
+
+// Providers returns the peers of the local network which announced c.
+func (a *Announcer) Providers(c cid.Cid) []peer.ID {
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []peer.ID
+	for p, expires := range a.known[c] {
+		if now.Before(expires) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package lanannounce
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, data string) cid.Cid {
+	h, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+// waitProviders waits for a to find the providers of c.
+func waitProviders(t *testing.T, a *Announcer, c cid.Cid, want int) []peer.ID {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ps := a.Providers(c)
+		if len(ps) >= want {
+			return ps
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d providers of %s, got %v", want, c, ps)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAnnounce(t *testing.T) {
+	mn, err := mocknet.FullMeshConnected(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	settings := Settings{TTL: time.Minute}
+	a, b, outsider := New(hosts[0], settings), New(hosts[1], settings), New(hosts[2], settings)
+	defer a.Close()
+	defer b.Close()
+	defer outsider.Close()
+
+	// a peer joining is sent the CIDs added before
+	before := testCid(t, "before")
+	a.Announce(before)
+	time.Sleep(2 * batchDelay)
+	a.AddPeer(b.h.ID())
+	b.AddPeer(a.h.ID())
+	if ps := waitProviders(t, b, before, 1); ps[0] != a.h.ID() {
+		t.Fatalf("expected a providing, got %v", ps)
+	}
+
+	added := testCid(t, "added")
+	a.Announce(added)
+	waitProviders(t, b, added, 1)
+	var found []peer.AddrInfo
+	for pi := range b.FindProvidersAsync(context.Background(), added, 0) {
+		found = append(found, pi)
+	}
+	if len(found) != 1 || found[0].ID != a.h.ID() || len(found[0].Addrs) == 0 {
+		t.Fatalf("expected a found with its addresses, got %v", found)
+	}
+
+	// the peers not of the local network are not announced to
+	if ps := outsider.Providers(added); len(ps) != 0 {
+		t.Fatalf("expected nothing announced to the outsider, got %v", ps)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	mn, err := mocknet.FullMeshConnected(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(mn.Hosts()[0], Settings{TTL: time.Minute})
+	defer a.Close()
+	c := testCid(t, "added")
+	p := mn.Hosts()[1].ID()
+
+	a.mu.Lock()
+	a.addKnown(c, p, time.Now().Add(-time.Second))
+	a.mu.Unlock()
+	if ps := a.Providers(c); len(ps) != 0 {
+		t.Fatalf("expected the announcement expired, got %v", ps)
+	}
+
+	// the expired announcements make room for the new ones
+	a.mu.Lock()
+	for i := 1; i < maxKnown; i++ {
+		a.addKnown(testCid(t, string(rune(i))), p, time.Now().Add(-time.Second))
+	}
+	fresh := testCid(t, "fresh")
+	a.addKnown(fresh, p, time.Now().Add(time.Minute))
+	n := len(a.known)
+	a.mu.Unlock()
+	if n != 1 || len(a.Providers(fresh)) != 1 {
+		t.Fatalf("expected only the new announcement kept, got %d", n)
+	}
+}
@@ -0,0 +1,32 @@
+package lanannounce
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+var _ routing.ContentRouting = (*Announcer)(nil)
+
+// Provide does nothing: the CIDs are announced when they are added, not when
+// they are provided.
+func (a *Announcer) Provide(context.Context, cid.Cid, bool) error {
+	return nil
+}
+
+// FindProvidersAsync returns the peers of the local network which announced
+// c, with their addresses.
+func (a *Announcer) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	peers := a.Providers(c)
+	if count > 0 && len(peers) > count {
+		peers = peers[:count]
+	}
+	out := make(chan peer.AddrInfo, len(peers))
+	for _, p := range peers {
+		out <- a.h.Peerstore().PeerInfo(p)
+	}
+	close(out)
+	return out
+}
@@ -0,0 +1,262 @@
+// Package lowpower implements the low-power mode of the daemon, for battery
+// or solar powered devices.
+//
+// When enabled, network activity follows a duty cycle: the node is awake for
+// a while, then sleeps for a while. Provides made while asleep are batched
+// until the node wakes up, reprovides and IPNS republishes are deferred to
+// the awake periods and spaced out further, and connections are trimmed when
+// falling asleep.
+package lowpower
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("lowpower")
+
+// Settings configures the low-power mode.
+type Settings struct {
+	// Awake is how long the node is awake in each duty cycle.
+	Awake time.Duration
+	// Sleep is how long the node sleeps in each duty cycle.
+	Sleep time.Duration
+	// IntervalMultiplier lengthens the reprovide and republish intervals.
+	IntervalMultiplier int
+}
+
+// Validate returns an error if s is not usable.
+func (s Settings) Validate() error {
+	if s.Awake <= 0 {
+		return fmt.Errorf("awake duration must be positive: %s", s.Awake)
+	}
+	if s.Sleep < 0 {
+		return fmt.Errorf("sleep duration must not be negative: %s", s.Sleep)
+	}
+	if s.IntervalMultiplier < 1 {
+		return fmt.Errorf("interval multiplier must be at least 1: %d", s.IntervalMultiplier)
+	}
+	return nil
+}
+
+// Status is the state of the low-power mode.
+type Status struct {
+	Enabled bool
+	Asleep  bool
+	// Until is when the current awake or sleep period ends, if enabled.
+	Until time.Time
+	Settings
+}
+
+// Controller switches the low-power mode on and off, and runs its duty
+// cycle.
+type Controller struct {
+	mu       sync.Mutex
+	enabled  bool
+	settings Settings
+	asleep   bool
+	until    time.Time
+	// awake is closed while the node is awake.
+	awake chan struct{}
+	// stop stops the current duty cycle.
+	stop context.CancelFunc
+
+	hooksMu sync.Mutex
+	onWake  []func()
+	onSleep []func()
+
+	wg sync.WaitGroup
+}
+
+// New returns a controller with the low-power mode disabled, and enabled with
+// s by default.
+func New(s Settings) *Controller {
+	awake := make(chan struct{})
+	close(awake)
+	return &Controller{settings: s, awake: awake}
+}
+
+// OnWake registers f to be called every time the node wakes up.
+func (c *Controller) OnWake(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.onWake = append(c.onWake, f)
+}
+
+// OnSleep registers f to be called every time the node falls asleep.
+func (c *Controller) OnSleep(f func()) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.onSleep = append(c.onSleep, f)
+}
+
+func (c *Controller) runHooks(asleep bool) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+
+	hooks := c.onWake
+	if asleep {
+		hooks = c.onSleep
+	}
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// Enable enables the low-power mode with s, or changes its settings if it is
+// enabled already. The node starts awake.
+func (c *Controller) Enable(s Settings) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.stop != nil {
+		c.stop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.stop = cancel
+	c.enabled = true
+	c.settings = s
+	woken := c.setAsleep(false)
+	c.until = time.Now().Add(s.Awake)
+	c.mu.Unlock()
+
+	if woken {
+		c.runHooks(false)
+	}
+	c.wg.Add(1)
+	go c.cycle(ctx, s)
+	log.Infof("low-power mode enabled: awake %s, asleep %s", s.Awake, s.Sleep)
+	return nil
+}
+
+// Disable disables the low-power mode, waking the node up.
+func (c *Controller) Disable() {
+	c.mu.Lock()
+	if c.stop != nil {
+		c.stop()
+		c.stop = nil
+	}
+	wasEnabled := c.enabled
+	c.enabled = false
+	woken := c.setAsleep(false)
+	c.until = time.Time{}
+	c.mu.Unlock()
+
+	if woken {
+		c.runHooks(false)
+	}
+	if wasEnabled {
+		log.Info("low-power mode disabled")
+	}
+}
+
+// setAsleep sets whether the node is asleep, and reports whether that
+// changed. c.mu must be held.
+func (c *Controller) setAsleep(asleep bool) bool {
+	if c.asleep == asleep {
+		return false
+	}
+	c.asleep = asleep
+	if asleep {
+		c.awake = make(chan struct{})
+	} else {
+		close(c.awake)
+	}
+	return true
+}
+
+// cycle alternates between awake and sleep periods until ctx is canceled,
+// starting with the awake period set up by Enable.
+func (c *Controller) cycle(ctx context.Context, s Settings) {
+	defer c.wg.Done()
+
+	asleep := false
+	d := s.Awake
+	for {
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		// without sleep periods, the node stays awake
+		asleep = !asleep && s.Sleep > 0
+		d = s.Awake
+		if asleep {
+			d = s.Sleep
+		}
+
+		c.mu.Lock()
+		if ctx.Err() != nil {
+			c.mu.Unlock()
+			return
+		}
+		changed := c.setAsleep(asleep)
+		c.until = time.Now().Add(d)
+		c.mu.Unlock()
+
+		if changed {
+			log.Debugf("low-power mode: asleep %t for %s", asleep, d)
+			c.runHooks(asleep)
+		}
+	}
+}
+
+// Status returns the state of the low-power mode.
+func (c *Controller) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Status{
+		Enabled:  c.enabled,
+		Asleep:   c.asleep,
+		Until:    c.until,
+		Settings: c.settings,
+	}
+}
+
+// Asleep reports whether the node is asleep.
+func (c *Controller) Asleep() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.asleep
+}
+
+// WaitAwake waits until the node is awake, or ctx is canceled.
+func (c *Controller) WaitAwake(ctx context.Context) error {
+	c.mu.Lock()
+	awake := c.awake
+	c.mu.Unlock()
+
+	select {
+	case <-awake:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stretch returns the interval d lengthened by the interval multiplier if the
+// low-power mode is enabled, and d otherwise.
+func (c *Controller) Stretch(d time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return d
+	}
+	return d * time.Duration(c.settings.IntervalMultiplier)
+}
+
+// Close stops the duty cycle, leaving the node awake.
+func (c *Controller) Close() error {
+	c.Disable()
+	c.wg.Wait()
+	return nil
+}
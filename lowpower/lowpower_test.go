@@ -0,0 +1,122 @@
+package lowpower
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestDutyCycle(t *testing.T) {
+	c := New(Settings{Awake: 50 * time.Millisecond, Sleep: 50 * time.Millisecond, IntervalMultiplier: 3})
+	defer c.Close()
+
+	woken := make(chan struct{}, 10)
+	slept := make(chan struct{}, 10)
+	c.OnWake(func() { woken <- struct{}{} })
+	c.OnSleep(func() { slept <- struct{}{} })
+
+	if c.Stretch(time.Hour) != time.Hour {
+		t.Fatal("interval stretched while disabled")
+	}
+
+	if err := c.Enable(c.Status().Settings); err != nil {
+		t.Fatal(err)
+	}
+	if c.Stretch(time.Hour) != 3*time.Hour {
+		t.Fatal("interval not stretched while enabled")
+	}
+
+	select {
+	case <-slept:
+	case <-time.After(time.Second):
+		t.Fatal("never fell asleep")
+	}
+	select {
+	case <-woken:
+	case <-time.After(time.Second):
+		t.Fatal("never woke up")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.WaitAwake(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Disable()
+	if st := c.Status(); st.Enabled || st.Asleep {
+		t.Fatalf("unexpected status after disabling: %+v", st)
+	}
+}
+
+func TestEnableInvalid(t *testing.T) {
+	c := New(Settings{Awake: time.Minute, IntervalMultiplier: 1})
+	defer c.Close()
+
+	if err := c.Enable(Settings{Awake: time.Minute}); err == nil {
+		t.Fatal("expected an error for a zero interval multiplier")
+	}
+	if c.Status().Enabled {
+		t.Fatal("enabled with invalid settings")
+	}
+}
+
+type fakeProvider struct {
+	mu       sync.Mutex
+	provided []cid.Cid
+}
+
+func (p *fakeProvider) Run() {}
+
+func (p *fakeProvider) Provide(k cid.Cid) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.provided = append(p.provided, k)
+	return nil
+}
+
+func (p *fakeProvider) Close() error { return nil }
+
+func (p *fakeProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.provided)
+}
+
+func TestProviderBatches(t *testing.T) {
+	c := New(Settings{Awake: time.Hour, IntervalMultiplier: 1})
+	defer c.Close()
+
+	inner := &fakeProvider{}
+	p := NewProvider(inner, c)
+
+	// put the node to sleep without running a duty cycle
+	c.mu.Lock()
+	c.setAsleep(true)
+	c.mu.Unlock()
+
+	for _, data := range []string{"a", "b", "a"} {
+		if err := p.Provide(dag.NodeWithData([]byte(data)).Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if inner.count() != 0 {
+		t.Fatal("provided while asleep")
+	}
+
+	c.Disable()
+	if n := inner.count(); n != 2 {
+		t.Fatalf("expected the 2 batched keys to be provided on wake, got %d", n)
+	}
+
+	if err := p.Provide(dag.NodeWithData([]byte("c")).Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if inner.count() != 3 {
+		t.Fatal("not provided while awake")
+	}
+}
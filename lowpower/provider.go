@@ -0,0 +1,135 @@
+package lowpower
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	provider "github.com/ipfs/go-ipfs-provider"
+)
+
+// Provider batches the provides made while the node is asleep, and provides
+// them when it wakes up.
+type Provider struct {
+	provider.Provider
+	c *Controller
+
+	mu      sync.Mutex
+	pending *cid.Set
+}
+
+// NewProvider returns p, batching provides while c is asleep.
+func NewProvider(p provider.Provider, c *Controller) *Provider {
+	bp := &Provider{Provider: p, c: c, pending: cid.NewSet()}
+	c.OnWake(bp.flush)
+	return bp
+}
+
+// Provide provides k, or defers it until the node wakes up.
+func (p *Provider) Provide(k cid.Cid) error {
+	p.mu.Lock()
+	if p.c.Asleep() {
+		p.pending.Add(k)
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.Unlock()
+	return p.Provider.Provide(k)
+}
+
+func (p *Provider) flush() {
+	p.mu.Lock()
+	pending := p.pending
+	p.pending = cid.NewSet()
+	p.mu.Unlock()
+
+	if pending.Len() > 0 {
+		log.Debugf("providing %d batched keys", pending.Len())
+	}
+	err := pending.ForEach(func(k cid.Cid) error {
+		return p.Provider.Provide(k)
+	})
+	if err != nil {
+		log.Errorf("providing batched keys: %s", err)
+	}
+}
+
+// Close queues the batched provides, which are persisted by the provider
+// queue, and closes the provider.
+func (p *Provider) Close() error {
+	p.flush()
+	return p.Provider.Close()
+}
+
+// Reprovider runs the reprovides of a reprovider with no interval of its
+// own, every interval, lengthened while the low-power mode is enabled, and
+// only while the node is awake. Reprovides that are triggered are run as
+// usual.
+type Reprovider struct {
+	provider.Reprovider
+	c        *Controller
+	interval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewReprovider returns r, running its reprovides every interval, as
+// lengthened by c.
+func NewReprovider(ctx context.Context, r provider.Reprovider, c *Controller, interval time.Duration) *Reprovider {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Reprovider{
+		Reprovider: r,
+		c:          c,
+		interval:   interval,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+}
+
+// Run runs the reprovider.
+func (r *Reprovider) Run() {
+	go r.Reprovider.Run()
+	defer close(r.done)
+
+	// like the simple reprovider, provide once after being up a minute
+	delay := r.interval
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	last := time.Now().Add(-r.interval).Add(delay)
+
+	// the interval is checked regularly, as it may be lengthened or
+	// shortened at any time
+	tick := delay
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.ctx.Done():
+			return
+		}
+		if time.Since(last) < r.c.Stretch(r.interval) {
+			continue
+		}
+		if err := r.c.WaitAwake(r.ctx); err != nil {
+			return
+		}
+		last = time.Now()
+		if err := r.Reprovider.Trigger(r.ctx); err != nil && r.ctx.Err() == nil {
+			log.Errorf("failed to reprovide: %s", err)
+		}
+	}
+}
+
+// Close stops the reprovider.
+func (r *Reprovider) Close() error {
+	r.cancel()
+	<-r.done
+	return r.Reprovider.Close()
+}
@@ -0,0 +1,67 @@
+package lowpower
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	ic "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// Republisher is the publisher of an IPNS republisher, which skips the
+// republishes made sooner than every interval, as lengthened while the
+// low-power mode is enabled, and defers them while the node is asleep.
+type Republisher struct {
+	namesys.Publisher
+	c        *Controller
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[peer.ID]time.Time
+}
+
+var _ namesys.Publisher = (*Republisher)(nil)
+
+// NewRepublisher returns p, to be used by a republisher running every
+// interval.
+func NewRepublisher(p namesys.Publisher, c *Controller, interval time.Duration) *Republisher {
+	return &Republisher{
+		Publisher: p,
+		c:         c,
+		interval:  interval,
+		last:      make(map[peer.ID]time.Time),
+	}
+}
+
+// PublishWithEOL republishes the record of name, unless it was republished
+// less than the lengthened interval ago.
+func (r *Republisher) PublishWithEOL(ctx context.Context, name ic.PrivKey, value path.Path, eol time.Time) error {
+	id, err := peer.IDFromPrivateKey(name)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	last, ok := r.last[id]
+	r.mu.Unlock()
+	// half an interval of slack, as the republisher runs every interval
+	if ok && time.Since(last) < r.c.Stretch(r.interval)-r.interval/2 {
+		log.Debugf("skipping republish of %s", id)
+		return nil
+	}
+
+	if err := r.c.WaitAwake(ctx); err != nil {
+		return err
+	}
+	if err := r.Publisher.PublishWithEOL(ctx, name, value, eol); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.last[id] = time.Now()
+	r.mu.Unlock()
+	return nil
+}
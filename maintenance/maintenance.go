@@ -0,0 +1,176 @@
+// Package maintenance holds the heavy background work of the node to
+// maintenance windows, opening on cron-like schedules, so that it lands in
+// off-peak hours.
+//
+// The tasks held to the windows wait for a window to open before they start,
+// for the garbage collection, or before each of their operations on the
+// blockstore, for the reprovides, the scrubbing of the repo and the
+// migrations of the blocks, which pause when the window closes and go on when
+// the next one opens.
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/go-ipfs/iothrottle"
+)
+
+var log = logging.Logger("maintenance")
+
+// Task is a kind of background work held to the maintenance windows.
+type Task string
+
+const (
+	// GC is the periodic garbage collection.
+	GC Task = "gc"
+	// Reprovide is the listing of the keys reprovided.
+	Reprovide Task = "reprovide"
+	// Scrub is the verification of the blocks, by 'ipfs repo verify' and
+	// 'ipfs repo fsck'.
+	Scrub Task = "scrub"
+	// Migrate is the copy of the blocks migrated to another datastore, by
+	// 'ipfs repo migrate-to' and 'ipfs repo compress'.
+	Migrate Task = "migrate"
+)
+
+// Tasks are all the tasks.
+var Tasks = []Task{GC, Reprovide, Scrub, Migrate}
+
+// ErrNoWindow is returned when no maintenance window opens anymore.
+var ErrNoWindow = errors.New("no maintenance window ahead")
+
+// Window is a maintenance window.
+type Window struct {
+	// Schedule is when the window opens, as a cron expression.
+	Schedule string
+	// Duration is how long the window stays open.
+	Duration time.Duration
+}
+
+type window struct {
+	schedule *schedule
+	duration time.Duration
+}
+
+// Scheduler holds tasks to maintenance windows. The nil Scheduler lets
+// everything run any time.
+type Scheduler struct {
+	windows []window
+	tasks   map[Task]bool
+	loc     *time.Location
+
+	mu sync.Mutex
+	// open and until cache whether a window is open, until when, or when
+	// the next one opens
+	open  bool
+	until time.Time
+}
+
+// New returns a Scheduler holding tasks to windows, whose schedules are in
+// the time zone loc.
+func New(windows []Window, tasks []Task, loc *time.Location) (*Scheduler, error) {
+	if len(windows) == 0 {
+		return nil, errors.New("no maintenance window")
+	}
+	s := &Scheduler{tasks: make(map[Task]bool, len(tasks)), loc: loc}
+	for _, w := range windows {
+		sched, err := parseSchedule(w.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		if w.Duration <= 0 {
+			return nil, fmt.Errorf("the duration of the maintenance window %q must be positive: %s", w.Schedule, w.Duration)
+		}
+		if sched.next(time.Now().In(loc)).IsZero() {
+			return nil, fmt.Errorf("the maintenance window %q never opens", w.Schedule)
+		}
+		s.windows = append(s.windows, window{schedule: sched, duration: w.Duration})
+	}
+	for _, t := range tasks {
+		if !known(t) {
+			return nil, fmt.Errorf("unknown maintenance task %q", t)
+		}
+		s.tasks[t] = true
+	}
+	return s, nil
+}
+
+func known(t Task) bool {
+	for _, k := range Tasks {
+		if t == k {
+			return true
+		}
+	}
+	return false
+}
+
+// State returns whether a window is open at now, and until when, or when the
+// next one opens, the zero time if none does.
+func (s *Scheduler) State(now time.Time) (open bool, until time.Time) {
+	now = now.In(s.loc)
+	for _, w := range s.windows {
+		// the first start within the duration of the window before now
+		if start := w.schedule.next(now.Add(-w.duration)); !start.IsZero() && !start.After(now) {
+			if end := start.Add(w.duration); !open || end.After(until) {
+				open, until = true, end
+			}
+			continue
+		}
+		if open {
+			continue
+		}
+		if start := w.schedule.next(now); !start.IsZero() && (until.IsZero() || start.Before(until)) {
+			until = start
+		}
+	}
+	return open, until
+}
+
+// Wait waits until a window is open if task is held to the windows, or until
+// ctx is canceled.
+func (s *Scheduler) Wait(ctx context.Context, task Task) error {
+	if s == nil || !s.tasks[task] {
+		return ctx.Err()
+	}
+	for {
+		now := time.Now()
+		s.mu.Lock()
+		if !now.Before(s.until) {
+			s.open, s.until = s.State(now)
+		}
+		open, until := s.open, s.until
+		s.mu.Unlock()
+
+		if open {
+			return ctx.Err()
+		}
+		if until.IsZero() {
+			return ErrNoWindow
+		}
+		log.Debugf("%s waits for the maintenance window at %s", task, until)
+		timer := time.NewTimer(until.Sub(now))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Limiter returns l holding each operation of task back until a window is
+// open, or l if task is not held to the windows.
+func (s *Scheduler) Limiter(task Task, l *iothrottle.Limiter) *iothrottle.Limiter {
+	if s == nil || !s.tasks[task] {
+		return l
+	}
+	return iothrottle.Gated(l, func(ctx context.Context) error {
+		return s.Wait(ctx, task)
+	})
+}
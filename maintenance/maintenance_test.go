@@ -0,0 +1,141 @@
+package maintenance
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-ipfs/iothrottle"
+)
+
+func TestScheduleNext(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	// a Wednesday
+	at := time.Date(2021, 6, 2, 10, 30, 15, 0, time.UTC)
+	for _, c := range []struct {
+		spec string
+		from time.Time
+		next time.Time
+	}{
+		{"0 2 * * *", at, time.Date(2021, 6, 3, 2, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", at, time.Date(2021, 6, 2, 10, 40, 0, 0, time.UTC)},
+		{"30 10 * * *", at, time.Date(2021, 6, 3, 10, 30, 0, 0, time.UTC)},
+		{"0 22-23 * * 1-5", at, time.Date(2021, 6, 2, 22, 0, 0, 0, time.UTC)},
+		{"0 3 * * 6,7", at, time.Date(2021, 6, 5, 3, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", at, time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// either day matches when both are set
+		{"0 0 15 * 4", at, time.Date(2021, 6, 3, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", at, time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", at, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", at, time.Time{}},
+		// in the time zone of the time, skipping the hour missing when
+		// the clocks go forward
+		{"30 2 * * *", time.Date(2021, 3, 27, 12, 0, 0, 0, paris), time.Date(2021, 3, 29, 2, 30, 0, 0, paris)},
+	} {
+		s, err := parseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := s.next(c.from); !next.Equal(c.next) {
+			t.Errorf("expected %q after %s at %s, got %s", c.spec, c.from, c.next, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "a * * * *", "@yearly"} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("expected %q refused", spec)
+		}
+	}
+}
+
+func TestState(t *testing.T) {
+	s, err := New([]Window{
+		{Schedule: "0 2 * * *", Duration: 4 * time.Hour},
+		{Schedule: "0 12 * * 0", Duration: 2 * time.Hour},
+	}, Tasks, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := func(d, h, m int) time.Time {
+		// June 6, 2021 is a Sunday
+		return time.Date(2021, 6, d, h, m, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		now   time.Time
+		open  bool
+		until time.Time
+	}{
+		{day(2, 1, 59), false, day(2, 2, 0)},
+		{day(2, 2, 0), true, day(2, 6, 0)},
+		{day(2, 5, 59), true, day(2, 6, 0)},
+		{day(2, 6, 0), false, day(3, 2, 0)},
+		{day(6, 7, 0), false, day(6, 12, 0)},
+		{day(6, 13, 0), true, day(6, 14, 0)},
+		{day(6, 14, 0), false, day(7, 2, 0)},
+	} {
+		open, until := s.State(c.now)
+		if open != c.open || !until.Equal(c.until) {
+			t.Errorf("expected open %t until %s at %s, got %t until %s", c.open, c.until, c.now, open, until)
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// always open
+	s, err := New([]Window{{Schedule: "* * * * *", Duration: time.Hour}}, []Task{GC}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Wait(ctx, GC); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Limiter(GC, nil).Wait(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// never open
+	if _, err := New([]Window{{Schedule: "0 0 31 2 *", Duration: time.Hour}}, Tasks, time.UTC); err == nil {
+		t.Fatal("expected a window never opening refused")
+	}
+	never, err := parseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = &Scheduler{
+		windows: []window{{schedule: never, duration: time.Hour}},
+		tasks:   map[Task]bool{GC: true, Scrub: true},
+		loc:     time.UTC,
+	}
+	if err := s.Wait(ctx, GC); err != ErrNoWindow {
+		t.Fatalf("expected no window ahead, got %v", err)
+	}
+	if err := s.Limiter(Scrub, iothrottle.New(10, 0)).Wait(ctx, 0); err != ErrNoWindow {
+		t.Fatalf("expected the scrub held back, got %v", err)
+	}
+
+	// the tasks not held to the windows, and a nil scheduler, run any time
+	if err := s.Wait(ctx, Migrate); err != nil {
+		t.Fatal(err)
+	}
+	l := iothrottle.New(10, 0)
+	if s.Limiter(Reprovide, l) != l {
+		t.Fatal("expected the reprovides not held back")
+	}
+	var none *Scheduler
+	if err := none.Wait(ctx, GC); err != nil || none.Limiter(GC, l) != l {
+		t.Fatalf("expected a nil scheduler not holding back, got %v", err)
+	}
+
+	if _, err := New([]Window{{Schedule: "0 2 * * *", Duration: time.Hour}}, []Task{"defrag"}, time.UTC); err == nil {
+		t.Error("expected an unknown task refused")
+	}
+	if _, err := New([]Window{{Schedule: "0 2 * * *"}}, Tasks, time.UTC); err == nil {
+		t.Error("expected a window without a duration refused")
+	}
+}
@@ -0,0 +1,48 @@
+package membudget
+
+import (
+	"context"
+
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+// session is a bitswap session that can be shed.
+type session struct {
+	cancel context.CancelFunc
+}
+
+// Exchange is an exchange whose sessions are shed when the node comes under
+// pressure.
+type Exchange struct {
+	exchange.SessionExchange
+	b *Budget
+}
+
+// NewExchange returns ex, shedding its sessions when b comes under pressure.
+// Exchanges without sessions are returned as is.
+func NewExchange(ex exchange.Interface, b *Budget) exchange.Interface {
+	sex, ok := ex.(exchange.SessionExchange)
+	if !ok {
+		return ex
+	}
+	return &Exchange{SessionExchange: sex, b: b}
+}
+
+// NewSession starts a session canceled when the node comes under pressure.
+func (e *Exchange) NewSession(ctx context.Context) exchange.Fetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &session{cancel: cancel}
+
+	e.b.mu.Lock()
+	e.b.sessions[s] = struct{}{}
+	e.b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		e.b.mu.Lock()
+		delete(e.b.sessions, s)
+		e.b.mu.Unlock()
+	}()
+
+	return e.SessionExchange.NewSession(ctx)
+}
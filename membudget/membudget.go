@@ -0,0 +1,227 @@
+// Package membudget keeps the memory used by the node within a budget.
+//
+// The memory used by the process is sampled regularly. When it gets close to
+// the budget, the node is under pressure: the bitswap sessions in progress
+// are shed, the caches registered with OnPressure are emptied, the garbage
+// collector runs more often, and new requests are held back until the
+// pressure is relieved, or declined if it lasts. This keeps the node usable,
+// and alive, where it would otherwise be killed for running out of memory.
+package membudget
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("membudget")
+
+// ErrOverBudget is returned by Wait when the pressure lasts longer than the
+// maximum wait.
+var ErrOverBudget = errors.New("node is over its memory budget")
+
+const (
+	// HighWater is the fraction of the budget from which the node is under
+	// pressure.
+	HighWater = 0.9
+	// LowWater is the fraction of the budget below which the pressure is
+	// relieved.
+	LowWater = 0.8
+
+	// pressureGCPercent is the GOGC value used while under pressure.
+	pressureGCPercent = 25
+)
+
+// Usage is the state of the memory budget.
+type Usage struct {
+	// Limit is the budget, in bytes.
+	Limit uint64
+	// Used is the memory held by the process, in bytes, as of the last
+	// sample.
+	Used uint64
+	// UnderPressure reports whether the usage is close to the budget.
+	UnderPressure bool
+	// Pressures is the number of times the node came under pressure.
+	Pressures uint64
+	// SessionsShed is the number of bitswap sessions shed.
+	SessionsShed uint64
+	// RequestsDelayed is the number of requests held back by the pressure.
+	RequestsDelayed uint64
+	// RequestsRejected is the number of requests declined after waiting too
+	// long.
+	RequestsRejected uint64
+}
+
+// Budget samples the memory used by the process, and relieves the pressure
+// when it gets close to the limit.
+type Budget struct {
+	limit   uint64
+	maxWait time.Duration
+	// read returns the memory held by the process
+	read func() uint64
+
+	mu       sync.Mutex
+	usage    Usage
+	relieved chan struct{} // closed while not under pressure
+	gcPct    int           // the GOGC value to restore
+	sessions map[*session]struct{}
+
+	hooksMu sync.Mutex
+	hooks   []func()
+}
+
+// New returns a budget of limit bytes, holding requests back for up to maxWait
+// while under pressure. It starts sampling once Run is called.
+func New(limit uint64, maxWait time.Duration) *Budget {
+	relieved := make(chan struct{})
+	close(relieved)
+	return &Budget{
+		limit:    limit,
+		maxWait:  maxWait,
+		read:     readMemory,
+		usage:    Usage{Limit: limit},
+		relieved: relieved,
+		sessions: make(map[*session]struct{}),
+	}
+}
+
+// readMemory returns the memory obtained from the OS which has not been
+// returned to it.
+func readMemory() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys - ms.HeapReleased
+}
+
+// OnPressure registers f to be called every time the node comes under
+// pressure, to release the memory it is in charge of, such as a cache.
+func (b *Budget) OnPressure(f func()) {
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+	b.hooks = append(b.hooks, f)
+}
+
+// Run samples the memory usage every interval until ctx is canceled.
+func (b *Budget) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.Sample()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			b.relieve()
+			return
+		}
+	}
+}
+
+// Sample samples the memory usage, and starts or ends the pressure
+// accordingly.
+func (b *Budget) Sample() {
+	used := b.read()
+
+	b.mu.Lock()
+	b.usage.Used = used
+	pressure := b.usage.UnderPressure
+	b.mu.Unlock()
+
+	switch {
+	case !pressure && float64(used) >= HighWater*float64(b.limit):
+		b.pressure(used)
+	case pressure && float64(used) < LowWater*float64(b.limit):
+		b.relieve()
+	}
+}
+
+// pressure puts the node under pressure, and releases all the memory it can.
+func (b *Budget) pressure(used uint64) {
+	b.mu.Lock()
+	b.usage.UnderPressure = true
+	b.usage.Pressures++
+	b.relieved = make(chan struct{})
+	b.gcPct = debug.SetGCPercent(pressureGCPercent)
+	sessions := b.sessions
+	b.sessions = make(map[*session]struct{})
+	b.usage.SessionsShed += uint64(len(sessions))
+	b.mu.Unlock()
+
+	log.Warnf("memory usage of %d bytes close to the budget of %d bytes, shedding load", used, b.limit)
+
+	for s := range sessions {
+		s.cancel()
+	}
+
+	b.hooksMu.Lock()
+	for _, f := range b.hooks {
+		f()
+	}
+	b.hooksMu.Unlock()
+
+	// hand what was freed back to the OS, so that it is not killed for it
+	debug.FreeOSMemory()
+}
+
+// relieve ends the pressure, if any.
+func (b *Budget) relieve() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.usage.UnderPressure {
+		return
+	}
+	b.usage.UnderPressure = false
+	close(b.relieved)
+	debug.SetGCPercent(b.gcPct)
+	log.Infof("memory usage of %d bytes back within the budget", b.usage.Used)
+}
+
+// Wait holds the caller back while the node is under pressure, and returns
+// ErrOverBudget if the pressure lasts longer than the maximum wait.
+func (b *Budget) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	relieved := b.relieved
+	pressure := b.usage.UnderPressure
+	if pressure {
+		b.usage.RequestsDelayed++
+	}
+	b.mu.Unlock()
+
+	if !pressure {
+		return nil
+	}
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+	select {
+	case <-relieved:
+		return nil
+	case <-timer.C:
+		b.mu.Lock()
+		b.usage.RequestsRejected++
+		b.mu.Unlock()
+		return ErrOverBudget
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// UnderPressure reports whether the node is under pressure, and should not
+// take more memory than it needs.
+func (b *Budget) UnderPressure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage.UnderPressure
+}
+
+// Usage returns the state of the budget.
+func (b *Budget) Usage() Usage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage
+}
@@ -0,0 +1,105 @@
+package membudget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+)
+
+type fakeExchange struct {
+	sessions []context.Context
+}
+
+func (e *fakeExchange) GetBlock(context.Context, cid.Cid) (blocks.Block, error) { return nil, nil }
+
+func (e *fakeExchange) GetBlocks(context.Context, []cid.Cid) (<-chan blocks.Block, error) {
+	return nil, nil
+}
+
+func (e *fakeExchange) HasBlock(context.Context, blocks.Block) error { return nil }
+
+func (e *fakeExchange) IsOnline() bool { return true }
+
+func (e *fakeExchange) Close() error { return nil }
+
+func (e *fakeExchange) NewSession(ctx context.Context) exchange.Fetcher {
+	e.sessions = append(e.sessions, ctx)
+	return e
+}
+
+func TestPressure(t *testing.T) {
+	used := uint64(50)
+	b := New(100, time.Hour)
+	b.read = func() uint64 { return used }
+
+	purged := 0
+	b.OnPressure(func() { purged++ })
+
+	inner := &fakeExchange{}
+	ex := NewExchange(inner, b).(exchange.SessionExchange)
+	ex.NewSession(context.Background())
+
+	b.Sample()
+	if b.Usage().UnderPressure {
+		t.Fatal("under pressure at half the budget")
+	}
+	if err := b.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	used = 95
+	b.Sample()
+	if u := b.Usage(); !u.UnderPressure || u.Pressures != 1 || u.SessionsShed != 1 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+	if purged != 1 {
+		t.Fatal("caches not purged under pressure")
+	}
+	if inner.sessions[0].Err() == nil {
+		t.Fatal("session not shed under pressure")
+	}
+
+	waited := make(chan error)
+	go func() { waited <- b.Wait(context.Background()) }()
+
+	// the pressure lasts until the usage drops below the low water mark
+	used = 85
+	b.Sample()
+	select {
+	case <-waited:
+		t.Fatal("request let through while under pressure")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	used = 70
+	b.Sample()
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request still held back once relieved")
+	}
+	if u := b.Usage(); u.UnderPressure || u.RequestsDelayed != 1 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+}
+
+func TestWaitRejects(t *testing.T) {
+	b := New(100, 10*time.Millisecond)
+	b.read = func() uint64 { return 100 }
+	b.Sample()
+	defer b.relieve()
+
+	if err := b.Wait(context.Background()); err != ErrOverBudget {
+		t.Fatalf("expected ErrOverBudget, got %v", err)
+	}
+	if u := b.Usage(); u.RequestsRejected != 1 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+}
@@ -0,0 +1,260 @@
+// Package mfsjournal journals the operations changing the MFS, so that an
+// operation interrupted by a crash is rolled back on the next start instead of
+// leaving the MFS root pointing at a partially written tree.
+//
+// Before an operation changes the MFS, Begin records it in the repo datastore
+// along with the MFS root it starts from. Once it ends, and the root it
+// results in is flushed, the record is removed, and the root is added to the
+// recent roots known to be the result of complete operations. A record found
+// on start is thus the trace of operations interrupted by a crash, whose root
+// is restored with Rollback.
+package mfsjournal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+var log = logging.Logger("mfsjournal")
+
+var (
+	// opsKey is the datastore key of the operations in flight.
+	opsKey = ds.NewKey("/local/files/journal/ops")
+	// rootsKey is the datastore key of the recent complete roots.
+	rootsKey = ds.NewKey("/local/files/journal/roots")
+)
+
+// maxRoots is how many complete roots are kept, for fsck to go back to.
+const maxRoots = 16
+
+// Entry is the record of the operations in flight.
+type Entry struct {
+	// Root is the MFS root before the operations started.
+	Root cid.Cid
+	// Ops describes the operations, such as "write /a".
+	Ops []string
+	// Started is when the first of them started.
+	Started time.Time
+}
+
+// Journal journals the operations changing the MFS of a repo.
+type Journal struct {
+	ds ds.Datastore
+	// rootKey is the datastore key of the MFS root.
+	rootKey ds.Key
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]string
+	entry   Entry
+}
+
+// New returns the journal of the MFS whose root is stored under rootKey of d.
+func New(d ds.Datastore, rootKey ds.Key) *Journal {
+	return &Journal{ds: d, rootKey: rootKey, pending: make(map[uint64]string)}
+}
+
+// Begin records that op starts changing the MFS. The returned function
+// records that it ended, and must be called once the root it results in is
+// flushed, or once it failed. Operations may run concurrently: the record
+// keeps the root from before the first of them, until none is left.
+func (j *Journal) Begin(ctx context.Context, op string) (func(), error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := j.entry
+	if len(j.pending) == 0 {
+		root, err := j.root(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entry = Entry{Root: root, Started: time.Now()}
+	}
+	entry.Ops = append(entry.Ops[:len(entry.Ops):len(entry.Ops)], op)
+	if err := j.put(ctx, opsKey, entry); err != nil {
+		return nil, err
+	}
+
+	id := j.nextID
+	j.nextID++
+	j.pending[id] = op
+	j.entry = entry
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := j.end(id); err != nil {
+				log.Errorf("journaling the end of %s: %s", op, err)
+			}
+		})
+	}, nil
+}
+
+func (j *Journal) end(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// the operation ended even if its caller was cancelled
+	ctx := context.Background()
+	delete(j.pending, id)
+	if len(j.pending) > 0 {
+		ids := make([]uint64, 0, len(j.pending))
+		for id := range j.pending {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+		j.entry.Ops = j.entry.Ops[:0:0]
+		for _, id := range ids {
+			j.entry.Ops = append(j.entry.Ops, j.pending[id])
+		}
+		return j.put(ctx, opsKey, j.entry)
+	}
+
+	root, err := j.root(ctx)
+	if err != nil {
+		return err
+	}
+	if err := j.addRoot(ctx, root); err != nil {
+		return err
+	}
+	j.entry = Entry{}
+	return j.delete(ctx, opsKey)
+}
+
+// Interrupted returns the record of the operations in flight when the repo
+// was last closed, if it was not closed cleanly. It must be called before any
+// operation begins.
+func (j *Journal) Interrupted(ctx context.Context) (Entry, bool, error) {
+	var e Entry
+	found, err := j.get(ctx, opsKey, &e)
+	return e, found, err
+}
+
+// Rollback restores the MFS root from before the interrupted operations of e,
+// and removes their record.
+func (j *Journal) Rollback(ctx context.Context, e Entry) error {
+	if err := j.SetRoot(ctx, e.Root); err != nil {
+		return err
+	}
+	return j.Discard(ctx)
+}
+
+// Discard removes the record of the interrupted operations, keeping the MFS
+// root as it is.
+func (j *Journal) Discard(ctx context.Context) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.delete(ctx, opsKey)
+}
+
+// SetRoot replaces the MFS root in the datastore with root. The MFS of a
+// running node is not changed. An undefined root removes it, for the MFS to
+// start empty.
+func (j *Journal) SetRoot(ctx context.Context, root cid.Cid) error {
+	if !root.Defined() {
+		return j.delete(ctx, j.rootKey)
+	}
+	if err := j.ds.Put(ctx, j.rootKey, root.Bytes()); err != nil {
+		return err
+	}
+	return j.ds.Sync(ctx, j.rootKey)
+}
+
+// Roots returns the MFS roots recently resulting from complete operations,
+// from the most recent.
+func (j *Journal) Roots(ctx context.Context) ([]cid.Cid, error) {
+	var roots []cid.Cid
+	_, err := j.get(ctx, rootsKey, &roots)
+	return roots, err
+}
+
+func (j *Journal) addRoot(ctx context.Context, root cid.Cid) error {
+	if !root.Defined() {
+		return nil
+	}
+	roots, err := j.Roots(ctx)
+	if err != nil {
+		return err
+	}
+	if len(roots) > 0 && roots[0].Equals(root) {
+		return nil
+	}
+	roots = append([]cid.Cid{root}, roots...)
+	if len(roots) > maxRoots {
+		roots = roots[:maxRoots]
+	}
+	return j.put(ctx, rootsKey, roots)
+}
+
+// root returns the MFS root stored in the datastore, cid.Undef if none is.
+func (j *Journal) root(ctx context.Context) (cid.Cid, error) {
+	b, err := j.ds.Get(ctx, j.rootKey)
+	if err == ds.ErrNotFound {
+		return cid.Undef, nil
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.Cast(b)
+}
+
+func (j *Journal) put(ctx context.Context, k ds.Key, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := j.ds.Put(ctx, k, b); err != nil {
+		return err
+	}
+	return j.ds.Sync(ctx, k)
+}
+
+func (j *Journal) get(ctx context.Context, k ds.Key, v interface{}) (bool, error) {
+	b, err := j.ds.Get(ctx, k)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("invalid MFS journal %s: %w", k, err)
+	}
+	return true, nil
+}
+
+func (j *Journal) delete(ctx context.Context, k ds.Key) error {
+	if err := j.ds.Delete(ctx, k); err != nil {
+		return err
+	}
+	return j.ds.Sync(ctx, k)
+}
+
+// Missing returns the first block of the DAG of root missing from dserv, or
+// cid.Undef if the DAG is complete. dserv should be offline, for the local
+// blocks to be checked.
+func Missing(ctx context.Context, dserv ipld.DAGService, root cid.Cid) (cid.Cid, error) {
+	missing := cid.Undef
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		links, err := dag.GetLinksDirect(dserv)(ctx, c)
+		if ipld.IsNotFound(err) {
+			missing = c
+		}
+		return links, err
+	}
+	err := dag.Walk(ctx, getLinks, root, cid.NewSet().Visit)
+	if missing.Defined() {
+		return missing, nil
+	}
+	return cid.Undef, err
+}
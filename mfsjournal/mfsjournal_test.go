@@ -0,0 +1,106 @@
+package mfsjournal
+
+import (
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+var rootKey = ds.NewKey("/local/filesroot")
+
+func TestJournal(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	j := New(d, rootKey)
+
+	a := dag.NodeWithData([]byte("a")).Cid()
+	b := dag.NodeWithData([]byte("b")).Cid()
+	c := dag.NodeWithData([]byte("c")).Cid()
+	if err := j.SetRoot(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+
+	endMv, err := j.Begin(ctx, "mv /x /y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.SetRoot(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	endWrite, err := j.Begin(ctx, "write /z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endMv()
+	endMv()
+
+	// a new journal of the repo finds the write in flight, from before the mv
+	e, found, err := New(d, rootKey).Interrupted(ctx)
+	if err != nil || !found {
+		t.Fatalf("expected interrupted operations, got %v", err)
+	}
+	if !e.Root.Equals(a) || len(e.Ops) != 1 || e.Ops[0] != "write /z" {
+		t.Fatalf("unexpected interrupted operations %+v", e)
+	}
+
+	if err := j.SetRoot(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	endWrite()
+	if _, found, _ := j.Interrupted(ctx); found {
+		t.Fatal("expected no operations in flight")
+	}
+	roots, err := j.Roots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || !roots[0].Equals(c) {
+		t.Fatalf("expected %s to be the complete root, got %v", c, roots)
+	}
+
+	if err := j.Rollback(ctx, e); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := j.root(ctx); !r.Equals(a) {
+		t.Fatalf("expected the root to be rolled back to %s, got %s", a, r)
+	}
+	if err := j.SetRoot(ctx, cid.Undef); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(ctx, rootKey); has {
+		t.Fatal("expected the root to be removed")
+	}
+}
+
+func TestMissing(t *testing.T) {
+	ctx := context.Background()
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	leaf := dag.NodeWithData([]byte("leaf"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("leaf", leaf); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Missing(ctx, dserv, root.Cid())
+	if err != nil || !m.Equals(leaf.Cid()) {
+		t.Fatalf("expected %s to be missing, got %s, %v", leaf.Cid(), m, err)
+	}
+	if err := dserv.Add(ctx, leaf); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := Missing(ctx, dserv, root.Cid()); err != nil || m.Defined() {
+		t.Fatalf("expected the DAG to be complete, got %s, %v", m, err)
+	}
+}
@@ -0,0 +1,263 @@
+package mfsrepl
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// stateKey is where a standby keeps the last root it pinned.
+var stateKey = ds.NewKey("/local/mfs-standby")
+
+// Status is the state of a standby.
+type Status struct {
+	Writer peer.ID
+	// Received is the last update received from the writer.
+	Received   Update
+	ReceivedAt time.Time
+	// Pinned is the last update whose root was pinned.
+	Pinned   Update
+	PinnedAt time.Time
+	// Error is the error pinning the last update received, if any.
+	Error string
+}
+
+type storedState struct {
+	Writer   peer.ID
+	Root     string
+	Seq      uint64
+	PinnedAt time.Time
+}
+
+// Follower follows the MFS root of a writer, keeping its latest root pinned.
+type Follower struct {
+	writer peer.ID
+	sub    *pubsub.Subscription
+	dstore ds.Datastore
+	pinner pin.Pinner
+	dag    ipld.DAGService
+	locker bstore.GCLocker
+
+	mu     sync.Mutex
+	status Status
+	// cancelPin cancels the pin in progress, superseded by a newer root
+	cancelPin context.CancelFunc
+	pending   chan Update
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewFollower returns a follower of the MFS root of writer, resuming from the
+// last root pinned, as kept in dstore.
+func NewFollower(ps *pubsub.PubSub, writer peer.ID, dstore ds.Datastore, pinner pin.Pinner, dag ipld.DAGService, locker bstore.GCLocker) (*Follower, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	f := &Follower{
+		writer:  writer,
+		dstore:  dstore,
+		pinner:  pinner,
+		dag:     dag,
+		locker:  locker,
+		status:  Status{Writer: writer},
+		pending: make(chan Update, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	val, err := dstore.Get(ctx, stateKey)
+	switch err {
+	case nil:
+		var st storedState
+		if err := json.Unmarshal(val, &st); err != nil {
+			cancel()
+			return nil, err
+		}
+		root, err := cid.Decode(st.Root)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		// the sequence numbers of another writer are meaningless, but its
+		// root still needs to be unpinned once replaced
+		f.status.Pinned = Update{Root: root}
+		f.status.PinnedAt = st.PinnedAt
+		if st.Writer == writer {
+			f.status.Pinned.Seq = st.Seq
+		}
+		f.status.Received = f.status.Pinned
+	case ds.ErrNotFound:
+	default:
+		cancel()
+		return nil, err
+	}
+
+	f.sub, err = ps.Subscribe(Topic(writer))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return f, nil
+}
+
+// LastRoot returns the last root pinned by the standby kept in dstore, as of
+// its last run.
+func LastRoot(ctx context.Context, dstore ds.Datastore) (cid.Cid, peer.ID, error) {
+	val, err := dstore.Get(ctx, stateKey)
+	if err != nil {
+		return cid.Undef, "", err
+	}
+	var st storedState
+	if err := json.Unmarshal(val, &st); err != nil {
+		return cid.Undef, "", err
+	}
+	root, err := cid.Decode(st.Root)
+	return root, st.Writer, err
+}
+
+// Status returns the state of the standby.
+func (f *Follower) Status() Status {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.status
+}
+
+// Run follows the writer until the follower is closed.
+func (f *Follower) Run() {
+	f.wg.Add(1)
+	go f.pinLoop()
+
+	for {
+		msg, err := f.sub.Next(f.ctx)
+		if err != nil {
+			return
+		}
+		// messages are signed by their author
+		if msg.GetFrom() != f.writer {
+			continue
+		}
+		u, err := unmarshalUpdate(msg.Data)
+		if err != nil {
+			log.Debugf("invalid MFS root update from %s: %s", f.writer, err)
+			continue
+		}
+
+		f.mu.Lock()
+		if u.Seq <= f.status.Received.Seq {
+			f.mu.Unlock()
+			continue
+		}
+		f.status.Received = u
+		f.status.ReceivedAt = time.Now()
+		// the root being pinned is outdated, and mostly shared with the
+		// new one anyway
+		if f.cancelPin != nil {
+			f.cancelPin()
+		}
+		f.mu.Unlock()
+
+		// only the latest root needs pinning
+		select {
+		case <-f.pending:
+		default:
+		}
+		f.pending <- u
+	}
+}
+
+func (f *Follower) pinLoop() {
+	defer f.wg.Done()
+	for {
+		select {
+		case u := <-f.pending:
+			f.pinUpdate(u)
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Follower) pinUpdate(u Update) {
+	ctx, cancel := context.WithCancel(f.ctx)
+	f.mu.Lock()
+	f.cancelPin = cancel
+	old := f.status.Pinned.Root
+	f.mu.Unlock()
+	defer cancel()
+
+	err := f.pin(ctx, old, u.Root)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancelPin = nil
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Errorf("pinning MFS root %s of %s: %s", u.Root, f.writer, err)
+			f.status.Error = err.Error()
+		}
+		return
+	}
+	f.status.Pinned = u
+	f.status.PinnedAt = time.Now()
+	f.status.Error = ""
+
+	data, err := json.Marshal(storedState{
+		Writer:   f.writer,
+		Root:     u.Root.String(),
+		Seq:      u.Seq,
+		PinnedAt: f.status.PinnedAt,
+	})
+	if err == nil {
+		err = f.dstore.Put(f.ctx, stateKey, data)
+	}
+	if err == nil {
+		err = f.dstore.Sync(f.ctx, stateKey)
+	}
+	if err != nil {
+		log.Errorf("saving MFS standby state: %s", err)
+	}
+}
+
+// pin pins root recursively in place of old, if defined.
+func (f *Follower) pin(ctx context.Context, old, root cid.Cid) error {
+	defer f.locker.PinLock(ctx).Unlock(ctx)
+
+	if old.Defined() {
+		// only fetches what changed
+		if err := f.pinner.Update(ctx, old, root, true); err == nil {
+			return nil
+		}
+		// the pins were changed by hand, pin from scratch
+	}
+
+	nd, err := f.dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	if err := f.pinner.Pin(ctx, nd, true); err != nil {
+		return err
+	}
+	if old.Defined() && old != root {
+		if err := f.pinner.Unpin(ctx, old, true); err != nil && err != pin.ErrNotPinned {
+			return err
+		}
+	}
+	return f.pinner.Flush(ctx)
+}
+
+// Close stops following the writer.
+func (f *Follower) Close() error {
+	f.cancel()
+	f.sub.Cancel()
+	f.wg.Wait()
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package mfsrepl replicates the MFS root of a writer node to hot standbys.
+//
+// The writer publishes its MFS root over pubsub every time it changes, and
+// regularly while it does not, for standbys joining late. A standby follows
+// the roots published by its writer, and keeps the latest one pinned, so that
+// it can take over with at most a few seconds of MFS changes lost.
+package mfsrepl
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+var log = logging.Logger("mfsrepl")
+
+// Update is an MFS root published by a writer.
+type Update struct {
+	Root cid.Cid
+	// Seq orders the updates of a writer, older updates being ignored.
+	Seq uint64
+}
+
+// Topic returns the pubsub topic the writer publishes its MFS root to.
+func Topic(writer peer.ID) string {
+	return "/ipfs/mfs-standby/1.0.0/" + writer.String()
+}
+
+// newSeq returns a sequence number greater than that of the updates
+// published before, including by previous runs of the writer.
+func newSeq(last uint64) uint64 {
+	seq := uint64(time.Now().UnixNano())
+	if seq <= last {
+		seq = last + 1
+	}
+	return seq
+}
+
+type updateJSON struct {
+	Root string
+	Seq  uint64
+}
+
+func (u Update) marshal() ([]byte, error) {
+	return json.Marshal(updateJSON{Root: u.Root.String(), Seq: u.Seq})
+}
+
+func unmarshalUpdate(data []byte) (Update, error) {
+	var uj updateJSON
+	if err := json.Unmarshal(data, &uj); err != nil {
+		return Update{}, err
+	}
+	root, err := cid.Decode(uj.Root)
+	if err != nil {
+		return Update{}, fmt.Errorf("invalid root: %w", err)
+	}
+	return Update{Root: root, Seq: uj.Seq}, nil
+}
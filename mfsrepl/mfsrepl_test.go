@@ -0,0 +1,141 @@
+package mfsrepl
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestFollowWriter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// pubsub messages are signed, which the bogus keys of mocknet can't do
+	mn := mocknet.New()
+	newHost := func() host.Host {
+		t.Helper()
+		sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, ma.StringCast("/ip4/127.0.0.1/tcp/4001"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	writer, standby := newHost(), newHost()
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	wps, err := pubsub.NewGossipSub(ctx, writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sps, err := pubsub.NewGossipSub(ctx, standby)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both nodes share a blockstore, the standby has nothing to fetch
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := NewFollower(sps, writer.ID(), dstore, pinner, dserv, bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go f.Run()
+	defer f.Close()
+
+	p, err := NewPublisher(wps, writer.ID(), dag.NodeWithData([]byte("unused")).Cid(), 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go p.Run()
+	defer p.Close()
+
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitPinned := func(nd *dag.ProtoNode) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for f.Status().Pinned.Root != nd.Cid() {
+			if time.Now().After(deadline) {
+				t.Fatalf("root %s never pinned: %+v", nd.Cid(), f.Status())
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		_, pinned, err := pinner.IsPinnedWithType(ctx, nd.Cid(), pin.Recursive)
+		if err != nil || !pinned {
+			t.Fatalf("root %s not pinned: %v", nd.Cid(), err)
+		}
+	}
+
+	first := dag.NodeWithData([]byte("first"))
+	second := dag.NodeWithData([]byte("second"))
+	for _, nd := range []*dag.ProtoNode{first, second} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p.Publish(first.Cid())
+	waitPinned(first)
+
+	p.Publish(second.Cid())
+	waitPinned(second)
+
+	// the previous root is unpinned
+	_, pinned, err := pinner.IsPinned(ctx, first.Cid())
+	if err != nil || pinned {
+		t.Fatalf("previous root still pinned: %v", err)
+	}
+
+	root, from, err := LastRoot(ctx, dstore)
+	if err != nil || root != second.Cid() || from != writer.ID() {
+		t.Fatalf("unexpected last root %s from %s: %v", root, from, err)
+	}
+}
+
+func TestUpdateEncoding(t *testing.T) {
+	u := Update{Root: dag.NodeWithData([]byte("root")).Cid(), Seq: newSeq(0)}
+	data, err := u.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := unmarshalUpdate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != u {
+		t.Fatalf("expected %+v, got %+v", u, decoded)
+	}
+
+	if seq := newSeq(u.Seq + 1000000000); seq <= u.Seq+1000000000 {
+		t.Fatal("sequence numbers must increase")
+	}
+}
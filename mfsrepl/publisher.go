@@ -0,0 +1,104 @@
+package mfsrepl
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// Publisher publishes the MFS root of a writer.
+type Publisher struct {
+	topic    *pubsub.Topic
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    Update
+	changed chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewPublisher returns a publisher of the MFS root of self, starting at root,
+// which may be undefined. The root is republished every interval while it
+// does not change.
+func NewPublisher(ps *pubsub.PubSub, self peer.ID, root cid.Cid, interval time.Duration) (*Publisher, error) {
+	topic, err := ps.Join(Topic(self))
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Publisher{
+		topic:    topic,
+		interval: interval,
+		changed:  make(chan struct{}, 1),
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	if root.Defined() {
+		p.Publish(root)
+	}
+	return p, nil
+}
+
+// Publish publishes root as the new MFS root.
+func (p *Publisher) Publish(root cid.Cid) {
+	p.mu.Lock()
+	p.last = Update{Root: root, Seq: newSeq(p.last.Seq)}
+	p.mu.Unlock()
+
+	select {
+	case p.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Last returns the last update published.
+func (p *Publisher) Last() Update {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last
+}
+
+// Run publishes the MFS root until the publisher is closed.
+func (p *Publisher) Run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.changed:
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+
+		u := p.Last()
+		if !u.Root.Defined() {
+			continue
+		}
+		data, err := u.marshal()
+		if err != nil {
+			log.Errorf("encoding MFS root update: %s", err)
+			continue
+		}
+		if err := p.topic.Publish(p.ctx, data); err != nil && p.ctx.Err() == nil {
+			log.Errorf("publishing MFS root %s: %s", u.Root, err)
+		}
+	}
+}
+
+// Close stops publishing.
+func (p *Publisher) Close() error {
+	p.cancel()
+	<-p.done
+	return p.topic.Close()
+}
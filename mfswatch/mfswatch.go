@@ -0,0 +1,270 @@
+// Package mfswatch notifies the changes of the MFS tree under a path, so that
+// the applications syncing the MFS do not have to poll it.
+//
+// The Watcher is given the MFS roots as they are published. The changes are
+// found by comparing the trees under the path watched in the last root seen by
+// the watch and in the new one, only walking the directories whose CIDs
+// differ. A watch slower than the changes sees the changes of several roots
+// at once.
+package mfswatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+var log = logging.Logger("mfswatch")
+
+// Op is the kind of a change.
+type Op string
+
+const (
+	Create Op = "create"
+	Modify Op = "modify"
+	Delete Op = "delete"
+)
+
+// Event is the change of an entry of the MFS. A directory created or deleted
+// is a single event, its entries are not reported one by one. The entries of
+// a directory modified are.
+type Event struct {
+	Op   Op
+	Path string
+	// Old and New are the CIDs of the entry before and after the change,
+	// cid.Undef when created and deleted
+	Old cid.Cid
+	New cid.Cid
+}
+
+// Watcher watches the changes of the MFS.
+type Watcher struct {
+	dserv ipld.DAGService
+
+	mu    sync.Mutex
+	root  cid.Cid
+	watch map[*watch]struct{}
+}
+
+// watch is a path watched.
+type watch struct {
+	path string
+	// notify is signaled when the root changes
+	notify chan struct{}
+}
+
+// New returns a watcher reading the trees of the MFS from dserv.
+func New(dserv ipld.DAGService) *Watcher {
+	return &Watcher{
+		dserv: dserv,
+		watch: make(map[*watch]struct{}),
+	}
+}
+
+// Publish sets the MFS root, notifying the watches.
+func (w *Watcher) Publish(root cid.Cid) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.root = root
+	for wt := range w.watch {
+		select {
+		case wt.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Resolve returns the CID of the entry at the MFS path p in the last root
+// published, cid.Undef if there is none.
+func (w *Watcher) Resolve(ctx context.Context, p string) (cid.Cid, error) {
+	if !strings.HasPrefix(p, "/") {
+		return cid.Undef, fmt.Errorf("%s is not an absolute MFS path", p)
+	}
+	w.mu.Lock()
+	root := w.root
+	w.mu.Unlock()
+	return resolve(ctx, w.dserv, root, gopath.Clean(p))
+}
+
+// Watch returns the changes of the MFS under p, from the next change on,
+// until ctx is done.
+func (w *Watcher) Watch(ctx context.Context, p string) (<-chan Event, error) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%s is not an absolute MFS path", p)
+	}
+	wt := &watch{path: gopath.Clean(p), notify: make(chan struct{}, 1)}
+
+	w.mu.Lock()
+	last := w.root
+	w.watch[wt] = struct{}{}
+	w.mu.Unlock()
+
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		defer func() {
+			w.mu.Lock()
+			delete(w.watch, wt)
+			w.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-wt.notify:
+			case <-ctx.Done():
+				return
+			}
+			w.mu.Lock()
+			root := w.root
+			w.mu.Unlock()
+			if root.Equals(last) {
+				continue
+			}
+
+			events, err := Diff(ctx, w.dserv, wt.path, last, root)
+			if err != nil {
+				// the changes are lost, but not the next ones
+				log.Errorf("cannot compare the MFS roots %s and %s under %s: %s", last, root, wt.path, err)
+			}
+			last = root
+			for _, e := range events {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Diff returns the changes of the tree under p from the MFS root old to the
+// root new, in the order of the paths.
+func Diff(ctx context.Context, dserv ipld.DAGService, p string, old, new cid.Cid) ([]Event, error) {
+	from, err := resolve(ctx, dserv, old, p)
+	if err != nil {
+		return nil, err
+	}
+	to, err := resolve(ctx, dserv, new, p)
+	if err != nil {
+		return nil, err
+	}
+	var events []Event
+	err = diff(ctx, dserv, p, from, to, &events)
+	return events, err
+}
+
+// resolve returns the CID of the entry at p in the tree of root, cid.Undef if
+// there is none.
+func resolve(ctx context.Context, dserv ipld.DAGService, root cid.Cid, p string) (cid.Cid, error) {
+	c := root
+	for _, name := range strings.Split(strings.Trim(p, "/"), "/") {
+		if name == "" || !c.Defined() {
+			continue
+		}
+		dir, err := directory(ctx, dserv, c)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if dir == nil {
+			return cid.Undef, nil
+		}
+		nd, err := dir.Find(ctx, name)
+		if errors.Is(err, os.ErrNotExist) {
+			return cid.Undef, nil
+		}
+		if err != nil {
+			return cid.Undef, err
+		}
+		c = nd.Cid()
+	}
+	return c, nil
+}
+
+// directory returns the UnixFS directory c, or nil if c is not one.
+func directory(ctx context.Context, dserv ipld.DAGService, c cid.Cid) (uio.Directory, error) {
+	nd, err := dserv.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	pbnd, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return nil, nil
+	}
+	fsn, err := ft.FSNodeFromBytes(pbnd.Data())
+	if err != nil || !fsn.IsDir() {
+		return nil, nil
+	}
+	return uio.NewDirectoryFromNode(dserv, pbnd)
+}
+
+// diff appends the changes from the entry old at p to the entry new.
+func diff(ctx context.Context, dserv ipld.DAGService, p string, old, new cid.Cid, events *[]Event) error {
+	switch {
+	case old.Equals(new):
+		return nil
+	case !old.Defined():
+		*events = append(*events, Event{Op: Create, Path: p, New: new})
+		return nil
+	case !new.Defined():
+		*events = append(*events, Event{Op: Delete, Path: p, Old: old})
+		return nil
+	}
+
+	oldEntries, err := entries(ctx, dserv, old)
+	if err != nil {
+		return err
+	}
+	newEntries, err := entries(ctx, dserv, new)
+	if err != nil {
+		return err
+	}
+	if oldEntries == nil || newEntries == nil {
+		*events = append(*events, Event{Op: Modify, Path: p, Old: old, New: new})
+		return nil
+	}
+
+	names := make([]string, 0, len(newEntries))
+	for name := range oldEntries {
+		names = append(names, name)
+	}
+	for name := range newEntries {
+		if _, ok := oldEntries[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := diff(ctx, dserv, gopath.Join(p, name), oldEntries[name], newEntries[name], events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries returns the entries of the directory c, or nil if c is not one.
+func entries(ctx context.Context, dserv ipld.DAGService, c cid.Cid) (map[string]cid.Cid, error) {
+	dir, err := directory(ctx, dserv, c)
+	if err != nil || dir == nil {
+		return nil, err
+	}
+	m := make(map[string]cid.Cid)
+	err = dir.ForEachLink(ctx, func(l *ipld.Link) error {
+		m[l.Name] = l.Cid
+		return nil
+	})
+	return m, err
+}
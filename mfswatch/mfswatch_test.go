@@ -0,0 +1,173 @@
+package mfswatch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/ipfs/go-mfs"
+	ft "github.com/ipfs/go-unixfs"
+)
+
+func setup(t *testing.T) (*Watcher, *mfs.Root, ipld.DAGService) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	dserv := mdtest.Mock()
+	w := New(dserv)
+	nd := ft.EmptyDirNode()
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	w.Publish(nd.Cid())
+	root, err := mfs.NewRoot(ctx, dserv, nd, func(_ context.Context, c cid.Cid) error {
+		w.Publish(c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, root, dserv
+}
+
+func file(t *testing.T, dserv ipld.DAGService, data string) ipld.Node {
+	nd := dag.NodeWithData(ft.FilePBData([]byte(data), uint64(len(data))))
+	if err := dserv.Add(context.Background(), nd); err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func put(t *testing.T, root *mfs.Root, p string, nd ipld.Node) {
+	if err := mfs.PutNode(root, p, nd); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfs.FlushPath(context.Background(), root, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func next(t *testing.T, events <-chan Event) Event {
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("no event")
+		return Event{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	w, root, dserv := setup(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := w.Watch(ctx, "/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changes outside of the path are not seen
+	put(t, root, "/other", file(t, dserv, "other"))
+	if err := mfs.Mkdir(root, "/a/b", mfs.MkdirOpts{Mkparents: true, Flush: true}); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(t, events); e.Op != Create || e.Path != "/a" || !e.New.Defined() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	f1 := file(t, dserv, "1")
+	put(t, root, "/a/b/f", f1)
+	if e := next(t, events); e.Op != Create || e.Path != "/a/b/f" || !e.New.Equals(f1.Cid()) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	f2 := file(t, dserv, "2")
+	if err := mfs.Mv(root, "/a/b/f", "/a/b/g"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mfs.FlushPath(ctx, root, "/a"); err != nil {
+		t.Fatal(err)
+	}
+	// a move is a delete and a create, in the order of the paths
+	if e := next(t, events); e.Op != Delete || e.Path != "/a/b/f" || !e.Old.Equals(f1.Cid()) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	if e := next(t, events); e.Op != Create || e.Path != "/a/b/g" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	dir, err := mfs.Lookup(root, "/a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.(*mfs.Directory).Unlink("g"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, root, "/a/b/g", f2)
+	if e := next(t, events); e.Op != Modify || e.Path != "/a/b/g" || !e.Old.Equals(f1.Cid()) || !e.New.Equals(f2.Cid()) {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	cancel()
+	for range events {
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.watch) != 0 {
+		t.Fatal("watch not removed")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	_, root, dserv := setup(t)
+	ctx := context.Background()
+	rootCid := func() cid.Cid {
+		nd, err := root.GetDirectory().GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return nd.Cid()
+	}
+
+	mkdir := func(p string) {
+		if err := mfs.Mkdir(root, p, mfs.MkdirOpts{Flush: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkdir("/d")
+	put(t, root, "/d/x", file(t, dserv, "x"))
+	before := rootCid()
+	dir, err := mfs.Lookup(root, "/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dir.(*mfs.Directory).Unlink("x"); err != nil {
+		t.Fatal(err)
+	}
+	mkdir("/d/x")
+	put(t, root, "/d/x/y", file(t, dserv, "y"))
+	after := rootCid()
+
+	// a file replaced by a directory is modified
+	events, err := Diff(ctx, dserv, "/", before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != Modify || events[0].Path != "/d/x" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	// a path below a file does not exist
+	events, err = Diff(ctx, dserv, "/d/x/y", before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Op != Create || events[0].Path != "/d/x/y" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	events, err = Diff(ctx, dserv, "/d", after, after)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("unexpected events %+v: %v", events, err)
+	}
+}
@@ -0,0 +1,102 @@
+// Package namechain resolves chains of IPNS names and DNSLinks, such as an
+// IPNS name pointing at a DNSLink pointing at another IPNS name, one name at
+// a time. This bounds the number of names in the chain and the time spent on
+// each, and tells which name failed to resolve.
+package namechain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	namesys "github.com/ipfs/go-namesys"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	caopts "github.com/ipfs/interface-go-ipfs-core/options"
+	nsopts "github.com/ipfs/interface-go-ipfs-core/options/namesys"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+var (
+	// ErrTooDeep is the error of the chains with more names than MaxDepth.
+	ErrTooDeep = errors.New("too many names in the chain")
+	// ErrStepTimeout is the error of the names not resolved within
+	// StepTimeout.
+	ErrStepTimeout = errors.New("name resolution timed out")
+)
+
+// Settings bound the resolution of a chain of names.
+type Settings struct {
+	// MaxDepth is the number of names resolved before giving up, the
+	// namesys default when 0
+	MaxDepth int
+	// StepTimeout bounds the resolution of each name, unbounded when 0
+	StepTimeout time.Duration
+}
+
+// StepError is the failure to resolve a name of the chain.
+type StepError struct {
+	// Step is the position of the name in the chain, from 1
+	Step int
+	// Name is the path of the name, e.g. /ipns/example.com
+	Name string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d of the name resolution, %s: %s", e.Step, e.Name, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Resolve resolves the names of p until it is not an IPNS path, with the
+// options of each name resolution. The error of a name failing to resolve is
+// a *StepError.
+func Resolve(ctx context.Context, names coreiface.NameAPI, p path.Path, settings Settings, opts ...caopts.NameResolveOption) (path.Path, error) {
+	maxDepth := settings.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = nsopts.DefaultDepthLimit
+	}
+	opts = append(opts, caopts.Name.ResolveOption(nsopts.Depth(1)))
+
+	for step := 1; p.Namespace() == "ipns"; step++ {
+		// the name is resolved without the rest of the path, like
+		// resolve.ResolveIPNS does
+		segments := strings.SplitN(strings.TrimPrefix(p.String(), "/ipns/"), "/", 2)
+		name := "/ipns/" + segments[0]
+		if step > maxDepth {
+			return nil, &StepError{Step: step, Name: name, Err: ErrTooDeep}
+		}
+		next, err := resolveStep(ctx, names, name, settings.StepTimeout, opts)
+		if err != nil {
+			return nil, &StepError{Step: step, Name: name, Err: err}
+		}
+		if len(segments) > 1 {
+			next = path.Join(next, segments[1])
+		}
+		p = next
+	}
+	return p, nil
+}
+
+func resolveStep(ctx context.Context, names coreiface.NameAPI, name string, timeout time.Duration, opts []caopts.NameResolveOption) (path.Path, error) {
+	stepCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	next, err := names.Resolve(stepCtx, name, opts...)
+	switch {
+	case err == nil, err == namesys.ErrResolveRecursion:
+		// the name resolved to another name
+		return next, nil
+	case stepCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil:
+		// the routing errors hide the timeout
+		return nil, fmt.Errorf("%w after %s", ErrStepTimeout, timeout)
+	}
+	return nil, err
+}
@@ -0,0 +1,82 @@
+package namechain
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	namesys "github.com/ipfs/go-namesys"
+	coreiface "github.com/ipfs/interface-go-ipfs-core"
+	caopts "github.com/ipfs/interface-go-ipfs-core/options"
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const target = "/ipfs/bafkqaaa"
+
+// fakeNames resolves the names of its map one at a time, and blocks on the
+// names mapped to "".
+type fakeNames struct {
+	coreiface.NameAPI
+	names map[string]string
+}
+
+func (f *fakeNames) Resolve(ctx context.Context, name string, _ ...caopts.NameResolveOption) (path.Path, error) {
+	segments := strings.SplitN(strings.TrimPrefix(name, "/ipns/"), "/", 2)
+	next, ok := f.names[segments[0]]
+	switch {
+	case !ok:
+		return nil, coreiface.ErrResolveFailed
+	case next == "":
+		<-ctx.Done()
+		return nil, coreiface.ErrResolveFailed
+	}
+	if len(segments) > 1 {
+		next += "/" + segments[1]
+	}
+	if strings.HasPrefix(next, "/ipns/") {
+		return path.New(next), namesys.ErrResolveRecursion
+	}
+	return path.New(next), nil
+}
+
+func TestResolve(t *testing.T) {
+	names := &fakeNames{names: map[string]string{
+		"a":           "/ipns/example.com",
+		"example.com": "/ipns/b",
+		"b":           target,
+		"slow":        "",
+		"loop":        "/ipns/loop",
+	}}
+	ctx := context.Background()
+
+	p, err := Resolve(ctx, names, path.New("/ipns/a/dir/file"), Settings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != target+"/dir/file" {
+		t.Errorf("unexpected path %s", p)
+	}
+
+	_, err = Resolve(ctx, names, path.New("/ipns/a"), Settings{MaxDepth: 2})
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Step != 3 || stepErr.Name != "/ipns/b" || !errors.Is(err, ErrTooDeep) {
+		t.Errorf("expected the third name to be too deep, got %v", err)
+	}
+	if _, err = Resolve(ctx, names, path.New("/ipns/loop"), Settings{}); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("expected the loop to be too deep, got %v", err)
+	}
+
+	names.names["b"] = "/ipns/slow"
+	_, err = Resolve(ctx, names, path.New("/ipns/a"), Settings{StepTimeout: 10 * time.Millisecond})
+	if !errors.As(err, &stepErr) || stepErr.Step != 4 || stepErr.Name != "/ipns/slow" || !errors.Is(err, ErrStepTimeout) {
+		t.Errorf("expected the fourth name to time out, got %v", err)
+	}
+
+	names.names["b"] = "/ipns/missing"
+	_, err = Resolve(ctx, names, path.New("/ipns/a"), Settings{})
+	if !errors.As(err, &stepErr) || stepErr.Step != 4 || !errors.Is(err, coreiface.ErrResolveFailed) {
+		t.Errorf("expected the fourth name to fail, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+// Package namespaces holds the resolvers of the mutable-name systems added
+// next to /ipns, such as custom registries or blockchain-based names, each
+// under a namespace of its own: the paths /<namespace>/<name>/... are then
+// resolved by the path APIs and served by the gateway.
+//
+// The resolvers are registered by plugins, see plugin.PluginNamespace.
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+// DepthLimit is the number of names resolved in a row, through the
+// namespaces, before the resolution fails with ErrResolveRecursion.
+const DepthLimit = 32
+
+// ErrResolveRecursion is returned when the names resolved in a row go beyond
+// DepthLimit.
+var ErrResolveRecursion = errors.New("could not resolve name (recursion limit exceeded)")
+
+// Resolver resolves the names of a namespace.
+type Resolver interface {
+	// Resolve returns the path name points to, such as an /ipfs/ path, or a
+	// path of another name, resolved in turn.
+	Resolve(ctx context.Context, name string) (path.Path, error)
+}
+
+// builtin are the namespaces of go-ipfs itself.
+var builtin = map[string]bool{"ipfs": true, "ipns": true, "ipld": true}
+
+var (
+	resolversMu sync.RWMutex
+	resolvers   = map[string]Resolver{}
+)
+
+// Register adds the resolver of the names of namespace, such as "xyz" for
+// the paths /xyz/<name>/... It fails if the namespace is already registered
+// or is one of go-ipfs.
+func Register(namespace string, r Resolver) error {
+	if namespace == "" || strings.ContainsAny(namespace, "/?#") {
+		return fmt.Errorf("invalid namespace %q", namespace)
+	}
+	if builtin[namespace] {
+		return fmt.Errorf("namespace %q is built in", namespace)
+	}
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	if _, ok := resolvers[namespace]; ok {
+		return fmt.Errorf("namespace %q already registered", namespace)
+	}
+	resolvers[namespace] = r
+	return nil
+}
+
+// Names returns the namespaces registered, sorted.
+func Names() []string {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	names := make([]string, 0, len(resolvers))
+	for ns := range resolvers {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(namespace string) (Resolver, bool) {
+	resolversMu.RLock()
+	defer resolversMu.RUnlock()
+	r, ok := resolvers[namespace]
+	return r, ok
+}
+
+// split splits p into its namespace, its name and the rest, starting with a
+// slash if not empty, when the namespace of p is registered.
+func split(p string) (r Resolver, ns, name, rest string, ok bool) {
+	if !strings.HasPrefix(p, "/") {
+		return nil, "", "", "", false
+	}
+	parts := strings.SplitN(p[1:], "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return nil, "", "", "", false
+	}
+	if r, ok = lookup(parts[0]); !ok {
+		return nil, "", "", "", false
+	}
+	if len(parts) == 3 {
+		rest = "/" + parts[2]
+	}
+	return r, parts[0], parts[1], rest, true
+}
+
+// IsNamespaced tells whether p is a path of a registered namespace.
+func IsNamespaced(p string) bool {
+	_, _, _, _, ok := split(p)
+	return ok
+}
+
+// ResolveOnce resolves the name of p, if p is a path of a registered
+// namespace, to the path it points to followed by the rest of p. It returns
+// p unchanged otherwise.
+func ResolveOnce(ctx context.Context, p path.Path) (path.Path, error) {
+	r, ns, name, rest, ok := split(p.String())
+	if !ok {
+		return p, nil
+	}
+	target, err := r.Resolve(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve /%s/%s: %w", ns, name, err)
+	}
+	return path.New(strings.TrimSuffix(target.String(), "/") + rest), nil
+}
+
+// Resolve resolves the names of p, and of the paths they point to in turn,
+// as long as they are in a registered namespace. It returns p unchanged if
+// it is not.
+func Resolve(ctx context.Context, p path.Path) (path.Path, error) {
+	for depth := 0; IsNamespaced(p.String()); depth++ {
+		if depth == DepthLimit {
+			return nil, ErrResolveRecursion
+		}
+		var err error
+		if p, err = ResolveOnce(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Path returns p as a path of a registered namespace, which is valid and
+// mutable, unlike the paths of path.New outside of /ipfs, /ipns and /ipld.
+func Path(p string) (path.Path, bool) {
+	_, ns, _, _, ok := split(p)
+	if !ok {
+		return nil, false
+	}
+	return namespacedPath{p: p, ns: ns}, true
+}
+
+type namespacedPath struct {
+	p, ns string
+}
+
+func (p namespacedPath) String() string    { return p.p }
+func (p namespacedPath) Namespace() string { return p.ns }
+func (p namespacedPath) Mutable() bool     { return true }
+func (p namespacedPath) IsValid() error    { return nil }
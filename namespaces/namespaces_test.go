@@ -0,0 +1,78 @@
+package namespaces
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	path "github.com/ipfs/interface-go-ipfs-core/path"
+)
+
+const welcome = "/ipfs/QmQPeNsJPyVWPFDVHb9Yy1Ea9SAgb86ZYMtf4GWJJpWAuq"
+
+type mapResolver map[string]string
+
+func (m mapResolver) Resolve(ctx context.Context, name string) (path.Path, error) {
+	p, ok := m[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return path.New(p), nil
+}
+
+func TestResolve(t *testing.T) {
+	defer func() { resolvers = map[string]Resolver{} }()
+	if err := Register("xyz", mapResolver{
+		"docs":  welcome + "/",
+		"alias": "/xyz/docs/about",
+		"ipns":  "/ipns/example.com",
+		"loop":  "/xyz/loop",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{"xyz", "ipns", "", "a/b"} {
+		if err := Register(ns, mapResolver{}); err == nil {
+			t.Errorf("expected namespace %q refused", ns)
+		}
+	}
+	if names := Names(); len(names) != 1 || names[0] != "xyz" {
+		t.Fatalf("expected the namespace registered, got %v", names)
+	}
+
+	ctx := context.Background()
+	for _, c := range []struct{ p, resolved string }{
+		{"/xyz/docs", welcome},
+		{"/xyz/docs/readme", welcome + "/readme"},
+		{"/xyz/alias/x", welcome + "/about/x"},
+		// the other namespaces are left to the path APIs
+		{"/xyz/ipns/a", "/ipns/example.com/a"},
+		{welcome, welcome},
+		{"/abc/docs", "/abc/docs"},
+	} {
+		p, err := Resolve(ctx, path.New(c.p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != c.resolved {
+			t.Errorf("expected %s resolved to %s, got %s", c.p, c.resolved, p)
+		}
+	}
+
+	if p, err := ResolveOnce(ctx, path.New("/xyz/alias")); err != nil || p.String() != "/xyz/docs/about" {
+		t.Errorf("expected one name resolved, got %v, %v", p, err)
+	}
+	if _, err := Resolve(ctx, path.New("/xyz/loop")); err != ErrResolveRecursion {
+		t.Errorf("expected the recursion limited, got %v", err)
+	}
+	if _, err := Resolve(ctx, path.New("/xyz/missing")); err == nil {
+		t.Error("expected an unknown name failing")
+	}
+
+	p, ok := Path("/xyz/docs/readme")
+	if !ok || p.Namespace() != "xyz" || !p.Mutable() || p.IsValid() != nil {
+		t.Errorf("expected a valid, mutable path of xyz, got %v", p)
+	}
+	if _, ok := Path("/xyz/"); ok {
+		t.Error("expected a path without a name refused")
+	}
+}
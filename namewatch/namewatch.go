@@ -0,0 +1,129 @@
+// Package namewatch follows the IPNS records published over pubsub, to tell
+// when the value of a name changes without polling its resolution.
+package namewatch
+
+import (
+	"bytes"
+	"context"
+
+	ipns "github.com/ipfs/go-ipns"
+	pb "github.com/ipfs/go-ipns/pb"
+	logging "github.com/ipfs/go-log"
+	path "github.com/ipfs/go-path"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	routing "github.com/libp2p/go-libp2p-core/routing"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	psrouter "github.com/libp2p/go-libp2p-pubsub-router"
+	record "github.com/libp2p/go-libp2p-record"
+)
+
+var log = logging.Logger("namewatch")
+
+// Update is a new value of a name.
+type Update struct {
+	Value    path.Path
+	Sequence uint64
+}
+
+// Watcher follows names over the pubsub topics of IPNS over pubsub.
+type Watcher struct {
+	ps        *pubsub.PubSub
+	psr       *psrouter.PubsubValueStore
+	vs        routing.ValueStore
+	validator record.Validator
+}
+
+// NewWatcher returns a Watcher receiving records on the topics of psr, and
+// looking up the current records of the names in vs.
+func NewWatcher(ps *pubsub.PubSub, psr *psrouter.PubsubValueStore, vs routing.ValueStore, validator record.Validator) *Watcher {
+	return &Watcher{ps: ps, psr: psr, vs: vs, validator: validator}
+}
+
+// Watch sends the current value of the name of id, then its new value each
+// time a newer record of the name with another value is received, until ctx
+// is done.
+func (w *Watcher) Watch(ctx context.Context, id peer.ID) (<-chan Update, error) {
+	key := ipns.RecordKey(id)
+	// the topic is joined by the pubsub router first, so that the records
+	// are validated by it and it keeps the latest one
+	if err := w.psr.Subscribe(key); err != nil {
+		return nil, err
+	}
+	sub, err := w.ps.Subscribe(psrouter.KeyToTopic(key))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Update)
+	go func() {
+		defer close(out)
+		defer sub.Cancel()
+
+		var t tracker
+		send := func(val []byte) bool {
+			if err := w.validator.Validate(key, val); err != nil {
+				log.Debugf("invalid record of %s: %s", id, err)
+				return true
+			}
+			u, ok := t.update(val)
+			if !ok {
+				return true
+			}
+			select {
+			case out <- u:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if val, err := w.vs.GetValue(ctx, key); err == nil {
+			if !send(val) {
+				return
+			}
+		} else {
+			log.Debugf("looking up the record of %s: %s", id, err)
+		}
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if !send(msg.GetData()) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// tracker keeps the latest record of a name.
+type tracker struct {
+	last *pb.IpnsEntry
+}
+
+// update returns the value of the record val, or false if val is not newer
+// than the latest record or has the same value.
+func (t *tracker) update(val []byte) (Update, bool) {
+	entry := new(pb.IpnsEntry)
+	if err := entry.Unmarshal(val); err != nil {
+		return Update{}, false
+	}
+	if t.last != nil {
+		if c, err := ipns.Compare(entry, t.last); err != nil || c <= 0 {
+			return Update{}, false
+		}
+	}
+	same := t.last != nil && bytes.Equal(entry.GetValue(), t.last.GetValue())
+	t.last = entry
+	if same {
+		return Update{}, false
+	}
+
+	p, err := path.ParsePath(string(entry.GetValue()))
+	if err != nil {
+		log.Debugf("invalid value of record: %s", err)
+		return Update{}, false
+	}
+	return Update{Value: p, Sequence: entry.GetSequence()}, true
+}
@@ -0,0 +1,60 @@
+package namewatch
+
+import (
+	"testing"
+	"time"
+
+	ipns "github.com/ipfs/go-ipns"
+	"github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func newRecord(t *testing.T, sk crypto.PrivKey, value string, seq uint64) []byte {
+	entry, err := ipns.Create(sk, []byte(value), seq, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := entry.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestTracker(t *testing.T) {
+	sk, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		a = "/ipfs/bafkqaaa"
+		b = "/ipfs/QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+	)
+
+	var tr tracker
+	for i, step := range []struct {
+		value   string
+		seq     uint64
+		updated bool
+	}{
+		{a, 1, true},
+		// republished
+		{a, 2, false},
+		{b, 3, true},
+		// an older record received late
+		{a, 1, false},
+		{"not a path", 4, false},
+		{a, 5, true},
+	} {
+		u, ok := tr.update(newRecord(t, sk, step.value, step.seq))
+		if ok != step.updated {
+			t.Fatalf("step %d: expected updated to be %t", i, step.updated)
+		}
+		if ok && (u.Value.String() != step.value || u.Sequence != step.seq) {
+			t.Fatalf("step %d: unexpected update %+v", i, u)
+		}
+	}
+
+	if _, ok := tr.update([]byte("garbage")); ok {
+		t.Fatal("expected an invalid record to be ignored")
+	}
+}
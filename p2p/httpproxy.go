@@ -0,0 +1,187 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	gonet "net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	net "github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// PeerIDHeader is the header telling the HTTP server behind an HTTP listener
+// the peer a request comes from.
+const PeerIDHeader = "X-Forwarded-Peer-Id"
+
+var httpComponent = ma.StringCast("/http")
+
+// httpListener accepts libp2p streams of HTTP requests and proxies the
+// requests to an HTTP server
+type httpListener struct {
+	p2p *P2P
+
+	// Application proto identifier.
+	proto protocol.ID
+
+	// Address of the HTTP server to proxy the requests to
+	addr ma.Multiaddr
+
+	server  *http.Server
+	streams *streamListener
+}
+
+// ForwardRemoteHTTP creates new p2p listener proxying the HTTP requests of
+// the incoming streams to the HTTP server at addr. The server has timeout to
+// answer a request, and a stream to send its next request.
+func (p2p *P2P) ForwardRemoteHTTP(ctx context.Context, proto protocol.ID, addr ma.Multiaddr, timeout time.Duration) (Listener, error) {
+	network, host, err := manet.DialArgs(addr)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &gonet.Dialer{Timeout: timeout}
+
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: host})
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		// the remote address of a request is the peer it comes from
+		r.Header.Set(PeerIDHeader, r.RemoteAddr)
+	}
+	proxy.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (gonet.Conn, error) {
+			return dialer.DialContext(ctx, network, host)
+		},
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       timeout,
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Debugf("proxying the HTTP request of %s to %s: %s", r.RemoteAddr, addr, err)
+		var nerr gonet.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	listener := &httpListener{
+		p2p: p2p,
+
+		proto: proto,
+		addr:  addr,
+
+		streams: &streamListener{
+			local:  p2p.identity,
+			conns:  make(chan gonet.Conn),
+			closed: make(chan struct{}),
+		},
+	}
+	listener.server = &http.Server{
+		Handler:           proxy,
+		ReadHeaderTimeout: timeout,
+		IdleTimeout:       timeout,
+	}
+
+	if err := p2p.ListenersP2P.Register(listener); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := listener.server.Serve(listener.streams); err != http.ErrServerClosed {
+			log.Errorf("serving the HTTP requests of %s: %s", proto, err)
+		}
+	}()
+
+	return listener, nil
+}
+
+func (l *httpListener) handleStream(remote net.Stream) {
+	select {
+	case l.streams.conns <- streamConn{remote}:
+	case <-l.streams.closed:
+		_ = remote.Reset()
+	}
+}
+
+func (l *httpListener) Protocol() protocol.ID {
+	return l.proto
+}
+
+func (l *httpListener) ListenAddress() ma.Multiaddr {
+	addr, err := ma.NewMultiaddr(maPrefix + l.p2p.identity.Pretty())
+	if err != nil {
+		panic(err)
+	}
+	return addr
+}
+
+// TargetAddress is the address of the HTTP server, ending with /http.
+func (l *httpListener) TargetAddress() ma.Multiaddr {
+	return l.addr.Encapsulate(httpComponent)
+}
+
+func (l *httpListener) close() {
+	// closes the requests being proxied too
+	_ = l.server.Close()
+}
+
+func (l *httpListener) key() string {
+	return string(l.proto)
+}
+
+// streamListener is a net.Listener of the libp2p streams of a listener.
+type streamListener struct {
+	local  peer.ID
+	conns  chan gonet.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *streamListener) Accept() (gonet.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, gonet.ErrClosed
+	}
+}
+
+func (l *streamListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *streamListener) Addr() gonet.Addr {
+	return peerAddr(l.local)
+}
+
+// streamConn is a libp2p stream as a net.Conn.
+type streamConn struct {
+	net.Stream
+}
+
+func (c streamConn) LocalAddr() gonet.Addr {
+	return peerAddr(c.Conn().LocalPeer())
+}
+
+func (c streamConn) RemoteAddr() gonet.Addr {
+	return peerAddr(c.Conn().RemotePeer())
+}
+
+// peerAddr is the address of a peer, as a net.Addr.
+type peerAddr peer.ID
+
+func (a peerAddr) Network() string {
+	return "libp2p"
+}
+
+func (a peerAddr) String() string {
+	return peer.ID(a).Pretty()
+}
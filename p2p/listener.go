@@ -22,6 +22,11 @@ type Listener interface {
 	close()
 }
 
+// remoteHandler is a Listener of libp2p streams
+type remoteHandler interface {
+	handleStream(net.Stream)
+}
+
 // Listeners manages a group of Listener implementations,
 // checking for conflicts and optionally dispatching connections
 type Listeners struct {
@@ -52,8 +57,8 @@ func newListenersP2P(host p2phost.Host) *Listeners {
 		defer reg.RUnlock()
 
 		l := reg.Listeners[string(stream.Protocol())]
-		if l != nil {
-			go l.(*remoteListener).handleStream(stream)
+		if l, ok := l.(remoteHandler); ok {
+			go l.handleStream(stream)
 		}
 	})
 
@@ -0,0 +1,371 @@
+// Package peerstats records how fast and how reliably the peers answered the
+// wants of bitswap, and persists it in the datastore, so that the providers
+// that answered well in the past are preferred over the others.
+//
+// The Recorder is given to bitswap as its tracer, to see the wants sent and
+// the blocks and block presences received. A want answered with a block or a
+// HAVE is a hit, taking the time since the want was sent; a want answered with
+// a DONT_HAVE is a miss. The wants that are not answered are not accounted,
+// bitswap broadcasting them to peers that are not expected to have the
+// blocks, but they are counted as outstanding until they time out.
+package peerstats
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var log = logging.Logger("peerstats")
+
+var (
+	wantLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ipfs_bitswap_want_latency_seconds",
+		Help:    "time between the wants sent to the peers and their answers, a block or a HAVE",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	outstandingWants = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_bitswap_outstanding_wants",
+		Help: "number of wants sent to the peers and not answered yet",
+	})
+)
+
+// statsKey is the datastore key under which the stats are persisted.
+var statsKey = ds.NewKey("/local/peerstats")
+
+const (
+	// MaxPeers is the number of peers whose stats are kept, the peers that
+	// answered last.
+	MaxPeers = 4096
+	// FlushInterval is the interval at which the stats are persisted.
+	FlushInterval = time.Minute
+
+	// minAnswers is the number of answers of a peer before it is judged.
+	minAnswers = 3
+	// latencyWeight is the weight of the last latency in the moving average.
+	latencyWeight = 0.2
+	// wantTimeout is how long a want sent is waited for an answer.
+	wantTimeout = time.Minute
+)
+
+// Stat is the record of the answers of a peer.
+type Stat struct {
+	// Hits is the number of wants answered with a block or a HAVE
+	Hits uint64
+	// Misses is the number of wants answered with a DONT_HAVE
+	Misses uint64
+	// Latency is the moving average of the time the hits took
+	Latency time.Duration
+	// Updated is the time of the last answer
+	Updated time.Time
+}
+
+// Score is the expected time the peer takes to provide a block: the latency
+// of its hits divided by the rate of its hits. Lower is better.
+func (s Stat) Score() time.Duration {
+	rate := float64(s.Hits+1) / float64(s.Hits+s.Misses+2)
+	return time.Duration(float64(s.Latency) / rate)
+}
+
+// want is a want sent to a peer.
+type want struct {
+	p peer.ID
+	c cid.Cid
+}
+
+// Recorder records the stats of the peers, until Close is called.
+type Recorder struct {
+	ds ds.Datastore
+
+	mu    sync.Mutex
+	peers map[peer.ID]*Stat
+	dirty map[peer.ID]struct{}
+	// sent is when the wants not answered yet were sent
+	sent map[want]time.Time
+	// outstanding is the number of the wants in sent, by peer
+	outstanding map[peer.ID]int
+	// threshold is the median score of the peers judged, above which a peer
+	// is slow
+	threshold time.Duration
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// New returns a recorder of the stats persisted in d.
+func New(ctx context.Context, d ds.Datastore) (*Recorder, error) {
+	r := &Recorder{
+		ds:          d,
+		peers:       make(map[peer.ID]*Stat),
+		dirty:       make(map[peer.ID]struct{}),
+		sent:        make(map[want]time.Time),
+		outstanding: make(map[peer.ID]int),
+		closing:     make(chan struct{}),
+		closed:      make(chan struct{}),
+	}
+	res, err := d.Query(ctx, dsq.Query{Prefix: statsKey.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		k := ds.RawKey(e.Key)
+		p, err := peer.Decode(k.BaseNamespace())
+		if err != nil {
+			log.Warnf("ignoring the stats of invalid peer %s", k.BaseNamespace())
+			continue
+		}
+		var st Stat
+		if err := json.Unmarshal(e.Value, &st); err != nil {
+			log.Warnf("ignoring the invalid stats of peer %s: %s", p, err)
+			continue
+		}
+		r.peers[p] = &st
+	}
+	r.rescore()
+	go r.run()
+	return r, nil
+}
+
+// Stat returns the stats of p, if any.
+func (r *Recorder) Stat(p peer.ID) (Stat, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.peers[p]
+	if !ok {
+		return Stat{}, false
+	}
+	return *st, true
+}
+
+// Outstanding returns the number of the wants sent to p not answered yet.
+func (r *Recorder) Outstanding(p peer.ID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.outstanding[p]
+}
+
+// Slow reports whether p answered slower than most peers, or missed most of
+// the wants. The peers without enough answers are not slow.
+func (r *Recorder) Slow(p peer.ID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st, ok := r.peers[p]
+	return ok && judged(st) && r.threshold > 0 && st.Score() > r.threshold
+}
+
+// Sort sorts ps by their scores, best first. The peers without enough
+// answers come first, as nothing says they are slow.
+func (r *Recorder) Sort(ps []peer.AddrInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	score := func(p peer.ID) time.Duration {
+		if st, ok := r.peers[p]; ok && judged(st) {
+			return st.Score()
+		}
+		return 0
+	}
+	sort.SliceStable(ps, func(i, j int) bool {
+		return score(ps[i].ID) < score(ps[j].ID)
+	})
+}
+
+func judged(st *Stat) bool {
+	return st.Hits+st.Misses >= minAnswers
+}
+
+// MessageSent records the time the wants of msg were sent to p. It implements
+// bitswap.Tracer.
+func (r *Recorder) MessageSent(p peer.ID, msg bsmsg.BitSwapMessage) {
+	entries := msg.Wantlist()
+	if len(entries) == 0 {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range entries {
+		w := want{p, e.Cid}
+		if e.Cancel {
+			r.forget(w)
+			continue
+		}
+		if _, ok := r.sent[w]; !ok {
+			r.sent[w] = now
+			r.outstanding[p]++
+		}
+	}
+	outstandingWants.Set(float64(len(r.sent)))
+}
+
+// MessageReceived records the answers of p in msg to the wants sent to it. It
+// implements bitswap.Tracer.
+func (r *Recorder) MessageReceived(p peer.ID, msg bsmsg.BitSwapMessage) {
+	blks := msg.Blocks()
+	haves := msg.Haves()
+	dontHaves := msg.DontHaves()
+	if len(blks)+len(haves)+len(dontHaves) == 0 {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range blks {
+		r.answer(p, b.Cid(), true, now)
+	}
+	for _, c := range haves {
+		r.answer(p, c, true, now)
+	}
+	for _, c := range dontHaves {
+		r.answer(p, c, false, now)
+	}
+	outstandingWants.Set(float64(len(r.sent)))
+}
+
+// answer records the answer of p to the want of c, if it was sent.
+func (r *Recorder) answer(p peer.ID, c cid.Cid, hit bool, now time.Time) {
+	w := want{p, c}
+	sent, ok := r.sent[w]
+	if !ok {
+		return
+	}
+	r.forget(w)
+
+	st, ok := r.peers[p]
+	if !ok {
+		st = &Stat{}
+		r.peers[p] = st
+	}
+	if hit {
+		latency := now.Sub(sent)
+		wantLatency.Observe(latency.Seconds())
+		if st.Hits == 0 {
+			st.Latency = latency
+		} else {
+			st.Latency += time.Duration(latencyWeight * float64(latency-st.Latency))
+		}
+		st.Hits++
+	} else {
+		st.Misses++
+	}
+	st.Updated = now
+	r.dirty[p] = struct{}{}
+}
+
+// forget forgets the want w sent. r.mu must be held.
+func (r *Recorder) forget(w want) {
+	if _, ok := r.sent[w]; !ok {
+		return
+	}
+	delete(r.sent, w)
+	if r.outstanding[w.p]--; r.outstanding[w.p] <= 0 {
+		delete(r.outstanding, w.p)
+	}
+}
+
+// Close persists the stats and stops recording.
+func (r *Recorder) Close() error {
+	close(r.closing)
+	<-r.closed
+	return r.flush(context.Background(), time.Now())
+}
+
+func (r *Recorder) run() {
+	defer close(r.closed)
+	t := time.NewTicker(FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case now := <-t.C:
+			if err := r.flush(context.Background(), now); err != nil {
+				log.Errorf("persisting the peer stats: %s", err)
+			}
+		case <-r.closing:
+			return
+		}
+	}
+}
+
+// flush persists the stats changed, forgets the wants not answered in time
+// and the peers past MaxPeers, and scores the peers again.
+func (r *Recorder) flush(ctx context.Context, now time.Time) error {
+	r.mu.Lock()
+	for w, sent := range r.sent {
+		if now.Sub(sent) > wantTimeout {
+			r.forget(w)
+		}
+	}
+	outstandingWants.Set(float64(len(r.sent)))
+	var evicted []peer.ID
+	if len(r.peers) > MaxPeers {
+		ps := make([]peer.ID, 0, len(r.peers))
+		for p := range r.peers {
+			ps = append(ps, p)
+		}
+		sort.Slice(ps, func(i, j int) bool {
+			return r.peers[ps[i]].Updated.After(r.peers[ps[j]].Updated)
+		})
+		evicted = ps[MaxPeers:]
+		for _, p := range evicted {
+			delete(r.peers, p)
+			delete(r.dirty, p)
+		}
+	}
+	changed := make(map[peer.ID]Stat, len(r.dirty))
+	for p := range r.dirty {
+		changed[p] = *r.peers[p]
+	}
+	r.dirty = make(map[peer.ID]struct{})
+	r.rescore()
+	r.mu.Unlock()
+
+	if len(changed) == 0 && len(evicted) == 0 {
+		return nil
+	}
+	for _, p := range evicted {
+		if err := r.ds.Delete(ctx, statsKey.ChildString(p.String())); err != nil {
+			return err
+		}
+	}
+	for p, st := range changed {
+		b, err := json.Marshal(&st)
+		if err != nil {
+			return err
+		}
+		if err := r.ds.Put(ctx, statsKey.ChildString(p.String()), b); err != nil {
+			return err
+		}
+	}
+	return r.ds.Sync(ctx, statsKey)
+}
+
+// rescore sets the threshold to the median score of the peers judged. r.mu
+// must be held.
+func (r *Recorder) rescore() {
+	var scores []time.Duration
+	for _, st := range r.peers {
+		if judged(st) {
+			scores = append(scores, st.Score())
+		}
+	}
+	if len(scores) == 0 {
+		r.threshold = 0
+		return
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i] < scores[j] })
+	r.threshold = scores[len(scores)/2]
+}
@@ -0,0 +1,256 @@
+package peerstats
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	bsmsg "github.com/ipfs/go-bitswap/message"
+	pb "github.com/ipfs/go-bitswap/message/pb"
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func testPeer(t *testing.T, i int) peer.ID {
+	t.Helper()
+	h, err := mh.Sum([]byte(fmt.Sprint("peer ", i)), mh.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return peer.ID(h)
+}
+
+// fastPeers has peers 10 to 10+n answer fast, to judge the others against.
+func fastPeers(t *testing.T, r *Recorder, n int) {
+	for i := 0; i < n; i++ {
+		fetch(r, testPeer(t, 10+i), 4, 0, 10*time.Millisecond)
+	}
+	r.mu.Lock()
+	r.rescore()
+	r.mu.Unlock()
+}
+
+func wants(cs ...cid.Cid) bsmsg.BitSwapMessage {
+	msg := bsmsg.New(false)
+	for _, c := range cs {
+		msg.AddEntry(c, 1, pb.Message_Wantlist_Block, true)
+	}
+	return msg
+}
+
+// fetch has p answer the wants of n blocks after latency, with DONT_HAVE
+// for the misses first ones.
+func fetch(r *Recorder, p peer.ID, n, misses int, latency time.Duration) {
+	for i := 0; i < n; i++ {
+		b := blocks.NewBlock([]byte(fmt.Sprintf("%s %d %d", p, i, time.Now().UnixNano())))
+		r.MessageSent(p, wants(b.Cid()))
+		r.mu.Lock()
+		r.sent[want{p, b.Cid()}] = time.Now().Add(-latency)
+		r.mu.Unlock()
+		msg := bsmsg.New(false)
+		if i < misses {
+			msg.AddDontHave(b.Cid())
+		} else {
+			msg.AddBlock(b)
+		}
+		r.MessageReceived(p, msg)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	r, err := New(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, slow, missing := testPeer(t, 0), testPeer(t, 1), testPeer(t, 2)
+	fetch(r, fast, 4, 0, 5*time.Millisecond)
+	fetch(r, slow, 4, 0, time.Second)
+	fetch(r, missing, 4, 3, 10*time.Millisecond)
+	fastPeers(t, r, 2)
+
+	// blocks not wanted are not accounted
+	r.MessageReceived(testPeer(t, 3), bsmsg.New(false))
+	unwanted := bsmsg.New(false)
+	unwanted.AddBlock(blocks.NewBlock([]byte("unwanted")))
+	r.MessageReceived(testPeer(t, 3), unwanted)
+	if _, ok := r.Stat(testPeer(t, 3)); ok {
+		t.Fatal("unwanted block accounted")
+	}
+
+	// the wants not answered are outstanding, until cancelled
+	pending := blocks.NewBlock([]byte("pending"))
+	r.MessageSent(fast, wants(pending.Cid()))
+	if n := r.Outstanding(fast); n != 1 {
+		t.Fatalf("got %d outstanding wants, expected 1", n)
+	}
+	cancel := bsmsg.New(false)
+	cancel.Cancel(pending.Cid())
+	r.MessageSent(fast, cancel)
+	if n := r.Outstanding(fast); n != 0 {
+		t.Fatalf("got %d outstanding wants after the cancel, expected 0", n)
+	}
+
+	st, _ := r.Stat(missing)
+	if st.Hits != 1 || st.Misses != 3 {
+		t.Fatalf("got %d hits and %d misses, expected 1 and 3", st.Hits, st.Misses)
+	}
+	st, _ = r.Stat(slow)
+	if st.Hits != 4 || st.Latency < 900*time.Millisecond {
+		t.Fatalf("got %d hits in %s, expected 4 in 1s", st.Hits, st.Latency)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the stats are persisted, and the peers judged on them
+	r, err = New(ctx, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, _ := r.Stat(slow); got.Hits != st.Hits || got.Latency != st.Latency || !got.Updated.Equal(st.Updated) {
+		t.Fatalf("got %v after restart, expected %v", got, st)
+	}
+	if r.Slow(fast) || !r.Slow(slow) || !r.Slow(missing) || r.Slow(testPeer(t, 3)) {
+		t.Fatal("fast and unknown peers must not be slow, others must")
+	}
+
+	ps := []peer.AddrInfo{{ID: slow}, {ID: missing}, {ID: testPeer(t, 3)}, {ID: fast}}
+	r.Sort(ps)
+	if ps[0].ID != testPeer(t, 3) || ps[1].ID != fast {
+		t.Fatalf("unknown and fast peers must come first: %v", ps)
+	}
+}
+
+func TestEvict(t *testing.T) {
+	r := &Recorder{
+		ds:          dssync.MutexWrap(ds.NewMapDatastore()),
+		peers:       make(map[peer.ID]*Stat),
+		dirty:       make(map[peer.ID]struct{}),
+		sent:        make(map[want]time.Time),
+		outstanding: make(map[peer.ID]int),
+	}
+	now := time.Now()
+	r.sent[want{testPeer(t, 0), cid.Undef}] = now.Add(-2 * wantTimeout)
+	r.outstanding[testPeer(t, 0)] = 1
+	for i := 0; i <= MaxPeers; i++ {
+		p := peer.ID(fmt.Sprint(i))
+		r.peers[p] = &Stat{Hits: 1, Updated: now.Add(time.Duration(i) * time.Second)}
+		r.dirty[p] = struct{}{}
+	}
+	if err := r.flush(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.peers) != MaxPeers || r.peers[peer.ID("0")] != nil {
+		t.Fatal("the peer that answered first must be forgotten")
+	}
+	if len(r.sent) != 0 || r.Outstanding(testPeer(t, 0)) != 0 {
+		t.Fatal("the want not answered in time must be forgotten")
+	}
+}
+
+// staticRouting finds the providers given, one after another.
+type staticRouting struct {
+	routing.ContentRouting
+	providers []peer.ID
+	// asked is the count looked up
+	asked int
+}
+
+func (rt *staticRouting) FindProvidersAsync(ctx context.Context, _ cid.Cid, count int) <-chan peer.AddrInfo {
+	rt.asked = count
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		for i, p := range rt.providers {
+			if count > 0 && i == count {
+				return
+			}
+			select {
+			case out <- peer.AddrInfo{ID: p}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+func TestRouting(t *testing.T) {
+	r, err := New(context.Background(), dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fast, slow, slower := testPeer(t, 0), testPeer(t, 1), testPeer(t, 2)
+	fetch(r, fast, 4, 0, 5*time.Millisecond)
+	fetch(r, slow, 4, 0, time.Second)
+	fetch(r, slower, 4, 0, 2*time.Second)
+	fastPeers(t, r, 2)
+	unknown := testPeer(t, 3)
+
+	for _, tc := range []struct {
+		providers []peer.ID
+		count     int
+		expected  []peer.ID
+	}{
+		// the slow providers make way for the others
+		{[]peer.ID{slower, slow, fast, unknown}, 2, []peer.ID{fast, unknown}},
+		// and make up for the others not found, fastest first
+		{[]peer.ID{slower, slow, fast}, 2, []peer.ID{fast, slow}},
+		{[]peer.ID{slower, slow}, 3, []peer.ID{slow, slower}},
+		// all the providers are passed on without a count
+		{[]peer.ID{slower, fast}, 0, []peer.ID{slower, fast}},
+	} {
+		rt := &staticRouting{providers: tc.providers}
+		var got []peer.ID
+		for ai := range (preferFast{rt, r, time.Minute}).FindProvidersAsync(context.Background(), cid.Undef, tc.count) {
+			got = append(got, ai.ID)
+		}
+		if tc.count > 0 && rt.asked != lookupFactor*tc.count {
+			t.Fatalf("%d providers looked up, expected %d", rt.asked, lookupFactor*tc.count)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+			t.Fatalf("got providers %v, expected %v", got, tc.expected)
+		}
+	}
+
+	// the slow providers are held back until the delay passes
+	rt := &staticRouting{providers: []peer.ID{slow}}
+	blocking := blockingRouting{rt}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	ch := (preferFast{blocking, r, 50 * time.Millisecond}).FindProvidersAsync(ctx, cid.Undef, 2)
+	if ai := <-ch; ai.ID != slow || time.Since(start) < 50*time.Millisecond {
+		t.Fatal("slow provider must be passed on after the delay")
+	}
+}
+
+// blockingRouting finds the providers of its routing, and then blocks until
+// the lookup is canceled.
+type blockingRouting struct {
+	rt *staticRouting
+}
+
+func (b blockingRouting) Provide(context.Context, cid.Cid, bool) error { return nil }
+
+func (b blockingRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	out := make(chan peer.AddrInfo)
+	go func() {
+		defer close(out)
+		for ai := range b.rt.FindProvidersAsync(ctx, c, count) {
+			out <- ai
+		}
+		<-ctx.Done()
+	}()
+	return out
+}
@@ -0,0 +1,114 @@
+package peerstats
+
+import (
+	"context"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+const (
+	// lookupFactor is how many more providers are looked up than asked for,
+	// to make up for the slow ones held back.
+	lookupFactor = 2
+	// HoldDelay is how long the slow providers are held back, waiting for
+	// faster ones, after the first of them is found.
+	HoldDelay = time.Second
+)
+
+// preferFast is a content routing preferring the providers that are not
+// slow.
+type preferFast struct {
+	routing.ContentRouting
+	r     *Recorder
+	delay time.Duration
+}
+
+// NewRouting returns rt, preferring the providers that are not slow by the
+// stats of r. The providers found are passed on as they come, but for the
+// slow ones, which are held back until the lookup ends or HoldDelay passed,
+// and are only passed on, fastest first, if not enough others were found.
+func NewRouting(rt routing.ContentRouting, r *Recorder) routing.ContentRouting {
+	return preferFast{rt, r, HoldDelay}
+}
+
+func (rt preferFast) FindProvidersAsync(ctx context.Context, c cid.Cid, count int) <-chan peer.AddrInfo {
+	if count <= 0 {
+		// all the providers are passed on anyway
+		return rt.ContentRouting.FindProvidersAsync(ctx, c, count)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	in := rt.ContentRouting.FindProvidersAsync(ctx, c, lookupFactor*count)
+	out := make(chan peer.AddrInfo, count)
+
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		sent := 0
+		send := func(ai peer.AddrInfo) bool {
+			select {
+			case out <- ai:
+				sent++
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// release passes on the providers held back, until count are sent
+		var held []peer.AddrInfo
+		release := func() bool {
+			rt.r.Sort(held)
+			for _, ai := range held {
+				if sent == count {
+					break
+				}
+				if !send(ai) {
+					return false
+				}
+			}
+			held = nil
+			return true
+		}
+
+		var hold *time.Timer
+		var holdC <-chan time.Time
+		defer func() {
+			if hold != nil {
+				hold.Stop()
+			}
+		}()
+		holding := true
+		for sent < count {
+			select {
+			case ai, ok := <-in:
+				if !ok {
+					release()
+					return
+				}
+				if holding && rt.r.Slow(ai.ID) {
+					held = append(held, ai)
+					if hold == nil {
+						hold = time.NewTimer(rt.delay)
+						holdC = hold.C
+					}
+					continue
+				}
+				if !send(ai) {
+					return
+				}
+			case <-holdC:
+				holding = false
+				holdC = nil
+				if !release() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
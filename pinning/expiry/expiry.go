@@ -0,0 +1,211 @@
+// Package expiry implements the expiry of pins: pins added with an expiry
+// class are removed once they exceed the age or inactivity limits of their
+// class, and pins added with a TTL once it has passed.
+//
+// The class of a pin is recorded in the repo datastore, along with when it
+// was added and when its root was last read. Reads are recorded by wrapping
+// the blockstore with NewBlockstore, except for the reads made with an
+// Untracked context.
+package expiry
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log"
+
+	"github.com/ipfs/go-ipfs/pinning/pinstore"
+)
+
+var log = logging.Logger("pinexpiry")
+
+// pinsKey is the datastore key under which the expiring pins are stored.
+var pinsKey = ds.NewKey("/local/pins/expiry")
+
+// accessResolution is how precisely the last read of a pin is recorded, which
+// bounds how often reads are written to the datastore.
+const accessResolution = time.Minute
+
+// Pin is a pin of Root which expires according to Class, or at Expires.
+type Pin struct {
+	Root  cid.Cid
+	Class string `json:",omitempty"`
+	// Expires is when the TTL of the pin passes, zero if it has none.
+	Expires time.Time
+	// Added is when the pin was added with its class.
+	Added time.Time
+	// Accessed is when the root of the pin was last read.
+	Accessed time.Time
+}
+
+// Store stores the expiring pins of a repo.
+type Store struct {
+	records *pinstore.Store
+
+	loadOnce sync.Once
+	loadErr  error
+
+	// mu guards accessed, the time of the last recorded read of each root.
+	mu       sync.Mutex
+	accessed map[cid.Cid]time.Time
+}
+
+// New returns the store of the expiring pins kept in d.
+func New(d ds.Datastore) *Store {
+	return &Store{records: pinstore.New(d, pinsKey, "expiring pin")}
+}
+
+// load reads the roots of the pins, so reads of other blocks are not looked
+// up in the datastore.
+func (s *Store) load() error {
+	s.loadOnce.Do(func() {
+		pins, err := s.List(context.Background())
+		if err != nil {
+			s.loadErr = err
+			return
+		}
+		s.accessed = make(map[cid.Cid]time.Time, len(pins))
+		for _, p := range pins {
+			s.accessed[p.Root] = p.Accessed
+		}
+	})
+	return s.loadErr
+}
+
+// Add records that the pin of root expires according to class if set, and at
+// expires if not zero, replacing its previous expiry if any. The age of the
+// pin starts now.
+func (s *Store) Add(ctx context.Context, root cid.Cid, class string, expires time.Time) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if err := s.put(ctx, Pin{Root: root, Class: class, Expires: expires, Added: now, Accessed: now}); err != nil {
+		return err
+	}
+	s.accessed[root] = now
+	return nil
+}
+
+func (s *Store) put(ctx context.Context, p Pin) error {
+	return s.records.Put(ctx, s.records.Key(p.Root), &p)
+}
+
+// Remove removes the expiry of the pin of root, and reports whether it had
+// one. The pin itself is left alone.
+func (s *Store) Remove(ctx context.Context, root cid.Cid) (bool, error) {
+	if err := s.load(); err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed, err := s.records.Delete(ctx, s.records.Key(root))
+	if err != nil || !removed {
+		return false, err
+	}
+	delete(s.accessed, root)
+	return true, nil
+}
+
+// Get returns the expiring pin of root, if any.
+func (s *Store) Get(ctx context.Context, root cid.Cid) (Pin, bool, error) {
+	var p Pin
+	found, err := s.records.Get(ctx, s.records.Key(root), &p)
+	if err != nil || !found {
+		return Pin{}, false, err
+	}
+	return p, true, nil
+}
+
+// List returns all the expiring pins, sorted by root.
+func (s *Store) List(ctx context.Context) ([]Pin, error) {
+	var pins []Pin
+	err := s.records.List(ctx, s.records.Key(cid.Undef), func(decode func(interface{}) error) error {
+		var p Pin
+		if err := decode(&p); err != nil {
+			return err
+		}
+		pins = append(pins, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].Root.KeyString() < pins[j].Root.KeyString()
+	})
+	return pins, nil
+}
+
+// Touch records that c was read, if it is the root of an expiring pin.
+func (s *Store) Touch(ctx context.Context, c cid.Cid) error {
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.accessed[c]
+	now := time.Now()
+	if !ok || now.Sub(last) < accessResolution {
+		return nil
+	}
+
+	p, found, err := s.Get(ctx, c)
+	if err != nil || !found {
+		return err
+	}
+	p.Accessed = now
+	if err := s.put(ctx, p); err != nil {
+		return err
+	}
+	s.accessed[c] = now
+	return nil
+}
+
+type untrackedKey struct{}
+
+// Untracked returns a context whose reads are not recorded, for internal
+// walks of the pinned DAGs such as those of GC and the reprovider, which
+// would otherwise keep every pin active.
+func Untracked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, untrackedKey{}, true)
+}
+
+func isUntracked(ctx context.Context) bool {
+	untracked, _ := ctx.Value(untrackedKey{}).(bool)
+	return untracked
+}
+
+// Blockstore records the reads of the roots of expiring pins.
+type Blockstore struct {
+	blockstore.Blockstore
+	store *Store
+}
+
+// NewBlockstore returns bs, recording the reads of the roots of the pins of
+// store.
+func NewBlockstore(bs blockstore.Blockstore, store *Store) *Blockstore {
+	return &Blockstore{Blockstore: bs, store: store}
+}
+
+func (bs *Blockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := bs.Blockstore.Get(ctx, c)
+	if err != nil || isUntracked(ctx) {
+		return blk, err
+	}
+	if err := bs.store.Touch(ctx, c); err != nil {
+		log.Warnf("recording read of %s: %s", c, err)
+	}
+	return blk, nil
+}
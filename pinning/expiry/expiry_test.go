@@ -0,0 +1,132 @@
+package expiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestBlockstoreTouch(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	s := New(dstore)
+	bs := NewBlockstore(bstore.NewBlockstore(dstore), s)
+
+	nd := dag.NodeWithData([]byte("root"))
+	if err := bs.Put(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(ctx, nd.Cid(), "cache", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	accessed := func() time.Time {
+		t.Helper()
+		p, found, err := s.Get(ctx, nd.Cid())
+		if err != nil || !found {
+			t.Fatalf("expected %s to expire: %v", nd.Cid(), err)
+		}
+		return p.Accessed
+	}
+
+	// pretend the last read was a while ago
+	before := time.Now().Add(-time.Hour)
+	s.mu.Lock()
+	s.accessed[nd.Cid()] = before
+	s.mu.Unlock()
+	added := accessed()
+
+	if _, err := bs.Get(Untracked(ctx), nd.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if !accessed().Equal(added) {
+		t.Fatal("untracked read was recorded")
+	}
+
+	if _, err := bs.Get(ctx, nd.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if !accessed().After(added) {
+		t.Fatal("read was not recorded")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(dstore)
+	nodes := map[string]*dag.ProtoNode{
+		"old":   dag.NodeWithData([]byte("old")),
+		"idle":  dag.NodeWithData([]byte("idle")),
+		"other": dag.NodeWithData([]byte("other")),
+		"ttl":   dag.NodeWithData([]byte("ttl")),
+	}
+	for class, nd := range nodes {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := pinner.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+		var expires time.Time
+		if class == "ttl" {
+			class, expires = "", time.Now().Add(2*time.Hour)
+		}
+		if err := s.Add(ctx, nd.Cid(), class, expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	policy := NewPolicy(s, pinner, bs, map[string]Class{
+		"old":  {MaxAge: time.Hour},
+		"idle": {MaxIdle: 2 * time.Hour},
+	})
+
+	expired, err := policy.Expired(ctx, time.Now().Add(90*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].Root != nodes["old"].Cid() {
+		t.Fatalf("unexpected expired pins: %v", expired)
+	}
+
+	expired, err = policy.Apply(ctx, time.Now().Add(3*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 3 {
+		t.Fatalf("expected 3 expired pins, got %v", expired)
+	}
+
+	for class, nd := range nodes {
+		_, pinned, err := pinner.IsPinnedWithType(ctx, nd.Cid(), pin.Recursive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, found, err := s.Get(ctx, nd.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// pins of unknown classes never expire
+		if keep := class == "other"; pinned != keep || found != keep {
+			t.Errorf("pin of class %q: pinned %t, expiring %t", class, pinned, found)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	config "github.com/ipfs/go-ipfs/config"
+)
+
+// Class sets when the pins of an expiry class expire. Zero limits never
+// expire.
+type Class struct {
+	MaxAge  time.Duration
+	MaxIdle time.Duration
+}
+
+// Expired is an expired pin.
+type Expired struct {
+	Pin
+	// Reason describes the limit of its class that the pin exceeded.
+	Reason string
+}
+
+// Policy removes the expired pins.
+type Policy struct {
+	store   *Store
+	pinner  pin.Pinner
+	locker  bstore.GCLocker
+	classes map[string]Class
+}
+
+// Classes returns the expiry classes of cfg.
+func Classes(cfg config.PinExpiry) (map[string]Class, error) {
+	classes := make(map[string]Class, len(cfg.Classes))
+	for name, c := range cfg.Classes {
+		class := Class{
+			MaxAge:  c.MaxAge.WithDefault(0),
+			MaxIdle: c.MaxIdle.WithDefault(0),
+		}
+		if class.MaxAge < 0 || class.MaxIdle < 0 {
+			return nil, fmt.Errorf("limits of expiry class %q must not be negative", name)
+		}
+		classes[name] = class
+	}
+	return classes, nil
+}
+
+// NewPolicy returns a policy removing the pins of store from pinner once their
+// TTL has passed or they exceed the limits of their class in classes. Pins
+// without a TTL whose class is unknown never expire.
+func NewPolicy(store *Store, pinner pin.Pinner, locker bstore.GCLocker, classes map[string]Class) *Policy {
+	return &Policy{
+		store:   store,
+		pinner:  pinner,
+		locker:  locker,
+		classes: classes,
+	}
+}
+
+// Expired returns the pins which have expired at now.
+func (p *Policy) Expired(ctx context.Context, now time.Time) ([]Expired, error) {
+	pins, err := p.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Expired
+	for _, pn := range pins {
+		if !pn.Expires.IsZero() && !now.Before(pn.Expires) {
+			expired = append(expired, Expired{pn, fmt.Sprintf("TTL passed at %s", pn.Expires.Format(time.RFC3339))})
+			continue
+		}
+		class, ok := p.classes[pn.Class]
+		if !ok {
+			continue
+		}
+		if class.MaxAge > 0 && now.Sub(pn.Added) > class.MaxAge {
+			expired = append(expired, Expired{pn, fmt.Sprintf("added more than %s ago", class.MaxAge)})
+		} else if class.MaxIdle > 0 && now.Sub(pn.Accessed) > class.MaxIdle {
+			expired = append(expired, Expired{pn, fmt.Sprintf("not read for more than %s", class.MaxIdle)})
+		}
+	}
+	return expired, nil
+}
+
+// Apply removes the pins which have expired at now, and returns them. The
+// expired pins are looked up under the pin lock, which the pins and their
+// expiry are recorded under, so that a pin added again meanwhile without
+// expiry is kept.
+func (p *Policy) Apply(ctx context.Context, now time.Time) ([]Expired, error) {
+	defer p.locker.PinLock(ctx).Unlock(ctx)
+
+	expired, err := p.Expired(ctx, now)
+	if err != nil || len(expired) == 0 {
+		return nil, err
+	}
+
+	for i, e := range expired {
+		if err := p.unpin(ctx, e.Root); err != nil {
+			return expired[:i], fmt.Errorf("unpinning %s: %w", e.Root, err)
+		}
+	}
+	if err := p.pinner.Flush(ctx); err != nil {
+		return expired, err
+	}
+	return expired, nil
+}
+
+func (p *Policy) unpin(ctx context.Context, root cid.Cid) error {
+	// the pin may have been removed already
+	err := p.pinner.Unpin(ctx, root, true)
+	if err != nil && err != pin.ErrNotPinned {
+		return err
+	}
+	_, err = p.store.Remove(ctx, root)
+	return err
+}
+
+// Run applies the policy every interval until ctx is canceled.
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		expired, err := p.Apply(ctx, time.Now())
+		for _, e := range expired {
+			log.Infof("unpinned %s of class %q: %s", e.Root, e.Class, e.Reason)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("applying pin expiry policy: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CheckClass returns an error if class is not an expiry class of cfg.
+func CheckClass(cfg config.PinExpiry, class string) error {
+	if _, ok := cfg.Classes[class]; !ok {
+		return fmt.Errorf("unknown expiry class %q, see Pinning.Expiry.Classes", class)
+	}
+	return nil
+}
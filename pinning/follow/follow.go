@@ -0,0 +1,301 @@
+// Package follow implements pinset followers: read replicas mirroring the
+// recursive pins of another node, exported at an IPNS name or by its RPC API.
+//
+// A follower periodically lists the pinset followed, pins what was added to
+// it and unpins what was removed. Only the pins the follower added are ever
+// removed: the CIDs of the pinset which were already pinned by hand are left
+// alone, and pinning a CID by hand once the follower pinned it hands the pin
+// over, see Release.
+package follow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pinfollow")
+
+// pinsKey is the datastore key under which the pins added by the follower
+// are recorded.
+var pinsKey = ds.NewKey("/local/pins/follow")
+
+func pinKey(c cid.Cid) ds.Key {
+	return pinsKey.ChildString(c.String())
+}
+
+// Release hands the pin of c over to the user, who pinned it by hand: the
+// followers recording it in dstore no longer remove it once it leaves their
+// pinset. It must be called under the pin lock, as the followers unpin under
+// it.
+func Release(ctx context.Context, dstore ds.Datastore, c cid.Cid) error {
+	k := pinKey(c)
+	has, err := dstore.Has(ctx, k)
+	if err != nil || !has {
+		return err
+	}
+	if err := dstore.Delete(ctx, k); err != nil {
+		return err
+	}
+	return dstore.Sync(ctx, k)
+}
+
+// Source lists the pinset followed.
+type Source interface {
+	// Pins returns the CIDs pinned recursively.
+	Pins(ctx context.Context) ([]cid.Cid, error)
+	// String describes the source.
+	String() string
+}
+
+// Result is the outcome of a sync.
+type Result struct {
+	// Added and Removed count the pins added and removed.
+	Added   int
+	Removed int
+	// Failed counts the CIDs of the pinset which could not be pinned.
+	Failed int
+}
+
+// Status is the state of a follower.
+type Status struct {
+	Source string
+	// Mirrored counts the pins held by the follower for the pinset.
+	Mirrored int
+	// Synced is when the last sync ended, and Last its outcome.
+	Synced time.Time
+	Last   Result
+	// Error is the error of the last sync, if any.
+	Error string
+}
+
+// Follower mirrors the pinset of a source.
+type Follower struct {
+	src    Source
+	dstore ds.Datastore
+	pinner pin.Pinner
+	dag    ipld.DAGService
+	locker bstore.GCLocker
+
+	// syncMu serializes the syncs
+	syncMu sync.Mutex
+
+	mu     sync.Mutex
+	status Status
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a follower of the pinset of src, recording its pins in dstore.
+func New(src Source, dstore ds.Datastore, pinner pin.Pinner, dag ipld.DAGService, locker bstore.GCLocker) *Follower {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Follower{
+		src:    src,
+		dstore: dstore,
+		pinner: pinner,
+		dag:    dag,
+		locker: locker,
+		status: Status{Source: src.String()},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Status returns the state of the follower.
+func (f *Follower) Status(ctx context.Context) (Status, error) {
+	mirrored, err := f.Mirrored(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := f.status
+	st.Mirrored = len(mirrored)
+	return st, nil
+}
+
+// Mirrored returns the pins added by the follower.
+func (f *Follower) Mirrored(ctx context.Context) ([]cid.Cid, error) {
+	res, err := f.dstore.Query(ctx, dsq.Query{Prefix: pinsKey.String(), KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var pins []cid.Cid
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		c, err := cid.Decode(ds.RawKey(r.Key).Name())
+		if err != nil {
+			return nil, fmt.Errorf("invalid followed pin %s: %w", r.Key, err)
+		}
+		pins = append(pins, c)
+	}
+	return pins, nil
+}
+
+// Run syncs the pinset every interval, starting now, until the follower is
+// closed.
+func (f *Follower) Run(interval time.Duration) {
+	f.wg.Add(1)
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := f.Sync(f.ctx); err != nil && f.ctx.Err() == nil {
+			log.Errorf("syncing the pinset of %s: %s", f.src, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync mirrors the pinset once. The pins still missing because they failed
+// are retried by the next sync.
+func (f *Follower) Sync(ctx context.Context) (Result, error) {
+	f.syncMu.Lock()
+	defer f.syncMu.Unlock()
+
+	res, err := f.sync(ctx)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status.Synced = time.Now()
+	f.status.Last = res
+	f.status.Error = ""
+	if err != nil {
+		f.status.Error = err.Error()
+	}
+	return res, err
+}
+
+func (f *Follower) sync(ctx context.Context) (Result, error) {
+	var res Result
+
+	pins, err := f.src.Pins(ctx)
+	if err != nil {
+		return res, fmt.Errorf("listing the pinset: %w", err)
+	}
+	want := cid.NewSet()
+	for _, c := range pins {
+		want.Add(c)
+	}
+
+	mirrored, err := f.Mirrored(ctx)
+	if err != nil {
+		return res, err
+	}
+
+	// remove first, making room for the additions
+	for _, c := range mirrored {
+		if want.Has(c) {
+			continue
+		}
+		removed, err := f.unpin(ctx, c)
+		if err != nil {
+			return res, fmt.Errorf("unpinning %s: %w", c, err)
+		}
+		if removed {
+			res.Removed++
+		}
+	}
+
+	var lastErr error
+	err = want.ForEach(func(c cid.Cid) error {
+		added, err := f.pin(ctx, c)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			log.Debugf("pinning %s: %s", c, err)
+			lastErr = fmt.Errorf("pinning %s: %w", c, err)
+			res.Failed++
+		case added:
+			res.Added++
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	if res.Failed > 0 {
+		return res, fmt.Errorf("%d pins failed, last: %w", res.Failed, lastErr)
+	}
+	return res, nil
+}
+
+// pin pins c recursively unless it is already, and reports whether it did.
+func (f *Follower) pin(ctx context.Context, c cid.Cid) (bool, error) {
+	_, pinned, err := f.pinner.IsPinnedWithType(ctx, c, pin.Recursive)
+	if err != nil || pinned {
+		// pinned by the follower already, or by hand
+		return false, err
+	}
+
+	defer f.locker.PinLock(ctx).Unlock(ctx)
+
+	nd, err := f.dag.Get(ctx, c)
+	if err != nil {
+		return false, err
+	}
+	if err := f.pinner.Pin(ctx, nd, true); err != nil {
+		return false, err
+	}
+	if err := f.pinner.Flush(ctx); err != nil {
+		return false, err
+	}
+
+	k := pinKey(c)
+	if err := f.dstore.Put(ctx, k, nil); err != nil {
+		return false, err
+	}
+	return true, f.dstore.Sync(ctx, k)
+}
+
+// unpin removes the pin added by the follower for c unless it was handed
+// over since, and reports whether it did.
+func (f *Follower) unpin(ctx context.Context, c cid.Cid) (bool, error) {
+	defer f.locker.PinLock(ctx).Unlock(ctx)
+
+	k := pinKey(c)
+	if has, err := f.dstore.Has(ctx, k); err != nil || !has {
+		return false, err
+	}
+	// it may have been unpinned by hand
+	if err := f.pinner.Unpin(ctx, c, true); err != nil && err != pin.ErrNotPinned {
+		return false, err
+	}
+	if err := f.pinner.Flush(ctx); err != nil {
+		return false, err
+	}
+
+	if err := f.dstore.Delete(ctx, k); err != nil {
+		return false, err
+	}
+	return true, f.dstore.Sync(ctx, k)
+}
+
+// Close stops the periodic syncs.
+func (f *Follower) Close() error {
+	f.cancel()
+	f.wg.Wait()
+	return nil
+}
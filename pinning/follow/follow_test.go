@@ -0,0 +1,221 @@
+package follow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+type staticSource []cid.Cid
+
+func (s *staticSource) Pins(context.Context) ([]cid.Cid, error) {
+	return *s, nil
+}
+
+func (s *staticSource) String() string {
+	return "static"
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := make(map[string]*dag.ProtoNode)
+	for _, name := range []string{"a", "b", "mine"} {
+		nd := dag.NodeWithData([]byte(name))
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		nodes[name] = nd
+	}
+	// pinned by hand before being followed
+	if err := pinner.Pin(ctx, nodes["mine"], true); err != nil {
+		t.Fatal(err)
+	}
+
+	pinned := func(name string) bool {
+		t.Helper()
+		_, ok, err := pinner.IsPinnedWithType(ctx, nodes[name].Cid(), pin.Recursive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	src := &staticSource{nodes["a"].Cid(), nodes["mine"].Cid()}
+	f := New(src, dstore, pinner, dserv, bs)
+
+	res, err := f.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (Result{Added: 1}) {
+		t.Fatalf("unexpected first sync: %+v", res)
+	}
+	if !pinned("a") || !pinned("mine") || pinned("b") {
+		t.Fatal("pinset not mirrored")
+	}
+
+	*src = staticSource{nodes["b"].Cid()}
+	res, err = f.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (Result{Added: 1, Removed: 1}) {
+		t.Fatalf("unexpected second sync: %+v", res)
+	}
+	// the pin made by hand is kept
+	if pinned("a") || !pinned("b") || !pinned("mine") {
+		t.Fatal("pinset not mirrored")
+	}
+
+	st, err := f.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mirrored != 1 || st.Error != "" || st.Synced.IsZero() {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+
+	// missing objects are retried by the next sync
+	missing := dag.NodeWithData([]byte("missing"))
+	*src = staticSource{nodes["b"].Cid(), missing.Cid()}
+	res, err = f.Sync(ctx)
+	if err == nil || res.Failed != 1 {
+		t.Fatalf("expected a failed pin, got %+v, %v", res, err)
+	}
+	if st, _ := f.Status(ctx); st.Error == "" {
+		t.Fatal("failure not reported")
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd := dag.NodeWithData([]byte("a"))
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &staticSource{nd.Cid()}
+	f := New(src, dstore, pinner, dserv, bs)
+	if res, err := f.Sync(ctx); err != nil || res != (Result{Added: 1}) {
+		t.Fatalf("unexpected first sync: %+v, %v", res, err)
+	}
+
+	// pinned by hand once the follower pinned it
+	if err := pinner.Pin(ctx, nd, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Release(ctx, dstore, nd.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	if st, _ := f.Status(ctx); st.Mirrored != 0 {
+		t.Fatalf("expected the pin handed over, got %d mirrored", st.Mirrored)
+	}
+
+	*src = staticSource{}
+	if res, err := f.Sync(ctx); err != nil || res != (Result{}) {
+		t.Fatalf("unexpected second sync: %+v, %v", res, err)
+	}
+	if _, ok, err := pinner.IsPinnedWithType(ctx, nd.Cid(), pin.Recursive); err != nil || !ok {
+		t.Fatal("expected the pin made by hand kept")
+	}
+
+	// releasing a CID the follower did not pin does nothing
+	if err := Release(ctx, dstore, dag.NodeWithData([]byte("b")).Cid()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinsetEncoding(t *testing.T) {
+	pins := []cid.Cid{
+		dag.NodeWithData([]byte("a")).Cid(),
+		dag.NodeWithData([]byte("b")).Cid(),
+	}
+	var buf bytes.Buffer
+	if err := WritePinset(&buf, pins); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("\n  \n")
+
+	got, err := ReadPinset(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != pins[0] || got[1] != pins[1] {
+		t.Fatalf("unexpected pinset: %v", got)
+	}
+
+	if _, err := ReadPinset(strings.NewReader("notacid\n")); err == nil {
+		t.Fatal("expected an invalid pinset")
+	}
+}
+
+func TestAPISource(t *testing.T) {
+	c := dag.NodeWithData([]byte("a")).Cid()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, `{"Message":"unauthorized"}`, http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/api/v0/pin/ls" || r.URL.Query().Get("type") != "recursive" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "{\"Cid\":%q,\"Type\":\"recursive\"}\n", c)
+	}))
+	defer srv.Close()
+
+	src, err := NewAPISource(srv.URL, "secret", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pins, err := src.Pins(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0] != c {
+		t.Fatalf("unexpected pins: %v", pins)
+	}
+
+	src, err = NewAPISource(srv.URL, "wrong", srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Pins(context.Background()); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Fatalf("expected an authorization error, got %v", err)
+	}
+
+	if _, err := NewAPISource("/ip4/127.0.0.1/tcp/5001", "", nil); err == nil {
+		t.Fatal("expected an invalid endpoint")
+	}
+}
@@ -0,0 +1,179 @@
+package follow
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	namesys "github.com/ipfs/go-namesys"
+	path "github.com/ipfs/go-path"
+	resolver "github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
+)
+
+// ReadPinset reads a pinset exported as a list of CIDs, one per line, as
+// written by WritePinset or 'ipfs pin ls --quiet'. Blank lines are skipped.
+func ReadPinset(r io.Reader) ([]cid.Cid, error) {
+	var pins []cid.Cid
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		txt := strings.TrimSpace(s.Text())
+		if txt == "" {
+			continue
+		}
+		c, err := cid.Decode(txt)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		pins = append(pins, c)
+	}
+	return pins, s.Err()
+}
+
+// WritePinset writes pins as a list of CIDs, one per line.
+func WritePinset(w io.Writer, pins []cid.Cid) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range pins {
+		if _, err := fmt.Fprintln(bw, c); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// nameSource is a pinset exported as a file at an IPNS name.
+type nameSource struct {
+	name     path.Path
+	ns       namesys.NameSystem
+	resolver *resolver.Resolver
+	dag      ipld.DAGService
+}
+
+// NewNameSource returns the source of the pinset exported as a file at the
+// path name, usually an /ipns/ name, as written by WritePinset.
+func NewNameSource(name string, ns namesys.NameSystem, r *resolver.Resolver, dag ipld.DAGService) (Source, error) {
+	p, err := path.ParsePath(name)
+	if err != nil {
+		return nil, err
+	}
+	return &nameSource{name: p, ns: ns, resolver: r, dag: dag}, nil
+}
+
+func (s *nameSource) Pins(ctx context.Context) ([]cid.Cid, error) {
+	p, err := s.ns.Resolve(ctx, s.name.String())
+	if err != nil {
+		return nil, err
+	}
+	c, rest, err := s.resolver.ResolveToLastNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+
+	nd, err := s.dag.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	f, err := unixfile.NewUnixfsFile(ctx, s.dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	file, ok := f.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	return ReadPinset(file)
+}
+
+func (s *nameSource) String() string {
+	return s.name.String()
+}
+
+// apiSource is the pinset of a node, listed with its RPC API.
+type apiSource struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+// NewAPISource returns the source of the pinset of the node whose RPC API is
+// at endpoint, such as http://127.0.0.1:5001, authorized with the bearer token
+// secret if set.
+func NewAPISource(endpoint, secret string, client *http.Client) (Source, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported RPC API URL: %s", endpoint)
+	}
+	return &apiSource{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		secret:   secret,
+		client:   client,
+	}, nil
+}
+
+func (s *apiSource) Pins(ctx context.Context) ([]cid.Cid, error) {
+	u := s.endpoint + "/api/v0/pin/ls?type=recursive&quiet=true&stream=true"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.secret != "" {
+		req.Header.Set("Authorization", "Bearer "+s.secret)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		var e struct{ Message string }
+		if json.Unmarshal(msg, &e) == nil && e.Message != "" {
+			msg = []byte(e.Message)
+		}
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var pins []cid.Cid
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var out struct{ Cid string }
+		if err := dec.Decode(&out); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		c, err := cid.Decode(out.Cid)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, c)
+	}
+	// errors past the headers are reported in the trailer
+	if e := resp.Trailer.Get("X-Stream-Error"); e != "" {
+		return nil, errors.New(e)
+	}
+	return pins, nil
+}
+
+func (s *apiSource) String() string {
+	return s.endpoint
+}
@@ -0,0 +1,215 @@
+// Package lazypin implements lazy pins: pins which only fetch the root of a
+// DAG, its other blocks being fetched on first access, or in the background
+// when filling is requested.
+//
+// The root of a lazy pin is pinned directly by the pinner, and the other
+// blocks of its DAG which are present locally are kept by the garbage
+// collector, as best-effort roots. Once filled, a lazy pin becomes a
+// recursive pin.
+package lazypin
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+
+	"github.com/ipfs/go-ipfs/pinning/pinstore"
+)
+
+var log = logging.Logger("lazypin")
+
+// pinsKey is the datastore key under which the lazy pins are stored.
+var pinsKey = ds.NewKey("/local/pins/lazy")
+
+// Pin is a lazy pin of the DAG of Root.
+type Pin struct {
+	Root cid.Cid
+	// Fill is set if the DAG is to be fetched in the background.
+	Fill bool `json:",omitempty"`
+}
+
+// Store stores the lazy pins of a repo.
+type Store struct {
+	records *pinstore.Store
+}
+
+// New returns the store of the lazy pins kept in d.
+func New(d ds.Datastore) *Store {
+	return &Store{records: pinstore.New(d, pinsKey, "lazy pin")}
+}
+
+// Add records the pin p, replacing any lazy pin of the same root.
+func (s *Store) Add(ctx context.Context, p Pin) error {
+	return s.records.Put(ctx, s.records.Key(p.Root), &p)
+}
+
+// Remove removes the lazy pin of root, and reports whether there was one.
+func (s *Store) Remove(ctx context.Context, root cid.Cid) (bool, error) {
+	return s.records.Delete(ctx, s.records.Key(root))
+}
+
+// Has reports whether root is lazily pinned.
+func (s *Store) Has(ctx context.Context, root cid.Cid) (bool, error) {
+	return s.records.Has(ctx, s.records.Key(root))
+}
+
+// List returns all the lazy pins, sorted by root.
+func (s *Store) List(ctx context.Context) ([]Pin, error) {
+	var pins []Pin
+	err := s.records.List(ctx, s.records.Key(cid.Undef), func(decode func(interface{}) error) error {
+		var p Pin
+		if err := decode(&p); err != nil {
+			return err
+		}
+		pins = append(pins, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].Root.KeyString() < pins[j].Root.KeyString()
+	})
+	return pins, nil
+}
+
+// Roots returns the roots of all the lazy pins.
+func (s *Store) Roots(ctx context.Context) ([]cid.Cid, error) {
+	pins, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]cid.Cid, len(pins))
+	for i, p := range pins {
+		roots[i] = p.Root
+	}
+	return roots, nil
+}
+
+// Filler fetches the DAGs of lazy pins in the background, and turns them
+// into recursive pins once they are complete.
+type Filler struct {
+	store  *Store
+	pinner pin.Pinner
+	dag    ipld.DAGService
+	locker bstore.GCLocker
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	filling map[cid.Cid]context.CancelFunc
+}
+
+// NewFiller returns a Filler fetching DAGs with dag.
+func NewFiller(store *Store, pinner pin.Pinner, dag ipld.DAGService, locker bstore.GCLocker) *Filler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Filler{
+		store:   store,
+		pinner:  pinner,
+		dag:     dag,
+		locker:  locker,
+		ctx:     ctx,
+		cancel:  cancel,
+		filling: make(map[cid.Cid]context.CancelFunc),
+	}
+}
+
+// Resume starts filling the lazy pins which requested it.
+func (f *Filler) Resume(ctx context.Context) error {
+	pins, err := f.store.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range pins {
+		if p.Fill {
+			f.Fill(p.Root)
+		}
+	}
+	return nil
+}
+
+// Fill starts filling the lazy pin of root, unless it is already being
+// filled.
+func (f *Filler) Fill(root cid.Cid) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.filling[root]; ok || f.ctx.Err() != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(f.ctx)
+	f.filling[root] = cancel
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		defer func() {
+			f.mu.Lock()
+			delete(f.filling, root)
+			f.mu.Unlock()
+			cancel()
+		}()
+
+		if err := f.fill(ctx, root); err != nil && ctx.Err() == nil {
+			log.Errorf("filling lazy pin %s: %s", root, err)
+		}
+	}()
+}
+
+// Stop stops filling the lazy pin of root.
+func (f *Filler) Stop(root cid.Cid) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if cancel, ok := f.filling[root]; ok {
+		cancel()
+	}
+}
+
+func (f *Filler) fill(ctx context.Context, root cid.Cid) error {
+	// the fetched blocks are kept by GC as the pin is still lazy
+	if err := dag.FetchGraph(ctx, root, f.dag); err != nil {
+		return err
+	}
+
+	defer f.locker.PinLock(ctx).Unlock(ctx)
+
+	// the pin may have been removed meanwhile
+	has, err := f.store.Has(ctx, root)
+	if err != nil || !has {
+		return err
+	}
+
+	nd, err := f.dag.Get(ctx, root)
+	if err != nil {
+		return err
+	}
+	if err := f.pinner.Pin(ctx, nd, true); err != nil {
+		return err
+	}
+	if err := f.pinner.Flush(ctx); err != nil {
+		return err
+	}
+	if _, err := f.store.Remove(ctx, root); err != nil {
+		return err
+	}
+	log.Infof("lazy pin %s filled, now pinned recursively", root)
+	return nil
+}
+
+// Close stops filling lazy pins.
+func (f *Filler) Close() error {
+	f.cancel()
+	f.wg.Wait()
+	return nil
+}
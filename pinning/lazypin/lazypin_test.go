@@ -0,0 +1,123 @@
+package lazypin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := New(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	a := dag.NodeWithData([]byte("a")).Cid()
+	b := dag.NodeWithData([]byte("b")).Cid()
+	for _, p := range []Pin{{Root: a}, {Root: b}, {Root: a, Fill: true}} {
+		if err := s.Add(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pins, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("expected 2 pins, got %d", len(pins))
+	}
+	for _, p := range pins {
+		if p.Fill != (p.Root == a) {
+			t.Errorf("unexpected fill of %s: %t", p.Root, p.Fill)
+		}
+	}
+
+	removed, err := s.Remove(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !removed {
+		t.Fatalf("expected %s to be removed", a)
+	}
+	if removed, _ := s.Remove(ctx, a); removed {
+		t.Fatalf("expected %s to be removed already", a)
+	}
+	if has, _ := s.Has(ctx, a); has {
+		t.Fatalf("expected %s not to be lazily pinned", a)
+	}
+
+	roots, err := s.Roots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != 1 || roots[0] != b {
+		t.Fatalf("unexpected roots after removal: %v", roots)
+	}
+}
+
+func TestFiller(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewGCBlockstore(bstore.NewBlockstore(dstore), bstore.NewGCLocker())
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	child := dag.NodeWithData([]byte("child"))
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.AddMany(ctx, []ipld.Node{child, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinner.Pin(ctx, root, false); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(dstore)
+	if err := s.Add(ctx, Pin{Root: root.Cid(), Fill: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFiller(s, pinner, dserv, bs)
+	defer f.Close()
+	if err := f.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// the lazy pin is removed once filled
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		has, err := s.Has(ctx, root.Cid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("lazy pin was not filled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, pinned, _ := pinner.IsPinnedWithType(ctx, root.Cid(), pin.Recursive); !pinned {
+		t.Error("expected the filled lazy pin to be pinned recursively")
+	}
+	if _, pinned, _ := pinner.IsPinnedWithType(ctx, root.Cid(), pin.Direct); pinned {
+		t.Error("expected the direct pin to be replaced")
+	}
+}
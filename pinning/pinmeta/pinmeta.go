@@ -0,0 +1,134 @@
+// Package pinmeta implements the metadata of pins: a name and key/value
+// labels given when pinning, by which the pins can then be listed.
+//
+// The metadata is recorded in the repo datastore, apart from the pins
+// themselves, and is removed along with them.
+package pinmeta
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+
+	"github.com/ipfs/go-ipfs/pinning/pinstore"
+)
+
+// metaKey is the datastore key under which the metadata of the pins is stored.
+var metaKey = ds.NewKey("/local/pins/meta")
+
+// Meta is the metadata of the pin of Root.
+type Meta struct {
+	Root   cid.Cid
+	Name   string            `json:",omitempty"`
+	Labels map[string]string `json:",omitempty"`
+}
+
+// IsEmpty reports whether m has neither a name nor labels.
+func (m Meta) IsEmpty() bool {
+	return m.Name == "" && len(m.Labels) == 0
+}
+
+// Filter selects pins by their metadata.
+type Filter struct {
+	// Name, if set, is the name of the pins selected.
+	Name string
+	// Labels are the labels the pins selected all have, with these values.
+	Labels map[string]string
+}
+
+// IsEmpty reports whether f selects all pins.
+func (f Filter) IsEmpty() bool {
+	return f.Name == "" && len(f.Labels) == 0
+}
+
+// Matches reports whether the pin of m is selected by f.
+func (f Filter) Matches(m Meta) bool {
+	if f.Name != "" && m.Name != f.Name {
+		return false
+	}
+	for k, v := range f.Labels {
+		if l, ok := m.Labels[k]; !ok || l != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels parses labels given as "key=value". Labels given again
+// replace the previous value of their key.
+func ParseLabels(labels []string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	parsed := make(map[string]string, len(labels))
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, must be key=value", l)
+		}
+		parsed[kv[0]] = kv[1]
+	}
+	return parsed, nil
+}
+
+// Store stores the metadata of the pins of a repo.
+type Store struct {
+	records *pinstore.Store
+}
+
+// New returns the store of the metadata of the pins kept in d.
+func New(d ds.Datastore) *Store {
+	return &Store{records: pinstore.New(d, metaKey, "pin metadata")}
+}
+
+// Set records m as the metadata of the pin of its root, replacing the previous
+// one. An empty m removes it.
+func (s *Store) Set(ctx context.Context, m Meta) error {
+	if m.IsEmpty() {
+		_, err := s.Remove(ctx, m.Root)
+		return err
+	}
+	return s.records.Put(ctx, s.records.Key(m.Root), &m)
+}
+
+// Remove removes the metadata of the pin of root, and reports whether it had
+// any.
+func (s *Store) Remove(ctx context.Context, root cid.Cid) (bool, error) {
+	return s.records.Delete(ctx, s.records.Key(root))
+}
+
+// Get returns the metadata of the pin of root, if any.
+func (s *Store) Get(ctx context.Context, root cid.Cid) (Meta, bool, error) {
+	var m Meta
+	found, err := s.records.Get(ctx, s.records.Key(root), &m)
+	if err != nil || !found {
+		return Meta{}, false, err
+	}
+	return m, true, nil
+}
+
+// List returns the metadata of the pins selected by f, sorted by root.
+func (s *Store) List(ctx context.Context, f Filter) ([]Meta, error) {
+	var metas []Meta
+	err := s.records.List(ctx, s.records.Key(cid.Undef), func(decode func(interface{}) error) error {
+		var m Meta
+		if err := decode(&m); err != nil {
+			return err
+		}
+		if f.Matches(m) {
+			metas = append(metas, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].Root.KeyString() < metas[j].Root.KeyString()
+	})
+	return metas, nil
+}
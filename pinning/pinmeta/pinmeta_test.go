@@ -0,0 +1,86 @@
+package pinmeta
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := New(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	a := dag.NodeWithData([]byte("a")).Cid()
+	b := dag.NodeWithData([]byte("b")).Cid()
+	c := dag.NodeWithData([]byte("c")).Cid()
+	for _, m := range []Meta{
+		{Root: a, Name: "backup", Labels: map[string]string{"team": "infra"}},
+		{Root: b, Labels: map[string]string{"team": "infra", "env": "prod"}},
+		{Root: c, Name: "other", Labels: map[string]string{"team": "web"}},
+	} {
+		if err := s.Set(ctx, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		filter   Filter
+		expected int
+	}{
+		{Filter{}, 3},
+		{Filter{Labels: map[string]string{"team": "infra"}}, 2},
+		{Filter{Labels: map[string]string{"team": "infra", "env": "prod"}}, 1},
+		{Filter{Labels: map[string]string{"env": ""}}, 0},
+		{Filter{Name: "backup"}, 1},
+		{Filter{Name: "backup", Labels: map[string]string{"team": "web"}}, 0},
+	} {
+		metas, err := s.List(ctx, tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(metas) != tc.expected {
+			t.Errorf("%+v: expected %d pins, got %d", tc.filter, tc.expected, len(metas))
+		}
+	}
+
+	m, found, err := s.Get(ctx, a)
+	if err != nil || !found {
+		t.Fatalf("expected the metadata of %s, got %v", a, err)
+	}
+	if m.Name != "backup" || m.Labels["team"] != "infra" {
+		t.Fatalf("unexpected metadata %+v", m)
+	}
+
+	// setting no metadata removes it
+	if err := s.Set(ctx, Meta{Root: a}); err != nil {
+		t.Fatal(err)
+	}
+	if _, found, _ := s.Get(ctx, a); found {
+		t.Fatalf("expected the metadata of %s to be removed", a)
+	}
+	removed, err := s.Remove(ctx, b)
+	if err != nil || !removed {
+		t.Fatalf("expected the metadata of %s to be removed, got %v", b, err)
+	}
+	if removed, _ := s.Remove(ctx, b); removed {
+		t.Fatalf("expected the metadata of %s to be removed already", b)
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"team=infra", "note=a=b", "empty=", "team=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(labels) != 3 || labels["team"] != "web" || labels["note"] != "a=b" || labels["empty"] != "" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+	for _, l := range []string{"team", "=infra"} {
+		if _, err := ParseLabels([]string{l}); err == nil {
+			t.Errorf("expected %q to be invalid", l)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package pinsize tells how many bytes each recursive pin takes, and how many
+// of them only it takes, which GC would free if it were removed.
+//
+// The blocks of each pin are indexed once, when the index is first synced
+// after the pin is added, and kept in the repo datastore, so that syncing
+// only walks the DAGs of the pins added since the last sync.
+package pinsize
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+var log = logging.Logger("pinsize")
+
+// pinsKey is the datastore key under which the blocks of the pins are stored.
+var pinsKey = ds.NewKey("/local/pins/size")
+
+var errInvalidEntry = errors.New("invalid pin size entry")
+
+// Size is the storage taken by a pin.
+type Size struct {
+	// Total is the size of the distinct blocks of the DAG of the pin.
+	Total uint64
+	// Unique is the size of those of its blocks which no other indexed pin
+	// has.
+	Unique uint64
+	// Blocks is the number of distinct blocks of the DAG of the pin.
+	Blocks int
+}
+
+// block is a block of a pin.
+type block struct {
+	key  string // the multihash of the block
+	size uint64
+}
+
+// Index indexes the blocks of the recursive pins.
+type Index struct {
+	ds       ds.Datastore
+	dag      ipld.DAGService
+	loadOnce sync.Once
+
+	mu      sync.Mutex
+	loadErr error
+	pins    map[cid.Cid][]block
+	// refs is the number of pins of each block
+	refs map[string]int
+}
+
+// New returns the index of the pins kept in d, walking their DAGs in dserv.
+func New(d ds.Datastore, dserv ipld.DAGService) *Index {
+	return &Index{ds: d, dag: dserv}
+}
+
+func pinKey(root cid.Cid) ds.Key {
+	return pinsKey.ChildString(root.String())
+}
+
+// load reads the indexed pins. It must be called with mu held.
+func (x *Index) load(ctx context.Context) error {
+	x.loadOnce.Do(func() {
+		x.pins = make(map[cid.Cid][]block)
+		x.refs = make(map[string]int)
+
+		res, err := x.ds.Query(ctx, dsq.Query{Prefix: pinsKey.String()})
+		if err != nil {
+			x.loadErr = err
+			return
+		}
+		defer res.Close()
+
+		for r := range res.Next() {
+			if r.Error != nil {
+				x.loadErr = r.Error
+				return
+			}
+			root, err := cid.Decode(ds.RawKey(r.Key).BaseNamespace())
+			if err != nil {
+				log.Warnf("dropping pin size entry %s: %s", r.Key, err)
+				continue
+			}
+			blocks, err := decodeBlocks(r.Value)
+			if err != nil {
+				log.Warnf("dropping pin size entry %s: %s", r.Key, err)
+				continue
+			}
+			x.add(root, blocks)
+		}
+	})
+	return x.loadErr
+}
+
+func (x *Index) add(root cid.Cid, blocks []block) {
+	x.pins[root] = blocks
+	for _, b := range blocks {
+		x.refs[b.key]++
+	}
+}
+
+func (x *Index) remove(root cid.Cid) {
+	for _, b := range x.pins[root] {
+		if x.refs[b.key]--; x.refs[b.key] == 0 {
+			delete(x.refs, b.key)
+		}
+	}
+	delete(x.pins, root)
+}
+
+// Sync makes the indexed pins those of roots, indexing the blocks of the new
+// ones and dropping those no longer pinned.
+func (x *Index) Sync(ctx context.Context, roots []cid.Cid) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if err := x.load(ctx); err != nil {
+		return err
+	}
+
+	pinned := cid.NewSet()
+	for _, root := range roots {
+		pinned.Add(root)
+	}
+	for root := range x.pins {
+		if pinned.Has(root) {
+			continue
+		}
+		if err := x.ds.Delete(ctx, pinKey(root)); err != nil {
+			return err
+		}
+		x.remove(root)
+	}
+
+	for _, root := range roots {
+		if _, ok := x.pins[root]; ok {
+			continue
+		}
+		blocks, err := x.walk(ctx, root)
+		if err != nil {
+			return fmt.Errorf("indexing the blocks of %s: %w", root, err)
+		}
+		if err := x.ds.Put(ctx, pinKey(root), encodeBlocks(blocks)); err != nil {
+			return err
+		}
+		x.add(root, blocks)
+	}
+	return x.ds.Sync(ctx, pinsKey)
+}
+
+// walk returns the distinct blocks of the DAG of root.
+func (x *Index) walk(ctx context.Context, root cid.Cid) ([]block, error) {
+	var blocks []block
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipld.Link, error) {
+		nd, err := x.dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block{key: string(c.Hash()), size: uint64(len(nd.RawData()))})
+		return nd.Links(), nil
+	}
+	// blocks of the same multihash but different codecs are the same
+	// block in the blockstore
+	seen := make(map[string]struct{})
+	visit := func(c cid.Cid) bool {
+		if _, ok := seen[string(c.Hash())]; ok {
+			return false
+		}
+		seen[string(c.Hash())] = struct{}{}
+		return true
+	}
+	if err := dag.Walk(ctx, getLinks, root, visit); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// Size returns the size of the pin of root, or false if root is not indexed.
+func (x *Index) Size(root cid.Cid) (Size, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	blocks, ok := x.pins[root]
+	if !ok {
+		return Size{}, false
+	}
+	s := Size{Blocks: len(blocks)}
+	for _, b := range blocks {
+		s.Total += b.size
+		if x.refs[b.key] == 1 {
+			s.Unique += b.size
+		}
+	}
+	return s, true
+}
+
+// encodeBlocks encodes blocks as a sequence of the varint length of the
+// multihash of a block, the multihash and the varint size of the block.
+func encodeBlocks(blocks []block) []byte {
+	var buf []byte
+	tmp := make([]byte, binary.MaxVarintLen64)
+	for _, b := range blocks {
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, uint64(len(b.key)))]...)
+		buf = append(buf, b.key...)
+		buf = append(buf, tmp[:binary.PutUvarint(tmp, b.size)]...)
+	}
+	return buf
+}
+
+func decodeBlocks(buf []byte) ([]block, error) {
+	var blocks []block
+	for len(buf) > 0 {
+		l, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf)-n) < l {
+			return nil, errInvalidEntry
+		}
+		buf = buf[n:]
+		key := string(buf[:l])
+		buf = buf[l:]
+		size, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errInvalidEntry
+		}
+		buf = buf[n:]
+		blocks = append(blocks, block{key: key, size: size})
+	}
+	return blocks, nil
+}
@@ -0,0 +1,86 @@
+package pinsize
+
+import (
+	"context"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	dserv := mdtest.Mock()
+
+	shared := dag.NodeWithData([]byte("shared"))
+	onlyA := dag.NodeWithData([]byte("only a"))
+	a := dag.NodeWithData([]byte("a"))
+	b := dag.NodeWithData([]byte("b"))
+	for _, link := range []struct{ from, to *dag.ProtoNode }{{a, shared}, {a, onlyA}, {b, shared}} {
+		if err := link.from.AddNodeLink("", link.to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, nd := range []*dag.ProtoNode{shared, onlyA, a, b} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := func(nds ...*dag.ProtoNode) uint64 {
+		var s uint64
+		for _, nd := range nds {
+			s += uint64(len(nd.RawData()))
+		}
+		return s
+	}
+	check := func(x *Index, root *dag.ProtoNode, expected Size) {
+		t.Helper()
+		s, ok := x.Size(root.Cid())
+		if !ok || s != expected {
+			t.Fatalf("expected the size of %s to be %+v, got %+v", root.Cid(), expected, s)
+		}
+	}
+
+	x := New(dstore, dserv)
+	if err := x.Sync(ctx, []cid.Cid{a.Cid(), b.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	check(x, a, Size{Total: size(a, shared, onlyA), Unique: size(a, onlyA), Blocks: 3})
+	check(x, b, Size{Total: size(b, shared), Unique: size(b), Blocks: 2})
+
+	// the index is kept in the datastore, and the DAGs not walked again
+	for _, nd := range []*dag.ProtoNode{shared, onlyA, a, b} {
+		if err := dserv.Remove(ctx, nd.Cid()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	x = New(dstore, dserv)
+	if err := x.Sync(ctx, []cid.Cid{b.Cid()}); err != nil {
+		t.Fatal(err)
+	}
+	check(x, b, Size{Total: size(b, shared), Unique: size(b, shared), Blocks: 2})
+	if _, ok := x.Size(a.Cid()); ok {
+		t.Fatal("expected the removed pin to be dropped")
+	}
+	if err := x.Sync(ctx, []cid.Cid{a.Cid()}); err == nil {
+		t.Fatal("expected indexing a pin with missing blocks to fail")
+	}
+}
+
+func TestEncodeBlocks(t *testing.T) {
+	blocks := []block{{key: "abc", size: 1}, {key: string(make([]byte, 300)), size: 1 << 40}}
+	decoded, err := decodeBlocks(encodeBlocks(blocks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(blocks) || decoded[0] != blocks[0] || decoded[1] != blocks[1] {
+		t.Fatalf("unexpected blocks %v", decoded)
+	}
+	if _, err := decodeBlocks([]byte{5, 'a'}); err == nil {
+		t.Fatal("expected a truncated entry to fail")
+	}
+}
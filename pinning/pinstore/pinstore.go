@@ -0,0 +1,137 @@
+// Package pinstore stores records about pins in the repo datastore, apart from
+// the pins themselves: one JSON record per pin under a datastore key, keyed by
+// the root of the pin, and by more names when a root has several records.
+//
+// It backs the stores of the selector pins, the lazy pins, the expiring pins
+// and the metadata of the pins.
+package pinstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+)
+
+// Store stores the records of pins under a datastore key.
+type Store struct {
+	ds     ds.Datastore
+	prefix ds.Key
+	// kind is what the records are, for the errors
+	kind string
+}
+
+// New returns the store of the records kept in d under prefix. kind says
+// what the records are in the errors, e.g. "lazy pin".
+func New(d ds.Datastore, prefix ds.Key, kind string) *Store {
+	return &Store{ds: d, prefix: prefix, kind: kind}
+}
+
+// Key returns the key of the record of root, under the names given. The key
+// of cid.Undef is the one of all the records.
+func (s *Store) Key(root cid.Cid, names ...string) ds.Key {
+	if !root.Defined() {
+		return s.prefix
+	}
+	k := s.prefix.ChildString(root.String())
+	for _, n := range names {
+		k = k.ChildString(n)
+	}
+	return k
+}
+
+// Put records v, encoded as JSON, at k, replacing the previous record.
+func (s *Store) Put(ctx context.Context, k ds.Key, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := s.ds.Put(ctx, k, b); err != nil {
+		return err
+	}
+	return s.ds.Sync(ctx, k)
+}
+
+// Get decodes the record at k into v, and reports whether there is one.
+func (s *Store) Get(ctx context.Context, k ds.Key, v interface{}) (bool, error) {
+	b, err := s.ds.Get(ctx, k)
+	if err == ds.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("invalid %s %s: %w", s.kind, k, err)
+	}
+	return true, nil
+}
+
+// Has reports whether there is a record at k.
+func (s *Store) Has(ctx context.Context, k ds.Key) (bool, error) {
+	return s.ds.Has(ctx, k)
+}
+
+// Delete removes the record at k, and reports whether there was one.
+func (s *Store) Delete(ctx context.Context, k ds.Key) (bool, error) {
+	has, err := s.ds.Has(ctx, k)
+	if err != nil || !has {
+		return false, err
+	}
+	if err := s.ds.Delete(ctx, k); err != nil {
+		return false, err
+	}
+	return true, s.ds.Sync(ctx, k)
+}
+
+// DeleteAll removes the records under k, and returns how many were removed.
+func (s *Store) DeleteAll(ctx context.Context, k ds.Key) (int, error) {
+	res, err := s.ds.Query(ctx, dsq.Query{Prefix: k.String(), KeysOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if err := s.ds.Delete(ctx, ds.RawKey(e.Key)); err != nil {
+			return 0, err
+		}
+	}
+	if len(entries) > 0 {
+		if err := s.ds.Sync(ctx, k); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// List calls add with each record under k, in no particular order. add is
+// given the function decoding the record into its argument.
+func (s *Store) List(ctx context.Context, k ds.Key, add func(decode func(v interface{}) error) error) error {
+	res, err := s.ds.Query(ctx, dsq.Query{Prefix: k.String()})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		err := add(func(v interface{}) error {
+			if err := json.Unmarshal(r.Value, v); err != nil {
+				return fmt.Errorf("invalid %s %s: %w", s.kind, r.Key, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
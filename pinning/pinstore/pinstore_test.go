@@ -0,0 +1,83 @@
+package pinstore
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+type record struct {
+	Root cid.Cid
+	Name string
+}
+
+func list(t *testing.T, s *Store, k ds.Key) []string {
+	t.Helper()
+	var names []string
+	err := s.List(context.Background(), k, func(decode func(interface{}) error) error {
+		var r record
+		if err := decode(&r); err != nil {
+			return err
+		}
+		names = append(names, r.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	s := New(d, ds.NewKey("/local/pins/test"), "test record")
+
+	a := dag.NodeWithData([]byte("a")).Cid()
+	b := dag.NodeWithData([]byte("b")).Cid()
+	for _, r := range []record{{a, "x"}, {a, "y"}, {b, "z"}} {
+		if err := s.Put(ctx, s.Key(r.Root, r.Name), &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var r record
+	if found, err := s.Get(ctx, s.Key(a, "y"), &r); err != nil || !found || r.Name != "y" {
+		t.Fatalf("got %v, found %t, err %v, expected the record y", r, found, err)
+	}
+	if found, err := s.Get(ctx, s.Key(b, "y"), &r); err != nil || found {
+		t.Fatalf("expected no record, got found %t, err %v", found, err)
+	}
+	if got := list(t, s, s.Key(cid.Undef)); len(got) != 3 {
+		t.Fatalf("expected 3 records, got %v", got)
+	}
+	if got := list(t, s, s.Key(a)); len(got) != 2 || got[0] != "x" || got[1] != "y" {
+		t.Fatalf("expected the records x and y of a, got %v", got)
+	}
+
+	if deleted, err := s.Delete(ctx, s.Key(b, "z")); err != nil || !deleted {
+		t.Fatalf("expected the record z deleted, got %t, err %v", deleted, err)
+	}
+	if deleted, err := s.Delete(ctx, s.Key(b, "z")); err != nil || deleted {
+		t.Fatalf("expected the record z deleted already, got %t, err %v", deleted, err)
+	}
+	if n, err := s.DeleteAll(ctx, s.Key(a)); err != nil || n != 2 {
+		t.Fatalf("expected the 2 records of a deleted, got %d, err %v", n, err)
+	}
+	if got := list(t, s, s.Key(cid.Undef)); len(got) != 0 {
+		t.Fatalf("expected no record left, got %v", got)
+	}
+
+	if err := d.Put(ctx, s.Key(a), []byte("nope")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, s.Key(a), &r); err == nil {
+		t.Fatal("expected an invalid record to fail")
+	}
+}
@@ -0,0 +1,609 @@
+// Package remotesync mirrors the recursive pins of the node to remote pinning
+// services.
+//
+// Every interval, the pins of the node, or those with a given label, are
+// compared to the remote pins of the service with the name of the mirror:
+// the pins missing are added and the pins no longer held by the node are
+// removed. The pins which fail, either when requested or on the service, are
+// retried with an exponential backoff. The state of every pin mirrored is
+// kept, and its changes are sent to the subscribers as events.
+package remotesync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	logging "github.com/ipfs/go-log"
+	pinclient "github.com/ipfs/go-pinning-service-http-client"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+)
+
+var log = logging.Logger("remotepinning/sync")
+
+const (
+	// minBackoff is the wait before retrying a pin which failed once
+	minBackoff = 30 * time.Second
+	// maxRequests is the number of requests sent to a service at once
+	maxRequests = 8
+	// lsLimit is the number of remote pins listed by request, the most
+	// allowed by the pinning service API
+	lsLimit = 1000
+	// eventsBuffer is the number of events buffered for a subscriber, the
+	// events beyond are dropped
+	eventsBuffer = 1024
+)
+
+// errRemoteFailed is the error of the pins which failed on the service.
+var errRemoteFailed = errors.New("pinning failed on the service")
+
+// State is the state of a pin mirrored to a service.
+type State string
+
+// The states of the pins mirrored. Queued, Pinning and Pinned are those
+// reported by the service.
+const (
+	Queued  State = "queued"
+	Pinning State = "pinning"
+	Pinned  State = "pinned"
+	// Failed pins are retried once their backoff has passed.
+	Failed State = "failed"
+	// Removed pins are no longer held by the node, and were removed from
+	// the service.
+	Removed State = "removed"
+)
+
+func stateOf(s pinclient.Status) State {
+	switch s {
+	case pinclient.StatusQueued:
+		return Queued
+	case pinclient.StatusPinning:
+		return Pinning
+	case pinclient.StatusPinned:
+		return Pinned
+	}
+	return Failed
+}
+
+// Client is the client of a remote pinning service, such as a
+// *pinclient.Client.
+type Client interface {
+	Ls(ctx context.Context, opts ...pinclient.LsOption) (chan pinclient.PinStatusGetter, chan error)
+	Add(ctx context.Context, c cid.Cid, opts ...pinclient.AddOption) (pinclient.PinStatusGetter, error)
+	DeleteByID(ctx context.Context, requestID string) error
+}
+
+// Service is a remote pinning service the pins are mirrored to.
+type Service struct {
+	Name   string
+	Client Client
+	// PinName is the name of the remote pins of the mirror.
+	PinName string
+	// Filter selects the pins mirrored, all the recursive pins if empty.
+	Filter pinmeta.Filter
+	// Origins are the addresses of the node, given to the service to fetch
+	// the pins from.
+	Origins []multiaddr.Multiaddr
+	// Interval is how often the pins are mirrored, and MaxBackoff the
+	// longest wait before retrying a pin which failed.
+	Interval   time.Duration
+	MaxBackoff time.Duration
+}
+
+// Item is a pin mirrored to a service.
+type Item struct {
+	Service string
+	Cid     cid.Cid
+	State   State
+	// RequestID is the ID of the remote pin, if it was added.
+	RequestID string
+	// Attempts counts the failures in a row, and Retry is when the pin is
+	// retried after the last one.
+	Attempts int
+	Retry    time.Time
+	Error    string
+	Updated  time.Time
+}
+
+// Event is a change of the state of a pin mirrored.
+type Event struct {
+	Item
+	// Dropped counts the events dropped before this one, the subscriber
+	// being too slow.
+	Dropped int
+}
+
+// ServiceStatus is the state of the mirroring to a service.
+type ServiceStatus struct {
+	Name string
+	// Synced is when the last sync ended, and Error its error, if any.
+	Synced time.Time
+	Error  string
+	// Count counts the pins mirrored by state.
+	Count map[State]int
+}
+
+type subscriber struct {
+	ch      chan Event
+	dropped int
+}
+
+// Syncer mirrors the pins of the node to the services.
+type Syncer struct {
+	services func() ([]Service, error)
+	pinner   pin.Pinner
+	meta     *pinmeta.Store
+
+	// syncMu serializes the syncs
+	syncMu sync.Mutex
+
+	mu          sync.Mutex
+	items       map[string]map[cid.Cid]*Item
+	status      map[string]*ServiceStatus
+	subscribers map[*subscriber]struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a syncer mirroring the pins of pinner, with the metadata of
+// meta, to the services returned by services, which is called for every sync
+// to follow the changes of the config.
+func New(services func() ([]Service, error), pinner pin.Pinner, meta *pinmeta.Store) *Syncer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Syncer{
+		services:    services,
+		pinner:      pinner,
+		meta:        meta,
+		items:       make(map[string]map[cid.Cid]*Item),
+		status:      make(map[string]*ServiceStatus),
+		subscribers: make(map[*subscriber]struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Run syncs the services whose interval has passed or which have pins to
+// retry, checking every pollInterval, until the syncer is closed.
+func (s *Syncer) Run(pollInterval time.Duration) {
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.sync(s.ctx, false); err != nil && s.ctx.Err() == nil {
+			log.Errorf("mirroring the pins: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// Sync mirrors the pins to all the services now, retrying the pins which
+// failed whether their backoff has passed or not.
+func (s *Syncer) Sync(ctx context.Context) error {
+	return s.sync(ctx, true)
+}
+
+func (s *Syncer) sync(ctx context.Context, force bool) error {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	services, err := s.services()
+	if err != nil {
+		return err
+	}
+	s.forget(services)
+
+	now := time.Now()
+	var due []Service
+	for _, svc := range services {
+		if force || s.due(svc, now) {
+			due = append(due, svc)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	recursive, err := s.pinner.RecursiveKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("listing the pins: %w", err)
+	}
+	for _, svc := range due {
+		pins, err := s.selectPins(ctx, svc.Filter, recursive)
+		if err == nil {
+			err = s.syncService(ctx, svc, pins, force)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.synced(svc.Name, err)
+		if err != nil {
+			log.Errorf("mirroring the pins to %q: %s", svc.Name, err)
+		}
+	}
+	return nil
+}
+
+// forget drops the state of the services no longer configured.
+func (s *Syncer) forget(services []Service) {
+	names := make(map[string]bool, len(services))
+	for _, svc := range services {
+		names[svc.Name] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range s.status {
+		if !names[name] {
+			delete(s.status, name)
+			delete(s.items, name)
+		}
+	}
+}
+
+// due reports whether svc is to be synced at now.
+func (s *Syncer) due(svc Service, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.status[svc.Name]
+	if !ok || now.Sub(st.Synced) >= svc.Interval {
+		return true
+	}
+	for _, it := range s.items[svc.Name] {
+		if it.State == Failed && !now.Before(it.Retry) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectPins returns the pins of recursive selected by f.
+func (s *Syncer) selectPins(ctx context.Context, f pinmeta.Filter, recursive []cid.Cid) (*cid.Set, error) {
+	pins := cid.NewSet()
+	if f.IsEmpty() {
+		for _, c := range recursive {
+			pins.Add(c)
+		}
+		return pins, nil
+	}
+
+	metas, err := s.meta.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	labeled := cid.NewSet()
+	for _, m := range metas {
+		labeled.Add(m.Root)
+	}
+	for _, c := range recursive {
+		if labeled.Has(c) {
+			pins.Add(c)
+		}
+	}
+	return pins, nil
+}
+
+// syncService mirrors pins to svc.
+func (s *Syncer) syncService(ctx context.Context, svc Service, pins *cid.Set, force bool) error {
+	remote, err := listRemote(ctx, svc)
+	if err != nil {
+		return fmt.Errorf("listing the remote pins: %w", err)
+	}
+
+	type request struct {
+		c cid.Cid
+		// failed is the ID of the remote pin which failed, replaced
+		failed string
+	}
+	var requests []request
+	now := time.Now()
+	for c, ps := range remote {
+		if pins.Has(c) {
+			continue
+		}
+		if err := svc.Client.DeleteByID(ctx, ps.GetRequestId()); err != nil {
+			return fmt.Errorf("removing the remote pin of %s: %w", c, err)
+		}
+		s.update(svc.Name, c, func(it *Item) {
+			it.State = Removed
+			it.RequestID = ""
+			it.Error = ""
+		})
+	}
+	err = pins.ForEach(func(c cid.Cid) error {
+		ps, ok := remote[c]
+		it := s.item(svc.Name, c)
+		switch {
+		case ok && ps.GetStatus() != pinclient.StatusFailed:
+			s.update(svc.Name, c, func(it *Item) {
+				it.State = stateOf(ps.GetStatus())
+				it.RequestID = ps.GetRequestId()
+				it.Error = ""
+				if it.State == Pinned {
+					it.Attempts = 0
+				}
+			})
+			return nil
+		case ok && (it.State != Failed || it.RequestID != ps.GetRequestId()):
+			// seen failing for the first time, retried after a backoff
+			s.fail(svc, c, ps.GetRequestId(), errRemoteFailed, now)
+			return nil
+		case it.State == Failed && now.Before(it.Retry) && !force:
+			return nil
+		}
+		r := request{c: c}
+		if ok {
+			r.failed = ps.GetRequestId()
+		}
+		requests = append(requests, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// the pins which are neither held nor remote are forgotten
+	s.mu.Lock()
+	for c, it := range s.items[svc.Name] {
+		if _, ok := remote[c]; !pins.Has(c) && (!ok || it.State == Removed) {
+			delete(s.items[svc.Name], c)
+		}
+	}
+	s.mu.Unlock()
+
+	sem := make(chan struct{}, maxRequests)
+	var wg sync.WaitGroup
+	for _, r := range requests {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func(r request) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			s.add(ctx, svc, r.c, r.failed)
+		}(r)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// add requests the remote pin of c, replacing the remote pin failed if set.
+func (s *Syncer) add(ctx context.Context, svc Service, c cid.Cid, failed string) {
+	if failed != "" {
+		if err := svc.Client.DeleteByID(ctx, failed); err != nil {
+			s.fail(svc, c, failed, fmt.Errorf("removing the remote pin failed: %w", err), time.Now())
+			return
+		}
+	}
+
+	opts := []pinclient.AddOption{pinclient.PinOpts.WithName(svc.PinName)}
+	if len(svc.Origins) > 0 {
+		opts = append(opts, pinclient.PinOpts.WithOrigins(svc.Origins...))
+	}
+	ps, err := svc.Client.Add(ctx, c, opts...)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.fail(svc, c, "", err, time.Now())
+		}
+		return
+	}
+	if ps.GetStatus() == pinclient.StatusFailed {
+		s.fail(svc, c, ps.GetRequestId(), errRemoteFailed, time.Now())
+		return
+	}
+	s.update(svc.Name, c, func(it *Item) {
+		it.State = stateOf(ps.GetStatus())
+		it.RequestID = ps.GetRequestId()
+		it.Error = ""
+	})
+}
+
+// fail records the failure of the pin of c, retried after a backoff.
+func (s *Syncer) fail(svc Service, c cid.Cid, requestID string, err error, now time.Time) {
+	log.Debugf("pinning %s to %q: %s", c, svc.Name, err)
+	s.update(svc.Name, c, func(it *Item) {
+		it.State = Failed
+		it.RequestID = requestID
+		it.Attempts++
+		it.Retry = now.Add(backoff(it.Attempts, svc.MaxBackoff))
+		it.Error = err.Error()
+	})
+}
+
+// backoff returns the wait before retrying a pin which failed attempts times
+// in a row.
+func backoff(attempts int, max time.Duration) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// listRemote returns the remote pins of the mirror, by CID.
+func listRemote(ctx context.Context, svc Service) (map[cid.Cid]pinclient.PinStatusGetter, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	statuses := []pinclient.Status{pinclient.StatusQueued, pinclient.StatusPinning, pinclient.StatusPinned, pinclient.StatusFailed}
+	psCh, errCh := svc.Client.Ls(ctx, pinclient.PinOpts.FilterName(svc.PinName), pinclient.PinOpts.FilterStatus(statuses...), pinclient.PinOpts.Limit(lsLimit))
+	remote := make(map[cid.Cid]pinclient.PinStatusGetter)
+	for ps := range psCh {
+		c := ps.GetPin().GetCid()
+		// the pins are listed from the newest, which is kept
+		if _, ok := remote[c]; !ok {
+			remote[c] = ps
+		}
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return remote, nil
+}
+
+// item returns a copy of the state of the pin of c on service, whose State
+// is empty if it is unknown.
+func (s *Syncer) item(service string, c cid.Cid) Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if it, ok := s.items[service][c]; ok {
+		return *it
+	}
+	return Item{Service: service, Cid: c}
+}
+
+// update changes the state of the pin of c on service with change, and sends
+// the change to the subscribers.
+func (s *Syncer) update(service string, c cid.Cid, change func(*Item)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items, ok := s.items[service]
+	if !ok {
+		items = make(map[cid.Cid]*Item)
+		s.items[service] = items
+	}
+	it, ok := items[c]
+	if !ok {
+		it = &Item{Service: service, Cid: c}
+		items[c] = it
+	}
+	prev := *it
+	change(it)
+	if *it == prev {
+		return
+	}
+	it.Updated = time.Now()
+
+	for sub := range s.subscribers {
+		select {
+		case sub.ch <- Event{Item: *it, Dropped: sub.dropped}:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// synced records the end of a sync of service.
+func (s *Syncer) synced(service string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.status[service]
+	if !ok {
+		st = &ServiceStatus{Name: service}
+		s.status[service] = st
+	}
+	st.Synced = time.Now()
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
+
+// Status returns the state of the mirroring to the services synced, sorted
+// by name.
+func (s *Syncer) Status() []ServiceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]ServiceStatus, 0, len(s.status))
+	for name, st := range s.status {
+		cp := *st
+		cp.Count = make(map[State]int)
+		for _, it := range s.items[name] {
+			cp.Count[it.State]++
+		}
+		out = append(out, cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Items returns the pins mirrored to service, or to all the services if
+// service is empty, sorted by service and CID.
+func (s *Syncer) Items(service string) []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Item
+	for name, items := range s.items {
+		if service != "" && name != service {
+			continue
+		}
+		for _, it := range items {
+			out = append(out, *it)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Service != out[j].Service {
+			return out[i].Service < out[j].Service
+		}
+		return out[i].Cid.String() < out[j].Cid.String()
+	})
+	return out
+}
+
+// Subscribe returns the changes of the states of the pins mirrored, until ctx
+// is done.
+func (s *Syncer) Subscribe(ctx context.Context) <-chan Event {
+	sub := &subscriber{ch: make(chan Event, eventsBuffer)}
+	s.mu.Lock()
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		defer func() {
+			s.mu.Lock()
+			delete(s.subscribers, sub)
+			s.mu.Unlock()
+		}()
+		for {
+			select {
+			case e := <-sub.ch:
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Close stops the periodic syncs.
+func (s *Syncer) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
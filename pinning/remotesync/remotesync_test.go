@@ -0,0 +1,270 @@
+package remotesync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+	pinclient "github.com/ipfs/go-pinning-service-http-client"
+	"github.com/multiformats/go-multiaddr"
+
+	"github.com/ipfs/go-ipfs/pinning/pinmeta"
+)
+
+type fakePin struct {
+	c    cid.Cid
+	name string
+}
+
+func (p *fakePin) GetCid() cid.Cid              { return p.c }
+func (p *fakePin) GetName() string              { return p.name }
+func (p *fakePin) GetOrigins() []string         { return nil }
+func (p *fakePin) GetMeta() map[string]string   { return nil }
+func (p *fakePin) String() string               { return p.c.String() }
+func (p *fakePin) MarshalJSON() ([]byte, error) { return json.Marshal(p.c) }
+
+type fakeStatus struct {
+	id     string
+	status pinclient.Status
+	pin    *fakePin
+}
+
+func (s *fakeStatus) GetRequestId() string                { return s.id }
+func (s *fakeStatus) GetStatus() pinclient.Status         { return s.status }
+func (s *fakeStatus) GetCreated() time.Time               { return time.Time{} }
+func (s *fakeStatus) GetPin() pinclient.PinGetter         { return s.pin }
+func (s *fakeStatus) GetDelegates() []multiaddr.Multiaddr { return nil }
+func (s *fakeStatus) GetInfo() map[string]string          { return nil }
+func (s *fakeStatus) String() string                      { return s.id }
+func (s *fakeStatus) MarshalJSON() ([]byte, error)        { return json.Marshal(s.id) }
+
+// fakeService is a pinning service whose pins are queued, and which fails
+// the requests of the CIDs in fail.
+type fakeService struct {
+	mu   sync.Mutex
+	pins map[string]*fakeStatus
+	fail map[cid.Cid]bool
+	next int
+}
+
+func (f *fakeService) Ls(ctx context.Context, opts ...pinclient.LsOption) (chan pinclient.PinStatusGetter, chan error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(chan pinclient.PinStatusGetter, len(f.pins))
+	errs := make(chan error, 1)
+	for _, ps := range f.pins {
+		out <- ps
+	}
+	close(out)
+	close(errs)
+	return out, errs
+}
+
+func (f *fakeService) Add(ctx context.Context, c cid.Cid, opts ...pinclient.AddOption) (pinclient.PinStatusGetter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail[c] {
+		return nil, errors.New("unavailable")
+	}
+	f.next++
+	ps := &fakeStatus{id: fmt.Sprint(f.next), status: pinclient.StatusQueued, pin: &fakePin{c: c, name: "sync"}}
+	f.pins[ps.id] = ps
+	return ps, nil
+}
+
+func (f *fakeService) DeleteByID(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.pins, id)
+	return nil
+}
+
+func (f *fakeService) setStatus(c cid.Cid, status pinclient.Status) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ps := range f.pins {
+		if ps.pin.c == c {
+			ps.status = status
+		}
+	}
+}
+
+func (f *fakeService) has(c cid.Cid) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, ps := range f.pins {
+		if ps.pin.c == c {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(dstore)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+	pinner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := pinmeta.New(dstore)
+
+	nodes := make(map[string]*dag.ProtoNode)
+	for _, name := range []string{"a", "b", "c"} {
+		nd := dag.NodeWithData([]byte(name))
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := pinner.Pin(ctx, nd, true); err != nil {
+			t.Fatal(err)
+		}
+		nodes[name] = nd
+	}
+	a, b, c := nodes["a"].Cid(), nodes["b"].Cid(), nodes["c"].Cid()
+	if err := meta.Set(ctx, pinmeta.Meta{Root: a, Labels: map[string]string{"tier": "gold"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	all := &fakeService{pins: map[string]*fakeStatus{}, fail: map[cid.Cid]bool{b: true}}
+	gold := &fakeService{pins: map[string]*fakeStatus{}}
+	// pinned by hand, with another name
+	gold.pins["mine"] = &fakeStatus{id: "mine", status: pinclient.StatusPinned, pin: &fakePin{c: c, name: "mine"}}
+	services := []Service{
+		{Name: "all", Client: all, PinName: "sync", Interval: time.Hour, MaxBackoff: time.Hour},
+		{Name: "gold", Client: &namedService{gold, "sync"}, PinName: "sync", Filter: pinmeta.Filter{Labels: map[string]string{"tier": "gold"}}, Interval: time.Hour, MaxBackoff: time.Hour},
+	}
+	s := New(func() ([]Service, error) { return services, nil }, pinner, meta)
+
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := s.Subscribe(subCtx)
+
+	if err := s.sync(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if !all.has(a) || all.has(b) || !all.has(c) {
+		t.Fatal("expected the pins mirrored, but the one failing")
+	}
+	if !gold.has(a) || len(gold.pins) != 2 {
+		t.Fatal("expected the labeled pin mirrored, and the others left alone")
+	}
+	failed := s.item("all", b)
+	if failed.State != Failed || failed.Attempts != 1 || failed.Error != "unavailable" {
+		t.Fatalf("expected the pin failed, got %+v", failed)
+	}
+	if e := <-events; e.State != Queued && e.State != Failed {
+		t.Fatalf("unexpected event %+v", e)
+	}
+
+	// not retried before its backoff, nor synced before the interval
+	delete(all.fail, b)
+	if s.due(services[0], time.Now()) {
+		t.Fatal("expected the service not to be due")
+	}
+	if !s.due(services[0], failed.Retry) {
+		t.Fatal("expected the service due for the retry")
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !all.has(b) || s.item("all", b).State != Queued {
+		t.Fatal("expected the pin retried")
+	}
+
+	// the states reported by the service are followed, and the pins failing
+	// there retried
+	all.setStatus(a, pinclient.StatusPinned)
+	all.setStatus(c, pinclient.StatusFailed)
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.item("all", a).State; st != Pinned {
+		t.Fatalf("expected the pin pinned, got %s", st)
+	}
+	if it := s.item("all", c); it.State != Failed || it.Error != errRemoteFailed.Error() {
+		t.Fatalf("expected the pin failed on the service, got %+v", it)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if it := s.item("all", c); it.State != Queued || it.Attempts != 1 {
+		t.Fatalf("expected the failed pin replaced, got %+v", it)
+	}
+
+	// the pins removed are removed remotely
+	if err := pinner.Unpin(ctx, a, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if all.has(a) || gold.has(a) || !gold.has(c) {
+		t.Fatal("expected the pin removed from the services, but the one pinned by hand")
+	}
+	for _, it := range s.Items("") {
+		if it.Cid == a {
+			t.Fatalf("expected the pin removed forgotten, got %+v", it)
+		}
+	}
+
+	st := s.Status()
+	if len(st) != 2 || st[0].Name != "all" || st[0].Count[Queued] != 2 || st[0].Error != "" {
+		t.Fatalf("unexpected status %+v", st)
+	}
+
+	var removed bool
+	for !removed {
+		select {
+		case e := <-events:
+			removed = removed || (e.State == Removed && e.Cid == a)
+		case <-time.After(time.Second):
+			t.Fatal("expected an event for the pin removed")
+		}
+	}
+}
+
+// namedService lists the pins of name only, as the services do with
+// FilterName.
+type namedService struct {
+	*fakeService
+	name string
+}
+
+func (n *namedService) Ls(ctx context.Context, opts ...pinclient.LsOption) (chan pinclient.PinStatusGetter, chan error) {
+	in, errs := n.fakeService.Ls(ctx, opts...)
+	out := make(chan pinclient.PinStatusGetter, len(in))
+	for ps := range in {
+		if ps.GetPin().GetName() == n.name {
+			out <- ps
+		}
+	}
+	close(out)
+	return out, errs
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, expected := range map[int]time.Duration{
+		1:   minBackoff,
+		2:   2 * minBackoff,
+		4:   8 * minBackoff,
+		100: time.Hour,
+	} {
+		if d := backoff(attempts, time.Hour); d != expected {
+			t.Errorf("%d attempts: expected %s, got %s", attempts, expected, d)
+		}
+	}
+}
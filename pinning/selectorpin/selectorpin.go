@@ -0,0 +1,176 @@
+// Package selectorpin implements selector pins: pins of the sub-DAG of a root
+// matched by an IPLD selector, rather than of the whole DAG.
+//
+// The pinner only knows direct and recursive pins, so selector pins are
+// stored separately, in the repo datastore, and the garbage collector and the
+// reprovider walk them with Walk.
+package selectorpin
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	blocks "github.com/ipfs/go-block-format"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	ipld "github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/ipld/go-ipld-prime/traversal"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+
+	"github.com/ipfs/go-ipfs/pinning/pinstore"
+)
+
+// pinsKey is the datastore key under which the selector pins are stored.
+var pinsKey = ds.NewKey("/local/pins/selector")
+
+// Pin is a pin of the blocks of the DAG of Root matched by Selector.
+type Pin struct {
+	Root cid.Cid
+	// Selector is the DAG-JSON encoding of the selector.
+	Selector string
+}
+
+// BlockGetter gets the blocks walked by selector pins.
+type BlockGetter interface {
+	GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error)
+}
+
+// ParseSelector parses and validates the DAG-JSON encoding of an IPLD
+// selector, and returns it in canonical form.
+func ParseSelector(s string) (string, error) {
+	nd, err := selectorparse.ParseJSONSelector(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid selector: %w", err)
+	}
+	if _, err := selector.CompileSelector(nd); err != nil {
+		return "", fmt.Errorf("invalid selector: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := dagjson.Encode(nd, &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Store stores the selector pins of a repo.
+type Store struct {
+	records *pinstore.Store
+}
+
+// New returns the store of the selector pins kept in d.
+func New(d ds.Datastore) *Store {
+	return &Store{records: pinstore.New(d, pinsKey, "selector pin")}
+}
+
+func (s *Store) pinKey(p Pin) ds.Key {
+	h := sha256.Sum256([]byte(p.Selector))
+	return s.records.Key(p.Root, hex.EncodeToString(h[:]))
+}
+
+// Add records the pin p. Adding the same pin twice has no effect.
+func (s *Store) Add(ctx context.Context, p Pin) error {
+	return s.records.Put(ctx, s.pinKey(p), &p)
+}
+
+// Remove removes all the selector pins of root, and returns how many were
+// removed.
+func (s *Store) Remove(ctx context.Context, root cid.Cid) (int, error) {
+	return s.records.DeleteAll(ctx, s.records.Key(root))
+}
+
+// Get returns the selector pins of root.
+func (s *Store) Get(ctx context.Context, root cid.Cid) ([]Pin, error) {
+	return s.query(ctx, s.records.Key(root))
+}
+
+// List returns all the selector pins, sorted by root.
+func (s *Store) List(ctx context.Context) ([]Pin, error) {
+	return s.query(ctx, s.records.Key(cid.Undef))
+}
+
+func (s *Store) query(ctx context.Context, k ds.Key) ([]Pin, error) {
+	var pins []Pin
+	err := s.records.List(ctx, k, func(decode func(interface{}) error) error {
+		var p Pin
+		if err := decode(&p); err != nil {
+			return err
+		}
+		pins = append(pins, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Root != pins[j].Root {
+			return pins[i].Root.KeyString() < pins[j].Root.KeyString()
+		}
+		return pins[i].Selector < pins[j].Selector
+	})
+	return pins, nil
+}
+
+// Walk calls visit for the root of p and for every block of its DAG reached
+// by its selector, getting the blocks from bg. A block may be visited more
+// than once.
+func Walk(ctx context.Context, bg BlockGetter, p Pin, visit func(cid.Cid)) error {
+	sel, err := selectorparse.ParseAndCompileJSONSelector(p.Selector)
+	if err != nil {
+		return err
+	}
+
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.TrustedStorage = true
+	lsys.StorageReadOpener = func(lctx ipld.LinkContext, l ipld.Link) (io.Reader, error) {
+		cl, ok := l.(cidlink.Link)
+		if !ok {
+			return nil, fmt.Errorf("unsupported link type %T", l)
+		}
+		blk, err := bg.GetBlock(lctx.Ctx, cl.Cid)
+		if err != nil {
+			return nil, err
+		}
+		visit(cl.Cid)
+		return bytes.NewReader(blk.RawData()), nil
+	}
+
+	chooser := dagpb.AddSupportToChooser(func(l ipld.Link, lctx ipld.LinkContext) (ipld.NodePrototype, error) {
+		if tl, ok := lctx.LinkNode.(schema.TypedLinkNode); ok {
+			return tl.LinkTargetNodePrototype(), nil
+		}
+		return basicnode.Prototype.Any, nil
+	})
+
+	root := cidlink.Link{Cid: p.Root}
+	proto, err := chooser(root, ipld.LinkContext{Ctx: ctx})
+	if err != nil {
+		return err
+	}
+	nd, err := lsys.Load(ipld.LinkContext{Ctx: ctx}, root, proto)
+	if err != nil {
+		return err
+	}
+
+	prog := traversal.Progress{
+		Cfg: &traversal.Config{
+			Ctx:                            ctx,
+			LinkSystem:                     lsys,
+			LinkTargetNodePrototypeChooser: chooser,
+		},
+	}
+	return prog.WalkAdv(nd, sel, func(traversal.Progress, ipld.Node, traversal.VisitReason) error {
+		return nil
+	})
+}
@@ -0,0 +1,135 @@
+package selectorpin
+
+import (
+	"context"
+	"testing"
+
+	bserv "github.com/ipfs/go-blockservice"
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestParseSelector(t *testing.T) {
+	s, err := ParseSelector(`{"R": {"l": {"depth": 1}, ":>": {"a": {">": {"@": {}}}}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != `{"R":{":>":{"a":{">":{"@":{}}}},"l":{"depth":1}}}` {
+		t.Errorf("selector is not canonical: %s", s)
+	}
+
+	for _, invalid := range []string{`{`, `{"x": {}}`, `{"R": {}}`} {
+		if _, err := ParseSelector(invalid); err == nil {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := New(dssync.MutexWrap(ds.NewMapDatastore()))
+
+	a := dag.NodeWithData([]byte("a")).Cid()
+	b := dag.NodeWithData([]byte("b")).Cid()
+	pins := []Pin{
+		{Root: a, Selector: `{".":{}}`},
+		{Root: a, Selector: `{"a":{">":{".":{}}}}`},
+		{Root: b, Selector: `{".":{}}`},
+	}
+	for _, p := range append(pins, pins[0]) {
+		if err := s.Add(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 pins, got %d", len(all))
+	}
+
+	got, err := s.Get(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Root != a || got[1].Root != a {
+		t.Fatalf("unexpected pins of %s: %v", a, got)
+	}
+
+	n, err := s.Remove(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 pins removed, got %d", n)
+	}
+	all, err = s.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Root != b {
+		t.Fatalf("unexpected pins after removal: %v", all)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	ctx := context.Background()
+	bs := bstore.NewBlockstore(dssync.MutexWrap(ds.NewMapDatastore()))
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	// root -> child -> grandchild
+	grandchild := dag.NodeWithData([]byte("grandchild"))
+	child := dag.NodeWithData([]byte("child"))
+	if err := child.AddNodeLink("grandchild", grandchild); err != nil {
+		t.Fatal(err)
+	}
+	root := dag.NodeWithData([]byte("root"))
+	if err := root.AddNodeLink("child", child); err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.AddMany(ctx, []ipld.Node{grandchild, child, root}); err != nil {
+		t.Fatal(err)
+	}
+
+	walk := func(sel string) *cid.Set {
+		t.Helper()
+		sel, err := ParseSelector(sel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set := cid.NewSet()
+		err = Walk(ctx, bserv.New(bs, offline.Exchange(bs)), Pin{Root: root.Cid(), Selector: sel}, func(c cid.Cid) {
+			set.Add(c)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return set
+	}
+
+	set := walk(`{"R":{"l":{"depth":4},":>":{"a":{">":{"@":{}}}}}}`)
+	if set.Len() != 2 || !set.Has(root.Cid()) || !set.Has(child.Cid()) {
+		t.Errorf("depth 4 selector walked %v", set.Keys())
+	}
+
+	set = walk(`{"R":{"l":{"none":{}},":>":{"a":{">":{"@":{}}}}}}`)
+	if set.Len() != 3 || !set.Has(grandchild.Cid()) {
+		t.Errorf("recursive selector walked %v", set.Keys())
+	}
+
+	// missing blocks make the walk fail
+	if err := bs.DeleteBlock(ctx, grandchild.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	sel, _ := ParseSelector(`{"R":{"l":{"none":{}},":>":{"a":{">":{"@":{}}}}}}`)
+	if err := Walk(ctx, bserv.New(bs, offline.Exchange(bs)), Pin{Root: root.Cid(), Selector: sel}, func(cid.Cid) {}); err == nil {
+		t.Error("expected the walk to fail on a missing block")
+	}
+}
@@ -0,0 +1,173 @@
+// Package warmup implements a pinner loading in the background, so that a
+// node starts serving before its pinset is loaded.
+//
+// Loading the pinner is quick when its indexes are clean, but after an unclean
+// shutdown it rebuilds them from all the pins, which takes minutes with
+// millions of pins. The calls made meanwhile wait for the load to complete.
+package warmup
+
+import (
+	"context"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("pin/warmup")
+
+// Pinner is a pinner loaded in the background. Its calls wait for the load to
+// complete, and fail if it did.
+type Pinner struct {
+	pinner pin.Pinner
+	err    error
+	ready  chan struct{}
+}
+
+var _ pin.Pinner = (*Pinner)(nil)
+
+// New returns a pinner loaded by load in the background. The load is canceled
+// with ctx.
+func New(ctx context.Context, load func(context.Context) (pin.Pinner, error)) *Pinner {
+	p := &Pinner{ready: make(chan struct{})}
+	go func() {
+		defer close(p.ready)
+		start := time.Now()
+		p.pinner, p.err = load(ctx)
+		if p.err != nil {
+			log.Errorf("loading the pinset: %s", p.err)
+			return
+		}
+		log.Infof("pinset loaded in %s", time.Since(start))
+	}()
+	return p
+}
+
+// Ready is closed once the load is complete.
+func (p *Pinner) Ready() <-chan struct{} {
+	return p.ready
+}
+
+// Err returns the error of the load, once complete.
+func (p *Pinner) Err() error {
+	select {
+	case <-p.ready:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits for the load to complete, and returns the pinner loaded.
+func (p *Pinner) Wait(ctx context.Context) (pin.Pinner, error) {
+	select {
+	case <-p.ready:
+		return p.pinner, p.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// wait waits for the load with no context, for the calls carrying none.
+func (p *Pinner) wait() pin.Pinner {
+	<-p.ready
+	return p.pinner
+}
+
+func (p *Pinner) IsPinned(ctx context.Context, c cid.Cid) (string, bool, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	return pn.IsPinned(ctx, c)
+}
+
+func (p *Pinner) IsPinnedWithType(ctx context.Context, c cid.Cid, mode pin.Mode) (string, bool, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	return pn.IsPinnedWithType(ctx, c, mode)
+}
+
+func (p *Pinner) Pin(ctx context.Context, node ipld.Node, recursive bool) error {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return pn.Pin(ctx, node, recursive)
+}
+
+func (p *Pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return pn.Unpin(ctx, c, recursive)
+}
+
+func (p *Pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return pn.Update(ctx, from, to, unpin)
+}
+
+func (p *Pinner) CheckIfPinned(ctx context.Context, cids ...cid.Cid) ([]pin.Pinned, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pn.CheckIfPinned(ctx, cids...)
+}
+
+// PinWithMode pins c once the pinner is loaded. It does nothing if the load
+// failed, as the Flush that follows fails.
+func (p *Pinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	if pn := p.wait(); pn != nil {
+		pn.PinWithMode(c, mode)
+	}
+}
+
+// RemovePinWithMode unpins c once the pinner is loaded. It does nothing if
+// the load failed, as the Flush that follows fails.
+func (p *Pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	if pn := p.wait(); pn != nil {
+		pn.RemovePinWithMode(c, mode)
+	}
+}
+
+func (p *Pinner) Flush(ctx context.Context) error {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return pn.Flush(ctx)
+}
+
+func (p *Pinner) DirectKeys(ctx context.Context) ([]cid.Cid, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pn.DirectKeys(ctx)
+}
+
+func (p *Pinner) RecursiveKeys(ctx context.Context) ([]cid.Cid, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pn.RecursiveKeys(ctx)
+}
+
+func (p *Pinner) InternalPins(ctx context.Context) ([]cid.Cid, error) {
+	pn, err := p.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pn.InternalPins(ctx)
+}
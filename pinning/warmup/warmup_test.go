@@ -0,0 +1,76 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	"github.com/ipfs/go-merkledag"
+)
+
+func TestWarmup(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	dserv := merkledag.NewDAGService(bserv.New(blockstore.NewBlockstore(dstore), offline.Exchange(blockstore.NewBlockstore(dstore))))
+
+	release := make(chan struct{})
+	p := New(ctx, func(ctx context.Context) (pin.Pinner, error) {
+		<-release
+		return dspinner.New(ctx, dstore, dserv)
+	})
+
+	select {
+	case <-p.Ready():
+		t.Fatal("ready before the load")
+	default:
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.RecursiveKeys(short); err != context.DeadlineExceeded {
+		t.Fatalf("expected the call to wait for the load, got %v", err)
+	}
+
+	nd := merkledag.NodeWithData([]byte("pinned"))
+	pinned := make(chan error)
+	go func() {
+		pinned <- p.Pin(ctx, nd, true)
+	}()
+	close(release)
+	if err := <-pinned; err != nil {
+		t.Fatal(err)
+	}
+	<-p.Ready()
+
+	keys, err := p.RecursiveKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != nd.Cid() {
+		t.Fatalf("unexpected recursive pins %v", keys)
+	}
+}
+
+func TestWarmupError(t *testing.T) {
+	ctx := context.Background()
+	failure := errors.New("corrupt pinset")
+	p := New(ctx, func(context.Context) (pin.Pinner, error) {
+		return nil, failure
+	})
+
+	if _, err := p.DirectKeys(ctx); err != failure {
+		t.Fatalf("expected the load error, got %v", err)
+	}
+	if p.Err() != failure {
+		t.Fatalf("expected the load error, got %v", p.Err())
+	}
+	// the calls without a context do nothing
+	p.PinWithMode(merkledag.NodeWithData(nil).Cid(), pin.Direct)
+}
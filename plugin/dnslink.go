@@ -0,0 +1,14 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/dnslink"
+)
+
+// PluginDNSLinkProvider is an interface that can be implemented to add
+// DNS provider types for the DNSLink auto-publisher
+type PluginDNSLinkProvider interface {
+	Plugin
+
+	DNSLinkProviderType() string
+	DNSLinkProviderConstructor() dnslink.ProviderConstructor
+}
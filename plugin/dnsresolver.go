@@ -0,0 +1,15 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/core/node"
+)
+
+// PluginDNSResolver is an interface that can be implemented to add resolvers
+// for the URLs of a scheme in DNS.Resolvers, such as resolvers of ENS-style
+// names
+type PluginDNSResolver interface {
+	Plugin
+
+	DNSResolverScheme() string
+	DNSResolverConstructor() node.DNSResolverConstructor
+}
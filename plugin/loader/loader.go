@@ -14,6 +14,10 @@ import (
 
 	"github.com/ipfs/go-ipfs/core"
 	"github.com/ipfs/go-ipfs/core/coreapi"
+	"github.com/ipfs/go-ipfs/core/node"
+	"github.com/ipfs/go-ipfs/dnslink"
+	"github.com/ipfs/go-ipfs/hashfunc"
+	"github.com/ipfs/go-ipfs/namespaces"
 	plugin "github.com/ipfs/go-ipfs/plugin"
 	fsrepo "github.com/ipfs/go-ipfs/repo/fsrepo"
 
@@ -262,6 +266,41 @@ func (loader *PluginLoader) Inject() error {
 				return err
 			}
 		}
+		if pl, ok := pl.(plugin.PluginDNSLinkProvider); ok {
+			err := injectDNSLinkPlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
+		if pl, ok := pl.(plugin.PluginDNSResolver); ok {
+			err := injectDNSResolverPlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
+		if pl, ok := pl.(plugin.PluginMultihash); ok {
+			err := injectMultihashPlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
+		if pl, ok := pl.(plugin.PluginReprovideStrategy); ok {
+			err := injectReprovideStrategyPlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
+		if pl, ok := pl.(plugin.PluginNamespace); ok {
+			err := injectNamespacePlugin(pl)
+			if err != nil {
+				loader.state = loaderFailed
+				return err
+			}
+		}
 	}
 
 	return loader.transition(loaderInjecting, loaderInjected)
@@ -334,6 +373,26 @@ func injectDatastorePlugin(pl plugin.PluginDatastore) error {
 	return fsrepo.AddDatastoreConfigHandler(pl.DatastoreTypeName(), pl.DatastoreConfigParser())
 }
 
+func injectDNSLinkPlugin(pl plugin.PluginDNSLinkProvider) error {
+	return dnslink.RegisterProvider(pl.DNSLinkProviderType(), pl.DNSLinkProviderConstructor())
+}
+
+func injectDNSResolverPlugin(pl plugin.PluginDNSResolver) error {
+	return node.RegisterDNSResolver(pl.DNSResolverScheme(), pl.DNSResolverConstructor())
+}
+
+func injectMultihashPlugin(pl plugin.PluginMultihash) error {
+	return hashfunc.Register(pl.MultihashCode(), pl.MultihashName(), pl.MultihashHasher())
+}
+
+func injectReprovideStrategyPlugin(pl plugin.PluginReprovideStrategy) error {
+	return node.RegisterReprovideStrategy(pl.ReprovideStrategyName(), pl.ReprovideStrategy())
+}
+
+func injectNamespacePlugin(pl plugin.PluginNamespace) error {
+	return namespaces.Register(pl.Namespace(), pl.NamespaceResolver())
+}
+
 func injectIPLDPlugin(pl plugin.PluginIPLD) error {
 	return pl.Register(multicodec.DefaultRegistry)
 }
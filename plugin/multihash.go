@@ -0,0 +1,16 @@
+package plugin
+
+import (
+	"hash"
+)
+
+// PluginMultihash is an interface that can be implemented to add multihash
+// functions, usable by 'ipfs add' and 'ipfs block put' and accepted in the
+// CIDs of the blocks
+type PluginMultihash interface {
+	Plugin
+
+	MultihashCode() uint64
+	MultihashName() string
+	MultihashHasher() func() hash.Hash
+}
@@ -0,0 +1,15 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/namespaces"
+)
+
+// PluginNamespace is an interface that can be implemented to add mutable-name
+// systems next to IPNS, resolving the paths /<namespace>/<name>/... in the
+// path APIs and the gateway
+type PluginNamespace interface {
+	Plugin
+
+	Namespace() string
+	NamespaceResolver() namespaces.Resolver
+}
@@ -125,3 +125,21 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 
 	return badgerds.NewDatastore(p, &defopts)
 }
+
+// CreateReadOnly opens the datastore read-only: badger shares its lock with
+// the other readers.
+func (c *datastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	defopts := badgerds.DefaultOptions
+	defopts.ReadOnly = true
+	defopts.Truncate = false
+	// the garbage collection of the value log writes
+	defopts.GcInterval = 0
+	defopts.ValueLogFileSize = c.vlogFileSize
+
+	return badgerds.NewDatastore(p, &defopts)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/fsrepo"
 
+	ds "github.com/ipfs/go-datastore"
 	flatfs "github.com/ipfs/go-ds-flatfs"
 )
 
@@ -20,6 +21,8 @@ type flatfsPlugin struct{}
 
 var _ plugin.PluginDatastore = (*flatfsPlugin)(nil)
 
+var _ fsrepo.FileDatastoreConfig = (*datastoreConfig)(nil)
+
 func (*flatfsPlugin) Name() string {
 	return "ds-flatfs"
 }
@@ -81,10 +84,18 @@ func (c *datastoreConfig) DiskSpec() fsrepo.DiskSpec {
 }
 
 func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
-	p := c.path
-	if !filepath.IsAbs(p) {
-		p = filepath.Join(path, p)
-	}
+	return flatfs.CreateOrOpen(c.dir(path), c.shardFun, c.syncField)
+}
 
-	return flatfs.CreateOrOpen(p, c.shardFun, c.syncField)
+// File returns the file flatfs stores the value of key in, as is.
+func (c *datastoreConfig) File(path string, key ds.Key) (string, bool) {
+	return keyFile(c.dir(path), c.shardFun.Func(), key)
+}
+
+// dir returns the directory of the datastore created under path.
+func (c *datastoreConfig) dir(path string) string {
+	if filepath.IsAbs(c.path) {
+		return c.path
+	}
+	return filepath.Join(path, c.path)
 }
@@ -0,0 +1,211 @@
+package flatfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/jbenet/goprocess"
+)
+
+const extension = ".data"
+
+// readOnlyDatastore reads a flatfs datastore without writing to its
+// directory, which flatfs.Open does, to keep its temporary files and the
+// cache of its disk usage.
+type readOnlyDatastore struct {
+	path   string
+	getDir flatfs.ShardFunc
+}
+
+var _ ds.PersistentDatastore = (*readOnlyDatastore)(nil)
+
+// CreateReadOnly opens the datastore read-only.
+func (c *datastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	p := c.dir(path)
+
+	shardFun, err := flatfs.ReadShardFunc(p)
+	if err != nil {
+		return nil, err
+	}
+	if shardFun.String() != c.shardFun.String() {
+		return nil, fmt.Errorf("the shard function of %s is %s, not %s", p, shardFun, c.shardFun)
+	}
+	return &readOnlyDatastore{path: p, getDir: shardFun.Func()}, nil
+}
+
+// file returns the file of key, false if key cannot be in a flatfs datastore.
+func (d *readOnlyDatastore) file(key ds.Key) (string, bool) {
+	return keyFile(d.path, d.getDir, key)
+}
+
+// keyFile returns the file of key in the flatfs datastore at path, false if
+// key cannot be in a flatfs datastore.
+func keyFile(path string, getDir flatfs.ShardFunc, key ds.Key) (string, bool) {
+	noslash := key.String()[1:]
+	if noslash == "" || strings.IndexFunc(noslash, invalidKeyRune) >= 0 {
+		return "", false
+	}
+	return filepath.Join(path, getDir(noslash), noslash+extension), true
+}
+
+func invalidKeyRune(r rune) bool {
+	switch {
+	case '0' <= r && r <= '9', 'A' <= r && r <= 'Z':
+		return false
+	}
+	return !strings.ContainsRune("+-_=", r)
+}
+
+func (d *readOnlyDatastore) Get(_ context.Context, key ds.Key) ([]byte, error) {
+	file, ok := d.file(key)
+	if !ok {
+		return nil, ds.ErrNotFound
+	}
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, ds.ErrNotFound
+	}
+	return data, err
+}
+
+func (d *readOnlyDatastore) Has(_ context.Context, key ds.Key) (bool, error) {
+	file, ok := d.file(key)
+	if !ok {
+		return false, nil
+	}
+	_, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (d *readOnlyDatastore) GetSize(_ context.Context, key ds.Key) (int, error) {
+	file, ok := d.file(key)
+	if !ok {
+		return -1, ds.ErrNotFound
+	}
+	fi, err := os.Stat(file)
+	if os.IsNotExist(err) {
+		return -1, ds.ErrNotFound
+	}
+	if err != nil {
+		return -1, err
+	}
+	return int(fi.Size()), nil
+}
+
+func (d *readOnlyDatastore) Query(_ context.Context, q query.Query) (query.Results, error) {
+	// the keys of flatfs have a single component
+	if ds.NewKey(q.Prefix).String() != "/" {
+		return query.ResultsWithEntries(q, nil), nil
+	}
+	results := query.ResultsWithProcess(q, func(p goprocess.Process, out chan<- query.Result) {
+		if err := d.walk(p, q, out); err != nil {
+			select {
+			case out <- query.Result{Error: err}:
+			case <-p.Closing():
+			}
+		}
+	})
+	return query.NaiveQueryApply(q, results), nil
+}
+
+// walk sends the entries of the shard directories to out.
+func (d *readOnlyDatastore) walk(p goprocess.Process, q query.Query, out chan<- query.Result) error {
+	shards, err := ioutil.ReadDir(d.path)
+	if err != nil {
+		return err
+	}
+	for _, shard := range shards {
+		if !shard.IsDir() || strings.HasPrefix(shard.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(d.path, shard.Name())
+		f, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if !strings.HasSuffix(name, extension) || strings.HasPrefix(name, ".") {
+				continue
+			}
+			r := query.Result{Entry: query.Entry{Key: "/" + strings.TrimSuffix(name, extension)}}
+			switch {
+			case !q.KeysOnly:
+				r.Value, r.Error = ioutil.ReadFile(filepath.Join(dir, name))
+				r.Size = len(r.Value)
+			case q.ReturnsSizes:
+				fi, err := os.Stat(filepath.Join(dir, name))
+				if err != nil {
+					r.Error = err
+				} else {
+					r.Size = int(fi.Size())
+				}
+			}
+			if os.IsNotExist(r.Error) {
+				// removed since
+				continue
+			}
+			select {
+			case out <- r:
+			case <-p.Closing():
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// DiskUsage returns the disk usage cached by flatfs, when last written.
+func (d *readOnlyDatastore) DiskUsage(context.Context) (uint64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(d.path, flatfs.DiskUsageFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var du struct {
+		DiskUsage int64 `json:"diskUsage"`
+	}
+	if err := json.Unmarshal(data, &du); err != nil || du.DiskUsage < 0 {
+		return 0, errors.New("invalid disk usage cache of flatfs")
+	}
+	return uint64(du.DiskUsage), nil
+}
+
+func (d *readOnlyDatastore) Put(context.Context, ds.Key, []byte) error {
+	return repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) Delete(context.Context, ds.Key) error {
+	return repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) Batch(context.Context) (ds.Batch, error) {
+	return nil, repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) Sync(context.Context, ds.Key) error {
+	return nil
+}
+
+func (d *readOnlyDatastore) Close() error {
+	return nil
+}
@@ -86,3 +86,17 @@ func (c *datastoreConfig) Create(path string) (repo.Datastore, error) {
 		Compression: c.compression,
 	})
 }
+
+// CreateReadOnly opens the datastore read-only: leveldb shares its lock with
+// the other readers.
+func (c *datastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	p := c.path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(path, p)
+	}
+
+	return levelds.NewDatastore(p, &levelds.Options{
+		Compression: c.compression,
+		ReadOnly:    true,
+	})
+}
@@ -0,0 +1,14 @@
+package plugin
+
+import (
+	"github.com/ipfs/go-ipfs/core/node"
+)
+
+// PluginReprovideStrategy is an interface that can be implemented to add
+// strategies to Reprovider.Strategy, listing the keys the reprovider announces
+type PluginReprovideStrategy interface {
+	Plugin
+
+	ReprovideStrategyName() string
+	ReprovideStrategy() node.ReprovideStrategy
+}
@@ -0,0 +1,435 @@
+// Package profhistory takes snapshots of the CPU, heap and goroutine
+// profiles of the node on a schedule, and keeps a bounded history of them on
+// disk, so that the memory growth and the goroutine leaks which only show
+// after days of uptime can be diagnosed once they do.
+//
+// Each snapshot is a directory named after its time, holding the profiles, to
+// be examined with 'go tool pprof', and a summary of them: the memory
+// statistics, the number of goroutines and the functions holding the most of
+// them. The summaries make the timeline of the history, which survives the
+// restarts of the node.
+package profhistory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("profhistory")
+
+// The files of the profiles of a snapshot.
+const (
+	CPUFile       = "cpu.pprof"
+	HeapFile      = "heap.pprof"
+	GoroutineFile = "goroutine.pprof"
+)
+
+const (
+	summaryFile = "summary.json"
+	// tmpSuffix is the suffix of the directory of a snapshot being taken
+	tmpSuffix = ".tmp"
+	// nameFormat is the format of the names of the snapshots, in UTC: they
+	// sort as their times, and are valid file names on windows
+	nameFormat = "2006-01-02T15_04_05.000Z"
+	// topFunctions is the number of functions kept in the tops of a summary
+	topFunctions = 10
+)
+
+var errClosing = errors.New("profhistory: recorder closing")
+
+// Entry is the number of goroutines, or of bytes, of a function.
+type Entry struct {
+	Function string
+	Value    int64
+}
+
+// Snapshot is the summary of the profiles taken at a time.
+type Snapshot struct {
+	// Name is the name of the directory of the snapshot
+	Name string
+	Time time.Time
+	// Uptime is how long the node had been running
+	Uptime time.Duration
+
+	Goroutines  int
+	HeapAlloc   uint64
+	HeapInuse   uint64
+	HeapObjects uint64
+	Sys         uint64
+	NumGC       uint32
+
+	// Profiles are the files of the profiles of the snapshot, the CPU
+	// profile being skipped when another one was running
+	Profiles []string
+	// TopGoroutines are the functions which started the most goroutines
+	// still running
+	TopGoroutines []Entry
+	// TopHeap are the functions which allocated the most memory in use, as
+	// of the last garbage collection
+	TopHeap []Entry
+}
+
+// Settings are the settings of a Recorder.
+type Settings struct {
+	// Dir is the directory of the snapshots
+	Dir string
+	// Interval is the interval between the snapshots
+	Interval time.Duration
+	// CPUDuration is how long the CPU is profiled in each snapshot, zero
+	// skipping the CPU profile
+	CPUDuration time.Duration
+	// MaxSnapshots is the number of snapshots kept
+	MaxSnapshots int
+}
+
+// Recorder takes the snapshots.
+type Recorder struct {
+	settings Settings
+	started  time.Time
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// New returns a recorder taking a snapshot at once, then at every interval,
+// until Close is called.
+func New(settings Settings) (*Recorder, error) {
+	if err := os.MkdirAll(settings.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{
+		settings: settings,
+		started:  time.Now(),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// Settings returns the settings of the recorder.
+func (r *Recorder) Settings() Settings {
+	return r.settings
+}
+
+// History returns the snapshots kept, oldest first.
+func (r *Recorder) History() ([]Snapshot, error) {
+	return Load(r.settings.Dir)
+}
+
+// Open opens the file of a profile of the snapshot name.
+func (r *Recorder) Open(name, file string) (*os.File, error) {
+	switch file {
+	case CPUFile, HeapFile, GoroutineFile:
+	default:
+		return nil, fmt.Errorf("unknown profile %q", file)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") || strings.HasSuffix(name, tmpSuffix) {
+		return nil, fmt.Errorf("invalid snapshot %q", name)
+	}
+	return os.Open(filepath.Join(r.settings.Dir, name, file))
+}
+
+// Close stops taking snapshots, abandoning the one being taken.
+func (r *Recorder) Close() error {
+	close(r.closing)
+	<-r.closed
+	return nil
+}
+
+func (r *Recorder) run() {
+	defer close(r.closed)
+	r.clean()
+	t := time.NewTicker(r.settings.Interval)
+	defer t.Stop()
+	now := time.Now()
+	for {
+		if err := r.snapshot(now); err != nil {
+			if err == errClosing {
+				return
+			}
+			log.Errorf("snapshot of the profiles failed: %s", err)
+		}
+		select {
+		case now = <-t.C:
+		case <-r.closing:
+			return
+		}
+	}
+}
+
+// clean removes the snapshots interrupted by the end of the process.
+func (r *Recorder) clean() {
+	entries, err := ioutil.ReadDir(r.settings.Dir)
+	if err != nil {
+		log.Errorf("cannot read the snapshots of the profiles: %s", err)
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasSuffix(e.Name(), tmpSuffix) {
+			os.RemoveAll(filepath.Join(r.settings.Dir, e.Name()))
+		}
+	}
+}
+
+// snapshot takes the snapshot of now, then removes the oldest snapshots past
+// the maximum. The profiles are written to a temporary directory, renamed
+// once complete.
+func (r *Recorder) snapshot(now time.Time) error {
+	name := now.UTC().Format(nameFormat)
+	tmp := filepath.Join(r.settings.Dir, name+tmpSuffix)
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	s := Snapshot{Name: name, Time: now, Uptime: now.Sub(r.started)}
+	if r.settings.CPUDuration > 0 {
+		ok, err := r.profileCPU(filepath.Join(tmp, CPUFile))
+		if err != nil {
+			return err
+		}
+		if ok {
+			s.Profiles = append(s.Profiles, CPUFile)
+		}
+	}
+	for _, p := range []struct{ name, file string }{
+		{"heap", HeapFile},
+		{"goroutine", GoroutineFile},
+	} {
+		if err := writeProfile(p.name, filepath.Join(tmp, p.file)); err != nil {
+			return err
+		}
+		s.Profiles = append(s.Profiles, p.file)
+	}
+	summarize(&s)
+
+	data, err := json.MarshalIndent(&s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, summaryFile), data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(r.settings.Dir, name)); err != nil {
+		return err
+	}
+	return r.prune()
+}
+
+// profileCPU profiles the CPU for the CPU duration to fpath. It reports
+// false when another CPU profile is running, such as that of 'ipfs diag
+// profile', as there can only be one.
+func (r *Recorder) profileCPU(fpath string) (bool, error) {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	if err := pprof.StartCPUProfile(f); err != nil {
+		log.Warnf("CPU profile of the snapshot skipped: %s", err)
+		f.Close()
+		return false, os.Remove(fpath)
+	}
+
+	timer := time.NewTimer(r.settings.CPUDuration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-r.closing:
+		pprof.StopCPUProfile()
+		return false, errClosing
+	}
+	pprof.StopCPUProfile()
+	return true, f.Close()
+}
+
+// writeProfile writes the profile name to fpath.
+func writeProfile(name, fpath string) error {
+	f, err := os.Create(fpath)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup(name).WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// prune removes the oldest snapshots past the maximum.
+func (r *Recorder) prune() error {
+	names, err := snapshotNames(r.settings.Dir)
+	if err != nil {
+		return err
+	}
+	for len(names) > r.settings.MaxSnapshots {
+		if err := os.RemoveAll(filepath.Join(r.settings.Dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// snapshotNames returns the names of the snapshots of dir, oldest first.
+func snapshotNames(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasSuffix(e.Name(), tmpSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Load returns the snapshots of the directory dir, oldest first. It reads
+// them without a recorder, such as when the node is not running.
+func Load(dir string) ([]Snapshot, error) {
+	names, err := snapshotNames(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(names))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name, summaryFile))
+		if err != nil {
+			// removed since, or not a snapshot
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		var s Snapshot
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("invalid summary of the snapshot %s: %s", name, err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// summarize sets the statistics of the memory and the goroutines of s.
+func summarize(s *Snapshot) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	s.HeapAlloc = ms.HeapAlloc
+	s.HeapInuse = ms.HeapInuse
+	s.HeapObjects = ms.HeapObjects
+	s.Sys = ms.Sys
+	s.NumGC = ms.NumGC
+
+	goroutines := goroutineProfile()
+	s.Goroutines = len(goroutines)
+	counts := make(map[string]int64)
+	for _, g := range goroutines {
+		counts[entryFunction(g.Stack())]++
+	}
+	s.TopGoroutines = top(counts)
+
+	inuse := make(map[string]int64)
+	for _, m := range memProfile() {
+		if b := m.InUseBytes(); b > 0 {
+			inuse[allocFunction(m.Stack())] += b
+		}
+	}
+	s.TopHeap = top(inuse)
+}
+
+func goroutineProfile() []runtime.StackRecord {
+	records := make([]runtime.StackRecord, runtime.NumGoroutine()+16)
+	for {
+		n, ok := runtime.GoroutineProfile(records)
+		if ok {
+			return records[:n]
+		}
+		records = make([]runtime.StackRecord, n+n/4)
+	}
+}
+
+func memProfile() []runtime.MemProfileRecord {
+	n, _ := runtime.MemProfile(nil, false)
+	for {
+		records := make([]runtime.MemProfileRecord, n+n/4+16)
+		var ok bool
+		n, ok = runtime.MemProfile(records, false)
+		if ok {
+			return records[:n]
+		}
+	}
+}
+
+// entryFunction returns the function a goroutine was started with, the last
+// one of its stack.
+func entryFunction(stk []uintptr) string {
+	var fn string
+	frames := runtime.CallersFrames(stk)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && f.Function != "runtime.goexit" {
+			fn = f.Function
+		}
+		if !more {
+			return fn
+		}
+	}
+}
+
+// allocFunction returns the function which allocated, the first one of the
+// stack out of the runtime.
+func allocFunction(stk []uintptr) string {
+	var fn string
+	frames := runtime.CallersFrames(stk)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			fn = f.Function
+			if !strings.HasPrefix(fn, "runtime.") {
+				return fn
+			}
+		}
+		if !more {
+			return fn
+		}
+	}
+}
+
+// top returns the functions of values with the most, the most first.
+func top(values map[string]int64) []Entry {
+	entries := make([]Entry, 0, len(values))
+	for fn, v := range values {
+		entries = append(entries, Entry{Function: fn, Value: v})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Value != entries[j].Value {
+			return entries[i].Value > entries[j].Value
+		}
+		return entries[i].Function < entries[j].Function
+	})
+	if len(entries) > topFunctions {
+		entries = entries[:topFunctions]
+	}
+	return entries
+}
@@ -0,0 +1,118 @@
+package profhistory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func parked(ch chan struct{}) {
+	<-ch
+}
+
+func TestSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	settings := Settings{Dir: dir, Interval: time.Hour, CPUDuration: 10 * time.Millisecond, MaxSnapshots: 2}
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	r := &Recorder{settings: settings, started: start, closing: make(chan struct{})}
+
+	// the goroutines started by parked top the goroutines
+	ch := make(chan struct{})
+	defer close(ch)
+	for i := 0; i < 100; i++ {
+		go parked(ch)
+	}
+
+	// an interrupted snapshot is left over
+	if err := os.Mkdir(filepath.Join(dir, "interrupted"+tmpSuffix), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r.clean()
+
+	for i := 0; i < 3; i++ {
+		if err := r.snapshot(start.Add(time.Duration(i) * time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := r.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("expected the 2 latest snapshots kept, got %d", len(snapshots))
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the other snapshots removed, got %d entries", len(entries))
+	}
+
+	s := snapshots[1]
+	if !s.Time.Equal(start.Add(2*time.Hour)) || s.Uptime != 2*time.Hour {
+		t.Errorf("expected the latest snapshot last, got %s after %s", s.Time, s.Uptime)
+	}
+	if s.Goroutines < 100 || s.HeapInuse == 0 || s.Sys == 0 {
+		t.Errorf("expected the statistics set, got %+v", s)
+	}
+	if len(s.TopGoroutines) == 0 || s.TopGoroutines[0].Function != "github.com/ipfs/go-ipfs/profhistory.parked" || s.TopGoroutines[0].Value != 100 {
+		t.Errorf("expected the goroutines of parked on top, got %+v", s.TopGoroutines)
+	}
+	if len(s.TopHeap) == 0 {
+		t.Error("expected the heap in use by function")
+	}
+
+	for _, file := range s.Profiles {
+		f, err := r.Open(s.Name, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fi, err := f.Stat()
+		f.Close()
+		if err != nil || fi.Size() == 0 {
+			t.Errorf("expected the profile %s written", file)
+		}
+	}
+	if len(s.Profiles) != 3 {
+		t.Errorf("expected the CPU, heap and goroutine profiles, got %v", s.Profiles)
+	}
+	for _, name := range []string{"..", "../x", s.Name + tmpSuffix, ""} {
+		if _, err := r.Open(name, HeapFile); err == nil || os.IsNotExist(err) {
+			t.Errorf("expected the snapshot %q refused, got %v", name, err)
+		}
+	}
+	if _, err := r.Open(s.Name, summaryFile); err == nil {
+		t.Error("expected only the profiles opened")
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r, err := New(Settings{Dir: dir, Interval: time.Hour, CPUDuration: time.Minute, MaxSnapshots: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closing abandons the snapshot profiling the CPU
+	time.Sleep(50 * time.Millisecond)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 0 || len(entries) != 0 {
+		t.Errorf("expected the snapshot abandoned, got %d snapshots and %d entries", len(snapshots), len(entries))
+	}
+
+	if snapshots, err := Load(filepath.Join(dir, "missing")); err != nil || len(snapshots) != 0 {
+		t.Errorf("expected no snapshot in a missing directory, got %v, %v", snapshots, err)
+	}
+}
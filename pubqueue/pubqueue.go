@@ -0,0 +1,380 @@
+// Package pubqueue queues the IPNS records and the provider records that
+// could not be published because the node was unreachable, and persists them
+// in the datastore, so that they are published once the node is reachable
+// again, even after a restart.
+//
+// The node is unreachable when it is not connected to any peer, or when the
+// routing system finds no peer to publish to. The other failures are returned
+// as they are.
+package pubqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/routing"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+)
+
+var log = logging.Logger("pubqueue")
+
+var (
+	// recordsKey and providesKey are the datastore keys under which the
+	// queued records and provides are persisted.
+	recordsKey  = ds.NewKey("/local/pubqueue/records")
+	providesKey = ds.NewKey("/local/pubqueue/provides")
+)
+
+const (
+	// MaxProvides is the largest number of provides queued. The provides
+	// beyond are dropped, the reprovider announcing them eventually.
+	MaxProvides = 100000
+	// RetryInterval is the interval at which the queue is flushed while the
+	// node is connected.
+	RetryInterval = time.Minute
+	// ConnectDelay is the time between the node getting connected and the
+	// queue being flushed, for the routing system to find its peers first.
+	ConnectDelay = 5 * time.Second
+)
+
+// Stat is the state of the queue.
+type Stat struct {
+	// Records is the number of IPNS records, and public keys, queued
+	Records int
+	// Provides is the number of provides queued
+	Provides int
+	// Dropped is the number of provides dropped since the node started,
+	// because the queue was full
+	Dropped uint64
+	// Oldest is when the oldest entry of the queue was queued
+	Oldest time.Time
+	// LastFlush is when the queue was last flushed, and LastError the error
+	// that stopped that flush, if any
+	LastFlush time.Time
+	LastError string `json:",omitempty"`
+}
+
+// entry is a record or a provide queued, as persisted.
+type entry struct {
+	Key    []byte `json:",omitempty"`
+	Value  []byte `json:",omitempty"`
+	Queued time.Time
+}
+
+// Queue queues what could not be published through its routing system, and
+// publishes it when the node gets connected, then every RetryInterval, until
+// Close is called.
+type Queue struct {
+	ds  ds.Datastore
+	rt  routing.Routing
+	net network.Network
+
+	mu sync.Mutex
+	// records and provides are when the entries were queued, by datastore key
+	records   map[ds.Key]time.Time
+	provides  map[ds.Key]time.Time
+	dropped   uint64
+	lastFlush time.Time
+	lastError string
+
+	connected chan struct{}
+	flushing  sync.Mutex
+	cancel    context.CancelFunc
+	closed    chan struct{}
+}
+
+// New returns the queue of the entries persisted in d, publishing them
+// through rt when the node is connected to the peers of n.
+func New(ctx context.Context, d ds.Datastore, rt routing.Routing, n network.Network) (*Queue, error) {
+	q := &Queue{
+		ds:        d,
+		rt:        rt,
+		net:       n,
+		records:   make(map[ds.Key]time.Time),
+		provides:  make(map[ds.Key]time.Time),
+		connected: make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+	for prefix, queued := range map[ds.Key]map[ds.Key]time.Time{recordsKey: q.records, providesKey: q.provides} {
+		res, err := d.Query(ctx, dsq.Query{Prefix: prefix.String()})
+		if err != nil {
+			return nil, err
+		}
+		entries, err := res.Rest()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			var en entry
+			if err := json.Unmarshal(e.Value, &en); err != nil {
+				log.Warnf("ignoring the invalid entry %s: %s", e.Key, err)
+				continue
+			}
+			queued[ds.RawKey(e.Key)] = en.Queued
+		}
+	}
+
+	n.Notify(&network.NotifyBundle{
+		ConnectedF: func(network.Network, network.Conn) {
+			select {
+			case q.connected <- struct{}{}:
+			default:
+			}
+		},
+	})
+
+	ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run(ctx)
+	return q, nil
+}
+
+// Routing returns the routing system of the queue, queuing the records put
+// and the provides announced while the node is unreachable instead of failing.
+func (q *Queue) Routing() routing.Routing {
+	return &queueRouting{Routing: q.rt, q: q}
+}
+
+// Stat returns the state of the queue.
+func (q *Queue) Stat() Stat {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := Stat{
+		Records:   len(q.records),
+		Provides:  len(q.provides),
+		Dropped:   q.dropped,
+		LastFlush: q.lastFlush,
+		LastError: q.lastError,
+	}
+	for _, queued := range []map[ds.Key]time.Time{q.records, q.provides} {
+		for _, t := range queued {
+			if st.Oldest.IsZero() || t.Before(st.Oldest) {
+				st.Oldest = t
+			}
+		}
+	}
+	return st
+}
+
+// Close stops flushing the queue. The entries queued stay persisted.
+func (q *Queue) Close() error {
+	q.cancel()
+	<-q.closed
+	return nil
+}
+
+func (q *Queue) run(ctx context.Context) {
+	defer close(q.closed)
+	retry := time.NewTicker(RetryInterval)
+	defer retry.Stop()
+	delay := time.NewTimer(ConnectDelay)
+	defer delay.Stop()
+
+	for {
+		select {
+		case <-q.connected:
+			// flush once the routing system had time to find its peers
+			if !delay.Stop() {
+				select {
+				case <-delay.C:
+				default:
+				}
+			}
+			delay.Reset(ConnectDelay)
+			continue
+		case <-delay.C:
+		case <-retry.C:
+		case <-ctx.Done():
+			return
+		}
+		if q.empty() || !q.reachable() {
+			continue
+		}
+		if err := q.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Infof("cannot flush the publish queue yet: %s", err)
+		}
+	}
+}
+
+func (q *Queue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.records) == 0 && len(q.provides) == 0
+}
+
+// reachable reports whether the node is connected to any peer.
+func (q *Queue) reachable() bool {
+	return len(q.net.Peers()) > 0
+}
+
+// Flush publishes the entries of the queue, removing the ones published. It
+// stops at the first failure.
+func (q *Queue) Flush(ctx context.Context) error {
+	q.flushing.Lock()
+	defer q.flushing.Unlock()
+
+	err := q.flush(ctx)
+	q.mu.Lock()
+	q.lastFlush = time.Now()
+	q.lastError = ""
+	if err != nil {
+		q.lastError = err.Error()
+	}
+	q.mu.Unlock()
+	return err
+}
+
+func (q *Queue) flush(ctx context.Context) error {
+	for _, prefix := range []ds.Key{recordsKey, providesKey} {
+		for k, queued := range q.entries(prefix) {
+			data, err := q.ds.Get(ctx, k)
+			if err == ds.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			var en entry
+			if err := json.Unmarshal(data, &en); err != nil {
+				log.Warnf("dropping the invalid entry %s: %s", k, err)
+				if err := q.remove(ctx, prefix, k, queued); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if prefix == recordsKey {
+				err = q.rt.PutValue(ctx, string(en.Key), en.Value)
+			} else if c, cerr := cid.Cast(en.Key); cerr != nil {
+				log.Warnf("dropping the invalid provide %s: %s", k, cerr)
+			} else {
+				err = q.rt.Provide(ctx, c, true)
+			}
+			if err != nil {
+				return err
+			}
+			// an entry queued again meanwhile stays queued
+			if err := q.remove(ctx, prefix, k, queued); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// entries returns a copy of the entries queued under prefix.
+func (q *Queue) entries(prefix ds.Key) map[ds.Key]time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queued := q.records
+	if prefix == providesKey {
+		queued = q.provides
+	}
+	entries := make(map[ds.Key]time.Time, len(queued))
+	for k, t := range queued {
+		entries[k] = t
+	}
+	return entries
+}
+
+// remove removes the entry k, unless it was queued again since queued.
+func (q *Queue) remove(ctx context.Context, prefix, k ds.Key, queued time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries := q.records
+	if prefix == providesKey {
+		entries = q.provides
+	}
+	if t, ok := entries[k]; !ok || !t.Equal(queued) {
+		return nil
+	}
+	if err := q.ds.Delete(ctx, k); err != nil {
+		return err
+	}
+	delete(entries, k)
+	return nil
+}
+
+// queueRecord queues the record val of the routing key key, replacing the
+// record of the same key queued, if any.
+func (q *Queue) queueRecord(ctx context.Context, key string, val []byte) error {
+	k := recordsKey.Child(dshelp.NewKeyFromBinary([]byte(key)))
+	return q.queue(ctx, q.records, k, entry{Key: []byte(key), Value: val})
+}
+
+// queueProvide queues the provide of c.
+func (q *Queue) queueProvide(ctx context.Context, c cid.Cid) error {
+	k := providesKey.ChildString(c.String())
+	q.mu.Lock()
+	if _, ok := q.provides[k]; !ok && len(q.provides) >= MaxProvides {
+		q.dropped++
+		q.mu.Unlock()
+		return nil
+	}
+	q.mu.Unlock()
+	return q.queue(ctx, q.provides, k, entry{Key: c.Bytes()})
+}
+
+func (q *Queue) queue(ctx context.Context, entries map[ds.Key]time.Time, k ds.Key, en entry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	en.Queued = time.Now()
+	data, err := json.Marshal(&en)
+	if err != nil {
+		return err
+	}
+	if err := q.ds.Put(ctx, k, data); err != nil {
+		return err
+	}
+	if err := q.ds.Sync(ctx, k); err != nil {
+		return err
+	}
+	entries[k] = en.Queued
+	return nil
+}
+
+// unreachable reports whether err is the failure of the routing system to
+// find any peer.
+func unreachable(err error) bool {
+	return errors.Is(err, kb.ErrLookupFailure)
+}
+
+// queueRouting queues the records and the provides that cannot be published
+// because the node is unreachable.
+type queueRouting struct {
+	routing.Routing
+	q *Queue
+}
+
+func (r *queueRouting) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	if r.q.reachable() {
+		err := r.Routing.PutValue(ctx, key, val, opts...)
+		if !unreachable(err) {
+			return err
+		}
+	}
+	log.Warn("the node is unreachable, queuing the record to publish")
+	return r.q.queueRecord(ctx, key, val)
+}
+
+func (r *queueRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if !announce {
+		return r.Routing.Provide(ctx, c, announce)
+	}
+	if r.q.reachable() {
+		err := r.Routing.Provide(ctx, c, announce)
+		if !unreachable(err) {
+			return err
+		}
+	}
+	log.Debugf("the node is unreachable, queuing the provide of %s", c)
+	return r.q.queueProvide(ctx, c)
+}
@@ -0,0 +1,138 @@
+package pubqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/routing"
+	kb "github.com/libp2p/go-libp2p-kbucket"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multihash"
+)
+
+// fakeRouting records the values put and the provides announced, failing
+// with err.
+type fakeRouting struct {
+	routing.Routing
+	err      error
+	values   map[string]string
+	provides []cid.Cid
+}
+
+func (r *fakeRouting) PutValue(ctx context.Context, key string, val []byte, opts ...routing.Option) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.values[key] = string(val)
+	return nil
+}
+
+func (r *fakeRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.provides = append(r.provides, c)
+	return nil
+}
+
+func testCid(t *testing.T, data string) cid.Cid {
+	mh, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cid.NewCidV1(cid.Raw, mh)
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New()
+	h1, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := mn.GenPeer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	rt := &fakeRouting{err: errors.New("not called"), values: make(map[string]string)}
+	q, err := New(ctx, d, rt, h1.Network())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := q.Routing()
+
+	// not connected, the records are queued without being put
+	c := testCid(t, "c")
+	for _, err := range []error{
+		r.PutValue(ctx, "/ipns/a", []byte("a1")),
+		r.PutValue(ctx, "/ipns/a", []byte("a2")),
+		r.Provide(ctx, c, true),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Provide(ctx, c, false); err == nil || err.Error() != "not called" {
+		t.Fatalf("expected the provide not announced to pass through, got %v", err)
+	}
+	if st := q.Stat(); st.Records != 1 || st.Provides != 1 || st.Oldest.IsZero() {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+
+	// connected, the records are queued when the routing finds no peer
+	if _, err := mn.ConnectPeers(h1.ID(), h2.ID()); err != nil {
+		t.Fatal(err)
+	}
+	rt.err = fmt.Errorf("put failed: %w", kb.ErrLookupFailure)
+	if err := r.PutValue(ctx, "/ipns/b", []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	rt.err = errors.New("invalid record")
+	if err := r.PutValue(ctx, "/ipns/c", []byte("c")); err != rt.err {
+		t.Fatalf("expected the error returned, got %v", err)
+	}
+	if st := q.Stat(); st.Records != 2 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the queue persists
+	q, err = New(ctx, d, rt, h1.Network())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if st := q.Stat(); st.Records != 2 || st.Provides != 1 {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+
+	if err := q.Flush(ctx); err != rt.err {
+		t.Fatalf("expected the flush to fail with %v, got %v", rt.err, err)
+	}
+	if st := q.Stat(); st.Records != 2 || st.Provides != 1 || st.LastError != rt.err.Error() || st.LastFlush.IsZero() {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+
+	rt.err = nil
+	if err := q.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if rt.values["/ipns/a"] != "a2" || rt.values["/ipns/b"] != "b" || len(rt.provides) != 1 || !rt.provides[0].Equals(c) {
+		t.Fatalf("unexpected publishes %v %v", rt.values, rt.provides)
+	}
+	if st := q.Stat(); st.Records != 0 || st.Provides != 0 || !st.Oldest.IsZero() || st.LastError != "" {
+		t.Fatalf("unexpected stat %+v", st)
+	}
+}
@@ -0,0 +1,254 @@
+// Package pubsubhistory keeps the recent messages of pubsub topics, so that
+// the subscribers that were away get them replayed when they subscribe again.
+//
+// The node subscribes to the topics whose history is kept for as long as it
+// runs, and persists their last messages in the datastore, so that they are
+// kept across restarts. The messages of a topic beyond its size, or older
+// than its TTL, are dropped.
+package pubsubhistory
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+var log = logging.Logger("pubsubhistory")
+
+// historyKey is the datastore key under which the messages are persisted, by
+// topic and sequence number.
+var historyKey = ds.NewKey("/local/pubsub/history")
+
+var topicEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Message is a message kept.
+type Message struct {
+	From     peer.ID
+	Data     []byte
+	Seqno    []byte
+	Received time.Time
+}
+
+// ID is the ID of the message in pubsub, telling it apart from the other
+// messages of its topic.
+func (m *Message) ID() string {
+	return string(m.From) + string(m.Seqno)
+}
+
+// entry is a message kept, in memory.
+type entry struct {
+	seq      uint64
+	received time.Time
+}
+
+// topicHistory is the history of a topic.
+type topicHistory struct {
+	key     ds.Key
+	entries []entry
+	next    uint64
+}
+
+// History keeps the last messages of its topics.
+type History struct {
+	ds   ds.Datastore
+	size int
+	ttl  time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	topics map[string]*topicHistory
+}
+
+// New returns the history of topics, keeping up to size messages of each for
+// ttl, in d. It subscribes to topics with ps until Close is called.
+func New(ps *pubsub.PubSub, d ds.Datastore, topics []string, size int, ttl time.Duration) (*History, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid history size %d", size)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &History{
+		ds:     d,
+		size:   size,
+		ttl:    ttl,
+		ctx:    ctx,
+		cancel: cancel,
+		topics: make(map[string]*topicHistory),
+	}
+	for _, topic := range topics {
+		if _, ok := h.topics[topic]; ok {
+			continue
+		}
+		th, err := h.load(topic)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		h.topics[topic] = th
+	}
+	// subscribed once all loaded, the messages are recorded as they come
+	for topic := range h.topics {
+		sub, err := ps.Subscribe(topic)
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		h.wg.Add(1)
+		go h.record(topic, sub)
+	}
+	return h, nil
+}
+
+// load loads the entries of topic persisted.
+func (h *History) load(topic string) (*topicHistory, error) {
+	th := &topicHistory{key: historyKey.ChildString(topicEncoding.EncodeToString([]byte(topic)))}
+	res, err := h.ds.Query(h.ctx, dsq.Query{Prefix: th.key.String()})
+	if err != nil {
+		return nil, err
+	}
+	all, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range all {
+		seq, err := strconv.ParseUint(ds.RawKey(e.Key).BaseNamespace(), 16, 64)
+		if err != nil {
+			log.Errorf("invalid history key %s: %s", e.Key, err)
+			continue
+		}
+		var m Message
+		if err := json.Unmarshal(e.Value, &m); err != nil {
+			log.Errorf("invalid history message %s: %s", e.Key, err)
+			continue
+		}
+		th.entries = append(th.entries, entry{seq: seq, received: m.Received})
+	}
+	sort.Slice(th.entries, func(i, j int) bool {
+		return th.entries[i].seq < th.entries[j].seq
+	})
+	if n := len(th.entries); n > 0 {
+		th.next = th.entries[n-1].seq + 1
+	}
+	return th, nil
+}
+
+func (th *topicHistory) seqKey(seq uint64) ds.Key {
+	return th.key.ChildString(fmt.Sprintf("%016x", seq))
+}
+
+// record records the messages of topic received by sub.
+func (h *History) record(topic string, sub *pubsub.Subscription) {
+	defer h.wg.Done()
+	defer sub.Cancel()
+	for {
+		msg, err := sub.Next(h.ctx)
+		if err != nil {
+			return
+		}
+		m := &Message{
+			From:     msg.GetFrom(),
+			Data:     msg.Data,
+			Seqno:    msg.Seqno,
+			Received: time.Now(),
+		}
+		if err := h.add(topic, m); err != nil {
+			log.Errorf("keeping a message of %q: %s", topic, err)
+		}
+	}
+}
+
+// add adds m to the history of topic, dropping the messages beyond.
+func (h *History) add(topic string, m *Message) error {
+	val, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th := h.topics[topic]
+	seq := th.next
+	if err := h.ds.Put(h.ctx, th.seqKey(seq), val); err != nil {
+		return err
+	}
+	th.next++
+	th.entries = append(th.entries, entry{seq: seq, received: m.Received})
+	return h.prune(th, m.Received)
+}
+
+// prune drops the entries of th beyond the size and the TTL at now. The
+// caller holds mu.
+func (h *History) prune(th *topicHistory, now time.Time) error {
+	drop := len(th.entries) - h.size
+	if drop < 0 {
+		drop = 0
+	}
+	for drop < len(th.entries) && h.ttl > 0 && now.Sub(th.entries[drop].received) > h.ttl {
+		drop++
+	}
+	for _, e := range th.entries[:drop] {
+		if err := h.ds.Delete(h.ctx, th.seqKey(e.seq)); err != nil {
+			return err
+		}
+	}
+	th.entries = th.entries[drop:]
+	return nil
+}
+
+// Keeps reports whether the history of topic is kept.
+func (h *History) Keeps(topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, ok := h.topics[topic]
+	return ok
+}
+
+// Last returns the last n messages of topic kept, oldest first.
+func (h *History) Last(ctx context.Context, topic string, n int) ([]*Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th, ok := h.topics[topic]
+	if !ok {
+		return nil, fmt.Errorf("the history of %q is not kept", topic)
+	}
+	if err := h.prune(th, time.Now()); err != nil {
+		return nil, err
+	}
+	entries := th.entries
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	msgs := make([]*Message, 0, len(entries))
+	for _, e := range entries {
+		val, err := h.ds.Get(ctx, th.seqKey(e.seq))
+		if err != nil {
+			return nil, err
+		}
+		m := new(Message)
+		if err := json.Unmarshal(val, m); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// Close stops keeping the messages.
+func (h *History) Close() error {
+	h.cancel()
+	h.wg.Wait()
+	return nil
+}
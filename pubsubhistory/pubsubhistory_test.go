@@ -0,0 +1,126 @@
+package pubsubhistory
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"testing"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	crypto "github.com/libp2p/go-libp2p-core/crypto"
+	host "github.com/libp2p/go-libp2p-core/host"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func lastData(t *testing.T, h *History, topic string, n int) []string {
+	t.Helper()
+	msgs, err := h.Last(context.Background(), topic, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data []string
+	for _, m := range msgs {
+		data = append(data, string(m.Data))
+	}
+	return data
+}
+
+func checkData(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("expected the messages %v, got %v", want, got)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// pubsub messages are signed, which the bogus keys of mocknet can't do
+	mn := mocknet.New()
+	newHost := func() host.Host {
+		t.Helper()
+		sk, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := mn.AddPeer(sk, ma.StringCast("/ip4/127.0.0.1/tcp/4001"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	h1, h2 := newHost(), newHost()
+	if err := mn.LinkAll(); err != nil {
+		t.Fatal(err)
+	}
+	ps1, err := pubsub.NewFloodSub(ctx, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps2, err := pubsub.NewFloodSub(ctx, h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	h, err := New(ps1, d, []string{"kept"}, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !h.Keeps("kept") || h.Keeps("other") {
+		t.Fatal("expected the history of kept only")
+	}
+	if _, err := h.Last(ctx, "other", 1); err == nil {
+		t.Fatal("expected the history of other not to be kept")
+	}
+
+	top, err := ps2.Join("kept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mn.ConnectAllButSelf(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(top.ListPeers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the peers never joined the topic")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 1; i <= 4; i++ {
+		if err := top.Publish(ctx, []byte(fmt.Sprint("m", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for len(lastData(t, h, "kept", 3)) < 3 || lastData(t, h, "kept", 1)[0] != "m4" {
+		if time.Now().After(deadline) {
+			t.Fatalf("the messages were not kept, got %v", lastData(t, h, "kept", 3))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// beyond the size, the first message is dropped
+	checkData(t, lastData(t, h, "kept", 10), "m2", "m3", "m4")
+	checkData(t, lastData(t, h, "kept", 2), "m3", "m4")
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// persisted across restarts, expiring with the TTL
+	h, err = New(ps1, d, []string{"kept"}, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkData(t, lastData(t, h, "kept", 10), "m2", "m3", "m4")
+	h.ttl = time.Nanosecond
+	checkData(t, lastData(t, h, "kept", 10))
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,108 @@
+package remotesign
+
+import (
+	"errors"
+	"sort"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// ErrRemoteKey is returned when a remote key is to be changed in the
+// keystore, as it is configured instead.
+var ErrRemoteKey = errors.New("the key is signed remotely: it is not stored in the keystore")
+
+// Keystore adds the remote keys to a keystore: they are read as its keys, the
+// Signer of a key being its private key, but are not written to it.
+type Keystore struct {
+	ks      keystore.Keystore
+	signers map[string]*Signer
+}
+
+var _ keystore.Keystore = (*Keystore)(nil)
+
+// NewKeystore returns the keystore adding the keys signed by signers, by
+// name, to ks. The remote keys shadow the keys of ks of the same name.
+func NewKeystore(ks keystore.Keystore, signers map[string]*Signer) *Keystore {
+	return &Keystore{ks: ks, signers: signers}
+}
+
+// Unwrap returns the keystore the remote keys are added to.
+func (k *Keystore) Unwrap() keystore.Keystore {
+	return k.ks
+}
+
+// Has returns whether or not a key exists in the Keystore
+func (k *Keystore) Has(name string) (bool, error) {
+	if _, ok := k.signers[name]; ok {
+		return true, nil
+	}
+	return k.ks.Has(name)
+}
+
+// Put stores a key in the Keystore, if a key with the same name does not
+// already exist.
+func (k *Keystore) Put(name string, sk ci.PrivKey) error {
+	if _, ok := k.signers[name]; ok {
+		return keystore.ErrKeyExists
+	}
+	if _, ok := sk.(*Signer); ok {
+		return ErrRemoteKey
+	}
+	return k.ks.Put(name, sk)
+}
+
+// Get retrieves a key from the Keystore if it exists, and returns
+// ErrNoSuchKey otherwise.
+func (k *Keystore) Get(name string) (ci.PrivKey, error) {
+	if s, ok := k.signers[name]; ok {
+		return s, nil
+	}
+	return k.ks.Get(name)
+}
+
+// PublicKey returns the public key of the key name, read by the keystore
+// while it is locked when it can.
+func (k *Keystore) PublicKey(name string) (ci.PubKey, error) {
+	if s, ok := k.signers[name]; ok {
+		return s.GetPublic(), nil
+	}
+	if r, ok := k.ks.(interface {
+		PublicKey(name string) (ci.PubKey, error)
+	}); ok {
+		return r.PublicKey(name)
+	}
+	sk, err := k.ks.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return sk.GetPublic(), nil
+}
+
+// Delete removes a key from the Keystore
+func (k *Keystore) Delete(name string) error {
+	if _, ok := k.signers[name]; ok {
+		return ErrRemoteKey
+	}
+	return k.ks.Delete(name)
+}
+
+// List returns a list of key identifier
+func (k *Keystore) List() ([]string, error) {
+	names, err := k.ks.List()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(names)+len(k.signers))
+	for _, name := range names {
+		if _, ok := k.signers[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	remote := make([]string, 0, len(k.signers))
+	for name := range k.signers {
+		remote = append(remote, name)
+	}
+	sort.Strings(remote)
+	return append(out, remote...), nil
+}
@@ -0,0 +1,207 @@
+// Package remotesign delegates the signing of the IPNS records of a key to a
+// remote signer, such as a KMS or an HSM fronted by a small HTTP service, so
+// that the private key is not kept by the node.
+//
+// The signer is sent a POST request with a JSON body holding the peer ID of
+// the key and the base64 encoded data to sign:
+//
+//	{"Key": "12D3KooW...", "Data": "..."}
+//
+// and answers with a 200 response with the base64 encoded signature:
+//
+//	{"Signature": "..."}
+//
+// The signatures are checked against the public key of the key before they
+// are used.
+package remotesign
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	pb "github.com/libp2p/go-libp2p-core/crypto/pb"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var signs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "ipfs_remotesign_signatures_total",
+	Help: "signatures asked to the remote signers, by result: ok or failed",
+}, []string{"result"})
+
+// maxResponseSize is the largest response read from the signer.
+const maxResponseSize = 64 << 10
+
+// ErrNoKeyMaterial is returned when the private key of a remote key is asked
+// for, as it is only known to the signer.
+var ErrNoKeyMaterial = errors.New("the private key is kept by the remote signer")
+
+// Settings configures the signer of a key.
+type Settings struct {
+	// URL is the http or https URL the data to sign is posted to.
+	URL string
+	// Header is sent with the requests, such as the credentials of the node.
+	Header http.Header
+	// Timeout is how long the signer may take to answer.
+	Timeout time.Duration
+	// PublicKey is the public key of the key, the signatures are checked
+	// against.
+	PublicKey ci.PubKey
+}
+
+// SignRequest is the body of the requests to the signer.
+type SignRequest struct {
+	// Key is the peer ID of the key signing.
+	Key string
+	// Data is the data to sign.
+	Data []byte
+}
+
+// SignResponse is the body of the responses of the signer.
+type SignResponse struct {
+	Signature []byte
+}
+
+// Signer is a private key whose signatures are made by the remote signer. It
+// implements crypto.PrivKey, except for Raw, and is used to publish IPNS
+// records as the keys of the keystore are.
+type Signer struct {
+	s      Settings
+	id     peer.ID
+	client *http.Client
+}
+
+var _ ci.PrivKey = (*Signer)(nil)
+
+// New returns the signer of s.
+func New(s Settings) (*Signer, error) {
+	if s.Timeout <= 0 {
+		return nil, fmt.Errorf("signing timeout must be positive: %s", s.Timeout)
+	}
+	if s.PublicKey == nil {
+		return nil, errors.New("no public key given")
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signer URL %q: %w", s.URL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid signer URL %q: not an http or https URL", s.URL)
+	}
+	id, err := peer.IDFromPublicKey(s.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{s: s, id: id, client: &http.Client{Timeout: s.Timeout}}, nil
+}
+
+// ParsePublicKey parses the public key of a remote key: a peer ID embedding
+// its public key, as the ones of ed25519 keys do, or a base64 encoded public
+// key protobuf.
+func ParsePublicKey(s string) (ci.PubKey, error) {
+	if id, err := peer.Decode(s); err == nil {
+		pk, err := id.ExtractPublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("peer ID %s does not embed its public key: give the base64 encoded public key", s)
+		}
+		return pk, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %q: neither a peer ID nor base64", s)
+	}
+	return ci.UnmarshalPublicKey(data)
+}
+
+// ID returns the peer ID of the key.
+func (s *Signer) ID() peer.ID {
+	return s.id
+}
+
+// Sign has the remote signer sign data.
+func (s *Signer) Sign(data []byte) ([]byte, error) {
+	sig, err := s.sign(context.Background(), data)
+	if err != nil {
+		signs.WithLabelValues("failed").Inc()
+		return nil, fmt.Errorf("remote signing with key %s: %w", s.id, err)
+	}
+	signs.WithLabelValues("ok").Inc()
+	return sig, nil
+}
+
+func (s *Signer) sign(ctx context.Context, data []byte) ([]byte, error) {
+	body, err := json.Marshal(&SignRequest{Key: s.id.String(), Data: data})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		msg := strings.TrimSpace(string(resBody))
+		if msg == "" {
+			return nil, fmt.Errorf("unexpected response from the signer: %s", res.Status)
+		}
+		return nil, fmt.Errorf("unexpected response from the signer: %s: %s", res.Status, msg)
+	}
+
+	var out SignResponse
+	if err := json.Unmarshal(resBody, &out); err != nil {
+		return nil, fmt.Errorf("invalid response from the signer: %w", err)
+	}
+	// a wrong signature would only be noticed by the peers resolving the
+	// record
+	ok, err := s.s.PublicKey.Verify(data, out.Signature)
+	if err != nil || !ok {
+		return nil, errors.New("invalid signature from the signer")
+	}
+	return out.Signature, nil
+}
+
+// GetPublic returns the public key of the key.
+func (s *Signer) GetPublic() ci.PubKey {
+	return s.s.PublicKey
+}
+
+// Raw returns ErrNoKeyMaterial: the private key is kept by the signer.
+func (s *Signer) Raw() ([]byte, error) {
+	return nil, ErrNoKeyMaterial
+}
+
+// Type returns the type of the key.
+func (s *Signer) Type() pb.KeyType {
+	return s.s.PublicKey.Type()
+}
+
+// Equals tells whether k is a signer of the same key.
+func (s *Signer) Equals(k ci.Key) bool {
+	o, ok := k.(*Signer)
+	return ok && s.s.PublicKey.Equals(o.s.PublicKey)
+}
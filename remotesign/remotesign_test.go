@@ -0,0 +1,168 @@
+package remotesign
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	ipns "github.com/ipfs/go-ipns"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// signerServer serves a signer signing with sk, after running check.
+func signerServer(t *testing.T, sk ci.PrivKey, check func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			http.Error(w, "who are you?", http.StatusUnauthorized)
+			return
+		}
+		var req SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if id, _ := peer.IDFromPrivateKey(sk); req.Key != id.String() {
+			http.Error(w, "unknown key", http.StatusNotFound)
+			return
+		}
+		if check != nil && !check(w, r) {
+			return
+		}
+		sig, err := sk.Sign(req.Data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&SignResponse{Signature: sig})
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newSigner(t *testing.T, u string, pk ci.PubKey) *Signer {
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer key")
+	s, err := New(Settings{URL: u, Header: header, Timeout: 5 * time.Second, PublicKey: pk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParsePublicKey(t *testing.T) {
+	_, pk, err := ci.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := peer.IDFromPublicKey(pk)
+	data, _ := ci.MarshalPublicKey(pk)
+	for _, s := range []string{id.String(), base64.StdEncoding.EncodeToString(data)} {
+		got, err := ParsePublicKey(s)
+		if err != nil || !got.Equals(pk) {
+			t.Errorf("expected %s parsed, got %v", s, err)
+		}
+	}
+	if _, err := ParsePublicKey("QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N"); err == nil {
+		t.Error("expected a hashed peer ID to fail")
+	}
+}
+
+func TestSign(t *testing.T) {
+	sk, pk, err := ci.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newSigner(t, signerServer(t, sk, nil).URL, pk)
+
+	if id, _ := peer.IDFromPrivateKey(s); id != s.ID() {
+		t.Fatalf("expected the peer ID of the key, got %s", id)
+	}
+	if _, err := s.Raw(); err != ErrNoKeyMaterial {
+		t.Fatalf("expected ErrNoKeyMaterial, got %v", err)
+	}
+
+	// the records signed remotely are valid
+	entry, err := ipns.Create(s, []byte("/ipfs/QmYyQSo1c1Ym7orWxLYvCrM2EmxFTANf8wXmmE7DWjhx5N"), 1, time.Now().Add(time.Hour), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ipns.Validate(pk, entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// a signature of another key is refused
+	other, _, _ := ci.GenerateEd25519Key(nil)
+	id, _ := peer.IDFromPrivateKey(sk)
+	ts := signerServer(t, sk, func(w http.ResponseWriter, r *http.Request) bool {
+		sig, _ := other.Sign([]byte("data"))
+		json.NewEncoder(w).Encode(&SignResponse{Signature: sig})
+		return false
+	})
+	if _, err := newSigner(t, ts.URL, pk).Sign([]byte("data")); err == nil {
+		t.Fatal("expected the wrong signature refused")
+	}
+
+	// the errors of the signer are returned
+	if _, err := newSigner(t, signerServer(t, other, nil).URL, pk).Sign([]byte("data")); err == nil {
+		t.Fatalf("expected key %s unknown to the signer", id)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, pk, _ := ci.GenerateEd25519Key(nil)
+	for _, s := range []Settings{
+		{URL: "ftp://signer.example.net", Timeout: time.Second, PublicKey: pk},
+		{URL: "http://signer.example.net", PublicKey: pk},
+		{URL: "http://signer.example.net", Timeout: time.Second},
+	} {
+		if _, err := New(s); err == nil {
+			t.Errorf("expected %+v to fail", s)
+		}
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	local, _, _ := ci.GenerateEd25519Key(nil)
+	_, pk, _ := ci.GenerateEd25519Key(nil)
+	mem := keystore.NewMemKeystore()
+	if err := mem.Put("local", local); err != nil {
+		t.Fatal(err)
+	}
+	remote := newSigner(t, "http://signer.example.net", pk)
+	ks := NewKeystore(mem, map[string]*Signer{"remote": remote})
+
+	names, err := ks.List()
+	if err != nil || len(names) != 2 || names[0] != "local" || names[1] != "remote" {
+		t.Fatalf("unexpected keys %v, %v", names, err)
+	}
+	if sk, err := ks.Get("remote"); err != nil || sk != remote {
+		t.Fatalf("expected the signer, got %v", err)
+	}
+	if got, err := ks.PublicKey("remote"); err != nil || !got.Equals(pk) {
+		t.Fatalf("expected the public key of the signer, got %v", err)
+	}
+	if has, _ := ks.Has("remote"); !has {
+		t.Fatal("expected the remote key")
+	}
+	if err := ks.Put("remote", local); err != keystore.ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if err := ks.Put("moved", remote); !errors.Is(err, ErrRemoteKey) {
+		t.Fatalf("expected ErrRemoteKey, got %v", err)
+	}
+	if err := ks.Delete("remote"); !errors.Is(err, ErrRemoteKey) {
+		t.Fatalf("expected ErrRemoteKey, got %v", err)
+	}
+	if err := ks.Delete("local"); err != nil {
+		t.Fatal(err)
+	}
+	if ks.Unwrap() != mem {
+		t.Fatal("expected the keystore unwrapped")
+	}
+}
@@ -0,0 +1,339 @@
+// Package compressds compresses the values of a datastore.
+//
+// Each value is stored behind a header: the format it is stored in, and its
+// size once decompressed, which GetSize reads without decompressing the
+// value. The values which don't shrink when compressed, such as the blocks
+// of media files, are stored as they are behind the header.
+package compressds
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// The algorithms the values can be compressed with.
+const (
+	Zstd = "zstd"
+	LZ4  = "lz4"
+)
+
+// The formats the values are stored in, first byte of their header.
+const (
+	formatNone byte = iota
+	formatZstd
+	formatLZ4
+)
+
+// Algorithms are the algorithms the values can be compressed with.
+var Algorithms = []string{Zstd, LZ4}
+
+// Stat is the size of the entries of a datastore, as stored and once
+// decompressed.
+type Stat struct {
+	Algorithm string
+	// Entries is the number of entries, of which Compressed are stored
+	// compressed, and the others as they are
+	Entries    uint64
+	Compressed uint64
+	// LogicalSize is the size of the values, PhysicalSize their size as
+	// stored, headers included
+	LogicalSize  uint64
+	PhysicalSize uint64
+}
+
+// Datastore compresses the values of the datastore it wraps.
+type Datastore struct {
+	child     ds.Batching
+	algorithm string
+	format    byte
+	zenc      *zstd.Encoder
+	zdec      *zstd.Decoder
+}
+
+var (
+	_ ds.Batching            = (*Datastore)(nil)
+	_ ds.PersistentDatastore = (*Datastore)(nil)
+	_ ds.GCDatastore         = (*Datastore)(nil)
+	_ ds.CheckedDatastore    = (*Datastore)(nil)
+	_ ds.Shim                = (*Datastore)(nil)
+)
+
+// Check returns an error if the values can't be compressed with algorithm
+// at level, 0 being its default level.
+func Check(algorithm string, level int) error {
+	switch algorithm {
+	case Zstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("invalid zstd level %d, expected from 1 to 22", level)
+		}
+	case LZ4:
+		if level != 0 {
+			return fmt.Errorf("%s has no compression levels", algorithm)
+		}
+	default:
+		return fmt.Errorf("unknown compression algorithm %q, expected one of %v", algorithm, Algorithms)
+	}
+	return nil
+}
+
+// New returns a datastore compressing the values of child with algorithm, at
+// level if it has levels, or at its default level if level is 0. The values
+// stored with another algorithm, or not compressed, are still read.
+func New(child ds.Batching, algorithm string, level int) (*Datastore, error) {
+	if err := Check(algorithm, level); err != nil {
+		return nil, err
+	}
+	d := &Datastore{child: child, algorithm: algorithm, format: formatZstd}
+	if algorithm == LZ4 {
+		d.format = formatLZ4
+	}
+
+	zlevel := zstd.SpeedDefault
+	if level != 0 {
+		zlevel = zstd.EncoderLevelFromZstd(level)
+	}
+	var err error
+	d.zenc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zlevel))
+	if err != nil {
+		return nil, err
+	}
+	d.zdec, err = zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Algorithm returns the algorithm the values are compressed with.
+func (d *Datastore) Algorithm() string {
+	return d.algorithm
+}
+
+// compress returns v behind its header, compressed if it shrinks.
+func (d *Datastore) compress(v []byte) []byte {
+	header := make([]byte, 1+binary.MaxVarintLen64)
+	header[0] = d.format
+	n := 1 + binary.PutUvarint(header[1:], uint64(len(v)))
+	header = header[:n]
+
+	switch d.format {
+	case formatZstd:
+		out := d.zenc.EncodeAll(v, header)
+		if len(out) < n+len(v) {
+			return out
+		}
+	case formatLZ4:
+		out := make([]byte, n+lz4.CompressBlockBound(len(v)))
+		copy(out, header)
+		// 0 is returned for the values which don't shrink
+		if c, err := lz4.CompressBlock(v, out[n:], nil); err == nil && c > 0 && c < len(v) {
+			return out[:n+c]
+		}
+	}
+	header[0] = formatNone
+	return append(header, v...)
+}
+
+// readHeader returns the format and size of the value stored as v, and the
+// offset of its content.
+func readHeader(v []byte) (format byte, size uint64, offset int, err error) {
+	if len(v) == 0 {
+		return 0, 0, 0, errors.New("missing header")
+	}
+	size, n := binary.Uvarint(v[1:])
+	if n <= 0 {
+		return 0, 0, 0, errors.New("invalid header")
+	}
+	return v[0], size, 1 + n, nil
+}
+
+// decompress returns the value stored as v under k.
+func (d *Datastore) decompress(k ds.Key, v []byte) ([]byte, error) {
+	format, size, offset, err := readHeader(v)
+	if err != nil {
+		return nil, fmt.Errorf("compressds: %s: %w", k, err)
+	}
+	content := v[offset:]
+	switch format {
+	case formatNone:
+		return content, nil
+	case formatZstd:
+		out, err := d.zdec.DecodeAll(content, make([]byte, 0, size))
+		if err == nil && uint64(len(out)) != size {
+			err = fmt.Errorf("expected %d bytes, got %d", size, len(out))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("compressds: %s: %w", k, err)
+		}
+		return out, nil
+	case formatLZ4:
+		out := make([]byte, size)
+		n, err := lz4.UncompressBlock(content, out)
+		if err == nil && uint64(n) != size {
+			err = fmt.Errorf("expected %d bytes, got %d", size, n)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("compressds: %s: %w", k, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("compressds: %s: unknown format %d", k, format)
+	}
+}
+
+func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
+	v, err := d.child.Get(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	return d.decompress(k, v)
+}
+
+func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
+	return d.child.Has(ctx, k)
+}
+
+// GetSize returns the size of the value of k once decompressed, read from
+// its header.
+func (d *Datastore) GetSize(ctx context.Context, k ds.Key) (int, error) {
+	v, err := d.child.Get(ctx, k)
+	if err != nil {
+		return -1, err
+	}
+	_, size, _, err := readHeader(v)
+	if err != nil {
+		return -1, fmt.Errorf("compressds: %s: %w", k, err)
+	}
+	return int(size), nil
+}
+
+func (d *Datastore) Put(ctx context.Context, k ds.Key, v []byte) error {
+	return d.child.Put(ctx, k, d.compress(v))
+}
+
+func (d *Datastore) Delete(ctx context.Context, k ds.Key) error {
+	return d.child.Delete(ctx, k)
+}
+
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	return d.child.Sync(ctx, prefix)
+}
+
+// Query lists the entries with their values decompressed, and their sizes
+// once decompressed. The filters, orders, offset and limit of q apply to
+// them.
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	// the values are read for their size
+	naive := dsq.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly && !q.ReturnsSizes}
+	res, err := d.child.Query(ctx, naive)
+	if err != nil {
+		return nil, err
+	}
+	out := dsq.ResultsFromIterator(naive, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			r, ok := res.NextSync()
+			if !ok || r.Error != nil || naive.KeysOnly {
+				return r, ok
+			}
+			if q.KeysOnly {
+				_, size, _, err := readHeader(r.Value)
+				if err != nil {
+					return dsq.Result{Error: fmt.Errorf("compressds: %s: %w", r.Key, err)}, true
+				}
+				r.Value, r.Size = nil, int(size)
+				return r, true
+			}
+			v, err := d.decompress(ds.RawKey(r.Key), r.Value)
+			if err != nil {
+				return dsq.Result{Error: err}, true
+			}
+			r.Value, r.Size = v, len(v)
+			return r, true
+		},
+		Close: res.Close,
+	})
+	return dsq.NaiveQueryApply(q, out), nil
+}
+
+// Batch returns a batch compressing the values put.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	b, err := d.child.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &batch{d: d, Batch: b}, nil
+}
+
+// DiskUsage returns the disk usage of the datastore wrapped, the values
+// compressed.
+func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	return ds.DiskUsage(ctx, d.child)
+}
+
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	if gds, ok := d.child.(ds.GCDatastore); ok {
+		return gds.CollectGarbage(ctx)
+	}
+	return nil
+}
+
+func (d *Datastore) Check(ctx context.Context) error {
+	if cds, ok := d.child.(ds.CheckedDatastore); ok {
+		return cds.Check(ctx)
+	}
+	return nil
+}
+
+// Children returns the datastore wrapped.
+func (d *Datastore) Children() []ds.Datastore {
+	return []ds.Datastore{d.child}
+}
+
+// Stat reads the headers of all the entries, and returns their size as
+// stored and once decompressed.
+func (d *Datastore) Stat(ctx context.Context) (Stat, error) {
+	st := Stat{Algorithm: d.algorithm}
+	res, err := d.child.Query(ctx, dsq.Query{})
+	if err != nil {
+		return st, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return st, r.Error
+		}
+		format, size, _, err := readHeader(r.Value)
+		if err != nil {
+			return st, fmt.Errorf("compressds: %s: %w", r.Key, err)
+		}
+		st.Entries++
+		if format != formatNone {
+			st.Compressed++
+		}
+		st.LogicalSize += size
+		st.PhysicalSize += uint64(len(r.Value))
+	}
+	return st, ctx.Err()
+}
+
+func (d *Datastore) Close() error {
+	d.zenc.Close()
+	d.zdec.Close()
+	return d.child.Close()
+}
+
+type batch struct {
+	d *Datastore
+	ds.Batch
+}
+
+func (b *batch) Put(ctx context.Context, k ds.Key, v []byte) error {
+	return b.Batch.Put(ctx, k, b.d.compress(v))
+}
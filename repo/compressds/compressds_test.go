@@ -0,0 +1,158 @@
+package compressds
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func newDatastore(t *testing.T, child ds.Batching, algorithm string) *Datastore {
+	t.Helper()
+	d, err := New(child, algorithm, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	text := bytes.Repeat([]byte("text compresses well, "), 100)
+	random := make([]byte, 2048)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			child := dssync.MutexWrap(ds.NewMapDatastore())
+			d := newDatastore(t, child, algorithm)
+			values := map[string][]byte{"/text": text, "/random": random, "/empty": {}}
+			for k, v := range values {
+				if err := d.Put(ctx, ds.NewKey(k), v); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for k, v := range values {
+				got, err := d.Get(ctx, ds.NewKey(k))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, v) {
+					t.Fatalf("%s: got back %d different bytes", k, len(got))
+				}
+				size, err := d.GetSize(ctx, ds.NewKey(k))
+				if err != nil || size != len(v) {
+					t.Fatalf("%s: expected size %d, got %d, %v", k, len(v), size, err)
+				}
+			}
+
+			stored, _ := child.Get(ctx, ds.NewKey("/text"))
+			if len(stored) >= len(text)/4 {
+				t.Fatalf("expected the text compressed, stored %d bytes of %d", len(stored), len(text))
+			}
+			stored, _ = child.Get(ctx, ds.NewKey("/random"))
+			if stored[0] != formatNone {
+				t.Fatal("expected the random bytes stored as they are")
+			}
+
+			st, err := d.Stat(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if st.Entries != 3 || st.Compressed != 1 || st.LogicalSize != uint64(len(text)+len(random)) || st.PhysicalSize >= st.LogicalSize {
+				t.Fatalf("unexpected stat %+v", st)
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	d := newDatastore(t, dssync.MutexWrap(ds.NewMapDatastore()), Zstd)
+	text := bytes.Repeat([]byte("a"), 1000)
+	for _, k := range []string{"/a/1", "/a/2", "/b/1"} {
+		if err := d.Put(ctx, ds.NewKey(k), text); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := d.Query(ctx, dsq.Query{Prefix: "/a", KeysOnly: true, ReturnsSizes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	for _, e := range entries {
+		if e.Size != len(text) || e.Value != nil {
+			t.Fatalf("%s: expected the size %d without value, got %d", e.Key, len(text), e.Size)
+		}
+	}
+
+	res, err = d.Query(ctx, dsq.Query{Prefix: "/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || !bytes.Equal(entries[0].Value, text) {
+		t.Fatal("expected the value decompressed")
+	}
+}
+
+func TestOtherAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	text := bytes.Repeat([]byte("b"), 1000)
+
+	b, err := newDatastore(t, child, LZ4).Batch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Put(ctx, ds.NewKey("/k"), text); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// read back with zstd
+	got, err := newDatastore(t, child, Zstd).Get(ctx, ds.NewKey("/k"))
+	if err != nil || !bytes.Equal(got, text) {
+		t.Fatalf("expected the value stored with lz4 read back, got %v", err)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	child := dssync.MutexWrap(ds.NewMapDatastore())
+	if _, err := New(child, "gzip", 0); err == nil {
+		t.Fatal("expected an unknown algorithm refused")
+	}
+	if _, err := New(child, LZ4, 3); err == nil {
+		t.Fatal("expected a level refused for lz4")
+	}
+	if _, err := New(child, Zstd, 23); err == nil {
+		t.Fatal("expected an invalid zstd level refused")
+	}
+
+	ctx := context.Background()
+	if err := child.Put(ctx, ds.NewKey("/bad"), []byte{formatZstd, 10, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newDatastore(t, child, Zstd).Get(ctx, ds.NewKey("/bad")); err == nil {
+		t.Fatal("expected a corrupted value to fail")
+	}
+}
@@ -0,0 +1,50 @@
+package fsrepo
+
+import (
+	"strings"
+
+	ds "github.com/ipfs/go-datastore"
+)
+
+// fileDatastores adds to out the configs created from dsc whose datastores
+// store their values as is, in files, by the mountpoint they are under. The
+// datastores under the others, such as the compressed ones, are left out.
+func fileDatastores(dsc DatastoreConfig, mountpoint string, out map[string]FileDatastoreConfig) {
+	switch c := dsc.(type) {
+	case *mountDatastoreConfig:
+		for _, m := range c.mounts {
+			fileDatastores(m.ds, m.prefix.String(), out)
+		}
+	case *measureDatastoreConfig:
+		fileDatastores(c.child, mountpoint, out)
+	case *logDatastoreConfig:
+		fileDatastores(c.child, mountpoint, out)
+	case FileDatastoreConfig:
+		out[mountpoint] = c
+	}
+}
+
+// setBlockFiles records the config created from dsc, under mountpoint, of the
+// datastore storing the blocks in files, if any.
+func (r *FSRepo) setBlockFiles(dsc DatastoreConfig, mountpoint string) {
+	files := make(map[string]FileDatastoreConfig)
+	fileDatastores(dsc, mountpoint, files)
+
+	r.blockFilesMu.Lock()
+	defer r.blockFilesMu.Unlock()
+	r.blockFiles = files[blocksMountpoint.String()]
+}
+
+// BlockFile returns the file the block of key, a key of the datastore under
+// /blocks, is stored in as is, if the blocks are stored in files.
+func (r *FSRepo) BlockFile(key ds.Key) (string, bool) {
+	r.blockFilesMu.Lock()
+	fc := r.blockFiles
+	r.blockFilesMu.Unlock()
+
+	prefix := blocksMountpoint.String() + "/"
+	if fc == nil || !strings.HasPrefix(key.String(), prefix) {
+		return "", false
+	}
+	return fc.File(r.path, ds.NewKey(strings.TrimPrefix(key.String(), prefix)))
+}
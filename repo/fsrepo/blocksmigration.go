@@ -0,0 +1,292 @@
+package fsrepo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/mount"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/livemigrate"
+)
+
+// migrationFn is the file recording the config of the datastore the blocks
+// are being migrated to.
+const migrationFn = "datastore_migration"
+
+// blocksMountpoint is where the datastore migrated by MigrateBlocks is
+// mounted.
+var blocksMountpoint = ds.NewKey("/blocks")
+
+var errNoBlocksMount = fmt.Errorf("the datastore has no %s mount to migrate", blocksMountpoint)
+
+// createDatastore creates the datastore of dsc, with the datastore mounted at
+// /blocks, if any, ready to be migrated.
+func (r *FSRepo) createDatastore(dsc DatastoreConfig) (repo.Datastore, error) {
+	mc, ok := dsc.(*mountDatastoreConfig)
+	if !ok {
+		return createDatastore(dsc, r.path, r.readOnly)
+	}
+	mounts := make([]mount.Mount, len(mc.mounts))
+	for i, m := range mc.mounts {
+		d, err := createDatastore(m.ds, r.path, r.readOnly)
+		if err != nil {
+			return nil, err
+		}
+		if m.prefix == blocksMountpoint {
+			r.blocks = livemigrate.New(d)
+			d = r.blocks
+		}
+		mounts[i].Datastore = d
+		mounts[i].Prefix = m.prefix
+	}
+	return mount.New(mounts), nil
+}
+
+// MigrateBlocks moves the blocks to the datastore of spec, which replaces the
+// one mounted at /blocks, while the repo is in use. The blocks are written to
+// the new datastore from the start, and read from either until all the
+// blocks of the old one are copied, at the rate let through by l. It then
+// updates Datastore.Spec, and the old datastore is closed with the repo.
+// progress, if not nil, is called with the number of blocks copied so far.
+//
+// An interrupted migration goes on when the repo is opened again, and is
+// finished by calling MigrateBlocks with the same spec.
+func (r *FSRepo) MigrateBlocks(ctx context.Context, spec map[string]interface{}, l *iothrottle.Limiter, progress func(copied uint64)) error {
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
+	if r.blocks == nil {
+		return errNoBlocksMount
+	}
+	if !atomic.CompareAndSwapInt32(&r.migrating, 0, 1) {
+		return errors.New("the blocks are being migrated already")
+	}
+	defer atomic.StoreInt32(&r.migrating, 0)
+
+	tdsc, err := AnyDatastoreConfig(spec)
+	if err != nil {
+		return err
+	}
+	if r.blocks.Migrating() {
+		pending, err := r.readBlocksMigration()
+		if err != nil {
+			return err
+		}
+		pdsc, err := AnyDatastoreConfig(pending)
+		if err != nil {
+			return err
+		}
+		if pdsc.DiskSpec().String() != tdsc.DiskSpec().String() {
+			return fmt.Errorf("the blocks are being migrated to %s already, finish this migration first", pdsc.DiskSpec())
+		}
+	} else if err := r.startBlocksMigration(spec, tdsc); err != nil {
+		return err
+	}
+
+	if err := r.blocks.Copy(ctx, l, progress); err != nil {
+		return err
+	}
+	return r.cutoverBlocks(ctx, spec)
+}
+
+// startBlocksMigration starts the migration of the blocks to the datastore of
+// spec, configured by tdsc.
+func (r *FSRepo) startBlocksMigration(spec map[string]interface{}, tdsc DatastoreConfig) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	migrated, err := withBlocksMount(cfg.Datastore.Spec, spec)
+	if err != nil {
+		return err
+	}
+	mdsc, err := AnyDatastoreConfig(migrated)
+	if err != nil {
+		return err
+	}
+	onDisk, err := r.readSpec()
+	if err != nil {
+		return err
+	}
+	if mdsc.DiskSpec().String() == onDisk {
+		return errors.New("the blocks are in this datastore already")
+	}
+
+	to, err := tdsc.Create(r.path)
+	if err != nil {
+		return err
+	}
+	if err := r.writeBlocksMigration(spec); err != nil {
+		to.Close()
+		return err
+	}
+	r.setBlocksCompression(tdsc)
+	r.setBlockFiles(tdsc, blocksMountpoint.String())
+	return r.blocks.Start(to)
+}
+
+// cutoverBlocks switches to the datastore of spec alone, once all the blocks
+// are copied to it, and records it in the datastore spec and the config.
+func (r *FSRepo) cutoverBlocks(ctx context.Context, spec map[string]interface{}) error {
+	old, err := r.blocks.Cutover(ctx)
+	if err != nil {
+		return err
+	}
+
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	r.retired = append(r.retired, old)
+
+	migrated, err := withBlocksMount(r.config.Datastore.Spec, spec)
+	if err != nil {
+		return err
+	}
+	mdsc, err := AnyDatastoreConfig(migrated)
+	if err != nil {
+		return err
+	}
+	// the datastore spec goes first, for recoverBlocksMigration to tell
+	// that the cutover was done if interrupted
+	fn, err := config.Path(r.path, specFn)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fn, mdsc.DiskSpec().Bytes(), 0600); err != nil {
+		return err
+	}
+	if err := r.setConfigKey("Datastore.Spec", migrated); err != nil {
+		return err
+	}
+	return r.removeBlocksMigration()
+}
+
+// recoverBlocksMigration returns the config of the datastore the blocks are
+// being migrated to, target, or nil if the migration was done, in which case
+// it finishes the cutover if it was interrupted before the config was
+// updated. onDisk is the datastore spec on disk.
+func (r *FSRepo) recoverBlocksMigration(target map[string]interface{}, onDisk string) (map[string]interface{}, error) {
+	migrated, err := withBlocksMount(r.config.Datastore.Spec, target)
+	if err != nil {
+		return nil, err
+	}
+	mdsc, err := AnyDatastoreConfig(migrated)
+	if err != nil {
+		return nil, err
+	}
+	if mdsc.DiskSpec().String() != onDisk {
+		return target, nil
+	}
+	if err := r.setConfigKey("Datastore.Spec", migrated); err != nil {
+		return nil, err
+	}
+	return nil, r.removeBlocksMigration()
+}
+
+// resumeBlocksMigration starts again the migration of the blocks to the
+// datastore of target, interrupted when the repo was closed.
+func (r *FSRepo) resumeBlocksMigration(target map[string]interface{}) error {
+	if r.blocks == nil {
+		return errNoBlocksMount
+	}
+	tdsc, err := AnyDatastoreConfig(target)
+	if err != nil {
+		return fmt.Errorf("blocks migration: %w", err)
+	}
+	to, err := tdsc.Create(r.path)
+	if err != nil {
+		return fmt.Errorf("blocks migration: %w", err)
+	}
+	log.Warnf("the blocks are being migrated to %s, run 'ipfs repo migrate-to' again to finish", tdsc.DiskSpec())
+	r.setBlocksCompression(tdsc)
+	r.setBlockFiles(tdsc, blocksMountpoint.String())
+	return r.blocks.Start(to)
+}
+
+// withBlocksMount returns a copy of the datastore spec with the datastore
+// mounted at /blocks replaced by the one of blocks.
+func withBlocksMount(spec, blocks map[string]interface{}) (map[string]interface{}, error) {
+	mounts, ok := spec["mounts"].([]interface{})
+	if spec["type"] != "mount" || !ok {
+		return nil, errNoBlocksMount
+	}
+	out := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		out[k] = v
+	}
+	outMounts := make([]interface{}, len(mounts))
+	found := false
+	for i, m := range mounts {
+		outMounts[i] = m
+		if mm, ok := m.(map[string]interface{}); ok && mm["mountpoint"] == blocksMountpoint.String() {
+			bm := make(map[string]interface{}, len(blocks)+1)
+			for k, v := range blocks {
+				bm[k] = v
+			}
+			bm["mountpoint"] = blocksMountpoint.String()
+			outMounts[i] = bm
+			found = true
+		}
+	}
+	if !found {
+		return nil, errNoBlocksMount
+	}
+	out["mounts"] = outMounts
+	return out, nil
+}
+
+// readBlocksMigration returns the config of the datastore the blocks are
+// being migrated to, or nil if they are not.
+func (r *FSRepo) readBlocksMigration() (map[string]interface{}, error) {
+	return BlocksMigration(r.path)
+}
+
+// BlocksMigration returns the config of the datastore the blocks of the repo
+// at repoPath are being migrated to, or nil if they are not.
+func BlocksMigration(repoPath string) (map[string]interface{}, error) {
+	fn, err := config.Path(repoPath, migrationFn)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", migrationFn, err)
+	}
+	return spec, nil
+}
+
+func (r *FSRepo) writeBlocksMigration(spec map[string]interface{}) error {
+	fn, err := config.Path(r.path, migrationFn)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, b, 0600)
+}
+
+func (r *FSRepo) removeBlocksMigration() error {
+	fn, err := config.Path(r.path, migrationFn)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
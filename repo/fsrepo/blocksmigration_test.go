@@ -0,0 +1,164 @@
+package fsrepo_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+var leveldbBlocksSpec = map[string]interface{}{
+	"type":        "levelds",
+	"path":        "blocks-leveldb",
+	"compression": "none",
+}
+
+// testConfig returns a config with the default datastore, and a private key
+// for the config to be updated.
+func testConfig() *config.Config {
+	return &config.Config{
+		Identity:  config.Identity{PrivKey: "key"},
+		Datastore: config.DefaultDatastoreConfig(),
+	}
+}
+
+type migratingRepo interface {
+	repo.Repo
+	repo.BlocksMigrator
+}
+
+func openTestRepo(t *testing.T, path string) migratingRepo {
+	t.Helper()
+	r, err := fsrepo.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(migratingRepo)
+}
+
+func putBlocks(t *testing.T, r repo.Repo, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		k := ds.NewKey(fmt.Sprintf("/blocks/B%d", i))
+		if err := r.Datastore().Put(context.Background(), k, []byte(k.String())); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkBlocks(t *testing.T, r repo.Repo, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		k := ds.NewKey(fmt.Sprintf("/blocks/B%d", i))
+		v, err := r.Datastore().Get(context.Background(), k)
+		if err != nil {
+			t.Fatalf("getting %s: %s", k, err)
+		}
+		if string(v) != k.String() {
+			t.Fatalf("unexpected value of %s: %q", k, v)
+		}
+	}
+}
+
+func blocksMountType(t *testing.T, r repo.Repo) interface{} {
+	t.Helper()
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range cfg.Datastore.Spec["mounts"].([]interface{}) {
+		if m := m.(map[string]interface{}); m["mountpoint"] == "/blocks" {
+			return m["type"]
+		}
+	}
+	t.Fatal("no /blocks mount")
+	return nil
+}
+
+func TestMigrateBlocks(t *testing.T) {
+	loadPlugins(t)
+	path, err := ioutil.TempDir("", "ipfs-blocks-migration-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	if err := fsrepo.Init(path, testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openTestRepo(t, path)
+	putBlocks(t, r, 0, 100)
+	if err := r.MigrateBlocks(context.Background(), leveldbBlocksSpec, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	putBlocks(t, r, 100, 110)
+	checkBlocks(t, r, 110)
+	if typ := blocksMountType(t, r); typ != "levelds" {
+		t.Fatalf("expected the levelds blocks mount configured, got %v", typ)
+	}
+	if err := r.MigrateBlocks(context.Background(), leveldbBlocksSpec, nil, nil); err == nil {
+		t.Fatal("expected migrating to the same datastore to fail")
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blocks are all in the new datastore, the only one opened
+	r = openTestRepo(t, path)
+	defer r.Close()
+	checkBlocks(t, r, 110)
+}
+
+func TestMigrateBlocksResume(t *testing.T) {
+	loadPlugins(t)
+	path, err := ioutil.TempDir("", "ipfs-blocks-migration-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	if err := fsrepo.Init(path, testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openTestRepo(t, path)
+	putBlocks(t, r, 0, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	err = r.MigrateBlocks(ctx, leveldbBlocksSpec, nil, func(copied uint64) {
+		if copied == 10 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected the migration canceled, got %v", err)
+	}
+	putBlocks(t, r, 100, 110)
+	checkBlocks(t, r, 110)
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the migration goes on when the repo is opened again
+	r = openTestRepo(t, path)
+	defer r.Close()
+	checkBlocks(t, r, 110)
+	if typ := blocksMountType(t, r); typ != "measure" {
+		t.Fatalf("expected the flatfs blocks mount still configured, got %v", typ)
+	}
+	other := map[string]interface{}{"type": "levelds", "path": "other-leveldb"}
+	if err := r.MigrateBlocks(context.Background(), other, nil, nil); err == nil {
+		t.Fatal("expected migrating to another datastore to fail")
+	}
+	if err := r.MigrateBlocks(context.Background(), leveldbBlocksSpec, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	checkBlocks(t, r, 110)
+	if typ := blocksMountType(t, r); typ != "levelds" {
+		t.Fatalf("expected the levelds blocks mount configured, got %v", typ)
+	}
+}
@@ -0,0 +1,248 @@
+package fsrepo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/compressds"
+)
+
+type compressDatastoreConfig struct {
+	child     DatastoreConfig
+	algorithm string
+	level     int
+
+	// created is the datastore last created from this config
+	created *compressds.Datastore
+}
+
+// CompressDatastoreConfig returns a compress DatastoreConfig from a spec
+func CompressDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error) {
+	childField, ok := params["child"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'child' field is missing or not a map")
+	}
+	child, err := AnyDatastoreConfig(childField)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, ok := params["algorithm"].(string)
+	if !ok {
+		return nil, fmt.Errorf("'algorithm' field is missing or not a string")
+	}
+	c := &compressDatastoreConfig{child: child, algorithm: algorithm}
+	switch level := params["level"].(type) {
+	case float64:
+		c.level = int(level)
+	case int:
+		c.level = level
+	case nil:
+	default:
+		return nil, fmt.Errorf("'level' field is not a number")
+	}
+	if err := compressds.Check(c.algorithm, c.level); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DiskSpec leaves out the level, the values compressed at any level being
+// read alike.
+func (c *compressDatastoreConfig) DiskSpec() DiskSpec {
+	return map[string]interface{}{
+		"type":      "compress",
+		"algorithm": c.algorithm,
+		"child":     map[string]interface{}(c.child.DiskSpec()),
+	}
+}
+
+func (c *compressDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	return c.create(path, false)
+}
+
+func (c *compressDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.create(path, true)
+}
+
+func (c *compressDatastoreConfig) create(path string, readOnly bool) (repo.Datastore, error) {
+	child, err := createDatastore(c.child, path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	d, err := compressds.New(child, c.algorithm, c.level)
+	if err != nil {
+		child.Close()
+		return nil, err
+	}
+	c.created = d
+	return d, nil
+}
+
+// compressedDatastores adds to out the compressed datastores created from
+// dsc, by the mountpoint they are under.
+func compressedDatastores(dsc DatastoreConfig, mountpoint string, out map[string]*compressds.Datastore) {
+	switch c := dsc.(type) {
+	case *mountDatastoreConfig:
+		for _, m := range c.mounts {
+			compressedDatastores(m.ds, m.prefix.String(), out)
+		}
+	case *measureDatastoreConfig:
+		compressedDatastores(c.child, mountpoint, out)
+	case *logDatastoreConfig:
+		compressedDatastores(c.child, mountpoint, out)
+	case *compressDatastoreConfig:
+		if c.created != nil {
+			out[mountpoint] = c.created
+		}
+	}
+}
+
+// setBlocksCompression records the compressed datastore created from dsc, the
+// datastore the blocks are migrated to, if any.
+func (r *FSRepo) setBlocksCompression(dsc DatastoreConfig) {
+	created := make(map[string]*compressds.Datastore)
+	compressedDatastores(dsc, blocksMountpoint.String(), created)
+
+	r.compressedMu.Lock()
+	defer r.compressedMu.Unlock()
+	if d, ok := created[blocksMountpoint.String()]; ok {
+		r.compressed[blocksMountpoint.String()] = d
+	} else {
+		delete(r.compressed, blocksMountpoint.String())
+	}
+}
+
+// CompressionStat returns the size of the entries of the compressed
+// datastores, as stored and once decompressed, by the mountpoint they are
+// under. It reads all their entries.
+func (r *FSRepo) CompressionStat(ctx context.Context) (map[string]compressds.Stat, error) {
+	r.compressedMu.Lock()
+	compressed := make(map[string]*compressds.Datastore, len(r.compressed))
+	for mountpoint, d := range r.compressed {
+		compressed[mountpoint] = d
+	}
+	r.compressedMu.Unlock()
+
+	out := make(map[string]compressds.Stat, len(compressed))
+	for mountpoint, d := range compressed {
+		st, err := d.Stat(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out[mountpoint] = st
+	}
+	return out, nil
+}
+
+// CompressedBlocksSpec returns the spec of the datastore to migrate the
+// blocks to, for them to be compressed with algorithm at level, or
+// decompressed if algorithm is empty, given the datastore spec, and the path
+// the blocks are stored in. The compression goes right above the datastore
+// storing the blocks, whose path gets the algorithm as a suffix, for the
+// blocks to be copied to a new directory.
+func CompressedBlocksSpec(spec map[string]interface{}, algorithm string, level int) (map[string]interface{}, string, error) {
+	mounts, ok := spec["mounts"].([]interface{})
+	if spec["type"] != "mount" || !ok {
+		return nil, "", errNoBlocksMount
+	}
+	for _, m := range mounts {
+		if mm, ok := m.(map[string]interface{}); ok && mm["mountpoint"] == blocksMountpoint.String() {
+			blocks := make(map[string]interface{}, len(mm))
+			for k, v := range mm {
+				blocks[k] = v
+			}
+			delete(blocks, "mountpoint")
+			out, err := compressedSpec(blocks, algorithm, level)
+			if err != nil {
+				return nil, "", err
+			}
+			return out, specPath(out), nil
+		}
+	}
+	return nil, "", errNoBlocksMount
+}
+
+// specPath returns the path of the innermost datastore of spec.
+func specPath(spec map[string]interface{}) string {
+	for {
+		child, ok := spec["child"].(map[string]interface{})
+		if !ok {
+			path, _ := spec["path"].(string)
+			return path
+		}
+		spec = child
+	}
+}
+
+func compressedSpec(spec map[string]interface{}, algorithm string, level int) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		out[k] = v
+	}
+	child, hasChild := spec["child"].(map[string]interface{})
+	switch {
+	case spec["type"] == "compress" && algorithm == "":
+		return compressedPath(child, "")
+	case spec["type"] == "compress":
+		if spec["algorithm"] == algorithm {
+			return nil, fmt.Errorf("the blocks are compressed with %s already", algorithm)
+		}
+		child, err := compressedPath(child, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		out["child"] = child
+		out["algorithm"] = algorithm
+		delete(out, "level")
+		if level != 0 {
+			out["level"] = level
+		}
+		return out, nil
+	case hasChild:
+		child, err := compressedSpec(child, algorithm, level)
+		if err != nil {
+			return nil, err
+		}
+		out["child"] = child
+		return out, nil
+	case algorithm == "":
+		return nil, fmt.Errorf("the blocks are not compressed")
+	default:
+		child, err := compressedPath(spec, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		wrapped := map[string]interface{}{
+			"type":      "compress",
+			"algorithm": algorithm,
+			"child":     child,
+		}
+		if level != 0 {
+			wrapped["level"] = level
+		}
+		return wrapped, nil
+	}
+}
+
+// compressedPath returns a copy of spec with its path suffixed by algorithm
+// instead of the algorithm it was compressed with, if any.
+func compressedPath(spec map[string]interface{}, algorithm string) (map[string]interface{}, error) {
+	path, ok := spec["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("the datastore storing the blocks has no path")
+	}
+	for _, a := range compressds.Algorithms {
+		path = strings.TrimSuffix(path, "-"+a)
+	}
+	if algorithm != "" {
+		path += "-" + algorithm
+	}
+	out := make(map[string]interface{}, len(spec))
+	for k, v := range spec {
+		out[k] = v
+	}
+	out["path"] = path
+	return out, nil
+}
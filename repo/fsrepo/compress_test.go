@@ -0,0 +1,113 @@
+package fsrepo_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/repo/fsrepo"
+)
+
+func TestCompressedBlocksSpec(t *testing.T) {
+	spec := map[string]interface{}{
+		"type": "mount",
+		"mounts": []interface{}{
+			map[string]interface{}{
+				"mountpoint": "/blocks",
+				"type":       "measure",
+				"prefix":     "flatfs.datastore",
+				"child":      map[string]interface{}{"type": "flatfs", "path": "blocks"},
+			},
+		},
+	}
+
+	compressed, path, err := fsrepo.CompressedBlocksSpec(spec, "zstd", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "blocks-zstd" {
+		t.Fatalf("expected the blocks copied to blocks-zstd, got %s", path)
+	}
+	expected := map[string]interface{}{
+		"type":   "measure",
+		"prefix": "flatfs.datastore",
+		"child": map[string]interface{}{
+			"type":      "compress",
+			"algorithm": "zstd",
+			"level":     9,
+			"child":     map[string]interface{}{"type": "flatfs", "path": "blocks-zstd"},
+		},
+	}
+	if !reflect.DeepEqual(compressed, expected) {
+		t.Fatalf("expected %v, got %v", expected, compressed)
+	}
+
+	compressed["mountpoint"] = "/blocks"
+	spec["mounts"] = []interface{}{compressed}
+	if _, _, err := fsrepo.CompressedBlocksSpec(spec, "zstd", 0); err == nil {
+		t.Fatal("expected compressing with the same algorithm to fail")
+	}
+	decompressed, _, err := fsrepo.CompressedBlocksSpec(spec, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]interface{}{
+		"type":   "measure",
+		"prefix": "flatfs.datastore",
+		"child":  map[string]interface{}{"type": "flatfs", "path": "blocks"},
+	}
+	if !reflect.DeepEqual(decompressed, expected) {
+		t.Fatalf("expected %v, got %v", expected, decompressed)
+	}
+}
+
+func TestCompressBlocks(t *testing.T) {
+	loadPlugins(t)
+	path, err := ioutil.TempDir("", "ipfs-blocks-compression-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path)
+	if err := fsrepo.Init(path, testConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := openTestRepo(t, path)
+	putBlocks(t, r, 0, 100)
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, _, err := fsrepo.CompressedBlocksSpec(cfg.Datastore.Spec, "lz4", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.MigrateBlocks(context.Background(), spec, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	putBlocks(t, r, 100, 110)
+	checkBlocks(t, r, 110)
+
+	stats, err := r.(repo.CompressionStater).CompressionStat(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := stats["/blocks"]; st.Algorithm != "lz4" || st.Entries != 110 || st.LogicalSize == 0 {
+		t.Fatalf("unexpected stats %v", stats)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blocks are read back compressed, and decompressed
+	r = openTestRepo(t, path)
+	defer r.Close()
+	checkBlocks(t, r, 110)
+	stats, err = r.(repo.CompressionStater).CompressionStat(context.Background())
+	if err != nil || len(stats) != 1 {
+		t.Fatalf("expected the stats of /blocks, got %v, %v", stats, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/ipfs/go-ipfs/plugin/loader"
@@ -74,20 +75,29 @@ var measureConfig = []byte(`{
           "type": "measure"
 }`)
 
-func TestDefaultDatastoreConfig(t *testing.T) {
-	loader, err := loader.NewPluginLoader("")
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = loader.Initialize()
-	if err != nil {
-		t.Fatal(err)
-	}
+var loadPluginsOnce sync.Once
+
+// loadPlugins loads the datastore plugins, once for all the tests.
+func loadPlugins(t *testing.T) {
+	loadPluginsOnce.Do(func() {
+		loader, err := loader.NewPluginLoader("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = loader.Initialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = loader.Inject()
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+}
 
-	err = loader.Inject()
-	if err != nil {
-		t.Fatal(err)
-	}
+func TestDefaultDatastoreConfig(t *testing.T) {
+	loadPlugins(t)
 
 	dir, err := ioutil.TempDir("", "ipfs-datastore-config-test")
 	if err != nil {
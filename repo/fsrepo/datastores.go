@@ -30,6 +30,41 @@ type DatastoreConfig interface {
 	Create(path string) (repo.Datastore, error)
 }
 
+// ReadOnlyDatastoreConfig is implemented by the DatastoreConfigs which can
+// instantiate their datastore read-only, for the repos opened with
+// OpenReadOnly: the datastore is neither written to nor locked for writing,
+// so that other processes can read it at the same time.
+type ReadOnlyDatastoreConfig interface {
+	DatastoreConfig
+
+	// CreateReadOnly instantiates the datastore of this config, read-only
+	CreateReadOnly(path string) (repo.Datastore, error)
+}
+
+// FileDatastoreConfig is implemented by the DatastoreConfigs whose datastore
+// stores each value as is, in a file of its own, which can then be sent from
+// the disk without being read.
+type FileDatastoreConfig interface {
+	DatastoreConfig
+	// File returns the file the value of key is stored in by the datastore
+	// created under path, if stored at all, or false if key cannot be
+	// stored in a file.
+	File(path string, key ds.Key) (string, bool)
+}
+
+// createDatastore instantiates the datastore of dsc, read-only if readOnly is
+// set.
+func createDatastore(dsc DatastoreConfig, path string, readOnly bool) (repo.Datastore, error) {
+	if !readOnly {
+		return dsc.Create(path)
+	}
+	rc, ok := dsc.(ReadOnlyDatastoreConfig)
+	if !ok {
+		return nil, fmt.Errorf("the datastore %s cannot be opened read-only", dsc.DiskSpec())
+	}
+	return rc.CreateReadOnly(path)
+}
+
 // DiskSpec is a minimal representation of the characteristic values of the
 // datastore. If two diskspecs are the same, the loader assumes that they refer
 // to exactly the same datastore. If they differ at all, it is assumed they are
@@ -57,10 +92,11 @@ var datastores map[string]ConfigFromMap
 
 func init() {
 	datastores = map[string]ConfigFromMap{
-		"mount":   MountDatastoreConfig,
-		"mem":     MemDatastoreConfig,
-		"log":     LogDatastoreConfig,
-		"measure": MeasureDatastoreConfig,
+		"mount":    MountDatastoreConfig,
+		"mem":      MemDatastoreConfig,
+		"log":      LogDatastoreConfig,
+		"measure":  MeasureDatastoreConfig,
+		"compress": CompressDatastoreConfig,
 	}
 }
 
@@ -149,9 +185,17 @@ func (c *mountDatastoreConfig) DiskSpec() DiskSpec {
 }
 
 func (c *mountDatastoreConfig) Create(path string) (repo.Datastore, error) {
+	return c.create(path, false)
+}
+
+func (c *mountDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.create(path, true)
+}
+
+func (c *mountDatastoreConfig) create(path string, readOnly bool) (repo.Datastore, error) {
 	mounts := make([]mount.Mount, len(c.mounts))
 	for i, m := range c.mounts {
-		ds, err := m.ds.Create(path)
+		ds, err := createDatastore(m.ds, path, readOnly)
 		if err != nil {
 			return nil, err
 		}
@@ -178,6 +222,11 @@ func (c *memDatastoreConfig) Create(string) (repo.Datastore, error) {
 	return dssync.MutexWrap(ds.NewMapDatastore()), nil
 }
 
+// CreateReadOnly creates an empty datastore, as Create does: it is on no disk.
+func (c *memDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.Create(path)
+}
+
 type logDatastoreConfig struct {
 	child DatastoreConfig
 	name  string
@@ -202,7 +251,15 @@ func LogDatastoreConfig(params map[string]interface{}) (DatastoreConfig, error)
 }
 
 func (c *logDatastoreConfig) Create(path string) (repo.Datastore, error) {
-	child, err := c.child.Create(path)
+	return c.create(path, false)
+}
+
+func (c *logDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.create(path, true)
+}
+
+func (c *logDatastoreConfig) create(path string, readOnly bool) (repo.Datastore, error) {
+	child, err := createDatastore(c.child, path, readOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -240,7 +297,15 @@ func (c *measureDatastoreConfig) DiskSpec() DiskSpec {
 }
 
 func (c measureDatastoreConfig) Create(path string) (repo.Datastore, error) {
-	child, err := c.child.Create(path)
+	return c.create(path, false)
+}
+
+func (c measureDatastoreConfig) CreateReadOnly(path string) (repo.Datastore, error) {
+	return c.create(path, true)
+}
+
+func (c measureDatastoreConfig) create(path string, readOnly bool) (repo.Datastore, error) {
+	child, err := createDatastore(c.child, path, readOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 
 	filestore "github.com/ipfs/go-filestore"
 	keystore "github.com/ipfs/go-ipfs-keystore"
+	keylock "github.com/ipfs/go-ipfs/keylock"
+	"github.com/ipfs/go-ipfs/remotesign"
 	repo "github.com/ipfs/go-ipfs/repo"
 	"github.com/ipfs/go-ipfs/repo/common"
+	"github.com/ipfs/go-ipfs/repo/compressds"
+	"github.com/ipfs/go-ipfs/repo/livemigrate"
 	dir "github.com/ipfs/go-ipfs/thirdparty/dir"
 
 	ds "github.com/ipfs/go-datastore"
@@ -96,16 +102,44 @@ type FSRepo struct {
 	closed bool
 	// path is the file-system path
 	path string
+	// readOnly is set when the repo is opened by OpenReadOnly
+	readOnly bool
 	// lockfile is the file system lock to prevent others from opening
-	// the same fsrepo path concurrently
+	// the same fsrepo path concurrently, nil when read-only
 	lockfile io.Closer
 	config   *config.Config
 	ds       repo.Datastore
+	coldDs   repo.Datastore
 	keystore keystore.Keystore
 	filemgr  *filestore.FileManager
+
+	// placement are the datastores of the placement mounts, by name
+	placement map[string]repo.Datastore
+
+	// blocks is the datastore mounted at /blocks, nil if none
+	blocks *livemigrate.Datastore
+	// retired are the datastores the blocks were migrated from
+	retired []repo.Datastore
+	// migrating is 1 while MigrateBlocks runs
+	migrating int32
+	// compressed are the compressed datastores, by the mountpoint they are
+	// under
+	compressed   map[string]*compressds.Datastore
+	compressedMu sync.Mutex
+	// blockFiles is the config of the datastore storing the blocks in
+	// files, nil if they are not
+	blockFiles   FileDatastoreConfig
+	blockFilesMu sync.Mutex
 }
 
-var _ repo.Repo = (*FSRepo)(nil)
+var (
+	_ repo.Repo              = (*FSRepo)(nil)
+	_ repo.BlocksMigrator    = (*FSRepo)(nil)
+	_ repo.CompressionStater = (*FSRepo)(nil)
+	_ repo.BlockFiler        = (*FSRepo)(nil)
+	_ repo.PlacementMounter  = (*FSRepo)(nil)
+	_ repo.ReadOnlyOpener    = (*FSRepo)(nil)
+)
 
 // Open the FSRepo at path. Returns an error if the repo is not
 // initialized.
@@ -116,6 +150,26 @@ func Open(repoPath string) (repo.Repo, error) {
 	return onlyOne.Open(repoPath, fn)
 }
 
+// readOnlyKey is the key of the repos opened read-only, apart from the others.
+type readOnlyKey string
+
+// OpenReadOnly opens the FSRepo at path read-only: nothing is written to its
+// directory, which may be on a read-only file system, such as a snapshot of
+// the storage of another node. Its config, keystore and datastores refuse the
+// changes with repo.ErrReadOnly, and its datastores are opened read-only,
+// which the DatastoreConfigs must support.
+//
+// The repo is not locked, so that several processes can open it read-only at
+// the same time, for instance tools inspecting it while a daemon serves it.
+// The datastores locking their files still refuse to be opened while another
+// process writes them.
+func OpenReadOnly(repoPath string) (repo.Repo, error) {
+	fn := func() (repo.Repo, error) {
+		return openReadOnly(repoPath)
+	}
+	return onlyOne.Open(readOnlyKey(repoPath), fn)
+}
+
 func open(repoPath string) (repo.Repo, error) {
 	packageLock.Lock()
 	defer packageLock.Unlock()
@@ -142,37 +196,95 @@ func open(repoPath string) (repo.Repo, error) {
 		}
 	}()
 
+	if err := r.openParts(); err != nil {
+		return nil, err
+	}
+
+	keepLocked = true
+	return r, nil
+}
+
+func openReadOnly(repoPath string) (repo.Repo, error) {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+
+	r, err := newFSRepo(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	r.readOnly = true
+
+	if err := checkInitialized(r.path); err != nil {
+		return nil, err
+	}
+	// an interrupted migration of the blocks only goes on with writes
+	if target, err := r.readBlocksMigration(); err != nil {
+		return nil, err
+	} else if target != nil {
+		return nil, errors.New("the blocks of the repo are being migrated, open it for writing to finish the migration first")
+	}
+
+	if err := r.openParts(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// openParts checks the version of the repo, and opens its config, datastores
+// and keystore, refusing the changes if read-only.
+func (r *FSRepo) openParts() error {
 	// Check version, and error out if not matching
 	ver, err := migrations.RepoVersion(r.path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, ErrNoVersion
+			return ErrNoVersion
 		}
-		return nil, err
+		return err
 	}
 
 	if RepoVersion > ver {
-		return nil, ErrNeedMigration
+		return ErrNeedMigration
 	} else if ver > RepoVersion {
 		// program version too low for existing repo
-		return nil, fmt.Errorf(programTooLowMessage, RepoVersion, ver)
+		return fmt.Errorf(programTooLowMessage, RepoVersion, ver)
 	}
 
 	// check repo path, then check all constituent parts.
-	if err := dir.Writable(r.path); err != nil {
-		return nil, err
+	if !r.readOnly {
+		if err := dir.Writable(r.path); err != nil {
+			return err
+		}
 	}
 
 	if err := r.openConfig(); err != nil {
-		return nil, err
+		return err
 	}
 
 	if err := r.openDatastore(); err != nil {
-		return nil, err
+		return err
+	}
+
+	if err := r.openColdDatastore(); err != nil {
+		return err
+	}
+
+	if err := r.openPlacementDatastores(); err != nil {
+		return err
 	}
 
 	if err := r.openKeystore(); err != nil {
-		return nil, err
+		return err
+	}
+
+	if r.readOnly {
+		r.ds = &readOnlyDatastore{r.ds}
+		if r.coldDs != nil {
+			r.coldDs = &readOnlyDatastore{r.coldDs}
+		}
+		for name, d := range r.placement {
+			r.placement[name] = &readOnlyDatastore{d}
+		}
+		r.keystore = &readOnlyKeystore{r.keystore}
 	}
 
 	if r.config.Experimental.FilestoreEnabled || r.config.Experimental.UrlstoreEnabled {
@@ -180,9 +292,7 @@ func open(repoPath string) (repo.Repo, error) {
 		r.filemgr.AllowFiles = r.config.Experimental.FilestoreEnabled
 		r.filemgr.AllowUrls = r.config.Experimental.UrlstoreEnabled
 	}
-
-	keepLocked = true
-	return r, nil
+	return nil
 }
 
 func newFSRepo(rpath string) (*FSRepo, error) {
@@ -341,8 +451,12 @@ func (r *FSRepo) Path() string {
 	return r.path
 }
 
-// SetAPIAddr writes the API Addr to the /api file.
+// SetAPIAddr writes the API Addr to the /api file. A read-only repo records
+// no address, the clients being given it with --api.
 func (r *FSRepo) SetAPIAddr(addr ma.Multiaddr) error {
+	if r.readOnly {
+		return nil
+	}
 	// Create a temp file to write the address, so that we don't leave empty file when the
 	// program crashes after creating the file.
 	f, err := os.Create(filepath.Join(r.path, "."+apiFile+".tmp"))
@@ -386,16 +500,57 @@ func (r *FSRepo) openConfig() error {
 
 func (r *FSRepo) openKeystore() error {
 	ksp := filepath.Join(r.path, "keystore")
-	ks, err := keystore.NewFSKeystore(ksp)
+	ks, err := keylock.Open(ksp)
 	if err != nil {
 		return err
 	}
+	// an encrypted keystore is unlocked with the passphrase given by the
+	// environment, if any
+	if err := ks.UnlockFromEnv(); err != nil {
+		return fmt.Errorf("unlocking the keystore: %w", err)
+	}
 
 	r.keystore = ks
+	if len(r.config.Ipns.RemoteKeys) > 0 {
+		signers, err := remoteSigners(r.config.Ipns.RemoteKeys)
+		if err != nil {
+			return err
+		}
+		r.keystore = remotesign.NewKeystore(ks, signers)
+	}
 
 	return nil
 }
 
+// remoteSigners returns the signers of the remote keys of the config, by name.
+func remoteSigners(keys map[string]config.IpnsRemoteKey) (map[string]*remotesign.Signer, error) {
+	signers := make(map[string]*remotesign.Signer, len(keys))
+	for name, k := range keys {
+		if name == "self" {
+			return nil, errors.New("invalid Ipns.RemoteKeys config: the identity of the node cannot be a remote key")
+		}
+		pk, err := remotesign.ParsePublicKey(k.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ipns.RemoteKeys config for key %s: %s", name, err)
+		}
+		header := make(http.Header, len(k.Headers))
+		for h, v := range k.Headers {
+			header.Set(h, v)
+		}
+		s, err := remotesign.New(remotesign.Settings{
+			URL:       k.URL,
+			Header:    header,
+			Timeout:   k.Timeout.WithDefault(config.DefaultIpnsRemoteSignTimeout),
+			PublicKey: pk,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ipns.RemoteKeys config for key %s: %s", name, err)
+		}
+		signers[name] = s
+	}
+	return signers, nil
+}
+
 // openDatastore returns an error if the config file is not present.
 func (r *FSRepo) openDatastore() error {
 	if r.config.Datastore.Type != "" || r.config.Datastore.Path != "" {
@@ -407,25 +562,43 @@ func (r *FSRepo) openDatastore() error {
 		log.Warn("NoSync is now deprecated in favor of datastore specific settings. If you want to disable fsync on flatfs set 'sync' to false. See https://github.com/ipfs/go-ipfs/blob/master/docs/datastores.md#flatfs.")
 	}
 
-	dsc, err := AnyDatastoreConfig(r.config.Datastore.Spec)
+	oldSpec, err := r.readSpec()
 	if err != nil {
 		return err
 	}
-	spec := dsc.DiskSpec()
+	target, err := r.readBlocksMigration()
+	if err != nil {
+		return err
+	}
+	if target != nil {
+		if target, err = r.recoverBlocksMigration(target, oldSpec); err != nil {
+			return err
+		}
+	}
 
-	oldSpec, err := r.readSpec()
+	dsc, err := AnyDatastoreConfig(r.config.Datastore.Spec)
 	if err != nil {
 		return err
 	}
+	spec := dsc.DiskSpec()
 	if oldSpec != spec.String() {
 		return fmt.Errorf("datastore configuration of '%s' does not match what is on disk '%s'",
 			oldSpec, spec.String())
 	}
 
-	d, err := dsc.Create(r.path)
+	d, err := r.createDatastore(dsc)
 	if err != nil {
 		return err
 	}
+	r.compressed = make(map[string]*compressds.Datastore)
+	compressedDatastores(dsc, "/", r.compressed)
+	r.setBlockFiles(dsc, "/")
+	if target != nil {
+		if err := r.resumeBlocksMigration(target); err != nil {
+			d.Close()
+			return err
+		}
+	}
 	r.ds = d
 
 	// Wrap it with metrics gathering
@@ -435,6 +608,54 @@ func (r *FSRepo) openDatastore() error {
 	return nil
 }
 
+// openColdDatastore opens the cold tier datastore, if one is configured.
+func (r *FSRepo) openColdDatastore() error {
+	if len(r.config.Datastore.ColdTier.Spec) == 0 {
+		return nil
+	}
+
+	dsc, err := AnyDatastoreConfig(r.config.Datastore.ColdTier.Spec)
+	if err != nil {
+		return fmt.Errorf("cold tier: %w", err)
+	}
+	d, err := createDatastore(dsc, r.path, r.readOnly)
+	if err != nil {
+		return fmt.Errorf("cold tier: %w", err)
+	}
+	r.coldDs = measure.New("ipfs.fsrepo.colddatastore", d)
+	return nil
+}
+
+// placementMountName matches the names of the placement mounts, which go in
+// the names of their metrics.
+var placementMountName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// openPlacementDatastores opens the datastores of the placement mounts, if
+// any are configured.
+func (r *FSRepo) openPlacementDatastores() error {
+	mounts := r.config.Datastore.Placement.Mounts
+	if len(mounts) == 0 {
+		return nil
+	}
+
+	r.placement = make(map[string]repo.Datastore, len(mounts))
+	for name, spec := range mounts {
+		if !placementMountName.MatchString(name) || name == config.PlacementMain {
+			return fmt.Errorf("placement mount %q: the names are made of lowercase letters, digits and underscores, and not %q", name, config.PlacementMain)
+		}
+		dsc, err := AnyDatastoreConfig(spec)
+		if err != nil {
+			return fmt.Errorf("placement mount %q: %w", name, err)
+		}
+		d, err := createDatastore(dsc, r.path, r.readOnly)
+		if err != nil {
+			return fmt.Errorf("placement mount %q: %w", name, err)
+		}
+		r.placement[name] = measure.New("ipfs.fsrepo.placement."+name, d)
+	}
+	return nil
+}
+
 func (r *FSRepo) readSpec() (string, error) {
 	fn, err := config.Path(r.path, specFn)
 	if err != nil {
@@ -456,14 +677,31 @@ func (r *FSRepo) Close() error {
 		return errors.New("repo is closed")
 	}
 
-	err := os.Remove(filepath.Join(r.path, apiFile))
-	if err != nil && !os.IsNotExist(err) {
-		log.Warn("error removing api file: ", err)
+	if !r.readOnly {
+		err := os.Remove(filepath.Join(r.path, apiFile))
+		if err != nil && !os.IsNotExist(err) {
+			log.Warn("error removing api file: ", err)
+		}
 	}
 
 	if err := r.ds.Close(); err != nil {
 		return err
 	}
+	if r.coldDs != nil {
+		if err := r.coldDs.Close(); err != nil {
+			return err
+		}
+	}
+	for _, d := range r.placement {
+		if err := d.Close(); err != nil {
+			return err
+		}
+	}
+	for _, d := range r.retired {
+		if err := d.Close(); err != nil {
+			return err
+		}
+	}
 
 	// This code existed in the previous versions, but
 	// EventlogComponent.Close was never called. Preserving here
@@ -474,6 +712,9 @@ func (r *FSRepo) Close() error {
 	// logging.Configure(logging.Output(os.Stderr))
 
 	r.closed = true
+	if r.lockfile == nil {
+		return nil
+	}
 	return r.lockfile.Close()
 }
 
@@ -496,11 +737,19 @@ func (r *FSRepo) Config() (*config.Config, error) {
 	return r.config, nil
 }
 
+// ReadOnly returns whether the repo is opened by OpenReadOnly.
+func (r *FSRepo) ReadOnly() bool {
+	return r.readOnly
+}
+
 func (r *FSRepo) FileManager() *filestore.FileManager {
 	return r.filemgr
 }
 
 func (r *FSRepo) BackupConfig(prefix string) (string, error) {
+	if r.readOnly {
+		return "", repo.ErrReadOnly
+	}
 	temp, err := ioutil.TempFile(r.path, "config-"+prefix)
 	if err != nil {
 		return "", err
@@ -546,6 +795,10 @@ func (r *FSRepo) SetConfig(updated *config.Config) error {
 	packageLock.Lock()
 	defer packageLock.Unlock()
 
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
+
 	configFilename, err := config.Filename(r.path)
 	if err != nil {
 		return err
@@ -599,7 +852,14 @@ func (r *FSRepo) SetConfigKey(key string, value interface{}) error {
 	if r.closed {
 		return errors.New("repo is closed")
 	}
+	if r.readOnly {
+		return repo.ErrReadOnly
+	}
+	return r.setConfigKey(key, value)
+}
 
+// setConfigKey writes the value of key. packageLock must be held.
+func (r *FSRepo) setConfigKey(key string, value interface{}) error {
 	filename, err := config.Filename(r.path)
 	if err != nil {
 		return err
@@ -652,6 +912,23 @@ func (r *FSRepo) Datastore() repo.Datastore {
 	return d
 }
 
+// ColdDatastore returns the repo-owned cold tier datastore, or nil if the
+// cold tier is not configured. If FSRepo is Closed, return value is undefined.
+func (r *FSRepo) ColdDatastore() repo.Datastore {
+	packageLock.Lock()
+	d := r.coldDs
+	packageLock.Unlock()
+	return d
+}
+
+// PlacementDatastores returns the repo-owned datastores of the placement
+// mounts, by name. If FSRepo is Closed, return value is undefined.
+func (r *FSRepo) PlacementDatastores() map[string]repo.Datastore {
+	packageLock.Lock()
+	defer packageLock.Unlock()
+	return r.placement
+}
+
 // GetStorageUsage computes the storage space taken by the repo in bytes
 func (r *FSRepo) GetStorageUsage(ctx context.Context) (uint64, error) {
 	return ds.DiskUsage(ctx, r.Datastore())
@@ -0,0 +1,53 @@
+package fsrepo
+
+import (
+	"context"
+
+	ds "github.com/ipfs/go-datastore"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/ipfs/go-ipfs/repo"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+// readOnlyDatastore refuses the writes to the datastore of a repo opened
+// read-only.
+type readOnlyDatastore struct {
+	repo.Datastore
+}
+
+var _ ds.PersistentDatastore = (*readOnlyDatastore)(nil)
+
+func (d *readOnlyDatastore) Put(context.Context, ds.Key, []byte) error {
+	return repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) Delete(context.Context, ds.Key) error {
+	return repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) Batch(context.Context) (ds.Batch, error) {
+	return nil, repo.ErrReadOnly
+}
+
+func (d *readOnlyDatastore) DiskUsage(ctx context.Context) (uint64, error) {
+	return ds.DiskUsage(ctx, d.Datastore)
+}
+
+// readOnlyKeystore refuses the changes to the keystore of a repo opened
+// read-only.
+type readOnlyKeystore struct {
+	keystore.Keystore
+}
+
+func (ks *readOnlyKeystore) Put(string, ci.PrivKey) error {
+	return repo.ErrReadOnly
+}
+
+func (ks *readOnlyKeystore) Delete(string) error {
+	return repo.ErrReadOnly
+}
+
+// Unwrap returns the keystore refusing the changes.
+func (ks *readOnlyKeystore) Unwrap() keystore.Keystore {
+	return ks.Keystore
+}
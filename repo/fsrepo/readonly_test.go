@@ -0,0 +1,79 @@
+package fsrepo
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/repo"
+	"github.com/ipfs/go-ipfs/thirdparty/assert"
+	ci "github.com/libp2p/go-libp2p-core/crypto"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	path := testRepoPath("readonly", t)
+	defer Remove(path)
+	assert.Nil(Init(path, &config.Config{Datastore: config.DefaultDatastoreConfig()}), t)
+
+	block := datastore.NewKey("/blocks/CIQREADONLY")
+	key := datastore.NewKey("/local/readonly")
+	r, err := Open(path)
+	assert.Nil(err, t)
+	assert.Nil(r.Datastore().Put(ctx, block, []byte("block")), t)
+	assert.Nil(r.Datastore().Put(ctx, key, []byte("value")), t)
+	assert.Nil(r.Close(), t)
+
+	r1, err := OpenReadOnly(path)
+	assert.Nil(err, t, "the repo should open read-only")
+	r2, err := OpenReadOnly(path)
+	assert.Nil(err, t, "the repo should open read-only twice")
+	assert.True(r1 == r2, t, "opening read-only twice returns the same value")
+	assert.True(repo.IsReadOnly(r1), t, "the repo should be read-only")
+	defer r2.Close()
+
+	// nothing is written to the repo, not even a lock
+	if _, err := os.Stat(filepath.Join(path, LockFile)); !os.IsNotExist(err) {
+		t.Errorf("expected the repo not locked, got %v", err)
+	}
+
+	// the flatfs and levelds datastores are read
+	for k, expected := range map[datastore.Key][]byte{block: []byte("block"), key: []byte("value")} {
+		actual, err := r1.Datastore().Get(ctx, k)
+		assert.Nil(err, t, "Get should succeed")
+		assert.True(bytes.Equal(expected, actual), t, "data should match")
+	}
+	res, err := r1.Datastore().Query(ctx, query.Query{Prefix: "/blocks", KeysOnly: true})
+	assert.Nil(err, t)
+	entries, err := res.Rest()
+	assert.Nil(err, t)
+	if len(entries) != 1 || entries[0].Key != block.String() {
+		t.Errorf("expected the block queried, got %v", entries)
+	}
+
+	// and the changes refused
+	if err := r1.Datastore().Put(ctx, block, []byte("changed")); err != repo.ErrReadOnly {
+		t.Errorf("expected Put refused, got %v", err)
+	}
+	if err := r1.Datastore().Delete(ctx, key); err != repo.ErrReadOnly {
+		t.Errorf("expected Delete refused, got %v", err)
+	}
+	if _, err := r1.Datastore().Batch(ctx); err != repo.ErrReadOnly {
+		t.Errorf("expected Batch refused, got %v", err)
+	}
+	if err := r1.SetConfigKey("Foo", "bar"); err != repo.ErrReadOnly {
+		t.Errorf("expected SetConfigKey refused, got %v", err)
+	}
+	sk, _, err := ci.GenerateEd25519Key(nil)
+	assert.Nil(err, t)
+	if err := r1.Keystore().Put("key", sk); err != repo.ErrReadOnly {
+		t.Errorf("expected the keystore refusing Put, got %v", err)
+	}
+	assert.Nil(r1.Close(), t)
+}
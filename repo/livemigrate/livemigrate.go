@@ -0,0 +1,386 @@
+// Package livemigrate moves the content of a datastore to another while it
+// is in use.
+//
+// A Datastore is used in the place of the datastore migrated. Once the
+// migration is started, the entries are written to the new datastore, read
+// from either, and deleted from both, while Copy copies the entries of the old
+// datastore to the new one in the background. Once they are all copied, the
+// old datastore is left out by Cutover, and the new one is used alone.
+package livemigrate
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/repo"
+)
+
+// ErrNotMigrating is returned by Copy and Cutover when no migration is
+// started.
+var ErrNotMigrating = errors.New("no migration started")
+
+// Datastore is a datastore which can be migrated to another while in use.
+// Until a migration is started, it passes everything to the datastore it
+// wraps.
+type Datastore struct {
+	// mu is read locked by the operations, for the datastores not to be
+	// switched under them
+	mu     sync.RWMutex
+	active repo.Datastore // the datastore written to
+	old    repo.Datastore // the datastore migrated from, nil if not migrating
+
+	// copyMu keeps an entry from being copied while it is deleted, which
+	// would bring it back in the new datastore
+	copyMu sync.Mutex
+}
+
+var (
+	_ ds.Batching            = (*Datastore)(nil)
+	_ ds.PersistentDatastore = (*Datastore)(nil)
+	_ ds.GCDatastore         = (*Datastore)(nil)
+	_ ds.CheckedDatastore    = (*Datastore)(nil)
+)
+
+// New returns d, ready to be migrated.
+func New(d repo.Datastore) *Datastore {
+	return &Datastore{active: d}
+}
+
+// Start starts the migration to to: the entries are written to it from now
+// on, and read from it before the current datastore.
+func (d *Datastore) Start(to repo.Datastore) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.old != nil {
+		return errors.New("a migration is already started")
+	}
+	d.old, d.active = d.active, to
+	return nil
+}
+
+// Migrating returns whether a migration is started.
+func (d *Datastore) Migrating() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.old != nil
+}
+
+// Copy copies the entries of the datastore migrated from to the new one, but
+// the ones already there, waiting for l between them. It calls progress, if
+// not nil, with the number of entries copied so far, after each one.
+func (d *Datastore) Copy(ctx context.Context, l *iothrottle.Limiter, progress func(copied uint64)) error {
+	d.mu.RLock()
+	active, old := d.active, d.old
+	d.mu.RUnlock()
+	if old == nil {
+		return ErrNotMigrating
+	}
+
+	res, err := old.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	var copied uint64
+	for r := range res.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		n, err := d.copyEntry(ctx, active, old, ds.NewKey(r.Key))
+		if err != nil {
+			return err
+		}
+		if n < 0 {
+			continue
+		}
+		copied++
+		if progress != nil {
+			progress(copied)
+		}
+		if err := l.Wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// copyEntry copies the entry of k from old to active, and returns its size,
+// or -1 if it is not copied: already in active, or deleted since it was
+// listed.
+func (d *Datastore) copyEntry(ctx context.Context, active, old repo.Datastore, k ds.Key) (int, error) {
+	d.copyMu.Lock()
+	defer d.copyMu.Unlock()
+	if has, err := active.Has(ctx, k); err != nil || has {
+		return -1, err
+	}
+	v, err := old.Get(ctx, k)
+	if err == ds.ErrNotFound {
+		return -1, nil
+	} else if err != nil {
+		return -1, err
+	}
+	if err := active.Put(ctx, k, v); err != nil {
+		return -1, err
+	}
+	return len(v), nil
+}
+
+// Cutover ends the migration, once Copy is done, and returns the datastore
+// migrated from, which is not used anymore. Closing it is up to the caller.
+func (d *Datastore) Cutover(ctx context.Context) (repo.Datastore, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.old == nil {
+		return nil, ErrNotMigrating
+	}
+	if err := d.active.Sync(ctx, ds.NewKey("/")); err != nil {
+		return nil, err
+	}
+	old := d.old
+	d.old = nil
+	return old, nil
+}
+
+func (d *Datastore) Get(ctx context.Context, k ds.Key) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	v, err := d.active.Get(ctx, k)
+	if err == ds.ErrNotFound && d.old != nil {
+		return d.old.Get(ctx, k)
+	}
+	return v, err
+}
+
+func (d *Datastore) Has(ctx context.Context, k ds.Key) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	has, err := d.active.Has(ctx, k)
+	if err == nil && !has && d.old != nil {
+		return d.old.Has(ctx, k)
+	}
+	return has, err
+}
+
+func (d *Datastore) GetSize(ctx context.Context, k ds.Key) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	size, err := d.active.GetSize(ctx, k)
+	if err == ds.ErrNotFound && d.old != nil {
+		return d.old.GetSize(ctx, k)
+	}
+	return size, err
+}
+
+func (d *Datastore) Put(ctx context.Context, k ds.Key, v []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.active.Put(ctx, k, v)
+}
+
+func (d *Datastore) Delete(ctx context.Context, k ds.Key) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.old == nil {
+		return d.active.Delete(ctx, k)
+	}
+	d.copyMu.Lock()
+	defer d.copyMu.Unlock()
+	if err := d.active.Delete(ctx, k); err != nil {
+		return err
+	}
+	return d.old.Delete(ctx, k)
+}
+
+func (d *Datastore) Sync(ctx context.Context, prefix ds.Key) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.old != nil {
+		if err := d.old.Sync(ctx, prefix); err != nil {
+			return err
+		}
+	}
+	return d.active.Sync(ctx, prefix)
+}
+
+// Query lists the entries of both datastores while migrating, those of the
+// new one first. The filters, orders, offset and limit of q apply to them
+// all.
+func (d *Datastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	d.mu.RLock()
+	active, old := d.active, d.old
+	d.mu.RUnlock()
+	if old == nil {
+		return active.Query(ctx, q)
+	}
+
+	naive := dsq.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly, ReturnsSizes: q.ReturnsSizes}
+	ar, err := active.Query(ctx, naive)
+	if err != nil {
+		return nil, err
+	}
+	or, err := old.Query(ctx, naive)
+	if err != nil {
+		ar.Close()
+		return nil, err
+	}
+	activeDone := false
+	res := dsq.ResultsFromIterator(naive, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			if !activeDone {
+				if r, ok := ar.NextSync(); ok {
+					return r, true
+				}
+				activeDone = true
+			}
+			for {
+				r, ok := or.NextSync()
+				if !ok || r.Error != nil {
+					return r, ok
+				}
+				// the entries already copied are listed with the new
+				// datastore
+				has, err := active.Has(ctx, ds.NewKey(r.Key))
+				if err != nil {
+					return dsq.Result{Error: err}, true
+				}
+				if !has {
+					return r, true
+				}
+			}
+		},
+		Close: func() error {
+			err := ar.Close()
+			if oerr := or.Close(); err == nil {
+				err = oerr
+			}
+			return err
+		},
+	})
+	return dsq.NaiveQueryApply(q, res), nil
+}
+
+// Batch returns a batch of the datastore written to when it is committed.
+func (d *Datastore) Batch(ctx context.Context) (ds.Batch, error) {
+	return &batch{d: d, puts: make(map[ds.Key][]byte), deletes: make(map[ds.Key]struct{})}, nil
+}
+
+// DiskUsage returns the disk usage of both datastores while migrating.
+func (d *Datastore) DiskUsage(ctx context.Context) (uint64, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	du, err := ds.DiskUsage(ctx, d.active)
+	if err != nil || d.old == nil {
+		return du, err
+	}
+	odu, err := ds.DiskUsage(ctx, d.old)
+	return du + odu, err
+}
+
+// CollectGarbage collects the garbage of the datastores which can.
+func (d *Datastore) CollectGarbage(ctx context.Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, sd := range d.datastores() {
+		if gds, ok := sd.(ds.GCDatastore); ok {
+			if err := gds.CollectGarbage(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Check checks the datastores which can.
+func (d *Datastore) Check(ctx context.Context) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, sd := range d.datastores() {
+		if cds, ok := sd.(ds.CheckedDatastore); ok {
+			if err := cds.Check(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// datastores returns the datastores in use. d.mu must be held.
+func (d *Datastore) datastores() []repo.Datastore {
+	if d.old == nil {
+		return []repo.Datastore{d.active}
+	}
+	return []repo.Datastore{d.active, d.old}
+}
+
+// Close closes both datastores while migrating.
+func (d *Datastore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.active.Close()
+	if d.old != nil {
+		if oerr := d.old.Close(); err == nil {
+			err = oerr
+		}
+	}
+	return err
+}
+
+// batch holds the operations until they are committed, so that they go to
+// the datastore written to then, and not to the one when the batch was made.
+type batch struct {
+	d       *Datastore
+	puts    map[ds.Key][]byte
+	deletes map[ds.Key]struct{}
+}
+
+func (b *batch) Put(ctx context.Context, k ds.Key, v []byte) error {
+	delete(b.deletes, k)
+	b.puts[k] = v
+	return nil
+}
+
+func (b *batch) Delete(ctx context.Context, k ds.Key) error {
+	delete(b.puts, k)
+	b.deletes[k] = struct{}{}
+	return nil
+}
+
+func (b *batch) Commit(ctx context.Context) error {
+	b.d.mu.RLock()
+	defer b.d.mu.RUnlock()
+	if b.d.old != nil && len(b.deletes) > 0 {
+		b.d.copyMu.Lock()
+		defer b.d.copyMu.Unlock()
+	}
+
+	ab, err := b.d.active.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for k, v := range b.puts {
+		if err := ab.Put(ctx, k, v); err != nil {
+			return err
+		}
+	}
+	for k := range b.deletes {
+		if err := ab.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	if err := ab.Commit(ctx); err != nil {
+		return err
+	}
+	if b.d.old == nil {
+		return nil
+	}
+	for k := range b.deletes {
+		if err := b.d.old.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package livemigrate
+
+import (
+	"context"
+	"testing"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+)
+
+func newMapDatastore() ds.Batching {
+	return dssync.MutexWrap(ds.NewMapDatastore())
+}
+
+func keys(t *testing.T, d ds.Datastore) map[string]bool {
+	t.Helper()
+	res, err := d.Query(context.Background(), dsq.Query{KeysOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(map[string]bool)
+	for _, e := range entries {
+		if out[e.Key] {
+			t.Fatalf("%s listed twice", e.Key)
+		}
+		out[e.Key] = true
+	}
+	return out
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	from, to := newMapDatastore(), newMapDatastore()
+	for _, k := range []string{"/a", "/b", "/c"} {
+		if err := from.Put(ctx, ds.NewKey(k), []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := New(from)
+	if err := d.Copy(ctx, nil, nil); err != ErrNotMigrating {
+		t.Fatalf("expected ErrNotMigrating, got %v", err)
+	}
+	if err := d.Start(to); err != nil {
+		t.Fatal(err)
+	}
+
+	// written to the new datastore, read from either, deleted from both
+	if err := d.Put(ctx, ds.NewKey("/d"), []byte("/d")); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := from.Has(ctx, ds.NewKey("/d")); has {
+		t.Fatal("expected /d written to the new datastore only")
+	}
+	if v, err := d.Get(ctx, ds.NewKey("/a")); err != nil || string(v) != "/a" {
+		t.Fatalf("expected /a read from the old datastore, got %q, %v", v, err)
+	}
+	if err := d.Delete(ctx, ds.NewKey("/b")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Batch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Put(ctx, ds.NewKey("/e"), []byte("/e"))
+	b.Delete(ctx, ds.NewKey("/c"))
+	if err := b.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if has, _ := d.Has(ctx, ds.NewKey("/c")); has {
+		t.Fatal("expected /c deleted by the batch")
+	}
+
+	// an entry copied already is listed once
+	if err := to.Put(ctx, ds.NewKey("/a"), []byte("/a")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"/a": true, "/d": true, "/e": true}
+	if got := keys(t, d); len(got) != len(want) {
+		t.Fatalf("expected %v listed, got %v", want, got)
+	}
+
+	var copied uint64
+	if err := d.Copy(ctx, nil, func(n uint64) { copied = n }); err != nil {
+		t.Fatal(err)
+	}
+	if copied != 0 {
+		t.Fatalf("expected nothing left to copy, got %d", copied)
+	}
+	if err := from.Put(ctx, ds.NewKey("/f"), []byte("/f")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Copy(ctx, nil, func(n uint64) { copied = n }); err != nil {
+		t.Fatal(err)
+	}
+	if copied != 1 {
+		t.Fatalf("expected /f copied, got %d", copied)
+	}
+
+	old, err := d.Cutover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != from {
+		t.Fatal("expected the old datastore returned")
+	}
+	want["/f"] = true
+	got := keys(t, to)
+	for k := range want {
+		if !got[k] {
+			t.Fatalf("expected %s in the new datastore, got %v", k, got)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v in the new datastore, got %v", want, got)
+	}
+	if d.Migrating() {
+		t.Fatal("expected the migration done")
+	}
+}
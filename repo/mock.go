@@ -44,6 +44,8 @@ func (m *Mock) GetConfigKey(key string) (interface{}, error) {
 
 func (m *Mock) Datastore() Datastore { return m.D }
 
+func (m *Mock) ColdDatastore() Datastore { return nil }
+
 func (m *Mock) GetStorageUsage(_ context.Context) (uint64, error) { return 0, nil }
 
 func (m *Mock) Close() error { return m.D.Close() }
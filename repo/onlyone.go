@@ -1,7 +1,12 @@
 package repo
 
 import (
+	"context"
 	"sync"
+
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/repo/compressds"
 )
 
 // OnlyOne tracks open Repos by arbitrary key and returns the already
@@ -54,7 +59,58 @@ type ref struct {
 	Repo
 }
 
-var _ Repo = (*ref)(nil)
+var (
+	_ Repo              = (*ref)(nil)
+	_ BlocksMigrator    = (*ref)(nil)
+	_ CompressionStater = (*ref)(nil)
+	_ BlockFiler        = (*ref)(nil)
+	_ PlacementMounter  = (*ref)(nil)
+	_ ReadOnlyOpener    = (*ref)(nil)
+)
+
+// MigrateBlocks migrates the blocks of the repo, if it is a BlocksMigrator.
+func (r *ref) MigrateBlocks(ctx context.Context, spec map[string]interface{}, l *iothrottle.Limiter, progress func(copied uint64)) error {
+	m, ok := r.Repo.(BlocksMigrator)
+	if !ok {
+		return ErrBlocksMigrationUnsupported
+	}
+	return m.MigrateBlocks(ctx, spec, l, progress)
+}
+
+// CompressionStat returns the compression stats of the repo, if it is a
+// CompressionStater, or none.
+func (r *ref) CompressionStat(ctx context.Context) (map[string]compressds.Stat, error) {
+	s, ok := r.Repo.(CompressionStater)
+	if !ok {
+		return nil, nil
+	}
+	return s.CompressionStat(ctx)
+}
+
+// BlockFile returns the file of the block of key, if the repo is a
+// BlockFiler storing the blocks in files.
+func (r *ref) BlockFile(key ds.Key) (string, bool) {
+	f, ok := r.Repo.(BlockFiler)
+	if !ok {
+		return "", false
+	}
+	return f.BlockFile(key)
+}
+
+// PlacementDatastores returns the datastores of the placement mounts of the
+// repo, if it is a PlacementMounter, or none.
+func (r *ref) PlacementDatastores() map[string]Datastore {
+	m, ok := r.Repo.(PlacementMounter)
+	if !ok {
+		return nil
+	}
+	return m.PlacementDatastores()
+}
+
+// ReadOnly returns whether the repo is opened read-only.
+func (r *ref) ReadOnly() bool {
+	return IsReadOnly(r.Repo)
+}
 
 func (r *ref) Close() error {
 	r.parent.mu.Lock()
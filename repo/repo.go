@@ -9,12 +9,22 @@ import (
 	keystore "github.com/ipfs/go-ipfs-keystore"
 
 	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/iothrottle"
+	"github.com/ipfs/go-ipfs/repo/compressds"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
 var (
 	ErrApiNotRunning = errors.New("api not running")
+
+	// ErrBlocksMigrationUnsupported is returned when the blocks of a repo
+	// cannot be migrated to another datastore.
+	ErrBlocksMigrationUnsupported = errors.New("the blocks of this repo cannot be migrated")
+
+	// ErrReadOnly is returned by the changes of a repo opened read-only.
+	ErrReadOnly = errors.New("the repo is opened read-only")
 )
 
 // Repo represents all persistent data of a given ipfs node.
@@ -39,6 +49,10 @@ type Repo interface {
 	// Datastore returns a reference to the configured data storage backend.
 	Datastore() Datastore
 
+	// ColdDatastore returns the datastore backing the cold storage tier, or
+	// nil if none is configured.
+	ColdDatastore() Datastore
+
 	// GetStorageUsage returns the number of bytes stored.
 	GetStorageUsage(context.Context) (uint64, error)
 
@@ -57,6 +71,64 @@ type Repo interface {
 	io.Closer
 }
 
+// BlocksMigrator is implemented by the repos which can migrate their blocks
+// to another datastore while in use.
+type BlocksMigrator interface {
+	// MigrateBlocks migrates the blocks to the datastore of spec, copying
+	// them at the rate let through by l. progress, if not nil, is called
+	// with the number of blocks copied so far.
+	MigrateBlocks(ctx context.Context, spec map[string]interface{}, l *iothrottle.Limiter, progress func(copied uint64)) error
+}
+
+// CompressionStater is implemented by the repos which can compress the
+// values of their datastores.
+type CompressionStater interface {
+	// CompressionStat returns the size of the entries of the compressed
+	// datastores, as stored and once decompressed, by the mountpoint they
+	// are under.
+	CompressionStat(ctx context.Context) (map[string]compressds.Stat, error)
+}
+
+// BlockFiler is implemented by the repos which can store each block as is,
+// in a file of its own, which can then be sent from the disk without being
+// read.
+type BlockFiler interface {
+	// BlockFile returns the file the block of key, a key of the datastore,
+	// is stored in if stored at all, or false if the blocks are not stored
+	// in files.
+	BlockFile(key ds.Key) (string, bool)
+}
+
+// PlacementMounter is implemented by the repos which can store the blocks in
+// several datastores, as set by Datastore.Placement.
+type PlacementMounter interface {
+	// PlacementDatastores returns the datastores of the mounts, by name.
+	PlacementDatastores() map[string]Datastore
+}
+
+// ReadOnlyOpener is implemented by the repos which can be opened read-only.
+type ReadOnlyOpener interface {
+	// ReadOnly returns whether the repo is opened read-only, its changes
+	// failing with ErrReadOnly.
+	ReadOnly() bool
+}
+
+// IsReadOnly returns whether r is opened read-only.
+func IsReadOnly(r Repo) bool {
+	ro, ok := r.(ReadOnlyOpener)
+	return ok && ro.ReadOnly()
+}
+
+// StateDatastore returns the datastore of r, for the state a running node
+// keeps, such as its provider queue, or an empty datastore in memory when r is
+// opened read-only, this state then being lost on close.
+func StateDatastore(r Repo) Datastore {
+	if IsReadOnly(r) {
+		return dssync.MutexWrap(ds.NewMapDatastore())
+	}
+	return r.Datastore()
+}
+
 // Datastore is the interface required from a datastore to be
 // acceptable to FSRepo.
 type Datastore interface {
@@ -0,0 +1,296 @@
+// Package reprovide implements a reprovider spreading the reprovides evenly
+// over the reprovide interval, instead of reproviding all the keys at once.
+//
+// The intervals are aligned on the wall clock, and each key is reprovided at
+// the same offset in every interval, derived from its multihash and the seed
+// of the node, so the schedule holds across restarts and differs from node to
+// node. The keys of an interval are listed when it starts, and are scheduled
+// in shards, slices of the interval reprovided one after the other.
+package reprovide
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	provider "github.com/ipfs/go-ipfs-provider"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	logging "github.com/ipfs/go-log"
+	"github.com/ipfs/go-verifcid"
+	"github.com/libp2p/go-libp2p-core/routing"
+)
+
+var log = logging.Logger("reprovide")
+
+const (
+	// Shards is the number of slices of the interval.
+	Shards = 256
+	// workers is the number of keys reprovided concurrently, so that slow
+	// provides do not hold back the schedule.
+	workers = 8
+)
+
+// Pacer paces the reprovides, as the low-power mode does.
+type Pacer interface {
+	// Stretch returns the actual length of interval.
+	Stretch(interval time.Duration) time.Duration
+	// WaitAwake waits until the node may reprovide.
+	WaitAwake(ctx context.Context) error
+}
+
+// Progress is the progress of the reprovides of the current interval.
+type Progress struct {
+	// Interval is the length of the interval, Start and End its bounds.
+	Interval time.Duration
+	Start    time.Time
+	End      time.Time
+	// Shard is the index of the shard being reprovided.
+	Shard  int
+	Shards int
+	// Keys is the number of keys scheduled in the interval, Provided and
+	// Failed the number of them reprovided so far.
+	Keys     int
+	Provided int
+	Failed   int
+	// Next is when the next key is due, zero when all are.
+	Next time.Time
+	// Lag is how late the last key was reprovided.
+	Lag time.Duration
+}
+
+// Reprovider reprovides the keys of a key provider every interval, each at
+// its own offset in the interval. Reprovides that are triggered are run by
+// the reprovider it wraps, which must have no interval of its own.
+type Reprovider struct {
+	provider.Reprovider
+	rt       routing.ContentRouting
+	keys     simple.KeyChanFunc
+	interval time.Duration
+	seed     []byte
+	pacer    Pacer
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	progress Progress
+}
+
+// New returns a reprovider providing the keys of keys through rt every
+// interval, at the offsets derived from seed, and triggering the reprovides
+// of r. pacer may be nil.
+func New(ctx context.Context, r provider.Reprovider, rt routing.ContentRouting, keys simple.KeyChanFunc, interval time.Duration, seed []byte, pacer Pacer) *Reprovider {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Reprovider{
+		Reprovider: r,
+		rt:         rt,
+		keys:       keys,
+		interval:   interval,
+		seed:       seed,
+		pacer:      pacer,
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+}
+
+// Run runs the reprovider.
+func (r *Reprovider) Run() {
+	go r.Reprovider.Run()
+	defer close(r.done)
+
+	work := make(chan cid.Cid)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				r.provide(c)
+			}
+		}()
+	}
+	defer func() {
+		close(work)
+		wg.Wait()
+	}()
+
+	// like the simple reprovider, start after being up a minute
+	delay := r.interval
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	if !sleepUntil(r.ctx, time.Now().Add(delay)) {
+		return
+	}
+
+	// the keys due before the start are reprovided in the next interval
+	from := time.Now()
+	for {
+		end, err := r.reprovideInterval(from, work)
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Errorf("failed to reprovide: %s", err)
+			// retry the rest of the interval later
+			end = time.Now().Add(time.Minute)
+		}
+		if !sleepUntil(r.ctx, end) {
+			return
+		}
+		from = end
+	}
+}
+
+// Close stops the reprovider.
+func (r *Reprovider) Close() error {
+	r.cancel()
+	<-r.done
+	return r.Reprovider.Close()
+}
+
+// Progress returns the progress of the current interval.
+func (r *Reprovider) Progress() Progress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress
+}
+
+type scheduledKey struct {
+	c      cid.Cid
+	offset time.Duration
+}
+
+// reprovideInterval hands the keys due in the interval containing from, and
+// after it, to work when they are due. It returns the end of the interval.
+func (r *Reprovider) reprovideInterval(from time.Time, work chan<- cid.Cid) (time.Time, error) {
+	interval := r.interval
+	if r.pacer != nil {
+		interval = r.pacer.Stretch(interval)
+	}
+	start := from.Truncate(interval)
+	end := start.Add(interval)
+	shardLen := interval / Shards
+	if shardLen <= 0 {
+		shardLen = 1
+	}
+
+	keys, err := r.keys(r.ctx)
+	if err != nil {
+		return end, err
+	}
+	shards := make([][]scheduledKey, Shards)
+	n := 0
+	for c := range keys {
+		offset := r.offset(c, interval)
+		if start.Add(offset).Before(from) {
+			continue
+		}
+		i := int(offset / shardLen)
+		if i >= Shards {
+			i = Shards - 1
+		}
+		shards[i] = append(shards[i], scheduledKey{c, offset})
+		n++
+	}
+	if err := r.ctx.Err(); err != nil {
+		return end, err
+	}
+
+	r.mu.Lock()
+	r.progress = Progress{
+		Interval: interval,
+		Start:    start,
+		End:      end,
+		Shards:   Shards,
+		Keys:     n,
+	}
+	r.mu.Unlock()
+	log.Debugf("reprovide %d keys until %s", n, end)
+
+	for i, shard := range shards {
+		sort.Slice(shard, func(a, b int) bool { return shard[a].offset < shard[b].offset })
+		r.mu.Lock()
+		r.progress.Shard = i
+		r.mu.Unlock()
+
+		for _, k := range shard {
+			due := start.Add(k.offset)
+			r.mu.Lock()
+			r.progress.Next = due
+			r.mu.Unlock()
+
+			if !sleepUntil(r.ctx, due) {
+				return end, r.ctx.Err()
+			}
+			if r.pacer != nil {
+				if err := r.pacer.WaitAwake(r.ctx); err != nil {
+					return end, err
+				}
+			}
+			select {
+			case work <- k.c:
+			case <-r.ctx.Done():
+				return end, r.ctx.Err()
+			}
+
+			r.mu.Lock()
+			r.progress.Lag = time.Since(due)
+			r.mu.Unlock()
+		}
+		// the shard is done with
+		shards[i] = nil
+	}
+
+	r.mu.Lock()
+	r.progress.Next = time.Time{}
+	r.mu.Unlock()
+	return end, nil
+}
+
+// offset returns the offset of c in an interval.
+func (r *Reprovider) offset(c cid.Cid, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	_, _ = h.Write(r.seed)
+	_, _ = h.Write(c.Hash())
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+func (r *Reprovider) provide(c cid.Cid) {
+	// hash security
+	err := verifcid.ValidateCid(c)
+	if err != nil {
+		log.Errorf("insecure hash in reprovider, %s (%s)", c, err)
+	} else if err = r.rt.Provide(r.ctx, c, true); err != nil {
+		log.Debugf("failed to reprovide %s: %s", c, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.progress.Failed++
+	} else {
+		r.progress.Provided++
+	}
+}
+
+// sleepUntil waits until t, and returns false if ctx is canceled first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+package reprovide
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-ipfs-provider/simple"
+	dag "github.com/ipfs/go-merkledag"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+type mockRouting struct {
+	mu       sync.Mutex
+	provides map[cid.Cid][]time.Time
+}
+
+func (m *mockRouting) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.provides[c] = append(m.provides[c], time.Now())
+	return nil
+}
+
+func (m *mockRouting) FindProvidersAsync(ctx context.Context, c cid.Cid, n int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
+
+func testKeys(n int) []cid.Cid {
+	keys := make([]cid.Cid, n)
+	for i := range keys {
+		keys[i] = dag.NodeWithData([]byte(fmt.Sprint(i))).Cid()
+	}
+	return keys
+}
+
+func keyChan(keys []cid.Cid) simple.KeyChanFunc {
+	return func(ctx context.Context) (<-chan cid.Cid, error) {
+		ch := make(chan cid.Cid, len(keys))
+		for _, c := range keys {
+			ch <- c
+		}
+		close(ch)
+		return ch, nil
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	keys := testKeys(2000)
+	r := New(context.Background(), nil, nil, keyChan(keys), time.Hour, []byte("seed"), nil)
+	other := New(context.Background(), nil, nil, keyChan(keys), time.Hour, []byte("other seed"), nil)
+
+	shards := make(map[time.Duration]bool)
+	same := 0
+	for _, c := range keys {
+		offset := r.offset(c, time.Hour)
+		if offset < 0 || offset >= time.Hour {
+			t.Fatalf("offset %s out of the interval", offset)
+		}
+		if offset != r.offset(c, time.Hour) {
+			t.Fatal("offsets are not deterministic")
+		}
+		if offset == other.offset(c, time.Hour) {
+			same++
+		}
+		shards[offset/(time.Hour/Shards)] = true
+	}
+	if same > 1 {
+		t.Fatalf("%d keys have the same offset with another seed", same)
+	}
+	// 2000 keys leave few of the 256 shards empty
+	if len(shards) < Shards*9/10 {
+		t.Fatalf("keys spread over %d shards only", len(shards))
+	}
+}
+
+func TestReprovider(t *testing.T) {
+	keys := testKeys(50)
+	rt := &mockRouting{provides: make(map[cid.Cid][]time.Time)}
+	interval := 500 * time.Millisecond
+	ctx := context.Background()
+	r := New(ctx, simple.NewReprovider(ctx, 0, rt, keyChan(keys)), rt, keyChan(keys), interval, []byte("seed"), nil)
+	go r.Run()
+	defer r.Close()
+
+	// the first interval is partial, all are reprovided in the next one
+	time.Sleep(4 * interval)
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var first time.Time
+	var last time.Time
+	for _, c := range keys {
+		times := rt.provides[c]
+		if len(times) == 0 {
+			t.Fatalf("%s was not reprovided", c)
+		}
+		for i := 1; i < len(times); i++ {
+			if d := times[i].Sub(times[i-1]); d < interval*8/10 || d > interval*12/10 {
+				t.Fatalf("%s reprovided %s apart", c, d)
+			}
+		}
+		if first.IsZero() || times[0].Before(first) {
+			first = times[0]
+		}
+		if times[0].After(last) {
+			last = times[0]
+		}
+	}
+	// not all at once
+	if last.Sub(first) < interval/4 {
+		t.Fatalf("reprovides were not spread: all within %s", last.Sub(first))
+	}
+
+	p := r.Progress()
+	if p.Interval != interval || p.Shards != Shards || !p.End.Equal(p.Start.Add(interval)) || p.Failed != 0 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+}
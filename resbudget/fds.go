@@ -0,0 +1,22 @@
+package resbudget
+
+import "os"
+
+// readFds counts the open file descriptors of the process, listed in
+// /proc/self/fd on Linux, and /dev/fd on the BSDs and macOS.
+func readFds() (int, error) {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		f, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+		// less the descriptor of the directory read
+		return len(names) - 1, nil
+	}
+	return 0, errUnsupported
+}
@@ -0,0 +1,297 @@
+// Package resbudget counts the file descriptors, goroutines and sockets of the
+// node, exported as metrics, against soft limits set below the hard limits of
+// the OS.
+//
+// The resources are counted regularly. When one goes over its soft limit, a
+// warning is logged, and the functions registered with OnOverLimit are called
+// on every count until it is back under, such as to trim the connections to
+// the peers. This leaves room to act before the node fails to open files or
+// accept connections.
+package resbudget
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var log = logging.Logger("resbudget")
+
+// errUnsupported is returned by the readers of the resources not counted on
+// this OS.
+var errUnsupported = errors.New("not supported on this OS")
+
+// The resources with a soft limit.
+const (
+	FileDescriptors = "fds"
+	Goroutines      = "goroutines"
+	Sockets         = "sockets"
+)
+
+var (
+	openFds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_fds_open",
+		Help: "open file descriptors of the process",
+	})
+	fdsLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "ipfs_fds_limit",
+		Help: "limit of the open file descriptors of the process set by the OS",
+	})
+	goroutines = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_goroutines",
+		Help: "goroutines of the process, by the subsystem that started them",
+	}, []string{"subsystem"})
+	sockets = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_sockets",
+		Help: "TCP and UDP sockets of the process, by state",
+	}, []string{"proto", "state"})
+	softLimits = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ipfs_resource_soft_limit",
+		Help: "soft limits of the resources of the process",
+	}, []string{"resource"})
+	overLimit = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ipfs_resource_soft_limit_exceeded_total",
+		Help: "times the resources of the process went over their soft limit",
+	}, []string{"resource"})
+)
+
+// Limits are the soft limits of the resources, 0 meaning no limit.
+type Limits struct {
+	// FileDescriptors is the fraction of the limit of the OS.
+	FileDescriptors float64
+	Goroutines      int
+	Sockets         int
+}
+
+// Socket is the protocol, tcp or udp, and the state of a socket.
+type Socket struct {
+	Proto string
+	State string
+}
+
+// Usage is the state of the resources as of the last count.
+type Usage struct {
+	// FileDescriptors is the number of open file descriptors, and
+	// FileDescriptorsLimit their limit set by the OS, 0 if unknown.
+	FileDescriptors      int
+	FileDescriptorsLimit uint64
+	// Goroutines are counted by subsystem.
+	Goroutines map[string]int
+	// Sockets are counted by protocol and state, on Linux only.
+	Sockets map[Socket]int
+	// Over are the resources over their soft limit.
+	Over []string
+}
+
+// Budget counts the resources of the process against their soft limits.
+type Budget struct {
+	limits Limits
+	// the readers of the resources
+	readFds        func() (int, error)
+	readFdsLimit   func() uint64
+	readGoroutines func() map[string]int
+	readSockets    func() (map[Socket]int, error)
+
+	mu    sync.Mutex
+	usage Usage
+	over  map[string]bool
+
+	hooksMu sync.Mutex
+	hooks   []func()
+}
+
+// New returns a budget of the given soft limits. It starts counting once Run
+// is called.
+func New(limits Limits) *Budget {
+	if limits.Goroutines > 0 {
+		softLimits.WithLabelValues(Goroutines).Set(float64(limits.Goroutines))
+	}
+	if limits.Sockets > 0 {
+		softLimits.WithLabelValues(Sockets).Set(float64(limits.Sockets))
+	}
+	return &Budget{
+		limits:         limits,
+		readFds:        readFds,
+		readFdsLimit:   readFdsLimit,
+		readGoroutines: countGoroutines,
+		readSockets:    readSockets,
+		over:           make(map[string]bool),
+	}
+}
+
+// OnOverLimit registers f to be called on every count while a resource is
+// over its soft limit, to release some, such as connections.
+func (b *Budget) OnOverLimit(f func()) {
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+	b.hooks = append(b.hooks, f)
+}
+
+// Run counts the resources every interval until ctx is canceled.
+func (b *Budget) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		b.Sample()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Sample counts the resources, updates their metrics, and checks them against
+// their soft limits.
+func (b *Budget) Sample() {
+	usage := Usage{FileDescriptors: -1}
+	counts := make(map[string]int, 3)
+	limits := make(map[string]int, 3)
+
+	if fds, err := b.readFds(); err == nil {
+		usage.FileDescriptors = fds
+		usage.FileDescriptorsLimit = b.readFdsLimit()
+		openFds.Set(float64(fds))
+		if usage.FileDescriptorsLimit > 0 {
+			fdsLimit.Set(float64(usage.FileDescriptorsLimit))
+			if b.limits.FileDescriptors > 0 {
+				counts[FileDescriptors] = fds
+				limits[FileDescriptors] = int(b.limits.FileDescriptors * float64(usage.FileDescriptorsLimit))
+				softLimits.WithLabelValues(FileDescriptors).Set(float64(limits[FileDescriptors]))
+			}
+		}
+	}
+
+	usage.Goroutines = b.readGoroutines()
+	goroutines.Reset()
+	total := 0
+	for s, n := range usage.Goroutines {
+		goroutines.WithLabelValues(s).Set(float64(n))
+		total += n
+	}
+	if b.limits.Goroutines > 0 {
+		counts[Goroutines] = total
+		limits[Goroutines] = b.limits.Goroutines
+	}
+
+	if socks, err := b.readSockets(); err == nil {
+		usage.Sockets = socks
+		sockets.Reset()
+		total := 0
+		for s, n := range socks {
+			sockets.WithLabelValues(s.Proto, s.State).Set(float64(n))
+			total += n
+		}
+		if b.limits.Sockets > 0 {
+			counts[Sockets] = total
+			limits[Sockets] = b.limits.Sockets
+		}
+	}
+
+	b.mu.Lock()
+	for r, limit := range limits {
+		n := counts[r]
+		switch over := n >= limit; {
+		case over && !b.over[r]:
+			overLimit.WithLabelValues(r).Inc()
+			log.Warnf("%d %s, over the soft limit of %d", n, r, limit)
+		case !over && b.over[r]:
+			log.Infof("%d %s, back under the soft limit of %d", n, r, limit)
+		}
+		b.over[r] = n >= limit
+	}
+	for r, over := range b.over {
+		if over {
+			usage.Over = append(usage.Over, r)
+		}
+	}
+	sort.Strings(usage.Over)
+	b.usage = usage
+	b.mu.Unlock()
+
+	if len(usage.Over) == 0 {
+		return
+	}
+	b.hooksMu.Lock()
+	defer b.hooksMu.Unlock()
+	for _, f := range b.hooks {
+		f()
+	}
+}
+
+// Usage returns the state of the resources as of the last count.
+func (b *Budget) Usage() Usage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.usage
+}
+
+// subsystems map the packages the goroutines are started in to the subsystem
+// they are counted under, the first prefix matching.
+var subsystems = []struct{ prefix, name string }{
+	{"github.com/ipfs/go-bitswap", "bitswap"},
+	{"github.com/ipfs/go-graphsync", "graphsync"},
+	{"github.com/libp2p/go-libp2p-kad-dht", "dht"},
+	{"github.com/libp2p/go-libp2p-kbucket", "dht"},
+	{"github.com/libp2p/go-libp2p-pubsub", "pubsub"},
+	{"github.com/libp2p/", "libp2p"},
+	{"github.com/lucas-clemente/quic-go", "libp2p"},
+	{"github.com/marten-seemann/", "libp2p"},
+	{"github.com/ipfs/go-ipfs/core/corehttp", "http"},
+	{"github.com/ipfs/go-ipfs-cmds", "http"},
+	{"net/http", "http"},
+	{"github.com/ipfs/go-ipfs-provider", "provider"},
+	{"github.com/ipfs/go-datastore", "datastore"},
+	{"github.com/ipfs/go-ds-", "datastore"},
+	{"github.com/dgraph-io/badger", "datastore"},
+	{"github.com/syndtr/goleveldb", "datastore"},
+	{"github.com/ipfs/", "ipfs"},
+}
+
+// subsystem returns the subsystem of the function a goroutine was started
+// with: the outermost frame of its stack, as recorded.
+func subsystem(stack []uintptr) string {
+	var fn string
+	frames := runtime.CallersFrames(stack)
+	for more := true; more; {
+		var f runtime.Frame
+		f, more = frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, "runtime.") {
+			fn = f.Function
+		}
+	}
+	for _, s := range subsystems {
+		if strings.HasPrefix(fn, s.prefix) {
+			return s.name
+		}
+	}
+	return "other"
+}
+
+// countGoroutines counts the goroutines of the process by subsystem.
+func countGoroutines() map[string]int {
+	n, _ := runtime.GoroutineProfile(nil)
+	var records []runtime.StackRecord
+	for {
+		// room for the goroutines started in between
+		records = make([]runtime.StackRecord, n+n/10+10)
+		var ok bool
+		if n, ok = runtime.GoroutineProfile(records); ok {
+			break
+		}
+	}
+	counts := make(map[string]int)
+	for _, r := range records[:n] {
+		counts[subsystem(r.Stack())]++
+	}
+	return counts
+}
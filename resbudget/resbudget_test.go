@@ -0,0 +1,90 @@
+package resbudget
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSoftLimits(t *testing.T) {
+	fds, gs, socks := 50, 10, 5
+	b := New(Limits{FileDescriptors: 0.9, Goroutines: 100, Sockets: 20})
+	b.readFds = func() (int, error) { return fds, nil }
+	b.readFdsLimit = func() uint64 { return 100 }
+	b.readGoroutines = func() map[string]int { return map[string]int{"bitswap": gs, "other": 1} }
+	b.readSockets = func() (map[Socket]int, error) {
+		return map[Socket]int{{"tcp", "established"}: socks}, nil
+	}
+
+	shed := 0
+	b.OnOverLimit(func() { shed++ })
+
+	b.Sample()
+	if u := b.Usage(); len(u.Over) != 0 || u.FileDescriptors != 50 || u.FileDescriptorsLimit != 100 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+
+	fds, socks = 90, 25
+	b.Sample()
+	if u := b.Usage(); !reflect.DeepEqual(u.Over, []string{FileDescriptors, Sockets}) {
+		t.Fatalf("expected fds and sockets over their limit, got %v", u.Over)
+	}
+	b.Sample()
+	if shed != 2 {
+		t.Fatalf("expected the hooks called on every count over the limit, got %d", shed)
+	}
+
+	fds, socks, gs = 10, 5, 99
+	b.Sample()
+	if u := b.Usage(); !reflect.DeepEqual(u.Over, []string{Goroutines}) {
+		t.Fatalf("expected the goroutines over their limit, got %v", u.Over)
+	}
+
+	gs = 0
+	b.Sample()
+	if u := b.Usage(); len(u.Over) != 0 {
+		t.Fatalf("expected all back under their limit, got %v", u.Over)
+	}
+	if shed != 3 {
+		t.Fatalf("expected no hooks called under the limits, got %d", shed)
+	}
+}
+
+func TestNoLimits(t *testing.T) {
+	b := New(Limits{})
+	b.readFds = func() (int, error) { return 1 << 20, nil }
+	b.readFdsLimit = func() uint64 { return 1024 }
+	b.OnOverLimit(func() { t.Fatal("hook called without limits") })
+
+	b.Sample()
+	if u := b.Usage(); len(u.Over) != 0 {
+		t.Fatalf("unexpected usage: %+v", u)
+	}
+}
+
+func TestCountGoroutines(t *testing.T) {
+	counts := countGoroutines()
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 || total > runtime.NumGoroutine()+10 {
+		t.Fatalf("counted %d goroutines out of %d: %v", total, runtime.NumGoroutine(), counts)
+	}
+}
+
+func TestReadFds(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("counted on Linux only")
+	}
+	n, err := readFds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n < 3 {
+		t.Fatalf("expected at least the standard descriptors, got %d", n)
+	}
+	if _, err := readSockets(); err != nil {
+		t.Fatal(err)
+	}
+}
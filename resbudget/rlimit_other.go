@@ -0,0 +1,10 @@
+//go:build !darwin && !linux && !netbsd && !openbsd
+// +build !darwin,!linux,!netbsd,!openbsd
+
+package resbudget
+
+// readFdsLimit returns 0, the limit of the open file descriptors being
+// unknown on this OS.
+func readFdsLimit() uint64 {
+	return 0
+}
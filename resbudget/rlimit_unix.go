@@ -0,0 +1,18 @@
+//go:build darwin || linux || netbsd || openbsd
+// +build darwin linux netbsd openbsd
+
+package resbudget
+
+import (
+	unix "golang.org/x/sys/unix"
+)
+
+// readFdsLimit returns the soft limit of the open file descriptors of the
+// process, 0 if unknown.
+func readFdsLimit() uint64 {
+	rlimit := unix.Rlimit{}
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0
+	}
+	return rlimit.Cur
+}
@@ -0,0 +1,84 @@
+package resbudget
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// tcpStates names the states of the TCP sockets as listed in /proc/net/tcp.
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "syn_sent",
+	"03": "syn_recv",
+	"04": "fin_wait1",
+	"05": "fin_wait2",
+	"06": "time_wait",
+	"07": "close",
+	"08": "close_wait",
+	"09": "last_ack",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+// readSockets counts the TCP and UDP sockets of the process by state: those
+// of /proc/self/net whose inode is among the open file descriptors.
+func readSockets() (map[Socket]int, error) {
+	fds, err := filepath.Glob("/proc/self/fd/*")
+	if err != nil {
+		return nil, err
+	}
+	inodes := make(map[string]struct{}, len(fds))
+	for _, fd := range fds {
+		link, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inodes[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = struct{}{}
+	}
+
+	counts := make(map[Socket]int)
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open("/proc/self/net/" + proto)
+		if err != nil {
+			continue
+		}
+		err = countSockets(f, strings.TrimSuffix(proto, "6"), inodes, counts)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// countSockets counts the sockets listed in a /proc/net table whose inode is
+// among inodes.
+func countSockets(f *os.File, proto string, inodes map[string]struct{}, counts map[Socket]int) error {
+	s := bufio.NewScanner(f)
+	// the first line names the columns
+	s.Scan()
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		if _, ok := inodes[fields[9]]; !ok {
+			continue
+		}
+		state := "unknown"
+		switch {
+		case proto == "udp" && fields[3] == "01":
+			state = "connected"
+		case proto == "udp":
+			state = "unconnected"
+		default:
+			if name, ok := tcpStates[fields[3]]; ok {
+				state = name
+			}
+		}
+		counts[Socket{Proto: proto, State: state}]++
+	}
+	return s.Err()
+}
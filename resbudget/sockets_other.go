@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package resbudget
+
+// readSockets is not supported but on Linux.
+func readSockets() (map[Socket]int, error) {
+	return nil, errUnsupported
+}
@@ -0,0 +1,448 @@
+// Package speedtest measures the latency and the throughput of the libp2p
+// connection to a cooperating peer, serving the test, apart from bitswap: a
+// transfer slower than the speed test is slowed by bitswap or by the peers
+// providing the data, not by the network.
+//
+// Each stream of a test starts with a JSON request, naming the test and its
+// duration, answered with a JSON response granting the duration, capped by
+// the server, or refusing the test. The peer then echoes the pings of the
+// latency test, sends data for the download test, or counts the data
+// received for the upload test, which it reports once the client closes the
+// stream for writing.
+package speedtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+)
+
+var log = logging.Logger("speedtest")
+
+// ID is the protocol the speed test runs over.
+const ID protocol.ID = "/ipfs/speedtest/1.0.0"
+
+const (
+	opLatency  = "latency"
+	opDownload = "download"
+	opUpload   = "upload"
+
+	// pings is the number of pings of the latency test.
+	pings    = 10
+	pingSize = 32
+	// chunkSize is the size of the writes of the download and upload tests.
+	chunkSize = 64 << 10
+	// timeout bounds the exchanges besides the transfers.
+	timeout = 10 * time.Second
+	// maxLine bounds the JSON requests and responses.
+	maxLine = 1 << 10
+)
+
+// ErrRefused is returned when the peer does not serve the speed test, or is
+// running as many tests as it serves at once.
+var ErrRefused = errors.New("the peer refused the speed test")
+
+type request struct {
+	Op       string
+	Duration time.Duration
+}
+
+type response struct {
+	// Error is set when the test is refused.
+	Error string `json:",omitempty"`
+	// Duration is the duration of the transfer granted.
+	Duration time.Duration `json:",omitempty"`
+	// Bytes is the number of bytes received by the upload test, sent once
+	// it is done.
+	Bytes uint64 `json:",omitempty"`
+}
+
+// Settings configures the server of the speed test.
+type Settings struct {
+	// MaxDuration caps the duration of the transfers.
+	MaxDuration time.Duration
+	// MaxStreams is the number of streams tested at once, all peers
+	// included.
+	MaxStreams int
+}
+
+// Server serves the speed test to the peers of its host.
+type Server struct {
+	h        host.Host
+	settings Settings
+
+	mu     sync.Mutex
+	active int
+}
+
+// NewServer returns the server of the speed test of h, serving it.
+func NewServer(h host.Host, s Settings) *Server {
+	srv := &Server{h: h, settings: s}
+	h.SetStreamHandler(ID, srv.handleStream)
+	return srv
+}
+
+// Close stops serving the speed test.
+func (srv *Server) Close() error {
+	srv.h.RemoveStreamHandler(ID)
+	return nil
+}
+
+func (srv *Server) handleStream(s network.Stream) {
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(s)
+	var req request
+	if err := readJSON(r, &req); err != nil {
+		s.Reset()
+		return
+	}
+
+	d := req.Duration
+	if d <= 0 || d > srv.settings.MaxDuration {
+		d = srv.settings.MaxDuration
+	}
+	switch req.Op {
+	case opLatency, opDownload, opUpload:
+	default:
+		writeJSON(s, &response{Error: fmt.Sprintf("unknown test %q", req.Op)})
+		return
+	}
+	if !srv.acquire() {
+		writeJSON(s, &response{Error: "too many speed tests running"})
+		return
+	}
+	defer srv.release()
+	if err := writeJSON(s, &response{Duration: d}); err != nil {
+		s.Reset()
+		return
+	}
+
+	log.Debugf("%s test of %s for %s", req.Op, s.Conn().RemotePeer(), d)
+	var err error
+	switch req.Op {
+	case opLatency:
+		err = serveLatency(s, r)
+	case opDownload:
+		err = serveDownload(s, d)
+	case opUpload:
+		err = serveUpload(s, r, d)
+	}
+	if err != nil {
+		log.Debugf("%s test of %s: %s", req.Op, s.Conn().RemotePeer(), err)
+		s.Reset()
+	}
+}
+
+func (srv *Server) acquire() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.active >= srv.settings.MaxStreams {
+		return false
+	}
+	srv.active++
+	return true
+}
+
+func (srv *Server) release() {
+	srv.mu.Lock()
+	srv.active--
+	srv.mu.Unlock()
+}
+
+// serveLatency echoes the pings.
+func serveLatency(s network.Stream, r io.Reader) error {
+	buf := make([]byte, pingSize)
+	for i := 0; i < pings; i++ {
+		s.SetDeadline(time.Now().Add(timeout))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		if _, err := s.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveDownload sends data for d.
+func serveDownload(s network.Stream, d time.Duration) error {
+	end := time.Now().Add(d)
+	s.SetDeadline(end.Add(timeout))
+	buf := randomChunk()
+	for time.Now().Before(end) {
+		if _, err := s.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serveUpload counts the data received until the client closes the stream
+// for writing, and reports it.
+func serveUpload(s network.Stream, r io.Reader, d time.Duration) error {
+	s.SetDeadline(time.Now().Add(d + timeout))
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	return writeJSON(s, &response{Bytes: uint64(n)})
+}
+
+// Options configures a speed test.
+type Options struct {
+	// Duration is the duration of the download and upload tests, capped by
+	// the peer.
+	Duration time.Duration
+	// Streams is the number of streams of the download and upload tests.
+	Streams int
+}
+
+// Result is the result of a speed test.
+type Result struct {
+	Peer peer.ID
+	// Addr is the address of the connection tested.
+	Addr string
+	// Streams is the number of streams of the download and upload tests.
+	Streams int
+	// The latencies of the pings.
+	MinLatency, AvgLatency, MaxLatency time.Duration
+	Download                           Transfer
+	Upload                             Transfer
+}
+
+// Transfer is the result of the download or upload test.
+type Transfer struct {
+	// Bytes is the number of bytes transferred by all the streams.
+	Bytes    uint64
+	Duration time.Duration
+	// Rate is the throughput, in bytes per second.
+	Rate float64
+}
+
+// Run runs the speed test with p, which h must be able to connect to, and
+// which must serve it.
+func Run(ctx context.Context, h host.Host, p peer.ID, opts Options) (*Result, error) {
+	if opts.Streams <= 0 {
+		return nil, errors.New("the number of streams must be positive")
+	}
+	res := &Result{Peer: p, Streams: opts.Streams}
+	if err := runLatency(ctx, h, res); err != nil {
+		return nil, fmt.Errorf("latency test: %w", err)
+	}
+	var err error
+	if res.Download, err = runTransfer(ctx, h, p, opDownload, opts); err != nil {
+		return nil, fmt.Errorf("download test: %w", err)
+	}
+	if res.Upload, err = runTransfer(ctx, h, p, opUpload, opts); err != nil {
+		return nil, fmt.Errorf("upload test: %w", err)
+	}
+	return res, nil
+}
+
+// open opens a stream to p for the test op, and returns the duration the
+// peer grants.
+func open(ctx context.Context, h host.Host, p peer.ID, op string, d time.Duration) (network.Stream, *bufio.Reader, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	s, err := h.NewStream(ctx, p, ID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	s.SetDeadline(time.Now().Add(timeout))
+	r := bufio.NewReader(s)
+	var resp response
+	if err := writeJSON(s, &request{Op: op, Duration: d}); err != nil {
+		s.Reset()
+		return nil, nil, 0, err
+	}
+	if err := readJSON(r, &resp); err != nil {
+		s.Reset()
+		return nil, nil, 0, err
+	}
+	if resp.Error != "" {
+		s.Reset()
+		return nil, nil, 0, fmt.Errorf("%w: %s", ErrRefused, resp.Error)
+	}
+	return s, r, resp.Duration, nil
+}
+
+func runLatency(ctx context.Context, h host.Host, res *Result) error {
+	s, r, _, err := open(ctx, h, res.Peer, opLatency, 0)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	res.Addr = s.Conn().RemoteMultiaddr().String()
+
+	ping := make([]byte, pingSize)
+	pong := make([]byte, pingSize)
+	var total time.Duration
+	for i := 0; i < pings; i++ {
+		if err := ctx.Err(); err != nil {
+			s.Reset()
+			return err
+		}
+		rand.Read(ping)
+		s.SetDeadline(time.Now().Add(timeout))
+		start := time.Now()
+		if _, err := s.Write(ping); err != nil {
+			s.Reset()
+			return err
+		}
+		if _, err := io.ReadFull(r, pong); err != nil {
+			s.Reset()
+			return err
+		}
+		rtt := time.Since(start)
+		if string(ping) != string(pong) {
+			s.Reset()
+			return errors.New("the peer answered another ping")
+		}
+		total += rtt
+		if res.MinLatency == 0 || rtt < res.MinLatency {
+			res.MinLatency = rtt
+		}
+		if rtt > res.MaxLatency {
+			res.MaxLatency = rtt
+		}
+	}
+	res.AvgLatency = total / pings
+	return nil
+}
+
+// runTransfer runs the download or upload test over opts.Streams streams,
+// at the same time.
+func runTransfer(ctx context.Context, h host.Host, p peer.ID, op string, opts Options) (Transfer, error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		total   uint64
+		longest time.Duration
+		first   error
+	)
+	for i := 0; i < opts.Streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, d, err := transfer(ctx, h, p, op, opts.Duration)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if first == nil {
+					first = err
+				}
+				return
+			}
+			total += n
+			if d > longest {
+				longest = d
+			}
+		}()
+	}
+	wg.Wait()
+	if first != nil {
+		return Transfer{}, first
+	}
+	t := Transfer{Bytes: total, Duration: longest}
+	if longest > 0 {
+		t.Rate = float64(total) / longest.Seconds()
+	}
+	return t, nil
+}
+
+// transfer runs the test op over a stream, returning the number of bytes
+// transferred and how long it took.
+func transfer(ctx context.Context, h host.Host, p peer.ID, op string, d time.Duration) (uint64, time.Duration, error) {
+	s, r, granted, err := open(ctx, h, p, op, d)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer s.Close()
+	// the stream is reset when the test is interrupted
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Reset()
+		case <-stop:
+		}
+	}()
+
+	start := time.Now()
+	s.SetDeadline(start.Add(granted + timeout))
+	if op == opDownload {
+		n, err := io.Copy(io.Discard, r)
+		if err != nil {
+			s.Reset()
+			return 0, 0, err
+		}
+		return uint64(n), time.Since(start), nil
+	}
+
+	buf := randomChunk()
+	end := start.Add(granted)
+	for time.Now().Before(end) {
+		if _, err := s.Write(buf); err != nil {
+			s.Reset()
+			return 0, 0, err
+		}
+	}
+	if err := s.CloseWrite(); err != nil {
+		s.Reset()
+		return 0, 0, err
+	}
+	var resp response
+	if err := readJSON(r, &resp); err != nil {
+		s.Reset()
+		return 0, 0, err
+	}
+	return resp.Bytes, time.Since(start), nil
+}
+
+// randomChunk returns data which the transports cannot compress.
+func randomChunk() []byte {
+	buf := make([]byte, chunkSize)
+	rand.Read(buf)
+	return buf
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func readJSON(r *bufio.Reader, v interface{}) error {
+	var line []byte
+	for {
+		part, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return err
+		}
+		line = append(line, part...)
+		if len(line) > maxLine {
+			return errors.New("line too long")
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	return json.Unmarshal(line, v)
+}
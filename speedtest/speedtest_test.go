@@ -0,0 +1,53 @@
+package speedtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+)
+
+func TestSpeedTest(t *testing.T) {
+	mn, err := mocknet.FullMeshConnected(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := mn.Hosts()
+	srv := NewServer(hosts[1], Settings{MaxDuration: 100 * time.Millisecond, MaxStreams: 2})
+	defer srv.Close()
+	ctx := context.Background()
+
+	// the duration asked is capped by the server
+	start := time.Now()
+	res, err := Run(ctx, hosts[0], hosts[1].ID(), Options{Duration: time.Hour, Streams: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("expected the duration capped, took %s", time.Since(start))
+	}
+	if res.Peer != hosts[1].ID() || res.Addr == "" || res.Streams != 2 {
+		t.Errorf("expected the peer tested, got %+v", res)
+	}
+	if res.MinLatency <= 0 || res.MinLatency > res.AvgLatency || res.AvgLatency > res.MaxLatency {
+		t.Errorf("expected the latencies measured, got %s, %s, %s", res.MinLatency, res.AvgLatency, res.MaxLatency)
+	}
+	for name, tr := range map[string]Transfer{"download": res.Download, "upload": res.Upload} {
+		if tr.Bytes < chunkSize || tr.Duration < 100*time.Millisecond || tr.Rate <= 0 {
+			t.Errorf("expected the %s measured, got %+v", name, tr)
+		}
+	}
+
+	// the streams tested at once are limited
+	if _, err := Run(ctx, hosts[0], hosts[1].ID(), Options{Duration: time.Second, Streams: 3}); !errors.Is(err, ErrRefused) {
+		t.Errorf("expected the third stream refused, got %v", err)
+	}
+
+	// the test fails once not served
+	srv.Close()
+	if _, err := Run(ctx, hosts[0], hosts[1].ID(), Options{Duration: time.Second, Streams: 1}); err == nil {
+		t.Error("expected the speed test failing when not served")
+	}
+}
@@ -0,0 +1,56 @@
+package tenants
+
+import (
+	"context"
+
+	blocks "github.com/ipfs/go-block-format"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// Blockstore accounts for the new blocks stored by the tenants.
+type Blockstore struct {
+	bstore.Blockstore
+	a *Accountant
+}
+
+// NewBlockstore returns bs, accounting with a for the blocks stored in it.
+func NewBlockstore(bs bstore.Blockstore, a *Accountant) *Blockstore {
+	return &Blockstore{Blockstore: bs, a: a}
+}
+
+// Put stores b, accounting for it if it is new.
+func (bs *Blockstore) Put(ctx context.Context, b blocks.Block) error {
+	if FromContext(ctx) == "" {
+		return bs.Blockstore.Put(ctx, b)
+	}
+	n := bs.newSize(ctx, b)
+	if err := bs.Blockstore.Put(ctx, b); err != nil {
+		return err
+	}
+	bs.a.Stored(ctx, n)
+	return nil
+}
+
+// PutMany stores blks, accounting for the new ones.
+func (bs *Blockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	if FromContext(ctx) == "" {
+		return bs.Blockstore.PutMany(ctx, blks)
+	}
+	n := 0
+	for _, b := range blks {
+		n += bs.newSize(ctx, b)
+	}
+	if err := bs.Blockstore.PutMany(ctx, blks); err != nil {
+		return err
+	}
+	bs.a.Stored(ctx, n)
+	return nil
+}
+
+// newSize returns the size of b, or 0 if it is stored already.
+func (bs *Blockstore) newSize(ctx context.Context, b blocks.Block) int {
+	if has, err := bs.Blockstore.Has(ctx, b.Cid()); err == nil && has {
+		return 0
+	}
+	return len(b.RawData())
+}
@@ -0,0 +1,140 @@
+package tenants
+
+import (
+	"context"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Pinner records the owners of the pins made by the tenants.
+type Pinner struct {
+	pin.Pinner
+	a *Accountant
+
+	// PinWithMode and RemovePinWithMode carry no context, so their pins
+	// are accounted for by the Flush that follows them
+	mu      sync.Mutex
+	added   []cid.Cid
+	removed []cid.Cid
+}
+
+// NewPinner returns p, accounting for its pins with a.
+func NewPinner(p pin.Pinner, a *Accountant) *Pinner {
+	return &Pinner{Pinner: p, a: a}
+}
+
+func ownerKey(c cid.Cid) ds.Key {
+	return pinsKey.ChildString(c.String())
+}
+
+// own makes tenant the owner of the pin of c, unless it has one.
+func (p *Pinner) own(ctx context.Context, tenant string, c cid.Cid) {
+	if tenant == "" {
+		return
+	}
+	k := ownerKey(c)
+	has, err := p.a.dstore.Has(ctx, k)
+	if err == nil && !has {
+		err = p.a.dstore.Put(ctx, k, []byte(tenant))
+	}
+	if err != nil {
+		log.Errorf("recording the owner of the pin of %s: %s", c, err)
+		return
+	}
+	if !has {
+		p.a.pinned(tenant, 1)
+	}
+}
+
+// release removes the owner of the pin of c, and returns it.
+func (p *Pinner) release(ctx context.Context, c cid.Cid) string {
+	k := ownerKey(c)
+	owner, err := p.a.dstore.Get(ctx, k)
+	if err == ds.ErrNotFound {
+		return ""
+	}
+	if err == nil {
+		err = p.a.dstore.Delete(ctx, k)
+	}
+	if err != nil {
+		log.Errorf("removing the owner of the pin of %s: %s", c, err)
+		return ""
+	}
+	p.a.pinned(string(owner), -1)
+	return string(owner)
+}
+
+// Pin pins node for the tenant of ctx.
+func (p *Pinner) Pin(ctx context.Context, node ipld.Node, recursive bool) error {
+	if err := p.Pinner.Pin(ctx, node, recursive); err != nil {
+		return err
+	}
+	p.own(ctx, FromContext(ctx), node.Cid())
+	return nil
+}
+
+// Unpin unpins c, whoever owns it.
+func (p *Pinner) Unpin(ctx context.Context, c cid.Cid, recursive bool) error {
+	if err := p.Pinner.Unpin(ctx, c, recursive); err != nil {
+		return err
+	}
+	p.release(ctx, c)
+	return nil
+}
+
+// Update moves the pin of from to to, for the tenant of ctx, or else for the
+// owner of the pin of from if it is removed.
+func (p *Pinner) Update(ctx context.Context, from, to cid.Cid, unpin bool) error {
+	if err := p.Pinner.Update(ctx, from, to, unpin); err != nil {
+		return err
+	}
+	owner := FromContext(ctx)
+	if unpin {
+		if prev := p.release(ctx, from); owner == "" {
+			owner = prev
+		}
+	}
+	p.own(ctx, owner, to)
+	return nil
+}
+
+// PinWithMode pins c, for the tenant of the next Flush.
+func (p *Pinner) PinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.PinWithMode(c, mode)
+	p.mu.Lock()
+	p.added = append(p.added, c)
+	p.mu.Unlock()
+}
+
+// RemovePinWithMode unpins c, whoever owns it.
+func (p *Pinner) RemovePinWithMode(c cid.Cid, mode pin.Mode) {
+	p.Pinner.RemovePinWithMode(c, mode)
+	p.mu.Lock()
+	p.removed = append(p.removed, c)
+	p.mu.Unlock()
+}
+
+// Flush flushes the pins, accounting for those made with PinWithMode and
+// RemovePinWithMode for the tenant of ctx.
+func (p *Pinner) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	added, removed := p.added, p.removed
+	p.added, p.removed = nil, nil
+	p.mu.Unlock()
+
+	if err := p.Pinner.Flush(ctx); err != nil {
+		return err
+	}
+	for _, c := range removed {
+		p.release(ctx, c)
+	}
+	tenant := FromContext(ctx)
+	for _, c := range added {
+		p.own(ctx, tenant, c)
+	}
+	return nil
+}
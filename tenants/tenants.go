@@ -0,0 +1,228 @@
+// Package tenants accounts for the resources used by each tenant of a shared
+// node, a tenant being one of the authorizations of its RPC API.
+//
+// For each tenant, the accountant counts the bytes of the new blocks stored by
+// its requests, the bytes of the responses served to it by the RPC API and the
+// gateway, and the pins it owns. A pin is owned by the tenant which added it
+// until it is removed, by anyone.
+package tenants
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	ds "github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log"
+)
+
+var log = logging.Logger("tenants")
+
+var (
+	// usageKey is where the usage of each tenant is stored.
+	usageKey = ds.NewKey("/local/tenants/usage")
+	// pinsKey is where the owner of each pin made by a tenant is stored.
+	pinsKey = ds.NewKey("/local/tenants/pins")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context for the requests of tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant making the request of ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// Usage is the resource usage of a tenant.
+type Usage struct {
+	// BytesStored is the size of the blocks stored by the tenant which were
+	// not stored already. It is not decreased by garbage collection.
+	BytesStored uint64
+	// BytesServed is the size of the responses served to the tenant.
+	BytesServed uint64
+	// Pins counts the pins owned by the tenant.
+	Pins int64
+}
+
+// Accountant records the usage of the tenants of a node.
+type Accountant struct {
+	dstore ds.Datastore
+
+	mu    sync.Mutex
+	usage map[string]*Usage
+	dirty bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns an accountant recording usage in dstore, with the tenants,
+// along with the tenants which used the node before.
+func New(ctx context.Context, dstore ds.Datastore, tenants []string) (*Accountant, error) {
+	a := &Accountant{
+		dstore: dstore,
+		usage:  make(map[string]*Usage),
+	}
+	for _, t := range tenants {
+		a.usage[t] = &Usage{}
+	}
+
+	res, err := dstore.Query(ctx, dsq.Query{Prefix: usageKey.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var u Usage
+		if err := json.Unmarshal(r.Value, &u); err != nil {
+			return nil, fmt.Errorf("invalid tenant usage %s: %w", r.Key, err)
+		}
+		// pins are counted from their owners
+		u.Pins = 0
+		a.usage[ds.RawKey(r.Key).Name()] = &u
+	}
+
+	owners, err := dstore.Query(ctx, dsq.Query{Prefix: pinsKey.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer owners.Close()
+	for r := range owners.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		a.get(string(r.Value)).Pins++
+	}
+
+	a.ctx, a.cancel = context.WithCancel(context.Background())
+	return a, nil
+}
+
+// get returns the usage of tenant. a.mu must be held, or a not shared yet.
+func (a *Accountant) get(tenant string) *Usage {
+	u, ok := a.usage[tenant]
+	if !ok {
+		u = &Usage{}
+		a.usage[tenant] = u
+	}
+	return u
+}
+
+// Stored records that the tenant of ctx, if any, stored n bytes.
+func (a *Accountant) Stored(ctx context.Context, n int) {
+	tenant := FromContext(ctx)
+	if tenant == "" || n <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.get(tenant).BytesStored += uint64(n)
+	a.dirty = true
+}
+
+// Served records that n bytes were served to tenant.
+func (a *Accountant) Served(tenant string, n int64) {
+	if tenant == "" || n <= 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.get(tenant).BytesServed += uint64(n)
+	a.dirty = true
+}
+
+// pinned changes the pin count of tenant by delta.
+func (a *Accountant) pinned(tenant string, delta int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.get(tenant).Pins += delta
+}
+
+// Usage returns the usage of every tenant.
+func (a *Accountant) Usage() map[string]Usage {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	usage := make(map[string]Usage, len(a.usage))
+	for t, u := range a.usage {
+		usage[t] = *u
+	}
+	return usage
+}
+
+// Tenants returns the names of the tenants, sorted.
+func (a *Accountant) Tenants() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	tenants := make([]string, 0, len(a.usage))
+	for t := range a.usage {
+		tenants = append(tenants, t)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Run saves the usage every interval, until the accountant is closed.
+func (a *Accountant) Run(interval time.Duration) {
+	a.wg.Add(1)
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.save(a.ctx); err != nil {
+				log.Errorf("saving the usage of the tenants: %s", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// save stores the usage of the tenants, if it changed.
+func (a *Accountant) save(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.dirty {
+		a.mu.Unlock()
+		return nil
+	}
+	a.dirty = false
+	values := make(map[string][]byte, len(a.usage))
+	for t, u := range a.usage {
+		b, err := json.Marshal(Usage{BytesStored: u.BytesStored, BytesServed: u.BytesServed})
+		if err != nil {
+			a.mu.Unlock()
+			return err
+		}
+		values[t] = b
+	}
+	a.mu.Unlock()
+
+	for t, b := range values {
+		if err := a.dstore.Put(ctx, usageKey.ChildString(t), b); err != nil {
+			return err
+		}
+	}
+	return a.dstore.Sync(ctx, usageKey)
+}
+
+// Close saves the usage and stops the accountant.
+func (a *Accountant) Close() error {
+	a.cancel()
+	a.wg.Wait()
+	return a.save(context.Background())
+}
@@ -0,0 +1,121 @@
+package tenants
+
+import (
+	"context"
+	"testing"
+
+	blocks "github.com/ipfs/go-block-format"
+	bserv "github.com/ipfs/go-blockservice"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	offline "github.com/ipfs/go-ipfs-exchange-offline"
+	pin "github.com/ipfs/go-ipfs-pinner"
+	"github.com/ipfs/go-ipfs-pinner/dspinner"
+	dag "github.com/ipfs/go-merkledag"
+)
+
+func TestBlockstore(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	a, err := New(ctx, dstore, []string{"alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := NewBlockstore(bstore.NewBlockstore(dstore), a)
+
+	alice := WithTenant(ctx, "alice")
+	nd := dag.NodeWithData([]byte("data"))
+	size := uint64(len(nd.RawData()))
+	if err := bs.Put(alice, nd); err != nil {
+		t.Fatal(err)
+	}
+	// stored already
+	if err := bs.PutMany(WithTenant(ctx, "bob"), []blocks.Block{nd}); err != nil {
+		t.Fatal(err)
+	}
+	// no tenant
+	if err := bs.Put(ctx, dag.NodeWithData([]byte("other"))); err != nil {
+		t.Fatal(err)
+	}
+
+	usage := a.Usage()
+	if usage["alice"].BytesStored != size || usage["bob"].BytesStored != 0 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestPinner(t *testing.T) {
+	ctx := context.Background()
+	dstore := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := bstore.NewBlockstore(dstore)
+	dserv := dag.NewDAGService(bserv.New(bs, offline.Exchange(bs)))
+
+	a, err := New(ctx, dstore, []string{"alice", "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner, err := dspinner.New(ctx, dstore, dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPinner(inner, a)
+
+	nds := make([]*dag.ProtoNode, 3)
+	for i := range nds {
+		nds[i] = dag.NodeWithData([]byte{byte(i)})
+		if err := dserv.Add(ctx, nds[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pins := func() (int64, int64) {
+		usage := a.Usage()
+		return usage["alice"].Pins, usage["bob"].Pins
+	}
+
+	alice, bob := WithTenant(ctx, "alice"), WithTenant(ctx, "bob")
+	if err := p.Pin(alice, nds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	// pinned already: still owned by alice
+	if err := p.Pin(bob, nds[0], true); err != nil {
+		t.Fatal(err)
+	}
+	p.PinWithMode(nds[1].Cid(), pin.Recursive)
+	if err := p.Flush(bob); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := pins(); a != 1 || b != 1 {
+		t.Fatalf("expected 1 pin each, got %d and %d", a, b)
+	}
+
+	// update for nobody: the owner is kept
+	if err := p.Update(ctx, nds[1].Cid(), nds[2].Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	// unpinned by someone else
+	if err := p.Unpin(bob, nds[0].Cid(), true); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := pins(); a != 0 || b != 1 {
+		t.Fatalf("expected 0 and 1 pins, got %d and %d", a, b)
+	}
+
+	a.Served("alice", 42)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the usage is kept across restarts
+	a, err = New(ctx, dstore, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := a.Usage()
+	if usage["alice"].BytesServed != 42 || usage["bob"].Pins != 1 {
+		t.Fatalf("usage not restored: %+v", usage)
+	}
+	if tenants := a.Tenants(); len(tenants) != 2 || tenants[0] != "alice" {
+		t.Fatalf("unexpected tenants: %v", tenants)
+	}
+}
@@ -0,0 +1,47 @@
+#!/usr/bin/env bash
+
+test_description="Test the commands run in an 'ipfs session'"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs session' needs a daemon" '
+  echo version | test_must_fail ipfs session 2> nodaemon_err &&
+  test_should_contain "which is not running" nodaemon_err
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs session' runs the commands of a script" '
+  cat > script <<-\EOF &&
+	# make a directory
+	ipfs files mkdir "/my docs"
+
+	files ls /
+	EOF
+  ipfs session --separator=--- script > session_out &&
+  printf "%s\n" --- "my docs" --- > expected &&
+  test_cmp expected session_out
+'
+
+test_expect_success "'ipfs session' goes on after a failed command" '
+  printf "%s\n" nope version | test_expect_code 1 ipfs session > goon_out 2> goon_err &&
+  test_should_contain "Unknown Command" goon_err &&
+  test_should_contain "1 of 2 commands failed" goon_err &&
+  test_should_contain "ipfs version" goon_out
+'
+
+test_expect_success "'ipfs session --stop-on-error' ends at a failed command" '
+  printf "%s\n" nope version | test_expect_code 1 ipfs session --stop-on-error > stop_out &&
+  test_must_be_empty stop_out
+'
+
+test_expect_success "'ipfs session' refuses the commands run by the client" '
+  echo init | test_must_fail ipfs session 2> init_err &&
+  test_should_contain "runs on the client" init_err
+'
+
+test_kill_ipfs_daemon
+
+test_done
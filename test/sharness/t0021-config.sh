@@ -48,6 +48,37 @@ CONFIG_SET_JSON_TEST='{
   }
 }'
 
+# test_config_replace_keeps_secret sets the concealed config field $1, a jq
+# path, to $2 in the config file, and checks 'ipfs config show' hides it and
+# feeding the output back to 'ipfs config replace' keeps it, while replacing
+# it with $3 is refused.
+test_config_replace_keeps_secret() {
+  secret_field=$1
+  secret_value=$2
+  secret_changed=$3
+
+  test_expect_success "set $secret_field in the config file" '
+    jq "$secret_field = $secret_value" "$IPFS_PATH/config" > secret_config &&
+    cp secret_config "$IPFS_PATH/config"
+  '
+
+  test_expect_success "'ipfs config show' hides $secret_field" '
+    ipfs config show > show_config &&
+    test "$(jq "$secret_field" show_config)" != "$(jq "$secret_field" secret_config)"
+  '
+
+  test_expect_success "'ipfs config replace' keeps $secret_field" '
+    ipfs config replace show_config &&
+    jq -e "$secret_field == $secret_value" "$IPFS_PATH/config"
+  '
+
+  test_expect_success "'ipfs config replace' refuses to change $secret_field" '
+    jq "$secret_field = $secret_changed" show_config > changed_config &&
+    test_must_fail ipfs config replace changed_config &&
+    jq -e "$secret_field == $secret_value" "$IPFS_PATH/config"
+  '
+}
+
 test_profile_apply_revert() {
   profile=$1
   inverse_profile=$2
@@ -286,6 +317,33 @@ test_init_ipfs
 # should work offline
 test_config_cmd
 
+# the config file is edited, which a running daemon would not see
+test_expect_success "save the config before adding secrets" '
+  cp "$IPFS_PATH/config" config_without_secrets
+'
+
+test_config_replace_keeps_secret .Gateway.AccessControl.Tokens '["secret-token"]' '["other-token"]'
+test_config_replace_keeps_secret .Gateway.Purge.Headers '{"Authorization": "Bearer secret"}' '{"Authorization": "Bearer other"}'
+test_config_replace_keeps_secret .Import.Scanner.Headers '{"X-Api-Key": "secret"}' '{"X-Api-Key": "other"}'
+
+test_expect_success "add a remote signer key to the config file" '
+  jq ".Ipns.RemoteKeys.signer = {\"PublicKey\": \"$(ipfs config Identity.PeerID)\", \"URL\": \"http://127.0.0.1:1/sign\"}" "$IPFS_PATH/config" > signer_config &&
+  cp signer_config "$IPFS_PATH/config"
+'
+
+test_config_replace_keeps_secret .Ipns.RemoteKeys.signer.Headers '{"Authorization": "Bearer secret"}' '{"Authorization": "Bearer other"}'
+
+test_expect_success "add a DNSLink provider to the config file" '
+  jq ".DNSLink.Providers.cf = {\"Type\": \"cloudflare\"}" "$IPFS_PATH/config" > provider_config &&
+  cp provider_config "$IPFS_PATH/config"
+'
+
+test_config_replace_keeps_secret .DNSLink.Providers.cf.Params '{"Token": "secret", "ZoneID": "zone"}' '{"Token": "other", "ZoneID": "zone"}'
+
+test_expect_success "restore the config without secrets" '
+  cp config_without_secrets "$IPFS_PATH/config"
+'
+
 # should work online
 test_launch_ipfs_daemon
 test_config_cmd
@@ -61,4 +61,26 @@ test_expect_success "checking and converting ID of a random peer while offline"
   test_cmp expected-id actual-id
 '
 
+test_expect_success "configure the AgentVersion and the transports not announced" '
+  ipfs config Swarm.Identify.AgentVersion go-ipfs &&
+  ipfs config --json Addresses.Swarm "[\"/ip4/127.0.0.1/tcp/0\", \"/ip4/127.0.0.1/udp/0/quic\"]" &&
+  ipfs config --json Addresses.NoAnnounceTransports "[\"quic\"]"
+'
+
+test_launch_ipfs_daemon --agent-version-suffix=test-suffix
+
+test_expect_success "checking the configured AgentVersion (daemon running)" '
+  echo go-ipfs > expected-agent-version &&
+  ipfs id -f "<aver>\n" > actual-agent-version &&
+  test_cmp expected-agent-version actual-agent-version
+'
+
+test_expect_success "the addresses of Addresses.NoAnnounceTransports are not announced" '
+  ipfs id -f "<addrs>\n" > actual-addrs &&
+  grep "/tcp/" actual-addrs &&
+  test_expect_code 1 grep "/quic" actual-addrs
+'
+
+test_kill_ipfs_daemon
+
 test_done
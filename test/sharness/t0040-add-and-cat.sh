@@ -203,6 +203,21 @@ test_add_cat_file() {
     test_cmp expected actual
   '
 
+  test_expect_success "ipfs add --chunker auto inlines a tiny file" '
+    ipfs add --chunker auto mountdir/hello.txt >actual &&
+    HASH="bafyaafqkcqeaeeqojbswy3dpeblw64tmmrzsccqyby" &&
+    echo "added $HASH hello.txt" >expected &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "Import.Chunker is used without --chunker" '
+    test_config_set Import.Chunker auto &&
+    ipfs add -Q mountdir/hello.txt >actual &&
+    ipfs config --json Import {} &&
+    echo "bafyaafqkcqeaeeqojbswy3dpeblw64tmmrzsccqyby" >expected &&
+    test_cmp expected actual
+  '
+
   test_expect_success "ipfs add on hidden file succeeds" '
     echo "Hello Worlds!" >mountdir/.hello.txt &&
     ipfs add mountdir/.hello.txt >actual
@@ -399,6 +414,15 @@ test_add_cat_5MB() {
     test_cmp mountdir/bigfile actual
   '
 
+  test_expect_success "'ipfs cat --offset --length' succeeds" '
+    ipfs cat --offset 1000000 --length 300000 "$EXP_HASH" >actual
+  '
+
+  test_expect_success "'ipfs cat --offset --length' output looks good" '
+    tail -c +1000001 mountdir/bigfile | head -c 300000 >expected &&
+    test_cmp expected actual
+  '
+
   test_expect_success FUSE "cat ipfs/bigfile succeeds" '
     cat "ipfs/$EXP_HASH" >actual
   '
@@ -862,6 +886,53 @@ test_add_named_pipe
 
 test_add_pwd_is_symlink
 
+test_expect_success "ipfs add --workers gives the same hashes" '
+  random-files -depth=2 -dirs=3 -files=8 -seed=42 workers-dir > /dev/null &&
+  ipfs add -r workers-dir > workers_expected &&
+  ipfs add -r --workers=4 workers-dir > workers_actual &&
+  test_cmp workers_expected workers_actual
+'
+
+test_expect_success "ipfs add --workers=0 gives the same hashes" '
+  ipfs add -r --workers=0 workers-dir > workers_actual &&
+  test_cmp workers_expected workers_actual
+'
+
+test_expect_success "ipfs add --workers fails when negative" '
+  test_must_fail ipfs add -r --workers=-1 workers-dir 2> workers_err &&
+  grep "must not be negative" workers_err
+'
+
+test_expect_success "ipfs add --resume fails on an unsupported file" '
+  mkdir -p resume-dir &&
+  echo "resumed" > resume-dir/a &&
+  mkfifo resume-dir/b &&
+  test_must_fail ipfs add -r --resume=test resume-dir
+'
+
+test_expect_success "ipfs add --resume skips the files added" '
+  rm resume-dir/b &&
+  ipfs add -r -Q resume-dir > resume_expected &&
+  touch -r resume-dir/a resume_ref &&
+  echo "changed" > resume-dir/a &&
+  touch -r resume_ref resume-dir/a &&
+  ipfs add -r -Q --resume=test resume-dir > resume_actual &&
+  test_cmp resume_expected resume_actual
+'
+
+test_expect_success "ipfs add --resume removes the session once complete" '
+  ipfs add -r -Q --resume=test resume-dir > resume_actual &&
+  test_must_fail test_cmp resume_expected resume_actual
+'
+
+test_expect_success "ipfs add --resume requires the same options" '
+  mkfifo resume-dir/b &&
+  test_must_fail ipfs add -r --resume=other resume-dir &&
+  rm resume-dir/b &&
+  test_must_fail ipfs add -r --resume=other --chunker=buzhash resume-dir 2> resume_err &&
+  grep "was started with other options" resume_err
+'
+
 # Test daemon in offline mode
 test_launch_ipfs_daemon_without_network
 
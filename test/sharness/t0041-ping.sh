@@ -25,6 +25,31 @@ test_expect_success "test ping other" '
   ipfsi 1 ping -n2 -- "$PEERID_0"
 '
 
+test_expect_success "test ping statistics" '
+  ipfsi 0 ping -n3 --interval=100ms --size=100 -- "$PEERID_1" > ping_out &&
+  test_should_contain "3 pings sent, 3 received, 0.0% loss" ping_out &&
+  test_should_contain "Average latency: " ping_out &&
+  test_should_contain "Latency: min=.* p50=.* p90=.* p99=.* max=.* jitter=" ping_out
+'
+
+test_expect_success "test ping ndjson output" '
+  ipfsi 0 ping -n2 --interval=100ms --enc=json -- "$PEERID_1" > ping_json &&
+  test $(wc -l < ping_json) = 4 &&
+  grep -q "\"Seq\":2" ping_json &&
+  tail -1 ping_json | grep -q "\"Summary\":{\"Sent\":2,\"Received\":2,\"Loss\":0"
+'
+
+test_expect_success "test ping continuous" '
+  test_expect_code 124 env IPFS_PATH="$IPTB_ROOT/testbeds/default/0" \
+    timeout -s INT 2 ipfs ping --continuous --interval=200ms -- "$PEERID_1" > ping_out &&
+  test_should_contain "pings sent, .* received" ping_out
+'
+
+test_expect_success "test ping invalid interval and size" '
+  test_must_fail ipfsi 0 ping --interval=0s -- "$PEERID_1" &&
+  test_must_fail ipfsi 0 ping --size=0 -- "$PEERID_1"
+'
+
 test_expect_success "test ping unreachable peer" '
   printf "Looking up peer %s\n" "$BAD_PEER" > bad_ping_exp &&
   printf "Error: peer lookup failed: routing: not found\n" >> bad_ping_exp &&
@@ -262,12 +262,82 @@ test_ls_object() {
   '
 }
 
+test_ls_cmd_recursive() {
+  test_expect_success "'ipfs ls --recursive' succeeds" '
+    ipfs ls --recursive --size=false QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 >actual_ls_recursive
+  '
+
+  test_expect_success "'ipfs ls --recursive' output looks good" '
+    cat <<-\EOF >expected_ls_recursive &&
+QmSix55yz8CzWXf5ZVM9vgEvijnEeeXiTSarVtsqiiCJss d1/
+QmQNd6ubRXaNG6Prov8o6vk3bn6eWsj9FxLGrAVDUAGkGe d1/128
+QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN d1/a
+Qmf9nCpkCfa8Gtz5m1NJMeHBWcBozKRcbdom338LukPAjy d2/
+QmbQBUSRL9raZtNXfpTDeaxQapibJEG6qEY8WqAN22aUzd d2/1024
+QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL d2/a
+QmQSLRRd1Lxn6NMsWmmj2g9W3LtSRfmVAVqU3ShneLUrbn d2/bad\u007fname.txt
+QmeomffUNfmQy76CQGy9NdmqEnnHU9soCexBnGU3ezPHVH f1
+QmNtocSs7MoDkJMc1RkyisCSKvLadujPsfJfSdJ3e1eA1M f2
+EOF
+    test_cmp expected_ls_recursive actual_ls_recursive
+  '
+
+  test_expect_success "'ipfs ls --recursive --tree' output looks good" '
+    ipfs ls --recursive --tree --size=false QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 >actual_ls_tree &&
+    cat <<-\EOF >expected_ls_tree &&
+QmSix55yz8CzWXf5ZVM9vgEvijnEeeXiTSarVtsqiiCJss d1/
+QmQNd6ubRXaNG6Prov8o6vk3bn6eWsj9FxLGrAVDUAGkGe   128
+QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN   a
+Qmf9nCpkCfa8Gtz5m1NJMeHBWcBozKRcbdom338LukPAjy d2/
+QmbQBUSRL9raZtNXfpTDeaxQapibJEG6qEY8WqAN22aUzd   1024
+QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL   a
+QmQSLRRd1Lxn6NMsWmmj2g9W3LtSRfmVAVqU3ShneLUrbn   bad\u007fname.txt
+QmeomffUNfmQy76CQGy9NdmqEnnHU9soCexBnGU3ezPHVH f1
+QmNtocSs7MoDkJMc1RkyisCSKvLadujPsfJfSdJ3e1eA1M f2
+EOF
+    test_cmp expected_ls_tree actual_ls_tree
+  '
+
+  test_expect_success "'ipfs ls --recursive --filter' output looks good" '
+    ipfs ls --recursive --filter=a --size=false QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 >actual_ls_filter &&
+    cat <<-\EOF >expected_ls_filter &&
+QmSix55yz8CzWXf5ZVM9vgEvijnEeeXiTSarVtsqiiCJss d1/
+QmZULkCELmmk5XNfCgTnCyFgAVxBRBXyDHGGMVoLFLiXEN d1/a
+Qmf9nCpkCfa8Gtz5m1NJMeHBWcBozKRcbdom338LukPAjy d2/
+QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL d2/a
+EOF
+    test_cmp expected_ls_filter actual_ls_filter
+  '
+
+  test_expect_success "'ipfs ls --sort=size' output looks good" '
+    ipfs ls --sort=size Qmf9nCpkCfa8Gtz5m1NJMeHBWcBozKRcbdom338LukPAjy >actual_ls_sort &&
+    cat <<-\EOF >expected_ls_sort &&
+QmaRGe7bVmVaLmxbrMiVNXqW4pRNNp3xq7hFtyRKA3mtJL 6    a
+QmQSLRRd1Lxn6NMsWmmj2g9W3LtSRfmVAVqU3ShneLUrbn 8    bad\u007fname.txt
+QmbQBUSRL9raZtNXfpTDeaxQapibJEG6qEY8WqAN22aUzd 1024 1024
+EOF
+    test_cmp expected_ls_sort actual_ls_sort
+  '
+
+  test_expect_success "'ipfs ls --recursive --stream --enc=json' outputs one entry per line" '
+    ipfs ls --recursive --stream --enc=json QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 >actual_ls_ndjson &&
+    test_line_count = 9 actual_ls_ndjson &&
+    grep "\"Name\":\"d2/1024\"" actual_ls_ndjson
+  '
+
+  test_expect_success "'ipfs ls' with an invalid --sort or --filter fails" '
+    test_must_fail ipfs ls --sort=date QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21 &&
+    test_must_fail ipfs ls --filter="[" QmRPX2PWaPGqzoVzqNcQkueijHVzPicjupnD7eLck6Rs21
+  '
+}
+
 # should work offline
 test_ls_cmd
 test_ls_cmd_streaming
 test_ls_cmd_raw_leaves
 test_ls_cmd_raw_leaves --size
 test_ls_object
+test_ls_cmd_recursive
 
 # should work online
 test_launch_ipfs_daemon
@@ -277,6 +347,7 @@ test_ls_cmd_raw_leaves
 test_ls_cmd_raw_leaves --size
 test_kill_ipfs_daemon
 test_ls_object
+test_ls_cmd_recursive
 
 #
 # test for ls --resolve-type=false
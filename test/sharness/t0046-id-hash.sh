@@ -78,6 +78,58 @@ test_expect_success "ipfs add --inline --raw-leaves outputs the correct hash on
   test "$HASH0" = "$HASH"
 '
 
+test_expect_success "ipfs cid inline outputs the identity hash" '
+  echo $ID_HASH0_CONTENTS | ipfs cid inline > actual &&
+  echo $ID_HASH0 > expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "ipfs cid inline fails on data above the limit" '
+  test_must_fail ipfs cid inline --limit 8 < afile 2> err &&
+  grep -q "data exceeds the inline limit of 8 bytes" err
+'
+
+test_expect_success "ipfs add inlines blocks when Import.Inline is set" '
+  ipfs config --json Import.Inline true &&
+  HASH=$(ipfs add -q --raw-leaves afile) &&
+  test "$ID_HASH0" = "$HASH"
+'
+
+test_expect_success "ipfs add honors Import.InlineLimit" '
+  ipfs config --json Import.InlineLimit 8 &&
+  HASH=$(ipfs add -q --raw-leaves afile) &&
+  test "$(cid-fmt %h $HASH)" = sha2-256
+'
+
+test_expect_success "Import.InlineLimit cannot exceed 128 bytes" '
+  ipfs config --json Import.InlineLimit 1000 &&
+  test_must_fail ipfs add -q afile 2> err &&
+  grep -q "inline limit must be between 1 and 128 bytes" err &&
+  ipfs config --json Import.InlineLimit 32
+'
+
+test_expect_success "ipfs files write inlines small files" '
+  ipfs files write --create --raw-leaves /inlined < afile &&
+  HASH=$(ipfs files stat --hash /inlined) &&
+  test "$ID_HASH0" = "$HASH"
+'
+
+test_expect_success "ipfs files write uninlines files growing past the limit" '
+  ipfs files write --offset 16 --raw-leaves /inlined < 1000bytes &&
+  HASH=$(ipfs files stat --hash /inlined) &&
+  test "$(cid-fmt %h $HASH)" = sha2-256 &&
+  cat afile 1000bytes > expected &&
+  ipfs files read /inlined > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "ipfs files write --inline=false does not inline" '
+  ipfs files write --create --inline=false /regular < afile &&
+  HASH=$(ipfs files stat --hash /regular) &&
+  test "$(cid-fmt %h $HASH)" = sha2-256 &&
+  ipfs config --json Import.Inline false
+'
+
 test_expect_success "enable filestore" '
   ipfs config --json Experimental.FilestoreEnabled true
 '
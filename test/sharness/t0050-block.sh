@@ -262,4 +262,29 @@ test_expect_success "'ipfs block put' check block size" '
     rm 2-MB-file
   '
 
+
+test_expect_success "'ipfs block put --batch' puts the blocks of a .car file" '
+  RAW_HASH=$(echo "batch me" | ipfs block put --format=raw) &&
+  ipfs dag export $RAW_HASH > batch.car &&
+  ipfs block rm $RAW_HASH &&
+  ipfs block put --batch batch.car > batch_out &&
+  echo "1 blocks stored (9 B), 0 refused" > batch_exp &&
+  test_cmp batch_exp batch_out &&
+  ipfs block stat $RAW_HASH
+'
+
+test_expect_success "'ipfs block put --batch' refuses the blocks not matching their CID" '
+  sed "s/batch me/batch mE/" batch.car > tampered.car &&
+  test_expect_code 1 ipfs block put --batch tampered.car > tampered_out 2>&1 &&
+  grep "0 blocks stored (0 B), 1 refused" tampered_out &&
+  grep "block 1 of tampered.car: $RAW_HASH: data hashes to" tampered_out &&
+  grep "1 out of 1 blocks refused" tampered_out
+'
+
+test_expect_success "'ipfs block put --batch' outputs a summary in JSON" '
+  ipfs block put --batch --enc=json batch.car > batch_json &&
+  echo "{\"Batch\":{\"Blocks\":1,\"Bytes\":9,\"Invalid\":0}}" > batch_json_exp &&
+  test_cmp batch_json_exp batch_json
+'
+
 test_done
@@ -241,6 +241,36 @@ test_expect_success "'ipfs dag put' check block size" '
     test_cmp ipld_path_Data_actual ipld_path_Data_expected
   '
 
+  test_expect_success "dag get follows paths across codecs" '
+    mkdir -p mixed/sub &&
+    echo "hello world" > mixed/sub/file.txt &&
+    MIXEDDIR=$(ipfs add -Qr mixed) &&
+    MIXEDRAW=$(echo -n "0123456789" | ipfs add -q --raw-leaves --cid-version 1) &&
+    MIXEDHASH=$(echo "{\"dir\":{\"/\":\"$MIXEDDIR\"},\"raw\":{\"/\":\"$MIXEDRAW\"}}" | ipfs dag put) &&
+    ipfs dag get /ipld/$MIXEDHASH/dir/Links/0/Name > mixed_name &&
+    echo -n "\"sub\"" > mixed_name_exp &&
+    test_cmp mixed_name_exp mixed_name
+  '
+
+  test_expect_success "dag get --offset --length reads the bytes of a UnixFS file" '
+    ipfs dag get --offset 6 --length 5 $MIXEDHASH/dir/sub/file.txt > mixed_file &&
+    echo -n "world" > mixed_file_exp &&
+    test_cmp mixed_file_exp mixed_file
+  '
+
+  test_expect_success "dag get --offset reads the bytes of a raw block" '
+    ipfs dag get --offset 7 $MIXEDHASH/raw > mixed_raw &&
+    echo -n "789" > mixed_raw_exp &&
+    test_cmp mixed_raw_exp mixed_raw
+  '
+
+  test_expect_success "dag get --length fails on other nodes" '
+    test_must_fail ipfs dag get --length 1 $MIXEDHASH 2> mixed_err &&
+    grep -q "not a UnixFS file or raw block" mixed_err &&
+    test_must_fail ipfs dag get --length 1 $MIXEDHASH/dir/sub 2> mixed_err &&
+    grep -q "not a UnixFS file" mixed_err
+  '
+
   test_expect_success "can pin ipld object" '
     ipfs pin add $IPLDHASH
   '
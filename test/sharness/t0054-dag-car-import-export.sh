@@ -165,6 +165,25 @@ startup_cluster 2
 
 run_online_imp_exp_tests
 
+test_expect_success "tracked import reports its progress" '
+  ipfsi 0 dag import --track=testnet --pin-roots=false \
+    ../t0054-dag-car-import-export-data/lotus_testnet_export_128_shuffled_nulroot.car &&
+  ipfsi 0 dag progress --enc=json testnet > progress_tracked_import &&
+  grep "\"Op\":\"import\",\"Blocks\":1049,\"Bytes\":438130," progress_tracked_import &&
+  grep "\"Done\":true" progress_tracked_import
+'
+
+test_expect_success "tracked export reports its progress" '
+  ipfsi 0 dag export --track=testnet bafy2bzaced4ueelaegfs5fqu4tzsh6ywbbpfk3cxppupmxfdhbpbhzawfw5oy > tracked_export.car &&
+  ipfsi 0 dag progress testnet > progress_tracked_export &&
+  grep "^export: 1049 blocks (438 kB, .*), done in" progress_tracked_export
+'
+
+test_expect_success "progress of an untracked name fails" '
+  test_must_fail ipfsi 0 dag progress nonexistent 2>progress_untracked_err &&
+  grep "no .car import or export tracked as \"nonexistent\"" progress_untracked_err
+'
+
 test_expect_success "shut down nodes" '
   iptb stop && iptb_wait_stop
 '
@@ -263,4 +282,28 @@ test_expect_success "version 2 import output as expected" '
   test_cmp_sorted version_2_import_expected version_2_import_actual
 '
 
+test_expect_success "import with --stats-interval reports the progress" '
+  ipfs dag import --stats-interval=1ns --enc=json --pin-roots=false \
+    ../t0054-dag-car-import-export-data/lotus_testnet_export_128_v2.car \
+  > progress_import_actual &&
+  grep "^{\"Progress\":{\"BlockCount\":1," progress_import_actual &&
+  test $(grep -c "\"Progress\"" progress_import_actual) -gt 1
+'
+
+test_expect_success "import with an invalid --stats-interval fails" '
+  test_must_fail ipfs dag import --stats-interval=-1s 2-MB-block.car 2>progress_import_err &&
+  grep "stats-interval must be positive" progress_import_err
+'
+
+test_expect_success "import of a corrupted block fails" '
+  SMALL_CID=$(echo "corrupt me" | ipfs dag put --input-codec=raw --store-codec=raw) &&
+  ipfs dag export $SMALL_CID > corrupted.car &&
+  printf "X" | dd of=corrupted.car bs=1 seek=$(($(wc -c < corrupted.car) - 2)) conv=notrunc &&
+  test_expect_code 1 ipfs dag import corrupted.car >corrupted_import_out 2>&1
+'
+
+test_expect_success "import of a corrupted block reports the block" '
+  grep "block 1 of corrupted.car: mismatch in content integrity" corrupted_import_out
+'
+
 test_done
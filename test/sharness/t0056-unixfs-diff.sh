@@ -0,0 +1,71 @@
+#!/usr/bin/env bash
+
+test_description="Test diff command"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create some directories to diff" '
+  mkdir foo &&
+  echo "stuff" > foo/bar &&
+  mkdir foo/baz &&
+  echo "nested" > foo/baz/dog &&
+  A=$(ipfs add -r -Q foo) &&
+  echo "changed" > foo/bar &&
+  echo "more things" > foo/cat &&
+  rm -r foo/baz &&
+  B=$(ipfs add -r -Q foo)
+'
+
+test_expect_success "diff against self is empty" '
+  ipfs diff $A $A > diff_out &&
+  test_must_be_empty diff_out
+'
+
+test_expect_success "diff output looks good" '
+  ipfs diff $A $B > diff_out &&
+  cat <<-\EOF >diff_exp &&
+~ QmNgd5cz2jNftnAHBhcRUGdtiaMzb5Rhjqd4etondHHST8 QmRfFVsjSXkhFxrfWnLpMae2M4GBVsry6VAuYYcji5MiZb "bar" (+2 bytes, 1 changed blocks)
+- QmRiziE5MjkLxxBAn8V8K6oJ31kSnT8owNRPUCyPFj6NPZ "baz/"
++ QmUSvcqzhdfYM1KLDbM76eLPdS9ANFtkJvFuPYeZt73d7A "cat" (12 bytes)
+EOF
+  test_cmp diff_exp diff_out
+'
+
+test_expect_success "add the second directory sharded" '
+  ipfs config Internal.UnixFSShardingSizeThreshold 1B &&
+  BS=$(ipfs add -r -Q foo) &&
+  ipfs config --json Internal "{}"
+'
+
+test_expect_success "diff against the sharded directory looks good" '
+  ipfs diff $A $BS > diff_out &&
+  test_cmp diff_exp diff_out &&
+  ipfs diff $B $BS > diff_out &&
+  test_must_be_empty diff_out
+'
+
+test_expect_success "diff --enc=json reports the size changes" '
+  ipfs diff --enc=json $A $B > diff_json &&
+  grep "\"Path\":\"bar\"" diff_json | grep "\"SizeDelta\":2" &&
+  grep "\"Path\":\"baz\",\"Dir\":true" diff_json
+'
+
+test_expect_success "create two versions of a large file" '
+  mkdir big &&
+  random 3000000 42 > big/file &&
+  C=$(ipfs add -r -Q big) &&
+  echo "appended" >> big/file &&
+  D=$(ipfs add -r -Q big)
+'
+
+test_expect_success "diff does not read the blocks shared by the versions" '
+  ipfs pin rm $C $D &&
+  SHARED=$(ipfs refs $C/file | head -1) &&
+  ipfs block rm $SHARED &&
+  ipfs diff --offline $C $D > diff_out &&
+  grep "\"file\" (+9 bytes, 2 changed blocks)" diff_out
+'
+
+test_done
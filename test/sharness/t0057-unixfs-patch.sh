@@ -0,0 +1,85 @@
+#!/usr/bin/env bash
+
+test_description="Test the unixfs directory editing commands"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+EMPTY_DIR=QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn
+
+test_expect_success "create some files" '
+  echo "hello" > hello.txt &&
+  HELLO=$(ipfs add -q hello.txt) &&
+  mkdir many &&
+  for i in $(seq 1 50); do echo $i > many/file$i; done
+'
+
+test_expect_success "unixfs mkdir adds a directory" '
+  DIR=$(ipfs unixfs mkdir $EMPTY_DIR docs) &&
+  ipfs ls $DIR > ls_out &&
+  grep -q "docs/" ls_out
+'
+
+test_expect_success "unixfs mkdir fails on an existing entry" '
+  test_must_fail ipfs unixfs mkdir $DIR docs 2> err &&
+  grep -q "\"docs\" already exists" err &&
+  ipfs unixfs mkdir --parents $DIR docs > mkdir_out &&
+  echo $DIR > mkdir_exp &&
+  test_cmp mkdir_exp mkdir_out
+'
+
+test_expect_success "unixfs add-link adds an entry" '
+  DIR=$(ipfs unixfs add-link $DIR docs/hello.txt $HELLO) &&
+  ipfs cat $DIR/docs/hello.txt > cat_out &&
+  test_cmp hello.txt cat_out
+'
+
+test_expect_success "unixfs add-link needs --parents for missing directories" '
+  test_must_fail ipfs unixfs add-link $DIR a/b/hello.txt $HELLO 2> err &&
+  grep -q "no directory named \"a\"" err &&
+  DIR=$(ipfs unixfs add-link --parents $DIR a/b/hello.txt $HELLO) &&
+  ipfs cat $DIR/a/b/hello.txt > cat_out &&
+  test_cmp hello.txt cat_out
+'
+
+test_expect_success "unixfs rm-link removes an entry" '
+  DIR=$(ipfs unixfs rm-link $DIR a/b/hello.txt) &&
+  test_must_fail ipfs cat $DIR/a/b/hello.txt &&
+  test_must_fail ipfs unixfs rm-link $DIR a/b/hello.txt 2> err &&
+  grep -q "no entry named \"a/b/hello.txt\"" err
+'
+
+test_expect_success "unixfs add-link fails on files" '
+  test_must_fail ipfs unixfs add-link $HELLO name $HELLO 2> err &&
+  grep -q "not a UnixFS directory" err
+'
+
+test_expect_success "add a sharded directory" '
+  ipfs config --json Internal.UnixFSShardingSizeThreshold "\"1B\"" &&
+  SHARDED=$(ipfs add -Qr many) &&
+  ipfs dag get /ipld/$SHARDED/Data > data_out &&
+  echo -n "{\"/\":{\"bytes\":\"CAUS" > data_exp &&
+  grep -q -F "$(cat data_exp)" data_out
+'
+
+test_expect_success "unixfs add-link edits sharded directories" '
+  ADDED=$(ipfs unixfs add-link $SHARDED hello.txt $HELLO) &&
+  cp hello.txt many/ &&
+  ipfs add -Qr many > expected &&
+  echo $ADDED > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "unixfs rm-link edits sharded directories" '
+  REMOVED=$(ipfs unixfs rm-link $ADDED hello.txt) &&
+  test "$REMOVED" = "$SHARDED" &&
+  for i in $(seq 1 40); do REMOVED=$(ipfs unixfs rm-link $REMOVED file$i) || return 1; done &&
+  ipfs ls $REMOVED > ls_out &&
+  test_line_count = 10 ls_out &&
+  ipfs cat $REMOVED/file45 > cat_out &&
+  echo 45 > cat_exp &&
+  test_cmp cat_exp cat_out
+'
+
+test_done
@@ -0,0 +1,74 @@
+#!/usr/bin/env bash
+
+test_description="Test dag diff command"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create some DAGs to diff" '
+  mkdir foo &&
+  echo "stuff" > foo/bar &&
+  mkdir foo/baz &&
+  echo "nested" > foo/baz/dog &&
+  A=$(ipfs add -r -Q --cid-version=1 foo) &&
+  echo "changed" > foo/bar &&
+  echo "more things" > foo/cat &&
+  rm -r foo/baz &&
+  B=$(ipfs add -r -Q --cid-version=1 foo) &&
+  BAR_A=$(ipfs resolve -r /ipfs/$A/bar | cut -d/ -f3) &&
+  BAR_B=$(ipfs resolve -r /ipfs/$B/bar | cut -d/ -f3) &&
+  BAZ=$(ipfs resolve -r /ipfs/$A/baz | cut -d/ -f3) &&
+  CAT=$(ipfs resolve -r /ipfs/$B/cat | cut -d/ -f3)
+'
+
+test_expect_success "dag diff against self is empty" '
+  ipfs dag diff $A $A > diff_out &&
+  echo "0 blocks added (0 bytes), 0 blocks removed (0 bytes)" > diff_exp &&
+  test_cmp diff_exp diff_out
+'
+
+test_expect_success "dag diff output looks good" '
+  ipfs dag diff $A $B > diff_out &&
+  cat <<-EOF >diff_exp &&
+~ $BAR_A $BAR_B "/bar"
+- $BAZ "/baz"
++ $CAT "/cat"
+EOF
+  head -n 3 diff_out > diff_changes &&
+  test_cmp diff_exp diff_changes &&
+  tail -n 1 diff_out | grep "^3 blocks added ([0-9]* bytes), 4 blocks removed ([0-9]* bytes)$"
+'
+
+test_expect_success "dag diff --blocks lists the blocks" '
+  ipfs dag diff --blocks $A $B > diff_out &&
+  grep "^added block $B$" diff_out &&
+  grep "^added block $BAR_B$" diff_out &&
+  grep "^added block $CAT$" diff_out &&
+  grep "^removed block $A$" diff_out &&
+  grep "^removed block $BAZ$" diff_out &&
+  test $(grep -c "^added block" diff_out) -eq 3
+'
+
+test_expect_success "dag diff --enc=json looks good" '
+  ipfs dag diff --enc=json $A $B > diff_json &&
+  grep "\"Path\":\"/cat\"" diff_json | grep "\"After\":\"$CAT\"" &&
+  grep "\"NumAdded\":3" diff_json
+'
+
+test_expect_success "dag diff --car exports the blocks added" '
+  ipfs dag diff --car --progress=false $A $B > diff.car &&
+  ipfs dag export --progress=false $A > a.car
+'
+
+test_expect_success "importing the blocks added next to the first DAG gives the second one" '
+  IPFS_PATH="$(pwd)/.ipfs-b" &&
+  export IPFS_PATH &&
+  ipfs init --profile=test > /dev/null &&
+  ipfs dag import --pin-roots=false a.car &&
+  ipfs dag import diff.car > import_out &&
+  grep "Pinned root" import_out | grep "$B" | grep "success" &&
+  ipfs dag stat --offline --progress=false $B
+'
+
+test_done
@@ -49,4 +49,44 @@ test_expect_success "create empty \$IPFS_PATH dir" '
 
 test_ipfs_daemon_init
 
+test_expect_success "create the seed manifest" '
+  rm -rf "$IPFS_PATH" &&
+  IPFS_PATH="$(pwd)/.seed" ipfs init --profile=test >/dev/null &&
+  echo "seeded content" >seeded &&
+  SEED_HASH=$(IPFS_PATH="$(pwd)/.seed" ipfs add -q --cid-version=1 seeded) &&
+  mkdir seed &&
+  IPFS_PATH="$(pwd)/.seed" ipfs dag export $SEED_HASH >seed/content.car &&
+  printf "{\"Profiles\": [\"lowpower\"], \"Config\": {\"Datastore.StorageMax\": \"1GB\"}, \"Cars\": [\"content.car\"], \"Pins\": [{\"Path\": \"/ipfs/%s\", \"Name\": \"seeded\"}]}" $SEED_HASH >seed/seed.json
+'
+
+test_expect_success "'ipfs daemon --init --init-seed' succeeds" '
+  ipfs daemon --init --init-profile=test --init-seed=seed/seed.json >actual_daemon 2>daemon_err &
+  IPFS_PID=$!
+  sleep 2 &&
+  if ! kill -0 $IPFS_PID; then cat daemon_err; return 1; fi
+'
+
+test_expect_success "the repo is seeded" '
+  grep "pinned /ipfs/$SEED_HASH" actual_daemon &&
+  ipfs cat $SEED_HASH >actual &&
+  test_cmp seeded actual &&
+  ipfs pin ls -q --name=seeded >actual &&
+  echo $SEED_HASH >expected &&
+  test_cmp expected actual &&
+  test $(ipfs config Datastore.StorageMax) = 1GB &&
+  test $(ipfs config Routing.Type) = dhtclient
+'
+
+test_expect_success "'ipfs daemon' can be killed" '
+  test_kill_repeat_10_sec $IPFS_PID
+'
+
+test_expect_success "'ipfs init --seed' fails on an invalid manifest" '
+  rm -rf "$IPFS_PATH" &&
+  echo "{\"Unknown\": 1}" >invalid.json &&
+  test_must_fail ipfs init --seed=invalid.json 2>err &&
+  grep "invalid seed manifest" err &&
+  test_path_is_missing "$IPFS_PATH/config"
+'
+
 test_done
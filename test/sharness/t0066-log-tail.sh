@@ -0,0 +1,47 @@
+#!/usr/bin/env bash
+
+test_description="Test log tail command"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs log tail' fails without a daemon" '
+  test_must_fail ipfs log tail
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "log some messages" '
+  ipfs log level core/commands info &&
+  ipfs log level all error
+'
+
+test_expect_success "'ipfs log tail --since' replays recent messages" '
+  { go-timeout 2 ipfs log tail --since=1m > tail_out || true ; } &&
+  grep "Changed log level of .core/commands. to .info." tail_out
+'
+
+test_expect_success "'ipfs log tail --subsystem' filters messages" '
+  { go-timeout 2 ipfs log tail --since=1m --subsystem=bitswap > tail_out || true ; } &&
+  test_expect_code 1 grep "Changed log level" tail_out
+'
+
+test_expect_success "'ipfs log tail --level' filters messages" '
+  { go-timeout 2 ipfs log tail --since=1m --level=warn > tail_out || true ; } &&
+  test_expect_code 1 grep "Changed log level" tail_out
+'
+
+test_expect_success "'ipfs log tail --enc=json' outputs structured messages" '
+  { go-timeout 2 ipfs log tail --since=1m --subsystem="core/*" --enc=json > tail_out || true ; } &&
+  grep "\"Subsystem\":\"core/commands\"" tail_out | grep "\"Level\":\"info\""
+'
+
+test_expect_success "'ipfs log tail' rejects invalid filters" '
+  test_must_fail ipfs log tail --level=loud &&
+  test_must_fail ipfs log tail --since=yesterday
+'
+
+test_kill_ipfs_daemon
+
+test_done
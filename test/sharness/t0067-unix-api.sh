@@ -26,5 +26,25 @@ test_expect_success "client works" '
   test_cmp expected actual
 '
 
+test_expect_success "socket is only accessible to the user" '
+  ls -l "$SOCKDIR/sock" | cut -c1-10 >actual &&
+  echo srw------- >expected &&
+  test_cmp expected actual
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "configure the socket mode" '
+  ipfs config API.SocketMode 0660
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "socket has the mode set" '
+  ls -l "$SOCKDIR/sock" | cut -c1-10 >actual &&
+  echo srw-rw---- >expected &&
+  test_cmp expected actual
+'
+
 test_kill_ipfs_daemon
 test_done
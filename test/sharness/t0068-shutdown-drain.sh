@@ -0,0 +1,38 @@
+#!/usr/bin/env bash
+
+test_description="Test shutdown --drain command"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs shutdown --drain' rejects an invalid timeout" '
+  test_must_fail ipfs shutdown --drain --drain-timeout=bad 2>shutdown_err &&
+  grep "invalid drain timeout" shutdown_err
+'
+
+test_expect_success "daemon is still running" '
+  ipfs id
+'
+
+test_expect_success "'ipfs shutdown --drain' succeeds" '
+  ipfs shutdown --drain --drain-timeout=10s >shutdown_out
+'
+
+test_expect_success "'ipfs shutdown --drain' output looks good" '
+  echo "drained 0 of 0 requests in flight" >expected_shutdown_out &&
+  test_cmp expected_shutdown_out shutdown_out
+'
+
+test_expect_success "daemon exits" '
+  for i in $(test_seq 1 100)
+  do
+    kill -0 $IPFS_PID 2>/dev/null || break
+    go-sleep 100ms
+  done &&
+  test_expect_code 1 kill -0 $IPFS_PID 2>/dev/null
+'
+
+test_done
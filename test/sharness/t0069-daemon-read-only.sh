@@ -0,0 +1,77 @@
+#!/usr/bin/env bash
+
+test_description="Test read-only daemon"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add content before going read-only" '
+  HASH=$(echo "mirrored" | ipfs add -q)
+'
+
+test_expect_success "--read-only and --writable are mutually exclusive" '
+  test_expect_code 1 ipfs daemon --read-only --writable 2> daemon_err &&
+  test_should_contain "mutually exclusive" daemon_err
+'
+
+test_config_ipfs_gateway_writable
+test_launch_ipfs_daemon --read-only
+
+test_expect_success "content can be read" '
+  echo "mirrored" > expected &&
+  ipfs cat "$HASH" > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "pins can be listed" '
+  ipfs pin ls "$HASH"
+'
+
+test_expect_success "content cannot be added" '
+  test_must_fail ipfs add -q expected 2> add_err &&
+  test_should_contain "read-only" add_err
+'
+
+test_expect_success "pins cannot be removed" '
+  test_must_fail ipfs pin rm "$HASH" 2> pin_err &&
+  test_should_contain "read-only" pin_err
+'
+
+test_expect_success "MFS cannot be written" '
+  test_must_fail ipfs files mkdir /dir 2> files_err &&
+  test_should_contain "read-only" files_err
+'
+
+test_expect_success "names cannot be published" '
+  test_must_fail ipfs name publish --allow-offline "$HASH" 2> publish_err &&
+  test_should_contain "read-only" publish_err
+'
+
+test_expect_success "the CIDs can be audited, but not upgraded" '
+  ipfs cid audit &&
+  test_must_fail ipfs cid audit --upgrade 2> audit_err &&
+  test_should_contain "read-only" audit_err
+'
+
+test_expect_success "MFS can be checked, but not repaired" '
+  ipfs files fsck &&
+  test_must_fail ipfs files fsck --repair 2> fsck_err &&
+  test_should_contain "read-only" fsck_err
+'
+
+test_expect_success "the blocks cannot be compressed or migrated" '
+  test_must_fail ipfs repo compress zstd 2> compress_err &&
+  test_should_contain "read-only" compress_err &&
+  test_must_fail ipfs repo migrate-to "{}" 2> migrate_err &&
+  test_should_contain "read-only" migrate_err
+'
+
+test_expect_success "gateway ignores Gateway.Writable" '
+  curl -v -X POST http://$GWAY_ADDR/ipfs/ 2> outfile &&
+  grep "HTTP/1.1 405 Method Not Allowed" outfile
+'
+
+test_kill_ipfs_daemon
+
+test_done
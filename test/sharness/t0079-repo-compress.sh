@@ -0,0 +1,53 @@
+#!/usr/bin/env bash
+
+test_description="Test the compression of the blocks"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add compressible content" '
+  for i in $(seq 200); do echo "text compresses well, line $i"; done > text &&
+  HASH=$(ipfs add -q text)
+'
+
+test_expect_success "ipfs repo compress zstd" '
+  ipfs repo compress zstd > compress_out &&
+  test_should_contain "migration complete" compress_out &&
+  test -d "$IPFS_PATH/blocks-zstd"
+'
+
+test_expect_success "the blocks are compressed" '
+  ipfs config Datastore.Spec > spec &&
+  grep "\"compress\"" spec &&
+  ipfs cat $HASH > text_out &&
+  test_cmp text text_out
+'
+
+test_expect_success "ipfs repo stat --compression reports the sizes" '
+  ipfs repo stat --compression --enc=json > stat.json &&
+  test $(jq -r ".Compression[\"/blocks\"].Algorithm" stat.json) = zstd &&
+  test $(jq -r ".Compression[\"/blocks\"].PhysicalSize" stat.json) -lt $(jq -r ".Compression[\"/blocks\"].LogicalSize" stat.json)
+'
+
+test_expect_success "the compressed blocks are read back by a new process" '
+  ipfs cat $HASH > text_out &&
+  test_cmp text text_out &&
+  ipfs repo verify
+'
+
+test_expect_success "ipfs repo compress none refuses the directory left" '
+  test_must_fail ipfs repo compress none 2> decompress_err &&
+  test_should_contain "remove it first" decompress_err
+'
+
+test_expect_success "ipfs repo compress none decompresses the blocks" '
+  rm -rf "$IPFS_PATH/blocks" &&
+  ipfs repo compress none &&
+  ipfs config Datastore.Spec > spec &&
+  test_expect_code 1 grep "\"compress\"" spec &&
+  ipfs cat $HASH > text_out &&
+  test_cmp text text_out
+'
+
+test_done
@@ -315,4 +315,37 @@ test_expect_success "'ipfs repo stat' still succeeds" '
   ipfs repo stat > repo-stats
 '
 
+test_expect_success "add unpinned content" '
+  for i in 1 2 3; do echo "incremental gc $i" | ipfs add -q --pin=false || return 1; done > unpinned &&
+  echo "incremental gc pinned" | ipfs add -q > pinned
+'
+
+test_expect_success "'ipfs repo gc --max-bytes' stops after the first block" '
+  ipfs repo gc --max-bytes=1 > gc_out &&
+  test $(grep -c "^removed" gc_out) -eq 1 &&
+  grep "garbage collection paused in the sweep phase" gc_out
+'
+
+test_expect_success "'ipfs repo gc --status' reports the garbage collection in progress" '
+  ipfs repo gc --status > gc_status &&
+  grep "in the sweep phase: .* 1 blocks removed" gc_status
+'
+
+test_expect_success "'ipfs repo gc' finishes the garbage collection" '
+  ipfs repo gc -q &&
+  ipfs repo gc --status > gc_status &&
+  echo "no garbage collection in progress" > gc_status_expected &&
+  test_cmp gc_status_expected gc_status
+'
+
+test_expect_success "the unpinned content is removed, and the pinned content kept" '
+  for c in $(cat unpinned); do test_must_fail ipfs block stat --offline $c || return 1; done &&
+  ipfs cat $(cat pinned)
+'
+
+test_expect_success "'ipfs repo gc --max-duration' rejects an invalid duration" '
+  test_must_fail ipfs repo gc --max-duration=soon 2> gc_err &&
+  grep "invalid --max-duration" gc_err
+'
+
 test_done
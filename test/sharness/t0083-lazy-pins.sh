@@ -0,0 +1,74 @@
+#!/usr/bin/env bash
+
+test_description="Test lazy pins"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a directory" '
+  mkdir -p dir &&
+  echo a > dir/a &&
+  echo b > dir/b &&
+  DIR=$(ipfs add -Qr --pin=false dir) &&
+  A=$(ipfs resolve -r /ipfs/$DIR/a | cut -d/ -f3) &&
+  B=$(ipfs resolve -r /ipfs/$DIR/b | cut -d/ -f3)
+'
+
+test_expect_success "'ipfs pin add --fill' requires --lazy" '
+  test_must_fail ipfs pin add --fill $DIR 2>err_fill &&
+  grep "requires --lazy" err_fill
+'
+
+test_expect_success "'ipfs pin add --lazy' succeeds" '
+  ipfs pin add --lazy $DIR >actual_add &&
+  echo "pinned $DIR lazily" >expected_add &&
+  test_cmp expected_add actual_add
+'
+
+test_expect_success "'ipfs pin ls' lists the lazy pin" '
+  ipfs pin ls --type=lazy >actual_ls &&
+  echo "$DIR lazy" >expected_ls &&
+  test_cmp expected_ls actual_ls &&
+  ipfs pin ls $DIR >actual_ls_key &&
+  test_cmp expected_ls actual_ls_key &&
+  ipfs pin ls --type=all | grep "$DIR lazy"
+'
+
+test_expect_success "'ipfs repo gc' keeps the fetched blocks of the lazy pin" '
+  ipfs block rm $B &&
+  ipfs repo gc &&
+  ipfs block stat --offline $DIR &&
+  ipfs block stat --offline $A
+'
+
+test_expect_success "'ipfs pin rm' removes the lazy pin" '
+  ipfs pin rm $DIR &&
+  ipfs pin ls --type=lazy >actual_rm &&
+  test_must_be_empty actual_rm &&
+  test_must_fail ipfs pin ls $DIR
+'
+
+test_expect_success "'ipfs repo gc' removes the blocks once unpinned" '
+  ipfs repo gc &&
+  test_must_fail ipfs block stat --offline $A
+'
+
+test_expect_success "re-add the directory" '
+  ipfs add -Qr --pin=false dir
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs pin add --lazy --fill' fills the pin" '
+  ipfs pin add --lazy --fill $DIR >actual_fill &&
+  echo "pinned $DIR lazily" >expected_fill &&
+  test_cmp expected_fill actual_fill &&
+  go-timeout 10 sh -c "until ipfs pin ls --type=recursive $DIR; do go-sleep 100ms; done" &&
+  ipfs pin ls --type=lazy >actual_filled &&
+  test_must_be_empty actual_filled
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -164,6 +164,69 @@ test_pin_progress() {
   '
 }
 
+test_pin_size() {
+  test_expect_success "pin two files sharing a block" '
+    mkdir -p size/a size/b &&
+    echo "shared" > size/a/shared && cp size/a/shared size/b/shared &&
+    echo "only in a" > size/a/own &&
+    A=$(ipfs add -rQ size/a) &&
+    B=$(ipfs add -rQ size/b)
+  '
+
+  test_expect_success "'ipfs pin ls --size' lists the storage of the pins" '
+    ipfs pin ls --type=recursive --size > sizes &&
+    SHARED=$(ipfs block stat $(ipfs add -Qn size/a/shared) | grep Size | cut -d" " -f2) &&
+    A_TOTAL=$(ipfs pin ls --size $A | cut -d" " -f3) &&
+    A_UNIQUE=$(ipfs pin ls --size $A | cut -d" " -f4) &&
+    test $A_UNIQUE -eq $((A_TOTAL - SHARED)) &&
+    grep "^$B recursive" sizes
+  '
+
+  test_expect_success "the shared block counts for the last pin having it" '
+    ipfs pin rm $A &&
+    B_TOTAL=$(ipfs pin ls --size $B | cut -d" " -f3) &&
+    B_UNIQUE=$(ipfs pin ls --size $B | cut -d" " -f4) &&
+    test $B_UNIQUE -eq $B_TOTAL
+  '
+}
+
+test_pin_meta() {
+  test_expect_success "pin with a name and labels" '
+    NAMED=$(echo "named" | ipfs add -Q --pin=false) &&
+    LABELED=$(echo "labeled" | ipfs add -Q --pin=false) &&
+    ipfs pin add --name=backup --label team=infra --label env=prod $NAMED &&
+    ipfs pin add -r=false --label team=infra $LABELED
+  '
+
+  test_expect_success "'ipfs pin ls --label' lists the labeled pins" '
+    printf "%s\n" "$NAMED recursive backup" "$LABELED direct" | sort > expected &&
+    ipfs pin ls --label team=infra | sort > actual &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "'ipfs pin ls' filters on all the labels and the name" '
+    echo "$NAMED recursive backup" > expected &&
+    ipfs pin ls --label team=infra --label env=prod > actual &&
+    test_cmp expected actual &&
+    ipfs pin ls --name=backup > actual &&
+    test_cmp expected actual &&
+    ipfs pin ls --enc=json --name=backup | grep "\"env\":\"prod\""
+  '
+
+  test_expect_success "'ipfs pin ls --label' rejects invalid labels" '
+    test_must_fail ipfs pin ls --label team 2> err &&
+    grep "must be key=value" err
+  '
+
+  test_expect_success "'ipfs pin rm' removes the name and labels" '
+    ipfs pin rm $NAMED &&
+    ipfs pin add $NAMED &&
+    ipfs pin ls --label team=infra > actual &&
+    echo "$LABELED direct" > expected &&
+    test_cmp expected actual
+  '
+}
+
 test_init_ipfs
 
 test_pins '' '' ''
@@ -180,6 +243,10 @@ test_pin_dag --raw-leaves
 
 test_pin_progress
 
+test_pin_size
+
+test_pin_meta
+
 test_launch_ipfs_daemon_without_network
 
 test_pins '' '' ''
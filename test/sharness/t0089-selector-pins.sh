@@ -0,0 +1,62 @@
+#!/usr/bin/env bash
+
+test_description="Test ipfs pinning with IPLD selectors"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+SELECTOR='{"R":{"l":{"depth":4},":>":{"a":{">":{"@":{}}}}}}'
+
+test_expect_success "create a directory with a large file" '
+  mkdir -p dir &&
+  random 600000 42 > dir/big &&
+  echo small > dir/small &&
+  DIR=$(ipfs add -Qr --pin=false dir) &&
+  BIG=$(ipfs resolve -r /ipfs/$DIR/big | cut -d/ -f3) &&
+  CHUNK=$(ipfs refs $BIG | head -1)
+'
+
+test_expect_success "'ipfs pin add --selector' succeeds" '
+  ipfs pin add --selector="$SELECTOR" $DIR >actual_add &&
+  echo "pinned $DIR with selector" >expected_add &&
+  test_cmp expected_add actual_add
+'
+
+test_expect_success "'ipfs pin add --selector' rejects invalid selectors" '
+  test_must_fail ipfs pin add --selector="{\"x\":{}}" $DIR 2>err_add &&
+  grep "invalid selector" err_add
+'
+
+test_expect_success "'ipfs pin ls' lists the selector pin" '
+  ipfs pin ls --type=selector >actual_ls &&
+  echo "$DIR selector" >expected_ls &&
+  test_cmp expected_ls actual_ls &&
+  ipfs pin ls $DIR >actual_ls_key &&
+  test_cmp expected_ls actual_ls_key &&
+  ipfs pin ls --type=all | grep "$DIR selector"
+'
+
+test_expect_success "'ipfs repo gc' keeps the blocks matched by the selector" '
+  ipfs repo gc &&
+  ipfs cat --offline /ipfs/$DIR/small &&
+  ipfs block stat --offline $BIG
+'
+
+test_expect_success "'ipfs repo gc' removes the blocks not matched by the selector" '
+  test_must_fail ipfs block stat --offline $CHUNK
+'
+
+test_expect_success "'ipfs pin rm' removes the selector pin" '
+  ipfs pin rm $DIR &&
+  ipfs pin ls --type=selector >actual_rm &&
+  test_must_be_empty actual_rm &&
+  test_must_fail ipfs pin ls $DIR
+'
+
+test_expect_success "'ipfs repo gc' removes the blocks once unpinned" '
+  ipfs repo gc &&
+  test_must_fail ipfs block stat --offline $BIG
+'
+
+test_done
@@ -187,6 +187,14 @@ test_expect_success "empty request to get doesn't panic and returns error" '
   curl -X POST "http://$API_ADDR/api/v0/get" > curl_out || true &&
     grep "argument \"ipfs-path\" is required" curl_out
 '
+
+test_expect_success "'ipfs get --track' tracks the fetch for 'ipfs stats fetch'" '
+  HASH=$(echo "tracked fetch" | ipfs add -q) &&
+  ipfs get --track=tracked -o tracked_out "$HASH" &&
+  ipfs stats fetch tracked --enc=json > fetch_out &&
+  grep "\"Blocks\":1," fetch_out &&
+  grep "\"Done\":true" fetch_out
+'
 test_kill_ipfs_daemon
 
 test_done
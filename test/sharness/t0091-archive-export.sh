@@ -0,0 +1,72 @@
+#!/usr/bin/env bash
+
+test_description="Test reproducible archive export"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_archive_export() {
+  test_expect_success "'ipfs archive export' succeeds" '
+    ipfs archive export $DIR > archive1.tar
+  '
+
+  test_expect_success "'ipfs archive export' output is sorted" '
+    tar tf archive1.tar > archive_list &&
+    cat <<-EOF > archive_list_exp &&
+$DIR/
+$DIR/a
+$DIR/b/
+$DIR/b/c
+$DIR/z
+EOF
+    test_cmp archive_list_exp archive_list
+  '
+
+  test_expect_success "'ipfs archive export' metadata is normalized" '
+    tar tvf archive1.tar > archive_verbose &&
+    test $(grep -c " 0/0 .* 1970-01-01 00:00 " archive_verbose) -eq 5 &&
+    test $(grep -c "^drwxr-xr-x" archive_verbose) -eq 2 &&
+    test $(grep -c "^-rw-r--r--" archive_verbose) -eq 3
+  '
+
+  test_expect_success "'ipfs archive export' output is reproducible" '
+    ipfs archive export $DIR > archive2.tar &&
+    test_cmp archive1.tar archive2.tar &&
+    ipfs archive export -C $DIR > archive1.tar.gz &&
+    ipfs archive export -C $DIR > archive2.tar.gz &&
+    test_cmp archive1.tar.gz archive2.tar.gz
+  '
+}
+
+test_expect_success "add a directory" '
+  mkdir -p dir/b &&
+  echo z > dir/z &&
+  echo a > dir/a &&
+  echo c > dir/b/c &&
+  DIR=$(ipfs add -r -Q dir)
+'
+
+test_archive_export
+
+test_expect_success "sharded and basic directories give the same archive" '
+  ipfs config Internal.UnixFSShardingSizeThreshold 1B &&
+  SHARDED=$(ipfs add -r -Q dir) &&
+  ipfs config --json Internal "{}" &&
+  test "$SHARDED" != "$DIR" &&
+  ipfs archive export --name=dir $DIR > basic.tar &&
+  ipfs archive export --name=dir $SHARDED > sharded.tar &&
+  test_cmp basic.tar sharded.tar
+'
+
+test_expect_success "'ipfs archive export' rejects invalid names" '
+  test_must_fail ipfs archive export --name=../dir $DIR
+'
+
+test_launch_ipfs_daemon
+
+test_archive_export
+
+test_kill_ipfs_daemon
+
+test_done
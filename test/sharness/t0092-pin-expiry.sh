@@ -0,0 +1,113 @@
+#!/usr/bin/env bash
+
+test_description="Test expiry of pins by class and TTL"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "configure expiry classes" '
+  ipfs config --json Pinning.Expiry.Classes "{\"temp-uploads\": {\"MaxAge\": \"1s\"}, \"cache\": {\"MaxIdle\": \"1h\"}}"
+'
+
+test_expect_success "'ipfs add --expire-class' rejects unknown classes" '
+  echo unknown > unknown &&
+  test_must_fail ipfs add --expire-class=unknown unknown 2>err_unknown &&
+  grep "unknown expiry class" err_unknown
+'
+
+test_expect_success "'ipfs add --expire-class' requires pinning" '
+  test_must_fail ipfs add --pin=false --expire-class=cache unknown
+'
+
+test_expect_success "add content with expiry classes" '
+  echo temp > temp &&
+  echo cached > cached &&
+  echo kept > kept &&
+  TEMP=$(ipfs add -Q --expire-class=temp-uploads temp) &&
+  CACHED=$(ipfs add -Q --pin=false cached) &&
+  ipfs pin add --expire-class=cache $CACHED &&
+  KEPT=$(ipfs add -Q kept)
+'
+
+test_expect_success "'ipfs pin expire --dry-run' lists the expired pins" '
+  go-sleep 2s &&
+  ipfs pin expire --dry-run >actual_dry &&
+  echo "would unpin $TEMP of class \"temp-uploads\": added more than 1s ago" >expected_dry &&
+  test_cmp expected_dry actual_dry
+'
+
+test_expect_success "'ipfs pin expire --dry-run' removes nothing" '
+  ipfs pin ls --type=recursive $TEMP
+'
+
+test_expect_success "'ipfs pin expire' removes the expired pins" '
+  ipfs pin expire >actual_expire &&
+  echo "unpinned $TEMP of class \"temp-uploads\": added more than 1s ago" >expected_expire &&
+  test_cmp expected_expire actual_expire &&
+  test_must_fail ipfs pin ls $TEMP &&
+  ipfs pin ls --type=recursive $CACHED &&
+  ipfs pin ls --type=recursive $KEPT
+'
+
+test_expect_success "'ipfs pin expire' does nothing once the pins are removed" '
+  ipfs pin expire >actual_again &&
+  test_must_be_empty actual_again
+'
+
+test_expect_success "'ipfs pin rm' removes the expiry" '
+  ipfs pin rm $CACHED &&
+  ipfs pin add $CACHED &&
+  ipfs config --json Pinning.Expiry.Classes.cache.MaxIdle "\"1ns\"" &&
+  ipfs pin expire >actual_rm &&
+  test_must_be_empty actual_rm
+'
+
+test_expect_success "a plain 'ipfs pin add' removes the expiry" '
+  echo again > again &&
+  AGAIN=$(ipfs add -Q --expire-class=temp-uploads again) &&
+  ipfs pin add $AGAIN &&
+  go-sleep 2s &&
+  ipfs pin expire >actual_again_add &&
+  test_must_be_empty actual_again_add &&
+  ipfs pin ls --type=recursive $AGAIN
+'
+
+test_expect_success "a plain 'ipfs add' removes the expiry" '
+  ipfs pin add --expire-class=temp-uploads $AGAIN &&
+  ipfs add -Q again &&
+  go-sleep 2s &&
+  ipfs pin expire >actual_again_readd &&
+  test_must_be_empty actual_again_readd &&
+  ipfs pin ls --type=recursive $AGAIN
+'
+
+test_expect_success "'ipfs pin add --ttl' rejects invalid durations" '
+  test_must_fail ipfs pin add --ttl=0s $KEPT &&
+  test_must_fail ipfs pin add --ttl=soon $KEPT
+'
+
+test_expect_success "add content with a TTL" '
+  echo short > short &&
+  echo long > long &&
+  SHORT=$(ipfs add -Q --pin=false short) &&
+  LONG=$(ipfs add -Q --pin=false long) &&
+  ipfs pin add --ttl=1s $SHORT &&
+  ipfs pin add --ttl=72h $LONG
+'
+
+test_expect_success "'ipfs pin expire --dry-run' lists the pins whose TTL passed" '
+  go-sleep 2s &&
+  ipfs pin expire --dry-run >actual_ttl &&
+  grep "would unpin $SHORT: TTL passed at" actual_ttl &&
+  test_line_count = 1 actual_ttl
+'
+
+test_expect_success "'ipfs repo gc' collects the pins whose TTL passed" '
+  ipfs repo gc &&
+  test_must_fail ipfs pin ls $SHORT &&
+  test_must_fail ipfs block stat --offline $SHORT &&
+  ipfs pin ls --type=recursive $LONG
+'
+
+test_done
@@ -0,0 +1,59 @@
+#!/usr/bin/env bash
+
+test_description="Test the low-power mode"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs lowpower status' requires a running daemon" '
+  test_must_fail ipfs lowpower status 2>err_offline &&
+  grep "must be run in online mode" err_offline
+'
+
+test_expect_success "apply the lowpower-v2 profile" '
+  ipfs config profile apply lowpower-v2 &&
+  test $(ipfs config LowPower.Enabled) = true
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "the low-power mode is enabled on start" '
+  ipfs lowpower status >actual_status &&
+  test_should_contain "low-power mode enabled: awake 1m0s, asleep 9m0s, intervals x2" actual_status &&
+  test_should_contain "awake until" actual_status
+'
+
+test_expect_success "'ipfs lowpower enable' changes the settings" '
+  ipfs lowpower enable --awake=1s --sleep=2s --interval-multiplier=4 >actual_enable &&
+  test_should_contain "awake 1s, asleep 2s, intervals x4" actual_enable
+'
+
+test_expect_success "the daemon falls asleep" '
+  go-sleep 1500ms &&
+  ipfs lowpower status >actual_asleep &&
+  test_should_contain "asleep until" actual_asleep
+'
+
+test_expect_success "'ipfs lowpower enable' rejects invalid settings" '
+  test_must_fail ipfs lowpower enable --interval-multiplier=0 2>err_invalid &&
+  test_should_contain "interval multiplier must be at least 1" err_invalid
+'
+
+test_expect_success "'ipfs lowpower disable' disables the low-power mode" '
+  ipfs lowpower disable >actual_disable &&
+  echo "low-power mode disabled" >expected_disable &&
+  test_cmp expected_disable actual_disable &&
+  ipfs lowpower status --enc=json | grep "\"Enabled\":false"
+'
+
+test_expect_success "the daemon still adds content" '
+  echo hello | ipfs add -Q >hash &&
+  ipfs cat $(cat hash) >actual_cat &&
+  echo hello >expected_cat &&
+  test_cmp expected_cat actual_cat
+'
+
+test_kill_ipfs_daemon
+
+test_done
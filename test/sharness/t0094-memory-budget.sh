@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+test_description="Test the memory budget"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs stats memory' requires a budget" '
+  test_must_fail ipfs stats memory 2>err_nobudget &&
+  test_should_contain "no memory budget" err_nobudget
+'
+
+test_expect_success "add content" '
+  echo hello >hello &&
+  HASH=$(ipfs add -Q hello)
+'
+
+test_expect_success "set a budget the daemon cannot stay within" '
+  ipfs config MemoryBudget.Limit 1MB &&
+  ipfs config MemoryBudget.MaxWait 1s
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs stats memory' reports the pressure" '
+  ipfs stats memory >actual_stats &&
+  test_should_contain "Limit: *1.0 MB" actual_stats &&
+  test_should_contain "UnderPressure: *true" actual_stats
+'
+
+test_expect_success "API requests are declined under pressure" '
+  test_must_fail ipfs cat $HASH 2>err_cat &&
+  test_should_contain "over its memory budget" err_cat
+'
+
+test_expect_success "gateway requests are declined under pressure" '
+  curl -s -o /dev/null -w "%{http_code}" "http://$GWAY_ADDR/ipfs/$HASH" >actual_code &&
+  echo 503 >expected_code &&
+  test_cmp expected_code actual_code
+'
+
+test_expect_success "'ipfs stats memory' counts the declined requests" '
+  ipfs stats memory --enc=json >actual_json &&
+  test_should_contain "\"RequestsRejected\":2" actual_json
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "set a budget the daemon stays within" '
+  ipfs config MemoryBudget.Limit 64GB
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "requests are served within the budget" '
+  ipfs cat $HASH >actual_cat &&
+  test_cmp hello actual_cat &&
+  ipfs stats memory >actual_ok &&
+  test_should_contain "UnderPressure: *false" actual_ok
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -182,6 +182,24 @@ test_refs_output '' 'cat'
 
 test_refs_output '--cid-base=base32' 'ipfs cid base32'
 
+test_expect_success "'ipfs refs -r --progress' writes the refs, and the progress to stderr" '
+  ipfs refs -r $refsroot > expected.txt &&
+  ipfs refs -r --progress $refsroot > refsr.txt 2> progress.txt &&
+  test_cmp expected.txt refsr.txt &&
+  grep "done in" progress.txt
+'
+
+test_expect_success "'ipfs refs -r --progress --enc=json' streams the progress" '
+  ipfs refs -r --progress --enc=json $refsroot | tail -n 1 > progress.json &&
+  grep "\"Done\":true" progress.json &&
+  grep "\"Fetched\":0" progress.json
+'
+
+test_expect_success "'ipfs stats fetch' fails for a fetch not tracked" '
+  test_must_fail ipfs stats fetch nothing 2> fetch_err &&
+  grep "no fetch tracked" fetch_err
+'
+
 test_kill_ipfs_daemon
 
 test_done
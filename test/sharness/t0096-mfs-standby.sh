@@ -0,0 +1,52 @@
+#!/usr/bin/env bash
+
+test_description="Test the hot-standby replication of the MFS root"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs files standby promote' needs a replicated root" '
+  test_must_fail ipfs files standby promote 2>err_promote &&
+  test_should_contain "no MFS root was replicated" err_promote
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs files standby status' needs the replication" '
+  test_must_fail ipfs files standby status 2>err_status &&
+  test_should_contain "MFS replication is not enabled" err_status
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "enable publishing the MFS root" '
+  ipfs config --json Files.Replication.Publish true
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs files standby status' reports the published root" '
+  echo hot >hot &&
+  ipfs files write --create /hot hot &&
+  ROOT=$(ipfs files stat --hash /) &&
+  ipfs files standby status >actual_status &&
+  test_should_contain "publishing $ROOT" actual_status
+'
+
+test_expect_success "'ipfs files standby promote' needs the daemon stopped" '
+  test_must_fail ipfs files standby promote 2>err_online &&
+  test_should_contain "must be run in offline mode" err_online
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "follower needs signed pubsub messages" '
+  ipfs config --json Files.Replication.Publish false &&
+  ipfs config Files.Replication.Follow $(ipfs config Identity.PeerID) &&
+  ipfs config --json Pubsub.DisableSigning true &&
+  test_must_fail ipfs daemon 2>err_daemon &&
+  test_should_contain "DisableSigning" err_daemon
+'
+
+test_done
@@ -0,0 +1,95 @@
+#!/usr/bin/env bash
+
+test_description="Test following the pinset of a node"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs pin export' lists the recursive pins" '
+  echo followed >followed &&
+  HASH=$(ipfs add -Q followed) &&
+  EXPORT=$(ipfs pin export -q) &&
+  ipfs cat $EXPORT >actual_export &&
+  test_should_contain "^$HASH\$" actual_export
+'
+
+test_expect_success "'ipfs pin export' replaces the previous export" '
+  EXPORT2=$(ipfs pin export -q) &&
+  ipfs cat $EXPORT2 >actual_export2 &&
+  test_cmp actual_export actual_export2 &&
+  test $EXPORT = $EXPORT2
+'
+
+test_expect_success "'ipfs pin diff' shows no change since the export" '
+  ipfs pin diff >actual_nodiff &&
+  test_must_be_empty actual_nodiff
+'
+
+test_expect_success "'ipfs pin diff' streams the pins added and removed" '
+  echo other >other &&
+  OTHER=$(ipfs add -Q other) &&
+  ipfs pin rm $HASH &&
+  ipfs pin diff >actual_diff &&
+  printf "+ %s\n- %s\n" $OTHER $HASH >expected_diff &&
+  test_cmp expected_diff actual_diff
+'
+
+test_expect_success "'ipfs pin diff --export' exports the pins compared" '
+  ipfs pin diff --export >actual_diff_export &&
+  SNAPSHOT=$(sed -n "s/^snapshot //p" actual_diff_export) &&
+  ipfs cat $SNAPSHOT >actual_snapshot &&
+  test_should_contain "^$OTHER\$" actual_snapshot &&
+  ! grep -q "^$HASH\$" actual_snapshot &&
+  ipfs pin diff >actual_diff_after &&
+  test_must_be_empty actual_diff_after &&
+  ipfs pin diff $EXPORT >actual_diff_old &&
+  test_cmp expected_diff actual_diff_old
+'
+
+test_expect_success "restore the pins exported" '
+  ipfs pin rm $OTHER &&
+  ipfs pin add $HASH &&
+  test $(ipfs pin export -q) = $EXPORT
+'
+
+test_expect_success "unpin the content, and follow the export" '
+  ipfs pin rm $HASH &&
+  ipfs config Pinning.Follow.Source /ipfs/$EXPORT
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs pin follow sync' pins the pinset" '
+  ipfs pin follow sync >actual_sync &&
+  test_should_contain "following /ipfs/$EXPORT" actual_sync &&
+  ipfs pin ls --type=recursive $HASH
+'
+
+test_expect_success "'ipfs pin follow status' reports the mirrored pins" '
+  ipfs pin follow status --enc=json >actual_status &&
+  test_should_contain "\"Mirrored\":1" actual_status &&
+  ! grep -q "\"Error\"" actual_status
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "'ipfs pin follow' runs on the daemon only" '
+  test_must_fail ipfs pin follow status 2>err_offline &&
+  test_should_contain "must be run on the daemon" err_offline
+'
+
+test_expect_success "stop following" '
+  ipfs config Pinning.Follow.Source ""
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs pin follow status' needs a source" '
+  test_must_fail ipfs pin follow status 2>err_nosource &&
+  test_should_contain "pinset following is not enabled" err_nosource
+'
+
+test_kill_ipfs_daemon
+
+test_done
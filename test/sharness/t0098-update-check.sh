@@ -0,0 +1,63 @@
+#!/usr/bin/env bash
+
+test_description="Test checking for newer versions"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add a distribution site with a newer version" '
+  mkdir -p dist/go-ipfs &&
+  printf "v0.1.0\nv99.0.0-rc1\nv99.0.0\nv100.0.0-dev\n" >dist/go-ipfs/versions &&
+  DIST=$(ipfs add -Q -r dist) &&
+  ipfs config Update.DistPath /ipfs/$DIST
+'
+
+test_expect_success "enable the checks" '
+  ipfs config --json Update.Check true
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs version check' reports the newer version" '
+  ipfs version check >actual_check &&
+  test_should_contain "^go-ipfs 99.0.0 is available, this node runs " actual_check
+'
+
+test_expect_success "'ipfs version check' reports the status" '
+  ipfs version check --enc=json >actual_status &&
+  test_should_contain "\"Latest\":\"99.0.0\"" actual_status &&
+  test_should_contain "\"Available\":true" actual_status
+'
+
+test_expect_success "the newer version is reported by the metrics" '
+  curl -s "http://$API_ADDR/debug/metrics/prometheus" >actual_metrics &&
+  test_should_contain "^ipfs_update_available{latest=\"99.0.0\"} 1$" actual_metrics
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "add a distribution site without a newer version" '
+  printf "v0.1.0\n" >dist/go-ipfs/versions &&
+  DIST=$(ipfs add -Q -r dist) &&
+  ipfs config Update.DistPath /ipfs/$DIST &&
+  ipfs config --json Update.Check false
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs version check' checks without Update.Check" '
+  ipfs version check >actual_check &&
+  test_should_contain "is up to date$" actual_check
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "an invalid Update.Interval is rejected" '
+  ipfs config --json Update.Check true &&
+  ipfs config Update.Interval 0s &&
+  test_must_fail ipfs daemon 2>err_interval &&
+  test_should_contain "Update.Interval must be positive" err_interval
+'
+
+test_done
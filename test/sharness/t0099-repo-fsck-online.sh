@@ -0,0 +1,56 @@
+#!/usr/bin/env bash
+
+test_description="Test ipfs repo fsck --online"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs repo fsck' is a no-op without --online" '
+  ipfs repo fsck >actual_noop &&
+  test_should_contain "does nothing" actual_noop
+'
+
+test_expect_success "add a file of several blocks" '
+  random 600000 42 >afile &&
+  HASH=$(ipfs add -Q afile) &&
+  CHILD=$(ipfs refs $HASH | head -n 1)
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "'ipfs repo fsck --online' finds the repo consistent" '
+  ipfs repo fsck --online >actual_ok &&
+  test_should_contain "the repo is consistent" actual_ok
+'
+
+test_expect_success "remove a block of the pinned file" '
+  MH=$(ipfs cid format -f "%M" -b base32upper $CHILD) &&
+  find "$IPFS_PATH/blocks" -name "$MH.data" -exec mv {} block_backup \; &&
+  test -f block_backup
+'
+
+test_expect_success "'ipfs repo fsck --online' reports the missing block" '
+  test_must_fail ipfs repo fsck --online >actual_missing &&
+  test_should_contain "^pins: recursive pin $HASH is missing block $CHILD$" actual_missing
+'
+
+test_expect_success "'ipfs repo fsck --online' reports as JSON" '
+  test_must_fail ipfs repo fsck --online --enc=json >actual_json &&
+  test_should_contain "\"Check\":\"pins\"" actual_json
+'
+
+test_expect_success "restore the block" '
+  ipfs block put block_backup &&
+  ipfs repo fsck --online >actual_restored &&
+  test_should_contain "the repo is consistent" actual_restored
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "'ipfs repo fsck --online' runs without the daemon" '
+  ipfs repo fsck --online >actual_offline &&
+  test_should_contain "the repo is consistent" actual_offline
+'
+
+test_done
@@ -236,6 +236,32 @@ test_name_with_self() {
 
         test_kill_ipfs_daemon
 
+        # test resolving from a stale record
+
+        test_expect_success "'ipfs name publish --lifetime' succeeds" '
+        ipfs name publish --allow-offline --lifetime=1s "/ipfs/$HASH_WELCOME_DOCS" &&
+        sleep 2
+        '
+
+        test_expect_success "'ipfs name resolve' fails for an expired record" '
+        test_expect_code 1 ipfs name resolve "$PEERID"
+        '
+
+        test_expect_success "'ipfs name resolve --allow-stale' succeeds" '
+        ipfs name resolve --allow-stale "$PEERID" >output 2>stale_err
+        '
+
+        test_expect_success "resolve output looks good (stale record)" '
+        printf "/ipfs/%s\n" "$HASH_WELCOME_DOCS" >expected5 &&
+        test_cmp expected5 output &&
+        grep "cached record that may be stale" stale_err
+        '
+
+        test_expect_success "'ipfs name resolve --allow-stale' marks the result as stale" '
+        ipfs name resolve --allow-stale --enc=json "$PEERID" >output 2>/dev/null &&
+        grep "\"Stale\":true" output
+        '
+
         test_expect_success "clean up ipfs dir" '
         rm -rf "$IPFS_PATH"
         '
@@ -197,6 +197,37 @@ test_expect_success "HEAD 'index.html' has no content" '
   [ ! -s output ]
 '
 
+test_expect_success "add a file and remove its leaves" '
+  random 600000 7 >headfile &&
+  HEADHASH=$(ipfs add -Q --pin=false headfile) &&
+  ipfs refs $HEADHASH | xargs ipfs block rm >/dev/null
+'
+
+test_expect_success "HEAD of the file does not fetch its leaves" '
+  curl -sI --max-time 5 "http://127.0.0.1:$port/ipfs/$HEADHASH" >headout &&
+  test_should_contain "HTTP/1.1 200 OK" headout &&
+  test_should_contain "Content-Length: 600000" headout &&
+  ! grep -qi "^Content-Type" headout
+'
+
+test_expect_success "HEAD of the file takes the type of its extension" '
+  curl -sI --max-time 5 "http://127.0.0.1:$port/ipfs/$HEADHASH?filename=head.txt" >headout_ext &&
+  test_should_contain "Content-Type: text/plain" headout_ext
+'
+
+test_expect_success "add a file and remove the leaves out of a range" '
+  random 3000000 8 >rangefile &&
+  RANGEHASH=$(ipfs add -Q --pin=false rangefile) &&
+  ipfs refs $RANGEHASH | sed 8d | xargs ipfs block rm >/dev/null
+'
+
+# 2000000-2000099 is in the 8th leaf of 256KiB
+test_expect_success "GET a range of the file only fetches the leaves of the range" '
+  curl -s --max-time 5 -H "Range: bytes=2000000-2000099" "http://127.0.0.1:$port/ipfs/$RANGEHASH?filename=range.txt" >rangeout &&
+  dd if=rangefile of=expected_rangeout bs=1 skip=2000000 count=100 2>/dev/null &&
+  test_cmp expected_rangeout rangeout
+'
+
 # test ipfs readonly api
 
 test_curl_gateway_api() {
@@ -135,6 +135,56 @@ test_expect_success "dnslink gw: hash column should be a CID link to cid.ipfs.io
   test_should_contain "<a class=\"ipfs-hash\" translate=\"no\" href=\"https://cid.ipfs.io/#$FILE_CID\" target=\"_blank\" rel=\"noreferrer noopener\">" list_response
 '
 
+## ============================================================================
+## Test branding of dir listing and error pages (Gateway.PublicGateways)
+## ============================================================================
+
+test_kill_ipfs_daemon
+
+BRANDED_HOSTNAME="ipfs.example.edu"
+test_expect_success "configure branding of $BRANDED_HOSTNAME" '
+  ipfs config --json Gateway.PublicGateways "{
+    \"$BRANDED_HOSTNAME\": {
+      \"Paths\": [\"/ipfs\", \"/ipns\"],
+      \"HeaderHTML\": \"<header>Example University</header>\",
+      \"FooterHTML\": \"<footer>Legal notice</footer>\",
+      \"Locale\": \"de-CH\"
+    }
+  }"
+'
+
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "branded gw: dir listing has the header, footer and locale" '
+  curl -sD - --resolve $BRANDED_HOSTNAME:$GWAY_PORT:127.0.0.1 http://$BRANDED_HOSTNAME:$GWAY_PORT/ipfs/${DIR_CID}/ > list_response &&
+  test_should_contain "Index of" list_response &&
+  test_should_contain "Content-Language: de-CH" list_response &&
+  test_should_contain "<html lang=\"de-CH\">" list_response &&
+  test_should_contain "<header>Example University</header>" list_response &&
+  test_should_contain "<footer>Legal notice</footer>" list_response
+'
+
+test_expect_success "branded gw: error page has the header and footer for browsers" '
+  curl -sD - -H "Accept: text/html" --resolve $BRANDED_HOSTNAME:$GWAY_PORT:127.0.0.1 http://$BRANDED_HOSTNAME:$GWAY_PORT/ipfs/${DIR_CID}/missing > error_response &&
+  test_should_contain "HTTP/1.1 404 Not Found" error_response &&
+  test_should_contain "Content-Type: text/html" error_response &&
+  test_should_contain "<header>Example University</header>" error_response &&
+  test_should_contain "no link named" error_response
+'
+
+test_expect_success "branded gw: error is plain text for other clients" '
+  curl -sD - --resolve $BRANDED_HOSTNAME:$GWAY_PORT:127.0.0.1 http://$BRANDED_HOSTNAME:$GWAY_PORT/ipfs/${DIR_CID}/missing > error_response &&
+  test_should_contain "HTTP/1.1 404 Not Found" error_response &&
+  test_should_contain "Content-Type: text/plain" error_response &&
+  ! grep -q "Example University" error_response
+'
+
+test_expect_success "path gw: dir listing on other hostnames is not branded" '
+  curl -s http://127.0.0.1:$GWAY_PORT/ipfs/${DIR_CID}/ > list_response &&
+  test_should_contain "Index of" list_response &&
+  ! grep -q "Example University" list_response
+'
+
 ## ============================================================================
 ## End of tests, cleanup
 ## ============================================================================
@@ -145,6 +145,30 @@ test_expect_success "Prepare IPNS unixfs content path for testing" '
     grep "< Etag: \"${FILE_CID}\"" curl_ipns_file_output
     '
 
+    ## formats
+    test_expect_success "GET /ipfs/ responses have an Etag for each format" '
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=tar" >/dev/null 2>curl_tar_output &&
+    grep "< Etag: \"${ROOT4_CID}.x-tar\"" curl_tar_output &&
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=zip" >/dev/null 2>curl_zip_output &&
+    grep "< Etag: \"${ROOT4_CID}.zip\"" curl_zip_output &&
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=dag-json" >/dev/null 2>curl_dag_json_output &&
+    grep "< Etag: \"${ROOT4_CID}.dag-json\"" curl_dag_json_output &&
+    grep "< Vary: Accept" curl_dag_json_output
+    '
+    test_expect_success "GET /ipfs/ honors If-None-Match for each format" '
+    curl -so /dev/null -w "%{http_code}\n" -H "If-None-Match: \"${ROOT4_CID}.raw\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=raw" >status_codes &&
+    curl -so /dev/null -w "%{http_code}\n" -H "If-None-Match: W/\"${ROOT4_CID}.car\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=car" >>status_codes &&
+    curl -so /dev/null -w "%{http_code}\n" -H "If-None-Match: W/\"${ROOT4_CID}.x-tar\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=tar" >>status_codes &&
+    curl -so /dev/null -w "%{http_code}\n" -H "If-None-Match: \"${ROOT4_CID}.dag-json\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=dag-json" >>status_codes &&
+    printf "304\n304\n304\n304\n" >expected &&
+    test_cmp expected status_codes
+    '
+    test_expect_success "GET /ipfs/ ignores If-None-Match for another format" '
+    curl -so /dev/null -w "%{http_code}\n" -H "If-None-Match: \"${ROOT4_CID}.raw\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT4_CID?format=car" >status_code &&
+    echo 200 >expected &&
+    test_cmp expected status_code
+    '
+
 test_kill_ipfs_daemon
 
 test_done
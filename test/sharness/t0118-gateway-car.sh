@@ -103,17 +103,16 @@ test_launch_ipfs_daemon_without_network
     grep "< X-Content-Type-Options: nosniff" curl_output
     '
 
-    # CAR is streamed, gateway may not have the entire thing, unable to support range-requests
-    # Partial downloads and resumes should be handled using
-    # IPLD selectors: https://github.com/ipfs/go-ipfs/issues/8769
+    # Range requests are served from the index of the CAR
     test_expect_success "GET response for application/vnd.ipld.car includes Accept-Ranges header" '
-    grep "< Accept-Ranges: none" curl_output
+    grep "< Accept-Ranges: bytes" curl_output
     '
 
 # Cache control HTTP headers
 
-    test_expect_success "GET response for application/vnd.ipld.car includes a weak Etag" '
-    grep "< Etag: W/\"${FILE_CID}.car\"" curl_output
+    # The blocks are written in the order of the traversal, the CAR is always the same
+    test_expect_success "GET response for application/vnd.ipld.car includes a strong Etag" '
+    grep "< Etag: \"${FILE_CID}.car\"" curl_output
     '
 
     # (basic checks, detailed behavior for some fields is tested in  t0116-gateway-cache.sh)
@@ -126,6 +125,134 @@ test_launch_ipfs_daemon_without_network
     grep "< Cache-Control: no-cache, no-transform" curl_output
     '
 
+# Range requests
+
+    test_expect_success "GET for application/vnd.ipld.car of the whole DAG" '
+    curl -sX GET -H "Accept: application/vnd.ipld.car" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID" -o full.car &&
+    FULL_SIZE=$(wc -c < full.car | tr -d " ")
+    '
+
+    test_expect_success "GET with a Range header returns 206 and the range of the CAR" '
+    curl -svX GET -H "Accept: application/vnd.ipld.car" -H "Range: bytes=100-199" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID" -o range.car 2>curl_output &&
+    grep "< HTTP/1.1 206 Partial Content" curl_output &&
+    grep "< Content-Range: bytes 100-199/$FULL_SIZE" curl_output &&
+    dd if=full.car of=expected_range.car bs=1 skip=100 count=100 2>/dev/null &&
+    test_cmp expected_range.car range.car
+    '
+
+    test_expect_success "a CAR downloaded in ranges is the whole CAR" '
+    curl -sX GET -H "Accept: application/vnd.ipld.car" -H "Range: bytes=0-149" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID" -o resumed.car &&
+    curl -sX GET -H "Accept: application/vnd.ipld.car" -H "Range: bytes=150-" -H "If-Range: \"${ROOT_DIR_CID}.car\"" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID" >> resumed.car &&
+    test_cmp full.car resumed.car
+    '
+
+    test_expect_success "GET with an unsatisfiable Range returns 416" '
+    curl -svX GET -H "Accept: application/vnd.ipld.car" -H "Range: bytes=$FULL_SIZE-" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID" >/dev/null 2>curl_output &&
+    grep "< HTTP/1.1 416 Requested Range Not Satisfiable" curl_output
+    '
+
+# Shallow CARs
+
+    test_expect_success "GET with scope=block returns a CAR of the root block only" '
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID?format=car&scope=block" -o block.car 2>curl_output &&
+    grep "< Etag: \"${ROOT_DIR_CID}.depth-0.car\"" curl_output &&
+    purge_blockstore &&
+    ipfs dag import --pin-roots=false block.car &&
+    ipfs block stat --offline $ROOT_DIR_CID &&
+    test_must_fail ipfs block stat --offline $FILE_CID
+    '
+
+    test_expect_success "GET with depth=1 returns a CAR of the root block and its children" '
+    ipfs dag import test-dag.car &&
+    SUBDIR_CID=$(ipfs resolve -r /ipfs/$ROOT_DIR_CID/subdir | cut -d "/" -f3) &&
+    curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID?format=car&depth=1" -o depth1.car &&
+    purge_blockstore &&
+    ipfs dag import --pin-roots=false depth1.car &&
+    ipfs block stat --offline $ROOT_DIR_CID &&
+    ipfs block stat --offline $SUBDIR_CID &&
+    test_must_fail ipfs block stat --offline $FILE_CID
+    '
+
+    test_expect_success "GET with a depth past the leaves returns the CAR of the whole DAG" '
+    ipfs dag import test-dag.car &&
+    curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID?format=car&depth=10" -o deep.car &&
+    test_cmp full.car deep.car
+    '
+
+    test_expect_success "GET with a Range header returns the range of a shallow CAR" '
+    curl -sX GET -H "Range: bytes=10-" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID?format=car&depth=1" -o depth1-range.car &&
+    dd if=depth1.car of=expected-depth1-range.car bs=1 skip=10 2>/dev/null &&
+    test_cmp expected-depth1-range.car depth1-range.car
+    '
+
+    test_expect_success "GET with an invalid depth returns HTTP 400 Bad Request error" '
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID?format=car&depth=-1" > curl_output 2>&1 &&
+    grep "400 Bad Request" curl_output &&
+    grep "invalid CAR scope" curl_output
+    '
+
+# Entity CARs
+
+    test_expect_success "Create a file of several blocks" '
+    random 1048576 42 > big.bin &&
+    BIG_CID=$(ipfs add -Q --cid-version 1 --chunker=size-262144 big.bin) &&
+    ipfs dag export $BIG_CID > big.car
+    '
+
+    test_expect_success "GET with scope=entity of a directory returns a CAR without its entries" '
+    ipfs dag import test-dag.car &&
+    SUBDIR_CID=$(ipfs resolve -r /ipfs/$ROOT_DIR_CID/subdir | cut -d "/" -f3) &&
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID/subdir?format=car&scope=entity" -o entity.car 2>curl_output &&
+    grep "< Etag: \"${SUBDIR_CID}.entity.car\"" curl_output &&
+    purge_blockstore &&
+    ipfs dag import --pin-roots=false entity.car &&
+    ipfs block stat --offline $SUBDIR_CID &&
+    test_must_fail ipfs block stat --offline $FILE_CID
+    '
+
+    test_expect_success "GET with scope=entity of a file returns the CAR of the whole file" '
+    ipfs dag import big.car &&
+    curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&scope=entity" -o big-entity.car &&
+    test_cmp big.car big-entity.car
+    '
+
+    test_expect_success "GET with entity-bytes returns the blocks of the range of the file" '
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&entity-bytes=0:1023" -o first.car 2>curl_output &&
+    grep "< Etag: \"${BIG_CID}.entity-bytes-0-1023.car\"" curl_output &&
+    purge_blockstore &&
+    ipfs dag import --pin-roots=false --stats first.car | grep "Imported 2 blocks" &&
+    ipfs cat --offline -l 1024 $BIG_CID > first.bin &&
+    head -c 1024 big.bin > expected-first.bin &&
+    test_cmp expected-first.bin first.bin &&
+    test_must_fail ipfs cat --offline -o 262144 -l 1 $BIG_CID
+    '
+
+    test_expect_success "GET with entity-bytes counted from the end returns the blocks of the end of the file" '
+    ipfs dag import big.car &&
+    curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&entity-bytes=-262145:*" -o last.car &&
+    purge_blockstore &&
+    ipfs dag import --pin-roots=false last.car &&
+    ipfs cat --offline -o 786431 $BIG_CID > last.bin &&
+    tail -c 262145 big.bin > expected-last.bin &&
+    test_cmp expected-last.bin last.bin &&
+    test_must_fail ipfs cat --offline -l 1 $BIG_CID
+    '
+
+    test_expect_success "GET with a Range header returns the range of an entity CAR" '
+    ipfs dag import big.car &&
+    curl -sX GET -H "Range: bytes=10-" "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&entity-bytes=0:1023" -o first-range.car &&
+    dd if=first.car of=expected-first-range.car bs=1 skip=10 2>/dev/null &&
+    test_cmp expected-first-range.car first-range.car
+    '
+
+    test_expect_success "GET with an invalid entity-bytes returns HTTP 400 Bad Request error" '
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&entity-bytes=10:1" > curl_output 2>&1 &&
+    grep "400 Bad Request" curl_output &&
+    curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$BIG_CID?format=car&scope=block&entity-bytes=0:*" > curl_output 2>&1 &&
+    grep "400 Bad Request" curl_output &&
+    grep "invalid CAR scope" curl_output
+    '
+
 test_kill_ipfs_daemon
 
 test_done
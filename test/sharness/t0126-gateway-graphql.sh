@@ -0,0 +1,45 @@
+#!/usr/bin/env bash
+
+test_description="Test experimental GraphQL endpoint of the HTTP Gateway"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "Create fixtures" '
+  DOC_CID=$(echo "{\"name\": \"go-ipfs\", \"tags\": [\"ipfs\", \"go\"], \"author\": {\"name\": \"ipfs\"}}" | ipfs dag put)
+'
+
+test_expect_success "GraphQL endpoint is disabled by default" '
+  curl -s -o /dev/null -w "%{http_code}" "http://127.0.0.1:$GWAY_PORT/graphql" >actual_disabled &&
+  echo -n 404 >expected_disabled &&
+  test_cmp expected_disabled actual_disabled
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "enable GraphQL endpoint" '
+  ipfs config --json Experimental.GraphQL true
+'
+
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "POST a GraphQL query returns the selected fields" '
+  curl -s -X POST -H "Content-Type: application/graphql" \
+    --data-binary "{ node(cid: \"$DOC_CID\") { name first: _(path: \"tags/0\") author { name } } }" \
+    "http://127.0.0.1:$GWAY_PORT/graphql" >actual_post &&
+  echo "{\"data\":{\"node\":{\"name\":\"go-ipfs\",\"first\":\"ipfs\",\"author\":{\"name\":\"ipfs\"}}}}" >expected_post &&
+  test_cmp expected_post actual_post
+'
+
+test_expect_success "an invalid GraphQL query fails" '
+  curl -s -o /dev/null -w "%{http_code}" -G --data-urlencode "query={ node" \
+    "http://127.0.0.1:$GWAY_PORT/graphql" >actual_invalid &&
+  echo -n 400 >expected_invalid &&
+  test_cmp expected_invalid actual_invalid
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,47 @@
+#!/usr/bin/env bash
+
+test_description="Test HTTP Gateway File Stat (application/vnd.ipfs.file-stat+json) Support"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "Create text fixtures" '
+  mkdir -p dir &&
+  random 600000 11 > dir/file.bin &&
+  ROOT_DIR_CID=$(ipfs add -Qrw --cid-version 1 dir) &&
+  FILE_CID=$(ipfs resolve -r /ipfs/$ROOT_DIR_CID/dir/file.bin | cut -d "/" -f3)
+'
+
+test_expect_success "GET with stat=true param returns the stat of a file" '
+  curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID/dir/file.bin?stat=true" > curl_stat_param_output &&
+  test_should_contain "\"Cid\":\"$FILE_CID\"" curl_stat_param_output &&
+  test_should_contain "\"Type\":\"file\"" curl_stat_param_output &&
+  test_should_contain "\"Size\":600000" curl_stat_param_output &&
+  test_should_contain "\"Blocks\":3" curl_stat_param_output &&
+  test_should_contain "\"BlockSizes\":\[262144,262144,75712\]" curl_stat_param_output &&
+  test_should_contain "\"RawLeaves\":true" curl_stat_param_output
+'
+
+test_expect_success "GET for application/vnd.ipfs.file-stat+json returns the same stat" '
+  curl -sX GET -H "Accept: application/vnd.ipfs.file-stat+json" "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID/dir/file.bin" > curl_stat_accept_output &&
+  test_cmp curl_stat_param_output curl_stat_accept_output
+'
+
+test_expect_success "GET with stat=true param returns the stat of a directory" '
+  curl -sX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID/dir?stat=true" > curl_stat_dir_output &&
+  test_should_contain "\"Type\":\"directory\"" curl_stat_dir_output &&
+  test_should_contain "\"Blocks\":1" curl_stat_dir_output
+'
+
+test_expect_success "GET response for application/vnd.ipfs.file-stat+json has expected headers" '
+  curl -svX GET "http://127.0.0.1:$GWAY_PORT/ipfs/$ROOT_DIR_CID/dir/file.bin?stat=true" >/dev/null 2>curl_output &&
+  grep "< Content-Type: application/vnd.ipfs.file-stat+json" curl_output &&
+  grep "< X-Content-Type-Options: nosniff" curl_output &&
+  grep "< Etag: \"${FILE_CID}.file-stat+json\"" curl_output
+'
+
+test_kill_ipfs_daemon
+
+test_done
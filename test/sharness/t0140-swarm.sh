@@ -205,6 +205,51 @@ test_expect_success "addresses contain /p2p/..." '
   test_should_contain "/p2p/$(iptb attr get 0 id)\"" 0see0
 '
 
+test_expect_success "disconnect by criteria keeps the connections not matching" '
+  ipfsi 0 swarm disconnect --relayed >actual &&
+  test_must_be_empty actual &&
+  ipfsi 0 swarm disconnect --cidr=192.0.2.0/24 >actual &&
+  test_must_be_empty actual &&
+  [ $(ipfsi 0 swarm peers | wc -l) -eq 1 ]
+'
+
+test_expect_success "disconnect by criteria closes the connections matching" '
+  ipfsi 0 swarm disconnect --cidr=127.0.0.0/8 --protocol=/ipfs/id/1.0.0 >actual &&
+  grep "disconnect $(iptb attr get 1 id) .* success" actual &&
+  [ $(ipfsi 0 swarm peers | wc -l) -eq 0 ]
+'
+
+test_expect_success "disconnect can not combine addresses and criteria" '
+  test_must_fail ipfsi 0 swarm disconnect --relayed "/p2p/$(iptb attr get 1 id)" 2>err &&
+  grep "addresses and criteria can not be combined" err
+'
+
+test_expect_success "'ipfs swarm events' streams the connections and disconnections" '
+  ipfsi 0 swarm events --enc=json > events &
+  EVENTS_PID=$! &&
+  sleep 1 &&
+  ipfsi 0 swarm connect "/p2p/$(iptb attr get 1 id)" &&
+  sleep 1 &&
+  ipfsi 0 swarm disconnect "/p2p/$(iptb attr get 1 id)" &&
+  sleep 1 &&
+  kill $EVENTS_PID &&
+  grep "{\"Type\":\"connected\",.*\"Peer\":\"$(iptb attr get 1 id)\",\"Conns\":\[{\"Addr\":\"/ip4/127.0.0.1/" events &&
+  grep "{\"Type\":\"identified\",.*\"Peer\":\"$(iptb attr get 1 id)\",\"AgentVersion\":\"go-ipfs/" events &&
+  grep "{\"Type\":\"disconnected\",.*\"Peer\":\"$(iptb attr get 1 id)\"}" events
+'
+
+test_expect_success "reconnect the nodes" '
+  ipfsi 0 swarm connect "/p2p/$(iptb attr get 1 id)"
+'
+
+test_expect_success "'ipfs swarm events --initial' starts with the peers connected" '
+  ipfsi 0 swarm events --initial > events &
+  EVENTS_PID=$! &&
+  sleep 1 &&
+  kill $EVENTS_PID &&
+  grep "^connected $(iptb attr get 1 id) /ip4/127.0.0.1/.* outbound" events
+'
+
 test_expect_success "stopping cluster" '
   iptb stop
 '
@@ -129,6 +129,38 @@ test_resolve_cmd_b32() {
   '
 }
 
+test_resolve_cmd_batch() {
+  echo '-- starting test_resolve_cmd_batch'
+
+  test_expect_success "resolve --batch succeeds" '
+    printf "/ipfs/$a_hash/b\n/ipfs/$a_hash/missing\n/ipfs/$a_hash/b/c\n" |
+    ipfs resolve --batch >actual
+  '
+
+  test_expect_success "resolve --batch output looks good" '
+    printf "/ipfs/$a_hash/b\t/ipfs/$b_hash\n" >expected &&
+    printf "/ipfs/$a_hash/missing\tError: no link named \"missing\" under $a_hash\n" >>expected &&
+    printf "/ipfs/$a_hash/b/c\t/ipfs/$c_hash\n" >>expected &&
+    test_cmp expected actual
+  '
+
+  test_expect_success "resolve --batch --enc=json emits one object per name" '
+    printf "/ipfs/$a_hash/b\n/ipfs/$a_hash/b/c\n" |
+    ipfs resolve --batch --enc=json >actual &&
+    test $(wc -l <actual) -eq 2 &&
+    grep "\"Path\":\"/ipfs/$c_hash\"" actual
+  '
+
+  test_expect_success "dag resolve --batch succeeds" '
+    printf "/ipfs/$a_hash/b\n/ipld/$dag_hash/i/j\n" |
+    ipfs dag resolve --batch >actual
+  '
+
+  test_expect_success "dag resolve --batch output looks good" '
+    printf "/ipfs/$a_hash/b\t$b_hash\n/ipld/$dag_hash/i/j\t$dag_hash/i/j\n" >expected &&
+    test_cmp expected actual
+  '
+}
 
 #todo remove this once the online resolve is fixed
 test_resolve_fail() {
@@ -178,6 +210,7 @@ test_resolve_cmd_fail() {
 # should work offline
 test_resolve_cmd
 test_resolve_cmd_b32
+test_resolve_cmd_batch
 
 # should work online
 test_launch_ipfs_daemon
@@ -0,0 +1,63 @@
+#!/usr/bin/env bash
+
+test_description="Test the commands run with --offline"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add a directory and drop one of its blocks" '
+  mkdir dir &&
+  echo "kept" > dir/kept &&
+  echo "dropped" > dir/dropped &&
+  DIR=$(ipfs add -Q -r --pin=false dir) &&
+  DROPPED=$(ipfs add -Q --only-hash dir/dropped) &&
+  ipfs block rm "$DROPPED"
+'
+
+test_offline_commands() {
+  test_expect_success "'ipfs pin add --offline' names the missing block" '
+    test_expect_code 4 ipfs pin add --offline "$DIR" 2> pin_err &&
+    test_should_contain "block $DROPPED is not available locally" pin_err
+  '
+
+  test_expect_success "'ipfs pin add --offline --lazy --fill' is refused" '
+    test_must_fail ipfs pin add --offline --lazy --fill "$DIR" 2> fill_err &&
+    test_should_contain "not supported with --offline" fill_err
+  '
+
+  test_expect_success "'ipfs refs --offline' names the missing block" '
+    test_expect_code 4 ipfs refs --offline -r "$DIR" 2> refs_err &&
+    test_should_contain "block $DROPPED is not available locally" refs_err
+  '
+
+  test_expect_success "'ipfs dag stat --offline' names the missing block" '
+    test_expect_code 4 ipfs dag stat --offline --progress=false "$DIR" 2> stat_err &&
+    test_should_contain "block $DROPPED is not available locally" stat_err
+  '
+
+  test_expect_success "'ipfs name resolve --offline' fails for a DNSLink" '
+    test_expect_code 4 ipfs name resolve --offline example.com 2> dnslink_err &&
+    test_should_contain "name /ipns/example.com is not available locally" dnslink_err
+  '
+
+  test_expect_success "'ipfs name resolve --offline' fails for a name never seen" '
+    test_expect_code 4 ipfs name resolve --offline k51qzi5uqu5dlvj2baxnqndepeb86cbk3ng7n3i46uzyxzyqj2xjonzllnv0v8 2> name_err &&
+    test_should_contain "is not available locally" name_err
+  '
+
+  test_expect_success "'ipfs name resolve --offline' resolves the names published locally" '
+    ipfs name publish --allow-offline "$DIR" &&
+    ipfs name resolve --offline > name_out &&
+    echo "/ipfs/$DIR" > name_exp &&
+    test_cmp name_exp name_out
+  '
+}
+
+test_offline_commands
+
+test_launch_ipfs_daemon_without_network
+test_offline_commands
+test_kill_ipfs_daemon
+
+test_done
@@ -71,8 +71,24 @@ ipfs key rm key_ed25519
   '
 
   test_key_import_export_all_formats ed25519_key
+  test_key_import_export ed25519_key pem-openssh-cleartext
 
   test_openssl_compatibility_all_types
+  test_openssh_compatibility
+
+  test_expect_success "export rsa key with format pem-openssh-cleartext fails" '
+    test_must_fail ipfs key export generated_rsa_key -f pem-openssh-cleartext 2>&1 | tee key_exp_out &&
+    grep -q "only ed25519 keys are exported" key_exp_out &&
+    rm key_exp_out
+  '
+
+  test_expect_success "import RSA key in PKCS1 PEM format" '
+    ipfs key import test-pkcs8 -f pem-pkcs8-cleartext ../t0165-keystore-data/openssl_rsa.pem > pkcs8_id &&
+    ipfs key rm test-pkcs8 &&
+    ipfs key import test-pkcs1 -f pem-pkcs8-cleartext ../t0165-keystore-data/openssl_rsa_pkcs1.pem > pkcs1_id &&
+    ipfs key rm test-pkcs1 &&
+    test_cmp pkcs8_id pkcs1_id
+  '
 
   INVALID_KEY=../t0165-keystore-data/openssl_secp384r1.pem
   test_expect_success "import key type we don't generate fails" '
@@ -231,6 +247,8 @@ test_key_import_export() {
   ORIG_KEY="generated_$KEY_NAME"
   if [ $FORMAT == "pem-pkcs8-cleartext" ]; then
     FILE_EXT="pem"
+  elif [ $FORMAT == "pem-openssh-cleartext" ]; then
+    FILE_EXT="openssh"
   else
     FILE_EXT="key"
   fi
@@ -270,6 +288,22 @@ test_openssl_compatibility() {
   '
 }
 
+# Import an ssh-keygen key, export it in the OpenSSH format and import it
+# again, as the same key.
+test_openssh_compatibility() {
+  KEY_NAME=../t0165-keystore-data/openssh_ed25519
+
+  test_expect_success "import and export $KEY_NAME with format pem-openssh-cleartext" '
+    ipfs key import test-openssh -f pem-openssh-cleartext $KEY_NAME > openssh_id &&
+    ipfs key export test-openssh -f pem-openssh-cleartext -o openssh_exported &&
+    ipfs key rm test-openssh &&
+    ipfs key import test-openssh -f pem-openssh-cleartext openssh_exported > openssh_exported_id &&
+    ipfs key rm test-openssh &&
+    test_cmp openssh_id openssh_exported_id &&
+    rm openssh_exported
+  '
+}
+
 test_openssl_compatibility_all_types() {
   test_openssl_compatibility ../t0165-keystore-data/openssl_ed25519.pem
   test_openssl_compatibility ../t0165-keystore-data/openssl_rsa.pem
@@ -104,6 +104,69 @@ test_expect_success 'Stop iptb' '
   iptb stop
 '
 
+# Test 'pinned+mfs' strategy
+init_strategy 'pinned+mfs'
+
+test_expect_success 'prepare test files' '
+  echo foo > f1 &&
+  echo bar > f2 &&
+  echo baz > f3
+'
+
+test_expect_success 'add test objects' '
+  HASH_FOO=$(ipfsi 0 add -q --offline --pin=false f1) &&
+  HASH_BAR=$(ipfsi 0 add -q --offline f2) &&
+  HASH_BAZ=$(ipfsi 0 add -q --offline --pin=false f3) &&
+  ipfsi 0 files cp /ipfs/$HASH_BAZ /baz
+'
+
+findprovs_empty '$HASH_FOO'
+findprovs_empty '$HASH_BAR'
+findprovs_empty '$HASH_BAZ'
+
+reprovide
+
+findprovs_empty '$HASH_FOO'
+findprovs_expect '$HASH_BAR' '$PEERID_0'
+findprovs_expect '$HASH_BAZ' '$PEERID_0'
+
+test_expect_success 'Stop iptb' '
+  iptb stop
+'
+
+# Test 'pinned' strategy scoped by pin labels
+init_strategy 'pinned:public=true'
+
+test_expect_success 'prepare test files' '
+  echo foo > f1 &&
+  echo bar > f2
+'
+
+test_expect_success 'add test objects' '
+  HASH_FOO=$(ipfsi 0 add -q --offline --pin=false f1) &&
+  HASH_BAR=$(ipfsi 0 add -q --offline --pin=false f2) &&
+  ipfsi 0 pin add --label public=false $HASH_FOO &&
+  ipfsi 0 pin add --label public=true $HASH_BAR
+'
+
+findprovs_empty '$HASH_FOO'
+findprovs_empty '$HASH_BAR'
+
+reprovide
+
+findprovs_empty '$HASH_FOO'
+findprovs_expect '$HASH_BAR' '$PEERID_0'
+
+test_expect_success 'Stop iptb' '
+  iptb stop
+'
+
+test_expect_success 'an unknown strategy fails the start' '
+  ipfsi 0 config Reprovider.Strategy "pinned+unknown" &&
+  test_must_fail ipfsi 0 repo stat 2> strategy_err &&
+  grep -q "unknown reprovider strategy .unknown." strategy_err
+'
+
 # Test reprovider working with ticking disabled
 test_expect_success 'init iptb' '
   iptb testbed create -type localipfs -force -count $NUM_NODES -init
@@ -137,4 +200,46 @@ test_expect_success 'Stop iptb' '
   iptb stop
 '
 
+# Test reprovider spreading the reprovides
+test_expect_success 'init iptb' '
+  iptb testbed create -type localipfs -force -count $NUM_NODES -init
+'
+
+test_expect_success 'peer ids' '
+  PEERID_0=$(iptb attr get 0 id) &&
+  PEERID_1=$(iptb attr get 1 id)
+'
+
+test_expect_success 'Spread the reprovides' '
+  ipfsi 0 config --json Reprovider.Spread true
+'
+
+startup_cluster ${NUM_NODES}
+
+test_expect_success 'add test object' '
+  HASH_0=$(echo "foo" | ipfsi 0 add -q --offline)
+'
+
+findprovs_empty '$HASH_0'
+reprovide
+findprovs_expect '$HASH_0' '$PEERID_0'
+
+test_expect_success "'ipfs provide progress' succeeds" '
+  ipfsi 0 provide progress > progress_out
+'
+
+test_expect_success "the reprovides start after a minute" '
+  echo "reprovides not started yet" > progress_exp &&
+  test_cmp progress_exp progress_out
+'
+
+test_expect_success "'ipfs provide progress' fails when the reprovides are not spread" '
+  test_must_fail ipfsi 1 provide progress 2> progress_err &&
+  grep -q "Reprovider.Spread" progress_err
+'
+
+test_expect_success 'Stop iptb' '
+  iptb stop
+'
+
 test_done
@@ -53,6 +53,11 @@ test_expect_success 'wait until relay is ready to do work' '
   sleep 1
 '
 
+test_expect_success 'connect A <-Relay-> B fails with --direct-only' '
+  test_must_fail ipfsi 2 swarm connect --direct-only /p2p/$PEERID_1/p2p-circuit/p2p/$PEERID_0 2> connect_err &&
+  test_should_contain "connect $PEERID_0 failure: direct dial: failed in" connect_err
+'
+
 test_expect_success 'connect A <-Relay-> B' '
   ipfsi 2 swarm connect /p2p/$PEERID_1/p2p-circuit/p2p/$PEERID_0 > peers_out
 '
@@ -62,6 +67,11 @@ test_expect_success 'output looks good' '
   test_cmp peers_exp peers_out
 '
 
+test_expect_success 'connect A <-Relay-> B --verbose tells the relay was used' '
+  ipfsi 2 swarm connect --verbose /p2p/$PEERID_1/p2p-circuit/p2p/$PEERID_0 > peers_out &&
+  test_should_contain "^connect $PEERID_0 success via " peers_out
+'
+
 test_expect_success 'peers for A look good' '
   ipfsi 0 swarm peers > peers_out &&
   test_should_contain "/p2p/$PEERID_1/p2p-circuit/p2p/$PEERID_2$" peers_out
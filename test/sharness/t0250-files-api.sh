@@ -701,6 +701,38 @@ test_files_api() {
     ipfs repo gc
   '
 
+  # test content-defined chunking
+
+  test_expect_success "write a file with a content-defined chunker $EXTRA" '
+    seq 1 400000 > cdc_v1 &&
+    sed "200000a inserted" cdc_v1 > cdc_v2 &&
+    ipfs files write $ARGS $RAW_LEAVES --create --chunker=buzhash /cdc cdc_v1 &&
+    ipfs files read /cdc > cdc_out &&
+    test_cmp cdc_v1 cdc_out &&
+    ipfs refs -r "$(ipfs files stat --hash /cdc)" | sort > cdc_refs_v1
+  '
+
+  test_expect_success "a new version shares the blocks left unchanged $EXTRA" '
+    ipfs files write $RAW_LEAVES --truncate --chunker=buzhash /cdc cdc_v2 &&
+    ipfs files read /cdc > cdc_out &&
+    test_cmp cdc_v2 cdc_out &&
+    ipfs refs -r "$(ipfs files stat --hash /cdc)" | sort > cdc_refs_v2 &&
+    test $(comm -12 cdc_refs_v1 cdc_refs_v2 | wc -l) -ge $(($(wc -l < cdc_refs_v2) - 3))
+  '
+
+  test_expect_success "write at an offset with a content-defined chunker $EXTRA" '
+    printf "hello" | ipfs files write $RAW_LEAVES --offset 3 --chunker=buzhash /cdc &&
+    ipfs files read --count 10 /cdc > cdc_out &&
+    printf "1\n2hello5\n" > cdc_exp &&
+    test_cmp cdc_exp cdc_out &&
+    ipfs files rm /cdc
+  '
+
+  test_expect_success "write with an invalid chunker fails $EXTRA" '
+    test_must_fail ipfs files write --create --chunker=bogus /cdc cdc_v1 &&
+    test_must_fail ipfs files stat /cdc
+  '
+
   # test rm
 
   test_expect_success "remove file forcibly" '
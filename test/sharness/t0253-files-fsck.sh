@@ -0,0 +1,45 @@
+#!/usr/bin/env bash
+
+test_description="test the checks and repairs of the MFS root"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs files fsck' finds a complete root" '
+  ipfs files mkdir /adir &&
+  ROOT1=$(ipfs files stat --hash /) &&
+  echo "some content" | ipfs files write --create /adir/file &&
+  ROOT2=$(ipfs files stat --hash /) &&
+  echo "MFS root $ROOT2 is complete" > expected &&
+  ipfs files fsck > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files fsck' finds a missing block" '
+  FILE=$(ipfs files stat --hash /adir/file) &&
+  ipfs block rm $FILE &&
+  echo "MFS root $ROOT2 is missing block $FILE" > expected &&
+  ipfs files fsck > actual &&
+  test_cmp expected actual
+'
+
+test_launch_ipfs_daemon_without_network
+
+test_expect_success "'ipfs files fsck --repair' needs the daemon to be stopped" '
+  test_must_fail ipfs files fsck --repair 2> err &&
+  grep "stop the daemon first" err
+'
+
+test_kill_ipfs_daemon
+
+test_expect_success "'ipfs files fsck --repair' resets the root to the last complete one" '
+  ipfs files fsck --repair > actual &&
+  grep "MFS root is now $ROOT1" actual &&
+  test "$(ipfs files stat --hash /)" = "$ROOT1" &&
+  echo "MFS root $ROOT1 is complete" > expected &&
+  ipfs files fsck > actual &&
+  test_cmp expected actual
+'
+
+test_done
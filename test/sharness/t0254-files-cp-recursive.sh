@@ -0,0 +1,58 @@
+#!/usr/bin/env bash
+
+test_description="test the copies and moves fetching the DAG of their source"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "create a directory" '
+  mkdir -p tree/sub &&
+  echo "file a" > tree/a &&
+  echo "file b" > tree/sub/b &&
+  TREE=$(ipfs add -Qr --pin=false tree)
+'
+
+test_expect_success "'ipfs files cp -r' outputs the progress" '
+  ipfs files cp -r /ipfs/$TREE /tree > actual &&
+  cat > expected <<-EOF &&
+	fetched /ipfs/$TREE/a (1 files, 7 B)
+	fetched /ipfs/$TREE/sub/b (2 files, 14 B)
+	EOF
+  test_cmp expected actual &&
+  ipfs files stat --hash /tree > actual &&
+  echo $TREE > expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files cp' without -r outputs nothing" '
+  ipfs files cp /ipfs/$TREE /tree2 > actual &&
+  test_must_be_empty actual
+'
+
+test_expect_success "'ipfs files mv -r' outputs the progress" '
+  ipfs files mv -r /tree2 /tree3 > actual &&
+  cat > expected <<-EOF &&
+	fetched /tree2/a (1 files, 7 B)
+	fetched /tree2/sub/b (2 files, 14 B)
+	EOF
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files cp -r' streams JSON progress" '
+  ipfs files cp -r --enc=json /ipfs/$TREE/sub /sub > actual &&
+  echo "{\"Path\":\"/ipfs/$TREE/sub/b\",\"Files\":1,\"Bytes\":7}" > expected &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files cp -r' fails on a missing block, leaving the MFS unchanged" '
+  mkdir missing &&
+  echo "missing file" > missing/a &&
+  MISSING=$(ipfs add -Qr --pin=false missing) &&
+  ipfs block rm $(ipfs add -Q --pin=false missing/a) &&
+  test_must_fail ipfs files cp -r --offline /ipfs/$MISSING /missing 2> err &&
+  grep "cannot fetch /ipfs/$MISSING/a" err &&
+  test_must_fail ipfs files stat /missing
+'
+
+test_done
@@ -0,0 +1,69 @@
+#!/usr/bin/env bash
+
+test_description="test the stream of the changes of the MFS"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs files watch' needs the daemon" '
+  test_expect_code 1 ipfs files watch /w 2> err &&
+  grep "daemon not running" err
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "start watching /w" '
+  ipfs files watch /w > watch_out &
+  WATCH_PID=$! &&
+  sleep 1
+'
+
+test_expect_success "change the MFS" '
+  ipfs files mkdir /elsewhere &&
+  ipfs files mkdir /w &&
+  sleep 1 &&
+  echo "file a" | ipfs files write --create /w/a &&
+  A=$(ipfs files stat --hash /w/a) &&
+  sleep 1 &&
+  echo "file b" | ipfs files write --truncate /w/a &&
+  B=$(ipfs files stat --hash /w/a) &&
+  sleep 1 &&
+  ipfs files rm /w/a &&
+  sleep 1 &&
+  EMPTY=$(ipfs files stat --hash /elsewhere)
+'
+
+# the client killed ends its output with an empty line
+test_expect_success "the changes under /w were streamed" '
+  kill $WATCH_PID &&
+  cat > expected <<-EOF &&
+	create /w $EMPTY
+	create /w/a $A
+	modify /w/a $A -> $B
+	delete /w/a $B
+	EOF
+  grep -v "^$" watch_out > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files watch' streams JSON" '
+  ipfs files watch --enc=json /j > watch_out &
+  WATCH_PID=$! &&
+  sleep 1 &&
+  ipfs files mkdir /j &&
+  sleep 1 &&
+  kill $WATCH_PID &&
+  echo "{\"Op\":\"create\",\"Path\":\"/j\",\"New\":\"$EMPTY\"}" > expected &&
+  grep -v "^$" watch_out > actual &&
+  test_cmp expected actual
+'
+
+test_expect_success "'ipfs files watch' rejects a relative path" '
+  test_expect_code 1 ipfs files watch w 2> err &&
+  grep "leading slash" err
+'
+
+test_kill_ipfs_daemon
+
+test_done
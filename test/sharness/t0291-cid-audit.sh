@@ -0,0 +1,65 @@
+#!/usr/bin/env bash
+
+test_description="Test the CID audit of the repo"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "add content with CIDv0 and CIDv1" '
+  V0=$(echo "v0 content" | ipfs add -q) &&
+  ipfs pin add --name=named $V0 &&
+  V1=$(echo "v1 content" | ipfs add -q --cid-version=1) &&
+  echo "mfs content" | ipfs files write --create --cid-version=0 /file &&
+  ipfs files mkdir --cid-version=0 /dir &&
+  ipfs files cp /ipfs/$V0 /dir/v0
+'
+
+test_expect_success "ipfs cid audit reports the blocks" '
+  ipfs cid audit --enc=json > audit.json &&
+  test $(jq -r .Versions.v1 audit.json) -ge 1 &&
+  test $(jq -r .Versions.v0 audit.json) -ge 2 &&
+  test $(jq -r ".Codecs.raw" audit.json) -ge 1 &&
+  test $(jq -r ".Hashes[\"sha2-256\"]" audit.json) -eq $(jq -r .Blocks audit.json) &&
+  test $(jq "[.Sizes[].Blocks] | add" audit.json) -eq $(jq -r .Blocks audit.json) &&
+  test $(jq -r .References audit.json) -ge 5 &&
+  test $(jq -r .V0Pins audit.json) -ge 1
+'
+
+test_expect_success "ipfs cid audit text output" '
+  ipfs cid audit > audit.txt &&
+  test_should_contain "Versions:" audit.txt &&
+  test_should_contain "CIDv0 pins:" audit.txt
+'
+
+test_expect_success "ipfs cid audit --upgrade re-encodes the pins and MFS" '
+  ipfs cid audit --upgrade --enc=json > upgrade.json &&
+  test $(jq -r .PinsUpgraded upgrade.json) -ge 1 &&
+  test $(jq -r .MFSUpgraded upgrade.json) -ge 3 &&
+  V0V1=$(ipfs cid format -v 1 -b base32 $V0) &&
+  ipfs pin ls --type=recursive -q > pins &&
+  test_should_contain $V0V1 pins &&
+  test_expect_code 1 grep $V0 pins
+'
+
+test_expect_success "the upgraded pin keeps its name" '
+  ipfs pin ls --type=recursive --name=named -q > names &&
+  test_should_contain $V0V1 names
+'
+
+test_expect_success "MFS references CIDv1" '
+  ipfs files stat --hash / > root_hash &&
+  test $(ipfs cid format -f %v $(cat root_hash)) = cidv1 &&
+  ipfs files stat --hash /dir/v0 > v0_hash &&
+  test $(cat v0_hash) = $V0V1 &&
+  ipfs files read /dir/v0 > v0_content &&
+  echo "v0 content" > expected &&
+  test_cmp expected v0_content
+'
+
+test_expect_success "no CIDv0 pins are left" '
+  ipfs cid audit --enc=json > after.json &&
+  test $(jq -r .V0Pins after.json) -eq 0
+'
+
+test_done
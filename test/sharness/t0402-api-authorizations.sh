@@ -0,0 +1,110 @@
+#!/usr/bin/env bash
+
+test_description="Test API authorizations"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "set API authorizations" '
+  jq ".API.Authorizations = {
+    \"all\": {\"AuthSecret\": \"all-secret\"},
+    \"mfs\": {\"AuthSecret\": \"mfs-secret\", \"AllowedCommands\": [\"files/*\"], \"DeniedCommands\": [\"files/rm\"]}
+  }" "$IPFS_PATH/config" > authconfig.json &&
+  cp authconfig.json "$IPFS_PATH/config"
+'
+
+test_expect_success "API authorization secrets are not shown" '
+  test_must_fail ipfs config API.Authorizations.all.AuthSecret &&
+  ipfs config show > show.json &&
+  test_expect_code 1 grep "all-secret" show.json
+'
+
+test_expect_success "'ipfs config replace' keeps the API authorization secrets" '
+  ipfs config replace show.json &&
+  grep "all-secret" "$IPFS_PATH/config"
+'
+
+test_expect_success "'ipfs config replace' can not add an API authorization" '
+  jq ".API.Authorizations.new = {\"AuthSecret\": \"new-secret\"}" show.json > add_auth.json &&
+  test_must_fail ipfs config replace add_auth.json 2> add_auth_err &&
+  test_should_contain "cannot add API authorizations" add_auth_err &&
+  test_expect_code 1 grep "new-secret" "$IPFS_PATH/config"
+'
+
+test_expect_success "'ipfs config replace' can not change an API authorization secret" '
+  jq ".API.Authorizations.mfs.AuthSecret = \"chosen-secret\"" show.json > change_auth.json &&
+  test_must_fail ipfs config replace change_auth.json 2> change_auth_err &&
+  test_should_contain "cannot change API authorization secrets" change_auth_err &&
+  grep "mfs-secret" "$IPFS_PATH/config"
+'
+
+test_expect_success "ipfs auth mint creates an authorization with a scope" '
+  ipfs auth mint reader --scope=read-only > reader_secret &&
+  test -s reader_secret &&
+  ipfs auth ls > auth_ls &&
+  test_should_contain "reader.*read-only" auth_ls &&
+  test_expect_code 1 grep "$(cat reader_secret)" auth_ls
+'
+
+test_expect_success "ipfs auth mint refuses an unknown scope" '
+  test_must_fail ipfs auth mint bad --scope=everything
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "request without secret is refused" '
+  test_curl_resp_http_code "http://127.0.0.1:$API_PORT/api/v0/id" "HTTP/1.1 401 Unauthorized"
+'
+
+test_expect_success "ipfs id without --api-auth fails" '
+  test_must_fail ipfs id
+'
+
+test_expect_success "ipfs id with --api-auth succeeds" '
+  ipfs id --api-auth=all-secret
+'
+
+test_expect_success "allowed command succeeds" '
+  ipfs files ls --api-auth=mfs-secret /
+'
+
+test_expect_success "command not allowed fails" '
+  test_must_fail ipfs id --api-auth=mfs-secret 2> id_err &&
+  test_should_contain "403" id_err
+'
+
+test_expect_success "denied command fails" '
+  test_must_fail ipfs files rm --api-auth=mfs-secret /none 2> rm_err &&
+  test_should_contain "403" rm_err
+'
+
+test_expect_success "command of the scope succeeds" '
+  HASH=$(echo scoped | ipfs add -q --api-auth=all-secret) &&
+  ipfs cat --api-auth=$(cat reader_secret) $HASH
+'
+
+test_expect_success "command outside of the scope fails" '
+  test_must_fail ipfs pin ls --api-auth=$(cat reader_secret) 2> pin_err &&
+  test_should_contain "403" pin_err
+'
+
+test_expect_success "restricted authorization can not manage the authorizations" '
+  test_must_fail ipfs auth ls --api-auth=mfs-secret 2> auth_err &&
+  test_should_contain "403" auth_err
+'
+
+test_expect_success "authorization minted while running applies at once" '
+  ipfs auth mint pins --scope=pin-admin --api-auth=all-secret > pins_secret &&
+  ipfs pin ls --api-auth=$(cat pins_secret)
+'
+
+test_expect_success "authorization revoked while running is refused at once" '
+  ipfs auth revoke pins --api-auth=all-secret &&
+  test_must_fail ipfs pin ls --api-auth=$(cat pins_secret) 2> revoked_err &&
+  test_should_contain "401" revoked_err
+'
+
+test_kill_ipfs_daemon
+
+test_done
@@ -0,0 +1,54 @@
+#!/usr/bin/env bash
+
+test_description="Test the usage accounting of the API authorizations"
+
+. lib/test-lib.sh
+
+test_init_ipfs
+
+test_expect_success "'ipfs stats tenants' needs API authorizations" '
+  test_must_fail ipfs stats tenants 2>err_notenants &&
+  test_should_contain "no tenants" err_notenants
+'
+
+test_expect_success "set API authorizations" '
+  jq ".API.Authorizations = {
+    \"alice\": {\"AuthSecret\": \"alice-secret\"},
+    \"bob\": {\"AuthSecret\": \"bob-secret\"}
+  }" "$IPFS_PATH/config" > authconfig.json &&
+  cp authconfig.json "$IPFS_PATH/config"
+'
+
+test_launch_ipfs_daemon
+
+test_expect_success "add and pin content as alice" '
+  random 100000 42 >data &&
+  HASH=$(ipfs add -Q --api-auth=alice-secret data)
+'
+
+test_expect_success "fetch the content from the gateway as bob" '
+  curl -sf -H "Authorization: Bearer bob-secret" "http://$GWAY_ADDR/ipfs/$HASH" >actual_data &&
+  test_cmp data actual_data
+'
+
+test_expect_success "'ipfs stats tenants' reports the usage" '
+  ipfs stats tenants --api-auth=alice-secret --enc=json | jq -c ".Tenants[]" >actual_tenants &&
+  test_should_contain "\"Name\":\"alice\",\"BytesStored\":1[0-9]\{5\},\"BytesServed\":[1-9][0-9]*,\"Pins\":1}" actual_tenants &&
+  test_should_contain "\"Name\":\"bob\",\"BytesStored\":0,\"BytesServed\":1[0-9]\{5\},\"Pins\":0}" actual_tenants
+'
+
+test_expect_success "unpinning releases the pin of its owner" '
+  ipfs pin rm --api-auth=bob-secret $HASH &&
+  ipfs stats tenants --api-auth=alice-secret --enc=json | jq -c ".Tenants[]" >actual_unpinned &&
+  test_should_contain "\"Name\":\"alice\".*\"Pins\":0}" actual_unpinned
+'
+
+test_expect_success "the usage is exported to Prometheus" '
+  curl -s "http://$API_ADDR/debug/metrics/prometheus" >actual_metrics &&
+  test_should_contain "ipfs_tenant_bytes_stored_total{tenant=\"alice\"}" actual_metrics &&
+  test_should_contain "ipfs_tenant_pins{tenant=\"bob\"} 0" actual_metrics
+'
+
+test_kill_ipfs_daemon
+
+test_done
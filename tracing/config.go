@@ -0,0 +1,203 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/trace"
+	traceapi "go.opentelemetry.io/otel/trace"
+)
+
+// Subsystems maps the subsystems of Tracing.Subsystems to the prefixes of the
+// names of their spans.
+var Subsystems = map[string][]string{
+	"gateway": {"Gateway."},
+	"bitswap": {"Bitswap."},
+	"dht":     {"CoreAPI.DhtAPI."},
+	"pinner":  {"CoreAPI.PinAPI.", "CoreAPI.PinningAdder."},
+}
+
+// subsystemSampler drops the spans of the disabled subsystems, even in a
+// sampled trace, and has its Sampler decide for the others.
+type subsystemSampler struct {
+	trace.Sampler
+	disabled []string
+}
+
+func (s subsystemSampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	for _, prefix := range s.disabled {
+		if strings.HasPrefix(p.Name, prefix) {
+			return trace.SamplingResult{
+				Decision:   trace.Drop,
+				Tracestate: traceapi.SpanContextFromContext(p.ParentContext).TraceState(),
+			}
+		}
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s subsystemSampler) Description() string {
+	return fmt.Sprintf("SubsystemSampler{%s,disabled:%v}", s.Sampler.Description(), s.disabled)
+}
+
+// newConfigSampler samples the ratio of the traces of cfg, without the spans
+// of the subsystems it disables.
+func newConfigSampler(cfg config.Tracing) (trace.Sampler, error) {
+	ratio := cfg.SampleRatio.WithDefault(1)
+	if ratio < 0 || ratio > 1 {
+		return nil, fmt.Errorf("config setting Tracing.SampleRatio must be between 0 and 1, got %g", ratio)
+	}
+	var disabled []string
+	for name, enabled := range cfg.Subsystems {
+		prefixes, ok := Subsystems[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown subsystem %q in Tracing.Subsystems", name)
+		}
+		if !enabled.WithDefault(true) {
+			disabled = append(disabled, prefixes...)
+		}
+	}
+	sort.Strings(disabled)
+	return subsystemSampler{
+		Sampler:  trace.ParentBased(trace.TraceIDRatioBased(ratio)),
+		disabled: disabled,
+	}, nil
+}
+
+// newConfigExporter creates the exporter of cfg, nil if tracing is disabled.
+func newConfigExporter(ctx context.Context, cfg config.Tracing) (trace.SpanExporter, error) {
+	exporter := cfg.Exporter.WithDefault("")
+	endpoint := cfg.Endpoint.WithDefault("")
+	var u *url.URL
+	if endpoint != "" {
+		var err error
+		u, err = url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("config setting Tracing.Endpoint must be an http or https URL, got %q", endpoint)
+		}
+	}
+
+	switch exporter {
+	case "":
+		return nil, nil
+	case "otlp-grpc":
+		var opts []otlptracegrpc.Option
+		if u != nil {
+			opts = append(opts, otlptracegrpc.WithEndpoint(u.Host))
+			if u.Scheme == "http" {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			}
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "otlp-http":
+		var opts []otlptracehttp.Option
+		if u != nil {
+			opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+			if u.Scheme == "http" {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+			if u.Path != "" && u.Path != "/" {
+				opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+			}
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case "jaeger":
+		var opts []jaeger.CollectorEndpointOption
+		if u != nil {
+			opts = append(opts, jaeger.WithEndpoint(endpoint))
+		}
+		return jaeger.New(jaeger.WithCollectorEndpoint(opts...))
+	case "stdout":
+		if u != nil {
+			return nil, fmt.Errorf("config setting Tracing.Endpoint is not used by the stdout exporter")
+		}
+		return stdouttrace.New()
+	default:
+		return nil, fmt.Errorf("unknown exporter %q in Tracing.Exporter, expected otlp-grpc, otlp-http, jaeger or stdout", exporter)
+	}
+}
+
+// newConfigTracerProvider creates the TracerProvider configured by cfg.
+func newConfigTracerProvider(ctx context.Context, cfg config.Tracing) (ShutdownTracerProvider, error) {
+	sampler, err := newConfigSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := newConfigExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if exporter == nil {
+		return &noopShutdownTracerProvider{tp: traceapi.NewNoopTracerProvider()}, nil
+	}
+	r, err := newResource()
+	if err != nil {
+		return nil, err
+	}
+	return trace.NewTracerProvider(
+		trace.WithSampler(sampler),
+		trace.WithResource(r),
+		trace.WithBatcher(exporter),
+	), nil
+}
+
+// ConfigTracerProvider is a TracerProvider configured by the Tracing section
+// of the config, which can be reconfigured. Its tracers are only valid until
+// it is reconfigured, so they should not be kept, as Span does.
+type ConfigTracerProvider struct {
+	mu  sync.Mutex
+	cfg *config.Tracing
+	tp  ShutdownTracerProvider
+}
+
+var _ ShutdownTracerProvider = (*ConfigTracerProvider)(nil)
+
+// NewConfigTracerProvider creates a TracerProvider configured by cfg.
+func NewConfigTracerProvider(ctx context.Context, cfg config.Tracing) (*ConfigTracerProvider, error) {
+	p := &ConfigTracerProvider{
+		tp: &noopShutdownTracerProvider{tp: traceapi.NewNoopTracerProvider()},
+	}
+	if err := p.Configure(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Configure applies cfg if it changed, shutting down the previous exporter
+// once its spans are exported. The configuration is kept if cfg is invalid.
+func (p *ConfigTracerProvider) Configure(ctx context.Context, cfg config.Tracing) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cfg != nil && reflect.DeepEqual(*p.cfg, cfg) {
+		return nil
+	}
+	tp, err := newConfigTracerProvider(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	old := p.tp
+	p.cfg, p.tp = &cfg, tp
+	return old.Shutdown(ctx)
+}
+
+func (p *ConfigTracerProvider) Tracer(instrumentationName string, opts ...traceapi.TracerOption) traceapi.Tracer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tp.Tracer(instrumentationName, opts...)
+}
+
+func (p *ConfigTracerProvider) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tp.Shutdown(ctx)
+}
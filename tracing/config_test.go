@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func tracingConfig(t *testing.T, s string) config.Tracing {
+	var cfg config.Tracing
+	if err := json.Unmarshal([]byte(s), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestConfigSampler(t *testing.T) {
+	ctx := context.Background()
+	sampler, err := newConfigSampler(tracingConfig(t, `{"Subsystems": {"gateway": false, "dht": true}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := tracetest.NewSpanRecorder()
+	tp := trace.NewTracerProvider(trace.WithSampler(sampler), trace.WithSpanProcessor(rec))
+	tracer := tp.Tracer("test")
+
+	for _, name := range []string{"Gateway.Request", "CoreAPI.DhtAPI.FindPeer", "Bitswap.SendMsg"} {
+		_, span := tracer.Start(ctx, name)
+		span.End()
+	}
+	// the spans of a disabled subsystem are dropped in a sampled trace
+	sctx, span := tracer.Start(ctx, "CoreAPI.UnixfsAPI.Get")
+	_, child := tracer.Start(sctx, "Gateway.ServeFile")
+	child.End()
+	span.End()
+
+	var names []string
+	for _, s := range rec.Ended() {
+		names = append(names, s.Name())
+	}
+	expected := []string{"CoreAPI.DhtAPI.FindPeer", "Bitswap.SendMsg", "CoreAPI.UnixfsAPI.Get"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected the spans %v, got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("expected the spans %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	ctx := context.Background()
+	for _, s := range []string{
+		`{"SampleRatio": 1.5}`,
+		`{"SampleRatio": -1}`,
+		`{"Subsystems": {"unknown": false}}`,
+		`{"Exporter": "zipkin"}`,
+		`{"Exporter": "otlp-grpc", "Endpoint": "localhost:4317"}`,
+		`{"Exporter": "stdout", "Endpoint": "http://localhost:4318"}`,
+	} {
+		if _, err := NewConfigTracerProvider(ctx, tracingConfig(t, s)); err == nil {
+			t.Errorf("expected %s to be invalid", s)
+		}
+	}
+}
+
+func TestConfigTracerProvider(t *testing.T) {
+	ctx := context.Background()
+	tp, err := NewConfigTracerProvider(ctx, config.Tracing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tp.Shutdown(ctx)
+	recording := func() bool {
+		_, span := tp.Tracer("test").Start(ctx, "Test.Span")
+		defer span.End()
+		return span.IsRecording()
+	}
+
+	if recording() {
+		t.Fatal("expected tracing to be disabled without exporter")
+	}
+	if err := tp.Configure(ctx, tracingConfig(t, `{"Exporter": "otlp-http", "Endpoint": "http://127.0.0.1:1/v1/traces", "SampleRatio": 0}`)); err != nil {
+		t.Fatal(err)
+	}
+	if recording() {
+		t.Fatal("expected no trace to be sampled")
+	}
+	if err := tp.Configure(ctx, tracingConfig(t, `{"Exporter": "otlp-http", "Endpoint": "http://127.0.0.1:1/v1/traces"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !recording() {
+		t.Fatal("expected the traces to be sampled once reconfigured")
+	}
+	if err := tp.Configure(ctx, tracingConfig(t, `{"Exporter": "stdout", "Endpoint": "http://127.0.0.1:1"}`)); err == nil {
+		t.Fatal("expected the invalid config not to be applied")
+	}
+	if !recording() {
+		t.Fatal("expected the previous config to be kept")
+	}
+}
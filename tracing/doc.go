@@ -8,6 +8,10 @@
 // variables can be used to configure it. Multiple exporters can also be installed simultaneously,
 // including one that writes traces to a JSON file on disk.
 //
+// The daemon can be configured with the Tracing section of the config, which selects the exporter, the sampling
+// ratio and the subsystems traced, and is reloaded when changed with 'ipfs config'. Setting IPFS_TRACING configures
+// tracing through environment variables instead, the config being ignored.
+//
 // In general, tracing is configured through environment variables. The IPFS-specific environment variables are:
 //
 //  - IPFS_TRACING: enable tracing in go-ipfs
@@ -87,9 +87,28 @@ type ShutdownTracerProvider interface {
 	Shutdown(ctx context.Context) error
 }
 
+// EnvEnabled reports whether tracing is enabled by the IPFS_TRACING
+// environment variable, in which case the environment variables configure it
+// instead of the config.
+func EnvEnabled() bool {
+	return os.Getenv("IPFS_TRACING") != ""
+}
+
+// newResource describes go-ipfs in the spans exported.
+func newResource() (*resource.Resource, error) {
+	return resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("go-ipfs"),
+			semconv.ServiceVersionKey.String(version.CurrentVersionNumber),
+		),
+	)
+}
+
 // NewTracerProvider creates and configures a TracerProvider.
 func NewTracerProvider(ctx context.Context) (ShutdownTracerProvider, error) {
-	if os.Getenv("IPFS_TRACING") == "" {
+	if !EnvEnabled() {
 		return &noopShutdownTracerProvider{tp: traceapi.NewNoopTracerProvider()}, nil
 	}
 
@@ -104,14 +123,7 @@ func NewTracerProvider(ctx context.Context) (ShutdownTracerProvider, error) {
 	}
 	options = append(options, trace.WithSampler(trace.ParentBased(trace.TraceIDRatioBased(traceRatio))))
 
-	r, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String("go-ipfs"),
-			semconv.ServiceVersionKey.String(version.CurrentVersionNumber),
-		),
-	)
+	r, err := newResource()
 	if err != nil {
 		return nil, err
 	}
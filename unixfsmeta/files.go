@@ -0,0 +1,123 @@
+package unixfsmeta
+
+import (
+	"context"
+
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	unixfile "github.com/ipfs/go-unixfs/file"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// Node is a files.Node of a UnixFS DAG with its metadata.
+type Node interface {
+	files.Node
+	Meta() Meta
+}
+
+// Of returns the metadata of n, if it is a Node.
+func Of(n files.Node) Meta {
+	if mn, ok := n.(Node); ok {
+		return mn.Meta()
+	}
+	return Meta{}
+}
+
+// NewFile returns the file, or the directory, of the UnixFS DAG nd, as
+// unixfile.NewUnixfsFile does, with the metadata of its nodes: every node,
+// the entries of the directories included, is a Node.
+func NewFile(ctx context.Context, dserv ipld.DAGService, nd ipld.Node) (files.Node, error) {
+	f, err := unixfile.NewUnixfsFile(ctx, dserv, nd)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Get(nd)
+	if err != nil {
+		return nil, err
+	}
+	switch f := f.(type) {
+	case files.Directory:
+		dir, err := uio.NewDirectoryFromNode(dserv, nd)
+		if err != nil {
+			return nil, err
+		}
+		return &metaDir{Directory: f, ctx: ctx, dserv: dserv, dir: dir, meta: m}, nil
+	case *files.Symlink:
+		// the links are created as they are, their metadata are not kept
+		return f, nil
+	case files.File:
+		return &metaFile{File: f, meta: m}, nil
+	default:
+		return f, nil
+	}
+}
+
+type metaFile struct {
+	files.File
+	meta Meta
+}
+
+func (f *metaFile) Meta() Meta {
+	return f.meta
+}
+
+type metaDir struct {
+	files.Directory
+	ctx   context.Context
+	dserv ipld.DAGService
+	dir   uio.Directory
+	meta  Meta
+}
+
+func (d *metaDir) Meta() Meta {
+	return d.meta
+}
+
+func (d *metaDir) Entries() files.DirIterator {
+	links, err := d.dir.Links(d.ctx)
+	return &metaIterator{ctx: d.ctx, dserv: d.dserv, links: links, err: err}
+}
+
+// metaIterator iterates over the entries of a directory, fetched one after
+// the other.
+type metaIterator struct {
+	ctx   context.Context
+	dserv ipld.DAGService
+	links []*ipld.Link
+
+	name string
+	node files.Node
+	err  error
+}
+
+func (it *metaIterator) Name() string {
+	return it.name
+}
+
+func (it *metaIterator) Node() files.Node {
+	return it.node
+}
+
+func (it *metaIterator) Next() bool {
+	if it.err != nil || len(it.links) == 0 {
+		return false
+	}
+	l := it.links[0]
+	it.links = it.links[1:]
+
+	nd, err := l.GetNode(it.ctx, it.dserv)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.name = l.Name
+	it.node, it.err = NewFile(it.ctx, it.dserv, nd)
+	return it.err == nil
+}
+
+func (it *metaIterator) Err() error {
+	return it.err
+}
+
+var _ Node = &metaFile{}
+var _ Node = &metaDir{}
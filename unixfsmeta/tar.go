@@ -0,0 +1,148 @@
+package unixfsmeta
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+)
+
+// The PAX records of the entries of a tar archive whose mode, or whose
+// modification time, are the metadata of their node, rather than defaults.
+const (
+	PAXMode  = "IPFS.mode"
+	PAXMtime = "IPFS.mtime"
+)
+
+// TarWriter writes files to a tar archive as files.TarWriter does, with the
+// mode and the modification time of their metadata, if any.
+type TarWriter struct {
+	TarW *tar.Writer
+	// Mark marks the mode and the modification time of the metadata with the
+	// PAXMode and PAXMtime records, for the extraction to tell them from the
+	// defaults. The tar tools warn of these records.
+	Mark bool
+}
+
+// NewTarWriter returns a tar writer writing to w.
+func NewTarWriter(w io.Writer) *TarWriter {
+	return &TarWriter{TarW: tar.NewWriter(w)}
+}
+
+// WriteFile writes nd, and its entries if a directory, to the archive at
+// fpath.
+func (w *TarWriter) WriteFile(nd files.Node, fpath string) error {
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return w.TarW.WriteHeader(&tar.Header{
+			Name:     fpath,
+			Linkname: nd.Target,
+			Mode:     0777,
+			Typeflag: tar.TypeSymlink,
+		})
+	case files.File:
+		size, err := nd.Size()
+		if err != nil {
+			return err
+		}
+		h := w.header(Of(nd), fpath, tar.TypeReg, 0644)
+		h.Size = size
+		if err := w.TarW.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w.TarW, nd); err != nil {
+			return err
+		}
+		return w.TarW.Flush()
+	case files.Directory:
+		if err := w.TarW.WriteHeader(w.header(Of(nd), fpath, tar.TypeDir, 0777)); err != nil {
+			return err
+		}
+		it := nd.Entries()
+		for it.Next() {
+			if err := w.WriteFile(it.Node(), path.Join(fpath, it.Name())); err != nil {
+				return err
+			}
+		}
+		return it.Err()
+	default:
+		return fmt.Errorf("file type %T is not supported", nd)
+	}
+}
+
+// Close closes the tar writer.
+func (w *TarWriter) Close() error {
+	return w.TarW.Close()
+}
+
+// header returns the header of an entry with the metadata m, of the default
+// mode otherwise.
+func (w *TarWriter) header(m Meta, fpath string, typ byte, mode int64) *tar.Header {
+	h := &tar.Header{
+		Name:     fpath,
+		Typeflag: typ,
+		Mode:     mode,
+		ModTime:  time.Now().Truncate(time.Second),
+	}
+	if m.IsZero() {
+		return h
+	}
+	// PAX keeps the nanoseconds
+	h.Format = tar.FormatPAX
+	records := make(map[string]string)
+	if m.HasMode {
+		h.Mode = int64(posixMode(m.Mode))
+		records[PAXMode] = strconv.FormatInt(h.Mode, 8)
+	}
+	if !m.ModTime.IsZero() {
+		h.ModTime = m.ModTime
+		records[PAXMtime] = strconv.FormatInt(m.ModTime.Unix(), 10)
+	}
+	if w.Mark {
+		h.PAXRecords = records
+	}
+	return h
+}
+
+// FromHeader returns the metadata of the entry h of an archive written by a
+// TarWriter.
+func FromHeader(h *tar.Header) Meta {
+	var m Meta
+	if _, ok := h.PAXRecords[PAXMode]; ok {
+		m.Mode = fileMode(uint32(h.Mode))
+		m.HasMode = true
+	}
+	if _, ok := h.PAXRecords[PAXMtime]; ok {
+		m.ModTime = h.ModTime
+	}
+	return m
+}
+
+// Restore sets the mode and the modification time of the file at fpath to
+// those of m, if any. The links are left alone.
+func Restore(fpath string, m Meta) error {
+	if m.IsZero() {
+		return nil
+	}
+	fi, err := os.Lstat(fpath)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	if m.HasMode {
+		if err := os.Chmod(fpath, m.Mode); err != nil {
+			return err
+		}
+	}
+	if !m.ModTime.IsZero() {
+		return os.Chtimes(fpath, m.ModTime, m.ModTime)
+	}
+	return nil
+}
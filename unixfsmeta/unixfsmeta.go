@@ -0,0 +1,317 @@
+// Package unixfsmeta reads and writes the optional metadata of the UnixFS 1.5
+// nodes: the mode and the modification time of the files and directories, so
+// that their attributes are kept from the disk they are added from to the
+// disk they are retrieved to.
+//
+// The metadata are the fields 7 (mode) and 8 (mtime) of the UnixFS Data,
+// which the UnixFS implementation in use does not know of: they are encoded
+// and decoded here, the other fields being kept byte for byte. A node without
+// metadata is left as it is, with the same CID as before.
+package unixfsmeta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	dag "github.com/ipfs/go-merkledag"
+	ft "github.com/ipfs/go-unixfs"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// The fields of the UnixFS Data holding the metadata, the last ones.
+const (
+	fieldMode  = 7
+	fieldMtime = 8
+
+	// the fields of UnixTime
+	fieldSeconds = 1
+	fieldNanos   = 2
+)
+
+// The wire types of the protobuf fields.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// The POSIX mode bits, as stored.
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+	modePerm   = 0777
+)
+
+var errTruncated = errors.New("unixfsmeta: truncated UnixFS data")
+
+// Meta is the metadata of a UnixFS node.
+type Meta struct {
+	// Mode is the permissions of the node, with os.ModeSetuid,
+	// os.ModeSetgid and os.ModeSticky, if HasMode is set.
+	Mode    os.FileMode
+	HasMode bool
+	// ModTime is the modification time of the node, if not zero.
+	ModTime time.Time
+}
+
+// IsZero reports whether m holds no metadata.
+func (m Meta) IsZero() bool {
+	return !m.HasMode && m.ModTime.IsZero()
+}
+
+// FromFileInfo returns the metadata of fi: its mode if mode is set, and its
+// modification time if mtime is.
+func FromFileInfo(fi os.FileInfo, mode, mtime bool) Meta {
+	var m Meta
+	if fi == nil {
+		return m
+	}
+	if mode {
+		m.Mode = fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		m.HasMode = true
+	}
+	if mtime {
+		m.ModTime = fi.ModTime()
+	}
+	return m
+}
+
+// posixMode returns the POSIX bits of mode.
+func posixMode(mode os.FileMode) uint32 {
+	bits := uint32(mode & modePerm)
+	if mode&os.ModeSetuid != 0 {
+		bits |= modeSetuid
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= modeSetgid
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= modeSticky
+	}
+	return bits
+}
+
+// fileMode returns the mode of the POSIX bits. The bits of the file type are
+// ignored, the type being that of the node.
+func fileMode(bits uint32) os.FileMode {
+	mode := os.FileMode(bits & modePerm)
+	if bits&modeSetuid != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&modeSetgid != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&modeSticky != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// Get returns the metadata of nd. The nodes which are not UnixFS, as the raw
+// leaves, have none.
+func Get(nd ipld.Node) (Meta, error) {
+	pn, ok := nd.(*dag.ProtoNode)
+	if !ok {
+		return Meta{}, nil
+	}
+	return Decode(pn.Data())
+}
+
+// Decode returns the metadata of the UnixFS Data data.
+func Decode(data []byte) (Meta, error) {
+	var m Meta
+	err := forEachField(data, func(num, wire int, value uint64, field, payload []byte) error {
+		switch {
+		case num == fieldMode && wire == wireVarint:
+			m.Mode = fileMode(uint32(value))
+			m.HasMode = true
+		case num == fieldMtime && wire == wireBytes:
+			t, err := decodeTime(payload)
+			if err != nil {
+				return err
+			}
+			m.ModTime = t
+		}
+		return nil
+	})
+	return m, err
+}
+
+// decodeTime decodes a UnixTime.
+func decodeTime(data []byte) (time.Time, error) {
+	var sec int64
+	var nsec uint32
+	err := forEachField(data, func(num, wire int, value uint64, field, payload []byte) error {
+		switch {
+		case num == fieldSeconds && wire == wireVarint:
+			sec = int64(value)
+		case num == fieldNanos && wire == wireFixed32:
+			nsec = binary.LittleEndian.Uint32(payload)
+			if nsec >= uint32(time.Second) {
+				return fmt.Errorf("unixfsmeta: invalid mtime nanoseconds %d", nsec)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sec, int64(nsec)), nil
+}
+
+// Encode returns the UnixFS Data data with the metadata m in the place of
+// its own.
+func Encode(data []byte, m Meta) ([]byte, error) {
+	out := make([]byte, 0, len(data)+32)
+	err := forEachField(data, func(num, wire int, value uint64, field, payload []byte) error {
+		if num != fieldMode && num != fieldMtime {
+			out = append(out, field...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the metadata are the last fields, so that the encoding stays canonical
+	if m.HasMode {
+		out = appendTag(out, fieldMode, wireVarint)
+		out = appendUvarint(out, uint64(posixMode(m.Mode)))
+	}
+	if !m.ModTime.IsZero() {
+		var t []byte
+		t = appendTag(t, fieldSeconds, wireVarint)
+		t = appendUvarint(t, uint64(m.ModTime.Unix()))
+		if nsec := m.ModTime.Nanosecond(); nsec != 0 {
+			t = appendTag(t, fieldNanos, wireFixed32)
+			t = appendUint32(t, uint32(nsec))
+		}
+		out = appendTag(out, fieldMtime, wireBytes)
+		out = appendUvarint(out, uint64(len(t)))
+		out = append(out, t...)
+	}
+	return out, nil
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return appendUvarint(b, uint64(num<<3|wire))
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// forEachField calls f with every field of the protobuf message data: its
+// number, its wire type, its value for a varint, the bytes of the whole field
+// and its payload for the others.
+func forEachField(data []byte, f func(num, wire int, value uint64, field, payload []byte) error) error {
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncated
+		}
+		num, wire := int(tag>>3), int(tag&7)
+		rest := data[n:]
+
+		var value uint64
+		var payload []byte
+		switch wire {
+		case wireVarint:
+			value, n = binary.Uvarint(rest)
+			if n <= 0 {
+				return errTruncated
+			}
+		case wireFixed64, wireFixed32:
+			n = 8
+			if wire == wireFixed32 {
+				n = 4
+			}
+			if len(rest) < n {
+				return errTruncated
+			}
+			payload = rest[:n]
+		case wireBytes:
+			l, ln := binary.Uvarint(rest)
+			if ln <= 0 || uint64(len(rest)-ln) < l {
+				return errTruncated
+			}
+			n = ln + int(l)
+			payload = rest[ln:n]
+		default:
+			return fmt.Errorf("unixfsmeta: unsupported wire type %d of field %d", wire, num)
+		}
+
+		size := len(data) - len(rest) + n
+		if err := f(num, wire, value, data[:size], payload); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// Apply returns nd with the metadata m, nd itself if m is zero. A raw leaf,
+// which has no metadata, is linked to by a UnixFS file node holding them. The
+// node returned, unlike nd, is not added to any DAG service.
+func Apply(nd ipld.Node, m Meta) (ipld.Node, error) {
+	if m.IsZero() {
+		return nd, nil
+	}
+	switch nd := nd.(type) {
+	case *dag.ProtoNode:
+		out := nd.Copy().(*dag.ProtoNode)
+		if err := Set(out, m); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case *dag.RawNode:
+		size := uint64(len(nd.RawData()))
+		fsn := ft.NewFSNode(ft.TFile)
+		fsn.AddBlockSize(size)
+		data, err := fsn.GetBytes()
+		if err != nil {
+			return nil, err
+		}
+		fn := dag.NodeWithData(data)
+		prefix := nd.Cid().Prefix()
+		prefix.Codec = cid.DagProtobuf
+		if prefix.MhType == mh.IDENTITY {
+			// the node is no longer small enough to be inlined
+			prefix.MhType, prefix.MhLength = mh.SHA2_256, -1
+		}
+		fn.SetCidBuilder(prefix)
+		if err := fn.AddRawLink("", &ipld.Link{Size: size, Cid: nd.Cid()}); err != nil {
+			return nil, err
+		}
+		if err := Set(fn, m); err != nil {
+			return nil, err
+		}
+		return fn, nil
+	default:
+		return nil, fmt.Errorf("unixfsmeta: cannot set the metadata of a %T node", nd)
+	}
+}
+
+// Set sets the metadata of the UnixFS node nd to m.
+func Set(nd *dag.ProtoNode, m Meta) error {
+	data, err := Encode(nd.Data(), m)
+	if err != nil {
+		return err
+	}
+	nd.SetData(data)
+	return nil
+}
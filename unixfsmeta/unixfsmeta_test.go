@@ -0,0 +1,179 @@
+package unixfsmeta
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	dag "github.com/ipfs/go-merkledag"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	ft "github.com/ipfs/go-unixfs"
+)
+
+func TestEncode(t *testing.T) {
+	data := ft.FilePBData([]byte("hello"), 5)
+	for _, m := range []Meta{
+		{Mode: 0640, HasMode: true},
+		{Mode: 0755 | os.ModeSetuid | os.ModeSticky, HasMode: true, ModTime: time.Unix(981173106, 789)},
+		{ModTime: time.Unix(-1, 0)},
+		{Mode: 0, HasMode: true, ModTime: time.Unix(1600000000, 0)},
+	} {
+		enc, err := Encode(data, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.HasMode != m.HasMode || got.Mode != m.Mode || !got.ModTime.Equal(m.ModTime) {
+			t.Errorf("expected %+v, got %+v", m, got)
+		}
+
+		// the other fields are kept
+		fsn, err := ft.FSNodeFromBytes(enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsn.Type() != ft.TFile || string(fsn.Data()) != "hello" || fsn.FileSize() != 5 {
+			t.Errorf("expected the file kept, got %s of %q", fsn.Type(), fsn.Data())
+		}
+
+		// the metadata are replaced, and removed
+		again, err := Encode(enc, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(again, enc) {
+			t.Error("expected the same encoding")
+		}
+		stripped, err := Encode(enc, Meta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(stripped, data) {
+			t.Error("expected the metadata removed")
+		}
+	}
+
+	if _, err := Decode(data[:len(data)-1]); err == nil {
+		t.Error("expected truncated data refused")
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock()
+	m := Meta{Mode: 0600, HasMode: true, ModTime: time.Unix(1600000000, 5)}
+
+	raw := dag.NewRawNode([]byte("raw leaf"))
+	if err := dserv.Add(ctx, raw); err != nil {
+		t.Fatal(err)
+	}
+	if nd, err := Apply(raw, Meta{}); err != nil || nd != raw {
+		t.Fatal("expected the node left alone without metadata")
+	}
+	nd, err := Apply(raw, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dserv.Add(ctx, nd); err != nil {
+		t.Fatal(err)
+	}
+	if nd.Cid().Prefix().Version != 1 {
+		t.Error("expected the CID version of the raw leaf")
+	}
+
+	f, err := NewFile(ctx, dserv, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := Of(f)
+	if got.Mode != m.Mode || !got.ModTime.Equal(m.ModTime) {
+		t.Errorf("expected %+v, got %+v", m, got)
+	}
+	data, err := io.ReadAll(f.(files.File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "raw leaf" {
+		t.Errorf("expected the data of the leaf, got %q", data)
+	}
+}
+
+func TestTar(t *testing.T) {
+	ctx := context.Background()
+	dserv := mdtest.Mock()
+	m := Meta{Mode: 0750, HasMode: true, ModTime: time.Unix(1600000000, 123456789)}
+
+	file := dag.NodeWithData(ft.FilePBData([]byte("file"), 4))
+	if err := Set(file, Meta{ModTime: m.ModTime}); err != nil {
+		t.Fatal(err)
+	}
+	plain := dag.NodeWithData(ft.FilePBData([]byte("plain"), 5))
+	dir := ft.EmptyDirNode()
+	if err := Set(dir, m); err != nil {
+		t.Fatal(err)
+	}
+	for name, nd := range map[string]*dag.ProtoNode{"file": file, "plain": plain} {
+		if err := dserv.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := dir.AddNodeLink(name, nd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dserv.Add(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Get(dir); err != nil || got.Mode != m.Mode {
+		t.Fatalf("expected the metadata kept with the links, got %+v, %v", got, err)
+	}
+
+	f, err := NewFile(ctx, dserv, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w := NewTarWriter(&buf)
+	w.Mark = true
+	if err := w.WriteFile(f, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Meta{
+		"root":       m,
+		"root/file":  {ModTime: m.ModTime},
+		"root/plain": {},
+	}
+	tr := tar.NewReader(&buf)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, ok := expected[h.Name]
+		if !ok {
+			t.Fatalf("unexpected entry %s", h.Name)
+		}
+		delete(expected, h.Name)
+		got := FromHeader(h)
+		if got.HasMode != exp.HasMode || got.Mode != exp.Mode || !got.ModTime.Equal(exp.ModTime) {
+			t.Errorf("%s: expected %+v, got %+v", h.Name, exp, got)
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("missing entries %v", expected)
+	}
+}
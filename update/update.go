@@ -0,0 +1,207 @@
+// Package update checks the distribution site for newer versions of go-ipfs.
+//
+// The checker only reports that a version is available, with a log line, its
+// status and a metric: nothing is ever downloaded or installed.
+package update
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	gopath "path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver/v4"
+	files "github.com/ipfs/go-ipfs-files"
+	ipld "github.com/ipfs/go-ipld-format"
+	logging "github.com/ipfs/go-log"
+	namesys "github.com/ipfs/go-namesys"
+	resolver "github.com/ipfs/go-path/resolver"
+	unixfile "github.com/ipfs/go-unixfs/file"
+
+	config "github.com/ipfs/go-ipfs/config"
+	"github.com/ipfs/go-ipfs/repo/fsrepo/migrations"
+)
+
+var log = logging.Logger("update")
+
+const (
+	// distName is the name of go-ipfs on the distribution site.
+	distName = "go-ipfs"
+	// httpUserAgent is the user agent of the checks over HTTP.
+	httpUserAgent = "go-ipfs"
+	// fetchLimit bounds the size of the files fetched from the site.
+	fetchLimit = 1 << 20
+)
+
+// Status is the outcome of the last check.
+type Status struct {
+	// Current is the version running.
+	Current string
+	// Latest is the latest version on the distribution site.
+	Latest string `json:",omitempty"`
+	// Available is true if Latest is newer than Current.
+	Available bool
+	// Checked is when the check was made, zero if it was not yet.
+	Checked time.Time
+	// Error is why the check failed, if it did.
+	Error string `json:",omitempty"`
+}
+
+// Checker checks the distribution site for newer versions than the running
+// one.
+type Checker struct {
+	fetcher migrations.Fetcher
+	current semver.Version
+
+	mu       sync.Mutex
+	status   Status
+	notified string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a checker for versions newer than current, fetching the
+// distribution site with fetcher.
+func New(current string, fetcher migrations.Fetcher) (*Checker, error) {
+	v, err := semver.ParseTolerant(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version %q: %w", current, err)
+	}
+	c := &Checker{
+		fetcher: fetcher,
+		current: v,
+		status:  Status{Current: v.String()},
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// Check checks for a newer version now.
+func (c *Checker) Check(ctx context.Context) (Status, error) {
+	// release candidates are only offered to release candidates
+	stableOnly := !strings.Contains(c.current.String(), "-rc")
+
+	st := Status{Current: c.current.String(), Checked: time.Now()}
+	latest, err := migrations.LatestDistVersion(ctx, c.fetcher, distName, stableOnly)
+	var v semver.Version
+	if err == nil {
+		v, err = semver.ParseTolerant(latest)
+	}
+	if err != nil {
+		st.Error = err.Error()
+	} else {
+		st.Latest = v.String()
+		st.Available = v.GT(c.current)
+	}
+
+	c.mu.Lock()
+	c.status = st
+	notify := st.Available && st.Latest != c.notified
+	if notify {
+		c.notified = st.Latest
+	}
+	c.mu.Unlock()
+
+	if notify {
+		log.Warnf("go-ipfs %s is available, this node runs %s: https://dist.ipfs.io/#go-ipfs", st.Latest, st.Current)
+	}
+	return st, err
+}
+
+// Status returns the outcome of the last check.
+func (c *Checker) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// Run checks for a newer version now and every interval, until the checker
+// is closed.
+func (c *Checker) Run(interval time.Duration) {
+	c.wg.Add(1)
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Check(c.ctx); err != nil && c.ctx.Err() == nil {
+			log.Infof("checking for a newer version: %s", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the checker.
+func (c *Checker) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return c.fetcher.Close()
+}
+
+// DistPath returns the distribution site of cfg, or else the one of the
+// IPFS_DIST_PATH environment variable, or else the default one.
+func DistPath(cfg config.Update) string {
+	return cfg.DistPath.WithDefault(migrations.GetDistPathEnv(migrations.LatestIpfsDist))
+}
+
+// NewFetcher returns a fetcher of the distribution site at distPath, over
+// IPFS with the name system, resolver and DAG of a node, or else over HTTP.
+func NewFetcher(distPath string, ns namesys.NameSystem, r *resolver.Resolver, dag ipld.DAGService) migrations.Fetcher {
+	return migrations.NewMultiFetcher(
+		&nodeFetcher{distPath: distPath, ns: ns, resolver: r, dag: dag},
+		migrations.NewHttpFetcher(distPath, "", httpUserAgent, fetchLimit),
+	)
+}
+
+// nodeFetcher fetches the files of the distribution site over IPFS.
+type nodeFetcher struct {
+	distPath string
+	ns       namesys.NameSystem
+	resolver *resolver.Resolver
+	dag      ipld.DAGService
+}
+
+func (f *nodeFetcher) Fetch(ctx context.Context, filePath string) ([]byte, error) {
+	p, err := f.ns.Resolve(ctx, gopath.Join(f.distPath, filePath))
+	if err != nil {
+		return nil, err
+	}
+	c, rest, err := f.resolver.ResolveToLastNode(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+
+	nd, err := f.dag.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	node, err := unixfile.NewUnixfsFile(ctx, f.dag, nd)
+	if err != nil {
+		return nil, err
+	}
+	defer node.Close()
+	file, ok := node.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a file", p)
+	}
+	return ioutil.ReadAll(io.LimitReader(file, fetchLimit))
+}
+
+func (f *nodeFetcher) Close() error {
+	return nil
+}
+
+var _ migrations.Fetcher = (*nodeFetcher)(nil)
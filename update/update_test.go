@@ -0,0 +1,68 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type mockFetcher struct {
+	versions string
+	err      error
+}
+
+func (f *mockFetcher) Fetch(ctx context.Context, filePath string) ([]byte, error) {
+	if filePath != "go-ipfs/versions" {
+		return nil, errors.New("unexpected path " + filePath)
+	}
+	return []byte(f.versions), f.err
+}
+
+func (f *mockFetcher) Close() error {
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		current   string
+		versions  string
+		latest    string
+		available bool
+	}{
+		{"0.12.0", "v0.11.0\nv0.12.0\n", "0.12.0", false},
+		{"0.12.0", "v0.12.0\nv0.13.0-rc1\n", "0.12.0", false},
+		{"0.12.0", "v0.12.0\nv0.13.0\n", "0.13.0", true},
+		{"0.13.0-dev", "v0.12.0\nv0.13.0-rc1\n", "0.12.0", false},
+		{"0.13.0-rc1", "v0.12.0\nv0.13.0-rc1\nv0.13.0-rc2\n", "0.13.0-rc2", true},
+		{"0.13.0-rc2", "v0.12.0\nv0.13.0-rc1\nv0.13.0\n", "0.13.0", true},
+	} {
+		c, err := New(tc.current, &mockFetcher{versions: tc.versions})
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := c.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Latest != tc.latest || st.Available != tc.available {
+			t.Errorf("%s with %q: expected %s (available: %t), got %s (available: %t)",
+				tc.current, tc.versions, tc.latest, tc.available, st.Latest, st.Available)
+		}
+		if c.Status() != st {
+			t.Errorf("%s: status not kept", tc.current)
+		}
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	c, err := New("0.12.0", &mockFetcher{err: errors.New("unreachable")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Check(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	if st := c.Status(); st.Error == "" || st.Checked.IsZero() || st.Available {
+		t.Fatalf("unexpected status %+v", st)
+	}
+}